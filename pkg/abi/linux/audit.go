@@ -21,3 +21,194 @@ const (
 	// AUDIT_ARCH_AARCH64 identifies ARM64.
 	AUDIT_ARCH_AARCH64 = 0xc00000b7
 )
+
+// Netlink audit message types, from <uapi/linux/audit.h>.
+const (
+	AUDIT_GET             = 1000
+	AUDIT_SET             = 1001
+	AUDIT_LIST            = 1002
+	AUDIT_ADD             = 1003
+	AUDIT_DEL             = 1004
+	AUDIT_USER            = 1005
+	AUDIT_LOGIN           = 1006
+	AUDIT_WATCH_INS       = 1007
+	AUDIT_WATCH_REM       = 1008
+	AUDIT_WATCH_LIST      = 1009
+	AUDIT_SIGNAL_INFO     = 1010
+	AUDIT_ADD_RULE        = 1011
+	AUDIT_DEL_RULE        = 1012
+	AUDIT_LIST_RULES      = 1013
+	AUDIT_TRIM            = 1014
+	AUDIT_MAKE_EQUIV      = 1015
+	AUDIT_TTY_GET         = 1016
+	AUDIT_TTY_SET         = 1017
+	AUDIT_SET_FEATURE     = 1018
+	AUDIT_GET_FEATURE     = 1019
+	AUDIT_FIRST_USER_MSG  = 1100
+	AUDIT_USER_AVC        = 1107
+	AUDIT_LAST_USER_MSG   = 1199
+	AUDIT_FIRST_USER_MSG2 = 2100
+	AUDIT_LAST_USER_MSG2  = 2999
+)
+
+// Audit record types, from <uapi/linux/audit.h>.
+const (
+	AUDIT_SYSCALL       = 1300
+	AUDIT_PATH          = 1302
+	AUDIT_CONFIG_CHANGE = 1305
+	AUDIT_CWD           = 1307
+	AUDIT_EXECVE        = 1309
+	AUDIT_EOE           = 1320
+)
+
+// Audit netlink multicast groups, from <uapi/linux/audit.h>.
+const (
+	AUDIT_NLGRP_NONE    = 0
+	AUDIT_NLGRP_READLOG = 1
+)
+
+// Audit failure actions, used in AuditStatus.Failure.
+const (
+	AUDIT_FAIL_SILENT = 0
+	AUDIT_FAIL_PRINTK = 1
+	AUDIT_FAIL_PANIC  = 2
+)
+
+// Audit status mask bits, used in AuditStatus.Mask.
+const (
+	AUDIT_STATUS_ENABLED                  = 0x0001
+	AUDIT_STATUS_FAILURE                  = 0x0002
+	AUDIT_STATUS_PID                      = 0x0004
+	AUDIT_STATUS_RATE_LIMIT               = 0x0008
+	AUDIT_STATUS_BACKLOG_LIMIT            = 0x0010
+	AUDIT_STATUS_BACKLOG_WAIT_TIME        = 0x0020
+	AUDIT_STATUS_LOST                     = 0x0040
+	AUDIT_STATUS_BACKLOG_WAIT_TIME_ACTUAL = 0x0080
+)
+
+// Audit feature bits, reported in AuditStatus.FeatureBitmap.
+const (
+	AUDIT_FEATURE_BITMAP_BACKLOG_LIMIT     = 0x00000001
+	AUDIT_FEATURE_BITMAP_BACKLOG_WAIT_TIME = 0x00000002
+	AUDIT_FEATURE_BITMAP_EXECUTABLE_PATH   = 0x00000004
+	AUDIT_FEATURE_BITMAP_EXCLUDE_EXTEND    = 0x00000008
+	AUDIT_FEATURE_BITMAP_SESSIONID_FILTER  = 0x00000010
+	AUDIT_FEATURE_BITMAP_LOST_RESET        = 0x00000020
+	AUDIT_FEATURE_BITMAP_FILTER_FS         = 0x00000040
+)
+
+// Audit features set by AUDIT_SET_FEATURE, from <uapi/linux/audit.h>.
+const (
+	AUDIT_FEATURE_VERSION             = 1
+	AUDIT_FEATURE_ONLY_UNSET_LOGINUID = 0
+	AUDIT_FEATURE_LOGINUID_IMMUTABLE  = 1
+	AUDIT_LAST_FEATURE                = AUDIT_FEATURE_LOGINUID_IMMUTABLE
+)
+
+// Audit rule filter lists, from <uapi/linux/audit.h>.
+const (
+	AUDIT_FILTER_USER    = 0x00
+	AUDIT_FILTER_TASK    = 0x01
+	AUDIT_FILTER_ENTRY   = 0x02
+	AUDIT_FILTER_WATCH   = 0x03
+	AUDIT_FILTER_EXIT    = 0x04
+	AUDIT_FILTER_EXCLUDE = 0x05
+	AUDIT_FILTER_FS      = 0x06
+	AUDIT_NR_FILTERS     = 7
+)
+
+// Audit rule actions, from <uapi/linux/audit.h>.
+const (
+	AUDIT_NEVER    = 0
+	AUDIT_POSSIBLE = 1
+	AUDIT_ALWAYS   = 2
+)
+
+// Audit rule fields, from <uapi/linux/audit.h>.
+const (
+	AUDIT_PID          = 0
+	AUDIT_UID          = 1
+	AUDIT_EUID         = 2
+	AUDIT_SUID         = 3
+	AUDIT_FSUID        = 4
+	AUDIT_GID          = 5
+	AUDIT_EGID         = 6
+	AUDIT_SGID         = 7
+	AUDIT_FSGID        = 8
+	AUDIT_LOGINUID     = 9
+	AUDIT_PERS         = 10
+	AUDIT_ARCH         = 11
+	AUDIT_MSGTYPE      = 12
+	AUDIT_PPID         = 18
+	AUDIT_LOGINUID_SET = 24
+	AUDIT_SESSIONID    = 25
+	AUDIT_DEVMAJOR     = 100
+	AUDIT_DEVMINOR     = 101
+	AUDIT_INODE        = 102
+	AUDIT_EXIT         = 103
+	AUDIT_SUCCESS      = 104
+	AUDIT_WATCH        = 105
+	AUDIT_PERM         = 106
+	AUDIT_DIR          = 107
+	AUDIT_FILETYPE     = 108
+	AUDIT_EXE          = 112
+	AUDIT_ARG0         = 200
+	AUDIT_ARG1         = AUDIT_ARG0 + 1
+	AUDIT_ARG2         = AUDIT_ARG0 + 2
+	AUDIT_ARG3         = AUDIT_ARG0 + 3
+	AUDIT_FILTERKEY    = 210
+)
+
+// Audit rule field operators, from <uapi/linux/audit.h>.
+const (
+	AUDIT_BIT_MASK              = 0x08000000
+	AUDIT_LESS_THAN             = 0x10000000
+	AUDIT_GREATER_THAN          = 0x20000000
+	AUDIT_NOT_EQUAL             = 0x30000000
+	AUDIT_EQUAL                 = 0x40000000
+	AUDIT_BIT_TEST              = AUDIT_BIT_MASK | AUDIT_EQUAL
+	AUDIT_LESS_THAN_OR_EQUAL    = AUDIT_LESS_THAN | AUDIT_EQUAL
+	AUDIT_GREATER_THAN_OR_EQUAL = AUDIT_GREATER_THAN | AUDIT_EQUAL
+	AUDIT_OPERATORS             = AUDIT_EQUAL | AUDIT_NOT_EQUAL | AUDIT_BIT_MASK
+)
+
+// Audit rule limits, from <uapi/linux/audit.h>.
+const (
+	AUDIT_MAX_FIELDS   = 64
+	AUDIT_MAX_KEY_LEN  = 256
+	AUDIT_BITMASK_SIZE = 64
+)
+
+// AUDIT_SID_UNSET is the audit session ID of tasks without a login UID.
+const AUDIT_SID_UNSET = ^uint32(0)
+
+// AuditStatus is equivalent to struct audit_status.
+//
+// +marshal
+type AuditStatus struct {
+	Mask                  uint32
+	Enabled               uint32
+	Failure               uint32
+	PID                   uint32
+	RateLimit             uint32
+	BacklogLimit          uint32
+	Lost                  uint32
+	Backlog               uint32
+	FeatureBitmap         uint32
+	BacklogWaitTime       uint32
+	BacklogWaitTimeActual uint32
+}
+
+// AuditFeatures is equivalent to struct audit_features.
+//
+// +marshal
+type AuditFeatures struct {
+	Vers     uint32
+	Mask     uint32
+	Features uint32
+	Lock     uint32
+}
+
+// AuditRuleDataSize is the size of struct audit_rule_data, excluding the
+// trailing strings buffer.
+const AuditRuleDataSize = 4*3 + 4*AUDIT_BITMASK_SIZE + 4*AUDIT_MAX_FIELDS*3 + 4
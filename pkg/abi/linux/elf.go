@@ -107,6 +107,24 @@ const (
 	NT_ARM_TLS = 0x401
 )
 
+// ELF program properties, found in PT_GNU_PROPERTY segments.
+//
+// See include/uapi/linux/elf.h.
+const (
+	// NT_GNU_PROPERTY_TYPE_0 is the type of the note containing program
+	// properties.
+	NT_GNU_PROPERTY_TYPE_0 = 5
+
+	// GNU_PROPERTY_AARCH64_FEATURE_1_AND is the property holding AArch64
+	// features required by the program.
+	GNU_PROPERTY_AARCH64_FEATURE_1_AND = 0xc0000000
+
+	// GNU_PROPERTY_AARCH64_FEATURE_1_BTI is set in
+	// GNU_PROPERTY_AARCH64_FEATURE_1_AND if the program is compatible with
+	// Branch Target Identification.
+	GNU_PROPERTY_AARCH64_FEATURE_1_BTI = 1 << 0
+)
+
 // ElfHeader64 is the ELF64 file header.
 //
 // +marshal
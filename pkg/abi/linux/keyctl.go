@@ -0,0 +1,76 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+// Special key IDs, from include/uapi/linux/keyctl.h.
+const (
+	KEY_SPEC_THREAD_KEYRING       = -1
+	KEY_SPEC_PROCESS_KEYRING      = -2
+	KEY_SPEC_SESSION_KEYRING      = -3
+	KEY_SPEC_USER_KEYRING         = -4
+	KEY_SPEC_USER_SESSION_KEYRING = -5
+	KEY_SPEC_GROUP_KEYRING        = -6
+	KEY_SPEC_REQKEY_AUTH_KEY      = -7
+)
+
+// Operations for keyctl(2), from include/uapi/linux/keyctl.h.
+const (
+	KEYCTL_GET_KEYRING_ID       = 0
+	KEYCTL_JOIN_SESSION_KEYRING = 1
+	KEYCTL_UPDATE               = 2
+	KEYCTL_REVOKE               = 3
+	KEYCTL_CHOWN                = 4
+	KEYCTL_SETPERM              = 5
+	KEYCTL_DESCRIBE             = 6
+	KEYCTL_CLEAR                = 7
+	KEYCTL_LINK                 = 8
+	KEYCTL_UNLINK               = 9
+	KEYCTL_SEARCH               = 10
+	KEYCTL_READ                 = 11
+	KEYCTL_INSTANTIATE          = 12
+	KEYCTL_NEGATE               = 13
+	KEYCTL_SET_REQKEY_KEYRING   = 14
+	KEYCTL_SET_TIMEOUT          = 15
+	KEYCTL_ASSUME_AUTHORITY     = 16
+	KEYCTL_GET_SECURITY         = 17
+	KEYCTL_SESSION_TO_PARENT    = 18
+	KEYCTL_REJECT               = 19
+	KEYCTL_INSTANTIATE_IOV      = 20
+	KEYCTL_INVALIDATE           = 21
+	KEYCTL_GET_PERSISTENT       = 22
+)
+
+// Key permissions, from include/uapi/linux/keyctl.h. Each permission is
+// granted separately to the possessor of the key, its owner, its group and
+// everyone else.
+const (
+	KEY_VIEW    = 0x01
+	KEY_READ    = 0x02
+	KEY_WRITE   = 0x04
+	KEY_SEARCH  = 0x08
+	KEY_LINK    = 0x10
+	KEY_SETATTR = 0x20
+	KEY_ALL     = 0x3f
+
+	KEY_POS_SHIFT = 24
+	KEY_USR_SHIFT = 16
+	KEY_GRP_SHIFT = 8
+	KEY_OTH_SHIFT = 0
+
+	KEY_POS_ALL = KEY_ALL << KEY_POS_SHIFT
+	KEY_USR_ALL = KEY_ALL << KEY_USR_SHIFT
+	KEY_GRP_ALL = KEY_ALL << KEY_GRP_SHIFT
+	KEY_OTH_ALL = KEY_ALL << KEY_OTH_SHIFT
+)
@@ -14,6 +14,8 @@ import (
 )
 
 // Marshallable types used by this file.
+var _ marshal.Marshallable = (*AuditFeatures)(nil)
+var _ marshal.Marshallable = (*AuditStatus)(nil)
 var _ marshal.Marshallable = (*BPFInstruction)(nil)
 var _ marshal.Marshallable = (*CString)(nil)
 var _ marshal.Marshallable = (*CapUserData)(nil)
@@ -416,6 +418,244 @@ func (i *IOEvent) WriteTo(writer io.Writer) (int64, error) {
 	return int64(length), err
 }
 
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (a *AuditFeatures) SizeBytes() int {
+	return 16
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (a *AuditFeatures) MarshalBytes(dst []byte) []byte {
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.Vers))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.Mask))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.Features))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.Lock))
+	dst = dst[4:]
+	return dst
+}
+
+// UnmarshalBytes implements marshal.Marshallable.UnmarshalBytes.
+func (a *AuditFeatures) UnmarshalBytes(src []byte) []byte {
+	a.Vers = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.Mask = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.Features = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.Lock = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	return src
+}
+
+// Packed implements marshal.Marshallable.Packed.
+//
+//go:nosplit
+func (a *AuditFeatures) Packed() bool {
+	return true
+}
+
+// MarshalUnsafe implements marshal.Marshallable.MarshalUnsafe.
+func (a *AuditFeatures) MarshalUnsafe(dst []byte) []byte {
+	size := a.SizeBytes()
+	gohacks.Memmove(unsafe.Pointer(&dst[0]), unsafe.Pointer(a), uintptr(size))
+	return dst[size:]
+}
+
+// UnmarshalUnsafe implements marshal.Marshallable.UnmarshalUnsafe.
+func (a *AuditFeatures) UnmarshalUnsafe(src []byte) []byte {
+	size := a.SizeBytes()
+	gohacks.Memmove(unsafe.Pointer(a), unsafe.Pointer(&src[0]), uintptr(size))
+	return src[size:]
+}
+
+// CopyOutN implements marshal.Marshallable.CopyOutN.
+func (a *AuditFeatures) CopyOutN(cc marshal.CopyContext, addr hostarch.Addr, limit int) (int, error) {
+	// Construct a slice backed by dst's underlying memory.
+	var buf []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	hdr.Data = uintptr(gohacks.Noescape(unsafe.Pointer(a)))
+	hdr.Len = a.SizeBytes()
+	hdr.Cap = a.SizeBytes()
+
+	length, err := cc.CopyOutBytes(addr, buf[:limit]) // escapes: okay.
+	// Since we bypassed the compiler's escape analysis, indicate that a
+	// must live until the use above.
+	runtime.KeepAlive(a) // escapes: replaced by intrinsic.
+	return length, err
+}
+
+// CopyOut implements marshal.Marshallable.CopyOut.
+func (a *AuditFeatures) CopyOut(cc marshal.CopyContext, addr hostarch.Addr) (int, error) {
+	return a.CopyOutN(cc, addr, a.SizeBytes())
+}
+
+// CopyIn implements marshal.Marshallable.CopyIn.
+func (a *AuditFeatures) CopyIn(cc marshal.CopyContext, addr hostarch.Addr) (int, error) {
+	// Construct a slice backed by dst's underlying memory.
+	var buf []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	hdr.Data = uintptr(gohacks.Noescape(unsafe.Pointer(a)))
+	hdr.Len = a.SizeBytes()
+	hdr.Cap = a.SizeBytes()
+
+	length, err := cc.CopyInBytes(addr, buf) // escapes: okay.
+	// Since we bypassed the compiler's escape analysis, indicate that a
+	// must live until the use above.
+	runtime.KeepAlive(a) // escapes: replaced by intrinsic.
+	return length, err
+}
+
+// WriteTo implements io.WriterTo.WriteTo.
+func (a *AuditFeatures) WriteTo(writer io.Writer) (int64, error) {
+	// Construct a slice backed by dst's underlying memory.
+	var buf []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	hdr.Data = uintptr(gohacks.Noescape(unsafe.Pointer(a)))
+	hdr.Len = a.SizeBytes()
+	hdr.Cap = a.SizeBytes()
+
+	length, err := writer.Write(buf)
+	// Since we bypassed the compiler's escape analysis, indicate that a
+	// must live until the use above.
+	runtime.KeepAlive(a) // escapes: replaced by intrinsic.
+	return int64(length), err
+}
+
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (a *AuditStatus) SizeBytes() int {
+	return 44
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (a *AuditStatus) MarshalBytes(dst []byte) []byte {
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.Mask))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.Enabled))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.Failure))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.PID))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.RateLimit))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.BacklogLimit))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.Lost))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.Backlog))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.FeatureBitmap))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.BacklogWaitTime))
+	dst = dst[4:]
+	hostarch.ByteOrder.PutUint32(dst[:4], uint32(a.BacklogWaitTimeActual))
+	dst = dst[4:]
+	return dst
+}
+
+// UnmarshalBytes implements marshal.Marshallable.UnmarshalBytes.
+func (a *AuditStatus) UnmarshalBytes(src []byte) []byte {
+	a.Mask = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.Enabled = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.Failure = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.PID = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.RateLimit = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.BacklogLimit = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.Lost = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.Backlog = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.FeatureBitmap = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.BacklogWaitTime = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	a.BacklogWaitTimeActual = uint32(hostarch.ByteOrder.Uint32(src[:4]))
+	src = src[4:]
+	return src
+}
+
+// Packed implements marshal.Marshallable.Packed.
+//
+//go:nosplit
+func (a *AuditStatus) Packed() bool {
+	return true
+}
+
+// MarshalUnsafe implements marshal.Marshallable.MarshalUnsafe.
+func (a *AuditStatus) MarshalUnsafe(dst []byte) []byte {
+	size := a.SizeBytes()
+	gohacks.Memmove(unsafe.Pointer(&dst[0]), unsafe.Pointer(a), uintptr(size))
+	return dst[size:]
+}
+
+// UnmarshalUnsafe implements marshal.Marshallable.UnmarshalUnsafe.
+func (a *AuditStatus) UnmarshalUnsafe(src []byte) []byte {
+	size := a.SizeBytes()
+	gohacks.Memmove(unsafe.Pointer(a), unsafe.Pointer(&src[0]), uintptr(size))
+	return src[size:]
+}
+
+// CopyOutN implements marshal.Marshallable.CopyOutN.
+func (a *AuditStatus) CopyOutN(cc marshal.CopyContext, addr hostarch.Addr, limit int) (int, error) {
+	// Construct a slice backed by dst's underlying memory.
+	var buf []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	hdr.Data = uintptr(gohacks.Noescape(unsafe.Pointer(a)))
+	hdr.Len = a.SizeBytes()
+	hdr.Cap = a.SizeBytes()
+
+	length, err := cc.CopyOutBytes(addr, buf[:limit]) // escapes: okay.
+	// Since we bypassed the compiler's escape analysis, indicate that a
+	// must live until the use above.
+	runtime.KeepAlive(a) // escapes: replaced by intrinsic.
+	return length, err
+}
+
+// CopyOut implements marshal.Marshallable.CopyOut.
+func (a *AuditStatus) CopyOut(cc marshal.CopyContext, addr hostarch.Addr) (int, error) {
+	return a.CopyOutN(cc, addr, a.SizeBytes())
+}
+
+// CopyIn implements marshal.Marshallable.CopyIn.
+func (a *AuditStatus) CopyIn(cc marshal.CopyContext, addr hostarch.Addr) (int, error) {
+	// Construct a slice backed by dst's underlying memory.
+	var buf []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	hdr.Data = uintptr(gohacks.Noescape(unsafe.Pointer(a)))
+	hdr.Len = a.SizeBytes()
+	hdr.Cap = a.SizeBytes()
+
+	length, err := cc.CopyInBytes(addr, buf) // escapes: okay.
+	// Since we bypassed the compiler's escape analysis, indicate that a
+	// must live until the use above.
+	runtime.KeepAlive(a) // escapes: replaced by intrinsic.
+	return length, err
+}
+
+// WriteTo implements io.WriterTo.WriteTo.
+func (a *AuditStatus) WriteTo(writer io.Writer) (int64, error) {
+	// Construct a slice backed by dst's underlying memory.
+	var buf []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	hdr.Data = uintptr(gohacks.Noescape(unsafe.Pointer(a)))
+	hdr.Len = a.SizeBytes()
+	hdr.Cap = a.SizeBytes()
+
+	length, err := writer.Write(buf)
+	// Since we bypassed the compiler's escape analysis, indicate that a
+	// must live until the use above.
+	runtime.KeepAlive(a) // escapes: replaced by intrinsic.
+	return int64(length), err
+}
+
 // SizeBytes implements marshal.Marshallable.SizeBytes.
 func (b *BPFInstruction) SizeBytes() int {
 	return 8
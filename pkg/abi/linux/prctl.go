@@ -145,6 +145,14 @@ const (
 	// Protection eXtensions (MPX) bounds tables.
 	PR_MPX_DISABLE_MANAGEMENT = 44
 
+	// PR_SET_MDWE sets the memory-deny-write-execute policy of the calling
+	// process.
+	PR_SET_MDWE = 65
+
+	// PR_GET_MDWE gets the memory-deny-write-execute policy of the calling
+	// process.
+	PR_GET_MDWE = 66
+
 	// The following constants are used to control thread scheduling on cores.
 	PR_SCHED_CORE_SCOPE_THREAD       = 0
 	PR_SCHED_CORE_SCOPE_THREAD_GROUP = 1
@@ -165,6 +173,12 @@ const (
 	ARCH_SET_CPUID = 0x1012
 )
 
+// Flags for prctl(PR_SET_MDWE), defined in include/uapi/linux/prctl.h.
+const (
+	PR_MDWE_REFUSE_EXEC_GAIN = 1 << 0
+	PR_MDWE_NO_INHERIT       = 1 << 1
+)
+
 // Flags for prctl(PR_SET_DUMPABLE), defined in include/linux/sched/coredump.h.
 const (
 	SUID_DUMP_DISABLE = 0
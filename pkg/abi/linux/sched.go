@@ -29,6 +29,10 @@ const (
 	SCHED_RESET_ON_FORK = 0x40000000
 )
 
+// MAX_RT_PRIO is the number of real-time priorities: SCHED_FIFO and SCHED_RR
+// priorities are between 1 and MAX_RT_PRIO-1.
+const MAX_RT_PRIO = 100
+
 // Scheduling priority group selectors.
 const (
 	PRIO_PGRP    = 0x1
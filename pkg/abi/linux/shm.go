@@ -32,6 +32,14 @@ const (
 	SHM_NORESERVE = 010000 // Don't check for reservations.
 )
 
+// shmget(2) SHM_HUGETLB page size encoding. Source: include/uapi/linux/shm.h
+const (
+	SHM_HUGE_SHIFT = 26
+	SHM_HUGE_MASK  = 0x3f
+	SHM_HUGE_2MB   = 21 << SHM_HUGE_SHIFT
+	SHM_HUGE_1GB   = 30 << SHM_HUGE_SHIFT
+)
+
 // Additional Linux-only flags for shmctl(2). Source: include/uapi/linux/shm.h
 const (
 	SHM_LOCK   = 11
@@ -49,6 +57,10 @@ const (
 	SHMSEG = 4096
 )
 
+// IPCMNI is the maximum number of SysV IPC objects of each kind, and the upper
+// bound of SHMMNI. Source: include/linux/ipc_namespace.h
+const IPCMNI = 32768
+
 // ShmidDS is equivalent to struct shmid64_ds. Source:
 // include/uapi/asm-generic/shmbuf.h
 //
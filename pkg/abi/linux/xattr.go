@@ -34,4 +34,7 @@ const (
 
 	XATTR_USER_PREFIX     = "user."
 	XATTR_USER_PREFIX_LEN = len(XATTR_USER_PREFIX)
+
+	XATTR_SELINUX_SUFFIX = "selinux"
+	XATTR_NAME_SELINUX   = XATTR_SECURITY_PREFIX + XATTR_SELINUX_SUFFIX
 )
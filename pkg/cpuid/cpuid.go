@@ -116,6 +116,48 @@ func FeatureFromString(s string) (Feature, bool) {
 	return feature, ok
 }
 
+// ParseFeatureMask parses a comma-separated list of features to hide, each
+// prefixed with "-", e.g. "-avx512f,-rtm,-hle".
+func ParseFeatureMask(s string) ([]Feature, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var features []Feature
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		hidden, ok := strings.CutPrefix(name, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid CPU feature %q: only hiding features, with a \"-\" prefix, is supported", name)
+		}
+		feature, ok := FeatureFromString(hidden)
+		if !ok {
+			return nil, fmt.Errorf("unknown CPU feature %q", hidden)
+		}
+		features = append(features, feature)
+	}
+	return features, nil
+}
+
+// withDependents returns the set of features along with all features that
+// depend on them.
+func withDependents(features []Feature) map[Feature]struct{} {
+	set := make(map[Feature]struct{})
+	var add func(Feature)
+	add = func(feature Feature) {
+		if _, ok := set[feature]; ok {
+			return
+		}
+		set[feature] = struct{}{}
+		for _, dep := range featureDependents[feature] {
+			add(dep)
+		}
+	}
+	for _, feature := range features {
+		add(feature)
+	}
+	return set
+}
+
 // AllFeatures returns the full set of all possible features.
 func AllFeatures() (features []Feature) {
 	archFlagOrder(func(f Feature) {
@@ -158,6 +200,62 @@ func (fs FeatureSet) FlagString() string {
 	return strings.Join(s, " ")
 }
 
+// CacheType describes the type of a cache, as returned in eax[4:0] for eax=4.
+type CacheType uint8
+
+const (
+	// cacheNull indicates that there are no more entries.
+	cacheNull CacheType = iota
+
+	// CacheData is a data cache.
+	CacheData
+
+	// CacheInstruction is an instruction cache.
+	CacheInstruction
+
+	// CacheUnified is a unified instruction and data cache.
+	CacheUnified
+)
+
+// Cache describes the parameters of a single cache on the system.
+//
+// This is returned by the Caches method on FeatureSet.
+type Cache struct {
+	// Level is the hierarchical level of this cache (L1, L2, etc).
+	Level uint32
+
+	// Type is the type of cache.
+	Type CacheType
+
+	// LineSize is the size of a cache line in bytes.
+	LineSize uint32
+
+	// FullyAssociative indicates that entries may be placed in any block.
+	FullyAssociative bool
+
+	// Partitions is the number of physical partitions in the cache.
+	Partitions uint32
+
+	// Ways is the number of ways of associativity in the cache.
+	Ways uint32
+
+	// Sets is the number of sets in the cache.
+	Sets uint32
+
+	// InvalidateHierarchical indicates that WBINVD/INVD from threads
+	// sharing this cache acts upon lower level caches for threads sharing
+	// this cache.
+	InvalidateHierarchical bool
+
+	// Inclusive indicates that this cache is inclusive of lower cache
+	// levels.
+	Inclusive bool
+
+	// DirectMapped indicates that this cache is directly mapped from
+	// address, rather than using a hash function.
+	DirectMapped bool
+}
+
 // ErrIncompatible is returned for incompatible feature sets.
 type ErrIncompatible struct {
 	reason string
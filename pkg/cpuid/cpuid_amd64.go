@@ -194,59 +194,6 @@ func (fs FeatureSet) PhysicalAddressBits() uint32 {
 	return ax & 0xff
 }
 
-// CacheType describes the type of a cache, as returned in eax[4:0] for eax=4.
-type CacheType uint8
-
-const (
-	// cacheNull indicates that there are no more entries.
-	cacheNull CacheType = iota
-
-	// CacheData is a data cache.
-	CacheData
-
-	// CacheInstruction is an instruction cache.
-	CacheInstruction
-
-	// CacheUnified is a unified instruction and data cache.
-	CacheUnified
-)
-
-// Cache describes the parameters of a single cache on the system.
-//
-// This is returned by the Caches method on FeatureSet.
-type Cache struct {
-	// Level is the hierarchical level of this cache (L1, L2, etc).
-	Level uint32
-
-	// Type is the type of cache.
-	Type CacheType
-
-	// FullyAssociative indicates that entries may be placed in any block.
-	FullyAssociative bool
-
-	// Partitions is the number of physical partitions in the cache.
-	Partitions uint32
-
-	// Ways is the number of ways of associativity in the cache.
-	Ways uint32
-
-	// Sets is the number of sets in the cache.
-	Sets uint32
-
-	// InvalidateHierarchical indicates that WBINVD/INVD from threads
-	// sharing this cache acts upon lower level caches for threads sharing
-	// this cache.
-	InvalidateHierarchical bool
-
-	// Inclusive indicates that this cache is inclusive of lower cache
-	// levels.
-	Inclusive bool
-
-	// DirectMapped indicates that this cache is directly mapped from
-	// address, rather than using a hash function.
-	DirectMapped bool
-}
-
 // Caches describes the caches on the CPU.
 //
 // Only supported on Intel; requires allocation.
@@ -272,6 +219,7 @@ func (fs FeatureSet) Caches() (caches []Cache) {
 		caches = append(caches, Cache{
 			Type:                   t,
 			Level:                  (out.Eax >> 5) & 0x7,
+			LineSize:               lineSize,
 			FullyAssociative:       ((out.Eax >> 9) & 1) == 1,
 			Partitions:             ((out.Ebx >> 12) & 0x3ff) + 1,
 			Ways:                   ((out.Ebx >> 22) & 0x3ff) + 1,
@@ -308,7 +256,10 @@ func (fs FeatureSet) HasFeature(feature Feature) bool {
 // WriteCPUInfoTo is to generate a section of one cpu in /proc/cpuinfo. This is
 // a minimal /proc/cpuinfo, it is missing some fields like "microcode" that are
 // not always printed in Linux. The bogomips field is simply made up.
-func (fs FeatureSet) WriteCPUInfoTo(cpu uint, w io.Writer) {
+//
+// The topology is that of a single package of numCPUs cores, with one thread
+// per core.
+func (fs FeatureSet) WriteCPUInfoTo(cpu, numCPUs uint, w io.Writer) {
 	// Avoid many redunant calls here, since this can occasionally appear
 	// in the hot path. Read all basic information up front, see above.
 	ax, _, _, _ := fs.query(featureInfo)
@@ -321,6 +272,12 @@ func (fs FeatureSet) WriteCPUInfoTo(cpu uint, w io.Writer) {
 	fmt.Fprintf(w, "model name\t: %s\n", "unknown") // Unknown for now.
 	fmt.Fprintf(w, "stepping\t: %s\n", "unknown")   // Unknown for now.
 	fmt.Fprintf(w, "cpu MHz\t\t: %.3f\n", cpuFreqMHz)
+	fmt.Fprintf(w, "physical id\t: 0\n")
+	fmt.Fprintf(w, "siblings\t: %d\n", numCPUs)
+	fmt.Fprintf(w, "core id\t\t: %d\n", cpu)
+	fmt.Fprintf(w, "cpu cores\t: %d\n", numCPUs)
+	fmt.Fprintf(w, "apicid\t\t: %d\n", cpu)
+	fmt.Fprintf(w, "initial apicid\t: %d\n", cpu)
 	fmt.Fprintf(w, "fpu\t\t: yes\n")
 	fmt.Fprintf(w, "fpu_exception\t: yes\n")
 	fmt.Fprintf(w, "cpuid level\t: %d\n", uint32(xSaveInfo)) // Same as ax in vendorID.
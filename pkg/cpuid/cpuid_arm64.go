@@ -91,8 +91,9 @@ func (fs FeatureSet) HasFeature(feature Feature) bool {
 }
 
 // WriteCPUInfoTo is to generate a section of one cpu in /proc/cpuinfo. This is
-// a minimal /proc/cpuinfo, and the bogomips field is simply made up.
-func (fs FeatureSet) WriteCPUInfoTo(cpu uint, w io.Writer) {
+// a minimal /proc/cpuinfo, and the bogomips field is simply made up. Like on
+// Linux, the topology isn't described, so numCPUs is unused.
+func (fs FeatureSet) WriteCPUInfoTo(cpu, numCPUs uint, w io.Writer) {
 	fmt.Fprintf(w, "processor\t: %d\n", cpu)
 	fmt.Fprintf(w, "BogoMIPS\t: %.02f\n", fs.cpuFreqMHz) // It's bogus anyway.
 	fmt.Fprintf(w, "Features\t\t: %s\n", fs.FlagString())
@@ -104,6 +105,13 @@ func (fs FeatureSet) WriteCPUInfoTo(cpu uint, w io.Writer) {
 	fmt.Fprintf(w, "\n") // The /proc/cpuinfo file ends with an extra newline.
 }
 
+// Caches describes the caches on the CPU.
+//
+// Cache parameters aren't known on arm64; no caches are described.
+func (fs FeatureSet) Caches() []Cache {
+	return nil
+}
+
 // archCheckHostCompatible is a noop on arm64.
 func (FeatureSet) archCheckHostCompatible(FeatureSet) error {
 	return nil
@@ -588,3 +588,23 @@ func archFlagOrder(fn func(Feature)) {
 		}
 	}
 }
+
+// featureDependents maps features to the features that can't be used without
+// them, and are thus hidden along with them by FeatureSet.Mask.
+var featureDependents = map[Feature][]Feature{
+	X86FeatureAVX: {X86FeatureAVX2, X86FeatureFMA, X86FeatureF16C, X86FeatureAVX512F},
+	X86FeatureAVX512F: {
+		X86FeatureAVX512DQ,
+		X86FeatureAVX512IFMA,
+		X86FeatureAVX512PF,
+		X86FeatureAVX512ER,
+		X86FeatureAVX512CD,
+		X86FeatureAVX512BW,
+		X86FeatureAVX512VL,
+		X86FeatureAVX512VBMI,
+		X86FeatureAVX512_VBMI2,
+		X86FeatureAVX512_VNNI,
+		X86FeatureAVX512_BITALG,
+		X86FeatureAVX512_VPOPCNTDQ,
+	},
+}
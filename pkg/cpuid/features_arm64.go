@@ -145,3 +145,7 @@ func archFlagOrder(fn func(Feature)) {
 		fn(Feature(i))
 	}
 }
+
+// featureDependents maps features to the features that can't be used without
+// them, and are thus hidden along with them by FeatureSet.Mask.
+var featureDependents = map[Feature][]Feature{}
@@ -41,6 +41,15 @@ func (fs FeatureSet) Fixed() FeatureSet {
 	return fs
 }
 
+// Mask returns a copy of the FeatureSet without features, and without the
+// features that depend on them.
+func (fs FeatureSet) Mask(features []Feature) FeatureSet {
+	for feature := range withDependents(features) {
+		fs.hwCap.hwCap1 &^= 1 << uint(feature)
+	}
+	return fs
+}
+
 // Reads CPU information from host /proc/cpuinfo.
 //
 // Must run before syscall filter installation. This value is used to create
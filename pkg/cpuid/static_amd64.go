@@ -27,6 +27,16 @@ func (fs FeatureSet) Fixed() FeatureSet {
 	return fs.ToStatic().ToFeatureSet()
 }
 
+// Mask returns a fixed copy of the FeatureSet without features, and without
+// the features that depend on them.
+func (fs FeatureSet) Mask(features []Feature) FeatureSet {
+	s := fs.ToStatic()
+	for feature := range withDependents(features) {
+		s.Remove(feature)
+	}
+	return s.ToFeatureSet()
+}
+
 // ToStatic converts a FeatureSet to a Static function.
 //
 // You can create a new static feature set as:
@@ -0,0 +1,407 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fdaudit tracks the host file descriptors held by the sandbox and
+// gofer processes, and periodically audits their host FD tables so that FD
+// leaks are reported before they surface as EMFILE errors.
+//
+// Subsystems holding host FDs register them with an Owner. FDs that are open
+// when auditing starts, e.g. the FDs donated to the process, are expected to
+// stay open. Other FDs are not held by any tracked subsystem; their growth is
+// reported as a possible leak.
+package fdaudit
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// StartupOwner is the owner of FDs that were open when auditing started.
+	StartupOwner = "startup"
+
+	// probeGap is the number of consecutive closed FDs after which FDs are
+	// no longer probed, when the FD table can't be listed. Linux allocates
+	// the lowest available FD, so the FD table is mostly dense.
+	probeGap = 1024
+
+	// minLeakWarning is the minimum number of FDs not held by any tracked
+	// subsystem for which a possible leak is reported.
+	minLeakWarning = 1024
+)
+
+// limitLevels are the shares of RLIMIT_NOFILE, in percents, at which a
+// warning is logged when crossed.
+var limitLevels = []uint64{50, 75, 90}
+
+// Owner is a subsystem that holds host FDs.
+type Owner struct {
+	name string
+}
+
+// NewOwner returns an Owner with the given name, which annotates the FDs it
+// holds in FD tables.
+func NewOwner(name string) *Owner {
+	return &Owner{name: name}
+}
+
+// fileID identifies the file an FD refers to.
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+var (
+	// mu protects the variables below.
+	mu sync.Mutex
+
+	// owned maps the host FDs held by tracked subsystems to their Owner.
+	owned = make(map[int]*Owner)
+
+	// startup maps the host FDs open when auditing started to the file they
+	// referred to.
+	startup map[int]fileID
+
+	// procSelfFD is an FD of the /proc/self/fd directory, used to list and
+	// describe host FDs, or -1 if it isn't available.
+	procSelfFD = -1
+
+	// limit is the RLIMIT_NOFILE soft limit, or 0 if unknown.
+	limit uint64
+)
+
+// Add records that o holds fd.
+func (o *Owner) Add(fd int) {
+	if fd < 0 {
+		return
+	}
+	mu.Lock()
+	owned[fd] = o
+	mu.Unlock()
+}
+
+// Remove records that o no longer holds fd. It must be called before fd is
+// closed, since the FD number may be reused as soon as it is.
+func (o *Owner) Remove(fd int) {
+	if fd < 0 {
+		return
+	}
+	mu.Lock()
+	if owned[fd] == o {
+		delete(owned, fd)
+	}
+	mu.Unlock()
+}
+
+// SetProcSelfFD sets an FD of the /proc/self/fd directory, used to list host
+// FDs and annotate them with their path. Without it, FDs are found by probing
+// and their paths are unknown.
+func SetProcSelfFD(fd int) {
+	mu.Lock()
+	procSelfFD = fd
+	mu.Unlock()
+}
+
+// Entry describes an open host FD.
+type Entry struct {
+	// FD is the host FD number.
+	FD int `json:"fd"`
+
+	// Owner is the subsystem holding the FD, StartupOwner if it was open when
+	// auditing started, or empty if unknown.
+	Owner string `json:"owner,omitempty"`
+
+	// Type is the type of file the FD refers to, e.g. "socket".
+	Type string `json:"type"`
+
+	// Target is the path of the FD as shown in /proc/self/fd, or empty if
+	// unknown.
+	Target string `json:"target,omitempty"`
+
+	id fileID
+}
+
+// Table returns the open host FDs of the process, ordered by FD number.
+func Table() ([]Entry, error) {
+	mu.Lock()
+	dirFD := procSelfFD
+	maxFD, lim := -1, limit
+	for fd := range owned {
+		if fd > maxFD {
+			maxFD = fd
+		}
+	}
+	mu.Unlock()
+
+	var entries []Entry
+	if dirFD >= 0 {
+		fds, err := listFDs(dirFD)
+		if err != nil {
+			return nil, err
+		}
+		for _, fd := range fds {
+			if e, ok := newEntry(fd); ok {
+				e.Target, _ = readlinkat(dirFD, strconv.Itoa(fd))
+				entries = append(entries, e)
+			}
+		}
+	} else {
+		lastOpen := maxFD
+		for fd := 0; fd <= lastOpen+probeGap && (lim == 0 || uint64(fd) < lim); fd++ {
+			if e, ok := newEntry(fd); ok {
+				entries = append(entries, e)
+				if fd > lastOpen {
+					lastOpen = fd
+				}
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range entries {
+		e := &entries[i]
+		if o, ok := owned[e.FD]; ok {
+			e.Owner = o.name
+		} else if id, ok := startup[e.FD]; ok && id == e.id {
+			e.Owner = StartupOwner
+		}
+	}
+	return entries, nil
+}
+
+// newEntry returns the Entry of fd, or false if fd isn't open.
+func newEntry(fd int) (Entry, bool) {
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		return Entry{}, false
+	}
+	return Entry{
+		FD:   fd,
+		Type: fileType(stat.Mode),
+		id:   fileID{dev: uint64(stat.Dev), ino: uint64(stat.Ino)},
+	}, true
+}
+
+// fileType returns the name of the type of file with the given mode.
+func fileType(mode uint32) string {
+	switch mode & unix.S_IFMT {
+	case unix.S_IFSOCK:
+		return "socket"
+	case unix.S_IFIFO:
+		return "pipe"
+	case unix.S_IFREG:
+		return "file"
+	case unix.S_IFDIR:
+		return "dir"
+	case unix.S_IFCHR:
+		return "char"
+	case unix.S_IFBLK:
+		return "block"
+	case unix.S_IFLNK:
+		return "symlink"
+	default:
+		// Anonymous inodes, e.g. of eventfds and epoll instances, have no
+		// file type.
+		return "anon"
+	}
+}
+
+// listFDs lists the FDs in the /proc/self/fd directory dirFD.
+func listFDs(dirFD int) ([]int, error) {
+	d, err := unix.Openat(dirFD, ".", unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening /proc/self/fd: %w", err)
+	}
+	defer unix.Close(d)
+
+	var fds []int
+	buf := make([]byte, 8192)
+	for {
+		n, err := unix.Getdents(d, buf)
+		if err != nil {
+			return nil, fmt.Errorf("listing /proc/self/fd: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+		var names []string
+		_, _, names = unix.ParseDirent(buf[:n], -1, names)
+		for _, name := range names {
+			fd, err := strconv.Atoi(name)
+			if err != nil || fd == d {
+				continue
+			}
+			fds = append(fds, fd)
+		}
+	}
+	sort.Ints(fds)
+	return fds, nil
+}
+
+// readlinkat returns the target of the symlink name in dirFD.
+func readlinkat(dirFD int, name string) (string, error) {
+	buf := make([]byte, unix.PathMax)
+	n, err := unix.Readlinkat(dirFD, name, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+// Format returns a human-readable table of entries.
+func Format(entries []Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-6s %-12s %-8s %s\n", "FD", "OWNER", "TYPE", "TARGET")
+	for _, e := range entries {
+		owner := e.Owner
+		if owner == "" {
+			owner = "-"
+		}
+		fmt.Fprintf(&b, "%-6d %-12s %-8s %s\n", e.FD, owner, e.Type, e.Target)
+	}
+	return b.String()
+}
+
+// Summary returns the number of entries held by each owner, and the number
+// of entries of each type without an owner, largest first.
+func Summary(entries []Entry) string {
+	counts := make(map[string]int)
+	for _, e := range entries {
+		key := e.Owner
+		if key == "" {
+			key = "untracked " + e.Type
+		}
+		counts[key]++
+	}
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", key, counts[key]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// auditor periodically audits the host FD table.
+type auditor struct {
+	// limit is the RLIMIT_NOFILE soft limit, or 0 if unknown.
+	limit uint64
+
+	// lastLevel is the highest share of the limit in limitLevels that was
+	// crossed in the last audit.
+	lastLevel uint64
+
+	// nextLeakWarning is the number of untracked FDs from which a possible
+	// leak is reported.
+	nextLeakWarning int
+}
+
+// Start records the host FDs currently open as expected, and starts auditing
+// the host FD table every interval. It must be called before seccomp filters
+// are installed, since it reads RLIMIT_NOFILE.
+func Start(interval time.Duration) error {
+	var rlim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &rlim); err != nil {
+		return fmt.Errorf("getting RLIMIT_NOFILE: %w", err)
+	}
+	var lim uint64
+	if rlim.Cur != unix.RLIM_INFINITY {
+		lim = rlim.Cur
+	}
+	mu.Lock()
+	limit = lim
+	mu.Unlock()
+
+	entries, err := Table()
+	if err != nil {
+		return err
+	}
+	fds := make(map[int]fileID, len(entries))
+	for _, e := range entries {
+		if e.Owner == "" {
+			fds[e.FD] = e.id
+		}
+	}
+	mu.Lock()
+	startup = fds
+	mu.Unlock()
+
+	a := &auditor{limit: lim, nextLeakWarning: minLeakWarning}
+	if l := int(lim / 8); l > a.nextLeakWarning {
+		a.nextLeakWarning = l
+	}
+	log.Infof("Auditing host FDs every %v, %d FDs open at startup, limit %d", interval, len(entries), lim)
+	go a.run(interval) // S/R-SAFE: not saved.
+	return nil
+}
+
+// run audits the host FD table every interval.
+func (a *auditor) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		a.audit()
+	}
+}
+
+// audit checks the host FD table and logs warnings when it gets close to the
+// limit, or when FDs not held by any tracked subsystem accumulate.
+func (a *auditor) audit() {
+	entries, err := Table()
+	if err != nil {
+		log.Warningf("Failed to audit host FDs: %v", err)
+		return
+	}
+	total := uint64(len(entries))
+
+	var level uint64
+	for _, l := range limitLevels {
+		if a.limit > 0 && total*100 >= a.limit*l {
+			level = l
+		}
+	}
+	if level > a.lastLevel {
+		log.Warningf("%d host FDs are open, over %d%% of the limit of %d: %s", total, level, a.limit, Summary(entries))
+		log.Debugf("Host FDs:\n%s", Format(entries))
+	}
+	a.lastLevel = level
+
+	untracked := 0
+	for _, e := range entries {
+		if e.Owner == "" {
+			untracked++
+		}
+	}
+	if untracked >= a.nextLeakWarning {
+		log.Warningf("Possible host FD leak: %d host FDs are not held by any tracked subsystem: %s", untracked, Summary(entries))
+		log.Debugf("Host FDs:\n%s", Format(entries))
+		a.nextLeakWarning = 2 * untracked
+	}
+}
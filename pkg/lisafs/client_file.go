@@ -480,6 +480,20 @@ func (f *ClientFD) Connect(ctx context.Context, sockType linux.SockType) (int, e
 	return sockFD[0], err
 }
 
+// Watch makes the Watch RPC.
+func (f *ClientFD) Watch(ctx context.Context) (int, error) {
+	req := WatchReq{FD: f.fd}
+	var resp WatchResp
+	var sockFD [1]int
+	ctx.UninterruptibleSleepStart(false)
+	err := f.client.SndRcvMessage(Watch, uint32(req.SizeBytes()), req.MarshalUnsafe, resp.CheckedUnmarshal, sockFD[:], req.String, resp.String)
+	ctx.UninterruptibleSleepFinish(false)
+	if err == nil && sockFD[0] < 0 {
+		err = unix.EBADF
+	}
+	return sockFD[0], err
+}
+
 // UnlinkAt makes the UnlinkAt RPC.
 func (f *ClientFD) UnlinkAt(ctx context.Context, name string, flags uint32) error {
 	req := UnlinkAtReq{
@@ -494,6 +494,15 @@ type ControlFDImpl interface {
 	// On the server, BindAt has a write concurrency guarantee.
 	BindAt(name string, sockType uint32, mode linux.FileMode, uid UID, gid GID) (*ControlFD, linux.Statx, *BoundSocketFD, int, error)
 
+	// Watch starts reporting changes to files under this directory made
+	// outside of the client. It returns a host socket FD from which each
+	// message read is the path of a changed file, relative to this directory,
+	// or "." if the directory itself changed. Changes stop being reported once
+	// the client closes the socket.
+	//
+	// On the server, Watch has a read concurrency guarantee.
+	Watch() (int, error)
+
 	// UnlinkAt the file identified by name in this directory.
 	//
 	// Flags are Linux unlinkat(2) flags.
@@ -30,12 +30,23 @@ import (
 )
 
 const (
-	allowedOpenFlags     = unix.O_ACCMODE | unix.O_TRUNC
+	allowedOpenFlags     = unix.O_ACCMODE | unix.O_TRUNC | unix.O_DIRECT
 	setStatSupportedMask = unix.STATX_MODE | unix.STATX_UID | unix.STATX_GID | unix.STATX_SIZE | unix.STATX_ATIME | unix.STATX_MTIME
 	// unixDirentMaxSize is the maximum size of unix.Dirent for amd64.
 	unixDirentMaxSize = 280
 )
 
+// allowedAllocateModes are the fallocate(2) modes that FAllocate accepts.
+var allowedAllocateModes = map[uint64]struct{}{
+	0:                        {},
+	unix.FALLOC_FL_KEEP_SIZE: {},
+	unix.FALLOC_FL_PUNCH_HOLE | unix.FALLOC_FL_KEEP_SIZE: {},
+	unix.FALLOC_FL_ZERO_RANGE:                            {},
+	unix.FALLOC_FL_ZERO_RANGE | unix.FALLOC_FL_KEEP_SIZE: {},
+	unix.FALLOC_FL_COLLAPSE_RANGE:                        {},
+	unix.FALLOC_FL_INSERT_RANGE:                          {},
+}
+
 // RPCHandler defines a handler that is invoked when the associated message is
 // received. The handler is responsible for:
 //
@@ -78,6 +89,7 @@ var handlers = [...]RPCHandler{
 	BindAt:       BindAtHandler,
 	Listen:       ListenHandler,
 	Accept:       AcceptHandler,
+	Watch:        WatchHandler,
 }
 
 // ErrorHandler handles Error message.
@@ -972,6 +984,9 @@ func FAllocateHandler(c *Connection, comm Communicator, payloadLen uint32) (uint
 	if !fd.writable {
 		return 0, unix.EBADF
 	}
+	if _, ok := allowedAllocateModes[req.Mode]; !ok {
+		return 0, unix.EOPNOTSUPP
+	}
 
 	return 0, fd.controlFD.safelyWrite(func() error {
 		if fd.controlFD.node.isDeleted() && !c.server.opts.AllocateOnDeleted {
@@ -1174,6 +1189,36 @@ func AcceptHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32,
 	return respLen, nil
 }
 
+// WatchHandler handles the Watch RPC.
+func WatchHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
+	var req WatchReq
+	if _, ok := req.CheckedUnmarshal(comm.PayloadBuf(payloadLen)); !ok {
+		return 0, unix.EIO
+	}
+
+	fd, err := c.lookupControlFD(req.FD)
+	if err != nil {
+		return 0, err
+	}
+	defer fd.DecRef(nil)
+	if !fd.IsDir() {
+		return 0, unix.ENOTDIR
+	}
+	var sock int
+	if err := fd.safelyRead(func() error {
+		if fd.node.isDeleted() {
+			return unix.EINVAL
+		}
+		sock, err = fd.impl.Watch()
+		return err
+	}); err != nil {
+		return 0, err
+	}
+
+	comm.DonateFD(sock)
+	return 0, nil
+}
+
 // UnlinkAtHandler handles the UnlinkAt RPC.
 func UnlinkAtHandler(c *Connection, comm Communicator, payloadLen uint32) (uint32, error) {
 	if c.readonly {
@@ -47,6 +47,7 @@ var _ marshal.Marshallable = (*StatFS)(nil)
 var _ marshal.Marshallable = (*StatReq)(nil)
 var _ marshal.Marshallable = (*SymlinkAtResp)(nil)
 var _ marshal.Marshallable = (*UID)(nil)
+var _ marshal.Marshallable = (*WatchReq)(nil)
 var _ marshal.Marshallable = (*channelHeader)(nil)
 var _ marshal.Marshallable = (*createCommon)(nil)
 var _ marshal.Marshallable = (*linux.FileMode)(nil)
@@ -4461,6 +4462,147 @@ func (uid *UID) WriteTo(writer io.Writer) (int64, error) {
 	return int64(length), err
 }
 
+// SizeBytes implements marshal.Marshallable.SizeBytes.
+func (w *WatchReq) SizeBytes() int {
+	return 0 +
+		(*FDID)(nil).SizeBytes()
+}
+
+// MarshalBytes implements marshal.Marshallable.MarshalBytes.
+func (w *WatchReq) MarshalBytes(dst []byte) []byte {
+	dst = w.FD.MarshalUnsafe(dst)
+	return dst
+}
+
+// UnmarshalBytes implements marshal.Marshallable.UnmarshalBytes.
+func (w *WatchReq) UnmarshalBytes(src []byte) []byte {
+	src = w.FD.UnmarshalUnsafe(src)
+	return src
+}
+
+// Packed implements marshal.Marshallable.Packed.
+//
+//go:nosplit
+func (w *WatchReq) Packed() bool {
+	return w.FD.Packed()
+}
+
+// MarshalUnsafe implements marshal.Marshallable.MarshalUnsafe.
+func (w *WatchReq) MarshalUnsafe(dst []byte) []byte {
+	if w.FD.Packed() {
+		size := w.SizeBytes()
+		gohacks.Memmove(unsafe.Pointer(&dst[0]), unsafe.Pointer(w), uintptr(size))
+		return dst[size:]
+	}
+	// Type WatchReq doesn't have a packed layout in memory, fallback to MarshalBytes.
+	return w.MarshalBytes(dst)
+}
+
+// UnmarshalUnsafe implements marshal.Marshallable.UnmarshalUnsafe.
+func (w *WatchReq) UnmarshalUnsafe(src []byte) []byte {
+	if w.FD.Packed() {
+		size := w.SizeBytes()
+		gohacks.Memmove(unsafe.Pointer(w), unsafe.Pointer(&src[0]), uintptr(size))
+		return src[size:]
+	}
+	// Type WatchReq doesn't have a packed layout in memory, fallback to UnmarshalBytes.
+	return w.UnmarshalBytes(src)
+}
+
+// CopyOutN implements marshal.Marshallable.CopyOutN.
+func (w *WatchReq) CopyOutN(cc marshal.CopyContext, addr hostarch.Addr, limit int) (int, error) {
+	if !w.FD.Packed() {
+		// Type WatchReq doesn't have a packed layout in memory, fall back to MarshalBytes.
+		buf := cc.CopyScratchBuffer(w.SizeBytes()) // escapes: okay.
+		w.MarshalBytes(buf)                        // escapes: fallback.
+		return cc.CopyOutBytes(addr, buf[:limit])  // escapes: okay.
+	}
+
+	// Construct a slice backed by dst's underlying memory.
+	var buf []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	hdr.Data = uintptr(gohacks.Noescape(unsafe.Pointer(w)))
+	hdr.Len = w.SizeBytes()
+	hdr.Cap = w.SizeBytes()
+
+	length, err := cc.CopyOutBytes(addr, buf[:limit]) // escapes: okay.
+	// Since we bypassed the compiler's escape analysis, indicate that w
+	// must live until the use above.
+	runtime.KeepAlive(w) // escapes: replaced by intrinsic.
+	return length, err
+}
+
+// CopyOut implements marshal.Marshallable.CopyOut.
+func (w *WatchReq) CopyOut(cc marshal.CopyContext, addr hostarch.Addr) (int, error) {
+	return w.CopyOutN(cc, addr, w.SizeBytes())
+}
+
+// CopyIn implements marshal.Marshallable.CopyIn.
+func (w *WatchReq) CopyIn(cc marshal.CopyContext, addr hostarch.Addr) (int, error) {
+	if !w.FD.Packed() {
+		// Type WatchReq doesn't have a packed layout in memory, fall back to UnmarshalBytes.
+		buf := cc.CopyScratchBuffer(w.SizeBytes()) // escapes: okay.
+		length, err := cc.CopyInBytes(addr, buf)   // escapes: okay.
+		// Unmarshal unconditionally. If we had a short copy-in, this results in a
+		// partially unmarshalled struct.
+		w.UnmarshalBytes(buf) // escapes: fallback.
+		return length, err
+	}
+
+	// Construct a slice backed by dst's underlying memory.
+	var buf []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	hdr.Data = uintptr(gohacks.Noescape(unsafe.Pointer(w)))
+	hdr.Len = w.SizeBytes()
+	hdr.Cap = w.SizeBytes()
+
+	length, err := cc.CopyInBytes(addr, buf) // escapes: okay.
+	// Since we bypassed the compiler's escape analysis, indicate that w
+	// must live until the use above.
+	runtime.KeepAlive(w) // escapes: replaced by intrinsic.
+	return length, err
+}
+
+// WriteTo implements io.WriterTo.WriteTo.
+func (w *WatchReq) WriteTo(writer io.Writer) (int64, error) {
+	if !w.FD.Packed() {
+		// Type WatchReq doesn't have a packed layout in memory, fall back to MarshalBytes.
+		buf := make([]byte, w.SizeBytes())
+		w.MarshalBytes(buf)
+		length, err := writer.Write(buf)
+		return int64(length), err
+	}
+
+	// Construct a slice backed by dst's underlying memory.
+	var buf []byte
+	hdr := (*reflect.SliceHeader)(unsafe.Pointer(&buf))
+	hdr.Data = uintptr(gohacks.Noescape(unsafe.Pointer(w)))
+	hdr.Len = w.SizeBytes()
+	hdr.Cap = w.SizeBytes()
+
+	length, err := writer.Write(buf)
+	// Since we bypassed the compiler's escape analysis, indicate that w
+	// must live until the use above.
+	runtime.KeepAlive(w) // escapes: replaced by intrinsic.
+	return int64(length), err
+}
+
+// CheckedMarshal implements marshal.CheckedMarshallable.CheckedMarshal.
+func (w *WatchReq) CheckedMarshal(dst []byte) ([]byte, bool) {
+	if w.SizeBytes() > len(dst) {
+		return dst, false
+	}
+	return w.MarshalUnsafe(dst), true
+}
+
+// CheckedUnmarshal implements marshal.CheckedMarshallable.CheckedUnmarshal.
+func (w *WatchReq) CheckedUnmarshal(src []byte) ([]byte, bool) {
+	if w.SizeBytes() > len(src) {
+		return src, false
+	}
+	return w.UnmarshalUnsafe(src), true
+}
+
 // SizeBytes implements marshal.Marshallable.SizeBytes.
 func (c *createCommon) SizeBytes() int {
 	return 6 +
@@ -172,6 +172,9 @@ const (
 
 	// Accept is analogous to accept4(2).
 	Accept MID = 31
+
+	// Watch starts reporting changes to files under a directory.
+	Watch MID = 32
 )
 
 const (
@@ -1428,6 +1431,26 @@ func (a *AcceptResp) CheckedUnmarshal(src []byte) ([]byte, bool) {
 	return a.PeerAddr.CheckedUnmarshal(src)
 }
 
+// WatchReq is used to make a Watch request.
+//
+// +marshal boundCheck
+type WatchReq struct {
+	FD FDID
+}
+
+// String implements fmt.Stringer.String.
+func (w *WatchReq) String() string {
+	return fmt.Sprintf("WatchReq{FD: %d}", w.FD)
+}
+
+// WatchResp is an empty response to WatchReq.
+type WatchResp struct{ EmptyMessage }
+
+// String implements fmt.Stringer.String.
+func (*WatchResp) String() string {
+	return "WatchResp{}"
+}
+
 // UnlinkAtReq is used to make UnlinkAt request.
 type UnlinkAtReq struct {
 	DirFD FDID
@@ -0,0 +1,128 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rand
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+)
+
+// seedSize is the number of bytes read from the entropy source of a reseeding
+// DRBG each time it's reseeded.
+const seedSize = 32
+
+// DRBG is a deterministic random bit generator: it expands a seed into a
+// pseudorandom stream with AES-256 in counter mode. If it has an entropy
+// source, it's reseeded from it periodically; otherwise, its output only
+// depends on the seed.
+type DRBG struct {
+	mu sync.Mutex
+
+	// key is the current key, derived from all seeds.
+	//
+	// +checklocks:mu
+	key [sha256.Size]byte
+
+	// stream generates the output for key.
+	//
+	// +checklocks:mu
+	stream cipher.Stream
+
+	// generated is the number of bytes generated since the last reseed.
+	//
+	// +checklocks:mu
+	generated uint64
+
+	// source and reseedInterval are the entropy source and the number of
+	// bytes after which it's reseeded from source. source is nil for
+	// deterministic DRBGs.
+	source         io.Reader
+	reseedInterval uint64
+}
+
+// NewDeterministicReader returns a DRBG whose output only depends on seed.
+func NewDeterministicReader(seed []byte) *DRBG {
+	d := &DRBG{}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seedLocked(seed)
+	return d
+}
+
+// NewReseedingReader returns a DRBG seeded from source, and reseeded from it
+// every reseedInterval bytes of output.
+func NewReseedingReader(source io.Reader, reseedInterval uint64) (*DRBG, error) {
+	d := &DRBG{
+		source:         source,
+		reseedInterval: reseedInterval,
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.reseedLocked(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// seedLocked mixes seed into the key.
+//
+// +checklocks:d.mu
+func (d *DRBG) seedLocked(seed []byte) {
+	h := sha256.New()
+	h.Write(d.key[:])
+	h.Write(seed)
+	h.Sum(d.key[:0])
+	block, err := aes.NewCipher(d.key[:])
+	if err != nil {
+		panic(fmt.Sprintf("aes.NewCipher failed with a %d byte key: %v", len(d.key), err))
+	}
+	// Each key only generates a single stream, so a zero IV is fine.
+	d.stream = cipher.NewCTR(block, make([]byte, aes.BlockSize))
+	d.generated = 0
+}
+
+// reseedLocked reads a new seed from the entropy source.
+//
+// +checklocks:d.mu
+func (d *DRBG) reseedLocked() error {
+	var seed [seedSize]byte
+	if _, err := io.ReadFull(d.source, seed[:]); err != nil {
+		return fmt.Errorf("reading seed from entropy source: %w", err)
+	}
+	d.seedLocked(seed[:])
+	return nil
+}
+
+// Read implements io.Reader.Read.
+func (d *DRBG) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.source != nil && d.generated >= d.reseedInterval {
+		if err := d.reseedLocked(); err != nil {
+			return 0, err
+		}
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	d.stream.XORKeyStream(p, p)
+	d.generated += uint64(len(p))
+	return len(p), nil
+}
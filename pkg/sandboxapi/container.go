@@ -0,0 +1,370 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandboxapi
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/control"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/runsc/boot"
+	"github.com/talismancer/gvisor-ligolo/runsc/container"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+	"golang.org/x/sys/unix"
+)
+
+// CreateOptions specify the container to create.
+type CreateOptions struct {
+	// ID is the ID of the container.
+	ID string
+
+	// BundleDir is the directory containing the container bundle.
+	BundleDir string
+
+	// Spec is the OCI spec of the container. If nil, it is read from
+	// BundleDir.
+	Spec *specs.Spec
+
+	// ConsoleSocket is the path to a Unix domain socket that will receive
+	// the console FD. It may be empty.
+	ConsoleSocket string
+
+	// PIDFile is the file where the PID of the sandbox is written. It may be
+	// empty.
+	PIDFile string
+
+	// UserLog is the file to send user-visible logs to. It may be empty.
+	UserLog string
+
+	// Attached makes the sandbox exit if the calling process exits.
+	Attached bool
+
+	// PassFiles are host files exposed to the application, keyed by FD
+	// number.
+	PassFiles map[int]*os.File
+}
+
+// Container is a container in a sandbox. The first container of a sandbox is
+// its root container.
+type Container struct {
+	client *Client
+	c      *container.Container
+}
+
+// Create creates a container. Unless the spec says it belongs to an existing
+// sandbox, a new sandbox is created for it. The container must be started with
+// Start. If ctx is done before the container is created, it is destroyed.
+func (cl *Client) Create(ctx context.Context, opts CreateOptions) (*Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	spec := opts.Spec
+	if spec == nil {
+		var err error
+		if spec, err = specutils.ReadSpec(opts.BundleDir, cl.conf); err != nil {
+			return nil, fmt.Errorf("reading spec: %w", err)
+		}
+	}
+	c, err := container.New(ctx, cl.conf, container.Args{
+		ID:            opts.ID,
+		Spec:          spec,
+		BundleDir:     opts.BundleDir,
+		ConsoleSocket: opts.ConsoleSocket,
+		PIDFile:       opts.PIDFile,
+		UserLog:       opts.UserLog,
+		Attached:      opts.Attached,
+		PassFiles:     opts.PassFiles,
+		ExePath:       cl.runscPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating container: %w", err)
+	}
+	return &Container{client: cl, c: c}, nil
+}
+
+// ID returns the ID of the container.
+func (c *Container) ID() string {
+	return c.c.ID
+}
+
+// SandboxID returns the ID of the sandbox the container runs in.
+func (c *Container) SandboxID() string {
+	return c.c.Sandbox.ID
+}
+
+// SandboxPID returns the PID of the sandbox process, or -1 if it isn't
+// running.
+func (c *Container) SandboxPID() int {
+	return c.c.SandboxPid()
+}
+
+// State returns the OCI state of the container.
+func (c *Container) State() specs.State {
+	return c.c.State()
+}
+
+// Start starts a created container.
+func (c *Container) Start(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.Start(ctx, c.client.conf)
+}
+
+// Restore starts a created container from the checkpoint image at imagePath,
+// which must be a file written by Checkpoint. If ctx is done before the
+// restore completes, the restore is canceled and the container must be
+// destroyed.
+func (c *Container) Restore(ctx context.Context, imagePath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.Restore(ctx, c.client.conf, imagePath)
+}
+
+// ExecOptions specify a process to run in a container.
+type ExecOptions struct {
+	// Argv is the command line of the process. Argv[0] is looked up in the
+	// PATH of the container if it isn't an absolute path.
+	Argv []string
+
+	// Env is the environment of the process, as "KEY=value" strings.
+	Env []string
+
+	// WorkingDirectory is the working directory of the process. If empty,
+	// it is the root directory.
+	WorkingDirectory string
+
+	// UID and GID are the user and group the process runs as.
+	UID uint32
+	GID uint32
+
+	// Terminal indicates that Stdin, Stdout and Stderr are a host terminal.
+	Terminal bool
+
+	// Stdin, Stdout and Stderr are the standard files of the process. If
+	// nil, the standard files of the calling process are used.
+	Stdin  *os.File
+	Stdout *os.File
+	Stderr *os.File
+}
+
+// Exec starts a new process in the container and returns its PID in the
+// sandbox. Use WaitPID to wait for it.
+func (c *Container) Exec(ctx context.Context, opts ExecOptions) (int32, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	files := map[int]*os.File{0: os.Stdin, 1: os.Stdout, 2: os.Stderr}
+	for i, f := range []*os.File{opts.Stdin, opts.Stdout, opts.Stderr} {
+		if f != nil {
+			files[i] = f
+		}
+	}
+	args := &control.ExecArgs{
+		Argv:             opts.Argv,
+		Envv:             opts.Env,
+		WorkingDirectory: opts.WorkingDirectory,
+		KUID:             auth.KUID(opts.UID),
+		KGID:             auth.KGID(opts.GID),
+		StdioIsPty:       opts.Terminal,
+		FilePayload:      control.NewFilePayload(files, nil),
+	}
+	return c.c.Execute(c.client.conf, args)
+}
+
+// Wait waits for the container to exit and returns its exit status.
+func (c *Container) Wait(ctx context.Context) (unix.WaitStatus, error) {
+	return c.c.Wait(ctx)
+}
+
+// WaitPID waits for the process with PID pid in the sandbox to exit and
+// returns its exit status.
+func (c *Container) WaitPID(ctx context.Context, pid int32) (unix.WaitStatus, error) {
+	return c.c.WaitPID(ctx, pid)
+}
+
+// Signal sends sig to the init process of the container, or to all of its
+// processes if all is true.
+func (c *Container) Signal(ctx context.Context, sig unix.Signal, all bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.SignalContainer(sig, all)
+}
+
+// Processes returns the processes running in the container.
+func (c *Container) Processes(ctx context.Context) ([]*control.Process, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.c.Processes()
+}
+
+// Pause pauses the sandbox of the container.
+func (c *Container) Pause(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.Pause()
+}
+
+// Resume resumes the sandbox of the container.
+func (c *Container) Resume(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.Resume()
+}
+
+// SetCPUs changes the number of CPUs applications in the container's sandbox
+// run on. It can't exceed the --cpu-num-max the sandbox was started with.
+func (c *Container) SetCPUs(ctx context.Context, numCPUs int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.Sandbox.SetCPUs(numCPUs)
+}
+
+// SetMemory changes the total memory, in bytes, reported to applications in
+// the container's sandbox. Shrinking it reclaims memory the sandbox can evict.
+func (c *Container) SetMemory(ctx context.Context, totalMem uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.Sandbox.SetMemory(totalMem)
+}
+
+// SetBalloon sets the amount of memory, in bytes, the container's sandbox
+// should return to the host. The memory is taken from the memory available to
+// its applications as they stop using it. A target of 0 deflates the balloon.
+func (c *Container) SetBalloon(ctx context.Context, targetBytes uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.Sandbox.SetBalloon(targetBytes)
+}
+
+// RestartGofer starts a new gofer for the container after its gofer died,
+// and reconnects the container's mounts to it. The sandbox must run with
+// --gofer-recovery-timeout, and the gofer must be restarted before it expires.
+func (c *Container) RestartGofer(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.RestartGofer(c.client.conf)
+}
+
+// SuperviseGofer checks the gofer of the container every interval, and
+// restarts it when it died, until ctx is done or the container stops. It
+// returns the error that prevented a restart. interval must be shorter than
+// the --gofer-recovery-timeout of the sandbox.
+func (c *Container) SuperviseGofer(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if c.c.IsGoferRunning() {
+			continue
+		}
+		if err := c.c.SignalContainer(0, false); err != nil {
+			// The container stopped, and its gofer with it.
+			return nil
+		}
+		if err := c.c.RestartGofer(c.client.conf); err != nil {
+			return fmt.Errorf("restarting gofer of container %q: %w", c.c.ID, err)
+		}
+	}
+}
+
+// CheckpointOptions specify how to checkpoint a container.
+type CheckpointOptions struct {
+	// ImagePath is the file the checkpoint image is written to. It must not
+	// exist.
+	ImagePath string
+}
+
+// Checkpoint saves the state of the container's sandbox to an image, which
+// can be restored with Restore. The sandbox exits once the checkpoint is
+// written, or if it fails, so the checkpoint isn't canceled once started:
+// ctx is only checked before.
+func (c *Container) Checkpoint(ctx context.Context, opts CheckpointOptions) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(opts.ImagePath, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.c.Checkpoint(f)
+}
+
+// Event is a snapshot of the resource usage of a container.
+type Event = boot.EventOut
+
+// Event returns the current resource usage of the container.
+func (c *Container) Event(ctx context.Context) (*Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.c.Event()
+}
+
+// Events sends the resource usage of the container every interval until ctx
+// is done or the container can't be queried anymore, e.g. because it exited.
+// The returned channel is closed then.
+func (c *Container) Events(ctx context.Context, interval time.Duration) <-chan *Event {
+	ch := make(chan *Event)
+	go func() {
+		defer close(ch)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			ev, err := c.c.Event()
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// Destroy stops all processes of the container and frees its resources. If
+// it is the root container, the sandbox is destroyed.
+func (c *Container) Destroy(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.c.Destroy()
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandboxapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkNetwork checks that network is supported by Dial and Listen.
+func checkNetwork(network string) error {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+		return nil
+	default:
+		return fmt.Errorf("unsupported network %q, only TCP is supported", network)
+	}
+}
+
+// streamPair returns a connected pair of a local connection and a file to
+// pass to the sandbox.
+func streamPair() (net.Conn, *os.File, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating socket pair: %w", err)
+	}
+	local := os.NewFile(uintptr(fds[0]), "sandboxapi-local")
+	defer local.Close()
+	conn, err := net.FileConn(local)
+	if err != nil {
+		unix.Close(fds[1])
+		return nil, nil, err
+	}
+	return conn, os.NewFile(uintptr(fds[1]), "sandboxapi-remote"), nil
+}
+
+// conn is a connection tunneled through the control socket of a sandbox. It
+// reports TCP addresses instead of the ones of the underlying socket pair.
+type conn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+// LocalAddr implements net.Conn.LocalAddr.
+func (c *conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr implements net.Conn.RemoteAddr.
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// CloseWrite shuts down the writing side of the connection, if supported.
+func (c *conn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return c.Conn.Close()
+}
+
+// Dial connects to address through the network stack of the sandbox, as if
+// the connection was made by the container. Host names in address are
+// resolved on the host. Only TCP is supported.
+//
+// Data is copied between the returned connection and the sandbox over a
+// socket passed through the control socket, so the caller doesn't need access
+// to the network namespace of the sandbox.
+func (c *Container) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	if err := checkNetwork(network); err != nil {
+		return nil, err
+	}
+	remote, err := net.ResolveTCPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	local, f, err := streamPair()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := c.c.Sandbox.Dial(ctx, c.c.ID, remote.String(), f); err != nil {
+		local.Close()
+		return nil, err
+	}
+	return &conn{Conn: local, local: &net.TCPAddr{}, remote: remote}, nil
+}
+
+// listener is a listener in the network stack of a sandbox.
+type listener struct {
+	c    *Container
+	id   uint64
+	addr *net.TCPAddr
+}
+
+// Listen listens on address in the network stack of the sandbox, as if the
+// listener belonged to the container. The IP may be omitted to listen on all
+// IPv4 addresses, and the port may be zero to pick one. Only TCP is
+// supported.
+func (c *Container) Listen(ctx context.Context, network, address string) (net.Listener, error) {
+	if err := checkNetwork(network); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	res, err := c.c.Sandbox.Listen(c.c.ID, address)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := net.ResolveTCPAddr(network, res.Address)
+	if err != nil {
+		c.c.Sandbox.CloseListener(res.ID)
+		return nil, err
+	}
+	return &listener{c: c, id: res.ID, addr: addr}, nil
+}
+
+// Accept implements net.Listener.Accept.
+func (l *listener) Accept() (net.Conn, error) {
+	local, f, err := streamPair()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	peer, err := l.c.c.Sandbox.Accept(l.c.c.ID, l.id, f)
+	if err != nil {
+		local.Close()
+		return nil, err
+	}
+	remote, err := net.ResolveTCPAddr("tcp", peer)
+	if err != nil {
+		remote = &net.TCPAddr{}
+	}
+	return &conn{Conn: local, local: l.addr, remote: remote}, nil
+}
+
+// Close implements net.Listener.Close. Pending calls to Accept fail.
+func (l *listener) Close() error {
+	return l.c.c.Sandbox.CloseListener(l.id)
+}
+
+// Addr implements net.Listener.Addr.
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandboxapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/unet"
+	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
+	"github.com/talismancer/gvisor-ligolo/runsc/relay"
+)
+
+// relayBackend serves relay requests with a container.
+type relayBackend struct {
+	c *Container
+}
+
+// DialControl implements relay.Backend.DialControl.
+func (b relayBackend) DialControl() (net.Conn, error) {
+	sock, err := unet.Connect(b.c.c.Sandbox.ControlAddress, false)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := sock.Release()
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "control")
+	defer f.Close()
+	return net.FileConn(f)
+}
+
+// Dial implements relay.Backend.Dial.
+func (b relayBackend) Dial(address string) (net.Conn, error) {
+	return b.c.Dial(context.Background(), "tcp", address)
+}
+
+// ServeRelay makes the sandbox a relay, see package relay. It listens on
+// address in the network stack of the sandbox and serves clients
+// authenticated with secret until ctx is done.
+func (c *Container) ServeRelay(ctx context.Context, address string, secret []byte) error {
+	l, err := c.Listen(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		l.Close()
+	}()
+	srv := relay.Server{Secret: secret, Backend: relayBackend{c}}
+	err = srv.Serve(l)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// DialRelay connects to the first of hops through the network stack of the
+// sandbox, and asks the last one for req through the others. See
+// relay.Connect.
+func (c *Container) DialRelay(ctx context.Context, hops []relay.Hop, req relay.Request) (net.Conn, error) {
+	if len(hops) == 0 {
+		return nil, fmt.Errorf("no relay to connect to")
+	}
+	conn, err := c.Dial(ctx, "tcp", hops[0].Address)
+	if err != nil {
+		return nil, err
+	}
+	tunnel, err := wait(ctx, func() (net.Conn, error) {
+		return relay.Connect(conn, hops, req)
+	}, func() {
+		// Abort the handshake.
+		conn.Close()
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tunnel, nil
+}
+
+// DialRelayControl returns a client of the control server of the sandbox
+// behind the last of hops, reached through the network stack of this sandbox.
+// Calls that take files, like port forwarding, fail; use DialRelay with
+// relay.TargetDial to reach addresses in that sandbox instead.
+func (c *Container) DialRelayControl(ctx context.Context, hops []relay.Hop) (*urpc.Client, error) {
+	conn, err := c.DialRelay(ctx, hops, relay.Request{Target: relay.TargetControl})
+	if err != nil {
+		return nil, err
+	}
+	return relay.NewControlClient(conn)
+}
@@ -0,0 +1,150 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sandboxapi is a Go API to create and manage gVisor sandboxes from
+// other programs, without shelling out to the runsc command line.
+//
+// A Client manages the containers stored in one root directory, like runsc
+// --root does. Sandbox and gofer processes are started by executing the runsc
+// binary, so a Client needs the path to one, unless the calling program is
+// runsc itself:
+//
+//	client, err := sandboxapi.New(sandboxapi.Options{
+//		RootDir:   "/run/myagent/runsc",
+//		RunscPath: "/usr/local/bin/runsc",
+//	})
+//	...
+//	c, err := client.Create(ctx, sandboxapi.CreateOptions{
+//		ID:        "web",
+//		BundleDir: "/var/lib/myagent/bundles/web",
+//	})
+//	...
+//	err = c.Start(ctx)
+//	...
+//	status, err := c.Wait(ctx)
+//
+// Operations that wait, like Container.Wait, are canceled when their context
+// is done, and return its error.
+package sandboxapi
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/container"
+)
+
+// Options configure a Client.
+type Options struct {
+	// RootDir is the directory holding the state of containers. If empty,
+	// Config.RootDir is used.
+	RootDir string
+
+	// RunscPath is the path of the runsc binary used to start sandbox and
+	// gofer processes. If empty, the calling program must be runsc.
+	// Containers keep using the binary they were created with.
+	RunscPath string
+
+	// Config is the configuration of sandboxes created by the client, see
+	// config.Builder. If nil, the default configuration is used.
+	Config *config.Config
+}
+
+// Client creates and manages sandboxes.
+type Client struct {
+	conf      *config.Config
+	runscPath string
+}
+
+// New creates a new client.
+func New(opts Options) (*Client, error) {
+	conf := opts.Config
+	if conf == nil {
+		var err error
+		if conf, err = config.NewBuilder().Build(); err != nil {
+			return nil, err
+		}
+	}
+	if opts.RootDir != "" {
+		c := *conf
+		c.RootDir = opts.RootDir
+		conf = &c
+	}
+	return &Client{conf: conf, runscPath: opts.RunscPath}, nil
+}
+
+// Config returns the configuration of the client. It must not be modified.
+func (cl *Client) Config() *config.Config {
+	return cl.conf
+}
+
+// List returns the IDs of all containers in the root directory, sorted.
+func (cl *Client) List(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ids, err := container.List(cl.conf.RootDir)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, id := range ids {
+		out = append(out, id.ContainerID)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Load returns the container with the given ID, which may be a unique prefix
+// of the ID.
+func (cl *Client) Load(ctx context.Context, id string) (*Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c, err := container.Load(cl.conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		return nil, fmt.Errorf("loading container %q: %w", id, err)
+	}
+	if c.ExePath == "" {
+		// The container was created by runsc itself, which must also run
+		// the processes the client starts for it, e.g. gofers.
+		c.ExePath = cl.runscPath
+	}
+	return &Container{client: cl, c: c}, nil
+}
+
+// wait runs fn and returns its results. If ctx is done before fn returns,
+// cancel is called to interrupt fn, and ctx.Err() is returned once fn returned.
+func wait[T any](ctx context.Context, fn func() (T, error), cancel func()) (T, error) {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-stop:
+		}
+	}()
+	v, err := fn()
+	close(stop)
+	<-stopped
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		var zero T
+		return zero, ctxErr
+	}
+	return v, err
+}
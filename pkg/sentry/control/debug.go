@@ -0,0 +1,214 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/gdbstub"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
+)
+
+// Debug includes RPC stubs to debug applications running in the sandbox.
+type Debug struct {
+	Kernel *kernel.Kernel
+}
+
+// AttachGDBArgs are the arguments to AttachGDB.
+type AttachGDBArgs struct {
+	// ContainerID, if set, is the container that the process must belong to.
+	ContainerID string `json:"container_id"`
+
+	// PID is the ID of the process in the root PID namespace.
+	PID kernel.ThreadID `json:"pid"`
+
+	// FilePayload contains the connection to gdb.
+	urpc.FilePayload
+}
+
+// AttachGDB attaches a gdb remote serial protocol stub to a process. The stub
+// is served on the connection passed in the payload, in the background, until
+// gdb detaches or the process exits.
+func (d *Debug) AttachGDB(args *AttachGDBArgs, _ *struct{}) error {
+	if len(args.Files) != 1 {
+		return fmt.Errorf("expected 1 file, got %d", len(args.Files))
+	}
+	conn := args.Files[0]
+
+	tg := d.Kernel.RootPIDNamespace().ThreadGroupWithID(args.PID)
+	if tg == nil || (args.ContainerID != "" && tg.Leader().ContainerID() != args.ContainerID) {
+		conn.Close()
+		return fmt.Errorf("process %d not found", args.PID)
+	}
+	dbg, err := tg.AttachDebugger()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("attaching to process %d: %w", args.PID, err)
+	}
+	log.Infof("gdb attached to process %d", args.PID)
+	go func() {
+		if err := gdbstub.Serve(d.Kernel, dbg, conn); err != nil {
+			log.Warningf("gdb connection to process %d failed: %v", args.PID, err)
+		}
+		log.Infof("gdb detached from process %d", args.PID)
+	}()
+	return nil
+}
+
+// ThreadsArgs are the arguments to Threads.
+type ThreadsArgs struct {
+	// Stacks causes the stack of the task goroutine of each thread to be
+	// included.
+	Stacks bool `json:"stacks"`
+}
+
+// ThreadState is the state of a guest thread.
+type ThreadState struct {
+	// PID and TID are the thread group and thread IDs in the root PID
+	// namespace.
+	PID kernel.ThreadID `json:"pid"`
+	TID kernel.ThreadID `json:"tid"`
+
+	ContainerID string `json:"container_id"`
+	Name        string `json:"name"`
+
+	// State is the state of the task goroutine.
+	State string `json:"state"`
+
+	// Syscall and Args describe the syscall in progress, if the thread is
+	// blocked or stopped in one.
+	Syscall string   `json:"syscall,omitempty"`
+	Args    []uint64 `json:"args,omitempty"`
+
+	// UserPC and UserSP are the application instruction and stack pointers,
+	// if the thread is blocked or stopped.
+	UserPC uint64 `json:"user_pc,omitempty"`
+	UserSP uint64 `json:"user_sp,omitempty"`
+
+	// WaitChannel is the sentry function the thread is blocked in.
+	WaitChannel string `json:"wait_channel,omitempty"`
+
+	// GoroutineID is the ID of the task goroutine.
+	GoroutineID int64 `json:"goroutine_id"`
+
+	// Stack is the stack of the task goroutine, if requested.
+	Stack string `json:"stack,omitempty"`
+}
+
+// Threads returns the state of all guest threads.
+func (d *Debug) Threads(args *ThreadsArgs, out *[]*ThreadState) error {
+	stacks := goroutineStacks(log.Stacks(true))
+	root := d.Kernel.RootPIDNamespace()
+	var threads []*ThreadState
+	for _, t := range root.Tasks() {
+		ts := &ThreadState{
+			PID:         root.IDOfThreadGroup(t.ThreadGroup()),
+			TID:         root.IDOfTask(t),
+			ContainerID: t.ContainerID(),
+			Name:        t.Name(),
+			State:       t.TaskGoroutineSchedInfo().State.String(),
+			GoroutineID: t.GoroutineID(),
+		}
+		if ts.TID == 0 {
+			// Exited concurrently.
+			continue
+		}
+		stack, hasStack := stacks[ts.GoroutineID]
+		if ds, ok := t.DebugState(); ok {
+			ts.UserPC = uint64(ds.IP)
+			ts.UserSP = uint64(ds.SP)
+			if ds.InSyscall {
+				ts.Syscall = t.SyscallTable().LookupName(ds.Sysno)
+				for _, a := range ds.Args {
+					ts.Args = append(ts.Args, a.Uint64())
+				}
+			}
+			if hasStack {
+				ts.WaitChannel = waitChannel(stack)
+			}
+		}
+		if args.Stacks && hasStack {
+			ts.Stack = stack
+		}
+		threads = append(threads, ts)
+	}
+	sort.Slice(threads, func(i, j int) bool { return threads[i].TID < threads[j].TID })
+	*out = threads
+	return nil
+}
+
+// goroutineHeader matches the first line of a goroutine stack.
+var goroutineHeader = regexp.MustCompile(`^goroutine (\d+) `)
+
+// goroutineStacks splits the output of runtime.Stack into the stacks of
+// individual goroutines, keyed by goroutine ID.
+func goroutineStacks(all []byte) map[int64]string {
+	stacks := make(map[int64]string)
+	for _, stack := range bytes.Split(all, []byte("\n\n")) {
+		m := goroutineHeader.FindSubmatch(stack)
+		if m == nil {
+			continue
+		}
+		id, err := strconv.ParseInt(string(m[1]), 10, 64)
+		if err != nil {
+			continue
+		}
+		stacks[id] = string(stack)
+	}
+	return stacks
+}
+
+// waitChannelSkip are function name prefixes of frames that are skipped to
+// find the wait channel of a goroutine.
+var waitChannelSkip = []string{
+	"runtime.",
+	"sync.",
+	"kernel.(*Task).block",
+	"kernel.(*Task).Block",
+	"kernel.(*Task).doStop",
+}
+
+// waitChannel returns the innermost function of a goroutine stack that isn't
+// part of the Go runtime, synchronization primitives or the task blocking
+// machinery.
+func waitChannel(stack string) string {
+	lines := strings.Split(stack, "\n")
+frames:
+	// The first line is the goroutine header; frames alternate between
+	// function and file lines.
+	for i := 1; i < len(lines); i += 2 {
+		fn := lines[i]
+		if j := strings.LastIndex(fn, "("); j > 0 {
+			fn = fn[:j]
+		}
+		if j := strings.LastIndex(fn, "/"); j >= 0 {
+			fn = fn[j+1:]
+		}
+		for _, skip := range waitChannelSkip {
+			if strings.HasPrefix(fn, skip) {
+				continue frames
+			}
+		}
+		return fn
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/faultinject"
+)
+
+// FaultInject includes fault injection RPC stubs.
+type FaultInject struct{}
+
+// Add installs a fault injection rule, replacing any rule with the same name.
+func (*FaultInject) Add(rule *faultinject.Rule, _ *struct{}) error {
+	log.Debugf("FaultInject.Add: %+v", *rule)
+	return faultinject.Add(*rule)
+}
+
+// Remove uninstalls the fault injection rule with the given name.
+func (*FaultInject) Remove(name *string, _ *struct{}) error {
+	log.Debugf("FaultInject.Remove: %q", *name)
+	return faultinject.Remove(*name)
+}
+
+// Clear uninstalls all fault injection rules.
+func (*FaultInject) Clear(_ *struct{}, _ *struct{}) error {
+	log.Debugf("FaultInject.Clear")
+	faultinject.Clear()
+	return nil
+}
+
+// List returns all installed fault injection rules.
+func (*FaultInject) List(_ *struct{}, out *[]faultinject.Rule) error {
+	*out = faultinject.List()
+	return nil
+}
@@ -18,13 +18,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
 	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
 )
@@ -38,9 +41,33 @@ type CatOpts struct {
 	urpc.FilePayload
 }
 
+// FreezeOpts contains options for the Freeze and Thaw RPC calls.
+type FreezeOpts struct {
+	// ContainerID is the container in whose mount namespace Mounts are
+	// resolved.
+	ContainerID string `json:"container_id"`
+
+	// Mounts are paths in the filesystems to freeze or thaw, typically the
+	// mount points of volumes.
+	Mounts []string `json:"mounts"`
+
+	// Timeout, if non-zero, is the time after which frozen filesystems are
+	// thawed automatically, so that a failed snapshot doesn't leave the
+	// sandbox hung.
+	Timeout time.Duration `json:"timeout"`
+}
+
 // Fs includes fs-related functions.
 type Fs struct {
 	Kernel *kernel.Kernel
+
+	// mu protects frozen.
+	mu sync.Mutex
+
+	// frozen maps the filesystems frozen by Freeze to their auto-thaw timer,
+	// which is nil if there is none. frozen holds a reference on each
+	// filesystem.
+	frozen map[*vfs.Filesystem]*time.Timer
 }
 
 // Cat is a RPC stub which prints out and returns the content of the files.
@@ -94,3 +121,143 @@ func cat(k *kernel.Kernel, path string, output *os.File) error {
 	_, err = io.Copy(output, &fdReader{ctx: ctx, fd: fd})
 	return err
 }
+
+// Freeze quiesces writes to the filesystems of the given mounts and writes
+// back their cached data, so that a crash-consistent snapshot of their backing
+// storage can be taken on the host. Either all filesystems are frozen or none
+// is.
+func (f *Fs) Freeze(o *FreezeOpts, _ *struct{}) error {
+	log.Debugf("Fs.Freeze: %+v", *o)
+	ctx := f.Kernel.SupervisorContext()
+	fss, paths, err := f.filesystems(ctx, o)
+	if err != nil {
+		return err
+	}
+	defer decRefFilesystems(ctx, fss)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.frozen == nil {
+		f.frozen = make(map[*vfs.Filesystem]*time.Timer)
+	}
+	for i, fs := range fss {
+		if err := fs.Freeze(ctx); err != nil {
+			for _, frozen := range fss[:i] {
+				if err := frozen.Thaw(ctx); err != nil {
+					log.Warningf("Fs.Freeze: failed to thaw %q: %v", frozen.FilesystemType().Name(), err)
+				}
+			}
+			return fmt.Errorf("cannot freeze %q filesystem of mount %q: %w", fs.FilesystemType().Name(), paths[i], err)
+		}
+	}
+	for _, fs := range fss {
+		fs.IncRef()
+		var timer *time.Timer
+		if o.Timeout > 0 {
+			fs := fs
+			timer = time.AfterFunc(o.Timeout, func() {
+				log.Warningf("Fs.Freeze: thawing %q filesystem after %v", fs.FilesystemType().Name(), o.Timeout)
+				f.mu.Lock()
+				defer f.mu.Unlock()
+				if f.frozen[fs] != nil {
+					f.thawLocked(ctx, fs)
+				}
+			})
+		}
+		f.frozen[fs] = timer
+	}
+	return nil
+}
+
+// Thaw undoes Freeze for the filesystems of the given mounts.
+func (f *Fs) Thaw(o *FreezeOpts, _ *struct{}) error {
+	log.Debugf("Fs.Thaw: %+v", *o)
+	ctx := f.Kernel.SupervisorContext()
+	fss, paths, err := f.filesystems(ctx, o)
+	if err != nil {
+		return err
+	}
+	defer decRefFilesystems(ctx, fss)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var lastErr error
+	for i, fs := range fss {
+		if _, ok := f.frozen[fs]; !ok {
+			lastErr = fmt.Errorf("filesystem of mount %q isn't frozen", paths[i])
+			continue
+		}
+		if err := f.thawLocked(ctx, fs); err != nil {
+			lastErr = fmt.Errorf("cannot thaw filesystem of mount %q: %w", paths[i], err)
+		}
+	}
+	return lastErr
+}
+
+// thawLocked thaws fs, which must be in f.frozen.
+//
+// Preconditions: f.mu must be locked.
+func (f *Fs) thawLocked(ctx context.Context, fs *vfs.Filesystem) error {
+	if timer := f.frozen[fs]; timer != nil {
+		timer.Stop()
+	}
+	delete(f.frozen, fs)
+	defer fs.DecRef(ctx)
+	return fs.Thaw(ctx)
+}
+
+// filesystems returns the distinct filesystems of o.Mounts, in the mount
+// namespace of container o.ContainerID, and the first path in o.Mounts of
+// each. A reference is taken on each returned filesystem.
+func (f *Fs) filesystems(ctx context.Context, o *FreezeOpts) ([]*vfs.Filesystem, []string, error) {
+	if len(o.Mounts) == 0 {
+		return nil, nil, fmt.Errorf("no mounts given")
+	}
+	var mns *vfs.MountNamespace
+	for _, tg := range f.Kernel.TaskSet().Root.ThreadGroups() {
+		if leader := tg.Leader(); leader != nil && leader.ContainerID() == o.ContainerID {
+			mns = leader.MountNamespace()
+			break
+		}
+	}
+	if mns == nil {
+		return nil, nil, fmt.Errorf("container %q not found", o.ContainerID)
+	}
+	root := mns.Root()
+	root.IncRef()
+	defer root.DecRef(ctx)
+
+	creds := auth.NewRootCredentials(f.Kernel.RootUserNamespace())
+	var (
+		fss   []*vfs.Filesystem
+		paths []string
+	)
+	seen := make(map[*vfs.Filesystem]struct{})
+	for _, path := range o.Mounts {
+		vd, err := f.Kernel.VFS().GetDentryAt(ctx, creds, &vfs.PathOperation{
+			Root:               root,
+			Start:              root,
+			Path:               fspath.Parse(path),
+			FollowFinalSymlink: true,
+		}, &vfs.GetDentryOptions{})
+		if err != nil {
+			decRefFilesystems(ctx, fss)
+			return nil, nil, fmt.Errorf("cannot resolve mount %q: %w", path, err)
+		}
+		fs := vd.Mount().Filesystem()
+		if _, ok := seen[fs]; !ok {
+			seen[fs] = struct{}{}
+			fs.IncRef()
+			fss = append(fss, fs)
+			paths = append(paths, path)
+		}
+		vd.DecRef(ctx)
+	}
+	return fss, paths, nil
+}
+
+func decRefFilesystems(ctx context.Context, fss []*vfs.Filesystem) {
+	for _, fs := range fss {
+		fs.DecRef(ctx)
+	}
+}
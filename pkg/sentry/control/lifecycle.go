@@ -17,6 +17,8 @@ package control
 import (
 	"encoding/json"
 	"fmt"
+	"runtime"
+	"runtime/debug"
 	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
@@ -29,6 +31,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/limits"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/usage"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
@@ -384,6 +387,67 @@ func (l *Lifecycle) Resume(_, _ *struct{}) error {
 	return nil
 }
 
+// SetCPUsArgs are the arguments to SetCPUs.
+type SetCPUsArgs struct {
+	// NumCPUs is the number of CPUs sandboxed applications can run on.
+	NumCPUs int `json:"num_cpus"`
+}
+
+// SetCPUs brings CPUs online or offline so that sandboxed applications run on
+// args.NumCPUs CPUs, and sizes the sentry's Go scheduler to match.
+func (l *Lifecycle) SetCPUs(args *SetCPUsArgs, _ *struct{}) error {
+	if args.NumCPUs <= 0 {
+		return fmt.Errorf("invalid number of CPUs %d", args.NumCPUs)
+	}
+	if err := l.Kernel.SetOnlineCores(uint(args.NumCPUs)); err != nil {
+		return err
+	}
+	runtime.GOMAXPROCS(args.NumCPUs)
+	return nil
+}
+
+// SetMemoryArgs are the arguments to SetMemory.
+type SetMemoryArgs struct {
+	// TotalMem is the amount of total memory, in bytes, reported to sandboxed
+	// applications.
+	TotalMem uint64 `json:"total_mem"`
+}
+
+// SetMemory changes the total memory reported to sandboxed applications, e.g.
+// in /proc/meminfo and sysinfo(2). When the total memory shrinks, evictable
+// memory is reclaimed so that usage can fit the new limit.
+func (l *Lifecycle) SetMemory(args *SetMemoryArgs, _ *struct{}) error {
+	if args.TotalMem == 0 {
+		return fmt.Errorf("invalid total memory %d", args.TotalMem)
+	}
+	old := usage.SetTotalMemoryBytes(args.TotalMem)
+	log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(1<<30))
+	if old == 0 || args.TotalMem < old {
+		l.Kernel.MemoryFile().StartEvictions()
+	}
+	return nil
+}
+
+// SetBalloonArgs are the arguments to SetBalloon.
+type SetBalloonArgs struct {
+	// TargetBytes is the amount of memory, in bytes, the sandbox should
+	// return to the host.
+	TargetBytes uint64 `json:"target_bytes"`
+}
+
+// SetBalloon sets the amount of memory the sandbox should return to the host.
+// Like memory claimed by a balloon driver, it is taken from the memory
+// available to sandboxed applications. Inflating the balloon shrinks the
+// sandbox's caches and returns free sentry memory to the host.
+func (l *Lifecycle) SetBalloon(args *SetBalloonArgs, _ *struct{}) error {
+	log.Infof("Setting balloon target to %d bytes", args.TargetBytes)
+	l.Kernel.MemoryFile().SetBalloonTarget(args.TargetBytes)
+	if args.TargetBytes > 0 {
+		debug.FreeOSMemory()
+	}
+	return nil
+}
+
 // Shutdown sends signal to destroy the sentry/sandbox.
 func (l *Lifecycle) Shutdown(_, _ *struct{}) error {
 	close(l.ShutdownCh)
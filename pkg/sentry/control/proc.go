@@ -29,6 +29,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fdimport"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/host"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/user"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	ktime "github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/time"
@@ -139,6 +140,18 @@ type ExecArgs struct {
 	// PIDNamespace is the pid namespace for the process being executed.
 	PIDNamespace *kernel.PIDNamespace
 
+	// NetworkNamespace is the network namespace for the process being
+	// executed. If nil, the root network namespace is used.
+	NetworkNamespace *inet.Namespace
+
+	// UTSNamespace is the UTS namespace for the process being executed. If
+	// nil, the root UTS namespace is used.
+	UTSNamespace *kernel.UTSNamespace
+
+	// IPCNamespace is the IPC namespace for the process being executed. If
+	// nil, the root IPC namespace is used.
+	IPCNamespace *kernel.IPCNamespace
+
 	// Limits is the limit set for the process being executed.
 	Limits *limits.LimitSet
 }
@@ -193,6 +206,18 @@ func (proc *Proc) execAsync(args *ExecArgs) (*kernel.ThreadGroup, kernel.ThreadI
 	if pidns == nil {
 		pidns = proc.Kernel.RootPIDNamespace()
 	}
+	utsns := args.UTSNamespace
+	if utsns == nil {
+		utsns = proc.Kernel.RootUTSNamespace()
+	}
+	// initArgs must hold a reference on IPCNamespace, which will be donated
+	// to the new process in CreateProcess.
+	ipcns := args.IPCNamespace
+	if ipcns == nil {
+		ipcns = proc.Kernel.RootIPCNamespace()
+	} else {
+		ipcns.IncRef()
+	}
 	limitSet := args.Limits
 	if limitSet == nil {
 		limitSet = limits.NewLimitSet()
@@ -208,11 +233,12 @@ func (proc *Proc) execAsync(args *ExecArgs) (*kernel.ThreadGroup, kernel.ThreadI
 		Umask:                   0022,
 		Limits:                  limitSet,
 		MaxSymlinkTraversals:    linux.MaxSymlinkTraversals,
-		UTSNamespace:            proc.Kernel.RootUTSNamespace(),
-		IPCNamespace:            proc.Kernel.RootIPCNamespace(),
+		UTSNamespace:            utsns,
+		IPCNamespace:            ipcns,
 		AbstractSocketNamespace: proc.Kernel.RootAbstractSocketNamespace(),
 		ContainerID:             args.ContainerID,
 		PIDNamespace:            pidns,
+		NetworkNamespace:        args.NetworkNamespace,
 	}
 	if initArgs.MountNamespace != nil {
 		// initArgs must hold a reference on MountNamespace, which will
@@ -20,6 +20,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/pgalloc"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/state"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/watchdog"
 	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
@@ -43,6 +44,18 @@ type SaveOpts struct {
 	// Metadata is the set of metadata to prepend to the state file.
 	Metadata map[string]string `json:"metadata"`
 
+	// Resume indicates that the sandbox keeps running after the save,
+	// instead of exiting.
+	Resume bool `json:"resume"`
+
+	// Checksums enables checksums of the state file and of the saved memory
+	// pages, verified on restore.
+	Checksums bool `json:"checksums"`
+
+	// Precopy, if not nil, records the memory pre-copied to the destination
+	// before the save. It's only set within the sandbox.
+	Precopy *pgalloc.PrecopyState `json:"-"`
+
 	// FilePayload contains the destination for the state.
 	urpc.FilePayload
 }
@@ -60,7 +73,18 @@ func (s *State) Save(o *SaveOpts, _ *struct{}) error {
 		Destination: o.FilePayload.Files[0],
 		Key:         o.Key,
 		Metadata:    o.Metadata,
+		Checksums:   o.Checksums,
+		Precopy:     o.Precopy,
+		Resume:      o.Resume,
 		Callback: func(err error) {
+			if o.Resume {
+				if err == nil {
+					log.Infof("Save succeeded: resuming...")
+				} else {
+					log.Warningf("Save failed: resuming...")
+				}
+				return
+			}
 			if err == nil {
 				log.Infof("Save succeeded: exiting...")
 				s.Kernel.SetSaveSuccess(false /* autosave */)
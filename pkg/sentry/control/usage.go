@@ -23,6 +23,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsmetric"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/usage"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
 	"golang.org/x/sys/unix"
 )
@@ -30,6 +31,12 @@ import (
 // Usage includes usage-related RPC stubs.
 type Usage struct {
 	Kernel *kernel.Kernel
+
+	// mu protects sampler.
+	mu sync.Mutex
+
+	// sampler is the running usage sampler, if any.
+	sampler *usageSampler
 }
 
 // MemoryUsageOpts contains usage options.
@@ -104,24 +111,65 @@ func (u *Usage) Collect(opts *MemoryUsageOpts, out *MemoryUsage) error {
 			Total:     total,
 		}
 	} else {
-		// Get total usage from the MemoryFile implementation.
-		total, err := u.Kernel.MemoryFile().TotalUsage()
+		m, err := u.collectPartial()
 		if err != nil {
 			return err
 		}
+		*out = m
+	}
 
-		// The memory accounting is guaranteed to be accurate only when
-		// UpdateUsage is called. If UpdateUsage is not called, then only Mapped
-		// will be up-to-date.
-		snapshot, _ := usage.MemoryAccounting.Copy()
-		*out = MemoryUsage{
-			Unknown: total,
-			Mapped:  snapshot.Mapped,
-			Total:   total + snapshot.Mapped,
-		}
+	return nil
+}
 
+// collectPartial returns a partial accounting of the memory used by the
+// sandboxed application, see Collect.
+func (u *Usage) collectPartial() (MemoryUsage, error) {
+	// Get total usage from the MemoryFile implementation.
+	total, err := u.Kernel.MemoryFile().TotalUsage()
+	if err != nil {
+		return MemoryUsage{}, err
 	}
 
+	// The memory accounting is guaranteed to be accurate only when
+	// UpdateUsage is called. If UpdateUsage is not called, then only Mapped
+	// will be up-to-date.
+	snapshot, _ := usage.MemoryAccounting.Copy()
+	return MemoryUsage{
+		Unknown: total,
+		Mapped:  snapshot.Mapped,
+		Total:   total + snapshot.Mapped,
+	}, nil
+}
+
+// SentryMemoryUsage is the memory used by the sentry itself, i.e. the runtime
+// overhead of the sandbox, as opposed to the memory used on behalf of the
+// application reported by Collect. All values are in bytes.
+type SentryMemoryUsage struct {
+	Heap     uint64 `json:"Heap"`
+	HeapFree uint64 `json:"HeapFree"`
+	Stacks   uint64 `json:"Stacks"`
+	Runtime  uint64 `json:"Runtime"`
+	Total    uint64 `json:"Total"`
+
+	// Limit is the cap on Total, or 0 if the sentry's memory isn't capped.
+	Limit uint64 `json:"Limit"`
+
+	// OverLimit is true if Total exceeded Limit when last checked.
+	OverLimit bool `json:"OverLimit"`
+}
+
+// CollectSentry returns the memory used by the sentry itself.
+func (u *Usage) CollectSentry(_ *struct{}, out *SentryMemoryUsage) error {
+	stats := usage.ReadSentryMemory()
+	*out = SentryMemoryUsage{
+		Heap:      stats.Heap,
+		HeapFree:  stats.HeapFree,
+		Stacks:    stats.Stacks,
+		Runtime:   stats.Runtime,
+		Total:     stats.Total,
+		Limit:     usage.SentryMemoryLimit.Load(),
+		OverLimit: usage.SentryMemoryOverLimit(),
+	}
 	return nil
 }
 
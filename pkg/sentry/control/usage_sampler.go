@@ -0,0 +1,186 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+)
+
+const (
+	// minSamplingInterval is the shortest interval at which usage can be
+	// sampled.
+	minSamplingInterval = 10 * time.Millisecond
+
+	// defaultSampleCapacity is the number of samples kept by default.
+	defaultSampleCapacity = 600
+
+	// maxSampleCapacity is the maximum number of samples kept.
+	maxSampleCapacity = 1 << 20
+)
+
+// UsageSamplingOpts contains options to Usage.StartSampling.
+type UsageSamplingOpts struct {
+	// Interval is the time between samples.
+	Interval time.Duration `json:"interval"`
+
+	// Capacity is the number of samples kept. Once it is reached, new samples
+	// replace the oldest ones. If 0, defaultSampleCapacity is used.
+	Capacity int `json:"capacity"`
+}
+
+// UsageSample is the usage of the sandbox at a point in time.
+type UsageSample struct {
+	// Time is when the sample was taken.
+	Time time.Time `json:"time"`
+
+	// Memory is a partial accounting of memory usage, see Usage.Collect.
+	Memory MemoryUsage `json:"memory"`
+
+	// CPUUsage is the CPU time, in nanoseconds, used by the sandboxed
+	// application since it started.
+	CPUUsage uint64 `json:"cpu_usage_ns"`
+}
+
+// UsageSamples is a time series of usage samples.
+type UsageSamples struct {
+	// Interval is the time between samples.
+	Interval time.Duration `json:"interval"`
+
+	// Samples are the samples recorded, oldest first.
+	Samples []UsageSample `json:"samples"`
+}
+
+// usageSampler periodically records usage samples into a ring.
+type usageSampler struct {
+	interval time.Duration
+	stop     chan struct{}
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// samples is the ring of samples. next is the index of the next sample
+	// to write, and full is set once the ring has wrapped around.
+	samples []UsageSample
+	next    int
+	full    bool
+}
+
+// StartSampling starts recording usage samples at a fixed interval in the
+// background. Samples recorded by a previous sampler are discarded.
+func (u *Usage) StartSampling(opts *UsageSamplingOpts, _ *struct{}) error {
+	if opts.Interval < minSamplingInterval {
+		return fmt.Errorf("sampling interval %v is shorter than %v", opts.Interval, minSamplingInterval)
+	}
+	capacity := opts.Capacity
+	if capacity == 0 {
+		capacity = defaultSampleCapacity
+	}
+	if capacity < 0 || capacity > maxSampleCapacity {
+		return fmt.Errorf("invalid sample capacity %d", opts.Capacity)
+	}
+
+	s := &usageSampler{
+		interval: opts.Interval,
+		stop:     make(chan struct{}),
+		samples:  make([]UsageSample, capacity),
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.sampler != nil {
+		close(u.sampler.stop)
+	}
+	u.sampler = s
+	log.Infof("Sampling usage every %v, keeping %d samples", s.interval, capacity)
+	go u.runSampler(s) // S/R-SAFE: not saved.
+	return nil
+}
+
+// StopSampling stops the running usage sampler. The samples recorded so far
+// can still be retrieved.
+func (u *Usage) StopSampling(_, _ *struct{}) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.sampler == nil {
+		return fmt.Errorf("usage sampling was not started")
+	}
+	select {
+	case <-u.sampler.stop:
+	default:
+		close(u.sampler.stop)
+	}
+	return nil
+}
+
+// Samples returns the usage samples recorded by the last sampler started.
+func (u *Usage) Samples(_ *struct{}, out *UsageSamples) error {
+	u.mu.Lock()
+	s := u.sampler
+	u.mu.Unlock()
+	if s == nil {
+		return fmt.Errorf("usage sampling was not started")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out.Interval = s.interval
+	if s.full {
+		out.Samples = append(out.Samples, s.samples[s.next:]...)
+	}
+	out.Samples = append(out.Samples, s.samples[:s.next]...)
+	return nil
+}
+
+// runSampler records samples into s until it is stopped.
+func (u *Usage) runSampler(s *usageSampler) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		u.recordSample(s)
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// recordSample records the current usage into s.
+func (u *Usage) recordSample(s *usageSampler) {
+	m, err := u.collectPartial()
+	if err != nil {
+		log.Warningf("Failed to sample memory usage: %v", err)
+		return
+	}
+	sample := UsageSample{
+		Time:   time.Now(),
+		Memory: m,
+	}
+	for _, cpu := range ContainerUsage(u.Kernel) {
+		sample.CPUUsage += cpu
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.samples[s.next] = sample
+	s.next++
+	if s.next == len(s.samples) {
+		s.next = 0
+		s.full = true
+	}
+}
@@ -0,0 +1,267 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package faultinject implements rule based error and latency injection for
+// sentry filesystem and network operations. It is meant for chaos testing of
+// applications running inside the sandbox.
+//
+// Rules are installed at runtime via the control server. When no rules are
+// installed, Check is a single atomic load.
+package faultinject
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux/errno"
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/metric"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
+	"golang.org/x/sys/unix"
+)
+
+// Point identifies an operation where faults can be injected.
+type Point string
+
+// Injection points.
+const (
+	// GoferWalk is a lookup of a child in a gofer directory.
+	GoferWalk Point = "gofer.walk"
+
+	// GoferOpen is an open of a gofer file.
+	GoferOpen Point = "gofer.open"
+
+	// GoferRead is a read from a gofer regular file.
+	GoferRead Point = "gofer.read"
+
+	// GoferWrite is a write to a gofer regular file.
+	GoferWrite Point = "gofer.write"
+
+	// NetConnect is a connect(2) on a netstack socket. The path is the
+	// destination address.
+	NetConnect Point = "net.connect"
+
+	// NetSend is a send on a netstack socket. The path is the remote address,
+	// if known.
+	NetSend Point = "net.send"
+
+	// NetRecv is a receive on a netstack socket. The path is the remote
+	// address, if known.
+	NetRecv Point = "net.recv"
+)
+
+// Points lists all known injection points.
+var Points = []Point{GoferWalk, GoferOpen, GoferRead, GoferWrite, NetConnect, NetSend, NetRecv}
+
+// Rule describes a fault to inject.
+type Rule struct {
+	// Name uniquely identifies the rule.
+	Name string `json:"name"`
+
+	// Point is a glob matched against the injection point, e.g. "gofer.*".
+	Point string `json:"point"`
+
+	// Path is an optional glob matched against the file path (relative to the
+	// mount root) or the remote network address. Empty matches everything.
+	Path string `json:"path,omitempty"`
+
+	// Probability is the chance, in (0, 1], that the rule fires when matched.
+	// Zero is treated as 1.
+	Probability float64 `json:"probability,omitempty"`
+
+	// Errno is the error number returned when the rule fires. Zero means that
+	// no error is injected, only latency.
+	Errno uint32 `json:"errno,omitempty"`
+
+	// Delay is the latency added when the rule fires.
+	Delay time.Duration `json:"delay,omitempty"`
+
+	// Count is the maximum number of times the rule fires. Zero means
+	// unlimited.
+	Count uint64 `json:"count,omitempty"`
+
+	// Fired is the number of times the rule has fired. It is ignored when
+	// adding a rule.
+	Fired uint64 `json:"fired,omitempty"`
+}
+
+// Validate checks that the rule is well formed.
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule name cannot be empty")
+	}
+	if r.Point == "" {
+		return fmt.Errorf("rule %q: point cannot be empty", r.Name)
+	}
+	if _, err := path.Match(r.Point, ""); err != nil {
+		return fmt.Errorf("rule %q: invalid point pattern %q: %w", r.Name, r.Point, err)
+	}
+	if _, err := path.Match(r.Path, ""); err != nil {
+		return fmt.Errorf("rule %q: invalid path pattern %q: %w", r.Name, r.Path, err)
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("rule %q: probability must be in [0, 1], got %v", r.Name, r.Probability)
+	}
+	if r.Errno != 0 {
+		if r.Errno > uint32(errno.EHWPOISON) {
+			return fmt.Errorf("rule %q: invalid errno %d", r.Name, r.Errno)
+		}
+		if e, ok := linuxerr.ErrorFromUnix(unix.Errno(r.Errno)).(*errors.Error); !ok || e == nil {
+			return fmt.Errorf("rule %q: invalid errno %d", r.Name, r.Errno)
+		}
+	}
+	if r.Delay < 0 {
+		return fmt.Errorf("rule %q: delay cannot be negative", r.Name)
+	}
+	if r.Errno == 0 && r.Delay == 0 {
+		return fmt.Errorf("rule %q: must inject an error, a delay, or both", r.Name)
+	}
+	return nil
+}
+
+func (r *Rule) matches(point Point, p string) bool {
+	if ok, _ := path.Match(r.Point, string(point)); !ok {
+		return false
+	}
+	if r.Path == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Path, p)
+	return ok
+}
+
+var (
+	// enabled is set when at least one rule is installed.
+	enabled atomicbitops.Bool
+
+	mu sync.Mutex
+
+	// rules holds the installed rules, in insertion order.
+	//
+	// +checklocks:mu
+	rules []*Rule
+)
+
+var injected = metric.MustCreateNewUint64Metric("/faultinject/injected", false /* sync */, "Number of faults injected by fault injection rules.")
+
+// Add installs a rule. If a rule with the same name exists, it is replaced.
+func Add(r Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	r.Fired = 0
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, old := range rules {
+		if old.Name == r.Name {
+			rules[i] = &r
+			return nil
+		}
+	}
+	rules = append(rules, &r)
+	enabled.Store(true)
+	log.Infof("Fault injection rule added: %+v", r)
+	return nil
+}
+
+// Remove uninstalls the rule with the given name.
+func Remove(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, r := range rules {
+		if r.Name == name {
+			rules = append(rules[:i], rules[i+1:]...)
+			enabled.Store(len(rules) > 0)
+			return nil
+		}
+	}
+	return fmt.Errorf("fault injection rule %q not found", name)
+}
+
+// Clear uninstalls all rules.
+func Clear() {
+	mu.Lock()
+	defer mu.Unlock()
+	rules = nil
+	enabled.Store(false)
+}
+
+// List returns a copy of all installed rules.
+func List() []Rule {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, *r)
+	}
+	return out
+}
+
+// Enabled returns true if at least one rule is installed. Callers can use it
+// to skip computing the path passed to Check.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Check evaluates the installed rules for the given point and path. If a rule
+// fires, its delay is applied by blocking on ctx and its error, if any, is
+// returned. Only the first matching rule that fires is applied.
+func Check(ctx context.Context, point Point, p string) error {
+	if !enabled.Load() {
+		return nil
+	}
+	r, ok := fire(point, p)
+	if !ok {
+		return nil
+	}
+	injected.Increment()
+	if r.Delay > 0 {
+		var q waiter.NeverReady
+		if left, ok := ctx.BlockWithTimeoutOn(&q, waiter.EventIn, r.Delay); !ok && left != 0 {
+			return linuxerr.ErrInterrupted
+		}
+	}
+	if r.Errno != 0 {
+		return linuxerr.ErrorFromUnix(unix.Errno(r.Errno))
+	}
+	return nil
+}
+
+// fire returns a copy of the first rule that matches and fires.
+func fire(point Point, p string) (Rule, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range rules {
+		if r.Count > 0 && r.Fired >= r.Count {
+			continue
+		}
+		if !r.matches(point, p) {
+			continue
+		}
+		if r.Probability > 0 && r.Probability < 1 && rand.Float64() >= r.Probability {
+			continue
+		}
+		r.Fired++
+		return *r, true
+	}
+	return Rule{}, false
+}
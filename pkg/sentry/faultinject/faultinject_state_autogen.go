@@ -0,0 +1,3 @@
+// automatically generated by stateify.
+
+package faultinject
@@ -0,0 +1,356 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package binfmtmisc implements the binfmt_misc filesystem, which configures
+// the interpreters used to run binaries of other formats, e.g. binaries for
+// other architectures run through qemu-user.
+//
+// All binfmt_misc filesystems show the kernel's single registry, as in Linux.
+package binfmtmisc
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/kernfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/loader"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
+)
+
+const (
+	// Name is the user-visible filesystem name.
+	Name = "binfmt_misc"
+
+	// maxCommandLength is the maximum length of a command written to the
+	// status or entry files.
+	maxCommandLength = 3
+)
+
+// FilesystemType implements vfs.FilesystemType.
+//
+// +stateify savable
+type FilesystemType struct{}
+
+// Name implements vfs.FilesystemType.Name.
+func (FilesystemType) Name() string {
+	return Name
+}
+
+// Release implements vfs.FilesystemType.Release.
+func (FilesystemType) Release(ctx context.Context) {}
+
+// GetFilesystem implements vfs.FilesystemType.GetFilesystem.
+func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, source string, opts vfs.GetFilesystemOptions) (*vfs.Filesystem, *vfs.Dentry, error) {
+	k := kernel.KernelFromContext(ctx)
+	if k == nil {
+		return nil, nil, linuxerr.EINVAL
+	}
+	devMinor, err := vfsObj.GetAnonBlockDevMinor()
+	if err != nil {
+		return nil, nil, err
+	}
+	fs := &filesystem{
+		devMinor: devMinor,
+		registry: k.BinfmtMisc(),
+	}
+	fs.VFSFilesystem().Init(vfsObj, &fsType, fs)
+
+	root := &rootInode{fs: fs}
+	root.StaticDirectory.Init(ctx, creds, linux.UNNAMED_MAJOR, devMinor, fs.NextIno(), 0755, kernfs.GenericDirectoryFDOptions{
+		SeekEnd: kernfs.SeekEndZero,
+	})
+	root.InitRefs()
+	root.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+	root.IncLinks(root.OrderedChildren.Populate(map[string]kernfs.Inode{
+		"register": fs.newRegisterFile(ctx, creds),
+		"status":   fs.newStatusFile(ctx, creds),
+	}))
+	var rootD kernfs.Dentry
+	rootD.InitRoot(&fs.Filesystem, root)
+	return fs.VFSFilesystem(), rootD.VFSDentry(), nil
+}
+
+// filesystem implements vfs.FilesystemImpl.
+//
+// +stateify savable
+type filesystem struct {
+	kernfs.Filesystem
+
+	devMinor uint32
+
+	// registry is the kernel's binfmt_misc registry. registry is immutable.
+	registry *loader.BinfmtMisc
+}
+
+// Release implements vfs.FilesystemImpl.Release.
+func (fs *filesystem) Release(ctx context.Context) {
+	fs.Filesystem.VFSFilesystem().VirtualFilesystem().PutAnonBlockDevMinor(fs.devMinor)
+	fs.Filesystem.Release(ctx)
+}
+
+// MountOptions implements vfs.FilesystemImpl.MountOptions.
+func (fs *filesystem) MountOptions() string {
+	return ""
+}
+
+// rootInode is the root directory, which contains the register and status
+// files, and a file for each registered entry.
+//
+// +stateify savable
+type rootInode struct {
+	kernfs.StaticDirectory
+
+	fs *filesystem
+}
+
+// Lookup implements kernfs.Inode.Lookup.
+func (i *rootInode) Lookup(ctx context.Context, name string) (kernfs.Inode, error) {
+	if inode, err := i.StaticDirectory.Lookup(ctx, name); err == nil {
+		return inode, nil
+	}
+	e := i.fs.registry.Lookup(name)
+	if e == nil {
+		return nil, linuxerr.ENOENT
+	}
+	return i.fs.newEntryFile(ctx, e), nil
+}
+
+// IterDirents implements kernfs.Inode.IterDirents.
+func (i *rootInode) IterDirents(ctx context.Context, mnt *vfs.Mount, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+	names := i.fs.registry.Names()
+	if relOffset >= int64(len(names)) {
+		return offset, nil
+	}
+	for _, name := range names[relOffset:] {
+		dirent := vfs.Dirent{
+			Name:    name,
+			Type:    linux.DT_REG,
+			Ino:     i.fs.NextIno(),
+			NextOff: offset + 1,
+		}
+		if err := cb.Handle(dirent); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
+
+// parseCommand parses a command written to the status or entry files: "0"
+// to disable, "1" to enable, or "-1" to remove.
+func parseCommand(ctx context.Context, src usermem.IOSequence) (string, int64, error) {
+	n := src.NumBytes()
+	if n > maxCommandLength {
+		return "", 0, linuxerr.EINVAL
+	}
+	buf := make([]byte, n)
+	if _, err := src.CopyIn(ctx, buf); err != nil {
+		return "", 0, err
+	}
+	switch cmd := strings.TrimSuffix(string(buf), "\n"); cmd {
+	case "0", "1", "-1":
+		return cmd, n, nil
+	default:
+		return "", 0, linuxerr.EINVAL
+	}
+}
+
+// statusFile implements vfs.WritableDynamicBytesSource for the status file,
+// which enables or disables binfmt_misc as a whole.
+//
+// +stateify savable
+type statusFile struct {
+	kernfs.DynamicBytesFile
+
+	fs *filesystem
+}
+
+var _ vfs.WritableDynamicBytesSource = (*statusFile)(nil)
+
+func (fs *filesystem) newStatusFile(ctx context.Context, creds *auth.Credentials) kernfs.Inode {
+	f := &statusFile{fs: fs}
+	f.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), f, 0644)
+	return f
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (f *statusFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if f.fs.registry.Enabled() {
+		buf.WriteString("enabled\n")
+	} else {
+		buf.WriteString("disabled\n")
+	}
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (f *statusFile) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	cmd, n, err := parseCommand(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	switch cmd {
+	case "0":
+		f.fs.registry.SetEnabled(false)
+	case "1":
+		f.fs.registry.SetEnabled(true)
+	case "-1":
+		f.fs.registry.RemoveAll(ctx)
+	}
+	return n, nil
+}
+
+// registerFile implements vfs.WritableDynamicBytesSource for the register
+// file, which adds entries.
+//
+// +stateify savable
+type registerFile struct {
+	kernfs.DynamicBytesFile
+
+	fs *filesystem
+}
+
+var _ vfs.WritableDynamicBytesSource = (*registerFile)(nil)
+
+func (fs *filesystem) newRegisterFile(ctx context.Context, creds *auth.Credentials) kernfs.Inode {
+	f := &registerFile{fs: fs}
+	f.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), f, 0200)
+	return f
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (f *registerFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	return linuxerr.EINVAL
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (f *registerFile) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	// Each write must contain a whole registration.
+	if offset != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	n := src.NumBytes()
+	buf := make([]byte, n)
+	if _, err := src.CopyIn(ctx, buf); err != nil {
+		return 0, err
+	}
+	e, err := loader.ParseBinfmtMiscEntry(string(buf))
+	if err != nil {
+		return 0, err
+	}
+	if e.Flags&loader.BinfmtMiscFixBinary != 0 {
+		fd, err := openInterpreter(ctx, e.Interpreter)
+		if err != nil {
+			return 0, err
+		}
+		e.SetInterpreterFile(fd)
+	}
+	if err := f.fs.registry.Register(e); err != nil {
+		e.Release(ctx)
+		return 0, err
+	}
+	return n, nil
+}
+
+// openInterpreter opens the interpreter of an entry with the
+// loader.BinfmtMiscFixBinary flag, as the executing task would when running a
+// binary. This is Linux's fs/exec.c:open_exec().
+func openInterpreter(ctx context.Context, path string) (*vfs.FileDescription, error) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return nil, linuxerr.EINVAL
+	}
+	root := t.FSContext().RootDirectory()
+	defer root.DecRef(ctx)
+	wd := t.FSContext().WorkingDirectory()
+	defer wd.DecRef(ctx)
+	pop := &vfs.PathOperation{
+		Root:               root,
+		Start:              wd,
+		Path:               fspath.Parse(path),
+		FollowFinalSymlink: true,
+	}
+	fd, err := t.Kernel().VFS().OpenAt(ctx, t.Credentials(), pop, &vfs.OpenOptions{
+		Flags:    linux.O_RDONLY,
+		FileExec: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat(ctx, vfs.StatOptions{Mask: linux.STATX_TYPE})
+	if err != nil {
+		fd.DecRef(ctx)
+		return nil, err
+	}
+	if linux.FileMode(stat.Mode).FileType() != linux.ModeRegular {
+		fd.DecRef(ctx)
+		return nil, linuxerr.EACCES
+	}
+	return fd, nil
+}
+
+// entryFile implements vfs.WritableDynamicBytesSource for the file of a
+// registered entry, which shows the entry and enables, disables or removes
+// it.
+//
+// +stateify savable
+type entryFile struct {
+	kernfs.DynamicBytesFile
+
+	fs    *filesystem
+	entry *loader.BinfmtMiscEntry
+}
+
+var _ vfs.WritableDynamicBytesSource = (*entryFile)(nil)
+
+func (fs *filesystem) newEntryFile(ctx context.Context, e *loader.BinfmtMiscEntry) kernfs.Inode {
+	f := &entryFile{fs: fs, entry: e}
+	f.Init(ctx, auth.CredentialsFromContext(ctx), linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), f, 0644)
+	return f
+}
+
+// Valid implements kernfs.Inode.Valid.
+func (f *entryFile) Valid(ctx context.Context) bool {
+	return f.fs.registry.Registered(f.entry)
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (f *entryFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString(f.fs.registry.EntryStatus(f.entry))
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (f *entryFile) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	cmd, n, err := parseCommand(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	switch cmd {
+	case "0":
+		f.fs.registry.SetEntryEnabled(f.entry, false)
+	case "1":
+		f.fs.registry.SetEntryEnabled(f.entry, true)
+	case "-1":
+		f.fs.registry.Remove(ctx, f.entry)
+	}
+	return n, nil
+}
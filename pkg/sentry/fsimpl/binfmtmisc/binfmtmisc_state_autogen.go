@@ -0,0 +1,183 @@
+// automatically generated by stateify.
+
+package binfmtmisc
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/state"
+)
+
+func (ft *FilesystemType) StateTypeName() string {
+	return "pkg/sentry/fsimpl/binfmtmisc.FilesystemType"
+}
+
+func (ft *FilesystemType) StateFields() []string {
+	return []string{}
+}
+
+func (ft *FilesystemType) beforeSave() {}
+
+// +checklocksignore
+func (ft *FilesystemType) StateSave(stateSinkObject state.Sink) {
+	ft.beforeSave()
+}
+
+func (ft *FilesystemType) afterLoad() {}
+
+// +checklocksignore
+func (ft *FilesystemType) StateLoad(stateSourceObject state.Source) {
+}
+
+func (fs *filesystem) StateTypeName() string {
+	return "pkg/sentry/fsimpl/binfmtmisc.filesystem"
+}
+
+func (fs *filesystem) StateFields() []string {
+	return []string{
+		"Filesystem",
+		"devMinor",
+		"registry",
+	}
+}
+
+func (fs *filesystem) beforeSave() {}
+
+// +checklocksignore
+func (fs *filesystem) StateSave(stateSinkObject state.Sink) {
+	fs.beforeSave()
+	stateSinkObject.Save(0, &fs.Filesystem)
+	stateSinkObject.Save(1, &fs.devMinor)
+	stateSinkObject.Save(2, &fs.registry)
+}
+
+func (fs *filesystem) afterLoad() {}
+
+// +checklocksignore
+func (fs *filesystem) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &fs.Filesystem)
+	stateSourceObject.Load(1, &fs.devMinor)
+	stateSourceObject.Load(2, &fs.registry)
+}
+
+func (r *rootInode) StateTypeName() string {
+	return "pkg/sentry/fsimpl/binfmtmisc.rootInode"
+}
+
+func (r *rootInode) StateFields() []string {
+	return []string{
+		"StaticDirectory",
+		"fs",
+	}
+}
+
+func (r *rootInode) beforeSave() {}
+
+// +checklocksignore
+func (r *rootInode) StateSave(stateSinkObject state.Sink) {
+	r.beforeSave()
+	stateSinkObject.Save(0, &r.StaticDirectory)
+	stateSinkObject.Save(1, &r.fs)
+}
+
+func (r *rootInode) afterLoad() {}
+
+// +checklocksignore
+func (r *rootInode) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &r.StaticDirectory)
+	stateSourceObject.Load(1, &r.fs)
+}
+
+func (s *statusFile) StateTypeName() string {
+	return "pkg/sentry/fsimpl/binfmtmisc.statusFile"
+}
+
+func (s *statusFile) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"fs",
+	}
+}
+
+func (s *statusFile) beforeSave() {}
+
+// +checklocksignore
+func (s *statusFile) StateSave(stateSinkObject state.Sink) {
+	s.beforeSave()
+	stateSinkObject.Save(0, &s.DynamicBytesFile)
+	stateSinkObject.Save(1, &s.fs)
+}
+
+func (s *statusFile) afterLoad() {}
+
+// +checklocksignore
+func (s *statusFile) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &s.DynamicBytesFile)
+	stateSourceObject.Load(1, &s.fs)
+}
+
+func (r *registerFile) StateTypeName() string {
+	return "pkg/sentry/fsimpl/binfmtmisc.registerFile"
+}
+
+func (r *registerFile) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"fs",
+	}
+}
+
+func (r *registerFile) beforeSave() {}
+
+// +checklocksignore
+func (r *registerFile) StateSave(stateSinkObject state.Sink) {
+	r.beforeSave()
+	stateSinkObject.Save(0, &r.DynamicBytesFile)
+	stateSinkObject.Save(1, &r.fs)
+}
+
+func (r *registerFile) afterLoad() {}
+
+// +checklocksignore
+func (r *registerFile) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &r.DynamicBytesFile)
+	stateSourceObject.Load(1, &r.fs)
+}
+
+func (e *entryFile) StateTypeName() string {
+	return "pkg/sentry/fsimpl/binfmtmisc.entryFile"
+}
+
+func (e *entryFile) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"fs",
+		"entry",
+	}
+}
+
+func (e *entryFile) beforeSave() {}
+
+// +checklocksignore
+func (e *entryFile) StateSave(stateSinkObject state.Sink) {
+	e.beforeSave()
+	stateSinkObject.Save(0, &e.DynamicBytesFile)
+	stateSinkObject.Save(1, &e.fs)
+	stateSinkObject.Save(2, &e.entry)
+}
+
+func (e *entryFile) afterLoad() {}
+
+// +checklocksignore
+func (e *entryFile) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &e.DynamicBytesFile)
+	stateSourceObject.Load(1, &e.fs)
+	stateSourceObject.Load(2, &e.entry)
+}
+
+func init() {
+	state.Register((*FilesystemType)(nil))
+	state.Register((*filesystem)(nil))
+	state.Register((*rootInode)(nil))
+	state.Register((*statusFile)(nil))
+	state.Register((*registerFile)(nil))
+	state.Register((*entryFile)(nil))
+}
@@ -29,6 +29,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/kernfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/sched"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
 )
@@ -395,6 +396,15 @@ func (c *cgroupInode) ID() uint32 {
 	return c.id
 }
 
+// CPUSet implements kernel.CgroupImpl.CPUSet.
+func (c *cgroupInode) CPUSet() sched.CPUSet {
+	ctl, ok := c.controllers[kernel.CgroupControllerCPUSet]
+	if !ok {
+		return nil
+	}
+	return ctl.(*cpusetController).cpuSet()
+}
+
 func sortTIDs(tids []kernel.ThreadID) {
 	sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
 }
@@ -307,11 +307,17 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	if vfsfs != nil {
 		fs := vfsfs.Impl().(*filesystem)
 		ctx.Debugf("cgroupfs.FilesystemType.GetFilesystem: mounting new view to hierarchy %v", fs.hierarchyID)
-		fs.root.IncRef()
+		// As in Linux's kernel/cgroup/cgroup.c:cgroup_do_get_tree(), mounts
+		// made in a cgroup namespace are rooted at the root of the namespace.
+		root := fs.root
+		if cg, ok := kernel.CgroupNamespaceRoot(ctx, fs.hierarchyID); ok {
+			root = cg.Dentry
+		}
+		root.IncRef()
 		if fs.effectiveRoot != fs.root {
 			fs.effectiveRoot.IncRef()
 		}
-		return vfsfs, fs.root.VFSDentry(), nil
+		return vfsfs, root.VFSDentry(), nil
 	}
 
 	// No existing hierarchy with the exactly controllers found. Make a new
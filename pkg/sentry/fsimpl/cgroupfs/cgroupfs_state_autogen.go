@@ -436,7 +436,9 @@ func (c *cpuController) StateFields() []string {
 		"controllerNoResource",
 		"cfsPeriod",
 		"cfsQuota",
+		"cfsBurst",
 		"shares",
+		"idle",
 	}
 }
 
@@ -450,7 +452,9 @@ func (c *cpuController) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(2, &c.controllerNoResource)
 	stateSinkObject.Save(3, &c.cfsPeriod)
 	stateSinkObject.Save(4, &c.cfsQuota)
-	stateSinkObject.Save(5, &c.shares)
+	stateSinkObject.Save(5, &c.cfsBurst)
+	stateSinkObject.Save(6, &c.shares)
+	stateSinkObject.Save(7, &c.idle)
 }
 
 func (c *cpuController) afterLoad() {}
@@ -462,7 +466,9 @@ func (c *cpuController) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(2, &c.controllerNoResource)
 	stateSourceObject.Load(3, &c.cfsPeriod)
 	stateSourceObject.Load(4, &c.cfsQuota)
-	stateSourceObject.Load(5, &c.shares)
+	stateSourceObject.Load(5, &c.cfsBurst)
+	stateSourceObject.Load(6, &c.shares)
+	stateSourceObject.Load(7, &c.idle)
 }
 
 func (c *cpuacctController) StateTypeName() string {
@@ -674,6 +680,7 @@ func (d *cpusData) StateTypeName() string {
 func (d *cpusData) StateFields() []string {
 	return []string{
 		"c",
+		"cg",
 	}
 }
 
@@ -683,6 +690,7 @@ func (d *cpusData) beforeSave() {}
 func (d *cpusData) StateSave(stateSinkObject state.Sink) {
 	d.beforeSave()
 	stateSinkObject.Save(0, &d.c)
+	stateSinkObject.Save(1, &d.cg)
 }
 
 func (d *cpusData) afterLoad() {}
@@ -690,6 +698,7 @@ func (d *cpusData) afterLoad() {}
 // +checklocksignore
 func (d *cpusData) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &d.c)
+	stateSourceObject.Load(1, &d.cg)
 }
 
 func (d *memsData) StateTypeName() string {
@@ -28,12 +28,19 @@ type cpuController struct {
 	controllerStateless
 	controllerNoResource
 
-	// CFS bandwidth control parameters, values in microseconds.
+	// CFS bandwidth control parameters, values in microseconds. cfsBurst is
+	// the runtime that can be accumulated from unused quota, see
+	// Documentation/scheduler/sched-bwc.rst.
 	cfsPeriod atomicbitops.Int64
 	cfsQuota  atomicbitops.Int64
+	cfsBurst  atomicbitops.Int64
 
 	// CPU shares, values should be (num core * 1024).
 	shares atomicbitops.Int64
+
+	// idle is 1 if the cgroup's tasks are scheduled like SCHED_IDLE tasks
+	// relative to other cgroups, and 0 otherwise.
+	idle atomicbitops.Int64
 }
 
 var _ controller = (*cpuController)(nil)
@@ -54,10 +61,18 @@ func newCPUController(fs *filesystem, defaults map[string]int64) *cpuController
 		c.cfsQuota = atomicbitops.FromInt64(val)
 		delete(defaults, "cpu.cfs_quota_us")
 	}
+	if val, ok := defaults["cpu.cfs_burst_us"]; ok {
+		c.cfsBurst = atomicbitops.FromInt64(val)
+		delete(defaults, "cpu.cfs_burst_us")
+	}
 	if val, ok := defaults["cpu.shares"]; ok {
 		c.shares = atomicbitops.FromInt64(val)
 		delete(defaults, "cpu.shares")
 	}
+	if val, ok := defaults["cpu.idle"]; ok {
+		c.idle = atomicbitops.FromInt64(val)
+		delete(defaults, "cpu.idle")
+	}
 
 	c.controllerCommon.init(kernel.CgroupControllerCPU, fs)
 	return c
@@ -68,7 +83,9 @@ func (c *cpuController) Clone() controller {
 	new := &cpuController{
 		cfsPeriod: atomicbitops.FromInt64(c.cfsPeriod.Load()),
 		cfsQuota:  atomicbitops.FromInt64(c.cfsQuota.Load()),
+		cfsBurst:  atomicbitops.FromInt64(c.cfsBurst.Load()),
 		shares:    atomicbitops.FromInt64(c.shares.Load()),
+		idle:      atomicbitops.FromInt64(c.idle.Load()),
 	}
 	new.controllerCommon.cloneFromParent(c)
 	return new
@@ -78,5 +95,7 @@ func (c *cpuController) Clone() controller {
 func (c *cpuController) AddControlFiles(ctx context.Context, creds *auth.Credentials, _ *cgroupInode, contents map[string]kernfs.Inode) {
 	contents["cpu.cfs_period_us"] = c.fs.newStubControllerFile(ctx, creds, &c.cfsPeriod, true)
 	contents["cpu.cfs_quota_us"] = c.fs.newStubControllerFile(ctx, creds, &c.cfsQuota, true)
+	contents["cpu.cfs_burst_us"] = c.fs.newStubControllerFile(ctx, creds, &c.cfsBurst, true)
 	contents["cpu.shares"] = c.fs.newStubControllerFile(ctx, creds, &c.shares, true)
+	contents["cpu.idle"] = c.fs.newStubControllerFile(ctx, creds, &c.idle, true)
 }
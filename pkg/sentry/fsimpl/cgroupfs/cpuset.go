@@ -26,6 +26,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/kernfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/sched"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
@@ -81,14 +82,36 @@ func (c *cpusetController) Clone() controller {
 }
 
 // AddControlFiles implements controller.AddControlFiles.
-func (c *cpusetController) AddControlFiles(ctx context.Context, creds *auth.Credentials, _ *cgroupInode, contents map[string]kernfs.Inode) {
-	contents["cpuset.cpus"] = c.fs.newControllerWritableFile(ctx, creds, &cpusData{c: c}, true)
+func (c *cpusetController) AddControlFiles(ctx context.Context, creds *auth.Credentials, cg *cgroupInode, contents map[string]kernfs.Inode) {
+	contents["cpuset.cpus"] = c.fs.newControllerWritableFile(ctx, creds, &cpusData{c: c, cg: cg}, true)
 	contents["cpuset.mems"] = c.fs.newControllerWritableFile(ctx, creds, &memsData{c: c}, true)
 }
 
+// cpuSet returns the CPUs allowed by c as a sched.CPUSet.
+func (c *cpusetController) cpuSet() sched.CPUSet {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return cpuSetFromBitmap(c.cpus, c.maxCpus)
+}
+
+// cpuSetFromBitmap returns a sched.CPUSet for maxCpus CPUs with the CPUs set
+// in b.
+func cpuSetFromBitmap(b *bitmap.Bitmap, maxCpus uint32) sched.CPUSet {
+	cpus := sched.NewCPUSet(uint(maxCpus))
+	b.ForEach(0, maxCpus, func(i uint32) bool {
+		cpus.Set(uint(i))
+		return true
+	})
+	return cpus
+}
+
 // +stateify savable
 type cpusData struct {
 	c *cpusetController
+
+	// cg is the cgroup whose tasks the CPUs apply to. cg is nil if the file
+	// was restored from a statefile that predates it.
+	cg *cgroupInode
 }
 
 // Generate implements vfs.DynamicBytesSource.Generate.
@@ -128,9 +151,25 @@ func (d *cpusData) WriteBackground(ctx context.Context, src usermem.IOSequence)
 		return 0, linuxerr.EINVAL
 	}
 
+	var tasks []*kernel.Task
+	if d.cg != nil {
+		tasks = d.cg.tasks()
+	}
+	if b.IsEmpty() && len(tasks) != 0 {
+		// See kernel/cgroup/cpuset.c:validate_change.
+		return 0, linuxerr.ENOSPC
+	}
+
 	d.c.mu.Lock()
-	defer d.c.mu.Unlock()
 	d.c.cpus = b
+	cpus := cpuSetFromBitmap(b, d.c.maxCpus)
+	d.c.mu.Unlock()
+
+	// Like kernel/cgroup/cpuset.c:update_cpumask, reset the CPU mask of the
+	// tasks in the cgroup to the new CPUs.
+	for _, t := range tasks {
+		t.SetCPUSet(cpus.Copy())
+	}
 	return int64(n), nil
 }
 
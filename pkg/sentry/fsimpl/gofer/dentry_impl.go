@@ -20,6 +20,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/fsutil"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/faultinject"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"golang.org/x/sys/unix"
@@ -251,6 +252,9 @@ func (d *dentry) getRemoteChild(ctx context.Context, name string) (*dentry, erro
 func (d *dentry) getRemoteChildAndWalkPathLocked(ctx context.Context, rp resolvingPath, ds **[]*dentry) (*dentry, error) {
 	switch dt := d.impl.(type) {
 	case *lisafsDentry:
+		if err := d.checkChildFault(ctx, faultinject.GoferWalk, rp.Component()); err != nil {
+			return nil, err
+		}
 		return dt.getRemoteChildAndWalkPathLocked(ctx, rp, ds)
 	case *directfsDentry:
 		// We need to check for races because opMu is read locked which allows
@@ -365,6 +369,9 @@ func (d *dentry) symlink(ctx context.Context, name, target string, creds *auth.C
 
 // Precondition: !d.isSynthetic().
 func (d *dentry) openCreate(ctx context.Context, name string, accessFlags uint32, mode linux.FileMode, uid auth.KUID, gid auth.KGID) (*dentry, handle, error) {
+	if err := d.checkChildFault(ctx, faultinject.GoferOpen, name); err != nil {
+		return nil, noHandle, err
+	}
 	switch dt := d.impl.(type) {
 	case *lisafsDentry:
 		return dt.openCreate(ctx, name, accessFlags, mode, uid, gid)
@@ -651,10 +651,7 @@ func (d *directfsDentry) restoreFile(ctx context.Context, controlFD int, opts *v
 	//		checking inoKey.
 	//
 	//	- We need to associate the new inoKey with the existing d.ino.
-	d.inoKey = inoKeyFromStat(&stat)
-	d.fs.inoMu.Lock()
-	d.fs.inoByKey[d.inoKey] = d.ino
-	d.fs.inoMu.Unlock()
+	d.fs.restoreInoKey(&d.dentry, inoKeyFromStat(&stat))
 
 	// Check metadata stability before updating metadata.
 	d.metadataMu.Lock()
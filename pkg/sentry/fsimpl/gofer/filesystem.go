@@ -25,6 +25,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/faultinject"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/host"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsmetric"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
@@ -256,6 +257,10 @@ func (fs *filesystem) getChildLocked(ctx context.Context, parent *dentry, name s
 //
 // +checklocksread:parent.opMu
 func (fs *filesystem) getRemoteChildLocked(ctx context.Context, parent *dentry, name string, checkForRace bool, ds **[]*dentry) (*dentry, error) {
+	// Injected faults must not be cached as negative dentries.
+	if err := parent.checkChildFault(ctx, faultinject.GoferWalk, name); err != nil {
+		return nil, err
+	}
 	child, err := parent.getRemoteChild(ctx, name)
 	// Cache the result appropriately in the dentry tree.
 	if err != nil {
@@ -1043,6 +1048,11 @@ func (d *dentry) open(ctx context.Context, rp *vfs.ResolvingPath, opts *vfs.Open
 	}
 
 	if !d.isSynthetic() {
+		// Injected faults apply to every open, whether or not it opens a new
+		// handle, and with or without directfs.
+		if err := d.checkFault(ctx, faultinject.GoferOpen); err != nil {
+			return nil, err
+		}
 		// renameMu is locked here because it is required by d.openHandle(), which
 		// is called by d.ensureSharedHandle() and d.openSpecialFile() below. It is
 		// also required by d.connect() which is called by
@@ -30,6 +30,7 @@
 //	            *** "memmap.Mappable locks taken by Translate" below this point
 //	            dentry.handleMu
 //	              dentry.dataMu
+//	                filesystem.flusherMu
 //	          filesystem.inoMu
 //	specialFileFD.mu
 //	  specialFileFD.bufMu
@@ -41,6 +42,7 @@ package gofer
 
 import (
 	"fmt"
+	"math"
 	"path"
 	"strconv"
 	"strings"
@@ -54,6 +56,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/lisafs"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/refs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/faultinject"
 	fslock "github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/lock"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsutil"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
@@ -62,6 +65,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/memmap"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/pgalloc"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix/transport"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/usage"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"github.com/talismancer/gvisor-ligolo/pkg/unet"
@@ -85,6 +89,12 @@ const (
 	moptOverlayfsStaleRead       = "overlayfs_stale_read"
 	moptDisableFileHandleSharing = "disable_file_handle_sharing"
 	moptDisableFifoOpen          = "disable_fifo_open"
+	moptReadahead                = "readahead"
+	moptWriteback                = "writeback"
+	moptIno                      = "ino"
+	moptDev                      = "dev"
+	moptTruncateEIO              = "truncate_eio"
+	moptWatch                    = "watch"
 
 	// Directfs options.
 	moptDirectfs = "directfs"
@@ -97,6 +107,50 @@ const (
 	cacheRemoteRevalidating  = "remote_revalidating"
 )
 
+// InoMode controls how inode numbers are assigned to files, as set by the
+// "ino" mount option.
+//
+// +stateify savable
+type InoMode uint8
+
+// Valid values for the "ino" mount option.
+const (
+	// InoModeVirtual assigns inode numbers to files in the order they're
+	// first seen. Numbers are stable for the lifetime of the sandbox,
+	// including across gofer reconnects, but files that aren't open or cached
+	// when the sandbox is saved get new numbers after restore.
+	InoModeVirtual InoMode = iota
+
+	// InoModePersist is InoModeVirtual, except that the numbers of all files
+	// seen before save are stored in the statefile and kept after restore.
+	// This is only correct if the restored filesystem is backed by the same
+	// host files, with the same device and inode numbers.
+	InoModePersist
+
+	// InoModeHost uses the host inode numbers of files that are on the same
+	// host device as the mount's root, and InoModeVirtual numbers from the top
+	// half of the inode number space for other files.
+	InoModeHost
+)
+
+// String implements fmt.Stringer.
+func (m InoMode) String() string {
+	switch m {
+	case InoModeVirtual:
+		return "virtual"
+	case InoModePersist:
+		return "persist"
+	case InoModeHost:
+		return "host"
+	default:
+		return fmt.Sprintf("unknown (%d)", uint8(m))
+	}
+}
+
+// firstHostModeVirtualIno is the first inode number assigned to files that
+// don't use their host inode number in InoModeHost.
+const firstHostModeVirtualIno = 1 << 63
+
 const (
 	defaultMaxCachedDentries  = 1000
 	maxCachedNegativeChildren = 1000
@@ -188,7 +242,8 @@ type filesystem struct {
 	iopts InternalFilesystemOptions
 
 	// client is the LISAFS client used for communicating with the server. client
-	// is immutable.
+	// is only replaced by filesystem.Reconnect, with renameMu locked for
+	// writing.
 	client *lisafs.Client `state:"nosave"`
 
 	// clock is a realtime clock used to set timestamps in file operations.
@@ -221,22 +276,63 @@ type filesystem struct {
 	specialFileFDs   specialFDList
 
 	// inoByKey maps previously-observed device ID and host inode numbers to
-	// internal inode numbers assigned to those files. inoByKey is not preserved
-	// across checkpoint/restore because inode numbers may be reused between
-	// different gofer processes, so inode numbers may be repeated for different
-	// files across checkpoint/restore. inoByKey is protected by inoMu.
+	// internal inode numbers assigned to those files. Unless opts.ino is
+	// InoModePersist, inoByKey is not preserved across checkpoint/restore
+	// because inode numbers may be reused between different gofer processes,
+	// so inode numbers may be repeated for different files across
+	// checkpoint/restore. inoByKey is protected by inoMu.
 	inoMu    sync.Mutex        `state:"nosave"`
 	inoByKey map[inoKey]uint64 `state:"nosave"`
 
+	// If opts.ino is InoModeHost, hostDev is the host device of the root once
+	// it has been seen, with ino 0. hostDev is protected by inoMu.
+	hostDev    inoKey `state:"nosave"`
+	hostDevSet bool   `state:"nosave"`
+
 	// lastIno is the last inode number assigned to a file. lastIno is accessed
 	// using atomic memory operations.
 	lastIno atomicbitops.Uint64
 
+	// savedInoByKey records inoByKey during save/restore if opts.ino is
+	// InoModePersist.
+	savedInoByKey map[inoKey]uint64
+
 	// savedDentryRW records open read/write handles during save/restore.
 	savedDentryRW map[*dentry]savedDentryRW
 
 	// released is nonzero once filesystem.Release has been called.
 	released atomicbitops.Int32
+
+	// flusherMu protects flusherStop and flusherKick.
+	flusherMu sync.Mutex `state:"nosave"`
+
+	// flusherStop is closed to stop the flusher goroutine, which writes back
+	// dirty cached pages. It's nil if the flusher isn't running. The flusher
+	// is started by the first write to a client-cached file.
+	flusherStop chan struct{} `state:"nosave"`
+
+	// flusherKick wakes the flusher up before its next tick.
+	flusherKick chan struct{} `state:"nosave"`
+
+	// flusherStarted is nonzero once the flusher has been started.
+	flusherStarted atomicbitops.Uint32 `state:"nosave"`
+
+	// flushTick is incremented on every tick of the flusher.
+	flushTick atomicbitops.Uint64 `state:"nosave"`
+
+	// dirtyBytes is the contribution of fs to fsmetric.GoferDirtyBytes.
+	dirtyBytes atomicbitops.Int64 `state:"nosave"`
+
+	// watchMu protects watching and watchFD.
+	watchMu sync.Mutex `state:"nosave"`
+
+	// watching is true if the remote filesystem is being watched for
+	// changes. See watch.go.
+	watching bool `state:"nosave"`
+
+	// If watching is true, watchFD is the host socket on which the gofer
+	// reports changes to the remote filesystem.
+	watchFD int `state:"nosave"`
 }
 
 // +stateify savable
@@ -281,6 +377,33 @@ type filesystemOptions struct {
 	// are disallowed.
 	disableFifoOpen bool
 
+	// readahead is the maximum number of bytes read ahead of accesses to
+	// regular files, or 0 for defaultMaxReadahead.
+	readahead uint64
+
+	// If writeback is not 0, writes that append to client-cached regular
+	// files are buffered in the cache, and written back to the remote file
+	// once writeback bytes are buffered rather than by each write.
+	writeback uint64
+
+	// ino is derived from the "ino" mount option.
+	ino InoMode
+
+	// If dev is not 0, it's the minor device number of the filesystem, rather
+	// than a dynamically allocated one.
+	dev uint32
+
+	// If truncateEIO is true, reads and writes of regular files fail with EIO
+	// after an application access to a host FD mapping of the file faulted
+	// because the host file was truncated outside of the sandbox, until the
+	// application truncates the file itself.
+	truncateEIO bool
+
+	// If watch is true, the remote filesystem is watched for changes made
+	// outside of the sandbox, which invalidate cached metadata and data as if
+	// InteropModeShared were in effect for the changed files. See watch.go.
+	watch bool
+
 	// directfs holds options for directfs mode.
 	directfs directfsOpts
 }
@@ -361,6 +484,11 @@ type InternalFilesystemOptions struct {
 	// filesystem with a new server FD during restoration from checkpoint.
 	UniqueID string
 
+	// Owner identifies the server of the filesystem, e.g. the container whose
+	// gofer serves it. If Owner is non-empty, the filesystem can be reconnected
+	// to the server after it was restarted; see filesystem.Reconnect.
+	Owner string
+
 	// If LeakConnection is true, do not close the connection to the server
 	// when the Filesystem is released. This is necessary for deployments in
 	// which servers can handle only a single client and report failure if that
@@ -460,6 +588,48 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		fsopts.dfltgid = auth.KGID(dfltgid)
 	}
 
+	if readaheadstr, ok := mopts[moptReadahead]; ok {
+		delete(mopts, moptReadahead)
+		readahead, err := strconv.ParseUint(readaheadstr, 10, 64)
+		if err != nil || readahead%hostarch.PageSize != 0 {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid readahead: %s=%s", moptReadahead, readaheadstr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		fsopts.readahead = readahead
+	}
+	if writebackstr, ok := mopts[moptWriteback]; ok {
+		delete(mopts, moptWriteback)
+		writeback, err := strconv.ParseUint(writebackstr, 10, 64)
+		if err != nil {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid writeback: %s=%s", moptWriteback, writebackstr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		fsopts.writeback = writeback
+	}
+	if inostr, ok := mopts[moptIno]; ok {
+		delete(mopts, moptIno)
+		switch inostr {
+		case InoModeVirtual.String():
+			fsopts.ino = InoModeVirtual
+		case InoModePersist.String():
+			fsopts.ino = InoModePersist
+		case InoModeHost.String():
+			fsopts.ino = InoModeHost
+		default:
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid inode number mode: %s=%s", moptIno, inostr)
+			return nil, nil, linuxerr.EINVAL
+		}
+	}
+	if devstr, ok := mopts[moptDev]; ok {
+		delete(mopts, moptDev)
+		dev, err := strconv.ParseUint(devstr, 10, 32)
+		if err != nil || dev == 0 {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: invalid device minor number: %s=%s", moptDev, devstr)
+			return nil, nil, linuxerr.EINVAL
+		}
+		fsopts.dev = uint32(dev)
+	}
+
 	// Handle simple flags.
 	if _, ok := mopts[moptDisableFileHandleSharing]; ok {
 		delete(mopts, moptDisableFileHandleSharing)
@@ -481,6 +651,18 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		delete(mopts, moptOverlayfsStaleRead)
 		fsopts.overlayfsStaleRead = true
 	}
+	if _, ok := mopts[moptTruncateEIO]; ok {
+		delete(mopts, moptTruncateEIO)
+		fsopts.truncateEIO = true
+	}
+	if _, ok := mopts[moptWatch]; ok {
+		delete(mopts, moptWatch)
+		if fsopts.interop == InteropModeShared {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: %s is redundant with %s=%s", moptWatch, moptCache, cacheRemoteRevalidating)
+		} else {
+			fsopts.watch = true
+		}
+	}
 	if _, ok := mopts[moptDirectfs]; ok {
 		delete(mopts, moptDirectfs)
 		fsopts.directfs.enabled = true
@@ -513,9 +695,17 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	// If !ok, iopts being the zero value is correct.
 
 	// Construct the filesystem object.
-	devMinor, err := vfsObj.GetAnonBlockDevMinor()
-	if err != nil {
-		return nil, nil, err
+	devMinor := fsopts.dev
+	if devMinor != 0 {
+		if err := vfsObj.GetSpecificAnonBlockDevMinor(devMinor); err != nil {
+			ctx.Warningf("gofer.FilesystemType.GetFilesystem: device minor number %d unavailable: %v", devMinor, err)
+			return nil, nil, err
+		}
+	} else {
+		var err error
+		if devMinor, err = vfsObj.GetAnonBlockDevMinor(); err != nil {
+			return nil, nil, err
+		}
 	}
 	fs := &filesystem{
 		mfp:      mfp,
@@ -525,6 +715,9 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		devMinor: devMinor,
 		inoByKey: make(map[inoKey]uint64),
 	}
+	if fsopts.ino == InoModeHost {
+		fs.lastIno.Store(firstHostModeVirtualIno - 1)
+	}
 
 	// Did the user configure a global dentry cache?
 	if globalDentryCache != nil {
@@ -553,6 +746,7 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 	// caller, and the other is held by fs to prevent the root from being "cached"
 	// and subsequently evicted.
 	fs.root.refs = atomicbitops.FromInt64(2)
+	fs.startWatcher(ctx)
 	return &fs.vfsfs, &fs.root.vfsd, nil
 }
 
@@ -655,6 +849,8 @@ func getFDFromMountOptionsMap(ctx context.Context, mopts map[string]string) (int
 // Release implements vfs.FilesystemImpl.Release.
 func (fs *filesystem) Release(ctx context.Context) {
 	fs.released.Store(1)
+	fs.stopFlusher()
+	fs.stopWatcher()
 
 	mf := fs.mfp.MemoryFile()
 	fs.syncMu.Lock()
@@ -938,6 +1134,11 @@ type dentry struct {
 	writeFD  atomicbitops.Int32 `state:"nosave"`
 	mmapFD   atomicbitops.Int32 `state:"nosave"`
 
+	// If filesystemOptions.truncateEIO is true, truncated is true if an
+	// application access to a host FD mapping of this file faulted because
+	// the host file was truncated outside of the sandbox.
+	truncated atomicbitops.Bool `state:"nosave"`
+
 	dataMu sync.RWMutex `state:"nosave"`
 
 	// If this dentry represents a regular file that is client-cached, cache
@@ -950,6 +1151,20 @@ type dentry struct {
 	// tracks dirty segments in cache. dirty is protected by dataMu.
 	dirty fsutil.DirtySet
 
+	// accessPattern is the access pattern advised by the application for the
+	// file's data, one of linux.POSIX_FADV_NORMAL, POSIX_FADV_RANDOM or
+	// POSIX_FADV_SEQUENTIAL. It isn't saved, as it's only a hint.
+	accessPattern atomicbitops.Int32 `state:"nosave"`
+
+	// If filesystemOptions.writeback is not 0, batched is the range of
+	// appending writes buffered in cache since it was last written back.
+	// batched is protected by dataMu.
+	batched memmap.MappableRange `state:"nosave"`
+
+	// dirtiedTick is the filesystem.flushTick at which dirty became non-empty,
+	// plus 1, or 0 if dirty is empty. dirtiedTick is protected by dataMu.
+	dirtiedTick uint64 `state:"nosave"`
+
 	// pf implements platform.File for mappings of hostFD.
 	pf dentryPlatformFile
 
@@ -1006,6 +1221,9 @@ func (fs *filesystem) inoFromKey(key inoKey) uint64 {
 	fs.inoMu.Lock()
 	defer fs.inoMu.Unlock()
 
+	if ino, ok := fs.hostInoLocked(key); ok {
+		return ino
+	}
 	if ino, ok := fs.inoByKey[key]; ok {
 		return ino
 	}
@@ -1018,6 +1236,44 @@ func (fs *filesystem) nextIno() uint64 {
 	return fs.lastIno.Add(1)
 }
 
+// hostInoLocked returns the host inode number of key if fs uses it as the
+// inode number of the file. The root must be the first file passed to
+// hostInoLocked.
+//
+// Preconditions: fs.inoMu must be locked.
+func (fs *filesystem) hostInoLocked(key inoKey) (uint64, bool) {
+	if fs.opts.ino != InoModeHost {
+		return 0, false
+	}
+	dev := inoKey{devMinor: key.devMinor, devMajor: key.devMajor}
+	if !fs.hostDevSet {
+		fs.hostDev = dev
+		fs.hostDevSet = true
+	}
+	if dev != fs.hostDev || key.ino >= firstHostModeVirtualIno {
+		return 0, false
+	}
+	return key.ino, true
+}
+
+// restoreInoKey sets the inoKey of d, which is being restored, to key, and
+// associates it with d's existing inode number.
+func (fs *filesystem) restoreInoKey(d *dentry, key inoKey) {
+	fs.inoMu.Lock()
+	defer fs.inoMu.Unlock()
+	if _, ok := fs.hostInoLocked(key); ok {
+		d.inoKey = key
+		return
+	}
+	if fs.opts.ino == InoModePersist && d.inoKey != key && fs.inoByKey[d.inoKey] == d.ino {
+		// The host file changed, so its previous key may now identify
+		// another file.
+		delete(fs.inoByKey, d.inoKey)
+	}
+	d.inoKey = key
+	fs.inoByKey[key] = d.ino
+}
+
 // init must be called before first use of d.
 func (d *dentry) init(impl any) {
 	d.pf.dentry = d
@@ -1038,6 +1294,23 @@ func (d *dentry) isSynthetic() bool {
 	return d.impl == nil
 }
 
+// checkFault evaluates fault injection rules for an operation on d.
+func (d *dentry) checkFault(ctx context.Context, point faultinject.Point) error {
+	if !faultinject.Enabled() {
+		return nil
+	}
+	return faultinject.Check(ctx, point, genericDebugPathname(d))
+}
+
+// checkChildFault evaluates fault injection rules for an operation on the
+// child of d with the given name.
+func (d *dentry) checkChildFault(ctx context.Context, point faultinject.Point, name string) error {
+	if !faultinject.Enabled() {
+		return nil
+	}
+	return faultinject.Check(ctx, point, path.Join(genericDebugPathname(d), name))
+}
+
 func (d *dentry) cachedMetadataAuthoritative() bool {
 	return d.fs.opts.interop != InteropModeShared || d.isSynthetic()
 }
@@ -1082,7 +1355,7 @@ func (d *lisafsDentry) updateMetadataFromStatxLocked(stat *linux.Statx) {
 		d.nlink.Store(stat.Nlink)
 	}
 	if stat.Mask&linux.STATX_SIZE != 0 {
-		d.updateSizeLocked(stat.Size)
+		d.updateRemoteSizeLocked(stat.Size)
 	}
 }
 
@@ -1108,7 +1381,7 @@ func (d *directfsDentry) updateMetadataFromStatLocked(stat *unix.Stat_t) error {
 	}
 	d.ctime.Store(dentryTimestampFromUnix(stat.Ctim))
 	d.nlink.Store(uint32(stat.Nlink))
-	d.updateSizeLocked(uint64(stat.Size))
+	d.updateRemoteSizeLocked(uint64(stat.Size))
 	return nil
 }
 
@@ -1285,6 +1558,7 @@ func (d *dentry) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs
 					// copy-on-write mappings of truncated pages need to be
 					// invalidated, even if InteropModeShared is in effect.
 					d.updateSizeAndUnlockDataMuLocked(stat.Size) // +checklocksforce: locked conditionally above
+					d.truncated.Store(false)
 				} else {
 					d.dataMu.Unlock() // +checklocksforce: locked conditionally above
 				}
@@ -1330,22 +1604,71 @@ func (d *dentry) setStat(ctx context.Context, creds *auth.Credentials, opts *vfs
 
 // doAllocate performs an allocate operation on d. Note that d.metadataMu will
 // be held when allocate is called.
-func (d *dentry) doAllocate(ctx context.Context, offset, length uint64, allocate func() error) error {
+func (d *dentry) doAllocate(ctx context.Context, mode, offset, length uint64, allocate func() error) error {
 	d.metadataMu.Lock()
 	defer d.metadataMu.Unlock()
 
+	// Compute the new size of the file, and the range of the file whose
+	// contents are changed by allocate.
+	var changed memmap.MappableRange
+	oldSize := d.size.RacyLoad()
+	size := oldSize
+	switch {
+	case mode&linux.FALLOC_FL_COLLAPSE_RANGE != 0:
+		changed = memmap.MappableRange{offset, math.MaxUint64}
+		if offset+length < oldSize {
+			size = oldSize - length
+		}
+	case mode&linux.FALLOC_FL_INSERT_RANGE != 0:
+		changed = memmap.MappableRange{offset, math.MaxUint64}
+		size = oldSize + length
+	case mode&(linux.FALLOC_FL_PUNCH_HOLE|linux.FALLOC_FL_ZERO_RANGE) != 0:
+		changed = memmap.MappableRange{offset, offset + length}
+		fallthrough
+	default:
+		if mode&linux.FALLOC_FL_KEEP_SIZE == 0 && offset+length > oldSize {
+			size = offset + length
+		}
+	}
+
 	// Allocating a smaller size is a noop.
-	size := offset + length
-	if d.cachedMetadataAuthoritative() && size <= d.size.RacyLoad() {
+	if mode == 0 && d.cachedMetadataAuthoritative() && size == oldSize {
 		return nil
 	}
 
-	err := allocate()
-	if err != nil {
+	var pgChanged memmap.MappableRange
+	if changed.Length() != 0 {
+		// Cached pages in the changed range are dropped below, so write them
+		// back first to preserve the bytes outside of the range in the first
+		// and last pages.
+		pgChanged.Start = hostarch.PageRoundDown(changed.Start)
+		pgChanged.End = hostarch.PageRoundDown(uint64(math.MaxUint64))
+		writebackLen := int64(math.MaxInt64)
+		if end, ok := hostarch.PageRoundUp(changed.End); ok && changed.End != math.MaxUint64 {
+			pgChanged.End = end
+			writebackLen = int64(end - pgChanged.Start)
+		}
+		if err := d.writeback(ctx, int64(pgChanged.Start), writebackLen); err != nil {
+			return err
+		}
+	}
+
+	if err := allocate(); err != nil {
 		return err
 	}
-	d.updateSizeLocked(size)
-	if d.cachedMetadataAuthoritative() {
+	if changed.Length() != 0 {
+		d.dropCache(pgChanged)
+	}
+	if !d.cachedMetadataAuthoritative() && changed.Length() != 0 {
+		// The remote file may have been changed concurrently, so d.size
+		// isn't a reliable basis for the new size.
+		if err := d.refreshSizeLocked(ctx); err != nil {
+			return err
+		}
+	} else if size != oldSize {
+		d.updateSizeLocked(size)
+	}
+	if d.cachedMetadataAuthoritative() && (size != oldSize || changed.Length() != 0) {
 		d.touchCMtimeLocked()
 	}
 	return nil
@@ -1357,6 +1680,20 @@ func (d *dentry) updateSizeLocked(newSize uint64) {
 	d.updateSizeAndUnlockDataMuLocked(newSize)
 }
 
+// updateRemoteSizeLocked is like updateSizeLocked, but for a size reported by
+// the remote filesystem. Cached data that hasn't been written back yet isn't
+// accounted for by the remote size, so it isn't dropped.
+//
+// Preconditions: d.metadataMu must be locked.
+func (d *dentry) updateRemoteSizeLocked(newSize uint64) {
+	d.dataMu.Lock()
+	if seg := d.dirty.LastSegment(); seg.Ok() && seg.End() > newSize {
+		d.dataMu.Unlock()
+		return
+	}
+	d.updateSizeAndUnlockDataMuLocked(newSize)
+}
+
 // Preconditions: d.metadataMu and d.dataMu must be locked.
 //
 // Postconditions: d.dataMu is unlocked.
@@ -1642,11 +1979,12 @@ func (d *dentry) checkCachingLocked(ctx context.Context, renameMuWriteLocked boo
 		return
 	}
 	// Cache the dentry, then evict the least recently used cached dentry if
-	// the cache becomes over-full.
+	// the cache becomes over-full, or to keep it from growing while the
+	// sentry's memory is over limit.
 	d.fs.dentryCache.dentries.PushFront(&d.cacheEntry)
 	d.fs.dentryCache.dentriesLen++
 	d.cached = true
-	shouldEvict := d.fs.dentryCache.dentriesLen > d.fs.dentryCache.maxCachedDentries
+	shouldEvict := d.fs.dentryCache.dentriesLen > d.fs.dentryCache.maxCachedDentries || usage.SentryMemoryOverLimit()
 	d.fs.dentryCache.mu.Unlock()
 	d.cachingMu.Unlock()
 
@@ -220,6 +220,7 @@ func (fs *filesystem) StateFields() []string {
 		"syncableDentries",
 		"specialFileFDs",
 		"lastIno",
+		"savedInoByKey",
 		"savedDentryRW",
 		"released",
 	}
@@ -241,8 +242,9 @@ func (fs *filesystem) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(8, &fs.syncableDentries)
 	stateSinkObject.Save(9, &fs.specialFileFDs)
 	stateSinkObject.Save(10, &fs.lastIno)
-	stateSinkObject.Save(11, &fs.savedDentryRW)
-	stateSinkObject.Save(12, &fs.released)
+	stateSinkObject.Save(11, &fs.savedInoByKey)
+	stateSinkObject.Save(12, &fs.savedDentryRW)
+	stateSinkObject.Save(13, &fs.released)
 }
 
 func (fs *filesystem) afterLoad() {}
@@ -260,8 +262,9 @@ func (fs *filesystem) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(8, &fs.syncableDentries)
 	stateSourceObject.Load(9, &fs.specialFileFDs)
 	stateSourceObject.Load(10, &fs.lastIno)
-	stateSourceObject.Load(11, &fs.savedDentryRW)
-	stateSourceObject.Load(12, &fs.released)
+	stateSourceObject.Load(11, &fs.savedInoByKey)
+	stateSourceObject.Load(12, &fs.savedDentryRW)
+	stateSourceObject.Load(13, &fs.released)
 }
 
 func (f *filesystemOptions) StateTypeName() string {
@@ -280,6 +283,12 @@ func (f *filesystemOptions) StateFields() []string {
 		"overlayfsStaleRead",
 		"regularFilesUseSpecialFileFD",
 		"disableFifoOpen",
+		"readahead",
+		"writeback",
+		"ino",
+		"dev",
+		"truncateEIO",
+		"watch",
 		"directfs",
 	}
 }
@@ -299,7 +308,13 @@ func (f *filesystemOptions) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(7, &f.overlayfsStaleRead)
 	stateSinkObject.Save(8, &f.regularFilesUseSpecialFileFD)
 	stateSinkObject.Save(9, &f.disableFifoOpen)
-	stateSinkObject.Save(10, &f.directfs)
+	stateSinkObject.Save(10, &f.readahead)
+	stateSinkObject.Save(11, &f.writeback)
+	stateSinkObject.Save(12, &f.ino)
+	stateSinkObject.Save(13, &f.dev)
+	stateSinkObject.Save(14, &f.truncateEIO)
+	stateSinkObject.Save(15, &f.watch)
+	stateSinkObject.Save(16, &f.directfs)
 }
 
 func (f *filesystemOptions) afterLoad() {}
@@ -316,7 +331,13 @@ func (f *filesystemOptions) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(7, &f.overlayfsStaleRead)
 	stateSourceObject.Load(8, &f.regularFilesUseSpecialFileFD)
 	stateSourceObject.Load(9, &f.disableFifoOpen)
-	stateSourceObject.Load(10, &f.directfs)
+	stateSourceObject.Load(10, &f.readahead)
+	stateSourceObject.Load(11, &f.writeback)
+	stateSourceObject.Load(12, &f.ino)
+	stateSourceObject.Load(13, &f.dev)
+	stateSourceObject.Load(14, &f.truncateEIO)
+	stateSourceObject.Load(15, &f.watch)
+	stateSourceObject.Load(16, &f.directfs)
 }
 
 func (d *directfsOpts) StateTypeName() string {
@@ -344,6 +365,14 @@ func (d *directfsOpts) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &d.enabled)
 }
 
+func (i *InoMode) StateTypeName() string {
+	return "pkg/sentry/fsimpl/gofer.InoMode"
+}
+
+func (i *InoMode) StateFields() []string {
+	return nil
+}
+
 func (i *InteropMode) StateTypeName() string {
 	return "pkg/sentry/fsimpl/gofer.InteropMode"
 }
@@ -359,6 +388,7 @@ func (i *InternalFilesystemOptions) StateTypeName() string {
 func (i *InternalFilesystemOptions) StateFields() []string {
 	return []string{
 		"UniqueID",
+		"Owner",
 		"LeakConnection",
 		"OpenSocketsByConnecting",
 	}
@@ -370,8 +400,9 @@ func (i *InternalFilesystemOptions) beforeSave() {}
 func (i *InternalFilesystemOptions) StateSave(stateSinkObject state.Sink) {
 	i.beforeSave()
 	stateSinkObject.Save(0, &i.UniqueID)
-	stateSinkObject.Save(1, &i.LeakConnection)
-	stateSinkObject.Save(2, &i.OpenSocketsByConnecting)
+	stateSinkObject.Save(1, &i.Owner)
+	stateSinkObject.Save(2, &i.LeakConnection)
+	stateSinkObject.Save(3, &i.OpenSocketsByConnecting)
 }
 
 func (i *InternalFilesystemOptions) afterLoad() {}
@@ -379,8 +410,9 @@ func (i *InternalFilesystemOptions) afterLoad() {}
 // +checklocksignore
 func (i *InternalFilesystemOptions) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &i.UniqueID)
-	stateSourceObject.Load(1, &i.LeakConnection)
-	stateSourceObject.Load(2, &i.OpenSocketsByConnecting)
+	stateSourceObject.Load(1, &i.Owner)
+	stateSourceObject.Load(2, &i.LeakConnection)
+	stateSourceObject.Load(3, &i.OpenSocketsByConnecting)
 }
 
 func (i *inoKey) StateTypeName() string {
@@ -953,6 +985,7 @@ func init() {
 	state.Register((*filesystem)(nil))
 	state.Register((*filesystemOptions)(nil))
 	state.Register((*directfsOpts)(nil))
+	state.Register((*InoMode)(nil))
 	state.Register((*InteropMode)(nil))
 	state.Register((*InternalFilesystemOptions)(nil))
 	state.Register((*inoKey)(nil))
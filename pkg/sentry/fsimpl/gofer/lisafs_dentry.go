@@ -534,10 +534,7 @@ func (d *lisafsDentry) restoreFile(ctx context.Context, inode *lisafs.Inode, opt
 	//		checking inoKey.
 	//
 	//	- We need to associate the new inoKey with the existing d.ino.
-	d.inoKey = inoKeyFromStatx(&inode.Stat)
-	d.fs.inoMu.Lock()
-	d.fs.inoByKey[d.inoKey] = d.ino
-	d.fs.inoMu.Unlock()
+	d.fs.restoreInoKey(&d.dentry, inoKeyFromStatx(&inode.Stat))
 
 	// Check metadata stability before updating metadata.
 	d.metadataMu.Lock()
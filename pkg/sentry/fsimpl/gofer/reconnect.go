@@ -0,0 +1,258 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"fmt"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/lisafs"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"golang.org/x/sys/unix"
+)
+
+var _ vfs.FilesystemImplReconnectExtension = (*filesystem)(nil)
+
+// Reconnect implements vfs.FilesystemImplReconnectExtension.Reconnect.
+//
+// Host FDs donated by the previous server remain valid, so directfs dentries
+// and open files backed by a host FD are unaffected. Cached dentries are
+// walked again by path, and their shared handles reopened, as long as the
+// file found at their path is the same as before. Other dentries, e.g. of
+// deleted or replaced files, are left with invalid lisafs FDs: operations that
+// need the server fail on them. Sockets bound through the previous server are
+// not restored.
+func (fs *filesystem) Reconnect(ctx context.Context, owner string, fds map[string]int) error {
+	if fs.iopts.Owner == "" || fs.iopts.Owner != owner || fs.released.Load() != 0 {
+		return nil
+	}
+	fd, ok := fds[fs.iopts.UniqueID]
+	if !ok {
+		return nil
+	}
+	delete(fds, fs.iopts.UniqueID)
+
+	fs.renameMu.Lock()
+	defer fs.renameMu.Unlock()
+
+	// Make RPCs racing with the reconnection fail quickly, if the previous
+	// server isn't gone already.
+	oldClient := fs.client
+	oldClient.Close()
+
+	fs.opts.fd = fd
+	if err := fs.reconnectRoot(ctx); err != nil {
+		if fs.client == nil {
+			fs.client = oldClient
+		}
+		return fmt.Errorf("reconnecting filesystem %q: %w", fs.iopts.UniqueID, err)
+	}
+	fs.root.reconnectDescendantsLocked(ctx)
+
+	// Dentries that are no longer reachable from the root, e.g. of deleted
+	// files that are still open, can't be walked again.
+	fs.syncMu.Lock()
+	for elem := fs.syncableDentries.Front(); elem != nil; elem = elem.Next() {
+		elem.d.dropStaleFDs(ctx)
+	}
+	for sffd := fs.specialFileFDs.Front(); sffd != nil; sffd = sffd.Next() {
+		sffd.reconnect(ctx)
+	}
+	fs.syncMu.Unlock()
+
+	// The previous server's watcher is gone with it.
+	fs.stopWatcher()
+	fs.startWatcher(ctx)
+
+	log.Infof("Reconnected gofer filesystem %q to FD %d", fs.iopts.UniqueID, fd)
+	return nil
+}
+
+// Preconditions: fs.renameMu is locked for writing.
+func (fs *filesystem) reconnectRoot(ctx context.Context) error {
+	rootInode, rootHostFD, err := fs.initClientAndGetRoot(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The root is always non-synthetic.
+	switch dt := fs.root.impl.(type) {
+	case *lisafsDentry:
+		if key := inoKeyFromStatx(&rootInode.Stat); key != dt.inoKey {
+			fs.client.CloseFD(ctx, rootInode.ControlFD, true /* flush */)
+			return fmt.Errorf("root changed from %+v to %+v", dt.inoKey, key)
+		}
+		dt.controlFD = fs.client.NewFD(rootInode.ControlFD)
+		dt.reconnectHandles(ctx)
+	case *directfsDentry:
+		// The existing host FD of the root is still usable.
+		_ = unix.Close(rootHostFD)
+		dt.controlFDLisa = fs.client.NewFD(rootInode.ControlFD)
+	default:
+		panic("unknown dentry implementation")
+	}
+	return nil
+}
+
+// reconnectDescendantsLocked walks the cached descendants of d again on the
+// new connection.
+//
+// Preconditions:
+//   - fs.renameMu is locked for writing.
+//   - d is not synthetic, and has been reconnected.
+func (d *dentry) reconnectDescendantsLocked(ctx context.Context) {
+	d.childrenMu.Lock()
+	defer d.childrenMu.Unlock()
+	for _, child := range d.children {
+		if child == nil || child.isSynthetic() {
+			continue
+		}
+		switch dt := child.impl.(type) {
+		case *lisafsDentry:
+			dt.reconnect(ctx)
+		case *directfsDentry:
+			// The lisafs control FD is only used for some operations on
+			// sockets, and is reopened when needed.
+			child.handleMu.Lock()
+			dt.controlFDLisa = lisafs.ClientFD{}
+			child.handleMu.Unlock()
+		default:
+			panic("unknown dentry implementation")
+		}
+		child.reconnectDescendantsLocked(ctx)
+	}
+}
+
+// Preconditions:
+//   - d.fs.renameMu is locked for writing.
+//   - d.parent has been reconnected.
+func (d *lisafsDentry) reconnect(ctx context.Context) {
+	controlFD := d.fs.client.NewFD(lisafs.InvalidFDID)
+	parent := d.parent.impl.(*lisafsDentry)
+	switch {
+	case d.isDeleted():
+		// Another file may have been created at its path.
+	case !parent.controlFD.Ok():
+		log.Warningf("gofer.lisafsDentry(%q).reconnect: parent was not reconnected", genericDebugPathname(&d.dentry))
+	default:
+		inode, err := parent.controlFD.Walk(ctx, d.name)
+		if err != nil {
+			log.Warningf("gofer.lisafsDentry(%q).reconnect: walk failed: %v", genericDebugPathname(&d.dentry), err)
+			break
+		}
+		if key := inoKeyFromStatx(&inode.Stat); key != d.inoKey {
+			log.Warningf("gofer.lisafsDentry(%q).reconnect: file was replaced", genericDebugPathname(&d.dentry))
+			d.fs.client.CloseFD(ctx, inode.ControlFD, false /* flush */)
+			break
+		}
+		controlFD = d.fs.client.NewFD(inode.ControlFD)
+	}
+	d.controlFD = controlFD
+	d.reconnectHandles(ctx)
+}
+
+// reconnectHandles reopens the shared lisafs handles of d on the new
+// connection. Host FDs of d are kept, as they are still valid.
+//
+// Preconditions: d.controlFD has been reconnected.
+func (d *lisafsDentry) reconnectHandles(ctx context.Context) {
+	d.handleMu.Lock()
+	defer d.handleMu.Unlock()
+	read, write := d.readFDLisa.Ok(), d.writeFDLisa.Ok()
+	shared := read && write && d.readFDLisa.ID() == d.writeFDLisa.ID()
+	invalid := d.fs.client.NewFD(lisafs.InvalidFDID)
+	d.readFDLisa, d.writeFDLisa = invalid, invalid
+	if !d.controlFD.Ok() {
+		return
+	}
+
+	open := func(read, write bool) lisafs.ClientFD {
+		h, err := d.dentry.openHandle(ctx, read, write, false /* trunc */)
+		if err != nil {
+			log.Warningf("gofer.lisafsDentry(%q).reconnectHandles: open failed: %v", genericDebugPathname(&d.dentry), err)
+			return invalid
+		}
+		if h.fd >= 0 {
+			_ = unix.Close(int(h.fd))
+		}
+		return h.fdLisa
+	}
+	switch {
+	case shared:
+		d.readFDLisa = open(true, true)
+		d.writeFDLisa = d.readFDLisa
+	default:
+		if read {
+			d.readFDLisa = open(true, false)
+		}
+		if write {
+			d.writeFDLisa = open(false, true)
+		}
+	}
+}
+
+// dropStaleFDs replaces the lisafs FDs of d that weren't reconnected with
+// invalid FDs of the new connection, so that the previous connection is no
+// longer used.
+//
+// Preconditions: d.fs.renameMu is locked for writing.
+func (d *dentry) dropStaleFDs(ctx context.Context) {
+	client := d.fs.client
+	switch dt := d.impl.(type) {
+	case *lisafsDentry:
+		if dt.controlFD.Client() == client {
+			return
+		}
+		dt.controlFD = client.NewFD(lisafs.InvalidFDID)
+		dt.reconnectHandles(ctx)
+	case *directfsDentry:
+		d.handleMu.Lock()
+		if dt.controlFDLisa.Ok() && dt.controlFDLisa.Client() != client {
+			dt.controlFDLisa = lisafs.ClientFD{}
+		}
+		d.handleMu.Unlock()
+	}
+}
+
+// reconnect switches fd to the new connection. Host FDs are kept; lisafs-only
+// handles are only reopened for regular files, since reopening other files,
+// e.g. pipes, may block or have side effects.
+//
+// Preconditions:
+//   - fs.renameMu is locked for writing.
+//   - fs.syncMu is locked.
+//   - The dentry of fd has been reconnected.
+func (fd *specialFileFD) reconnect(ctx context.Context) {
+	d := fd.dentry()
+	fd.releaseMu.Lock()
+	defer fd.releaseMu.Unlock()
+	invalid := d.fs.client.NewFD(lisafs.InvalidFDID)
+	hadLisaFD := fd.handle.fdLisa.Ok()
+	fd.handle.fdLisa = invalid
+	if !hadLisaFD || fd.handle.fd >= 0 || d.fileType() != linux.S_IFREG {
+		return
+	}
+	h, err := d.openHandle(ctx, fd.vfsfd.IsReadable(), fd.vfsfd.IsWritable(), false /* trunc */)
+	if err != nil {
+		log.Warningf("gofer.specialFileFD(%q).reconnect: open failed: %v", genericDebugPathname(d), err)
+		return
+	}
+	if h.fd >= 0 {
+		_ = unix.Close(int(h.fd))
+	}
+	fd.handle.fdLisa = h.fdLisa
+}
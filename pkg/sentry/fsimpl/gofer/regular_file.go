@@ -26,6 +26,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/metric"
 	"github.com/talismancer/gvisor-ligolo/pkg/safemem"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/faultinject"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsmetric"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsutil"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/memmap"
@@ -47,8 +48,26 @@ type regularFileFD struct {
 	// off is the file offset. off is protected by mu.
 	mu  sync.Mutex `state:"nosave"`
 	off int64
+
+	// directMu protects direct and directUnsupported.
+	directMu sync.Mutex `state:"nosave"`
+
+	// direct is the handle that I/O goes to while the FD has O_DIRECT set. It
+	// is opened with O_DIRECT on the first such I/O, and is nil until then.
+	direct *handle `state:"nosave"`
+
+	// directUnsupported is true if the remote file couldn't be opened with
+	// O_DIRECT, in which case I/O with O_DIRECT set only bypasses the page
+	// cache of the sentry.
+	directUnsupported bool `state:"nosave"`
 }
 
+// directIOAlignment is the required alignment of the offset and length of
+// I/O with O_DIRECT set. Like Linux, we require alignment to the minimum
+// logical block size; the host rejects I/O that isn't aligned to the
+// logical block size of the backing device.
+const directIOAlignment = 512
+
 func newRegularFileFD(mnt *vfs.Mount, d *dentry, flags uint32) (*regularFileFD, error) {
 	fd := &regularFileFD{}
 	fd.LockFD.Init(&d.locks)
@@ -69,7 +88,50 @@ func newRegularFileFD(mnt *vfs.Mount, d *dentry, flags uint32) (*regularFileFD,
 }
 
 // Release implements vfs.FileDescriptionImpl.Release.
-func (fd *regularFileFD) Release(context.Context) {
+func (fd *regularFileFD) Release(ctx context.Context) {
+	if fd.direct != nil {
+		fd.direct.close(ctx)
+	}
+}
+
+// directHandle returns the handle that I/O of length bytes at offset goes to
+// while fd has O_DIRECT set. It returns noHandle if the remote file doesn't
+// support O_DIRECT, in which case the I/O goes to the dentry's handles.
+func (fd *regularFileFD) directHandle(ctx context.Context, offset, length int64) (handle, error) {
+	d := fd.dentry()
+	if d.isSynthetic() {
+		return noHandle, nil
+	}
+	fd.directMu.Lock()
+	defer fd.directMu.Unlock()
+	if fd.directUnsupported {
+		return noHandle, nil
+	}
+	if fd.direct == nil {
+		d.fs.renameMu.RLock()
+		h, err := d.openHandle(ctx, fd.vfsfd.IsReadable(), fd.vfsfd.IsWritable(), false /* trunc */)
+		d.fs.renameMu.RUnlock()
+		if err == nil && h.fd < 0 {
+			// I/O through the gofer goes through its buffers, which
+			// don't satisfy the alignment requirements of O_DIRECT.
+			h.close(ctx)
+			err = linuxerr.EINVAL
+		}
+		if err != nil {
+			if !linuxerr.Equals(linuxerr.EINVAL, err) {
+				return noHandle, err
+			}
+			// The remote filesystem doesn't support O_DIRECT.
+			log.Debugf("gofer.regularFileFD.directHandle: falling back to buffered I/O for %q: %v", genericDebugPathname(d), err)
+			fd.directUnsupported = true
+			return noHandle, nil
+		}
+		fd.direct = &h
+	}
+	if offset%directIOAlignment != 0 || length%directIOAlignment != 0 {
+		return noHandle, linuxerr.EINVAL
+	}
+	return *fd.direct, nil
 }
 
 // OnClose implements vfs.FileDescriptionImpl.OnClose.
@@ -100,7 +162,10 @@ func (fd *regularFileFD) OnClose(ctx context.Context) error {
 // Allocate implements vfs.FileDescriptionImpl.Allocate.
 func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
 	d := fd.dentry()
-	return d.doAllocate(ctx, offset, length, func() error {
+	vfsfs := fd.vfsfd.Mount().Filesystem()
+	vfsfs.StartWrite()
+	defer vfsfs.EndWrite()
+	return d.doAllocate(ctx, mode, offset, length, func() error {
 		return d.allocate(ctx, mode, offset, length)
 	})
 }
@@ -130,6 +195,13 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		return 0, linuxerr.EOPNOTSUPP
 	}
 
+	if err := d.checkFault(ctx, faultinject.GoferRead); err != nil {
+		return 0, err
+	}
+	if d.truncated.Load() {
+		return 0, linuxerr.EIO
+	}
+
 	// Check for reading at EOF before calling into MM (but not under
 	// InteropModeShared, which makes d.size unreliable).
 	if d.cachedMetadataAuthoritative() && uint64(offset) >= d.size.Load() {
@@ -141,6 +213,10 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		readErr error
 	)
 	if fd.vfsfd.StatusFlags()&linux.O_DIRECT != 0 {
+		dh, err := fd.directHandle(ctx, offset, dst.NumBytes())
+		if err != nil {
+			return 0, err
+		}
 		// Write dirty cached pages that will be touched by the read back to
 		// the remote file.
 		if err := d.writeback(ctx, offset, dst.NumBytes()); err != nil {
@@ -149,6 +225,7 @@ func (fd *regularFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		rw := getDentryReadWriter(ctx, d, offset)
 		// Require the read to go to the remote file.
 		rw.direct = true
+		rw.dh = dh
 		n, readErr = dst.CopyOutFrom(ctx, rw)
 		putDentryReadWriter(rw)
 		if d.fs.opts.interop != InteropModeShared {
@@ -198,6 +275,17 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 	d := fd.dentry()
 
+	if err := d.checkFault(ctx, faultinject.GoferWrite); err != nil {
+		return 0, offset, err
+	}
+	if d.truncated.Load() {
+		return 0, offset, linuxerr.EIO
+	}
+
+	vfsfs := fd.vfsfd.Mount().Filesystem()
+	vfsfs.StartWrite()
+	defer vfsfs.EndWrite()
+
 	d.metadataMu.Lock()
 	defer d.metadataMu.Unlock()
 
@@ -232,12 +320,17 @@ func (fd *regularFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 	defer putDentryReadWriter(rw)
 
 	if fd.vfsfd.StatusFlags()&linux.O_DIRECT != 0 {
+		dh, err := fd.directHandle(ctx, offset, src.NumBytes())
+		if err != nil {
+			return 0, offset, err
+		}
 		if err := fd.writeCache(ctx, d, offset, src); err != nil {
 			return 0, offset, err
 		}
 
 		// Require the write to go to the remote file.
 		rw.direct = true
+		rw.dh = dh
 	}
 
 	n, err := src.CopyInTo(ctx, rw)
@@ -291,7 +384,15 @@ func (fd *regularFileFD) writeCache(ctx context.Context, d *dentry, offset int64
 	if !ok {
 		return linuxerr.EINVAL
 	}
-	mr := memmap.MappableRange{pgstart, pgend}
+	d.dropCache(memmap.MappableRange{pgstart, pgend})
+	return nil
+}
+
+// dropCache removes the cached pages of d in mr, without writing them back,
+// and invalidates their mappings.
+//
+// Preconditions: mr must be page-aligned.
+func (d *dentry) dropCache(mr memmap.MappableRange) {
 	var freed []memmap.FileRange
 
 	d.dataMu.Lock()
@@ -313,7 +414,6 @@ func (fd *regularFileFD) writeCache(ctx context.Context, d *dentry, offset int64
 	for _, freedFR := range freed {
 		mf.DecRef(freedFR)
 	}
-	return nil
 }
 
 // Write implements vfs.FileDescriptionImpl.Write.
@@ -330,6 +430,10 @@ type dentryReadWriter struct {
 	d      *dentry
 	off    uint64
 	direct bool
+
+	// If direct is true and dh is valid, I/O goes to dh, which was opened
+	// with O_DIRECT, rather than to the handles of d.
+	dh handle
 }
 
 var dentryReadWriterPool = sync.Pool{
@@ -344,12 +448,14 @@ func getDentryReadWriter(ctx context.Context, d *dentry, offset int64) *dentryRe
 	rw.d = d
 	rw.off = uint64(offset)
 	rw.direct = false
+	rw.dh = noHandle
 	return rw
 }
 
 func putDentryReadWriter(rw *dentryReadWriter) {
 	rw.ctx = nil
 	rw.d = nil
+	rw.dh = noHandle
 	dentryReadWriterPool.Put(rw)
 }
 
@@ -366,6 +472,9 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 	// readHandle() without locking dentry.dataMu.
 	rw.d.handleMu.RLock()
 	h := rw.d.readHandle()
+	if rw.direct && rw.dh.fd >= 0 {
+		h = rw.dh
+	}
 	if (rw.d.mmapFD.RacyLoad() >= 0 && !rw.d.fs.opts.forcePageCache) || rw.d.fs.opts.interop == InteropModeShared || rw.direct {
 		n, err := h.readToBlocksAt(rw.ctx, dsts, rw.off)
 		rw.d.handleMu.RUnlock()
@@ -435,7 +544,7 @@ func (rw *dentryReadWriter) ReadToBlocks(dsts safemem.BlockSeq) (uint64, error)
 					End:   gapEnd,
 				}
 				optMR := gap.Range()
-				_, err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR), rw.d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
+				_, err := rw.d.cache.Fill(rw.ctx, reqMR, maxFillRange(reqMR, optMR, rw.d.maxReadahead()), rw.d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
 				mf.MarkEvictable(rw.d, pgalloc.EvictableRange{optMR.Start, optMR.End})
 				seg, gap = rw.d.cache.Find(rw.off)
 				if !seg.Ok() {
@@ -486,6 +595,9 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 	// without locking dentry.dataMu.
 	rw.d.handleMu.RLock()
 	h := rw.d.writeHandle()
+	if rw.direct && rw.dh.fd >= 0 {
+		h = rw.dh
+	}
 	if (rw.d.mmapFD.RacyLoad() >= 0 && !rw.d.fs.opts.forcePageCache) || rw.d.fs.opts.interop == InteropModeShared || rw.direct {
 		n, err := h.writeFromBlocksAt(rw.ctx, srcs, rw.off)
 		rw.off += n
@@ -511,9 +623,24 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 		end = math.MaxInt64
 	}
 
+	// If the write is batched, allocate the cache pages it writes to, so that
+	// it's buffered in the cache below rather than written to the file.
+	batch := rw.d.shouldBatchWriteLocked(mf, start, end)
+	if batch {
+		pgEnd, _ := hostarch.PageRoundUp(end)
+		mr := memmap.MappableRange{hostarch.PageRoundDown(start), pgEnd}
+		rh := rw.d.readHandle()
+		if _, err := rw.d.cache.Fill(rw.ctx, mr, mr, rw.d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, rh.readToBlocksAt); err != nil {
+			// Write whatever wasn't allocated directly to the file.
+			log.Debugf("gofer.dentryReadWriter.WriteFromBlocks: failed to allocate cache for batched write %v: %v", mr, err)
+		}
+		mf.MarkEvictable(rw.d, pgalloc.EvictableRange{mr.Start, mr.End})
+	}
+
 	var (
-		done   uint64
-		retErr error
+		done    uint64
+		dirtied uint64
+		retErr  error
 	)
 	seg, gap := rw.d.cache.Find(rw.off)
 	for rw.off < end {
@@ -531,6 +658,7 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 			// Copy to internal mappings.
 			n, err := safemem.CopySeq(ims, srcs)
 			done += n
+			dirtied += n
 			rw.off += n
 			srcs = srcs.DropFirst64(n)
 			rw.d.dirty.MarkDirty(segMR)
@@ -543,10 +671,11 @@ func (rw *dentryReadWriter) WriteFromBlocks(srcs safemem.BlockSeq) (uint64, erro
 			seg, gap = seg.NextNonEmpty()
 
 		case gap.Ok():
-			// Write directly to the file. At present, we never fill the cache
-			// when writing, since doing so can convert small writes into
-			// inefficient read-modify-write cycles, and we have no mechanism
-			// for detecting or avoiding this.
+			// Write directly to the file. Except for batched writes, which
+			// only append to the file, we never fill the cache when writing,
+			// since doing so can convert small writes into inefficient
+			// read-modify-write cycles, and we have no mechanism for
+			// detecting or avoiding this.
 			gapMR := gap.Range().Intersect(mr)
 			gapSrcs := srcs.TakeFirst64(gapMR.Length())
 			n, err := h.writeFromBlocksAt(rw.ctx, gapSrcs, gapMR.Start)
@@ -569,6 +698,12 @@ exitLoop:
 		// The remote file's size will implicitly be extended to the correct
 		// value when we write back to it.
 	}
+	if batch && done != 0 {
+		rw.d.writebackBatchLocked(rw.ctx, h, memmap.MappableRange{start, rw.off})
+	}
+	if dirtied != 0 {
+		rw.d.noteDirtyLocked(rw.ctx, h, memmap.MappableRange{start, rw.off}, dirtied)
+	}
 	// If InteropModeWritethrough is in effect, flush written data back to the
 	// remote filesystem.
 	if rw.d.fs.opts.interop == InteropModeWritethrough && done != 0 {
@@ -587,6 +722,147 @@ exitLoop:
 	return done, retErr
 }
 
+// shouldBatchWriteLocked returns true if a write of bytes [start, end) should
+// be buffered in the cache and written back in a batch. Only writes that
+// append to the file are batched, since batching writes that overwrite
+// uncached data would require read-modify-write cycles.
+//
+// Preconditions:
+//   - d.handleMu must be locked.
+//   - d.dataMu must be locked.
+//   - d is client-cached.
+func (d *dentry) shouldBatchWriteLocked(mf *pgalloc.MemoryFile, start, end uint64) bool {
+	if d.fs.opts.writeback == 0 || d.fs.opts.interop != InteropModeExclusive || end == math.MaxInt64 {
+		return false
+	}
+	if d.accessPattern.Load() == linux.POSIX_FADV_RANDOM || !mf.ShouldCacheEvictable() {
+		return false
+	}
+	size := d.size.Load()
+	if start < size {
+		return false
+	}
+	// Filling the cache reads the last page of the file, if it's partial.
+	return hostarch.PageRoundDown(start) >= size || d.isReadHandleOk()
+}
+
+// writebackBatchLocked adds bytes mr, which were written to the cache, to the
+// batch of writes of d, and writes the batch back to the remote file once it
+// reaches filesystemOptions.writeback bytes. Failures to write back are
+// logged, as the data stays dirty in the cache.
+//
+// Preconditions:
+//   - d.handleMu must be locked.
+//   - d.dataMu must be locked.
+func (d *dentry) writebackBatchLocked(ctx context.Context, h handle, mr memmap.MappableRange) {
+	if d.batched.Length() == 0 {
+		d.batched = mr
+	} else {
+		if mr.Start < d.batched.Start {
+			d.batched.Start = mr.Start
+		}
+		if mr.End > d.batched.End {
+			d.batched.End = mr.End
+		}
+	}
+	if d.batched.Length() < d.fs.opts.writeback {
+		return
+	}
+	if err := fsutil.SyncDirty(ctx, d.batched, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt); err != nil {
+		log.Warningf("gofer.dentry.writebackBatchLocked: failed to write back %v: %v", d.batched, err)
+	}
+	d.batched = memmap.MappableRange{}
+}
+
+// maxPrefetch is the maximum number of bytes read into the cache for
+// POSIX_FADV_WILLNEED advice, which is only a hint.
+const maxPrefetch = 16 << 20 // 16 MiB
+
+// sequentialReadaheadFactor scales the maximum readahead of files that are
+// advised to be accessed sequentially.
+const sequentialReadaheadFactor = 4
+
+// maxReadahead returns the maximum number of bytes read ahead of accesses to
+// d's data, depending on the access pattern advised for d.
+func (d *dentry) maxReadahead() uint64 {
+	switch d.accessPattern.Load() {
+	case linux.POSIX_FADV_RANDOM:
+		return 0
+	case linux.POSIX_FADV_SEQUENTIAL:
+		return sequentialReadaheadFactor * d.fs.opts.maxReadahead()
+	default:
+		return d.fs.opts.maxReadahead()
+	}
+}
+
+// Advise implements vfs.FileAdvisor.Advise.
+func (fd *regularFileFD) Advise(ctx context.Context, offset, length int64, advice int32) error {
+	d := fd.dentry()
+	switch advice {
+	case linux.POSIX_FADV_NORMAL, linux.POSIX_FADV_RANDOM, linux.POSIX_FADV_SEQUENTIAL:
+		d.accessPattern.Store(advice)
+	case linux.POSIX_FADV_WILLNEED:
+		d.prefetch(ctx, offset, length)
+	case linux.POSIX_FADV_DONTNEED:
+		// Like Linux, write back dirty data. Clean data stays cached, as it
+		// may be mapped.
+		if length == 0 {
+			length = math.MaxInt64
+		}
+		return d.writeback(ctx, offset, length)
+	}
+	return nil
+}
+
+// Advise implements memmap.MappableAdvisor.Advise.
+func (d *dentry) Advise(ctx context.Context, mr memmap.MappableRange, advice int32) {
+	if advice == linux.POSIX_FADV_WILLNEED {
+		d.prefetch(ctx, int64(mr.Start), int64(mr.Length()))
+		return
+	}
+	d.accessPattern.Store(advice)
+}
+
+// prefetch reads bytes [offset, offset+length) of d into the cache, if d is
+// client-cached. A length of 0 extends to the end of the file. At most
+// maxPrefetch bytes are read.
+func (d *dentry) prefetch(ctx context.Context, offset, length int64) {
+	if offset < 0 || length < 0 {
+		return
+	}
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	if (d.mmapFD.RacyLoad() >= 0 && !d.fs.opts.forcePageCache) || d.fs.opts.interop == InteropModeShared || !d.isReadHandleOk() {
+		return
+	}
+	mf := d.fs.mfp.MemoryFile()
+	if !mf.ShouldCacheEvictable() {
+		return
+	}
+	h := d.readHandle()
+	d.dataMu.Lock()
+	defer d.dataMu.Unlock()
+
+	size := d.size.Load()
+	start := hostarch.PageRoundDown(uint64(offset))
+	if start >= size {
+		return
+	}
+	end := size
+	if rend := uint64(offset) + uint64(length); length != 0 && rend > uint64(offset) && rend < end {
+		end = rend
+	}
+	if end-start > maxPrefetch {
+		end = start + maxPrefetch
+	}
+	pgEnd, _ := hostarch.PageRoundUp(end)
+	mr := memmap.MappableRange{start, pgEnd}
+	if _, err := d.cache.Fill(ctx, mr, mr, size, mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt); err != nil {
+		log.Debugf("gofer.dentry.prefetch: failed to read %v: %v", mr, err)
+	}
+	mf.MarkEvictable(d, pgalloc.EvictableRange{mr.Start, mr.End})
+}
+
 func (d *dentry) writeback(ctx context.Context, offset, size int64) error {
 	if size == 0 {
 		return nil
@@ -754,6 +1030,13 @@ func (d *dentry) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR,
 	return d.AddMapping(ctx, ms, dstAR, offset, writable)
 }
 
+// HandleExternalTruncate implements memmap.ExternalTruncateHandler.
+func (d *dentry) HandleExternalTruncate(ctx context.Context, off uint64) {
+	if d.fs.opts.truncateEIO {
+		d.truncated.Store(true)
+	}
+}
+
 // Translate implements memmap.Mappable.Translate.
 func (d *dentry) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
 	d.handleMu.RLock()
@@ -761,7 +1044,7 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 		d.handleMu.RUnlock()
 		mr := optional
 		if d.fs.opts.limitHostFDTranslation {
-			mr = maxFillRange(required, optional)
+			mr = maxFillRange(required, optional, d.maxReadahead())
 		}
 		return []memmap.Translation{
 			{
@@ -794,7 +1077,7 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 
 	mf := d.fs.mfp.MemoryFile()
 	h := d.readHandle()
-	_, cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional), d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
+	_, cerr := d.cache.Fill(ctx, required, maxFillRange(required, optional, d.maxReadahead()), d.size.Load(), mf, usage.PageCache, pgalloc.AllocateAndWritePopulate, h.readToBlocksAt)
 
 	var ts []memmap.Translation
 	var translatedEnd uint64
@@ -835,8 +1118,20 @@ func (d *dentry) Translate(ctx context.Context, required, optional memmap.Mappab
 	return ts, nil
 }
 
-func maxFillRange(required, optional memmap.MappableRange) memmap.MappableRange {
-	const maxReadahead = 64 << 10 // 64 KB, chosen arbitrarily
+// defaultMaxReadahead is the default maximum number of bytes read ahead of
+// accesses to regular files.
+const defaultMaxReadahead = 64 << 10 // 64 KB, chosen arbitrarily
+
+// maxReadahead returns the maximum number of bytes read ahead of accesses to
+// regular files.
+func (f *filesystemOptions) maxReadahead() uint64 {
+	if f.readahead == 0 {
+		return defaultMaxReadahead
+	}
+	return f.readahead
+}
+
+func maxFillRange(required, optional memmap.MappableRange, maxReadahead uint64) memmap.MappableRange {
 	if required.Length() >= maxReadahead {
 		return required
 	}
@@ -74,6 +74,15 @@ func (fs *filesystem) PrepareSave(ctx context.Context) error {
 		return err
 	}
 
+	if fs.opts.ino == InoModePersist {
+		fs.inoMu.Lock()
+		fs.savedInoByKey = make(map[inoKey]uint64, len(fs.inoByKey))
+		for key, ino := range fs.inoByKey {
+			fs.savedInoByKey[key] = ino
+		}
+		fs.inoMu.Unlock()
+	}
+
 	fs.savedDentryRW = make(map[*dentry]savedDentryRW)
 	return fs.root.prepareSaveRecursive(ctx)
 }
@@ -181,11 +190,18 @@ func (fs *filesystem) CompleteRestore(ctx context.Context, opts vfs.CompleteRest
 		return fmt.Errorf("no server FD available for filesystem with unique ID %q", fs.iopts.UniqueID)
 	}
 	fs.opts.fd = fd
-	fs.inoByKey = make(map[inoKey]uint64)
+	fs.inoByKey = fs.savedInoByKey
+	if fs.inoByKey == nil {
+		fs.inoByKey = make(map[inoKey]uint64)
+	}
+	fs.hostDevSet = false
 
 	if err := fs.restoreRoot(ctx, &opts); err != nil {
 		return err
 	}
+	if opts.FileRestored != nil {
+		opts.FileRestored()
+	}
 
 	// Restore remaining dentries.
 	if err := fs.root.restoreDescendantsRecursive(ctx, &opts); err != nil {
@@ -219,7 +235,9 @@ func (fs *filesystem) CompleteRestore(ctx context.Context, opts vfs.CompleteRest
 
 	// Discard state only required during restore.
 	fs.savedDentryRW = nil
+	fs.savedInoByKey = nil
 
+	fs.startWatcher(ctx)
 	return nil
 }
 
@@ -237,6 +255,9 @@ func (d *dentry) restoreDescendantsRecursive(ctx context.Context, opts *vfs.Comp
 		if err := child.restoreFile(ctx, opts); err != nil {
 			return err
 		}
+		if opts.FileRestored != nil {
+			opts.FileRestored()
+		}
 		if err := child.restoreDescendantsRecursive(ctx, opts); err != nil {
 			return err
 		}
@@ -25,6 +25,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
 	"github.com/talismancer/gvisor-ligolo/pkg/metric"
 	"github.com/talismancer/gvisor-ligolo/pkg/safemem"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/faultinject"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsmetric"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsutil"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/memmap"
@@ -196,7 +197,7 @@ func (fd *specialFileFD) Epollable() bool {
 func (fd *specialFileFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
 	if fd.isRegularFile {
 		d := fd.dentry()
-		return d.doAllocate(ctx, offset, length, func() error {
+		return d.doAllocate(ctx, mode, offset, length, func() error {
 			return fd.handle.allocate(ctx, mode, offset, length)
 		})
 	}
@@ -227,7 +228,13 @@ func (fd *specialFileFD) PRead(ctx context.Context, dst usermem.IOSequence, offs
 		return 0, linuxerr.EOPNOTSUPP
 	}
 
-	if d := fd.dentry(); d.cachedMetadataAuthoritative() {
+	d := fd.dentry()
+	if fd.isRegularFile {
+		if err := d.checkFault(ctx, faultinject.GoferRead); err != nil {
+			return 0, err
+		}
+	}
+	if d.cachedMetadataAuthoritative() {
 		d.touchAtime(fd.vfsfd.Mount())
 	}
 
@@ -299,6 +306,9 @@ func (fd *specialFileFD) pwrite(ctx context.Context, src usermem.IOSequence, off
 
 	d := fd.dentry()
 	if fd.isRegularFile {
+		if err := d.checkFault(ctx, faultinject.GoferWrite); err != nil {
+			return 0, offset, err
+		}
 		// If the regular file fd was opened with O_APPEND, make sure the file
 		// size is updated. There is a possible race here if size is modified
 		// externally after metadata cache is updated.
@@ -467,7 +477,7 @@ func (fd *specialFileFD) CopyMapping(ctx context.Context, ms memmap.MappingSpace
 func (fd *specialFileFD) Translate(ctx context.Context, required, optional memmap.MappableRange, at hostarch.AccessType) ([]memmap.Translation, error) {
 	mr := optional
 	if fd.filesystem().opts.limitHostFDTranslation {
-		mr = maxFillRange(required, optional)
+		mr = maxFillRange(required, optional, fd.dentry().maxReadahead())
 	}
 	return []memmap.Translation{
 		{
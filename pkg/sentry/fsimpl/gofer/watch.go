@@ -0,0 +1,154 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"math"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/lisafs"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/pgalloc"
+	"golang.org/x/sys/unix"
+)
+
+// If the "watch" mount option is set, the gofer reports changes made to the
+// remote files from outside of the sandbox, and the cached dentries of changed
+// files are revalidated as in InteropModeShared, but only when they changed.
+// Clean cached pages of changed regular files are dropped. Since the sandbox's
+// own writes to the remote files are also reported, this costs an extra stat
+// of written files and the page cache of files that are both read and written.
+
+// startWatcher starts watching the remote filesystem for changes, if the
+// "watch" mount option is set and the gofer supports it.
+func (fs *filesystem) startWatcher(ctx context.Context) {
+	if !fs.opts.watch || !fs.client.IsSupported(lisafs.Watch) {
+		return
+	}
+	var rootFD lisafs.ClientFD
+	switch dt := fs.root.impl.(type) {
+	case *lisafsDentry:
+		rootFD = dt.controlFD
+	case *directfsDentry:
+		rootFD = dt.controlFDLisa
+	default:
+		panic("unknown dentry implementation")
+	}
+	fd, err := rootFD.Watch(ctx)
+	if err != nil {
+		log.Warningf("Failed to watch gofer filesystem %q for changes: %v", fs.iopts.UniqueID, err)
+		return
+	}
+
+	fs.watchMu.Lock()
+	defer fs.watchMu.Unlock()
+	if fs.watching || fs.released.Load() != 0 {
+		_ = unix.Close(fd)
+		return
+	}
+	fs.watching = true
+	fs.watchFD = fd
+	go fs.runWatcher(fd) // S/R-SAFE: restarted by CompleteRestore.
+}
+
+// stopWatcher stops watching the remote filesystem for changes, if it's being
+// watched.
+func (fs *filesystem) stopWatcher() {
+	fs.watchMu.Lock()
+	defer fs.watchMu.Unlock()
+	if fs.watching {
+		// Wake runWatcher up; it closes the FD.
+		_ = unix.Shutdown(fs.watchFD, unix.SHUT_RDWR)
+		fs.watching = false
+	}
+}
+
+func (fs *filesystem) runWatcher(fd int) {
+	defer func() {
+		fs.watchMu.Lock()
+		defer fs.watchMu.Unlock()
+		if fs.watching && fs.watchFD == fd {
+			fs.watching = false
+		}
+		_ = unix.Close(fd)
+	}()
+	ctx := context.Background()
+	buf := make([]byte, linux.PATH_MAX)
+	for {
+		n, err := unix.Read(fd, buf)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil || n == 0 {
+			return
+		}
+		fs.handleWatchEvent(ctx, string(buf[:n]))
+	}
+}
+
+// handleWatchEvent revalidates the cached dentry, if any, of the file at path
+// rel, relative to the root of fs, after the remote file changed.
+func (fs *filesystem) handleWatchEvent(ctx context.Context, rel string) {
+	var ds *[]*dentry
+	fs.renameMu.RLock()
+	defer fs.renameMuRUnlockAndCheckCaching(ctx, &ds)
+
+	vfsObj := fs.vfsfs.VirtualFilesystem()
+	if rel == "." {
+		state := makeRevalidateState(fs.root, true /* refreshStart */)
+		defer state.release()
+		if err := state.doRevalidation(ctx, vfsObj, &ds); err != nil {
+			log.Debugf("gofer.filesystem.handleWatchEvent: revalidating %q: %v", rel, err)
+		}
+		return
+	}
+
+	parent := fs.root
+	names := strings.Split(rel, "/")
+	for _, name := range names[:len(names)-1] {
+		parent.childrenMu.Lock()
+		child := parent.children[name]
+		parent.childrenMu.Unlock()
+		if child == nil {
+			return
+		}
+		parent = child
+	}
+	name := names[len(names)-1]
+	parent.childrenMu.Lock()
+	child, ok := parent.children[name]
+	if ok && child == nil {
+		delete(parent.children, name)
+		parent.negativeChildren--
+	}
+	parent.clearDirentsLocked()
+	parent.childrenMu.Unlock()
+
+	state := makeRevalidateState(parent, true /* refreshStart */)
+	defer state.release()
+	if child != nil {
+		if child.isRegularFile() {
+			// Dirty pages are written back first, so that they aren't
+			// lost if the remote file shrank.
+			child.Evict(ctx, pgalloc.EvictableRange{Start: 0, End: math.MaxUint64})
+		}
+		state.add(child)
+	}
+	if err := state.doRevalidation(ctx, vfsObj, &ds); err != nil {
+		log.Debugf("gofer.filesystem.handleWatchEvent: revalidating %q: %v", rel, err)
+	}
+}
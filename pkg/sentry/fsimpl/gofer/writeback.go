@@ -0,0 +1,245 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gofer
+
+import (
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsmetric"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsutil"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/memmap"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/usage"
+)
+
+// Dirty pages cached for client-cached files are written back to the remote
+// files in the background by a flusher goroutine per filesystem, so that
+// close(2) and fsync(2) don't need to write back everything that was written
+// to the files. The thresholds mirror the Linux vm.dirty_* sysctls.
+const (
+	// writebackInterval is the interval at which the flusher looks for dirty
+	// pages to write back. Compare vm.dirty_writeback_centisecs.
+	writebackInterval = 5 * time.Second
+
+	// dirtyExpireIntervals is the number of writebackIntervals after which
+	// dirty pages are written back. Compare vm.dirty_expire_centisecs.
+	dirtyExpireIntervals = 6
+
+	// dirtyBackgroundRatio is the percentage of total memory that can be
+	// dirty before the flusher writes back all dirty pages. Compare
+	// vm.dirty_background_ratio.
+	dirtyBackgroundRatio = 10
+
+	// dirtyRatio is the percentage of total memory that can be dirty before
+	// writers write back the pages they dirty themselves. Compare
+	// vm.dirty_ratio.
+	dirtyRatio = 20
+)
+
+// dirtyBackgroundBytes and dirtyLimitBytes are the thresholds derived from
+// dirtyBackgroundRatio and dirtyRatio, as last computed by a flusher. They
+// are 0 until a flusher has run.
+var (
+	dirtyBackgroundBytes atomicbitops.Int64
+	dirtyLimitBytes      atomicbitops.Int64
+)
+
+// startFlusher starts the flusher of fs, if it isn't running.
+func (fs *filesystem) startFlusher() {
+	if fs.flusherStarted.Load() != 0 {
+		return
+	}
+	fs.flusherMu.Lock()
+	defer fs.flusherMu.Unlock()
+	if fs.flusherStop != nil || fs.released.Load() != 0 {
+		return
+	}
+	fs.flusherStop = make(chan struct{})
+	fs.flusherKick = make(chan struct{}, 1)
+	fs.flusherStarted.Store(1)
+	go fs.runFlusher(fs.flusherStop, fs.flusherKick) // S/R-SAFE: restarted by the first write after restore.
+}
+
+// stopFlusher stops the flusher of fs, if it's running.
+func (fs *filesystem) stopFlusher() {
+	fs.flusherMu.Lock()
+	defer fs.flusherMu.Unlock()
+	if fs.flusherStop != nil {
+		close(fs.flusherStop)
+		fs.flusherStop = nil
+		fs.flusherKick = nil
+	}
+	fsmetric.GoferDirtyBytes.Add(-fs.dirtyBytes.Swap(0))
+}
+
+// kickFlusher makes the flusher of fs run without waiting for
+// writebackInterval.
+func (fs *filesystem) kickFlusher() {
+	fs.flusherMu.Lock()
+	defer fs.flusherMu.Unlock()
+	if fs.flusherKick == nil {
+		return
+	}
+	select {
+	case fs.flusherKick <- struct{}{}:
+	default:
+	}
+}
+
+func (fs *filesystem) runFlusher(stop, kick <-chan struct{}) {
+	ctx := context.Background()
+	ticker := time.NewTicker(writebackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			fs.flushTick.Add(1)
+		case <-kick:
+		}
+		if fs.vfsfs.Frozen() {
+			// See filesystem.Freeze.
+			continue
+		}
+		fs.flushDirty(ctx)
+	}
+}
+
+// flushDirty writes back the dirty pages of the files of fs that have been
+// dirty for dirtyExpireIntervals, or of all files if the amount of dirty
+// memory exceeds dirtyBackgroundBytes.
+func (fs *filesystem) flushDirty(ctx context.Context) {
+	mf := fs.mfp.MemoryFile()
+	if used, err := mf.TotalUsage(); err == nil {
+		total := int64(usage.TotalMemory(mf.TotalSize(), used))
+		dirtyBackgroundBytes.Store(total * dirtyBackgroundRatio / 100)
+		dirtyLimitBytes.Store(total * dirtyRatio / 100)
+	}
+
+	// Snapshot the dentries that may have cached pages, as in
+	// filesystem.Sync.
+	fs.syncMu.Lock()
+	ds := make([]*dentry, 0, fs.syncableDentries.Len())
+	for elem := fs.syncableDentries.Front(); elem != nil; elem = elem.Next() {
+		ds = append(ds, elem.d)
+	}
+	fs.syncMu.Unlock()
+
+	tick := fs.flushTick.Load() + 1
+	background := fsmetric.GoferDirtyBytes.Load() > dirtyBackgroundBytes.Load()
+	var dirty int64
+	for _, d := range ds {
+		dirty += int64(d.flushDirty(ctx, tick, background))
+	}
+	fsmetric.GoferDirtyBytes.Add(dirty - fs.dirtyBytes.Swap(dirty))
+}
+
+// flushDirty writes back the dirty pages of d if they have been dirty for
+// dirtyExpireIntervals or if force is true. tick is the current tick of the
+// flusher. It returns the number of bytes that are still dirty.
+func (d *dentry) flushDirty(ctx context.Context, tick uint64, force bool) uint64 {
+	d.handleMu.RLock()
+	defer d.handleMu.RUnlock()
+	d.dataMu.Lock()
+	defer d.dataMu.Unlock()
+	dirty := d.dirtyBytesLocked()
+	if dirty == 0 {
+		d.dirtiedTick = 0
+		return 0
+	}
+	if d.dirtiedTick == 0 {
+		// Pages dirtied through memory mappings aren't reported to the
+		// flusher.
+		d.dirtiedTick = tick
+	}
+	if !force && tick-d.dirtiedTick < dirtyExpireIntervals {
+		return dirty
+	}
+	if !d.isWriteHandleOk() {
+		return dirty
+	}
+	h := d.writeHandle()
+	if err := fsutil.SyncDirtyAll(ctx, &d.cache, &d.dirty, d.size.Load(), d.fs.mfp.MemoryFile(), h.writeFromBlocksAt); err != nil {
+		log.Warningf("gofer.dentry.flushDirty: failed to write back dirty pages: %v", err)
+	}
+	// Pages that are mapped writable stay dirty.
+	remaining := d.dirtyBytesLocked()
+	fsmetric.GoferWritebackFlushes.Increment()
+	fsmetric.GoferWritebackBytes.IncrementBy(dirty - remaining)
+	d.dirtiedTick = 0
+	if remaining != 0 {
+		d.dirtiedTick = tick
+	}
+	return remaining
+}
+
+// dirtyBytesLocked returns the number of bytes of d's cache that are dirty.
+//
+// Preconditions: d.dataMu must be locked.
+func (d *dentry) dirtyBytesLocked() uint64 {
+	var n uint64
+	for seg := d.dirty.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		n += seg.Range().Length()
+	}
+	return n
+}
+
+// noteDirtyLocked reports that n bytes in mr were dirtied by a write through
+// handle h. If the amount of dirty memory exceeds dirtyLimitBytes, the write
+// is throttled by writing mr back to the remote file, like Linux's
+// balance_dirty_pages().
+//
+// Preconditions:
+//   - d.handleMu must be locked.
+//   - d.dataMu must be locked.
+func (d *dentry) noteDirtyLocked(ctx context.Context, h handle, mr memmap.MappableRange, n uint64) {
+	fs := d.fs
+	fs.startFlusher()
+	if d.dirtiedTick == 0 {
+		d.dirtiedTick = fs.flushTick.Load() + 1
+	}
+	fs.dirtyBytes.Add(int64(n))
+	total := fsmetric.GoferDirtyBytes.Add(int64(n))
+	if limit := dirtyLimitBytes.Load(); limit != 0 && total > limit {
+		fsmetric.GoferWritebackThrottles.Increment()
+		mf := fs.mfp.MemoryFile()
+		if err := fsutil.SyncDirty(ctx, mr, &d.cache, &d.dirty, d.size.Load(), mf, h.writeFromBlocksAt); err != nil {
+			log.Warningf("gofer.dentry.noteDirtyLocked: failed to write back %v: %v", mr, err)
+			return
+		}
+		fs.dirtyBytes.Add(-int64(n))
+		fsmetric.GoferDirtyBytes.Add(-int64(n))
+		return
+	}
+	if background := dirtyBackgroundBytes.Load(); background != 0 && total > background {
+		fs.kickFlusher()
+	}
+}
+
+// Freeze implements vfs.FilesystemFreezer.Freeze. Since writes to fs have been
+// quiesced, writing back all dirty pages leaves the remote files consistent
+// until Thaw; the flusher doesn't run in between.
+func (fs *filesystem) Freeze(ctx context.Context) error {
+	return fs.Sync(ctx)
+}
+
+// Thaw implements vfs.FilesystemFreezer.Thaw. Pages dirtied through memory
+// mappings while fs was frozen are written back right away.
+func (fs *filesystem) Thaw(ctx context.Context) {
+	fs.kickFlusher()
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/fdaudit"
 	"github.com/talismancer/gvisor-ligolo/pkg/fdnotifier"
 	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
 	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
@@ -44,6 +45,9 @@ import (
 	"golang.org/x/sys/unix"
 )
 
+// hostFDs tracks the host FDs of inodes, see fdaudit.
+var hostFDs = fdaudit.NewOwner("hostfs")
+
 // These are the modes that are stored with virtualOwner.
 const virtualOwnerModes = linux.STATX_MODE | linux.STATX_UID | linux.STATX_GID
 
@@ -201,6 +205,7 @@ func newInode(ctx context.Context, fs *filesystem, hostFD int, savable bool, fil
 			return nil, err
 		}
 	}
+	hostFDs.Add(hostFD)
 	return i, nil
 }
 
@@ -615,6 +620,7 @@ func (i *inode) DecRef(ctx context.Context) {
 		if i.epollable {
 			fdnotifier.RemoveFD(int32(i.hostFD))
 		}
+		hostFDs.Remove(i.hostFD)
 		if err := unix.Close(i.hostFD); err != nil {
 			log.Warningf("failed to close host fd %d: %v", i.hostFD, err)
 		}
@@ -68,6 +68,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
 	"github.com/talismancer/gvisor-ligolo/pkg/refs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/usage"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 )
@@ -374,16 +375,17 @@ func (d *Dentry) cacheLocked(ctx context.Context) {
 		return
 	}
 	// Cache the dentry, then evict the least recently used cached dentry if
-	// the cache becomes over-full.
+	// the cache becomes over-full, or to keep it from growing while the
+	// sentry's memory is over limit.
 	d.fs.cachedDentries.PushFront(d)
 	d.fs.cachedDentriesLen++
 	d.cached = true
-	if d.fs.cachedDentriesLen <= d.fs.MaxCachedDentries {
+	if d.fs.cachedDentriesLen <= d.fs.MaxCachedDentries && !usage.SentryMemoryOverLimit() {
 		return
 	}
 	d.fs.evictCachedDentryLocked(ctx)
 	// Whether or not victim was destroyed, we brought fs.cachedDentriesLen
-	// back down to fs.opts.maxCachedDentries, so we don't loop.
+	// back down to at most fs.opts.maxCachedDentries, so we don't loop.
 }
 
 // Preconditions:
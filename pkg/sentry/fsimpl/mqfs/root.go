@@ -73,6 +73,16 @@ func (i *rootInode) Rename(ctx context.Context, oldname, newname string, child,
 	return linuxerr.EPERM
 }
 
+// Unlink implements Inode.Unlink and overrides OrderedChildren.Unlink to
+// release the resources charged for the unlinked queue.
+func (i *rootInode) Unlink(ctx context.Context, name string, child kernfs.Inode) error {
+	if err := i.OrderedChildren.Unlink(ctx, name, child); err != nil {
+		return err
+	}
+	child.(*queueInode).queue.Unlinked()
+	return nil
+}
+
 // SetStat implements kernfs.Inode.SetStat not allowing inode attributes to be changed.
 func (*rootInode) SetStat(context.Context, *vfs.Filesystem, *auth.Credentials, vfs.SetStatOptions) error {
 	return linuxerr.EPERM
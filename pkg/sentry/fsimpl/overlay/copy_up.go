@@ -31,6 +31,16 @@ func (d *dentry) isCopiedUp() bool {
 	return d.copiedUp.Load() != 0
 }
 
+func (d *dentry) isMetacopy() bool {
+	return d.metacopy.Load() != 0
+}
+
+// isDataCopiedUp returns true if d's data, and not just its metadata, has been
+// copied-up.
+func (d *dentry) isDataCopiedUp() bool {
+	return d.isCopiedUp() && !d.isMetacopy()
+}
+
 func (d *dentry) canBeCopiedUp() bool {
 	ftype := d.mode.Load() & linux.S_IFMT
 	switch ftype {
@@ -43,16 +53,41 @@ func (d *dentry) canBeCopiedUp() bool {
 	}
 }
 
-// copyUpLocked ensures that d exists on the upper layer, i.e. d.upperVD.Ok().
+// copyUpLocked ensures that d exists on the upper layer, i.e. d.upperVD.Ok(),
+// along with its data.
 //
 // Preconditions: filesystem.renameMu must be locked.
 func (d *dentry) copyUpLocked(ctx context.Context) error {
-	return d.copyUpMaybeSyntheticMountpointLocked(ctx, false /* forSyntheticMountpoint */)
+	return d.copyUpInternalLocked(ctx, false /* forSyntheticMountpoint */, false /* metadataOnly */)
+}
+
+// copyUpMetadataLocked is like copyUpLocked, but if d is a regular file and
+// FilesystemOptions.MetaCopy is set, d's data isn't copied-up. It must only be
+// used by operations that don't change d's data.
+//
+// Preconditions: filesystem.renameMu must be locked.
+func (d *dentry) copyUpMetadataLocked(ctx context.Context) error {
+	return d.copyUpInternalLocked(ctx, false /* forSyntheticMountpoint */, d.fs.opts.MetaCopy)
+}
+
+// copyUpForSetStatLocked copies up d as required to apply opts, which only
+// requires d's data if d's size is changed.
+//
+// Preconditions: filesystem.renameMu must be locked.
+func (d *dentry) copyUpForSetStatLocked(ctx context.Context, opts *vfs.SetStatOptions) error {
+	if opts.Stat.Mask&linux.STATX_SIZE != 0 {
+		return d.copyUpLocked(ctx)
+	}
+	return d.copyUpMetadataLocked(ctx)
 }
 
 func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSyntheticMountpoint bool) error {
+	return d.copyUpInternalLocked(ctx, forSyntheticMountpoint, false /* metadataOnly */)
+}
+
+func (d *dentry) copyUpInternalLocked(ctx context.Context, forSyntheticMountpoint, metadataOnly bool) error {
 	// Fast path.
-	if d.isCopiedUp() {
+	if d.isCopiedUp() && (metadataOnly || !d.isMetacopy()) {
 		return nil
 	}
 
@@ -76,8 +111,11 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 	d.copyMu.Lock()
 	defer d.copyMu.Unlock()
 	if d.upperVD.Ok() {
-		// Raced with another call to d.copyUpLocked().
-		return nil
+		if metadataOnly || !d.isMetacopy() {
+			// Raced with another call to d.copyUpLocked().
+			return nil
+		}
+		return d.copyUpDataLocked(ctx)
 	}
 	if d.vfsd.IsDead() {
 		// Raced with deletion of d.
@@ -91,8 +129,13 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 		Start: d.lowerVDs[0],
 	}
 	const timestampsMask = linux.STATX_ATIME | linux.STATX_MTIME
+	statMask := uint32(timestampsMask)
+	if metadataOnly {
+		// The size of the file is needed to create a metacopy.
+		statMask |= linux.STATX_SIZE
+	}
 	oldStat, err := vfsObj.StatAt(ctx, d.fs.creds, &oldpop, &vfs.StatOptions{
-		Mask: timestampsMask,
+		Mask: statMask,
 	})
 	if err != nil {
 		return err
@@ -107,6 +150,8 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 	}
 	// Used during copy-up of memory-mapped regular files.
 	var mmapOpts *memmap.MMapOpts
+	// Set if only the metadata of a regular file is copied-up.
+	metacopy := false
 	cleanupUndoCopyUp := func() {
 		var err error
 		if ftype == linux.S_IFDIR {
@@ -124,13 +169,6 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 	}
 	switch ftype {
 	case linux.S_IFREG:
-		oldFD, err := vfsObj.OpenAt(ctx, d.fs.creds, &oldpop, &vfs.OpenOptions{
-			Flags: linux.O_RDONLY,
-		})
-		if err != nil {
-			return err
-		}
-		defer oldFD.DecRef(ctx)
 		newFD, err := vfsObj.OpenAt(ctx, d.fs.creds, &newpop, &vfs.OpenOptions{
 			Flags: linux.O_WRONLY | linux.O_CREAT | linux.O_EXCL,
 			// d.mode can be read because d.copyMu is locked.
@@ -140,28 +178,26 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 			return err
 		}
 		defer newFD.DecRef(ctx)
-		if _, err := vfs.CopyRegularFileData(ctx, newFD, oldFD); err != nil {
-			cleanupUndoCopyUp()
-			return err
-		}
-		if d.wrappedMappable != nil {
-			// We may have memory mappings of the file on the lower layer.
-			// Switch to mapping the file on the upper layer instead.
-			mmapOpts = &memmap.MMapOpts{
-				Perms:    hostarch.ReadWrite,
-				MaxPerms: hostarch.ReadWrite,
-			}
-			if err := newFD.ConfigureMMap(ctx, mmapOpts); err != nil {
+		if metadataOnly && oldStat.Mask&linux.STATX_SIZE != 0 {
+			// Mark the upper layer file as a metacopy, so that lookups find
+			// its data on the lower layer. If the upper layer doesn't support
+			// this, fall back to copying up the data.
+			err := newFD.SetXattr(ctx, &vfs.SetXattrOptions{
+				Name: _OVL_XATTR_METACOPY,
+			})
+			if err != nil && !linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
 				cleanupUndoCopyUp()
 				return err
 			}
-			if mmapOpts.MappingIdentity != nil {
-				mmapOpts.MappingIdentity.DecRef(ctx)
+			metacopy = err == nil
+		}
+		if !metacopy {
+			if err := d.copyDataLocked(ctx, &oldpop, newFD, &mmapOpts); err != nil {
+				cleanupUndoCopyUp()
+				return err
 			}
-			// Don't actually switch Mappables until the end of copy-up; see
-			// below for why.
 		}
-		if err := newFD.SetStat(ctx, vfs.SetStatOptions{
+		setStatOpts := vfs.SetStatOptions{
 			Stat: linux.Statx{
 				Mask: linux.STATX_UID | linux.STATX_GID | oldStat.Mask&timestampsMask,
 				// d.uid and d.gid can be read because d.copyMu is locked.
@@ -170,7 +206,14 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 				Atime: oldStat.Atime,
 				Mtime: oldStat.Mtime,
 			},
-		}); err != nil {
+		}
+		if metacopy {
+			// The upper layer file reports the size of the data on the lower
+			// layer, without allocating it.
+			setStatOpts.Stat.Mask |= linux.STATX_SIZE
+			setStatOpts.Stat.Size = oldStat.Size
+		}
+		if err := newFD.SetStat(ctx, setStatOpts); err != nil {
 			cleanupUndoCopyUp()
 			return err
 		}
@@ -295,70 +338,185 @@ func (d *dentry) copyUpMaybeSyntheticMountpointLocked(ctx context.Context, forSy
 		d.ino.Store(upperStat.Ino)
 
 		// Lower level dentries for non-directories are no longer accessible from
-		// the overlayfs anymore after copyup. Ask filesystems to release their
-		// resources whenever possible.
-		for _, lowerDentry := range d.lowerVDs {
-			lowerDentry.Dentry().MarkEvictable()
+		// the overlayfs anymore after copyup, unless they still hold the data
+		// of a metacopy. Ask filesystems to release their resources whenever
+		// possible.
+		if !metacopy {
+			for _, lowerDentry := range d.lowerVDs {
+				lowerDentry.Dentry().MarkEvictable()
+			}
 		}
 	}
 
 	if mmapOpts != nil && mmapOpts.Mappable != nil {
 		d.mapsMu.Lock()
 		defer d.mapsMu.Unlock()
+		if err := d.switchMappableLocked(ctx, mmapOpts.Mappable); err != nil {
+			return err
+		}
+	}
 
-		// Propagate mappings of d to the new Mappable. Remember which mappings
-		// we added so we can remove them on failure.
-		upperMappable := mmapOpts.Mappable
-		allAdded := make(map[memmap.MappableRange]memmap.MappingsOfRange)
-		for seg := d.lowerMappings.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
-			added := make(memmap.MappingsOfRange)
-			for m := range seg.Value() {
-				if err := upperMappable.AddMapping(ctx, m.MappingSpace, m.AddrRange, seg.Start(), m.Writable); err != nil {
-					for m := range added {
-						upperMappable.RemoveMapping(ctx, m.MappingSpace, m.AddrRange, seg.Start(), m.Writable)
-					}
-					for mr, mappings := range allAdded {
-						for m := range mappings {
-							upperMappable.RemoveMapping(ctx, m.MappingSpace, m.AddrRange, mr.Start, m.Writable)
-						}
+	if metacopy {
+		d.metacopy.Store(1)
+	}
+	d.copiedUp.Store(1)
+	return nil
+}
+
+// copyDataLocked copies the data of the regular file at oldpop, on a lower
+// layer, to newFD, on the upper layer. If d has a Mappable, copyDataLocked
+// configures *mmapOpts with the Mappable of newFD, which the caller must
+// switch to with switchMappableLocked.
+//
+// Preconditions: d.copyMu must be locked for writing.
+func (d *dentry) copyDataLocked(ctx context.Context, oldpop *vfs.PathOperation, newFD *vfs.FileDescription, mmapOpts **memmap.MMapOpts) error {
+	oldFD, err := d.fs.vfsfs.VirtualFilesystem().OpenAt(ctx, d.fs.creds, oldpop, &vfs.OpenOptions{
+		Flags: linux.O_RDONLY,
+	})
+	if err != nil {
+		return err
+	}
+	defer oldFD.DecRef(ctx)
+	if _, err := vfs.CopyRegularFileData(ctx, newFD, oldFD); err != nil {
+		return err
+	}
+	if d.wrappedMappable != nil {
+		// We may have memory mappings of the file on the lower layer.
+		// Switch to mapping the file on the upper layer instead.
+		opts := &memmap.MMapOpts{
+			Perms:    hostarch.ReadWrite,
+			MaxPerms: hostarch.ReadWrite,
+		}
+		if err := newFD.ConfigureMMap(ctx, opts); err != nil {
+			return err
+		}
+		if opts.MappingIdentity != nil {
+			opts.MappingIdentity.DecRef(ctx)
+		}
+		// Don't actually switch Mappables until the end of copy-up; see
+		// switchMappableLocked for why.
+		*mmapOpts = opts
+	}
+	return nil
+}
+
+// copyUpDataLocked copies up the data of d, whose metadata has already been
+// copied-up, into its upper layer file.
+//
+// Preconditions:
+//   - d.copyMu must be locked for writing.
+//   - d.isMetacopy().
+func (d *dentry) copyUpDataLocked(ctx context.Context) error {
+	vfsObj := d.fs.vfsfs.VirtualFilesystem()
+	oldpop := vfs.PathOperation{
+		Root:  d.lowerVDs[0],
+		Start: d.lowerVDs[0],
+	}
+	newpop := vfs.PathOperation{
+		Root:  d.upperVD,
+		Start: d.upperVD,
+	}
+	// Writing the data changes the timestamps of the upper layer file, which
+	// reflect changes to d's metadata; restore them afterwards.
+	const timestampsMask = linux.STATX_ATIME | linux.STATX_MTIME
+	upperStat, err := vfsObj.StatAt(ctx, d.fs.creds, &newpop, &vfs.StatOptions{
+		Mask: timestampsMask,
+	})
+	if err != nil {
+		return err
+	}
+	newFD, err := vfsObj.OpenAt(ctx, d.fs.creds, &newpop, &vfs.OpenOptions{
+		Flags: linux.O_WRONLY,
+	})
+	if err != nil {
+		return err
+	}
+	defer newFD.DecRef(ctx)
+	var mmapOpts *memmap.MMapOpts
+	if err := d.copyDataLocked(ctx, &oldpop, newFD, &mmapOpts); err != nil {
+		return err
+	}
+	if err := newFD.SetStat(ctx, vfs.SetStatOptions{
+		Stat: linux.Statx{
+			Mask:  upperStat.Mask & timestampsMask,
+			Atime: upperStat.Atime,
+			Mtime: upperStat.Mtime,
+		},
+	}); err != nil {
+		return err
+	}
+	if err := newFD.RemoveXattr(ctx, _OVL_XATTR_METACOPY); err != nil {
+		return err
+	}
+
+	d.mapsMu.Lock()
+	defer d.mapsMu.Unlock()
+	if mmapOpts != nil && mmapOpts.Mappable != nil {
+		if err := d.switchMappableLocked(ctx, mmapOpts.Mappable); err != nil {
+			return err
+		}
+	}
+	d.metacopy.Store(0)
+	for _, lowerDentry := range d.lowerVDs {
+		lowerDentry.Dentry().MarkEvictable()
+	}
+	return nil
+}
+
+// switchMappableLocked switches the Mappable of d, a regular file on a lower
+// layer, to upperMappable, the Mappable of its copied-up data.
+//
+// Preconditions: d.mapsMu must be locked.
+func (d *dentry) switchMappableLocked(ctx context.Context, upperMappable memmap.Mappable) error {
+	// Propagate mappings of d to the new Mappable. Remember which mappings
+	// we added so we can remove them on failure.
+	allAdded := make(map[memmap.MappableRange]memmap.MappingsOfRange)
+	for seg := d.lowerMappings.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		added := make(memmap.MappingsOfRange)
+		for m := range seg.Value() {
+			if err := upperMappable.AddMapping(ctx, m.MappingSpace, m.AddrRange, seg.Start(), m.Writable); err != nil {
+				for m := range added {
+					upperMappable.RemoveMapping(ctx, m.MappingSpace, m.AddrRange, seg.Start(), m.Writable)
+				}
+				for mr, mappings := range allAdded {
+					for m := range mappings {
+						upperMappable.RemoveMapping(ctx, m.MappingSpace, m.AddrRange, mr.Start, m.Writable)
 					}
-					return err
 				}
-				added[m] = struct{}{}
-			}
-			allAdded[seg.Range()] = added
-		}
-
-		// Switch to the new Mappable. We do this at the end of copy-up
-		// because:
-		//
-		//	- We need to switch Mappables (by changing d.wrappedMappable) before
-		//		invalidating Translations from the old Mappable (to pick up
-		//		Translations from the new one).
-		//
-		//	- We need to lock d.dataMu while changing d.wrappedMappable, but
-		//		must invalidate Translations with d.dataMu unlocked (due to lock
-		//		ordering).
-		//
-		//	- Consequently, once we unlock d.dataMu, other threads may
-		//		immediately observe the new (copied-up) Mappable, which we want to
-		//		delay until copy-up is guaranteed to succeed.
-		d.dataMu.Lock()
-		lowerMappable := d.wrappedMappable
-		d.wrappedMappable = upperMappable
-		d.dataMu.Unlock()
-		d.lowerMappings.InvalidateAll(memmap.InvalidateOpts{})
-
-		// Remove mappings from the old Mappable.
-		for seg := d.lowerMappings.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
-			for m := range seg.Value() {
-				lowerMappable.RemoveMapping(ctx, m.MappingSpace, m.AddrRange, seg.Start(), m.Writable)
+				return err
 			}
+			added[m] = struct{}{}
 		}
-		d.lowerMappings.RemoveAll()
+		allAdded[seg.Range()] = added
 	}
 
-	d.copiedUp.Store(1)
+	// Switch to the new Mappable. We do this at the end of copy-up
+	// because:
+	//
+	//	- We need to switch Mappables (by changing d.wrappedMappable) before
+	//		invalidating Translations from the old Mappable (to pick up
+	//		Translations from the new one).
+	//
+	//	- We need to lock d.dataMu while changing d.wrappedMappable, but
+	//		must invalidate Translations with d.dataMu unlocked (due to lock
+	//		ordering).
+	//
+	//	- Consequently, once we unlock d.dataMu, other threads may
+	//		immediately observe the new (copied-up) Mappable, which we want to
+	//		delay until copy-up is guaranteed to succeed.
+	d.dataMu.Lock()
+	lowerMappable := d.wrappedMappable
+	d.wrappedMappable = upperMappable
+	d.dataMu.Unlock()
+	d.lowerMappings.InvalidateAll(memmap.InvalidateOpts{})
+
+	// Remove mappings from the old Mappable.
+	for seg := d.lowerMappings.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		for m := range seg.Value() {
+			lowerMappable.RemoveMapping(ctx, m.MappingSpace, m.AddrRange, seg.Start(), m.Writable)
+		}
+	}
+	d.lowerMappings.RemoveAll()
 	return nil
 }
 
@@ -0,0 +1,309 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package overlay
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"sort"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
+)
+
+// Whiteouts in OCI image layers are represented by empty files whose names
+// have these prefixes. See
+// https://github.com/opencontainers/image-spec/blob/main/layer.md#whiteouts.
+const (
+	ociWhiteoutPrefix = ".wh."
+	ociOpaqueWhiteout = ociWhiteoutPrefix + ociWhiteoutPrefix + ".opq"
+)
+
+// ExportUpperLayer writes the changes made to the overlay filesystem rooted at
+// root, i.e. the files on its upper layer, to w as a tar archive in the format
+// of OCI image layers: whiteouts are written as files with the ".wh." prefix,
+// and opaque directories contain a ".wh..wh..opq" file. The data and
+// attributes of files are read through the overlay, so files copied-up with
+// FilesystemOptions.MetaCopy are exported in full, and renamed directories
+// recorded with FilesystemOptions.RedirectDir are exported as opaque
+// directories with all of their contents.
+//
+// Files that are modified while they are exported may be inconsistent in the
+// archive, or fail the export; callers should pause the overlay's users.
+func ExportUpperLayer(ctx context.Context, creds *auth.Credentials, root vfs.VirtualDentry, w io.Writer) error {
+	fs, ok := root.Mount().Filesystem().Impl().(*filesystem)
+	if !ok || root.Dentry().Impl().(*dentry).parent != nil {
+		return linuxerr.EINVAL
+	}
+	tw := tar.NewWriter(w)
+	if fs.opts.UpperRoot.Ok() {
+		e := exporter{
+			ctx:    ctx,
+			creds:  creds,
+			vfsObj: fs.vfsfs.VirtualFilesystem(),
+			fs:     fs,
+			root:   root,
+			tw:     tw,
+			links:  make(map[layerDevNoAndIno]string),
+		}
+		if err := e.exportDir("", false /* merged */); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+type exporter struct {
+	ctx    context.Context
+	creds  *auth.Credentials
+	vfsObj *vfs.VirtualFilesystem
+	fs     *filesystem
+
+	// root is the root of the overlay.
+	root vfs.VirtualDentry
+
+	tw *tar.Writer
+
+	// links maps the device and inode numbers of regular files with multiple
+	// links to the first path at which they were exported.
+	links map[layerDevNoAndIno]string
+}
+
+func (e *exporter) pop(vd vfs.VirtualDentry, p string) *vfs.PathOperation {
+	return &vfs.PathOperation{
+		Root:  vd,
+		Start: vd,
+		Path:  fspath.Parse(p),
+	}
+}
+
+// exportDir exports the files in directory p. If merged is false, only the
+// files in p on the upper layer are exported; otherwise, all files in p in the
+// overlay are.
+func (e *exporter) exportDir(p string, merged bool) error {
+	listVD := e.fs.opts.UpperRoot
+	if merged {
+		listVD = e.root
+	}
+	fd, err := e.vfsObj.OpenAt(e.ctx, e.creds, e.pop(listVD, p), &vfs.OpenOptions{
+		Flags: linux.O_RDONLY | linux.O_DIRECTORY,
+	})
+	if err != nil {
+		return err
+	}
+	var names []string
+	for {
+		n := len(names)
+		err := fd.IterDirents(e.ctx, vfs.IterDirentsCallbackFunc(func(dirent vfs.Dirent) error {
+			if dirent.Name != "." && dirent.Name != ".." {
+				names = append(names, dirent.Name)
+			}
+			return nil
+		}))
+		if err != nil {
+			fd.DecRef(e.ctx)
+			return err
+		}
+		if len(names) == n {
+			break
+		}
+	}
+	fd.DecRef(e.ctx)
+
+	// Export files in a stable order.
+	sort.Strings(names)
+	for _, name := range names {
+		if err := e.exportFile(path.Join(p, name), merged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportFile exports the file at p, as for exportDir.
+func (e *exporter) exportFile(p string, merged bool) error {
+	if !merged {
+		upperStat, err := e.vfsObj.StatAt(e.ctx, e.creds, e.pop(e.fs.opts.UpperRoot, p), &vfs.StatOptions{
+			Mask: linux.STATX_TYPE,
+		})
+		if err != nil {
+			return err
+		}
+		if isWhiteout(&upperStat) {
+			return e.writeWhiteout(path.Join(path.Dir(p), ociWhiteoutPrefix+path.Base(p)))
+		}
+	}
+
+	pop := e.pop(e.root, p)
+	stat, err := e.vfsObj.StatAt(e.ctx, e.creds, pop, &vfs.StatOptions{
+		Mask: linux.STATX_BASIC_STATS,
+	})
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{
+		Name:    p,
+		Mode:    int64(stat.Mode &^ linux.S_IFMT),
+		Uid:     int(stat.UID),
+		Gid:     int(stat.GID),
+		ModTime: stat.Mtime.ToTime(),
+	}
+	switch stat.Mode & linux.S_IFMT {
+	case linux.S_IFDIR:
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case linux.S_IFREG:
+		if stat.Nlink > 1 {
+			key := layerDevNoAndIno{
+				layerDevNumber: layerDevNumber{major: stat.DevMajor, minor: stat.DevMinor},
+				ino:            stat.Ino,
+			}
+			if target, ok := e.links[key]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = target
+				return e.tw.WriteHeader(hdr)
+			}
+			e.links[key] = p
+		}
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = int64(stat.Size)
+	case linux.S_IFLNK:
+		target, err := e.vfsObj.ReadlinkAt(e.ctx, e.creds, pop)
+		if err != nil {
+			return err
+		}
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = target
+	case linux.S_IFCHR, linux.S_IFBLK:
+		hdr.Typeflag = tar.TypeChar
+		if stat.Mode&linux.S_IFMT == linux.S_IFBLK {
+			hdr.Typeflag = tar.TypeBlock
+		}
+		hdr.Devmajor = int64(stat.RdevMajor)
+		hdr.Devminor = int64(stat.RdevMinor)
+	case linux.S_IFIFO:
+		hdr.Typeflag = tar.TypeFifo
+	default:
+		// Like tar(1), skip sockets.
+		return nil
+	}
+	if err := e.addXattrs(hdr, pop); err != nil {
+		return err
+	}
+	if err := e.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		return e.writeData(pop, hdr.Size)
+	case tar.TypeDir:
+		redirected := false
+		if !merged {
+			upperPop := e.pop(e.fs.opts.UpperRoot, p)
+			opaque, err := e.vfsObj.GetXattrAt(e.ctx, e.fs.creds, upperPop, &vfs.GetXattrOptions{
+				Name: _OVL_XATTR_OPAQUE,
+				Size: 1,
+			})
+			if err == nil && opaque == "y" {
+				if err := e.writeWhiteout(path.Join(p, ociOpaqueWhiteout)); err != nil {
+					return err
+				}
+			} else if e.fs.opts.RedirectDir {
+				// OCI image layers can't represent renamed directories, so
+				// export them as opaque directories with all of their files.
+				redirect, err := e.vfsObj.GetXattrAt(e.ctx, e.fs.creds, upperPop, &vfs.GetXattrOptions{
+					Name: _OVL_XATTR_REDIRECT,
+				})
+				if redirected = err == nil && redirect != ""; redirected {
+					if err := e.writeWhiteout(path.Join(p, ociOpaqueWhiteout)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return e.exportDir(p, merged || redirected)
+	}
+	return nil
+}
+
+// addXattrs adds the extended attributes of the file at pop to hdr.
+func (e *exporter) addXattrs(hdr *tar.Header, pop *vfs.PathOperation) error {
+	names, err := e.vfsObj.ListXattrAt(e.ctx, e.creds, pop, 0)
+	if err != nil {
+		if linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
+			return nil
+		}
+		return err
+	}
+	for _, name := range names {
+		value, err := e.vfsObj.GetXattrAt(e.ctx, e.creds, pop, &vfs.GetXattrOptions{Name: name})
+		if err != nil {
+			return err
+		}
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string)
+		}
+		hdr.PAXRecords["SCHILY.xattr."+name] = value
+	}
+	return nil
+}
+
+// writeData writes the size bytes of data of the regular file at pop.
+func (e *exporter) writeData(pop *vfs.PathOperation, size int64) error {
+	fd, err := e.vfsObj.OpenAt(e.ctx, e.creds, pop, &vfs.OpenOptions{
+		Flags: linux.O_RDONLY,
+	})
+	if err != nil {
+		return err
+	}
+	defer fd.DecRef(e.ctx)
+	buf := make([]byte, 32*1024) // arbitrary buffer size
+	for size > 0 {
+		if int64(len(buf)) > size {
+			buf = buf[:size]
+		}
+		n, err := fd.Read(e.ctx, usermem.BytesIOSequence(buf), vfs.ReadOptions{})
+		if n > 0 {
+			if _, err := e.tw.Write(buf[:n]); err != nil {
+				return err
+			}
+			size -= n
+		}
+		if err == io.EOF {
+			// The file was truncated after it was stat'ed.
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWhiteout writes the empty file that represents a whiteout at p.
+func (e *exporter) writeWhiteout(p string) error {
+	return e.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     p,
+		Mode:     0644,
+	})
+}
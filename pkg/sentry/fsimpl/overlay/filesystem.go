@@ -40,6 +40,17 @@ const _OVL_XATTR_PREFIX = linux.XATTR_TRUSTED_PREFIX + "overlay."
 // Linux: fs/overlayfs/overlayfs.h:OVL_XATTR_OPAQUE
 const _OVL_XATTR_OPAQUE = _OVL_XATTR_PREFIX + "opaque"
 
+// _OVL_XATTR_METACOPY is an extended attribute key that is set on regular files
+// whose data hasn't been copied-up.
+// Linux: fs/overlayfs/overlayfs.h:OVL_XATTR_METACOPY
+const _OVL_XATTR_METACOPY = _OVL_XATTR_PREFIX + "metacopy"
+
+// _OVL_XATTR_REDIRECT is an extended attribute key whose value is the path,
+// relative to the roots of lower layers, of the lower layers of a renamed
+// directory.
+// Linux: fs/overlayfs/overlayfs.h:OVL_XATTR_REDIRECT
+const _OVL_XATTR_REDIRECT = _OVL_XATTR_PREFIX + "redirect"
+
 func isWhiteout(stat *linux.Statx) bool {
 	return stat.Mode&linux.S_IFMT == linux.S_IFCHR && stat.RdevMajor == 0 && stat.RdevMinor == 0
 }
@@ -212,20 +223,9 @@ func (fs *filesystem) lookupLocked(ctx context.Context, parent *dentry, name str
 	var lookupErr error
 
 	vfsObj := fs.vfsfs.VirtualFilesystem()
-	parent.iterLayers(func(parentVD vfs.VirtualDentry, isUpper bool) bool {
-		childVD, err := vfsObj.GetDentryAt(ctx, fs.creds, &vfs.PathOperation{
-			Root:  parentVD,
-			Start: parentVD,
-			Path:  childPath,
-		}, &vfs.GetDentryOptions{})
-		if linuxerr.Equals(linuxerr.ENOENT, err) || linuxerr.Equals(linuxerr.ENAMETOOLONG, err) {
-			// The file doesn't exist on this layer. Proceed to the next one.
-			return true
-		}
-		if err != nil {
-			lookupErr = err
-			return false
-		}
+	// addLayer updates child to include childVD, the file on the next layer,
+	// and returns true if lower layers should be included as well.
+	addLayer := func(childVD vfs.VirtualDentry, isUpper bool) bool {
 		defer childVD.DecRef(ctx)
 
 		mask := uint32(linux.STATX_TYPE)
@@ -257,6 +257,15 @@ func (fs *filesystem) lookupLocked(ctx context.Context, parent *dentry, name str
 			}
 			return false
 		}
+		if child.metacopy.RacyLoad() != 0 {
+			// The topmost lower layer file holds the data of the metacopy on
+			// the upper layer, if it's a regular file.
+			if stat.Mode&linux.S_IFMT == linux.S_IFREG {
+				childVD.IncRef()
+				child.lowerVDs = append(child.lowerVDs, childVD)
+			}
+			return false
+		}
 		isDir := stat.Mode&linux.S_IFMT == linux.S_IFDIR
 		if topLookupLayer != lookupLayerNone && !isDir {
 			// Directories are not merged with non-directory files from lower
@@ -290,8 +299,19 @@ func (fs *filesystem) lookupLocked(ctx context.Context, parent *dentry, name str
 		}
 
 		// For non-directory files, only the topmost layer that contains a file
-		// matters.
+		// matters, unless it's a metacopy.
 		if !isDir {
+			if isUpper && fs.opts.MetaCopy && stat.Mode&linux.S_IFMT == linux.S_IFREG {
+				if _, err := vfsObj.GetXattrAt(ctx, fs.creds, &vfs.PathOperation{
+					Root:  childVD,
+					Start: childVD,
+				}, &vfs.GetXattrOptions{
+					Name: _OVL_XATTR_METACOPY,
+				}); err == nil {
+					child.metacopy = atomicbitops.FromUint32(1)
+					return true
+				}
+			}
 			return false
 		}
 
@@ -311,8 +331,66 @@ func (fs *filesystem) lookupLocked(ctx context.Context, parent *dentry, name str
 			Name: _OVL_XATTR_OPAQUE,
 			Size: 1,
 		})
-		return !(err == nil && opaqueVal == "y")
+		if err == nil && opaqueVal == "y" {
+			return false
+		}
+		if isUpper && fs.opts.RedirectDir {
+			// A renamed directory is merged with the directories at its
+			// original path on lower layers, rather than at its name in
+			// parent; see below.
+			redirect, err := vfsObj.GetXattrAt(ctx, fs.creds, &vfs.PathOperation{
+				Root:  childVD,
+				Start: childVD,
+			}, &vfs.GetXattrOptions{
+				Name: _OVL_XATTR_REDIRECT,
+			})
+			if err == nil && redirect != "" {
+				child.redirect = redirect
+				return false
+			}
+		}
+		return true
+	}
+	parent.iterLayers(func(parentVD vfs.VirtualDentry, isUpper bool) bool {
+		childVD, err := vfsObj.GetDentryAt(ctx, fs.creds, &vfs.PathOperation{
+			Root:  parentVD,
+			Start: parentVD,
+			Path:  childPath,
+		}, &vfs.GetDentryOptions{})
+		if linuxerr.Equals(linuxerr.ENOENT, err) || linuxerr.Equals(linuxerr.ENAMETOOLONG, err) {
+			// The file doesn't exist on this layer. Proceed to the next one.
+			return true
+		}
+		if err != nil {
+			lookupErr = err
+			return false
+		}
+		return addLayer(childVD, isUpper)
 	})
+	if lookupErr == nil && child.redirect != "" {
+		redirectPath := fspath.Parse(child.redirect)
+		for _, lowerRoot := range fs.opts.LowerRoots {
+			childVD, err := vfsObj.GetDentryAt(ctx, fs.creds, &vfs.PathOperation{
+				Root:  lowerRoot,
+				Start: lowerRoot,
+				Path:  redirectPath,
+			}, &vfs.GetDentryOptions{})
+			if linuxerr.Equals(linuxerr.ENOENT, err) || linuxerr.Equals(linuxerr.ENAMETOOLONG, err) {
+				continue
+			}
+			if err != nil {
+				lookupErr = err
+				break
+			}
+			if !addLayer(childVD, false /* isUpper */) {
+				break
+			}
+		}
+	}
+	if lookupErr == nil && child.metacopy.RacyLoad() != 0 && len(child.lowerVDs) == 0 {
+		ctx.Infof("overlay.filesystem.lookupLocked: no lower layer holds the data of metacopy %q", name)
+		lookupErr = linuxerr.EIO
+	}
 
 	if lookupErr != nil {
 		child.destroyLocked(ctx)
@@ -956,7 +1034,7 @@ func (d *dentry) openCopiedUp(ctx context.Context, rp *vfs.ResolvingPath, opts *
 		return &fd.vfsfd, nil
 	}
 
-	layerVD, isUpper := d.topLayerInfo()
+	layerVD, isUpper := d.dataLayerInfo()
 	layerFD, err := rp.VirtualFilesystem().OpenAt(ctx, d.fs.creds, &vfs.PathOperation{
 		Root:  layerVD,
 		Start: layerVD,
@@ -1205,14 +1283,31 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 		return nil
 	}
 
+	// If renamed is a directory that exists on lower layers, it needs to
+	// either record where its lower layers are, or be made opaque after all
+	// of its descendants are copied-up.
+	redirect := ""
+	if renamed.isDir() && len(renamed.lowerVDs) != 0 && fs.opts.RedirectDir {
+		redirect = renamed.lowerPathLocked()
+	}
 	// renamed and oldParent need to be copied-up before they're renamed on the
 	// upper layer.
 	if err := renamed.copyUpLocked(ctx); err != nil {
 		return err
 	}
-	// If renamed is a directory, all of its descendants need to be copied-up
-	// before they're renamed on the upper layer.
-	if renamed.isDir() {
+	if redirect != "" {
+		if err := rp.VirtualFilesystem().SetXattrAt(ctx, fs.creds, &vfs.PathOperation{
+			Root:  renamed.upperVD,
+			Start: renamed.upperVD,
+		}, &vfs.SetXattrOptions{
+			Name:  _OVL_XATTR_REDIRECT,
+			Value: redirect,
+		}); err != nil {
+			return err
+		}
+	} else if renamed.isDir() {
+		// All of renamed's descendants need to be copied-up before they're
+		// renamed on the upper layer.
 		if err := renamed.copyUpDescendantsLocked(ctx, &ds); err != nil {
 			return err
 		}
@@ -1329,6 +1424,7 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 		renamed.parent = newParent
 	}
 	renamed.name = newName
+	renamed.redirect = redirect
 	if newParent.children == nil {
 		newParent.children = make(map[string]*dentry)
 	}
@@ -1338,7 +1434,7 @@ func (fs *filesystem) RenameAt(ctx context.Context, rp *vfs.ResolvingPath, oldPa
 	if err := CreateWhiteout(ctx, vfsObj, fs.creds, &oldpop); err != nil {
 		panic(fmt.Sprintf("unrecoverable overlayfs inconsistency: failed to create whiteout at origin after RenameAt: %v", err))
 	}
-	if renamed.isDir() {
+	if renamed.isDir() && redirect == "" {
 		if err := vfsObj.SetXattrAt(ctx, fs.creds, &newpop, &vfs.SetXattrOptions{
 			Name:  _OVL_XATTR_OPAQUE,
 			Value: "y",
@@ -1507,7 +1603,7 @@ func (d *dentry) setStatLocked(ctx context.Context, rp *vfs.ResolvingPath, opts
 		return err
 	}
 	defer mnt.EndWrite()
-	if err := d.copyUpLocked(ctx); err != nil {
+	if err := d.copyUpForSetStatLocked(ctx, &opts); err != nil {
 		return err
 	}
 	// Changes to d's attributes are serialized by d.copyMu.
@@ -1799,7 +1895,7 @@ func (fs *filesystem) setXattrLocked(ctx context.Context, d *dentry, mnt *vfs.Mo
 		return err
 	}
 	defer mnt.EndWrite()
-	if err := d.copyUpLocked(ctx); err != nil {
+	if err := d.copyUpMetadataLocked(ctx); err != nil {
 		return err
 	}
 	vfsObj := d.fs.vfsfs.VirtualFilesystem()
@@ -1843,7 +1939,7 @@ func (fs *filesystem) removeXattrLocked(ctx context.Context, d *dentry, mnt *vfs
 		return err
 	}
 	defer mnt.EndWrite()
-	if err := d.copyUpLocked(ctx); err != nil {
+	if err := d.copyUpMetadataLocked(ctx); err != nil {
 		return err
 	}
 	vfsObj := d.fs.vfsfs.VirtualFilesystem()
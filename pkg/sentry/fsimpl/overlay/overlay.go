@@ -35,6 +35,7 @@ package overlay
 
 import (
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
@@ -82,6 +83,18 @@ type FilesystemOptions struct {
 	// LowerRoots contains the roots of the immutable lower layers of the
 	// overlay. LowerRoots is immutable.
 	LowerRoots []vfs.VirtualDentry
+
+	// If MetaCopy is true, changing the metadata of a regular file that only
+	// exists on a lower layer copies up the file's metadata, but not its
+	// data, which continues to be read from the lower layer until the file
+	// is opened for writing or truncated. Compare Linux's metacopy=on.
+	MetaCopy bool
+
+	// If RedirectDir is true, renaming a directory that exists on a lower
+	// layer copies up the directory but not its descendants, and records the
+	// directory's original path on the upper layer so that its lower layers
+	// are still found at the new path. Compare Linux's redirect_dir=on.
+	RedirectDir bool
 }
 
 // filesystem implements vfs.FilesystemImpl.
@@ -165,6 +178,10 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		// Linux overlayfs also requires a workdir when upperdir is
 		// specified; we don't, so silently ignore this option.
 		delete(mopts, "workdir")
+		// TODO(Talismancer/gvisor-ligolo#synth-3174): Support overlays as
+		// upper layers, so that inner runtimes can keep their storage on the
+		// rootfs overlay with --nested-containers. Overlays refuse to create
+		// the whiteouts and overlay xattrs that upper layers must hold.
 		upperPath := fspath.Parse(upperPathname)
 		if !upperPath.Absolute {
 			ctx.Infof("overlay.FilesystemType.GetFilesystem: upperdir %q must be absolute", upperPathname)
@@ -228,6 +245,26 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		}
 	}
 
+	for name, opt := range map[string]*bool{
+		"metacopy":     &fsopts.MetaCopy,
+		"redirect_dir": &fsopts.RedirectDir,
+	} {
+		val, ok := mopts[name]
+		if !ok {
+			continue
+		}
+		delete(mopts, name)
+		switch val {
+		case "on":
+			*opt = true
+		case "off":
+			*opt = false
+		default:
+			ctx.Infof("overlay.FilesystemType.GetFilesystem: invalid value for %s: %q", name, val)
+			return nil, nil, linuxerr.EINVAL
+		}
+	}
+
 	if len(mopts) != 0 {
 		ctx.Infof("overlay.FilesystemType.GetFilesystem: unused options: %v", mopts)
 		return nil, nil, linuxerr.EINVAL
@@ -474,6 +511,12 @@ type dentry struct {
 	// 0 otherwise.
 	copiedUp atomicbitops.Uint32
 
+	// metacopy is 1 if this dentry is a regular file whose metadata, but not
+	// data, has been copied-up, such that its data is still read from
+	// lowerVDs[0], and 0 otherwise. metacopy can only transition from 1 to 0,
+	// with copyMu locked for writing.
+	metacopy atomicbitops.Uint32
+
 	// parent is the dentry corresponding to this dentry's parent directory.
 	// name is this dentry's name in parent. If this dentry is a filesystem
 	// root, parent is nil and name is the empty string. parent and name are
@@ -481,6 +524,12 @@ type dentry struct {
 	parent *dentry
 	name   string
 
+	// If this dentry represents a directory that was renamed with
+	// FilesystemOptions.RedirectDir, redirect is the path, relative to the
+	// roots of lower layers, at which its lower layers are found. Otherwise,
+	// redirect is empty. redirect is protected by fs.renameMu.
+	redirect string
+
 	// If this dentry represents a directory, children maps the names of
 	// children for which dentries have been instantiated to those dentries,
 	// and dirents (if not nil) is a cache of dirents as returned by
@@ -757,6 +806,16 @@ func (d *dentry) topLayerInfo() (vd vfs.VirtualDentry, isUpper bool) {
 	return d.lowerVDs[0], false
 }
 
+// dataLayerInfo is like topLayerInfo, but returns the layer from which d's
+// data is read, which is a lower layer if only d's metadata has been
+// copied-up.
+func (d *dentry) dataLayerInfo() (vd vfs.VirtualDentry, isUpper bool) {
+	if d.isDataCopiedUp() {
+		return d.upperVD, true
+	}
+	return d.lowerVDs[0], false
+}
+
 func (d *dentry) topLayer() vfs.VirtualDentry {
 	vd, _ := d.topLayerInfo()
 	return vd
@@ -769,6 +828,20 @@ func (d *dentry) topLookupLayer() lookupLayer {
 	return lookupLayerLower
 }
 
+// lowerPathLocked returns the path, relative to the roots of lower layers, of
+// the directories comprising d on lower layers.
+//
+// Preconditions: d.fs.renameMu must be locked.
+func (d *dentry) lowerPathLocked() string {
+	if d.redirect != "" {
+		return d.redirect
+	}
+	if d.parent == nil {
+		return "/"
+	}
+	return path.Join(d.parent.lowerPathLocked(), d.name)
+}
+
 func (d *dentry) checkPermissions(creds *auth.Credentials, ats vfs.AccessTypes) error {
 	return vfs.GenericCheckPermissions(creds, ats, linux.FileMode(d.mode.Load()), auth.KUID(d.uid.Load()), auth.KGID(d.gid.Load()))
 }
@@ -72,6 +72,8 @@ func (f *FilesystemOptions) StateFields() []string {
 	return []string{
 		"UpperRoot",
 		"LowerRoots",
+		"MetaCopy",
+		"RedirectDir",
 	}
 }
 
@@ -82,6 +84,8 @@ func (f *FilesystemOptions) StateSave(stateSinkObject state.Sink) {
 	f.beforeSave()
 	stateSinkObject.Save(0, &f.UpperRoot)
 	stateSinkObject.Save(1, &f.LowerRoots)
+	stateSinkObject.Save(2, &f.MetaCopy)
+	stateSinkObject.Save(3, &f.RedirectDir)
 }
 
 func (f *FilesystemOptions) afterLoad() {}
@@ -90,6 +94,8 @@ func (f *FilesystemOptions) afterLoad() {}
 func (f *FilesystemOptions) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &f.UpperRoot)
 	stateSourceObject.Load(1, &f.LowerRoots)
+	stateSourceObject.Load(2, &f.MetaCopy)
+	stateSourceObject.Load(3, &f.RedirectDir)
 }
 
 func (fs *filesystem) StateTypeName() string {
@@ -207,8 +213,10 @@ func (d *dentry) StateFields() []string {
 		"uid",
 		"gid",
 		"copiedUp",
+		"metacopy",
 		"parent",
 		"name",
+		"redirect",
 		"children",
 		"dirents",
 		"upperVD",
@@ -237,21 +245,23 @@ func (d *dentry) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(4, &d.uid)
 	stateSinkObject.Save(5, &d.gid)
 	stateSinkObject.Save(6, &d.copiedUp)
-	stateSinkObject.Save(7, &d.parent)
-	stateSinkObject.Save(8, &d.name)
-	stateSinkObject.Save(9, &d.children)
-	stateSinkObject.Save(10, &d.dirents)
-	stateSinkObject.Save(11, &d.upperVD)
-	stateSinkObject.Save(12, &d.lowerVDs)
-	stateSinkObject.Save(13, &d.inlineLowerVDs)
-	stateSinkObject.Save(14, &d.devMajor)
-	stateSinkObject.Save(15, &d.devMinor)
-	stateSinkObject.Save(16, &d.ino)
-	stateSinkObject.Save(17, &d.lowerMappings)
-	stateSinkObject.Save(18, &d.wrappedMappable)
-	stateSinkObject.Save(19, &d.isMappable)
-	stateSinkObject.Save(20, &d.locks)
-	stateSinkObject.Save(21, &d.watches)
+	stateSinkObject.Save(7, &d.metacopy)
+	stateSinkObject.Save(8, &d.parent)
+	stateSinkObject.Save(9, &d.name)
+	stateSinkObject.Save(10, &d.redirect)
+	stateSinkObject.Save(11, &d.children)
+	stateSinkObject.Save(12, &d.dirents)
+	stateSinkObject.Save(13, &d.upperVD)
+	stateSinkObject.Save(14, &d.lowerVDs)
+	stateSinkObject.Save(15, &d.inlineLowerVDs)
+	stateSinkObject.Save(16, &d.devMajor)
+	stateSinkObject.Save(17, &d.devMinor)
+	stateSinkObject.Save(18, &d.ino)
+	stateSinkObject.Save(19, &d.lowerMappings)
+	stateSinkObject.Save(20, &d.wrappedMappable)
+	stateSinkObject.Save(21, &d.isMappable)
+	stateSinkObject.Save(22, &d.locks)
+	stateSinkObject.Save(23, &d.watches)
 }
 
 // +checklocksignore
@@ -263,21 +273,23 @@ func (d *dentry) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(4, &d.uid)
 	stateSourceObject.Load(5, &d.gid)
 	stateSourceObject.Load(6, &d.copiedUp)
-	stateSourceObject.Load(7, &d.parent)
-	stateSourceObject.Load(8, &d.name)
-	stateSourceObject.Load(9, &d.children)
-	stateSourceObject.Load(10, &d.dirents)
-	stateSourceObject.Load(11, &d.upperVD)
-	stateSourceObject.Load(12, &d.lowerVDs)
-	stateSourceObject.Load(13, &d.inlineLowerVDs)
-	stateSourceObject.Load(14, &d.devMajor)
-	stateSourceObject.Load(15, &d.devMinor)
-	stateSourceObject.Load(16, &d.ino)
-	stateSourceObject.Load(17, &d.lowerMappings)
-	stateSourceObject.Load(18, &d.wrappedMappable)
-	stateSourceObject.Load(19, &d.isMappable)
-	stateSourceObject.Load(20, &d.locks)
-	stateSourceObject.Load(21, &d.watches)
+	stateSourceObject.Load(7, &d.metacopy)
+	stateSourceObject.Load(8, &d.parent)
+	stateSourceObject.Load(9, &d.name)
+	stateSourceObject.Load(10, &d.redirect)
+	stateSourceObject.Load(11, &d.children)
+	stateSourceObject.Load(12, &d.dirents)
+	stateSourceObject.Load(13, &d.upperVD)
+	stateSourceObject.Load(14, &d.lowerVDs)
+	stateSourceObject.Load(15, &d.inlineLowerVDs)
+	stateSourceObject.Load(16, &d.devMajor)
+	stateSourceObject.Load(17, &d.devMinor)
+	stateSourceObject.Load(18, &d.ino)
+	stateSourceObject.Load(19, &d.lowerMappings)
+	stateSourceObject.Load(20, &d.wrappedMappable)
+	stateSourceObject.Load(21, &d.isMappable)
+	stateSourceObject.Load(22, &d.locks)
+	stateSourceObject.Load(23, &d.watches)
 	stateSourceObject.AfterLoad(d.afterLoad)
 }
 
@@ -73,7 +73,7 @@ func (fd *regularFileFD) getCurrentFD(ctx context.Context) (*vfs.FileDescription
 func (fd *regularFileFD) currentFDLocked(ctx context.Context) (*vfs.FileDescription, error) {
 	d := fd.dentry()
 	statusFlags := fd.vfsfd.StatusFlags()
-	if !fd.copiedUp && d.isCopiedUp() {
+	if !fd.copiedUp && d.isDataCopiedUp() {
 		// Switch to the copied-up file.
 		upperVD := d.topLayer()
 		upperFD, err := fd.filesystem().vfsfs.VirtualFilesystem().OpenAt(ctx, d.fs.creds, &vfs.PathOperation{
@@ -135,7 +135,22 @@ func (fd *regularFileFD) OnClose(ctx context.Context) error {
 // Stat implements vfs.FileDescriptionImpl.Stat.
 func (fd *regularFileFD) Stat(ctx context.Context, opts vfs.StatOptions) (linux.Statx, error) {
 	var stat linux.Statx
-	if layerMask := opts.Mask &^ statInternalMask; layerMask != 0 {
+	if layerMask := opts.Mask &^ statInternalMask; layerMask != 0 && fd.dentry().isMetacopy() {
+		// Attributes of a metacopy are read from the upper layer, while fd
+		// still refers to the lower layer.
+		d := fd.dentry()
+		var err error
+		stat, err = d.fs.vfsfs.VirtualFilesystem().StatAt(ctx, d.fs.creds, &vfs.PathOperation{
+			Root:  d.upperVD,
+			Start: d.upperVD,
+		}, &vfs.StatOptions{
+			Mask: layerMask,
+			Sync: opts.Sync,
+		})
+		if err != nil {
+			return linux.Statx{}, err
+		}
+	} else if layerMask != 0 {
 		wrappedFD, err := fd.getCurrentFD(ctx)
 		if err != nil {
 			return linux.Statx{}, err
@@ -175,15 +190,33 @@ func (fd *regularFileFD) SetStat(ctx context.Context, opts vfs.SetStatOptions) e
 		return err
 	}
 	defer mnt.EndWrite()
-	if err := d.copyUpLocked(ctx); err != nil {
+	if err := d.copyUpForSetStatLocked(ctx, &opts); err != nil {
 		return err
 	}
 	// Changes to d's attributes are serialized by d.copyMu.
 	d.copyMu.Lock()
 	defer d.copyMu.Unlock()
-	wrappedFD, err := fd.currentFDLocked(ctx)
-	if err != nil {
-		return err
+	var wrappedFD *vfs.FileDescription
+	if d.isMetacopy() {
+		// fd still reads d's data from the lower layer, but d's attributes
+		// are set on the upper layer.
+		upperFD, err := d.fs.vfsfs.VirtualFilesystem().OpenAt(ctx, d.fs.creds, &vfs.PathOperation{
+			Root:  d.upperVD,
+			Start: d.upperVD,
+		}, &vfs.OpenOptions{
+			Flags: linux.O_RDONLY,
+		})
+		if err != nil {
+			return err
+		}
+		defer upperFD.DecRef(ctx)
+		wrappedFD = upperFD
+	} else {
+		var err error
+		wrappedFD, err = fd.currentFDLocked(ctx)
+		if err != nil {
+			return err
+		}
 	}
 	if err := wrappedFD.SetStat(ctx, opts); err != nil {
 		return err
@@ -436,7 +469,7 @@ func (d *dentry) AddMapping(ctx context.Context, ms memmap.MappingSpace, ar host
 	if err := d.wrappedMappable.AddMapping(ctx, ms, ar, offset, writable); err != nil {
 		return err
 	}
-	if !d.isCopiedUp() {
+	if !d.isDataCopiedUp() {
 		d.lowerMappings.AddMapping(ms, ar, offset, writable)
 	}
 	return nil
@@ -447,7 +480,7 @@ func (d *dentry) RemoveMapping(ctx context.Context, ms memmap.MappingSpace, ar h
 	d.mapsMu.Lock()
 	defer d.mapsMu.Unlock()
 	d.wrappedMappable.RemoveMapping(ctx, ms, ar, offset, writable)
-	if !d.isCopiedUp() {
+	if !d.isDataCopiedUp() {
 		d.lowerMappings.RemoveMapping(ms, ar, offset, writable)
 	}
 }
@@ -459,7 +492,7 @@ func (d *dentry) CopyMapping(ctx context.Context, ms memmap.MappingSpace, srcAR,
 	if err := d.wrappedMappable.CopyMapping(ctx, ms, srcAR, dstAR, offset, writable); err != nil {
 		return err
 	}
-	if !d.isCopiedUp() {
+	if !d.isDataCopiedUp() {
 		d.lowerMappings.AddMapping(ms, dstAR, offset, writable)
 	}
 	return nil
@@ -379,6 +379,40 @@ func (i *taskOwnedInode) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(1, &i.owner)
 }
 
+func (d *attrData) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.attrData"
+}
+
+func (d *attrData) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"task",
+		"lsm",
+		"name",
+	}
+}
+
+func (d *attrData) beforeSave() {}
+
+// +checklocksignore
+func (d *attrData) StateSave(stateSinkObject state.Sink) {
+	d.beforeSave()
+	stateSinkObject.Save(0, &d.DynamicBytesFile)
+	stateSinkObject.Save(1, &d.task)
+	stateSinkObject.Save(2, &d.lsm)
+	stateSinkObject.Save(3, &d.name)
+}
+
+func (d *attrData) afterLoad() {}
+
+// +checklocksignore
+func (d *attrData) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &d.DynamicBytesFile)
+	stateSourceObject.Load(1, &d.task)
+	stateSourceObject.Load(2, &d.lsm)
+	stateSourceObject.Load(3, &d.name)
+}
+
 func (i *fdDir) StateTypeName() string {
 	return "pkg/sentry/fsimpl/proc.fdDir"
 }
@@ -752,6 +786,34 @@ func (d *idMapData) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(2, &d.gids)
 }
 
+func (d *setgroupsData) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.setgroupsData"
+}
+
+func (d *setgroupsData) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"task",
+	}
+}
+
+func (d *setgroupsData) beforeSave() {}
+
+// +checklocksignore
+func (d *setgroupsData) StateSave(stateSinkObject state.Sink) {
+	d.beforeSave()
+	stateSinkObject.Save(0, &d.DynamicBytesFile)
+	stateSinkObject.Save(1, &d.task)
+}
+
+func (d *setgroupsData) afterLoad() {}
+
+// +checklocksignore
+func (d *setgroupsData) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &d.DynamicBytesFile)
+	stateSourceObject.Load(1, &d.task)
+}
+
 func (f *memInode) StateTypeName() string {
 	return "pkg/sentry/fsimpl/proc.memInode"
 }
@@ -1163,6 +1225,62 @@ func (o *oomScoreAdj) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(1, &o.task)
 }
 
+func (d *loginUIDData) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.loginUIDData"
+}
+
+func (d *loginUIDData) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"task",
+	}
+}
+
+func (d *loginUIDData) beforeSave() {}
+
+// +checklocksignore
+func (d *loginUIDData) StateSave(stateSinkObject state.Sink) {
+	d.beforeSave()
+	stateSinkObject.Save(0, &d.DynamicBytesFile)
+	stateSinkObject.Save(1, &d.task)
+}
+
+func (d *loginUIDData) afterLoad() {}
+
+// +checklocksignore
+func (d *loginUIDData) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &d.DynamicBytesFile)
+	stateSourceObject.Load(1, &d.task)
+}
+
+func (d *sessionIDData) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.sessionIDData"
+}
+
+func (d *sessionIDData) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"task",
+	}
+}
+
+func (d *sessionIDData) beforeSave() {}
+
+// +checklocksignore
+func (d *sessionIDData) StateSave(stateSinkObject state.Sink) {
+	d.beforeSave()
+	stateSinkObject.Save(0, &d.DynamicBytesFile)
+	stateSinkObject.Save(1, &d.task)
+}
+
+func (d *sessionIDData) afterLoad() {}
+
+// +checklocksignore
+func (d *sessionIDData) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &d.DynamicBytesFile)
+	stateSourceObject.Load(1, &d.task)
+}
+
 func (s *exeSymlink) StateTypeName() string {
 	return "pkg/sentry/fsimpl/proc.exeSymlink"
 }
@@ -1582,6 +1700,34 @@ func (n *netDevData) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(1, &n.stack)
 }
 
+func (n *netDevMcastData) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.netDevMcastData"
+}
+
+func (n *netDevMcastData) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"stack",
+	}
+}
+
+func (n *netDevMcastData) beforeSave() {}
+
+// +checklocksignore
+func (n *netDevMcastData) StateSave(stateSinkObject state.Sink) {
+	n.beforeSave()
+	stateSinkObject.Save(0, &n.DynamicBytesFile)
+	stateSinkObject.Save(1, &n.stack)
+}
+
+func (n *netDevMcastData) afterLoad() {}
+
+// +checklocksignore
+func (n *netDevMcastData) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &n.DynamicBytesFile)
+	stateSourceObject.Load(1, &n.stack)
+}
+
 func (n *netUnixData) StateTypeName() string {
 	return "pkg/sentry/fsimpl/proc.netUnixData"
 }
@@ -1694,6 +1840,34 @@ func (d *netUDPData) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(1, &d.kernel)
 }
 
+func (d *netUDP6Data) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.netUDP6Data"
+}
+
+func (d *netUDP6Data) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"kernel",
+	}
+}
+
+func (d *netUDP6Data) beforeSave() {}
+
+// +checklocksignore
+func (d *netUDP6Data) StateSave(stateSinkObject state.Sink) {
+	d.beforeSave()
+	stateSinkObject.Save(0, &d.DynamicBytesFile)
+	stateSinkObject.Save(1, &d.kernel)
+}
+
+func (d *netUDP6Data) afterLoad() {}
+
+// +checklocksignore
+func (d *netUDP6Data) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &d.DynamicBytesFile)
+	stateSourceObject.Load(1, &d.kernel)
+}
+
 func (d *netSnmpData) StateTypeName() string {
 	return "pkg/sentry/fsimpl/proc.netSnmpData"
 }
@@ -1750,6 +1924,34 @@ func (s *snmpLine) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(1, &s.header)
 }
 
+func (d *netSnmp6Data) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.netSnmp6Data"
+}
+
+func (d *netSnmp6Data) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"stack",
+	}
+}
+
+func (d *netSnmp6Data) beforeSave() {}
+
+// +checklocksignore
+func (d *netSnmp6Data) StateSave(stateSinkObject state.Sink) {
+	d.beforeSave()
+	stateSinkObject.Save(0, &d.DynamicBytesFile)
+	stateSinkObject.Save(1, &d.stack)
+}
+
+func (d *netSnmp6Data) afterLoad() {}
+
+// +checklocksignore
+func (d *netSnmp6Data) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &d.DynamicBytesFile)
+	stateSourceObject.Load(1, &d.stack)
+}
+
 func (d *netRouteData) StateTypeName() string {
 	return "pkg/sentry/fsimpl/proc.netRouteData"
 }
@@ -1870,32 +2072,29 @@ func (i *tasksInode) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(13, &i.fakeCgroupControllers)
 }
 
-func (s *staticFileSetStat) StateTypeName() string {
-	return "pkg/sentry/fsimpl/proc.staticFileSetStat"
+func (c *cpuInfoData) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.cpuInfoData"
 }
 
-func (s *staticFileSetStat) StateFields() []string {
+func (c *cpuInfoData) StateFields() []string {
 	return []string{
 		"dynamicBytesFileSetAttr",
-		"StaticData",
 	}
 }
 
-func (s *staticFileSetStat) beforeSave() {}
+func (c *cpuInfoData) beforeSave() {}
 
 // +checklocksignore
-func (s *staticFileSetStat) StateSave(stateSinkObject state.Sink) {
-	s.beforeSave()
-	stateSinkObject.Save(0, &s.dynamicBytesFileSetAttr)
-	stateSinkObject.Save(1, &s.StaticData)
+func (c *cpuInfoData) StateSave(stateSinkObject state.Sink) {
+	c.beforeSave()
+	stateSinkObject.Save(0, &c.dynamicBytesFileSetAttr)
 }
 
-func (s *staticFileSetStat) afterLoad() {}
+func (c *cpuInfoData) afterLoad() {}
 
 // +checklocksignore
-func (s *staticFileSetStat) StateLoad(stateSourceObject state.Source) {
-	stateSourceObject.Load(0, &s.dynamicBytesFileSetAttr)
-	stateSourceObject.Load(1, &s.StaticData)
+func (c *cpuInfoData) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &c.dynamicBytesFileSetAttr)
 }
 
 func (s *selfSymlink) StateTypeName() string {
@@ -2318,6 +2517,14 @@ func (t *tcpMemDir) StateFields() []string {
 	return nil
 }
 
+func (s *ipcLimit) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.ipcLimit"
+}
+
+func (s *ipcLimit) StateFields() []string {
+	return nil
+}
+
 func (d *mmapMinAddrData) StateTypeName() string {
 	return "pkg/sentry/fsimpl/proc.mmapMinAddrData"
 }
@@ -2378,8 +2585,6 @@ func (d *tcpSackData) StateTypeName() string {
 func (d *tcpSackData) StateFields() []string {
 	return []string{
 		"DynamicBytesFile",
-		"stack",
-		"enabled",
 	}
 }
 
@@ -2389,8 +2594,6 @@ func (d *tcpSackData) beforeSave() {}
 func (d *tcpSackData) StateSave(stateSinkObject state.Sink) {
 	d.beforeSave()
 	stateSinkObject.Save(0, &d.DynamicBytesFile)
-	stateSinkObject.Save(1, &d.stack)
-	stateSinkObject.Save(2, &d.enabled)
 }
 
 func (d *tcpSackData) afterLoad() {}
@@ -2398,8 +2601,6 @@ func (d *tcpSackData) afterLoad() {}
 // +checklocksignore
 func (d *tcpSackData) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &d.DynamicBytesFile)
-	stateSourceObject.LoadWait(1, &d.stack)
-	stateSourceObject.Load(2, &d.enabled)
 }
 
 func (d *tcpRecoveryData) StateTypeName() string {
@@ -2409,7 +2610,6 @@ func (d *tcpRecoveryData) StateTypeName() string {
 func (d *tcpRecoveryData) StateFields() []string {
 	return []string{
 		"DynamicBytesFile",
-		"stack",
 	}
 }
 
@@ -2419,7 +2619,6 @@ func (d *tcpRecoveryData) beforeSave() {}
 func (d *tcpRecoveryData) StateSave(stateSinkObject state.Sink) {
 	d.beforeSave()
 	stateSinkObject.Save(0, &d.DynamicBytesFile)
-	stateSinkObject.Save(1, &d.stack)
 }
 
 func (d *tcpRecoveryData) afterLoad() {}
@@ -2427,7 +2626,6 @@ func (d *tcpRecoveryData) afterLoad() {}
 // +checklocksignore
 func (d *tcpRecoveryData) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &d.DynamicBytesFile)
-	stateSourceObject.LoadWait(1, &d.stack)
 }
 
 func (d *tcpMemData) StateTypeName() string {
@@ -2438,7 +2636,6 @@ func (d *tcpMemData) StateFields() []string {
 	return []string{
 		"DynamicBytesFile",
 		"dir",
-		"stack",
 	}
 }
 
@@ -2449,7 +2646,6 @@ func (d *tcpMemData) StateSave(stateSinkObject state.Sink) {
 	d.beforeSave()
 	stateSinkObject.Save(0, &d.DynamicBytesFile)
 	stateSinkObject.Save(1, &d.dir)
-	stateSinkObject.Save(2, &d.stack)
 }
 
 func (d *tcpMemData) afterLoad() {}
@@ -2458,7 +2654,6 @@ func (d *tcpMemData) afterLoad() {}
 func (d *tcpMemData) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &d.DynamicBytesFile)
 	stateSourceObject.Load(1, &d.dir)
-	stateSourceObject.LoadWait(2, &d.stack)
 }
 
 func (ipf *ipForwarding) StateTypeName() string {
@@ -2468,8 +2663,6 @@ func (ipf *ipForwarding) StateTypeName() string {
 func (ipf *ipForwarding) StateFields() []string {
 	return []string{
 		"DynamicBytesFile",
-		"stack",
-		"enabled",
 	}
 }
 
@@ -2479,8 +2672,6 @@ func (ipf *ipForwarding) beforeSave() {}
 func (ipf *ipForwarding) StateSave(stateSinkObject state.Sink) {
 	ipf.beforeSave()
 	stateSinkObject.Save(0, &ipf.DynamicBytesFile)
-	stateSinkObject.Save(1, &ipf.stack)
-	stateSinkObject.Save(2, &ipf.enabled)
 }
 
 func (ipf *ipForwarding) afterLoad() {}
@@ -2488,8 +2679,6 @@ func (ipf *ipForwarding) afterLoad() {}
 // +checklocksignore
 func (ipf *ipForwarding) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &ipf.DynamicBytesFile)
-	stateSourceObject.LoadWait(1, &ipf.stack)
-	stateSourceObject.Load(2, &ipf.enabled)
 }
 
 func (pr *portRange) StateTypeName() string {
@@ -2499,9 +2688,6 @@ func (pr *portRange) StateTypeName() string {
 func (pr *portRange) StateFields() []string {
 	return []string{
 		"DynamicBytesFile",
-		"stack",
-		"start",
-		"end",
 	}
 }
 
@@ -2511,9 +2697,6 @@ func (pr *portRange) beforeSave() {}
 func (pr *portRange) StateSave(stateSinkObject state.Sink) {
 	pr.beforeSave()
 	stateSinkObject.Save(0, &pr.DynamicBytesFile)
-	stateSinkObject.Save(1, &pr.stack)
-	stateSinkObject.Save(2, &pr.start)
-	stateSinkObject.Save(3, &pr.end)
 }
 
 func (pr *portRange) afterLoad() {}
@@ -2521,9 +2704,6 @@ func (pr *portRange) afterLoad() {}
 // +checklocksignore
 func (pr *portRange) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &pr.DynamicBytesFile)
-	stateSourceObject.LoadWait(1, &pr.stack)
-	stateSourceObject.Load(2, &pr.start)
-	stateSourceObject.Load(3, &pr.end)
 }
 
 func (s *yamaPtraceScope) StateTypeName() string {
@@ -2554,6 +2734,34 @@ func (s *yamaPtraceScope) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(1, &s.level)
 }
 
+func (d *ipcLimitData) StateTypeName() string {
+	return "pkg/sentry/fsimpl/proc.ipcLimitData"
+}
+
+func (d *ipcLimitData) StateFields() []string {
+	return []string{
+		"DynamicBytesFile",
+		"limit",
+	}
+}
+
+func (d *ipcLimitData) beforeSave() {}
+
+// +checklocksignore
+func (d *ipcLimitData) StateSave(stateSinkObject state.Sink) {
+	d.beforeSave()
+	stateSinkObject.Save(0, &d.DynamicBytesFile)
+	stateSinkObject.Save(1, &d.limit)
+}
+
+func (d *ipcLimitData) afterLoad() {}
+
+// +checklocksignore
+func (d *ipcLimitData) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &d.DynamicBytesFile)
+	stateSourceObject.Load(1, &d.limit)
+}
+
 func init() {
 	state.Register((*fdDirInodeRefs)(nil))
 	state.Register((*fdInfoDirInodeRefs)(nil))
@@ -2567,6 +2775,7 @@ func init() {
 	state.Register((*subtasksInodeRefs)(nil))
 	state.Register((*taskInode)(nil))
 	state.Register((*taskOwnedInode)(nil))
+	state.Register((*attrData)(nil))
 	state.Register((*fdDir)(nil))
 	state.Register((*fdDirInode)(nil))
 	state.Register((*fdSymlink)(nil))
@@ -2577,6 +2786,7 @@ func init() {
 	state.Register((*commInode)(nil))
 	state.Register((*commData)(nil))
 	state.Register((*idMapData)(nil))
+	state.Register((*setgroupsData)(nil))
 	state.Register((*memInode)(nil))
 	state.Register((*memFD)(nil))
 	state.Register((*limitsData)(nil))
@@ -2589,6 +2799,8 @@ func init() {
 	state.Register((*statusFDLowerBase)(nil))
 	state.Register((*ioData)(nil))
 	state.Register((*oomScoreAdj)(nil))
+	state.Register((*loginUIDData)(nil))
+	state.Register((*sessionIDData)(nil))
 	state.Register((*exeSymlink)(nil))
 	state.Register((*cwdSymlink)(nil))
 	state.Register((*rootSymlink)(nil))
@@ -2601,16 +2813,19 @@ func init() {
 	state.Register((*taskInodeRefs)(nil))
 	state.Register((*ifinet6)(nil))
 	state.Register((*netDevData)(nil))
+	state.Register((*netDevMcastData)(nil))
 	state.Register((*netUnixData)(nil))
 	state.Register((*netTCPData)(nil))
 	state.Register((*netTCP6Data)(nil))
 	state.Register((*netUDPData)(nil))
+	state.Register((*netUDP6Data)(nil))
 	state.Register((*netSnmpData)(nil))
+	state.Register((*netSnmp6Data)(nil))
 	state.Register((*snmpLine)(nil))
 	state.Register((*netRouteData)(nil))
 	state.Register((*netStatData)(nil))
 	state.Register((*tasksInode)(nil))
-	state.Register((*staticFileSetStat)(nil))
+	state.Register((*cpuInfoData)(nil))
 	state.Register((*selfSymlink)(nil))
 	state.Register((*threadSelfSymlink)(nil))
 	state.Register((*dynamicBytesFileSetAttr)(nil))
@@ -2626,6 +2841,7 @@ func init() {
 	state.Register((*sentryMeminfoData)(nil))
 	state.Register((*tasksInodeRefs)(nil))
 	state.Register((*tcpMemDir)(nil))
+	state.Register((*ipcLimit)(nil))
 	state.Register((*mmapMinAddrData)(nil))
 	state.Register((*hostnameData)(nil))
 	state.Register((*tcpSackData)(nil))
@@ -2634,4 +2850,5 @@ func init() {
 	state.Register((*ipForwarding)(nil))
 	state.Register((*portRange)(nil))
 	state.Register((*yamaPtraceScope)(nil))
+	state.Register((*ipcLimitData)(nil))
 }
@@ -0,0 +1,183 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package proc
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/kernfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
+)
+
+// newAttrDir returns the /proc/[pid]/attr directory, through which tasks get
+// and set their LSM attributes. The files behave according to the LSM the
+// sandbox presents, see vfs.LSM; all tasks are unconfined and writes never
+// change their attributes.
+func (fs *filesystem) newAttrDir(ctx context.Context, task *kernel.Task) kernfs.Inode {
+	attr := func(lsm vfs.LSM, name string, perm linux.FileMode) kernfs.Inode {
+		return fs.newTaskOwnedInode(ctx, task, fs.NextIno(), perm, &attrData{task: task, lsm: lsm, name: name})
+	}
+	// An LSM of vfs.LSMNone makes the files behave like the generic ones of
+	// the active LSM.
+	const generic = vfs.LSMNone
+	return fs.newTaskOwnedDir(ctx, task, fs.NextIno(), 0555, map[string]kernfs.Inode{
+		"current":    attr(generic, "current", 0666),
+		"exec":       attr(generic, "exec", 0666),
+		"fscreate":   attr(generic, "fscreate", 0666),
+		"keycreate":  attr(generic, "keycreate", 0666),
+		"prev":       attr(generic, "prev", 0444),
+		"sockcreate": attr(generic, "sockcreate", 0666),
+		"apparmor": fs.newTaskOwnedDir(ctx, task, fs.NextIno(), 0555, map[string]kernfs.Inode{
+			"current": attr(vfs.LSMAppArmor, "current", 0666),
+			"exec":    attr(vfs.LSMAppArmor, "exec", 0666),
+			"prev":    attr(vfs.LSMAppArmor, "prev", 0444),
+		}),
+	})
+}
+
+// attrData implements vfs.WritableDynamicBytesSource for the files of
+// /proc/[pid]/attr.
+//
+// +stateify savable
+type attrData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+
+	// lsm is the LSM whose attribute the file exposes, or vfs.LSMNone for the
+	// attributes of the active LSM.
+	lsm vfs.LSM
+
+	// name is the name of the attribute, e.g. "current".
+	name string
+}
+
+var _ vfs.WritableDynamicBytesSource = (*attrData)(nil)
+
+// activeLSM returns the LSM handling the attribute, or vfs.LSMNone if it
+// isn't handled by the LSM presented to applications.
+func (d *attrData) activeLSM() vfs.LSM {
+	lsm := d.task.Kernel().VFS().LSM()
+	if d.lsm != vfs.LSMNone && d.lsm != lsm {
+		return vfs.LSMNone
+	}
+	return lsm
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *attrData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	switch d.activeLSM() {
+	case vfs.LSMAppArmor:
+		// See security/apparmor/lsm.c:apparmor_getprocattr. Unconfined
+		// tasks have neither a previous nor an on-exec label.
+		if d.name != "current" {
+			return linuxerr.EINVAL
+		}
+		buf.WriteString(vfs.AppArmorUnconfined + "\n")
+		return nil
+	case vfs.LSMSELinux:
+		// See security/selinux/hooks.c:selinux_getprocattr. Contexts are
+		// NUL-terminated, and the create contexts are unset.
+		if d.name == "current" || d.name == "prev" {
+			buf.WriteString(vfs.SELinuxTaskContext + "\x00")
+		}
+		return nil
+	default:
+		return linuxerr.EINVAL
+	}
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *attrData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	// A task may only set its own attributes.
+	if kernel.TaskFromContext(ctx) != d.task {
+		return 0, linuxerr.EACCES
+	}
+	if offset != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	lsm := d.activeLSM()
+	if lsm == vfs.LSMNone {
+		return 0, linuxerr.EINVAL
+	}
+
+	src = src.TakeFirst(hostarch.PageSize)
+	buf := make([]byte, src.NumBytes())
+	n, err := src.CopyIn(ctx, buf)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimRight(string(buf[:n]), "\x00\n")
+
+	switch lsm {
+	case vfs.LSMAppArmor:
+		err = d.writeAppArmor(value)
+	case vfs.LSMSELinux:
+		err = d.writeSELinux(value)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+// writeAppArmor handles a write of value to an AppArmor attribute. See
+// security/apparmor/lsm.c:apparmor_setprocattr. No profile is loaded, so
+// only changes to the unconfined label succeed, as no-ops.
+func (d *attrData) writeAppArmor(value string) error {
+	cmd, arg, _ := strings.Cut(value, " ")
+	switch {
+	case d.name == "current" && (cmd == "changehat" || cmd == "permhat"):
+		// Unconfined tasks have no hats.
+		return linuxerr.EPERM
+	case d.name == "current" && (cmd == "changeprofile" || cmd == "permprofile"):
+	case d.name == "exec" && cmd == "exec":
+	default:
+		return linuxerr.EINVAL
+	}
+	if arg == "" {
+		return linuxerr.EINVAL
+	}
+	if arg != vfs.AppArmorUnconfined {
+		return linuxerr.ENOENT
+	}
+	return nil
+}
+
+// writeSELinux handles a write of value to a SELinux attribute. See
+// security/selinux/hooks.c:selinux_setprocattr. The task context can't be
+// changed; create contexts are accepted and have no effect.
+func (d *attrData) writeSELinux(value string) error {
+	switch d.name {
+	case "current":
+		if value != vfs.SELinuxTaskContext {
+			return linuxerr.EACCES
+		}
+	case "exec", "fscreate", "keycreate", "sockcreate":
+		if value != "" && !vfs.ValidSELinuxContext(value) {
+			return linuxerr.EINVAL
+		}
+	default:
+		return linuxerr.EINVAL
+	}
+	return nil
+}
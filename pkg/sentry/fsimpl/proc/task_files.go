@@ -404,6 +404,61 @@ func (d *idMapData) Write(ctx context.Context, _ *vfs.FileDescription, src userm
 	return int64(srclen), nil
 }
 
+// setgroupsData implements vfs.WritableDynamicBytesSource for
+// /proc/[pid]/setgroups.
+//
+// +stateify savable
+type setgroupsData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*setgroupsData)(nil)
+var _ vfs.WritableDynamicBytesSource = (*setgroupsData)(nil)
+
+// Generate implements vfs.WritableDynamicBytesSource.Generate.
+func (d *setgroupsData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if d.task.UserNamespace().SetgroupsAllowed() {
+		buf.WriteString("allow\n")
+	} else {
+		buf.WriteString("deny\n")
+	}
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *setgroupsData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	// Linux's kernel/user_namespace.c:proc_setgroups_write() only accepts
+	// "allow" or "deny", optionally followed by whitespace, written at once at
+	// the start of the file.
+	srclen := src.NumBytes()
+	if srclen >= 8 || offset != 0 {
+		return 0, linuxerr.EINVAL
+	}
+	b := make([]byte, srclen)
+	if _, err := src.CopyIn(ctx, b); err != nil {
+		return 0, err
+	}
+	var allow bool
+	switch string(bytes.TrimRight(b, " \t\n\v\f\r\x00")) {
+	case "allow":
+		allow = true
+	case "deny":
+		allow = false
+	default:
+		return 0, linuxerr.EINVAL
+	}
+	ns := d.task.UserNamespace()
+	if !auth.CredentialsFromContext(ctx).HasCapabilityIn(linux.CAP_SYS_ADMIN, ns) {
+		return 0, linuxerr.EPERM
+	}
+	if err := ns.SetSetgroupsAllowed(allow); err != nil {
+		return 0, err
+	}
+	return int64(srclen), nil
+}
+
 var _ kernfs.Inode = (*memInode)(nil)
 
 // memInode implements kernfs.Inode for /proc/[pid]/mem.
@@ -697,7 +752,8 @@ func (s *taskStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 		terminationSignal = s.task.ThreadGroup().TerminationSignal()
 	}
 	fmt.Fprintf(buf, "%d ", terminationSignal)
-	fmt.Fprintf(buf, "0 0 0 " /* processor rt_priority policy */)
+	schedPolicy := s.task.SchedPolicy()
+	fmt.Fprintf(buf, "0 %d %d " /* processor rt_priority policy */, schedPolicy.RTPriority, schedPolicy.Policy)
 	fmt.Fprintf(buf, "0 0 0 " /* delayacct_blkio_ticks guest_time cguest_time */)
 	fmt.Fprintf(buf, "0 0 0 0 0 0 0 " /* start_data end_data start_brk arg_start arg_end env_start env_end */)
 	fmt.Fprintf(buf, "0\n" /* exit_code */)
@@ -879,6 +935,9 @@ func (s *statusFD) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	fmt.Fprintf(buf, "CapEff:\t%016x\n", creds.EffectiveCaps)
 	fmt.Fprintf(buf, "CapBnd:\t%016x\n", creds.BoundingCaps)
 	fmt.Fprintf(buf, "Seccomp:\t%d\n", s.task.SeccompMode())
+	cpus := s.task.CPUMask()
+	fmt.Fprintf(buf, "Cpus_allowed:\t%s\n", cpus.MaskString(s.task.Kernel().ApplicationCores()))
+	fmt.Fprintf(buf, "Cpus_allowed_list:\t%s\n", cpus.ListString())
 	// We unconditionally report a single NUMA node. See
 	// pkg/sentry/syscalls/linux/sys_mempolicy.go.
 	fmt.Fprintf(buf, "Mems_allowed:\t1\n")
@@ -966,6 +1025,84 @@ func (o *oomScoreAdj) Write(ctx context.Context, _ *vfs.FileDescription, src use
 	return src.NumBytes(), nil
 }
 
+// loginUIDData implements vfs.WritableDynamicBytesSource for
+// /proc/[pid]/loginuid.
+//
+// +stateify savable
+type loginUIDData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ vfs.WritableDynamicBytesSource = (*loginUIDData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *loginUIDData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	creds := auth.CredentialsFromContext(ctx)
+	kuid := d.task.Credentials().LoginKUID
+	uid := uint32(auth.NoID)
+	if kuid.Ok() {
+		uid = uint32(kuid.In(creds.UserNamespace).OrOverflow())
+	}
+	fmt.Fprintf(buf, "%d", uid)
+	return nil
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *loginUIDData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	// Only a task may set its own login UID.
+	if kernel.TaskFromContext(ctx) != d.task {
+		return 0, linuxerr.EPERM
+	}
+	if offset != 0 {
+		return 0, linuxerr.EINVAL
+	}
+
+	src = src.TakeFirst(hostarch.PageSize - 1)
+	str, err := usermem.CopyStringIn(ctx, src.IO, src.Addrs.Head().Start, int(src.Addrs.Head().Length()), src.Opts)
+	if err != nil && err != linuxerr.ENAMETOOLONG {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(str), 10, 32)
+	if err != nil {
+		return 0, linuxerr.EINVAL
+	}
+
+	// (uid_t)-1 unsets the login UID. Other UIDs are mapped from the
+	// writer's user namespace and must be valid.
+	kuid := auth.KUID(auth.NoID)
+	if uid := auth.UID(v); uid.Ok() {
+		creds := auth.CredentialsFromContext(ctx)
+		kuid = creds.UserNamespace.MapToKUID(uid)
+		if !kuid.Ok() {
+			return 0, linuxerr.EINVAL
+		}
+	}
+	if err := d.task.SetLoginUID(kuid); err != nil {
+		return 0, err
+	}
+	return src.NumBytes(), nil
+}
+
+// sessionIDData implements vfs.DynamicBytesSource for
+// /proc/[pid]/sessionid.
+//
+// +stateify savable
+type sessionIDData struct {
+	kernfs.DynamicBytesFile
+
+	task *kernel.Task
+}
+
+var _ dynamicInode = (*sessionIDData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *sessionIDData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	fmt.Fprintf(buf, "%d", d.task.Credentials().SessionID)
+	return nil
+}
+
 // exeSymlink is an symlink for the /proc/[pid]/exe file.
 //
 // +stateify savable
@@ -1274,6 +1411,8 @@ func (s *namespaceSymlink) getInode(t *kernel.Task) *nsfs.Inode {
 	switch s.nsType {
 	case linux.CLONE_NEWNET:
 		return t.GetNetworkNamespace().GetInode()
+	case linux.CLONE_NEWCGROUP:
+		return t.CgroupNamespace().GetInode()
 	default:
 		panic("unknown namespace")
 	}
@@ -1416,6 +1555,12 @@ func (d *taskCgroupData) Generate(ctx context.Context, buf *bytes.Buffer) error
 		return linuxerr.ESRCH
 	}
 
-	d.task.GenerateProcTaskCgroup(buf)
+	// Paths are relative to the cgroup namespace of the reader.
+	var ns *kernel.CgroupNamespace
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		ns = t.CgroupNamespace()
+		defer ns.DecRef(ctx)
+	}
+	d.task.GenerateProcTaskCgroup(ns, buf)
 	return nil
 }
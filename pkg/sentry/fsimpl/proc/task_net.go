@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"reflect"
+	"sort"
 	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
@@ -34,6 +35,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix/transport"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
 )
 
@@ -50,22 +52,22 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 			packet    = "sk       RefCnt Type Proto  Iface R Rmem   User   Inode\n"
 			protocols = "protocol  size sockets  memory press maxhdr  slab module     cl co di ac io in de sh ss gs se re sp bi br ha uh gp em\n"
 			ptype     = "Type Device      Function\n"
-			upd6      = "  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
 		)
 		psched := fmt.Sprintf("%08x %08x %08x %08x\n", uint64(time.Microsecond/time.Nanosecond), 64, 1000000, uint64(time.Second/time.Nanosecond))
 
 		// TODO(gvisor.dev/issue/1833): Make sure file contents reflect the task
 		// network namespace.
 		contents = map[string]kernfs.Inode{
-			"dev":  fs.newInode(ctx, root, 0444, &netDevData{stack: stack}),
-			"snmp": fs.newInode(ctx, root, 0444, &netSnmpData{stack: stack}),
+			"dev":       fs.newInode(ctx, root, 0444, &netDevData{stack: stack}),
+			"dev_mcast": fs.newInode(ctx, root, 0444, &netDevMcastData{stack: stack}),
+			"netstat":   fs.newInode(ctx, root, 0444, &netStatData{stack: stack}),
+			"snmp":      fs.newInode(ctx, root, 0444, &netSnmpData{stack: stack}),
 
 			// The following files are simple stubs until they are implemented in
 			// netstack, if the file contains a header the stub is just the header
 			// otherwise it is an empty file.
 			"arp":       fs.newInode(ctx, root, 0444, newStaticFile(arp)),
 			"netlink":   fs.newInode(ctx, root, 0444, newStaticFile(netlink)),
-			"netstat":   fs.newInode(ctx, root, 0444, &netStatData{}),
 			"packet":    fs.newInode(ctx, root, 0444, newStaticFile(packet)),
 			"protocols": fs.newInode(ctx, root, 0444, newStaticFile(protocols)),
 
@@ -83,7 +85,8 @@ func (fs *filesystem) newTaskNetDir(ctx context.Context, task *kernel.Task) kern
 			contents["if_inet6"] = fs.newInode(ctx, root, 0444, &ifinet6{stack: stack})
 			contents["ipv6_route"] = fs.newInode(ctx, root, 0444, newStaticFile(""))
 			contents["tcp6"] = fs.newInode(ctx, root, 0444, &netTCP6Data{kernel: k})
-			contents["udp6"] = fs.newInode(ctx, root, 0444, newStaticFile(upd6))
+			contents["snmp6"] = fs.newInode(ctx, root, 0444, &netSnmp6Data{stack: stack})
+			contents["udp6"] = fs.newInode(ctx, root, 0444, &netUDP6Data{kernel: k})
 		}
 	}
 
@@ -191,6 +194,61 @@ func (n *netDevData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// netDevMcastData implements vfs.DynamicBytesSource for /proc/net/dev_mcast.
+//
+// +stateify savable
+type netDevMcastData struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack
+}
+
+var _ dynamicInode = (*netDevMcastData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (n *netDevMcastData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	interfaces := n.stack.Interfaces()
+	groups := n.stack.MulticastGroups()
+	idxs := make([]int32, 0, len(groups))
+	for idx := range groups {
+		idxs = append(idxs, idx)
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+
+	for _, idx := range idxs {
+		iface, ok := interfaces[idx]
+		if !ok || iface.DeviceType != linux.ARPHRD_ETHER {
+			continue
+		}
+
+		// dev_mcast lists link-layer addresses. Groups that map to the same
+		// link-layer address share an entry.
+		users := make(map[tcpip.LinkAddress]uint64)
+		for _, g := range groups[idx] {
+			addr := tcpip.AddrFromSlice(g.Addr)
+			switch len(g.Addr) {
+			case header.IPv4AddressSize:
+				users[header.EthernetAddressFromMulticastIPv4Address(addr)] += g.Users
+			case header.IPv6AddressSize:
+				users[header.EthernetAddressFromMulticastIPv6Address(addr)] += g.Users
+			}
+		}
+		addrs := make([]tcpip.LinkAddress, 0, len(users))
+		for addr := range users {
+			addrs = append(addrs, addr)
+		}
+		sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+
+		// Implements the same format as
+		// net/core/dev_addr_lists.c:dev_mc_seq_show.
+		for _, addr := range addrs {
+			fmt.Fprintf(buf, "%-4d %-15s %-5d %-5d %x\n", idx, iface.Name, users[addr], 0, []byte(addr))
+		}
+	}
+
+	return nil
+}
+
 // netUnixData implements vfs.DynamicBytesSource for /proc/net/unix.
 //
 // +stateify savable
@@ -344,6 +402,15 @@ func writeInetAddr(w io.Writer, family int, i linux.SockAddr) {
 	}
 }
 
+// queueSizes returns the number of bytes in the transmit and receive queues of
+// sops, or zeroes if sops doesn't report them.
+func queueSizes(sops socket.Socket) (tx, rx int) {
+	if qs, ok := sops.(socket.QueueSizer); ok {
+		return qs.QueueSizes()
+	}
+	return 0, 0
+}
+
 func commonGenerateTCP(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel, family int) error {
 	// t may be nil here if our caller is not part of a task goroutine. This can
 	// happen for example if we're here for "sentryctl cat". When t is nil,
@@ -395,9 +462,10 @@ func commonGenerateTCP(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel,
 		// Field: state; socket state.
 		fmt.Fprintf(buf, "%02X ", sops.State())
 
-		// Field: tx_queue, rx_queue; number of packets in the transmit and
-		// receive queue. Unimplemented.
-		fmt.Fprintf(buf, "%08X:%08X ", 0, 0)
+		// Field: tx_queue, rx_queue; number of bytes in the transmit and
+		// receive queue.
+		txQueue, rxQueue := queueSizes(sops)
+		fmt.Fprintf(buf, "%08X:%08X ", txQueue, rxQueue)
 
 		// Field: tr, tm->when; timer active state and number of jiffies
 		// until timer expires. Unimplemented.
@@ -508,14 +576,34 @@ var _ dynamicInode = (*netUDPData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (d *netUDPData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops             \n")
+	return commonGenerateUDP(ctx, buf, d.kernel, linux.AF_INET)
+}
+
+// netUDP6Data implements vfs.DynamicBytesSource for /proc/net/udp6.
+//
+// +stateify savable
+type netUDP6Data struct {
+	kernfs.DynamicBytesFile
+
+	kernel *kernel.Kernel
+}
+
+var _ dynamicInode = (*netUDP6Data)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *netUDP6Data) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	buf.WriteString("  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n")
+	return commonGenerateUDP(ctx, buf, d.kernel, linux.AF_INET6)
+}
+
+func commonGenerateUDP(ctx context.Context, buf *bytes.Buffer, k *kernel.Kernel, family int) error {
 	// t may be nil here if our caller is not part of a task goroutine. This can
 	// happen for example if we're here for "sentryctl cat". When t is nil,
 	// degrade gracefully and retrieve what we can.
 	t := kernel.TaskFromContext(ctx)
 
-	buf.WriteString("  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops             \n")
-
-	for _, se := range d.kernel.ListSockets() {
+	for _, se := range k.ListSockets() {
 		s := se.Sock
 		if !s.TryIncRef() {
 			// Racing with socket destruction, this is ok.
@@ -525,41 +613,43 @@ func (d *netUDPData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 		if !ok {
 			panic(fmt.Sprintf("Found non-socket file in socket table: %+v", s))
 		}
-		if family, stype, _ := sops.Type(); family != linux.AF_INET || stype != linux.SOCK_DGRAM {
+		if fa, stype, _ := sops.Type(); !(family == fa && stype == linux.SOCK_DGRAM) {
 			s.DecRef(ctx)
-			// Not udp4 socket.
+			// Not udp sockets of this family.
 			continue
 		}
 
-		// For Linux's implementation, see net/ipv4/udp.c:udp4_format_sock().
+		// For Linux's implementation, see net/ipv4/udp.c:udp4_format_sock()
+		// and net/ipv6/datagram.c:__ip6_dgram_sock_seq_show().
 
 		// Field: sl; entry number.
 		fmt.Fprintf(buf, "%5d: ", se.ID)
 
 		// Field: local_adddress.
-		var localAddr linux.SockAddrInet
+		var localAddr linux.SockAddr
 		if t != nil {
 			if local, _, err := sops.GetSockName(t); err == nil {
-				localAddr = *local.(*linux.SockAddrInet)
+				localAddr = local
 			}
 		}
-		writeInetAddr(buf, linux.AF_INET, &localAddr)
+		writeInetAddr(buf, family, localAddr)
 
 		// Field: rem_address.
-		var remoteAddr linux.SockAddrInet
+		var remoteAddr linux.SockAddr
 		if t != nil {
 			if remote, _, err := sops.GetPeerName(t); err == nil {
-				remoteAddr = *remote.(*linux.SockAddrInet)
+				remoteAddr = remote
 			}
 		}
-		writeInetAddr(buf, linux.AF_INET, &remoteAddr)
+		writeInetAddr(buf, family, remoteAddr)
 
 		// Field: state; socket state.
 		fmt.Fprintf(buf, "%02X ", sops.State())
 
-		// Field: tx_queue, rx_queue; number of packets in the transmit and
-		// receive queue. Unimplemented.
-		fmt.Fprintf(buf, "%08X:%08X ", 0, 0)
+		// Field: tx_queue, rx_queue; number of bytes in the transmit and
+		// receive queue.
+		txQueue, rxQueue := queueSizes(sops)
+		fmt.Fprintf(buf, "%08X:%08X ", txQueue, rxQueue)
 
 		// Field: tr, tm->when. Always 0 for UDP.
 		fmt.Fprintf(buf, "%02X:%08X ", 0, 0)
@@ -701,6 +791,102 @@ func (d *netSnmpData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	return nil
 }
 
+// netSnmp6Data implements vfs.DynamicBytesSource for /proc/net/snmp6.
+//
+// +stateify savable
+type netSnmp6Data struct {
+	kernfs.DynamicBytesFile
+
+	stack inet.Stack
+}
+
+var _ dynamicInode = (*netSnmp6Data)(nil)
+
+// icmp6Types are the ICMPv6 message types reported in /proc/net/snmp6, see
+// Linux's net/ipv6/proc.c:icmp6type2name.
+var icmp6Types = []string{
+	"DestUnreachs",
+	"PktTooBigs",
+	"TimeExcds",
+	"ParmProblems",
+	"Echos",
+	"EchoReplies",
+	"GroupMembQueries",
+	"GroupMembResponses",
+	"GroupMembReductions",
+	"RouterSolicits",
+	"RouterAdvertisements",
+	"NeighborSolicits",
+	"NeighborAdvertisements",
+	"Redirects",
+	"MLDv2Reports",
+}
+
+// snmp6 describes the sections of /proc/net/snmp6.
+var snmp6 = []struct {
+	prefix string
+	names  []string
+}{
+	{
+		prefix: "Ip6",
+		names: []string{
+			"InReceives", "InHdrErrors", "InTooBigErrors", "InNoRoutes",
+			"InAddrErrors", "InUnknownProtos", "InTruncatedPkts", "InDiscards",
+			"InDelivers", "OutForwDatagrams", "OutRequests", "OutDiscards",
+			"OutNoRoutes", "ReasmTimeout", "ReasmReqds", "ReasmOKs",
+			"ReasmFails", "FragOKs", "FragFails", "FragCreates", "InMcastPkts",
+			"OutMcastPkts", "InOctets", "OutOctets", "InMcastOctets",
+			"OutMcastOctets", "InBcastOctets", "OutBcastOctets", "InNoECTPkts",
+			"InECT1Pkts", "InECT0Pkts", "InCEPkts",
+		},
+	},
+	{
+		prefix: "Icmp6",
+		names: func() []string {
+			names := []string{"InMsgs", "InErrors", "OutMsgs", "OutErrors", "InCsumErrors"}
+			for _, dir := range []string{"In", "Out"} {
+				for _, t := range icmp6Types {
+					names = append(names, dir+t)
+				}
+			}
+			return names
+		}(),
+	},
+	{
+		prefix: "Udp6",
+		names:  []string{"InDatagrams", "NoPorts", "InErrors", "OutDatagrams", "RcvbufErrors", "SndbufErrors", "InCsumErrors", "IgnoredMulti"},
+	},
+	{
+		prefix: "UdpLite6",
+		names:  []string{"InDatagrams", "NoPorts", "InErrors", "OutDatagrams", "RcvbufErrors", "SndbufErrors", "InCsumErrors", "IgnoredMulti"},
+	},
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+// See Linux's net/ipv6/proc.c:snmp6_seq_show.
+func (d *netSnmp6Data) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	types := []any{
+		&inet.StatSNMP6IP{},
+		&inet.StatSNMP6ICMP{},
+		&inet.StatSNMP6UDP{},
+		&inet.StatSNMP6UDPLite{},
+	}
+	for i, stat := range types {
+		section := snmp6[i]
+		if err := d.stack.Statistics(stat, section.prefix); err != nil {
+			if linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
+				log.Infof("Failed to retrieve %s of /proc/net/snmp6: %v", section.prefix, err)
+			} else {
+				log.Warningf("Failed to retrieve %s of /proc/net/snmp6: %v", section.prefix, err)
+			}
+		}
+		for j, v := range toSlice(stat) {
+			fmt.Fprintf(buf, "%-32s\t%d\n", section.prefix+section.names[j], v)
+		}
+	}
+	return nil
+}
+
 // netRouteData implements vfs.DynamicBytesSource for /proc/net/route.
 //
 // +stateify savable
@@ -776,38 +962,71 @@ type netStatData struct {
 
 var _ dynamicInode = (*netStatData)(nil)
 
+// netstat describes the lines of /proc/net/netstat.
+var netstat = []snmpLine{
+	{
+		prefix: "TcpExt",
+		header: "SyncookiesSent SyncookiesRecv SyncookiesFailed " +
+			"EmbryonicRsts PruneCalled RcvPruned OfoPruned OutOfWindowIcmps " +
+			"LockDroppedIcmps ArpFilter TW TWRecycled TWKilled PAWSPassive " +
+			"PAWSActive PAWSEstab DelayedACKs DelayedACKLocked DelayedACKLost " +
+			"ListenOverflows ListenDrops TCPPrequeued TCPDirectCopyFromBacklog " +
+			"TCPDirectCopyFromPrequeue TCPPrequeueDropped TCPHPHits TCPHPHitsToUser " +
+			"TCPPureAcks TCPHPAcks TCPRenoRecovery TCPSackRecovery TCPSACKReneging " +
+			"TCPFACKReorder TCPSACKReorder TCPRenoReorder TCPTSReorder TCPFullUndo " +
+			"TCPPartialUndo TCPDSACKUndo TCPLossUndo TCPLostRetransmit " +
+			"TCPRenoFailures TCPSackFailures TCPLossFailures TCPFastRetrans " +
+			"TCPForwardRetrans TCPSlowStartRetrans TCPTimeouts TCPLossProbes " +
+			"TCPLossProbeRecovery TCPRenoRecoveryFail TCPSackRecoveryFail " +
+			"TCPSchedulerFailed TCPRcvCollapsed TCPDSACKOldSent TCPDSACKOfoSent " +
+			"TCPDSACKRecv TCPDSACKOfoRecv TCPAbortOnData TCPAbortOnClose " +
+			"TCPAbortOnMemory TCPAbortOnTimeout TCPAbortOnLinger TCPAbortFailed " +
+			"TCPMemoryPressures TCPSACKDiscard TCPDSACKIgnoredOld " +
+			"TCPDSACKIgnoredNoUndo TCPSpuriousRTOs TCPMD5NotFound TCPMD5Unexpected " +
+			"TCPMD5Failure TCPSackShifted TCPSackMerged TCPSackShiftFallback " +
+			"TCPBacklogDrop TCPMinTTLDrop TCPDeferAcceptDrop IPReversePathFilter " +
+			"TCPTimeWaitOverflow TCPReqQFullDoCookies TCPReqQFullDrop TCPRetransFail " +
+			"TCPRcvCoalesce TCPOFOQueue TCPOFODrop TCPOFOMerge TCPChallengeACK " +
+			"TCPSYNChallenge TCPFastOpenActive TCPFastOpenActiveFail " +
+			"TCPFastOpenPassive TCPFastOpenPassiveFail TCPFastOpenListenOverflow " +
+			"TCPFastOpenCookieReqd TCPSpuriousRtxHostQueues BusyPollRxPackets " +
+			"TCPAutoCorking TCPFromZeroWindowAdv TCPToZeroWindowAdv " +
+			"TCPWantZeroWindowAdv TCPSynRetrans TCPOrigDataSent TCPHystartTrainDetect " +
+			"TCPHystartTrainCwnd TCPHystartDelayDetect TCPHystartDelayCwnd " +
+			"TCPACKSkippedSynRecv TCPACKSkippedPAWS TCPACKSkippedSeq " +
+			"TCPACKSkippedFinWait2 TCPACKSkippedTimeWait TCPACKSkippedChallenge " +
+			"TCPWinProbe TCPKeepAlive TCPMTUPFail TCPMTUPSuccess",
+	},
+	{
+		prefix: "IpExt",
+		header: "InNoRoutes InTruncatedPkts InMcastPkts OutMcastPkts InBcastPkts " +
+			"OutBcastPkts InOctets OutOctets InMcastOctets OutMcastOctets " +
+			"InBcastOctets OutBcastOctets InCsumErrors InNoECTPkts InECT1Pkts " +
+			"InECT0Pkts InCEPkts ReasmOverlaps",
+	},
+}
+
 // Generate implements vfs.DynamicBytesSource.Generate.
-// See Linux's net/ipv4/fib_trie.c:fib_route_seq_show.
+// See Linux's net/ipv4/proc.c:netstat_seq_show.
 func (d *netStatData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	buf.WriteString("TcpExt: SyncookiesSent SyncookiesRecv SyncookiesFailed " +
-		"EmbryonicRsts PruneCalled RcvPruned OfoPruned OutOfWindowIcmps " +
-		"LockDroppedIcmps ArpFilter TW TWRecycled TWKilled PAWSPassive " +
-		"PAWSActive PAWSEstab DelayedACKs DelayedACKLocked DelayedACKLost " +
-		"ListenOverflows ListenDrops TCPPrequeued TCPDirectCopyFromBacklog " +
-		"TCPDirectCopyFromPrequeue TCPPrequeueDropped TCPHPHits TCPHPHitsToUser " +
-		"TCPPureAcks TCPHPAcks TCPRenoRecovery TCPSackRecovery TCPSACKReneging " +
-		"TCPFACKReorder TCPSACKReorder TCPRenoReorder TCPTSReorder TCPFullUndo " +
-		"TCPPartialUndo TCPDSACKUndo TCPLossUndo TCPLostRetransmit " +
-		"TCPRenoFailures TCPSackFailures TCPLossFailures TCPFastRetrans " +
-		"TCPForwardRetrans TCPSlowStartRetrans TCPTimeouts TCPLossProbes " +
-		"TCPLossProbeRecovery TCPRenoRecoveryFail TCPSackRecoveryFail " +
-		"TCPSchedulerFailed TCPRcvCollapsed TCPDSACKOldSent TCPDSACKOfoSent " +
-		"TCPDSACKRecv TCPDSACKOfoRecv TCPAbortOnData TCPAbortOnClose " +
-		"TCPAbortOnMemory TCPAbortOnTimeout TCPAbortOnLinger TCPAbortFailed " +
-		"TCPMemoryPressures TCPSACKDiscard TCPDSACKIgnoredOld " +
-		"TCPDSACKIgnoredNoUndo TCPSpuriousRTOs TCPMD5NotFound TCPMD5Unexpected " +
-		"TCPMD5Failure TCPSackShifted TCPSackMerged TCPSackShiftFallback " +
-		"TCPBacklogDrop TCPMinTTLDrop TCPDeferAcceptDrop IPReversePathFilter " +
-		"TCPTimeWaitOverflow TCPReqQFullDoCookies TCPReqQFullDrop TCPRetransFail " +
-		"TCPRcvCoalesce TCPOFOQueue TCPOFODrop TCPOFOMerge TCPChallengeACK " +
-		"TCPSYNChallenge TCPFastOpenActive TCPFastOpenActiveFail " +
-		"TCPFastOpenPassive TCPFastOpenPassiveFail TCPFastOpenListenOverflow " +
-		"TCPFastOpenCookieReqd TCPSpuriousRtxHostQueues BusyPollRxPackets " +
-		"TCPAutoCorking TCPFromZeroWindowAdv TCPToZeroWindowAdv " +
-		"TCPWantZeroWindowAdv TCPSynRetrans TCPOrigDataSent TCPHystartTrainDetect " +
-		"TCPHystartTrainCwnd TCPHystartDelayDetect TCPHystartDelayCwnd " +
-		"TCPACKSkippedSynRecv TCPACKSkippedPAWS TCPACKSkippedSeq " +
-		"TCPACKSkippedFinWait2 TCPACKSkippedTimeWait TCPACKSkippedChallenge " +
-		"TCPWinProbe TCPKeepAlive TCPMTUPFail TCPMTUPSuccess\n")
+	types := []any{
+		&inet.StatNetstatTCPExt{},
+		&inet.StatNetstatIPExt{},
+	}
+	for i, stat := range types {
+		line := netstat[i]
+		if d.stack == nil {
+			// Restored from a checkpoint taken before netstat reported
+			// statistics.
+		} else if err := d.stack.Statistics(stat, line.prefix); err != nil {
+			if linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
+				log.Infof("Failed to retrieve %s of /proc/net/netstat: %v", line.prefix, err)
+			} else {
+				log.Warningf("Failed to retrieve %s of /proc/net/netstat: %v", line.prefix, err)
+			}
+		}
+		fmt.Fprintf(buf, "%s: %s\n", line.prefix, line.header)
+		fmt.Fprintf(buf, "%s: %s\n", line.prefix, sprintSlice(toSlice(stat)))
+	}
 	return nil
 }
@@ -68,7 +68,7 @@ func (fs *filesystem) newTasksInode(ctx context.Context, k *kernel.Kernel, pidns
 	root := auth.NewRootCredentials(pidns.UserNamespace())
 	contents := map[string]kernfs.Inode{
 		"cmdline":        fs.newInode(ctx, root, 0444, &cmdLineData{}),
-		"cpuinfo":        fs.newInode(ctx, root, 0444, newStaticFileSetStat(cpuInfoData(k))),
+		"cpuinfo":        fs.newInode(ctx, root, 0444, &cpuInfoData{}),
 		"filesystems":    fs.newInode(ctx, root, 0444, &filesystemsData{}),
 		"loadavg":        fs.newInode(ctx, root, 0444, &loadavgData{}),
 		"sys":            fs.newSysDir(ctx, root, k),
@@ -136,7 +136,7 @@ func (i *tasksInode) IterDirents(ctx context.Context, mnt *vfs.Mount, cb vfs.Ite
 	const FIRST_PROCESS_ENTRY = 256
 
 	// Use maxTaskID to shortcut searches that will result in 0 entries.
-	const maxTaskID = kernel.TasksLimit + 1
+	maxTaskID := int64(kernel.PIDMax()) + 1
 	if offset >= maxTaskID {
 		return offset, nil
 	}
@@ -242,31 +242,30 @@ func (i *tasksInode) DecRef(ctx context.Context) {
 	i.tasksInodeRefs.DecRef(func() { i.Destroy(ctx) })
 }
 
-// staticFileSetStat implements a special static file that allows inode
-// attributes to be set. This is to support /proc files that are readonly, but
-// allow attributes to be set.
+// cpuInfoData implements vfs.DynamicBytesSource for /proc/cpuinfo.
+//
+// Like lxcfs, only the online CPUs the cpuset of the reading task allows are
+// listed, such that applications sizing their parallelism from /proc/cpuinfo
+// agree with sched_getaffinity(2).
 //
 // +stateify savable
-type staticFileSetStat struct {
+type cpuInfoData struct {
 	dynamicBytesFileSetAttr
-	vfs.StaticData
 }
 
-var _ dynamicInode = (*staticFileSetStat)(nil)
-
-func newStaticFileSetStat(data string) *staticFileSetStat {
-	return &staticFileSetStat{StaticData: vfs.StaticData{Data: data}}
-}
+var _ dynamicInode = (*cpuInfoData)(nil)
 
-func cpuInfoData(k *kernel.Kernel) string {
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (*cpuInfoData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	k := kernel.KernelFromContext(ctx)
 	features := k.FeatureSet()
-	var buf bytes.Buffer
-	for i, max := uint(0), k.ApplicationCores(); i < max; i++ {
-		features.WriteCPUInfoTo(i, &buf)
+	cpus := k.OnlineCPUs()
+	if t := kernel.TaskFromContext(ctx); t != nil {
+		cpus = t.OnlineCPUSet()
 	}
-	return buf.String()
-}
-
-func ipcData(v uint64) dynamicInode {
-	return newStaticFile(strconv.FormatUint(v, 10))
+	numCPUs := cpus.NumCPUs()
+	cpus.ForEachCPU(func(cpu uint) {
+		features.WriteCPUInfoTo(cpu, numCPUs, buf)
+	})
+	return nil
 }
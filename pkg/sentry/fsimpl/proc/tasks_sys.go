@@ -41,18 +41,30 @@ const (
 	tcpWMem
 )
 
+// +stateify savable
+type ipcLimit int
+
+const (
+	shmAll ipcLimit = iota
+	shmMax
+	shmMni
+	msgMax
+	msgMnb
+	msgMni
+)
+
 // newSysDir returns the dentry corresponding to /proc/sys directory.
 func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *kernel.Kernel) kernfs.Inode {
 	return fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 		"kernel": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 			"hostname": fs.newInode(ctx, root, 0444, &hostnameData{}),
 			"sem":      fs.newInode(ctx, root, 0444, newStaticFile(fmt.Sprintf("%d\t%d\t%d\t%d\n", linux.SEMMSL, linux.SEMMNS, linux.SEMOPM, linux.SEMMNI))),
-			"shmall":   fs.newInode(ctx, root, 0444, ipcData(linux.SHMALL)),
-			"shmmax":   fs.newInode(ctx, root, 0444, ipcData(linux.SHMMAX)),
-			"shmmni":   fs.newInode(ctx, root, 0444, ipcData(linux.SHMMNI)),
-			"msgmni":   fs.newInode(ctx, root, 0444, ipcData(linux.MSGMNI)),
-			"msgmax":   fs.newInode(ctx, root, 0444, ipcData(linux.MSGMAX)),
-			"msgmnb":   fs.newInode(ctx, root, 0444, ipcData(linux.MSGMNB)),
+			"shmall":   fs.newInode(ctx, root, 0644, &ipcLimitData{limit: shmAll}),
+			"shmmax":   fs.newInode(ctx, root, 0644, &ipcLimitData{limit: shmMax}),
+			"shmmni":   fs.newInode(ctx, root, 0644, &ipcLimitData{limit: shmMni}),
+			"msgmni":   fs.newInode(ctx, root, 0644, &ipcLimitData{limit: msgMni}),
+			"msgmax":   fs.newInode(ctx, root, 0644, &ipcLimitData{limit: msgMax}),
+			"msgmnb":   fs.newInode(ctx, root, 0644, &ipcLimitData{limit: msgMnb}),
 			"yama": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
 				"ptrace_scope": fs.newYAMAPtraceScopeFile(ctx, k, root),
 			}),
@@ -63,6 +75,10 @@ func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *
 			"overcommit_memory": fs.newInode(ctx, root, 0444, newStaticFile("0\n")),
 		}),
 		"net": fs.newSysNetDir(ctx, root, k),
+		"fs": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
+			// Mount point for binfmt_misc.
+			"binfmt_misc": fs.newStaticDir(ctx, root, nil),
+		}),
 	})
 }
 
@@ -70,17 +86,17 @@ func (fs *filesystem) newSysDir(ctx context.Context, root *auth.Credentials, k *
 func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials, k *kernel.Kernel) kernfs.Inode {
 	var contents map[string]kernfs.Inode
 
-	// TODO(gvisor.dev/issue/1833): Support for using the network stack in the
-	// network namespace of the calling process.
+	// The writable files below operate on the network stack of the network
+	// namespace of the caller.
 	if stack := k.RootNetworkNamespace().Stack(); stack != nil {
 		contents = map[string]kernfs.Inode{
 			"ipv4": fs.newStaticDir(ctx, root, map[string]kernfs.Inode{
-				"ip_forward":          fs.newInode(ctx, root, 0444, &ipForwarding{stack: stack}),
-				"ip_local_port_range": fs.newInode(ctx, root, 0644, &portRange{stack: stack}),
-				"tcp_recovery":        fs.newInode(ctx, root, 0644, &tcpRecoveryData{stack: stack}),
-				"tcp_rmem":            fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpRMem}),
-				"tcp_sack":            fs.newInode(ctx, root, 0644, &tcpSackData{stack: stack}),
-				"tcp_wmem":            fs.newInode(ctx, root, 0644, &tcpMemData{stack: stack, dir: tcpWMem}),
+				"ip_forward":          fs.newInode(ctx, root, 0644, &ipForwarding{}),
+				"ip_local_port_range": fs.newInode(ctx, root, 0644, &portRange{}),
+				"tcp_recovery":        fs.newInode(ctx, root, 0644, &tcpRecoveryData{}),
+				"tcp_rmem":            fs.newInode(ctx, root, 0644, &tcpMemData{dir: tcpRMem}),
+				"tcp_sack":            fs.newInode(ctx, root, 0644, &tcpSackData{}),
+				"tcp_wmem":            fs.newInode(ctx, root, 0644, &tcpMemData{dir: tcpWMem}),
 
 				// The following files are simple stubs until they are implemented in
 				// netstack, most of these files are configuration related. We use the
@@ -139,6 +155,18 @@ func (fs *filesystem) newSysNetDir(ctx context.Context, root *auth.Credentials,
 	return fs.newStaticDir(ctx, root, contents)
 }
 
+// netStackFromContext returns the network stack of the network namespace of
+// the caller.
+func netStackFromContext(ctx context.Context) (inet.Stack, error) {
+	stack := inet.StackFromContext(ctx)
+	if stack == nil {
+		// The network namespace has no stack, e.g. because the sandbox
+		// doesn't create stacks for new network namespaces.
+		return nil, linuxerr.ENODEV
+	}
+	return stack, nil
+}
+
 // mmapMinAddrData implements vfs.DynamicBytesSource for
 // /proc/sys/vm/mmap_min_addr.
 //
@@ -180,31 +208,29 @@ func (*hostnameData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 // +stateify savable
 type tcpSackData struct {
 	kernfs.DynamicBytesFile
-
-	stack   inet.Stack `state:"wait"`
-	enabled *bool
 }
 
 var _ vfs.WritableDynamicBytesSource = (*tcpSackData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (d *tcpSackData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	if d.enabled == nil {
-		sack, err := d.stack.TCPSACKEnabled()
-		if err != nil {
-			return err
-		}
-		d.enabled = &sack
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	enabled, err := stack.TCPSACKEnabled()
+	if err != nil {
+		return err
 	}
 
 	val := "0\n"
-	if *d.enabled {
+	if enabled {
 		// Technically, this is not quite compatible with Linux. Linux stores these
 		// as an integer, so if you write "2" into tcp_sack, you should get 2 back.
 		// Tough luck.
 		val = "1\n"
 	}
-	_, err := buf.WriteString(val)
+	_, err = buf.WriteString(val)
 	return err
 }
 
@@ -226,11 +252,11 @@ func (d *tcpSackData) Write(ctx context.Context, _ *vfs.FileDescription, src use
 	if err != nil {
 		return 0, err
 	}
-	if d.enabled == nil {
-		d.enabled = new(bool)
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
+		return 0, err
 	}
-	*d.enabled = v != 0
-	return n, d.stack.SetTCPSACKEnabled(*d.enabled)
+	return n, stack.SetTCPSACKEnabled(v != 0)
 }
 
 // tcpRecoveryData implements vfs.WritableDynamicBytesSource for
@@ -239,15 +265,17 @@ func (d *tcpSackData) Write(ctx context.Context, _ *vfs.FileDescription, src use
 // +stateify savable
 type tcpRecoveryData struct {
 	kernfs.DynamicBytesFile
-
-	stack inet.Stack `state:"wait"`
 }
 
 var _ vfs.WritableDynamicBytesSource = (*tcpRecoveryData)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (d *tcpRecoveryData) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	recovery, err := d.stack.TCPRecovery()
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	recovery, err := stack.TCPRecovery()
 	if err != nil {
 		return err
 	}
@@ -274,7 +302,11 @@ func (d *tcpRecoveryData) Write(ctx context.Context, _ *vfs.FileDescription, src
 	if err != nil {
 		return 0, err
 	}
-	if err := d.stack.SetTCPRecovery(inet.TCPLossRecovery(v)); err != nil {
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := stack.SetTCPRecovery(inet.TCPLossRecovery(v)); err != nil {
 		return 0, err
 	}
 	return n, nil
@@ -287,8 +319,7 @@ func (d *tcpRecoveryData) Write(ctx context.Context, _ *vfs.FileDescription, src
 type tcpMemData struct {
 	kernfs.DynamicBytesFile
 
-	dir   tcpMemDir
-	stack inet.Stack `state:"wait"`
+	dir tcpMemDir
 
 	// mu protects against concurrent reads/writes to FDs based on the dentry
 	// backing this byte source.
@@ -302,7 +333,11 @@ func (d *tcpMemData) Generate(ctx context.Context, buf *bytes.Buffer) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	size, err := d.readSizeLocked()
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	size, err := d.readSizeLocked(stack)
 	if err != nil {
 		return err
 	}
@@ -324,7 +359,11 @@ func (d *tcpMemData) Write(ctx context.Context, _ *vfs.FileDescription, src user
 
 	// Limit the amount of memory allocated.
 	src = src.TakeFirst(hostarch.PageSize - 1)
-	size, err := d.readSizeLocked()
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	size, err := d.readSizeLocked(stack)
 	if err != nil {
 		return 0, err
 	}
@@ -338,31 +377,31 @@ func (d *tcpMemData) Write(ctx context.Context, _ *vfs.FileDescription, src user
 		Default: int(buf[1]),
 		Max:     int(buf[2]),
 	}
-	if err := d.writeSizeLocked(newSize); err != nil {
+	if err := d.writeSizeLocked(stack, newSize); err != nil {
 		return 0, err
 	}
 	return n, nil
 }
 
 // Precondition: d.mu must be locked.
-func (d *tcpMemData) readSizeLocked() (inet.TCPBufferSize, error) {
+func (d *tcpMemData) readSizeLocked(stack inet.Stack) (inet.TCPBufferSize, error) {
 	switch d.dir {
 	case tcpRMem:
-		return d.stack.TCPReceiveBufferSize()
+		return stack.TCPReceiveBufferSize()
 	case tcpWMem:
-		return d.stack.TCPSendBufferSize()
+		return stack.TCPSendBufferSize()
 	default:
 		panic(fmt.Sprintf("unknown tcpMemFile type: %v", d.dir))
 	}
 }
 
 // Precondition: d.mu must be locked.
-func (d *tcpMemData) writeSizeLocked(size inet.TCPBufferSize) error {
+func (d *tcpMemData) writeSizeLocked(stack inet.Stack, size inet.TCPBufferSize) error {
 	switch d.dir {
 	case tcpRMem:
-		return d.stack.SetTCPReceiveBufferSize(size)
+		return stack.SetTCPReceiveBufferSize(size)
 	case tcpWMem:
-		return d.stack.SetTCPSendBufferSize(size)
+		return stack.SetTCPSendBufferSize(size)
 	default:
 		panic(fmt.Sprintf("unknown tcpMemFile type: %v", d.dir))
 	}
@@ -374,17 +413,18 @@ func (d *tcpMemData) writeSizeLocked(size inet.TCPBufferSize) error {
 // +stateify savable
 type ipForwarding struct {
 	kernfs.DynamicBytesFile
-
-	stack   inet.Stack `state:"wait"`
-	enabled bool
 }
 
 var _ vfs.WritableDynamicBytesSource = (*ipForwarding)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (ipf *ipForwarding) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
+		return err
+	}
 	val := "0\n"
-	if ipf.enabled {
+	if stack.Forwarding(ipv4.ProtocolNumber) {
 		// Technically, this is not quite compatible with Linux. Linux stores these
 		// as an integer, so if you write "2" into tcp_sack, you should get 2 back.
 		// Tough luck.
@@ -413,8 +453,11 @@ func (ipf *ipForwarding) Write(ctx context.Context, _ *vfs.FileDescription, src
 	if err != nil {
 		return 0, err
 	}
-	ipf.enabled = v != 0
-	if err := ipf.stack.SetForwarding(ipv4.ProtocolNumber, ipf.enabled); err != nil {
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := stack.SetForwarding(ipv4.ProtocolNumber, v != 0); err != nil {
 		return 0, err
 	}
 	return n, nil
@@ -426,25 +469,18 @@ func (ipf *ipForwarding) Write(ctx context.Context, _ *vfs.FileDescription, src
 // +stateify savable
 type portRange struct {
 	kernfs.DynamicBytesFile
-
-	stack inet.Stack `state:"wait"`
-
-	// start and end store the port range. We must save/restore this here,
-	// since a netstack instance is created on restore.
-	start *uint16
-	end   *uint16
 }
 
 var _ vfs.WritableDynamicBytesSource = (*portRange)(nil)
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (pr *portRange) Generate(ctx context.Context, buf *bytes.Buffer) error {
-	if pr.start == nil {
-		start, end := pr.stack.PortRange()
-		pr.start = &start
-		pr.end = &end
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
+		return err
 	}
-	_, err := fmt.Fprintf(buf, "%d %d\n", *pr.start, *pr.end)
+	start, end := stack.PortRange()
+	_, err = fmt.Fprintf(buf, "%d %d\n", start, end)
 	return err
 }
 
@@ -473,14 +509,106 @@ func (pr *portRange) Write(ctx context.Context, _ *vfs.FileDescription, src user
 		return 0, linuxerr.EINVAL
 	}
 
-	if err := pr.stack.SetPortRange(uint16(ports[0]), uint16(ports[1])); err != nil {
+	stack, err := netStackFromContext(ctx)
+	if err != nil {
 		return 0, err
 	}
-	if pr.start == nil {
-		pr.start = new(uint16)
-		pr.end = new(uint16)
+	if err := stack.SetPortRange(uint16(ports[0]), uint16(ports[1])); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ipcLimitData implements vfs.WritableDynamicBytesSource for
+// /proc/sys/kernel/shm{all,max,mni} and /proc/sys/kernel/msg{max,mnb,mni}. The
+// limits belong to the IPC namespace of the caller.
+//
+// +stateify savable
+type ipcLimitData struct {
+	kernfs.DynamicBytesFile
+
+	limit ipcLimit
+}
+
+var _ vfs.WritableDynamicBytesSource = (*ipcLimitData)(nil)
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (d *ipcLimitData) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	ipcns := kernel.IPCNamespaceFromContext(ctx)
+	if ipcns == nil {
+		return linuxerr.EINVAL
+	}
+	defer ipcns.DecRef(ctx)
+
+	var v uint64
+	switch d.limit {
+	case shmAll:
+		v = ipcns.ShmRegistry().IPCInfo().ShmAll
+	case shmMax:
+		v = ipcns.ShmRegistry().IPCInfo().ShmMax
+	case shmMni:
+		v = ipcns.ShmRegistry().IPCInfo().ShmMni
+	case msgMax:
+		v = uint64(ipcns.MsgqueueRegistry().IPCInfo(ctx).MsgMax)
+	case msgMnb:
+		v = uint64(ipcns.MsgqueueRegistry().IPCInfo(ctx).MsgMnb)
+	case msgMni:
+		v = uint64(ipcns.MsgqueueRegistry().IPCInfo(ctx).MsgMni)
+	default:
+		panic(fmt.Sprintf("unknown IPC limit: %v", d.limit))
+	}
+	_, err := fmt.Fprintf(buf, "%d\n", v)
+	return err
+}
+
+// Write implements vfs.WritableDynamicBytesSource.Write.
+func (d *ipcLimitData) Write(ctx context.Context, _ *vfs.FileDescription, src usermem.IOSequence, offset int64) (int64, error) {
+	if offset != 0 {
+		// No need to handle partial writes thus far.
+		return 0, linuxerr.EINVAL
+	}
+	if src.NumBytes() == 0 {
+		return 0, nil
+	}
+
+	// Limit input size so as not to impact performance if input size is
+	// large.
+	src = src.TakeFirst(hostarch.PageSize - 1)
+
+	var v uint64
+	n, err := usermem.CopyUint64StringInVec(ctx, src.IO, src.Addrs, &v, src.Opts)
+	if err != nil {
+		return 0, err
+	}
+
+	ipcns := kernel.IPCNamespaceFromContext(ctx)
+	if ipcns == nil {
+		return 0, linuxerr.EINVAL
+	}
+	defer ipcns.DecRef(ctx)
+
+	// The msg limits are ints in Linux.
+	if (d.limit == msgMax || d.limit == msgMnb || d.limit == msgMni) && v > math.MaxInt32 {
+		return 0, linuxerr.EINVAL
+	}
+	switch d.limit {
+	case shmAll:
+		ipcns.ShmRegistry().SetShmAll(v)
+	case shmMax:
+		ipcns.ShmRegistry().SetShmMax(v)
+	case shmMni:
+		err = ipcns.ShmRegistry().SetShmMni(v)
+	case msgMax:
+		err = ipcns.MsgqueueRegistry().SetMsgMax(int32(v))
+	case msgMnb:
+		err = ipcns.MsgqueueRegistry().SetMsgMnb(int32(v))
+	case msgMni:
+		err = ipcns.MsgqueueRegistry().SetMsgMni(int32(v))
+	default:
+		panic(fmt.Sprintf("unknown IPC limit: %v", d.limit))
+	}
+	if err != nil {
+		return 0, err
 	}
-	*pr.start = uint16(ports[0])
-	*pr.end = uint16(ports[1])
 	return n, nil
 }
@@ -0,0 +1,180 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sys
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/cpuid"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/kernfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/sched"
+)
+
+// The topology presented to applications is synthesized: the application
+// cores form a single package and die, each core running a single thread.
+// This keeps the parallelism computed from the topology, e.g. by OpenMP or the
+// JVM, equal to the number of application cores, whatever the host topology.
+
+// newCPUDir returns the /sys/devices/system/cpu/cpu<cpu> directory.
+func (fs *filesystem) newCPUDir(ctx context.Context, creds *auth.Credentials, cpu, numCPUs uint, caches []cpuid.Cache) kernfs.Inode {
+	self := sched.NewCPUSet(numCPUs)
+	self.Set(cpu)
+	all := sched.NewFullCPUSet(numCPUs)
+	file := func(data string) kernfs.Inode {
+		return fs.newStaticFile(ctx, creds, defaultSysMode, data+"\n")
+	}
+	children := map[string]kernfs.Inode{
+		"topology": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"core_cpus":            file(formatCPUMask(self, numCPUs)),
+			"core_cpus_list":       file(formatCPUList(self)),
+			"core_id":              file(fmt.Sprint(cpu)),
+			"core_siblings":        file(formatCPUMask(all, numCPUs)),
+			"core_siblings_list":   file(formatCPUList(all)),
+			"die_cpus":             file(formatCPUMask(all, numCPUs)),
+			"die_cpus_list":        file(formatCPUList(all)),
+			"die_id":               file("0"),
+			"package_cpus":         file(formatCPUMask(all, numCPUs)),
+			"package_cpus_list":    file(formatCPUList(all)),
+			"physical_package_id":  file("0"),
+			"thread_siblings":      file(formatCPUMask(self, numCPUs)),
+			"thread_siblings_list": file(formatCPUList(self)),
+		}),
+	}
+	if cpu != 0 {
+		// Like on x86, the boot CPU can't be taken offline.
+		children["online"] = fs.newCPUOnlineFile(ctx, creds, cpu)
+	}
+	if len(caches) == 0 {
+		return fs.newDir(ctx, creds, defaultSysDirMode, children)
+	}
+
+	cacheChildren := make(map[string]kernfs.Inode, len(caches))
+	for i, c := range caches {
+		// Only the last level caches are shared between cores.
+		shared, id := self, cpu
+		if c.Level > 2 {
+			shared, id = all, 0
+		}
+		size := c.LineSize * c.Partitions * c.Ways * c.Sets
+		cacheChildren[fmt.Sprintf("index%d", i)] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"coherency_line_size":     file(fmt.Sprint(c.LineSize)),
+			"id":                      file(fmt.Sprint(id)),
+			"level":                   file(fmt.Sprint(c.Level)),
+			"number_of_sets":          file(fmt.Sprint(c.Sets)),
+			"physical_line_partition": file(fmt.Sprint(c.Partitions)),
+			"shared_cpu_list":         file(formatCPUList(shared)),
+			"shared_cpu_map":          file(formatCPUMask(shared, numCPUs)),
+			"size":                    file(fmt.Sprintf("%dK", size/1024)),
+			"type":                    file(cacheTypeName(c.Type)),
+			"ways_of_associativity":   file(fmt.Sprint(c.Ways)),
+		})
+	}
+	children["cache"] = fs.newDir(ctx, creds, defaultSysDirMode, cacheChildren)
+	return fs.newDir(ctx, creds, defaultSysDirMode, children)
+}
+
+// cpuOnlineFile implements kernfs.Inode for
+// /sys/devices/system/cpu/cpu<cpu>/online. CPUs are brought online or offline
+// with Kernel.SetOnlineCores, so the file isn't writable.
+//
+// +stateify savable
+type cpuOnlineFile struct {
+	implStatFS
+	kernfs.DynamicBytesFile
+
+	cpu uint
+}
+
+// Generate implements vfs.DynamicBytesSource.Generate.
+func (c *cpuOnlineFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if c.cpu < kernel.KernelFromContext(ctx).OnlineCores() {
+		buf.WriteString("1\n")
+	} else {
+		buf.WriteString("0\n")
+	}
+	return nil
+}
+
+func (fs *filesystem) newCPUOnlineFile(ctx context.Context, creds *auth.Credentials, cpu uint) kernfs.Inode {
+	c := &cpuOnlineFile{cpu: cpu}
+	c.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), c, defaultSysMode)
+	return c
+}
+
+// cacheTypeName returns the name of a cache type, as in
+// drivers/base/cacheinfo.c:type_show.
+func cacheTypeName(t cpuid.CacheType) string {
+	switch t {
+	case cpuid.CacheData:
+		return "Data"
+	case cpuid.CacheInstruction:
+		return "Instruction"
+	default:
+		return "Unified"
+	}
+}
+
+// formatCPUList formats cpus as a list of ranges, e.g. "0-2,4", like
+// bitmap_print_to_pagebuf with list set.
+func formatCPUList(cpus sched.CPUSet) string {
+	var b strings.Builder
+	first, last := -1, -1
+	flush := func() {
+		if first < 0 {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		if first == last {
+			fmt.Fprintf(&b, "%d", first)
+		} else {
+			fmt.Fprintf(&b, "%d-%d", first, last)
+		}
+	}
+	cpus.ForEachCPU(func(cpu uint) {
+		if int(cpu) != last+1 || first < 0 {
+			flush()
+			first = int(cpu)
+		}
+		last = int(cpu)
+	})
+	flush()
+	return b.String()
+}
+
+// formatCPUMask formats the first numCPUs CPUs of cpus as a hexadecimal
+// mask, in comma-separated groups of 32 bits, like bitmap_print_to_pagebuf
+// without list set.
+func formatCPUMask(cpus sched.CPUSet, numCPUs uint) string {
+	words := (numCPUs + 31) / 32
+	groups := make([]string, 0, words)
+	for w := int(words) - 1; w >= 0; w-- {
+		var word uint32
+		for bit := uint(0); bit < 32; bit++ {
+			if cpus.IsSet(uint(w)*32 + bit) {
+				word |= 1 << bit
+			}
+		}
+		groups = append(groups, fmt.Sprintf("%08x", word))
+	}
+	return strings.Join(groups, ",")
+}
@@ -17,10 +17,12 @@ package sys
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/kernfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
@@ -28,28 +30,116 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
 )
 
+// netDir is a directory containing a subdirectory for each network interface
+// of the network namespace of the caller. Its contents are looked up on each
+// access, so that interfaces added or removed at runtime show up.
+//
+// +stateify savable
+type netDir struct {
+	dir
+
+	fs    *filesystem
+	creds *auth.Credentials
+	mode  linux.FileMode
+}
+
 // newNetDir returns a directory containing a subdirectory for each network
 // interface.
-func (fs *filesystem) newNetDir(ctx context.Context, creds *auth.Credentials, mode linux.FileMode) map[string]kernfs.Inode {
-	// Get list of interfaces.
+func (fs *filesystem) newNetDir(ctx context.Context, creds *auth.Credentials, mode linux.FileMode) kernfs.Inode {
+	d := &netDir{fs: fs, creds: creds, mode: mode}
+	d.InodeAttrs.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), linux.ModeDirectory|0755)
+	d.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+	d.InitRefs()
+	return d
+}
+
+// Lookup implements kernfs.inodeDirectory.Lookup.
+func (d *netDir) Lookup(ctx context.Context, name string) (kernfs.Inode, error) {
 	stk := inet.StackFromContext(ctx)
 	if stk == nil {
-		return map[string]kernfs.Inode{}
+		return nil, linuxerr.ENOENT
 	}
-
-	subDirs := make(map[string]kernfs.Inode)
 	for idx, iface := range stk.Interfaces() {
-		subDirs[iface.Name] = fs.newIfaceDir(ctx, creds, mode, idx, stk)
+		if iface.Name == name {
+			return d.fs.newIfaceDir(ctx, d.creds, d.mode, idx, name, stk), nil
+		}
 	}
-	return subDirs
+	return nil, linuxerr.ENOENT
+}
+
+// IterDirents implements kernfs.inodeDirectory.IterDirents.
+func (d *netDir) IterDirents(ctx context.Context, mnt *vfs.Mount, cb vfs.IterDirentsCallback, offset, relOffset int64) (int64, error) {
+	stk := inet.StackFromContext(ctx)
+	if stk == nil {
+		return offset, nil
+	}
+	var names []string
+	for _, iface := range stk.Interfaces() {
+		names = append(names, iface.Name)
+	}
+	if relOffset >= int64(len(names)) {
+		return offset, nil
+	}
+	sort.Strings(names)
+	for _, name := range names[relOffset:] {
+		dirent := vfs.Dirent{
+			Name:    name,
+			Type:    linux.DT_DIR,
+			Ino:     d.fs.NextIno(),
+			NextOff: offset + 1,
+		}
+		if err := cb.Handle(dirent); err != nil {
+			return offset, err
+		}
+		offset++
+	}
+	return offset, nil
+}
+
+// Open implements kernfs.Inode.Open.
+func (d *netDir) Open(ctx context.Context, rp *vfs.ResolvingPath, kd *kernfs.Dentry, opts vfs.OpenOptions) (*vfs.FileDescription, error) {
+	opts.Flags &= linux.O_ACCMODE | linux.O_CREAT | linux.O_EXCL | linux.O_TRUNC |
+		linux.O_DIRECTORY | linux.O_NOFOLLOW | linux.O_NONBLOCK | linux.O_NOCTTY
+	fd, err := kernfs.NewGenericDirectoryFD(rp.Mount(), kd, &d.OrderedChildren, &d.locks, &opts, kernfs.GenericDirectoryFDOptions{
+		SeekEnd: kernfs.SeekEndZero,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fd.VFSFileDescription(), nil
+}
+
+// ifaceDir is a directory containing per-interface files.
+//
+// +stateify savable
+type ifaceDir struct {
+	dir
+
+	idx  int32
+	name string
+	stk  inet.Stack
 }
 
 // newIfaceDir returns a directory containing per-interface files.
-func (fs *filesystem) newIfaceDir(ctx context.Context, creds *auth.Credentials, mode linux.FileMode, idx int32, stk inet.Stack) kernfs.Inode {
+func (fs *filesystem) newIfaceDir(ctx context.Context, creds *auth.Credentials, mode linux.FileMode, idx int32, name string, stk inet.Stack) kernfs.Inode {
 	files := map[string]kernfs.Inode{
 		"gro_flush_timeout": fs.newGROTimeoutFile(ctx, creds, mode, idx, stk),
+		"ifindex":           fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("%d\n", idx)),
+		"uevent":            fs.newStaticFile(ctx, creds, defaultSysMode, fmt.Sprintf("INTERFACE=%s\nIFINDEX=%d\n", name, idx)),
 	}
-	return fs.newDir(ctx, creds, mode, files)
+	d := &ifaceDir{idx: idx, name: name, stk: stk}
+	d.InodeAttrs.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), linux.ModeDirectory|0755)
+	d.OrderedChildren.Init(kernfs.OrderedChildrenOptions{})
+	d.InitRefs()
+	d.IncLinks(d.OrderedChildren.Populate(files))
+	return d
+}
+
+// Valid implements kernfs.Inode.Valid. The directory is looked up again once
+// the interface is removed or renamed.
+func (d *ifaceDir) Valid(ctx context.Context) bool {
+	iface, ok := d.stk.Interfaces()[d.idx]
+	return ok && iface.Name == d.name
 }
 
 // groTimeoutFile enables the reading and writing of the GRO timeout.
@@ -112,7 +112,10 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 
 	classSub := map[string]kernfs.Inode{
 		"power_supply": fs.newDir(ctx, creds, defaultSysDirMode, nil),
-		"net":          fs.newDir(ctx, creds, defaultSysDirMode, fs.newNetDir(ctx, creds, defaultSysDirMode)),
+		"net":          fs.newNetDir(ctx, creds, defaultSysDirMode),
+	}
+	virtualSub := map[string]kernfs.Inode{
+		"net": fs.newNetDir(ctx, creds, defaultSysDirMode),
 	}
 	devicesSub := map[string]kernfs.Inode{
 		"system": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
@@ -155,14 +158,24 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		classSub["dmi"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
 			"id": kernfs.NewStaticSymlink(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), "../../devices/virtual/dmi/id"),
 		})
-		devicesSub["virtual"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
-			"dmi": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
-				"id": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
-					"product_name": fs.newStaticFile(ctx, creds, defaultSysMode, productName+"\n"),
-				}),
+		virtualSub["dmi"] = fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+			"id": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+				"product_name": fs.newStaticFile(ctx, creds, defaultSysMode, productName+"\n"),
 			}),
 		})
 	}
+	devicesSub["virtual"] = fs.newDir(ctx, creds, defaultSysDirMode, virtualSub)
+	var moduleSub map[string]kernfs.Inode
+	if vfsObj.LSM() == vfs.LSMAppArmor {
+		// Checked by systemd and libapparmor to tell if AppArmor is enabled.
+		moduleSub = map[string]kernfs.Inode{
+			"apparmor": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+				"parameters": fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
+					"enabled": fs.newStaticFile(ctx, creds, defaultSysMode, "Y\n"),
+				}),
+			}),
+		}
+	}
 	root := fs.newDir(ctx, creds, defaultSysDirMode, map[string]kernfs.Inode{
 		"block":    fs.newDir(ctx, creds, defaultSysDirMode, nil),
 		"bus":      fs.newDir(ctx, creds, defaultSysDirMode, busSub),
@@ -172,7 +185,7 @@ func (fsType FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		"firmware": fs.newDir(ctx, creds, defaultSysDirMode, nil),
 		"fs":       fs.newDir(ctx, creds, defaultSysDirMode, fsDirChildren),
 		"kernel":   kernelDir(ctx, fs, creds),
-		"module":   fs.newDir(ctx, creds, defaultSysDirMode, nil),
+		"module":   fs.newDir(ctx, creds, defaultSysDirMode, moduleSub),
 		"power":    fs.newDir(ctx, creds, defaultSysDirMode, nil),
 	})
 	var rootD kernfs.Dentry
@@ -184,12 +197,13 @@ func cpuDir(ctx context.Context, fs *filesystem, creds *auth.Credentials) kernfs
 	k := kernel.KernelFromContext(ctx)
 	maxCPUCores := k.ApplicationCores()
 	children := map[string]kernfs.Inode{
-		"online":   fs.newCPUFile(ctx, creds, maxCPUCores, linux.FileMode(0444)),
-		"possible": fs.newCPUFile(ctx, creds, maxCPUCores, linux.FileMode(0444)),
-		"present":  fs.newCPUFile(ctx, creds, maxCPUCores, linux.FileMode(0444)),
+		"online":   fs.newCPUFile(ctx, creds, maxCPUCores, true /* online */, linux.FileMode(0444)),
+		"possible": fs.newCPUFile(ctx, creds, maxCPUCores, false /* online */, linux.FileMode(0444)),
+		"present":  fs.newCPUFile(ctx, creds, maxCPUCores, false /* online */, linux.FileMode(0444)),
 	}
+	caches := k.FeatureSet().Caches()
 	for i := uint(0); i < maxCPUCores; i++ {
-		children[fmt.Sprintf("cpu%d", i)] = fs.newDir(ctx, creds, linux.FileMode(0555), nil)
+		children[fmt.Sprintf("cpu%d", i)] = fs.newCPUDir(ctx, creds, i, maxCPUCores, caches)
 	}
 	return fs.newDir(ctx, creds, defaultSysDirMode, children)
 }
@@ -283,16 +297,29 @@ type cpuFile struct {
 	kernfs.DynamicBytesFile
 
 	maxCores uint
+
+	// online is true if the file lists the online CPUs rather than all of
+	// them. Like lxcfs does, only the CPUs the cpuset of the reading task
+	// allows are listed.
+	online bool
 }
 
 // Generate implements vfs.DynamicBytesSource.Generate.
 func (c *cpuFile) Generate(ctx context.Context, buf *bytes.Buffer) error {
+	if c.online {
+		cpus := kernel.KernelFromContext(ctx).OnlineCPUs()
+		if t := kernel.TaskFromContext(ctx); t != nil {
+			cpus = t.OnlineCPUSet()
+		}
+		fmt.Fprintf(buf, "%s\n", formatCPUList(cpus))
+		return nil
+	}
 	fmt.Fprintf(buf, "0-%d\n", c.maxCores-1)
 	return nil
 }
 
-func (fs *filesystem) newCPUFile(ctx context.Context, creds *auth.Credentials, maxCores uint, mode linux.FileMode) kernfs.Inode {
-	c := &cpuFile{maxCores: maxCores}
+func (fs *filesystem) newCPUFile(ctx context.Context, creds *auth.Credentials, maxCores uint, online bool, mode linux.FileMode) kernfs.Inode {
+	c := &cpuFile{maxCores: maxCores, online: online}
 	c.DynamicBytesFile.Init(ctx, creds, linux.UNNAMED_MAJOR, fs.devMinor, fs.NextIno(), c, mode)
 	return c
 }
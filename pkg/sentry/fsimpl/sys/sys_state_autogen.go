@@ -6,6 +6,37 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/state"
 )
 
+func (c *cpuOnlineFile) StateTypeName() string {
+	return "pkg/sentry/fsimpl/sys.cpuOnlineFile"
+}
+
+func (c *cpuOnlineFile) StateFields() []string {
+	return []string{
+		"implStatFS",
+		"DynamicBytesFile",
+		"cpu",
+	}
+}
+
+func (c *cpuOnlineFile) beforeSave() {}
+
+// +checklocksignore
+func (c *cpuOnlineFile) StateSave(stateSinkObject state.Sink) {
+	c.beforeSave()
+	stateSinkObject.Save(0, &c.implStatFS)
+	stateSinkObject.Save(1, &c.DynamicBytesFile)
+	stateSinkObject.Save(2, &c.cpu)
+}
+
+func (c *cpuOnlineFile) afterLoad() {}
+
+// +checklocksignore
+func (c *cpuOnlineFile) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &c.implStatFS)
+	stateSourceObject.Load(1, &c.DynamicBytesFile)
+	stateSourceObject.Load(2, &c.cpu)
+}
+
 func (r *dirRefs) StateTypeName() string {
 	return "pkg/sentry/fsimpl/sys.dirRefs"
 }
@@ -110,6 +141,74 @@ func (fd *kcovFD) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(4, &fd.kcov)
 }
 
+func (n *netDir) StateTypeName() string {
+	return "pkg/sentry/fsimpl/sys.netDir"
+}
+
+func (n *netDir) StateFields() []string {
+	return []string{
+		"dir",
+		"fs",
+		"creds",
+		"mode",
+	}
+}
+
+func (n *netDir) beforeSave() {}
+
+// +checklocksignore
+func (n *netDir) StateSave(stateSinkObject state.Sink) {
+	n.beforeSave()
+	stateSinkObject.Save(0, &n.dir)
+	stateSinkObject.Save(1, &n.fs)
+	stateSinkObject.Save(2, &n.creds)
+	stateSinkObject.Save(3, &n.mode)
+}
+
+func (n *netDir) afterLoad() {}
+
+// +checklocksignore
+func (n *netDir) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &n.dir)
+	stateSourceObject.Load(1, &n.fs)
+	stateSourceObject.Load(2, &n.creds)
+	stateSourceObject.Load(3, &n.mode)
+}
+
+func (i *ifaceDir) StateTypeName() string {
+	return "pkg/sentry/fsimpl/sys.ifaceDir"
+}
+
+func (i *ifaceDir) StateFields() []string {
+	return []string{
+		"dir",
+		"idx",
+		"name",
+		"stk",
+	}
+}
+
+func (i *ifaceDir) beforeSave() {}
+
+// +checklocksignore
+func (i *ifaceDir) StateSave(stateSinkObject state.Sink) {
+	i.beforeSave()
+	stateSinkObject.Save(0, &i.dir)
+	stateSinkObject.Save(1, &i.idx)
+	stateSinkObject.Save(2, &i.name)
+	stateSinkObject.Save(3, &i.stk)
+}
+
+func (i *ifaceDir) afterLoad() {}
+
+// +checklocksignore
+func (i *ifaceDir) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &i.dir)
+	stateSourceObject.Load(1, &i.idx)
+	stateSourceObject.Load(2, &i.name)
+	stateSourceObject.Load(3, &i.stk)
+}
+
 func (gf *groTimeoutFile) StateTypeName() string {
 	return "pkg/sentry/fsimpl/sys.groTimeoutFile"
 }
@@ -282,6 +381,7 @@ func (c *cpuFile) StateFields() []string {
 		"implStatFS",
 		"DynamicBytesFile",
 		"maxCores",
+		"online",
 	}
 }
 
@@ -293,6 +393,7 @@ func (c *cpuFile) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(0, &c.implStatFS)
 	stateSinkObject.Save(1, &c.DynamicBytesFile)
 	stateSinkObject.Save(2, &c.maxCores)
+	stateSinkObject.Save(3, &c.online)
 }
 
 func (c *cpuFile) afterLoad() {}
@@ -302,6 +403,7 @@ func (c *cpuFile) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &c.implStatFS)
 	stateSourceObject.Load(1, &c.DynamicBytesFile)
 	stateSourceObject.Load(2, &c.maxCores)
+	stateSourceObject.Load(3, &c.online)
 }
 
 func (i *implStatFS) StateTypeName() string {
@@ -382,9 +484,12 @@ func (hf *hostFile) StateLoad(stateSourceObject state.Source) {
 }
 
 func init() {
+	state.Register((*cpuOnlineFile)(nil))
 	state.Register((*dirRefs)(nil))
 	state.Register((*kcovInode)(nil))
 	state.Register((*kcovFD)(nil))
+	state.Register((*netDir)(nil))
+	state.Register((*ifaceDir)(nil))
 	state.Register((*groTimeoutFile)(nil))
 	state.Register((*FilesystemType)(nil))
 	state.Register((*InternalData)(nil))
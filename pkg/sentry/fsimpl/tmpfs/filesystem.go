@@ -16,11 +16,13 @@ package tmpfs
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsmetric"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix/transport"
@@ -945,9 +947,57 @@ func (fs *filesystem) PrependPath(ctx context.Context, vfsroot, vd vfs.VirtualDe
 
 // MountOptions implements vfs.FilesystemImpl.MountOptions.
 func (fs *filesystem) MountOptions() string {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
 	return fs.mopts
 }
 
+// Remount implements vfs.FilesystemRemounter.Remount. Only the size option
+// can be changed; like Linux, the mode, uid and gid options are ignored since
+// they only apply to the root directory when the filesystem is created. The
+// size can't be reduced below the number of pages in use.
+func (fs *filesystem) Remount(ctx context.Context, creds *auth.Credentials, data string) error {
+	mopts := vfs.GenericParseMountOptions(data)
+	delete(mopts, "mode")
+	delete(mopts, "uid")
+	delete(mopts, "gid")
+	maxSizeStr, ok := mopts["size"]
+	delete(mopts, "size")
+	if len(mopts) != 0 {
+		ctx.Warningf("tmpfs.filesystem.Remount: unknown options: %v", mopts)
+		return linuxerr.EINVAL
+	}
+	if !ok {
+		return nil
+	}
+	maxSizeInBytes, err := parseSize(maxSizeStr)
+	if err != nil {
+		ctx.Debugf("tmpfs.filesystem.Remount: parseSize() failed: %v", err)
+		return linuxerr.EINVAL
+	}
+	maxSizeInPages, ok := hostarch.ToPagesRoundUp(maxSizeInBytes)
+	if !ok {
+		return linuxerr.EINVAL
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.pagesUsed.Load() > maxSizeInPages {
+		return linuxerr.EINVAL
+	}
+	// Allocations racing with Remount may still be accounted against the
+	// previous size.
+	fs.maxSizeInPages.Store(maxSizeInPages)
+	var opts []string
+	for _, opt := range strings.Split(fs.mopts, ",") {
+		if opt != "" && !strings.HasPrefix(opt, "size=") {
+			opts = append(opts, opt)
+		}
+	}
+	fs.mopts = strings.Join(append(opts, "size="+maxSizeStr), ",")
+	return nil
+}
+
 // adjustPageAcct adjusts the accounting done against filesystem size limit in
 // case there is any discrepency between the number of pages reserved vs the
 // number of pages actually allocated.
@@ -973,11 +1023,12 @@ func (fs *filesystem) accountPagesPartial(pagesInc uint64) uint64 {
 
 	for {
 		pagesUsed := fs.pagesUsed.Load()
-		if fs.maxSizeInPages <= pagesUsed {
+		maxSizeInPages := fs.maxSizeInPages.Load()
+		if maxSizeInPages <= pagesUsed {
 			return 0
 		}
 
-		pagesFree := fs.maxSizeInPages - pagesUsed
+		pagesFree := maxSizeInPages - pagesUsed
 		toInc := pagesInc
 		if pagesFree < pagesInc {
 			toInc = pagesFree
@@ -999,11 +1050,12 @@ func (fs *filesystem) accountPages(pagesInc uint64) bool {
 
 	for {
 		pagesUsed := fs.pagesUsed.Load()
-		if fs.maxSizeInPages <= pagesUsed {
+		maxSizeInPages := fs.maxSizeInPages.Load()
+		if maxSizeInPages <= pagesUsed {
 			return false
 		}
 
-		pagesFree := fs.maxSizeInPages - pagesUsed
+		pagesFree := maxSizeInPages - pagesUsed
 		if pagesFree < pagesInc {
 			return false
 		}
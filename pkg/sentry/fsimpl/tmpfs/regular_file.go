@@ -359,6 +359,9 @@ func (fd *regularFileFD) Release(context.Context) {
 
 // Allocate implements vfs.FileDescriptionImpl.Allocate.
 func (fd *regularFileFD) Allocate(ctx context.Context, mode, offset, length uint64) error {
+	if mode != 0 {
+		return linuxerr.EOPNOTSUPP
+	}
 	f := fd.inode().impl.(*regularFile)
 
 	f.inode.mu.Lock()
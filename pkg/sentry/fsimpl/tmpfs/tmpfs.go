@@ -81,7 +81,7 @@ type filesystem struct {
 	devMinor uint32
 
 	// mopts contains the tmpfs-specific mount options passed to this
-	// filesystem. Immutable.
+	// filesystem. mopts is protected by mu.
 	mopts string
 
 	// usage is the memory accounting category under which pages backing
@@ -98,8 +98,8 @@ type filesystem struct {
 	maxFilenameLen int
 
 	// maxSizeInPages is the maximum permissible size for the tmpfs in terms of pages.
-	// This field is immutable.
-	maxSizeInPages uint64
+	// It's changed by Remount.
+	maxSizeInPages atomicbitops.Uint64
 
 	// pagesUsed is the number of pages used by this filesystem.
 	pagesUsed atomicbitops.Uint64
@@ -300,8 +300,8 @@ func (fstype FilesystemType) GetFilesystem(ctx context.Context, vfsObj *vfs.Virt
 		mopts:          opts.Data,
 		usage:          memUsage,
 		maxFilenameLen: linux.NAME_MAX,
-		maxSizeInPages: maxSizeInPages,
 	}
+	fs.maxSizeInPages.Store(maxSizeInPages)
 	fs.vfsfs.Init(vfsObj, newFSType, &fs)
 	if tmpfsOptsOk && tmpfsOpts.MaxFilenameLen > 0 {
 		fs.maxFilenameLen = tmpfsOpts.MaxFilenameLen
@@ -371,10 +371,15 @@ func (fs *filesystem) statFS() linux.Statfs {
 	}
 
 	// If size is set for tmpfs return set values.
-	st.Blocks = fs.maxSizeInPages
+	maxSizeInPages := fs.maxSizeInPages.Load()
+	st.Blocks = maxSizeInPages
 	pagesUsed := fs.pagesUsed.Load()
-	st.BlocksFree = fs.maxSizeInPages - pagesUsed
-	st.BlocksAvailable = fs.maxSizeInPages - pagesUsed
+	if pagesUsed > maxSizeInPages {
+		// The filesystem was shrunk by Remount while it was being written.
+		pagesUsed = maxSizeInPages
+	}
+	st.BlocksFree = maxSizeInPages - pagesUsed
+	st.BlocksAvailable = maxSizeInPages - pagesUsed
 	return st
 }
 
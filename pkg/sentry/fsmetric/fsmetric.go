@@ -18,6 +18,7 @@ package fsmetric
 import (
 	"time"
 
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/metric"
 )
 
@@ -44,8 +45,25 @@ var (
 	GoferReadWait9P   = metric.MustCreateNewUint64NanosecondsMetric("/gofer/read_wait_9p", false /* sync */, "Time waiting on 9P file reads from a gofer, in nanoseconds.")
 	GoferReadsHost    = metric.MustCreateNewUint64Metric("/gofer/reads_host", false /* sync */, "Number of host file reads from a gofer.")
 	GoferReadWaitHost = metric.MustCreateNewUint64NanosecondsMetric("/gofer/read_wait_host", false /* sync */, "Time waiting on host file reads from a gofer, in nanoseconds.")
+
+	GoferWritebackFlushes   = metric.MustCreateNewUint64Metric("/gofer/writeback_flushes", false /* sync */, "Number of times the dirty cached pages of a file from a gofer were written back in the background.")
+	GoferWritebackBytes     = metric.MustCreateNewUint64Metric("/gofer/writeback_bytes", false /* sync */, "Number of dirty cached bytes of files from a gofer written back in the background.")
+	GoferWritebackThrottles = metric.MustCreateNewUint64Metric("/gofer/writeback_throttles", false /* sync */, "Number of writes to files from a gofer that were throttled because too much memory was dirty.")
 )
 
+// GoferDirtyBytes is the number of dirty bytes cached for files from a gofer.
+// It's reported by the /gofer/dirty_bytes metric.
+var GoferDirtyBytes atomicbitops.Int64
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/gofer/dirty_bytes", false /* cumulative */, false /* sync */, "Number of dirty bytes cached for files from a gofer.", func(...*metric.FieldValue) uint64 {
+		if n := GoferDirtyBytes.Load(); n > 0 {
+			return uint64(n)
+		}
+		return 0
+	})
+}
+
 // Metrics that only apply to fs/tmpfs and fsimpl/tmpfs.
 var (
 	TmpfsOpensRO  = metric.MustCreateNewUint64Metric("/in_memory_file/opens_ro", false /* sync */, "Number of times an in-memory file was opened in read-only mode.")
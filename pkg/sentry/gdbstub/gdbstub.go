@@ -0,0 +1,917 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package gdbstub implements a gdb remote serial protocol stub for thread
+// groups running in the sentry.
+//
+// The stub operates in all-stop mode: when any task in the thread group stops,
+// all of them are stopped until gdb resumes them. Software breakpoints are
+// implemented by writing the architecture's breakpoint instruction into
+// application memory; the platform reports it as a SIGTRAP that is intercepted
+// by the kernel.Debugger.
+package gdbstub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
+)
+
+// maxPacketSize is the maximum packet size advertised to gdb.
+const maxPacketSize = 0x4000
+
+// register is a register in the layout of gdb's 'g' packet.
+type register struct {
+	// val is the register value in linux.PtraceRegs.
+	val *uint64
+
+	// size is the size of the register in bytes. If size is smaller than 8,
+	// only the low bytes of val are transferred.
+	size int
+}
+
+// input is a packet or an interrupt request received from gdb.
+type input struct {
+	// packet is the packet data.
+	packet string
+
+	// interrupt is true if gdb requested to stop the thread group.
+	interrupt bool
+
+	// bad is true if the packet checksum didn't match.
+	bad bool
+}
+
+// stub serves a single gdb connection.
+type stub struct {
+	ctx  context.Context
+	k    *kernel.Kernel
+	d    *kernel.Debugger
+	conn io.ReadWriteCloser
+	w    *bufio.Writer
+
+	// noAck is true once gdb has switched to no-acknowledgement mode.
+	noAck bool
+
+	// running is true if the thread group is running.
+	running bool
+
+	// stopReply is the reply to the last stop.
+	stopReply string
+
+	// reported is the set of tasks whose debugger stop has been reported to
+	// gdb since the thread group was last resumed.
+	reported map[*kernel.Task]struct{}
+
+	// current is the task selected for register and memory access; cont is
+	// the task selected for resuming with the legacy 'c' and 's' packets.
+	current *kernel.Task
+	cont    *kernel.Task
+
+	// breakpoints maps the address of software breakpoints to the
+	// instruction bytes they replaced.
+	breakpoints map[hostarch.Addr][]byte
+}
+
+// Serve runs a gdb stub for the thread group that d is attached to over conn.
+// It returns when gdb detaches or kills the thread group, when the thread
+// group exits, or when conn is closed. d is detached and conn is closed
+// before Serve returns.
+func Serve(k *kernel.Kernel, d *kernel.Debugger, conn io.ReadWriteCloser) error {
+	s := &stub{
+		ctx:         k.SupervisorContext(),
+		k:           k,
+		d:           d,
+		conn:        conn,
+		w:           bufio.NewWriter(conn),
+		reported:    make(map[*kernel.Task]struct{}),
+		breakpoints: make(map[hostarch.Addr][]byte),
+	}
+	defer s.conn.Close()
+	defer s.detach()
+
+	done := make(chan struct{})
+	defer close(done)
+	in := make(chan input)
+	go s.readLoop(bufio.NewReader(conn), in, done)
+
+	// gdb expects the thread group to be stopped when it connects.
+	s.d.Stop()
+	s.reportStop(linux.SIGTRAP)
+
+	for {
+		select {
+		case i, ok := <-in:
+			if !ok {
+				return nil
+			}
+			if i.interrupt {
+				if s.running {
+					s.d.Stop()
+					s.running = false
+					s.reportStop(linux.SIGINT)
+					if err := s.send(s.stopReply); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if !s.noAck {
+				ack := "+"
+				if i.bad {
+					ack = "-"
+				}
+				if _, err := s.w.WriteString(ack); err != nil {
+					return err
+				}
+			}
+			if i.bad {
+				if err := s.w.Flush(); err != nil {
+					return err
+				}
+				continue
+			}
+			if s.running {
+				// In all-stop mode gdb doesn't send packets while the
+				// thread group runs.
+				log.Warningf("gdbstub: ignoring packet %q while running", i.packet)
+				continue
+			}
+			reply, ok, exit := s.handle(i.packet)
+			if ok {
+				if err := s.send(reply); err != nil {
+					return err
+				}
+			}
+			if exit {
+				return nil
+			}
+			if i.packet == "QStartNoAckMode" {
+				s.noAck = true
+			}
+
+		case <-s.d.Notify():
+			if !s.running {
+				// Reported when gdb tries to resume the thread group.
+				continue
+			}
+			if t, info := s.unreportedTrap(); t != nil {
+				s.d.Stop()
+				s.running = false
+				s.setStop(t, linux.Signal(info.Signo))
+				if err := s.send(s.stopReply); err != nil {
+					return err
+				}
+			}
+
+		case <-s.d.Exited():
+			ws := s.d.ThreadGroup().ExitStatus()
+			reply := fmt.Sprintf("W%02x", ws.ExitStatus()&0xff)
+			if ws.Signaled() {
+				reply = fmt.Sprintf("X%02x", gdbSignal(ws.TerminationSignal()))
+			}
+			return s.send(reply)
+		}
+	}
+}
+
+// readLoop parses packets and interrupt requests sent by gdb, and sends them
+// to in until the connection is closed or done is closed.
+func (s *stub) readLoop(r *bufio.Reader, in chan<- input, done <-chan struct{}) {
+	defer close(in)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		var i input
+		switch c {
+		case 0x03:
+			i.interrupt = true
+		case '$':
+			data, err := r.ReadString('#')
+			if err != nil {
+				return
+			}
+			data = data[:len(data)-1]
+			var sum [2]byte
+			if _, err := io.ReadFull(r, sum[:]); err != nil {
+				return
+			}
+			want, err := strconv.ParseUint(string(sum[:]), 16, 8)
+			i.packet = data
+			i.bad = err != nil || uint8(want) != checksum(data)
+		default:
+			// Acknowledgements; packets are never retransmitted.
+			continue
+		}
+		select {
+		case in <- i:
+		case <-done:
+			return
+		}
+	}
+}
+
+// send sends a packet to gdb.
+func (s *stub) send(data string) error {
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '$', '#', '}', '*':
+			b.WriteByte('}')
+			b.WriteByte(c ^ 0x20)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	escaped := b.String()
+	if _, err := fmt.Fprintf(s.w, "$%s#%02x", escaped, checksum(escaped)); err != nil {
+		return err
+	}
+	return s.w.Flush()
+}
+
+// checksum returns the checksum of packet data.
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// handle handles a packet. It returns the reply, whether the reply should be
+// sent, and whether the stub should exit after sending it.
+func (s *stub) handle(p string) (string, bool, bool) {
+	if len(p) == 0 {
+		return "", true, false
+	}
+	switch p[0] {
+	case '?':
+		return s.stopReply, true, false
+	case 'g':
+		regs, err := s.readRegisters(s.task())
+		if err != nil {
+			return errorReply(err), true, false
+		}
+		return hex.EncodeToString(regs), true, false
+	case 'G':
+		b, err := hex.DecodeString(p[1:])
+		if err != nil {
+			return "E16", true, false
+		}
+		if err := s.writeRegisters(s.task(), b); err != nil {
+			return errorReply(err), true, false
+		}
+		return "OK", true, false
+	case 'p':
+		n, err := strconv.ParseUint(p[1:], 16, 32)
+		if err != nil {
+			return "E16", true, false
+		}
+		return s.readRegister(s.task(), int(n)), true, false
+	case 'P':
+		return s.writeRegister(p[1:]), true, false
+	case 'm':
+		return s.readMemory(p[1:]), true, false
+	case 'M':
+		return s.writeMemory(p[1:]), true, false
+	case 'Z', 'z':
+		return s.breakpoint(p[0] == 'Z', p[1:]), true, false
+	case 'H':
+		return s.selectThread(p[1:]), true, false
+	case 'T':
+		if t := s.lookupTask(p[1:]); t != nil {
+			return "OK", true, false
+		}
+		return "E03", true, false
+	case 'c', 's':
+		return s.resumeOne(kernel.DebugResume{Step: p[0] == 's'})
+	case 'C', 'S':
+		sig, err := strconv.ParseUint(strings.SplitN(p[1:], ";", 2)[0], 16, 8)
+		if err != nil {
+			return "E16", true, false
+		}
+		return s.resumeOne(kernel.DebugResume{Step: p[0] == 'S', Signal: linuxSignal(int(sig))})
+	case 'D':
+		return "OK", true, true
+	case 'k':
+		if err := s.d.ThreadGroup().SendSignal(&linux.SignalInfo{
+			Signo: int32(linux.SIGKILL),
+			Code:  linux.SI_KERNEL,
+		}); err != nil {
+			log.Warningf("gdbstub: killing thread group: %v", err)
+		}
+		return "", false, true
+	case 'v':
+		return s.handleV(p)
+	case 'q', 'Q':
+		return s.handleQuery(p), true, false
+	}
+	return "", true, false
+}
+
+// handleV handles 'v' packets.
+func (s *stub) handleV(p string) (string, bool, bool) {
+	switch {
+	case p == "vCont?":
+		return "vCont;c;C;s;S", true, false
+	case strings.HasPrefix(p, "vCont;"):
+		actions := make(map[*kernel.Task]kernel.DebugResume)
+		var def *kernel.DebugResume
+		for _, a := range strings.Split(p[len("vCont;"):], ";") {
+			action, tid, hasTID := strings.Cut(a, ":")
+			if len(action) == 0 {
+				return "E16", true, false
+			}
+			var r kernel.DebugResume
+			switch action[0] {
+			case 'c':
+			case 's':
+				r.Step = true
+			case 'C', 'S':
+				sig, err := strconv.ParseUint(action[1:], 16, 8)
+				if err != nil {
+					return "E16", true, false
+				}
+				r.Step = action[0] == 'S'
+				r.Signal = linuxSignal(int(sig))
+			default:
+				return "E16", true, false
+			}
+			if !hasTID || tid == "-1" {
+				// The leftmost action that applies to a thread is used.
+				if def == nil {
+					def = &r
+				}
+				continue
+			}
+			if t := s.lookupTask(tid); t != nil {
+				if _, ok := actions[t]; !ok {
+					actions[t] = r
+				}
+			}
+		}
+		if def != nil && (def.Step || def.Signal != 0) {
+			for _, t := range s.d.Tasks() {
+				if _, ok := actions[t]; !ok {
+					actions[t] = *def
+				}
+			}
+		}
+		return s.resume(actions)
+	}
+	return "", true, false
+}
+
+// handleQuery handles 'q' and 'Q' packets.
+func (s *stub) handleQuery(p string) string {
+	name, args, _ := strings.Cut(p, ":")
+	switch {
+	case name == "qSupported":
+		return fmt.Sprintf("PacketSize=%x;QStartNoAckMode+;qXfer:auxv:read+;vContSupported+", maxPacketSize)
+	case name == "QStartNoAckMode":
+		return "OK"
+	case name == "qAttached":
+		return "1"
+	case name == "qC":
+		if t := s.task(); t != nil {
+			return fmt.Sprintf("QC%x", s.tid(t))
+		}
+		return ""
+	case name == "qfThreadInfo":
+		var ids []string
+		for _, t := range s.d.Tasks() {
+			ids = append(ids, strconv.FormatInt(int64(s.tid(t)), 16))
+		}
+		return "m" + strings.Join(ids, ",")
+	case name == "qsThreadInfo":
+		return "l"
+	case strings.HasPrefix(name, "qThreadExtraInfo,"):
+		if t := s.lookupTask(name[len("qThreadExtraInfo,"):]); t != nil {
+			return hex.EncodeToString([]byte(t.Name()))
+		}
+		return "E03"
+	case name == "qXfer" && strings.HasPrefix(args, "auxv:read::"):
+		return s.readAuxv(args[len("auxv:read::"):])
+	}
+	return ""
+}
+
+// resume resumes the thread group. If a task stopped for the debugger without
+// gdb being told, the stop is reported instead.
+func (s *stub) resume(actions map[*kernel.Task]kernel.DebugResume) (string, bool, bool) {
+	if t, info := s.unreportedTrap(); t != nil {
+		s.setStop(t, linux.Signal(info.Signo))
+		return s.stopReply, true, false
+	}
+	s.reported = make(map[*kernel.Task]struct{})
+	s.d.Resume(actions)
+	s.running = true
+	return "", false, false
+}
+
+// resumeOne resumes the thread group, applying r to the task selected for
+// the legacy resume packets.
+func (s *stub) resumeOne(r kernel.DebugResume) (string, bool, bool) {
+	actions := make(map[*kernel.Task]kernel.DebugResume)
+	if t := s.resumeTask(); t != nil {
+		actions[t] = r
+	}
+	return s.resume(actions)
+}
+
+// unreportedTrap returns the task with the lowest thread ID that stopped for
+// the debugger without the stop being reported to gdb.
+func (s *stub) unreportedTrap() (*kernel.Task, *linux.SignalInfo) {
+	var (
+		task *kernel.Task
+		info *linux.SignalInfo
+	)
+	for t, i := range s.d.Trapped() {
+		if _, ok := s.reported[t]; ok {
+			continue
+		}
+		if task == nil || s.tid(t) < s.tid(task) {
+			task, info = t, i
+		}
+	}
+	return task, info
+}
+
+// reportStop records a stop of the thread group for sig. The stop is
+// attributed to a task that stopped for the debugger, if any.
+func (s *stub) reportStop(sig linux.Signal) {
+	if t, info := s.unreportedTrap(); t != nil {
+		s.setStop(t, linux.Signal(info.Signo))
+		return
+	}
+	tasks := s.d.Tasks()
+	if len(tasks) == 0 {
+		s.stopReply = fmt.Sprintf("S%02x", gdbSignal(sig))
+		return
+	}
+	sort.Slice(tasks, func(i, j int) bool { return s.tid(tasks[i]) < s.tid(tasks[j]) })
+	s.setStop(tasks[0], sig)
+}
+
+// setStop records a stop of t for sig.
+func (s *stub) setStop(t *kernel.Task, sig linux.Signal) {
+	s.reported[t] = struct{}{}
+	s.current = t
+	s.cont = t
+	s.stopReply = fmt.Sprintf("T%02xthread:%x;", gdbSignal(sig), s.tid(t))
+}
+
+// detach removes breakpoints and detaches from the thread group.
+func (s *stub) detach() {
+	if len(s.breakpoints) != 0 {
+		if s.running {
+			s.d.Stop()
+		}
+		for addr := range s.breakpoints {
+			if err := s.removeBreakpoint(addr); err != nil {
+				log.Warningf("gdbstub: removing breakpoint at %#x: %v", addr, err)
+			}
+		}
+	}
+	s.d.Detach()
+}
+
+// tid returns the ID of t in the root PID namespace.
+func (s *stub) tid(t *kernel.Task) kernel.ThreadID {
+	return s.k.TaskSet().Root.IDOfTask(t)
+}
+
+// lookupTask returns the task with the given hexadecimal thread ID, or nil if
+// it isn't a live task in the thread group.
+func (s *stub) lookupTask(id string) *kernel.Task {
+	tid, err := strconv.ParseInt(id, 16, 32)
+	if err != nil {
+		return nil
+	}
+	t := s.k.TaskSet().Root.TaskWithID(kernel.ThreadID(tid))
+	if t == nil || t.ThreadGroup() != s.d.ThreadGroup() || t.ExitState() != kernel.TaskExitNone {
+		return nil
+	}
+	return t
+}
+
+// selectThread handles the 'H' packet.
+func (s *stub) selectThread(p string) string {
+	if len(p) < 2 {
+		return "E16"
+	}
+	var t *kernel.Task
+	if id := p[1:]; id != "0" && id != "-1" {
+		if t = s.lookupTask(id); t == nil {
+			return "E03"
+		}
+	}
+	switch p[0] {
+	case 'g':
+		s.current = t
+	case 'c':
+		s.cont = t
+	default:
+		return "E16"
+	}
+	return "OK"
+}
+
+// task returns the task selected for register and memory access.
+func (s *stub) task() *kernel.Task {
+	if s.current != nil && s.current.ExitState() == kernel.TaskExitNone {
+		return s.current
+	}
+	tasks := s.d.Tasks()
+	if len(tasks) == 0 {
+		return nil
+	}
+	return tasks[0]
+}
+
+// resumeTask returns the task selected for the legacy resume packets.
+func (s *stub) resumeTask() *kernel.Task {
+	if s.cont != nil {
+		return s.cont
+	}
+	return s.task()
+}
+
+// ptraceRegs returns the registers of t.
+func ptraceRegs(t *kernel.Task) (*linux.PtraceRegs, error) {
+	var buf bytes.Buffer
+	if _, err := t.Arch().PtraceGetRegs(&buf); err != nil {
+		return nil, err
+	}
+	var regs linux.PtraceRegs
+	regs.UnmarshalUnsafe(buf.Bytes())
+	return &regs, nil
+}
+
+// setPtraceRegs sets the registers of t.
+func setPtraceRegs(t *kernel.Task, regs *linux.PtraceRegs) error {
+	buf := make([]byte, regs.SizeBytes())
+	regs.MarshalUnsafe(buf)
+	_, err := t.Arch().PtraceSetRegs(bytes.NewReader(buf))
+	return err
+}
+
+// readRegisters returns the registers of t in the layout of gdb's 'g'
+// packet.
+func (s *stub) readRegisters(t *kernel.Task) ([]byte, error) {
+	if t == nil {
+		return nil, errNoTask
+	}
+	regs, err := ptraceRegs(t)
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	for _, r := range registers(regs) {
+		var v [8]byte
+		binary.LittleEndian.PutUint64(v[:], *r.val)
+		b = append(b, v[:r.size]...)
+	}
+	return b, nil
+}
+
+// writeRegisters sets the registers of t from a gdb 'G' packet.
+func (s *stub) writeRegisters(t *kernel.Task, b []byte) error {
+	if t == nil {
+		return errNoTask
+	}
+	regs, err := ptraceRegs(t)
+	if err != nil {
+		return err
+	}
+	for _, r := range registers(regs) {
+		if len(b) < r.size {
+			break
+		}
+		setRegister(r, b[:r.size])
+		b = b[r.size:]
+	}
+	return setPtraceRegs(t, regs)
+}
+
+// readRegister handles the 'p' packet.
+func (s *stub) readRegister(t *kernel.Task, n int) string {
+	if t == nil {
+		return errorReply(errNoTask)
+	}
+	regs, err := ptraceRegs(t)
+	if err != nil {
+		return errorReply(err)
+	}
+	rs := registers(regs)
+	if n >= len(rs) {
+		// Registers not in the 'g' packet are unavailable.
+		return ""
+	}
+	b := binary.LittleEndian.AppendUint64(nil, *rs[n].val)
+	return hex.EncodeToString(b[:rs[n].size])
+}
+
+// writeRegister handles the 'P' packet.
+func (s *stub) writeRegister(p string) string {
+	num, val, ok := strings.Cut(p, "=")
+	if !ok {
+		return "E16"
+	}
+	n, err := strconv.ParseUint(num, 16, 32)
+	if err != nil {
+		return "E16"
+	}
+	b, err := hex.DecodeString(val)
+	if err != nil {
+		return "E16"
+	}
+	t := s.task()
+	if t == nil {
+		return errorReply(errNoTask)
+	}
+	regs, err := ptraceRegs(t)
+	if err != nil {
+		return errorReply(err)
+	}
+	rs := registers(regs)
+	if int(n) >= len(rs) || len(b) != rs[n].size {
+		return "E16"
+	}
+	setRegister(rs[n], b)
+	if err := setPtraceRegs(t, regs); err != nil {
+		return errorReply(err)
+	}
+	return "OK"
+}
+
+// setRegister sets r from little-endian bytes.
+func setRegister(r register, b []byte) {
+	var full [8]byte
+	binary.LittleEndian.PutUint64(full[:], *r.val)
+	copy(full[:], b)
+	*r.val = binary.LittleEndian.Uint64(full[:])
+}
+
+// parseAddrLen parses "addr,length".
+func parseAddrLen(p string) (hostarch.Addr, int, error) {
+	a, l, ok := strings.Cut(p, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("malformed address and length %q", p)
+	}
+	addr, err := strconv.ParseUint(a, 16, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	length, err := strconv.ParseUint(l, 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	return hostarch.Addr(addr), int(length), nil
+}
+
+// readMemory handles the 'm' packet. Breakpoint instructions inserted by the
+// stub are hidden from gdb.
+func (s *stub) readMemory(p string) string {
+	addr, length, err := parseAddrLen(p)
+	if err != nil {
+		return "E16"
+	}
+	if length > maxPacketSize/2 {
+		length = maxPacketSize / 2
+	}
+	t := s.task()
+	if t == nil {
+		return errorReply(errNoTask)
+	}
+	buf := make([]byte, length)
+	n, err := t.MemoryManager().CopyIn(s.ctx, addr, buf, usermem.IOOpts{IgnorePermissions: true})
+	if n == 0 && length != 0 {
+		return errorReply(err)
+	}
+	buf = buf[:n]
+	for bp, orig := range s.breakpoints {
+		for i := range orig {
+			if a := bp + hostarch.Addr(i); a >= addr && a < addr+hostarch.Addr(n) {
+				buf[a-addr] = orig[i]
+			}
+		}
+	}
+	return hex.EncodeToString(buf)
+}
+
+// writeMemory handles the 'M' packet.
+func (s *stub) writeMemory(p string) string {
+	al, data, ok := strings.Cut(p, ":")
+	if !ok {
+		return "E16"
+	}
+	addr, length, err := parseAddrLen(al)
+	if err != nil {
+		return "E16"
+	}
+	b, err := hex.DecodeString(data)
+	if err != nil || len(b) != length {
+		return "E16"
+	}
+	t := s.task()
+	if t == nil {
+		return errorReply(errNoTask)
+	}
+	if _, err := t.MemoryManager().CopyOut(s.ctx, addr, b, usermem.IOOpts{IgnorePermissions: true}); err != nil {
+		return errorReply(err)
+	}
+	return "OK"
+}
+
+// breakpoint handles the 'Z' and 'z' packets. Only software breakpoints are
+// supported.
+func (s *stub) breakpoint(insert bool, p string) string {
+	typ, rest, ok := strings.Cut(p, ",")
+	if !ok || typ != "0" {
+		return ""
+	}
+	addr, _, err := parseAddrLen(rest)
+	if err != nil {
+		return "E16"
+	}
+	if !insert {
+		if err := s.removeBreakpoint(addr); err != nil {
+			return errorReply(err)
+		}
+		return "OK"
+	}
+	if _, ok := s.breakpoints[addr]; ok {
+		return "OK"
+	}
+	t := s.task()
+	if t == nil {
+		return errorReply(errNoTask)
+	}
+	mm := t.MemoryManager()
+	orig := make([]byte, len(breakpointInsn))
+	if _, err := mm.CopyIn(s.ctx, addr, orig, usermem.IOOpts{IgnorePermissions: true}); err != nil {
+		return errorReply(err)
+	}
+	if _, err := mm.CopyOut(s.ctx, addr, breakpointInsn, usermem.IOOpts{IgnorePermissions: true}); err != nil {
+		return errorReply(err)
+	}
+	s.breakpoints[addr] = orig
+	return "OK"
+}
+
+// removeBreakpoint restores the instruction replaced by the breakpoint at
+// addr.
+func (s *stub) removeBreakpoint(addr hostarch.Addr) error {
+	orig, ok := s.breakpoints[addr]
+	if !ok {
+		return nil
+	}
+	delete(s.breakpoints, addr)
+	t := s.task()
+	if t == nil {
+		return nil
+	}
+	_, err := t.MemoryManager().CopyOut(s.ctx, addr, orig, usermem.IOOpts{IgnorePermissions: true})
+	return err
+}
+
+// readAuxv handles "qXfer:auxv:read::offset,length".
+func (s *stub) readAuxv(p string) string {
+	off, length, err := parseAddrLen(p)
+	if err != nil {
+		return "E16"
+	}
+	t := s.task()
+	if t == nil {
+		return errorReply(errNoTask)
+	}
+	var b []byte
+	for _, e := range t.MemoryManager().Auxv() {
+		b = binary.LittleEndian.AppendUint64(b, e.Key)
+		b = binary.LittleEndian.AppendUint64(b, uint64(e.Value))
+	}
+	// Terminate with AT_NULL, like /proc/[pid]/auxv.
+	b = append(b, make([]byte, 16)...)
+	if uint64(off) >= uint64(len(b)) {
+		return "l"
+	}
+	b = b[off:]
+	if len(b) > length {
+		return "m" + string(b[:length])
+	}
+	return "l" + string(b)
+}
+
+// errNoTask is returned when the thread group has no live task.
+var errNoTask = fmt.Errorf("no live task")
+
+// errorReply returns an error reply for err.
+func errorReply(err error) string {
+	log.Debugf("gdbstub: request failed: %v", err)
+	return "E0e"
+}
+
+// linuxToGDBSignal maps Linux signal numbers to gdb's signal numbers, which
+// are used in the remote protocol.
+var linuxToGDBSignal = map[linux.Signal]int{
+	linux.SIGHUP:    1,
+	linux.SIGINT:    2,
+	linux.SIGQUIT:   3,
+	linux.SIGILL:    4,
+	linux.SIGTRAP:   5,
+	linux.SIGABRT:   6,
+	linux.SIGBUS:    10,
+	linux.SIGFPE:    8,
+	linux.SIGKILL:   9,
+	linux.SIGUSR1:   30,
+	linux.SIGSEGV:   11,
+	linux.SIGUSR2:   31,
+	linux.SIGPIPE:   13,
+	linux.SIGALRM:   14,
+	linux.SIGTERM:   15,
+	linux.SIGCHLD:   20,
+	linux.SIGCONT:   19,
+	linux.SIGSTOP:   17,
+	linux.SIGTSTP:   18,
+	linux.SIGTTIN:   21,
+	linux.SIGTTOU:   22,
+	linux.SIGURG:    16,
+	linux.SIGXCPU:   24,
+	linux.SIGXFSZ:   25,
+	linux.SIGVTALRM: 26,
+	linux.SIGPROF:   27,
+	linux.SIGWINCH:  28,
+	linux.SIGIO:     23,
+	linux.SIGPWR:    32,
+	linux.SIGSYS:    12,
+}
+
+const (
+	// gdbSignalRealtime33 is gdb's number for signal 33. gdb's numbers for
+	// signals 33 to 63 are contiguous.
+	gdbSignalRealtime33 = 45
+	// gdbSignalRealtime32 and gdbSignalRealtime64 are gdb's numbers for
+	// signals 32 and 64.
+	gdbSignalRealtime32 = 77
+	gdbSignalRealtime64 = 78
+	// gdbSignalUnknown is gdb's number for signals it doesn't know.
+	gdbSignalUnknown = 143
+)
+
+// gdbSignal returns gdb's number for sig.
+func gdbSignal(sig linux.Signal) int {
+	if n, ok := linuxToGDBSignal[sig]; ok {
+		return n
+	}
+	switch {
+	case sig == 32:
+		return gdbSignalRealtime32
+	case sig >= 33 && sig <= 63:
+		return int(sig) - 33 + gdbSignalRealtime33
+	case sig == 64:
+		return gdbSignalRealtime64
+	}
+	return gdbSignalUnknown
+}
+
+// linuxSignal returns the Linux signal for gdb's signal number n, or 0 if
+// there is none.
+func linuxSignal(n int) linux.Signal {
+	if n == 0 {
+		return 0
+	}
+	for sig := linux.Signal(1); sig <= linux.SignalMaximum; sig++ {
+		if gdbSignal(sig) == n {
+			return sig
+		}
+	}
+	return 0
+}
@@ -0,0 +1,57 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64
+// +build amd64
+
+package gdbstub
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+)
+
+// breakpointInsn is the software breakpoint instruction (int3).
+var breakpointInsn = []byte{0xcc}
+
+// registers returns the registers in regs in the order of gdb's 'g' packet
+// for i386:x86-64. Floating point and vector registers are not included, and
+// gdb reports them as unavailable.
+func registers(regs *linux.PtraceRegs) []register {
+	return []register{
+		{&regs.Rax, 8},
+		{&regs.Rbx, 8},
+		{&regs.Rcx, 8},
+		{&regs.Rdx, 8},
+		{&regs.Rsi, 8},
+		{&regs.Rdi, 8},
+		{&regs.Rbp, 8},
+		{&regs.Rsp, 8},
+		{&regs.R8, 8},
+		{&regs.R9, 8},
+		{&regs.R10, 8},
+		{&regs.R11, 8},
+		{&regs.R12, 8},
+		{&regs.R13, 8},
+		{&regs.R14, 8},
+		{&regs.R15, 8},
+		{&regs.Rip, 8},
+		{&regs.Eflags, 4},
+		{&regs.Cs, 4},
+		{&regs.Ss, 4},
+		{&regs.Ds, 4},
+		{&regs.Es, 4},
+		{&regs.Fs, 4},
+		{&regs.Gs, 4},
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build arm64
+// +build arm64
+
+package gdbstub
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+)
+
+// breakpointInsn is the software breakpoint instruction (brk #0).
+var breakpointInsn = []byte{0x00, 0x00, 0x20, 0xd4}
+
+// registers returns the registers in regs in the order of gdb's 'g' packet
+// for aarch64. Floating point and vector registers are not included, and gdb
+// reports them as unavailable.
+func registers(regs *linux.PtraceRegs) []register {
+	rs := make([]register, 0, len(regs.Regs)+3)
+	for i := range regs.Regs {
+		rs = append(rs, register{&regs.Regs[i], 8})
+	}
+	return append(rs,
+		register{&regs.Sp, 8},
+		register{&regs.Pc, 8},
+		register{&regs.Pstate, 4})
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostmm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/eventfd"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"golang.org/x/sys/unix"
+)
+
+// SetPSITrigger sets up a PSI trigger on file, an open cgroup v2
+// memory.pressure file, that fires when tasks in the cgroup are stalled on
+// memory for at least stall within any window, as specified by Linux's
+// Documentation/accounting/psi.rst. If full is true, the trigger only counts
+// time in which all tasks are stalled.
+//
+// The trigger is bound to the open file description of file, and remains set
+// up when file is passed to another process.
+func SetPSITrigger(file *os.File, full bool, stall, window time.Duration) error {
+	kind := "some"
+	if full {
+		kind = "full"
+	}
+	// The whole trigger must be written in a single write.
+	trigger := fmt.Sprintf("%s %d %d", kind, stall.Microseconds(), window.Microseconds())
+	if n, err := file.Write([]byte(trigger)); n != len(trigger) || err != nil {
+		return fmt.Errorf("error writing %q to %s: got (%d, %v), wanted (%d, nil)", trigger, file.Name(), n, err, len(trigger))
+	}
+	return nil
+}
+
+// NotifyPSIMemoryPressureCallback requests that f is called whenever the PSI
+// trigger set up on file by SetPSITrigger fires.
+//
+// If NotifyPSIMemoryPressureCallback succeeds, it returns a function that
+// terminates the requested memory pressure notifications. This function may be
+// called at most once. file is not closed.
+func NotifyPSIMemoryPressureCallback(file *os.File, f func()) (func(), error) {
+	stopFD, err := eventfd.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Receiving PSI memory pressure notifications from %s", file.Name())
+	stopCh := make(chan struct{})
+	go func() { // S/R-SAFE: f provides synchronization if necessary
+		defer close(stopCh)
+		defer stopFD.Close()
+		fds := []unix.PollFd{
+			{Fd: int32(file.Fd()), Events: unix.POLLPRI},
+			{Fd: int32(stopFD.FD()), Events: unix.POLLIN},
+		}
+		for {
+			if _, err := unix.Ppoll(fds, nil, nil); err != nil {
+				if err == unix.EINTR {
+					continue
+				}
+				panic(fmt.Sprintf("failed to poll PSI memory pressure file: %v", err))
+			}
+			if fds[1].Revents != 0 {
+				return
+			}
+			if fds[0].Revents&unix.POLLERR != 0 {
+				// The cgroup was removed.
+				log.Warningf("PSI memory pressure file %s is gone, stopping notifications", file.Name())
+				return
+			}
+			if fds[0].Revents&unix.POLLPRI != 0 {
+				f()
+			}
+		}
+	}()
+	return func() {
+		stopFD.Notify()
+		<-stopCh
+	}, nil
+}
+
+// PSIAverages are the "avg10" stall ratios of a pressure file, in percent.
+type PSIAverages struct {
+	// Some is the share of time in which some tasks were stalled.
+	Some float64
+
+	// Full is the share of time in which all tasks were stalled.
+	Full float64
+}
+
+// ReadPSIAverages reads the averages of the last 10 seconds from file, an
+// open pressure file.
+func ReadPSIAverages(file *os.File) (PSIAverages, error) {
+	// Pressure files must be read from the start in a single read.
+	var avgs PSIAverages
+	buf := make([]byte, 256)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return avgs, err
+	}
+	// Each line is of the form:
+	// some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+	scanner := bufio.NewScanner(strings.NewReader(string(buf[:n])))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[1], "avg10=") {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.TrimPrefix(fields[1], "avg10="), 64)
+		if err != nil {
+			return avgs, fmt.Errorf("failed to parse %s: line %q: %v", file.Name(), scanner.Text(), err)
+		}
+		switch fields[0] {
+		case "some":
+			avgs.Some = v
+		case "full":
+			avgs.Full = v
+		}
+	}
+	return avgs, nil
+}
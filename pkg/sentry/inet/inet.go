@@ -81,10 +81,15 @@ type Stack interface {
 	// RouteTable returns the network stack's route table.
 	RouteTable() []Route
 
-	// Pause pauses the network stack before save.
-	Pause()
+	// MulticastGroups returns the multicast groups joined by each network
+	// interface, as a mapping from interface indexes to groups.
+	MulticastGroups() map[int32][]MulticastGroup
 
-	// Resume restarts the network stack after restore.
+	// Pause pauses the network stack before save. If resume is true, the
+	// network stack keeps running after the save.
+	Pause(resume bool)
+
+	// Resume restarts the network stack after save or restore.
 	Resume()
 
 	// Destroy the network stack.
@@ -100,6 +105,10 @@ type Stack interface {
 	// for restoring a stack after a save.
 	RestoreCleanupEndpoints([]stack.TransportEndpoint)
 
+	// Forwarding returns whether packet forwarding between NICs is enabled
+	// by default.
+	Forwarding(protocol tcpip.NetworkProtocolNumber) bool
+
 	// SetForwarding enables or disables packet forwarding between NICs.
 	SetForwarding(protocol tcpip.NetworkProtocolNumber, enable bool) error
 
@@ -156,6 +165,16 @@ type InterfaceAddr struct {
 	Addr []byte
 }
 
+// MulticastGroup contains information about a multicast group joined by a
+// network interface.
+type MulticastGroup struct {
+	// Addr is the group address.
+	Addr []byte
+
+	// Users is the number of times the group has been joined.
+	Users uint64
+}
+
 // TCPBufferSize contains settings controlling TCP buffer sizing.
 //
 // +stateify savable
@@ -236,6 +255,24 @@ type StatSNMPUDP [8]uint64
 // StatSNMPUDPLite describes UdpLite line of /proc/net/snmp.
 type StatSNMPUDPLite [8]uint64
 
+// StatSNMP6IP describes the Ip6 lines of /proc/net/snmp6.
+type StatSNMP6IP [32]uint64
+
+// StatSNMP6ICMP describes the Icmp6 lines of /proc/net/snmp6.
+type StatSNMP6ICMP [35]uint64
+
+// StatSNMP6UDP describes the Udp6 lines of /proc/net/snmp6.
+type StatSNMP6UDP [8]uint64
+
+// StatSNMP6UDPLite describes the UdpLite6 lines of /proc/net/snmp6.
+type StatSNMP6UDPLite [8]uint64
+
+// StatNetstatTCPExt describes TcpExt line of /proc/net/netstat.
+type StatNetstatTCPExt [117]uint64
+
+// StatNetstatIPExt describes IpExt line of /proc/net/netstat.
+type StatNetstatIPExt [18]uint64
+
 // TCPLossRecovery indicates TCP loss detection and recovery methods to use.
 type TCPLossRecovery int32
 
@@ -47,6 +47,7 @@ func (n *Namespace) StateFields() []string {
 		"creator",
 		"isRoot",
 		"userNS",
+		"destroyHooks",
 	}
 }
 
@@ -59,6 +60,7 @@ func (n *Namespace) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(1, &n.creator)
 	stateSinkObject.Save(2, &n.isRoot)
 	stateSinkObject.Save(3, &n.userNS)
+	stateSinkObject.Save(4, &n.destroyHooks)
 }
 
 // +checklocksignore
@@ -67,6 +69,7 @@ func (n *Namespace) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.LoadWait(1, &n.creator)
 	stateSourceObject.Load(2, &n.isRoot)
 	stateSourceObject.Load(3, &n.userNS)
+	stateSourceObject.Load(4, &n.destroyHooks)
 	stateSourceObject.AfterLoad(n.afterLoad)
 }
 
@@ -40,6 +40,18 @@ type Namespace struct {
 	isRoot bool
 
 	userNS *auth.UserNamespace
+
+	// destroyHooks are called when the namespace is destroyed. It's
+	// immutable after the namespace is shared.
+	destroyHooks []DestroyHook
+}
+
+// DestroyHook is notified when a network namespace is destroyed. Hooks are
+// saved with the namespace, so implementations must be savable.
+type DestroyHook interface {
+	// OnNamespaceDestroy is called when the namespace is destroyed, before
+	// its stack is destroyed.
+	OnNamespaceDestroy(ctx context.Context)
 }
 
 // NewRootNamespace creates the root network namespace, with creator
@@ -80,8 +92,26 @@ func NewNamespace(root *Namespace, userNS *auth.UserNamespace) *Namespace {
 	return n
 }
 
+// OnDestroy arranges for h to be notified when n is destroyed, i.e. when its
+// last reference is dropped, before its stack is destroyed. It's used to
+// remove the interfaces linked to n in other namespaces, as Linux does for
+// veth pairs.
+//
+// Preconditions: n isn't shared yet.
+func (n *Namespace) OnDestroy(h DestroyHook) {
+	n.destroyHooks = append(n.destroyHooks, h)
+}
+
+// DestroyHooks returns the hooks registered with OnDestroy.
+func (n *Namespace) DestroyHooks() []DestroyHook {
+	return n.destroyHooks
+}
+
 // Destroy implements nsfs.Namespace.Destroy.
 func (n *Namespace) Destroy(ctx context.Context) {
+	for _, h := range n.destroyHooks {
+		h.OnNamespaceDestroy(ctx)
+	}
 	if s := n.Stack(); s != nil {
 		s.Destroy()
 	}
@@ -28,6 +28,7 @@ type TestStack struct {
 	InterfacesMap     map[int32]Interface
 	InterfaceAddrsMap map[int32][]InterfaceAddr
 	RouteList         []Route
+	MulticastGroupMap map[int32][]MulticastGroup
 	SupportsIPv6Flag  bool
 	TCPRecvBufSize    TCPBufferSize
 	TCPSendBufSize    TCPBufferSize
@@ -149,8 +150,13 @@ func (s *TestStack) RouteTable() []Route {
 	return s.RouteList
 }
 
+// MulticastGroups implements Stack.
+func (s *TestStack) MulticastGroups() map[int32][]MulticastGroup {
+	return s.MulticastGroupMap
+}
+
 // Pause implements Stack.
-func (s *TestStack) Pause() {}
+func (s *TestStack) Pause(bool) {}
 
 // Resume implements Stack.
 func (s *TestStack) Resume() {}
@@ -168,6 +174,11 @@ func (s *TestStack) CleanupEndpoints() []stack.TransportEndpoint {
 // RestoreCleanupEndpoints implements Stack.
 func (s *TestStack) RestoreCleanupEndpoints([]stack.TransportEndpoint) {}
 
+// Forwarding implements Stack.
+func (s *TestStack) Forwarding(tcpip.NetworkProtocolNumber) bool {
+	return s.IPForwarding
+}
+
 // SetForwarding implements Stack.
 func (s *TestStack) SetForwarding(protocol tcpip.NetworkProtocolNumber, enable bool) error {
 	s.IPForwarding = enable
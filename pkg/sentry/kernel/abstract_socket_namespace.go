@@ -44,6 +44,20 @@ type AbstractSocketNamespace struct {
 	// destroyed. It is the responsibility of the socket to remove itself from the
 	// abstract socket namespace when it is destroyed.
 	endpoints map[string]abstractEndpoint
+
+	// external returns endpoints outside of the sandbox for names that are
+	// not bound in the namespace, or nil. See SetExternal.
+	external func(name string) transport.BoundEndpoint `state:"nosave"`
+}
+
+// SetExternal makes BoundEndpoint fall back to external for names that are not
+// bound in the namespace. It's used to give access to selected sockets bound
+// outside of the sandbox. external isn't saved, so it must be set again on
+// restore.
+func (a *AbstractSocketNamespace) SetExternal(external func(name string) transport.BoundEndpoint) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.external = external
 }
 
 // NewAbstractSocketNamespace returns a new AbstractSocketNamespace.
@@ -70,19 +84,20 @@ func (e *boundEndpoint) Release(ctx context.Context) {
 // value is nil if no endpoint was bound.
 func (a *AbstractSocketNamespace) BoundEndpoint(name string) transport.BoundEndpoint {
 	a.mu.Lock()
-	defer a.mu.Unlock()
-
 	ep, ok := a.endpoints[name]
-	if !ok {
-		return nil
+	if ok && ep.socket.TryIncRef() {
+		a.mu.Unlock()
+		return &boundEndpoint{ep.ep, ep.socket}
 	}
+	// Either no endpoint is bound at name or it has reached zero references
+	// and is being destroyed.
+	external := a.external
+	a.mu.Unlock()
 
-	if !ep.socket.TryIncRef() {
-		// The socket has reached zero references and is being destroyed.
-		return nil
+	if external != nil {
+		return external(name)
 	}
-
-	return &boundEndpoint{ep.ep, ep.socket}
+	return nil
 }
 
 // Bind binds the given socket.
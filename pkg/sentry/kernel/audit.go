@@ -0,0 +1,137 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+)
+
+// Audit holds the configuration of the audit subsystem, which audit daemons
+// set through NETLINK_AUDIT sockets. It's shared by all containers in the
+// sandbox.
+//
+// +stateify savable
+type Audit struct {
+	// mu protects config.
+	mu sync.Mutex `state:"nosave"`
+
+	config AuditConfig
+}
+
+// AuditConfig is the configuration of the audit subsystem.
+//
+// +stateify savable
+type AuditConfig struct {
+	// Enabled is 0 if auditing is disabled, 1 if it's enabled and 2 if it's
+	// enabled and the configuration is locked.
+	Enabled uint32
+
+	// Failure is the action taken on critical errors, one of
+	// AUDIT_FAIL_{SILENT,PRINTK,PANIC}. It's reported, but not acted on.
+	Failure uint32
+
+	// DaemonPID is the thread group ID of the audit daemon in the root PID
+	// namespace, or 0 if no daemon is registered.
+	DaemonPID int32
+
+	// DaemonPortID is the netlink port ID of the audit daemon's socket.
+	// Audit records are sent to it.
+	DaemonPortID int32
+
+	// RateLimit, BacklogLimit and BacklogWaitTime are reported, but not acted
+	// on.
+	RateLimit       uint32
+	BacklogLimit    uint32
+	BacklogWaitTime uint32
+
+	// Features and LockedFeatures are the masks of audit features that are
+	// set and locked, see AUDIT_SET_FEATURE.
+	Features       uint32
+	LockedFeatures uint32
+
+	// Rules are the audit rules, in the order they were added. Rules is
+	// immutable: changes replace the slice.
+	Rules []*AuditRule
+}
+
+// FeatureSet returns true if the audit feature with the given index is set.
+func (c *AuditConfig) FeatureSet(feature int) bool {
+	return c.Features&(1<<feature) != 0
+}
+
+// AuditRule is an audit rule, equivalent to struct audit_rule_data.
+//
+// +stateify savable
+type AuditRule struct {
+	// List is the filter list the rule is on, one of AUDIT_FILTER_*.
+	List uint32
+
+	// Action is AUDIT_NEVER or AUDIT_ALWAYS.
+	Action uint32
+
+	// Mask is the bitmask of system calls the rule applies to.
+	Mask [linux.AUDIT_BITMASK_SIZE]uint32
+
+	// Fields are the conditions that must all be true for the rule to apply.
+	Fields []AuditRuleField
+
+	// Data is the rule as passed by userspace, returned by AUDIT_LIST_RULES.
+	Data []byte
+}
+
+// AuditRuleField is a condition of an audit rule.
+//
+// +stateify savable
+type AuditRuleField struct {
+	// Type is the field compared, one of AUDIT_PID, AUDIT_UID, etc.
+	Type uint32
+
+	// Op is the comparison operator, one of AUDIT_EQUAL, AUDIT_NOT_EQUAL,
+	// etc.
+	Op uint32
+
+	// Value is the value compared against, for numeric fields.
+	Value uint32
+
+	// Str is the value compared against, for string fields such as
+	// AUDIT_WATCH or AUDIT_FILTERKEY.
+	Str string
+}
+
+// Config returns the audit configuration.
+func (a *Audit) Config() AuditConfig {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.config
+}
+
+// Update calls fn to modify the audit configuration. The configuration is
+// left unchanged if fn returns an error.
+func (a *Audit) Update(fn func(c *AuditConfig) error) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := a.config
+	if err := fn(&c); err != nil {
+		return err
+	}
+	a.config = c
+	return nil
+}
+
+// Audit returns the audit subsystem state.
+func (k *Kernel) Audit() *Audit {
+	return &k.audit
+}
@@ -25,6 +25,9 @@ func (c *Credentials) StateFields() []string {
 		"BoundingCaps",
 		"KeepCaps",
 		"UserNamespace",
+		"SessionKeyring",
+		"LoginKUID",
+		"SessionID",
 	}
 }
 
@@ -46,6 +49,9 @@ func (c *Credentials) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(10, &c.BoundingCaps)
 	stateSinkObject.Save(11, &c.KeepCaps)
 	stateSinkObject.Save(12, &c.UserNamespace)
+	stateSinkObject.Save(13, &c.SessionKeyring)
+	stateSinkObject.Save(14, &c.LoginKUID)
+	stateSinkObject.Save(15, &c.SessionID)
 }
 
 func (c *Credentials) afterLoad() {}
@@ -65,6 +71,9 @@ func (c *Credentials) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(10, &c.BoundingCaps)
 	stateSourceObject.Load(11, &c.KeepCaps)
 	stateSourceObject.Load(12, &c.UserNamespace)
+	stateSourceObject.Load(13, &c.SessionKeyring)
+	stateSourceObject.Load(14, &c.LoginKUID)
+	stateSourceObject.Load(15, &c.SessionID)
 }
 
 func (i *IDMapEntry) StateTypeName() string {
@@ -230,6 +239,101 @@ func (i *idMapSegmentDataSlices) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(2, &i.Values)
 }
 
+func (k *Key) StateTypeName() string {
+	return "pkg/sentry/kernel/auth.Key"
+}
+
+func (k *Key) StateFields() []string {
+	return []string{
+		"ID",
+		"Type",
+		"Description",
+		"kuid",
+		"kgid",
+		"perms",
+		"payload",
+		"links",
+		"linkCount",
+		"anchored",
+		"revoked",
+		"dead",
+	}
+}
+
+func (k *Key) beforeSave() {}
+
+// +checklocksignore
+func (k *Key) StateSave(stateSinkObject state.Sink) {
+	k.beforeSave()
+	stateSinkObject.Save(0, &k.ID)
+	stateSinkObject.Save(1, &k.Type)
+	stateSinkObject.Save(2, &k.Description)
+	stateSinkObject.Save(3, &k.kuid)
+	stateSinkObject.Save(4, &k.kgid)
+	stateSinkObject.Save(5, &k.perms)
+	stateSinkObject.Save(6, &k.payload)
+	stateSinkObject.Save(7, &k.links)
+	stateSinkObject.Save(8, &k.linkCount)
+	stateSinkObject.Save(9, &k.anchored)
+	stateSinkObject.Save(10, &k.revoked)
+	stateSinkObject.Save(11, &k.dead)
+}
+
+func (k *Key) afterLoad() {}
+
+// +checklocksignore
+func (k *Key) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &k.ID)
+	stateSourceObject.Load(1, &k.Type)
+	stateSourceObject.Load(2, &k.Description)
+	stateSourceObject.Load(3, &k.kuid)
+	stateSourceObject.Load(4, &k.kgid)
+	stateSourceObject.Load(5, &k.perms)
+	stateSourceObject.Load(6, &k.payload)
+	stateSourceObject.Load(7, &k.links)
+	stateSourceObject.Load(8, &k.linkCount)
+	stateSourceObject.Load(9, &k.anchored)
+	stateSourceObject.Load(10, &k.revoked)
+	stateSourceObject.Load(11, &k.dead)
+}
+
+func (ks *KeySet) StateTypeName() string {
+	return "pkg/sentry/kernel/auth.KeySet"
+}
+
+func (ks *KeySet) StateFields() []string {
+	return []string{
+		"keys",
+		"lastID",
+		"userKeyrings",
+		"userSessionKeyrings",
+		"owned",
+	}
+}
+
+func (ks *KeySet) beforeSave() {}
+
+// +checklocksignore
+func (ks *KeySet) StateSave(stateSinkObject state.Sink) {
+	ks.beforeSave()
+	stateSinkObject.Save(0, &ks.keys)
+	stateSinkObject.Save(1, &ks.lastID)
+	stateSinkObject.Save(2, &ks.userKeyrings)
+	stateSinkObject.Save(3, &ks.userSessionKeyrings)
+	stateSinkObject.Save(4, &ks.owned)
+}
+
+func (ks *KeySet) afterLoad() {}
+
+// +checklocksignore
+func (ks *KeySet) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &ks.keys)
+	stateSourceObject.Load(1, &ks.lastID)
+	stateSourceObject.Load(2, &ks.userKeyrings)
+	stateSourceObject.Load(3, &ks.userSessionKeyrings)
+	stateSourceObject.Load(4, &ks.owned)
+}
+
 func (ns *UserNamespace) StateTypeName() string {
 	return "pkg/sentry/kernel/auth.UserNamespace"
 }
@@ -242,6 +346,8 @@ func (ns *UserNamespace) StateFields() []string {
 		"uidMapToParent",
 		"gidMapFromParent",
 		"gidMapToParent",
+		"setgroupsDenied",
+		"keys",
 	}
 }
 
@@ -256,6 +362,8 @@ func (ns *UserNamespace) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(3, &ns.uidMapToParent)
 	stateSinkObject.Save(4, &ns.gidMapFromParent)
 	stateSinkObject.Save(5, &ns.gidMapToParent)
+	stateSinkObject.Save(6, &ns.setgroupsDenied)
+	stateSinkObject.Save(7, &ns.keys)
 }
 
 func (ns *UserNamespace) afterLoad() {}
@@ -268,6 +376,8 @@ func (ns *UserNamespace) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(3, &ns.uidMapToParent)
 	stateSourceObject.Load(4, &ns.gidMapFromParent)
 	stateSourceObject.Load(5, &ns.gidMapToParent)
+	stateSourceObject.Load(6, &ns.setgroupsDenied)
+	stateSourceObject.Load(7, &ns.keys)
 }
 
 func init() {
@@ -277,5 +387,7 @@ func init() {
 	state.Register((*idMapSet)(nil))
 	state.Register((*idMapnode)(nil))
 	state.Register((*idMapSegmentDataSlices)(nil))
+	state.Register((*Key)(nil))
+	state.Register((*KeySet)(nil))
 	state.Register((*UserNamespace)(nil))
 }
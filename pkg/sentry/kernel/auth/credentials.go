@@ -58,6 +58,18 @@ type Credentials struct {
 
 	// The user namespace associated with the owner of the credentials.
 	UserNamespace *UserNamespace
+
+	// SessionKeyring is the session keyring, or nil if no session keyring
+	// was joined.
+	SessionKeyring *Key
+
+	// LoginKUID is the audit login UID, set through /proc/[pid]/loginuid.
+	// It's NoID until a login service sets it.
+	LoginKUID KUID
+
+	// SessionID is the audit session ID, assigned when LoginKUID is set. It's
+	// linux.AUDIT_SID_UNSET when LoginKUID is NoID.
+	SessionID uint32
 }
 
 // NewAnonymousCredentials returns a set of credentials with no capabilities in
@@ -77,6 +89,8 @@ func NewAnonymousCredentials() *Credentials {
 		EffectiveKGID: NobodyKGID,
 		SavedKGID:     NobodyKGID,
 		UserNamespace: NewRootUserNamespace(),
+		LoginKUID:     NoID,
+		SessionID:     linux.AUDIT_SID_UNSET,
 	}
 }
 
@@ -97,6 +111,8 @@ func NewRootCredentials(ns *UserNamespace) *Credentials {
 		EffectiveCaps: AllCapabilities,
 		BoundingCaps:  AllCapabilities,
 		UserNamespace: ns,
+		LoginKUID:     NoID,
+		SessionID:     linux.AUDIT_SID_UNSET,
 	}
 }
 
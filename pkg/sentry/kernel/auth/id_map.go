@@ -223,9 +223,10 @@ func (ns *UserNamespace) SetGIDMap(ctx context.Context, entries []IDMapEntry) er
 		}
 		// "In the case of gid_map, use of the setgroups(2) system call must
 		// first be denied by writing "deny" to the /proc/[pid]/setgroups file
-		// (see below) before writing to gid_map." (This file isn't implemented
-		// in the version of Linux we're emulating; see comment in
-		// UserNamespace.)
+		// (see below) before writing to gid_map."
+		if !ns.setgroupsDenied {
+			return linuxerr.EPERM
+		}
 	}
 	if err := ns.trySetGIDMap(entries); err != nil {
 		ns.gidMapFromParent.RemoveAll()
@@ -283,3 +284,33 @@ func (ns *UserNamespace) getIDMap(m *idMapSet) []IDMapEntry {
 	}
 	return entries
 }
+
+// SetgroupsAllowed returns true if setgroups(2) is allowed in ns.
+func (ns *UserNamespace) SetgroupsAllowed() bool {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	return !ns.setgroupsDenied
+}
+
+// SetSetgroupsAllowed allows or denies setgroups(2) in ns, as done by writing
+// "allow" or "deny" to /proc/[pid]/setgroups.
+func (ns *UserNamespace) SetSetgroupsAllowed(allow bool) error {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+	if allow {
+		// "Once the string "deny" has been written to the file, it is no
+		// longer possible to re-enable setgroups(2) in that user namespace." -
+		// user_namespaces(7)
+		if ns.setgroupsDenied {
+			return linuxerr.EPERM
+		}
+		return nil
+	}
+	// "... it is not permitted to write "deny" to this file after gid_map has
+	// been written" - user_namespaces(7)
+	if !ns.gidMapFromParent.IsEmpty() {
+		return linuxerr.EPERM
+	}
+	ns.setgroupsDenied = true
+	return nil
+}
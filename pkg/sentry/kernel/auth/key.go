@@ -0,0 +1,734 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package auth
+
+import (
+	"fmt"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+)
+
+// KeySerial is the ID of a key.
+type KeySerial int32
+
+// Supported key types.
+const (
+	// KeyTypeKeyring is the type of keyrings, which hold links to other
+	// keys.
+	KeyTypeKeyring = "keyring"
+
+	// KeyTypeUser is the type of keys holding an arbitrary payload.
+	KeyTypeUser = "user"
+)
+
+const (
+	// MaxKeyDescription is the maximum length of a key description.
+	MaxKeyDescription = 4095
+
+	// MaxKeyPayload is the maximum size of the payload of a user key.
+	MaxKeyPayload = 32767
+
+	// maxKeys and maxRootKeys are the maximum number of keys owned by a
+	// user, and by root. They match the defaults of
+	// /proc/sys/kernel/keys/maxkeys and root_maxkeys.
+	maxKeys     = 200
+	maxRootKeys = 1000000
+)
+
+// Default permissions of new keys, from Linux.
+const (
+	// defaultKeyPerms are the permissions of keys created by add_key(2).
+	defaultKeyPerms = linux.KEY_POS_ALL | linux.KEY_VIEW<<linux.KEY_USR_SHIFT
+
+	// sessionKeyringPerms are the permissions of session keyrings.
+	sessionKeyringPerms = linux.KEY_POS_ALL | (linux.KEY_VIEW|linux.KEY_READ)<<linux.KEY_USR_SHIFT
+
+	// userKeyringPerms are the permissions of user and user session
+	// keyrings.
+	userKeyringPerms = linux.KEY_POS_ALL | linux.KEY_USR_ALL
+)
+
+// Key is a key or a keyring. Keys only exist in memory, and are kept in the
+// KeySet of the root user namespace.
+//
+// +stateify savable
+type Key struct {
+	// ID, Type and Description are immutable.
+	ID          KeySerial
+	Type        string
+	Description string
+
+	// All following fields are protected by the mutex of the KeySet that
+	// holds the key.
+
+	// kuid and kgid are the owner and group of the key.
+	kuid KUID
+	kgid KGID
+
+	// perms are the permissions of the key, see linux.KEY_*.
+	perms uint32
+
+	// payload is the payload of a user key.
+	payload []byte
+
+	// links are the keys linked in a keyring, in link order.
+	links []*Key
+
+	// linkCount is the number of keyrings the key is linked in.
+	linkCount int
+
+	// anchored is set for keyrings that may be referenced by credentials,
+	// which are never destroyed.
+	anchored bool
+
+	// revoked is set once the key is revoked.
+	revoked bool
+
+	// dead is set once the key is destroyed or invalidated.
+	dead bool
+}
+
+// KeyRef is a reference to a key held by a task.
+type KeyRef struct {
+	// Key is the referenced key.
+	Key *Key
+
+	// Possessed is true if the task possesses the key because it was
+	// obtained from one of the task's keyrings, e.g. its session keyring.
+	// Keys reachable from the task's keyrings are always possessed.
+	Possessed bool
+}
+
+// KeySet holds all keys of a root user namespace and its descendants.
+//
+// +stateify savable
+type KeySet struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// keys maps key IDs to live keys.
+	//
+	// +checklocks:mu
+	keys map[KeySerial]*Key
+
+	// lastID is the last key ID allocated.
+	//
+	// +checklocks:mu
+	lastID KeySerial
+
+	// userKeyrings and userSessionKeyrings map users to their user and
+	// user session keyrings.
+	//
+	// +checklocks:mu
+	userKeyrings map[KUID]*Key
+	// +checklocks:mu
+	userSessionKeyrings map[KUID]*Key
+
+	// owned is the number of keys owned by each user.
+	//
+	// +checklocks:mu
+	owned map[KUID]int
+}
+
+// Keys returns the KeySet of the root user namespace of ns.
+func (ns *UserNamespace) Keys() *KeySet {
+	root := ns
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if root.keys == nil {
+		root.keys = &KeySet{
+			keys:                make(map[KeySerial]*Key),
+			userKeyrings:        make(map[KUID]*Key),
+			userSessionKeyrings: make(map[KUID]*Key),
+			owned:               make(map[KUID]int),
+		}
+	}
+	return root.keys
+}
+
+// newKeyLocked creates a key owned by c.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) newKeyLocked(c *Credentials, typ, desc string, perms uint32, payload []byte) (*Key, error) {
+	limit := maxKeys
+	if c.EffectiveKUID == RootKUID {
+		limit = maxRootKeys
+	}
+	if ks.owned[c.EffectiveKUID] >= limit {
+		return nil, linuxerr.EDQUOT
+	}
+	for {
+		ks.lastID++
+		if ks.lastID <= 0 {
+			ks.lastID = 1
+		}
+		if _, ok := ks.keys[ks.lastID]; !ok {
+			break
+		}
+	}
+	k := &Key{
+		ID:          ks.lastID,
+		Type:        typ,
+		Description: desc,
+		kuid:        c.EffectiveKUID,
+		kgid:        c.EffectiveKGID,
+		perms:       perms,
+		payload:     payload,
+	}
+	ks.keys[k.ID] = k
+	ks.owned[k.kuid]++
+	return k, nil
+}
+
+// destroyLocked destroys k, and unlinks the keys it links to.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) destroyLocked(k *Key) {
+	if k.dead {
+		return
+	}
+	k.dead = true
+	delete(ks.keys, k.ID)
+	if ks.owned[k.kuid]--; ks.owned[k.kuid] == 0 {
+		delete(ks.owned, k.kuid)
+	}
+	links := k.links
+	k.links = nil
+	k.payload = nil
+	for _, l := range links {
+		ks.dropLinkLocked(l)
+	}
+}
+
+// dropLinkLocked is called when a link to k is removed.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) dropLinkLocked(k *Key) {
+	k.linkCount--
+	if k.linkCount == 0 && !k.anchored {
+		ks.destroyLocked(k)
+	}
+}
+
+// linkLocked links k in keyring, replacing any key of the same type and
+// description.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) linkLocked(keyring, k *Key) error {
+	if k.Type == KeyTypeKeyring && (k == keyring || ks.reachableLocked(k, keyring)) {
+		// The link would create a cycle.
+		return linuxerr.EDEADLK
+	}
+	for i, l := range keyring.links {
+		if l == k {
+			return nil
+		}
+		if l.Type == k.Type && l.Description == k.Description {
+			keyring.links[i] = k
+			k.linkCount++
+			ks.dropLinkLocked(l)
+			return nil
+		}
+	}
+	keyring.links = append(keyring.links, k)
+	k.linkCount++
+	return nil
+}
+
+// reachableLocked returns true if k is linked, directly or not, from keyring.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) reachableLocked(keyring, k *Key) bool {
+	seen := make(map[*Key]struct{})
+	var walk func(*Key) bool
+	walk = func(r *Key) bool {
+		if _, ok := seen[r]; ok {
+			return false
+		}
+		seen[r] = struct{}{}
+		for _, l := range r.links {
+			if l == k || (l.Type == KeyTypeKeyring && walk(l)) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(keyring)
+}
+
+// rootKeyringLocked returns the keyring from which c possesses keys: its
+// session keyring or, if it has none, its user session keyring.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) rootKeyringLocked(c *Credentials) *Key {
+	if c.SessionKeyring != nil {
+		return c.SessionKeyring
+	}
+	return ks.userSessionKeyrings[c.EffectiveKUID]
+}
+
+// basePermsLocked returns the permissions c has on k, ignoring possession.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) basePermsLocked(c *Credentials, k *Key) uint32 {
+	switch {
+	case k.kuid == c.EffectiveKUID:
+		return (k.perms >> linux.KEY_USR_SHIFT) & linux.KEY_ALL
+	case c.InGroup(k.kgid):
+		return (k.perms >> linux.KEY_GRP_SHIFT) & linux.KEY_ALL
+	default:
+		return (k.perms >> linux.KEY_OTH_SHIFT) & linux.KEY_ALL
+	}
+}
+
+// possessedLocked returns true if k can be reached from the root keyring of c
+// through keyrings c may search.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) possessedLocked(c *Credentials, k *Key) bool {
+	root := ks.rootKeyringLocked(c)
+	if root == nil || root.dead {
+		return false
+	}
+	found := false
+	ks.searchLocked(c, root, func(l *Key) bool {
+		found = l == k
+		return found
+	})
+	return found
+}
+
+// searchLocked calls fn with keyring and, recursively, with all keys linked
+// from keyrings c may search, as a possessor, until fn returns true.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) searchLocked(c *Credentials, keyring *Key, fn func(*Key) bool) bool {
+	seen := make(map[*Key]struct{})
+	var walk func(*Key) bool
+	walk = func(k *Key) bool {
+		if _, ok := seen[k]; ok {
+			return false
+		}
+		seen[k] = struct{}{}
+		if fn(k) {
+			return true
+		}
+		if k.Type != KeyTypeKeyring || k.revoked {
+			return false
+		}
+		perms := ks.basePermsLocked(c, k) | (k.perms>>linux.KEY_POS_SHIFT)&linux.KEY_ALL
+		if perms&linux.KEY_SEARCH == 0 {
+			return false
+		}
+		for _, l := range k.links {
+			if walk(l) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(keyring)
+}
+
+// checkLocked checks that r is a live key on which c has all permissions in
+// need.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) checkLocked(c *Credentials, r KeyRef, need uint32) error {
+	k := r.Key
+	if k.dead {
+		return linuxerr.ENOKEY
+	}
+	perms := ks.basePermsLocked(c, k)
+	if r.Possessed || ks.possessedLocked(c, k) {
+		perms |= (k.perms >> linux.KEY_POS_SHIFT) & linux.KEY_ALL
+	}
+	if perms&need != need {
+		return linuxerr.EACCES
+	}
+	if k.revoked {
+		return linuxerr.EKEYREVOKED
+	}
+	return nil
+}
+
+// Check checks that r is a live key on which c has all permissions in need.
+func (ks *KeySet) Check(c *Credentials, r KeyRef, need uint32) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.checkLocked(c, r, need)
+}
+
+// Find returns the key with serial id.
+func (ks *KeySet) Find(id KeySerial) (*Key, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	k, ok := ks.keys[id]
+	if !ok {
+		return nil, linuxerr.ENOKEY
+	}
+	return k, nil
+}
+
+// UserKeyring returns the user keyring of the effective user of c or, if
+// session is true, its user session keyring, creating it if needed.
+func (ks *KeySet) UserKeyring(c *Credentials, session bool) (*Key, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	k := ks.userKeyrings[c.EffectiveKUID]
+	if k == nil {
+		var err error
+		desc := fmt.Sprintf("_uid.%d", c.EffectiveKUID)
+		if k, err = ks.newKeyLocked(c, KeyTypeKeyring, desc, userKeyringPerms, nil); err != nil {
+			return nil, err
+		}
+		k.anchored = true
+		ks.userKeyrings[c.EffectiveKUID] = k
+	}
+	if !session {
+		return k, nil
+	}
+	s := ks.userSessionKeyrings[c.EffectiveKUID]
+	if s == nil {
+		var err error
+		desc := fmt.Sprintf("_uid_ses.%d", c.EffectiveKUID)
+		if s, err = ks.newKeyLocked(c, KeyTypeKeyring, desc, userKeyringPerms, nil); err != nil {
+			return nil, err
+		}
+		s.anchored = true
+		// The user keyring is linked in the user session keyring, so that
+		// it's possessed by default.
+		if err := ks.linkLocked(s, k); err != nil {
+			return nil, err
+		}
+		ks.userSessionKeyrings[c.EffectiveKUID] = s
+	}
+	return s, nil
+}
+
+// JoinSessionKeyring returns a new session keyring for c. If name isn't
+// empty, the existing keyring with that description that c may search is
+// returned instead, if any.
+func (ks *KeySet) JoinSessionKeyring(c *Credentials, name string) (*Key, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if name == "" {
+		name = "_ses"
+	} else {
+		for _, k := range ks.keys {
+			if k.Type != KeyTypeKeyring || k.Description != name {
+				continue
+			}
+			if err := ks.checkLocked(c, KeyRef{Key: k}, linux.KEY_SEARCH); err != nil {
+				return nil, err
+			}
+			k.anchored = true
+			return k, nil
+		}
+	}
+	k, err := ks.newKeyLocked(c, KeyTypeKeyring, name, sessionKeyringPerms, nil)
+	if err != nil {
+		return nil, err
+	}
+	k.anchored = true
+	return k, nil
+}
+
+// Add adds a key of type typ, with description desc and payload payload, to
+// keyring. If keyring already links a user key with the same description
+// that c may write to, its payload is updated instead.
+func (ks *KeySet) Add(c *Credentials, keyring KeyRef, typ, desc string, payload []byte) (*Key, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, keyring, linux.KEY_WRITE); err != nil {
+		return nil, err
+	}
+	if keyring.Key.Type != KeyTypeKeyring {
+		return nil, linuxerr.ENOTDIR
+	}
+	if typ == KeyTypeUser {
+		for _, l := range keyring.Key.links {
+			if l.Type != typ || l.Description != desc || l.dead || l.revoked {
+				continue
+			}
+			if ks.checkLocked(c, KeyRef{Key: l, Possessed: keyring.Possessed}, linux.KEY_WRITE) == nil {
+				l.payload = payload
+				return l, nil
+			}
+		}
+	}
+	k, err := ks.newKeyLocked(c, typ, desc, defaultKeyPerms, payload)
+	if err != nil {
+		return nil, err
+	}
+	if err := ks.linkLocked(keyring.Key, k); err != nil {
+		ks.destroyLocked(k)
+		return nil, err
+	}
+	return k, nil
+}
+
+// Search searches keyring and the keyrings linked from it for a key of type
+// typ and description desc that c may search.
+func (ks *KeySet) Search(c *Credentials, keyring KeyRef, typ, desc string) (*Key, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, keyring, linux.KEY_SEARCH); err != nil {
+		return nil, err
+	}
+	if keyring.Key.Type != KeyTypeKeyring {
+		return nil, linuxerr.ENOTDIR
+	}
+	return ks.searchKeyLocked(c, keyring.Key, typ, desc)
+}
+
+// Request searches the keyrings of c for a key of type typ and description
+// desc.
+func (ks *KeySet) Request(c *Credentials, typ, desc string) (*Key, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	root := ks.rootKeyringLocked(c)
+	if root == nil || root.dead {
+		return nil, linuxerr.ENOKEY
+	}
+	return ks.searchKeyLocked(c, root, typ, desc)
+}
+
+// searchKeyLocked implements Search and Request.
+//
+// +checklocks:ks.mu
+func (ks *KeySet) searchKeyLocked(c *Credentials, keyring *Key, typ, desc string) (*Key, error) {
+	var found *Key
+	ks.searchLocked(c, keyring, func(k *Key) bool {
+		if k == keyring || k.Type != typ || k.Description != desc || k.dead {
+			return false
+		}
+		if ks.checkLocked(c, KeyRef{Key: k, Possessed: true}, linux.KEY_SEARCH) != nil {
+			return false
+		}
+		found = k
+		return true
+	})
+	if found == nil {
+		return nil, linuxerr.ENOKEY
+	}
+	return found, nil
+}
+
+// Link links key in keyring.
+func (ks *KeySet) Link(c *Credentials, key, keyring KeyRef) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, key, linux.KEY_LINK); err != nil {
+		return err
+	}
+	if err := ks.checkLocked(c, keyring, linux.KEY_WRITE); err != nil {
+		return err
+	}
+	if keyring.Key.Type != KeyTypeKeyring {
+		return linuxerr.ENOTDIR
+	}
+	return ks.linkLocked(keyring.Key, key.Key)
+}
+
+// Unlink unlinks key from keyring.
+func (ks *KeySet) Unlink(c *Credentials, key, keyring KeyRef) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, keyring, linux.KEY_WRITE); err != nil {
+		return err
+	}
+	if keyring.Key.Type != KeyTypeKeyring {
+		return linuxerr.ENOTDIR
+	}
+	for i, l := range keyring.Key.links {
+		if l == key.Key {
+			keyring.Key.links = append(keyring.Key.links[:i], keyring.Key.links[i+1:]...)
+			ks.dropLinkLocked(l)
+			return nil
+		}
+	}
+	return linuxerr.ENOENT
+}
+
+// Clear unlinks all keys from keyring.
+func (ks *KeySet) Clear(c *Credentials, keyring KeyRef) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, keyring, linux.KEY_WRITE); err != nil {
+		return err
+	}
+	if keyring.Key.Type != KeyTypeKeyring {
+		return linuxerr.ENOTDIR
+	}
+	links := keyring.Key.links
+	keyring.Key.links = nil
+	for _, l := range links {
+		ks.dropLinkLocked(l)
+	}
+	return nil
+}
+
+// Update replaces the payload of a user key.
+func (ks *KeySet) Update(c *Credentials, key KeyRef, payload []byte) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, key, linux.KEY_WRITE); err != nil {
+		return err
+	}
+	if key.Key.Type != KeyTypeUser {
+		return linuxerr.EOPNOTSUPP
+	}
+	key.Key.payload = payload
+	return nil
+}
+
+// Revoke revokes key: all further operations on it fail with EKEYREVOKED.
+func (ks *KeySet) Revoke(c *Credentials, key KeyRef) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, key, linux.KEY_WRITE); err != nil {
+		if err2 := ks.checkLocked(c, key, linux.KEY_SETATTR); err2 != nil {
+			return err
+		}
+	}
+	key.Key.revoked = true
+	key.Key.payload = nil
+	return nil
+}
+
+// Invalidate unlinks key from all keyrings and destroys it.
+func (ks *KeySet) Invalidate(c *Credentials, key KeyRef) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, key, linux.KEY_SEARCH); err != nil {
+		return err
+	}
+	k := key.Key
+	for _, r := range ks.keys {
+		for i := 0; i < len(r.links); i++ {
+			if r.links[i] == k {
+				r.links = append(r.links[:i], r.links[i+1:]...)
+				k.linkCount--
+				i--
+			}
+		}
+	}
+	for uid, r := range ks.userKeyrings {
+		if r == k {
+			delete(ks.userKeyrings, uid)
+		}
+	}
+	for uid, r := range ks.userSessionKeyrings {
+		if r == k {
+			delete(ks.userSessionKeyrings, uid)
+		}
+	}
+	ks.destroyLocked(k)
+	return nil
+}
+
+// Chown changes the owner of key to kuid and its group to kgid, unless they
+// are invalid.
+func (ks *KeySet) Chown(c *Credentials, key KeyRef, kuid KUID, kgid KGID) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, key, linux.KEY_SETATTR); err != nil {
+		return err
+	}
+	k := key.Key
+	admin := c.HasCapability(linux.CAP_SYS_ADMIN)
+	if kuid.Ok() && kuid != k.kuid && !admin {
+		return linuxerr.EACCES
+	}
+	if kgid.Ok() && kgid != k.kgid && !admin && (k.kuid != c.EffectiveKUID || !c.InGroup(kgid)) {
+		return linuxerr.EACCES
+	}
+	if kuid.Ok() && kuid != k.kuid {
+		limit := maxKeys
+		if kuid == RootKUID {
+			limit = maxRootKeys
+		}
+		if ks.owned[kuid] >= limit {
+			return linuxerr.EDQUOT
+		}
+		if ks.owned[k.kuid]--; ks.owned[k.kuid] == 0 {
+			delete(ks.owned, k.kuid)
+		}
+		ks.owned[kuid]++
+		k.kuid = kuid
+	}
+	if kgid.Ok() {
+		k.kgid = kgid
+	}
+	return nil
+}
+
+// SetPerms sets the permissions of key.
+func (ks *KeySet) SetPerms(c *Credentials, key KeyRef, perms uint32) error {
+	if perms&^(linux.KEY_POS_ALL|linux.KEY_USR_ALL|linux.KEY_GRP_ALL|linux.KEY_OTH_ALL) != 0 {
+		return linuxerr.EINVAL
+	}
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, key, linux.KEY_SETATTR); err != nil {
+		return err
+	}
+	if key.Key.kuid != c.EffectiveKUID && !c.HasCapability(linux.CAP_SYS_ADMIN) {
+		return linuxerr.EACCES
+	}
+	key.Key.perms = perms
+	return nil
+}
+
+// Describe returns the description of key in the format of
+// KEYCTL_DESCRIBE: "type;uid;gid;perm;description".
+func (ks *KeySet) Describe(c *Credentials, key KeyRef) (string, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, key, linux.KEY_VIEW); err != nil {
+		return "", err
+	}
+	k := key.Key
+	uid := c.UserNamespace.MapFromKUID(k.kuid)
+	gid := c.UserNamespace.MapFromKGID(k.kgid)
+	return fmt.Sprintf("%s;%d;%d;%08x;%s", k.Type, uid.OrOverflow(), gid.OrOverflow(), k.perms, k.Description), nil
+}
+
+// Read returns the payload of a user key, or the IDs of the keys linked in a
+// keyring.
+func (ks *KeySet) Read(c *Credentials, key KeyRef) ([]byte, []KeySerial, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if err := ks.checkLocked(c, key, linux.KEY_READ); err != nil {
+		// A possessor may also read keys it may search.
+		if !key.Possessed || ks.checkLocked(c, key, linux.KEY_SEARCH) != nil {
+			return nil, nil, err
+		}
+	}
+	k := key.Key
+	if k.Type != KeyTypeKeyring {
+		return append([]byte(nil), k.payload...), nil, nil
+	}
+	ids := make([]KeySerial, 0, len(k.links))
+	for _, l := range k.links {
+		ids = append(ids, l.ID)
+	}
+	return nil, ids, nil
+}
@@ -48,7 +48,13 @@ type UserNamespace struct {
 	gidMapFromParent idMapSet
 	gidMapToParent   idMapSet
 
-	// TODO(b/27454212): Support disabling setgroups(2).
+	// setgroupsDenied is true if setgroups(2) was denied in the namespace
+	// through /proc/[pid]/setgroups. Once set, it can't be reset.
+	setgroupsDenied bool
+
+	// keys holds all keys of the root namespace and its descendants. It's
+	// only set in root namespaces, and created on first use.
+	keys *KeySet
 }
 
 // NewRootUserNamespace returns a UserNamespace that is appropriate for a
@@ -127,5 +133,9 @@ func (c *Credentials) NewChildUserNamespace() (*UserNamespace, error) {
 		// "When a user namespace is created, it starts without a mapping of
 		// user IDs (group IDs) to the parent user namespace." -
 		// user_namespaces(7)
+		//
+		// As in Linux's kernel/user_namespace.c:create_user_ns(), children
+		// inherit whether setgroups(2) is denied.
+		setgroupsDenied: !c.UserNamespace.SetgroupsAllowed(),
 	}, nil
 }
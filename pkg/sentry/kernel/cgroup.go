@@ -25,6 +25,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/kernfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/sched"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 )
 
@@ -163,6 +164,9 @@ func (ctx *CgroupMigrationContext) Commit() {
 	ctx.src.DecRef(ctx.t)
 	ctx.dst.IncRef()
 	ctx.t.cgroups[ctx.dst] = struct{}{}
+	if cpus := ctx.dst.CPUSet(); cpus != nil {
+		ctx.t.setCPUSetLocked(cpus, cpus.Copy())
+	}
 	ctx.t.mu.Unlock()
 }
 
@@ -218,6 +222,10 @@ type CgroupImpl interface {
 
 	// ID returns the id of this cgroup.
 	ID() uint32
+
+	// CPUSet returns the set of CPUs tasks in this cgroup may run on, or nil
+	// if the hierarchy of the cgroup has no cpuset controller.
+	CPUSet() sched.CPUSet
 }
 
 // hierarchy represents a cgroupfs filesystem instance, with a unique set of
@@ -0,0 +1,178 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/nsfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+)
+
+// CgroupNamespace represents a cgroup namespace. See cgroup_namespaces(7).
+//
+// The cgroups of the task that creates a cgroup namespace become the roots of
+// the namespace: the cgroup paths shown to tasks in the namespace are relative
+// to them, and mounts of existing cgroupfs hierarchies are rooted at them.
+//
+// +stateify savable
+type CgroupNamespace struct {
+	inode *nsfs.Inode
+
+	// userNS is the user namespace owning the namespace. Immutable.
+	userNS *auth.UserNamespace
+
+	// roots maps hierarchy IDs to the root cgroup of the namespace in each
+	// hierarchy. The namespace holds a reference on each cgroup. Hierarchies
+	// missing from roots, e.g. those created after the namespace, are rooted
+	// at the root of the hierarchy. Immutable; nil for the root namespace.
+	roots map[uint32]Cgroup
+}
+
+// newCgroupNamespace returns a new cgroup namespace rooted at the cgroups of
+// t, owned by userns.
+func (t *Task) newCgroupNamespace(userns *auth.UserNamespace) *CgroupNamespace {
+	ns := &CgroupNamespace{
+		userNS: userns,
+		roots:  make(map[uint32]Cgroup),
+	}
+	t.mu.Lock()
+	for c := range t.cgroups {
+		c.IncRef()
+		ns.roots[c.HierarchyID()] = c
+	}
+	t.mu.Unlock()
+	ns.inode = nsfs.NewInode(t, t.k.nsfsMount, ns)
+	return ns
+}
+
+// newRootCgroupNamespace returns the root cgroup namespace.
+//
+// Preconditions: k.nsfsMount is set.
+func (k *Kernel) newRootCgroupNamespace(ctx context.Context) *CgroupNamespace {
+	ns := &CgroupNamespace{userNS: k.rootUserNamespace}
+	ns.inode = nsfs.NewInode(ctx, k.nsfsMount, ns)
+	return ns
+}
+
+// UserNamespace returns the user namespace owning ns.
+func (ns *CgroupNamespace) UserNamespace() *auth.UserNamespace {
+	return ns.userNS
+}
+
+// GetInode returns the nsfs inode associated with ns.
+func (ns *CgroupNamespace) GetInode() *nsfs.Inode {
+	return ns.inode
+}
+
+// Type implements nsfs.Namespace.Type.
+func (ns *CgroupNamespace) Type() string {
+	return "cgroup"
+}
+
+// Destroy implements nsfs.Namespace.Destroy.
+func (ns *CgroupNamespace) Destroy(ctx context.Context) {
+	for _, c := range ns.roots {
+		c.decRef()
+	}
+}
+
+// IncRef increments the namespace's refcount.
+func (ns *CgroupNamespace) IncRef() {
+	ns.inode.IncRef()
+}
+
+// DecRef decrements the namespace's refcount.
+func (ns *CgroupNamespace) DecRef(ctx context.Context) {
+	ns.inode.DecRef(ctx)
+}
+
+// Root returns the root cgroup of ns in the hierarchy hid. It returns false if
+// ns is rooted at the root of the hierarchy.
+func (ns *CgroupNamespace) Root(hid uint32) (Cgroup, bool) {
+	c, ok := ns.roots[hid]
+	return c, ok
+}
+
+// relativePath returns the path of c as seen from ns, as in Linux's
+// kernel/cgroup/cgroup.c:cgroup_path_ns(): relative to the root of ns in the
+// hierarchy of c, with ".." components if c isn't a descendant of the root.
+func (ns *CgroupNamespace) relativePath(c Cgroup) string {
+	root, ok := ns.roots[c.HierarchyID()]
+	if !ok {
+		return c.Path()
+	}
+	return relativeCgroupPath(root.Path(), c.Path())
+}
+
+// relativeCgroupPath returns the absolute cgroup path p relative to the
+// absolute cgroup path root, itself as an absolute path.
+func relativeCgroupPath(root, p string) string {
+	split := func(s string) []string {
+		var cs []string
+		for _, c := range strings.Split(s, "/") {
+			if c != "" {
+				cs = append(cs, c)
+			}
+		}
+		return cs
+	}
+	rs, ps := split(root), split(p)
+	common := 0
+	for common < len(rs) && common < len(ps) && rs[common] == ps[common] {
+		common++
+	}
+	var rel []string
+	for range rs[common:] {
+		rel = append(rel, "..")
+	}
+	rel = append(rel, ps[common:]...)
+	return "/" + strings.Join(rel, "/")
+}
+
+// CgroupNamespace returns the cgroup namespace of t, with a reference that the
+// caller must drop.
+func (t *Task) CgroupNamespace() *CgroupNamespace {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ns := t.cgroupns
+	if ns == nil {
+		ns = t.k.rootCgroupNamespace
+	}
+	ns.IncRef()
+	return ns
+}
+
+// RootCgroupNamespace returns the root cgroup namespace.
+func (k *Kernel) RootCgroupNamespace() *CgroupNamespace {
+	return k.rootCgroupNamespace
+}
+
+// CgroupNamespaceRoot returns the root cgroup of the cgroup namespace of the
+// task in ctx, if any, in the hierarchy hid. It returns false if the namespace
+// is rooted at the root of the hierarchy.
+func CgroupNamespaceRoot(ctx context.Context, hid uint32) (Cgroup, bool) {
+	t := TaskFromContext(ctx)
+	if t == nil {
+		return Cgroup{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cgroupns == nil {
+		return Cgroup{}, false
+	}
+	return t.cgroupns.Root(hid)
+}
@@ -0,0 +1,478 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/arch"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/limits"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/mm"
+	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
+)
+
+// CoreDumpInfo describes a process that is being dumped.
+type CoreDumpInfo struct {
+	// PID and TID are the thread group and thread IDs of the dumping task in
+	// its PID namespace.
+	PID ThreadID
+	TID ThreadID
+
+	// UID and GID are the real user and group IDs of the dumping task in
+	// its user namespace.
+	UID uint32
+	GID uint32
+
+	// Signal is the signal that caused the dump.
+	Signal linux.Signal
+
+	// FaultAddr is the faulting address for signals caused by faults.
+	FaultAddr uint64
+
+	// Comm is the name of the dumping task.
+	Comm string
+
+	// Executable is the path of the executable, if known.
+	Executable string
+
+	// ContainerID is the container the process belongs to.
+	ContainerID string
+
+	// Hostname is the hostname in the UTS namespace of the task.
+	Hostname string
+
+	// Time is the time of the dump.
+	Time time.Time
+
+	// Limit is the RLIMIT_CORE soft limit of the process. Dumps are
+	// truncated to this size.
+	Limit uint64
+}
+
+// CoreDumper creates the files that core dumps are written to.
+type CoreDumper interface {
+	// CreateCoreFile returns the file a core dump described by info is
+	// written to. The file is closed once the dump is complete or failed.
+	CreateCoreFile(info *CoreDumpInfo) (io.WriteCloser, error)
+}
+
+// SetCoreDumper enables core dumps, which are created by d. If d is nil,
+// core dumps are disabled.
+func (k *Kernel) SetCoreDumper(d CoreDumper) {
+	k.coreDumper = d
+}
+
+// errCoreLimit is returned when a core dump reaches RLIMIT_CORE.
+var errCoreLimit = errors.New("core dump reached RLIMIT_CORE")
+
+// coreLimitWriter fails writes beyond a size limit, writing as much as
+// possible.
+type coreLimitWriter struct {
+	w io.Writer
+	n uint64
+}
+
+// Write implements io.Writer.Write.
+func (w *coreLimitWriter) Write(p []byte) (int, error) {
+	if uint64(len(p)) <= w.n {
+		n, err := w.w.Write(p)
+		w.n -= uint64(n)
+		return n, err
+	}
+	n, err := w.w.Write(p[:w.n])
+	w.n -= uint64(n)
+	if err == nil {
+		err = errCoreLimit
+	}
+	return n, err
+}
+
+// vsyscallStart is the start of the emulated vsyscall page, which isn't
+// backed by a VMA and can't be dumped.
+const vsyscallStart = hostarch.Addr(0xffffffffff600000)
+
+// coreVMA is a VMA included in a core dump.
+type coreVMA struct {
+	start  hostarch.Addr
+	end    hostarch.Addr
+	perms  hostarch.AccessType
+	offset uint64
+	path   string
+
+	// dump is true if the contents of the VMA are included in the dump.
+	dump bool
+}
+
+// maybeDumpCore writes a core dump of t's process, which is being killed by
+// sig, if core dumps are enabled and allowed by RLIMIT_CORE. It returns true
+// if a dump was written, even if truncated.
+//
+// Only the registers of t are included. Other tasks in the thread group may
+// still be running while the dump is taken.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) maybeDumpCore(sig linux.Signal, info *linux.SignalInfo) bool {
+	d := t.k.coreDumper
+	if d == nil {
+		return false
+	}
+	limit := t.tg.Limits().Get(limits.Core).Cur
+	if limit == 0 {
+		return false
+	}
+	m := t.MemoryManager()
+	if m == nil || m.Dumpability() == mm.NotDumpable {
+		return false
+	}
+
+	ci := &CoreDumpInfo{
+		PID:         t.tg.pidns.IDOfThreadGroup(t.tg),
+		TID:         t.tg.pidns.IDOfTask(t),
+		UID:         uint32(t.Credentials().RealKUID.In(t.UserNamespace()).OrOverflow()),
+		GID:         uint32(t.Credentials().RealKGID.In(t.UserNamespace()).OrOverflow()),
+		Signal:      sig,
+		Comm:        t.Name(),
+		ContainerID: t.ContainerID(),
+		Hostname:    t.UTSNamespace().HostName(),
+		Time:        time.Unix(0, t.k.RealtimeClock().Now().Nanoseconds()),
+		Limit:       limit,
+	}
+	switch sig {
+	case linux.SIGSEGV, linux.SIGFPE, linux.SIGILL, linux.SIGTRAP, linux.SIGBUS:
+		ci.FaultAddr = info.Addr()
+	}
+	if exe := m.Executable(); exe != nil {
+		root := t.FSContext().RootDirectory()
+		ci.Executable, _ = t.k.VFS().PathnameWithDeleted(t, root, exe.VirtualDentry())
+		root.DecRef(t)
+		exe.DecRef(t)
+	}
+
+	f, err := d.CreateCoreFile(ci)
+	if err != nil {
+		t.Warningf("Failed to create core file: %v", err)
+		return false
+	}
+	err = t.writeCore(&coreLimitWriter{w: f, n: limit}, info)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case err == errCoreLimit:
+		t.Infof("Core dump truncated to RLIMIT_CORE (%d bytes)", limit)
+	case err != nil:
+		t.Warningf("Failed to write core dump: %v", err)
+		return false
+	}
+	return true
+}
+
+// writeCore writes an ELF core file of t's process to w.
+func (t *Task) writeCore(w io.Writer, info *linux.SignalInfo) error {
+	m := t.MemoryManager()
+	var vmas []coreVMA
+	m.ReadMapsDataInto(t, func(start, end hostarch.Addr, perms hostarch.AccessType, private string, offset uint64, _, _ uint32, _ uint64, path string) {
+		if start >= vsyscallStart {
+			return
+		}
+		// Similar to Linux's default coredump_filter, file-backed shared
+		// mappings aren't dumped. Shared memory that isn't linked in a
+		// filesystem is.
+		shared := private != "p"
+		dump := perms.Read && (!shared || strings.HasSuffix(path, " (deleted)") || strings.HasPrefix(path, "/SYSV"))
+		vmas = append(vmas, coreVMA{
+			start:  start,
+			end:    end,
+			perms:  perms,
+			offset: offset,
+			path:   path,
+			dump:   dump,
+		})
+	})
+	// Leave room for the PT_NOTE segment.
+	const maxPhnum = 0xffff - 1
+	if len(vmas) > maxPhnum {
+		t.Warningf("Core dump only includes the first %d of %d mappings", maxPhnum, len(vmas))
+		vmas = vmas[:maxPhnum]
+	}
+
+	notes, err := t.coreNotes(info, vmas)
+	if err != nil {
+		return err
+	}
+
+	var machine elf.Machine
+	switch t.Arch().Arch() {
+	case arch.AMD64:
+		machine = elf.EM_X86_64
+	case arch.ARM64:
+		machine = elf.EM_AARCH64
+	default:
+		return fmt.Errorf("unsupported architecture %v", t.Arch().Arch())
+	}
+
+	const (
+		ehdrSize = 64
+		phdrSize = 56
+	)
+	phnum := 1 + len(vmas)
+	notesOff := uint64(ehdrSize + phdrSize*phnum)
+	dataOff := uint64(hostarch.Addr(notesOff + uint64(len(notes))).MustRoundUp())
+
+	bw := bufio.NewWriterSize(w, 64<<10)
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(machine),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     ehdrSize,
+		Ehsize:    ehdrSize,
+		Phentsize: phdrSize,
+		Phnum:     uint16(phnum),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	if err := binary.Write(bw, binary.LittleEndian, &hdr); err != nil {
+		return err
+	}
+
+	phdrs := make([]elf.Prog64, 0, phnum)
+	phdrs = append(phdrs, elf.Prog64{
+		Type:   uint32(elf.PT_NOTE),
+		Off:    notesOff,
+		Filesz: uint64(len(notes)),
+		Align:  4,
+	})
+	off := dataOff
+	for _, vma := range vmas {
+		size := uint64(vma.end - vma.start)
+		p := elf.Prog64{
+			Type:  uint32(elf.PT_LOAD),
+			Flags: uint32(progFlags(vma.perms)),
+			Off:   off,
+			Vaddr: uint64(vma.start),
+			Memsz: size,
+			Align: hostarch.PageSize,
+		}
+		if vma.dump {
+			p.Filesz = size
+			off += size
+		}
+		phdrs = append(phdrs, p)
+	}
+	if err := binary.Write(bw, binary.LittleEndian, phdrs); err != nil {
+		return err
+	}
+	if _, err := bw.Write(notes); err != nil {
+		return err
+	}
+	if _, err := bw.Write(make([]byte, dataOff-notesOff-uint64(len(notes)))); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64<<10)
+	for _, vma := range vmas {
+		if !vma.dump {
+			continue
+		}
+		for addr := vma.start; addr < vma.end; {
+			chunk := buf
+			if rem := uint64(vma.end - addr); rem < uint64(len(chunk)) {
+				chunk = chunk[:rem]
+			}
+			n, _ := m.CopyIn(t, addr, chunk, usermem.IOOpts{IgnorePermissions: true})
+			// Pages that can't be read, e.g. beyond the end of a file, are
+			// dumped as zeroes.
+			for i := n; i < len(chunk); i++ {
+				chunk[i] = 0
+			}
+			if _, err := bw.Write(chunk); err != nil {
+				return err
+			}
+			addr += hostarch.Addr(len(chunk))
+		}
+	}
+	return bw.Flush()
+}
+
+func progFlags(perms hostarch.AccessType) elf.ProgFlag {
+	var f elf.ProgFlag
+	if perms.Read {
+		f |= elf.PF_R
+	}
+	if perms.Write {
+		f |= elf.PF_W
+	}
+	if perms.Execute {
+		f |= elf.PF_X
+	}
+	return f
+}
+
+// Note types defined in include/uapi/linux/elf.h.
+const (
+	ntPrstatus = 1
+	ntPrfpreg  = 2
+	ntPrpsinfo = 3
+	ntAuxv     = 6
+	ntSiginfo  = 0x53494749
+	ntFile     = 0x46494c45
+)
+
+// coreNotes returns the contents of the PT_NOTE segment of a core dump.
+func (t *Task) coreNotes(info *linux.SignalInfo, vmas []coreVMA) ([]byte, error) {
+	var notes bytes.Buffer
+	le := binary.LittleEndian
+
+	t.tg.pidns.owner.mu.RLock()
+	var ppid ThreadID
+	if t.parent != nil {
+		ppid = t.tg.pidns.tids[t.parent.tg.leader]
+	}
+	pid := t.tg.pidns.tids[t]
+	pgid := t.tg.pidns.pgids[t.tg.processGroup]
+	sid := t.tg.pidns.sids[t.tg.processGroup.session]
+	t.tg.pidns.owner.mu.RUnlock()
+
+	// struct elf_prstatus.
+	var regs bytes.Buffer
+	if _, err := t.Arch().PtraceGetRegSet(ntPrstatus, &regs, 4096, t.k.FeatureSet()); err != nil {
+		return nil, fmt.Errorf("getting registers: %w", err)
+	}
+	var fpregs bytes.Buffer
+	_, fpErr := t.Arch().PtraceGetRegSet(ntPrfpreg, &fpregs, 4096, t.k.FeatureSet())
+	fpValid := fpErr == nil && fpregs.Len() > 0
+
+	var prstatus bytes.Buffer
+	binary.Write(&prstatus, le, []int32{info.Signo, info.Errno, info.Code})
+	binary.Write(&prstatus, le, []int16{int16(info.Signo), 0})
+	binary.Write(&prstatus, le, []uint64{uint64(t.PendingSignals()), uint64(t.SignalMask())})
+	binary.Write(&prstatus, le, []int32{int32(pid), int32(ppid), int32(pgid), int32(sid)})
+	cpu := t.CPUStats()
+	children := t.tg.JoinedChildCPUStats()
+	for _, d := range []time.Duration{cpu.UserTime, cpu.SysTime, children.UserTime, children.SysTime} {
+		tv := linux.DurationToTimeval(d)
+		binary.Write(&prstatus, le, []int64{tv.Sec, tv.Usec})
+	}
+	prstatus.Write(regs.Bytes())
+	if fpValid {
+		binary.Write(&prstatus, le, int32(1))
+	} else {
+		binary.Write(&prstatus, le, int32(0))
+	}
+	prstatus.Write(make([]byte, alignUp(prstatus.Len(), 8)-prstatus.Len()))
+	writeNote(&notes, ntPrstatus, prstatus.Bytes())
+
+	// struct elf_prpsinfo.
+	var prpsinfo bytes.Buffer
+	prpsinfo.Write([]byte{0 /* state */, 'R' /* sname */, 0 /* zomb */, byte(int8(t.Niceness()))})
+	prpsinfo.Write(make([]byte, 4))
+	binary.Write(&prpsinfo, le, uint64(0) /* flag */)
+	creds := t.Credentials()
+	binary.Write(&prpsinfo, le, []uint32{
+		uint32(creds.RealKUID.In(t.UserNamespace()).OrOverflow()),
+		uint32(creds.RealKGID.In(t.UserNamespace()).OrOverflow()),
+	})
+	binary.Write(&prpsinfo, le, []int32{int32(pid), int32(ppid), int32(pgid), int32(sid)})
+	var fname [16]byte
+	copy(fname[:len(fname)-1], t.Name())
+	prpsinfo.Write(fname[:])
+	var psargs [80]byte
+	copy(psargs[:len(psargs)-1], t.coreArgs(len(psargs)-1))
+	prpsinfo.Write(psargs[:])
+	writeNote(&notes, ntPrpsinfo, prpsinfo.Bytes())
+
+	siginfo := make([]byte, info.SizeBytes())
+	info.MarshalBytes(siginfo)
+	writeNote(&notes, ntSiginfo, siginfo)
+
+	if fpValid {
+		writeNote(&notes, ntPrfpreg, fpregs.Bytes())
+	}
+
+	var auxv bytes.Buffer
+	for _, e := range t.MemoryManager().Auxv() {
+		binary.Write(&auxv, le, []uint64{e.Key, uint64(e.Value)})
+	}
+	binary.Write(&auxv, le, []uint64{linux.AT_NULL, 0})
+	writeNote(&notes, ntAuxv, auxv.Bytes())
+
+	// NT_FILE lets debuggers find the files backing mappings.
+	var files []coreVMA
+	for _, vma := range vmas {
+		if strings.HasPrefix(vma.path, "/") {
+			files = append(files, vma)
+		}
+	}
+	var ntfile bytes.Buffer
+	binary.Write(&ntfile, le, []uint64{uint64(len(files)), hostarch.PageSize})
+	for _, f := range files {
+		binary.Write(&ntfile, le, []uint64{uint64(f.start), uint64(f.end), f.offset / hostarch.PageSize})
+	}
+	for _, f := range files {
+		ntfile.WriteString(f.path)
+		ntfile.WriteByte(0)
+	}
+	writeNote(&notes, ntFile, ntfile.Bytes())
+
+	return notes.Bytes(), nil
+}
+
+// coreArgs returns up to n bytes of the command line of t's process, with
+// arguments separated by spaces.
+func (t *Task) coreArgs(n int) []byte {
+	m := t.MemoryManager()
+	ar, ok := m.ArgvStart().ToRange(uint64(m.ArgvEnd() - m.ArgvStart()))
+	if !ok || ar.Length() == 0 {
+		return nil
+	}
+	if ar.Length() > hostarch.Addr(n) {
+		ar.End = ar.Start + hostarch.Addr(n)
+	}
+	buf := make([]byte, ar.Length())
+	read, _ := m.CopyIn(t, ar.Start, buf, usermem.IOOpts{IgnorePermissions: true})
+	buf = bytes.TrimRight(buf[:read], "\x00")
+	for i, c := range buf {
+		if c == 0 {
+			buf[i] = ' '
+		}
+	}
+	return buf
+}
+
+// writeNote appends an ELF note with name "CORE" to b.
+func writeNote(b *bytes.Buffer, typ uint32, desc []byte) {
+	const name = "CORE\x00"
+	binary.Write(b, binary.LittleEndian, []uint32{uint32(len(name)), uint32(len(desc)), typ})
+	b.WriteString(name)
+	b.Write(make([]byte, alignUp(len(name), 4)-len(name)))
+	b.Write(desc)
+	b.Write(make([]byte, alignUp(len(desc), 4)-len(desc)))
+}
+
+func alignUp(n, align int) int {
+	return (n + align - 1) &^ (align - 1)
+}
@@ -0,0 +1,345 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+)
+
+// A Debugger controls a thread group on behalf of a debugger running outside
+// of the sandbox, such as a gdb remote stub. It is similar to a ptrace tracer
+// that attaches to every task in the thread group, except that it is not a
+// task and only observes signals:
+//
+//   - While a Debugger is attached, a signal dequeued by a task in the thread
+//     group stops the task instead of being handled, and is reported to the
+//     debugger. The debugger decides whether the signal is delivered when the
+//     task is resumed.
+//
+//   - The debugger can stop and resume all tasks in the thread group, and
+//     access their registers and memory while they are stopped.
+//
+// Lock order: TaskSet.mu -> signal mutex -> Debugger.mu.
+type Debugger struct {
+	tg *ThreadGroup
+
+	// notify receives a value when a task stops for the debugger.
+	notify chan struct{}
+
+	// exited is closed when all tasks in tg have exited.
+	exited chan struct{}
+
+	mu sync.Mutex
+
+	// detached is true after Detach has been called.
+	//
+	// detached is protected by mu.
+	detached bool
+
+	// stopped is the set of tasks in an external stop begun by Stop.
+	//
+	// stopped is protected by mu.
+	stopped map[*Task]struct{}
+
+	// trapped maps tasks in a debugger stop to the signal that caused the
+	// stop.
+	//
+	// trapped is protected by mu.
+	trapped map[*Task]*linux.SignalInfo
+
+	// pass maps tasks to a signal that should be delivered to them without
+	// causing another debugger stop.
+	//
+	// pass is protected by mu.
+	pass map[*Task]linux.Signal
+
+	// stepping is the set of tasks for which the debugger enabled
+	// single-stepping.
+	//
+	// stepping is protected by mu.
+	stepping map[*Task]struct{}
+}
+
+// debugStop is a TaskStop placed on tasks that dequeued a signal while a
+// Debugger is attached to their thread group.
+//
+// +stateify savable
+type debugStop struct{}
+
+// Killable implements TaskStop.Killable.
+func (*debugStop) Killable() bool { return true }
+
+// DebugResume describes how Debugger.Resume resumes a task.
+type DebugResume struct {
+	// Step causes the task to execute a single instruction and then stop
+	// with SIGTRAP.
+	Step bool
+
+	// Signal, if not zero, is delivered to the task when it resumes.
+	Signal linux.Signal
+}
+
+// AttachDebugger attaches a new Debugger to tg. Only one Debugger may be
+// attached to a thread group at a time.
+func (tg *ThreadGroup) AttachDebugger() (*Debugger, error) {
+	d := &Debugger{
+		tg:       tg,
+		notify:   make(chan struct{}, 1),
+		exited:   make(chan struct{}),
+		stopped:  make(map[*Task]struct{}),
+		trapped:  make(map[*Task]*linux.SignalInfo),
+		pass:     make(map[*Task]linux.Signal),
+		stepping: make(map[*Task]struct{}),
+	}
+	tg.pidns.owner.mu.RLock()
+	defer tg.pidns.owner.mu.RUnlock()
+	if tg.leader == nil || tg.exiting {
+		return nil, linuxerr.ESRCH
+	}
+	tg.signalHandlers.mu.Lock()
+	defer tg.signalHandlers.mu.Unlock()
+	if tg.debugger != nil {
+		return nil, linuxerr.EBUSY
+	}
+	tg.debugger = d
+	go func() { // S/R-SAFE: checkpointing is refused while a debugger is attached.
+		tg.WaitExited()
+		close(d.exited)
+	}()
+	return d, nil
+}
+
+// ThreadGroup returns the thread group controlled by d.
+func (d *Debugger) ThreadGroup() *ThreadGroup {
+	return d.tg
+}
+
+// Notify returns a channel that receives a value when a task in the thread
+// group stops for the debugger.
+func (d *Debugger) Notify() <-chan struct{} {
+	return d.notify
+}
+
+// Exited returns a channel that is closed when all tasks in the thread group
+// have exited.
+func (d *Debugger) Exited() <-chan struct{} {
+	return d.exited
+}
+
+// Tasks returns the live tasks in the thread group.
+func (d *Debugger) Tasks() []*Task {
+	ts := d.tg.pidns.owner
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	var tasks []*Task
+	for t := d.tg.tasks.Front(); t != nil; t = t.Next() {
+		if t.exitState < TaskExitZombie {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// Trapped returns the tasks that stopped for the debugger and the signals
+// that stopped them.
+func (d *Debugger) Trapped() map[*Task]*linux.SignalInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	trapped := make(map[*Task]*linux.SignalInfo, len(d.trapped))
+	for t, info := range d.trapped {
+		trapped[t] = info
+	}
+	return trapped
+}
+
+// Stop stops all tasks in the thread group and waits for them to stop.
+// Registers and memory of the tasks may be accessed until the next call to
+// Resume.
+func (d *Debugger) Stop() {
+	ts := d.tg.pidns.owner
+	for {
+		var stopping []*Task
+		ts.mu.RLock()
+		d.tg.signalHandlers.mu.Lock()
+		d.mu.Lock()
+		for t := d.tg.tasks.Front(); t != nil; t = t.Next() {
+			if _, ok := d.stopped[t]; ok {
+				continue
+			}
+			d.stopped[t] = struct{}{}
+			t.beginStopLocked()
+			t.interrupt()
+			stopping = append(stopping, t)
+		}
+		d.mu.Unlock()
+		d.tg.signalHandlers.mu.Unlock()
+		ts.mu.RUnlock()
+
+		// Tasks created by a clone that was in progress when the thread
+		// group was stopped are not covered by the loop above, so repeat
+		// until no new task has been found.
+		if len(stopping) == 0 {
+			return
+		}
+		for _, t := range stopping {
+			t.waitGoroutineStoppedOrExited()
+			if t.ExitState() == TaskExitNone {
+				t.Activate()
+				if mm := t.MemoryManager(); mm != nil {
+					t.p.PullFullState(mm.AddressSpace(), t.Arch())
+				}
+				t.Deactivate()
+			}
+		}
+	}
+}
+
+// Resume resumes all tasks stopped by Stop and all tasks stopped for the
+// debugger. actions determines how each task resumes; tasks without an entry
+// resume normally, discarding the signal that stopped them, if any.
+func (d *Debugger) Resume(actions map[*Task]DebugResume) {
+	ts := d.tg.pidns.owner
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	d.tg.signalHandlers.mu.Lock()
+	defer d.tg.signalHandlers.mu.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.resumeLocked(actions)
+}
+
+// Preconditions:
+//   - The TaskSet mutex must be locked for reading.
+//   - The signal mutex must be locked.
+//   - d.mu must be locked.
+func (d *Debugger) resumeLocked(actions map[*Task]DebugResume) {
+	for t, info := range d.trapped {
+		if _, ok := t.stop.(*debugStop); ok {
+			t.endInternalStopLocked()
+		}
+		if a, ok := actions[t]; ok && a.Signal != 0 {
+			if linux.Signal(info.Signo) != a.Signal {
+				info = &linux.SignalInfo{
+					Signo: int32(a.Signal),
+					Code:  linux.SI_USER,
+				}
+			}
+			d.pass[t] = a.Signal
+			if err := t.sendSignalLocked(info, false /* group */); err != nil {
+				t.Warningf("Failed to deliver signal %d after debugger stop: %v", a.Signal, err)
+				delete(d.pass, t)
+			}
+		}
+	}
+	d.trapped = make(map[*Task]*linux.SignalInfo)
+
+	for t, a := range actions {
+		if !a.Step || t.exitState != TaskExitNone {
+			continue
+		}
+		if _, ok := d.stepping[t]; !ok && !t.Arch().SingleStep() {
+			t.Arch().SetSingleStep()
+			d.stepping[t] = struct{}{}
+		}
+	}
+
+	for t := range d.stopped {
+		t.endStopLocked()
+	}
+	d.stopped = make(map[*Task]struct{})
+}
+
+// Detach detaches d from the thread group and resumes all tasks stopped by d.
+// Signals that stopped tasks are discarded.
+func (d *Debugger) Detach() {
+	ts := d.tg.pidns.owner
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	d.tg.signalHandlers.mu.Lock()
+	defer d.tg.signalHandlers.mu.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.detached {
+		return
+	}
+	d.detached = true
+	if d.tg.debugger == d {
+		d.tg.debugger = nil
+	}
+	for t := range d.stepping {
+		if t.exitState == TaskExitNone {
+			t.Arch().ClearSingleStep()
+		}
+	}
+	d.stepping = make(map[*Task]struct{})
+	d.resumeLocked(nil)
+}
+
+// debugSignalLocked is called after signal dequeueing to check if t should
+// enter a debugger stop instead of handling the signal. If
+// debugSignalLocked returns true, the signal has been consumed and t will
+// stop until the debugger resumes it.
+//
+// Preconditions:
+//   - The caller must be running on the task goroutine.
+//   - The signal mutex must be locked.
+func (t *Task) debugSignalLocked(info *linux.SignalInfo) bool {
+	d := t.tg.debugger
+	if d == nil || linux.Signal(info.Signo) == linux.SIGKILL || t.killedLocked() {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.detached {
+		return false
+	}
+	if _, ok := d.stepping[t]; ok {
+		t.Arch().ClearSingleStep()
+		delete(d.stepping, t)
+	}
+	if sig, ok := d.pass[t]; ok && sig == linux.Signal(info.Signo) {
+		delete(d.pass, t)
+		return false
+	}
+	t.Debugf("Entering debugger stop for signal %d", info.Signo)
+	d.trapped[t] = info
+	t.beginInternalStopLocked((*debugStop)(nil))
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// hasDebuggers returns true if a Debugger is attached to any thread group in
+// ts.
+func (ts *TaskSet) hasDebuggers() bool {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	if ts.Root == nil {
+		return false
+	}
+	for tg := range ts.Root.tgids {
+		tg.signalHandlers.mu.Lock()
+		attached := tg.debugger != nil
+		tg.signalHandlers.mu.Unlock()
+		if attached {
+			return true
+		}
+	}
+	return false
+}
@@ -19,10 +19,12 @@ package futex
 
 import (
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/memmap"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 )
 
 // KeyKind indicates the type of a Key.
@@ -232,6 +234,32 @@ type Waiter struct {
 
 	// tid is the thread ID for the waiter in case this is a PI mutex.
 	tid uint32
+
+	// requeuePIKey is the key of the PI futex that a waiter added by
+	// WaitRequeuePIPrepare may be requeued to by CmpRequeuePI. It's only
+	// valid if requeuePI is true.
+	requeuePIKey Key
+	requeuePI    bool
+
+	// requeuedPI is true if the waiter has been requeued to the PI futex by
+	// CmpRequeuePI.
+	requeuedPI bool
+
+	// lockedPI is true if ownership of a PI futex has been transferred to the
+	// waiter by UnlockPI or CmpRequeuePI.
+	lockedPI bool
+
+	// rtPriority is the real-time priority of the waiter's task, or 0 if it
+	// doesn't have a real-time scheduling policy. Like Linux, waiters with
+	// higher real-time priorities are woken first, and waiters with the same
+	// priority are woken in FIFO order. See bucket.enqueueLocked.
+	rtPriority atomicbitops.Int32
+}
+
+// SetRTPriority sets the real-time priority of w to prio, which takes effect
+// the next time w is enqueued.
+func (w *Waiter) SetRTPriority(prio int32) {
+	w.rtPriority.Store(prio)
 }
 
 // NewWaiter returns a new unqueued Waiter.
@@ -246,6 +274,23 @@ func (w *Waiter) woken() bool {
 	return len(w.C) != 0
 }
 
+// LockedPI returns true if ownership of the PI futex w was waiting for has
+// been transferred to w, in which case the wait succeeded even if it was
+// interrupted.
+//
+// Preconditions: WaitComplete has been called for w.
+func (w *Waiter) LockedPI() bool {
+	return w.lockedPI
+}
+
+// RequeuedPI returns true if w, added by WaitRequeuePIPrepare, has been
+// requeued to the PI futex by CmpRequeuePI.
+//
+// Preconditions: WaitComplete has been called for w.
+func (w *Waiter) RequeuedPI() bool {
+	return w.requeuedPI
+}
+
 // bucket holds a list of waiters for a given address hash.
 //
 // +stateify savable
@@ -256,6 +301,26 @@ type bucket struct {
 	waiters waiterList `state:"zerovalue"`
 }
 
+// enqueueLocked adds w to b, behind the waiters with the same or higher
+// real-time priorities.
+//
+// Preconditions: b.mu must be locked.
+func (b *bucket) enqueueLocked(w *Waiter) {
+	prio := w.rtPriority.Load()
+	if back := b.waiters.Back(); back == nil || back.rtPriority.Load() >= prio {
+		// This is the common case: no waiter has a real-time priority.
+		b.waiters.PushBack(w)
+		return
+	}
+	for e := b.waiters.Front(); e != nil; e = e.Next() {
+		if e.rtPriority.Load() < prio {
+			b.waiters.InsertBefore(e, w)
+			return
+		}
+	}
+	b.waiters.PushBack(w)
+}
+
 // wakeLocked wakes up to n waiters matching the bitmask at the addr for this
 // bucket and returns the number of waiters woken.
 //
@@ -312,19 +377,129 @@ func (b *bucket) requeueLocked(t Target, to *bucket, key, nkey *Key, n int) int
 		b.waiters.Remove(requeued)
 		requeued.key.release(t)
 		requeued.key = nkey.clone()
-		to.waiters.PushBack(requeued)
+		to.enqueueLocked(requeued)
 		requeued.bucket.Store(to)
 		done++
 	}
 	return done
 }
 
-const (
-	// bucketCount is the number of buckets per Manager. By having many of
-	// these we reduce contention when concurrent yet unrelated calls are made.
-	bucketCount     = 1 << bucketCountBits
-	bucketCountBits = 10
-)
+// requeuePILocked implements Manager.CmpRequeuePI for the waiters on key in b,
+// which are requeued to nkey, the key of the PI futex at addr2, on bucket to.
+// Like Linux, if a waiter wasn't added by WaitRequeuePIPrepare with nkey,
+// EINVAL is returned, possibly after other waiters have been woken or
+// requeued.
+//
+// Preconditions: b and to must be locked.
+func (b *bucket) requeuePILocked(t Target, to *bucket, key, nkey *Key, addr2 hostarch.Addr, n int) (int, error) {
+	top := b.waiters.Front()
+	for top != nil && !top.key.matches(key) {
+		top = top.Next()
+	}
+	if top == nil {
+		return 0, nil
+	}
+	if !top.requeuePI || !top.requeuePIKey.matches(nkey) {
+		return 0, linuxerr.EINVAL
+	}
+
+	// Try to acquire the PI futex on behalf of the first waiter, like Linux's
+	// futex_proxy_trylock_atomic().
+	done := 0
+	for {
+		cur, err := t.LoadUint32(addr2)
+		if err != nil {
+			return 0, err
+		}
+		if cur&linux.FUTEX_TID_MASK == top.tid {
+			return 0, linuxerr.EDEADLK
+		}
+		if cur&linux.FUTEX_TID_MASK != 0 {
+			break
+		}
+		// Preserve the owner died and waiters bits.
+		prev, err := t.CompareAndSwapUint32(addr2, cur, cur|top.tid)
+		if err != nil {
+			return 0, err
+		}
+		if prev == cur {
+			top.lockedPI = true
+			b.wakeWaiterLocked(top)
+			done++
+			break
+		}
+	}
+
+	requeued := 0
+	var err error
+	for w := b.waiters.Front(); requeued < n && w != nil; {
+		if !w.key.matches(key) {
+			w = w.Next()
+			continue
+		}
+		if !w.requeuePI || !w.requeuePIKey.matches(nkey) {
+			err = linuxerr.EINVAL
+			break
+		}
+		rw := w
+		w = w.Next() // Next iteration.
+		b.waiters.Remove(rw)
+		rw.key.release(t)
+		rw.key = rw.requeuePIKey.clone()
+		rw.requeuedPI = true
+		to.enqueueLocked(rw)
+		rw.bucket.Store(to)
+		requeued++
+	}
+	if requeued != 0 {
+		// Make the owner of the PI futex call UnlockPI to wake the requeued
+		// waiters.
+		for {
+			cur, lerr := t.LoadUint32(addr2)
+			if lerr != nil {
+				return done + requeued, lerr
+			}
+			if cur&linux.FUTEX_WAITERS != 0 {
+				break
+			}
+			prev, lerr := t.CompareAndSwapUint32(addr2, cur, cur|linux.FUTEX_WAITERS)
+			if lerr != nil {
+				return done + requeued, lerr
+			}
+			if prev == cur {
+				break
+			}
+		}
+	}
+	return done + requeued, err
+}
+
+// defaultBucketCount is the default number of private buckets per Manager.
+// By having many of these we reduce contention when concurrent yet unrelated
+// calls are made.
+const defaultBucketCount = 1 << 10
+
+// maxBucketCount is the largest value accepted by SetBucketCount.
+const maxBucketCount = 1 << 16
+
+// bucketCount is the number of private buckets of Managers created after it's
+// set by SetBucketCount.
+var bucketCount = atomicbitops.FromUint32(defaultBucketCount)
+
+// BucketCount returns the number of private buckets of new Managers.
+func BucketCount() int {
+	return int(bucketCount.Load())
+}
+
+// SetBucketCount sets the number of private buckets of Managers created after
+// it's called. Existing Managers are unaffected.
+func SetBucketCount(n int) error {
+	if n <= 0 || n > maxBucketCount {
+		return linuxerr.EINVAL
+	}
+	bucketCount.Store(uint32(n))
+	return nil
+}
 
 // getKey returns a Key representing address addr in c.
 func getKey(t Target, addr hostarch.Addr, private bool) (Key, error) {
@@ -339,8 +514,13 @@ func getKey(t Target, addr hostarch.Addr, private bool) (Key, error) {
 	return t.GetSharedKey(addr)
 }
 
-// bucketIndexForAddr returns the index into Manager.buckets for addr.
-func bucketIndexForAddr(addr hostarch.Addr) uintptr {
+// sharedBucketCount is the number of buckets for KindSharedMappable futexes.
+// They are shared by all Managers forked from the same Manager.
+const sharedBucketCount = 1 << 8
+
+// hashOffset returns the hash of the address or offset of a futex, which is
+// reduced modulo the number of buckets to select a bucket.
+func hashOffset(off uint64) uintptr {
 	//	- The bottom 2 bits of addr must be 0, per getKey.
 	//
 	//	- On amd64, the top 16 bits of addr (bits 48-63) must be equal to bit 47
@@ -349,8 +529,8 @@ func bucketIndexForAddr(addr hostarch.Addr) uintptr {
 	//
 	// Thus 19 bits of addr are "useless" for hashing, leaving only 45 "useful"
 	// bits. We choose one of the simplest possible hash functions that at
-	// least uses all 45 useful bits in the output, given that bucketCountBits
-	// == 10. This hash function also has the property that it will usually map
+	// least uses all 45 useful bits in the output, given the default of 2^10
+	// buckets. This hash function also has the property that it will usually map
 	// adjacent addresses to adjacent buckets, slightly improving memory
 	// locality when an application synchronization structure uses multiple
 	// nearby futexes.
@@ -361,9 +541,16 @@ func bucketIndexForAddr(addr hostarch.Addr) uintptr {
 	// is also why h1 and h2 are grouped separately; for "(addr >> 2) + ... +
 	// (addr >> 42)" without any additional grouping, the compiler puts all 4
 	// additions in the critical path.
-	h1 := uintptr(addr>>2) + uintptr(addr>>12) + uintptr(addr>>22)
-	h2 := uintptr(addr>>32) + uintptr(addr>>42)
-	return (h1 + h2) % bucketCount
+	h1 := uintptr(off>>2) + uintptr(off>>12) + uintptr(off>>22)
+	h2 := uintptr(off>>32) + uintptr(off>>42)
+	return h1 + h2
+}
+
+// sharedBuckets holds the buckets for KindSharedMappable futexes.
+//
+// +stateify savable
+type sharedBuckets struct {
+	buckets [sharedBucketCount]bucket
 }
 
 // Manager holds futex state for a single virtual address space.
@@ -371,89 +558,125 @@ func bucketIndexForAddr(addr hostarch.Addr) uintptr {
 // +stateify savable
 type Manager struct {
 	// privateBuckets holds buckets for KindPrivate and KindSharedPrivate
-	// futexes.
-	privateBuckets [bucketCount]bucket `state:"zerovalue"`
-
-	// sharedBucket is the bucket for KindSharedMappable futexes. sharedBucket
-	// may be shared by multiple Managers. The sharedBucket pointer is
-	// immutable.
-	sharedBucket *bucket
+	// futexes. The privateBuckets slice is immutable; it's reallocated on
+	// restore with the current bucketCount.
+	privateBuckets []bucket `state:"nosave"`
+
+	// sharedBuckets holds the buckets for KindSharedMappable futexes.
+	// sharedBuckets may be shared by multiple Managers. The sharedBuckets
+	// pointer is immutable.
+	sharedBuckets *sharedBuckets
+
+	// legacySharedBucket is the single bucket that held KindSharedMappable
+	// futexes in Managers saved before they were spread over sharedBuckets.
+	// It's only non-nil during restore, and is replaced by sharedBuckets in
+	// afterLoad.
+	legacySharedBucket *bucket
 }
 
 // NewManager returns an initialized futex manager.
 func NewManager() *Manager {
 	return &Manager{
-		sharedBucket: &bucket{},
+		privateBuckets: make([]bucket, bucketCount.Load()),
+		sharedBuckets:  &sharedBuckets{},
+	}
+}
+
+// afterLoad is invoked by stateify.
+func (m *Manager) afterLoad() {
+	m.privateBuckets = make([]bucket, bucketCount.Load())
+	if m.sharedBuckets == nil {
+		m.sharedBuckets = restoredSharedBuckets(m.legacySharedBucket)
+		m.legacySharedBucket = nil
+	}
+}
+
+var (
+	// legacySharedBucketsMu protects legacySharedBuckets.
+	legacySharedBucketsMu sync.Mutex
+
+	// legacySharedBuckets maps the legacy shared bucket of restored Managers
+	// to the sharedBuckets replacing it, so that Managers that shared the
+	// bucket share the sharedBuckets.
+	legacySharedBuckets map[*bucket]*sharedBuckets
+)
+
+// restoredSharedBuckets returns the sharedBuckets replacing the legacy shared
+// bucket b of a restored Manager.
+func restoredSharedBuckets(b *bucket) *sharedBuckets {
+	legacySharedBucketsMu.Lock()
+	defer legacySharedBucketsMu.Unlock()
+	if sb, ok := legacySharedBuckets[b]; ok {
+		return sb
+	}
+	sb := &sharedBuckets{}
+	if legacySharedBuckets == nil {
+		legacySharedBuckets = make(map[*bucket]*sharedBuckets)
 	}
+	legacySharedBuckets[b] = sb
+	return sb
+}
+
+// CompleteRestore must be called once all Managers have been restored.
+func CompleteRestore() {
+	legacySharedBucketsMu.Lock()
+	defer legacySharedBucketsMu.Unlock()
+	legacySharedBuckets = nil
 }
 
 // Fork returns a new Manager. Shared futex clients using the returned Manager
 // may interoperate with those using m.
 func (m *Manager) Fork() *Manager {
 	return &Manager{
-		sharedBucket: m.sharedBucket,
+		privateBuckets: make([]bucket, bucketCount.Load()),
+		sharedBuckets:  m.sharedBuckets,
+	}
+}
+
+// bucketForKey returns the bucket for k, and its position in the order in
+// which buckets must be locked: buckets in m.privateBuckets by index, followed
+// by buckets in m.sharedBuckets by index.
+func (m *Manager) bucketForKey(k *Key) (*bucket, uintptr) {
+	if k.Kind == KindSharedMappable {
+		i := hashOffset(k.Offset) % sharedBucketCount
+		return &m.sharedBuckets.buckets[i], uintptr(len(m.privateBuckets)) + i
 	}
+	i := hashOffset(uint64(k.addr())) % uintptr(len(m.privateBuckets))
+	return &m.privateBuckets[i], i
 }
 
 // lockBucket returns a locked bucket for the given key.
 // +checklocksacquire:b.mu
 func (m *Manager) lockBucket(k *Key) (b *bucket) {
-	if k.Kind == KindSharedMappable {
-		b = m.sharedBucket
-	} else {
-		b = &m.privateBuckets[bucketIndexForAddr(k.addr())]
-	}
+	b, _ = m.bucketForKey(k)
 	b.mu.Lock()
 	return b
 }
 
 // lockBuckets returns locked buckets for the given keys.
-// It returns which bucket was locked first and second. They may be nil in case the buckets are
-// identical or they did not need locking.
+// It returns which bucket was locked first and second. lockedSecond is nil if
+// the buckets are identical.
 //
 // +checklocksacquire:lockedFirst.mu
 // +checklocksacquire:lockedSecond.mu
 func (m *Manager) lockBuckets(k1, k2 *Key) (b1, b2, lockedFirst, lockedSecond *bucket) {
 	// Buckets must be consistently ordered to avoid circular lock
-	// dependencies. We order buckets in m.privateBuckets by index (lowest
-	// index first), and all buckets in m.privateBuckets precede
-	// m.sharedBucket.
-
-	// Handle the common case first:
-	if k1.Kind != KindSharedMappable && k2.Kind != KindSharedMappable {
-		i1 := bucketIndexForAddr(k1.addr())
-		i2 := bucketIndexForAddr(k2.addr())
-		b1 = &m.privateBuckets[i1]
-		b2 = &m.privateBuckets[i2]
-		switch {
-		case i1 < i2:
-			b1.mu.Lock()
-			b2.mu.NestedLock(futexBucketLockB)
-			return b1, b2, b1, b2
-		case i2 < i1:
-			b2.mu.Lock()
-			b1.mu.NestedLock(futexBucketLockB)
-			return b1, b2, b2, b1
-		default:
-			b1.mu.Lock()
-			return b1, b2, b1, nil // +checklocksforce
-		}
-	}
-
-	// At least one of b1 or b2 should be m.sharedBucket.
-	b1 = m.sharedBucket
-	b2 = m.sharedBucket
-	if k1.Kind != KindSharedMappable {
-		b1 = m.lockBucket(k1)
+	// dependencies; see bucketForKey.
+	b1, i1 := m.bucketForKey(k1)
+	b2, i2 := m.bucketForKey(k2)
+	switch {
+	case i1 < i2:
+		b1.mu.Lock()
 		b2.mu.NestedLock(futexBucketLockB)
 		return b1, b2, b1, b2
-	}
-	if k2.Kind != KindSharedMappable {
-		b2 = m.lockBucket(k2)
+	case i2 < i1:
+		b2.mu.Lock()
 		b1.mu.NestedLock(futexBucketLockB)
 		return b1, b2, b2, b1
+	default:
+		b1.mu.Lock()
+		return b1, b2, b1, nil // +checklocksforce
 	}
-	return b1, b2, nil, nil // +checklocksforce
 }
 
 // unlockBuckets unlocks two buckets.
@@ -584,6 +807,9 @@ func (m *Manager) WaitPrepare(w *Waiter, t Target, addr hostarch.Addr, private b
 	}
 	w.key = k
 	w.bitmask = bitmask
+	w.requeuePI = false
+	w.requeuedPI = false
+	w.lockedPI = false
 
 	b := m.lockBucket(&k)
 	// This function is very hot; avoid defer.
@@ -596,7 +822,7 @@ func (m *Manager) WaitPrepare(w *Waiter, t Target, addr hostarch.Addr, private b
 	}
 
 	// Add the waiter to the bucket.
-	b.waiters.PushBack(w)
+	b.enqueueLocked(w)
 	w.bucket.Store(b)
 
 	b.mu.Unlock()
@@ -638,6 +864,88 @@ func (m *Manager) WaitComplete(w *Waiter, t Target) {
 
 	// Release references held by the waiter.
 	w.key.release(t)
+	if w.requeuePI {
+		w.requeuePIKey.release(t)
+	}
+}
+
+// WaitRequeuePIPrepare is like WaitPrepare for FUTEX_WAIT_REQUEUE_PI: w waits
+// for a wakeup on addr, which must contain val, or to be requeued to the PI
+// futex at addr2 by CmpRequeuePI. In the latter case, w is woken once it owns
+// the PI futex, with tid as its owner. The Waiter must be subsequently
+// removed by calling WaitComplete; Waiter.LockedPI then reports if the PI
+// futex was acquired.
+func (m *Manager) WaitRequeuePIPrepare(w *Waiter, t Target, addr, addr2 hostarch.Addr, private bool, val, tid uint32) error {
+	k, err := getKey(t, addr, private)
+	if err != nil {
+		return err
+	}
+	k2, err := getKey(t, addr2, private)
+	if err != nil {
+		k.release(t)
+		return err
+	}
+	if k.matches(&k2) {
+		k.release(t)
+		k2.release(t)
+		return linuxerr.EINVAL
+	}
+	// Ownership of k and k2 is transferred to w below.
+
+	// Prepare the Waiter before taking the bucket lock.
+	select {
+	case <-w.C:
+	default:
+	}
+	w.key = k
+	w.bitmask = linux.FUTEX_BITSET_MATCH_ANY
+	w.tid = tid
+	w.requeuePIKey = k2
+	w.requeuePI = true
+	w.requeuedPI = false
+	w.lockedPI = false
+
+	b := m.lockBucket(&k)
+	if err := check(t, addr, val); err != nil {
+		b.mu.Unlock()
+		w.key.release(t)
+		w.requeuePIKey.release(t)
+		w.requeuePI = false
+		return err
+	}
+	b.enqueueLocked(w)
+	w.bucket.Store(b)
+	b.mu.Unlock()
+	return nil
+}
+
+// CmpRequeuePI implements FUTEX_CMP_REQUEUE_PI. If addr contains val, the
+// first waiter on addr acquires the PI futex at addr2 if it's unowned, and is
+// woken; up to nreq other waiters are requeued to wait for the PI futex. All
+// of them must have been added by WaitRequeuePIPrepare with addr2. The number
+// of waiters woken or requeued is returned.
+func (m *Manager) CmpRequeuePI(t Target, addr, addr2 hostarch.Addr, private bool, val uint32, nreq int) (int, error) {
+	k1, err := getKey(t, addr, private)
+	if err != nil {
+		return 0, err
+	}
+	defer k1.release(t)
+	k2, err := getKey(t, addr2, private)
+	if err != nil {
+		return 0, err
+	}
+	defer k2.release(t)
+	if k1.matches(&k2) {
+		return 0, linuxerr.EINVAL
+	}
+
+	b1, b2, lockedFirst, lockedSecond := m.lockBuckets(&k1, &k2)
+	defer m.unlockBuckets(lockedFirst, lockedSecond)
+
+	if err := check(t, addr, val); err != nil {
+		return 0, err
+	}
+	return b1.requeuePILocked(t, b2, &k1, &k2, addr2, nreq)
 }
 
 // LockPI attempts to lock the futex following the Priority-inheritance futex
@@ -662,6 +970,9 @@ func (m *Manager) LockPI(w *Waiter, t Target, addr hostarch.Addr, tid uint32, pr
 	}
 	w.key = k
 	w.tid = tid
+	w.requeuePI = false
+	w.requeuedPI = false
+	w.lockedPI = false
 
 	b := m.lockBucket(&k)
 	// Hot function: avoid defers.
@@ -731,7 +1042,7 @@ func (m *Manager) lockPILocked(w *Waiter, t Target, addr hostarch.Addr, tid uint
 		}
 
 		// Add the waiter to the bucket.
-		b.waiters.PushBack(w)
+		b.enqueueLocked(w)
 		w.bucket.Store(b)
 		return false, nil
 	}
@@ -742,20 +1053,33 @@ func (m *Manager) lockPILocked(w *Waiter, t Target, addr hostarch.Addr, tid uint
 // TID of the next waiter (FIFO) is set to the given address, and the waiter
 // woken up. If there are no waiters, 0 is set to the address.
 func (m *Manager) UnlockPI(t Target, addr hostarch.Addr, tid uint32, private bool) error {
+	return m.unlockPI(t, addr, tid, private, false /* ownerDied */)
+}
+
+// OwnerDiedPI is called for the PI futex at addr, owned by the exiting task
+// with the given TID, when its robust list is processed. Like UnlockPI, the
+// futex is handed over to the next waiter, if any, but FUTEX_OWNER_DIED is
+// set so that the new owner knows that the state protected by the futex may
+// be inconsistent.
+func (m *Manager) OwnerDiedPI(t Target, addr hostarch.Addr, tid uint32, private bool) error {
+	return m.unlockPI(t, addr, tid, private, true /* ownerDied */)
+}
+
+func (m *Manager) unlockPI(t Target, addr hostarch.Addr, tid uint32, private, ownerDied bool) error {
 	k, err := getKey(t, addr, private)
 	if err != nil {
 		return err
 	}
 	b := m.lockBucket(&k)
 
-	err = m.unlockPILocked(t, addr, tid, b, &k)
+	err = m.unlockPILocked(t, addr, tid, b, &k, ownerDied)
 
 	k.release(t)
 	b.mu.Unlock()
 	return err
 }
 
-func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bucket, key *Key) error {
+func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bucket, key *Key, ownerDied bool) error {
 	cur, err := t.LoadUint32(addr)
 	if err != nil {
 		return err
@@ -780,10 +1104,15 @@ func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bu
 		}
 	}
 
+	var diedVal uint32
+	if ownerDied {
+		diedVal = linux.FUTEX_OWNER_DIED
+	}
+
 	if next == nil {
 		// It's safe to set 0 because there are no waiters, no new owner, and the
 		// executing task is the current owner (no owner died bit).
-		prev, err := t.CompareAndSwapUint32(addr, cur, 0)
+		prev, err := t.CompareAndSwapUint32(addr, cur, diedVal)
 		if err != nil {
 			return err
 		}
@@ -796,8 +1125,9 @@ func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bu
 	}
 
 	// Set next owner's TID, waiters if there are any. Resets owner died bit, if
-	// set, because the executing task takes over as the owner.
-	val := next.tid
+	// set, because the executing task takes over as the owner, unless the
+	// executing task is dying.
+	val := next.tid | diedVal
 	if next2 != nil {
 		val |= linux.FUTEX_WAITERS
 	}
@@ -810,6 +1140,7 @@ func (m *Manager) unlockPILocked(t Target, addr hostarch.Addr, tid uint32, b *bu
 		return linuxerr.EINVAL
 	}
 
+	next.lockedPI = true
 	b.wakeWaiterLocked(next)
 	return nil
 }
@@ -30,13 +30,39 @@ func (b *bucket) afterLoad() {}
 func (b *bucket) StateLoad(stateSourceObject state.Source) {
 }
 
+func (s *sharedBuckets) StateTypeName() string {
+	return "pkg/sentry/kernel/futex.sharedBuckets"
+}
+
+func (s *sharedBuckets) StateFields() []string {
+	return []string{
+		"buckets",
+	}
+}
+
+func (s *sharedBuckets) beforeSave() {}
+
+// +checklocksignore
+func (s *sharedBuckets) StateSave(stateSinkObject state.Sink) {
+	s.beforeSave()
+	stateSinkObject.Save(0, &s.buckets)
+}
+
+func (s *sharedBuckets) afterLoad() {}
+
+// +checklocksignore
+func (s *sharedBuckets) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &s.buckets)
+}
+
 func (m *Manager) StateTypeName() string {
 	return "pkg/sentry/kernel/futex.Manager"
 }
 
 func (m *Manager) StateFields() []string {
 	return []string{
-		"sharedBucket",
+		"sharedBuckets",
+		"legacySharedBucket",
 	}
 }
 
@@ -45,17 +71,15 @@ func (m *Manager) beforeSave() {}
 // +checklocksignore
 func (m *Manager) StateSave(stateSinkObject state.Sink) {
 	m.beforeSave()
-	if !state.IsZeroValue(&m.privateBuckets) {
-		state.Failf("privateBuckets is %#v, expected zero", &m.privateBuckets)
-	}
-	stateSinkObject.Save(0, &m.sharedBucket)
+	stateSinkObject.Save(0, &m.sharedBuckets)
+	stateSinkObject.Save(1, &m.legacySharedBucket)
 }
 
-func (m *Manager) afterLoad() {}
-
 // +checklocksignore
 func (m *Manager) StateLoad(stateSourceObject state.Source) {
-	stateSourceObject.Load(0, &m.sharedBucket)
+	stateSourceObject.Load(0, &m.sharedBuckets)
+	stateSourceObject.Load(1, &m.legacySharedBucket)
+	stateSourceObject.AfterLoad(m.afterLoad)
 }
 
 func (l *waiterList) StateTypeName() string {
@@ -116,6 +140,7 @@ func (e *waiterEntry) StateLoad(stateSourceObject state.Source) {
 
 func init() {
 	state.Register((*bucket)(nil))
+	state.Register((*sharedBuckets)(nil))
 	state.Register((*Manager)(nil))
 	state.Register((*waiterList)(nil))
 	state.Register((*waiterEntry)(nil))
@@ -0,0 +1,125 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+)
+
+// deepSleep tracks whether the sandbox is in deep sleep: all of its tasks
+// have been blocked for at least Kernel.deepSleepDelay, so the sentry shrinks
+// its Go scheduler to Kernel.deepSleepMaxProcs Ps until a task runs again.
+//
+// While tasks are blocked, the CPU clock ticker is already stopped and the
+// platforms already park idle contexts (systrap stops polling stub threads,
+// KVM vCPUs are released with their task goroutines). Most remaining idle CPU
+// is spent by the Go scheduler spinning up threads for idle Ps to run the
+// timer and network goroutines that eventually wake tasks.
+type deepSleep struct {
+	mu sync.Mutex
+
+	// timer enters deep sleep once it expires. It is created the first time
+	// the sandbox goes idle, and stopped whenever it wakes up.
+	//
+	// +checklocks:mu
+	timer *time.Timer
+
+	// asleep is true if the sandbox is in deep sleep.
+	//
+	// +checklocks:mu
+	asleep bool
+
+	// savedMaxProcs is GOMAXPROCS before the sandbox entered deep sleep. It
+	// is restored when the sandbox wakes up.
+	//
+	// +checklocks:mu
+	savedMaxProcs int
+}
+
+// idle is called by the CPU clock ticker goroutine when all tasks in k are
+// blocked.
+func (k *Kernel) idle() {
+	if k.deepSleepDelay <= 0 {
+		return
+	}
+	ds := &k.deepSleep
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.timer != nil {
+		ds.timer.Reset(k.deepSleepDelay)
+		return
+	}
+	ds.timer = time.AfterFunc(k.deepSleepDelay, k.enterDeepSleep)
+}
+
+// enterDeepSleep puts the sandbox into deep sleep. It is called by
+// deepSleep.timer, and races with wake; it has no effect if k.wake is called
+// first.
+func (k *Kernel) enterDeepSleep() {
+	ds := &k.deepSleep
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.asleep || k.runningTasks.Load() != 0 {
+		return
+	}
+	// Don't slow down external stops, e.g. checkpoints, which are idle only
+	// from the point of view of tasks.
+	k.tasks.mu.RLock()
+	stopped := k.tasks.stopCount > 0
+	k.tasks.mu.RUnlock()
+	if stopped {
+		return
+	}
+	ds.asleep = true
+	if k.deepSleepMaxProcs > 0 {
+		ds.savedMaxProcs = runtime.GOMAXPROCS(k.deepSleepMaxProcs)
+	}
+	log.Debugf("Sandbox idle for %v, entering deep sleep", k.deepSleepDelay)
+}
+
+// wake is called by the CPU clock ticker goroutine when a task in k starts
+// running again after k.idle, and by Kernel.Pause.
+func (k *Kernel) wake() {
+	if k.deepSleepDelay <= 0 {
+		return
+	}
+	ds := &k.deepSleep
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.timer != nil {
+		ds.timer.Stop()
+	}
+	if !ds.asleep {
+		return
+	}
+	ds.asleep = false
+	// GOMAXPROCS may have been changed while asleep, e.g. by
+	// Lifecycle.SetCPUs; keep the new value in that case.
+	if k.deepSleepMaxProcs > 0 && runtime.GOMAXPROCS(0) == k.deepSleepMaxProcs {
+		runtime.GOMAXPROCS(ds.savedMaxProcs)
+	}
+	log.Debugf("Sandbox woke up from deep sleep")
+}
+
+// DeepSleeping returns true if the sandbox is in deep sleep.
+func (k *Kernel) DeepSleeping() bool {
+	k.deepSleep.mu.Lock()
+	defer k.deepSleep.mu.Unlock()
+	return k.deepSleep.asleep
+}
@@ -137,6 +137,11 @@ type Kernel struct {
 	// mf provides application memory.
 	mf *pgalloc.MemoryFile `state:"nosave"`
 
+	// coreDumper creates core dump files. If nil, core dumps are disabled.
+	// It isn't saved, so that core dumps are written to the host directory
+	// of the restoring sandbox.
+	coreDumper CoreDumper `state:"nosave"`
+
 	// See InitKernelArgs for the meaning of these fields.
 	featureSet                  cpuid.FeatureSet
 	timekeeper                  *Timekeeper
@@ -145,12 +150,17 @@ type Kernel struct {
 	rootNetworkNamespace        *inet.Namespace
 	applicationCores            uint
 	useHostCores                bool
+	onlineCores                 atomicbitops.Uint32
 	extraAuxv                   []arch.AuxEntry
 	vdso                        *loader.VDSO
 	rootUTSNamespace            *UTSNamespace
 	rootIPCNamespace            *IPCNamespace
 	rootAbstractSocketNamespace *AbstractSocketNamespace
 
+	// rootCgroupNamespace is the root cgroup namespace. Tasks with a nil
+	// cgroup namespace are in it.
+	rootCgroupNamespace *CgroupNamespace
+
 	// futexes is the "root" futex.Manager, from which all others are forked.
 	// This is necessary to ensure that shared futexes are coherent across all
 	// tasks, including those created by CreateProcess.
@@ -323,6 +333,41 @@ type Kernel struct {
 	// userCountersMap maps auth.KUID into a set of user counters.
 	userCountersMap   map[auth.KUID]*userCounters
 	userCountersMapMu userCountersMutex `state:"nosave"`
+
+	// nestedContainers enables the kernel features required to run container
+	// runtimes inside the sandbox, e.g. mount and cgroup namespaces.
+	// Immutable.
+	nestedContainers bool
+
+	// lastAuditSessionID is the last audit session ID assigned to a task. See
+	// Task.SetLoginUID.
+	lastAuditSessionID atomicbitops.Uint32
+
+	// audit is the audit subsystem state.
+	audit Audit
+
+	// timerSlack is the initial timer slack of the tasks of new processes.
+	// Immutable.
+	timerSlack time.Duration
+
+	// timerResolution is the granularity that the expiration times of task
+	// timers are rounded up to. Immutable.
+	timerResolution time.Duration
+
+	// deepSleepDelay is how long all tasks must stay blocked before the
+	// sandbox enters deep sleep. If zero, it never does. Immutable.
+	deepSleepDelay time.Duration
+
+	// deepSleepMaxProcs is GOMAXPROCS while the sandbox is in deep sleep. If
+	// zero, GOMAXPROCS isn't changed. Immutable.
+	deepSleepMaxProcs int
+
+	// deepSleep is the deep sleep state of the sandbox.
+	deepSleep deepSleep `state:"nosave"`
+
+	// binfmtMisc is the registry of binary formats configured through
+	// binfmt_misc filesystems.
+	binfmtMisc loader.BinfmtMisc
 }
 
 // InitKernelArgs holds arguments to Init.
@@ -347,11 +392,20 @@ type InitKernelArgs struct {
 	ApplicationCores uint
 
 	// If UseHostCores is true, Task.CPU() returns the task goroutine's CPU
-	// instead of a virtualized CPU number, and Task.CopyToCPUMask() is a
-	// no-op. If ApplicationCores is less than hostcpu.MaxPossibleCPU(), it
-	// will be overridden.
+	// instead of a virtualized CPU number, and task CPU masks are the host
+	// CPUs tasks are bound to, if the platform supports it. If
+	// ApplicationCores is less than hostcpu.MaxPossibleCPU(), it will be
+	// overridden.
 	UseHostCores bool
 
+	// OnlineCores is the number of logical CPUs tasks can run on initially.
+	// The set of online CPU IDs is [0, OnlineCores), analogous to Linux's
+	// cpu_online_mask; CPUs can be brought online or offline at runtime, up to
+	// ApplicationCores, with Kernel.SetOnlineCores. If zero or greater than
+	// ApplicationCores, all ApplicationCores are online. It is ignored if
+	// UseHostCores is true.
+	OnlineCores uint
+
 	// ExtraAuxv contains additional auxiliary vector entries that are added to
 	// each process by the ELF loader.
 	ExtraAuxv []arch.AuxEntry
@@ -370,6 +424,32 @@ type InitKernelArgs struct {
 
 	// PIDNamespace is the root PID namespace.
 	PIDNamespace *PIDNamespace
+
+	// NestedContainers enables the kernel features required to run container
+	// runtimes inside the sandbox.
+	NestedContainers bool
+
+	// LSM is the Linux Security Module presented to applications.
+	LSM vfs.LSM
+
+	// TimerSlack is the initial timer slack of the tasks of new processes, by
+	// which their timers may be deferred to coalesce wakeups. Tasks can change
+	// their own with prctl(PR_SET_TIMERSLACK).
+	TimerSlack time.Duration
+
+	// TimerResolution is the minimum resolution of task timers: their
+	// expiration times are rounded up to a multiple of it. If zero, timers
+	// aren't rounded.
+	TimerResolution time.Duration
+
+	// DeepSleepDelay is how long all tasks must stay blocked before the
+	// sandbox enters deep sleep, parking the sentry more aggressively until a
+	// task runs again. If zero, the sandbox never enters deep sleep.
+	DeepSleepDelay time.Duration
+
+	// DeepSleepMaxProcs is GOMAXPROCS while the sandbox is in deep sleep. If
+	// zero, GOMAXPROCS isn't changed.
+	DeepSleepMaxProcs int
 }
 
 // Init initialize the Kernel with no tasks.
@@ -398,6 +478,11 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	k.rootIPCNamespace = args.RootIPCNamespace
 	k.rootAbstractSocketNamespace = args.RootAbstractSocketNamespace
 	k.rootNetworkNamespace = args.RootNetworkNamespace
+	k.nestedContainers = args.NestedContainers
+	k.timerSlack = args.TimerSlack
+	k.timerResolution = args.TimerResolution
+	k.deepSleepDelay = args.DeepSleepDelay
+	k.deepSleepMaxProcs = args.DeepSleepMaxProcs
 	if k.rootNetworkNamespace == nil {
 		k.rootNetworkNamespace = inet.NewRootNamespace(nil, nil, args.RootUserNamespace)
 	}
@@ -417,6 +502,10 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 			k.applicationCores = minAppCores
 		}
 	}
+	if args.OnlineCores == 0 || args.OnlineCores > k.applicationCores || k.useHostCores {
+		args.OnlineCores = k.applicationCores
+	}
+	k.onlineCores = atomicbitops.FromUint32(uint32(args.OnlineCores))
 	k.extraAuxv = args.ExtraAuxv
 	k.vdso = args.Vdso
 	k.futexes = futex.NewManager()
@@ -429,6 +518,7 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	if err := k.vfs.Init(ctx); err != nil {
 		return fmt.Errorf("failed to initialize VFS: %v", err)
 	}
+	k.vfs.SetLSM(args.LSM)
 
 	err := k.rootIPCNamespace.InitPosixQueues(ctx, &k.vfs, auth.CredentialsFromContext(ctx))
 	if err != nil {
@@ -451,6 +541,7 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	nsfsMount := k.vfs.NewDisconnectedMount(nsfsFilesystem, nil, &vfs.MountOptions{})
 	k.nsfsMount = nsfsMount
 	k.rootNetworkNamespace.SetInode(nsfs.NewInode(ctx, nsfsMount, k.rootNetworkNamespace))
+	k.rootCgroupNamespace = k.newRootCgroupNamespace(ctx)
 
 	tmpfsOpts := vfs.GetFilesystemOptions{
 		InternalData: tmpfs.FilesystemOpts{
@@ -487,16 +578,22 @@ func (k *Kernel) Init(args InitKernelArgs) error {
 	return nil
 }
 
-// SaveTo saves the state of k to w.
+// SaveTo saves the state of k to w. mfOpts are the options used to save the
+// MemoryFile. resume indicates that k keeps running after the save.
 //
 // Preconditions: The kernel must be paused throughout the call to SaveTo.
-func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
+func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer, mfOpts pgalloc.StateOpts, resume bool) error {
 	saveStart := time.Now()
 
 	// Do not allow other Kernel methods to affect it while it's being saved.
 	k.extMu.Lock()
 	defer k.extMu.Unlock()
 
+	// Tasks stopped for a debugger can't be resumed after restore.
+	if k.tasks.hasDebuggers() {
+		return fmt.Errorf("a debugger is attached to a thread group")
+	}
+
 	// Stop time.
 	k.pauseTimeLocked(ctx)
 	defer k.resumeTimeLocked(ctx)
@@ -530,14 +627,15 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 
 	// Save the timekeeper's state.
 
-	if rootNS := k.rootNetworkNamespace; rootNS != nil && rootNS.Stack() != nil {
-		// Pause the network stack.
-		netstackPauseStart := time.Now()
-		log.Infof("Pausing root network namespace")
-		k.rootNetworkNamespace.Stack().Pause()
-		defer k.rootNetworkNamespace.Stack().Resume()
-		log.Infof("Pausing root network namespace took [%s].", time.Since(netstackPauseStart))
+	// Pause the network stacks. Endpoints stop processing packets as they are
+	// saved, and are thawed when their stack is resumed.
+	netstackPauseStart := time.Now()
+	log.Infof("Pausing network namespaces")
+	for _, s := range k.networkStacks() {
+		s.Pause(resume)
+		defer s.Resume()
 	}
+	log.Infof("Pausing network namespaces took [%s].", time.Since(netstackPauseStart))
 
 	// Save the kernel state.
 	kernelStart := time.Now()
@@ -550,7 +648,7 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 
 	// Save the memory file's state.
 	memoryStart := time.Now()
-	if err := k.mf.SaveTo(ctx, w); err != nil {
+	if err := k.mf.SaveTo(ctx, w, mfOpts); err != nil {
 		return err
 	}
 	log.Infof("Memory save took [%s].", time.Since(memoryStart))
@@ -560,6 +658,34 @@ func (k *Kernel) SaveTo(ctx context.Context, w wire.Writer) error {
 	return nil
 }
 
+// networkStacks returns the network stacks of the root network namespace and of
+// the network namespaces used by tasks.
+//
+// Preconditions: The kernel must be paused.
+func (k *Kernel) networkStacks() []inet.Stack {
+	var stacks []inet.Stack
+	seen := make(map[*inet.Namespace]struct{})
+	add := func(ns *inet.Namespace) {
+		if ns == nil {
+			return
+		}
+		if _, ok := seen[ns]; ok {
+			return
+		}
+		seen[ns] = struct{}{}
+		if s := ns.Stack(); s != nil {
+			stacks = append(stacks, s)
+		}
+	}
+	add(k.rootNetworkNamespace)
+	k.tasks.mu.RLock()
+	defer k.tasks.mu.RUnlock()
+	for t := range k.tasks.Root.tids {
+		add(t.NetworkNamespace())
+	}
+	return stacks
+}
+
 // Preconditions: The kernel must be paused.
 func (k *Kernel) invalidateUnsavableMappings(ctx context.Context) error {
 	invalidated := make(map[*mm.MemoryManager]struct{})
@@ -585,8 +711,9 @@ func (k *Kernel) invalidateUnsavableMappings(ctx context.Context) error {
 	return nil
 }
 
-// LoadFrom returns a new Kernel loaded from args.
-func (k *Kernel) LoadFrom(ctx context.Context, r wire.Reader, timeReady chan struct{}, net inet.Stack, clocks sentrytime.Clocks, vfsOpts *vfs.CompleteRestoreOptions) error {
+// LoadFrom returns a new Kernel loaded from args. mfOpts must be the options
+// the MemoryFile was saved with.
+func (k *Kernel) LoadFrom(ctx context.Context, r wire.Reader, mfOpts pgalloc.StateOpts, timeReady chan struct{}, net inet.Stack, clocks sentrytime.Clocks, vfsOpts *vfs.CompleteRestoreOptions) error {
 	loadStart := time.Now()
 
 	k.runningTasksCond.L = &k.runningTasksMu
@@ -622,13 +749,25 @@ func (k *Kernel) LoadFrom(ctx context.Context, r wire.Reader, timeReady chan str
 	log.Infof("Kernel load stats: %s", stats.String())
 	log.Infof("Kernel load took [%s].", time.Since(kernelStart))
 
+	futex.CompleteRestore()
+
+	// Kernels saved before CPUs could be taken offline have all CPUs online.
+	if k.onlineCores.Load() == 0 {
+		k.onlineCores.Store(uint32(k.applicationCores))
+	}
+
+	// Kernels saved before cgroup namespaces have no root cgroup namespace.
+	if k.rootCgroupNamespace == nil {
+		k.rootCgroupNamespace = k.newRootCgroupNamespace(ctx)
+	}
+
 	// rootNetworkNamespace should be populated after loading the state file.
 	// Restore the root network stack.
 	k.rootNetworkNamespace.RestoreRootStack(net)
 
 	// Load the memory file's state.
 	memoryStart := time.Now()
-	if err := k.mf.LoadFrom(ctx, r); err != nil {
+	if err := k.mf.LoadFrom(ctx, r, mfOpts); err != nil {
 		return err
 	}
 	log.Infof("Memory load took [%s].", time.Since(memoryStart))
@@ -735,11 +874,21 @@ type CreateProcessArgs struct {
 	// increment it).
 	MountNamespace *vfs.MountNamespace
 
+	// NetworkNamespace optionally contains the network namespace for this
+	// process. If nil, the root network namespace is used. CreateProcess
+	// takes its own reference on NetworkNamespace.
+	NetworkNamespace *inet.Namespace
+
 	// ContainerID is the container that the process belongs to.
 	ContainerID string
 
 	// InitialCgroups are the cgroups the container is initialized to.
 	InitialCgroups map[Cgroup]struct{}
+
+	// ReapOrphans causes orphaned processes reparented to the new process to
+	// be reaped as soon as they exit, as a minimal init would do. See
+	// ThreadGroup.reapsOrphans.
+	ReapOrphans bool
 }
 
 // NewContext returns a context.Context that represents the task that will be
@@ -790,6 +939,9 @@ func (ctx *createProcessContext) Value(key any) any {
 		mntns.IncRef()
 		return mntns
 	case inet.CtxStack:
+		if ctx.args.NetworkNamespace != nil {
+			return ctx.args.NetworkNamespace.Stack()
+		}
 		return ctx.kernel.RootNetworkNamespace().Stack()
 	case ktime.CtxRealtimeClock:
 		return ctx.kernel.RealtimeClock()
@@ -884,6 +1036,7 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 	fsContext := NewFSContext(root, wd, args.Umask)
 
 	tg := k.NewThreadGroup(args.PIDNamespace, NewSignalHandlers(), linux.SIGCHLD, args.Limits)
+	tg.reapsOrphans = args.ReapOrphans
 	cu := cleanup.Make(func() {
 		tg.Release(ctx)
 	})
@@ -933,6 +1086,11 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 	// TaskSet.NewTask().
 	args.FDTable.IncRef()
 
+	netns := args.NetworkNamespace
+	if netns == nil {
+		netns = k.RootNetworkNamespace()
+	}
+
 	// Create the task.
 	config := &TaskConfig{
 		Kernel:                  k,
@@ -941,8 +1099,9 @@ func (k *Kernel) CreateProcess(args CreateProcessArgs) (*ThreadGroup, ThreadID,
 		FSContext:               fsContext,
 		FDTable:                 args.FDTable,
 		Credentials:             args.Credentials,
-		NetworkNamespace:        k.RootNetworkNamespace(),
-		AllowedCPUMask:          sched.NewFullCPUSet(k.applicationCores),
+		NetworkNamespace:        netns,
+		AllowedCPUMask:          k.OnlineCPUs(),
+		TimerSlack:              k.timerSlack.Nanoseconds(),
 		UTSNamespace:            args.UTSNamespace,
 		IPCNamespace:            args.IPCNamespace,
 		AbstractSocketNamespace: args.AbstractSocketNamespace,
@@ -1178,6 +1337,7 @@ func (k *Kernel) Pause() {
 	k.extMu.Lock()
 	k.tasks.BeginExternalStop()
 	k.extMu.Unlock()
+	k.wake()
 	k.tasks.runningGoroutines.Wait()
 	k.tasks.aioGoroutines.Wait()
 }
@@ -1307,6 +1467,14 @@ func (k *Kernel) RootNetworkNamespace() *inet.Namespace {
 	return k.rootNetworkNamespace
 }
 
+// NewNetworkNamespace creates a new network namespace that is a child of the
+// root network namespace. The caller owns the returned reference.
+func (k *Kernel) NewNetworkNamespace(ctx context.Context, userns *auth.UserNamespace) *inet.Namespace {
+	netns := inet.NewNamespace(k.rootNetworkNamespace, userns)
+	netns.SetInode(nsfs.NewInode(ctx, k.nsfsMount, netns))
+	return netns
+}
+
 // GlobalInit returns the thread group with ID 1 in the root PID namespace, or
 // nil if no such thread group exists. GlobalInit may return a thread group
 // containing no tasks if the thread group has already exited.
@@ -1327,6 +1495,49 @@ func (k *Kernel) ApplicationCores() uint {
 	return k.applicationCores
 }
 
+// OnlineCores returns the number of CPUs sandboxed applications can run on.
+// The online CPUs are [0, OnlineCores()).
+func (k *Kernel) OnlineCores() uint {
+	return uint(k.onlineCores.Load())
+}
+
+// OnlineCPUs returns the set of online CPUs, sized for ApplicationCores()
+// CPUs.
+func (k *Kernel) OnlineCPUs() sched.CPUSet {
+	cpus := sched.NewFullCPUSet(k.applicationCores)
+	cpus.ClearAbove(k.OnlineCores())
+	return cpus
+}
+
+// SetOnlineCores brings CPUs online or offline so that CPUs [0, n) are
+// online. n must be between 1 and ApplicationCores().
+//
+// Like Linux, tasks that were allowed to run on all online CPUs remain so, and
+// tasks that are left without an allowed online CPU are allowed to run on all
+// online CPUs their cpuset allows. See kernel/sched/core.c:select_fallback_rq.
+func (k *Kernel) SetOnlineCores(n uint) error {
+	if k.useHostCores {
+		return fmt.Errorf("can't change the number of online CPUs when using host CPU numbers")
+	}
+	if n == 0 || n > k.applicationCores {
+		return fmt.Errorf("invalid number of online CPUs %d, must be between 1 and %d", n, k.applicationCores)
+	}
+
+	ts := k.tasks
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	old := k.OnlineCores()
+	if n == old {
+		return nil
+	}
+	k.onlineCores.Store(uint32(n))
+	for t, tid := range ts.Root.tids {
+		t.onlineCoresChanged(old, n, tid)
+	}
+	log.Infof("Online CPUs changed from %d to %d", old, n)
+	return nil
+}
+
 // RealtimeClock returns the application CLOCK_REALTIME clock.
 func (k *Kernel) RealtimeClock() ktime.Clock {
 	return k.timekeeper.realtimeClock
@@ -1640,12 +1851,18 @@ func (k *Kernel) CgroupRegistry() *CgroupRegistry {
 	return k.cgroupRegistry
 }
 
+// BinfmtMisc returns the binfmt_misc registry of binary formats.
+func (k *Kernel) BinfmtMisc() *loader.BinfmtMisc {
+	return &k.binfmtMisc
+}
+
 // Release releases resources owned by k.
 //
 // Precondition: This should only be called after the kernel is fully
 // initialized, e.g. after k.Start() has been called.
 func (k *Kernel) Release() {
 	ctx := k.SupervisorContext()
+	k.binfmtMisc.RemoveAll(ctx)
 	k.hostMount.DecRef(ctx)
 	k.pipeMount.DecRef(ctx)
 	k.nsfsMount.DecRef(ctx)
@@ -1741,6 +1958,17 @@ func (k *Kernel) ReplaceFSContextRoots(ctx context.Context, oldRoot vfs.VirtualD
 	}
 }
 
+// NestedContainers returns true if the kernel features required to run
+// container runtimes inside the sandbox are enabled.
+func (k *Kernel) NestedContainers() bool {
+	return k.nestedContainers
+}
+
+// TimerResolution returns the minimum resolution of task timers.
+func (k *Kernel) TimerResolution() time.Duration {
+	return k.timerResolution
+}
+
 func (k *Kernel) GetUserCounters(uid auth.KUID) *userCounters {
 	k.userCountersMapMu.Lock()
 	defer k.userCountersMapMu.Unlock()
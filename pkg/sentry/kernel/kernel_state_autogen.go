@@ -67,6 +67,154 @@ func (a *AbstractSocketNamespace) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &a.endpoints)
 }
 
+func (a *Audit) StateTypeName() string {
+	return "pkg/sentry/kernel.Audit"
+}
+
+func (a *Audit) StateFields() []string {
+	return []string{
+		"config",
+	}
+}
+
+func (a *Audit) beforeSave() {}
+
+// +checklocksignore
+func (a *Audit) StateSave(stateSinkObject state.Sink) {
+	a.beforeSave()
+	stateSinkObject.Save(0, &a.config)
+}
+
+func (a *Audit) afterLoad() {}
+
+// +checklocksignore
+func (a *Audit) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &a.config)
+}
+
+func (a *AuditConfig) StateTypeName() string {
+	return "pkg/sentry/kernel.AuditConfig"
+}
+
+func (a *AuditConfig) StateFields() []string {
+	return []string{
+		"Enabled",
+		"Failure",
+		"DaemonPID",
+		"DaemonPortID",
+		"RateLimit",
+		"BacklogLimit",
+		"BacklogWaitTime",
+		"Features",
+		"LockedFeatures",
+		"Rules",
+	}
+}
+
+func (a *AuditConfig) beforeSave() {}
+
+// +checklocksignore
+func (a *AuditConfig) StateSave(stateSinkObject state.Sink) {
+	a.beforeSave()
+	stateSinkObject.Save(0, &a.Enabled)
+	stateSinkObject.Save(1, &a.Failure)
+	stateSinkObject.Save(2, &a.DaemonPID)
+	stateSinkObject.Save(3, &a.DaemonPortID)
+	stateSinkObject.Save(4, &a.RateLimit)
+	stateSinkObject.Save(5, &a.BacklogLimit)
+	stateSinkObject.Save(6, &a.BacklogWaitTime)
+	stateSinkObject.Save(7, &a.Features)
+	stateSinkObject.Save(8, &a.LockedFeatures)
+	stateSinkObject.Save(9, &a.Rules)
+}
+
+func (a *AuditConfig) afterLoad() {}
+
+// +checklocksignore
+func (a *AuditConfig) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &a.Enabled)
+	stateSourceObject.Load(1, &a.Failure)
+	stateSourceObject.Load(2, &a.DaemonPID)
+	stateSourceObject.Load(3, &a.DaemonPortID)
+	stateSourceObject.Load(4, &a.RateLimit)
+	stateSourceObject.Load(5, &a.BacklogLimit)
+	stateSourceObject.Load(6, &a.BacklogWaitTime)
+	stateSourceObject.Load(7, &a.Features)
+	stateSourceObject.Load(8, &a.LockedFeatures)
+	stateSourceObject.Load(9, &a.Rules)
+}
+
+func (a *AuditRule) StateTypeName() string {
+	return "pkg/sentry/kernel.AuditRule"
+}
+
+func (a *AuditRule) StateFields() []string {
+	return []string{
+		"List",
+		"Action",
+		"Mask",
+		"Fields",
+		"Data",
+	}
+}
+
+func (a *AuditRule) beforeSave() {}
+
+// +checklocksignore
+func (a *AuditRule) StateSave(stateSinkObject state.Sink) {
+	a.beforeSave()
+	stateSinkObject.Save(0, &a.List)
+	stateSinkObject.Save(1, &a.Action)
+	stateSinkObject.Save(2, &a.Mask)
+	stateSinkObject.Save(3, &a.Fields)
+	stateSinkObject.Save(4, &a.Data)
+}
+
+func (a *AuditRule) afterLoad() {}
+
+// +checklocksignore
+func (a *AuditRule) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &a.List)
+	stateSourceObject.Load(1, &a.Action)
+	stateSourceObject.Load(2, &a.Mask)
+	stateSourceObject.Load(3, &a.Fields)
+	stateSourceObject.Load(4, &a.Data)
+}
+
+func (a *AuditRuleField) StateTypeName() string {
+	return "pkg/sentry/kernel.AuditRuleField"
+}
+
+func (a *AuditRuleField) StateFields() []string {
+	return []string{
+		"Type",
+		"Op",
+		"Value",
+		"Str",
+	}
+}
+
+func (a *AuditRuleField) beforeSave() {}
+
+// +checklocksignore
+func (a *AuditRuleField) StateSave(stateSinkObject state.Sink) {
+	a.beforeSave()
+	stateSinkObject.Save(0, &a.Type)
+	stateSinkObject.Save(1, &a.Op)
+	stateSinkObject.Save(2, &a.Value)
+	stateSinkObject.Save(3, &a.Str)
+}
+
+func (a *AuditRuleField) afterLoad() {}
+
+// +checklocksignore
+func (a *AuditRuleField) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &a.Type)
+	stateSourceObject.Load(1, &a.Op)
+	stateSourceObject.Load(2, &a.Value)
+	stateSourceObject.Load(3, &a.Str)
+}
+
 func (c *Cgroup) StateTypeName() string {
 	return "pkg/sentry/kernel.Cgroup"
 }
@@ -169,6 +317,37 @@ func (r *CgroupRegistry) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(5, &r.cgroups)
 }
 
+func (ns *CgroupNamespace) StateTypeName() string {
+	return "pkg/sentry/kernel.CgroupNamespace"
+}
+
+func (ns *CgroupNamespace) StateFields() []string {
+	return []string{
+		"inode",
+		"userNS",
+		"roots",
+	}
+}
+
+func (ns *CgroupNamespace) beforeSave() {}
+
+// +checklocksignore
+func (ns *CgroupNamespace) StateSave(stateSinkObject state.Sink) {
+	ns.beforeSave()
+	stateSinkObject.Save(0, &ns.inode)
+	stateSinkObject.Save(1, &ns.userNS)
+	stateSinkObject.Save(2, &ns.roots)
+}
+
+func (ns *CgroupNamespace) afterLoad() {}
+
+// +checklocksignore
+func (ns *CgroupNamespace) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &ns.inode)
+	stateSourceObject.Load(1, &ns.userNS)
+	stateSourceObject.Load(2, &ns.roots)
+}
+
 func (f *FDFlags) StateTypeName() string {
 	return "pkg/sentry/kernel.FDFlags"
 }
@@ -442,11 +621,13 @@ func (k *Kernel) StateFields() []string {
 		"rootNetworkNamespace",
 		"applicationCores",
 		"useHostCores",
+		"onlineCores",
 		"extraAuxv",
 		"vdso",
 		"rootUTSNamespace",
 		"rootIPCNamespace",
 		"rootAbstractSocketNamespace",
+		"rootCgroupNamespace",
 		"futexes",
 		"globalInit",
 		"syslog",
@@ -472,6 +653,14 @@ func (k *Kernel) StateFields() []string {
 		"YAMAPtraceScope",
 		"cgroupRegistry",
 		"userCountersMap",
+		"nestedContainers",
+		"lastAuditSessionID",
+		"audit",
+		"timerSlack",
+		"timerResolution",
+		"deepSleepDelay",
+		"deepSleepMaxProcs",
+		"binfmtMisc",
 	}
 }
 
@@ -482,7 +671,7 @@ func (k *Kernel) StateSave(stateSinkObject state.Sink) {
 	k.beforeSave()
 	var danglingEndpointsValue []tcpip.Endpoint
 	danglingEndpointsValue = k.saveDanglingEndpoints()
-	stateSinkObject.SaveValue(21, danglingEndpointsValue)
+	stateSinkObject.SaveValue(23, danglingEndpointsValue)
 	stateSinkObject.Save(0, &k.featureSet)
 	stateSinkObject.Save(1, &k.timekeeper)
 	stateSinkObject.Save(2, &k.tasks)
@@ -490,35 +679,45 @@ func (k *Kernel) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(4, &k.rootNetworkNamespace)
 	stateSinkObject.Save(5, &k.applicationCores)
 	stateSinkObject.Save(6, &k.useHostCores)
-	stateSinkObject.Save(7, &k.extraAuxv)
-	stateSinkObject.Save(8, &k.vdso)
-	stateSinkObject.Save(9, &k.rootUTSNamespace)
-	stateSinkObject.Save(10, &k.rootIPCNamespace)
-	stateSinkObject.Save(11, &k.rootAbstractSocketNamespace)
-	stateSinkObject.Save(12, &k.futexes)
-	stateSinkObject.Save(13, &k.globalInit)
-	stateSinkObject.Save(14, &k.syslog)
-	stateSinkObject.Save(15, &k.runningTasks)
-	stateSinkObject.Save(16, &k.cpuClock)
-	stateSinkObject.Save(17, &k.cpuClockTickerRunning)
-	stateSinkObject.Save(18, &k.uniqueID)
-	stateSinkObject.Save(19, &k.nextInotifyCookie)
-	stateSinkObject.Save(20, &k.netlinkPorts)
-	stateSinkObject.Save(22, &k.sockets)
-	stateSinkObject.Save(23, &k.nextSocketRecord)
-	stateSinkObject.Save(24, &k.SpecialOpts)
-	stateSinkObject.Save(25, &k.vfs)
-	stateSinkObject.Save(26, &k.hostMount)
-	stateSinkObject.Save(27, &k.pipeMount)
-	stateSinkObject.Save(28, &k.nsfsMount)
-	stateSinkObject.Save(29, &k.shmMount)
-	stateSinkObject.Save(30, &k.socketMount)
-	stateSinkObject.Save(31, &k.sysVShmDevID)
-	stateSinkObject.Save(32, &k.SleepForAddressSpaceActivation)
-	stateSinkObject.Save(33, &k.ptraceExceptions)
-	stateSinkObject.Save(34, &k.YAMAPtraceScope)
-	stateSinkObject.Save(35, &k.cgroupRegistry)
-	stateSinkObject.Save(36, &k.userCountersMap)
+	stateSinkObject.Save(7, &k.onlineCores)
+	stateSinkObject.Save(8, &k.extraAuxv)
+	stateSinkObject.Save(9, &k.vdso)
+	stateSinkObject.Save(10, &k.rootUTSNamespace)
+	stateSinkObject.Save(11, &k.rootIPCNamespace)
+	stateSinkObject.Save(12, &k.rootAbstractSocketNamespace)
+	stateSinkObject.Save(13, &k.rootCgroupNamespace)
+	stateSinkObject.Save(14, &k.futexes)
+	stateSinkObject.Save(15, &k.globalInit)
+	stateSinkObject.Save(16, &k.syslog)
+	stateSinkObject.Save(17, &k.runningTasks)
+	stateSinkObject.Save(18, &k.cpuClock)
+	stateSinkObject.Save(19, &k.cpuClockTickerRunning)
+	stateSinkObject.Save(20, &k.uniqueID)
+	stateSinkObject.Save(21, &k.nextInotifyCookie)
+	stateSinkObject.Save(22, &k.netlinkPorts)
+	stateSinkObject.Save(24, &k.sockets)
+	stateSinkObject.Save(25, &k.nextSocketRecord)
+	stateSinkObject.Save(26, &k.SpecialOpts)
+	stateSinkObject.Save(27, &k.vfs)
+	stateSinkObject.Save(28, &k.hostMount)
+	stateSinkObject.Save(29, &k.pipeMount)
+	stateSinkObject.Save(30, &k.nsfsMount)
+	stateSinkObject.Save(31, &k.shmMount)
+	stateSinkObject.Save(32, &k.socketMount)
+	stateSinkObject.Save(33, &k.sysVShmDevID)
+	stateSinkObject.Save(34, &k.SleepForAddressSpaceActivation)
+	stateSinkObject.Save(35, &k.ptraceExceptions)
+	stateSinkObject.Save(36, &k.YAMAPtraceScope)
+	stateSinkObject.Save(37, &k.cgroupRegistry)
+	stateSinkObject.Save(38, &k.userCountersMap)
+	stateSinkObject.Save(39, &k.nestedContainers)
+	stateSinkObject.Save(40, &k.lastAuditSessionID)
+	stateSinkObject.Save(41, &k.audit)
+	stateSinkObject.Save(42, &k.timerSlack)
+	stateSinkObject.Save(43, &k.timerResolution)
+	stateSinkObject.Save(44, &k.deepSleepDelay)
+	stateSinkObject.Save(45, &k.deepSleepMaxProcs)
+	stateSinkObject.Save(46, &k.binfmtMisc)
 }
 
 func (k *Kernel) afterLoad() {}
@@ -532,36 +731,46 @@ func (k *Kernel) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(4, &k.rootNetworkNamespace)
 	stateSourceObject.Load(5, &k.applicationCores)
 	stateSourceObject.Load(6, &k.useHostCores)
-	stateSourceObject.Load(7, &k.extraAuxv)
-	stateSourceObject.Load(8, &k.vdso)
-	stateSourceObject.Load(9, &k.rootUTSNamespace)
-	stateSourceObject.Load(10, &k.rootIPCNamespace)
-	stateSourceObject.Load(11, &k.rootAbstractSocketNamespace)
-	stateSourceObject.Load(12, &k.futexes)
-	stateSourceObject.Load(13, &k.globalInit)
-	stateSourceObject.Load(14, &k.syslog)
-	stateSourceObject.Load(15, &k.runningTasks)
-	stateSourceObject.Load(16, &k.cpuClock)
-	stateSourceObject.Load(17, &k.cpuClockTickerRunning)
-	stateSourceObject.Load(18, &k.uniqueID)
-	stateSourceObject.Load(19, &k.nextInotifyCookie)
-	stateSourceObject.Load(20, &k.netlinkPorts)
-	stateSourceObject.Load(22, &k.sockets)
-	stateSourceObject.Load(23, &k.nextSocketRecord)
-	stateSourceObject.Load(24, &k.SpecialOpts)
-	stateSourceObject.Load(25, &k.vfs)
-	stateSourceObject.Load(26, &k.hostMount)
-	stateSourceObject.Load(27, &k.pipeMount)
-	stateSourceObject.Load(28, &k.nsfsMount)
-	stateSourceObject.Load(29, &k.shmMount)
-	stateSourceObject.Load(30, &k.socketMount)
-	stateSourceObject.Load(31, &k.sysVShmDevID)
-	stateSourceObject.Load(32, &k.SleepForAddressSpaceActivation)
-	stateSourceObject.Load(33, &k.ptraceExceptions)
-	stateSourceObject.Load(34, &k.YAMAPtraceScope)
-	stateSourceObject.Load(35, &k.cgroupRegistry)
-	stateSourceObject.Load(36, &k.userCountersMap)
-	stateSourceObject.LoadValue(21, new([]tcpip.Endpoint), func(y any) { k.loadDanglingEndpoints(y.([]tcpip.Endpoint)) })
+	stateSourceObject.Load(7, &k.onlineCores)
+	stateSourceObject.Load(8, &k.extraAuxv)
+	stateSourceObject.Load(9, &k.vdso)
+	stateSourceObject.Load(10, &k.rootUTSNamespace)
+	stateSourceObject.Load(11, &k.rootIPCNamespace)
+	stateSourceObject.Load(12, &k.rootAbstractSocketNamespace)
+	stateSourceObject.Load(13, &k.rootCgroupNamespace)
+	stateSourceObject.Load(14, &k.futexes)
+	stateSourceObject.Load(15, &k.globalInit)
+	stateSourceObject.Load(16, &k.syslog)
+	stateSourceObject.Load(17, &k.runningTasks)
+	stateSourceObject.Load(18, &k.cpuClock)
+	stateSourceObject.Load(19, &k.cpuClockTickerRunning)
+	stateSourceObject.Load(20, &k.uniqueID)
+	stateSourceObject.Load(21, &k.nextInotifyCookie)
+	stateSourceObject.Load(22, &k.netlinkPorts)
+	stateSourceObject.Load(24, &k.sockets)
+	stateSourceObject.Load(25, &k.nextSocketRecord)
+	stateSourceObject.Load(26, &k.SpecialOpts)
+	stateSourceObject.Load(27, &k.vfs)
+	stateSourceObject.Load(28, &k.hostMount)
+	stateSourceObject.Load(29, &k.pipeMount)
+	stateSourceObject.Load(30, &k.nsfsMount)
+	stateSourceObject.Load(31, &k.shmMount)
+	stateSourceObject.Load(32, &k.socketMount)
+	stateSourceObject.Load(33, &k.sysVShmDevID)
+	stateSourceObject.Load(34, &k.SleepForAddressSpaceActivation)
+	stateSourceObject.Load(35, &k.ptraceExceptions)
+	stateSourceObject.Load(36, &k.YAMAPtraceScope)
+	stateSourceObject.Load(37, &k.cgroupRegistry)
+	stateSourceObject.Load(38, &k.userCountersMap)
+	stateSourceObject.Load(39, &k.nestedContainers)
+	stateSourceObject.Load(40, &k.lastAuditSessionID)
+	stateSourceObject.Load(41, &k.audit)
+	stateSourceObject.Load(42, &k.timerSlack)
+	stateSourceObject.Load(43, &k.timerResolution)
+	stateSourceObject.Load(44, &k.deepSleepDelay)
+	stateSourceObject.Load(45, &k.deepSleepMaxProcs)
+	stateSourceObject.Load(46, &k.binfmtMisc)
+	stateSourceObject.LoadValue(23, new([]tcpip.Endpoint), func(y any) { k.loadDanglingEndpoints(y.([]tcpip.Endpoint)) })
 }
 
 func (s *SocketRecord) StateTypeName() string {
@@ -1294,12 +1503,15 @@ func (t *Task) StateFields() []string {
 		"ipcns",
 		"abstractSockets",
 		"mountNamespace",
+		"cgroupns",
 		"parentDeathSignal",
 		"syscallFilters",
 		"cleartid",
 		"allowedCPUMask",
+		"cpusetMask",
 		"cpu",
 		"niceness",
+		"schedPolicy",
 		"numaPolicy",
 		"numaNodeMask",
 		"netns",
@@ -1313,6 +1525,8 @@ func (t *Task) StateFields() []string {
 		"cgroups",
 		"memCgID",
 		"userCounters",
+		"timerSlack",
+		"defaultTimerSlack",
 	}
 }
 
@@ -1326,7 +1540,7 @@ func (t *Task) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.SaveValue(32, ptraceTracerValue)
 	var syscallFiltersValue []bpf.Program
 	syscallFiltersValue = t.saveSyscallFilters()
-	stateSinkObject.SaveValue(49, syscallFiltersValue)
+	stateSinkObject.SaveValue(50, syscallFiltersValue)
 	stateSinkObject.Save(0, &t.taskNode)
 	stateSinkObject.Save(1, &t.runState)
 	stateSinkObject.Save(2, &t.taskWorkCount)
@@ -1374,24 +1588,29 @@ func (t *Task) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(45, &t.ipcns)
 	stateSinkObject.Save(46, &t.abstractSockets)
 	stateSinkObject.Save(47, &t.mountNamespace)
-	stateSinkObject.Save(48, &t.parentDeathSignal)
-	stateSinkObject.Save(50, &t.cleartid)
-	stateSinkObject.Save(51, &t.allowedCPUMask)
-	stateSinkObject.Save(52, &t.cpu)
-	stateSinkObject.Save(53, &t.niceness)
-	stateSinkObject.Save(54, &t.numaPolicy)
-	stateSinkObject.Save(55, &t.numaNodeMask)
-	stateSinkObject.Save(56, &t.netns)
-	stateSinkObject.Save(57, &t.rseqCPU)
-	stateSinkObject.Save(58, &t.oldRSeqCPUAddr)
-	stateSinkObject.Save(59, &t.rseqAddr)
-	stateSinkObject.Save(60, &t.rseqSignature)
-	stateSinkObject.Save(61, &t.robustList)
-	stateSinkObject.Save(62, &t.startTime)
-	stateSinkObject.Save(63, &t.kcov)
-	stateSinkObject.Save(64, &t.cgroups)
-	stateSinkObject.Save(65, &t.memCgID)
-	stateSinkObject.Save(66, &t.userCounters)
+	stateSinkObject.Save(48, &t.cgroupns)
+	stateSinkObject.Save(49, &t.parentDeathSignal)
+	stateSinkObject.Save(51, &t.cleartid)
+	stateSinkObject.Save(52, &t.allowedCPUMask)
+	stateSinkObject.Save(53, &t.cpusetMask)
+	stateSinkObject.Save(54, &t.cpu)
+	stateSinkObject.Save(55, &t.niceness)
+	stateSinkObject.Save(56, &t.schedPolicy)
+	stateSinkObject.Save(57, &t.numaPolicy)
+	stateSinkObject.Save(58, &t.numaNodeMask)
+	stateSinkObject.Save(59, &t.netns)
+	stateSinkObject.Save(60, &t.rseqCPU)
+	stateSinkObject.Save(61, &t.oldRSeqCPUAddr)
+	stateSinkObject.Save(62, &t.rseqAddr)
+	stateSinkObject.Save(63, &t.rseqSignature)
+	stateSinkObject.Save(64, &t.robustList)
+	stateSinkObject.Save(65, &t.startTime)
+	stateSinkObject.Save(66, &t.kcov)
+	stateSinkObject.Save(67, &t.cgroups)
+	stateSinkObject.Save(68, &t.memCgID)
+	stateSinkObject.Save(69, &t.userCounters)
+	stateSinkObject.Save(70, &t.timerSlack)
+	stateSinkObject.Save(71, &t.defaultTimerSlack)
 }
 
 // +checklocksignore
@@ -1443,26 +1662,31 @@ func (t *Task) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(45, &t.ipcns)
 	stateSourceObject.Load(46, &t.abstractSockets)
 	stateSourceObject.Load(47, &t.mountNamespace)
-	stateSourceObject.Load(48, &t.parentDeathSignal)
-	stateSourceObject.Load(50, &t.cleartid)
-	stateSourceObject.Load(51, &t.allowedCPUMask)
-	stateSourceObject.Load(52, &t.cpu)
-	stateSourceObject.Load(53, &t.niceness)
-	stateSourceObject.Load(54, &t.numaPolicy)
-	stateSourceObject.Load(55, &t.numaNodeMask)
-	stateSourceObject.Load(56, &t.netns)
-	stateSourceObject.Load(57, &t.rseqCPU)
-	stateSourceObject.Load(58, &t.oldRSeqCPUAddr)
-	stateSourceObject.Load(59, &t.rseqAddr)
-	stateSourceObject.Load(60, &t.rseqSignature)
-	stateSourceObject.Load(61, &t.robustList)
-	stateSourceObject.Load(62, &t.startTime)
-	stateSourceObject.Load(63, &t.kcov)
-	stateSourceObject.Load(64, &t.cgroups)
-	stateSourceObject.Load(65, &t.memCgID)
-	stateSourceObject.Load(66, &t.userCounters)
+	stateSourceObject.Load(48, &t.cgroupns)
+	stateSourceObject.Load(49, &t.parentDeathSignal)
+	stateSourceObject.Load(51, &t.cleartid)
+	stateSourceObject.Load(52, &t.allowedCPUMask)
+	stateSourceObject.Load(53, &t.cpusetMask)
+	stateSourceObject.Load(54, &t.cpu)
+	stateSourceObject.Load(55, &t.niceness)
+	stateSourceObject.Load(56, &t.schedPolicy)
+	stateSourceObject.Load(57, &t.numaPolicy)
+	stateSourceObject.Load(58, &t.numaNodeMask)
+	stateSourceObject.Load(59, &t.netns)
+	stateSourceObject.Load(60, &t.rseqCPU)
+	stateSourceObject.Load(61, &t.oldRSeqCPUAddr)
+	stateSourceObject.Load(62, &t.rseqAddr)
+	stateSourceObject.Load(63, &t.rseqSignature)
+	stateSourceObject.Load(64, &t.robustList)
+	stateSourceObject.Load(65, &t.startTime)
+	stateSourceObject.Load(66, &t.kcov)
+	stateSourceObject.Load(67, &t.cgroups)
+	stateSourceObject.Load(68, &t.memCgID)
+	stateSourceObject.Load(69, &t.userCounters)
+	stateSourceObject.Load(70, &t.timerSlack)
+	stateSourceObject.Load(71, &t.defaultTimerSlack)
 	stateSourceObject.LoadValue(32, new(*Task), func(y any) { t.loadPtraceTracer(y.(*Task)) })
-	stateSourceObject.LoadValue(49, new([]bpf.Program), func(y any) { t.loadSyscallFilters(y.([]bpf.Program)) })
+	stateSourceObject.LoadValue(50, new([]bpf.Program), func(y any) { t.loadSyscallFilters(y.([]bpf.Program)) })
 	stateSourceObject.AfterLoad(t.afterLoad)
 }
 
@@ -1855,6 +2079,37 @@ func (tgc *tgClock) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(1, &tgc.includeSys)
 }
 
+func (s *SchedPolicy) StateTypeName() string {
+	return "pkg/sentry/kernel.SchedPolicy"
+}
+
+func (s *SchedPolicy) StateFields() []string {
+	return []string{
+		"Policy",
+		"RTPriority",
+		"ResetOnFork",
+	}
+}
+
+func (s *SchedPolicy) beforeSave() {}
+
+// +checklocksignore
+func (s *SchedPolicy) StateSave(stateSinkObject state.Sink) {
+	s.beforeSave()
+	stateSinkObject.Save(0, &s.Policy)
+	stateSinkObject.Save(1, &s.RTPriority)
+	stateSinkObject.Save(2, &s.ResetOnFork)
+}
+
+func (s *SchedPolicy) afterLoad() {}
+
+// +checklocksignore
+func (s *SchedPolicy) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &s.Policy)
+	stateSourceObject.Load(1, &s.RTPriority)
+	stateSourceObject.Load(2, &s.ResetOnFork)
+}
+
 func (g *groupStop) StateTypeName() string {
 	return "pkg/sentry/kernel.groupStop"
 }
@@ -1876,6 +2131,27 @@ func (g *groupStop) afterLoad() {}
 func (g *groupStop) StateLoad(stateSourceObject state.Source) {
 }
 
+func (d *debugStop) StateTypeName() string {
+	return "pkg/sentry/kernel.debugStop"
+}
+
+func (d *debugStop) StateFields() []string {
+	return []string{}
+}
+
+func (d *debugStop) beforeSave() {}
+
+// +checklocksignore
+func (d *debugStop) StateSave(stateSinkObject state.Sink) {
+	d.beforeSave()
+}
+
+func (d *debugStop) afterLoad() {}
+
+// +checklocksignore
+func (d *debugStop) StateLoad(stateSourceObject state.Source) {
+}
+
 func (r *runInterrupt) StateTypeName() string {
 	return "pkg/sentry/kernel.runInterrupt"
 }
@@ -2042,6 +2318,8 @@ func (tg *ThreadGroup) StateFields() []string {
 		"oomScoreAdj",
 		"isChildSubreaper",
 		"hasChildSubreaper",
+		"reapsOrphans",
+		"autoReap",
 	}
 }
 
@@ -2086,6 +2364,8 @@ func (tg *ThreadGroup) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(31, &tg.oomScoreAdj)
 	stateSinkObject.Save(32, &tg.isChildSubreaper)
 	stateSinkObject.Save(33, &tg.hasChildSubreaper)
+	stateSinkObject.Save(34, &tg.reapsOrphans)
+	stateSinkObject.Save(35, &tg.autoReap)
 }
 
 func (tg *ThreadGroup) afterLoad() {}
@@ -2125,6 +2405,8 @@ func (tg *ThreadGroup) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(31, &tg.oomScoreAdj)
 	stateSourceObject.Load(32, &tg.isChildSubreaper)
 	stateSourceObject.Load(33, &tg.hasChildSubreaper)
+	stateSourceObject.Load(34, &tg.reapsOrphans)
+	stateSourceObject.Load(35, &tg.autoReap)
 	stateSourceObject.LoadValue(29, new(*OldRSeqCriticalRegion), func(y any) { tg.loadOldRSeqCritical(y.(*OldRSeqCriticalRegion)) })
 }
 
@@ -2492,9 +2774,14 @@ func (v *VDSOParamPage) StateLoad(stateSourceObject state.Source) {
 func init() {
 	state.Register((*abstractEndpoint)(nil))
 	state.Register((*AbstractSocketNamespace)(nil))
+	state.Register((*Audit)(nil))
+	state.Register((*AuditConfig)(nil))
+	state.Register((*AuditRule)(nil))
+	state.Register((*AuditRuleField)(nil))
 	state.Register((*Cgroup)(nil))
 	state.Register((*hierarchy)(nil))
 	state.Register((*CgroupRegistry)(nil))
+	state.Register((*CgroupNamespace)(nil))
 	state.Register((*FDFlags)(nil))
 	state.Register((*descriptor)(nil))
 	state.Register((*FDTable)(nil))
@@ -2543,6 +2830,8 @@ func init() {
 	state.Register((*TaskGoroutineSchedInfo)(nil))
 	state.Register((*taskClock)(nil))
 	state.Register((*tgClock)(nil))
+	state.Register((*SchedPolicy)(nil))
+	state.Register((*debugStop)(nil))
 	state.Register((*groupStop)(nil))
 	state.Register((*runInterrupt)(nil))
 	state.Register((*runInterruptAfterSignalDeliveryStop)(nil))
@@ -24,6 +24,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/limits"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
@@ -42,6 +43,9 @@ const (
 // MaxName is the maximum size for a queue name.
 const MaxName = 255
 
+// MaxMessageSize is the maximum size of a message in any queue.
+const MaxMessageSize = msgSizeHardLimit
+
 const (
 	maxPriority = linux.MQ_PRIO_MAX - 1 // Highest possible message priority.
 
@@ -56,6 +60,11 @@ const (
 	msgSizeMin       = linux.MIN_MSGSIZEMAX  // Min value for max message size.
 	msgSizeLimit     = linux.DFLT_MSGSIZEMAX // Limit for max message size.
 	msgSizeHardLimit = linux.HARD_MSGSIZEMAX // Hard limit for max message size.
+
+	// msgOverhead is the memory used by Linux to track each message slot of a
+	// queue, sizeof(struct msg_msg *) + sizeof(struct posix_msg_tree_node).
+	// It is charged to RLIMIT_MSGQUEUE along with the message data.
+	msgOverhead = 56
 )
 
 // Registry is a POSIX message queue registry.
@@ -74,6 +83,18 @@ type Registry struct {
 	// impl is an implementation of several message queue utilities needed by
 	// the registry. impl should be provided by mqfs.
 	impl RegistryImpl
+
+	// usageMu protects the fields below. It is separate from mu because
+	// queues can also be unlinked through the filesystem, without mu held.
+	usageMu sync.Mutex `state:"nosave"`
+
+	// queueCount is the number of queues in the registry, limited by
+	// maxQueuesDefault.
+	queueCount int
+
+	// userBytes is the number of bytes charged to each user's
+	// RLIMIT_MSGQUEUE by queues in the registry.
+	userBytes map[auth.KUID]uint64
 }
 
 // RegistryImpl defines utilities needed by a Registry to provide actual
@@ -105,8 +126,9 @@ type RegistryImpl interface {
 // IPCNamespace.
 func NewRegistry(userNS *auth.UserNamespace, impl RegistryImpl) *Registry {
 	return &Registry{
-		userNS: userNS,
-		impl:   impl,
+		userNS:    userNS,
+		impl:      impl,
+		userBytes: make(map[auth.KUID]uint64),
 	}
 }
 
@@ -147,7 +169,7 @@ func (r *Registry) FindOrCreate(ctx context.Context, opts OpenOpts, mode linux.F
 
 	// Construct status flags.
 	var flags uint32
-	if opts.Block {
+	if !opts.Block {
 		flags = linux.O_NONBLOCK
 	}
 	switch opts.Access {
@@ -185,7 +207,52 @@ func (r *Registry) FindOrCreate(ctx context.Context, opts OpenOpts, mode linux.F
 	if err != nil {
 		return nil, err
 	}
-	return r.impl.New(ctx, opts.Name, q, opts.Access, opts.Block, mode.Permissions(), flags)
+	if err := r.charge(ctx, q); err != nil {
+		return nil, err
+	}
+	fd, err = r.impl.New(ctx, opts.Name, q, opts.Access, opts.Block, mode.Permissions(), flags)
+	if err != nil {
+		r.uncharge(q)
+		return nil, err
+	}
+	return fd, nil
+}
+
+// charge accounts for the new queue q against the queue count limit and the
+// RLIMIT_MSGQUEUE of its owner. Compare Linux's ipc/mqueue.c:mqueue_get_inode.
+func (r *Registry) charge(ctx context.Context, q *Queue) error {
+	creds := auth.CredentialsFromContext(ctx)
+	rlimit := limits.FromContext(ctx).Get(limits.MessageQueueBytes).Cur
+
+	r.usageMu.Lock()
+	defer r.usageMu.Unlock()
+	if r.queueCount >= maxQueuesDefault && !creds.HasCapabilityIn(linux.CAP_SYS_RESOURCE, r.userNS) {
+		return linuxerr.ENOSPC
+	}
+	if r.userBytes == nil {
+		// The registry was restored from an image taken before queues were
+		// charged.
+		r.userBytes = make(map[auth.KUID]uint64)
+	}
+	used := r.userBytes[q.ownerUID]
+	if used+q.chargedBytes < used || used+q.chargedBytes > rlimit {
+		return linuxerr.EMFILE
+	}
+	r.userBytes[q.ownerUID] = used + q.chargedBytes
+	r.queueCount++
+	return nil
+}
+
+// uncharge reverses charge.
+func (r *Registry) uncharge(q *Queue) {
+	r.usageMu.Lock()
+	defer r.usageMu.Unlock()
+	r.queueCount--
+	if used := r.userBytes[q.ownerUID] - q.chargedBytes; used > 0 {
+		r.userBytes[q.ownerUID] = used
+	} else {
+		delete(r.userBytes, q.ownerUID)
+	}
 }
 
 // newQueueLocked creates a new queue using the given attributes. If attr is nil
@@ -193,13 +260,7 @@ func (r *Registry) FindOrCreate(ctx context.Context, opts OpenOpts, mode linux.F
 // and return an error if attributes are invalid.
 func (r *Registry) newQueueLocked(creds *auth.Credentials, mode linux.FileMode, attr *linux.MqAttr) (*Queue, error) {
 	if attr == nil {
-		return &Queue{
-			ownerUID:        creds.EffectiveKUID,
-			ownerGID:        creds.EffectiveKGID,
-			mode:            mode,
-			maxMessageCount: int64(maxMsgDefault),
-			maxMessageSize:  uint64(msgSizeDefault),
-		}, nil
+		return r.newQueue(creds, mode, int64(maxMsgDefault), uint64(msgSizeDefault)), nil
 	}
 
 	// "O_CREAT was specified in oflag, and attr was not NULL, but
@@ -218,13 +279,20 @@ func (r *Registry) newQueueLocked(creds *auth.Credentials, mode linux.FileMode,
 		return nil, linuxerr.EINVAL
 	}
 
+	return r.newQueue(creds, mode, attr.MqMaxmsg, uint64(attr.MqMsgsize)), nil
+}
+
+// newQueue returns a new queue owned by creds.
+func (r *Registry) newQueue(creds *auth.Credentials, mode linux.FileMode, maxMessageCount int64, maxMessageSize uint64) *Queue {
 	return &Queue{
+		registry:        r,
 		ownerUID:        creds.EffectiveKUID,
 		ownerGID:        creds.EffectiveKGID,
 		mode:            mode,
-		maxMessageCount: attr.MqMaxmsg,
-		maxMessageSize:  uint64(attr.MqMsgsize),
-	}, nil
+		maxMessageCount: maxMessageCount,
+		maxMessageSize:  maxMessageSize,
+		chargedBytes:    uint64(maxMessageCount) * (maxMessageSize + msgOverhead),
+	}
 }
 
 // Remove removes the queue with the given name from the registry. See
@@ -255,6 +323,9 @@ func (r *Registry) Impl() RegistryImpl {
 //
 // +stateify savable
 type Queue struct {
+	// registry is the registry containing the queue. Immutable.
+	registry *Registry
+
 	// ownerUID is the registry's owner's UID. Immutable.
 	ownerUID auth.KUID
 
@@ -289,14 +360,32 @@ type Queue struct {
 
 	// byteCount is the number of bytes of data in all messages in the queue.
 	byteCount uint64
+
+	// waitingReceivers is the number of tasks blocked in Receive.
+	waitingReceivers int
+
+	// chargedBytes is the number of bytes charged to the owner's
+	// RLIMIT_MSGQUEUE for the queue. Immutable.
+	chargedBytes uint64
 }
 
 // View is a view into a message queue. Views should only be used in file
 // descriptions, but not inodes, because we use inodes to retreive the actual
 // queue, and only FDs are responsible for providing user functionality.
 type View interface {
-	// TODO: Add Send and Receive when mq_timedsend(2) and mq_timedreceive(2)
-	// are implemented.
+	// Send sends a message to the queue. See mq_timedsend(2).
+	Send(ctx context.Context, msg Message, b Blocker, block bool) error
+
+	// Receive removes the oldest message of the highest priority from the
+	// queue and returns it. See mq_timedreceive(2).
+	Receive(ctx context.Context, b Blocker, size uint64, block bool) (*Message, error)
+
+	// Subscribe registers the calling process for notification of new
+	// messages, or removes its registration if sub is nil. See mq_notify(2).
+	Subscribe(ctx context.Context, sub *Subscriber) error
+
+	// Attr returns the attributes of the queue, except for mq_flags.
+	Attr() linux.MqAttr
 
 	// Flush checks if the calling process has attached a notification request
 	// to this queue, if yes, then the request is removed, and another process
@@ -313,20 +402,44 @@ type ReaderWriter struct {
 	block bool
 }
 
-// Reader provides a send-only view into a queue.
+// Reader provides a receive-only view into a queue.
 type Reader struct {
 	*Queue
 
 	block bool
 }
 
-// Writer provides a receive-only view into a queue.
+// Send implements View.Send.
+func (Reader) Send(context.Context, Message, Blocker, bool) error {
+	return linuxerr.EBADF
+}
+
+// Writer provides a send-only view into a queue.
 type Writer struct {
 	*Queue
 
 	block bool
 }
 
+// Receive implements View.Receive.
+func (Writer) Receive(context.Context, Blocker, uint64, bool) (*Message, error) {
+	return nil, linuxerr.EBADF
+}
+
+// Blocker is used for blocking Queue.Send and Queue.Receive calls. It serves
+// as an abstracted version of kernel.Task, which can't be used directly to
+// avoid circular dependencies.
+type Blocker interface {
+	Block(C <-chan struct{}) error
+}
+
+// Notifier delivers the notification requested by a Subscriber.
+type Notifier interface {
+	// Notify is called in the context of the sender of a message that
+	// triggers the notification.
+	Notify(ctx context.Context)
+}
+
 // NewView creates a new view into a queue and returns it.
 func NewView(q *Queue, access AccessType, block bool) (View, error) {
 	switch access {
@@ -364,10 +477,29 @@ type Message struct {
 //
 // +stateify savable
 type Subscriber struct {
-	// TODO: Add fields when mq_notify(2) is implemented.
-
 	// pid is the PID of the registered task.
 	pid int32
+
+	// method is the notification method, linux.SIGEV_SIGNAL or
+	// linux.SIGEV_NONE.
+	method int32
+
+	// signo is the signal sent by SIGEV_SIGNAL notifications.
+	signo int32
+
+	// notifier delivers the notification. It is nil for SIGEV_NONE
+	// notifications.
+	notifier Notifier
+}
+
+// NewSubscriber returns a new subscriber notified by notifier with the given
+// method and signal.
+func NewSubscriber(method, signo int32, notifier Notifier) *Subscriber {
+	return &Subscriber{
+		method:   method,
+		signo:    signo,
+		notifier: notifier,
+	}
 }
 
 // Generate implements vfs.DynamicBytesSource.Generate. Queue is used as a
@@ -378,12 +510,13 @@ func (q *Queue) Generate(ctx context.Context, buf *bytes.Buffer) error {
 
 	var (
 		pid       int32
-		method    int
-		sigNumber int
+		method    int32
+		sigNumber int32
 	)
 	if q.subscriber != nil {
 		pid = q.subscriber.pid
-		// TODO: add method and sigNumber when mq_notify(2) is implemented.
+		method = q.subscriber.method
+		sigNumber = q.subscriber.signo
 	}
 
 	buf.WriteString(
@@ -406,6 +539,189 @@ func (q *Queue) Flush(ctx context.Context) {
 	}
 }
 
+// Send implements View.Send.
+func (q *Queue) Send(ctx context.Context, msg Message, b Blocker, block bool) error {
+	if msg.Priority > maxPriority {
+		return linuxerr.EINVAL
+	}
+	if msg.Size > q.maxMessageSize {
+		return linuxerr.EMSGSIZE
+	}
+
+	// Fast path: first attempt a non-blocking push.
+	err := q.push(ctx, &msg)
+	if err != linuxerr.EWOULDBLOCK {
+		return err
+	}
+	if !block {
+		return linuxerr.EAGAIN
+	}
+
+	// Slow path: the queue is full, and we were asked to block.
+	e, ch := waiter.NewChannelEntry(waiter.WritableEvents)
+	q.EventRegister(&e)
+	defer q.EventUnregister(&e)
+
+	// Check again before blocking, since space may have become available.
+	for {
+		if err := q.push(ctx, &msg); err != linuxerr.EWOULDBLOCK {
+			return err
+		}
+		if err := b.Block(ch); err != nil {
+			return err
+		}
+	}
+}
+
+// push inserts msg in the queue behind all messages of the same or higher
+// priority, and notifies waiters. It returns EWOULDBLOCK if the queue is full.
+func (q *Queue) push(ctx context.Context, msg *Message) error {
+	q.mu.Lock()
+	if q.messageCount >= q.maxMessageCount {
+		q.mu.Unlock()
+		return linuxerr.EWOULDBLOCK
+	}
+
+	// "Messages are placed on the queue in decreasing order of priority, with
+	//  newer messages of the same priority being placed after older messages
+	//  with the same priority." - mq_send(3)
+	prev := q.messages.Back()
+	for prev != nil && prev.Priority < msg.Priority {
+		prev = prev.Prev()
+	}
+	if prev == nil {
+		q.messages.PushFront(msg)
+	} else {
+		q.messages.InsertAfter(prev, msg)
+	}
+
+	// "If an empty message queue has a registered notification and no
+	//  process is blocked in mq_receive(3), the notification is delivered
+	//  when a message arrives, and the registration is removed." -
+	//  mq_notify(3)
+	var sub *Subscriber
+	if q.messageCount == 0 && q.waitingReceivers == 0 && q.subscriber != nil {
+		sub = q.subscriber
+		q.subscriber = nil
+	}
+	q.messageCount++
+	q.byteCount += msg.Size
+	q.mu.Unlock()
+
+	q.queue.Notify(waiter.ReadableEvents)
+	if sub != nil && sub.notifier != nil {
+		sub.notifier.Notify(ctx)
+	}
+	return nil
+}
+
+// Receive implements View.Receive.
+func (q *Queue) Receive(ctx context.Context, b Blocker, size uint64, block bool) (*Message, error) {
+	if size < q.maxMessageSize {
+		return nil, linuxerr.EMSGSIZE
+	}
+
+	// Fast path: first attempt a non-blocking pop.
+	msg, err := q.pop()
+	if err != linuxerr.EWOULDBLOCK {
+		return msg, err
+	}
+	if !block {
+		return nil, linuxerr.EAGAIN
+	}
+
+	// Slow path: the queue is empty, and we were asked to block.
+	e, ch := waiter.NewChannelEntry(waiter.ReadableEvents)
+	q.EventRegister(&e)
+	defer q.EventUnregister(&e)
+
+	q.mu.Lock()
+	q.waitingReceivers++
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		q.waitingReceivers--
+		q.mu.Unlock()
+	}()
+
+	// Check again before blocking, since a message may have arrived.
+	for {
+		if msg, err := q.pop(); err != linuxerr.EWOULDBLOCK {
+			return msg, err
+		}
+		if err := b.Block(ch); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// pop removes the first message from the queue and notifies waiters. It
+// returns EWOULDBLOCK if the queue is empty.
+func (q *Queue) pop() (*Message, error) {
+	q.mu.Lock()
+	msg := q.messages.Front()
+	if msg == nil {
+		q.mu.Unlock()
+		return nil, linuxerr.EWOULDBLOCK
+	}
+	q.messages.Remove(msg)
+	q.messageCount--
+	q.byteCount -= msg.Size
+	q.mu.Unlock()
+
+	q.queue.Notify(waiter.WritableEvents)
+	return msg, nil
+}
+
+// Subscribe implements View.Subscribe.
+func (q *Queue) Subscribe(ctx context.Context, sub *Subscriber) error {
+	pid, ok := auth.ThreadGroupIDFromContext(ctx)
+	if !ok {
+		return linuxerr.EINVAL
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if sub == nil {
+		// "If sevp is NULL, and the calling process is currently registered
+		//  to receive notifications for this message queue, then the
+		//  registration is removed." - mq_notify(3)
+		if q.subscriber != nil && q.subscriber.pid == pid {
+			q.subscriber = nil
+		}
+		return nil
+	}
+	if q.subscriber != nil {
+		// "Another process has already registered to receive notification
+		//  for this message queue." - mq_notify(3)
+		return linuxerr.EBUSY
+	}
+	sub.pid = pid
+	q.subscriber = sub
+	return nil
+}
+
+// Attr implements View.Attr.
+func (q *Queue) Attr() linux.MqAttr {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return linux.MqAttr{
+		MqMaxmsg:  q.maxMessageCount,
+		MqMsgsize: int64(q.maxMessageSize),
+		MqCurmsgs: q.messageCount,
+	}
+}
+
+// Unlinked must be called when q is removed from the registry's filesystem.
+// It releases the resources charged for q, which can't be opened anymore.
+func (q *Queue) Unlinked() {
+	// Queues restored from images taken before queues were charged have no
+	// registry and nothing to uncharge.
+	if q.registry != nil {
+		q.registry.uncharge(q)
+	}
+}
+
 // Readiness implements Waitable.Readiness.
 func (q *Queue) Readiness(mask waiter.EventMask) waiter.EventMask {
 	q.mu.Lock()
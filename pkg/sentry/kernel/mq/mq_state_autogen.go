@@ -70,6 +70,8 @@ func (r *Registry) StateFields() []string {
 	return []string{
 		"userNS",
 		"impl",
+		"queueCount",
+		"userBytes",
 	}
 }
 
@@ -80,6 +82,8 @@ func (r *Registry) StateSave(stateSinkObject state.Sink) {
 	r.beforeSave()
 	stateSinkObject.Save(0, &r.userNS)
 	stateSinkObject.Save(1, &r.impl)
+	stateSinkObject.Save(2, &r.queueCount)
+	stateSinkObject.Save(3, &r.userBytes)
 }
 
 func (r *Registry) afterLoad() {}
@@ -88,6 +92,8 @@ func (r *Registry) afterLoad() {}
 func (r *Registry) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &r.userNS)
 	stateSourceObject.Load(1, &r.impl)
+	stateSourceObject.Load(2, &r.queueCount)
+	stateSourceObject.Load(3, &r.userBytes)
 }
 
 func (q *Queue) StateTypeName() string {
@@ -96,6 +102,7 @@ func (q *Queue) StateTypeName() string {
 
 func (q *Queue) StateFields() []string {
 	return []string{
+		"registry",
 		"ownerUID",
 		"ownerGID",
 		"mode",
@@ -106,6 +113,8 @@ func (q *Queue) StateFields() []string {
 		"maxMessageCount",
 		"maxMessageSize",
 		"byteCount",
+		"waitingReceivers",
+		"chargedBytes",
 	}
 }
 
@@ -114,32 +123,38 @@ func (q *Queue) beforeSave() {}
 // +checklocksignore
 func (q *Queue) StateSave(stateSinkObject state.Sink) {
 	q.beforeSave()
-	stateSinkObject.Save(0, &q.ownerUID)
-	stateSinkObject.Save(1, &q.ownerGID)
-	stateSinkObject.Save(2, &q.mode)
-	stateSinkObject.Save(3, &q.queue)
-	stateSinkObject.Save(4, &q.messages)
-	stateSinkObject.Save(5, &q.subscriber)
-	stateSinkObject.Save(6, &q.messageCount)
-	stateSinkObject.Save(7, &q.maxMessageCount)
-	stateSinkObject.Save(8, &q.maxMessageSize)
-	stateSinkObject.Save(9, &q.byteCount)
+	stateSinkObject.Save(0, &q.registry)
+	stateSinkObject.Save(1, &q.ownerUID)
+	stateSinkObject.Save(2, &q.ownerGID)
+	stateSinkObject.Save(3, &q.mode)
+	stateSinkObject.Save(4, &q.queue)
+	stateSinkObject.Save(5, &q.messages)
+	stateSinkObject.Save(6, &q.subscriber)
+	stateSinkObject.Save(7, &q.messageCount)
+	stateSinkObject.Save(8, &q.maxMessageCount)
+	stateSinkObject.Save(9, &q.maxMessageSize)
+	stateSinkObject.Save(10, &q.byteCount)
+	stateSinkObject.Save(11, &q.waitingReceivers)
+	stateSinkObject.Save(12, &q.chargedBytes)
 }
 
 func (q *Queue) afterLoad() {}
 
 // +checklocksignore
 func (q *Queue) StateLoad(stateSourceObject state.Source) {
-	stateSourceObject.Load(0, &q.ownerUID)
-	stateSourceObject.Load(1, &q.ownerGID)
-	stateSourceObject.Load(2, &q.mode)
-	stateSourceObject.Load(3, &q.queue)
-	stateSourceObject.Load(4, &q.messages)
-	stateSourceObject.Load(5, &q.subscriber)
-	stateSourceObject.Load(6, &q.messageCount)
-	stateSourceObject.Load(7, &q.maxMessageCount)
-	stateSourceObject.Load(8, &q.maxMessageSize)
-	stateSourceObject.Load(9, &q.byteCount)
+	stateSourceObject.Load(0, &q.registry)
+	stateSourceObject.Load(1, &q.ownerUID)
+	stateSourceObject.Load(2, &q.ownerGID)
+	stateSourceObject.Load(3, &q.mode)
+	stateSourceObject.Load(4, &q.queue)
+	stateSourceObject.Load(5, &q.messages)
+	stateSourceObject.Load(6, &q.subscriber)
+	stateSourceObject.Load(7, &q.messageCount)
+	stateSourceObject.Load(8, &q.maxMessageCount)
+	stateSourceObject.Load(9, &q.maxMessageSize)
+	stateSourceObject.Load(10, &q.byteCount)
+	stateSourceObject.Load(11, &q.waitingReceivers)
+	stateSourceObject.Load(12, &q.chargedBytes)
 }
 
 func (m *Message) StateTypeName() string {
@@ -183,6 +198,9 @@ func (s *Subscriber) StateTypeName() string {
 func (s *Subscriber) StateFields() []string {
 	return []string{
 		"pid",
+		"method",
+		"signo",
+		"notifier",
 	}
 }
 
@@ -192,6 +210,9 @@ func (s *Subscriber) beforeSave() {}
 func (s *Subscriber) StateSave(stateSinkObject state.Sink) {
 	s.beforeSave()
 	stateSinkObject.Save(0, &s.pid)
+	stateSinkObject.Save(1, &s.method)
+	stateSinkObject.Save(2, &s.signo)
+	stateSinkObject.Save(3, &s.notifier)
 }
 
 func (s *Subscriber) afterLoad() {}
@@ -199,6 +220,9 @@ func (s *Subscriber) afterLoad() {}
 // +checklocksignore
 func (s *Subscriber) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &s.pid)
+	stateSourceObject.Load(1, &s.method)
+	stateSourceObject.Load(2, &s.signo)
+	stateSourceObject.Load(3, &s.notifier)
 }
 
 func init() {
@@ -17,6 +17,7 @@ package msgqueue
 
 import (
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
@@ -27,17 +28,6 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
 )
 
-const (
-	// System-wide limit for maximum number of queues.
-	maxQueues = linux.MSGMNI
-
-	// Maximum size of a queue in bytes.
-	maxQueueBytes = linux.MSGMNB
-
-	// Maximum size of a message in bytes.
-	maxMessageBytes = linux.MSGMAX
-)
-
 // Registry contains a set of message queues that can be referenced using keys
 // or IDs.
 //
@@ -48,12 +38,34 @@ type Registry struct {
 
 	// reg defines basic fields and operations needed for all SysV registries.
 	reg *ipc.Registry
+
+	// msgMax is the maximum size of a message in bytes, msgMnb the default
+	// maximum size of a queue in bytes, and msgMni the maximum number of
+	// queues. They correspond to /proc/sys/kernel/msg{max,mnb,mni}, and are
+	// accessed atomically so that queues can read them without r.mu.
+	msgMax atomicbitops.Int32
+	msgMnb atomicbitops.Int32
+	msgMni atomicbitops.Int32
 }
 
 // NewRegistry returns a new Registry ready to be used.
 func NewRegistry(userNS *auth.UserNamespace) *Registry {
 	return &Registry{
-		reg: ipc.NewRegistry(userNS),
+		reg:    ipc.NewRegistry(userNS),
+		msgMax: atomicbitops.FromInt32(linux.MSGMAX),
+		msgMnb: atomicbitops.FromInt32(linux.MSGMNB),
+		msgMni: atomicbitops.FromInt32(linux.MSGMNI),
+	}
+}
+
+// afterLoad is invoked by stateify.
+func (r *Registry) afterLoad() {
+	// Registries saved before the limits were added to them are restored
+	// with zero limits; use the defaults instead.
+	if r.msgMax.RacyLoad() == 0 && r.msgMnb.RacyLoad() == 0 && r.msgMni.RacyLoad() == 0 {
+		r.msgMax.Store(linux.MSGMAX)
+		r.msgMnb.Store(linux.MSGMNB)
+		r.msgMni.Store(linux.MSGMNI)
 	}
 }
 
@@ -164,7 +176,7 @@ func (r *Registry) FindOrCreate(ctx context.Context, key ipc.Key, mode linux.Fil
 	}
 
 	// Check system-wide limits.
-	if r.reg.ObjectCount() >= maxQueues {
+	if r.reg.ObjectCount() >= int(r.msgMni.Load()) {
 		return nil, linuxerr.ENOSPC
 	}
 
@@ -182,7 +194,7 @@ func (r *Registry) newQueueLocked(ctx context.Context, key ipc.Key, creds *auth.
 		sendTime:    ktime.ZeroTime,
 		receiveTime: ktime.ZeroTime,
 		changeTime:  ktime.NowFromContext(ctx),
-		maxBytes:    maxQueueBytes,
+		maxBytes:    uint64(r.msgMnb.Load()),
 	}
 
 	err := r.reg.Register(q)
@@ -221,15 +233,47 @@ func (r *Registry) IPCInfo(ctx context.Context) *linux.MsgInfo {
 	return &linux.MsgInfo{
 		MsgPool: linux.MSGPOOL,
 		MsgMap:  linux.MSGMAP,
-		MsgMax:  linux.MSGMAX,
-		MsgMnb:  linux.MSGMNB,
-		MsgMni:  linux.MSGMNI,
+		MsgMax:  r.msgMax.Load(),
+		MsgMnb:  r.msgMnb.Load(),
+		MsgMni:  r.msgMni.Load(),
 		MsgSsz:  linux.MSGSSZ,
 		MsgTql:  linux.MSGTQL,
 		MsgSeg:  linux.MSGSEG,
 	}
 }
 
+// MaxMessageSize returns the maximum size of a message in bytes.
+func (r *Registry) MaxMessageSize() int64 {
+	return int64(r.msgMax.Load())
+}
+
+// SetMsgMax sets the maximum size of a message in bytes.
+func (r *Registry) SetMsgMax(v int32) error {
+	if v < 0 {
+		return linuxerr.EINVAL
+	}
+	r.msgMax.Store(v)
+	return nil
+}
+
+// SetMsgMnb sets the default maximum size of new queues in bytes.
+func (r *Registry) SetMsgMnb(v int32) error {
+	if v < 0 {
+		return linuxerr.EINVAL
+	}
+	r.msgMnb.Store(v)
+	return nil
+}
+
+// SetMsgMni sets the maximum number of queues.
+func (r *Registry) SetMsgMni(v int32) error {
+	if v < 0 || v > linux.IPCMNI {
+		return linuxerr.EINVAL
+	}
+	r.msgMni.Store(v)
+	return nil
+}
+
 // MsgInfo reports global parameters for message queues. See msgctl(MSG_INFO).
 func (r *Registry) MsgInfo(ctx context.Context) *linux.MsgInfo {
 	r.mu.Lock()
@@ -250,9 +294,9 @@ func (r *Registry) MsgInfo(ctx context.Context) *linux.MsgInfo {
 		MsgPool: int32(r.reg.ObjectCount()),
 		MsgMap:  int32(messages),
 		MsgTql:  int32(bytes),
-		MsgMax:  linux.MSGMAX,
-		MsgMnb:  linux.MSGMNB,
-		MsgMni:  linux.MSGMNI,
+		MsgMax:  r.msgMax.Load(),
+		MsgMnb:  r.msgMnb.Load(),
+		MsgMni:  r.msgMni.Load(),
 		MsgSsz:  linux.MSGSSZ,
 		MsgSeg:  linux.MSGSEG,
 	}
@@ -355,7 +399,7 @@ func (q *Queue) push(ctx context.Context, m Message, creds *auth.Credentials, pi
 
 // Receive removes a message from the queue and returns it. See msgrcv(2).
 func (q *Queue) Receive(ctx context.Context, b Blocker, mType int64, maxSize int64, wait, truncate, except bool, pid int32) (*Message, error) {
-	if maxSize < 0 || maxSize > maxMessageBytes {
+	if maxSize < 0 || maxSize > int64(q.registry.msgMax.Load()) {
 		return nil, linuxerr.EINVAL
 	}
 	max := uint64(maxSize)
@@ -523,7 +567,7 @@ func (q *Queue) Set(ctx context.Context, ds *linux.MsqidDS) error {
 	defer q.mu.Unlock()
 
 	creds := auth.CredentialsFromContext(ctx)
-	if ds.MsgQbytes > maxQueueBytes && !creds.HasCapabilityIn(linux.CAP_SYS_RESOURCE, q.obj.UserNS) {
+	if ds.MsgQbytes > uint64(q.registry.msgMnb.Load()) && !creds.HasCapabilityIn(linux.CAP_SYS_RESOURCE, q.obj.UserNS) {
 		// "An attempt (IPC_SET) was made to increase msg_qbytes beyond the
 		// system parameter MSGMNB, but the caller is not privileged (Linux:
 		// does not have the CAP_SYS_RESOURCE capability)."
@@ -69,6 +69,9 @@ func (r *Registry) StateTypeName() string {
 func (r *Registry) StateFields() []string {
 	return []string{
 		"reg",
+		"msgMax",
+		"msgMnb",
+		"msgMni",
 	}
 }
 
@@ -78,13 +81,18 @@ func (r *Registry) beforeSave() {}
 func (r *Registry) StateSave(stateSinkObject state.Sink) {
 	r.beforeSave()
 	stateSinkObject.Save(0, &r.reg)
+	stateSinkObject.Save(1, &r.msgMax)
+	stateSinkObject.Save(2, &r.msgMnb)
+	stateSinkObject.Save(3, &r.msgMni)
 }
 
-func (r *Registry) afterLoad() {}
-
 // +checklocksignore
 func (r *Registry) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &r.reg)
+	stateSourceObject.Load(1, &r.msgMax)
+	stateSourceObject.Load(2, &r.msgMnb)
+	stateSourceObject.Load(3, &r.msgMni)
+	stateSourceObject.AfterLoad(r.afterLoad)
 }
 
 func (q *Queue) StateTypeName() string {
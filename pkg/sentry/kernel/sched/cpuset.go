@@ -14,7 +14,11 @@
 
 package sched
 
-import "math/bits"
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+)
 
 const (
 	bitsPerByte  = 8
@@ -81,6 +85,20 @@ func (c *CPUSet) Set(cpu uint) {
 	(*c)[cpu/bitsPerByte] |= 1 << (cpu % bitsPerByte)
 }
 
+// IsSet returns true if the bit corresponding to cpu is set.
+func (c CPUSet) IsSet(cpu uint) bool {
+	i := cpu / bitsPerByte
+	return i < c.Size() && c[i]&(1<<(cpu%bitsPerByte)) != 0
+}
+
+// And clears the bits of c that aren't set in other. other must have the
+// same size as c.
+func (c *CPUSet) And(other CPUSet) {
+	for i := range *c {
+		(*c)[i] &= other[i]
+	}
+}
+
 // ClearAbove clears bits corresponding to cpu and all higher cpus.
 func (c *CPUSet) ClearAbove(cpu uint) {
 	i := cpu / bitsPerByte
@@ -103,3 +121,61 @@ func (c CPUSet) ForEachCPU(fn func(uint)) {
 		}
 	}
 }
+
+// MaskString returns the first num CPUs of c formatted like Linux's "%*pb",
+// as in the Cpus_allowed field of /proc/[pid]/status: a hexadecimal bitmap in
+// comma-separated groups of 32 CPUs, highest CPUs first.
+func (c CPUSet) MaskString(num uint) string {
+	if num == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	groups := (num + 31) / 32
+	for g := groups; g > 0; g-- {
+		var word uint32
+		for i := uint(0); i < 32; i++ {
+			if cpu := (g-1)*32 + i; cpu < num && c.IsSet(cpu) {
+				word |= 1 << i
+			}
+		}
+		if g == groups {
+			// The first group only has as many digits as needed for num.
+			digits := ((num - (g-1)*32) + 3) / 4
+			fmt.Fprintf(&sb, "%0*x", digits, word)
+			continue
+		}
+		fmt.Fprintf(&sb, ",%08x", word)
+	}
+	return sb.String()
+}
+
+// ListString returns c formatted like Linux's "%*pbl", as in the
+// Cpus_allowed_list field of /proc/[pid]/status: a comma-separated list of
+// CPUs and CPU ranges, e.g. "0-3,6".
+func (c CPUSet) ListString() string {
+	var sb strings.Builder
+	start, end := -1, -1
+	flush := func() {
+		if start < 0 {
+			return
+		}
+		if sb.Len() != 0 {
+			sb.WriteByte(',')
+		}
+		if start == end {
+			fmt.Fprintf(&sb, "%d", start)
+		} else {
+			fmt.Fprintf(&sb, "%d-%d", start, end)
+		}
+	}
+	c.ForEachCPU(func(cpu uint) {
+		if int(cpu) == end+1 && start >= 0 {
+			end = int(cpu)
+			return
+		}
+		flush()
+		start, end = int(cpu), int(cpu)
+	})
+	flush()
+	return sb.String()
+}
@@ -0,0 +1,38 @@
+package kernel
+
+import (
+	"unsafe"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/gohacks"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+)
+
+// SeqAtomicLoad returns a copy of *ptr, ensuring that the read does not race
+// with any writer critical sections in seq.
+//
+//go:nosplit
+func SeqAtomicLoadTaskDebugState(seq *sync.SeqCount, ptr *TaskDebugState) TaskDebugState {
+	for {
+		if val, ok := SeqAtomicTryLoadTaskDebugState(seq, seq.BeginRead(), ptr); ok {
+			return val
+		}
+	}
+}
+
+// SeqAtomicTryLoad returns a copy of *ptr while in a reader critical section
+// in seq initiated by a call to seq.BeginRead() that returned epoch. If the
+// read would race with a writer critical section, SeqAtomicTryLoad returns
+// (unspecified, false).
+//
+//go:nosplit
+func SeqAtomicTryLoadTaskDebugState(seq *sync.SeqCount, epoch sync.SeqCountEpoch, ptr *TaskDebugState) (val TaskDebugState, ok bool) {
+	if sync.RaceEnabled {
+
+		gohacks.Memmove(unsafe.Pointer(&val), unsafe.Pointer(ptr), unsafe.Sizeof(val))
+	} else {
+
+		val = *ptr
+	}
+	ok = seq.ReadOk(epoch)
+	return
+}
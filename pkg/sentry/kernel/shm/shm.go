@@ -19,9 +19,9 @@
 //   - SHM_LOCK/SHM_UNLOCK are no-ops. The sentry currently doesn't implement
 //     memory locking in general.
 //
-//   - SHM_HUGETLB and related flags for shmget(2) are ignored. There's no easy
-//     way to implement hugetlb support on a per-map basis, and it has no impact
-//     on correctness.
+//   - SHM_HUGETLB segments are not backed by a reserved pool of huge pages.
+//     Instead, they are aligned to huge pages and the host is advised to back
+//     them with transparent huge pages.
 //
 //   - SHM_NORESERVE for shmget(2) is ignored, the sentry doesn't implement swap
 //     so it's meaningless to reserve space for swap.
@@ -51,6 +51,10 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 )
 
+// hugetlbShmGroup is the group allowed to create SHM_HUGETLB segments without
+// CAP_IPC_LOCK, the default value of Linux's vm.hugetlb_shm_group.
+const hugetlbShmGroup = auth.RootKGID
+
 // Registry tracks all shared memory segments in an IPC namespace. The registry
 // provides the mechanisms for creating and finding segments, and reporting
 // global shm parameters.
@@ -84,6 +88,13 @@ type Registry struct {
 	// Sum of the sizes of all existing segments rounded up to page size, in
 	// units of page size.
 	totalPages uint64
+
+	// shmMax, shmAll and shmMni are the limits on the size of a segment in
+	// bytes, the total size of all segments in pages and the number of
+	// segments. They are tunable via /proc/sys/kernel/shm{max,all,mni}.
+	shmMax uint64
+	shmAll uint64
+	shmMni uint64
 }
 
 // NewRegistry creates a new shm registry.
@@ -91,6 +102,9 @@ func NewRegistry(userNS *auth.UserNamespace) *Registry {
 	return &Registry{
 		userNS: userNS,
 		reg:    ipc.NewRegistry(userNS),
+		shmMax: linux.SHMMAX,
+		shmAll: linux.SHMALL,
+		shmMni: linux.SHMMNI,
 	}
 }
 
@@ -131,11 +145,15 @@ func (r *Registry) dissociateKey(s *Shm) {
 }
 
 // FindOrCreate looks up or creates a segment in the registry. It's functionally
-// analogous to open(2).
+// analogous to open(2). If hugetlb is true, a new segment is backed by huge
+// pages.
 //
 // FindOrCreate returns a reference on Shm.
-func (r *Registry) FindOrCreate(ctx context.Context, pid int32, key ipc.Key, size uint64, mode linux.FileMode, private, create, exclusive bool) (*Shm, error) {
-	if (create || private) && (size < linux.SHMMIN || size > linux.SHMMAX) {
+func (r *Registry) FindOrCreate(ctx context.Context, pid int32, key ipc.Key, size uint64, mode linux.FileMode, private, create, exclusive, hugetlb bool) (*Shm, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if (create || private) && (size < linux.SHMMIN || size > r.shmMax) {
 		// "A new segment was to be created and size is less than SHMMIN or
 		// greater than SHMMAX." - man shmget(2)
 		//
@@ -144,10 +162,7 @@ func (r *Registry) FindOrCreate(ctx context.Context, pid int32, key ipc.Key, siz
 		return nil, linuxerr.EINVAL
 	}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	if r.reg.ObjectCount() >= linux.SHMMNI {
+	if uint64(r.reg.ObjectCount()) >= r.shmMni {
 		// "All possible shared memory IDs have been taken (SHMMNI) ..."
 		//   - man shmget(2)
 		return nil, linuxerr.ENOSPC
@@ -178,8 +193,21 @@ func (r *Registry) FindOrCreate(ctx context.Context, pid int32, key ipc.Key, siz
 	} else {
 		return nil, linuxerr.EINVAL
 	}
+	if hugetlb {
+		val, ok := hostarch.Addr(size).HugeRoundUp()
+		if !ok {
+			return nil, linuxerr.EINVAL
+		}
+		sizeAligned = uint64(val)
+
+		// Compare Linux's mm/hugetlb.c:can_do_hugetlb_shm().
+		creds := auth.CredentialsFromContext(ctx)
+		if !creds.HasCapabilityIn(linux.CAP_IPC_LOCK, r.userNS) && !creds.InGroup(hugetlbShmGroup) {
+			return nil, linuxerr.EPERM
+		}
+	}
 
-	if numPages := sizeAligned / hostarch.PageSize; r.totalPages+numPages > linux.SHMALL {
+	if numPages := sizeAligned / hostarch.PageSize; r.totalPages+numPages < r.totalPages || r.totalPages+numPages > r.shmAll {
 		// "... allocating a segment of the requested size would cause the
 		// system to exceed the system-wide limit on shared memory (SHMALL)."
 		//   - man shmget(2)
@@ -187,7 +215,7 @@ func (r *Registry) FindOrCreate(ctx context.Context, pid int32, key ipc.Key, siz
 	}
 
 	// Need to create a new segment.
-	s, err := r.newShmLocked(ctx, pid, key, auth.CredentialsFromContext(ctx), mode, size)
+	s, err := r.newShmLocked(ctx, pid, key, auth.CredentialsFromContext(ctx), mode, size, sizeAligned, hugetlb)
 	if err != nil {
 		return nil, err
 	}
@@ -200,7 +228,7 @@ func (r *Registry) FindOrCreate(ctx context.Context, pid int32, key ipc.Key, siz
 // newShmLocked creates a new segment in the registry.
 //
 // Precondition: Caller must hold r.mu.
-func (r *Registry) newShmLocked(ctx context.Context, pid int32, key ipc.Key, creator *auth.Credentials, mode linux.FileMode, size uint64) (*Shm, error) {
+func (r *Registry) newShmLocked(ctx context.Context, pid int32, key ipc.Key, creator *auth.Credentials, mode linux.FileMode, size, effectiveSize uint64, hugetlb bool) (*Shm, error) {
 	mfp := pgalloc.MemoryFileProviderFromContext(ctx)
 	if mfp == nil {
 		panic(fmt.Sprintf("context.Context %T lacks non-nil value for key %T", ctx, pgalloc.CtxMemoryFileProvider))
@@ -210,8 +238,11 @@ func (r *Registry) newShmLocked(ctx context.Context, pid int32, key ipc.Key, cre
 		panic(fmt.Sprintf("context.Context %T lacks value for key %T", ctx, CtxDeviceID))
 	}
 
-	effectiveSize := uint64(hostarch.Addr(size).MustRoundUp())
-	fr, err := mfp.MemoryFile().Allocate(effectiveSize, pgalloc.AllocOpts{Kind: usage.Anonymous, MemCgID: pgalloc.MemoryCgroupIDFromContext(ctx)})
+	fr, err := mfp.MemoryFile().Allocate(effectiveSize, pgalloc.AllocOpts{
+		Kind:     usage.Anonymous,
+		MemCgID:  pgalloc.MemoryCgroupIDFromContext(ctx),
+		Hugepage: hugetlb,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -222,6 +253,7 @@ func (r *Registry) newShmLocked(ctx context.Context, pid int32, key ipc.Key, cre
 		devID:         devID,
 		size:          size,
 		effectiveSize: effectiveSize,
+		hugetlb:       hugetlb,
 		obj:           ipc.NewObject(r.reg.UserNS, ipc.Key(key), creator, creator, mode),
 		fr:            fr,
 		creatorPID:    pid,
@@ -240,15 +272,45 @@ func (r *Registry) newShmLocked(ctx context.Context, pid int32, key ipc.Key, cre
 // IPCInfo reports global parameters for sysv shared memory segments on this
 // system. See shmctl(IPC_INFO).
 func (r *Registry) IPCInfo() *linux.ShmParams {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	return &linux.ShmParams{
-		ShmMax: linux.SHMMAX,
+		ShmMax: r.shmMax,
 		ShmMin: linux.SHMMIN,
-		ShmMni: linux.SHMMNI,
+		ShmMni: r.shmMni,
 		ShmSeg: linux.SHMSEG,
-		ShmAll: linux.SHMALL,
+		ShmAll: r.shmAll,
 	}
 }
 
+// SetShmMax sets the maximum size of a segment in bytes. Existing segments are
+// not affected.
+func (r *Registry) SetShmMax(v uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shmMax = v
+}
+
+// SetShmAll sets the maximum total size of all segments in pages. Existing
+// segments are not affected.
+func (r *Registry) SetShmAll(v uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shmAll = v
+}
+
+// SetShmMni sets the maximum number of segments, which must not exceed
+// linux.IPCMNI. Existing segments are not affected.
+func (r *Registry) SetShmMni(v uint64) error {
+	if v > linux.IPCMNI {
+		return linuxerr.EINVAL
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.shmMni = v
+	return nil
+}
+
 // ShmInfo reports linux-specific global parameters for sysv shared memory
 // segments on this system. See shmctl(SHM_INFO).
 func (r *Registry) ShmInfo() *linux.ShmInfo {
@@ -344,11 +406,14 @@ type Shm struct {
 	size uint64
 
 	// effectiveSize of the segment, rounding up to the next page
-	// boundary. Immutable.
+	// boundary, or hugepage boundary if hugetlb is true. Immutable.
 	//
 	// Invariant: effectiveSize must be a multiple of hostarch.PageSize.
 	effectiveSize uint64
 
+	// hugetlb is true if the segment was created with SHM_HUGETLB. Immutable.
+	hugetlb bool
+
 	// fr is the offset into mfp.MemoryFile() that backs this contents of this
 	// segment. Immutable.
 	fr memmap.FileRange
@@ -545,8 +610,17 @@ func (s *Shm) ConfigureAttach(ctx context.Context, addr hostarch.Addr, opts Atta
 		// in the user namespace that governs its IPC namespace." - man shmat(2)
 		return memmap.MMapOpts{}, linuxerr.EACCES
 	}
+	length := s.size
+	if s.hugetlb {
+		// Hugetlb mappings must be aligned to huge pages, and span whole huge
+		// pages. Compare Linux's fs/hugetlbfs/inode.c:hugetlbfs_file_mmap().
+		if !hostarch.IsHugePageAligned(addr) {
+			return memmap.MMapOpts{}, linuxerr.EINVAL
+		}
+		length = s.effectiveSize
+	}
 	return memmap.MMapOpts{
-		Length: s.size,
+		Length: length,
 		Offset: 0,
 		Addr:   addr,
 		Fixed:  opts.Remap,
@@ -15,6 +15,9 @@ func (r *Registry) StateFields() []string {
 		"userNS",
 		"reg",
 		"totalPages",
+		"shmMax",
+		"shmAll",
+		"shmMni",
 	}
 }
 
@@ -26,6 +29,9 @@ func (r *Registry) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(0, &r.userNS)
 	stateSinkObject.Save(1, &r.reg)
 	stateSinkObject.Save(2, &r.totalPages)
+	stateSinkObject.Save(3, &r.shmMax)
+	stateSinkObject.Save(4, &r.shmAll)
+	stateSinkObject.Save(5, &r.shmMni)
 }
 
 func (r *Registry) afterLoad() {}
@@ -35,6 +41,9 @@ func (r *Registry) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &r.userNS)
 	stateSourceObject.Load(1, &r.reg)
 	stateSourceObject.Load(2, &r.totalPages)
+	stateSourceObject.Load(3, &r.shmMax)
+	stateSourceObject.Load(4, &r.shmAll)
+	stateSourceObject.Load(5, &r.shmMni)
 }
 
 func (s *Shm) StateTypeName() string {
@@ -49,6 +58,7 @@ func (s *Shm) StateFields() []string {
 		"devID",
 		"size",
 		"effectiveSize",
+		"hugetlb",
 		"fr",
 		"obj",
 		"attachTime",
@@ -71,14 +81,15 @@ func (s *Shm) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(3, &s.devID)
 	stateSinkObject.Save(4, &s.size)
 	stateSinkObject.Save(5, &s.effectiveSize)
-	stateSinkObject.Save(6, &s.fr)
-	stateSinkObject.Save(7, &s.obj)
-	stateSinkObject.Save(8, &s.attachTime)
-	stateSinkObject.Save(9, &s.detachTime)
-	stateSinkObject.Save(10, &s.changeTime)
-	stateSinkObject.Save(11, &s.creatorPID)
-	stateSinkObject.Save(12, &s.lastAttachDetachPID)
-	stateSinkObject.Save(13, &s.pendingDestruction)
+	stateSinkObject.Save(6, &s.hugetlb)
+	stateSinkObject.Save(7, &s.fr)
+	stateSinkObject.Save(8, &s.obj)
+	stateSinkObject.Save(9, &s.attachTime)
+	stateSinkObject.Save(10, &s.detachTime)
+	stateSinkObject.Save(11, &s.changeTime)
+	stateSinkObject.Save(12, &s.creatorPID)
+	stateSinkObject.Save(13, &s.lastAttachDetachPID)
+	stateSinkObject.Save(14, &s.pendingDestruction)
 }
 
 func (s *Shm) afterLoad() {}
@@ -91,14 +102,15 @@ func (s *Shm) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(3, &s.devID)
 	stateSourceObject.Load(4, &s.size)
 	stateSourceObject.Load(5, &s.effectiveSize)
-	stateSourceObject.Load(6, &s.fr)
-	stateSourceObject.Load(7, &s.obj)
-	stateSourceObject.Load(8, &s.attachTime)
-	stateSourceObject.Load(9, &s.detachTime)
-	stateSourceObject.Load(10, &s.changeTime)
-	stateSourceObject.Load(11, &s.creatorPID)
-	stateSourceObject.Load(12, &s.lastAttachDetachPID)
-	stateSourceObject.Load(13, &s.pendingDestruction)
+	stateSourceObject.Load(6, &s.hugetlb)
+	stateSourceObject.Load(7, &s.fr)
+	stateSourceObject.Load(8, &s.obj)
+	stateSourceObject.Load(9, &s.attachTime)
+	stateSourceObject.Load(10, &s.detachTime)
+	stateSourceObject.Load(11, &s.changeTime)
+	stateSourceObject.Load(12, &s.creatorPID)
+	stateSourceObject.Load(13, &s.lastAttachDetachPID)
+	stateSourceObject.Load(14, &s.pendingDestruction)
 }
 
 func (r *ShmRefs) StateTypeName() string {
@@ -25,6 +25,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
 	"github.com/talismancer/gvisor-ligolo/pkg/metric"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/arch"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/futex"
@@ -103,6 +104,22 @@ type Task struct {
 	goschedSeq sync.SeqCount `state:"nosave"`
 	gosched    TaskGoroutineSchedInfo
 
+	// debugState is a snapshot of the task's state taken when the task
+	// goroutine last blocked, stopped or exited, for debugging.
+	//
+	// debugState is protected by debugStateSeq. debugState is owned by the
+	// task goroutine.
+	debugStateSeq sync.SeqCount  `state:"nosave"`
+	debugState    TaskDebugState `state:"nosave"`
+
+	// If inSyscall is true, the task goroutine is executing the syscall
+	// described by syscallNo and syscallArgs.
+	//
+	// These fields are owned by the task goroutine.
+	inSyscall   bool                  `state:"nosave"`
+	syscallNo   uintptr               `state:"nosave"`
+	syscallArgs arch.SyscallArguments `state:"nosave"`
+
 	// yieldCount is the number of times the task goroutine has called
 	// Task.InterruptibleSleepStart, Task.UninterruptibleSleepStart, or
 	// Task.Yield(), voluntarily ceasing execution.
@@ -451,6 +468,12 @@ type Task struct {
 	// It is protected by mu. It is owned by the task goroutine.
 	mountNamespace *vfs.MountNamespace
 
+	// cgroupns is the task's cgroup namespace, or nil if the task is in the
+	// root cgroup namespace. The task holds a reference on it.
+	//
+	// It is protected by mu. It is owned by the task goroutine.
+	cgroupns *CgroupNamespace
+
 	// parentDeathSignal is sent to this task's thread group when its parent exits.
 	//
 	// parentDeathSignal is protected by mu.
@@ -470,8 +493,11 @@ type Task struct {
 	// cleartid is exclusive to the task goroutine.
 	cleartid hostarch.Addr
 
-	// This is mostly a fake cpumask just for sched_set/getaffinity as we
-	// don't really control the affinity.
+	// allowedCPUMask is the set of CPUs the task is allowed to run on, as
+	// set by sched_setaffinity(2) and restricted by cpusetMask. Unless
+	// Kernel.useHostCores is true, the virtualized CPU of the task is always
+	// in allowedCPUMask. If the platform supports it, the host thread of the
+	// task goroutine is bound to the matching host CPUs, see bindHostCPUs.
 	//
 	// Invariant: allowedCPUMask.Size() ==
 	// sched.CPUMaskSize(Kernel.applicationCores).
@@ -479,10 +505,28 @@ type Task struct {
 	// allowedCPUMask is protected by mu.
 	allowedCPUMask sched.CPUSet
 
+	// cpusetMask is the set of CPUs the cpuset cgroup of the task allows it
+	// to run on. allowedCPUMask is always a subset of cpusetMask. cpusetMask
+	// is empty if the task isn't in a cpuset cgroup.
+	//
+	// cpusetMask is protected by mu.
+	cpusetMask sched.CPUSet
+
 	// cpu is the fake cpu number returned by getcpu(2). cpu is ignored
 	// entirely if Kernel.useHostCores is true.
 	cpu atomicbitops.Int32
 
+	// hostCPUsBound is false if allowedCPUMask changed since the host thread
+	// of the task goroutine was last bound to it. It is false for new and
+	// restored tasks, whose task goroutines run on new host threads.
+	hostCPUsBound atomicbitops.Bool `state:"nosave"`
+
+	// hostThreadLocked is true if the task goroutine is locked to its host
+	// thread because the thread is bound to a subset of the host CPUs.
+	//
+	// hostThreadLocked is exclusive to the task goroutine.
+	hostThreadLocked bool `state:"nosave"`
+
 	// This is used to keep track of changes made to a process' priority/niceness.
 	// It is mostly used to provide some reasonable return value from
 	// getpriority(2) after a call to setpriority(2) has been made.
@@ -493,6 +537,12 @@ type Task struct {
 	// niceness is protected by mu.
 	niceness int
 
+	// schedPolicy is the scheduling policy of the task, as set by
+	// sched_setscheduler(2).
+	//
+	// schedPolicy is protected by mu.
+	schedPolicy SchedPolicy
+
 	// This is used to track the numa policy for the current thread. This can be
 	// modified through a set_mempolicy(2) syscall. Since we always report a
 	// single numa node, all policies are no-ops. We only track this information
@@ -598,6 +648,19 @@ type Task struct {
 	// The userCounters pointer is exclusive to the task goroutine, but the
 	// userCounters instance must be atomically accessed.
 	userCounters *userCounters
+
+	// timerSlack is the amount of time, in nanoseconds, by which the
+	// task's timers may be deferred so that they can be coalesced with other
+	// timers, as set by prctl(PR_SET_TIMERSLACK).
+	//
+	// timerSlack is owned by the task goroutine, but may be read
+	// concurrently.
+	timerSlack atomicbitops.Int64
+
+	// defaultTimerSlack is the value timerSlack is reset to by
+	// prctl(PR_SET_TIMERSLACK, 0): the timer slack of the task's parent when
+	// it was created. defaultTimerSlack is immutable.
+	defaultTimerSlack int64
 }
 
 // Task related metrics
@@ -643,6 +706,7 @@ func (t *Task) afterLoad() {
 	t.endStopCond.L = &t.tg.signalHandlers.mu
 	t.rseqPreempted = true
 	t.futexWaiter = futex.NewWaiter()
+	t.futexWaiter.SetRTPriority(t.schedPolicy.futexRTPriority())
 	t.p = t.k.Platform.NewContext(t.AsyncContext())
 }
 
@@ -15,6 +15,7 @@
 package kernel
 
 import (
+	"math"
 	"runtime"
 	"runtime/trace"
 	"time"
@@ -87,7 +88,7 @@ func (t *Task) BlockWithDeadline(C <-chan struct{}, haveDeadline bool, deadline
 	// Start the timeout timer.
 	t.blockingTimer.Swap(ktime.Setting{
 		Enabled: true,
-		Next:    deadline,
+		Next:    t.SlackDeadline(deadline),
 	})
 
 	err := t.block(C, t.blockingTimerChan)
@@ -102,6 +103,47 @@ func (t *Task) BlockWithDeadline(C <-chan struct{}, haveDeadline bool, deadline
 	return err
 }
 
+// TimerSlack returns t's timer slack in nanoseconds.
+func (t *Task) TimerSlack() int64 {
+	return t.timerSlack.Load()
+}
+
+// SetTimerSlack sets t's timer slack to slack nanoseconds, or to its default
+// timer slack if slack is 0.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) SetTimerSlack(slack int64) {
+	if slack == 0 {
+		slack = t.defaultTimerSlack
+	}
+	t.timerSlack.Store(slack)
+}
+
+// SlackDeadline returns the time at which a timer set by t to expire at
+// deadline should actually expire. Like Linux hrtimers, t's timers may be
+// deferred by up to its timer slack; they are rounded up to a multiple of
+// the slack, so that the timers of tasks sharing a slack expire together and
+// wake the sentry once. The result is then rounded up to the kernel's
+// minimum timer resolution.
+func (t *Task) SlackDeadline(deadline ktime.Time) ktime.Time {
+	ns := deadline.Nanoseconds()
+	if ns <= 0 || deadline == ktime.MaxTime {
+		return deadline
+	}
+	ns = roundUpNanoseconds(ns, t.timerSlack.Load())
+	ns = roundUpNanoseconds(ns, t.k.timerResolution.Nanoseconds())
+	return ktime.FromNanoseconds(ns)
+}
+
+// roundUpNanoseconds rounds ns up to a multiple of unit, unless unit is not
+// positive or doing so would overflow.
+func roundUpNanoseconds(ns, unit int64) int64 {
+	if unit <= 1 || ns > math.MaxInt64-unit {
+		return ns
+	}
+	return (ns + unit - 1) / unit * unit
+}
+
 // BlockWithTimer blocks t until an event is received from C or tchan, or t is
 // interrupted. It returns nil if an event is received from C, ETIMEDOUT if an
 // event is received from tchan, and linuxerr.ErrInterrupted if t is
@@ -52,6 +52,7 @@ func (t *Task) EnterInitialCgroups(parent *Task, initCgroups map[Cgroup]struct{}
 		// existing cgroups.
 		c.Enter(t)
 		t.setMemCgID(c)
+		t.enterCPUSetLocked(c)
 	}
 }
 
@@ -102,6 +103,7 @@ func (t *Task) enterCgroupLocked(c Cgroup) {
 	t.cgroups[c] = struct{}{}
 	c.Enter(t)
 	t.setMemCgID(c)
+	t.enterCPUSetLocked(c)
 }
 
 // +checklocks:t.mu
@@ -215,8 +217,14 @@ type TaskCgroupEntry struct {
 }
 
 // GetCgroupEntries generates the contents of /proc/<pid>/cgroup as
-// a TaskCgroupEntry array.
+// a TaskCgroupEntry array, as seen from the root cgroup namespace.
 func (t *Task) GetCgroupEntries() []TaskCgroupEntry {
+	return t.getCgroupEntries(nil)
+}
+
+// getCgroupEntries is GetCgroupEntries with paths relative to the cgroup
+// namespace ns, or to the root cgroup namespace if ns is nil.
+func (t *Task) getCgroupEntries(ns *CgroupNamespace) []TaskCgroupEntry {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
@@ -238,10 +246,14 @@ func (t *Task) GetCgroupEntries() []TaskCgroupEntry {
 			ctlNames = append(ctlNames, string(ctl.Type()))
 		}
 
+		path := c.Path()
+		if ns != nil {
+			path = ns.relativePath(c)
+		}
 		cgEntries = append(cgEntries, TaskCgroupEntry{
 			HierarchyID: c.HierarchyID(),
 			Controllers: strings.Join(ctlNames, ","),
-			Path:        c.Path(),
+			Path:        path,
 		})
 	}
 
@@ -249,9 +261,11 @@ func (t *Task) GetCgroupEntries() []TaskCgroupEntry {
 	return cgEntries
 }
 
-// GenerateProcTaskCgroup writes the contents of /proc/<pid>/cgroup for t to buf.
-func (t *Task) GenerateProcTaskCgroup(buf *bytes.Buffer) {
-	cgEntries := t.GetCgroupEntries()
+// GenerateProcTaskCgroup writes the contents of /proc/<pid>/cgroup for t to buf,
+// with paths relative to the cgroup namespace ns, as Linux does for the cgroup
+// namespace of the reader. ns may be nil for the root cgroup namespace.
+func (t *Task) GenerateProcTaskCgroup(ns *CgroupNamespace, buf *bytes.Buffer) {
+	cgEntries := t.getCgroupEntries(ns)
 	for _, cgE := range cgEntries {
 		fmt.Fprintf(buf, "%d:%s:%s\n", cgE.HierarchyID, cgE.Controllers, cgE.Path)
 	}
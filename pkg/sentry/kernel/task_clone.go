@@ -19,11 +19,13 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/bpf"
 	"github.com/talismancer/gvisor-ligolo/pkg/cleanup"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/kernfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/nsfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
 	pb "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/points/points_go_proto"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
@@ -61,6 +63,14 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 	if args.Flags&linux.CLONE_NEWUSER != 0 && args.Flags&(linux.CLONE_THREAD|linux.CLONE_FS) != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
+	// Mount namespaces are only supported with nested containers, and are
+	// silently shared otherwise. FS contexts cannot span mount namespaces.
+	newMountNS := args.Flags&linux.CLONE_NEWNS != 0 && t.k.nestedContainers
+	if newMountNS && args.Flags&linux.CLONE_FS != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	// Likewise for cgroup namespaces.
+	newCgroupNS := args.Flags&linux.CLONE_NEWCGROUP != 0 && t.k.nestedContainers
 	// args.ExitSignal must be a valid signal.
 	if args.ExitSignal != 0 && !linux.Signal(args.ExitSignal).IsValid() {
 		return 0, nil, linuxerr.EINVAL
@@ -97,7 +107,7 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 			return 0, nil, err
 		}
 	}
-	if args.Flags&(linux.CLONE_NEWPID|linux.CLONE_NEWNET|linux.CLONE_NEWUTS|linux.CLONE_NEWIPC) != 0 && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, userns) {
+	if (args.Flags&(linux.CLONE_NEWPID|linux.CLONE_NEWNET|linux.CLONE_NEWUTS|linux.CLONE_NEWIPC) != 0 || newMountNS || newCgroupNS) && !creds.HasCapabilityIn(linux.CAP_SYS_ADMIN, userns) {
 		return 0, nil, linuxerr.EPERM
 	}
 
@@ -132,15 +142,6 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		netns.DecRef(t)
 	})
 
-	// TODO(b/63601033): Implement CLONE_NEWNS.
-	mntns := t.mountNamespace
-	if mntns != nil {
-		mntns.IncRef()
-		cu.Add(func() {
-			mntns.DecRef(t)
-		})
-	}
-
 	// We must hold t.mu to access t.image, but we can't hold it during Fork(),
 	// since TaskImage.Fork()=>mm.Fork() takes mm.addressSpaceMu, which is ordered
 	// above Task.mu. So we copy t.image with t.mu held and call Fork() on the copy.
@@ -173,6 +174,35 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		fsContext.IncRef()
 	}
 
+	mntns := t.mountNamespace
+	if mntns != nil {
+		if newMountNS {
+			mntns = t.k.cloneMountNamespace(t, userns, mntns, fsContext)
+		} else {
+			mntns.IncRef()
+		}
+		cu.Add(func() {
+			mntns.DecRef(t)
+		})
+	}
+
+	var cgroupns *CgroupNamespace
+	if newCgroupNS {
+		cgroupns = t.newCgroupNamespace(userns)
+	} else {
+		t.mu.Lock()
+		cgroupns = t.cgroupns
+		if cgroupns != nil {
+			cgroupns.IncRef()
+		}
+		t.mu.Unlock()
+	}
+	if cgroupns != nil {
+		cu.Add(func() {
+			cgroupns.DecRef(t)
+		})
+	}
+
 	var fdTable *FDTable
 	if args.Flags&linux.CLONE_FILES == 0 {
 		fdTable = t.fdTable.Fork(t, MaxFdLimit)
@@ -207,6 +237,10 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		uc = t.k.GetUserCounters(creds.RealKUID)
 	}
 
+	t.mu.Lock()
+	schedPolicy, niceness := t.forkedSchedLocked()
+	t.mu.Unlock()
+
 	cfg := &TaskConfig{
 		Kernel:                  t.k,
 		ThreadGroup:             tg,
@@ -215,13 +249,16 @@ func (t *Task) Clone(args *linux.CloneArgs) (ThreadID, *SyscallControl, error) {
 		FSContext:               fsContext,
 		FDTable:                 fdTable,
 		Credentials:             creds,
-		Niceness:                t.Niceness(),
+		Niceness:                niceness,
+		SchedPolicy:             schedPolicy,
+		TimerSlack:              t.TimerSlack(),
 		NetworkNamespace:        netns,
 		AllowedCPUMask:          t.CPUMask(),
 		UTSNamespace:            utsns,
 		IPCNamespace:            ipcns,
 		AbstractSocketNamespace: t.abstractSockets,
 		MountNamespace:          mntns,
+		CgroupNamespace:         cgroupns,
 		RSeqAddr:                rseqAddr,
 		RSeqSignature:           rseqSignature,
 		ContainerID:             t.ContainerID(),
@@ -437,6 +474,27 @@ func (t *Task) Setns(fd *vfs.FileDescription, flags int32) error {
 		t.mu.Unlock()
 		oldNS.DecRef(t)
 		return nil
+	case *CgroupNamespace:
+		if flags != 0 && flags != linux.CLONE_NEWCGROUP {
+			return linuxerr.EINVAL
+		}
+		if !t.HasCapabilityIn(linux.CAP_SYS_ADMIN, ns.UserNamespace()) ||
+			!t.Credentials().HasCapability(linux.CAP_SYS_ADMIN) {
+			return linuxerr.EPERM
+		}
+		if ns == t.k.rootCgroupNamespace {
+			ns = nil
+		} else {
+			ns.IncRef()
+		}
+		t.mu.Lock()
+		oldNS := t.cgroupns
+		t.cgroupns = ns
+		t.mu.Unlock()
+		if oldNS != nil {
+			oldNS.DecRef(t)
+		}
+		return nil
 	default:
 		return linuxerr.EINVAL
 	}
@@ -497,6 +555,18 @@ func (t *Task) Unshare(flags int32) error {
 		creds = t.Credentials()
 	}
 	haveCapSysAdmin := t.HasCapability(linux.CAP_SYS_ADMIN)
+	newMountNS := flags&linux.CLONE_NEWNS != 0 && t.k.nestedContainers
+	if newMountNS {
+		if !haveCapSysAdmin {
+			return linuxerr.EPERM
+		}
+		// "CLONE_NEWNS implies CLONE_FS" - kernel/fork.c:ksys_unshare().
+		flags |= linux.CLONE_FS
+	}
+	newCgroupNS := flags&linux.CLONE_NEWCGROUP != 0 && t.k.nestedContainers
+	if newCgroupNS && !haveCapSysAdmin {
+		return linuxerr.EPERM
+	}
 	if flags&linux.CLONE_NEWPID != 0 {
 		if !haveCapSysAdmin {
 			return linuxerr.EPERM
@@ -559,9 +629,42 @@ func (t *Task) Unshare(flags int32) error {
 	if oldFSContext != nil {
 		oldFSContext.DecRef(t)
 	}
+	if newMountNS {
+		// t.fsContext was unshared above, so it isn't used by other tasks.
+		mntns := t.k.cloneMountNamespace(t, creds.UserNamespace, t.mountNamespace, t.fsContext)
+		t.mu.Lock()
+		oldMntns := t.mountNamespace
+		t.mountNamespace = mntns
+		t.mu.Unlock()
+		oldMntns.DecRef(t)
+	}
+	if newCgroupNS {
+		cgroupns := t.newCgroupNamespace(creds.UserNamespace)
+		t.mu.Lock()
+		oldCgroupns := t.cgroupns
+		t.cgroupns = cgroupns
+		t.mu.Unlock()
+		if oldCgroupns != nil {
+			oldCgroupns.DecRef(t)
+		}
+	}
 	return nil
 }
 
+// cloneMountNamespace returns a copy of mntns owned by userns, and moves the
+// root and working directories of fs into the copy. A reference is taken on
+// the returned mount namespace.
+func (k *Kernel) cloneMountNamespace(ctx context.Context, userns *auth.UserNamespace, mntns *vfs.MountNamespace, fs *FSContext) *vfs.MountNamespace {
+	root := fs.RootDirectory()
+	defer root.DecRef(ctx)
+	cwd := fs.WorkingDirectory()
+	defer cwd.DecRef(ctx)
+	newMntns := k.vfs.CloneMountNamespace(ctx, userns, mntns, &root, &cwd)
+	fs.SetRootDirectory(ctx, root)
+	fs.SetWorkingDirectory(ctx, cwd)
+	return newMntns
+}
+
 // UnshareFdTable unshares the FdTable that task t shares with other tasks, upto
 // the maxFd.
 //
@@ -0,0 +1,82 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kernel
+
+import (
+	"strconv"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/arch"
+)
+
+// TaskDebugState is a snapshot of the state of a task taken when its task
+// goroutine blocked, stopped or exited.
+type TaskDebugState struct {
+	// InSyscall is true if the task goroutine was executing a syscall.
+	InSyscall bool
+
+	// Sysno and Args are the syscall number and arguments if InSyscall is
+	// true.
+	Sysno uintptr
+	Args  arch.SyscallArguments
+
+	// IP and SP are the application instruction and stack pointers.
+	IP uintptr
+	SP uintptr
+}
+
+// saveDebugState records t's debug state.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) saveDebugState() {
+	t.debugStateSeq.BeginWrite()
+	// This function is very hot; avoid defer.
+	t.debugState.InSyscall = t.inSyscall
+	t.debugState.Sysno = t.syscallNo
+	t.debugState.Args = t.syscallArgs
+	t.debugState.IP = t.Arch().IP()
+	t.debugState.SP = t.Arch().Stack()
+	t.debugStateSeq.EndWrite()
+}
+
+// DebugState returns the state of t recorded when its task goroutine last
+// blocked, stopped or exited. ok is false if the task goroutine is running,
+// in which case the recorded state is stale.
+func (t *Task) DebugState() (state TaskDebugState, ok bool) {
+	switch t.TaskGoroutineSchedInfo().State {
+	case TaskGoroutineRunningSys, TaskGoroutineRunningApp:
+		return TaskDebugState{}, false
+	}
+	return SeqAtomicLoadTaskDebugState(&t.debugStateSeq, &t.debugState), true
+}
+
+// String implements fmt.Stringer.
+func (s TaskGoroutineState) String() string {
+	switch s {
+	case TaskGoroutineNonexistent:
+		return "nonexistent"
+	case TaskGoroutineRunningSys:
+		return "running (sentry)"
+	case TaskGoroutineRunningApp:
+		return "running (application)"
+	case TaskGoroutineBlockedInterruptible:
+		return "blocked (interruptible)"
+	case TaskGoroutineBlockedUninterruptible:
+		return "blocked (uninterruptible)"
+	case TaskGoroutineStopped:
+		return "stopped"
+	default:
+		return strconv.Itoa(int(s))
+	}
+}
@@ -289,12 +289,17 @@ func (*runExitMain) execute(t *Task) taskRunState {
 	t.mountNamespace = nil
 	ipcns := t.ipcns
 	netns := t.netns.Swap(nil)
+	cgroupns := t.cgroupns
+	t.cgroupns = nil
 	t.mu.Unlock()
 	if mntns != nil {
 		mntns.DecRef(t)
 	}
 	ipcns.DecRef(t)
 	netns.DecRef(t)
+	if cgroupns != nil {
+		cgroupns.DecRef(t)
+	}
 
 	// If this is the last task to exit from the thread group, release the
 	// thread group's resources.
@@ -472,6 +477,7 @@ func (t *Task) reparentLocked(parent *Task) {
 		return
 	}
 	t.tg.terminationSignal = linux.SIGCHLD
+	t.tg.autoReap = parent != nil && parent.tg.reapsOrphans
 	if t.exitParentNotified && !t.exitParentAcked {
 		t.exitParentNotified = false
 		t.exitNotifyLocked(false)
@@ -684,7 +690,12 @@ func (t *Task) exitNotifyLocked(fromPtraceDetach bool) {
 				//		does not suppress the SIGCHLD.
 				signalParent := t.tg.terminationSignal.IsValid()
 				t.parent.tg.signalHandlers.mu.Lock()
-				if t.tg.terminationSignal == linux.SIGCHLD || fromPtraceDetach {
+				if t.tg.autoReap {
+					// Orphans adopted by a thread group emulating init
+					// are reaped on its behalf.
+					t.exitParentAcked = true
+					signalParent = false
+				} else if t.tg.terminationSignal == linux.SIGCHLD || fromPtraceDetach {
 					if act, ok := t.parent.tg.signalHandlers.actions[linux.SIGCHLD]; ok {
 						if act.Handler == linux.SIG_IGN {
 							t.exitParentAcked = true
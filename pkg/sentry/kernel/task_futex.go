@@ -148,6 +148,12 @@ func (t *Task) wakeRobustListOne(addr hostarch.Addr) {
 	}
 
 	tid := uint32(t.ThreadID())
+	if pi {
+		// Hand the futex over to the next waiter, if any, with the owner died
+		// bit set. Like Linux, robust futexes use shared keys.
+		t.Futex().OwnerDiedPI(t, addr, tid, false /* private */)
+		return
+	}
 	for {
 		// Is this held by someone else?
 		if f&linux.FUTEX_TID_MASK != tid {
@@ -168,10 +174,6 @@ func (t *Task) wakeRobustListOne(addr hostarch.Addr) {
 		// Wake waiters if there are any.
 		if f&linux.FUTEX_WAITERS != 0 {
 			private := f&linux.FUTEX_PRIVATE_FLAG != 0
-			if pi {
-				t.Futex().UnlockPI(t, addr, tid, private)
-				return
-			}
 			t.Futex().Wake(t, addr, private, linux.FUTEX_BITSET_MATCH_ANY, 1)
 		}
 
@@ -345,6 +345,9 @@ func (t *Task) SetExtraGIDs(gids []auth.GID) error {
 	if !creds.HasCapability(linux.CAP_SETGID) {
 		return linuxerr.EPERM
 	}
+	if !creds.UserNamespace.SetgroupsAllowed() {
+		return linuxerr.EPERM
+	}
 	kgids := make([]auth.KGID, len(gids))
 	for i, gid := range gids {
 		kgid := creds.UserNamespace.MapToKGID(gid)
@@ -455,6 +458,45 @@ func (t *Task) SetKeepCaps(k bool) {
 	t.creds.Store(creds)
 }
 
+// SetSessionKeyring sets the session keyring of t.
+func (t *Task) SetSessionKeyring(k *auth.Key) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	creds := t.Credentials().Fork() // The credentials object is immutable. See doc for creds.
+	creds.SessionKeyring = k
+	t.creds.Store(creds)
+}
+
+// SetLoginUID sets the audit login UID of t, as for a write to
+// /proc/[pid]/loginuid. Setting a valid login UID starts a new audit session.
+func (t *Task) SetLoginUID(kuid auth.KUID) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	creds := t.Credentials()
+	if creds.LoginKUID.Ok() {
+		// Changing a login UID that was set requires privileges, and may be
+		// forbidden altogether. See kernel/auditsc.c:audit_set_loginuid_perm.
+		conf := t.k.audit.Config()
+		if conf.FeatureSet(linux.AUDIT_FEATURE_LOGINUID_IMMUTABLE) {
+			return linuxerr.EPERM
+		}
+		if !creds.HasCapabilityIn(linux.CAP_AUDIT_CONTROL, t.k.rootUserNamespace) {
+			return linuxerr.EPERM
+		}
+		if conf.FeatureSet(linux.AUDIT_FEATURE_ONLY_UNSET_LOGINUID) && kuid.Ok() {
+			return linuxerr.EPERM
+		}
+	}
+	creds = creds.Fork() // The credentials object is immutable. See doc for creds.
+	creds.LoginKUID = kuid
+	creds.SessionID = linux.AUDIT_SID_UNSET
+	if kuid.Ok() {
+		creds.SessionID = t.k.lastAuditSessionID.Add(1)
+	}
+	t.creds.Store(creds)
+	return nil
+}
+
 // updateCredsForExecLocked updates t.creds to reflect an execve().
 //
 // NOTE(b/30815691): We currently do not implement privileged executables
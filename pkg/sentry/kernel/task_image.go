@@ -141,6 +141,14 @@ func (k *Kernel) LoadTaskImage(ctx context.Context, args loader.LoadArgs) (*Task
 	m := mm.NewMemoryManager(k, k, k.SleepForAddressSpaceActivation)
 	defer m.DecUsers(ctx)
 	args.MemoryManager = m
+	args.BinfmtMisc = &k.binfmtMisc
+	// The memory-deny-write-execute policy is inherited across execve, and
+	// must apply while the new image is loaded.
+	if t := TaskFromContext(ctx); t != nil {
+		if cur := t.MemoryManager(); cur != nil {
+			cur.InheritMDWE(m)
+		}
+	}
 
 	os, ac, name, err := loader.Load(ctx, args, k.extraAuxv, k.vdso)
 	if err != nil {
@@ -16,6 +16,7 @@ package kernel
 
 import (
 	"fmt"
+	"io"
 	"runtime"
 	"runtime/trace"
 
@@ -28,6 +29,8 @@ import (
 	ktime "github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/time"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/memmap"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/platform"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
+	pb "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/points/points_go_proto"
 )
 
 // A taskRunState is a reified state in the task state machine. See README.md
@@ -165,6 +168,13 @@ func (app *runApp) execute(t *Task) taskRunState {
 		}
 	}
 
+	// Bind the host thread to the CPUs the task is allowed to run on if they
+	// changed.
+	if !t.hostCPUsBound.Load() {
+		t.hostCPUsBound.Store(true)
+		t.bindHostCPUs()
+	}
+
 	// We're about to switch to the application again. If there's still an
 	// unhandled SyscallRestartErrno that wasn't translated to an EINTR,
 	// restart the syscall that was interrupted. If there's a saved signal
@@ -289,6 +299,12 @@ func (app *runApp) execute(t *Task) taskRunState {
 			addr := hostarch.Addr(info.Addr())
 			err := t.MemoryManager().HandleUserFault(t, addr, at, hostarch.Addr(t.Arch().Stack()))
 			region.End()
+			if err == nil && sig == linux.SIGBUS {
+				// The faulting page is validly mapped as far as we know, but
+				// the host still raised SIGBUS: the host file backing it must
+				// have been truncated. Retrying the access would fault forever.
+				err = t.mappedFileTruncated(addr)
+			}
 			if err == nil {
 				// The fault was handled appropriately.
 				// We can resume running the application.
@@ -393,3 +409,32 @@ func (t *Task) Yield() {
 	t.yieldCount.Add(1)
 	runtime.Gosched()
 }
+
+// mappedFileTruncated is called when an application access at addr faulted
+// because the host file backing the mapping was truncated outside of the
+// sandbox. It returns the error that causes the fault to be reported to the
+// application as SIGBUS at addr, as Linux does for accesses beyond EOF.
+func (t *Task) mappedFileTruncated(addr hostarch.Addr) error {
+	name, off, ok := t.MemoryManager().HandleExternalTruncate(t, addr)
+	if !ok {
+		// Not a file mapping; there is nothing else to report.
+		return &memmap.BusError{Err: io.EOF}
+	}
+	t.Debugf("Access to %q at addr=%#x offset=%#x faulted: file was truncated", name, addr, off)
+	if seccheck.Global.Enabled(seccheck.PointMappedFileTruncated) {
+		info := &pb.MappedFileTruncated{
+			Path:    name,
+			Address: uint64(addr),
+			Offset:  off,
+		}
+		fields := seccheck.Global.GetFieldSet(seccheck.PointMappedFileTruncated)
+		if !fields.Context.Empty() {
+			info.ContextData = &pb.ContextData{}
+			LoadSeccheckData(t, fields.Context, info.ContextData)
+		}
+		seccheck.Global.SentToSinks(func(c seccheck.Sink) error {
+			return c.MappedFileTruncated(t, fields, info)
+		})
+	}
+	return &memmap.BusError{Err: io.EOF}
+}
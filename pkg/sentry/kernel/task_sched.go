@@ -19,6 +19,7 @@ package kernel
 import (
 	"fmt"
 	"math/rand"
+	"runtime"
 	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
@@ -28,6 +29,7 @@ import (
 	ktime "github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/time"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/limits"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/usage"
+	"golang.org/x/sys/unix"
 )
 
 // TaskGoroutineState is a coarse representation of the current execution
@@ -128,6 +130,7 @@ func (t *Task) accountTaskGoroutineEnter(state TaskGoroutineState) {
 
 	if state != TaskGoroutineRunningApp {
 		// Task is blocking/stopping.
+		t.saveDebugState()
 		t.k.decRunningTasks()
 	}
 }
@@ -342,10 +345,13 @@ func (k *Kernel) runCPUClockTicker() {
 	for {
 		// Stop the CPU clock while nothing is running.
 		if k.runningTasks.Load() == 0 {
+			idle := false
 			k.runningTasksMu.Lock()
 			if k.runningTasks.Load() == 0 {
+				idle = true
 				k.cpuClockTickerRunning = false
 				k.cpuClockTickerStopCond.Broadcast()
+				k.idle()
 				k.runningTasksCond.Wait()
 				// k.cpuClockTickerRunning was set to true by our waker
 				// (Kernel.incRunningTasks()). For reasons described there, we must
@@ -353,6 +359,9 @@ func (k *Kernel) runCPUClockTicker() {
 				// k.runningTasksCond.Wait().
 			}
 			k.runningTasksMu.Unlock()
+			if idle {
+				k.wake()
+			}
 		}
 
 		// Wait for the next CPU clock tick.
@@ -580,28 +589,178 @@ func (t *Task) SetCPUMask(mask sched.CPUSet) error {
 		panic(fmt.Sprintf("Invalid CPUSet %v (expected %d bytes)", mask, want))
 	}
 
-	// Remove CPUs in mask above Kernel.applicationCores.
-	mask.ClearAbove(t.k.applicationCores)
+	// Locking the TaskSet also prevents the online CPUs from changing, see
+	// Kernel.SetOnlineCores.
+	t.tg.pidns.owner.mu.RLock()
+	defer t.tg.pidns.owner.mu.RUnlock()
+	rootTID := t.tg.pidns.owner.Root.tids[t]
+
+	// Remove CPUs in mask that aren't online. If Kernel.useHostCores is
+	// true, all CPUs are online.
+	mask.ClearAbove(t.k.OnlineCores())
 
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Like kernel/sched/core.c:__sched_setaffinity, only keep the CPUs
+	// allowed by the cpuset of the task.
+	if t.cpusetMask != nil {
+		mask.And(t.cpusetMask)
+	}
 	// Ensure that at least 1 CPU is still allowed.
 	if mask.NumCPUs() == 0 {
 		return linuxerr.EINVAL
 	}
+	t.setAllowedCPUMaskLocked(mask)
+	t.cpu.Store(assignCPU(mask, rootTID))
+	return nil
+}
 
-	if t.k.useHostCores {
-		// No-op; pretend the mask was immediately changed back.
-		return nil
+// OnlineCPUSet returns the set of online CPUs the cpuset cgroup of t allows
+// it to run on. It returns all online CPUs if t isn't in a cpuset cgroup, or
+// if none of the CPUs of its cpuset are online.
+func (t *Task) OnlineCPUSet() sched.CPUSet {
+	cpus := t.k.OnlineCPUs()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cpusetMask == nil {
+		return cpus
+	}
+	cpuset := t.cpusetMask.Copy()
+	cpuset.And(cpus)
+	if cpuset.NumCPUs() == 0 {
+		return cpus
 	}
+	return cpuset
+}
 
-	t.tg.pidns.owner.mu.RLock()
-	rootTID := t.tg.pidns.owner.Root.tids[t]
-	t.tg.pidns.owner.mu.RUnlock()
+// enterCPUSetLocked restricts t to the CPUs allowed by c, a cgroup t is
+// entering, if c restricts them. t keeps the CPUs of its mask that c allows,
+// such that children inherit the affinity of their parent; its mask becomes
+// all CPUs c allows if none are.
+//
+// +checklocks:t.mu
+func (t *Task) enterCPUSetLocked(c Cgroup) {
+	cpus := c.CPUSet()
+	if cpus == nil {
+		return
+	}
+	mask := t.allowedCPUMask.Copy()
+	mask.And(cpus)
+	if mask.NumCPUs() == 0 {
+		mask = cpus.Copy()
+	}
+	t.setCPUSetLocked(cpus, mask)
+}
 
+// SetCPUSet changes the CPUs t's cpuset allows to cpus, as t migrated to
+// another cpuset cgroup or the CPUs of its cgroup changed. Like
+// kernel/cgroup/cpuset.c:update_tasks_cpumask, the mask of t is reset to
+// cpus. It takes ownership of cpus.
+//
+// Preconditions: cpus.Size() ==
+// sched.CPUSetSize(t.Kernel().ApplicationCores()).
+func (t *Task) SetCPUSet(cpus sched.CPUSet) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	t.setCPUSetLocked(cpus, cpus.Copy())
+}
+
+// +checklocks:t.mu
+func (t *Task) setCPUSetLocked(cpus, mask sched.CPUSet) {
+	if want := sched.CPUSetSize(t.k.applicationCores); cpus.Size() != want {
+		panic(fmt.Sprintf("Invalid CPUSet %v (expected %d bytes)", cpus, want))
+	}
+	if cpus.NumCPUs() == 0 {
+		// Tasks can't run in a cpuset without CPUs; Linux prevents them
+		// from entering it. Keep the current restrictions of t instead.
+		return
+	}
+	t.cpusetMask = cpus
+	mask.ClearAbove(t.k.OnlineCores())
+	if mask.NumCPUs() == 0 {
+		// None of the CPUs of the cpuset are online.
+		mask = t.k.OnlineCPUs()
+	}
+	t.setAllowedCPUMaskLocked(mask)
+	// The TID of t can't be read without locking the TaskSet, which callers
+	// may hold. Keep t on its CPU if possible, and otherwise use the CPU
+	// number to spread tasks over the allowed CPUs.
+	if cpu := t.cpu.Load(); !mask.IsSet(uint(cpu)) {
+		t.cpu.Store(assignCPU(mask, ThreadID(cpu)))
+	}
+}
+
+// setAllowedCPUMaskLocked sets t's allowed CPU mask to mask, and makes the
+// task goroutine bind its host thread to it before it runs application code
+// again.
+//
+// +checklocks:t.mu
+func (t *Task) setAllowedCPUMaskLocked(mask sched.CPUSet) {
 	t.allowedCPUMask = mask
-	t.cpu.Store(assignCPU(mask, rootTID))
-	return nil
+	t.hostCPUsBound.Store(false)
+}
+
+// hostCPUSet returns the host CPUs that tasks allowed to run on the CPUs in
+// mask are bound to, see Platform.HostCPUs. With host CPU numbers, these are
+// the same CPUs; otherwise, CPUs are mapped to host CPUs in a round-robin
+// fashion. It returns false if tasks don't need to be bound: if mask allows
+// all online CPUs or all host CPUs, or if the platform doesn't support it.
+// The returned set then holds all host CPUs.
+func (k *Kernel) hostCPUSet(mask sched.CPUSet) (unix.CPUSet, bool) {
+	var set unix.CPUSet
+	hostCPUs := k.Platform.HostCPUs()
+	if len(hostCPUs) == 0 {
+		return set, false
+	}
+	online := k.OnlineCPUs()
+	online.And(mask)
+	if online.NumCPUs() < k.OnlineCores() {
+		if k.useHostCores {
+			for _, cpu := range hostCPUs {
+				if mask.IsSet(cpu) {
+					set.Set(int(cpu))
+				}
+			}
+		} else {
+			mask.ForEachCPU(func(cpu uint) {
+				set.Set(int(hostCPUs[cpu%uint(len(hostCPUs))]))
+			})
+		}
+		if n := set.Count(); n != 0 && n < len(hostCPUs) {
+			return set, true
+		}
+	}
+	set.Zero()
+	for _, cpu := range hostCPUs {
+		set.Set(int(cpu))
+	}
+	return set, false
+}
+
+// bindHostCPUs binds the host thread of the task goroutine to the host CPUs
+// that t's allowed CPUs map to, such that the application code it executes
+// only runs on them. The task goroutine is locked to the thread while it is
+// bound; it is unlocked once t is allowed to run on all CPUs again. If the
+// task goroutine exits while locked, the Go runtime terminates the thread, so
+// bound threads don't run other goroutines.
+//
+// Preconditions: The caller must be running on the task goroutine.
+func (t *Task) bindHostCPUs() {
+	hostCPUs, bind := t.k.hostCPUSet(t.CPUMask())
+	if !bind && !t.hostThreadLocked {
+		return
+	}
+	if !t.hostThreadLocked {
+		runtime.LockOSThread()
+		t.hostThreadLocked = true
+	}
+	if err := unix.SchedSetaffinity(0, &hostCPUs); err != nil {
+		t.Debugf("Failed to bind to host CPUs %v: %v", hostCPUs, err)
+	}
+	if !bind {
+		runtime.UnlockOSThread()
+		t.hostThreadLocked = false
+	}
 }
 
 // CPU returns the cpu id for a given task.
@@ -635,10 +794,14 @@ func (t *Task) Niceness() int {
 	return t.niceness
 }
 
-// Priority returns t's priority.
+// Priority returns t's priority, as reported by /proc/[pid]/stat.
 func (t *Task) Priority() int {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	if t.schedPolicy.IsRealTime() {
+		// Like kernel/sched/core.c:task_prio.
+		return -1 - int(t.schedPolicy.RTPriority)
+	}
 	return t.niceness + 20
 }
 
@@ -649,6 +812,78 @@ func (t *Task) SetNiceness(n int) {
 	t.niceness = n
 }
 
+// SchedPolicy is the scheduling policy of a task, as set by
+// sched_setscheduler(2).
+//
+// The sentry doesn't schedule tasks itself, so real-time policies are only
+// best-effort: futex waiters with higher real-time priorities are woken
+// first, as in Linux, but tasks are otherwise scheduled like SCHED_NORMAL
+// tasks.
+//
+// +stateify savable
+type SchedPolicy struct {
+	// Policy is linux.SCHED_NORMAL, SCHED_BATCH, SCHED_IDLE, SCHED_FIFO or
+	// SCHED_RR.
+	Policy int32
+
+	// RTPriority is the real-time priority, between 1 and
+	// linux.MAX_RT_PRIO-1 for SCHED_FIFO and SCHED_RR and 0 for other
+	// policies.
+	RTPriority int32
+
+	// ResetOnFork is true if children of the task start with SCHED_NORMAL
+	// and non-negative niceness, see linux.SCHED_RESET_ON_FORK.
+	ResetOnFork bool
+}
+
+// IsRealTime returns true if p is SCHED_FIFO or SCHED_RR.
+func (p SchedPolicy) IsRealTime() bool {
+	return p.Policy == linux.SCHED_FIFO || p.Policy == linux.SCHED_RR
+}
+
+// futexRTPriority returns the real-time priority of futex waiters of tasks
+// with policy p.
+func (p SchedPolicy) futexRTPriority() int32 {
+	if p.IsRealTime() {
+		return p.RTPriority
+	}
+	return 0
+}
+
+// forkedSchedLocked returns the scheduling policy and niceness of a child of t,
+// like kernel/sched/core.c:sched_fork.
+//
+// +checklocks:t.mu
+func (t *Task) forkedSchedLocked() (SchedPolicy, int) {
+	p, niceness := t.schedPolicy, t.niceness
+	if !p.ResetOnFork {
+		return p, niceness
+	}
+	if p.IsRealTime() {
+		return SchedPolicy{Policy: linux.SCHED_NORMAL}, 0
+	}
+	if niceness < 0 {
+		niceness = 0
+	}
+	return SchedPolicy{Policy: p.Policy}, niceness
+}
+
+// SchedPolicy returns t's scheduling policy.
+func (t *Task) SchedPolicy() SchedPolicy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.schedPolicy
+}
+
+// SetSchedPolicy sets t's scheduling policy to p. Callers are responsible for
+// validating p and checking permissions.
+func (t *Task) SetSchedPolicy(p SchedPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.schedPolicy = p
+	t.futexWaiter.SetRTPriority(p.futexRTPriority())
+}
+
 // NumaPolicy returns t's current numa policy.
 func (t *Task) NumaPolicy() (policy linux.NumaPolicy, nodeMask uint64) {
 	t.mu.Lock()
@@ -663,3 +898,43 @@ func (t *Task) SetNumaPolicy(policy linux.NumaPolicy, nodeMask uint64) {
 	t.numaPolicy = policy
 	t.numaNodeMask = nodeMask
 }
+
+// onlineCoresChanged updates t's CPU mask after the number of online CPUs
+// changed from old to new. See Kernel.SetOnlineCores.
+//
+// Preconditions: The TaskSet mutex is locked. tid is t's TID in the root PID
+// namespace.
+func (t *Task) onlineCoresChanged(old, new uint, tid ThreadID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// The CPUs t may run on if it isn't restricted further.
+	available := func(online uint) sched.CPUSet {
+		cpus := sched.NewFullCPUSet(t.k.applicationCores)
+		cpus.ClearAbove(online)
+		if t.cpusetMask != nil {
+			cpus.And(t.cpusetMask)
+		}
+		return cpus
+	}
+	oldAvailable := available(old)
+	mask := t.allowedCPUMask.Copy()
+	mask.And(oldAvailable)
+	if mask.NumCPUs() == oldAvailable.NumCPUs() {
+		// t could run on every available CPU, keep it so.
+		mask = available(new)
+	} else {
+		mask.ClearAbove(new)
+	}
+	if mask.NumCPUs() == 0 {
+		mask = available(new)
+	}
+	if mask.NumCPUs() == 0 {
+		// None of the CPUs of the cpuset of t are online.
+		mask = t.k.OnlineCPUs()
+	}
+	t.setAllowedCPUMaskLocked(mask)
+	if !mask.IsSet(uint(t.cpu.Load())) {
+		t.cpu.Store(assignCPU(mask, tid))
+	}
+}
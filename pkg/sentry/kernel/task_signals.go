@@ -204,7 +204,11 @@ func (t *Task) deliverSignal(info *linux.SignalInfo, act linux.SigAction) taskRu
 		t.Debugf("Signal %d, PID: %d, TID: %d, fault addr: %#x: terminating thread group", ucs.Pid, ucs.Tid, ucs.FaultAddr, info.Signo)
 		eventchannel.Emit(ucs)
 
-		t.PrepareGroupExit(linux.WaitStatusTerminationSignal(sig))
+		ws := linux.WaitStatusTerminationSignal(sig)
+		if sigact == SignalActionCore && t.maybeDumpCore(sig, info) {
+			ws = ws.WithCoreDump()
+		}
+		t.PrepareGroupExit(ws)
 		return (*runExit)(nil)
 
 	case SignalActionStop:
@@ -1052,6 +1056,10 @@ func (*runInterrupt) execute(t *Task) taskRunState {
 			return (*runExit)(nil)
 		}
 
+		if t.debugSignalLocked(info) {
+			t.tg.signalHandlers.mu.Unlock()
+			return (*runInterrupt)(nil)
+		}
 		if linux.SignalSetOf(linux.Signal(info.Signo))&StopSignals != 0 {
 			// Indicate that we've dequeued a stop signal before unlocking the
 			// signal mutex; initiateGroupStop will check for races with
@@ -69,6 +69,12 @@ type TaskConfig struct {
 	// Niceness is the niceness of the new task.
 	Niceness int
 
+	// SchedPolicy is the scheduling policy of the new task.
+	SchedPolicy SchedPolicy
+
+	// TimerSlack is the timer slack of the new task, in nanoseconds.
+	TimerSlack int64
+
 	// NetworkNamespace is the network namespace to be used for the new task.
 	NetworkNamespace *inet.Namespace
 
@@ -87,6 +93,11 @@ type TaskConfig struct {
 	// MountNamespace is the MountNamespace of the new task.
 	MountNamespace *vfs.MountNamespace
 
+	// CgroupNamespace is the cgroup namespace of the new task, or nil for the
+	// root cgroup namespace. If not nil, a reference must be held on it, which
+	// is transferred to TaskSet.NewTask whether or not it succeeds.
+	CgroupNamespace *CgroupNamespace
+
 	// RSeqAddr is a pointer to the the userspace linux.RSeq structure.
 	RSeqAddr hostarch.Addr
 
@@ -121,6 +132,9 @@ func (ts *TaskSet) NewTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 		if cfg.MountNamespace != nil {
 			cfg.MountNamespace.DecRef(ctx)
 		}
+		if cfg.CgroupNamespace != nil {
+			cfg.CgroupNamespace.DecRef(ctx)
+		}
 	}
 	if err := cfg.UserCounters.incRLimitNProc(ctx); err != nil {
 		cleanup()
@@ -159,10 +173,12 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 		allowedCPUMask:  cfg.AllowedCPUMask.Copy(),
 		ioUsage:         &usage.IO{},
 		niceness:        cfg.Niceness,
+		schedPolicy:     cfg.SchedPolicy,
 		utsns:           cfg.UTSNamespace,
 		ipcns:           cfg.IPCNamespace,
 		abstractSockets: cfg.AbstractSocketNamespace,
 		mountNamespace:  cfg.MountNamespace,
+		cgroupns:        cfg.CgroupNamespace,
 		rseqCPU:         -1,
 		rseqAddr:        cfg.RSeqAddr,
 		rseqSignature:   cfg.RSeqSignature,
@@ -171,10 +187,13 @@ func (ts *TaskSet) newTask(ctx context.Context, cfg *TaskConfig) (*Task, error)
 		cgroups:         make(map[Cgroup]struct{}),
 		userCounters:    cfg.UserCounters,
 	}
+	t.timerSlack.Store(cfg.TimerSlack)
+	t.defaultTimerSlack = cfg.TimerSlack
 	t.netns.Store(cfg.NetworkNamespace)
 	t.creds.Store(cfg.Credentials)
 	t.endStopCond.L = &t.tg.signalHandlers.mu
 	t.ptraceTracer.Store((*Task)(nil))
+	t.futexWaiter.SetRTPriority(t.schedPolicy.futexRTPriority())
 	// We don't construct t.blockingTimer until Task.run(); see that function
 	// for justification.
 
@@ -331,11 +350,16 @@ func (ns *PIDNamespace) allocateTID() (ThreadID, error) {
 		// terminated." - pid_namespaces(7)
 		return 0, linuxerr.ENOMEM
 	}
-	tid := ns.last
+	maxTID := PIDMax()
+	last := ns.last
+	if last > maxTID {
+		last = maxTID
+	}
+	tid := last
 	for {
 		// Next.
 		tid++
-		if tid > TasksLimit {
+		if tid > maxTID {
 			tid = initTID + 1
 		}
 
@@ -359,7 +383,7 @@ func (ns *PIDNamespace) allocateTID() (ThreadID, error) {
 		}
 
 		// Did we do a full cycle?
-		if tid == ns.last {
+		if tid == last {
 			// No tid available.
 			return 0, linuxerr.EAGAIN
 		}
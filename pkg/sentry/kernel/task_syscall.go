@@ -82,6 +82,7 @@ func (t *Task) invokeExternal() {
 
 func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval uintptr, ctrl *SyscallControl, err error) {
 	s := t.SyscallTable()
+	t.inSyscall, t.syscallNo, t.syscallArgs = true, sysno, args
 
 	fe := s.FeatureEnable.Word(sysno)
 
@@ -202,6 +203,7 @@ func (t *Task) executeSyscall(sysno uintptr, args arch.SyscallArguments) (rval u
 		})
 	}
 
+	t.inSyscall = false
 	return
 }
 
@@ -265,6 +265,26 @@ type ThreadGroup struct {
 	// should look for a child_subreaper process at exit"
 	isChildSubreaper  bool
 	hasChildSubreaper bool
+
+	// reapsOrphans is true if orphaned thread groups reparented to this
+	// thread group are reaped as soon as they exit, without notifying this
+	// thread group. This emulates the init process injected by "docker run
+	// --init" for entrypoints that never wait for adopted children, while
+	// children created by this thread group remain waitable.
+	//
+	// reapsOrphans is immutable after the thread group is created.
+	reapsOrphans bool
+
+	// autoReap is true if this thread group was adopted by a thread group
+	// that reaps orphans.
+	//
+	// autoReap is protected by the TaskSet mutex.
+	autoReap bool
+
+	// debugger is the Debugger attached to this thread group, if any.
+	//
+	// debugger is protected by the signal mutex.
+	debugger *Debugger `state:"nosave"`
 }
 
 // NewThreadGroup returns a new, empty thread group in PID namespace pidns. The
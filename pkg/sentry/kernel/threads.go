@@ -18,6 +18,7 @@ import (
 	"fmt"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
@@ -36,6 +37,29 @@ import (
 // (kernel/fork.c:MAX_THREADS).
 const TasksLimit = (1 << 16)
 
+// PIDMaxLimit is the largest value accepted by SetPIDMax. It's the same as
+// Linux's PID_MAX_LIMIT on 64-bit architectures.
+const PIDMaxLimit = 1 << 22
+
+// pidMax is the largest thread ID allocated in a PID namespace, after which
+// allocation wraps around, like Linux's /proc/sys/kernel/pid_max.
+var pidMax = atomicbitops.FromInt32(TasksLimit)
+
+// PIDMax returns the largest thread ID allocated in a PID namespace.
+func PIDMax() ThreadID {
+	return ThreadID(pidMax.Load())
+}
+
+// SetPIDMax sets the largest thread ID allocated in a PID namespace. Like
+// Linux, it must be greater than 300 and at most PIDMaxLimit.
+func SetPIDMax(tid ThreadID) error {
+	if tid <= 300 || tid > PIDMaxLimit {
+		return linuxerr.EINVAL
+	}
+	pidMax.Store(int32(tid))
+	return nil
+}
+
 // ThreadID is a generic thread identifier.
 //
 // +marshal
@@ -0,0 +1,432 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loader
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+)
+
+const (
+	// binfmtMiscHeaderSize is the size of the file header that binfmt_misc
+	// magic numbers are matched against. This is Linux's BINPRM_BUF_SIZE.
+	binfmtMiscHeaderSize = 256
+
+	// maxBinfmtMiscRegisterLength is the maximum length of a binfmt_misc
+	// registration string. This is Linux's MAX_REGISTER_LENGTH.
+	maxBinfmtMiscRegisterLength = 1920
+)
+
+// BinfmtMiscFlags are the flags of a binfmt_misc entry.
+type BinfmtMiscFlags uint32
+
+const (
+	// BinfmtMiscPreserveArgv0 ('P') passes the original argv[0] to the
+	// interpreter, after the path of the binary.
+	BinfmtMiscPreserveArgv0 BinfmtMiscFlags = 1 << iota
+
+	// BinfmtMiscOpenBinary ('O') asks for the binary to be passed to the
+	// interpreter as an open file, for binaries that the caller can execute
+	// but not read. Since the loader only executes readable files, the
+	// interpreter is always given the path of the binary instead.
+	BinfmtMiscOpenBinary
+
+	// BinfmtMiscCredentials ('C') computes credentials from the binary
+	// rather than the interpreter. It implies BinfmtMiscOpenBinary. Set-user-ID
+	// binaries never change credentials on exec, so this has no other effect.
+	BinfmtMiscCredentials
+
+	// BinfmtMiscFixBinary ('F') opens the interpreter when the entry is
+	// registered rather than when a binary is executed, so that it's found
+	// regardless of the mount namespace and root of the executing process.
+	BinfmtMiscFixBinary
+)
+
+// String returns the flags in the format of binfmt_misc entry files.
+func (f BinfmtMiscFlags) String() string {
+	var b strings.Builder
+	if f&BinfmtMiscPreserveArgv0 != 0 {
+		b.WriteByte('P')
+	}
+	if f&BinfmtMiscOpenBinary != 0 {
+		b.WriteByte('O')
+	}
+	if f&BinfmtMiscCredentials != 0 {
+		b.WriteByte('C')
+	}
+	if f&BinfmtMiscFixBinary != 0 {
+		b.WriteByte('F')
+	}
+	return b.String()
+}
+
+// BinfmtMiscEntry is a binary format registered with binfmt_misc, which runs
+// matching binaries through an interpreter.
+//
+// +stateify savable
+type BinfmtMiscEntry struct {
+	// Name is the name of the entry, which is also the name of its file in
+	// binfmt_misc filesystems. Name is immutable.
+	Name string
+
+	// Extension is the file name extension of matching binaries, without the
+	// leading dot. If Extension is empty, binaries are matched by Magic
+	// instead. Extension is immutable.
+	Extension string
+
+	// Offset is the offset of Magic in matching binaries. Offset is
+	// immutable.
+	Offset int
+
+	// Magic is the magic number of matching binaries, already masked by Mask.
+	// Magic is immutable.
+	Magic []byte
+
+	// Mask is ANDed with the header of binaries before comparing it to Magic.
+	// If Mask is nil, the header is compared as is. Mask is immutable.
+	Mask []byte
+
+	// Interpreter is the path of the interpreter. Interpreter is immutable.
+	Interpreter string
+
+	// Flags are the entry's flags. Flags is immutable.
+	Flags BinfmtMiscFlags
+
+	// enabled is true if the entry is used to run binaries.
+	//
+	// enabled is protected by BinfmtMisc.mu of the registry holding the
+	// entry.
+	enabled bool
+
+	// file is the interpreter, opened at registration if Flags contains
+	// BinfmtMiscFixBinary. The entry holds a reference on file. file is
+	// immutable.
+	file *vfs.FileDescription
+}
+
+// ParseBinfmtMiscEntry parses a binfmt_misc registration string, as written
+// to the register file: ":name:type:offset:magic:mask:interpreter:flags",
+// where the first character is the delimiter of the following fields.
+//
+// If the entry has the BinfmtMiscFixBinary flag, the caller must open the
+// interpreter with SetInterpreterFile before registering it.
+func ParseBinfmtMiscEntry(s string) (*BinfmtMiscEntry, error) {
+	if len(s) < 11 || len(s) > maxBinfmtMiscRegisterLength {
+		return nil, linuxerr.EINVAL
+	}
+	// A single trailing newline is allowed after the flags.
+	s = strings.TrimSuffix(s, "\n")
+	fields := strings.Split(s[1:], s[:1])
+	if len(fields) != 7 {
+		return nil, linuxerr.EINVAL
+	}
+	name, typ, offset, magic, mask, interpreter, flags := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return nil, linuxerr.EINVAL
+	}
+	e := &BinfmtMiscEntry{
+		Name:        name,
+		Interpreter: interpreter,
+		enabled:     true,
+	}
+	switch typ {
+	case "E":
+		// The offset and mask are ignored.
+		if magic == "" || strings.Contains(magic, "/") {
+			return nil, linuxerr.EINVAL
+		}
+		e.Extension = magic
+	case "M":
+		if offset != "" {
+			off, err := strconv.ParseUint(offset, 10, 32)
+			if err != nil {
+				return nil, linuxerr.EINVAL
+			}
+			e.Offset = int(off)
+		}
+		e.Magic = unescapeBinfmtMisc(magic)
+		if len(e.Magic) == 0 || e.Offset+len(e.Magic) > binfmtMiscHeaderSize {
+			return nil, linuxerr.EINVAL
+		}
+		if mask != "" {
+			e.Mask = unescapeBinfmtMisc(mask)
+			if len(e.Mask) != len(e.Magic) {
+				return nil, linuxerr.EINVAL
+			}
+			for i := range e.Magic {
+				e.Magic[i] &= e.Mask[i]
+			}
+		}
+	default:
+		return nil, linuxerr.EINVAL
+	}
+	if e.Interpreter == "" {
+		return nil, linuxerr.EINVAL
+	}
+	for _, c := range flags {
+		switch c {
+		case 'P':
+			e.Flags |= BinfmtMiscPreserveArgv0
+		case 'O':
+			e.Flags |= BinfmtMiscOpenBinary
+		case 'C':
+			e.Flags |= BinfmtMiscCredentials | BinfmtMiscOpenBinary
+		case 'F':
+			e.Flags |= BinfmtMiscFixBinary
+		default:
+			return nil, linuxerr.EINVAL
+		}
+	}
+	return e, nil
+}
+
+// unescapeBinfmtMisc returns s with "\xHH" escapes replaced by the byte they
+// represent. Other backslashes are left as is, as in Linux's
+// string_unescape(UNESCAPE_HEX).
+func unescapeBinfmtMisc(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+2 >= len(s) || s[i+1] != 'x' || !isHexDigit(s[i+2]) {
+			b = append(b, s[i])
+			continue
+		}
+		// One or two hex digits follow "\x".
+		end := i + 3
+		if end < len(s) && isHexDigit(s[end]) {
+			end++
+		}
+		v, _ := strconv.ParseUint(s[i+2:end], 16, 8)
+		b = append(b, byte(v))
+		i = end - 1
+	}
+	return b
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+// SetInterpreterFile sets the interpreter file of an entry with the
+// BinfmtMiscFixBinary flag. The entry takes ownership of the reference on fd.
+//
+// Preconditions: e has not been registered.
+func (e *BinfmtMiscEntry) SetInterpreterFile(fd *vfs.FileDescription) {
+	e.file = fd
+}
+
+// matches returns true if the binary filename with header hdr matches e.
+//
+// Preconditions: len(hdr) == binfmtMiscHeaderSize.
+func (e *BinfmtMiscEntry) matches(hdr []byte, filename string) bool {
+	if e.Extension != "" {
+		dot := strings.LastIndexByte(filename, '.')
+		return dot >= 0 && filename[dot+1:] == e.Extension
+	}
+	s := hdr[e.Offset : e.Offset+len(e.Magic)]
+	if e.Mask == nil {
+		return bytes.Equal(s, e.Magic)
+	}
+	for i := range s {
+		if s[i]&e.Mask[i] != e.Magic[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// argv returns the arguments of e's interpreter to run the binary filename
+// with arguments argv.
+func (e *BinfmtMiscEntry) argv(filename string, argv []string) []string {
+	newArgv := []string{e.Interpreter, filename}
+	switch {
+	case e.Flags&BinfmtMiscPreserveArgv0 != 0:
+		newArgv = append(newArgv, argv...)
+	case len(argv) > 0:
+		newArgv = append(newArgv, argv[1:]...)
+	}
+	return newArgv
+}
+
+// BinfmtMisc is a registry of binary formats run through interpreters, as
+// configured through binfmt_misc filesystems.
+//
+// +stateify savable
+type BinfmtMisc struct {
+	mu sync.Mutex `state:"nosave"`
+
+	// disabled is true if no entries are used to run binaries. The zero
+	// value of BinfmtMisc is enabled, as in Linux.
+	//
+	// +checklocks:mu
+	disabled bool
+
+	// entries are the registered entries, most recently registered first,
+	// which is the order in which they are matched.
+	//
+	// +checklocks:mu
+	entries []*BinfmtMiscEntry
+}
+
+// Enabled returns true if b is used to run binaries.
+func (b *BinfmtMisc) Enabled() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.disabled
+}
+
+// SetEnabled enables or disables b.
+func (b *BinfmtMisc) SetEnabled(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.disabled = !enabled
+}
+
+// Register adds e to b. On success, b takes ownership of e.
+func (b *BinfmtMisc) Register(e *BinfmtMiscEntry) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, other := range b.entries {
+		if other.Name == e.Name {
+			return linuxerr.EEXIST
+		}
+	}
+	b.entries = append([]*BinfmtMiscEntry{e}, b.entries...)
+	return nil
+}
+
+// Lookup returns the entry with the given name, or nil if there is none.
+func (b *BinfmtMisc) Lookup(name string) *BinfmtMiscEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range b.entries {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// Registered returns true if e is registered in b.
+func (b *BinfmtMisc) Registered(e *BinfmtMiscEntry) bool {
+	return b.Lookup(e.Name) == e
+}
+
+// Names returns the names of all entries, in registration order.
+func (b *BinfmtMisc) Names() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	names := make([]string, len(b.entries))
+	for i, e := range b.entries {
+		names[len(names)-1-i] = e.Name
+	}
+	return names
+}
+
+// Remove removes e from b. It has no effect if e is not registered.
+func (b *BinfmtMisc) Remove(ctx context.Context, e *BinfmtMiscEntry) {
+	b.mu.Lock()
+	for i, other := range b.entries {
+		if other == e {
+			b.entries = append(b.entries[:i], b.entries[i+1:]...)
+			b.mu.Unlock()
+			e.Release(ctx)
+			return
+		}
+	}
+	b.mu.Unlock()
+}
+
+// RemoveAll removes all entries from b.
+func (b *BinfmtMisc) RemoveAll(ctx context.Context) {
+	b.mu.Lock()
+	entries := b.entries
+	b.entries = nil
+	b.mu.Unlock()
+	for _, e := range entries {
+		e.Release(ctx)
+	}
+}
+
+// SetEntryEnabled enables or disables e.
+func (b *BinfmtMisc) SetEntryEnabled(e *BinfmtMiscEntry, enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.enabled = enabled
+}
+
+// EntryStatus returns the contents of the binfmt_misc file of e, in the
+// format of Linux's fs/binfmt_misc.c:entry_status().
+func (b *BinfmtMisc) EntryStatus(e *BinfmtMiscEntry) string {
+	b.mu.Lock()
+	enabled := e.enabled
+	b.mu.Unlock()
+	if !enabled {
+		return "disabled\n"
+	}
+	var s strings.Builder
+	fmt.Fprintf(&s, "enabled\ninterpreter %s\nflags: %s\n", e.Interpreter, e.Flags)
+	if e.Extension != "" {
+		fmt.Fprintf(&s, "extension .%s\n", e.Extension)
+		return s.String()
+	}
+	fmt.Fprintf(&s, "offset %d\nmagic %s\n", e.Offset, hex.EncodeToString(e.Magic))
+	if e.Mask != nil {
+		fmt.Fprintf(&s, "mask %s\n", hex.EncodeToString(e.Mask))
+	}
+	return s.String()
+}
+
+// match returns the entry that runs the binary filename with header hdr, or
+// nil if there is none. If the entry has an interpreter file, match returns
+// it with an extra reference.
+//
+// Preconditions: len(hdr) == binfmtMiscHeaderSize.
+func (b *BinfmtMisc) match(hdr []byte, filename string) (*BinfmtMiscEntry, *vfs.FileDescription) {
+	if b == nil {
+		return nil, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.disabled {
+		return nil, nil
+	}
+	for _, e := range b.entries {
+		if e.enabled && e.matches(hdr, filename) {
+			if e.file != nil {
+				e.file.IncRef()
+			}
+			return e, e.file
+		}
+	}
+	return nil, nil
+}
+
+// Release releases the resources held by e. It must only be called for
+// entries that failed to register; registered entries are released when
+// removed.
+func (e *BinfmtMiscEntry) Release(ctx context.Context) {
+	if e.file != nil {
+		e.file.DecRef(ctx)
+	}
+}
@@ -17,8 +17,10 @@ package loader
 import (
 	"bytes"
 	"debug/elf"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"math/bits"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi"
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
@@ -40,8 +42,16 @@ const (
 	elfMagic = "\x7fELF"
 
 	// maxTotalPhdrSize is the maximum combined size of all program
-	// headers.  Linux limits this to one page.
-	maxTotalPhdrSize = hostarch.PageSize
+	// headers. Linux limits this to 64 KiB.
+	maxTotalPhdrSize = 64 << 10
+
+	// maxGNUPropertySize is the maximum size of a PT_GNU_PROPERTY segment.
+	// Linux limits this to 1 KiB.
+	maxGNUPropertySize = 1 << 10
+
+	// gnuPropertyAlign is the alignment of the note descriptor and of each
+	// property in a PT_GNU_PROPERTY segment of a 64-bit ELF.
+	gnuPropertyAlign = 8
 )
 
 var (
@@ -383,6 +393,10 @@ type loadedELF struct {
 	// phdrNum is the number of program headers.
 	phdrNum int
 
+	// gnuProperty is the PT_GNU_PROPERTY program header, or nil if there is
+	// none.
+	gnuProperty *elf.ProgHeader
+
 	// auxv contains a subset of ELF-specific auxiliary vector entries:
 	//	* AT_PHDR
 	//	* AT_PHENT
@@ -392,6 +406,24 @@ type loadedELF struct {
 	auxv arch.Auxv
 }
 
+// isHostELF returns true if hdr is the beginning of an ELF binary for the
+// host architecture.
+func isHostELF(hdr []byte) bool {
+	if len(hdr) < header64Size || !bytes.HasPrefix(hdr, []byte(elfMagic)) || elf.Class(hdr[elf.EI_CLASS]) != elf.ELFCLASS64 {
+		return false
+	}
+	var h linux.ElfHeader64
+	h.UnmarshalUnsafe(hdr[:header64Size])
+	switch arch.Host {
+	case arch.AMD64:
+		return elf.Machine(h.Machine) == elf.EM_X86_64
+	case arch.ARM64:
+		return elf.Machine(h.Machine) == elf.EM_AARCH64
+	default:
+		return false
+	}
+}
+
 // loadParsedELF loads f into mm.
 //
 // info is the parsed elfInfo from the header.
@@ -403,7 +435,8 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 	first := true
 	var start, end hostarch.Addr
 	var interpreter string
-	for _, phdr := range info.phdrs {
+	var gnuProperty *elf.ProgHeader
+	for i, phdr := range info.phdrs {
 		switch phdr.Type {
 		case elf.PT_LOAD:
 			vaddr := hostarch.Addr(phdr.Vaddr)
@@ -471,6 +504,10 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 				ctx.Infof("PT_INTERP path is empty: %v", path)
 				return loadedELF{}, linuxerr.EACCES
 			}
+
+		case elf.PT_GNU_PROPERTY:
+			// Like Linux, use the last PT_GNU_PROPERTY header.
+			gnuProperty = &info.phdrs[i]
 		}
 	}
 
@@ -493,9 +530,19 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 			return loadedELF{}, linuxerr.ENOEXEC
 		}
 
+		// Segments may require a load address aligned beyond the page size,
+		// e.g. to be backed by huge pages. Reserve enough extra space to
+		// align the load address within the region.
+		align := maxLoadAlignment(info.phdrs)
+		reserveSize, ok := totalSize.AddLength(uint64(align - hostarch.PageSize))
+		if !ok {
+			ctx.Infof("ELF PT_LOAD segments too big for alignment %#x", align)
+			return loadedELF{}, linuxerr.ENOEXEC
+		}
+
 		var err error
 		offset, err = m.MMap(ctx, memmap.MMapOpts{
-			Length:  uint64(totalSize),
+			Length:  uint64(reserveSize),
 			Addr:    sharedLoadOffset,
 			Private: true,
 		})
@@ -503,9 +550,12 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 			ctx.Infof("Error allocating address space for shared object: %v", err)
 			return loadedELF{}, err
 		}
-		if err := m.MUnmap(ctx, offset, uint64(totalSize)); err != nil {
+		if err := m.MUnmap(ctx, offset, uint64(reserveSize)); err != nil {
 			panic(fmt.Sprintf("Failed to unmap base address: %v", err))
 		}
+		// This can't overflow, since the aligned address is within the
+		// reserved region.
+		offset = (offset + align - 1) &^ (align - 1)
 
 		start, ok = start.AddLength(uint64(offset))
 		if !ok {
@@ -562,9 +612,106 @@ func loadParsedELF(ctx context.Context, m *mm.MemoryManager, fd *vfs.FileDescrip
 		phdrAddr:    phdrAddr,
 		phdrSize:    info.phdrSize,
 		phdrNum:     len(info.phdrs),
+		gnuProperty: gnuProperty,
 	}, nil
 }
 
+// maxLoadAlignment returns the largest power-of-2 alignment of the PT_LOAD
+// segments in phdrs, which is at least hostarch.PageSize.
+func maxLoadAlignment(phdrs []elf.ProgHeader) hostarch.Addr {
+	align := uint64(hostarch.PageSize)
+	for _, phdr := range phdrs {
+		if phdr.Type == elf.PT_LOAD && bits.OnesCount64(phdr.Align) == 1 && phdr.Align > align {
+			align = phdr.Align
+		}
+	}
+	return hostarch.Addr(align)
+}
+
+// parseGNUProperties parses the program properties in the PT_GNU_PROPERTY
+// segment phdr of the ELF file fd, and returns the AArch64 features it
+// requires, as a bitmask of linux.GNU_PROPERTY_AARCH64_FEATURE_1_* flags.
+//
+// This mirrors Linux's fs/binfmt_elf.c:parse_elf_properties(), which is only
+// used on architectures that handle properties, so properties are only
+// parsed for arm64 ELFs.
+func parseGNUProperties(ctx context.Context, fd fullReader, a arch.Arch, phdr *elf.ProgHeader) (uint32, error) {
+	if phdr == nil || a != arch.ARM64 {
+		return 0, nil
+	}
+	if phdr.Filesz > maxGNUPropertySize {
+		ctx.Infof("PT_GNU_PROPERTY too big: %d", phdr.Filesz)
+		return 0, linuxerr.ENOEXEC
+	}
+	if int64(phdr.Off) < 0 || int64(phdr.Off+phdr.Filesz) < 0 {
+		ctx.Infof("Unsupported PT_GNU_PROPERTY offset %d", phdr.Off)
+		return 0, linuxerr.ENOEXEC
+	}
+	note := make([]byte, phdr.Filesz)
+	n, err := fd.ReadFull(ctx, usermem.BytesIOSequence(note), int64(phdr.Off))
+	note = note[:n]
+
+	// The note is an Elf64_Nhdr (namesz, descsz, type), followed by the
+	// name "GNU" and the properties.
+	const (
+		nhdrSize = 12
+		name     = "GNU\x00"
+	)
+	if len(note) < nhdrSize+len(name) {
+		ctx.Infof("Error reading PT_GNU_PROPERTY: %v", err)
+		return 0, linuxerr.EIO
+	}
+	namesz := binary.LittleEndian.Uint32(note[0:])
+	descsz := binary.LittleEndian.Uint32(note[4:])
+	if typ := binary.LittleEndian.Uint32(note[8:]); typ != linux.NT_GNU_PROPERTY_TYPE_0 || namesz != uint32(len(name)) || string(note[nhdrSize:nhdrSize+len(name)]) != name {
+		ctx.Infof("Invalid PT_GNU_PROPERTY note header")
+		return 0, linuxerr.ENOEXEC
+	}
+	off := uint64(nhdrSize + len(name)) // Already aligned to gnuPropertyAlign.
+	if uint64(descsz) > uint64(len(note))-off {
+		ctx.Infof("PT_GNU_PROPERTY descriptor size %d too big", descsz)
+		return 0, linuxerr.ENOEXEC
+	}
+	data := note[:off+uint64(descsz)]
+
+	// Each property is a type and a data size, followed by the data padded
+	// to gnuPropertyAlign. Properties are unique and sorted by type.
+	var features uint32
+	var prevType uint32
+	for first := true; off < uint64(len(data)); first = false {
+		if uint64(len(data))-off < 8 {
+			ctx.Infof("Truncated PT_GNU_PROPERTY property at %d", off)
+			return 0, linuxerr.ENOEXEC
+		}
+		prType := binary.LittleEndian.Uint32(data[off:])
+		prDatasz := uint64(binary.LittleEndian.Uint32(data[off+4:]))
+		off += 8
+		if prDatasz > uint64(len(data))-off {
+			ctx.Infof("PT_GNU_PROPERTY property %#x size %d too big", prType, prDatasz)
+			return 0, linuxerr.ENOEXEC
+		}
+		if !first && prType <= prevType {
+			ctx.Infof("PT_GNU_PROPERTY property %#x out of order", prType)
+			return 0, linuxerr.ENOEXEC
+		}
+		prevType = prType
+		if prType == linux.GNU_PROPERTY_AARCH64_FEATURE_1_AND {
+			if prDatasz != 4 {
+				ctx.Infof("Invalid GNU_PROPERTY_AARCH64_FEATURE_1_AND size %d", prDatasz)
+				return 0, linuxerr.ENOEXEC
+			}
+			features = binary.LittleEndian.Uint32(data[off:])
+		}
+		step := (prDatasz + gnuPropertyAlign - 1) &^ (gnuPropertyAlign - 1)
+		if step > uint64(len(data))-off {
+			ctx.Infof("PT_GNU_PROPERTY property %#x padding truncated", prType)
+			return 0, linuxerr.ENOEXEC
+		}
+		off += step
+	}
+	return features, nil
+}
+
 // loadInitialELF loads f into mm.
 //
 // It creates an arch.Context64 for the ELF and prepares the mm for this arch.
@@ -649,6 +796,7 @@ func loadELF(ctx context.Context, args LoadArgs) (loadedELF, *arch.Context64, er
 	}
 
 	var interp loadedELF
+	var features uint32
 	if bin.interpreter != "" {
 		// Even if we do not allow the final link of the script to be
 		// resolved, the interpreter should still be resolved if it is
@@ -675,6 +823,20 @@ func loadELF(ctx context.Context, args LoadArgs) (loadedELF, *arch.Context64, er
 			ctx.Infof("Interpreter requires an interpreter")
 			return loadedELF{}, nil, linuxerr.ENOEXEC
 		}
+
+		// Like Linux, only check the properties of the ELF that starts
+		// running: the interpreter if there is one, or the binary itself.
+		features, err = parseGNUProperties(ctx, intFile, interp.arch, interp.gnuProperty)
+	} else {
+		features, err = parseGNUProperties(ctx, args.File, bin.arch, bin.gnuProperty)
+	}
+	if err != nil {
+		return loadedELF{}, nil, err
+	}
+	if features&linux.GNU_PROPERTY_AARCH64_FEATURE_1_BTI != 0 {
+		// The BTI landing pads are NOPs when not enforced, so the program runs
+		// normally, but without branch target protection.
+		ctx.Debugf("ELF requests Branch Target Identification, which is not supported")
 	}
 
 	// ELF-specific auxv entries.
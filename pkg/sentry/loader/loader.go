@@ -86,6 +86,11 @@ type LoadArgs struct {
 
 	// Features specifies the CPU feature set for the executable.
 	Features cpuid.FeatureSet
+
+	// BinfmtMisc is the registry of binary formats to run through
+	// interpreters. If BinfmtMisc is nil, only ELF binaries and interpreter
+	// scripts can be loaded.
+	BinfmtMisc *BinfmtMisc
 }
 
 // openPath opens args.Filename and checks that it is valid for loading.
@@ -165,7 +170,8 @@ const (
 // If nil, the path args.Filename is resolved and loaded (check that the user
 // can execute this file is done here in this case). If the executable is an
 // interpreter script rather than an ELF, the binary of the corresponding
-// interpreter will be loaded.
+// interpreter will be loaded. Likewise, binaries of other formats registered
+// in args.BinfmtMisc are run through their interpreter.
 //
 // It returns:
 //   - loadedELF, description of the loaded binary
@@ -189,10 +195,12 @@ func loadExecutable(ctx context.Context, args LoadArgs) (loadedELF, *arch.Contex
 			}
 		}
 
-		// Check the header. Is this an ELF or interpreter script?
-		var hdr [4]uint8
+		// Check the header. Is this an ELF or interpreter script? Read as
+		// much of it as binfmt_misc may match; bytes past the end of the file
+		// are zero.
+		hdr := make([]byte, binfmtMiscHeaderSize)
 		// N.B. We assume that reading from a regular file cannot block.
-		_, err := args.File.ReadFull(ctx, usermem.BytesIOSequence(hdr[:]), 0)
+		_, err := args.File.ReadFull(ctx, usermem.BytesIOSequence(hdr), 0)
 		// Allow unexpected EOF, as a valid executable could be only three bytes
 		// (e.g., #!a).
 		if err != nil && err != io.ErrUnexpectedEOF {
@@ -202,8 +210,17 @@ func loadExecutable(ctx context.Context, args LoadArgs) (loadedELF, *arch.Contex
 			return loadedELF{}, nil, nil, nil, err
 		}
 
+		// As in Linux, where binfmt_elf and binfmt_script are tried before
+		// binfmt_misc, binfmt_misc can only handle ELF binaries for other
+		// architectures, which binfmt_elf rejects.
+		misc, miscFile := args.BinfmtMisc.match(hdr, args.Filename)
+		if miscFile != nil {
+			defer miscFile.DecRef(ctx)
+		}
+
+		var next *vfs.FileDescription
 		switch {
-		case bytes.Equal(hdr[:], []byte(elfMagic)):
+		case bytes.HasPrefix(hdr, []byte(elfMagic)) && (misc == nil || isHostELF(hdr)):
 			loaded, ac, err := loadELF(ctx, args)
 			if err != nil {
 				ctx.Infof("Error loading ELF: %v", err)
@@ -213,7 +230,7 @@ func loadExecutable(ctx context.Context, args LoadArgs) (loadedELF, *arch.Contex
 			args.File.IncRef()
 			return loaded, ac, args.File, args.Argv, err
 
-		case bytes.Equal(hdr[:2], []byte(interpreterScriptMagic)):
+		case bytes.HasPrefix(hdr, []byte(interpreterScriptMagic)):
 			if args.CloseOnExec {
 				return loadedELF{}, nil, nil, nil, linuxerr.ENOENT
 			}
@@ -225,12 +242,25 @@ func loadExecutable(ctx context.Context, args LoadArgs) (loadedELF, *arch.Contex
 			// Refresh the traversal limit for the interpreter.
 			*args.RemainingTraversals = linux.MaxSymlinkTraversals
 
+		case misc != nil:
+			if args.CloseOnExec {
+				return loadedELF{}, nil, nil, nil, linuxerr.ENOENT
+			}
+			ctx.Debugf("Running %s through binfmt_misc %s interpreter %s", args.Filename, misc.Name, misc.Interpreter)
+			args.Argv = misc.argv(args.Filename, args.Argv)
+			args.Filename = misc.Interpreter
+			// The interpreter may have been opened at registration.
+			next = miscFile
+			// Refresh the traversal limit for the interpreter.
+			*args.RemainingTraversals = linux.MaxSymlinkTraversals
+
 		default:
-			ctx.Infof("Unknown magic: %v", hdr)
+			ctx.Infof("Unknown magic: %v", hdr[:4])
 			return loadedELF{}, nil, nil, nil, linuxerr.ENOEXEC
 		}
-		// Set to nil in case we loop on a Interpreter Script.
-		args.File = nil
+		// Reset in case we loop on an interpreter script or binfmt_misc
+		// interpreter.
+		args.File = next
 	}
 
 	return loadedELF{}, nil, nil, nil, linuxerr.ELOOP
@@ -6,6 +6,83 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/state"
 )
 
+func (e *BinfmtMiscEntry) StateTypeName() string {
+	return "pkg/sentry/loader.BinfmtMiscEntry"
+}
+
+func (e *BinfmtMiscEntry) StateFields() []string {
+	return []string{
+		"Name",
+		"Extension",
+		"Offset",
+		"Magic",
+		"Mask",
+		"Interpreter",
+		"Flags",
+		"enabled",
+		"file",
+	}
+}
+
+func (e *BinfmtMiscEntry) beforeSave() {}
+
+// +checklocksignore
+func (e *BinfmtMiscEntry) StateSave(stateSinkObject state.Sink) {
+	e.beforeSave()
+	stateSinkObject.Save(0, &e.Name)
+	stateSinkObject.Save(1, &e.Extension)
+	stateSinkObject.Save(2, &e.Offset)
+	stateSinkObject.Save(3, &e.Magic)
+	stateSinkObject.Save(4, &e.Mask)
+	stateSinkObject.Save(5, &e.Interpreter)
+	stateSinkObject.Save(6, &e.Flags)
+	stateSinkObject.Save(7, &e.enabled)
+	stateSinkObject.Save(8, &e.file)
+}
+
+func (e *BinfmtMiscEntry) afterLoad() {}
+
+// +checklocksignore
+func (e *BinfmtMiscEntry) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &e.Name)
+	stateSourceObject.Load(1, &e.Extension)
+	stateSourceObject.Load(2, &e.Offset)
+	stateSourceObject.Load(3, &e.Magic)
+	stateSourceObject.Load(4, &e.Mask)
+	stateSourceObject.Load(5, &e.Interpreter)
+	stateSourceObject.Load(6, &e.Flags)
+	stateSourceObject.Load(7, &e.enabled)
+	stateSourceObject.Load(8, &e.file)
+}
+
+func (b *BinfmtMisc) StateTypeName() string {
+	return "pkg/sentry/loader.BinfmtMisc"
+}
+
+func (b *BinfmtMisc) StateFields() []string {
+	return []string{
+		"disabled",
+		"entries",
+	}
+}
+
+func (b *BinfmtMisc) beforeSave() {}
+
+// +checklocksignore
+func (b *BinfmtMisc) StateSave(stateSinkObject state.Sink) {
+	b.beforeSave()
+	stateSinkObject.Save(0, &b.disabled)
+	stateSinkObject.Save(1, &b.entries)
+}
+
+func (b *BinfmtMisc) afterLoad() {}
+
+// +checklocksignore
+func (b *BinfmtMisc) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &b.disabled)
+	stateSourceObject.Load(1, &b.entries)
+}
+
 func (v *VDSO) StateTypeName() string {
 	return "pkg/sentry/loader.VDSO"
 }
@@ -92,6 +169,8 @@ func (e *elfProgHeader) StateLoad(stateSourceObject state.Source) {
 }
 
 func init() {
+	state.Register((*BinfmtMiscEntry)(nil))
+	state.Register((*BinfmtMisc)(nil))
 	state.Register((*VDSO)(nil))
 	state.Register((*elfProgHeader)(nil))
 }
@@ -100,6 +100,20 @@ type Mappable interface {
 	InvalidateUnsavable(ctx context.Context) error
 }
 
+// MappableAdvisor is an optional interface implemented by Mappables that act
+// on the access pattern advised by madvise(2).
+type MappableAdvisor interface {
+	// Advise notifies the Mappable that offsets in mr are expected to be
+	// accessed according to advice, which is one of linux.POSIX_FADV_NORMAL,
+	// POSIX_FADV_RANDOM, POSIX_FADV_SEQUENTIAL or POSIX_FADV_WILLNEED. Like
+	// posix_fadvise(2), the advice applies to the whole Mappable, except for
+	// POSIX_FADV_WILLNEED.
+	//
+	// Preconditions: The caller must hold a reference on the Mappable, e.g.
+	// through a mapping of mr.
+	Advise(ctx context.Context, mr MappableRange, advice int32)
+}
+
 // Translations are returned by Mappable.Translate.
 type Translation struct {
 	// Source is the translated range in the Mappable.
@@ -201,6 +215,18 @@ func (b *BusError) Error() string {
 	return fmt.Sprintf("BusError: %v", b.Err.Error())
 }
 
+// ExternalTruncateHandler is an optional interface implemented by Mappables
+// whose Translations may be host mappings of files that can be truncated
+// outside of the sandbox. Application accesses to such mappings beyond the
+// host file's new EOF fault on the host, even though their Translations are
+// still valid as far as the sentry knows.
+type ExternalTruncateHandler interface {
+	// HandleExternalTruncate is called after an application access to the
+	// Mappable at offset off failed because the host file backing it was
+	// truncated.
+	HandleExternalTruncate(ctx context.Context, off uint64)
+}
+
 // MappableRange represents a range of uint64 offsets into a Mappable.
 //
 // type MappableRange <generated using go_generics>
@@ -97,6 +97,7 @@ func (mm *MemoryManager) Fork(ctx context.Context) (*MemoryManager, error) {
 		sleepForActivation: mm.sleepForActivation,
 		vdsoSigReturnAddr:  mm.vdsoSigReturnAddr,
 	}
+	mm2.mdwe.Store(mm.inheritMDWE())
 
 	// Copy vmas.
 	dontforks := false
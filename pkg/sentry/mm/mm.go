@@ -249,6 +249,11 @@ type MemoryManager struct {
 	// membarrierRSeqEnabled is non-zero if EnableMembarrierRSeq has previously
 	// been called.
 	membarrierRSeqEnabled atomicbitops.Uint32
+
+	// mdwe is the memory-deny-write-execute policy set by
+	// prctl(PR_SET_MDWE), a bitmask of linux.PR_MDWE_* flags. Once set, flags
+	// can't be cleared.
+	mdwe atomicbitops.Uint32
 }
 
 // vma represents a virtual memory area.
@@ -298,6 +303,10 @@ type vma struct {
 	// metag, none of which we currently support.
 	growsDown bool `state:"manual"`
 
+	// sealed is true if the mapping was sealed by mseal(2), such that it may
+	// no longer be unmapped, moved, resized, or have its permissions changed.
+	sealed bool `state:"manual"`
+
 	// dontfork is the MADV_DONTFORK setting for this vma configured by madvise().
 	dontfork bool
 
@@ -337,6 +346,7 @@ const (
 	vmaMaxPermsExecute
 	vmaPrivate
 	vmaGrowsDown
+	vmaSealed
 )
 
 func (v *vma) saveRealPerms() int {
@@ -374,6 +384,9 @@ func (v *vma) saveRealPerms() int {
 	if v.growsDown {
 		b |= vmaGrowsDown
 	}
+	if v.sealed {
+		b |= vmaSealed
+	}
 	return b
 }
 
@@ -411,6 +424,9 @@ func (v *vma) loadRealPerms(b int) {
 	if b&vmaGrowsDown > 0 {
 		v.growsDown = true
 	}
+	if b&vmaSealed > 0 {
+		v.sealed = true
+	}
 }
 
 func (v *vma) copy() vma {
@@ -422,6 +438,7 @@ func (v *vma) copy() vma {
 		maxPerms:       v.maxPerms,
 		private:        v.private,
 		growsDown:      v.growsDown,
+		sealed:         v.sealed,
 		dontfork:       v.dontfork,
 		mlockMode:      v.mlockMode,
 		numaPolicy:     v.numaPolicy,
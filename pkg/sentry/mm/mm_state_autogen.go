@@ -337,6 +337,7 @@ func (mm *MemoryManager) StateFields() []string {
 		"vdsoSigReturnAddr",
 		"membarrierPrivateEnabled",
 		"membarrierRSeqEnabled",
+		"mdwe",
 	}
 }
 
@@ -373,6 +374,7 @@ func (mm *MemoryManager) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(21, &mm.vdsoSigReturnAddr)
 	stateSinkObject.Save(22, &mm.membarrierPrivateEnabled)
 	stateSinkObject.Save(23, &mm.membarrierRSeqEnabled)
+	stateSinkObject.Save(24, &mm.mdwe)
 }
 
 // +checklocksignore
@@ -401,6 +403,7 @@ func (mm *MemoryManager) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(21, &mm.vdsoSigReturnAddr)
 	stateSourceObject.Load(22, &mm.membarrierPrivateEnabled)
 	stateSourceObject.Load(23, &mm.membarrierRSeqEnabled)
+	stateSourceObject.Load(24, &mm.mdwe)
 	stateSourceObject.AfterLoad(mm.afterLoad)
 }
 
@@ -70,6 +70,32 @@ func (mm *MemoryManager) HandleUserFault(ctx context.Context, addr hostarch.Addr
 	return err
 }
 
+// HandleExternalTruncate handles an application page fault at addr that
+// HandleUserFault couldn't resolve because the host file backing the faulting
+// page was truncated outside of the sandbox. It returns the application-visible
+// name of the mapped file and the offset of addr into it; ok is false if addr
+// isn't in a file mapping.
+func (mm *MemoryManager) HandleExternalTruncate(ctx context.Context, addr hostarch.Addr) (name string, off uint64, ok bool) {
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	vseg := mm.vmas.FindSegment(addr)
+	if !vseg.Ok() {
+		return "", 0, false
+	}
+	vma := vseg.ValuePtr()
+	if vma.mappable == nil {
+		return "", 0, false
+	}
+	off = vseg.mappableOffsetAt(addr)
+	if vma.id != nil {
+		name = vma.id.MappedName(ctx)
+	}
+	if h, ok := vma.mappable.(memmap.ExternalTruncateHandler); ok {
+		h.HandleExternalTruncate(ctx, off)
+	}
+	return name, off, true
+}
+
 // MMap establishes a memory mapping.
 func (mm *MemoryManager) MMap(ctx context.Context, opts memmap.MMapOpts) (hostarch.Addr, error) {
 	if opts.Length == 0 {
@@ -112,6 +138,9 @@ func (mm *MemoryManager) MMap(ctx context.Context, opts memmap.MMapOpts) (hostar
 	if opts.GrowsDown && opts.Mappable != nil {
 		return 0, linuxerr.EINVAL
 	}
+	if mm.denyWriteExecute() && opts.Perms.Write && opts.Perms.Execute {
+		return 0, linuxerr.EACCES
+	}
 
 	// Get the new vma.
 	var droppedIDs []memmap.MappingIdentity
@@ -308,6 +337,10 @@ func (mm *MemoryManager) MUnmap(ctx context.Context, addr hostarch.Addr, length
 
 	var droppedIDs []memmap.MappingIdentity
 	mm.mappingMu.Lock()
+	if mm.sealedLocked(ar) {
+		mm.mappingMu.Unlock()
+		return linuxerr.EPERM
+	}
 	_, droppedIDs = mm.unmapLocked(ctx, ar, droppedIDs)
 	mm.mappingMu.Unlock()
 
@@ -377,6 +410,11 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 	mm.mappingMu.Lock()
 	defer mm.mappingMu.Unlock()
 
+	// Sealed mappings can't be moved or resized.
+	if mm.sealedLocked(hostarch.AddrRange{oldAddr, oldEnd}) {
+		return 0, linuxerr.EPERM
+	}
+
 	// All cases require that a vma exists at oldAddr.
 	vseg := mm.vmas.FindSegment(oldAddr)
 	if !vseg.Ok() {
@@ -488,6 +526,9 @@ func (mm *MemoryManager) MRemap(ctx context.Context, oldAddr hostarch.Addr, oldS
 		if (hostarch.AddrRange{oldAddr, oldEnd}).Overlaps(newAR) {
 			return 0, linuxerr.EINVAL
 		}
+		if mm.sealedLocked(newAR) {
+			return 0, linuxerr.EPERM
+		}
 
 		// Check that the new region is valid.
 		_, err := mm.findAvailableLocked(newSize, findAvailableOpts{
@@ -628,9 +669,13 @@ func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms h
 		return linuxerr.ENOMEM
 	}
 	effectivePerms := realPerms.Effective()
+	denyWriteExecute := mm.denyWriteExecute()
 
 	mm.mappingMu.Lock()
 	defer mm.mappingMu.Unlock()
+	if mm.sealedLocked(ar) {
+		return linuxerr.EPERM
+	}
 	// Non-growsDown mprotect requires that all of ar is mapped, and stops at
 	// the first non-empty gap. growsDown mprotect requires that the first vma
 	// be growsDown, but does not require it to extend all the way to ar.Start;
@@ -670,6 +715,11 @@ func (mm *MemoryManager) MProtect(addr hostarch.Addr, length uint64, realPerms h
 		if !vseg.ValuePtr().maxPerms.SupersetOf(effectivePerms) {
 			return linuxerr.EACCES
 		}
+		// Under MDWE, memory can't become executable unless it already was,
+		// and can never be both writable and executable.
+		if denyWriteExecute && realPerms.Execute && (realPerms.Write || !vseg.ValuePtr().realPerms.Execute) {
+			return linuxerr.EACCES
+		}
 		vseg = mm.vmas.Isolate(vseg, ar)
 
 		// Update vma permissions.
@@ -802,6 +852,11 @@ func (mm *MemoryManager) Brk(ctx context.Context, addr hostarch.Addr) (hostarch.
 		}
 
 	case newbrkpg < oldbrkpg:
+		if mm.sealedLocked(hostarch.AddrRange{newbrkpg, oldbrkpg}) {
+			addr = mm.brk.End
+			mm.mappingMu.Unlock()
+			return addr, linuxerr.EPERM
+		}
 		_, droppedIDs = mm.unmapLocked(ctx, hostarch.AddrRange{newbrkpg, oldbrkpg}, droppedIDs)
 		fallthrough
 
@@ -1083,6 +1138,33 @@ func (mm *MemoryManager) SetDontFork(addr hostarch.Addr, length uint64, dontfork
 	return nil
 }
 
+// Advise passes the access pattern advised for addresses [addr, addr+length)
+// by madvise(2) to the memmap.Mappables mapped there. advice is one of
+// linux.POSIX_FADV_NORMAL, POSIX_FADV_RANDOM, POSIX_FADV_SEQUENTIAL or
+// POSIX_FADV_WILLNEED. Mappables that don't implement memmap.MappableAdvisor,
+// and anonymous mappings, ignore the advice.
+func (mm *MemoryManager) Advise(ctx context.Context, addr hostarch.Addr, length uint64, advice int32) error {
+	ar, ok := addr.ToRange(length)
+	if !ok {
+		return linuxerr.EINVAL
+	}
+
+	mm.mappingMu.RLock()
+	defer mm.mappingMu.RUnlock()
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		a, ok := vseg.ValuePtr().mappable.(memmap.MappableAdvisor)
+		if !ok {
+			continue
+		}
+		a.Advise(ctx, vseg.mappableRangeOf(vseg.Range().Intersect(ar)), advice)
+	}
+
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		return linuxerr.ENOMEM
+	}
+	return nil
+}
+
 // Decommit implements the semantics of Linux's madvise(MADV_DONTNEED).
 func (mm *MemoryManager) Decommit(addr hostarch.Addr, length uint64) error {
 	ar, ok := addr.ToRange(length)
@@ -1092,6 +1174,15 @@ func (mm *MemoryManager) Decommit(addr hostarch.Addr, length uint64) error {
 
 	mm.mappingMu.RLock()
 	defer mm.mappingMu.RUnlock()
+
+	// Discarding sealed read-only anonymous memory would effectively change
+	// its contents, which sealing is meant to prevent.
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		if vma := vseg.ValuePtr(); vma.sealed && vma.mappable == nil && !vma.realPerms.Write {
+			return linuxerr.EPERM
+		}
+	}
+
 	mm.activeMu.Lock()
 	defer mm.activeMu.Unlock()
 
@@ -1321,6 +1412,96 @@ func (mm *MemoryManager) IsMembarrierRSeqEnabled() bool {
 	return mm.membarrierRSeqEnabled.Load() != 0
 }
 
+// MDWE returns mm's memory-deny-write-execute policy, as returned by
+// prctl(PR_GET_MDWE).
+func (mm *MemoryManager) MDWE() uint32 {
+	return mm.mdwe.Load()
+}
+
+// SetMDWE implements the semantics of prctl(PR_SET_MDWE). flags must be a
+// valid combination of linux.PR_MDWE_* flags.
+func (mm *MemoryManager) SetMDWE(flags uint32) error {
+	for {
+		cur := mm.mdwe.Load()
+		// Once set, the policy can't be relaxed.
+		if cur&^flags != 0 {
+			return linuxerr.EPERM
+		}
+		if mm.mdwe.CompareAndSwap(cur, flags) {
+			return nil
+		}
+	}
+}
+
+// denyWriteExecute returns true if mm refuses mappings that are both
+// writable and executable, or that become executable after creation.
+func (mm *MemoryManager) denyWriteExecute() bool {
+	return mm.mdwe.Load()&linux.PR_MDWE_REFUSE_EXEC_GAIN != 0
+}
+
+// inheritMDWE returns the policy inherited from mm by a new MemoryManager
+// created by fork or execve.
+func (mm *MemoryManager) inheritMDWE() uint32 {
+	mdwe := mm.mdwe.Load()
+	if mdwe&linux.PR_MDWE_NO_INHERIT != 0 {
+		return 0
+	}
+	return mdwe
+}
+
+// InheritMDWE copies the memory-deny-write-execute policy of mm to mm2, as
+// for execve.
+//
+// Preconditions: mm2 has no mappings.
+func (mm *MemoryManager) InheritMDWE(mm2 *MemoryManager) {
+	mm2.mdwe.Store(mm.inheritMDWE())
+}
+
+// MSeal implements the semantics of Linux's mseal(2).
+func (mm *MemoryManager) MSeal(addr hostarch.Addr, length uint64) error {
+	if addr.RoundDown() != addr {
+		return linuxerr.EINVAL
+	}
+	if length == 0 {
+		return nil
+	}
+	rlength, ok := hostarch.Addr(length).RoundUp()
+	if !ok {
+		return linuxerr.EINVAL
+	}
+	ar, ok := addr.ToRange(uint64(rlength))
+	if !ok {
+		return linuxerr.EINVAL
+	}
+
+	mm.mappingMu.Lock()
+	defer mm.mappingMu.Unlock()
+	// Like mprotect and mlock, mseal requires that all of ar is mapped, but
+	// unlike them, it leaves the range unchanged if it isn't.
+	if mm.vmas.SpanRange(ar) != ar.Length() {
+		return linuxerr.ENOMEM
+	}
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		vseg = mm.vmas.Isolate(vseg, ar)
+		vseg.ValuePtr().sealed = true
+	}
+	mm.vmas.MergeRange(ar)
+	mm.vmas.MergeAdjacent(ar)
+	return nil
+}
+
+// sealedLocked returns true if any vma overlapping ar is sealed.
+//
+// Preconditions: mm.mappingMu must be locked.
+func (mm *MemoryManager) sealedLocked(ar hostarch.AddrRange) bool {
+	for vseg := mm.vmas.LowerBoundSegment(ar.Start); vseg.Ok() && vseg.Start() < ar.End; vseg = vseg.NextSegment() {
+		if vseg.ValuePtr().sealed {
+			return true
+		}
+	}
+	return false
+}
+
 // FindVMAByName finds a vma with the specified name and returns its start address and offset.
 func (mm *MemoryManager) FindVMAByName(ar hostarch.AddrRange, hint string) (hostarch.Addr, uint64, error) {
 	mm.mappingMu.RLock()
@@ -59,6 +59,11 @@ func (mm *MemoryManager) createVMALocked(ctx context.Context, opts memmap.MMapOp
 	}
 	ar, _ := addr.ToRange(opts.Length)
 
+	// Sealed mappings can't be replaced.
+	if opts.Unmap && mm.sealedLocked(ar) {
+		return vmaIterator{}, hostarch.AddrRange{}, droppedIDs, linuxerr.EPERM
+	}
+
 	// Check against RLIMIT_AS.
 	newUsageAS := mm.usageAS + opts.Length
 	if opts.Unmap {
@@ -465,6 +470,7 @@ func (vmaSetFunctions) Merge(ar1 hostarch.AddrRange, vma1 vma, ar2 hostarch.Addr
 		vma1.maxPerms != vma2.maxPerms ||
 		vma1.private != vma2.private ||
 		vma1.growsDown != vma2.growsDown ||
+		vma1.sealed != vma2.sealed ||
 		vma1.mlockMode != vma2.mlockMode ||
 		vma1.numaPolicy != vma2.numaPolicy ||
 		vma1.numaNodemask != vma2.numaNodemask ||
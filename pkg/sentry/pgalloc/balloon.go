@@ -0,0 +1,73 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"sync/atomic"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/metric"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/usage"
+)
+
+// balloonFile is the MemoryFile whose balloon was last set, if any. The
+// balloon metrics are computed from its usage.
+var balloonFile atomic.Pointer[MemoryFile]
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/memory/balloon_target_bytes", false /* cumulative */, false /* sync */, "Amount of memory the host asked the sandbox to return, in bytes.", func(...*metric.FieldValue) uint64 {
+		return usage.BalloonBytes.Load()
+	})
+	metric.MustRegisterCustomUint64Metric("/memory/balloon_size_bytes", false /* cumulative */, false /* sync */, "Amount of memory returned to the host by the sandbox's balloon, in bytes.", func(...*metric.FieldValue) uint64 {
+		f := balloonFile.Load()
+		if f == nil {
+			return 0
+		}
+		return f.BalloonSize()
+	})
+}
+
+// SetBalloonTarget sets the amount of memory, in bytes, that the sandbox
+// should return to the host. The memory is deducted from the total memory
+// reported to the application as it becomes unused, see usage.BalloonBytes.
+// Growing the target starts evictions, shrinking caches of file data, and
+// freed pages are decommitted by the reclaimer goroutine.
+//
+// The balloon isn't saved; it's empty after restore.
+func (f *MemoryFile) SetBalloonTarget(target uint64) {
+	balloonFile.Store(f)
+	if old := usage.BalloonBytes.Swap(target); target <= old {
+		return
+	}
+	f.mu.Lock()
+	startedAny := f.startEvictionsLocked()
+	f.mu.Unlock()
+	if startedAny {
+		log.Debugf("pgalloc.MemoryFile performing evictions to inflate the balloon to %d bytes", target)
+	}
+}
+
+// BalloonSize returns the amount of memory, in bytes, currently returned to
+// the host by the balloon.
+func (f *MemoryFile) BalloonSize() uint64 {
+	used, err := f.TotalUsage()
+	if err != nil {
+		log.Warningf("Failed to get memory usage: %v", err)
+		return 0
+	}
+	memStats, _ := usage.MemoryAccounting.Copy()
+	used += memStats.Mapped
+	return usage.BalloonSize(f.TotalSize(), used)
+}
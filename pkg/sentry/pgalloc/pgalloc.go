@@ -196,6 +196,13 @@ type MemoryFileOpts struct {
 	// no effect unless DelayedEviction is DelayedEvictionEnabled.
 	UseHostMemcgPressure bool
 
+	// If HostMemoryPressureFile is not nil, it is the cgroup v2
+	// memory.pressure file of the sandbox's cgroup, with a PSI trigger set up
+	// by hostmm.SetPSITrigger. Its notifications are used instead of cgroup
+	// v1 memory pressure levels if UseHostMemcgPressure is true. The
+	// MemoryFile doesn't take ownership of the file.
+	HostMemoryPressureFile *os.File
+
 	// DecommitOnDestroy indicates whether the entire host file should be
 	// decommitted on destruction. This is appropriate for host filesystem based
 	// files that need to be explicitly cleaned up to release disk space.
@@ -351,18 +358,39 @@ func NewMemoryFile(file *os.File, opts MemoryFileOpts) (*MemoryFile, error) {
 	f.reclaimCond.L = &f.mu
 
 	if f.opts.DelayedEviction == DelayedEvictionEnabled && f.opts.UseHostMemcgPressure {
-		stop, err := hostmm.NotifyCurrentMemcgPressureCallback(func() {
-			f.mu.Lock()
-			startedAny := f.startEvictionsLocked()
-			f.mu.Unlock()
-			if startedAny {
-				log.Debugf("pgalloc.MemoryFile performing evictions due to memcg pressure")
+		if pf := f.opts.HostMemoryPressureFile; pf != nil {
+			stop, err := hostmm.NotifyPSIMemoryPressureCallback(pf, func() {
+				hostPressureEvents.Increment()
+				f.mu.Lock()
+				startedAny := f.startEvictionsLocked()
+				f.mu.Unlock()
+				if startedAny {
+					log.Debugf("pgalloc.MemoryFile performing evictions due to PSI memory pressure")
+				}
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure PSI memory pressure notifications: %v", err)
 			}
-		}, "low")
-		if err != nil {
-			return nil, fmt.Errorf("failed to configure memcg pressure level notifications: %v", err)
+			hostPressureFile.Store(pf)
+			f.stopNotifyPressure = func() {
+				stop()
+				hostPressureFile.CompareAndSwap(pf, nil)
+			}
+		} else {
+			stop, err := hostmm.NotifyCurrentMemcgPressureCallback(func() {
+				hostPressureEvents.Increment()
+				f.mu.Lock()
+				startedAny := f.startEvictionsLocked()
+				f.mu.Unlock()
+				if startedAny {
+					log.Debugf("pgalloc.MemoryFile performing evictions due to memcg pressure")
+				}
+			}, "low")
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure memcg pressure level notifications: %v", err)
+			}
+			f.stopNotifyPressure = stop
 		}
-		f.stopNotifyPressure = stop
 	}
 
 	go f.runReclaim() // S/R-SAFE: f.mu
@@ -467,6 +495,11 @@ type AllocOpts struct {
 	// nearest page. If this is shorter than length bytes due to an error
 	// returned by ReadToBlocks(), it returns the partially filled fr and error.
 	Reader safemem.Reader
+	// Hugepage requests that the allocation be backed by host huge pages if
+	// possible. The allocation is aligned to hugepage boundaries, and the host
+	// is advised to use transparent huge pages for it. length must be a
+	// multiple of hostarch.HugePageSize.
+	Hugepage bool
 }
 
 // Allocate returns a range of initially-zeroed pages of the given length with
@@ -477,10 +510,16 @@ type AllocOpts struct {
 //
 // Preconditions: length must be page-aligned and non-zero.
 func (f *MemoryFile) Allocate(length uint64, opts AllocOpts) (memmap.FileRange, error) {
+	if opts.Hugepage && length%hostarch.HugePageSize != 0 {
+		panic(fmt.Sprintf("invalid hugepage allocation length: %#x", length))
+	}
 	fr, err := f.allocate(length, &opts)
 	if err != nil {
 		return memmap.FileRange{}, err
 	}
+	if opts.Hugepage {
+		f.adviseHugepage(fr)
+	}
 	var dsts safemem.BlockSeq
 	switch opts.Mode {
 	case AllocateOnly: // Allocation is handled above. Nothing more to do.
@@ -544,7 +583,7 @@ func (f *MemoryFile) allocate(length uint64, opts *AllocOpts) (memmap.FileRange,
 	// Align hugepage-and-larger allocations on hugepage boundaries to try
 	// to take advantage of hugetmpfs.
 	alignment := uint64(hostarch.PageSize)
-	if length >= hostarch.HugePageSize {
+	if length >= hostarch.HugePageSize || opts.Hugepage {
 		alignment = hostarch.HugePageSize
 	}
 
@@ -947,6 +986,19 @@ func (f *MemoryFile) MapInternal(fr memmap.FileRange, at hostarch.AccessType) (s
 	return safemem.BlockSeqFromSlice(blocks), err
 }
 
+// adviseHugepage advises the host to back fr with transparent huge pages. It
+// has no effect unless the host's shmem_enabled setting is "advise" or
+// "within_size".
+func (f *MemoryFile) adviseHugepage(fr memmap.FileRange) {
+	if err := f.forEachMappingSlice(fr, func(bs []byte) {
+		if err := unix.Madvise(bs, unix.MADV_HUGEPAGE); err != nil {
+			log.Debugf("madvise(MADV_HUGEPAGE) failed for %v: %v", fr, err)
+		}
+	}); err != nil {
+		log.Debugf("Failed to map %v to advise huge pages: %v", fr, err)
+	}
+}
+
 // forEachMappingSlice invokes fn on a sequence of byte slices that
 // collectively map all bytes in fr.
 func (f *MemoryFile) forEachMappingSlice(fr memmap.FileRange, fn func([]byte)) error {
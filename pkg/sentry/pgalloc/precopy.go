@@ -0,0 +1,173 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/memmap"
+)
+
+// Memory can be pre-copied to the target of a migration while the sandbox is
+// running, so that only the pages that changed since need to be saved while
+// it's stopped. There is no tracking of written pages, so the pages to copy
+// are found by comparing the hash of each page with the hash of the contents
+// it was last pre-copied with. This trades hashing all memory while the
+// sandbox is stopped for not sending most of it.
+//
+// Pre-copied pages are sent as a stream of records, each made of a header
+// holding the offset of the page in the MemoryFile and its length, followed by
+// the page. A header with a length of 0 ends the stream.
+
+// precopyHashSize is the number of bytes of the SHA-256 hash of pages kept by
+// PrecopyState.
+const precopyHashSize = 16
+
+// precopyHeaderSize is the size of the header of pre-copied pages.
+const precopyHeaderSize = 16
+
+// PrecopyState records the pages of a MemoryFile that were pre-copied.
+type PrecopyState struct {
+	// sums maps the offset of each pre-copied page to the hash of the
+	// contents it was sent with.
+	sums map[uint64][precopyHashSize]byte
+}
+
+// NewPrecopyState returns a PrecopyState for which no page was pre-copied.
+func NewPrecopyState() *PrecopyState {
+	return &PrecopyState{sums: make(map[uint64][precopyHashSize]byte)}
+}
+
+// precopied returns true if the page at off was pre-copied with contents pg.
+func (p *PrecopyState) precopied(off uint64, pg []byte) bool {
+	sum, ok := p.sums[off]
+	return ok && sum == hashPage(pg)
+}
+
+func hashPage(pg []byte) [precopyHashSize]byte {
+	var sum [precopyHashSize]byte
+	full := sha256.Sum256(pg)
+	copy(sum[:], full[:])
+	return sum
+}
+
+// PrecopyTo writes the committed pages of f that changed since they were last
+// pre-copied with p to w, and records them in p. It doesn't write the end of
+// the stream, see WritePrecopyEnd. It returns the number of bytes of pages
+// written.
+//
+// PrecopyTo may be called while f is in use; pages that change while they're
+// copied are copied again by the next call, or saved by SaveTo.
+func (f *MemoryFile) PrecopyTo(ctx context.Context, w io.Writer, p *PrecopyState) (uint64, error) {
+	// Find the pages that may contain data.
+	f.mu.Lock()
+	currentUsage, err := f.TotalUsage()
+	if err == nil {
+		err = f.updateUsageLocked(currentUsage, mincore)
+	}
+	var frs []memmap.FileRange
+	for seg := f.usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if seg.Value().knownCommitted {
+			frs = append(frs, seg.Range())
+		}
+	}
+	f.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		sent  uint64
+		ioErr error
+		buf   = make([]byte, precopyHeaderSize+hostarch.PageSize)
+	)
+	hdr, pg := buf[:precopyHeaderSize], buf[precopyHeaderSize:]
+	for _, fr := range frs {
+		off := fr.Start
+		err := f.forEachMappingSlice(fr, func(s []byte) {
+			for ; len(s) != 0 && ioErr == nil; s, off = s[hostarch.PageSize:], off+hostarch.PageSize {
+				// Copy the page first, so that the hash matches the
+				// contents sent even if the page is being written to.
+				copy(pg, s[:hostarch.PageSize])
+				sum := hashPage(pg)
+				if old, ok := p.sums[off]; ok && old == sum {
+					continue
+				}
+				binary.LittleEndian.PutUint64(hdr[0:], off)
+				binary.LittleEndian.PutUint64(hdr[8:], hostarch.PageSize)
+				if _, ioErr = w.Write(buf); ioErr != nil {
+					return
+				}
+				p.sums[off] = sum
+				sent += hostarch.PageSize
+			}
+		})
+		if ioErr != nil {
+			return sent, ioErr
+		}
+		if err != nil {
+			return sent, err
+		}
+		if ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+	}
+	return sent, nil
+}
+
+// WritePrecopyEnd ends a stream of pages written by PrecopyTo.
+func WritePrecopyEnd(w io.Writer) error {
+	var hdr [precopyHeaderSize]byte
+	_, err := w.Write(hdr[:])
+	return err
+}
+
+// ReadPrecopy reads a stream of pages written by PrecopyTo and WritePrecopyEnd
+// from r, and writes each page to file at its offset in the MemoryFile. file
+// can then be passed to LoadFrom in StateOpts.PrecopyFile. It returns the
+// number of bytes of pages read.
+func ReadPrecopy(r io.Reader, file *os.File) (uint64, error) {
+	var (
+		read uint64
+		hdr  [precopyHeaderSize]byte
+		pg   = make([]byte, hostarch.PageSize)
+	)
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return read, err
+		}
+		off := binary.LittleEndian.Uint64(hdr[0:])
+		length := binary.LittleEndian.Uint64(hdr[8:])
+		if length == 0 {
+			return read, nil
+		}
+		if length != hostarch.PageSize || off%hostarch.PageSize != 0 {
+			return read, fmt.Errorf("invalid pre-copied page at offset %#x, length %d", off, length)
+		}
+		if _, err := io.ReadFull(r, pg); err != nil {
+			return read, err
+		}
+		if _, err := file.WriteAt(pg, int64(off)); err != nil {
+			return read, err
+		}
+		read += length
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgalloc
+
+import (
+	"os"
+	"sync/atomic"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/metric"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/hostmm"
+)
+
+var (
+	// hostPressureEvents counts host memory pressure notifications.
+	hostPressureEvents = metric.MustCreateNewUint64Metric("/memory/host_pressure_events", false /* sync */, "Number of host memory pressure notifications received by the sandbox.")
+
+	// hostPressureFile is the PSI memory pressure file of the MemoryFile
+	// that receives PSI notifications, if any.
+	hostPressureFile atomic.Pointer[os.File]
+)
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/memory/host_pressure_some_avg10", false /* cumulative */, false /* sync */, "Share of the last 10 seconds in which some sandbox tasks were stalled on host memory, in hundredths of a percent.", func(...*metric.FieldValue) uint64 {
+		return uint64(hostPressureAverages().Some * 100)
+	})
+	metric.MustRegisterCustomUint64Metric("/memory/host_pressure_full_avg10", false /* cumulative */, false /* sync */, "Share of the last 10 seconds in which all sandbox tasks were stalled on host memory, in hundredths of a percent.", func(...*metric.FieldValue) uint64 {
+		return uint64(hostPressureAverages().Full * 100)
+	})
+}
+
+// hostPressureAverages returns the current host memory pressure, or zero if
+// PSI notifications aren't used.
+func hostPressureAverages() hostmm.PSIAverages {
+	file := hostPressureFile.Load()
+	if file == nil {
+		return hostmm.PSIAverages{}
+	}
+	avgs, err := hostmm.ReadPSIAverages(file)
+	if err != nil {
+		log.Warningf("Failed to read host memory pressure: %v", err)
+	}
+	return avgs
+}
@@ -17,21 +17,106 @@ package pgalloc
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"math/bits"
+	"os"
 	"runtime"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/memmap"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/usage"
 	"github.com/talismancer/gvisor-ligolo/pkg/state"
 	"github.com/talismancer/gvisor-ligolo/pkg/state/wire"
 	"golang.org/x/sys/unix"
 )
 
+// StateOpts contains options for MemoryFile.SaveTo and MemoryFile.LoadFrom.
+// A MemoryFile must be loaded with the PageChecksums it was saved with.
+type StateOpts struct {
+	// If PageChecksums is true, the checksum of each saved page is written
+	// after the page data, and pages are verified against it when loaded.
+	PageChecksums bool
+
+	// If PagesLoaded is not nil, LoadFrom adds the number of pages it loads
+	// to it as it goes. It is ignored by SaveTo.
+	PagesLoaded *atomicbitops.Uint64
+
+	// If Precopy is not nil, SaveTo only writes the pages whose contents
+	// changed since they were pre-copied with it, see PrecopyTo. It is
+	// ignored by LoadFrom.
+	Precopy *PrecopyState
+
+	// If PrecopyFile is not nil, the state was saved with Precopy, and
+	// LoadFrom reads the pages that weren't saved from PrecopyFile, see
+	// ReadPrecopy. It is ignored by SaveTo.
+	PrecopyFile *os.File
+}
+
+// ErrPageChecksum is returned when a saved page doesn't match its checksum.
+var ErrPageChecksum = errors.New("page checksum mismatch")
+
+// pageChecksumTable is the CRC-32C table used for page checksums.
+var pageChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// appendPageChecksums appends the checksum of each page in bs to sums.
+//
+// Preconditions: len(bs) is page-aligned.
+func appendPageChecksums(sums []byte, bs []byte) []byte {
+	for off := 0; off < len(bs); off += hostarch.PageSize {
+		sums = binary.LittleEndian.AppendUint32(sums, crc32.Checksum(bs[off:off+hostarch.PageSize], pageChecksumTable))
+	}
+	return sums
+}
+
+// readPageChecksums reads the checksums of a segment of length bytes from r.
+func readPageChecksums(r wire.Reader, length uint64) ([]byte, error) {
+	sums := make([]byte, 4*(length/hostarch.PageSize))
+	if err := readDataHeader(r, uint64(len(sums))); err != nil {
+		return nil, fmt.Errorf("page checksums: %w", err)
+	}
+	if _, err := io.ReadFull(r, sums); err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// checkPageChecksums compares the checksums of the pages of a segment
+// starting at offset start.
+func checkPageChecksums(start uint64, got, want []byte) error {
+	for i := 0; i < len(want); i += 4 {
+		if !bytes.Equal(got[i:i+4], want[i:i+4]) {
+			return fmt.Errorf("%w: page at offset %#x", ErrPageChecksum, start+uint64(i/4)*hostarch.PageSize)
+		}
+	}
+	return nil
+}
+
+// readDataHeader reads the header of non-object data of the given length
+// from r.
+func readDataHeader(r wire.Reader, expected uint64) error {
+	length, object, err := state.ReadHeader(r)
+	if err != nil {
+		return err
+	}
+	if object {
+		// Not expected.
+		return fmt.Errorf("unexpected object")
+	}
+	if length != expected {
+		// Size mismatch.
+		return fmt.Errorf("mismatched segment: expected %d, got %d", expected, length)
+	}
+	return nil
+}
+
 // SaveTo writes f's state to the given stream.
-func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
+func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer, opts StateOpts) error {
 	// Wait for reclaim.
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -92,17 +177,29 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 		if !seg.Value().knownCommitted {
 			continue
 		}
+		if opts.Precopy != nil {
+			if err := f.savePrecopiedSegment(w, seg.Range(), opts); err != nil {
+				return err
+			}
+			continue
+		}
 		// Write a header to distinguish from objects.
 		if err := state.WriteHeader(w, uint64(seg.Range().Length()), false); err != nil {
 			return err
 		}
 		// Write out data.
-		var ioErr error
+		var (
+			ioErr error
+			sums  []byte
+		)
 		err := f.forEachMappingSlice(seg.Range(), func(s []byte) {
 			if ioErr != nil {
 				return
 			}
 			_, ioErr = w.Write(s)
+			if opts.PageChecksums {
+				sums = appendPageChecksums(sums, s)
+			}
 		})
 		if ioErr != nil {
 			return ioErr
@@ -110,13 +207,21 @@ func (f *MemoryFile) SaveTo(ctx context.Context, w wire.Writer) error {
 		if err != nil {
 			return err
 		}
+		if opts.PageChecksums {
+			if err := state.WriteHeader(w, uint64(len(sums)), false); err != nil {
+				return err
+			}
+			if _, err := w.Write(sums); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
 // LoadFrom loads MemoryFile state from the given stream.
-func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
+func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader, opts StateOpts) error {
 	// Load metadata.
 	if _, err := state.Load(ctx, r, &f.fileSize); err != nil {
 		return err
@@ -158,26 +263,33 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 		if !seg.Value().knownCommitted {
 			continue
 		}
+		if opts.PrecopyFile != nil {
+			if err := f.loadPrecopiedSegment(r, seg.Range(), opts); err != nil {
+				return err
+			}
+			if opts.PagesLoaded != nil {
+				opts.PagesLoaded.Add(uint64(seg.Range().Length()) / hostarch.PageSize)
+			}
+			usage.MemoryAccounting.Inc(seg.End()-seg.Start(), seg.Value().kind, seg.Value().memCgID)
+			continue
+		}
 		// Verify header.
-		length, object, err := state.ReadHeader(r)
-		if err != nil {
+		if err := readDataHeader(r, uint64(seg.Range().Length())); err != nil {
 			return err
 		}
-		if object {
-			// Not expected.
-			return fmt.Errorf("unexpected object")
-		}
-		if expected := uint64(seg.Range().Length()); length != expected {
-			// Size mismatch.
-			return fmt.Errorf("mismatched segment: expected %d, got %d", expected, length)
-		}
 		// Read data.
-		var ioErr error
-		err = f.forEachMappingSlice(seg.Range(), func(s []byte) {
+		var (
+			ioErr error
+			sums  []byte
+		)
+		err := f.forEachMappingSlice(seg.Range(), func(s []byte) {
 			if ioErr != nil {
 				return
 			}
 			_, ioErr = io.ReadFull(r, s)
+			if ioErr == nil && opts.PageChecksums {
+				sums = appendPageChecksums(sums, s)
+			}
 		})
 		if ioErr != nil {
 			return ioErr
@@ -185,6 +297,19 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 		if err != nil {
 			return err
 		}
+		if opts.PageChecksums {
+			want, err := readPageChecksums(r, uint64(seg.Range().Length()))
+			if err != nil {
+				return err
+			}
+			if err := checkPageChecksums(seg.Start(), sums, want); err != nil {
+				return err
+			}
+		}
+
+		if opts.PagesLoaded != nil {
+			opts.PagesLoaded.Add(uint64(seg.Range().Length()) / hostarch.PageSize)
+		}
 
 		// Update accounting for restored pages. We need to do this here since
 		// these segments are marked as "known committed", and will be skipped
@@ -195,6 +320,171 @@ func (f *MemoryFile) LoadFrom(ctx context.Context, r wire.Reader) error {
 	return nil
 }
 
+// savePrecopiedSegment writes the pages of fr that weren't pre-copied with
+// opts.Precopy to w. They're preceded by a bitmap of the pages of fr, in which
+// the bits of written pages are set.
+func (f *MemoryFile) savePrecopiedSegment(w wire.Writer, fr memmap.FileRange, opts StateOpts) error {
+	bitmap := make([]byte, (fr.Length()/hostarch.PageSize+7)/8)
+	var (
+		changed uint64
+		sums    []byte
+	)
+	off := fr.Start
+	if err := f.forEachMappingSlice(fr, func(s []byte) {
+		for ; len(s) != 0; s, off = s[hostarch.PageSize:], off+hostarch.PageSize {
+			pg := s[:hostarch.PageSize]
+			if !opts.Precopy.precopied(off, pg) {
+				i := (off - fr.Start) / hostarch.PageSize
+				bitmap[i/8] |= 1 << (i % 8)
+				changed += hostarch.PageSize
+			}
+			if opts.PageChecksums {
+				sums = appendPageChecksums(sums, pg)
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	if err := state.WriteHeader(w, uint64(len(bitmap)), false); err != nil {
+		return err
+	}
+	if _, err := w.Write(bitmap); err != nil {
+		return err
+	}
+	if err := state.WriteHeader(w, changed, false); err != nil {
+		return err
+	}
+	var ioErr error
+	off = fr.Start
+	if err := f.forEachMappingSlice(fr, func(s []byte) {
+		for ; len(s) != 0 && ioErr == nil; s, off = s[hostarch.PageSize:], off+hostarch.PageSize {
+			if i := (off - fr.Start) / hostarch.PageSize; bitmap[i/8]&(1<<(i%8)) != 0 {
+				_, ioErr = w.Write(s[:hostarch.PageSize])
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	if ioErr != nil {
+		return ioErr
+	}
+	if opts.PageChecksums {
+		if err := state.WriteHeader(w, uint64(len(sums)), false); err != nil {
+			return err
+		}
+		if _, err := w.Write(sums); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPrecopiedSegment loads the pages of fr saved by savePrecopiedSegment
+// from r, and the other pages from opts.PrecopyFile.
+func (f *MemoryFile) loadPrecopiedSegment(r wire.Reader, fr memmap.FileRange, opts StateOpts) error {
+	bitmap := make([]byte, (fr.Length()/hostarch.PageSize+7)/8)
+	if err := readDataHeader(r, uint64(len(bitmap))); err != nil {
+		return fmt.Errorf("page bitmap: %w", err)
+	}
+	if _, err := io.ReadFull(r, bitmap); err != nil {
+		return err
+	}
+	var changed uint64
+	for _, b := range bitmap {
+		changed += uint64(bits.OnesCount8(b)) * hostarch.PageSize
+	}
+	if err := readDataHeader(r, changed); err != nil {
+		return err
+	}
+	var (
+		ioErr error
+		sums  []byte
+	)
+	off := fr.Start
+	if err := f.forEachMappingSlice(fr, func(s []byte) {
+		for ; len(s) != 0 && ioErr == nil; s, off = s[hostarch.PageSize:], off+hostarch.PageSize {
+			pg := s[:hostarch.PageSize]
+			if i := (off - fr.Start) / hostarch.PageSize; bitmap[i/8]&(1<<(i%8)) != 0 {
+				_, ioErr = io.ReadFull(r, pg)
+			} else if _, ioErr = opts.PrecopyFile.ReadAt(pg, int64(off)); ioErr != nil {
+				ioErr = fmt.Errorf("reading pre-copied page at offset %#x: %w", off, ioErr)
+			}
+			if ioErr == nil && opts.PageChecksums {
+				sums = appendPageChecksums(sums, pg)
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	if ioErr != nil {
+		return ioErr
+	}
+	if opts.PageChecksums {
+		want, err := readPageChecksums(r, fr.Length())
+		if err != nil {
+			return err
+		}
+		if err := checkPageChecksums(fr.Start, sums, want); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyBufferSize is the size of the buffer used by VerifyFrom to read saved
+// pages.
+const verifyBufferSize = 1 << 20
+
+// VerifyFrom reads MemoryFile state saved with the given options from r
+// without loading it, and verifies page checksums if opts.PageChecksums is
+// true.
+func VerifyFrom(ctx context.Context, r wire.Reader, opts StateOpts) error {
+	var (
+		fileSize int64
+		usage    usageSet
+	)
+	if _, err := state.Load(ctx, r, &fileSize); err != nil {
+		return err
+	}
+	if _, err := state.Load(ctx, r, &usage); err != nil {
+		return err
+	}
+	buf := make([]byte, verifyBufferSize)
+	for seg := usage.FirstSegment(); seg.Ok(); seg = seg.NextSegment() {
+		if !seg.Value().knownCommitted {
+			continue
+		}
+		length := uint64(seg.Range().Length())
+		if err := readDataHeader(r, length); err != nil {
+			return err
+		}
+		var sums []byte
+		for done := uint64(0); done < length; {
+			n := uint64(len(buf))
+			if length-done < n {
+				n = length - done
+			}
+			if _, err := io.ReadFull(r, buf[:n]); err != nil {
+				return err
+			}
+			if opts.PageChecksums {
+				sums = appendPageChecksums(sums, buf[:n])
+			}
+			done += n
+		}
+		if opts.PageChecksums {
+			want, err := readPageChecksums(r, length)
+			if err != nil {
+				return err
+			}
+			if err := checkPageChecksums(seg.Start(), sums, want); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // MemoryFileProvider provides the MemoryFile method.
 //
 // This type exists to work around a save/restore defect. The only object in a
@@ -36,6 +36,10 @@ type context struct {
 
 	// interrupt is the interrupt context.
 	interrupt interrupt.Forwarder
+
+	// lastVCPU is the vCPU the context last ran on, which it prefers to run
+	// on again. It's only accessed by Switch.
+	lastVCPU *vCPU
 }
 
 // tryCPUIDError indicates that CPUID emulation should occur.
@@ -50,8 +54,14 @@ func (c *context) Switch(ctx pkgcontext.Context, mm platform.MemoryManager, ac *
 	localAS := as.(*addressSpace)
 
 restart:
-	// Grab a vCPU.
-	cpu := c.machine.Get()
+	// Grab a vCPU, preferably the last one.
+	cpu := c.machine.GetPreferred(c.lastVCPU)
+	if c.lastVCPU != cpu {
+		if c.lastVCPU != nil {
+			vCPUMigrationCounter.Increment()
+		}
+		c.lastVCPU = cpu
+	}
 
 	// Enable interrupts (i.e. calls to vCPU.Notify).
 	if !c.interrupt.Enable(cpu) {
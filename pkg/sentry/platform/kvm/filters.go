@@ -49,6 +49,13 @@ func (k *KVM) SyscallFilters() seccomp.SyscallRules {
 				seccomp.EqualTo(0),
 			},
 		},
+		// Task goroutines bind their host thread to host CPUs, see
+		// KVM.HostCPUs.
+		unix.SYS_SCHED_SETAFFINITY: []seccomp.Rule{
+			{
+				seccomp.EqualTo(0),
+			},
+		},
 		unix.SYS_MMAP:            {},
 		unix.SYS_RT_SIGSUSPEND:   {},
 		unix.SYS_RT_SIGTIMEDWAIT: {},
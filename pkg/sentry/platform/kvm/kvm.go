@@ -71,6 +71,9 @@ type KVM struct {
 
 	// machine is the backing VM.
 	machine *machine
+
+	// hostCPUs are the host CPUs the sentry is allowed to run on.
+	hostCPUs []uint
 }
 
 var (
@@ -127,9 +130,23 @@ func New(deviceFile *os.File) (*KVM, error) {
 		return nil, err
 	}
 
+	// vCPUs run on the host threads calling KVM_RUN, so they can be bound
+	// to the host CPUs the sentry is allowed to run on.
+	var cpus unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &cpus); err != nil {
+		return nil, fmt.Errorf("getting host CPU affinity: %v", err)
+	}
+	var hostCPUs []uint
+	for cpu := 0; cpu < len(cpus)*64; cpu++ {
+		if cpus.IsSet(cpu) {
+			hostCPUs = append(hostCPUs, uint(cpu))
+		}
+	}
+
 	// All set.
 	return &KVM{
-		machine: machine,
+		machine:  machine,
+		hostCPUs: hostCPUs,
 	}, nil
 }
 
@@ -143,6 +160,11 @@ func (*KVM) CooperativelySchedulesAddressSpace() bool {
 	return false
 }
 
+// HostCPUs implements platform.Platform.HostCPUs.
+func (k *KVM) HostCPUs() []uint {
+	return k.hostCPUs
+}
+
 // MapUnit implements platform.Platform.MapUnit.
 func (*KVM) MapUnit() uint64 {
 	// We greedily creates PTEs in MapFile, so extremely large mappings can
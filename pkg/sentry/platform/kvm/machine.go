@@ -107,6 +107,7 @@ const (
 var (
 	getVCPUAcquisitionFastReused = metric.FieldValue{"fast_reused"}
 	getVCPUAcquisitionReused     = metric.FieldValue{"reused"}
+	getVCPUAcquisitionAffinity   = metric.FieldValue{"affinity"}
 	getVCPUAcquisitionUnused     = metric.FieldValue{"unused"}
 	getVCPUAcquisitionStolen     = metric.FieldValue{"stolen"}
 )
@@ -136,7 +137,12 @@ var (
 	// machine.Get() are triggered.
 	getVCPUCounter = metric.MustCreateNewProfilingUint64Metric(
 		"/kvm/get_vcpu", false, "The number of times that machine.Get() was called, split by path the function took.",
-		metric.NewField("acquisition_type", &getVCPUAcquisitionFastReused, &getVCPUAcquisitionReused, &getVCPUAcquisitionUnused, &getVCPUAcquisitionStolen))
+		metric.NewField("acquisition_type", &getVCPUAcquisitionFastReused, &getVCPUAcquisitionReused, &getVCPUAcquisitionAffinity, &getVCPUAcquisitionUnused, &getVCPUAcquisitionStolen))
+
+	// vCPUMigrationCounter is a metric that tracks how many times a context
+	// ran on a different vCPU than the last time it ran.
+	vCPUMigrationCounter = metric.MustCreateNewProfilingUint64Metric(
+		"/kvm/vcpu_migrations", false, "The number of times a context switched to a different vCPU than the one it last ran on.")
 
 	// asInvalidateDuration are durations of calling addressSpace.invalidate().
 	asInvalidateDuration = metric.MustCreateNewProfilingTimerMetric("/kvm/address_space_invalidate",
@@ -453,6 +459,15 @@ func (m *machine) Destroy() {
 // the corrent context in guest, the vCPU of it must be the same as what
 // Get() returns.
 func (m *machine) Get() *vCPU {
+	return m.GetPreferred(nil)
+}
+
+// GetPreferred is like Get, but if the current thread has no vCPU, preferred
+// is taken over if it's available, rather than an arbitrary vCPU. Contexts
+// pass the vCPU they last ran on, so that their address spaces keep running
+// on the same vCPUs, and host CPUs, when task goroutines move between host
+// threads.
+func (m *machine) GetPreferred(preferred *vCPU) *vCPU {
 	m.mu.RLock()
 	runtime.LockOSThread()
 	tid := hosttid.Current()
@@ -485,6 +500,18 @@ func (m *machine) Get() *vCPU {
 		return c
 	}
 
+	// Take over the preferred vCPU if it's not in use.
+	if preferred != nil && preferred.state.CompareAndSwap(vCPUReady, vCPUUser) {
+		if origTID := preferred.tid.Load(); m.vCPUsByTID[origTID] == preferred {
+			delete(m.vCPUsByTID, origTID)
+		}
+		m.vCPUsByTID[tid] = preferred
+		m.mu.Unlock()
+		preferred.loadSegments(tid)
+		getVCPUCounter.Increment(&getVCPUAcquisitionAffinity)
+		return preferred
+	}
+
 	for {
 		// Get vCPU from the m.vCPUsByID pool.
 		if m.usedVCPUs < m.maxVCPUs {
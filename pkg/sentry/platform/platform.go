@@ -66,6 +66,15 @@ type Platform interface {
 	// correctly in host-managed page tables.
 	OwnsPageTables() bool
 
+	// HostCPUs returns the host CPUs that the host thread calling
+	// Context.Switch can be bound to, with sched_setaffinity(2), such that
+	// the application code it executes is bound to them too. It returns nil
+	// if application code doesn't run on that thread.
+	//
+	// The value returned by HostCPUs is guaranteed to remain unchanged over
+	// the lifetime of the Platform.
+	HostCPUs() []uint
+
 	// MapUnit returns the alignment used for optional mappings into this
 	// platform's AddressSpaces. Higher values indicate lower per-page costs
 	// for AddressSpace.MapFile. As a special case, a MapUnit of 0 indicates
@@ -175,6 +184,15 @@ func (UseHostProcessMemoryBarrier) GlobalMemoryBarrier() error {
 	return hostmm.GlobalMemoryBarrier()
 }
 
+// NoHostCPUs implements Platform.HostCPUs for Platforms that don't execute
+// application code on the host thread calling Context.Switch.
+type NoHostCPUs struct{}
+
+// HostCPUs implements Platform.HostCPUs.
+func (NoHostCPUs) HostCPUs() []uint {
+	return nil
+}
+
 // DoesOwnPageTables implements Platform.OwnsPageTables in the positive.
 type DoesOwnPageTables struct{}
 
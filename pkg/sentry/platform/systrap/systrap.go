@@ -297,6 +297,7 @@ type Systrap struct {
 	platform.NoCPUPreemptionDetection
 	platform.UseHostGlobalMemoryBarrier
 	platform.DoesNotOwnPageTables
+	platform.NoHostCPUs
 
 	// memoryFile is used to create a stub sysmsg stack
 	// which is shared with the Sentry.
@@ -31,6 +31,9 @@ const DefaultSessionName = "Default"
 var (
 	sessionsMu = sync.Mutex{}
 	sessions   = make(map[string]*State)
+
+	// sessionConfigs are the configurations of sessions, without sink FDs.
+	sessionConfigs = make(map[string]SessionConfig)
 )
 
 var sessionCounter = metric.MustCreateNewUint64Metric("/trace/sessions_created", false /* sync */, "Counts the number of trace sessions created.")
@@ -51,6 +54,9 @@ type SessionConfig struct {
 	IgnoreMissing bool `json:"ignore_missing,omitempty"`
 	// Sinks are the sinks that will process the points enabled above.
 	Sinks []SinkConfig `json:"sinks,omitempty"`
+	// Restartable sessions are recreated after the sandbox is restored from
+	// a checkpoint, see Restartable.
+	Restartable bool `json:"restartable,omitempty"`
 }
 
 // PointConfig describes a point to be enabled in a given session.
@@ -99,6 +105,61 @@ func Create(conf *SessionConfig, force bool) error {
 	}
 	state := &Global
 
+	reqs, err := pointReqs(conf)
+	if err != nil {
+		return err
+	}
+
+	for _, sinkConfig := range conf.Sinks {
+		desc, err := findSinkDesc(sinkConfig.Name)
+		if err != nil {
+			return err
+		}
+		sink, err := desc.New(sinkConfig.Config, sinkConfig.FD)
+		if err != nil {
+			return fmt.Errorf("creating event sink: %w", err)
+		}
+		state.AppendSink(sink, reqs)
+	}
+
+	sessions[conf.Name] = state
+	saved := *conf
+	saved.Sinks = make([]SinkConfig, len(conf.Sinks))
+	for i, sink := range conf.Sinks {
+		sink.FD = nil
+		saved.Sinks[i] = sink
+	}
+	sessionConfigs[conf.Name] = saved
+	sessionCounter.Increment()
+	return nil
+}
+
+// Update replaces the points enabled in the existing session conf.Name with
+// conf.Points, keeping its sinks. conf.Sinks is ignored.
+func Update(conf *SessionConfig) error {
+	log.Debugf("Updating seccheck: %+v", conf)
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	state := sessions[conf.Name]
+	if state == nil {
+		return fmt.Errorf("session %q not found", conf.Name)
+	}
+	reqs, err := pointReqs(conf)
+	if err != nil {
+		return err
+	}
+	state.setPoints(reqs)
+
+	saved := sessionConfigs[conf.Name]
+	saved.Points = conf.Points
+	saved.IgnoreMissing = conf.IgnoreMissing
+	sessionConfigs[conf.Name] = saved
+	return nil
+}
+
+// pointReqs returns the requests for the points enabled by conf.
+func pointReqs(conf *SessionConfig) ([]PointReq, error) {
 	var reqs []PointReq
 	for _, ptConfig := range conf.Points {
 		desc, err := findPointDesc(ptConfig.Name)
@@ -107,40 +168,25 @@ func Create(conf *SessionConfig, force bool) error {
 				log.Warningf("Skipping point %q: %v", ptConfig.Name, err)
 				continue
 			}
-			return err
+			return nil, err
 		}
 		req := PointReq{Pt: desc.ID}
 
 		mask, err := setFields(ptConfig.OptionalFields, desc.OptionalFields, conf.IgnoreMissing)
 		if err != nil {
-			return fmt.Errorf("configuring point %q: %w", ptConfig.Name, err)
+			return nil, fmt.Errorf("configuring point %q: %w", ptConfig.Name, err)
 		}
 		req.Fields.Local = mask
 
 		mask, err = setFields(ptConfig.ContextFields, desc.ContextFields, conf.IgnoreMissing)
 		if err != nil {
-			return fmt.Errorf("configuring point %q: %w", ptConfig.Name, err)
+			return nil, fmt.Errorf("configuring point %q: %w", ptConfig.Name, err)
 		}
 		req.Fields.Context = mask
 
 		reqs = append(reqs, req)
 	}
-
-	for _, sinkConfig := range conf.Sinks {
-		desc, err := findSinkDesc(sinkConfig.Name)
-		if err != nil {
-			return err
-		}
-		sink, err := desc.New(sinkConfig.Config, sinkConfig.FD)
-		if err != nil {
-			return fmt.Errorf("creating event sink: %w", err)
-		}
-		state.AppendSink(sink, reqs)
-	}
-
-	sessions[conf.Name] = state
-	sessionCounter.Increment()
-	return nil
+	return reqs, nil
 }
 
 // SetupSinks runs the setup step of all sinks in the configuration.
@@ -190,9 +236,25 @@ func deleteLocked(name string) error {
 
 	session.clearSink()
 	delete(sessions, name)
+	delete(sessionConfigs, name)
 	return nil
 }
 
+// Restartable returns the configurations of the existing restartable
+// sessions. Sink FDs and statuses are not included.
+func Restartable() []SessionConfig {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	var confs []SessionConfig
+	for _, conf := range sessionConfigs {
+		if conf.Restartable {
+			confs = append(confs, conf)
+		}
+	}
+	return confs
+}
+
 // List lists all existing sessions.
 func List(out *[]SessionConfig) {
 	sessionsMu.Lock()
@@ -30,6 +30,8 @@ const (
 	PointExecve
 	PointExitNotifyParent
 	PointTaskExit
+	PointMappedFileTruncated
+	PointTLSPlaintext
 
 	// Add new Points above this line.
 	pointLengthBeforeSyscalls
@@ -286,6 +288,17 @@ func genericInit() {
 		Name:          "sentry/task_exit",
 		ContextFields: defaultContextFields,
 	})
+	registerPoint(PointDesc{
+		ID:            PointMappedFileTruncated,
+		Name:          "sentry/mapped_file_truncated",
+		ContextFields: defaultContextFields,
+	})
+	// Plaintext of intercepted TLS connections isn't collected by a task, so
+	// it has no context fields.
+	registerPoint(PointDesc{
+		ID:   PointTLSPlaintext,
+		Name: "sentry/tls_plaintext",
+	})
 }
 
 var initOnce sync.Once
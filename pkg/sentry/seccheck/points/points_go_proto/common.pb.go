@@ -23,41 +23,43 @@ const (
 type MessageType int32
 
 const (
-	MessageType_MESSAGE_UNKNOWN                   MessageType = 0
-	MessageType_MESSAGE_CONTAINER_START           MessageType = 1
-	MessageType_MESSAGE_SENTRY_CLONE              MessageType = 2
-	MessageType_MESSAGE_SENTRY_EXEC               MessageType = 3
-	MessageType_MESSAGE_SENTRY_EXIT_NOTIFY_PARENT MessageType = 4
-	MessageType_MESSAGE_SENTRY_TASK_EXIT          MessageType = 5
-	MessageType_MESSAGE_SYSCALL_RAW               MessageType = 6
-	MessageType_MESSAGE_SYSCALL_OPEN              MessageType = 7
-	MessageType_MESSAGE_SYSCALL_CLOSE             MessageType = 8
-	MessageType_MESSAGE_SYSCALL_READ              MessageType = 9
-	MessageType_MESSAGE_SYSCALL_CONNECT           MessageType = 10
-	MessageType_MESSAGE_SYSCALL_EXECVE            MessageType = 11
-	MessageType_MESSAGE_SYSCALL_SOCKET            MessageType = 12
-	MessageType_MESSAGE_SYSCALL_CHDIR             MessageType = 13
-	MessageType_MESSAGE_SYSCALL_SETID             MessageType = 14
-	MessageType_MESSAGE_SYSCALL_SETRESID          MessageType = 15
-	MessageType_MESSAGE_SYSCALL_PRLIMIT64         MessageType = 16
-	MessageType_MESSAGE_SYSCALL_PIPE              MessageType = 17
-	MessageType_MESSAGE_SYSCALL_FCNTL             MessageType = 18
-	MessageType_MESSAGE_SYSCALL_DUP               MessageType = 19
-	MessageType_MESSAGE_SYSCALL_SIGNALFD          MessageType = 20
-	MessageType_MESSAGE_SYSCALL_CHROOT            MessageType = 21
-	MessageType_MESSAGE_SYSCALL_EVENTFD           MessageType = 22
-	MessageType_MESSAGE_SYSCALL_CLONE             MessageType = 23
-	MessageType_MESSAGE_SYSCALL_BIND              MessageType = 24
-	MessageType_MESSAGE_SYSCALL_ACCEPT            MessageType = 25
-	MessageType_MESSAGE_SYSCALL_TIMERFD_CREATE    MessageType = 26
-	MessageType_MESSAGE_SYSCALL_TIMERFD_SETTIME   MessageType = 27
-	MessageType_MESSAGE_SYSCALL_TIMERFD_GETTIME   MessageType = 28
-	MessageType_MESSAGE_SYSCALL_FORK              MessageType = 29
-	MessageType_MESSAGE_SYSCALL_INOTIFY_INIT      MessageType = 30
-	MessageType_MESSAGE_SYSCALL_INOTIFY_ADD_WATCH MessageType = 31
-	MessageType_MESSAGE_SYSCALL_INOTIFY_RM_WATCH  MessageType = 32
-	MessageType_MESSAGE_SYSCALL_SOCKETPAIR        MessageType = 33
-	MessageType_MESSAGE_SYSCALL_WRITE             MessageType = 34
+	MessageType_MESSAGE_UNKNOWN                      MessageType = 0
+	MessageType_MESSAGE_CONTAINER_START              MessageType = 1
+	MessageType_MESSAGE_SENTRY_CLONE                 MessageType = 2
+	MessageType_MESSAGE_SENTRY_EXEC                  MessageType = 3
+	MessageType_MESSAGE_SENTRY_EXIT_NOTIFY_PARENT    MessageType = 4
+	MessageType_MESSAGE_SENTRY_TASK_EXIT             MessageType = 5
+	MessageType_MESSAGE_SYSCALL_RAW                  MessageType = 6
+	MessageType_MESSAGE_SYSCALL_OPEN                 MessageType = 7
+	MessageType_MESSAGE_SYSCALL_CLOSE                MessageType = 8
+	MessageType_MESSAGE_SYSCALL_READ                 MessageType = 9
+	MessageType_MESSAGE_SYSCALL_CONNECT              MessageType = 10
+	MessageType_MESSAGE_SYSCALL_EXECVE               MessageType = 11
+	MessageType_MESSAGE_SYSCALL_SOCKET               MessageType = 12
+	MessageType_MESSAGE_SYSCALL_CHDIR                MessageType = 13
+	MessageType_MESSAGE_SYSCALL_SETID                MessageType = 14
+	MessageType_MESSAGE_SYSCALL_SETRESID             MessageType = 15
+	MessageType_MESSAGE_SYSCALL_PRLIMIT64            MessageType = 16
+	MessageType_MESSAGE_SYSCALL_PIPE                 MessageType = 17
+	MessageType_MESSAGE_SYSCALL_FCNTL                MessageType = 18
+	MessageType_MESSAGE_SYSCALL_DUP                  MessageType = 19
+	MessageType_MESSAGE_SYSCALL_SIGNALFD             MessageType = 20
+	MessageType_MESSAGE_SYSCALL_CHROOT               MessageType = 21
+	MessageType_MESSAGE_SYSCALL_EVENTFD              MessageType = 22
+	MessageType_MESSAGE_SYSCALL_CLONE                MessageType = 23
+	MessageType_MESSAGE_SYSCALL_BIND                 MessageType = 24
+	MessageType_MESSAGE_SYSCALL_ACCEPT               MessageType = 25
+	MessageType_MESSAGE_SYSCALL_TIMERFD_CREATE       MessageType = 26
+	MessageType_MESSAGE_SYSCALL_TIMERFD_SETTIME      MessageType = 27
+	MessageType_MESSAGE_SYSCALL_TIMERFD_GETTIME      MessageType = 28
+	MessageType_MESSAGE_SYSCALL_FORK                 MessageType = 29
+	MessageType_MESSAGE_SYSCALL_INOTIFY_INIT         MessageType = 30
+	MessageType_MESSAGE_SYSCALL_INOTIFY_ADD_WATCH    MessageType = 31
+	MessageType_MESSAGE_SYSCALL_INOTIFY_RM_WATCH     MessageType = 32
+	MessageType_MESSAGE_SYSCALL_SOCKETPAIR           MessageType = 33
+	MessageType_MESSAGE_SYSCALL_WRITE                MessageType = 34
+	MessageType_MESSAGE_SENTRY_MAPPED_FILE_TRUNCATED MessageType = 35
+	MessageType_MESSAGE_SENTRY_TLS_PLAINTEXT         MessageType = 36
 )
 
 // Enum value maps for MessageType.
@@ -98,43 +100,47 @@ var (
 		32: "MESSAGE_SYSCALL_INOTIFY_RM_WATCH",
 		33: "MESSAGE_SYSCALL_SOCKETPAIR",
 		34: "MESSAGE_SYSCALL_WRITE",
+		35: "MESSAGE_SENTRY_MAPPED_FILE_TRUNCATED",
+		36: "MESSAGE_SENTRY_TLS_PLAINTEXT",
 	}
 	MessageType_value = map[string]int32{
-		"MESSAGE_UNKNOWN":                   0,
-		"MESSAGE_CONTAINER_START":           1,
-		"MESSAGE_SENTRY_CLONE":              2,
-		"MESSAGE_SENTRY_EXEC":               3,
-		"MESSAGE_SENTRY_EXIT_NOTIFY_PARENT": 4,
-		"MESSAGE_SENTRY_TASK_EXIT":          5,
-		"MESSAGE_SYSCALL_RAW":               6,
-		"MESSAGE_SYSCALL_OPEN":              7,
-		"MESSAGE_SYSCALL_CLOSE":             8,
-		"MESSAGE_SYSCALL_READ":              9,
-		"MESSAGE_SYSCALL_CONNECT":           10,
-		"MESSAGE_SYSCALL_EXECVE":            11,
-		"MESSAGE_SYSCALL_SOCKET":            12,
-		"MESSAGE_SYSCALL_CHDIR":             13,
-		"MESSAGE_SYSCALL_SETID":             14,
-		"MESSAGE_SYSCALL_SETRESID":          15,
-		"MESSAGE_SYSCALL_PRLIMIT64":         16,
-		"MESSAGE_SYSCALL_PIPE":              17,
-		"MESSAGE_SYSCALL_FCNTL":             18,
-		"MESSAGE_SYSCALL_DUP":               19,
-		"MESSAGE_SYSCALL_SIGNALFD":          20,
-		"MESSAGE_SYSCALL_CHROOT":            21,
-		"MESSAGE_SYSCALL_EVENTFD":           22,
-		"MESSAGE_SYSCALL_CLONE":             23,
-		"MESSAGE_SYSCALL_BIND":              24,
-		"MESSAGE_SYSCALL_ACCEPT":            25,
-		"MESSAGE_SYSCALL_TIMERFD_CREATE":    26,
-		"MESSAGE_SYSCALL_TIMERFD_SETTIME":   27,
-		"MESSAGE_SYSCALL_TIMERFD_GETTIME":   28,
-		"MESSAGE_SYSCALL_FORK":              29,
-		"MESSAGE_SYSCALL_INOTIFY_INIT":      30,
-		"MESSAGE_SYSCALL_INOTIFY_ADD_WATCH": 31,
-		"MESSAGE_SYSCALL_INOTIFY_RM_WATCH":  32,
-		"MESSAGE_SYSCALL_SOCKETPAIR":        33,
-		"MESSAGE_SYSCALL_WRITE":             34,
+		"MESSAGE_UNKNOWN":                      0,
+		"MESSAGE_CONTAINER_START":              1,
+		"MESSAGE_SENTRY_CLONE":                 2,
+		"MESSAGE_SENTRY_EXEC":                  3,
+		"MESSAGE_SENTRY_EXIT_NOTIFY_PARENT":    4,
+		"MESSAGE_SENTRY_TASK_EXIT":             5,
+		"MESSAGE_SYSCALL_RAW":                  6,
+		"MESSAGE_SYSCALL_OPEN":                 7,
+		"MESSAGE_SYSCALL_CLOSE":                8,
+		"MESSAGE_SYSCALL_READ":                 9,
+		"MESSAGE_SYSCALL_CONNECT":              10,
+		"MESSAGE_SYSCALL_EXECVE":               11,
+		"MESSAGE_SYSCALL_SOCKET":               12,
+		"MESSAGE_SYSCALL_CHDIR":                13,
+		"MESSAGE_SYSCALL_SETID":                14,
+		"MESSAGE_SYSCALL_SETRESID":             15,
+		"MESSAGE_SYSCALL_PRLIMIT64":            16,
+		"MESSAGE_SYSCALL_PIPE":                 17,
+		"MESSAGE_SYSCALL_FCNTL":                18,
+		"MESSAGE_SYSCALL_DUP":                  19,
+		"MESSAGE_SYSCALL_SIGNALFD":             20,
+		"MESSAGE_SYSCALL_CHROOT":               21,
+		"MESSAGE_SYSCALL_EVENTFD":              22,
+		"MESSAGE_SYSCALL_CLONE":                23,
+		"MESSAGE_SYSCALL_BIND":                 24,
+		"MESSAGE_SYSCALL_ACCEPT":               25,
+		"MESSAGE_SYSCALL_TIMERFD_CREATE":       26,
+		"MESSAGE_SYSCALL_TIMERFD_SETTIME":      27,
+		"MESSAGE_SYSCALL_TIMERFD_GETTIME":      28,
+		"MESSAGE_SYSCALL_FORK":                 29,
+		"MESSAGE_SYSCALL_INOTIFY_INIT":         30,
+		"MESSAGE_SYSCALL_INOTIFY_ADD_WATCH":    31,
+		"MESSAGE_SYSCALL_INOTIFY_RM_WATCH":     32,
+		"MESSAGE_SYSCALL_SOCKETPAIR":           33,
+		"MESSAGE_SYSCALL_WRITE":                34,
+		"MESSAGE_SENTRY_MAPPED_FILE_TRUNCATED": 35,
+		"MESSAGE_SENTRY_TLS_PLAINTEXT":         36,
 	}
 )
 
@@ -454,7 +460,7 @@ var file_pkg_sentry_seccheck_points_common_proto_rawDesc = []byte{
 	0x74, 0x69, 0x61, 0x6c, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x77, 0x64, 0x18, 0x08, 0x20, 0x01,
 	0x28, 0x09, 0x52, 0x03, 0x63, 0x77, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x70, 0x72, 0x6f, 0x63, 0x65,
 	0x73, 0x73, 0x5f, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x70,
-	0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x4e, 0x61, 0x6d, 0x65, 0x2a, 0x8f, 0x08, 0x0a, 0x0b, 0x4d,
+	0x72, 0x6f, 0x63, 0x65, 0x73, 0x73, 0x4e, 0x61, 0x6d, 0x65, 0x2a, 0xdb, 0x08, 0x0a, 0x0b, 0x4d,
 	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70, 0x65, 0x12, 0x13, 0x0a, 0x0f, 0x4d, 0x45,
 	0x53, 0x53, 0x41, 0x47, 0x45, 0x5f, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12,
 	0x1b, 0x0a, 0x17, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x5f, 0x43, 0x4f, 0x4e, 0x54, 0x41,
@@ -519,8 +525,12 @@ var file_pkg_sentry_seccheck_points_common_proto_rawDesc = []byte{
 	0x20, 0x12, 0x1e, 0x0a, 0x1a, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x5f, 0x53, 0x59, 0x53,
 	0x43, 0x41, 0x4c, 0x4c, 0x5f, 0x53, 0x4f, 0x43, 0x4b, 0x45, 0x54, 0x50, 0x41, 0x49, 0x52, 0x10,
 	0x21, 0x12, 0x19, 0x0a, 0x15, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x5f, 0x53, 0x59, 0x53,
-	0x43, 0x41, 0x4c, 0x4c, 0x5f, 0x57, 0x52, 0x49, 0x54, 0x45, 0x10, 0x22, 0x62, 0x06, 0x70, 0x72,
-	0x6f, 0x74, 0x6f, 0x33,
+	0x43, 0x41, 0x4c, 0x4c, 0x5f, 0x57, 0x52, 0x49, 0x54, 0x45, 0x10, 0x22, 0x12, 0x28, 0x0a, 0x24,
+	0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x5f, 0x53, 0x45, 0x4e, 0x54, 0x52, 0x59, 0x5f, 0x4d,
+	0x41, 0x50, 0x50, 0x45, 0x44, 0x5f, 0x46, 0x49, 0x4c, 0x45, 0x5f, 0x54, 0x52, 0x55, 0x4e, 0x43,
+	0x41, 0x54, 0x45, 0x44, 0x10, 0x23, 0x12, 0x20, 0x0a, 0x1c, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47,
+	0x45, 0x5f, 0x53, 0x45, 0x4e, 0x54, 0x52, 0x59, 0x5f, 0x54, 0x4c, 0x53, 0x5f, 0x50, 0x4c, 0x41,
+	0x49, 0x4e, 0x54, 0x45, 0x58, 0x54, 0x10, 0x24, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -108,6 +108,8 @@ type Sink interface {
 	Execve(ctx context.Context, fields FieldSet, info *pb.ExecveInfo) error
 	ExitNotifyParent(ctx context.Context, fields FieldSet, info *pb.ExitNotifyParentInfo) error
 	TaskExit(context.Context, FieldSet, *pb.TaskExit) error
+	MappedFileTruncated(context.Context, FieldSet, *pb.MappedFileTruncated) error
+	TLSPlaintext(context.Context, FieldSet, *pb.TLSPlaintext) error
 
 	ContainerStart(context.Context, FieldSet, *pb.Start) error
 
@@ -169,6 +171,16 @@ func (SinkDefaults) TaskExit(context.Context, FieldSet, *pb.TaskExit) error {
 	return nil
 }
 
+// MappedFileTruncated implements Sink.MappedFileTruncated.
+func (SinkDefaults) MappedFileTruncated(context.Context, FieldSet, *pb.MappedFileTruncated) error {
+	return nil
+}
+
+// TLSPlaintext implements Sink.TLSPlaintext.
+func (SinkDefaults) TLSPlaintext(context.Context, FieldSet, *pb.TLSPlaintext) error {
+	return nil
+}
+
 // RawSyscall implements Sink.RawSyscall.
 func (SinkDefaults) RawSyscall(context.Context, FieldSet, *pb.Syscall) error {
 	return nil
@@ -246,6 +258,37 @@ func (s *State) AppendSink(c Sink, reqs []PointReq) {
 	}
 }
 
+// setPoints replaces the enabled points and their fields with reqs, keeping
+// the registered sinks.
+func (s *State) setPoints(reqs []PointReq) {
+	s.registrationMu.Lock()
+	defer s.registrationMu.Unlock()
+
+	var enabled [numPointBitmaskUint32s]uint32
+	s.pointFields = make(map[Point]FieldSet)
+	for _, req := range reqs {
+		word, bit := req.Pt/numPointsPerUint32, req.Pt%numPointsPerUint32
+		enabled[word] |= uint32(1) << bit
+		s.pointFields[req.Pt] = req.Fields
+	}
+	updateSyscalls := false
+	for i := range s.enabledPoints {
+		if s.enabledPoints[i].RacyLoad() == enabled[i] {
+			continue
+		}
+		s.enabledPoints[i].Store(enabled[i])
+		// We use i+1 here because we want to check the last bit that may have been changed within i.
+		if Point((i+1)*numPointsPerUint32) >= pointLengthBeforeSyscalls {
+			updateSyscalls = true
+		}
+	}
+	if updateSyscalls {
+		for _, listener := range s.syscallFlagListeners {
+			listener.UpdateSecCheck(s)
+		}
+	}
+}
+
 func (s *State) clearSink() {
 	s.registrationMu.Lock()
 	defer s.registrationMu.Unlock()
@@ -0,0 +1,133 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit defines a seccheck.Sink that evaluates the audit rules loaded
+// through NETLINK_AUDIT sockets on system calls, and sends the matching audit
+// records to the audit daemon running in the sandbox.
+//
+// The sink only sees the system calls of the points it's configured for, e.g.
+// "syscall/sysno/59/exit" or "syscall/openat/exit". Records are generated at
+// syscall exit; enter points are ignored.
+package audit
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/fd"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
+	pb "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/points/points_go_proto"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netlink/audit"
+	"google.golang.org/protobuf/proto"
+)
+
+const name = "audit"
+
+func init() {
+	seccheck.RegisterSink(seccheck.SinkDesc{
+		Name: name,
+		New:  new,
+	})
+}
+
+// sink is a seccheck.Sink that generates audit records.
+type sink struct {
+	seccheck.SinkDefaults
+}
+
+var _ seccheck.Sink = (*sink)(nil)
+
+func new(_ map[string]any, _ *fd.FD) (seccheck.Sink, error) {
+	return &sink{}, nil
+}
+
+// Name implements seccheck.Sink.Name.
+func (*sink) Name() string {
+	return name
+}
+
+// exitValue returns the value a system call returned to userspace.
+func exitValue(exit *pb.Exit) int64 {
+	if exit.GetErrorno() != 0 {
+		return -exit.GetErrorno()
+	}
+	return exit.GetResult()
+}
+
+// newEvent returns the audit event of a system call that exited, or nil if
+// there is no task or exit is nil.
+func newEvent(ctx context.Context, ctxData *pb.ContextData, sysno uint64, exit *pb.Exit) (*kernel.Task, *audit.Event) {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil || exit == nil {
+		return nil, nil
+	}
+	e := audit.NewEvent(t)
+	e.Cwd = ctxData.GetCwd()
+	e.HasSysno = true
+	e.Sysno = sysno
+	e.HasExit = true
+	e.Exit = exitValue(exit)
+	return t, e
+}
+
+// RawSyscall implements seccheck.Sink.RawSyscall.
+func (*sink) RawSyscall(ctx context.Context, _ seccheck.FieldSet, info *pb.Syscall) error {
+	t, e := newEvent(ctx, info.GetContextData(), info.GetSysno(), info.GetExit())
+	if e == nil {
+		return nil
+	}
+	e.HasArgs = true
+	e.Args = [4]uint64{info.GetArg1(), info.GetArg2(), info.GetArg3(), info.GetArg4()}
+	audit.LogSyscall(t, e)
+	return nil
+}
+
+// Interfaces implemented by the messages of schematized syscall points that
+// have the corresponding field.
+type (
+	sysnoGetter    interface{ GetSysno() uint64 }
+	exitGetter     interface{ GetExit() *pb.Exit }
+	pathnameGetter interface{ GetPathname() string }
+	fdPathGetter   interface{ GetFdPath() string }
+	argvGetter     interface{ GetArgv() []string }
+)
+
+// Syscall implements seccheck.Sink.Syscall.
+func (*sink) Syscall(ctx context.Context, _ seccheck.FieldSet, ctxData *pb.ContextData, _ pb.MessageType, msg proto.Message) error {
+	sg, ok := msg.(sysnoGetter)
+	if !ok {
+		return nil
+	}
+	eg, ok := msg.(exitGetter)
+	if !ok {
+		return nil
+	}
+	t, e := newEvent(ctx, ctxData, sg.GetSysno(), eg.GetExit())
+	if e == nil {
+		return nil
+	}
+	if pg, ok := msg.(pathnameGetter); ok {
+		e.Path = pg.GetPathname()
+	}
+	if fg, ok := msg.(fdPathGetter); ok && e.Path == "" {
+		e.Path = fg.GetFdPath()
+	}
+	if ag, ok := msg.(argvGetter); ok {
+		e.Argv = ag.GetArgv()
+		if e.Argv == nil {
+			e.Argv = []string{}
+		}
+	}
+	audit.LogSyscall(t, e)
+	return nil
+}
@@ -0,0 +1,317 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recorder defines a seccheck.Sink that records points, and network
+// packets, in a size-bounded ring file on the host, akin to a flight
+// recorder. The ring can be read back with Scan.
+package recorder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/fd"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
+	pb "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/points/points_go_proto"
+	"golang.org/x/sys/unix"
+	"google.golang.org/protobuf/proto"
+)
+
+// Name is the name of the sink.
+const Name = "recorder"
+
+func init() {
+	seccheck.RegisterSink(seccheck.SinkDesc{
+		Name:  Name,
+		Setup: setupSink,
+		New:   new,
+	})
+}
+
+// active is the recorder that network packets are recorded to, if any.
+var active atomic.Pointer[recorder]
+
+// recorder appends points to a ring file, see ring.go for its format. Points
+// that don't fit in a block are dropped.
+type recorder struct {
+	seccheck.SinkDefaults
+
+	endpoint  *fd.FD
+	numBlocks uint32
+
+	droppedCount atomicbitops.Uint32
+
+	mu sync.Mutex
+
+	// block is the index of the block being written.
+	//
+	// +checklocks:mu
+	block uint32
+
+	// hdr is the header of the block being written.
+	//
+	// +checklocks:mu
+	hdr blockHeader
+
+	// buf is a scratch buffer used to write records.
+	//
+	// +checklocks:mu
+	buf []byte
+}
+
+var _ seccheck.Sink = (*recorder)(nil)
+
+// setupSink opens the ring file at config["path"], see Open. Its size can be
+// set with config["size"], in bytes.
+func setupSink(config map[string]any) (*os.File, error) {
+	pathOpaque, ok := config["path"]
+	if !ok {
+		return nil, fmt.Errorf("path not present in configuration")
+	}
+	path, ok := pathOpaque.(string)
+	if !ok {
+		return nil, fmt.Errorf("path %q is not a string", pathOpaque)
+	}
+	size := uint64(DefaultSize)
+	if sizeOpaque, ok := config["size"]; ok {
+		sizeFloat, ok := sizeOpaque.(float64)
+		if !ok || sizeFloat < 0 || float64(uint64(sizeFloat)) != sizeFloat {
+			return nil, fmt.Errorf("size %q is not a positive int", sizeOpaque)
+		}
+		size = uint64(sizeFloat)
+	}
+	return Open(path, size)
+}
+
+// fdReaderAt implements io.ReaderAt for a file descriptor.
+type fdReaderAt int
+
+// ReadAt implements io.ReaderAt.
+func (f fdReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	n, err := unix.Pread(int(f), b, off)
+	if err != nil {
+		return 0, err
+	}
+	if n < len(b) {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+// new creates a new recorder sink, which appends records after the newest
+// block of the ring.
+func new(_ map[string]any, endpoint *fd.FD) (seccheck.Sink, error) {
+	if endpoint == nil {
+		return nil, fmt.Errorf("recorder sink requires an endpoint")
+	}
+	fhdr, err := readFileHeader(fdReaderAt(endpoint.FD()))
+	if err != nil {
+		return nil, err
+	}
+	hdrs, err := readBlockHeaders(fdReaderAt(endpoint.FD()), fhdr.NumBlocks)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{
+		endpoint:  endpoint,
+		numBlocks: fhdr.NumBlocks,
+		buf:       make([]byte, 0, blockSize),
+	}
+	// Start with a full block, so that the first record starts the block
+	// following the newest one.
+	r.block = fhdr.NumBlocks - 1
+	r.hdr.Used = blockSize
+	for i, hdr := range hdrs {
+		if hdr.valid() && hdr.Seq > r.hdr.Seq {
+			r.block = uint32(i)
+			r.hdr.Seq = hdr.Seq
+		}
+	}
+	active.Store(r)
+	log.Debugf("Recorder sink created, endpoint FD: %d, %d blocks", endpoint.FD(), fhdr.NumBlocks)
+	return r, nil
+}
+
+// NewPacketWriter returns a writer of pcap packet records to the active
+// recorder, or nil if there isn't one. The first write, which is the pcap file
+// header written by sniffer.NewWithWriter, is discarded. Writes never fail, as
+// packets are dropped if they can't be recorded.
+func NewPacketWriter() io.Writer {
+	if active.Load() == nil {
+		return nil
+	}
+	return &packetWriter{}
+}
+
+type packetWriter struct {
+	wroteHeader bool
+}
+
+// Write implements io.Writer.
+func (w *packetWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		return len(b), nil
+	}
+	if r := active.Load(); r != nil {
+		r.append(RecordPacket, b)
+	}
+	return len(b), nil
+}
+
+func (*recorder) Name() string {
+	return Name
+}
+
+func (r *recorder) Status() seccheck.SinkStatus {
+	return seccheck.SinkStatus{
+		DroppedCount: uint64(r.droppedCount.Load()),
+	}
+}
+
+// Stop implements seccheck.Sink.
+func (r *recorder) Stop() {
+	active.CompareAndSwap(r, nil)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endpoint.Close()
+}
+
+// append appends a record of type typ with payload to the ring.
+func (r *recorder) append(typ uint16, payload []byte) {
+	if len(payload) > maxRecordSize {
+		r.droppedCount.Add(1)
+		return
+	}
+	now := time.Now().UnixNano()
+	size := uint32(recordHeaderSize + len(payload))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.endpoint.FD() < 0 {
+		r.droppedCount.Add(1)
+		return
+	}
+	var hdrBuf [blockHeaderSize]byte
+	if r.hdr.Used+size > blockSize {
+		// Start the next block. Its header is written first to invalidate the
+		// records it held.
+		r.block = (r.block + 1) % r.numBlocks
+		r.hdr = blockHeader{
+			Magic: blockMagic,
+			Used:  blockHeaderSize,
+			Seq:   r.hdr.Seq + 1,
+			First: now,
+			Last:  now,
+		}
+		r.hdr.marshal(hdrBuf[:])
+		if _, err := unix.Pwrite(r.endpoint.FD(), hdrBuf[:], blockOffset(r.block)); err != nil {
+			log.Debugf("Writing block header failed, dropping record: %v", err)
+			r.droppedCount.Add(1)
+			return
+		}
+	}
+
+	rec := r.buf[:recordHeaderSize]
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint16(rec[4:6], typ)
+	binary.LittleEndian.PutUint16(rec[6:8], 0)
+	binary.LittleEndian.PutUint64(rec[8:16], uint64(now))
+	rec = append(rec, payload...)
+	if _, err := unix.Pwrite(r.endpoint.FD(), rec, blockOffset(r.block)+int64(r.hdr.Used)); err != nil {
+		log.Debugf("Writing record failed, dropping it: %v", err)
+		r.droppedCount.Add(1)
+		return
+	}
+
+	// Publish the record by updating the block header.
+	r.hdr.Used += size
+	r.hdr.Last = now
+	r.hdr.marshal(hdrBuf[:])
+	if _, err := unix.Pwrite(r.endpoint.FD(), hdrBuf[:], blockOffset(r.block)); err != nil {
+		log.Debugf("Writing block header failed: %v", err)
+		r.droppedCount.Add(1)
+	}
+}
+
+func (r *recorder) write(msg proto.Message, msgType pb.MessageType) {
+	out, err := proto.Marshal(msg)
+	if err != nil {
+		log.Debugf("Marshal(%+v): %v", msg, err)
+		return
+	}
+	r.append(uint16(msgType), out)
+}
+
+// Clone implements seccheck.Sink.
+func (r *recorder) Clone(_ context.Context, _ seccheck.FieldSet, info *pb.CloneInfo) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_CLONE)
+	return nil
+}
+
+// Execve implements seccheck.Sink.
+func (r *recorder) Execve(_ context.Context, _ seccheck.FieldSet, info *pb.ExecveInfo) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_EXEC)
+	return nil
+}
+
+// ExitNotifyParent implements seccheck.Sink.
+func (r *recorder) ExitNotifyParent(_ context.Context, _ seccheck.FieldSet, info *pb.ExitNotifyParentInfo) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_EXIT_NOTIFY_PARENT)
+	return nil
+}
+
+// TaskExit implements seccheck.Sink.
+func (r *recorder) TaskExit(_ context.Context, _ seccheck.FieldSet, info *pb.TaskExit) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_TASK_EXIT)
+	return nil
+}
+
+// MappedFileTruncated implements seccheck.Sink.
+func (r *recorder) MappedFileTruncated(_ context.Context, _ seccheck.FieldSet, info *pb.MappedFileTruncated) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_MAPPED_FILE_TRUNCATED)
+	return nil
+}
+
+// TLSPlaintext implements seccheck.Sink.
+func (r *recorder) TLSPlaintext(_ context.Context, _ seccheck.FieldSet, info *pb.TLSPlaintext) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_TLS_PLAINTEXT)
+	return nil
+}
+
+// ContainerStart implements seccheck.Sink.
+func (r *recorder) ContainerStart(_ context.Context, _ seccheck.FieldSet, info *pb.Start) error {
+	r.write(info, pb.MessageType_MESSAGE_CONTAINER_START)
+	return nil
+}
+
+// RawSyscall implements seccheck.Sink.
+func (r *recorder) RawSyscall(_ context.Context, _ seccheck.FieldSet, info *pb.Syscall) error {
+	r.write(info, pb.MessageType_MESSAGE_SYSCALL_RAW)
+	return nil
+}
+
+// Syscall implements seccheck.Sink.
+func (r *recorder) Syscall(_ context.Context, _ seccheck.FieldSet, _ *pb.ContextData, msgType pb.MessageType, msg proto.Message) error {
+	r.write(msg, msgType)
+	return nil
+}
@@ -0,0 +1,295 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recorder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// The ring is a file made of a header followed by fixed-size blocks, which
+// are written in turn, overwriting the oldest block once the ring is full:
+//
+//	+-------------+---------+---------+-----+---------+
+//	| file header | block 0 | block 1 | ... | block N |
+//	+-------------+---------+---------+-----+---------+
+//
+// Each block starts with a header holding its sequence number and the time
+// range of its records, which serves as the index of the ring: readers only
+// read the blocks overlapping the time window they are interested in.
+// Records never span blocks:
+//
+//	0 ------ 32 ----- 48 ------- 64 ---------- 128 ----------+
+//	| Length | Type   | Reserved | Time (nanos) | Payload... |
+//	+-- 32 --+-- 16 --+--- 16 ---+----- 64 -----+------------+
+//
+// The payload of records is a serialized point proto, whose pb.MessageType is
+// the record type, or a pcap packet record for RecordPacket records.
+const (
+	fileMagic   = 0x52464f47 // "GOFR"
+	blockMagic  = 0x4b4c4252 // "RBLK"
+	ringVersion = 1
+
+	fileHeaderSize   = 4096
+	blockHeaderSize  = 32
+	recordHeaderSize = 16
+
+	// blockSize is the size of each block of the ring, including its header.
+	blockSize = 64 << 10
+
+	// minBlocks is the minimum number of blocks of a ring, so that the
+	// block being written never holds all the records of the ring.
+	minBlocks = 2
+
+	// maxRecordSize is the maximum size of the payload of a record.
+	maxRecordSize = blockSize - blockHeaderSize - recordHeaderSize
+)
+
+// RecordPacket is the type of records holding network packets.
+const RecordPacket = 0xffff
+
+// DefaultSize is the default size of a ring, in bytes.
+const DefaultSize = 256 << 20
+
+// PacketSnapLen is the maximum number of bytes of each packet that are
+// recorded.
+const PacketSnapLen = 4096
+
+type fileHeader struct {
+	Magic     uint32
+	Version   uint32
+	BlockSize uint32
+	NumBlocks uint32
+}
+
+type blockHeader struct {
+	Magic uint32
+	// Used is the number of bytes of the block in use, including the header.
+	Used uint32
+	// Seq is the sequence number of the block. It's zero if the block was
+	// never written.
+	Seq uint64
+	// First and Last are the times of the first and last records of the
+	// block, in nanoseconds since the Unix epoch.
+	First int64
+	Last  int64
+}
+
+func (h *fileHeader) marshal() []byte {
+	b := make([]byte, fileHeaderSize)
+	binary.LittleEndian.PutUint32(b[0:4], h.Magic)
+	binary.LittleEndian.PutUint32(b[4:8], h.Version)
+	binary.LittleEndian.PutUint32(b[8:12], h.BlockSize)
+	binary.LittleEndian.PutUint32(b[12:16], h.NumBlocks)
+	return b
+}
+
+func (h *fileHeader) unmarshal(b []byte) {
+	h.Magic = binary.LittleEndian.Uint32(b[0:4])
+	h.Version = binary.LittleEndian.Uint32(b[4:8])
+	h.BlockSize = binary.LittleEndian.Uint32(b[8:12])
+	h.NumBlocks = binary.LittleEndian.Uint32(b[12:16])
+}
+
+func (h *blockHeader) marshal(b []byte) {
+	binary.LittleEndian.PutUint32(b[0:4], h.Magic)
+	binary.LittleEndian.PutUint32(b[4:8], h.Used)
+	binary.LittleEndian.PutUint64(b[8:16], h.Seq)
+	binary.LittleEndian.PutUint64(b[16:24], uint64(h.First))
+	binary.LittleEndian.PutUint64(b[24:32], uint64(h.Last))
+}
+
+func (h *blockHeader) unmarshal(b []byte) {
+	h.Magic = binary.LittleEndian.Uint32(b[0:4])
+	h.Used = binary.LittleEndian.Uint32(b[4:8])
+	h.Seq = binary.LittleEndian.Uint64(b[8:16])
+	h.First = int64(binary.LittleEndian.Uint64(b[16:24]))
+	h.Last = int64(binary.LittleEndian.Uint64(b[24:32]))
+}
+
+// valid returns true if the block was written and its header is consistent.
+func (h *blockHeader) valid() bool {
+	return h.Magic == blockMagic && h.Seq != 0 && h.Used >= blockHeaderSize && h.Used <= blockSize
+}
+
+func blockOffset(i uint32) int64 {
+	return fileHeaderSize + int64(i)*blockSize
+}
+
+func readFileHeader(r io.ReaderAt) (fileHeader, error) {
+	b := make([]byte, fileHeaderSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return fileHeader{}, fmt.Errorf("reading ring header: %w", err)
+	}
+	var hdr fileHeader
+	hdr.unmarshal(b)
+	if hdr.Magic != fileMagic {
+		return fileHeader{}, fmt.Errorf("not a flight recorder ring")
+	}
+	if hdr.Version != ringVersion {
+		return fileHeader{}, fmt.Errorf("unsupported ring version %d", hdr.Version)
+	}
+	if hdr.BlockSize != blockSize || hdr.NumBlocks < minBlocks {
+		return fileHeader{}, fmt.Errorf("invalid ring geometry: %d blocks of %d bytes", hdr.NumBlocks, hdr.BlockSize)
+	}
+	return hdr, nil
+}
+
+func readBlockHeaders(r io.ReaderAt, numBlocks uint32) ([]blockHeader, error) {
+	hdrs := make([]blockHeader, numBlocks)
+	b := make([]byte, blockHeaderSize)
+	for i := range hdrs {
+		if _, err := r.ReadAt(b, blockOffset(uint32(i))); err != nil {
+			return nil, fmt.Errorf("reading header of block %d: %w", i, err)
+		}
+		hdrs[i].unmarshal(b)
+	}
+	return hdrs, nil
+}
+
+// Open opens the ring at path, creating it with size bytes if it doesn't
+// exist. An existing ring is reused if it has the same size, so that records
+// are appended to it, and recreated otherwise. The caller is responsible for
+// closing the returned file.
+func Open(path string, size uint64) (*os.File, error) {
+	const minSize = fileHeaderSize + minBlocks*blockSize
+	if size < minSize {
+		return nil, fmt.Errorf("flight recorder size must be at least %d bytes, got %d", minSize, size)
+	}
+	numBlocks := (size - fileHeaderSize) / blockSize
+	if numBlocks > 1<<32-1 {
+		return nil, fmt.Errorf("flight recorder size %d is too large", size)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if hdr, err := readFileHeader(f); err == nil && hdr.NumBlocks == uint32(numBlocks) {
+		return f, nil
+	}
+	hdr := fileHeader{
+		Magic:     fileMagic,
+		Version:   ringVersion,
+		BlockSize: blockSize,
+		NumBlocks: uint32(numBlocks),
+	}
+	// Truncating the file first discards all blocks of the old ring.
+	if err := f.Truncate(0); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("truncating %q: %w", path, err)
+	}
+	if err := f.Truncate(blockOffset(uint32(numBlocks))); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("resizing %q: %w", path, err)
+	}
+	if _, err := f.WriteAt(hdr.marshal(), 0); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("writing header of %q: %w", path, err)
+	}
+	return f, nil
+}
+
+// Record is a record read from a ring.
+type Record struct {
+	// Type is the pb.MessageType of the payload, or RecordPacket.
+	Type uint16
+	// Time is when the record was written.
+	Time time.Time
+	// Payload is the serialized point or pcap packet record.
+	Payload []byte
+}
+
+// Scan calls fn with the records of the ring r written within [since, until],
+// oldest first. A zero since or until leaves the window unbounded on that
+// side. Blocks that are overwritten while being read are skipped, since the
+// ring may be written concurrently.
+func Scan(r io.ReaderAt, since, until time.Time, fn func(Record) error) error {
+	fhdr, err := readFileHeader(r)
+	if err != nil {
+		return err
+	}
+	hdrs, err := readBlockHeaders(r, fhdr.NumBlocks)
+	if err != nil {
+		return err
+	}
+	var blocks []uint32
+	for i, hdr := range hdrs {
+		if !hdr.valid() || hdr.Used == blockHeaderSize {
+			continue
+		}
+		if !since.IsZero() && hdr.Last < since.UnixNano() {
+			continue
+		}
+		if !until.IsZero() && hdr.First > until.UnixNano() {
+			continue
+		}
+		blocks = append(blocks, uint32(i))
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return hdrs[blocks[i]].Seq < hdrs[blocks[j]].Seq
+	})
+
+	buf := make([]byte, blockSize)
+	for _, i := range blocks {
+		b := buf[:hdrs[i].Used]
+		if _, err := r.ReadAt(b, blockOffset(i)); err != nil {
+			return fmt.Errorf("reading block %d: %w", i, err)
+		}
+		var hdr blockHeader
+		hdr.unmarshal(b)
+		if hdr.Seq != hdrs[i].Seq {
+			// The block was reused since its header was read.
+			continue
+		}
+		for off := uint32(blockHeaderSize); off+recordHeaderSize <= uint32(len(b)); {
+			length := binary.LittleEndian.Uint32(b[off : off+4])
+			end := off + recordHeaderSize + length
+			if end > uint32(len(b)) {
+				return fmt.Errorf("corrupted record at offset %d of block %d", off, i)
+			}
+			nanos := int64(binary.LittleEndian.Uint64(b[off+8 : off+16]))
+			if (since.IsZero() || nanos >= since.UnixNano()) && (until.IsZero() || nanos <= until.UnixNano()) {
+				rec := Record{
+					Type:    binary.LittleEndian.Uint16(b[off+4 : off+6]),
+					Time:    time.Unix(0, nanos),
+					Payload: append([]byte(nil), b[off+recordHeaderSize:end]...),
+				}
+				if err := fn(rec); err != nil {
+					return err
+				}
+			}
+			off = end
+		}
+	}
+	return nil
+}
+
+// WritePCAPHeader writes the header of a pcap file holding the payloads of
+// RecordPacket records to w.
+func WritePCAPHeader(w io.Writer) error {
+	const linkTypeRaw = 101
+	var b [24]byte
+	binary.LittleEndian.PutUint32(b[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(b[4:6], 2)
+	binary.LittleEndian.PutUint16(b[6:8], 4)
+	binary.LittleEndian.PutUint32(b[16:20], PacketSnapLen)
+	binary.LittleEndian.PutUint32(b[20:24], linkTypeRaw)
+	_, err := w.Write(b[:])
+	return err
+}
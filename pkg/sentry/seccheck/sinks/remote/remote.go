@@ -265,6 +265,18 @@ func (r *remote) TaskExit(_ context.Context, _ seccheck.FieldSet, info *pb.TaskE
 	return nil
 }
 
+// MappedFileTruncated implements seccheck.Sink.
+func (r *remote) MappedFileTruncated(_ context.Context, _ seccheck.FieldSet, info *pb.MappedFileTruncated) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_MAPPED_FILE_TRUNCATED)
+	return nil
+}
+
+// TLSPlaintext implements seccheck.Sink.
+func (r *remote) TLSPlaintext(_ context.Context, _ seccheck.FieldSet, info *pb.TLSPlaintext) error {
+	r.write(info, pb.MessageType_MESSAGE_SENTRY_TLS_PLAINTEXT)
+	return nil
+}
+
 // ContainerStart implements seccheck.Sink.
 func (r *remote) ContainerStart(_ context.Context, _ seccheck.FieldSet, info *pb.Start) error {
 	r.write(info, pb.MessageType_MESSAGE_CONTAINER_START)
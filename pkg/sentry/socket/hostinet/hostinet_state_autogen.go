@@ -44,8 +44,6 @@ func (s *Socket) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(10, &s.recvClosed)
 }
 
-func (s *Socket) afterLoad() {}
-
 // +checklocksignore
 func (s *Socket) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &s.vfsfd)
@@ -59,6 +57,7 @@ func (s *Socket) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(8, &s.queue)
 	stateSourceObject.Load(9, &s.fd)
 	stateSourceObject.Load(10, &s.recvClosed)
+	stateSourceObject.AfterLoad(s.afterLoad)
 }
 
 func init() {
@@ -0,0 +1,138 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hostinet
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
+	"github.com/talismancer/gvisor-ligolo/pkg/syserr"
+	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
+	"golang.org/x/sys/unix"
+)
+
+// afterLoad is called by stateify.
+//
+// Host sockets can't be saved, they are closed when the sandbox exits after a
+// checkpoint. A restored socket is not backed by a host socket and behaves as
+// follows:
+//   - Stream sockets behave as if the connection was reset by the peer: the
+//     next read, write, connect or SO_ERROR reports ECONNRESET, after which
+//     reads return EOF and writes fail with EPIPE.
+//   - Other sockets never receive data, and writes fail with ENOTCONN.
+//   - Accept, bind and listen fail with EINVAL, and setting socket options
+//     has no effect.
+func (s *Socket) afterLoad() {
+	s.fd = -1
+	s.resetPending.Store(s.stype == linux.SOCK_STREAM)
+}
+
+// closed returns true if s is not backed by a host socket.
+func (s *Socket) closed() bool {
+	return s.fd < 0
+}
+
+// takeResetError returns ECONNRESET if it hasn't been reported yet.
+//
+// Preconditions: s.closed().
+func (s *Socket) takeResetError() *syserr.Error {
+	if s.resetPending.Swap(false) {
+		return syserr.ErrConnectionReset
+	}
+	return nil
+}
+
+// closedReadError returns the error for reading from a closed socket after
+// ECONNRESET has been reported. A nil error means EOF.
+//
+// Preconditions: s.closed().
+func (s *Socket) closedReadError() error {
+	if s.stype == linux.SOCK_STREAM {
+		return nil
+	}
+	return linuxerr.ErrWouldBlock
+}
+
+// closedWriteError returns the error for writing to a closed socket.
+//
+// Preconditions: s.closed().
+func (s *Socket) closedWriteError() *syserr.Error {
+	if err := s.takeResetError(); err != nil {
+		return err
+	}
+	if s.stype == linux.SOCK_STREAM {
+		return syserr.ErrBrokenPipe
+	}
+	return syserr.ErrNotConnected
+}
+
+// closedReadiness implements waiter.Waitable.Readiness for closed sockets.
+//
+// Preconditions: s.closed().
+func (s *Socket) closedReadiness(mask waiter.EventMask) waiter.EventMask {
+	ready := waiter.WritableEvents
+	if s.stype == linux.SOCK_STREAM {
+		ready |= waiter.ReadableEvents | waiter.EventHUp
+	}
+	if s.resetPending.Load() {
+		ready |= waiter.EventErr
+	}
+	return mask & ready
+}
+
+// closedSockOpt fills opt with the value of a socket option of a closed
+// socket.
+//
+// Preconditions: s.closed().
+func (s *Socket) closedSockOpt(level, name int, opt []byte) []byte {
+	for i := range opt {
+		opt[i] = 0
+	}
+	if level != linux.SOL_SOCKET || len(opt) < 4 {
+		return opt
+	}
+	var val int32
+	switch name {
+	case linux.SO_ERROR:
+		if s.takeResetError() != nil {
+			val = int32(unix.ECONNRESET)
+		}
+	case linux.SO_TYPE:
+		val = int32(s.stype)
+	case linux.SO_DOMAIN:
+		val = int32(s.family)
+	case linux.SO_PROTOCOL:
+		val = int32(s.protocol)
+	}
+	hostarch.ByteOrder.PutUint32(opt, uint32(val))
+	return opt
+}
+
+// closedSockName returns the unspecified address of the socket's family.
+//
+// Preconditions: s.closed().
+func (s *Socket) closedSockName() (linux.SockAddr, uint32) {
+	switch s.family {
+	case linux.AF_INET:
+		addr := &linux.SockAddrInet{Family: linux.AF_INET}
+		return addr, uint32(addr.SizeBytes())
+	case linux.AF_INET6:
+		addr := &linux.SockAddrInet6{Family: linux.AF_INET6}
+		return addr, uint32(addr.SizeBytes())
+	default:
+		addr := &linux.SockAddrLink{Family: linux.AF_PACKET}
+		return addr, uint32(addr.SizeBytes())
+	}
+}
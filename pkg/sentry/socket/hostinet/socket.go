@@ -21,6 +21,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/fdaudit"
 	"github.com/talismancer/gvisor-ligolo/pkg/fdnotifier"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/marshal/primitive"
@@ -50,6 +51,9 @@ const (
 	maxControlLen = 1024
 )
 
+// hostFDs tracks the host FDs of sockets, see fdaudit.
+var hostFDs = fdaudit.NewOwner("hostinet")
+
 // AllowedSocketType is a tuple of socket family, type, and protocol.
 type AllowedSocketType struct {
 	Family int
@@ -124,14 +128,19 @@ type Socket struct {
 	// recvClosed indicates that the socket has been shutdown for reading
 	// (SHUT_RD or SHUT_RDWR).
 	recvClosed atomicbitops.Bool
+
+	// resetPending indicates that ECONNRESET must be reported by the next
+	// operation on a socket whose host socket was closed by save/restore. See
+	// afterLoad.
+	resetPending atomicbitops.Bool `state:"nosave"`
 }
 
 var _ = socket.Socket(&Socket{})
 
-func newSocket(t *kernel.Task, family int, stype linux.SockType, protocol int, fd int, flags uint32) (*vfs.FileDescription, *syserr.Error) {
-	mnt := t.Kernel().SocketMount()
-	d := sockfs.NewDentry(t, mnt)
-	defer d.DecRef(t)
+func newSocket(ctx context.Context, family int, stype linux.SockType, protocol int, fd int, flags uint32) (*vfs.FileDescription, *syserr.Error) {
+	mnt := kernel.KernelFromContext(ctx).SocketMount()
+	d := sockfs.NewDentry(ctx, mnt)
+	defer d.DecRef(ctx)
 
 	s := &Socket{
 		family:   family,
@@ -152,13 +161,29 @@ func newSocket(t *kernel.Task, family int, stype linux.SockType, protocol int, f
 		fdnotifier.RemoveFD(int32(s.fd))
 		return nil, syserr.FromError(err)
 	}
+	hostFDs.Add(fd)
+	return vfsfd, nil
+}
+
+// ImportSocket returns a socket backed by the host socket fd, which was
+// created outside of the sandbox, e.g. a listening socket passed to the
+// application. fd must be non-blocking; ImportSocket takes ownership of it.
+func ImportSocket(ctx context.Context, family int, stype linux.SockType, protocol int, fd int) (*vfs.FileDescription, error) {
+	vfsfd, err := newSocket(ctx, family, stype, protocol, fd, 0)
+	if err != nil {
+		return nil, err.ToError()
+	}
 	return vfsfd, nil
 }
 
 // Release implements vfs.FileDescriptionImpl.Release.
 func (s *Socket) Release(ctx context.Context) {
 	kernel.KernelFromContext(ctx).DeleteSocket(&s.vfsfd)
+	if s.closed() {
+		return
+	}
 	fdnotifier.RemoveFD(int32(s.fd))
+	hostFDs.Remove(s.fd)
 	_ = unix.Close(s.fd)
 }
 
@@ -169,6 +194,9 @@ func (s *Socket) Epollable() bool {
 
 // Ioctl implements vfs.FileDescriptionImpl.
 func (s *Socket) Ioctl(ctx context.Context, uio usermem.IO, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
+	if s.closed() {
+		return 0, linuxerr.ENOTCONN
+	}
 	return ioctl(ctx, s.fd, uio, sysno, args)
 }
 
@@ -185,6 +213,13 @@ func (s *Socket) Read(ctx context.Context, dst usermem.IOSequence, opts vfs.Read
 		return 0, linuxerr.EOPNOTSUPP
 	}
 
+	if s.closed() {
+		if err := s.takeResetError(); err != nil {
+			return 0, err.ToError()
+		}
+		return 0, s.closedReadError()
+	}
+
 	reader := hostfd.GetReadWriterAt(int32(s.fd), -1, opts.Flags)
 	defer hostfd.PutReadWriterAt(reader)
 	n, err := dst.CopyOutFrom(ctx, reader)
@@ -209,6 +244,10 @@ func (s *Socket) Write(ctx context.Context, src usermem.IOSequence, opts vfs.Wri
 		return 0, linuxerr.EOPNOTSUPP
 	}
 
+	if s.closed() {
+		return 0, s.closedWriteError().ToError()
+	}
+
 	writer := hostfd.GetReadWriterAt(int32(s.fd), -1, opts.Flags)
 	defer hostfd.PutReadWriterAt(writer)
 	n, err := src.CopyInTo(ctx, writer)
@@ -286,12 +325,18 @@ func (p *socketProvider) Pair(t *kernel.Task, stype linux.SockType, protocol int
 
 // Readiness implements waiter.Waitable.Readiness.
 func (s *Socket) Readiness(mask waiter.EventMask) waiter.EventMask {
+	if s.closed() {
+		return s.closedReadiness(mask)
+	}
 	return fdnotifier.NonBlockingPoll(int32(s.fd), mask)
 }
 
 // EventRegister implements waiter.Waitable.EventRegister.
 func (s *Socket) EventRegister(e *waiter.Entry) error {
 	s.queue.EventRegister(e)
+	if s.closed() {
+		return nil
+	}
 	if err := fdnotifier.UpdateFD(int32(s.fd)); err != nil {
 		s.queue.EventUnregister(e)
 		return err
@@ -302,6 +347,9 @@ func (s *Socket) EventRegister(e *waiter.Entry) error {
 // EventUnregister implements waiter.Waitable.EventUnregister.
 func (s *Socket) EventUnregister(e *waiter.Entry) {
 	s.queue.EventUnregister(e)
+	if s.closed() {
+		return
+	}
 	if err := fdnotifier.UpdateFD(int32(s.fd)); err != nil {
 		panic(err)
 	}
@@ -309,6 +357,12 @@ func (s *Socket) EventUnregister(e *waiter.Entry) {
 
 // Connect implements socket.Socket.Connect.
 func (s *Socket) Connect(t *kernel.Task, sockaddr []byte, blocking bool) *syserr.Error {
+	if s.closed() {
+		if err := s.takeResetError(); err != nil {
+			return err
+		}
+		return syserr.ErrInvalidArgument
+	}
 	if len(sockaddr) > sizeofSockaddr {
 		sockaddr = sockaddr[:sizeofSockaddr]
 	}
@@ -371,6 +425,9 @@ func (s *Socket) Connect(t *kernel.Task, sockaddr []byte, blocking bool) *syserr
 
 // Accept implements socket.Socket.Accept.
 func (s *Socket) Accept(t *kernel.Task, peerRequested bool, flags int, blocking bool) (int32, linux.SockAddr, uint32, *syserr.Error) {
+	if s.closed() {
+		return 0, nil, 0, syserr.ErrInvalidArgument
+	}
 	var peerAddr linux.SockAddr
 	var peerAddrBuf []byte
 	var peerAddrlen uint32
@@ -431,6 +488,9 @@ func (s *Socket) Accept(t *kernel.Task, peerRequested bool, flags int, blocking
 
 // Bind implements socket.Socket.Bind.
 func (s *Socket) Bind(_ *kernel.Task, sockaddr []byte) *syserr.Error {
+	if s.closed() {
+		return syserr.ErrInvalidArgument
+	}
 	if len(sockaddr) > sizeofSockaddr {
 		sockaddr = sockaddr[:sizeofSockaddr]
 	}
@@ -444,6 +504,9 @@ func (s *Socket) Bind(_ *kernel.Task, sockaddr []byte) *syserr.Error {
 
 // Listen implements socket.Socket.Listen.
 func (s *Socket) Listen(_ *kernel.Task, backlog int) *syserr.Error {
+	if s.closed() {
+		return syserr.ErrInvalidArgument
+	}
 	return syserr.FromError(unix.Listen(s.fd, backlog))
 }
 
@@ -455,6 +518,9 @@ func (s *Socket) Shutdown(_ *kernel.Task, how int) *syserr.Error {
 		s.recvClosed.Store(true)
 		fallthrough
 	case unix.SHUT_WR:
+		if s.closed() {
+			return syserr.ErrNotConnected
+		}
 		return syserr.FromError(unix.Shutdown(s.fd, how))
 	default:
 		return syserr.ErrInvalidArgument
@@ -462,6 +528,10 @@ func (s *Socket) Shutdown(_ *kernel.Task, how int) *syserr.Error {
 }
 
 func (s *Socket) recvMsgFromHost(iovs []unix.Iovec, flags int, senderRequested bool, controlLen uint64) (uint64, int, []byte, []byte, error) {
+	if s.closed() {
+		return 0 /* n */, 0 /* mFlags */, nil /* senderAddrBuf */, nil /* controlBuf */, s.closedReadError()
+	}
+
 	// We always do a non-blocking recv*().
 	sysflags := flags | unix.MSG_DONTWAIT
 
@@ -507,6 +577,12 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 		return 0, 0, nil, 0, socket.ControlMessages{}, syserr.ErrInvalidArgument
 	}
 
+	if s.closed() {
+		if err := s.takeResetError(); err != nil {
+			return 0, 0, nil, 0, socket.ControlMessages{}, err
+		}
+	}
+
 	var senderAddrBuf []byte
 	var controlBuf []byte
 	var msgFlags int
@@ -692,6 +768,10 @@ func (s *Socket) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flag
 		return 0, syserr.ErrInvalidArgument
 	}
 
+	if s.closed() {
+		return 0, s.closedWriteError()
+	}
+
 	// If the src is zero-length, call SENDTO directly with a null buffer in
 	// order to generate poll/epoll notifications.
 	if src.NumBytes() == 0 {
@@ -787,6 +867,12 @@ func translateIOSyscallError(err error) error {
 
 // State implements socket.Socket.State.
 func (s *Socket) State() uint32 {
+	if s.closed() {
+		if s.stype == linux.SOCK_STREAM {
+			return linux.TCP_CLOSE
+		}
+		return 0
+	}
 	info := linux.TCPInfo{}
 	buf := make([]byte, linux.SizeOfTCPInfo)
 	var err error
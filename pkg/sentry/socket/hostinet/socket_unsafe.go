@@ -217,6 +217,10 @@ func getsockopt(fd int, level, name int, opt []byte) ([]byte, error) {
 
 // GetSockName implements socket.Socket.GetSockName.
 func (s *Socket) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Error) {
+	if s.closed() {
+		addr, addrlen := s.closedSockName()
+		return addr, addrlen, nil
+	}
 	addr := make([]byte, sizeofSockaddr)
 	addrlen := uint32(len(addr))
 	_, _, errno := unix.Syscall(unix.SYS_GETSOCKNAME, uintptr(s.fd), uintptr(unsafe.Pointer(&addr[0])), uintptr(unsafe.Pointer(&addrlen)))
@@ -228,6 +232,9 @@ func (s *Socket) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Er
 
 // GetPeerName implements socket.Socket.GetPeerName.
 func (s *Socket) GetPeerName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Error) {
+	if s.closed() {
+		return nil, 0, syserr.ErrNotConnected
+	}
 	addr := make([]byte, sizeofSockaddr)
 	addrlen := uint32(len(addr))
 	_, _, errno := unix.Syscall(unix.SYS_GETPEERNAME, uintptr(s.fd), uintptr(unsafe.Pointer(&addr[0])), uintptr(unsafe.Pointer(&addrlen)))
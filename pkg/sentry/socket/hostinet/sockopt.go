@@ -201,10 +201,14 @@ func (s *Socket) GetSockOpt(t *kernel.Task, level, name int, optValAddr hostarch
 	if err := preGetSockOpt(t, level, name, optValAddr, opt); err != nil {
 		return nil, syserr.FromError(err)
 	}
-	var err error
-	opt, err = getsockopt(s.fd, level, name, opt)
-	if err != nil {
-		return nil, syserr.FromError(err)
+	if s.closed() {
+		opt = s.closedSockOpt(level, name, opt)
+	} else {
+		var err error
+		opt, err = getsockopt(s.fd, level, name, opt)
+		if err != nil {
+			return nil, syserr.FromError(err)
+		}
 	}
 	opt = postGetSockOpt(t, level, name, opt)
 	// If option allows a smaller buffer, truncate it to desired size.
@@ -257,6 +261,9 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level, name int, opt []byte) *syserr
 		}
 		opt = opt[:sockOpt.Size]
 	}
+	if s.closed() {
+		return nil
+	}
 	if _, _, errno := unix.Syscall6(unix.SYS_SETSOCKOPT, uintptr(s.fd), uintptr(level), uintptr(name), uintptr(firstBytePtr(opt)), uintptr(len(opt)), 0); errno != 0 {
 		return syserr.FromError(errno)
 	}
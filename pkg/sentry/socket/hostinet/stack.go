@@ -312,6 +312,12 @@ func (s *Stack) Statistics(stat any, arg string) error {
 	return nil
 }
 
+// MulticastGroups implements inet.Stack.MulticastGroups.
+func (s *Stack) MulticastGroups() map[int32][]inet.MulticastGroup {
+	// Multicast groups are joined by host sockets, and aren't tracked here.
+	return nil
+}
+
 // RouteTable implements inet.Stack.RouteTable.
 func (s *Stack) RouteTable() []inet.Route {
 	routes, err := getRoutes()
@@ -324,7 +330,7 @@ func (s *Stack) RouteTable() []inet.Route {
 }
 
 // Pause implements inet.Stack.Pause.
-func (*Stack) Pause() {}
+func (*Stack) Pause(bool) {}
 
 // Resume implements inet.Stack.Resume.
 func (*Stack) Resume() {}
@@ -338,6 +344,11 @@ func (*Stack) CleanupEndpoints() []stack.TransportEndpoint { return nil }
 // RestoreCleanupEndpoints implements inet.Stack.RestoreCleanupEndpoints.
 func (*Stack) RestoreCleanupEndpoints([]stack.TransportEndpoint) {}
 
+// Forwarding implements inet.Stack.Forwarding.
+func (*Stack) Forwarding(tcpip.NetworkProtocolNumber) bool {
+	return false
+}
+
 // SetForwarding implements inet.Stack.SetForwarding.
 func (*Stack) SetForwarding(tcpip.NetworkProtocolNumber, bool) error {
 	return linuxerr.EACCES
@@ -0,0 +1,36 @@
+// automatically generated by stateify.
+
+package audit
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/state"
+)
+
+func (p *Protocol) StateTypeName() string {
+	return "pkg/sentry/socket/netlink/audit.Protocol"
+}
+
+func (p *Protocol) StateFields() []string {
+	return []string{
+		"canRead",
+	}
+}
+
+func (p *Protocol) beforeSave() {}
+
+// +checklocksignore
+func (p *Protocol) StateSave(stateSinkObject state.Sink) {
+	p.beforeSave()
+	stateSinkObject.Save(0, &p.canRead)
+}
+
+func (p *Protocol) afterLoad() {}
+
+// +checklocksignore
+func (p *Protocol) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &p.canRead)
+}
+
+func init() {
+	state.Register((*Protocol)(nil))
+}
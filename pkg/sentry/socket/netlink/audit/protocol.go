@@ -0,0 +1,361 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit provides a NETLINK_AUDIT socket protocol.
+//
+// Audit daemons such as auditd use NETLINK_AUDIT sockets to configure the
+// audit subsystem, load audit rules and receive the audit records of the
+// system calls selected by the rules. The configuration is shared by all
+// containers in the sandbox. Records are generated from seccheck points, see
+// the "audit" seccheck sink.
+package audit
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/marshal/primitive"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netlink"
+	"github.com/talismancer/gvisor-ligolo/pkg/syserr"
+)
+
+// featureBitmap is the mask of audit features reported by AUDIT_GET.
+const featureBitmap = linux.AUDIT_FEATURE_BITMAP_BACKLOG_LIMIT |
+	linux.AUDIT_FEATURE_BITMAP_BACKLOG_WAIT_TIME |
+	linux.AUDIT_FEATURE_BITMAP_EXECUTABLE_PATH |
+	linux.AUDIT_FEATURE_BITMAP_EXCLUDE_EXTEND |
+	linux.AUDIT_FEATURE_BITMAP_SESSIONID_FILTER |
+	linux.AUDIT_FEATURE_BITMAP_LOST_RESET
+
+// Protocol implements netlink.Protocol.
+//
+// +stateify savable
+type Protocol struct {
+	// canRead is true if the socket was created with CAP_AUDIT_READ, which is
+	// required to join AUDIT_NLGRP_READLOG.
+	canRead bool
+}
+
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
+
+// NewProtocol creates a NETLINK_AUDIT netlink.Protocol.
+func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
+	return &Protocol{
+		canRead: t.Credentials().HasCapabilityIn(linux.CAP_AUDIT_READ, t.Kernel().RootUserNamespace()),
+	}, nil
+}
+
+// Protocol implements netlink.Protocol.Protocol.
+func (p *Protocol) Protocol() int {
+	return linux.NETLINK_AUDIT
+}
+
+// CanSend implements netlink.Protocol.CanSend.
+func (p *Protocol) CanSend() bool {
+	return true
+}
+
+// Groups implements netlink.MulticastProtocol.Groups.
+func (p *Protocol) Groups() uint32 {
+	if p.canRead {
+		return 1 << (linux.AUDIT_NLGRP_READLOG - 1)
+	}
+	return 0
+}
+
+// isUserMessage returns true if typ is a message type userspace may send to
+// be logged.
+func isUserMessage(typ uint16) bool {
+	return (typ >= linux.AUDIT_FIRST_USER_MSG && typ <= linux.AUDIT_LAST_USER_MSG) ||
+		(typ >= linux.AUDIT_FIRST_USER_MSG2 && typ <= linux.AUDIT_LAST_USER_MSG2) ||
+		typ == linux.AUDIT_USER
+}
+
+// checkPermission returns an error if the sender of a message of type typ
+// isn't allowed to send it. See kernel/audit.c:audit_netlink_ok.
+func checkPermission(t *kernel.Task, typ uint16) *syserr.Error {
+	creds := t.Credentials()
+	root := t.Kernel().RootUserNamespace()
+	switch {
+	case typ == linux.AUDIT_GET, typ == linux.AUDIT_SET, typ == linux.AUDIT_GET_FEATURE,
+		typ == linux.AUDIT_SET_FEATURE, typ == linux.AUDIT_LIST_RULES, typ == linux.AUDIT_ADD_RULE,
+		typ == linux.AUDIT_DEL_RULE, typ == linux.AUDIT_SIGNAL_INFO, typ == linux.AUDIT_TTY_GET,
+		typ == linux.AUDIT_TTY_SET, typ == linux.AUDIT_TRIM, typ == linux.AUDIT_MAKE_EQUIV:
+		// Only the audit daemon of the sandbox may configure auditing, not
+		// containers running in their own user namespace.
+		if creds.UserNamespace != root {
+			return syserr.ErrConnectionRefused
+		}
+		if !creds.HasCapabilityIn(linux.CAP_AUDIT_CONTROL, root) {
+			return syserr.ErrNotPermitted
+		}
+	case isUserMessage(typ):
+		if !creds.HasCapabilityIn(linux.CAP_AUDIT_WRITE, root) {
+			return syserr.ErrNotPermitted
+		}
+	default:
+		return syserr.ErrInvalidArgument
+	}
+	return nil
+}
+
+// ProcessMessage implements netlink.Protocol.ProcessMessage.
+func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	t := kernel.TaskFromContext(ctx)
+	if t == nil {
+		return syserr.ErrInvalidArgument
+	}
+	hdr := msg.Header()
+	if err := checkPermission(t, hdr.Type); err != nil {
+		return err
+	}
+
+	switch hdr.Type {
+	case linux.AUDIT_GET:
+		return p.getStatus(t, ms)
+	case linux.AUDIT_SET:
+		return p.setStatus(t, msg, ms)
+	case linux.AUDIT_GET_FEATURE:
+		return p.getFeatures(t, ms)
+	case linux.AUDIT_SET_FEATURE:
+		return p.setFeatures(t, msg)
+	case linux.AUDIT_LIST_RULES:
+		return p.listRules(t, ms)
+	case linux.AUDIT_ADD_RULE, linux.AUDIT_DEL_RULE:
+		return p.changeRule(t, hdr.Type, msg)
+	case linux.AUDIT_SIGNAL_INFO:
+		// No signal was ever sent to the audit daemon: reply with
+		// struct audit_sig_info{auid: AUDIT_UID_UNSET, pid: 0}.
+		auid, pid := primitive.Uint32(auth.NoID), primitive.Int32(0)
+		m := ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.AUDIT_SIGNAL_INFO})
+		m.Put(&auid)
+		m.Put(&pid)
+		return nil
+	case linux.AUDIT_TTY_GET:
+		// TTY input auditing isn't supported: report it as disabled with
+		// struct audit_tty_status{enabled: 0, log_passwd: 0}.
+		var enabled, logPasswd primitive.Uint32
+		m := ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.AUDIT_TTY_GET})
+		m.Put(&enabled)
+		m.Put(&logPasswd)
+		return nil
+	case linux.AUDIT_TTY_SET:
+		return nil
+	case linux.AUDIT_TRIM, linux.AUDIT_MAKE_EQUIV:
+		// There are no directory trees to trim or make equivalent.
+		return nil
+	default:
+		logUser(t, hdr.Type, string(msg.Payload()))
+		return nil
+	}
+}
+
+// getStatus replies to AUDIT_GET.
+func (p *Protocol) getStatus(t *kernel.Task, ms *netlink.MessageSet) *syserr.Error {
+	conf := t.Kernel().Audit().Config()
+	status := linux.AuditStatus{
+		Enabled:         conf.Enabled,
+		Failure:         conf.Failure,
+		PID:             uint32(conf.DaemonPID),
+		RateLimit:       conf.RateLimit,
+		BacklogLimit:    conf.BacklogLimit,
+		Lost:            lost.Load(),
+		FeatureBitmap:   featureBitmap,
+		BacklogWaitTime: conf.BacklogWaitTime,
+	}
+	ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.AUDIT_GET}).Put(&status)
+	return nil
+}
+
+// setStatus handles AUDIT_SET. See kernel/audit.c:audit_receive_msg.
+func (p *Protocol) setStatus(t *kernel.Task, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
+	// Older versions of userspace send a shorter struct audit_status, the
+	// missing fields are zero.
+	var status linux.AuditStatus
+	buf := make([]byte, status.SizeBytes())
+	copy(buf, msg.Payload())
+	status.UnmarshalUnsafe(buf)
+
+	k := t.Kernel()
+	tgid := int32(k.TaskSet().Root.IDOfThreadGroup(t.ThreadGroup()))
+	var old, conf kernel.AuditConfig
+	err := k.Audit().Update(func(c *kernel.AuditConfig) error {
+		old = *c
+		if c.Enabled == 2 {
+			return syserr.ErrNotPermitted.ToError()
+		}
+		if status.Mask&linux.AUDIT_STATUS_ENABLED != 0 {
+			if status.Enabled > 2 {
+				return syserr.ErrInvalidArgument.ToError()
+			}
+			c.Enabled = status.Enabled
+		}
+		if status.Mask&linux.AUDIT_STATUS_FAILURE != 0 {
+			if status.Failure > linux.AUDIT_FAIL_PANIC {
+				return syserr.ErrInvalidArgument.ToError()
+			}
+			c.Failure = status.Failure
+		}
+		if status.Mask&linux.AUDIT_STATUS_PID != 0 {
+			switch pid := int32(status.PID); {
+			case pid == 0:
+				// Only the daemon may unregister itself.
+				if c.DaemonPID != 0 && c.DaemonPID != tgid {
+					return syserr.ErrPermissionDenied.ToError()
+				}
+				c.DaemonPID = 0
+				c.DaemonPortID = 0
+			case pid != int32(t.PIDNamespace().IDOfThreadGroup(t.ThreadGroup())) && pid != tgid:
+				return syserr.ErrInvalidArgument.ToError()
+			default:
+				if c.DaemonPID != 0 && c.DaemonPID != tgid && netlink.IsBound(linux.NETLINK_AUDIT, c.DaemonPortID) {
+					return syserr.ErrExists.ToError()
+				}
+				c.DaemonPID = tgid
+				c.DaemonPortID = ms.PortID
+			}
+		}
+		if status.Mask&linux.AUDIT_STATUS_RATE_LIMIT != 0 {
+			c.RateLimit = status.RateLimit
+		}
+		if status.Mask&linux.AUDIT_STATUS_BACKLOG_LIMIT != 0 {
+			c.BacklogLimit = status.BacklogLimit
+		}
+		if status.Mask&linux.AUDIT_STATUS_BACKLOG_WAIT_TIME != 0 {
+			c.BacklogWaitTime = status.BacklogWaitTime
+		}
+		conf = *c
+		return nil
+	})
+	if err != nil {
+		return syserr.FromError(err)
+	}
+	if status.Mask&linux.AUDIT_STATUS_LOST != 0 {
+		lost.Store(0)
+	}
+	if old.Enabled != conf.Enabled {
+		logConfigChange(t, &conf, "audit_enabled=%d old=%d", conf.Enabled, old.Enabled)
+	}
+	if old.DaemonPID != conf.DaemonPID {
+		logConfigChange(t, &conf, "op=set audit_pid=%d old=%d", conf.DaemonPID, old.DaemonPID)
+	}
+	return nil
+}
+
+// getFeatures replies to AUDIT_GET_FEATURE.
+func (p *Protocol) getFeatures(t *kernel.Task, ms *netlink.MessageSet) *syserr.Error {
+	conf := t.Kernel().Audit().Config()
+	features := linux.AuditFeatures{
+		Vers:     linux.AUDIT_FEATURE_VERSION,
+		Mask:     ^uint32(0),
+		Features: conf.Features,
+		Lock:     conf.LockedFeatures,
+	}
+	ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.AUDIT_GET_FEATURE}).Put(&features)
+	return nil
+}
+
+// setFeatures handles AUDIT_SET_FEATURE. See kernel/audit.c:audit_set_feature.
+func (p *Protocol) setFeatures(t *kernel.Task, msg *netlink.Message) *syserr.Error {
+	var req linux.AuditFeatures
+	if _, ok := msg.GetData(&req); !ok {
+		return syserr.ErrInvalidArgument
+	}
+	const validMask = (1 << (linux.AUDIT_LAST_FEATURE + 1)) - 1
+	if req.Mask&^validMask != 0 {
+		return syserr.ErrInvalidArgument
+	}
+	err := t.Kernel().Audit().Update(func(c *kernel.AuditConfig) error {
+		// Locked features can't be changed or unlocked.
+		locked := c.LockedFeatures & req.Mask
+		if (c.Features^req.Features)&locked != 0 || (c.LockedFeatures^req.Lock)&locked != 0 {
+			return syserr.ErrNotPermitted.ToError()
+		}
+		c.Features = c.Features&^req.Mask | req.Features&req.Mask
+		c.LockedFeatures = c.LockedFeatures&^req.Mask | req.Lock&req.Mask
+		return nil
+	})
+	return syserr.FromError(err)
+}
+
+// listRules replies to AUDIT_LIST_RULES with one message per rule.
+func (p *Protocol) listRules(t *kernel.Task, ms *netlink.MessageSet) *syserr.Error {
+	conf := t.Kernel().Audit().Config()
+	ms.Multi = true
+	for _, r := range conf.Rules {
+		data := primitive.ByteSlice(r.Data)
+		ms.AddMessage(linux.NetlinkMessageHeader{Type: linux.AUDIT_LIST_RULES}).Put(&data)
+	}
+	return nil
+}
+
+// changeRule handles AUDIT_ADD_RULE and AUDIT_DEL_RULE.
+func (p *Protocol) changeRule(t *kernel.Task, typ uint16, msg *netlink.Message) *syserr.Error {
+	rule, prepend, serr := parseRule(msg.Payload())
+	if serr != nil {
+		return serr
+	}
+	var conf kernel.AuditConfig
+	err := t.Kernel().Audit().Update(func(c *kernel.AuditConfig) error {
+		if c.Enabled == 2 {
+			return syserr.ErrNotPermitted.ToError()
+		}
+		idx := -1
+		for i, r := range c.Rules {
+			if ruleEqual(r, rule) {
+				idx = i
+				break
+			}
+		}
+		// Rules is immutable, build a new slice.
+		rules := make([]*kernel.AuditRule, 0, len(c.Rules)+1)
+		switch {
+		case typ == linux.AUDIT_DEL_RULE && idx < 0:
+			return syserr.ErrNoFileOrDir.ToError()
+		case typ == linux.AUDIT_DEL_RULE:
+			rules = append(rules, c.Rules[:idx]...)
+			rules = append(rules, c.Rules[idx+1:]...)
+		case idx >= 0:
+			return syserr.ErrExists.ToError()
+		case prepend:
+			rules = append(rules, rule)
+			rules = append(rules, c.Rules...)
+		default:
+			rules = append(rules, c.Rules...)
+			rules = append(rules, rule)
+		}
+		c.Rules = rules
+		conf = *c
+		return nil
+	})
+	if err != nil {
+		return syserr.FromError(err)
+	}
+	op := "add_rule"
+	if typ == linux.AUDIT_DEL_RULE {
+		op = "remove_rule"
+	}
+	key := "(null)"
+	if k := ruleKey(rule); k != "" {
+		key = untrusted(k)
+	}
+	logConfigChange(t, &conf, "op=%s key=%s list=%d", op, key, rule.List)
+	return nil
+}
+
+// init registers the NETLINK_AUDIT provider.
+func init() {
+	netlink.RegisterProvider(linux.NETLINK_AUDIT, NewProtocol)
+}
@@ -0,0 +1,283 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/marshal/primitive"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netlink"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/syserr"
+)
+
+// serial is the serial number of the last audit event. It isn't saved, so it
+// restarts from zero on restore.
+var serial atomicbitops.Uint64
+
+// lost is the number of records that couldn't be delivered to the audit
+// daemon because its receive buffer was full. It isn't saved.
+var lost atomicbitops.Uint32
+
+// Event is what audit rules are evaluated on, and audit records describe: a
+// system call or a message from userspace, made by a task.
+type Event struct {
+	// PID and PPID are the thread group IDs of the task and its parent in the
+	// root PID namespace.
+	PID  int32
+	PPID int32
+
+	// Creds are the credentials of the task.
+	Creds *auth.Credentials
+
+	// Arch is the AUDIT_ARCH_* value of the task's system call ABI.
+	Arch uint32
+
+	// Comm is the name of the task, and Exe the path of its executable.
+	Comm string
+	Exe  string
+
+	// Cwd is the working directory of the task, or empty if unknown.
+	Cwd string
+
+	// Sysno is the system call number, if HasSysno is set.
+	HasSysno bool
+	Sysno    uint64
+
+	// Args are the first 4 system call arguments, if HasArgs is set.
+	HasArgs bool
+	Args    [4]uint64
+
+	// Exit is the return value of the system call, if HasExit is set.
+	HasExit bool
+	Exit    int64
+
+	// Path is the path the system call operates on, or empty.
+	Path string
+
+	// Argv is the argument vector of execve(2) system calls.
+	Argv []string
+
+	// msgType is the type of the record being filtered by the exclude list.
+	msgType uint16
+}
+
+// NewEvent returns an Event for a system call or message made by t.
+func NewEvent(t *kernel.Task) *Event {
+	k := t.Kernel()
+	e := &Event{
+		PID:   int32(k.TaskSet().Root.IDOfThreadGroup(t.ThreadGroup())),
+		Creds: t.Credentials(),
+		Arch:  t.SyscallTable().AuditNumber,
+		Comm:  t.Name(),
+		Exe:   executablePath(t),
+	}
+	if parent := t.ThreadGroup().Leader().Parent(); parent != nil {
+		e.PPID = int32(k.TaskSet().Root.IDOfThreadGroup(parent.ThreadGroup()))
+	}
+	return e
+}
+
+// executablePath returns the path of the executable of t, or an empty string
+// if it has none.
+func executablePath(t *kernel.Task) string {
+	mm := t.MemoryManager()
+	if mm == nil {
+		return ""
+	}
+	exe := mm.Executable()
+	if exe == nil {
+		return ""
+	}
+	defer exe.DecRef(t)
+	root := vfs.RootFromContext(t)
+	if !root.Ok() {
+		return ""
+	}
+	defer root.DecRef(t)
+	name, _ := t.Kernel().VFS().PathnameWithDeleted(t, root, exe.VirtualDentry())
+	return name
+}
+
+// untrusted formats a string that may contain arbitrary characters the way
+// Linux does: quoted if it only contains printable characters, hex-encoded
+// otherwise. See kernel/audit.c:audit_log_n_untrustedstring.
+func untrusted(s string) string {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '"' || c < 0x21 || c > 0x7e {
+			return fmt.Sprintf("%X", s)
+		}
+	}
+	return `"` + s + `"`
+}
+
+// taskInfo formats the fields describing the task of e, like
+// kernel/audit.c:audit_log_task_info.
+func (e *Event) taskInfo() string {
+	c := e.Creds
+	return fmt.Sprintf("ppid=%d pid=%d auid=%d uid=%d gid=%d euid=%d suid=%d fsuid=%d egid=%d sgid=%d fsgid=%d tty=(none) ses=%d comm=%s exe=%s",
+		e.PPID, e.PID, uint32(c.LoginKUID), c.RealKUID, c.RealKGID, c.EffectiveKUID, c.SavedKUID, c.EffectiveKUID,
+		c.EffectiveKGID, c.SavedKGID, c.EffectiveKGID, c.SessionID, untrusted(e.Comm), untrusted(e.Exe))
+}
+
+// emitter sends the records of an event, which share a timestamp and serial
+// number.
+type emitter struct {
+	ctx   context.Context
+	k     *kernel.Kernel
+	conf  *kernel.AuditConfig
+	e     *Event
+	stamp string
+}
+
+func newEmitter(ctx context.Context, k *kernel.Kernel, conf *kernel.AuditConfig, e *Event) *emitter {
+	now := k.RealtimeClock().Now()
+	return &emitter{
+		ctx:   ctx,
+		k:     k,
+		conf:  conf,
+		e:     e,
+		stamp: fmt.Sprintf("%d.%03d:%d", now.Seconds(), now.Nanoseconds()/1e6%1000, serial.Add(1)),
+	}
+}
+
+// emit sends a record of type typ, unless the exclude list filters it out.
+func (em *emitter) emit(typ uint16, format string, args ...any) {
+	em.e.msgType = typ
+	if r, ok := filter(em.conf.Rules, linux.AUDIT_FILTER_EXCLUDE, em.e); ok && r.Action == linux.AUDIT_NEVER {
+		return
+	}
+	text := fmt.Sprintf("audit(%s): ", em.stamp) + fmt.Sprintf(format, args...)
+	send(em.ctx, em.k, em.conf, typ, text)
+}
+
+// send sends a record to the audit daemon and the sockets that joined the
+// AUDIT_NLGRP_READLOG group.
+func send(ctx context.Context, k *kernel.Kernel, conf *kernel.AuditConfig, typ uint16, text string) {
+	m := netlink.NewMessage(linux.NetlinkMessageHeader{Type: typ})
+	payload := primitive.ByteSlice(text)
+	m.Put(&payload)
+	buf := m.Finalize()
+
+	netlink.Multicast(ctx, linux.NETLINK_AUDIT, linux.AUDIT_NLGRP_READLOG, buf)
+	if conf.DaemonPortID == 0 {
+		log.Debugf("audit: type=%d %s", typ, text)
+		return
+	}
+	switch err := netlink.Unicast(ctx, linux.NETLINK_AUDIT, conf.DaemonPortID, buf); err {
+	case nil:
+	case syserr.ErrConnectionRefused:
+		// The daemon went away without unregistering.
+		log.Infof("audit: daemon with pid %d is gone, unregistering it", conf.DaemonPID)
+		portID := conf.DaemonPortID
+		_ = k.Audit().Update(func(c *kernel.AuditConfig) error {
+			if c.DaemonPortID == portID {
+				c.DaemonPID = 0
+				c.DaemonPortID = 0
+			}
+			return nil
+		})
+		conf.DaemonPortID = 0
+	default:
+		lost.Add(1)
+	}
+}
+
+// LogSyscall emits the audit records of the system call described by e, made
+// by t, if the audit rules select it.
+func LogSyscall(t *kernel.Task, e *Event) {
+	k := t.Kernel()
+	conf := k.Audit().Config()
+	if conf.Enabled == 0 || len(conf.Rules) == 0 {
+		return
+	}
+	if r, ok := filter(conf.Rules, linux.AUDIT_FILTER_TASK, e); ok && r.Action == linux.AUDIT_NEVER {
+		return
+	}
+	r, ok := filter(conf.Rules, linux.AUDIT_FILTER_EXIT, e)
+	if !ok || r.Action == linux.AUDIT_NEVER {
+		return
+	}
+
+	key := "(null)"
+	if k := ruleKey(r); k != "" {
+		key = untrusted(k)
+	}
+	var result string
+	if e.HasExit {
+		success := "yes"
+		if e.Exit < 0 {
+			success = "no"
+		}
+		result = fmt.Sprintf(" success=%s exit=%d", success, e.Exit)
+	}
+	items := 0
+	if e.Path != "" {
+		items = 1
+	}
+
+	em := newEmitter(t, k, &conf, e)
+	em.emit(linux.AUDIT_SYSCALL, "arch=%x syscall=%d%s a0=%x a1=%x a2=%x a3=%x items=%d %s key=%s",
+		e.Arch, e.Sysno, result, e.Args[0], e.Args[1], e.Args[2], e.Args[3], items, e.taskInfo(), key)
+	if e.Argv != nil {
+		var b strings.Builder
+		fmt.Fprintf(&b, "argc=%d", len(e.Argv))
+		for i, arg := range e.Argv {
+			fmt.Fprintf(&b, " a%d=%s", i, untrusted(arg))
+		}
+		em.emit(linux.AUDIT_EXECVE, "%s", b.String())
+	}
+	if e.Cwd != "" {
+		em.emit(linux.AUDIT_CWD, "cwd=%s", untrusted(e.Cwd))
+	}
+	if e.Path != "" {
+		em.emit(linux.AUDIT_PATH, "item=0 name=%s", untrusted(e.Path))
+	}
+	em.emit(linux.AUDIT_EOE, "")
+}
+
+// logUser emits a record for a message sent by userspace, like
+// kernel/audit.c:audit_log_user_recv_msg.
+func logUser(t *kernel.Task, typ uint16, msg string) {
+	k := t.Kernel()
+	conf := k.Audit().Config()
+	if conf.Enabled == 0 && typ != linux.AUDIT_USER_AVC {
+		return
+	}
+	e := NewEvent(t)
+	if r, ok := filter(conf.Rules, linux.AUDIT_FILTER_USER, e); ok && r.Action == linux.AUDIT_NEVER {
+		return
+	}
+	msg = strings.TrimRight(msg, "\x00\n")
+	em := newEmitter(t, k, &conf, e)
+	em.emit(typ, "pid=%d uid=%d auid=%d ses=%d msg='%s'", e.PID, e.Creds.RealKUID, uint32(e.Creds.LoginKUID), e.Creds.SessionID, msg)
+}
+
+// logConfigChange emits an AUDIT_CONFIG_CHANGE record for a change made by t.
+func logConfigChange(t *kernel.Task, conf *kernel.AuditConfig, format string, args ...any) {
+	if conf.Enabled == 0 {
+		return
+	}
+	e := NewEvent(t)
+	em := newEmitter(t, t.Kernel(), conf, e)
+	em.emit(linux.AUDIT_CONFIG_CHANGE, "auid=%d ses=%d %s res=1", uint32(e.Creds.LoginKUID), e.Creds.SessionID, fmt.Sprintf(format, args...))
+}
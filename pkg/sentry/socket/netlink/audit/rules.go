@@ -0,0 +1,256 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/syserr"
+)
+
+// auditFilterPrepend is the flag of audit_rule_data.flags that adds the rule
+// at the head of its list.
+const auditFilterPrepend = 0x10
+
+// parseRule parses a struct audit_rule_data. It returns the rule and whether
+// it must be added at the head of its list.
+//
+// Fields that can't be evaluated in the sandbox, such as device numbers or
+// SELinux labels, are rejected with EINVAL, so that the audit daemon reports
+// the rule as unsupported instead of silently never matching it.
+func parseRule(data []byte) (*kernel.AuditRule, bool, *syserr.Error) {
+	if len(data) < linux.AuditRuleDataSize {
+		return nil, false, syserr.ErrInvalidArgument
+	}
+	order := hostarch.ByteOrder
+	u32 := func(i int) uint32 { return order.Uint32(data[4*i:]) }
+
+	flags := u32(0)
+	prepend := flags&auditFilterPrepend != 0
+	rule := &kernel.AuditRule{
+		List:   flags &^ auditFilterPrepend,
+		Action: u32(1),
+		Data:   append([]byte(nil), data...),
+	}
+	switch rule.List {
+	case linux.AUDIT_FILTER_USER, linux.AUDIT_FILTER_TASK, linux.AUDIT_FILTER_EXIT, linux.AUDIT_FILTER_EXCLUDE, linux.AUDIT_FILTER_FS:
+	default:
+		// AUDIT_FILTER_ENTRY has been deprecated since Linux 2.6.
+		return nil, false, syserr.ErrInvalidArgument
+	}
+	if rule.Action != linux.AUDIT_NEVER && rule.Action != linux.AUDIT_ALWAYS {
+		return nil, false, syserr.ErrInvalidArgument
+	}
+	fieldCount := int(u32(2))
+	if fieldCount > linux.AUDIT_MAX_FIELDS {
+		return nil, false, syserr.ErrInvalidArgument
+	}
+	const (
+		maskIdx       = 3
+		fieldsIdx     = maskIdx + linux.AUDIT_BITMASK_SIZE
+		valuesIdx     = fieldsIdx + linux.AUDIT_MAX_FIELDS
+		fieldflagsIdx = valuesIdx + linux.AUDIT_MAX_FIELDS
+		buflenIdx     = fieldflagsIdx + linux.AUDIT_MAX_FIELDS
+	)
+	for i := range rule.Mask {
+		rule.Mask[i] = u32(maskIdx + i)
+	}
+	buf := data[linux.AuditRuleDataSize:]
+	if buflen := int(u32(buflenIdx)); buflen > len(buf) {
+		return nil, false, syserr.ErrInvalidArgument
+	} else {
+		buf = buf[:buflen]
+	}
+
+	for i := 0; i < fieldCount; i++ {
+		f := kernel.AuditRuleField{
+			Type:  u32(fieldsIdx + i),
+			Value: u32(valuesIdx + i),
+			Op:    u32(fieldflagsIdx+i) & linux.AUDIT_OPERATORS,
+		}
+		switch f.Op {
+		case linux.AUDIT_EQUAL, linux.AUDIT_NOT_EQUAL, linux.AUDIT_LESS_THAN, linux.AUDIT_GREATER_THAN,
+			linux.AUDIT_LESS_THAN_OR_EQUAL, linux.AUDIT_GREATER_THAN_OR_EQUAL, linux.AUDIT_BIT_MASK, linux.AUDIT_BIT_TEST:
+		default:
+			return nil, false, syserr.ErrInvalidArgument
+		}
+		switch f.Type {
+		case linux.AUDIT_PID, linux.AUDIT_PPID, linux.AUDIT_UID, linux.AUDIT_EUID, linux.AUDIT_SUID,
+			linux.AUDIT_FSUID, linux.AUDIT_GID, linux.AUDIT_EGID, linux.AUDIT_SGID, linux.AUDIT_FSGID,
+			linux.AUDIT_LOGINUID, linux.AUDIT_LOGINUID_SET, linux.AUDIT_SESSIONID, linux.AUDIT_ARCH,
+			linux.AUDIT_MSGTYPE, linux.AUDIT_EXIT, linux.AUDIT_SUCCESS, linux.AUDIT_PERM,
+			linux.AUDIT_ARG0, linux.AUDIT_ARG1, linux.AUDIT_ARG2, linux.AUDIT_ARG3:
+		case linux.AUDIT_WATCH, linux.AUDIT_DIR, linux.AUDIT_FILTERKEY, linux.AUDIT_EXE:
+			n := int(f.Value)
+			if n > len(buf) || (f.Type == linux.AUDIT_FILTERKEY && n > linux.AUDIT_MAX_KEY_LEN) {
+				return nil, false, syserr.ErrInvalidArgument
+			}
+			f.Str = string(buf[:n])
+			buf = buf[n:]
+		default:
+			return nil, false, syserr.ErrInvalidArgument
+		}
+		rule.Fields = append(rule.Fields, f)
+	}
+	return rule, prepend, nil
+}
+
+// ruleEqual returns true if a and b are the same rule.
+func ruleEqual(a, b *kernel.AuditRule) bool {
+	return a.List == b.List && bytes.Equal(a.Data, b.Data)
+}
+
+// ruleKey returns the key of rule, or an empty string if it has none.
+func ruleKey(rule *kernel.AuditRule) string {
+	for _, f := range rule.Fields {
+		if f.Type == linux.AUDIT_FILTERKEY {
+			return f.Str
+		}
+	}
+	return ""
+}
+
+// compare returns the result of comparing v to value with operator op.
+func compare(op uint32, v, value uint32) bool {
+	switch op {
+	case linux.AUDIT_EQUAL:
+		return v == value
+	case linux.AUDIT_NOT_EQUAL:
+		return v != value
+	case linux.AUDIT_LESS_THAN:
+		return v < value
+	case linux.AUDIT_GREATER_THAN:
+		return v > value
+	case linux.AUDIT_LESS_THAN_OR_EQUAL:
+		return v <= value
+	case linux.AUDIT_GREATER_THAN_OR_EQUAL:
+		return v >= value
+	case linux.AUDIT_BIT_MASK:
+		return v&value != 0
+	case linux.AUDIT_BIT_TEST:
+		return v&value == value
+	default:
+		return false
+	}
+}
+
+// compareStr is compare for string fields, which only support equality.
+func compareStr(op uint32, v, value string) bool {
+	switch op {
+	case linux.AUDIT_EQUAL:
+		return v == value
+	case linux.AUDIT_NOT_EQUAL:
+		return v != value
+	default:
+		return false
+	}
+}
+
+// matchFields returns true if all fields of rule match e.
+func matchFields(rule *kernel.AuditRule, e *Event) bool {
+	for i := range rule.Fields {
+		f := &rule.Fields[i]
+		var ok bool
+		switch f.Type {
+		case linux.AUDIT_PID:
+			ok = compare(f.Op, uint32(e.PID), f.Value)
+		case linux.AUDIT_PPID:
+			ok = compare(f.Op, uint32(e.PPID), f.Value)
+		case linux.AUDIT_UID:
+			ok = compare(f.Op, uint32(e.Creds.RealKUID), f.Value)
+		case linux.AUDIT_EUID:
+			ok = compare(f.Op, uint32(e.Creds.EffectiveKUID), f.Value)
+		case linux.AUDIT_SUID:
+			ok = compare(f.Op, uint32(e.Creds.SavedKUID), f.Value)
+		case linux.AUDIT_FSUID:
+			ok = compare(f.Op, uint32(e.Creds.EffectiveKUID), f.Value)
+		case linux.AUDIT_GID:
+			ok = compare(f.Op, uint32(e.Creds.RealKGID), f.Value)
+		case linux.AUDIT_EGID:
+			ok = compare(f.Op, uint32(e.Creds.EffectiveKGID), f.Value)
+		case linux.AUDIT_SGID:
+			ok = compare(f.Op, uint32(e.Creds.SavedKGID), f.Value)
+		case linux.AUDIT_FSGID:
+			ok = compare(f.Op, uint32(e.Creds.EffectiveKGID), f.Value)
+		case linux.AUDIT_LOGINUID:
+			ok = compare(f.Op, uint32(e.Creds.LoginKUID), f.Value)
+		case linux.AUDIT_LOGINUID_SET:
+			var set uint32
+			if e.Creds.LoginKUID.Ok() {
+				set = 1
+			}
+			ok = compare(f.Op, set, f.Value)
+		case linux.AUDIT_SESSIONID:
+			ok = compare(f.Op, e.Creds.SessionID, f.Value)
+		case linux.AUDIT_ARCH:
+			ok = compare(f.Op, e.Arch, f.Value)
+		case linux.AUDIT_MSGTYPE:
+			ok = compare(f.Op, uint32(e.msgType), f.Value)
+		case linux.AUDIT_EXIT:
+			ok = e.HasExit && compare(f.Op, uint32(e.Exit), f.Value)
+		case linux.AUDIT_SUCCESS:
+			var success uint32
+			if e.Exit >= 0 {
+				success = 1
+			}
+			ok = e.HasExit && compare(f.Op, success, f.Value)
+		case linux.AUDIT_ARG0, linux.AUDIT_ARG1, linux.AUDIT_ARG2, linux.AUDIT_ARG3:
+			ok = e.HasArgs && compare(f.Op, uint32(e.Args[f.Type-linux.AUDIT_ARG0]), f.Value)
+		case linux.AUDIT_PERM:
+			// Accesses aren't classified, watches apply to all of them.
+			ok = true
+		case linux.AUDIT_WATCH:
+			ok = e.Path != "" && compareStr(f.Op, path.Clean(e.Path), path.Clean(f.Str))
+		case linux.AUDIT_DIR:
+			dir := path.Clean(f.Str)
+			ok = e.Path != "" && (path.Clean(e.Path) == dir || strings.HasPrefix(e.Path, dir+"/"))
+		case linux.AUDIT_EXE:
+			ok = compareStr(f.Op, e.Exe, f.Str)
+		case linux.AUDIT_FILTERKEY:
+			ok = true
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// filter returns the action of the first rule of list that matches e, and
+// the rule. It returns ok == false if no rule matches.
+func filter(rules []*kernel.AuditRule, list uint32, e *Event) (rule *kernel.AuditRule, ok bool) {
+	for _, r := range rules {
+		if r.List != list {
+			continue
+		}
+		if list == linux.AUDIT_FILTER_EXIT {
+			if !e.HasSysno || e.Sysno >= 32*linux.AUDIT_BITMASK_SIZE {
+				continue
+			}
+			if r.Mask[e.Sysno/32]&(1<<(e.Sysno%32)) == 0 {
+				continue
+			}
+		}
+		if matchFields(r, e) {
+			return r, true
+		}
+	}
+	return nil, false
+}
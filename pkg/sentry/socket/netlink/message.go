@@ -123,6 +123,12 @@ func (m *Message) GetData(msg marshal.Marshallable) (AttrsView, bool) {
 	return AttrsView(b), true
 }
 
+// Payload returns the payload of this netlink message, for protocols whose
+// messages don't have a fixed header.
+func (m *Message) Payload() []byte {
+	return m.buf[linux.NetlinkMessageHeaderSize:]
+}
+
 // Finalize returns the []byte containing the entire message, with the total
 // length set in the message header. The Message must not be modified after
 // calling Finalize.
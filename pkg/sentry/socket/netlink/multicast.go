@@ -0,0 +1,129 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netlink
+
+import (
+	"strconv"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix/transport"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"github.com/talismancer/gvisor-ligolo/pkg/syserr"
+)
+
+// MulticastProtocol is implemented by protocols whose sockets may join
+// multicast groups to receive messages sent by the kernel.
+type MulticastProtocol interface {
+	Protocol
+
+	// Groups returns the mask of the multicast groups sockets may join.
+	Groups() uint32
+}
+
+// multicast holds the sockets that joined multicast groups. It isn't saved,
+// sockets add themselves back on restore.
+var multicast struct {
+	mu sync.Mutex
+
+	// sockets maps sockets to the mask of the groups they joined.
+	sockets map[*Socket]uint32
+}
+
+// groupMask returns the mask of multicast group, which must be between 1 and
+// 32.
+func groupMask(group int) uint32 {
+	return 1 << (group - 1)
+}
+
+// checkGroups returns an error if the sockets of s's protocol can't join all
+// groups in mask.
+func (s *Socket) checkGroups(mask uint32) *syserr.Error {
+	if mask == 0 {
+		return nil
+	}
+	mp, ok := s.protocol.(MulticastProtocol)
+	if !ok || mask&^mp.Groups() != 0 {
+		return syserr.ErrPermissionDenied
+	}
+	return nil
+}
+
+// setGroupsLocked makes s a member of the multicast groups in mask, and only
+// those.
+//
+// Preconditions: s.mu is locked.
+func (s *Socket) setGroupsLocked(mask uint32) {
+	s.groups = mask
+	multicast.mu.Lock()
+	defer multicast.mu.Unlock()
+	if mask == 0 {
+		delete(multicast.sockets, s)
+		return
+	}
+	if multicast.sockets == nil {
+		multicast.sockets = make(map[*Socket]uint32)
+	}
+	multicast.sockets[s] = mask
+}
+
+// afterLoad is invoked by stateify. s isn't shared yet, so s.mu doesn't need
+// to be locked.
+func (s *Socket) afterLoad() {
+	if s.groups != 0 {
+		s.setGroupsLocked(s.groups)
+	}
+	if s.bound {
+		s.addBound()
+	}
+}
+
+// groupAddress returns the address that messages sent to the multicast groups
+// in mask are sent from. RecvMsg reports mask in the address of the sender,
+// as Linux does.
+func groupAddress(mask uint32) transport.Address {
+	return transport.Address{Addr: strconv.FormatUint(uint64(mask), 10)}
+}
+
+// addressGroups reverses groupAddress. It returns 0 for messages that were
+// not sent to multicast groups.
+func addressGroups(addr transport.Address) uint32 {
+	mask, err := strconv.ParseUint(addr.Addr, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(mask)
+}
+
+// Multicast sends buf from the kernel to the sockets of protocol that joined
+// multicast group. Like Linux, the message is dropped for sockets whose
+// receive buffer is full.
+func Multicast(ctx context.Context, protocol int, group int, buf []byte) {
+	mask := groupMask(group)
+	from := groupAddress(mask)
+	cms := transport.ControlMessages{
+		Credentials: kernelCreds,
+	}
+
+	multicast.mu.Lock()
+	defer multicast.mu.Unlock()
+	for s, groups := range multicast.sockets {
+		if groups&mask == 0 || s.protocol.Protocol() != protocol {
+			continue
+		}
+		if _, notify, err := s.connection.Send(ctx, [][]byte{buf}, cms, from); err == nil && notify {
+			s.connection.SendNotify()
+		}
+	}
+}
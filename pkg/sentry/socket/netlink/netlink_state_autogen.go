@@ -24,6 +24,7 @@ func (s *Socket) StateFields() []string {
 		"connection",
 		"bound",
 		"portID",
+		"groups",
 		"sendBufferSize",
 		"filter",
 	}
@@ -46,12 +47,11 @@ func (s *Socket) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(9, &s.connection)
 	stateSinkObject.Save(10, &s.bound)
 	stateSinkObject.Save(11, &s.portID)
-	stateSinkObject.Save(12, &s.sendBufferSize)
-	stateSinkObject.Save(13, &s.filter)
+	stateSinkObject.Save(12, &s.groups)
+	stateSinkObject.Save(13, &s.sendBufferSize)
+	stateSinkObject.Save(14, &s.filter)
 }
 
-func (s *Socket) afterLoad() {}
-
 // +checklocksignore
 func (s *Socket) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(0, &s.vfsfd)
@@ -66,8 +66,10 @@ func (s *Socket) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(9, &s.connection)
 	stateSourceObject.Load(10, &s.bound)
 	stateSourceObject.Load(11, &s.portID)
-	stateSourceObject.Load(12, &s.sendBufferSize)
-	stateSourceObject.Load(13, &s.filter)
+	stateSourceObject.Load(12, &s.groups)
+	stateSourceObject.Load(13, &s.sendBufferSize)
+	stateSourceObject.Load(14, &s.filter)
+	stateSourceObject.AfterLoad(s.afterLoad)
 }
 
 func (k *kernelSCM) StateTypeName() string {
@@ -98,6 +98,9 @@ type Socket struct {
 	// portID is the port ID allocated for this socket.
 	portID int32
 
+	// groups is the mask of the multicast groups the socket joined.
+	groups uint32
+
 	// sendBufferSize is the send buffer "size". We don't actually have a
 	// fixed buffer but only consume this many bytes.
 	sendBufferSize uint32
@@ -147,10 +150,14 @@ func New(t *kernel.Task, skType linux.SockType, protocol Protocol) (*Socket, *sy
 func (s *Socket) Release(ctx context.Context) {
 	t := kernel.TaskFromContext(ctx)
 	t.Kernel().DeleteSocket(&s.vfsfd)
+	s.mu.Lock()
+	s.setGroupsLocked(0)
+	s.mu.Unlock()
 	s.connection.Release(ctx)
 	s.ep.Close(ctx)
 
 	if s.bound {
+		s.removeBound()
 		s.ports.Release(s.protocol.Protocol(), s.portID)
 	}
 }
@@ -288,6 +295,7 @@ func (s *Socket) bindPort(t *kernel.Task, port int32) *syserr.Error {
 
 	s.portID = port
 	s.bound = true
+	s.addBound()
 	return nil
 }
 
@@ -298,15 +306,18 @@ func (s *Socket) Bind(t *kernel.Task, sockaddr []byte) *syserr.Error {
 		return err
 	}
 
-	// No support for multicast groups yet.
-	if a.Groups != 0 {
-		return syserr.ErrPermissionDenied
+	if err := s.checkGroups(a.Groups); err != nil {
+		return err
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.bindPort(t, int32(a.PortID))
+	if err := s.bindPort(t, int32(a.PortID)); err != nil {
+		return err
+	}
+	s.setGroupsLocked(a.Groups)
+	return nil
 }
 
 // Connect implements socket.Socket.Connect.
@@ -475,10 +486,30 @@ func (s *Socket) SetSockOpt(t *kernel.Task, level int, name int, opt []byte) *sy
 		}
 	case linux.SOL_NETLINK:
 		switch name {
-		case linux.NETLINK_ADD_MEMBERSHIP,
-			linux.NETLINK_BROADCAST_ERROR,
+		case linux.NETLINK_ADD_MEMBERSHIP, linux.NETLINK_DROP_MEMBERSHIP:
+			if len(opt) < sizeOfInt32 {
+				return syserr.ErrInvalidArgument
+			}
+			group := hostarch.ByteOrder.Uint32(opt)
+			if group < 1 || group > 32 {
+				return syserr.ErrInvalidArgument
+			}
+			mask := groupMask(int(group))
+			if err := s.checkGroups(mask); err != nil {
+				return err
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if name == linux.NETLINK_ADD_MEMBERSHIP {
+				s.setGroupsLocked(s.groups | mask)
+			} else {
+				s.setGroupsLocked(s.groups &^ mask)
+			}
+			return nil
+
+		case linux.NETLINK_BROADCAST_ERROR,
 			linux.NETLINK_CAP_ACK,
-			linux.NETLINK_DROP_MEMBERSHIP,
 			linux.NETLINK_DUMP_STRICT_CHK,
 			linux.NETLINK_EXT_ACK,
 			linux.NETLINK_LISTEN_ALL_NSID,
@@ -500,6 +531,7 @@ func (s *Socket) GetSockName(t *kernel.Task) (linux.SockAddr, uint32, *syserr.Er
 	sa := &linux.SockAddrNetlink{
 		Family: linux.AF_NETLINK,
 		PortID: uint32(s.portID),
+		Groups: s.groups,
 	}
 	return sa, uint32(sa.SizeBytes()), nil
 }
@@ -525,10 +557,12 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 
 	trunc := flags&linux.MSG_TRUNC != 0
 
+	var addr transport.Address
 	r := unix.EndpointReader{
 		Ctx:      t,
 		Endpoint: s.ep,
 		Peek:     flags&linux.MSG_PEEK != 0,
+		From:     &addr,
 	}
 
 	doRead := func() (int64, error) {
@@ -556,6 +590,7 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 		if trunc {
 			n = int64(r.MsgSize)
 		}
+		from.Groups = addressGroups(addr)
 		return int(n), mflags, from, fromLen, socket.ControlMessages{}, syserr.FromError(err)
 	}
 
@@ -576,6 +611,7 @@ func (s *Socket) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, have
 			if trunc {
 				n = int64(r.MsgSize)
 			}
+			from.Groups = addressGroups(addr)
 			return int(n), mflags, from, fromLen, socket.ControlMessages{}, syserr.FromError(err)
 		}
 
@@ -743,6 +779,16 @@ func (s *Socket) sendMsg(ctx context.Context, src usermem.IOSequence, to []byte,
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// Like Linux, bind the socket to a port on the first send, so that
+	// messages the kernel sends later can be addressed to it.
+	if !s.bound {
+		if t := kernel.TaskFromContext(ctx); t != nil {
+			if err := s.bindPort(t, 0); err != nil {
+				return 0, err
+			}
+		}
+	}
+
 	// For simplicity, and consistency with Linux, we copy in the entire
 	// message up front.
 	if src.NumBytes() > int64(s.sendBufferSize) {
@@ -14,24 +14,35 @@
 
 // Package uevent provides a NETLINK_KOBJECT_UEVENT socket protocol.
 //
-// NETLINK_KOBJECT_UEVENT sockets send udev-style device events. gVisor does
-// not support any device events, so these sockets never send any messages.
+// NETLINK_KOBJECT_UEVENT sockets send udev-style device events. gVisor only
+// sends events to sockets that joined the kernel multicast group, for devices
+// added to or removed from a running sandbox, such as network interfaces.
 package uevent
 
 import (
+	"bytes"
+	"fmt"
+
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netlink"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
 	"github.com/talismancer/gvisor-ligolo/pkg/syserr"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
 )
 
+// kernelGroup is the multicast group of events sent by the kernel. Other
+// groups are used by udev to forward events to its clients.
+const kernelGroup = 1
+
 // Protocol implements netlink.Protocol.
 //
 // +stateify savable
 type Protocol struct{}
 
-var _ netlink.Protocol = (*Protocol)(nil)
+var _ netlink.MulticastProtocol = (*Protocol)(nil)
 
 // NewProtocol creates a NETLINK_KOBJECT_UEVENT netlink.Protocol.
 func NewProtocol(t *kernel.Task) (netlink.Protocol, *syserr.Error) {
@@ -44,16 +55,84 @@ func (p *Protocol) Protocol() int {
 }
 
 // CanSend implements netlink.Protocol.CanSend.
+//
+// Messages are only sent to multicast groups, never in response to messages
+// from userspace. Socket filters are accepted and ignored: listeners such as
+// libudev check the events they receive again after filtering.
 func (p *Protocol) CanSend() bool {
 	return false
 }
 
+// Groups implements netlink.MulticastProtocol.Groups.
+func (p *Protocol) Groups() uint32 {
+	// Unprivileged sockets may join all groups, as on Linux.
+	return ^uint32(0)
+}
+
 // ProcessMessage implements netlink.Protocol.ProcessMessage.
 func (p *Protocol) ProcessMessage(ctx context.Context, msg *netlink.Message, ms *netlink.MessageSet) *syserr.Error {
 	// Silently ignore all messages.
 	return nil
 }
 
+// Event is a device event.
+type Event struct {
+	// Action is the action that happened to the device, e.g. "add" or
+	// "remove".
+	Action string
+
+	// DevPath is the path of the device in sysfs, without the leading
+	// "/sys", e.g. "/devices/virtual/net/eth1".
+	DevPath string
+
+	// Subsystem is the subsystem of the device, e.g. "net".
+	Subsystem string
+
+	// Env holds additional KEY=VALUE pairs describing the device.
+	Env []string
+}
+
+// seqnum is the sequence number of the last event. It isn't saved, so it
+// restarts from zero on restore.
+var seqnum atomicbitops.Uint64
+
+// Send sends ev to the sockets that joined the kernel multicast group.
+func Send(ctx context.Context, ev Event) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s@%s\x00", ev.Action, ev.DevPath)
+	fmt.Fprintf(&buf, "ACTION=%s\x00DEVPATH=%s\x00SUBSYSTEM=%s\x00", ev.Action, ev.DevPath, ev.Subsystem)
+	for _, kv := range ev.Env {
+		fmt.Fprintf(&buf, "%s\x00", kv)
+	}
+	fmt.Fprintf(&buf, "SEQNUM=%d\x00", seqnum.Add(1))
+	netlink.Multicast(ctx, linux.NETLINK_KOBJECT_UEVENT, kernelGroup, buf.Bytes())
+}
+
+// SendNetDevice sends an event for the network interface name with ID id of
+// the root network namespace, e.g. when it's added to or removed from the
+// running sandbox.
+func SendNetDevice(ctx context.Context, action, name string, id tcpip.NICID) {
+	Send(ctx, Event{
+		Action:    action,
+		DevPath:   "/devices/virtual/net/" + name,
+		Subsystem: "net",
+		Env:       []string{"INTERFACE=" + name, fmt.Sprintf("IFINDEX=%d", id)},
+	})
+}
+
+// NetDeviceNotifier sends events for the network interfaces removed by the
+// sentry.
+//
+// +stateify savable
+type NetDeviceNotifier struct{}
+
+var _ netstack.NICNotifier = (*NetDeviceNotifier)(nil)
+
+// NICRemoved implements netstack.NICNotifier.NICRemoved.
+func (*NetDeviceNotifier) NICRemoved(ctx context.Context, name string, id tcpip.NICID) {
+	SendNetDevice(ctx, "remove", name, id)
+}
+
 // init registers the NETLINK_KOBJECT_UEVENT provider.
 func init() {
 	netlink.RegisterProvider(linux.NETLINK_KOBJECT_UEVENT, NewProtocol)
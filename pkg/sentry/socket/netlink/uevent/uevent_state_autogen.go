@@ -27,6 +27,28 @@ func (p *Protocol) afterLoad() {}
 func (p *Protocol) StateLoad(stateSourceObject state.Source) {
 }
 
+func (n *NetDeviceNotifier) StateTypeName() string {
+	return "pkg/sentry/socket/netlink/uevent.NetDeviceNotifier"
+}
+
+func (n *NetDeviceNotifier) StateFields() []string {
+	return []string{}
+}
+
+func (n *NetDeviceNotifier) beforeSave() {}
+
+// +checklocksignore
+func (n *NetDeviceNotifier) StateSave(stateSinkObject state.Sink) {
+	n.beforeSave()
+}
+
+func (n *NetDeviceNotifier) afterLoad() {}
+
+// +checklocksignore
+func (n *NetDeviceNotifier) StateLoad(stateSourceObject state.Source) {
+}
+
 func init() {
 	state.Register((*Protocol)(nil))
+	state.Register((*NetDeviceNotifier)(nil))
 }
@@ -0,0 +1,87 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netlink
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix/transport"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"github.com/talismancer/gvisor-ligolo/pkg/syserr"
+)
+
+// unicastKey identifies a bound socket.
+type unicastKey struct {
+	protocol int
+	portID   int32
+}
+
+// unicast holds the bound sockets, which the kernel may send messages to. It
+// isn't saved, sockets add themselves back on restore.
+var unicast struct {
+	mu sync.Mutex
+
+	sockets map[unicastKey]*Socket
+}
+
+// addBound makes s reachable by Unicast.
+//
+// Preconditions: s is bound.
+func (s *Socket) addBound() {
+	unicast.mu.Lock()
+	defer unicast.mu.Unlock()
+	if unicast.sockets == nil {
+		unicast.sockets = make(map[unicastKey]*Socket)
+	}
+	unicast.sockets[unicastKey{s.protocol.Protocol(), s.portID}] = s
+}
+
+// removeBound reverses addBound.
+func (s *Socket) removeBound() {
+	unicast.mu.Lock()
+	defer unicast.mu.Unlock()
+	key := unicastKey{s.protocol.Protocol(), s.portID}
+	if unicast.sockets[key] == s {
+		delete(unicast.sockets, key)
+	}
+}
+
+// IsBound returns true if a socket of protocol is bound to portID.
+func IsBound(protocol int, portID int32) bool {
+	unicast.mu.Lock()
+	defer unicast.mu.Unlock()
+	_, ok := unicast.sockets[unicastKey{protocol, portID}]
+	return ok
+}
+
+// Unicast sends buf from the kernel to the socket of protocol bound to
+// portID. It returns ErrConnectionRefused if there is no such socket. Like
+// Linux, the message is dropped if the socket's receive buffer is full, and
+// ErrWouldBlock is returned.
+func Unicast(ctx context.Context, protocol int, portID int32, buf []byte) *syserr.Error {
+	unicast.mu.Lock()
+	s, ok := unicast.sockets[unicastKey{protocol, portID}]
+	unicast.mu.Unlock()
+	if !ok {
+		return syserr.ErrConnectionRefused
+	}
+	cms := transport.ControlMessages{
+		Credentials: kernelCreds,
+	}
+	_, notify, err := s.connection.Send(ctx, [][]byte{buf}, cms, transport.Address{})
+	if notify {
+		s.connection.SendNotify()
+	}
+	return err
+}
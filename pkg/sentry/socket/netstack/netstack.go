@@ -31,7 +31,9 @@ import (
 	"io"
 	"io/ioutil"
 	"math"
+	"net"
 	"reflect"
+	"strconv"
 	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
@@ -44,6 +46,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/marshal/primitive"
 	"github.com/talismancer/gvisor-ligolo/pkg/metric"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/arch"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/faultinject"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/sockfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
@@ -59,6 +62,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/tcp"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/udp"
 	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
 	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
 	"golang.org/x/sys/unix"
@@ -381,21 +385,51 @@ type sock struct {
 	// TODO(b/153685824): Move this to SocketOptions.
 	// sockOptInq corresponds to TCP_INQ.
 	sockOptInq bool
+
+	// portMu protects reservedPort and reservedProto.
+	portMu sync.Mutex `state:"nosave"`
+
+	// reservedPort is the port reserved with the PortReserver of the stack
+	// when the socket was bound, or 0. Reservations aren't restored.
+	//
+	// +checklocks:portMu
+	reservedPort uint16 `state:"nosave"`
+
+	// reservedProto is the transport protocol of reservedPort.
+	//
+	// +checklocks:portMu
+	reservedProto tcpip.TransportProtocolNumber `state:"nosave"`
+
+	// peerMu protects redirectedPeer.
+	peerMu sync.Mutex `state:"nosave"`
+
+	// redirectedPeer is the address the application connected the socket
+	// to, if the ConnectRedirector of the stack redirected the connection.
+	// Redirected connections aren't restored.
+	//
+	// +checklocks:peerMu
+	redirectedPeer *tcpip.FullAddress `state:"nosave"`
 }
 
 var _ = socket.Socket(&sock{})
 
 // New creates a new endpoint socket.
 func New(t *kernel.Task, family int, skType linux.SockType, protocol int, queue *waiter.Queue, endpoint tcpip.Endpoint) (*vfs.FileDescription, *syserr.Error) {
+	return NewInNamespace(t, t.NetworkNamespace(), family, skType, protocol, queue, endpoint)
+}
+
+// NewInNamespace creates a new endpoint socket in network namespace namespace.
+// Unlike New, it doesn't require a task, e.g. to create sockets on behalf of
+// the application before it starts.
+func NewInNamespace(ctx context.Context, namespace *inet.Namespace, family int, skType linux.SockType, protocol int, queue *waiter.Queue, endpoint tcpip.Endpoint) (*vfs.FileDescription, *syserr.Error) {
 	if skType == linux.SOCK_STREAM {
 		endpoint.SocketOptions().SetDelayOption(true)
 	}
 
-	mnt := t.Kernel().SocketMount()
-	d := sockfs.NewDentry(t, mnt)
-	defer d.DecRef(t)
+	mnt := kernel.KernelFromContext(ctx).SocketMount()
+	d := sockfs.NewDentry(ctx, mnt)
+	defer d.DecRef(ctx)
 
-	namespace := t.NetworkNamespace()
 	s := &sock{
 		Queue:     queue,
 		family:    family,
@@ -425,6 +459,9 @@ func (s *sock) Release(ctx context.Context) {
 	defer s.EventUnregister(&e)
 
 	s.Endpoint.Close()
+	s.portMu.Lock()
+	s.releasePortLocked()
+	s.portMu.Unlock()
 
 	// SO_LINGER option is valid only for TCP. For other socket types
 	// return after endpoint close.
@@ -694,9 +731,19 @@ func (s *sock) Connect(t *kernel.Task, sockaddr []byte, blocking bool) *syserr.E
 	}
 	addr = s.mapFamily(addr, family)
 
+	if err := s.checkFault(t, faultinject.NetConnect, &addr); err != nil {
+		return err
+	}
+	if err := s.checkEgress(addr); err != nil {
+		return err
+	}
+	addr, redirected := s.redirectConnect(addr)
+
 	// Always return right away in the non-blocking case.
 	if !blocking {
-		return syserr.TranslateNetstackError(s.Endpoint.Connect(addr))
+		err := s.Endpoint.Connect(addr)
+		redirected(err)
+		return syserr.TranslateNetstackError(err)
 	}
 
 	// Register for notification when the endpoint becomes writable, then
@@ -705,7 +752,9 @@ func (s *sock) Connect(t *kernel.Task, sockaddr []byte, blocking bool) *syserr.E
 	s.EventRegister(&e)
 	defer s.EventUnregister(&e)
 
-	switch err := s.Endpoint.Connect(addr); err.(type) {
+	cerr := s.Endpoint.Connect(addr)
+	redirected(cerr)
+	switch err := cerr.(type) {
 	case *tcpip.ErrConnectStarted, *tcpip.ErrAlreadyConnecting:
 	case *tcpip.ErrNoPortAvailable:
 		if (s.family == unix.AF_INET || s.family == unix.AF_INET6) && s.skType == linux.SOCK_STREAM {
@@ -774,8 +823,17 @@ func (s *sock) Bind(_ *kernel.Task, sockaddr []byte) *syserr.Error {
 		addr = s.mapFamily(addr, family)
 	}
 
+	s.portMu.Lock()
+	defer s.portMu.Unlock()
+	if serr := s.reservePortLocked(addr.Port); serr != nil {
+		return serr
+	}
+
 	// Issue the bind request to the endpoint.
 	err := s.Endpoint.Bind(addr)
+	if err != nil {
+		s.releasePortLocked()
+	}
 	if _, ok := err.(*tcpip.ErrNoPortAvailable); ok {
 		// Bind always returns EADDRINUSE irrespective of if the specified port was
 		// already bound or if an ephemeral port was requested but none were
@@ -791,6 +849,110 @@ func (s *sock) Bind(_ *kernel.Task, sockaddr []byte) *syserr.Error {
 	return syserr.TranslateNetstackError(err)
 }
 
+// transportProtocol returns the transport protocol of the socket.
+func (s *sock) transportProtocol() tcpip.TransportProtocolNumber {
+	switch {
+	case s.skType == linux.SOCK_STREAM:
+		return tcp.ProtocolNumber
+	case s.skType == linux.SOCK_DGRAM && (s.protocol == 0 || s.protocol == unix.IPPROTO_UDP):
+		return udp.ProtocolNumber
+	default:
+		return tcpip.TransportProtocolNumber(s.protocol)
+	}
+}
+
+// checkEgress evaluates the EgressFilter of the socket's stack, if any, for a
+// connection or datagram to addr.
+func (s *sock) checkEgress(addr tcpip.FullAddress) *syserr.Error {
+	if s.family != linux.AF_INET && s.family != linux.AF_INET6 {
+		return nil
+	}
+	ns, ok := s.namespace.Stack().(*Stack)
+	if !ok || ns.EgressFilter == nil {
+		return nil
+	}
+	if !ns.EgressFilter.AllowEgress(s.transportProtocol(), addr) {
+		return syserr.ErrNotPermitted
+	}
+	return nil
+}
+
+// redirectConnect returns the address a connection to addr is made to, which
+// differs from addr if the ConnectRedirector of the socket's stack redirects
+// it. The returned function must be called with the result of the first
+// connection attempt.
+func (s *sock) redirectConnect(addr tcpip.FullAddress) (tcpip.FullAddress, func(tcpip.Error)) {
+	noop := func(tcpip.Error) {}
+	if (s.family != linux.AF_INET && s.family != linux.AF_INET6) || s.transportProtocol() != tcp.ProtocolNumber {
+		return addr, noop
+	}
+	ns, ok := s.namespace.Stack().(*Stack)
+	if !ok || ns.ConnectRedirector == nil {
+		return addr, noop
+	}
+	to, ok := ns.ConnectRedirector.RedirectConnect(addr)
+	if !ok {
+		return addr, noop
+	}
+	return to, func(err tcpip.Error) {
+		switch err.(type) {
+		case nil, *tcpip.ErrConnectStarted:
+		default:
+			return
+		}
+		local, lerr := s.Endpoint.GetLocalAddress()
+		if lerr != nil {
+			return
+		}
+		s.peerMu.Lock()
+		s.redirectedPeer = &addr
+		s.peerMu.Unlock()
+		ns.ConnectRedirector.ConnectRedirected(local, addr)
+	}
+}
+
+// reservePortLocked reserves port with the PortReserver of the socket's stack,
+// if any, before the socket is bound to it. Only explicit binds of TCP and UDP
+// sockets are reserved.
+//
+// +checklocks:s.portMu
+func (s *sock) reservePortLocked(port uint16) *syserr.Error {
+	if port == 0 || s.reservedPort != 0 || (s.family != linux.AF_INET && s.family != linux.AF_INET6) {
+		return nil
+	}
+	var proto tcpip.TransportProtocolNumber
+	switch {
+	case s.skType == linux.SOCK_STREAM && (s.protocol == 0 || s.protocol == unix.IPPROTO_TCP):
+		proto = tcp.ProtocolNumber
+	case s.skType == linux.SOCK_DGRAM && (s.protocol == 0 || s.protocol == unix.IPPROTO_UDP):
+		proto = udp.ProtocolNumber
+	default:
+		return nil
+	}
+	ns, ok := s.namespace.Stack().(*Stack)
+	if !ok || ns.PortReserver == nil {
+		return nil
+	}
+	if err := ns.PortReserver.ReservePort(proto, port); err != nil {
+		return err
+	}
+	s.reservedPort, s.reservedProto = port, proto
+	return nil
+}
+
+// releasePortLocked releases the port reserved by reservePortLocked, if any.
+//
+// +checklocks:s.portMu
+func (s *sock) releasePortLocked() {
+	if s.reservedPort == 0 {
+		return
+	}
+	if ns, ok := s.namespace.Stack().(*Stack); ok && ns.PortReserver != nil {
+		ns.PortReserver.ReleasePort(s.reservedProto, s.reservedPort)
+	}
+	s.reservedPort, s.reservedProto = 0, 0
+}
+
 // Listen implements the linux syscall listen(2) for sockets backed by
 // tcpip.Endpoint.
 func (s *sock) Listen(_ *kernel.Task, backlog int) *syserr.Error {
@@ -2603,6 +2765,11 @@ func (s *sock) GetPeerName(*kernel.Task) (linux.SockAddr, uint32, *syserr.Error)
 	if err != nil {
 		return nil, 0, syserr.TranslateNetstackError(err)
 	}
+	s.peerMu.Lock()
+	if s.redirectedPeer != nil {
+		addr = *s.redirectedPeer
+	}
+	s.peerMu.Unlock()
 
 	a, l := socket.ConvertAddress(s.family, addr)
 	return a, l, nil
@@ -2839,6 +3006,10 @@ func (s *sock) RecvMsg(t *kernel.Task, dst usermem.IOSequence, flags int, haveDe
 		return s.recvErr(t, dst)
 	}
 
+	if err := s.checkFault(t, faultinject.NetRecv, nil); err != nil {
+		return 0, 0, nil, 0, socket.ControlMessages{}, err
+	}
+
 	trunc := flags&linux.MSG_TRUNC != 0
 	peek := flags&linux.MSG_PEEK != 0
 	dontWait := flags&linux.MSG_DONTWAIT != 0
@@ -2926,6 +3097,15 @@ func (s *sock) SendMsg(t *kernel.Task, src usermem.IOSequence, to []byte, flags
 		addr = &addrBuf
 	}
 
+	if err := s.checkFault(t, faultinject.NetSend, addr); err != nil {
+		return 0, err
+	}
+	if addr != nil {
+		if err := s.checkEgress(*addr); err != nil {
+			return 0, err
+		}
+	}
+
 	opts := tcpip.WriteOptions{
 		To:              addr,
 		More:            flags&linux.MSG_MORE != 0,
@@ -3322,6 +3502,17 @@ func nicStateFlagsToLinux(f stack.NICStateFlags) uint32 {
 	return rv
 }
 
+// QueueSizes implements socket.QueueSizer.QueueSizes.
+func (s *sock) QueueSizes() (send, recv int) {
+	if v, err := s.Endpoint.GetSockOptInt(tcpip.SendQueueSizeOption); err == nil {
+		send = v
+	}
+	if v, err := s.Endpoint.GetSockOptInt(tcpip.ReceiveQueueSizeOption); err == nil {
+		recv = v
+	}
+	return send, recv
+}
+
 // State implements socket.Socket.State. State translates the internal state
 // returned by netstack to values defined by Linux.
 func (s *sock) State() uint32 {
@@ -3398,3 +3589,24 @@ func (s *sock) EventRegister(e *waiter.Entry) error {
 func (s *sock) EventUnregister(e *waiter.Entry) {
 	s.Queue.EventUnregister(e)
 }
+
+// checkFault evaluates fault injection rules for an operation on s. If addr is
+// nil, the connected peer address is used, if any.
+func (s *sock) checkFault(t *kernel.Task, point faultinject.Point, addr *tcpip.FullAddress) *syserr.Error {
+	if !faultinject.Enabled() {
+		return nil
+	}
+	if addr == nil {
+		if ra, err := s.Endpoint.GetRemoteAddress(); err == nil {
+			addr = &ra
+		}
+	}
+	var p string
+	if addr != nil {
+		p = net.JoinHostPort(addr.Addr.String(), strconv.Itoa(int(addr.Port)))
+	}
+	if err := faultinject.Check(t, point, p); err != nil {
+		return syserr.FromError(err)
+	}
+	return nil
+}
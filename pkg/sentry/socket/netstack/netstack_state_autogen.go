@@ -95,7 +95,54 @@ func (s *Stack) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.AfterLoad(s.afterLoad)
 }
 
+func (v *Veth) StateTypeName() string {
+	return "pkg/sentry/socket/netstack.Veth"
+}
+
+func (v *Veth) StateFields() []string {
+	return []string{
+		"Root",
+		"RootID",
+		"RootName",
+		"RootLinkAddr",
+		"ID",
+		"LinkAddr",
+		"Config",
+		"Notifier",
+	}
+}
+
+func (v *Veth) beforeSave() {}
+
+// +checklocksignore
+func (v *Veth) StateSave(stateSinkObject state.Sink) {
+	v.beforeSave()
+	stateSinkObject.Save(0, &v.Root)
+	stateSinkObject.Save(1, &v.RootID)
+	stateSinkObject.Save(2, &v.RootName)
+	stateSinkObject.Save(3, &v.RootLinkAddr)
+	stateSinkObject.Save(4, &v.ID)
+	stateSinkObject.Save(5, &v.LinkAddr)
+	stateSinkObject.Save(6, &v.Config)
+	stateSinkObject.Save(7, &v.Notifier)
+}
+
+func (v *Veth) afterLoad() {}
+
+// +checklocksignore
+func (v *Veth) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &v.Root)
+	stateSourceObject.Load(1, &v.RootID)
+	stateSourceObject.Load(2, &v.RootName)
+	stateSourceObject.Load(3, &v.RootLinkAddr)
+	stateSourceObject.Load(4, &v.ID)
+	stateSourceObject.Load(5, &v.LinkAddr)
+	stateSourceObject.Load(6, &v.Config)
+	stateSourceObject.Load(7, &v.Notifier)
+}
+
 func init() {
 	state.Register((*sock)(nil))
 	state.Register((*Stack)(nil))
+	state.Register((*Veth)(nil))
 }
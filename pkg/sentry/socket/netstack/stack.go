@@ -16,6 +16,7 @@ package netstack
 
 import (
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
@@ -37,6 +38,49 @@ import (
 // +stateify savable
 type Stack struct {
 	Stack *stack.Stack `state:"manual"`
+
+	// PortReserver, if not nil, reserves the ports bound by sockets of the
+	// stack outside of it.
+	PortReserver PortReserver `state:"nosave"`
+
+	// EgressFilter, if not nil, restricts the destinations sockets of the
+	// stack may connect or send to.
+	EgressFilter EgressFilter `state:"nosave"`
+
+	// ConnectRedirector, if not nil, may redirect TCP connections made by
+	// sockets of the stack.
+	ConnectRedirector ConnectRedirector `state:"nosave"`
+}
+
+// ConnectRedirector redirects TCP connections, e.g. to a proxy running in the
+// stack. The application sees the connection as made to its original
+// destination.
+type ConnectRedirector interface {
+	// RedirectConnect returns the address a connection to addr is made to
+	// instead, or false if it isn't redirected.
+	RedirectConnect(addr tcpip.FullAddress) (tcpip.FullAddress, bool)
+
+	// ConnectRedirected is called once a connection from local to addr has
+	// been started to the address returned by RedirectConnect.
+	ConnectRedirected(local, addr tcpip.FullAddress)
+}
+
+// EgressFilter restricts the destinations of outbound traffic of a stack.
+type EgressFilter interface {
+	// AllowEgress returns true if sockets may connect or send to addr over
+	// transport protocol proto. It may block, e.g. to resolve names.
+	AllowEgress(proto tcpip.TransportProtocolNumber, addr tcpip.FullAddress) bool
+}
+
+// PortReserver reserves ports outside of a stack, e.g. across sandboxes whose
+// stacks share the addresses of a host network namespace.
+type PortReserver interface {
+	// ReservePort reserves port of transport protocol proto. It returns
+	// ErrAddressInUse if the port is reserved by someone else.
+	ReservePort(proto tcpip.TransportProtocolNumber, port uint16) *syserr.Error
+
+	// ReleasePort releases a reservation made by ReservePort.
+	ReleasePort(proto tcpip.TransportProtocolNumber, port uint16)
 }
 
 // Destroy implements inet.Stack.Destroy.
@@ -419,12 +463,162 @@ func (s *Stack) Statistics(stat any, arg string) error {
 			udp.ChecksumErrors.Value(),      // Udp/InCsumErrors.
 			0,                               // Udp/IgnoredMulti.
 		}
+	case *inet.StatSNMP6IP:
+		// IPv6 statistics are kept by each NIC's network endpoint.
+		var ip tcpip.IPStats
+		tcpip.InitStatCounters(reflect.ValueOf(&ip).Elem())
+		for _, ni := range s.Stack.NICInfo() {
+			if st, ok := ni.NetworkStats[ipv6.ProtocolNumber].(*ipv6.Stats); ok {
+				addStatCounters(reflect.ValueOf(&ip).Elem(), reflect.ValueOf(&st.IP).Elem())
+			}
+		}
+		// TODO(gvisor.dev/issue/969) Support stubbed stats.
+		*stats = inet.StatSNMP6IP{
+			ip.PacketsReceived.Value(),                     // Ip6InReceives.
+			ip.MalformedPacketsReceived.Value(),            // Ip6InHdrErrors.
+			ip.Forwarding.PacketTooBig.Value(),             // Ip6InTooBigErrors.
+			ip.Forwarding.Unrouteable.Value(),              // Ip6InNoRoutes.
+			ip.InvalidDestinationAddressesReceived.Value(), // Ip6InAddrErrors.
+			0,                               // Ip6InUnknownProtos.
+			0,                               // Ip6InTruncatedPkts.
+			0,                               // Ip6InDiscards.
+			ip.PacketsDelivered.Value(),     // Ip6InDelivers.
+			0,                               // Ip6OutForwDatagrams.
+			ip.PacketsSent.Value(),          // Ip6OutRequests.
+			ip.OutgoingPacketErrors.Value(), // Ip6OutDiscards.
+			0,                               // Ip6OutNoRoutes.
+			0,                               // Ip6ReasmTimeout.
+			0,                               // Ip6ReasmReqds.
+			0,                               // Ip6ReasmOKs.
+			0,                               // Ip6ReasmFails.
+			0,                               // Ip6FragOKs.
+			0,                               // Ip6FragFails.
+			0,                               // Ip6FragCreates.
+			0,                               // Ip6InMcastPkts.
+			0,                               // Ip6OutMcastPkts.
+			0,                               // Ip6InOctets.
+			0,                               // Ip6OutOctets.
+			0,                               // Ip6InMcastOctets.
+			0,                               // Ip6OutMcastOctets.
+			0,                               // Ip6InBcastOctets.
+			0,                               // Ip6OutBcastOctets.
+			0,                               // Ip6InNoECTPkts.
+			0,                               // Ip6InECT1Pkts.
+			0,                               // Ip6InECT0Pkts.
+			0,                               // Ip6InCEPkts.
+		}
+	case *inet.StatSNMP6ICMP:
+		// Not all counters are exported as metrics, so use the stack's
+		// statistics, which share the exported counters.
+		icmp := s.Stack.Stats().ICMP.V6
+		in := icmp.PacketsReceived
+		out := icmp.PacketsSent
+		inTypes := icmpv6PacketStats(in.ICMPv6PacketStats)
+		outTypes := icmpv6PacketStats(out.ICMPv6PacketStats)
+		var inMsgs, outMsgs uint64
+		for i := range inTypes {
+			inMsgs += inTypes[i]
+			outMsgs += outTypes[i]
+		}
+		*stats = inet.StatSNMP6ICMP{
+			inMsgs + in.Unrecognized.Value() + in.Invalid.Value(), // Icmp6InMsgs.
+			in.Invalid.Value(),  // Icmp6InErrors.
+			outMsgs,             // Icmp6OutMsgs.
+			out.Dropped.Value(), // Icmp6OutErrors.
+			0,                   // Icmp6InCsumErrors.
+		}
+		copy(stats[5:], inTypes[:])
+		copy(stats[5+len(inTypes):], outTypes[:])
+	case *inet.StatSNMP6UDP:
+		// Netstack doesn't keep separate UDP statistics for IPv6.
+		*stats = inet.StatSNMP6UDP{}
+	case *inet.StatNetstatTCPExt:
+		tcp := s.Stack.Stats().TCP
+		// TODO(gvisor.dev/issue/969) Support stubbed stats.
+		*stats = inet.StatNetstatTCPExt{
+			0:  tcp.ListenOverflowSynCookieSent.Value(),                               // SyncookiesSent.
+			1:  tcp.ListenOverflowSynCookieRcvd.Value(),                               // SyncookiesRecv.
+			2:  tcp.ListenOverflowInvalidSynCookieRcvd.Value(),                        // SyncookiesFailed.
+			19: tcp.ListenOverflowAckDrop.Value(),                                     // ListenOverflows.
+			20: tcp.ListenOverflowAckDrop.Value() + tcp.ListenOverflowSynDrop.Value(), // ListenDrops.
+			29: tcp.FastRecovery.Value(),                                              // TCPRenoRecovery.
+			30: tcp.SACKRecovery.Value(),                                              // TCPSackRecovery.
+			44: tcp.FastRetransmit.Value(),                                            // TCPFastRetrans.
+			46: tcp.SlowStartRetransmits.Value(),                                      // TCPSlowStartRetrans.
+			47: tcp.Timeouts.Value(),                                                  // TCPTimeouts.
+			49: tcp.TLPRecovery.Value(),                                               // TCPLossProbeRecovery.
+			56: tcp.SegmentsAckedWithDSACK.Value(),                                    // TCPDSACKRecv.
+			61: tcp.EstablishedTimedout.Value(),                                       // TCPAbortOnTimeout.
+			68: tcp.SpuriousRTORecovery.Value(),                                       // TCPSpuriousRTOs.
+		}
+	case *inet.StatNetstatIPExt:
+		// TODO(gvisor.dev/issue/969) Support stubbed stats.
+		*stats = inet.StatNetstatIPExt{
+			s.Stack.Stats().IP.Forwarding.Unrouteable.Value(), // InNoRoutes.
+		}
 	default:
 		return syserr.ErrEndpointOperation.ToError()
 	}
 	return nil
 }
 
+// icmpv6PacketStats returns the values of s in the order of the per-type
+// Icmp6 lines of /proc/net/snmp6.
+func icmpv6PacketStats(s tcpip.ICMPv6PacketStats) [15]uint64 {
+	return [15]uint64{
+		s.DstUnreachable.Value(),            // DestUnreachs.
+		s.PacketTooBig.Value(),              // PktTooBigs.
+		s.TimeExceeded.Value(),              // TimeExcds.
+		s.ParamProblem.Value(),              // ParmProblems.
+		s.EchoRequest.Value(),               // Echos.
+		s.EchoReply.Value(),                 // EchoReplies.
+		s.MulticastListenerQuery.Value(),    // GroupMembQueries.
+		s.MulticastListenerReport.Value(),   // GroupMembResponses.
+		s.MulticastListenerDone.Value(),     // GroupMembReductions.
+		s.RouterSolicit.Value(),             // RouterSolicits.
+		s.RouterAdvert.Value(),              // RouterAdvertisements.
+		s.NeighborSolicit.Value(),           // NeighborSolicits.
+		s.NeighborAdvert.Value(),            // NeighborAdvertisements.
+		s.RedirectMsg.Value(),               // Redirects.
+		s.MulticastListenerReportV2.Value(), // MLDv2Reports.
+	}
+}
+
+// addStatCounters adds the values of the StatCounters in src to the
+// corresponding StatCounters in dst, which must have the same type.
+func addStatCounters(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		d, s := dst.Field(i), src.Field(i)
+		if c, ok := s.Interface().(*tcpip.StatCounter); ok {
+			if c != nil {
+				d.Interface().(*tcpip.StatCounter).IncrementBy(c.Value())
+			}
+		} else if d.Kind() == reflect.Struct {
+			addStatCounters(d, s)
+		}
+	}
+}
+
+// MulticastGroups implements inet.Stack.MulticastGroups.
+func (s *Stack) MulticastGroups() map[int32][]inet.MulticastGroup {
+	groups := make(map[int32][]inet.MulticastGroup)
+	for id := range s.Stack.NICInfo() {
+		joined, err := s.Stack.JoinedGroups(id)
+		if err != nil {
+			// The NIC was removed concurrently.
+			continue
+		}
+		for addr, users := range joined {
+			addr := addr // AsSlice aliases addr.
+			groups[int32(id)] = append(groups[int32(id)], inet.MulticastGroup{
+				Addr:  addr.AsSlice(),
+				Users: users,
+			})
+		}
+	}
+	return groups
+}
+
 // RouteTable implements inet.Stack.RouteTable.
 func (s *Stack) RouteTable() []inet.Route {
 	var routeTable []inet.Route
@@ -470,8 +664,8 @@ func (s *Stack) IPTables() (*stack.IPTables, error) {
 }
 
 // Pause implements inet.Stack.Pause.
-func (s *Stack) Pause() {
-	s.Stack.Pause()
+func (s *Stack) Pause(resume bool) {
+	s.Stack.Pause(resume)
 }
 
 // Resume implements inet.Stack.Resume.
@@ -494,6 +688,11 @@ func (s *Stack) RestoreCleanupEndpoints(es []stack.TransportEndpoint) {
 	s.Stack.RestoreCleanupEndpoints(es)
 }
 
+// Forwarding implements inet.Stack.Forwarding.
+func (s *Stack) Forwarding(protocol tcpip.NetworkProtocolNumber) bool {
+	return s.Stack.ForwardingDefault(protocol)
+}
+
 // SetForwarding implements inet.Stack.SetForwarding.
 func (s *Stack) SetForwarding(protocol tcpip.NetworkProtocolNumber, enable bool) error {
 	if err := s.Stack.SetForwardingDefaultAndAllNICs(protocol, enable); err != nil {
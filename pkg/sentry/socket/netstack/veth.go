@@ -0,0 +1,86 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netstack
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+)
+
+// Veth describes a veth pair between a network namespace and the root network
+// namespace. It's registered as a destroy hook of the former, so that the root
+// end is removed with it, as on Linux. As hooks are saved with the namespace,
+// it also allows the pair to be recreated after restore, since the stacks
+// aren't saved.
+//
+// +stateify savable
+type Veth struct {
+	// Root is the root network namespace.
+	Root *inet.Namespace
+
+	// RootID is the ID of the root end.
+	RootID tcpip.NICID
+
+	// RootName is the name of the root end.
+	RootName string
+
+	// RootLinkAddr is the link address of the root end.
+	RootLinkAddr tcpip.LinkAddress
+
+	// ID is the ID of the end in the other namespace.
+	ID tcpip.NICID
+
+	// LinkAddr is the link address of the end in the other namespace.
+	LinkAddr tcpip.LinkAddress
+
+	// Config is the configuration of the pair's addresses, as given by the
+	// sandbox that created it.
+	Config string
+
+	// Notifier, if not nil, is notified when the root end is removed.
+	Notifier NICNotifier
+}
+
+var _ inet.DestroyHook = (*Veth)(nil)
+
+// NICNotifier is notified of interfaces removed by the sentry. Implementations
+// must be savable.
+type NICNotifier interface {
+	// NICRemoved is called after the interface id named name is removed from
+	// the root network namespace.
+	NICRemoved(ctx context.Context, name string, id tcpip.NICID)
+}
+
+// OnNamespaceDestroy implements inet.DestroyHook.OnNamespaceDestroy.
+func (v *Veth) OnNamespaceDestroy(ctx context.Context) {
+	s, ok := v.Root.Stack().(*Stack)
+	if !ok {
+		return
+	}
+	// The root end may be missing if the pair couldn't be recreated after
+	// restore, in which case its ID may be reused by another interface.
+	if s.Stack.FindNICNameFromID(v.RootID) != v.RootName {
+		return
+	}
+	if err := s.Stack.RemoveNIC(v.RootID); err != nil {
+		log.Warningf("Failed to remove veth interface %q: %v", v.RootName, err)
+		return
+	}
+	if v.Notifier != nil {
+		v.Notifier.NICRemoved(ctx, v.RootName, v.RootID)
+	}
+}
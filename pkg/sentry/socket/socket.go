@@ -217,6 +217,14 @@ func (c *ControlMessages) Release(ctx context.Context) {
 	c.Unix.Release(ctx)
 }
 
+// QueueSizer is implemented by sockets that can report the amount of data in
+// their queues, as shown in the tx_queue and rx_queue fields of /proc/net
+// files.
+type QueueSizer interface {
+	// QueueSizes returns the number of bytes in the send and receive queues.
+	QueueSizes() (send, recv int)
+}
+
 // Socket is an interface containing socket syscalls used by the syscall
 // layer to redirect them to the appropriate implementation.
 type Socket interface {
@@ -0,0 +1,130 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transport
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/syserr"
+	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
+	"golang.org/x/sys/unix"
+)
+
+// HostAbstractEndpoint is a BoundEndpoint for a socket bound in the abstract
+// namespace of the host network namespace the sandbox runs in. Connecting to
+// it connects a host socket to the host socket, so that connections support
+// SCM_RIGHTS like other host sockets.
+//
+// Like other host-backed endpoints, a HostAbstractEndpoint only lives between
+// the lookup of the name and the connection.
+type HostAbstractEndpoint struct {
+	// name is the name of the socket in the host abstract namespace, without
+	// the leading NUL byte.
+	name string
+}
+
+// NewHostAbstractEndpoint returns an endpoint for the host abstract socket
+// name.
+func NewHostAbstractEndpoint(name string) *HostAbstractEndpoint {
+	return &HostAbstractEndpoint{name: name}
+}
+
+// HostAbstractSocketTypes are the socket types that can connect to host
+// abstract sockets.
+var HostAbstractSocketTypes = []linux.SockType{linux.SOCK_STREAM, linux.SOCK_DGRAM, linux.SOCK_SEQPACKET}
+
+// BidirectionalConnect implements BoundEndpoint.BidirectionalConnect.
+func (e *HostAbstractEndpoint) BidirectionalConnect(ctx context.Context, ce ConnectingEndpoint, returnConnect func(Receiver, ConnectedEndpoint)) *syserr.Error {
+	// No lock ordering required as only the ConnectingEndpoint has a mutex.
+	ce.Lock()
+
+	// Check connecting state.
+	if ce.Connected() {
+		ce.Unlock()
+		return syserr.ErrAlreadyConnected
+	}
+	if ce.ListeningLocked() {
+		ce.Unlock()
+		return syserr.ErrInvalidEndpointState
+	}
+
+	c, err := e.newConnectedEndpoint(ce.Type(), ce.WaiterQueue())
+	if err != nil {
+		ce.Unlock()
+		return err
+	}
+
+	returnConnect(c, c)
+	ce.Unlock()
+	if err := c.Init(); err != nil {
+		return syserr.FromError(err)
+	}
+
+	return nil
+}
+
+// UnidirectionalConnect implements BoundEndpoint.UnidirectionalConnect.
+func (e *HostAbstractEndpoint) UnidirectionalConnect(ctx context.Context) (ConnectedEndpoint, *syserr.Error) {
+	c, err := e.newConnectedEndpoint(linux.SOCK_DGRAM, &waiter.Queue{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Init(); err != nil {
+		return nil, syserr.FromError(err)
+	}
+
+	// We don't need the receiver.
+	c.CloseRecv()
+	c.Release(ctx)
+
+	return c, nil
+}
+
+func (e *HostAbstractEndpoint) newConnectedEndpoint(sockType linux.SockType, queue *waiter.Queue) (*SCMConnectedEndpoint, *syserr.Error) {
+	supported := false
+	for _, t := range HostAbstractSocketTypes {
+		supported = supported || t == sockType
+	}
+	if !supported {
+		return nil, syserr.ErrConnectionRefused
+	}
+	fd, err := unix.Socket(unix.AF_UNIX, int(sockType)|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		log.Warningf("Failed to create host socket for abstract socket %q: %v", e.name, err)
+		return nil, syserr.ErrConnectionRefused
+	}
+	if err := unix.Connect(fd, &unix.SockaddrUnix{Name: "@" + e.name}); err != nil {
+		unix.Close(fd)
+		return nil, syserr.ErrConnectionRefused
+	}
+
+	c, serr := NewSCMEndpoint(fd, queue, "\x00"+e.name)
+	if serr != nil {
+		unix.Close(fd)
+		log.Warningf("NewSCMEndpoint failed: abstract name=%q, err=%v", e.name, serr)
+		return nil, serr
+	}
+	return c, nil
+}
+
+// Release implements BoundEndpoint.Release.
+func (e *HostAbstractEndpoint) Release(ctx context.Context) {}
+
+// Passcred implements BoundEndpoint.Passcred.
+func (e *HostAbstractEndpoint) Passcred() bool {
+	return false
+}
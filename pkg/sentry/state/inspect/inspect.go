@@ -0,0 +1,663 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package inspect summarizes the kernel objects contained in a checkpoint
+// image without restoring it.
+//
+// The summary is built from the raw object graph (see package wire) by
+// following type and field names, so it doesn't depend on the types being
+// linked into the binary. Objects that can't be interpreted are skipped, which
+// makes the summary best effort for images taken by other runsc versions.
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/state"
+	"github.com/talismancer/gvisor-ligolo/pkg/state/wire"
+)
+
+// Type names of the objects used to build the summary.
+const (
+	kernelType        = "pkg/sentry/kernel.Kernel"
+	pidNamespaceType  = "pkg/sentry/kernel.PIDNamespace"
+	mountType         = "pkg/sentry/vfs.Mount"
+	endpointInfoType  = "pkg/tcpip/stack.TransportEndpointInfo"
+	netstackSocket    = "pkg/sentry/socket/netstack.sock"
+	unixSocket        = "pkg/sentry/socket/unix.Socket"
+	hostinetSocket    = "pkg/sentry/socket/hostinet.Socket"
+	netlinkSocket     = "pkg/sentry/socket/netlink.Socket"
+	maxPathComponents = 256
+	maxEmbedDepth     = 4
+)
+
+// Permission bits of a saved vma, see mm.vma.saveRealPerms.
+const (
+	vmaRead    = 1 << 0
+	vmaWrite   = 1 << 1
+	vmaExecute = 1 << 2
+	vmaPrivate = 1 << 9
+)
+
+// Summary is a summary of the kernel objects in a checkpoint image.
+type Summary struct {
+	Processes []Process
+	Mounts    []Mount
+}
+
+// Process is a thread group.
+type Process struct {
+	PID         int64
+	Name        string
+	ContainerID string
+	Threads     uint64
+	VMAs        []VMA
+	FDs         []FD
+}
+
+// VMA is a virtual memory area of a process.
+type VMA struct {
+	Start   uint64
+	End     uint64
+	Perms   string
+	Offset  uint64
+	Mapping string
+}
+
+// FD is an open file descriptor of a process.
+type FD struct {
+	FD     int64
+	Type   string
+	Path   string
+	Socket *Socket
+}
+
+// Socket describes a socket file.
+type Socket struct {
+	Family   string
+	Protocol string
+	Local    string
+	Remote   string
+}
+
+// Mount is a mount in a mount namespace.
+type Mount struct {
+	ID    uint64
+	Type  string
+	Point string
+}
+
+// Summarize reads the state stream from r, as returned by statefile.NewReader,
+// and summarizes the kernel object graph it contains.
+func Summarize(r wire.Reader) (*Summary, error) {
+	g, err := readKernelGraph(r)
+	if err != nil {
+		return nil, err
+	}
+	return g.summarize(), nil
+}
+
+// graph is a decoded object graph.
+type graph struct {
+	types   []*wire.Type
+	objects map[uint64]wire.Object
+}
+
+// readKernelGraph reads object graphs from r until it finds the one rooted at
+// the kernel.
+func readKernelGraph(r wire.Reader) (g *graph, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rErr, ok := r.(error); ok {
+				err = rErr
+				return
+			}
+			panic(r)
+		}
+	}()
+	for {
+		length, object, err := state.ReadHeader(r)
+		if err == io.EOF {
+			return nil, fmt.Errorf("no kernel object graph found")
+		} else if err != nil {
+			return nil, err
+		}
+		if !object {
+			if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		g := &graph{objects: make(map[uint64]wire.Object)}
+		for i := uint64(0); i < length; {
+			switch we := wire.Load(r).(type) {
+			case *wire.Type:
+				g.types = append(g.types, we)
+			case wire.Uint:
+				i++
+				g.objects[uint64(we)] = wire.Load(r)
+			default:
+				return nil, fmt.Errorf("wanted type or object ID, got %T", we)
+			}
+		}
+		if g.typeName(g.objects[1]) == kernelType {
+			return g, nil
+		}
+	}
+}
+
+// typeName returns the type name of a struct, or "" if obj isn't a struct.
+func (g *graph) typeName(obj wire.Object) string {
+	s, ok := obj.(*wire.Struct)
+	if !ok || s.TypeID == 0 || int(s.TypeID) > len(g.types) {
+		return ""
+	}
+	return g.types[s.TypeID-1].Name
+}
+
+// fieldExact returns the named field of a struct, or nil.
+func (g *graph) fieldExact(obj wire.Object, name string) wire.Object {
+	s, ok := obj.(*wire.Struct)
+	if !ok || s.TypeID == 0 || int(s.TypeID) > len(g.types) {
+		return nil
+	}
+	for i, f := range g.types[s.TypeID-1].Fields {
+		if f == name && i < s.Fields() {
+			return *s.Field(i)
+		}
+	}
+	return nil
+}
+
+// field returns the named field of a struct, looking into embedded structs if
+// the struct doesn't have the field itself.
+func (g *graph) field(obj wire.Object, name string) wire.Object {
+	return g.fieldDepth(obj, name, maxEmbedDepth)
+}
+
+func (g *graph) fieldDepth(obj wire.Object, name string, depth int) wire.Object {
+	if f := g.fieldExact(obj, name); f != nil {
+		return f
+	}
+	s, ok := obj.(*wire.Struct)
+	if !ok || depth == 0 {
+		return nil
+	}
+	for i := 0; i < s.Fields(); i++ {
+		if inner, ok := (*s.Field(i)).(*wire.Struct); ok {
+			if f := g.fieldDepth(inner, name, depth-1); f != nil {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
+// find returns the first struct of the given type embedded in obj.
+func (g *graph) find(obj wire.Object, typeName string, depth int) wire.Object {
+	if g.typeName(obj) == typeName {
+		return obj
+	}
+	s, ok := obj.(*wire.Struct)
+	if !ok || depth == 0 {
+		return nil
+	}
+	for i := 0; i < s.Fields(); i++ {
+		if f := g.find(*s.Field(i), typeName, depth-1); f != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// id returns the ID of the object referenced by obj, or 0.
+func (g *graph) id(obj wire.Object) uint64 {
+	switch x := obj.(type) {
+	case *wire.Ref:
+		return uint64(x.Root)
+	case *wire.Interface:
+		return g.id(x.Value)
+	default:
+		return 0
+	}
+}
+
+// root returns the outermost object referenced by obj. For a pointer to an
+// embedded struct, this is the struct that embeds it.
+func (g *graph) root(obj wire.Object) wire.Object {
+	return g.objects[g.id(obj)]
+}
+
+// deref returns the value referenced by obj. Values that aren't references are
+// returned unchanged.
+func (g *graph) deref(obj wire.Object) wire.Object {
+	switch x := obj.(type) {
+	case *wire.Ref:
+		if x.Root == 0 {
+			return nil
+		}
+		return g.walk(g.objects[uint64(x.Root)], x.Dots)
+	case *wire.Interface:
+		return g.deref(x.Value)
+	case wire.Nil:
+		return nil
+	default:
+		return obj
+	}
+}
+
+// walk applies dots, stored in reverse order, to obj.
+func (g *graph) walk(obj wire.Object, dots []wire.Dot) wire.Object {
+	for i := len(dots) - 1; i >= 0 && obj != nil; i-- {
+		switch d := dots[i].(type) {
+		case *wire.FieldName:
+			obj = g.fieldExact(obj, string(*d))
+		case wire.Index:
+			a, ok := obj.(*wire.Array)
+			if !ok || int(d) >= len(a.Contents) {
+				return nil
+			}
+			obj = a.Contents[d]
+		}
+	}
+	return obj
+}
+
+// slice returns the elements of a slice.
+func (g *graph) slice(obj wire.Object) []wire.Object {
+	s, ok := obj.(*wire.Slice)
+	if !ok || s.Ref.Root == 0 {
+		return nil
+	}
+	dots := s.Ref.Dots
+	off := 0
+	if len(dots) > 0 {
+		// The last traversal is the index of the first element in the
+		// backing array.
+		if idx, ok := dots[0].(wire.Index); ok {
+			off = int(idx)
+			dots = dots[1:]
+		}
+	}
+	a, ok := g.walk(g.objects[uint64(s.Ref.Root)], dots).(*wire.Array)
+	if !ok || off+int(s.Length) > len(a.Contents) {
+		return nil
+	}
+	return a.Contents[off : off+int(s.Length)]
+}
+
+func toUint(obj wire.Object) uint64 {
+	switch x := obj.(type) {
+	case wire.Uint:
+		return uint64(x)
+	case wire.Int:
+		return uint64(x)
+	default:
+		return 0
+	}
+}
+
+func toInt(obj wire.Object) int64 {
+	switch x := obj.(type) {
+	case wire.Uint:
+		return int64(x)
+	case wire.Int:
+		return int64(x)
+	default:
+		return 0
+	}
+}
+
+func toString(obj wire.Object) string {
+	if s, ok := obj.(*wire.String); ok {
+		return string(*s)
+	}
+	return ""
+}
+
+// shortType strips the package directory from a type name, e.g.
+// "pkg/sentry/fsimpl/gofer.regularFileFD" becomes "gofer.regularFileFD".
+func shortType(name string) string {
+	return path.Base(name)
+}
+
+// fsType returns the package name of a filesystem implementation type.
+func fsType(name string) string {
+	t := shortType(name)
+	if i := strings.IndexByte(t, '.'); i >= 0 {
+		return t[:i]
+	}
+	return t
+}
+
+func (g *graph) summarize() *Summary {
+	s := &Summary{}
+	for _, obj := range g.objects {
+		if g.typeName(obj) != pidNamespaceType || g.id(g.field(obj, "parent")) != 0 {
+			continue
+		}
+		tgids, ok := g.deref(g.field(obj, "tgids")).(*wire.Map)
+		if !ok {
+			continue
+		}
+		for i := range tgids.Keys {
+			if p, ok := g.process(g.root(tgids.Keys[i]), toInt(tgids.Values[i])); ok {
+				s.Processes = append(s.Processes, p)
+			}
+		}
+	}
+	sort.Slice(s.Processes, func(i, j int) bool { return s.Processes[i].PID < s.Processes[j].PID })
+
+	for _, obj := range g.objects {
+		if g.typeName(obj) != mountType || g.id(g.field(obj, "ns")) == 0 {
+			continue
+		}
+		fs := g.deref(g.field(obj, "fs"))
+		s.Mounts = append(s.Mounts, Mount{
+			ID:    toUint(g.field(obj, "ID")),
+			Type:  fsType(g.typeName(g.root(g.field(fs, "fsType")))),
+			Point: g.mountPoint(obj),
+		})
+	}
+	sort.Slice(s.Mounts, func(i, j int) bool { return s.Mounts[i].ID < s.Mounts[j].ID })
+	return s
+}
+
+// process summarizes a thread group.
+func (g *graph) process(tg wire.Object, pid int64) (Process, bool) {
+	leader := g.deref(g.field(tg, "leader"))
+	if leader == nil {
+		return Process{}, false
+	}
+	image := g.field(leader, "image")
+	p := Process{
+		PID:         pid,
+		Name:        toString(g.field(image, "Name")),
+		ContainerID: toString(g.field(leader, "containerID")),
+		Threads:     toUint(g.field(tg, "tasksCount")),
+	}
+	if mm := g.deref(g.field(image, "MemoryManager")); mm != nil {
+		p.VMAs = g.vmas(mm)
+	}
+	if fdt := g.deref(g.field(leader, "fdTable")); fdt != nil {
+		p.FDs = g.fds(fdt)
+	}
+	return p, true
+}
+
+// vmas summarizes the memory map of a MemoryManager.
+func (g *graph) vmas(mm wire.Object) []VMA {
+	segs := g.deref(g.field(g.field(mm, "vmas"), "root"))
+	starts := g.slice(g.field(segs, "Start"))
+	ends := g.slice(g.field(segs, "End"))
+	values := g.slice(g.field(segs, "Values"))
+	if len(starts) != len(ends) || len(starts) != len(values) {
+		return nil
+	}
+	vmas := make([]VMA, 0, len(starts))
+	for i, v := range values {
+		perms := toUint(g.field(v, "realPerms"))
+		var b strings.Builder
+		for _, p := range []struct {
+			bit uint64
+			c   byte
+		}{{vmaRead, 'r'}, {vmaWrite, 'w'}, {vmaExecute, 'x'}} {
+			if perms&p.bit != 0 {
+				b.WriteByte(p.c)
+			} else {
+				b.WriteByte('-')
+			}
+		}
+		if perms&vmaPrivate != 0 {
+			b.WriteByte('p')
+		} else {
+			b.WriteByte('s')
+		}
+		vmas = append(vmas, VMA{
+			Start:   toUint(starts[i]),
+			End:     toUint(ends[i]),
+			Perms:   b.String(),
+			Offset:  toUint(g.field(v, "off")),
+			Mapping: g.mapping(v),
+		})
+	}
+	return vmas
+}
+
+// mapping describes what backs a vma.
+func (g *graph) mapping(v wire.Object) string {
+	if id := g.root(g.field(v, "id")); id != nil {
+		if vfsfd := g.field(id, "vfsfd"); vfsfd != nil {
+			if p := g.path(g.field(vfsfd, "vd")); p != "" {
+				return p
+			}
+		}
+		return shortType(g.typeName(id))
+	}
+	if m := g.root(g.field(v, "mappable")); m != nil {
+		return shortType(g.typeName(m))
+	}
+	return ""
+}
+
+// fds summarizes an FDTable.
+func (g *graph) fds(fdt wire.Object) []FD {
+	table, ok := g.deref(g.field(fdt, "descriptorTable")).(*wire.Map)
+	if !ok {
+		return nil
+	}
+	fds := make([]FD, 0, len(table.Keys))
+	for i := range table.Keys {
+		impl := g.root(g.field(table.Values[i], "file"))
+		if impl == nil {
+			continue
+		}
+		fd := FD{
+			FD:   toInt(table.Keys[i]),
+			Type: shortType(g.typeName(impl)),
+		}
+		if fd.Socket = g.socket(impl); fd.Socket == nil {
+			fd.Path = g.path(g.field(g.field(impl, "vfsfd"), "vd"))
+		}
+		fds = append(fds, fd)
+	}
+	sort.Slice(fds, func(i, j int) bool { return fds[i].FD < fds[j].FD })
+	return fds
+}
+
+// socket summarizes a socket file, or returns nil if impl isn't a socket.
+func (g *graph) socket(impl wire.Object) *Socket {
+	switch g.typeName(impl) {
+	case netstackSocket:
+		s := &Socket{Family: familyName(toInt(g.field(impl, "family")))}
+		info := g.find(g.root(g.field(impl, "Endpoint")), endpointInfoType, maxEmbedDepth)
+		if info == nil {
+			return s
+		}
+		s.Protocol = protocolName(toUint(g.field(info, "TransProto")))
+		id := g.field(info, "ID")
+		s.Local = g.hostPort(g.field(id, "LocalAddress"), toUint(g.field(id, "LocalPort")))
+		s.Remote = g.hostPort(g.field(id, "RemoteAddress"), toUint(g.field(id, "RemotePort")))
+		return s
+	case unixSocket:
+		s := &Socket{Family: "unix", Protocol: sockTypeName(toInt(g.field(impl, "stype")))}
+		s.Local = toString(g.field(g.root(g.field(impl, "ep")), "path"))
+		return s
+	case hostinetSocket:
+		return &Socket{Family: familyName(toInt(g.field(impl, "family"))), Protocol: "host"}
+	case netlinkSocket:
+		return &Socket{Family: "netlink"}
+	default:
+		return nil
+	}
+}
+
+// hostPort formats a tcpip.Address and port. Unspecified endpoints are
+// returned as "".
+func (g *graph) hostPort(addr wire.Object, port uint64) string {
+	n := int(toInt(g.field(addr, "length")))
+	var ip net.IP
+	if a, ok := g.field(addr, "addr").(*wire.Array); ok && n <= len(a.Contents) {
+		ip = make(net.IP, n)
+		for i := range ip {
+			ip[i] = byte(toUint(a.Contents[i]))
+		}
+	}
+	if len(ip) == 0 && port == 0 {
+		return ""
+	}
+	host := "*"
+	if len(ip) > 0 {
+		host = ip.String()
+	}
+	return net.JoinHostPort(host, fmt.Sprint(port))
+}
+
+// path returns the absolute path of a vfs.VirtualDentry, or "" if it can't be
+// determined.
+func (g *graph) path(vd wire.Object) string {
+	mnt := g.deref(g.field(vd, "mount"))
+	d := g.field(vd, "dentry")
+	if mnt == nil || g.id(d) == 0 {
+		return ""
+	}
+	var parts []string
+	for i := 0; i < maxPathComponents; i++ {
+		if g.id(d) == g.id(g.field(mnt, "root")) {
+			key := g.field(mnt, "key")
+			parent := g.deref(g.field(key, "mount"))
+			if parent == nil {
+				if g.id(g.field(mnt, "ns")) == 0 {
+					// Anonymous mount, e.g. pipefs.
+					return ""
+				}
+				break
+			}
+			mnt, d = parent, g.field(key, "dentry")
+			continue
+		}
+		dentry := g.root(d)
+		parent := g.field(dentry, "parent")
+		if g.id(parent) == 0 {
+			// Disconnected from the mount root, e.g. a deleted file.
+			return ""
+		}
+		parts = append(parts, toString(g.field(dentry, "name")))
+		d = parent
+	}
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// mountPoint returns the path where mnt is mounted.
+func (g *graph) mountPoint(mnt wire.Object) string {
+	key := g.field(mnt, "key")
+	if g.id(g.field(key, "mount")) == 0 {
+		return "/"
+	}
+	return g.path(key)
+}
+
+func familyName(family int64) string {
+	switch family {
+	case 1:
+		return "unix"
+	case 2:
+		return "inet"
+	case 10:
+		return "inet6"
+	case 16:
+		return "netlink"
+	case 17:
+		return "packet"
+	default:
+		return fmt.Sprintf("family %d", family)
+	}
+}
+
+func protocolName(proto uint64) string {
+	switch proto {
+	case 1:
+		return "icmp"
+	case 6:
+		return "tcp"
+	case 17:
+		return "udp"
+	case 58:
+		return "icmpv6"
+	default:
+		return fmt.Sprintf("protocol %d", proto)
+	}
+}
+
+func sockTypeName(stype int64) string {
+	switch stype {
+	case 1:
+		return "stream"
+	case 2:
+		return "dgram"
+	case 5:
+		return "seqpacket"
+	default:
+		return fmt.Sprintf("type %d", stype)
+	}
+}
+
+// WriteText writes the summary to w in a human readable format.
+func (s *Summary) WriteText(w io.Writer) {
+	for _, p := range s.Processes {
+		fmt.Fprintf(w, "Process %d (%s)", p.PID, p.Name)
+		if p.ContainerID != "" {
+			fmt.Fprintf(w, " container %s", p.ContainerID)
+		}
+		fmt.Fprintf(w, ", %d thread(s)\n", p.Threads)
+		if len(p.VMAs) > 0 {
+			fmt.Fprintf(w, "  Memory map:\n")
+			for _, v := range p.VMAs {
+				fmt.Fprintf(w, "    %08x-%08x %s %08x %s\n", v.Start, v.End, v.Perms, v.Offset, v.Mapping)
+			}
+		}
+		if len(p.FDs) > 0 {
+			fmt.Fprintf(w, "  File descriptors:\n")
+			for _, fd := range p.FDs {
+				switch {
+				case fd.Socket != nil:
+					fmt.Fprintf(w, "    %d socket %s %s", fd.FD, fd.Socket.Family, fd.Socket.Protocol)
+					if fd.Socket.Local != "" {
+						fmt.Fprintf(w, " %s", fd.Socket.Local)
+					}
+					if fd.Socket.Remote != "" {
+						fmt.Fprintf(w, " -> %s", fd.Socket.Remote)
+					}
+					fmt.Fprintf(w, "\n")
+				default:
+					fmt.Fprintf(w, "    %d %s %s\n", fd.FD, fd.Type, fd.Path)
+				}
+			}
+		}
+	}
+	if len(s.Mounts) > 0 {
+		fmt.Fprintf(w, "Mounts:\n")
+		for _, m := range s.Mounts {
+			fmt.Fprintf(w, "  %d %s %s\n", m.ID, m.Type, m.Point)
+		}
+	}
+}
@@ -16,14 +16,18 @@
 package state
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"os"
 
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/pgalloc"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/time"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/watchdog"
@@ -54,6 +58,18 @@ type SaveOpts struct {
 	// Metadata is save metadata.
 	Metadata map[string]string
 
+	// Checksums enables checksums of the statefile data and of each saved
+	// page of memory, verified on restore.
+	Checksums bool
+
+	// If Precopy is not nil, memory was pre-copied to the destination with
+	// it before the save, and only the pages that changed since are saved.
+	// The state must then be loaded with LoadOpts.PrecopyFile.
+	Precopy *pgalloc.PrecopyState
+
+	// Resume indicates that the kernel keeps running after the save.
+	Resume bool
+
 	// Callback is called prior to unpause, with any save error.
 	Callback func(err error)
 }
@@ -76,14 +92,17 @@ func (opts SaveOpts) Save(ctx context.Context, k *kernel.Kernel, w *watchdog.Wat
 		opts.Metadata = make(map[string]string)
 	}
 	addSaveMetadata(opts.Metadata)
+	if opts.Precopy != nil {
+		opts.Metadata[metadataPrecopy] = "true"
+	}
 
 	// Open the statefile.
-	wc, err := statefile.NewWriter(opts.Destination, opts.Key, opts.Metadata)
+	wc, err := statefile.NewWriterWithOptions(opts.Destination, opts.Key, opts.Metadata, statefile.Options{Checksums: opts.Checksums})
 	if err != nil {
 		err = ErrStateFile{err}
 	} else {
 		// Save the kernel.
-		err = k.SaveTo(ctx, wc)
+		err = k.SaveTo(ctx, wc, pgalloc.StateOpts{PageChecksums: opts.Checksums, Precopy: opts.Precopy}, opts.Resume)
 
 		// ENOSPC is a state file error. This error can only come from
 		// writing the state file, and not from fs.FileOperations.Fsync
@@ -107,18 +126,148 @@ type LoadOpts struct {
 
 	// Key is used for state integrity check.
 	Key []byte
+
+	// Progress, if not nil, tracks the progress of the load, and allows
+	// canceling it.
+	Progress *LoadProgress
+
+	// PrecopyFile holds the memory pre-copied before the state was saved,
+	// if it was saved with SaveOpts.Precopy. See pgalloc.ReadPrecopy.
+	PrecopyFile *os.File
 }
 
 // Load loads the given kernel, setting the provided platform and stack.
 func (opts LoadOpts) Load(ctx context.Context, k *kernel.Kernel, timeReady chan struct{}, n inet.Stack, clocks time.Clocks, vfsOpts *vfs.CompleteRestoreOptions) error {
+	src := opts.Source
+	mfOpts := pgalloc.StateOpts{}
+	if p := opts.Progress; p != nil {
+		src = &progressReader{r: src, p: p}
+		mfOpts.PagesLoaded = &p.pagesLoaded
+		o := *vfsOpts
+		o.FileRestored = func() { p.filesRestored.Add(1) }
+		vfsOpts = &o
+	}
+
 	// Open the file.
-	r, m, err := statefile.NewReader(opts.Source, opts.Key)
+	r, m, err := statefile.NewReader(src, opts.Key)
 	if err != nil {
-		return ErrStateFile{err}
+		return opts.Progress.loadError(ErrStateFile{err})
 	}
 
 	previousMetadata = m
 
 	// Restore the Kernel object graph.
-	return k.LoadFrom(ctx, r, timeReady, n, clocks, vfsOpts)
+	mfOpts.PageChecksums = statefile.Checksums(m)
+	if Precopied(m) {
+		if opts.PrecopyFile == nil {
+			return opts.Progress.loadError(ErrStateFile{fmt.Errorf("state was saved after pre-copying memory, which is missing")})
+		}
+		mfOpts.PrecopyFile = opts.PrecopyFile
+	}
+	if err := k.LoadFrom(ctx, r, mfOpts, timeReady, n, clocks, vfsOpts); err != nil {
+		return opts.Progress.loadError(err)
+	}
+	// Don't let the restored sandbox start if the load was canceled after
+	// the statefile was read.
+	return opts.Progress.loadError(nil)
+}
+
+// ErrLoadCanceled is returned by LoadOpts.Load if the load was canceled with
+// LoadProgress.Cancel.
+var ErrLoadCanceled = errors.New("restore canceled")
+
+// LoadProgress tracks the progress of LoadOpts.Load. Its methods may be called
+// concurrently with the load.
+type LoadProgress struct {
+	// totalBytes is the size of the statefile, or 0 if unknown.
+	totalBytes int64
+
+	// bytesRead is the number of bytes read from the statefile.
+	bytesRead atomicbitops.Int64
+
+	// pagesLoaded is the number of memory pages loaded.
+	pagesLoaded atomicbitops.Uint64
+
+	// filesRestored is the number of files reattached to their host files.
+	filesRestored atomicbitops.Uint64
+
+	// canceled is true if the load was canceled.
+	canceled atomicbitops.Bool
+}
+
+// NewLoadProgress returns a LoadProgress for a statefile of totalBytes bytes,
+// or of unknown size if totalBytes is 0.
+func NewLoadProgress(totalBytes int64) *LoadProgress {
+	return &LoadProgress{totalBytes: totalBytes}
+}
+
+// LoadStats is a snapshot of a LoadProgress.
+type LoadStats struct {
+	// BytesRead is the number of bytes read from the statefile.
+	BytesRead int64 `json:"bytes_read"`
+
+	// TotalBytes is the size of the statefile, or 0 if unknown.
+	TotalBytes int64 `json:"total_bytes"`
+
+	// PagesLoaded is the number of memory pages loaded.
+	PagesLoaded uint64 `json:"pages_loaded"`
+
+	// FilesRestored is the number of files reattached to their host files.
+	FilesRestored uint64 `json:"files_restored"`
+
+	// Canceled is true if the load was canceled.
+	Canceled bool `json:"canceled"`
+}
+
+// Percent returns how much of the statefile has been read, in percent, or -1
+// if the size of the statefile is unknown.
+func (s *LoadStats) Percent() int {
+	if s.TotalBytes <= 0 {
+		return -1
+	}
+	return int(s.BytesRead * 100 / s.TotalBytes)
+}
+
+// Stats returns the current progress of the load.
+func (p *LoadProgress) Stats() LoadStats {
+	return LoadStats{
+		BytesRead:     p.bytesRead.Load(),
+		TotalBytes:    p.totalBytes,
+		PagesLoaded:   p.pagesLoaded.Load(),
+		FilesRestored: p.filesRestored.Load(),
+		Canceled:      p.canceled.Load(),
+	}
+}
+
+// Cancel makes the load fail with ErrLoadCanceled. Reading the statefile is
+// interrupted; other steps of the load, like reattaching files, run to
+// completion first.
+func (p *LoadProgress) Cancel() {
+	p.canceled.Store(true)
+}
+
+// loadError returns the error that a load tracked by p returns instead of err.
+// p may be nil.
+func (p *LoadProgress) loadError(err error) error {
+	if p != nil && p.canceled.Load() {
+		return ErrLoadCanceled
+	}
+	return err
+}
+
+// progressReader is an io.Reader that counts the bytes read in a
+// LoadProgress, and fails once the load is canceled.
+type progressReader struct {
+	r io.Reader
+	p *LoadProgress
+}
+
+// Read implements io.Reader.Read.
+func (pr *progressReader) Read(b []byte) (int, error) {
+	if pr.p.canceled.Load() {
+		return 0, ErrLoadCanceled
+	}
+	n, err := pr.r.Read(b)
+	pr.p.bytesRead.Add(int64(n))
+	return n, err
 }
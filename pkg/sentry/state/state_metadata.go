@@ -30,6 +30,16 @@ const (
 	metadataTimestamp = "timestamp"
 )
 
+// metadataPrecopy is the save metadata key set if memory was pre-copied
+// before the save, see SaveOpts.Precopy.
+const metadataPrecopy = "precopy"
+
+// Precopied returns true if the state with the given metadata was saved after
+// pre-copying memory, and can only be loaded with the pre-copied memory.
+func Precopied(m map[string]string) bool {
+	return m[metadataPrecopy] == "true"
+}
+
 func addSaveMetadata(m map[string]string) {
 	t, err := CPUTime()
 	if err != nil {
@@ -0,0 +1,88 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/pgalloc"
+	"github.com/talismancer/gvisor-ligolo/pkg/state"
+	"github.com/talismancer/gvisor-ligolo/pkg/state/statefile"
+	"github.com/talismancer/gvisor-ligolo/pkg/state/wire"
+)
+
+// Verify reads the whole statefile from r without restoring it, and returns
+// an error if it is corrupted. The metadata is always verified; the state data
+// is verified if the file has an integrity key or checksums, and saved memory
+// pages are verified if the file has checksums. It returns the statefile
+// metadata.
+func Verify(r io.Reader, key []byte) (map[string]string, error) {
+	rc, m, err := statefile.NewReader(r, key)
+	if err != nil {
+		return nil, err
+	}
+	if Precopied(m) {
+		return nil, fmt.Errorf("state saved after pre-copying memory can't be verified on its own")
+	}
+	// Skip the CPUID FeatureSet and the kernel, see Kernel.SaveTo.
+	for _, name := range []string{"CPUID", "kernel"} {
+		if err := skipObjectGraph(rc); err != nil {
+			return nil, fmt.Errorf("reading %s state: %w", name, err)
+		}
+	}
+	if err := pgalloc.VerifyFrom(context.Background(), rc, pgalloc.StateOpts{PageChecksums: statefile.Checksums(m)}); err != nil {
+		return nil, fmt.Errorf("reading memory: %w", err)
+	}
+	// Read any remaining data, verifying the last chunks.
+	if n, err := io.Copy(io.Discard, rc); err != nil {
+		return nil, err
+	} else if n != 0 {
+		return nil, fmt.Errorf("%d unexpected bytes after memory", n)
+	}
+	return m, nil
+}
+
+// skipObjectGraph reads an object graph saved by state.Save from r.
+func skipObjectGraph(r wire.Reader) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if rErr, ok := r.(error); ok {
+				err = rErr
+				return
+			}
+			panic(r)
+		}
+	}()
+	length, object, err := state.ReadHeader(r)
+	if err != nil {
+		return err
+	}
+	if !object {
+		return fmt.Errorf("expected object graph, got %d bytes of data", length)
+	}
+	for i := uint64(0); i < length; {
+		switch we := wire.Load(r).(type) {
+		case *wire.Type:
+		case wire.Uint:
+			i++
+			wire.Load(r)
+		default:
+			return fmt.Errorf("wanted type or object ID, got %T", we)
+		}
+	}
+	return nil
+}
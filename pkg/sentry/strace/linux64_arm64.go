@@ -315,6 +315,7 @@ var linuxARM64 = SyscallMap{
 	435: makeSyscallInfo("clone3", Hex, Hex),
 	436: makeSyscallInfo("close_range", FD, FD, CloseRangeFlags),
 	441: makeSyscallInfo("epoll_pwait2", FD, EpollEvents, Hex, Timespec, SigSet),
+	462: makeSyscallInfo("mseal", Hex, Hex, Hex),
 }
 
 func init() {
@@ -81,7 +81,7 @@ var AMD64 = &kernel.SyscallTable{
 		26:  syscalls.PartiallySupported("msync", Msync, "Full data flush is not guaranteed at this time.", nil),
 		27:  syscalls.PartiallySupported("mincore", Mincore, "Stub implementation. The sandbox does not have access to this information. Reports all mapped pages are resident.", nil),
 		28:  syscalls.PartiallySupported("madvise", Madvise, "Options MADV_DONTNEED, MADV_DONTFORK are supported. Other advice is ignored.", nil),
-		29:  syscalls.PartiallySupported("shmget", Shmget, "Option SHM_HUGETLB is not supported.", nil),
+		29:  syscalls.PartiallySupported("shmget", Shmget, "SHM_HUGETLB segments are not backed by reserved huge pages, only by transparent huge pages if the host allows it.", nil),
 		30:  syscalls.PartiallySupported("shmat", Shmat, "Option SHM_RND is not supported.", nil),
 		31:  syscalls.PartiallySupported("shmctl", Shmctl, "Options SHM_LOCK, SHM_UNLOCK are not supported.", nil),
 		32:  syscalls.SupportedPoint("dup", Dup, PointDup),
@@ -108,7 +108,7 @@ var AMD64 = &kernel.SyscallTable{
 		53:  syscalls.SupportedPoint("socketpair", SocketPair, PointSocketpair),
 		54:  syscalls.Supported("setsockopt", SetSockOpt),
 		55:  syscalls.Supported("getsockopt", GetSockOpt),
-		56:  syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Mount namespace (CLONE_NEWNS) not supported. Options CLONE_PARENT, CLONE_SYSVSEM not supported.", nil),
+		56:  syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Mount namespace (CLONE_NEWNS) only supported with nested containers. Options CLONE_PARENT, CLONE_SYSVSEM not supported.", nil),
 		57:  syscalls.SupportedPoint("fork", Fork, PointFork),
 		58:  syscalls.SupportedPoint("vfork", Vfork, PointVfork),
 		59:  syscalls.SupportedPoint("execve", Execve, PointExecve),
@@ -194,13 +194,13 @@ var AMD64 = &kernel.SyscallTable{
 		139: syscalls.ErrorWithEvent("sysfs", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/165"}),
 		140: syscalls.PartiallySupported("getpriority", Getpriority, "Stub implementation.", nil),
 		141: syscalls.PartiallySupported("setpriority", Setpriority, "Stub implementation.", nil),
-		142: syscalls.CapError("sched_setparam", linux.CAP_SYS_NICE, "", nil),
-		143: syscalls.PartiallySupported("sched_getparam", SchedGetparam, "Stub implementation.", nil),
-		144: syscalls.PartiallySupported("sched_setscheduler", SchedSetscheduler, "Stub implementation.", nil),
-		145: syscalls.PartiallySupported("sched_getscheduler", SchedGetscheduler, "Stub implementation.", nil),
-		146: syscalls.PartiallySupported("sched_get_priority_max", SchedGetPriorityMax, "Stub implementation.", nil),
-		147: syscalls.PartiallySupported("sched_get_priority_min", SchedGetPriorityMin, "Stub implementation.", nil),
-		148: syscalls.ErrorWithEvent("sched_rr_get_interval", linuxerr.EPERM, "", nil),
+		142: syscalls.PartiallySupported("sched_setparam", SchedSetparam, "Real-time priorities only affect the order in which futex waiters are woken.", nil),
+		143: syscalls.Supported("sched_getparam", SchedGetparam),
+		144: syscalls.PartiallySupported("sched_setscheduler", SchedSetscheduler, "Real-time priorities only affect the order in which futex waiters are woken.", nil),
+		145: syscalls.Supported("sched_getscheduler", SchedGetscheduler),
+		146: syscalls.Supported("sched_get_priority_max", SchedGetPriorityMax),
+		147: syscalls.Supported("sched_get_priority_min", SchedGetPriorityMin),
+		148: syscalls.Supported("sched_rr_get_interval", SchedRRGetInterval),
 		149: syscalls.PartiallySupported("mlock", Mlock, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
 		150: syscalls.PartiallySupported("munlock", Munlock, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
 		151: syscalls.PartiallySupported("mlockall", Mlockall, "Stub implementation. The sandbox lacks appropriate permissions.", nil),
@@ -294,15 +294,15 @@ var AMD64 = &kernel.SyscallTable{
 		239: syscalls.PartiallySupported("get_mempolicy", GetMempolicy, "Stub implementation.", nil),
 		240: syscalls.Supported("mq_open", MqOpen),
 		241: syscalls.Supported("mq_unlink", MqUnlink),
-		242: syscalls.ErrorWithEvent("mq_timedsend", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}),    // TODO(b/29354921)
-		243: syscalls.ErrorWithEvent("mq_timedreceive", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}), // TODO(b/29354921)
-		244: syscalls.ErrorWithEvent("mq_notify", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}),       // TODO(b/29354921)
-		245: syscalls.ErrorWithEvent("mq_getsetattr", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}),   // TODO(b/29354921)
+		242: syscalls.Supported("mq_timedsend", MqTimedsend),
+		243: syscalls.Supported("mq_timedreceive", MqTimedreceive),
+		244: syscalls.PartiallySupported("mq_notify", MqNotify, "SIGEV_THREAD notifications are not supported.", nil),
+		245: syscalls.Supported("mq_getsetattr", MqGetsetattr),
 		246: syscalls.CapError("kexec_load", linux.CAP_SYS_BOOT, "", nil),
 		247: syscalls.Supported("waitid", Waitid),
-		248: syscalls.Error("add_key", linuxerr.EACCES, "Not available to user.", nil),
-		249: syscalls.Error("request_key", linuxerr.EACCES, "Not available to user.", nil),
-		250: syscalls.Error("keyctl", linuxerr.EACCES, "Not available to user.", nil),
+		248: syscalls.PartiallySupported("add_key", AddKey, "Only \"user\" keys and \"keyring\" keyrings are supported.", nil),
+		249: syscalls.PartiallySupported("request_key", RequestKey, "Keys are only searched for, never constructed by calling out to userspace.", nil),
+		250: syscalls.PartiallySupported("keyctl", Keyctl, "Thread and process keyrings, key timeouts and key construction are not supported.", nil),
 		251: syscalls.CapError("ioprio_set", linux.CAP_SYS_ADMIN, "", nil), // requires cap_sys_nice or cap_sys_admin (depending)
 		252: syscalls.CapError("ioprio_get", linux.CAP_SYS_ADMIN, "", nil), // requires cap_sys_nice or cap_sys_admin (depending)
 		253: syscalls.PartiallySupportedPoint("inotify_init", InotifyInit, PointInotifyInit, "inotify events are only available inside the sandbox.", nil),
@@ -324,7 +324,7 @@ var AMD64 = &kernel.SyscallTable{
 		269: syscalls.Supported("faccessat", Faccessat),
 		270: syscalls.Supported("pselect6", Pselect6),
 		271: syscalls.Supported("ppoll", Ppoll),
-		272: syscalls.PartiallySupported("unshare", Unshare, "Mount, cgroup namespaces not supported. Network namespaces supported but must be empty.", nil),
+		272: syscalls.PartiallySupported("unshare", Unshare, "Mount namespaces only supported with nested containers. Cgroup namespaces not supported. Network namespaces supported but must be empty.", nil),
 		273: syscalls.Supported("set_robust_list", SetRobustList),
 		274: syscalls.Supported("get_robust_list", GetRobustList),
 		275: syscalls.Supported("splice", Splice),
@@ -407,6 +407,7 @@ var AMD64 = &kernel.SyscallTable{
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
+		462: syscalls.Supported("mseal", Mseal),
 	},
 	Emulate: map[hostarch.Addr]uintptr{
 		0xffffffffff600000: 96,  // vsyscall gettimeofday(2)
@@ -528,7 +529,7 @@ var ARM64 = &kernel.SyscallTable{
 		94:  syscalls.Supported("exit_group", ExitGroup),
 		95:  syscalls.Supported("waitid", Waitid),
 		96:  syscalls.Supported("set_tid_address", SetTidAddress),
-		97:  syscalls.PartiallySupported("unshare", Unshare, "Mount, cgroup namespaces not supported. Network namespaces supported but must be empty.", nil),
+		97:  syscalls.PartiallySupported("unshare", Unshare, "Mount namespaces only supported with nested containers. Cgroup namespaces not supported. Network namespaces supported but must be empty.", nil),
 		98:  syscalls.PartiallySupported("futex", Futex, "Robust futexes not supported.", nil),
 		99:  syscalls.Supported("set_robust_list", SetRobustList),
 		100: syscalls.Supported("get_robust_list", GetRobustList),
@@ -549,16 +550,16 @@ var ARM64 = &kernel.SyscallTable{
 		115: syscalls.Supported("clock_nanosleep", ClockNanosleep),
 		116: syscalls.PartiallySupported("syslog", Syslog, "Outputs a dummy message for security reasons.", nil),
 		117: syscalls.PartiallySupported("ptrace", Ptrace, "Options PTRACE_PEEKSIGINFO, PTRACE_SECCOMP_GET_FILTER not supported.", nil),
-		118: syscalls.CapError("sched_setparam", linux.CAP_SYS_NICE, "", nil),
-		119: syscalls.PartiallySupported("sched_setscheduler", SchedSetscheduler, "Stub implementation.", nil),
-		120: syscalls.PartiallySupported("sched_getscheduler", SchedGetscheduler, "Stub implementation.", nil),
-		121: syscalls.PartiallySupported("sched_getparam", SchedGetparam, "Stub implementation.", nil),
+		118: syscalls.PartiallySupported("sched_setparam", SchedSetparam, "Real-time priorities only affect the order in which futex waiters are woken.", nil),
+		119: syscalls.PartiallySupported("sched_setscheduler", SchedSetscheduler, "Real-time priorities only affect the order in which futex waiters are woken.", nil),
+		120: syscalls.Supported("sched_getscheduler", SchedGetscheduler),
+		121: syscalls.Supported("sched_getparam", SchedGetparam),
 		122: syscalls.PartiallySupported("sched_setaffinity", SchedSetaffinity, "Stub implementation.", nil),
 		123: syscalls.PartiallySupported("sched_getaffinity", SchedGetaffinity, "Stub implementation.", nil),
 		124: syscalls.Supported("sched_yield", SchedYield),
-		125: syscalls.PartiallySupported("sched_get_priority_max", SchedGetPriorityMax, "Stub implementation.", nil),
-		126: syscalls.PartiallySupported("sched_get_priority_min", SchedGetPriorityMin, "Stub implementation.", nil),
-		127: syscalls.ErrorWithEvent("sched_rr_get_interval", linuxerr.EPERM, "", nil),
+		125: syscalls.Supported("sched_get_priority_max", SchedGetPriorityMax),
+		126: syscalls.Supported("sched_get_priority_min", SchedGetPriorityMin),
+		127: syscalls.Supported("sched_rr_get_interval", SchedRRGetInterval),
 		128: syscalls.Supported("restart_syscall", RestartSyscall),
 		129: syscalls.Supported("kill", Kill),
 		130: syscalls.Supported("tkill", Tkill),
@@ -613,10 +614,10 @@ var ARM64 = &kernel.SyscallTable{
 		179: syscalls.PartiallySupported("sysinfo", Sysinfo, "Fields loads, sharedram, bufferram, totalswap, freeswap, totalhigh, freehigh not supported.", nil),
 		180: syscalls.Supported("mq_open", MqOpen),
 		181: syscalls.Supported("mq_unlink", MqUnlink),
-		182: syscalls.ErrorWithEvent("mq_timedsend", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}),    // TODO(b/29354921)
-		183: syscalls.ErrorWithEvent("mq_timedreceive", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}), // TODO(b/29354921)
-		184: syscalls.ErrorWithEvent("mq_notify", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}),       // TODO(b/29354921)
-		185: syscalls.ErrorWithEvent("mq_getsetattr", linuxerr.ENOSYS, "", []string{"gvisor.dev/issue/136"}),   // TODO(b/29354921)
+		182: syscalls.Supported("mq_timedsend", MqTimedsend),
+		183: syscalls.Supported("mq_timedreceive", MqTimedreceive),
+		184: syscalls.PartiallySupported("mq_notify", MqNotify, "SIGEV_THREAD notifications are not supported.", nil),
+		185: syscalls.Supported("mq_getsetattr", MqGetsetattr),
 		186: syscalls.Supported("msgget", Msgget),
 		187: syscalls.Supported("msgctl", Msgctl),
 		188: syscalls.Supported("msgrcv", Msgrcv),
@@ -625,7 +626,7 @@ var ARM64 = &kernel.SyscallTable{
 		191: syscalls.Supported("semctl", Semctl),
 		192: syscalls.Supported("semtimedop", Semtimedop),
 		193: syscalls.PartiallySupported("semop", Semop, "Option SEM_UNDO not supported.", nil),
-		194: syscalls.PartiallySupported("shmget", Shmget, "Option SHM_HUGETLB is not supported.", nil),
+		194: syscalls.PartiallySupported("shmget", Shmget, "SHM_HUGETLB segments are not backed by reserved huge pages, only by transparent huge pages if the host allows it.", nil),
 		195: syscalls.PartiallySupported("shmctl", Shmctl, "Options SHM_LOCK, SHM_UNLOCK are not supported.", nil),
 		196: syscalls.PartiallySupported("shmat", Shmat, "Option SHM_RND is not supported.", nil),
 		197: syscalls.Supported("shmdt", Shmdt),
@@ -648,10 +649,10 @@ var ARM64 = &kernel.SyscallTable{
 		214: syscalls.Supported("brk", Brk),
 		215: syscalls.Supported("munmap", Munmap),
 		216: syscalls.Supported("mremap", Mremap),
-		217: syscalls.Error("add_key", linuxerr.EACCES, "Not available to user.", nil),
-		218: syscalls.Error("request_key", linuxerr.EACCES, "Not available to user.", nil),
-		219: syscalls.Error("keyctl", linuxerr.EACCES, "Not available to user.", nil),
-		220: syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Mount namespace (CLONE_NEWNS) not supported. Options CLONE_PARENT, CLONE_SYSVSEM not supported.", nil),
+		217: syscalls.PartiallySupported("add_key", AddKey, "Only \"user\" keys and \"keyring\" keyrings are supported.", nil),
+		218: syscalls.PartiallySupported("request_key", RequestKey, "Keys are only searched for, never constructed by calling out to userspace.", nil),
+		219: syscalls.PartiallySupported("keyctl", Keyctl, "Thread and process keyrings, key timeouts and key construction are not supported.", nil),
+		220: syscalls.PartiallySupportedPoint("clone", Clone, PointClone, "Mount namespace (CLONE_NEWNS) only supported with nested containers. Options CLONE_PARENT, CLONE_SYSVSEM not supported.", nil),
 		221: syscalls.SupportedPoint("execve", Execve, PointExecve),
 		222: syscalls.Supported("mmap", Mmap),
 		223: syscalls.PartiallySupported("fadvise64", Fadvise64, "Not all options are supported.", nil),
@@ -728,6 +729,7 @@ var ARM64 = &kernel.SyscallTable{
 		436: syscalls.Supported("close_range", CloseRange),
 		439: syscalls.Supported("faccessat2", Faccessat2),
 		441: syscalls.Supported("epoll_pwait2", EpollPwait2),
+		462: syscalls.Supported("mseal", Mseal),
 	},
 	Emulate: map[hostarch.Addr]uintptr{},
 	Missing: func(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, error) {
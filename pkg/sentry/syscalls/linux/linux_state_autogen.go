@@ -43,6 +43,40 @@ func (f *futexWaitRestartBlock) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(4, &f.mask)
 }
 
+func (n *mqSignalNotifier) StateTypeName() string {
+	return "pkg/sentry/syscalls/linux.mqSignalNotifier"
+}
+
+func (n *mqSignalNotifier) StateFields() []string {
+	return []string{
+		"tg",
+		"userNS",
+		"signo",
+		"value",
+	}
+}
+
+func (n *mqSignalNotifier) beforeSave() {}
+
+// +checklocksignore
+func (n *mqSignalNotifier) StateSave(stateSinkObject state.Sink) {
+	n.beforeSave()
+	stateSinkObject.Save(0, &n.tg)
+	stateSinkObject.Save(1, &n.userNS)
+	stateSinkObject.Save(2, &n.signo)
+	stateSinkObject.Save(3, &n.value)
+}
+
+func (n *mqSignalNotifier) afterLoad() {}
+
+// +checklocksignore
+func (n *mqSignalNotifier) StateLoad(stateSourceObject state.Source) {
+	stateSourceObject.Load(0, &n.tg)
+	stateSourceObject.Load(1, &n.userNS)
+	stateSourceObject.Load(2, &n.signo)
+	stateSourceObject.Load(3, &n.value)
+}
+
 func (p *pollRestartBlock) StateTypeName() string {
 	return "pkg/sentry/syscalls/linux.pollRestartBlock"
 }
@@ -107,6 +141,7 @@ func (n *clockNanosleepRestartBlock) StateLoad(stateSourceObject state.Source) {
 
 func init() {
 	state.Register((*futexWaitRestartBlock)(nil))
+	state.Register((*mqSignalNotifier)(nil))
 	state.Register((*pollRestartBlock)(nil))
 	state.Register((*clockNanosleepRestartBlock)(nil))
 }
@@ -432,7 +432,7 @@ func PivotRoot(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 	}
 	defer newRootVd.DecRef(t)
 
-	if err := t.Kernel().VFS().PivotRoot(t, t.Credentials(), &newRootTpop.pop, &putOldTpop.pop); err != nil {
+	if err := t.Kernel().VFS().PivotRoot(t, t.Credentials(), &newRootTpop.pop, &putOldTpop.pop, t.Kernel().NestedContainers()); err != nil {
 		return 0, nil, err
 	}
 	t.Kernel().ReplaceFSContextRoots(t, oldRootVd, newRootVd)
@@ -881,6 +881,7 @@ func posixLock(t *kernel.Task, args arch.SyscallArguments, file *vfs.FileDescrip
 // This implementation currently ignores the provided advice.
 func Fadvise64(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	fd := args[0].Int()
+	offset := args[1].Int64()
 	length := args[2].Int64()
 	advice := args[3].Int()
 
@@ -915,7 +916,10 @@ func Fadvise64(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 		return 0, nil, linuxerr.EINVAL
 	}
 
-	// Sure, whatever.
+	// Advice is only a hint, so errors acting on it aren't reported.
+	if err := file.Advise(t, offset, length, advice); err != nil {
+		t.Debugf("fadvise64(%d, %d, %d, %d) failed: %v", fd, offset, length, advice, err)
+	}
 	return 0, nil, nil
 }
 
@@ -1619,8 +1623,8 @@ func Fallocate(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 	if !file.IsWritable() {
 		return 0, nil, linuxerr.EBADF
 	}
-	if mode != 0 {
-		return 0, nil, linuxerr.ENOTSUP
+	if err := checkFallocateMode(mode); err != nil {
+		return 0, nil, err
 	}
 	if offset < 0 || length <= 0 {
 		return 0, nil, linuxerr.EINVAL
@@ -1630,18 +1634,45 @@ func Fallocate(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintp
 	if size < 0 {
 		return 0, nil, linuxerr.EFBIG
 	}
-	limit := limits.FromContext(t).Get(limits.FileSize).Cur
-	if uint64(size) >= limit {
-		t.SendSignal(&linux.SignalInfo{
-			Signo: int32(linux.SIGXFSZ),
-			Code:  linux.SI_USER,
-		})
-		return 0, nil, linuxerr.EFBIG
+	// Only modes that may extend the file to size are subject to
+	// RLIMIT_FSIZE.
+	if mode&(linux.FALLOC_FL_KEEP_SIZE|linux.FALLOC_FL_COLLAPSE_RANGE|linux.FALLOC_FL_INSERT_RANGE) == 0 {
+		limit := limits.FromContext(t).Get(limits.FileSize).Cur
+		if uint64(size) >= limit {
+			t.SendSignal(&linux.SignalInfo{
+				Signo: int32(linux.SIGXFSZ),
+				Code:  linux.SI_USER,
+			})
+			return 0, nil, linuxerr.EFBIG
+		}
 	}
 
 	return 0, nil, file.Allocate(t, mode, uint64(offset), uint64(length))
 }
 
+// checkFallocateMode checks that mode is a valid combination of fallocate(2)
+// flags. Compare Linux's fs/open.c:vfs_fallocate().
+func checkFallocateMode(mode uint64) error {
+	const supported = linux.FALLOC_FL_KEEP_SIZE | linux.FALLOC_FL_PUNCH_HOLE | linux.FALLOC_FL_COLLAPSE_RANGE | linux.FALLOC_FL_ZERO_RANGE | linux.FALLOC_FL_INSERT_RANGE
+	switch {
+	case mode&^supported != 0:
+		return linuxerr.EOPNOTSUPP
+	case mode&(linux.FALLOC_FL_PUNCH_HOLE|linux.FALLOC_FL_ZERO_RANGE) == linux.FALLOC_FL_PUNCH_HOLE|linux.FALLOC_FL_ZERO_RANGE:
+		// Punch hole and zero range are mutually exclusive.
+		return linuxerr.EOPNOTSUPP
+	case mode&linux.FALLOC_FL_PUNCH_HOLE != 0 && mode&linux.FALLOC_FL_KEEP_SIZE == 0:
+		// Punch hole must have keep size set.
+		return linuxerr.EOPNOTSUPP
+	case mode&linux.FALLOC_FL_COLLAPSE_RANGE != 0 && mode != linux.FALLOC_FL_COLLAPSE_RANGE:
+		// Collapse range should only be used exclusively.
+		return linuxerr.EINVAL
+	case mode&linux.FALLOC_FL_INSERT_RANGE != 0 && mode != linux.FALLOC_FL_INSERT_RANGE:
+		// Insert range should only be used exclusively.
+		return linuxerr.EINVAL
+	}
+	return nil
+}
+
 // Flock implements linux syscall flock(2).
 func Flock(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	fd := args[0].Int()
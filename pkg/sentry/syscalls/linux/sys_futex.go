@@ -22,6 +22,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/arch"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/futex"
 	ktime "github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/time"
 )
 
@@ -58,23 +59,30 @@ func futexWaitAbsolute(t *kernel.Task, clockRealtime bool, ts linux.Timespec, fo
 		return 0, err
 	}
 
+	err = futexBlockAbsolute(t, w, clockRealtime, ts, forever)
+	t.Futex().WaitComplete(w, t)
+	return 0, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+}
+
+// futexBlockAbsolute blocks until w is woken, forever if forever is true,
+// otherwise until ts, measured against CLOCK_REALTIME if clockRealtime is
+// true or CLOCK_MONOTONIC otherwise.
+func futexBlockAbsolute(t *kernel.Task, w *futex.Waiter, clockRealtime bool, ts linux.Timespec, forever bool) error {
 	if forever {
-		err = t.Block(w.C)
-	} else if clockRealtime {
+		return t.Block(w.C)
+	}
+	if clockRealtime {
 		notifier, tchan := ktime.NewChannelNotifier()
 		timer := ktime.NewTimer(t.Kernel().RealtimeClock(), notifier)
 		timer.Swap(ktime.Setting{
 			Enabled: true,
-			Next:    ktime.FromTimespec(ts),
+			Next:    t.SlackDeadline(ktime.FromTimespec(ts)),
 		})
-		err = t.BlockWithTimer(w.C, tchan)
+		err := t.BlockWithTimer(w.C, tchan)
 		timer.Destroy()
-	} else {
-		err = t.BlockWithDeadline(w.C, true, ktime.FromTimespec(ts))
+		return err
 	}
-
-	t.Futex().WaitComplete(w, t)
-	return 0, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+	return t.BlockWithDeadline(w.C, true, ktime.FromTimespec(ts))
 }
 
 // futexWaitDuration performs a FUTEX_WAIT, blocking until the wait is
@@ -124,7 +132,9 @@ func futexWaitDuration(t *kernel.Task, duration time.Duration, forever bool, add
 	return 0, linuxerr.ERESTART_RESTARTBLOCK
 }
 
-func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr hostarch.Addr, private bool) error {
+// futexLockPI performs a FUTEX_LOCK_PI or FUTEX_LOCK_PI2, blocking until the
+// futex is acquired or until ts, as for futexBlockAbsolute.
+func futexLockPI(t *kernel.Task, clockRealtime bool, ts linux.Timespec, forever bool, addr hostarch.Addr, private bool) error {
 	w := t.FutexWaiter()
 	locked, err := t.Futex().LockPI(w, t, addr, uint32(t.ThreadID()), private, false)
 	if err != nil {
@@ -135,21 +145,40 @@ func futexLockPI(t *kernel.Task, ts linux.Timespec, forever bool, addr hostarch.
 		return nil
 	}
 
-	if forever {
-		err = t.Block(w.C)
-	} else {
-		notifier, tchan := ktime.NewChannelNotifier()
-		timer := ktime.NewTimer(t.Kernel().RealtimeClock(), notifier)
-		timer.Swap(ktime.Setting{
-			Enabled: true,
-			Next:    ktime.FromTimespec(ts),
-		})
-		err = t.BlockWithTimer(w.C, tchan)
-		timer.Destroy()
+	err = futexBlockAbsolute(t, w, clockRealtime, ts, forever)
+	t.Futex().WaitComplete(w, t)
+	if w.LockedPI() {
+		// The futex was handed over to us, even if the wait also timed out or
+		// was interrupted.
+		return nil
+	}
+	return linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+}
+
+// futexWaitRequeuePI performs a FUTEX_WAIT_REQUEUE_PI, blocking until the wait
+// is woken, or until the PI futex at addr2 is acquired after a
+// FUTEX_CMP_REQUEUE_PI, or until ts, as for futexBlockAbsolute.
+func futexWaitRequeuePI(t *kernel.Task, clockRealtime bool, ts linux.Timespec, forever bool, addr, addr2 hostarch.Addr, private bool, val uint32) error {
+	w := t.FutexWaiter()
+	if err := t.Futex().WaitRequeuePIPrepare(w, t, addr, addr2, private, val, uint32(t.ThreadID())); err != nil {
+		return err
 	}
 
+	err := futexBlockAbsolute(t, w, clockRealtime, ts, forever)
 	t.Futex().WaitComplete(w, t)
-	return linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+	switch {
+	case w.LockedPI():
+		return nil
+	case err == nil:
+		// Woken without acquiring the PI futex, e.g. by FUTEX_WAKE.
+		return linuxerr.EWOULDBLOCK
+	case w.RequeuedPI() && err == linuxerr.ErrInterrupted:
+		// Like Linux, don't restart the syscall: the value at addr has
+		// changed, so it would fail anyway.
+		return linuxerr.EWOULDBLOCK
+	default:
+		return linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+	}
 }
 
 func tryLockPI(t *kernel.Task, addr hostarch.Addr, private bool) error {
@@ -255,7 +284,12 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		n, err := t.Futex().WakeOp(t, addr, naddr, private, val, nreq, op)
 		return uintptr(n), nil, err
 
-	case linux.FUTEX_LOCK_PI:
+	case linux.FUTEX_LOCK_PI, linux.FUTEX_LOCK_PI2:
+		if cmd == linux.FUTEX_LOCK_PI && clockRealtime {
+			// Only FUTEX_LOCK_PI2 takes the clock flag, see
+			// kernel/futex/syscalls.c:do_futex.
+			return 0, nil, linuxerr.ENOSYS
+		}
 		forever := (timeout == 0)
 
 		var timespec linux.Timespec
@@ -266,7 +300,9 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 				return 0, nil, err
 			}
 		}
-		err := futexLockPI(t, timespec, forever, addr, private)
+		// FUTEX_LOCK_PI timeouts are always measured against CLOCK_REALTIME,
+		// FUTEX_LOCK_PI2 timeouts against CLOCK_MONOTONIC by default.
+		err := futexLockPI(t, cmd == linux.FUTEX_LOCK_PI || clockRealtime, timespec, forever, addr, private)
 		return 0, nil, err
 
 	case linux.FUTEX_TRYLOCK_PI:
@@ -277,9 +313,28 @@ func Futex(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		err := t.Futex().UnlockPI(t, addr, uint32(t.ThreadID()), private)
 		return 0, nil, err
 
-	case linux.FUTEX_WAIT_REQUEUE_PI, linux.FUTEX_CMP_REQUEUE_PI:
-		t.Kernel().EmitUnimplementedEvent(t, sysno)
-		return 0, nil, linuxerr.ENOSYS
+	case linux.FUTEX_WAIT_REQUEUE_PI:
+		forever := (timeout == 0)
+
+		var timespec linux.Timespec
+		if !forever {
+			var err error
+			timespec, err = copyTimespecIn(t, timeout)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+		err := futexWaitRequeuePI(t, clockRealtime, timespec, forever, addr, naddr, private, uint32(val))
+		return 0, nil, err
+
+	case linux.FUTEX_CMP_REQUEUE_PI:
+		// Like Linux, only one waiter can be woken, since it must acquire the
+		// PI futex.
+		if val != 1 || nreq < 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		n, err := t.Futex().CmpRequeuePI(t, addr, naddr, private, uint32(val3), nreq)
+		return uintptr(n), nil, err
 
 	default:
 		// We don't even know about this command.
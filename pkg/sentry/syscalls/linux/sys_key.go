@@ -0,0 +1,402 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linux
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/arch"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+)
+
+// maxKeyTypeLen is the maximum length of a key type name.
+const maxKeyTypeLen = 32
+
+// lookupKey returns the key with serial id, which may be one of the special
+// KEY_SPEC_* IDs. If create is true, the special keyrings are created if
+// they don't exist yet.
+func lookupKey(t *kernel.Task, id int32, create bool) (auth.KeyRef, error) {
+	creds := t.Credentials()
+	keys := creds.UserNamespace.Keys()
+	switch id {
+	case linux.KEY_SPEC_THREAD_KEYRING, linux.KEY_SPEC_PROCESS_KEYRING:
+		// Thread and process keyrings are not supported.
+		if create {
+			return auth.KeyRef{}, linuxerr.EOPNOTSUPP
+		}
+		return auth.KeyRef{}, linuxerr.ENOKEY
+	case linux.KEY_SPEC_SESSION_KEYRING:
+		if creds.SessionKeyring != nil {
+			return auth.KeyRef{Key: creds.SessionKeyring, Possessed: true}, nil
+		}
+		if create {
+			k, err := keys.JoinSessionKeyring(creds, "")
+			if err != nil {
+				return auth.KeyRef{}, err
+			}
+			t.SetSessionKeyring(k)
+			return auth.KeyRef{Key: k, Possessed: true}, nil
+		}
+		// Without a session keyring, the user session keyring is used.
+		k, err := keys.UserKeyring(creds, true /* session */)
+		if err != nil {
+			return auth.KeyRef{}, err
+		}
+		return auth.KeyRef{Key: k, Possessed: true}, nil
+	case linux.KEY_SPEC_USER_KEYRING, linux.KEY_SPEC_USER_SESSION_KEYRING:
+		k, err := keys.UserKeyring(creds, id == linux.KEY_SPEC_USER_SESSION_KEYRING)
+		if err != nil {
+			return auth.KeyRef{}, err
+		}
+		return auth.KeyRef{Key: k, Possessed: true}, nil
+	case linux.KEY_SPEC_REQKEY_AUTH_KEY:
+		// Keys are never requested from userspace, see RequestKey.
+		return auth.KeyRef{}, linuxerr.ENOKEY
+	}
+	if id <= 0 {
+		return auth.KeyRef{}, linuxerr.EINVAL
+	}
+	k, err := keys.Find(auth.KeySerial(id))
+	if err != nil {
+		return auth.KeyRef{}, err
+	}
+	return auth.KeyRef{Key: k}, nil
+}
+
+// copyInKeyType copies in a key type and checks that it's supported.
+func copyInKeyType(t *kernel.Task, addr hostarch.Addr) (string, error) {
+	typ, err := t.CopyInString(addr, maxKeyTypeLen)
+	if err != nil {
+		if linuxerr.Equals(linuxerr.ENAMETOOLONG, err) {
+			return "", linuxerr.EINVAL
+		}
+		return "", err
+	}
+	if typ == "" || typ[0] == '.' {
+		// Types starting with a dot are internal to the kernel.
+		return "", linuxerr.EPERM
+	}
+	if typ != auth.KeyTypeKeyring && typ != auth.KeyTypeUser {
+		return "", linuxerr.ENODEV
+	}
+	return typ, nil
+}
+
+// copyInKeyDescription copies in a key description.
+func copyInKeyDescription(t *kernel.Task, addr hostarch.Addr) (string, error) {
+	desc, err := t.CopyInString(addr, auth.MaxKeyDescription+1)
+	if err != nil {
+		if linuxerr.Equals(linuxerr.ENAMETOOLONG, err) {
+			return "", linuxerr.EINVAL
+		}
+		return "", err
+	}
+	if desc == "" {
+		return "", linuxerr.EINVAL
+	}
+	return desc, nil
+}
+
+// copyInKeyPayload copies in the payload of a user key.
+func copyInKeyPayload(t *kernel.Task, addr hostarch.Addr, size uint) ([]byte, error) {
+	if size > auth.MaxKeyPayload {
+		return nil, linuxerr.EINVAL
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	payload := make([]byte, size)
+	if _, err := t.CopyInBytes(addr, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// AddKey implements Linux syscall add_key(2).
+func AddKey(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	typeAddr := args[0].Pointer()
+	descAddr := args[1].Pointer()
+	payloadAddr := args[2].Pointer()
+	size := args[3].SizeT()
+	keyringID := args[4].Int()
+
+	typ, err := copyInKeyType(t, typeAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	desc, err := copyInKeyDescription(t, descAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if typ == auth.KeyTypeKeyring && size != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	payload, err := copyInKeyPayload(t, payloadAddr, size)
+	if err != nil {
+		return 0, nil, err
+	}
+	keyring, err := lookupKey(t, keyringID, true /* create */)
+	if err != nil {
+		return 0, nil, err
+	}
+	k, err := t.Credentials().UserNamespace.Keys().Add(t.Credentials(), keyring, typ, desc, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	return uintptr(k.ID), nil, nil
+}
+
+// RequestKey implements Linux syscall request_key(2).
+//
+// Keys are only searched for in the caller's keyrings: they are never
+// constructed by calling out to /sbin/request-key.
+func RequestKey(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	typeAddr := args[0].Pointer()
+	descAddr := args[1].Pointer()
+	destID := args[3].Int()
+
+	typ, err := copyInKeyType(t, typeAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if typ == auth.KeyTypeKeyring {
+		return 0, nil, linuxerr.EPERM
+	}
+	desc, err := copyInKeyDescription(t, descAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	var dest auth.KeyRef
+	if destID != 0 {
+		if dest, err = lookupKey(t, destID, true /* create */); err != nil {
+			return 0, nil, err
+		}
+	}
+	creds := t.Credentials()
+	keys := creds.UserNamespace.Keys()
+	// Make sure that the user keyrings exist, so that they are searched
+	// without a session keyring.
+	if _, err := keys.UserKeyring(creds, true /* session */); err != nil {
+		return 0, nil, err
+	}
+	k, err := keys.Request(creds, typ, desc)
+	if err != nil {
+		return 0, nil, err
+	}
+	if dest.Key != nil {
+		if err := keys.Link(creds, auth.KeyRef{Key: k, Possessed: true}, dest); err != nil {
+			return 0, nil, err
+		}
+	}
+	return uintptr(k.ID), nil, nil
+}
+
+// Keyctl implements Linux syscall keyctl(2).
+func Keyctl(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	op := args[0].Int()
+	creds := t.Credentials()
+	keys := creds.UserNamespace.Keys()
+
+	switch op {
+	case linux.KEYCTL_GET_KEYRING_ID:
+		k, err := lookupKey(t, args[1].Int(), args[2].Int() != 0)
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := keys.Check(creds, k, linux.KEY_SEARCH); err != nil {
+			return 0, nil, err
+		}
+		return uintptr(k.Key.ID), nil, nil
+
+	case linux.KEYCTL_JOIN_SESSION_KEYRING:
+		var name string
+		if nameAddr := args[1].Pointer(); nameAddr != 0 {
+			var err error
+			if name, err = copyInKeyDescription(t, nameAddr); err != nil {
+				return 0, nil, err
+			}
+		}
+		k, err := keys.JoinSessionKeyring(creds, name)
+		if err != nil {
+			return 0, nil, err
+		}
+		t.SetSessionKeyring(k)
+		return uintptr(k.ID), nil, nil
+
+	case linux.KEYCTL_UPDATE:
+		payload, err := copyInKeyPayload(t, args[2].Pointer(), args[3].SizeT())
+		if err != nil {
+			return 0, nil, err
+		}
+		k, err := lookupKey(t, args[1].Int(), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.Update(creds, k, payload)
+
+	case linux.KEYCTL_REVOKE:
+		k, err := lookupKey(t, args[1].Int(), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.Revoke(creds, k)
+
+	case linux.KEYCTL_INVALIDATE:
+		k, err := lookupKey(t, args[1].Int(), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.Invalidate(creds, k)
+
+	case linux.KEYCTL_CHOWN:
+		k, err := lookupKey(t, args[1].Int(), true /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		uid := auth.UID(args[2].Uint())
+		gid := auth.GID(args[3].Uint())
+		kuid := auth.KUID(auth.NoID)
+		kgid := auth.KGID(auth.NoID)
+		if uid.Ok() {
+			if kuid = creds.UserNamespace.MapToKUID(uid); !kuid.Ok() {
+				return 0, nil, linuxerr.EINVAL
+			}
+		}
+		if gid.Ok() {
+			if kgid = creds.UserNamespace.MapToKGID(gid); !kgid.Ok() {
+				return 0, nil, linuxerr.EINVAL
+			}
+		}
+		return 0, nil, keys.Chown(creds, k, kuid, kgid)
+
+	case linux.KEYCTL_SETPERM:
+		k, err := lookupKey(t, args[1].Int(), true /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.SetPerms(creds, k, args[2].Uint())
+
+	case linux.KEYCTL_DESCRIBE:
+		k, err := lookupKey(t, args[1].Int(), true /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		desc, err := keys.Describe(creds, k)
+		if err != nil {
+			return 0, nil, err
+		}
+		// The description is returned with its NUL terminator.
+		return copyOutKeyData(t, args[2].Pointer(), args[3].SizeT(), append([]byte(desc), 0))
+
+	case linux.KEYCTL_CLEAR:
+		k, err := lookupKey(t, args[1].Int(), true /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, keys.Clear(creds, k)
+
+	case linux.KEYCTL_LINK, linux.KEYCTL_UNLINK:
+		k, err := lookupKey(t, args[1].Int(), op == linux.KEYCTL_LINK)
+		if err != nil {
+			return 0, nil, err
+		}
+		keyring, err := lookupKey(t, args[2].Int(), true /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		if op == linux.KEYCTL_LINK {
+			return 0, nil, keys.Link(creds, k, keyring)
+		}
+		return 0, nil, keys.Unlink(creds, k, keyring)
+
+	case linux.KEYCTL_SEARCH:
+		keyring, err := lookupKey(t, args[1].Int(), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		typ, err := copyInKeyType(t, args[2].Pointer())
+		if err != nil {
+			return 0, nil, err
+		}
+		desc, err := copyInKeyDescription(t, args[3].Pointer())
+		if err != nil {
+			return 0, nil, err
+		}
+		var dest auth.KeyRef
+		if destID := args[4].Int(); destID != 0 {
+			if dest, err = lookupKey(t, destID, true /* create */); err != nil {
+				return 0, nil, err
+			}
+		}
+		k, err := keys.Search(creds, keyring, typ, desc)
+		if err != nil {
+			return 0, nil, err
+		}
+		if dest.Key != nil {
+			if err := keys.Link(creds, auth.KeyRef{Key: k, Possessed: keyring.Possessed}, dest); err != nil {
+				return 0, nil, err
+			}
+		}
+		return uintptr(k.ID), nil, nil
+
+	case linux.KEYCTL_READ:
+		k, err := lookupKey(t, args[1].Int(), false /* create */)
+		if err != nil {
+			return 0, nil, err
+		}
+		payload, ids, err := keys.Read(creds, k)
+		if err != nil {
+			return 0, nil, err
+		}
+		if k.Key.Type == auth.KeyTypeKeyring {
+			payload = make([]byte, 4*len(ids))
+			for i, id := range ids {
+				hostarch.ByteOrder.PutUint32(payload[4*i:], uint32(id))
+			}
+		}
+		return copyOutKeyData(t, args[2].Pointer(), args[3].SizeT(), payload)
+
+	case linux.KEYCTL_SET_REQKEY_KEYRING:
+		// Keys are never constructed, so the default destination keyring of
+		// request_key(2) doesn't matter. Report that it was the default one.
+		return 0, nil, nil
+
+	case linux.KEYCTL_INSTANTIATE, linux.KEYCTL_NEGATE, linux.KEYCTL_REJECT,
+		linux.KEYCTL_INSTANTIATE_IOV, linux.KEYCTL_ASSUME_AUTHORITY:
+		// There is never a key under construction.
+		return 0, nil, linuxerr.EPERM
+
+	default:
+		t.Kernel().EmitUnimplementedEvent(t, sysno)
+		return 0, nil, linuxerr.EOPNOTSUPP
+	}
+}
+
+// copyOutKeyData copies data out to a buffer of size size at addr, if it fits,
+// and returns the size of data.
+func copyOutKeyData(t *kernel.Task, addr hostarch.Addr, size uint, data []byte) (uintptr, *kernel.SyscallControl, error) {
+	if addr != 0 && size > 0 {
+		n := len(data)
+		if uint(n) > size {
+			n = int(size)
+		}
+		if _, err := t.CopyOutBytes(addr, data[:n]); err != nil {
+			return 0, nil, err
+		}
+	}
+	return uintptr(len(data)), nil, nil
+}
@@ -166,6 +166,19 @@ func Mprotect(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintpt
 	return 0, nil, err
 }
 
+// Mseal implements linux syscall mseal(2).
+func Mseal(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	addr := args[0].Pointer()
+	length := args[1].Uint64()
+	flags := args[2].Uint64()
+
+	// No flags are currently defined.
+	if flags != 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	return 0, nil, t.MemoryManager().MSeal(addr, length)
+}
+
 // Madvise implements linux syscall madvise(2).
 func Madvise(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	addr := args[0].Pointer()
@@ -201,10 +214,15 @@ func Madvise(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr
 	case linux.MADV_DONTDUMP, linux.MADV_DODUMP:
 		// TODO(b/72045799): Core dumping isn't implemented, so these are
 		// no-ops.
-		fallthrough
-	case linux.MADV_NORMAL, linux.MADV_RANDOM, linux.MADV_SEQUENTIAL, linux.MADV_WILLNEED:
-		// Do nothing, we totally ignore the suggestions above.
 		return 0, nil, nil
+	case linux.MADV_NORMAL:
+		return 0, nil, t.MemoryManager().Advise(t, addr, length, linux.POSIX_FADV_NORMAL)
+	case linux.MADV_RANDOM:
+		return 0, nil, t.MemoryManager().Advise(t, addr, length, linux.POSIX_FADV_RANDOM)
+	case linux.MADV_SEQUENTIAL:
+		return 0, nil, t.MemoryManager().Advise(t, addr, length, linux.POSIX_FADV_SEQUENTIAL)
+	case linux.MADV_WILLNEED:
+		return 0, nil, t.MemoryManager().Advise(t, addr, length, linux.POSIX_FADV_WILLNEED)
 	case linux.MADV_REMOVE:
 		// These "suggestions" have application-visible side effects, so we
 		// have to indicate that we don't support them.
@@ -46,8 +46,7 @@ func Mount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	}
 
 	// Silently allow MS_NOSUID, since we don't implement set-id bits anyway.
-	const unsupported = linux.MS_REMOUNT | linux.MS_SLAVE |
-		linux.MS_UNBINDABLE | linux.MS_MOVE | linux.MS_REC | linux.MS_NODIRATIME |
+	const unsupported = linux.MS_UNBINDABLE | linux.MS_MOVE | linux.MS_NODIRATIME |
 		linux.MS_STRICTATIME
 
 	// Linux just allows passing any flags to mount(2) - it won't fail when
@@ -56,6 +55,11 @@ func Mount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	if flags&(unsupported) != 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
+	// MS_REC is only supported to change the propagation type of a mount
+	// tree.
+	if flags&linux.MS_REC != 0 && flags&(linux.MS_SHARED|linux.MS_PRIVATE|linux.MS_SLAVE) == 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
 
 	// For null-terminated strings related to mount(2), Linux copies in at most
 	// a page worth of data. See fs/namespace.c:copy_mount_string().
@@ -69,6 +73,16 @@ func Mount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	}
 	defer target.Release(t)
 
+	if flags&linux.MS_REMOUNT == linux.MS_REMOUNT {
+		// Unlike for new mounts, source and fstype are ignored.
+		data, err := copyInMountData(t, dataAddr)
+		if err != nil {
+			return 0, nil, err
+		}
+		opts := mountOptionsFromFlags(flags)
+		opts.GetFilesystemOptions.Data = data
+		return 0, nil, t.Kernel().VFS().RemountAt(t, creds, &target.pop, &opts, flags&linux.MS_BIND == linux.MS_BIND)
+	}
 	if flags&linux.MS_BIND == linux.MS_BIND {
 		var sourcePath fspath.Path
 		sourcePath, err = copyInPath(t, sourceAddr)
@@ -91,7 +105,7 @@ func Mount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 			return 0, nil, linuxerr.EINVAL
 		}
 		propType := vfs.PropagationTypeFromLinux(propFlag)
-		return 0, nil, t.Kernel().VFS().SetMountPropagationAt(t, creds, &target.pop, propType)
+		return 0, nil, t.Kernel().VFS().SetMountPropagationAt(t, creds, &target.pop, propType, flags&linux.MS_REC != 0)
 	}
 
 	// Only copy in source, fstype, and data if we are doing a normal mount.
@@ -103,17 +117,31 @@ func Mount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	if err != nil {
 		return 0, nil, err
 	}
-	data := ""
-	if dataAddr != 0 {
-		// In Linux, a full page is always copied in regardless of null
-		// character placement, and the address is passed to each file system.
-		// Most file systems always treat this data as a string, though, and so
-		// do all of the ones we implement.
-		data, err = t.CopyInString(dataAddr, hostarch.PageSize)
-		if err != nil {
-			return 0, nil, err
-		}
+	data, err := copyInMountData(t, dataAddr)
+	if err != nil {
+		return 0, nil, err
 	}
+	opts := mountOptionsFromFlags(flags)
+	opts.GetFilesystemOptions.Data = data
+	_, err = t.Kernel().VFS().MountAt(t, creds, source, &target.pop, fsType, &opts)
+	return 0, nil, err
+}
+
+// copyInMountData copies in the data argument of mount(2).
+func copyInMountData(t *kernel.Task, dataAddr hostarch.Addr) (string, error) {
+	if dataAddr == 0 {
+		return "", nil
+	}
+	// In Linux, a full page is always copied in regardless of null
+	// character placement, and the address is passed to each file system.
+	// Most file systems always treat this data as a string, though, and so
+	// do all of the ones we implement.
+	return t.CopyInString(dataAddr, hostarch.PageSize)
+}
+
+// mountOptionsFromFlags returns the vfs.MountOptions for the flags argument
+// of mount(2).
+func mountOptionsFromFlags(flags uint64) vfs.MountOptions {
 	var opts vfs.MountOptions
 	if flags&linux.MS_NOATIME == linux.MS_NOATIME {
 		opts.Flags.NoATime = true
@@ -130,9 +158,7 @@ func Mount(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	if flags&linux.MS_RDONLY == linux.MS_RDONLY {
 		opts.ReadOnly = true
 	}
-	opts.GetFilesystemOptions.Data = data
-	_, err = t.Kernel().VFS().MountAt(t, creds, source, &target.pop, fsType, &opts)
-	return 0, nil, err
+	return opts
 }
 
 // Umount2 implements Linux syscall umount2(2).
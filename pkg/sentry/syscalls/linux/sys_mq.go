@@ -16,9 +16,17 @@ package linux
 
 import (
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
+	"github.com/talismancer/gvisor-ligolo/pkg/marshal/primitive"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/arch"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/mqfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/mq"
+	ktime "github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/time"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 )
 
 // MqOpen implements mq_open(2).
@@ -77,6 +85,246 @@ func MqUnlink(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintpt
 	return 0, nil, t.IPCNamespace().PosixQueues().Remove(t, name)
 }
 
+// MqTimedsend implements mq_timedsend(2).
+func MqTimedsend(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	msgAddr := args[1].Pointer()
+	size := args[2].SizeT()
+	priority := args[3].Uint()
+	timeoutAddr := args[4].Pointer()
+
+	file, view, err := getMqView(t, fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	if size > mq.MaxMessageSize {
+		return 0, nil, linuxerr.EMSGSIZE
+	}
+	text := make([]byte, size)
+	if _, err := t.CopyInBytes(msgAddr, text); err != nil {
+		return 0, nil, err
+	}
+	b, err := newMqBlocker(t, timeoutAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer b.destroy()
+
+	msg := mq.Message{
+		Text:     string(text),
+		Size:     uint64(size),
+		Priority: priority,
+	}
+	err = view.Send(t, msg, b, file.StatusFlags()&linux.O_NONBLOCK == 0)
+	return 0, nil, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+}
+
+// MqTimedreceive implements mq_timedreceive(2).
+func MqTimedreceive(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	msgAddr := args[1].Pointer()
+	size := args[2].SizeT()
+	priorityAddr := args[3].Pointer()
+	timeoutAddr := args[4].Pointer()
+
+	file, view, err := getMqView(t, fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	b, err := newMqBlocker(t, timeoutAddr)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer b.destroy()
+
+	msg, err := view.Receive(t, b, uint64(size), file.StatusFlags()&linux.O_NONBLOCK == 0)
+	if err != nil {
+		return 0, nil, linuxerr.ConvertIntr(err, linuxerr.ERESTARTSYS)
+	}
+	// As in Linux, the message is lost if it can't be copied out.
+	if _, err := t.CopyOutBytes(msgAddr, []byte(msg.Text)); err != nil {
+		return 0, nil, err
+	}
+	if priorityAddr != 0 {
+		priority := primitive.Uint32(msg.Priority)
+		if _, err := priority.CopyOut(t, priorityAddr); err != nil {
+			return 0, nil, err
+		}
+	}
+	return uintptr(msg.Size), nil, nil
+}
+
+// MqNotify implements mq_notify(2).
+func MqNotify(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	sevAddr := args[1].Pointer()
+
+	var sub *mq.Subscriber
+	if sevAddr != 0 {
+		var sev linux.Sigevent
+		if _, err := sev.CopyIn(t, sevAddr); err != nil {
+			return 0, nil, err
+		}
+		switch sev.Notify {
+		case linux.SIGEV_NONE:
+			sub = mq.NewSubscriber(sev.Notify, 0, nil)
+		case linux.SIGEV_SIGNAL:
+			if !linux.Signal(sev.Signo).IsValid() {
+				return 0, nil, linuxerr.EINVAL
+			}
+			sub = mq.NewSubscriber(sev.Notify, sev.Signo, &mqSignalNotifier{
+				tg:     t.ThreadGroup(),
+				userNS: t.UserNamespace(),
+				signo:  sev.Signo,
+				value:  sev.Value,
+			})
+		default:
+			// SIGEV_THREAD requires netlink notification sockets, which
+			// aren't supported.
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+
+	file, view, err := getMqView(t, fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+	return 0, nil, view.Subscribe(t, sub)
+}
+
+// MqGetsetattr implements mq_getsetattr(2).
+func MqGetsetattr(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	fd := args[0].Int()
+	newAttrAddr := args[1].Pointer()
+	oldAttrAddr := args[2].Pointer()
+
+	file, view, err := getMqView(t, fd)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.DecRef(t)
+
+	var newAttr linux.MqAttr
+	if newAttrAddr != 0 {
+		if _, err := newAttr.CopyIn(t, newAttrAddr); err != nil {
+			return 0, nil, err
+		}
+		// Only O_NONBLOCK can be changed.
+		if newAttr.MqFlags&^linux.O_NONBLOCK != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+
+	flags := file.StatusFlags()
+	if oldAttrAddr != 0 {
+		oldAttr := view.Attr()
+		oldAttr.MqFlags = int64(flags & linux.O_NONBLOCK)
+		if _, err := oldAttr.CopyOut(t, oldAttrAddr); err != nil {
+			return 0, nil, err
+		}
+	}
+	if newAttrAddr != 0 {
+		flags = flags&^linux.O_NONBLOCK | uint32(newAttr.MqFlags)
+		if err := file.SetStatusFlags(t, t.Credentials(), flags); err != nil {
+			return 0, nil, err
+		}
+	}
+	return 0, nil, nil
+}
+
+// getMqView returns the file with the given FD and its message queue view.
+// The caller must release the returned file's reference.
+func getMqView(t *kernel.Task, fd int32) (*vfs.FileDescription, mq.View, error) {
+	file := t.GetFile(fd)
+	if file == nil {
+		return nil, nil, linuxerr.EBADF
+	}
+	view, ok := mqfs.View(file)
+	if !ok {
+		file.DecRef(t)
+		return nil, nil, linuxerr.EBADF
+	}
+	return file, view, nil
+}
+
+// mqBlocker implements mq.Blocker. It blocks until the absolute
+// CLOCK_REALTIME timeout of mq_timedsend(2) and mq_timedreceive(2), if any.
+type mqBlocker struct {
+	t     *kernel.Task
+	timer *ktime.Timer
+	tchan <-chan struct{}
+}
+
+// newMqBlocker returns a blocker for the timeout at timeoutAddr, which may be
+// NULL. The caller must call destroy on the returned blocker.
+func newMqBlocker(t *kernel.Task, timeoutAddr hostarch.Addr) (*mqBlocker, error) {
+	b := &mqBlocker{t: t}
+	if timeoutAddr == 0 {
+		return b, nil
+	}
+	var ts linux.Timespec
+	if _, err := ts.CopyIn(t, timeoutAddr); err != nil {
+		return nil, err
+	}
+	if !ts.Valid() {
+		return nil, linuxerr.EINVAL
+	}
+	notifier, tchan := ktime.NewChannelNotifier()
+	b.timer = ktime.NewTimer(t.Kernel().RealtimeClock(), notifier)
+	b.timer.Swap(ktime.Setting{
+		Enabled: true,
+		Next:    ktime.FromTimespec(ts),
+	})
+	b.tchan = tchan
+	return b, nil
+}
+
+// Block implements mq.Blocker.Block.
+func (b *mqBlocker) Block(C <-chan struct{}) error {
+	return b.t.BlockWithTimer(C, b.tchan)
+}
+
+// destroy releases the timer of b.
+func (b *mqBlocker) destroy() {
+	if b.timer != nil {
+		b.timer.Destroy()
+	}
+}
+
+// mqSignalNotifier implements mq.Notifier for SIGEV_SIGNAL notifications.
+//
+// +stateify savable
+type mqSignalNotifier struct {
+	// tg is the thread group that registered for notification.
+	tg *kernel.ThreadGroup
+
+	// userNS is the user namespace of tg when it registered.
+	userNS *auth.UserNamespace
+
+	// signo and value are the signal and value of the notification.
+	signo int32
+	value uint64
+}
+
+// Notify implements mq.Notifier.Notify.
+func (n *mqSignalNotifier) Notify(ctx context.Context) {
+	info := &linux.SignalInfo{
+		Signo: n.signo,
+		Code:  linux.SI_MESGQ,
+	}
+	info.SetSigval(n.value)
+	if sender := kernel.TaskFromContext(ctx); sender != nil {
+		info.SetPID(int32(n.tg.PIDNamespace().IDOfThreadGroup(sender.ThreadGroup())))
+		info.SetUID(int32(sender.Credentials().RealKUID.In(n.userNS).OrOverflow()))
+	}
+	n.tg.SendSignal(info)
+}
+
 func openOpts(name string, rOnly, wOnly, readWrite, create, exclusive, block bool) mq.OpenOpts {
 	var access mq.AccessType
 	switch {
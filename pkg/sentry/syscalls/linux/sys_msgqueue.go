@@ -50,7 +50,7 @@ func Msgsnd(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	size := args[2].Int64()
 	flag := args[3].Int()
 
-	if size < 0 || size > linux.MSGMAX {
+	if size < 0 || size > t.IPCNamespace().MsgqueueRegistry().MaxMessageSize() {
 		return 0, nil, linuxerr.EINVAL
 	}
 
@@ -16,6 +16,7 @@ package linux
 
 import (
 	"fmt"
+	"math"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
@@ -237,14 +238,48 @@ func Prctl(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 		_, err := primitive.CopyInt32Out(t, args[1].Pointer(), isSubreaper)
 		return 0, nil, err
 
+	case linux.PR_SET_TIMERSLACK:
+		// "If the nanosecond value supplied in arg2 is greater than zero, then
+		// the "current" value is set to this value. If arg2 is equal to zero,
+		// the "current" timer slack is reset to the thread's "default" timer
+		// slack value." - prctl(2)
+		slack := args[1].Uint64()
+		if slack > math.MaxInt64 {
+			slack = math.MaxInt64
+		}
+		t.SetTimerSlack(int64(slack))
+		return 0, nil, nil
+
+	case linux.PR_GET_TIMERSLACK:
+		return uintptr(t.TimerSlack()), nil, nil
+
+	case linux.PR_SET_MDWE:
+		flags := args[1].Uint64()
+		if args[2].Int() != 0 || args[3].Int() != 0 || args[4].Int() != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		if flags&^(linux.PR_MDWE_REFUSE_EXEC_GAIN|linux.PR_MDWE_NO_INHERIT) != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		// PR_MDWE_NO_INHERIT is only meaningful along with
+		// PR_MDWE_REFUSE_EXEC_GAIN.
+		if flags == linux.PR_MDWE_NO_INHERIT {
+			return 0, nil, linuxerr.EINVAL
+		}
+		return 0, nil, t.MemoryManager().SetMDWE(uint32(flags))
+
+	case linux.PR_GET_MDWE:
+		if args[1].Int() != 0 || args[2].Int() != 0 || args[3].Int() != 0 || args[4].Int() != 0 {
+			return 0, nil, linuxerr.EINVAL
+		}
+		return uintptr(t.MemoryManager().MDWE()), nil, nil
+
 	case linux.PR_GET_TIMING,
 		linux.PR_SET_TIMING,
 		linux.PR_GET_TSC,
 		linux.PR_SET_TSC,
 		linux.PR_TASK_PERF_EVENTS_DISABLE,
 		linux.PR_TASK_PERF_EVENTS_ENABLE,
-		linux.PR_GET_TIMERSLACK,
-		linux.PR_SET_TIMERSLACK,
 		linux.PR_MCE_KILL,
 		linux.PR_MCE_KILL_GET,
 		linux.PR_GET_TID_ADDRESS,
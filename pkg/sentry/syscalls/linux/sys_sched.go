@@ -15,16 +15,18 @@
 package linux
 
 import (
+	"time"
+
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/arch"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/limits"
 )
 
-const (
-	onlyScheduler = linux.SCHED_NORMAL
-	onlyPriority  = 0
-)
+// rrTimeslice is the timeslice of SCHED_RR tasks reported by
+// sched_rr_get_interval(2), like Linux's RR_TIMESLICE.
+const rrTimeslice = 100 * time.Millisecond
 
 // SchedParam replicates struct sched_param in sched.h.
 //
@@ -33,6 +35,70 @@ type SchedParam struct {
 	schedPriority int32
 }
 
+// schedTask returns the task with the given TID for the sched_* syscalls, or t
+// if pid is 0.
+func schedTask(t *kernel.Task, pid int32) (*kernel.Task, error) {
+	if pid < 0 {
+		return nil, linuxerr.EINVAL
+	}
+	if pid == 0 {
+		return t, nil
+	}
+	target := t.PIDNamespace().TaskWithID(kernel.ThreadID(pid))
+	if target == nil {
+		return nil, linuxerr.ESRCH
+	}
+	return target, nil
+}
+
+// priorityRange returns the range of real-time priorities of policy.
+func priorityRange(policy int32) (min, max int32, err error) {
+	switch policy {
+	case linux.SCHED_FIFO, linux.SCHED_RR:
+		return 1, linux.MAX_RT_PRIO - 1, nil
+	case linux.SCHED_NORMAL, linux.SCHED_BATCH, linux.SCHED_IDLE:
+		return 0, 0, nil
+	default:
+		return 0, 0, linuxerr.EINVAL
+	}
+}
+
+// setSchedPolicy validates p and sets it as the scheduling policy of target,
+// like kernel/sched/core.c:__sched_setscheduler.
+func setSchedPolicy(t, target *kernel.Task, p kernel.SchedPolicy) error {
+	minPrio, maxPrio, err := priorityRange(p.Policy)
+	if err != nil {
+		return err
+	}
+	if p.RTPriority < minPrio || p.RTPriority > maxPrio {
+		return linuxerr.EINVAL
+	}
+
+	if !t.HasCapabilityIn(linux.CAP_SYS_NICE, target.UserNamespace()) {
+		creds, targetCreds := t.Credentials(), target.Credentials()
+		if creds.EffectiveKUID != targetCreds.EffectiveKUID && creds.EffectiveKUID != targetCreds.RealKUID {
+			return linuxerr.EPERM
+		}
+		cur := target.SchedPolicy()
+		if p.IsRealTime() {
+			// Unprivileged tasks can only raise their real-time priority up
+			// to RLIMIT_RTPRIO.
+			rlim := target.ThreadGroup().Limits().Get(limits.RealTimePriority).Cur
+			if p.Policy != cur.Policy && rlim == 0 {
+				return linuxerr.EPERM
+			}
+			if p.RTPriority > cur.RTPriority && uint64(p.RTPriority) > rlim {
+				return linuxerr.EPERM
+			}
+		}
+		if cur.ResetOnFork && !p.ResetOnFork {
+			return linuxerr.EPERM
+		}
+	}
+	target.SetSchedPolicy(p)
+	return nil
+}
+
 // SchedGetparam implements linux syscall sched_getparam(2).
 func SchedGetparam(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	pid := args[0].Int()
@@ -40,13 +106,11 @@ func SchedGetparam(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (u
 	if param == 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
-	if pid < 0 {
-		return 0, nil, linuxerr.EINVAL
-	}
-	if pid != 0 && t.PIDNamespace().TaskWithID(kernel.ThreadID(pid)) == nil {
-		return 0, nil, linuxerr.ESRCH
+	target, err := schedTask(t, pid)
+	if err != nil {
+		return 0, nil, err
 	}
-	r := SchedParam{schedPriority: onlyPriority}
+	r := SchedParam{schedPriority: target.SchedPolicy().RTPriority}
 	if _, err := r.CopyOut(t, param); err != nil {
 		return 0, nil, err
 	}
@@ -54,16 +118,39 @@ func SchedGetparam(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (u
 	return 0, nil, nil
 }
 
+// SchedSetparam implements linux syscall sched_setparam(2).
+func SchedSetparam(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	pid := args[0].Int()
+	param := args[1].Pointer()
+	if param == 0 {
+		return 0, nil, linuxerr.EINVAL
+	}
+	var r SchedParam
+	if _, err := r.CopyIn(t, param); err != nil {
+		return 0, nil, linuxerr.EFAULT
+	}
+	target, err := schedTask(t, pid)
+	if err != nil {
+		return 0, nil, err
+	}
+	p := target.SchedPolicy()
+	p.RTPriority = r.schedPriority
+	return 0, nil, setSchedPolicy(t, target, p)
+}
+
 // SchedGetscheduler implements linux syscall sched_getscheduler(2).
 func SchedGetscheduler(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
 	pid := args[0].Int()
-	if pid < 0 {
-		return 0, nil, linuxerr.EINVAL
+	target, err := schedTask(t, pid)
+	if err != nil {
+		return 0, nil, err
 	}
-	if pid != 0 && t.PIDNamespace().TaskWithID(kernel.ThreadID(pid)) == nil {
-		return 0, nil, linuxerr.ESRCH
+	p := target.SchedPolicy()
+	policy := uintptr(p.Policy)
+	if p.ResetOnFork {
+		policy |= linux.SCHED_RESET_ON_FORK
 	}
-	return onlyScheduler, nil, nil
+	return policy, nil, nil
 }
 
 // SchedSetscheduler implements linux syscall sched_setscheduler(2).
@@ -71,31 +158,48 @@ func SchedSetscheduler(t *kernel.Task, sysno uintptr, args arch.SyscallArguments
 	pid := args[0].Int()
 	policy := args[1].Int()
 	param := args[2].Pointer()
-	if pid < 0 {
+	if policy < 0 || param == 0 {
 		return 0, nil, linuxerr.EINVAL
 	}
-	if policy != onlyScheduler {
-		return 0, nil, linuxerr.EINVAL
-	}
-	if pid != 0 && t.PIDNamespace().TaskWithID(kernel.ThreadID(pid)) == nil {
-		return 0, nil, linuxerr.ESRCH
-	}
 	var r SchedParam
 	if _, err := r.CopyIn(t, param); err != nil {
-		return 0, nil, linuxerr.EINVAL
+		return 0, nil, linuxerr.EFAULT
 	}
-	if r.schedPriority != onlyPriority {
-		return 0, nil, linuxerr.EINVAL
+	target, err := schedTask(t, pid)
+	if err != nil {
+		return 0, nil, err
 	}
-	return 0, nil, nil
+	return 0, nil, setSchedPolicy(t, target, kernel.SchedPolicy{
+		Policy:      policy &^ linux.SCHED_RESET_ON_FORK,
+		RTPriority:  r.schedPriority,
+		ResetOnFork: policy&linux.SCHED_RESET_ON_FORK != 0,
+	})
 }
 
 // SchedGetPriorityMax implements linux syscall sched_get_priority_max(2).
 func SchedGetPriorityMax(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return onlyPriority, nil, nil
+	_, maxPrio, err := priorityRange(args[0].Int())
+	return uintptr(maxPrio), nil, err
 }
 
 // SchedGetPriorityMin implements linux syscall sched_get_priority_min(2).
 func SchedGetPriorityMin(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
-	return onlyPriority, nil, nil
+	minPrio, _, err := priorityRange(args[0].Int())
+	return uintptr(minPrio), nil, err
+}
+
+// SchedRRGetInterval implements linux syscall sched_rr_get_interval(2).
+func SchedRRGetInterval(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr, *kernel.SyscallControl, error) {
+	pid := args[0].Int()
+	addr := args[1].Pointer()
+	target, err := schedTask(t, pid)
+	if err != nil {
+		return 0, nil, err
+	}
+	// The sentry doesn't have timeslices for other policies.
+	var ts linux.Timespec
+	if target.SchedPolicy().Policy == linux.SCHED_RR {
+		ts = linux.NsecToTimespec(rrTimeslice.Nanoseconds())
+	}
+	return 0, nil, copyTimespecOut(t, addr, &ts)
 }
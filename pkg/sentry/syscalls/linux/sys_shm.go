@@ -17,6 +17,7 @@ package linux
 import (
 	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
 	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/arch"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/ipc"
@@ -34,9 +35,17 @@ func Shmget(t *kernel.Task, sysno uintptr, args arch.SyscallArguments) (uintptr,
 	exclusive := flag&linux.IPC_EXCL == linux.IPC_EXCL
 	mode := linux.FileMode(flag & 0777)
 
+	hugetlb := flag&linux.SHM_HUGETLB != 0
+	if hugetlb {
+		// Only the default huge page size is supported.
+		if pageShift := (flag >> linux.SHM_HUGE_SHIFT) & linux.SHM_HUGE_MASK; pageShift != 0 && pageShift != hostarch.HugePageShift {
+			return 0, nil, linuxerr.EINVAL
+		}
+	}
+
 	pid := int32(t.ThreadGroup().ID())
 	r := t.IPCNamespace().ShmRegistry()
-	segment, err := r.FindOrCreate(t, pid, key, size, mode, private, create, exclusive)
+	segment, err := r.FindOrCreate(t, pid, key, size, mode, private, create, exclusive, hugetlb)
 	if err != nil {
 		return 0, nil, err
 	}
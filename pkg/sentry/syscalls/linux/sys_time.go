@@ -250,7 +250,7 @@ func clockNanosleepUntil(t *kernel.Task, c ktime.Clock, end ktime.Time, rem host
 		timer.Swap(ktime.Setting{
 			Period:  0,
 			Enabled: true,
-			Next:    end,
+			Next:    t.SlackDeadline(end),
 		})
 		err = t.BlockWithTimer(nil, tchan)
 		timer.Destroy()
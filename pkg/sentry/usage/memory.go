@@ -353,17 +353,30 @@ func (m *MemoryLocked) CopyPerCg(memCgID uint32) (MemoryStats, uint64) {
 }
 
 // These options control how much total memory the is reported to the
-// application. They may only be set before the application starts executing,
-// and must not be modified.
+// application. They may be changed while the application is running, see
+// SetTotalMemoryBytes.
 var (
 	// MinimumTotalMemoryBytes is the minimum reported total system memory.
-	MinimumTotalMemoryBytes uint64 = 2 << 30 // 2 GB
+	MinimumTotalMemoryBytes = atomicbitops.FromUint64(2 << 30) // 2 GB
 
 	// MaximumTotalMemoryBytes is the maximum reported total system memory.
 	// The 0 value indicates no maximum.
-	MaximumTotalMemoryBytes uint64
+	MaximumTotalMemoryBytes atomicbitops.Uint64
+
+	// BalloonBytes is the amount of memory the host asked the sandbox to
+	// return to it. Like memory claimed by a balloon driver, the part of it
+	// that the application doesn't use is deducted from the reported total
+	// system memory. See pgalloc.MemoryFile.SetBalloonTarget.
+	BalloonBytes atomicbitops.Uint64
 )
 
+// SetTotalMemoryBytes sets the total system memory reported to the
+// application to n bytes, and returns the previous maximum.
+func SetTotalMemoryBytes(n uint64) uint64 {
+	MinimumTotalMemoryBytes.Store(n)
+	return MaximumTotalMemoryBytes.Swap(n)
+}
+
 // TotalMemory returns the "total usable memory" available.
 //
 // This number doesn't really have a true value so it's based on the following
@@ -372,9 +385,37 @@ var (
 //
 // memSize should be the platform.Memory size reported by platform.Memory.TotalSize()
 // used is the total memory reported by MemoryLocked.Total()
+//
+// The memory returned to the host by the balloon, see BalloonSize, is
+// deducted from the result.
 func TotalMemory(memSize, used uint64) uint64 {
-	if memSize < MinimumTotalMemoryBytes {
-		memSize = MinimumTotalMemoryBytes
+	memSize = unballoonedTotalMemory(memSize, used)
+	return memSize - balloonSize(memSize, used)
+}
+
+// BalloonSize returns how much of BalloonBytes is returned to the host: the
+// memory that the application doesn't use, up to BalloonBytes. memSize and
+// used are as for TotalMemory.
+func BalloonSize(memSize, used uint64) uint64 {
+	return balloonSize(unballoonedTotalMemory(memSize, used), used)
+}
+
+// balloonSize implements BalloonSize given the total memory before the
+// balloon is deducted.
+func balloonSize(total, used uint64) uint64 {
+	if total <= used {
+		return 0
+	}
+	if b := BalloonBytes.Load(); b < total-used {
+		return b
+	}
+	return total - used
+}
+
+// unballoonedTotalMemory returns the total memory, ignoring the balloon.
+func unballoonedTotalMemory(memSize, used uint64) uint64 {
+	if min := MinimumTotalMemoryBytes.Load(); memSize < min {
+		memSize = min
 	}
 	if memSize < used {
 		memSize = used
@@ -384,8 +425,8 @@ func TotalMemory(memSize, used uint64) uint64 {
 			memSize = uint64(1) << (uint(msb) + 1)
 		}
 	}
-	if MaximumTotalMemoryBytes > 0 && memSize > MaximumTotalMemoryBytes {
-		memSize = MaximumTotalMemoryBytes
+	if max := MaximumTotalMemoryBytes.Load(); max > 0 && memSize > max {
+		memSize = max
 	}
 	return memSize
 }
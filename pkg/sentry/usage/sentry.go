@@ -0,0 +1,150 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package usage
+
+import (
+	"runtime/debug"
+	"runtime/metrics"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/metric"
+)
+
+// SentryMemoryStats is the memory used by the sentry itself, as opposed to
+// memory used on behalf of the application, which is tracked by
+// MemoryAccounting. All values are in bytes.
+type SentryMemoryStats struct {
+	// Heap is the memory occupied by heap objects, including fragmentation
+	// within heap spans.
+	Heap uint64
+
+	// HeapFree is heap memory that is mapped and not released to the host, but
+	// not occupied by objects.
+	HeapFree uint64
+
+	// Stacks is the memory used by goroutine and OS thread stacks.
+	Stacks uint64
+
+	// Runtime is the memory used by the Go runtime's own metadata and other
+	// mappings.
+	Runtime uint64
+
+	// Total is the memory mapped by the Go runtime and not released to the
+	// host: the sum of the above.
+	Total uint64
+}
+
+// sentryMemorySamples are the runtime metrics read by ReadSentryMemory.
+var sentryMemorySamples = []string{
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/heap/unused:bytes",
+	"/memory/classes/heap/free:bytes",
+	"/memory/classes/heap/stacks:bytes",
+	"/memory/classes/os-stacks:bytes",
+	"/memory/classes/total:bytes",
+	"/memory/classes/heap/released:bytes",
+}
+
+// ReadSentryMemory returns the memory currently used by the sentry itself.
+func ReadSentryMemory() SentryMemoryStats {
+	samples := make([]metrics.Sample, len(sentryMemorySamples))
+	for i, name := range sentryMemorySamples {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	v := make([]uint64, len(samples))
+	for i, s := range samples {
+		if s.Value.Kind() == metrics.KindUint64 {
+			v[i] = s.Value.Uint64()
+		}
+	}
+	stats := SentryMemoryStats{
+		Heap:     v[0] + v[1],
+		HeapFree: v[2],
+		Stacks:   v[3] + v[4],
+	}
+	if v[5] > v[6] {
+		stats.Total = v[5] - v[6]
+	}
+	if used := stats.Heap + stats.HeapFree + stats.Stacks; stats.Total > used {
+		stats.Runtime = stats.Total - used
+	}
+	return stats
+}
+
+var (
+	// SentryMemoryLimit is the cap on SentryMemoryStats.Total, in bytes. If
+	// zero, the sentry's memory isn't capped.
+	SentryMemoryLimit atomicbitops.Uint64
+
+	// sentryMemoryOverLimit is true if the sentry's memory exceeded
+	// SentryMemoryLimit when last checked.
+	sentryMemoryOverLimit atomicbitops.Bool
+
+	// sentryMemoryLimitExceeded counts the times the sentry's memory went
+	// over SentryMemoryLimit.
+	sentryMemoryLimitExceeded = metric.MustCreateNewUint64Metric("/memory/sentry_limit_exceeded", false /* sync */, "Number of times the memory used by the sentry itself went over its limit.")
+)
+
+func init() {
+	metric.MustRegisterCustomUint64Metric("/memory/sentry_heap_bytes", false /* cumulative */, false /* sync */, "Memory occupied by heap objects of the sentry itself, in bytes.", func(...*metric.FieldValue) uint64 {
+		return ReadSentryMemory().Heap
+	})
+	metric.MustRegisterCustomUint64Metric("/memory/sentry_total_bytes", false /* cumulative */, false /* sync */, "Memory used by the sentry itself rather than on behalf of the application, in bytes.", func(...*metric.FieldValue) uint64 {
+		return ReadSentryMemory().Total
+	})
+}
+
+// SentryMemoryOverLimit returns true if the sentry's memory exceeded
+// SentryMemoryLimit when last checked. Caches of the sentry stop growing while
+// it does.
+func SentryMemoryOverLimit() bool {
+	return sentryMemoryOverLimit.Load()
+}
+
+// sentryMemoryCheckInterval is the interval at which the sentry's memory is
+// compared to SentryMemoryLimit.
+const sentryMemoryCheckInterval = time.Second
+
+// StartSentryMemoryLimit caps the sentry's memory to limit bytes. The sentry's
+// memory is checked periodically; while it is over limit, caches stop growing,
+// and the Go runtime is asked to return free memory to the host each time it
+// goes over.
+func StartSentryMemoryLimit(limit uint64) {
+	if limit == 0 || SentryMemoryLimit.Swap(limit) != 0 {
+		return
+	}
+	go func() { // S/R-SAFE: not saved, only reads runtime state.
+		for range time.Tick(sentryMemoryCheckInterval) {
+			checkSentryMemory()
+		}
+	}()
+}
+
+// checkSentryMemory updates whether the sentry's memory is over
+// SentryMemoryLimit.
+func checkSentryMemory() {
+	limit := SentryMemoryLimit.Load()
+	total := ReadSentryMemory().Total
+	over := total > limit
+	if sentryMemoryOverLimit.Swap(over) || !over {
+		return
+	}
+	sentryMemoryLimitExceeded.Increment()
+	log.Warningf("Sentry memory usage %d bytes is over its limit of %d bytes, shrinking caches", total, limit)
+	debug.FreeOSMemory()
+}
@@ -152,6 +152,24 @@ func (vfs *VirtualFilesystem) GetAnonBlockDevMinor() (uint32, error) {
 	return 0, linuxerr.EMFILE
 }
 
+// GetSpecificAnonBlockDevMinor allocates the given minor device number for an
+// "anonymous" block device with major number UNNAMED_MAJOR, so that a
+// filesystem's device number doesn't depend on the order in which
+// filesystems are created. It returns EBUSY if minor is already allocated.
+func (vfs *VirtualFilesystem) GetSpecificAnonBlockDevMinor(minor uint32) error {
+	vfs.anonBlockDevMinorMu.Lock()
+	defer vfs.anonBlockDevMinorMu.Unlock()
+	const maxDevMinor = (1 << 20) - 1
+	if minor == 0 || minor >= maxDevMinor {
+		return linuxerr.EINVAL
+	}
+	if _, ok := vfs.anonBlockDevMinor[minor]; ok {
+		return linuxerr.EBUSY
+	}
+	vfs.anonBlockDevMinor[minor] = struct{}{}
+	return nil
+}
+
 // PutAnonBlockDevMinor deallocates a minor device number returned by a
 // previous call to GetAnonBlockDevMinor.
 func (vfs *VirtualFilesystem) PutAnonBlockDevMinor(minor uint32) {
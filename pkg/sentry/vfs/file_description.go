@@ -345,11 +345,14 @@ type FileDescriptionImpl interface {
 	// represented by the FileDescription.
 	StatFS(ctx context.Context) (linux.Statfs, error)
 
-	// Allocate grows the file to offset + length bytes.
-	// Only mode == 0 is supported currently.
+	// Allocate grows the file to offset + length bytes if mode == 0.
+	// Otherwise, mode is a valid combination of linux.FALLOC_FL_KEEP_SIZE,
+	// FALLOC_FL_PUNCH_HOLE, FALLOC_FL_ZERO_RANGE, FALLOC_FL_COLLAPSE_RANGE and
+	// FALLOC_FL_INSERT_RANGE, as for fallocate(2).
 	//
 	// Allocate should return EISDIR on directories, ESPIPE on pipes, and ENODEV on
-	// other files where it is not supported.
+	// other files where it is not supported. It should return EOPNOTSUPP for
+	// modes that the file doesn't support.
 	//
 	// Preconditions: The FileDescription was opened for writing.
 	Allocate(ctx context.Context, mode, offset, length uint64) error
@@ -552,11 +555,18 @@ func (fd *FileDescription) SetStat(ctx context.Context, opts SetStatOptions) err
 			Root:  fd.vd,
 			Start: fd.vd,
 		})
-		err := fd.vd.mount.fs.impl.SetStatAt(ctx, rp, opts)
+		fs := fd.vd.mount.fs
+		fs.StartWrite()
+		err := fs.impl.SetStatAt(ctx, rp, opts)
+		fs.EndWrite()
 		rp.Release(ctx)
 		return err
 	}
-	if err := fd.impl.SetStat(ctx, opts); err != nil {
+	fs := fd.vd.mount.fs
+	fs.StartWrite()
+	err := fd.impl.SetStat(ctx, opts)
+	fs.EndWrite()
+	if err != nil {
 		return err
 	}
 	if ev := InotifyEventFromStatMask(opts.Stat.Mask); ev != 0 {
@@ -593,6 +603,25 @@ func (fd *FileDescription) Allocate(ctx context.Context, mode, offset, length ui
 	return nil
 }
 
+// FileAdvisor is an optional interface implemented by FileDescriptionImpls
+// that act on posix_fadvise(2) advice.
+type FileAdvisor interface {
+	// Advise notifies the file that bytes [offset, offset+length) are
+	// expected to be accessed according to advice, a linux.POSIX_FADV_*
+	// value. A length of 0 extends to the end of the file.
+	Advise(ctx context.Context, offset, length int64, advice int32) error
+}
+
+// Advise implements posix_fadvise(2) for the file represented by
+// FileDescription. Files whose implementation doesn't implement FileAdvisor
+// ignore the advice.
+func (fd *FileDescription) Advise(ctx context.Context, offset, length int64, advice int32) error {
+	if a, ok := fd.impl.(FileAdvisor); ok {
+		return a.Advise(ctx, offset, length, advice)
+	}
+	return nil
+}
+
 // Readiness implements waiter.Waitable.Readiness.
 //
 // It returns fd's I/O readiness.
@@ -728,7 +757,10 @@ func (fd *FileDescription) ListXattr(ctx context.Context, size uint64) ([]string
 		})
 		names, err := fd.vd.mount.fs.impl.ListXattrAt(ctx, rp, size)
 		rp.Release(ctx)
-		return names, err
+		if err != nil {
+			return names, err
+		}
+		return vfsObj.lsmListXattr(names), nil
 	}
 	names, err := fd.impl.ListXattr(ctx, size)
 	if linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
@@ -736,9 +768,12 @@ func (fd *FileDescription) ListXattr(ctx context.Context, size uint64) ([]string
 		// fs/xattr.c:vfs_listxattr() falls back to allowing the security
 		// subsystem to return security extended attributes, which by default
 		// don't exist.
-		return nil, nil
+		return fd.vd.mount.vfs.lsmListXattr(nil), nil
+	}
+	if err != nil {
+		return names, err
 	}
-	return names, err
+	return fd.vd.mount.vfs.lsmListXattr(names), nil
 }
 
 // GetXattr returns the value associated with the given extended attribute for
@@ -757,26 +792,43 @@ func (fd *FileDescription) GetXattr(ctx context.Context, opts *GetXattrOptions)
 		})
 		val, err := fd.vd.mount.fs.impl.GetXattrAt(ctx, rp, *opts)
 		rp.Release(ctx)
-		return val, err
+		if err != nil {
+			return vfsObj.lsmGetXattr(opts.Name, err)
+		}
+		return val, nil
 	}
-	return fd.impl.GetXattr(ctx, *opts)
+	val, err := fd.impl.GetXattr(ctx, *opts)
+	if err != nil {
+		return fd.vd.mount.vfs.lsmGetXattr(opts.Name, err)
+	}
+	return val, nil
 }
 
 // SetXattr changes the value associated with the given extended attribute for
 // the file represented by fd.
 func (fd *FileDescription) SetXattr(ctx context.Context, opts *SetXattrOptions) error {
+	vfsObj := fd.vd.mount.vfs
+	if err := vfsObj.lsmCheckSetXattr(opts); err != nil {
+		return err
+	}
 	if fd.opts.UseDentryMetadata {
-		vfsObj := fd.vd.mount.vfs
 		rp := vfsObj.getResolvingPath(auth.CredentialsFromContext(ctx), &PathOperation{
 			Root:  fd.vd,
 			Start: fd.vd,
 		})
-		err := fd.vd.mount.fs.impl.SetXattrAt(ctx, rp, *opts)
+		fs := fd.vd.mount.fs
+		fs.StartWrite()
+		err := fs.impl.SetXattrAt(ctx, rp, *opts)
+		fs.EndWrite()
 		rp.Release(ctx)
-		return err
+		return vfsObj.lsmSetXattr(opts, err)
 	}
-	if err := fd.impl.SetXattr(ctx, *opts); err != nil {
-		return err
+	fs := fd.vd.mount.fs
+	fs.StartWrite()
+	err := fd.impl.SetXattr(ctx, *opts)
+	fs.EndWrite()
+	if err != nil {
+		return vfsObj.lsmSetXattr(opts, err)
 	}
 	fd.Dentry().InotifyWithParent(ctx, linux.IN_ATTRIB, 0, InodeEvent)
 	return nil
@@ -791,11 +843,18 @@ func (fd *FileDescription) RemoveXattr(ctx context.Context, name string) error {
 			Root:  fd.vd,
 			Start: fd.vd,
 		})
-		err := fd.vd.mount.fs.impl.RemoveXattrAt(ctx, rp, name)
+		fs := fd.vd.mount.fs
+		fs.StartWrite()
+		err := fs.impl.RemoveXattrAt(ctx, rp, name)
+		fs.EndWrite()
 		rp.Release(ctx)
 		return err
 	}
-	if err := fd.impl.RemoveXattr(ctx, name); err != nil {
+	fs := fd.vd.mount.fs
+	fs.StartWrite()
+	err := fd.impl.RemoveXattr(ctx, name)
+	fs.EndWrite()
+	if err != nil {
 		return err
 	}
 	fd.Dentry().InotifyWithParent(ctx, linux.IN_ATTRIB, 0, InodeEvent)
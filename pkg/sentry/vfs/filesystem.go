@@ -20,6 +20,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix/transport"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 )
 
 // A Filesystem is a tree of nodes represented by Dentries, which forms part of
@@ -41,6 +42,16 @@ type Filesystem struct {
 	// fsType is the FilesystemType of this Filesystem.
 	fsType FilesystemType
 
+	// freezeMu is held for reading by writes to the filesystem, and for
+	// writing while the filesystem is frozen. See freeze.go.
+	freezeMu sync.RWMutex `state:"nosave"`
+
+	// frozenMu serializes Freeze and Thaw, and protects frozen.
+	frozenMu sync.Mutex `state:"nosave"`
+
+	// frozen is true if the filesystem is frozen.
+	frozen bool `state:"nosave"`
+
 	// impl is the FilesystemImpl associated with this Filesystem. impl is
 	// immutable. This should be the last field in Dentry.
 	impl FilesystemImpl
@@ -0,0 +1,105 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+)
+
+// FilesystemFreezer is optionally implemented by FilesystemImpls that can be
+// frozen by Filesystem.Freeze, so that a consistent snapshot of the
+// filesystem's backing storage can be taken.
+type FilesystemFreezer interface {
+	// Freeze writes back all cached data of the filesystem to its backing
+	// storage. It's called after writes to the filesystem have been
+	// quiesced, and until Thaw is called the implementation must not write
+	// back data on its own.
+	Freeze(ctx context.Context) error
+
+	// Thaw undoes Freeze.
+	Thaw(ctx context.Context)
+}
+
+// freezable returns true if fs can be frozen.
+func (fs *Filesystem) freezable() bool {
+	_, ok := fs.impl.(FilesystemFreezer)
+	return ok
+}
+
+// StartWrite must be called before a filesystem operation that modifies the
+// filesystem, and EndWrite after it. Writes block while the filesystem is
+// frozen. VirtualFilesystem and FileDescription call them around metadata
+// operations; FileDescriptionImpls of filesystems that implement
+// FilesystemFreezer must call them around writes to regular files, which
+// can't be done generically since writes to e.g. FIFOs may block
+// indefinitely. Writes to files that are mapped shared aren't quiesced.
+//
+// StartWrite is a no-op for filesystems that can't be frozen.
+func (fs *Filesystem) StartWrite() {
+	if fs.freezable() {
+		fs.freezeMu.RLock()
+	}
+}
+
+// EndWrite must be called after a filesystem operation that modifies the
+// filesystem. See StartWrite.
+func (fs *Filesystem) EndWrite() {
+	if fs.freezable() {
+		fs.freezeMu.RUnlock()
+	}
+}
+
+// Freeze waits for ongoing writes to fs to complete, blocks new ones and
+// writes back cached data to fs' backing storage, like Linux's FIFREEZE. It
+// returns EOPNOTSUPP if fs can't be frozen and EBUSY if it's already frozen.
+func (fs *Filesystem) Freeze(ctx context.Context) error {
+	if !fs.freezable() {
+		return linuxerr.EOPNOTSUPP
+	}
+	fs.frozenMu.Lock()
+	defer fs.frozenMu.Unlock()
+	if fs.frozen {
+		return linuxerr.EBUSY
+	}
+	fs.freezeMu.Lock()
+	if err := fs.impl.(FilesystemFreezer).Freeze(ctx); err != nil {
+		fs.freezeMu.Unlock()
+		return err
+	}
+	fs.frozen = true
+	return nil
+}
+
+// Thaw unblocks writes to fs after Freeze, like Linux's FITHAW. It returns
+// EINVAL if fs isn't frozen.
+func (fs *Filesystem) Thaw(ctx context.Context) error {
+	fs.frozenMu.Lock()
+	defer fs.frozenMu.Unlock()
+	if !fs.frozen {
+		return linuxerr.EINVAL
+	}
+	fs.impl.(FilesystemFreezer).Thaw(ctx)
+	fs.frozen = false
+	fs.freezeMu.Unlock()
+	return nil
+}
+
+// Frozen returns true if fs is frozen.
+func (fs *Filesystem) Frozen() bool {
+	fs.frozenMu.Lock()
+	defer fs.frozenMu.Unlock()
+	return fs.frozen
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package vfs
+
+import (
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/errors/linuxerr"
+)
+
+// LSM is the Linux Security Module the sandbox presents to applications.
+// gVisor doesn't enforce any LSM policy: all tasks and files are unconfined.
+// The LSM only determines what applications probing for it observe, through
+// /proc/[pid]/attr and security extended attributes.
+type LSM int
+
+const (
+	// LSMNone presents no LSM, as a kernel built without one.
+	LSMNone LSM = iota
+
+	// LSMAppArmor presents AppArmor, enabled, with no profile loaded.
+	LSMAppArmor
+
+	// LSMSELinux presents SELinux labels on tasks and files. selinuxfs isn't
+	// provided, so libselinux reports SELinux as disabled.
+	LSMSELinux
+)
+
+const (
+	// AppArmorUnconfined is the AppArmor label of all tasks.
+	AppArmorUnconfined = "unconfined"
+
+	// SELinuxTaskContext is the SELinux context of all tasks.
+	SELinuxTaskContext = "unconfined_u:unconfined_r:unconfined_t:s0"
+
+	// SELinuxFileContext is the SELinux context of files that don't have
+	// one stored in their security.selinux extended attribute.
+	SELinuxFileContext = "system_u:object_r:unlabeled_t:s0"
+)
+
+// String returns the name of the LSM, as in /sys/kernel/security/lsm.
+func (l LSM) String() string {
+	switch l {
+	case LSMAppArmor:
+		return "apparmor"
+	case LSMSELinux:
+		return "selinux"
+	default:
+		return ""
+	}
+}
+
+// SetLSM sets the LSM presented to applications.
+//
+// Preconditions: No filesystem has been mounted.
+func (vfs *VirtualFilesystem) SetLSM(lsm LSM) {
+	vfs.lsm = lsm
+}
+
+// LSM returns the LSM presented to applications.
+func (vfs *VirtualFilesystem) LSM() LSM {
+	return vfs.lsm
+}
+
+// ValidSELinuxContext returns true if ctx is syntactically a SELinux security
+// context, "user:role:type[:level]". A trailing NUL byte is allowed.
+func ValidSELinuxContext(ctx string) bool {
+	ctx = strings.TrimSuffix(ctx, "\x00")
+	parts := strings.SplitN(ctx, ":", 4)
+	if len(parts) < 3 {
+		return false
+	}
+	for _, p := range parts {
+		if p == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// lsmListXattr adds the extended attributes provided by the LSM to names,
+// like fs/xattr.c:vfs_listxattr() falling back to
+// security_inode_listsecurity().
+func (vfs *VirtualFilesystem) lsmListXattr(names []string) []string {
+	if vfs.lsm != LSMSELinux {
+		return names
+	}
+	for _, name := range names {
+		if name == linux.XATTR_NAME_SELINUX {
+			return names
+		}
+	}
+	return append(names, linux.XATTR_NAME_SELINUX)
+}
+
+// lsmGetXattr returns the value of an extended attribute provided by the LSM
+// if the filesystem returned err getting it, like
+// security/selinux/hooks.c:selinux_inode_getsecurity(). It returns the error
+// to report otherwise.
+func (vfs *VirtualFilesystem) lsmGetXattr(name string, err error) (string, error) {
+	if vfs.lsm != LSMSELinux || name != linux.XATTR_NAME_SELINUX {
+		return "", err
+	}
+	if !linuxerr.Equals(linuxerr.ENODATA, err) && !linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
+		return "", err
+	}
+	return SELinuxFileContext, nil
+}
+
+// lsmCheckSetXattr returns an error if the LSM rejects setting an extended
+// attribute, before the filesystem is asked to.
+func (vfs *VirtualFilesystem) lsmCheckSetXattr(opts *SetXattrOptions) error {
+	if vfs.lsm == LSMSELinux && opts.Name == linux.XATTR_NAME_SELINUX && !ValidSELinuxContext(opts.Value) {
+		return linuxerr.EINVAL
+	}
+	return nil
+}
+
+// lsmSetXattr returns the error to report for setting an extended attribute
+// whose filesystem implementation returned err. SELinux contexts are accepted
+// if the filesystem can't store them, like
+// security/selinux/hooks.c:selinux_inode_setsecurity().
+func (vfs *VirtualFilesystem) lsmSetXattr(opts *SetXattrOptions, err error) error {
+	if vfs.lsm == LSMSELinux && opts.Name == linux.XATTR_NAME_SELINUX && linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
+		return nil
+	}
+	return err
+}
@@ -87,8 +87,8 @@ type Mount struct {
 	// Mount. children is protected by VirtualFilesystem.mountMu.
 	children map[*Mount]struct{}
 
-	// propagationType is propagation type of this mount. It can be shared or
-	// private.
+	// propagationType is propagation type of this mount. It can be shared,
+	// private or child (slave).
 	propType PropagationType
 
 	// sharedList is a list of mounts in the shared peer group. It is nil if
@@ -104,6 +104,14 @@ type Mount struct {
 	// in a peer group, this is 0.
 	groupID uint32
 
+	// master is a mount of the peer group that this mount receives
+	// propagation events from. It is nil unless propType is Child.
+	master *Mount
+
+	// slaves is the set of mounts for which master is this mount. Like
+	// sharedList, slaves do not hold references on each other.
+	slaves map[*Mount]struct{}
+
 	// umounted is true if VFS.umountRecursiveLocked() has been called on this
 	// Mount. VirtualFilesystem does not hold a reference on Mounts for which
 	// umounted is true. umounted is protected by VirtualFilesystem.mountMu.
@@ -151,10 +159,13 @@ func (mnt *Mount) Options() MountOptions {
 func (mnt *Mount) generateOptionalTags() string {
 	mnt.vfs.mountMu.Lock()
 	defer mnt.vfs.mountMu.Unlock()
-	// TODO(b/249777195): Support MS_SLAVE and MS_UNBINDABLE propagation types.
+	// TODO(b/249777195): Support MS_UNBINDABLE propagation type.
 	var optional string
-	if mnt.propType == Shared {
+	switch mnt.propType {
+	case Shared:
 		optional = fmt.Sprintf("shared:%d", mnt.groupID)
+	case Child:
+		optional = fmt.Sprintf("master:%d", mnt.master.groupID)
 	}
 	return optional
 }
@@ -222,6 +233,89 @@ func (vfs *VirtualFilesystem) NewMountNamespaceFrom(ctx context.Context, creds *
 	return mntns
 }
 
+// CloneMountNamespace creates a new mount namespace owned by owner that
+// contains a copy of every mount in ns, as for clone(2) and unshare(2) with
+// CLONE_NEWNS. Copies of shared mounts join the peer group of the original,
+// and copies of slaves become slaves of the same master.
+//
+// If root and cwd are on mounts of ns, they are updated to the corresponding
+// locations in the new mount namespace. The references held on their old
+// values are dropped and references are taken on the new ones.
+//
+// CloneMountNamespace is analogous to Linux's fs/namespace.c:copy_mnt_ns().
+func (vfs *VirtualFilesystem) CloneMountNamespace(ctx context.Context, owner *auth.UserNamespace, ns *MountNamespace, root, cwd *VirtualDentry) *MountNamespace {
+	newns := &MountNamespace{
+		Owner:       owner,
+		mountpoints: make(map[*Dentry]uint32),
+	}
+	newns.InitRefs()
+
+	clones := make(map[*Mount]*Mount)
+	vfs.mountMu.Lock()
+	vfs.mounts.seq.BeginWrite()
+	newns.root = vfs.cloneMountTreeLocked(ns.root, newns, clones)
+	vfs.mounts.seq.EndWrite()
+	vfs.mountMu.Unlock()
+
+	// Drop the references taken by cloneMount on connected clones; they are
+	// held by their mount parents now.
+	for _, clone := range clones {
+		if clone != newns.root {
+			clone.DecRef(ctx)
+		}
+	}
+
+	for _, vd := range []*VirtualDentry{root, cwd} {
+		clone, ok := clones[vd.mount]
+		if !ok {
+			continue
+		}
+		old := *vd
+		*vd = VirtualDentry{mount: clone, dentry: old.dentry}
+		vd.IncRef()
+		old.DecRef(ctx)
+	}
+	return newns
+}
+
+// cloneMountTreeLocked copies mnt and all of its submounts into mntns, and
+// returns the copy of mnt, which is not connected. clones maps the original
+// mounts to their copies.
+//
+// Preconditions:
+//   - vfs.mountMu must be locked.
+//   - vfs.mounts.seq must be in a writer critical section.
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) cloneMountTreeLocked(mnt *Mount, mntns *MountNamespace, clones map[*Mount]*Mount) *Mount {
+	clone := vfs.cloneMount(mnt, mnt.root, nil)
+	clone.ns = mntns
+	clones[mnt] = clone
+	switch mnt.propType {
+	case Shared:
+		vfs.addPeer(mnt, clone)
+	case Child:
+		vfs.addSlave(mnt.master, clone)
+	}
+
+	// Children are copied in mount order, so that mounts stacked on the same
+	// mountpoint keep their order.
+	children := make([]*Mount, 0, len(mnt.children))
+	for child := range mnt.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].ID < children[j].ID })
+	for _, child := range children {
+		childClone := vfs.cloneMountTreeLocked(child, mntns, clones)
+		mp := VirtualDentry{mount: clone, dentry: child.getKey().dentry}
+		mp.IncRef()
+		mp.dentry.mu.Lock()
+		vfs.connectLocked(childClone, mp, mntns)
+		mp.dentry.mu.Unlock()
+	}
+	return clone
+}
+
 // NewFilesystem creates a new filesystem object not yet associated with any
 // mounts. It can be installed into the filesystem tree with ConnectMountAt.
 // Note that only the filesystem-specific mount options from opts are used by
@@ -402,12 +496,18 @@ func (vfs *VirtualFilesystem) BindAt(ctx context.Context, creds *auth.Credential
 	clone := vfs.cloneMount(sourceVd.mount, sourceVd.dentry, nil)
 	defer clone.DecRef(ctx)
 	tree := vfs.preparePropagationTree(clone, targetVd)
-	if sourceVd.mount.propType == Shared {
+	switch sourceVd.mount.propType {
+	case Shared:
 		if clone.propType == Private {
 			vfs.addPeer(sourceVd.mount, clone)
 		} else {
 			vfs.mergePeerGroup(sourceVd.mount, clone)
 		}
+	case Child:
+		// A bind mount of a slave is a slave of the same peer group.
+		if clone.propType == Private {
+			vfs.addSlave(sourceVd.mount.master, clone)
+		}
 	}
 	if uint32(1+len(tree))+targetVd.mount.ns.mounts > MountMax {
 		vfs.setPropagation(clone, Private)
@@ -507,12 +607,10 @@ func (vfs *VirtualFilesystem) UmountAt(ctx context.Context, creds *auth.Credenti
 
 	umountTree := []*Mount{vd.mount}
 	parent, mountpoint := vd.mount.parent(), vd.mount.point()
-	if parent != nil && parent.propType == Shared {
-		for peer := parent.sharedList.Front(); peer != nil; peer = peer.sharedEntry.Next() {
-			if peer == parent {
-				continue
-			}
-			umountMnt := vfs.mounts.Lookup(peer, mountpoint)
+	if parent != nil && parent.propType != Private {
+		peers, slaves := vfs.propagationTargets(parent)
+		for _, target := range append(peers, slaves...) {
+			umountMnt := vfs.mounts.Lookup(target, mountpoint)
 			// From https://www.kernel.org/doc/Documentation/filesystems/sharedsubtree.txt:
 			// If any peer has some child mounts, then that mount is not unmounted,
 			// but all other mounts are unmounted.
@@ -604,7 +702,7 @@ func (vfs *VirtualFilesystem) umountRecursiveLocked(mnt *Mount, opts *umountRecu
 		if parent := mnt.parent(); parent != nil && (opts.disconnectHierarchy || !parent.umounted) {
 			vdsToDecRef = append(vdsToDecRef, vfs.disconnectLocked(mnt))
 		}
-		if mnt.propType == Shared {
+		if mnt.propType != Private {
 			vfs.setPropagation(mnt, Private)
 		}
 	}
@@ -922,7 +1020,13 @@ retryFirst:
 // PivotRoot makes location pointed to by newRootPop the root of the current
 // namespace, and moves the current root to the location pointed to by
 // putOldPop.
-func (vfs *VirtualFilesystem) PivotRoot(ctx context.Context, creds *auth.Credentials, newRootPop *PathOperation, putOldPop *PathOperation) error {
+//
+// If allowNamespaceRoot is true, the current root may be the root mount of the
+// namespace, in which case the new root becomes the root mount of the
+// namespace. Linux doesn't allow pivoting away from rootfs, but unlike rootfs,
+// the root mount of a sandbox's mount namespace is the container's root
+// filesystem, which container runtimes expect to be able to pivot from.
+func (vfs *VirtualFilesystem) PivotRoot(ctx context.Context, creds *auth.Credentials, newRootPop *PathOperation, putOldPop *PathOperation, allowNamespaceRoot bool) error {
 	newRootVd, err := vfs.GetDentryAt(ctx, creds, newRootPop, &GetDentryOptions{CheckSearchable: true})
 	if err != nil {
 		return err
@@ -958,7 +1062,7 @@ retry:
 		return linuxerr.EINVAL
 	}
 	// The current root and the new root cannot be on the rootfs mount.
-	if rootVd.mount.parent() == nil || newRootVd.mount.parent() == nil {
+	if (rootVd.mount.parent() == nil && !allowNamespaceRoot) || newRootVd.mount.parent() == nil {
 		return linuxerr.EINVAL
 	}
 	// The current root and the new root must be in the context's mount namespace.
@@ -990,6 +1094,19 @@ retry:
 	defer vfs.mountMu.Unlock()
 	mp := vfs.disconnectLocked(newRootVd.mount)
 	mp.DecRef(ctx)
+	if rootVd.mount.parent() == nil {
+		// The reference held by the namespace on its root mount is
+		// transferred from the current root to the new root.
+		putOldVd.IncRef()
+		putOldVd.dentry.mu.Lock()
+		vfs.connectLocked(rootVd.mount, putOldVd, ns)
+		putOldVd.dentry.mu.Unlock()
+		ns.root = newRootVd.mount
+		vfs.mounts.seq.EndWrite()
+
+		rootVd.mount.DecRef(ctx)
+		return nil
+	}
 	rootMp := vfs.disconnectLocked(rootVd.mount)
 
 	putOldVd.IncRef()
@@ -1014,6 +1131,51 @@ func (vfs *VirtualFilesystem) SetMountReadOnly(mnt *Mount, ro bool) error {
 	return mnt.setReadOnlyLocked(ro)
 }
 
+// FilesystemRemounter is optionally implemented by FilesystemImpls whose
+// options can be changed while they are mounted, as by mount(2) with
+// MS_REMOUNT.
+type FilesystemRemounter interface {
+	// Remount changes the filesystem-specific options in data, which has the
+	// format of GetFilesystemOptions.Data. Options that aren't in data are
+	// unchanged.
+	Remount(ctx context.Context, creds *auth.Credentials, data string) error
+}
+
+// RemountAt changes the options of the mount at pop, as by mount(2) with
+// MS_REMOUNT. opts.GetFilesystemOptions.Data is applied to the mounted
+// filesystem, which must implement FilesystemRemounter unless it's empty, and
+// opts.ReadOnly to the mount. If bind is true, as for MS_REMOUNT|MS_BIND, the
+// filesystem is left unchanged. opts.Flags is ignored since Mount.Flags is
+// immutable.
+func (vfs *VirtualFilesystem) RemountAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation, opts *MountOptions, bind bool) error {
+	vd, err := vfs.GetDentryAt(ctx, creds, pop, &GetDentryOptions{})
+	if err != nil {
+		return err
+	}
+	// See the similar defer in UmountAt for why this is in a closure.
+	defer func() {
+		vd.DecRef(ctx)
+	}()
+	if vd.dentry.isMounted() {
+		if realmnt := vfs.getMountAt(ctx, vd.mount, vd.dentry); realmnt != nil {
+			vd.mount.DecRef(ctx)
+			vd.mount = realmnt
+		}
+	} else if vd.dentry != vd.mount.root {
+		return linuxerr.EINVAL
+	}
+	if !bind {
+		if r, ok := vd.mount.fs.impl.(FilesystemRemounter); ok {
+			if err := r.Remount(ctx, creds, opts.GetFilesystemOptions.Data); err != nil {
+				return err
+			}
+		} else if opts.GetFilesystemOptions.Data != "" {
+			return linuxerr.EINVAL
+		}
+	}
+	return vfs.SetMountReadOnly(vd.mount, opts.ReadOnly)
+}
+
 // CheckBeginWrite increments the counter of in-progress write operations on
 // mnt. If mnt is mounted MS_RDONLY, CheckBeginWrite does nothing and returns
 // EROFS.
@@ -24,9 +24,10 @@ import (
 )
 
 // PropagationType is a propagation flavor as described in
-// https://www.kernel.org/doc/Documentation/filesystems/sharedsubtree.txt. Child
-// and Unbindable are currently unimplemented.
-// TODO(b/249777195): Support MS_SLAVE and MS_UNBINDABLE propagation types.
+// https://www.kernel.org/doc/Documentation/filesystems/sharedsubtree.txt.
+// Unbindable is currently unimplemented, and a mount can't be both shared and
+// a slave.
+// TODO(b/249777195): Support MS_UNBINDABLE propagation type.
 type PropagationType int
 
 const (
@@ -65,6 +66,9 @@ func PropagationTypeFromLinux(propFlag uint64) PropagationType {
 func (vfs *VirtualFilesystem) setPropagation(mnt *Mount, ptype PropagationType) error {
 	switch ptype {
 	case Shared:
+		if mnt.propType == Child {
+			vfs.removeSlave(mnt)
+		}
 		id, err := vfs.allocateGroupID()
 		if err != nil {
 			return err
@@ -73,14 +77,36 @@ func (vfs *VirtualFilesystem) setPropagation(mnt *Mount, ptype PropagationType)
 		mnt.sharedList = &sharedList{}
 		mnt.sharedList.PushBack(mnt)
 	case Private:
-		if mnt.propType == Shared {
-			mnt.sharedList.Remove(mnt)
-			if mnt.sharedList.Empty() {
-				vfs.freeGroupID(mnt.groupID)
+		switch mnt.propType {
+		case Shared:
+			vfs.transferSlaves(mnt)
+			vfs.leavePeerGroup(mnt)
+		case Child:
+			vfs.transferSlaves(mnt)
+			vfs.removeSlave(mnt)
+		}
+	case Child:
+		if mnt.propType != Shared {
+			// Private mounts stay private and slaves stay slaves of the same
+			// peer group.
+			return nil
+		}
+		// The mount becomes a slave of its former peers, if any.
+		var master *Mount
+		for peer := mnt.sharedList.Front(); peer != nil; peer = peer.sharedEntry.Next() {
+			if peer != mnt {
+				master = peer
+				break
 			}
-			mnt.sharedList = nil
-			mnt.groupID = 0
 		}
+		vfs.transferSlaves(mnt)
+		vfs.leavePeerGroup(mnt)
+		if master == nil {
+			mnt.propType = Private
+			return nil
+		}
+		vfs.addSlave(master, mnt)
+		return nil
 	default:
 		panic(fmt.Sprintf("unsupported propagation type: %v", ptype))
 	}
@@ -88,6 +114,94 @@ func (vfs *VirtualFilesystem) setPropagation(mnt *Mount, ptype PropagationType)
 	return nil
 }
 
+// leavePeerGroup removes mnt from its peer group.
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) leavePeerGroup(mnt *Mount) {
+	mnt.sharedList.Remove(mnt)
+	if mnt.sharedList.Empty() {
+		vfs.freeGroupID(mnt.groupID)
+	}
+	mnt.sharedList = nil
+	mnt.groupID = 0
+}
+
+// addSlave makes mnt a slave of master's peer group. mnt must be private.
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) addSlave(master *Mount, mnt *Mount) {
+	if master.slaves == nil {
+		master.slaves = make(map[*Mount]struct{})
+	}
+	master.slaves[mnt] = struct{}{}
+	mnt.master = master
+	mnt.propType = Child
+}
+
+// removeSlave detaches mnt from its master. The caller is responsible for
+// updating mnt.propType.
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) removeSlave(mnt *Mount) {
+	delete(mnt.master.slaves, mnt)
+	mnt.master = nil
+}
+
+// transferSlaves hands the slaves of mnt over to another mount of its peer
+// group or, if mnt has no peers, to its master. Slaves that are left without a
+// master become private. This must be called before mnt stops being shared or
+// a slave.
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) transferSlaves(mnt *Mount) {
+	if len(mnt.slaves) == 0 {
+		return
+	}
+	heir := mnt.master
+	if mnt.propType == Shared {
+		for peer := mnt.sharedList.Front(); peer != nil; peer = peer.sharedEntry.Next() {
+			if peer != mnt {
+				heir = peer
+				break
+			}
+		}
+	}
+	for slave := range mnt.slaves {
+		if heir != nil {
+			vfs.addSlave(heir, slave)
+		} else {
+			slave.master = nil
+			slave.propType = Private
+		}
+	}
+	mnt.slaves = nil
+}
+
+// propagationTargets returns the mounts that receive the mount and umount
+// events of mnt: its peers and, recursively, the slaves of mnt and of its
+// peers.
+//
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) propagationTargets(mnt *Mount) (peers []*Mount, slaves []*Mount) {
+	if mnt.propType == Shared {
+		for peer := mnt.sharedList.Front(); peer != nil; peer = peer.sharedEntry.Next() {
+			if peer != mnt {
+				peers = append(peers, peer)
+			}
+		}
+	}
+	queue := append([]*Mount{mnt}, peers...)
+	for len(queue) > 0 {
+		m := queue[0]
+		queue = queue[1:]
+		for slave := range m.slaves {
+			slaves = append(slaves, slave)
+			queue = append(queue, slave)
+		}
+	}
+	return peers, slaves
+}
+
 // addPeer adds oth to mnt's peer group. Both will have the same groupID
 // and sharedList. vfs.mountMu must be locked.
 //
@@ -114,8 +228,9 @@ func (vfs *VirtualFilesystem) mergePeerGroup(mnt *Mount, oth *Mount) {
 }
 
 // preparePropagationTree returns a mapping of propagated mounts to their future
-// mountpoints. The new mounts are clones of mnt and are added to mnt's peer
-// group if vd.mount and mnt are shared. All the cloned mounts and new
+// mountpoints. The new mounts are clones of mnt. Clones mounted on peers of
+// vd.mount are added to mnt's peer group, and clones mounted on slaves become
+// slaves of mnt, if vd.mount and mnt are shared. All the cloned mounts and new
 // mountpoints in the tree have an extra reference taken.
 //
 // +checklocks:vfs.mountMu
@@ -125,14 +240,12 @@ func (vfs *VirtualFilesystem) preparePropagationTree(mnt *Mount, vd VirtualDentr
 	if vd.mount.propType == Private {
 		return tree
 	}
-	if mnt.propType == Private {
+	if vd.mount.propType == Shared && mnt.propType == Private {
 		vfs.setPropagation(mnt, Shared)
 	}
+	peers, slaves := vfs.propagationTargets(vd.mount)
 	var newPeerGroup []*Mount
-	for peer := vd.mount.sharedList.Front(); peer != nil; peer = peer.sharedEntry.Next() {
-		if peer == vd.mount {
-			continue
-		}
+	for _, peer := range peers {
 		peerVd := VirtualDentry{
 			mount:  peer,
 			dentry: vd.dentry,
@@ -145,6 +258,18 @@ func (vfs *VirtualFilesystem) preparePropagationTree(mnt *Mount, vd VirtualDentr
 	for _, newPeer := range newPeerGroup {
 		vfs.addPeer(mnt, newPeer)
 	}
+	for _, slave := range slaves {
+		slaveVd := VirtualDentry{
+			mount:  slave,
+			dentry: vd.dentry,
+		}
+		slaveVd.IncRef()
+		clone := vfs.cloneMount(mnt, mnt.root, nil)
+		tree[clone] = slaveVd
+		if mnt.propType == Shared {
+			vfs.addSlave(mnt, clone)
+		}
+	}
 	return tree
 }
 
@@ -161,6 +286,10 @@ func (vfs *VirtualFilesystem) commitPropagationTree(ctx context.Context, tree ma
 		// If mnt isn't connected yet, skip connecting during propagation.
 		if mntns := vd.mount.ns; mntns != nil {
 			vfs.connectLocked(mnt, vd, mntns)
+		} else {
+			// The clone is released below, so it must not remain in a peer
+			// group or a slave set.
+			vfs.setPropagation(mnt, Private)
 		}
 		vd.dentry.mu.Unlock()
 		mnt.DecRef(ctx)
@@ -181,8 +310,9 @@ func (vfs *VirtualFilesystem) abortPropagationTree(ctx context.Context, tree map
 }
 
 // SetMountPropagationAt changes the propagation type of the mount pointed to by
-// pop.
-func (vfs *VirtualFilesystem) SetMountPropagationAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation, propType PropagationType) error {
+// pop. If recursive is true, the propagation type of all the mounts below it
+// is changed too.
+func (vfs *VirtualFilesystem) SetMountPropagationAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation, propType PropagationType, recursive bool) error {
 	vd, err := vfs.GetDentryAt(ctx, creds, pop, &GetDentryOptions{})
 	if err != nil {
 		return err
@@ -199,7 +329,11 @@ func (vfs *VirtualFilesystem) SetMountPropagationAt(ctx context.Context, creds *
 	} else if vd.dentry != vd.mount.root {
 		return linuxerr.EINVAL
 	}
-	vfs.SetMountPropagation(vd.mount, propType)
+	if recursive {
+		vfs.SetMountPropagationRecursive(vd.mount, propType)
+	} else {
+		vfs.SetMountPropagation(vd.mount, propType)
+	}
 	return nil
 }
 
@@ -207,13 +341,60 @@ func (vfs *VirtualFilesystem) SetMountPropagationAt(ctx context.Context, creds *
 func (vfs *VirtualFilesystem) SetMountPropagation(mnt *Mount, propType PropagationType) {
 	vfs.mountMu.Lock()
 	defer vfs.mountMu.Unlock()
-	if propType != mnt.propType {
-		switch propType {
-		case Shared, Private:
-			vfs.setPropagation(mnt, propType)
-		default:
-			panic(fmt.Sprintf("unsupported propagation type: %v", propType))
+	vfs.setMountPropagationLocked(mnt, propType)
+}
+
+// SetMountPropagationRecursive changes the propagation type of the mount and
+// of all the mounts below it.
+func (vfs *VirtualFilesystem) SetMountPropagationRecursive(mnt *Mount, propType PropagationType) {
+	vfs.mountMu.Lock()
+	defer vfs.mountMu.Unlock()
+	mounts := []*Mount{mnt}
+	for len(mounts) > 0 {
+		m := mounts[len(mounts)-1]
+		mounts = mounts[:len(mounts)-1]
+		vfs.setMountPropagationLocked(m, propType)
+		for child := range m.children {
+			mounts = append(mounts, child)
+		}
+	}
+}
+
+// +checklocks:vfs.mountMu
+func (vfs *VirtualFilesystem) setMountPropagationLocked(mnt *Mount, propType PropagationType) {
+	if propType == mnt.propType {
+		return
+	}
+	switch propType {
+	case Shared, Private, Child:
+		vfs.setPropagation(mnt, propType)
+	default:
+		panic(fmt.Sprintf("unsupported propagation type: %v", propType))
+	}
+}
+
+// JoinPropagationGroup makes mnt a peer (if propType is Shared) or a slave (if
+// propType is Child) of the peer group of master, so that mount events
+// propagate between them. master is made shared if it isn't already. mnt must
+// be private.
+func (vfs *VirtualFilesystem) JoinPropagationGroup(master, mnt *Mount, propType PropagationType) error {
+	vfs.mountMu.Lock()
+	defer vfs.mountMu.Unlock()
+	if mnt.propType != Private {
+		return fmt.Errorf("mount is not private")
+	}
+	if master.propType != Shared {
+		if err := vfs.setPropagation(master, Shared); err != nil {
+			return err
 		}
 	}
-	mnt.propType = propType
+	switch propType {
+	case Shared:
+		vfs.addPeer(master, mnt)
+	case Child:
+		vfs.addSlave(master, mnt)
+	default:
+		return fmt.Errorf("unsupported propagation type: %v", propType)
+	}
+	return nil
 }
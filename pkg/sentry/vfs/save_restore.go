@@ -87,6 +87,11 @@ type CompleteRestoreOptions struct {
 	// implementations backed by remote filesystems should validate that file
 	// mtimes have not changed between checkpoint and restore.
 	ValidateFileModificationTimestamps bool
+
+	// If FileRestored is not nil, filesystem implementations backed by
+	// remote filesystems call it each time they reattach a file to its
+	// backing file, to report restore progress.
+	FileRestored func()
 }
 
 // saveMounts is called by stateify.
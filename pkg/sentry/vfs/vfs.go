@@ -145,6 +145,10 @@ type VirtualFilesystem struct {
 	// mountPromises contains all unresolved mount promises.
 	mountPromisesMu sync.RWMutex `state:"nosave"`
 	mountPromises   map[VirtualDentry]*waiter.Queue
+
+	// lsm is the Linux Security Module presented to applications. lsm is
+	// immutable after filesystems are mounted.
+	lsm LSM
 }
 
 // Init initializes a new VirtualFilesystem with no mounts or FilesystemTypes.
@@ -314,7 +318,10 @@ func (vfs *VirtualFilesystem) LinkAt(ctx context.Context, creds *auth.Credential
 	rp := vfs.getResolvingPath(creds, newpop)
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.LinkAt(ctx, rp, oldVD)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.LinkAt(ctx, rp, oldVD)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			oldVD.DecRef(ctx)
@@ -354,7 +361,10 @@ func (vfs *VirtualFilesystem) MkdirAt(ctx context.Context, creds *auth.Credentia
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.MkdirAt(ctx, rp, *opts)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.MkdirAt(ctx, rp, *opts)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			return nil
@@ -390,7 +400,10 @@ func (vfs *VirtualFilesystem) MknodAt(ctx context.Context, creds *auth.Credentia
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.MknodAt(ctx, rp, *opts)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.MknodAt(ctx, rp, *opts)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			return nil
@@ -455,9 +468,19 @@ func (vfs *VirtualFilesystem) OpenAt(ctx context.Context, creds *auth.Credential
 	if opts.Flags&linux.O_DIRECTORY != 0 {
 		rp.mustBeDir = true
 	}
+	// Opens that may create or truncate files are writes for the purpose of
+	// Filesystem.Freeze.
+	writes := opts.Flags&(linux.O_CREAT|linux.O_TRUNC|linux.O_TMPFILE) != 0
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		fd, err := rp.mount.fs.impl.OpenAt(ctx, rp, *opts)
+		fs := rp.mount.fs
+		if writes {
+			fs.StartWrite()
+		}
+		fd, err := fs.impl.OpenAt(ctx, rp, *opts)
+		if writes {
+			fs.EndWrite()
+		}
 		if err == nil {
 			rp.Release(ctx)
 
@@ -552,7 +575,10 @@ func (vfs *VirtualFilesystem) RenameAt(ctx context.Context, creds *auth.Credenti
 	}
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.RenameAt(ctx, rp, oldParentVD, oldName, renameOpts)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.RenameAt(ctx, rp, oldParentVD, oldName, renameOpts)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			oldParentVD.DecRef(ctx)
@@ -589,7 +615,10 @@ func (vfs *VirtualFilesystem) RmdirAt(ctx context.Context, creds *auth.Credentia
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.RmdirAt(ctx, rp)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.RmdirAt(ctx, rp)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			return nil
@@ -611,7 +640,10 @@ func (vfs *VirtualFilesystem) SetStatAt(ctx context.Context, creds *auth.Credent
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.SetStatAt(ctx, rp, *opts)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.SetStatAt(ctx, rp, *opts)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			return nil
@@ -676,7 +708,10 @@ func (vfs *VirtualFilesystem) SymlinkAt(ctx context.Context, creds *auth.Credent
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.SymlinkAt(ctx, rp, target)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.SymlinkAt(ctx, rp, target)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			return nil
@@ -711,7 +746,10 @@ func (vfs *VirtualFilesystem) UnlinkAt(ctx context.Context, creds *auth.Credenti
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.UnlinkAt(ctx, rp)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.UnlinkAt(ctx, rp)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			return nil
@@ -759,7 +797,7 @@ func (vfs *VirtualFilesystem) ListXattrAt(ctx context.Context, creds *auth.Crede
 		names, err := rp.mount.fs.impl.ListXattrAt(ctx, rp, size)
 		if err == nil {
 			rp.Release(ctx)
-			return names, nil
+			return vfs.lsmListXattr(names), nil
 		}
 		if linuxerr.Equals(linuxerr.EOPNOTSUPP, err) {
 			// Linux doesn't actually return EOPNOTSUPP in this case; instead,
@@ -767,7 +805,7 @@ func (vfs *VirtualFilesystem) ListXattrAt(ctx context.Context, creds *auth.Crede
 			// subsystem to return security extended attributes, which by
 			// default don't exist.
 			rp.Release(ctx)
-			return nil, nil
+			return vfs.lsmListXattr(nil), nil
 		}
 		if !rp.handleError(ctx, err) {
 			rp.Release(ctx)
@@ -789,7 +827,7 @@ func (vfs *VirtualFilesystem) GetXattrAt(ctx context.Context, creds *auth.Creden
 		}
 		if !rp.handleError(ctx, err) {
 			rp.Release(ctx)
-			return "", err
+			return vfs.lsmGetXattr(opts.Name, err)
 		}
 	}
 }
@@ -797,17 +835,23 @@ func (vfs *VirtualFilesystem) GetXattrAt(ctx context.Context, creds *auth.Creden
 // SetXattrAt changes the value associated with the given extended attribute
 // for the file at the given path.
 func (vfs *VirtualFilesystem) SetXattrAt(ctx context.Context, creds *auth.Credentials, pop *PathOperation, opts *SetXattrOptions) error {
+	if err := vfs.lsmCheckSetXattr(opts); err != nil {
+		return err
+	}
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.SetXattrAt(ctx, rp, *opts)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.SetXattrAt(ctx, rp, *opts)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			return nil
 		}
 		if !rp.handleError(ctx, err) {
 			rp.Release(ctx)
-			return err
+			return vfs.lsmSetXattr(opts, err)
 		}
 	}
 }
@@ -817,7 +861,10 @@ func (vfs *VirtualFilesystem) RemoveXattrAt(ctx context.Context, creds *auth.Cre
 	rp := vfs.getResolvingPath(creds, pop)
 	for {
 		vfs.maybeBlockOnMountPromise(ctx, rp)
-		err := rp.mount.fs.impl.RemoveXattrAt(ctx, rp, name)
+		fs := rp.mount.fs
+		fs.StartWrite()
+		err := fs.impl.RemoveXattrAt(ctx, rp, name)
+		fs.EndWrite()
 		if err == nil {
 			rp.Release(ctx)
 			return nil
@@ -841,6 +888,33 @@ func (vfs *VirtualFilesystem) SyncAllFilesystems(ctx context.Context) error {
 	return retErr
 }
 
+// FilesystemImplReconnectExtension is an optional extension to
+// FilesystemImpl for filesystems served by a host process that may be
+// restarted, e.g. a gofer.
+type FilesystemImplReconnectExtension interface {
+	// Reconnect switches the filesystem to a new connection to its restarted
+	// server. If the filesystem is owned by owner and fds has an entry for its
+	// unique ID, Reconnect takes ownership of the connection FD and removes it
+	// from fds. Otherwise, it does nothing.
+	Reconnect(ctx context.Context, owner string, fds map[string]int) error
+}
+
+// ReconnectFilesystems reconnects the filesystems owned by owner to their
+// restarted server, taking the connection FDs from fds. The caller owns the
+// FDs left in fds.
+func (vfs *VirtualFilesystem) ReconnectFilesystems(ctx context.Context, owner string, fds map[string]int) error {
+	var retErr error
+	for fs := range vfs.getFilesystems() {
+		if ext, ok := fs.impl.(FilesystemImplReconnectExtension); ok {
+			if err := ext.Reconnect(ctx, owner, fds); err != nil && retErr == nil {
+				retErr = err
+			}
+		}
+		fs.DecRef(ctx)
+	}
+	return retErr
+}
+
 func (vfs *VirtualFilesystem) getFilesystems() map[*Filesystem]struct{} {
 	fss := make(map[*Filesystem]struct{})
 	vfs.filesystemsMu.Lock()
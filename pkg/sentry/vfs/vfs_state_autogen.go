@@ -1176,6 +1176,8 @@ func (mnt *Mount) StateFields() []string {
 		"sharedList",
 		"sharedEntry",
 		"groupID",
+		"master",
+		"slaves",
 		"umounted",
 		"writers",
 	}
@@ -1201,8 +1203,10 @@ func (mnt *Mount) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(10, &mnt.sharedList)
 	stateSinkObject.Save(11, &mnt.sharedEntry)
 	stateSinkObject.Save(12, &mnt.groupID)
-	stateSinkObject.Save(13, &mnt.umounted)
-	stateSinkObject.Save(14, &mnt.writers)
+	stateSinkObject.Save(13, &mnt.master)
+	stateSinkObject.Save(14, &mnt.slaves)
+	stateSinkObject.Save(15, &mnt.umounted)
+	stateSinkObject.Save(16, &mnt.writers)
 }
 
 // +checklocksignore
@@ -1219,8 +1223,10 @@ func (mnt *Mount) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(10, &mnt.sharedList)
 	stateSourceObject.Load(11, &mnt.sharedEntry)
 	stateSourceObject.Load(12, &mnt.groupID)
-	stateSourceObject.Load(13, &mnt.umounted)
-	stateSourceObject.Load(14, &mnt.writers)
+	stateSourceObject.Load(13, &mnt.master)
+	stateSourceObject.Load(14, &mnt.slaves)
+	stateSourceObject.Load(15, &mnt.umounted)
+	stateSourceObject.Load(16, &mnt.writers)
 	stateSourceObject.LoadValue(5, new(VirtualDentry), func(y any) { mnt.loadKey(y.(VirtualDentry)) })
 	stateSourceObject.AfterLoad(mnt.afterLoad)
 }
@@ -1983,6 +1989,7 @@ func (vfs *VirtualFilesystem) StateFields() []string {
 		"filesystems",
 		"groupIDBitmap",
 		"mountPromises",
+		"lsm",
 	}
 }
 
@@ -2005,6 +2012,7 @@ func (vfs *VirtualFilesystem) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(9, &vfs.filesystems)
 	stateSinkObject.Save(10, &vfs.groupIDBitmap)
 	stateSinkObject.Save(11, &vfs.mountPromises)
+	stateSinkObject.Save(12, &vfs.lsm)
 }
 
 func (vfs *VirtualFilesystem) afterLoad() {}
@@ -2022,6 +2030,7 @@ func (vfs *VirtualFilesystem) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(9, &vfs.filesystems)
 	stateSourceObject.Load(10, &vfs.groupIDBitmap)
 	stateSourceObject.Load(11, &vfs.mountPromises)
+	stateSourceObject.Load(12, &vfs.lsm)
 	stateSourceObject.LoadValue(0, new([]*Mount), func(y any) { vfs.loadMounts(y.([]*Mount)) })
 }
 
@@ -47,4 +47,11 @@ type options struct {
 
 	// RunscConfig is a key/value map of all runsc flags.
 	RunscConfig map[string]string `toml:"runsc_config" json:"runscConfig"`
+
+	// StreamingAddress is the TCP address, e.g. "127.0.0.1:0", of the server
+	// for Kubernetes exec, attach and port-forward streams. The URLs of
+	// streaming sessions are requested over HTTP on a UDS whose path is the
+	// shim socket path followed by ".streaming", see streaming.APIHandler.
+	// Streaming is disabled if empty.
+	StreamingAddress string `toml:"streaming_address" json:"streamingAddress"`
 }
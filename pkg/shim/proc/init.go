@@ -76,6 +76,11 @@ type Init struct {
 	Sandbox  bool
 	UserLog  string
 	Monitor  ProcessMonitor
+
+	// stdoutAttach and stderrAttach copy the output of the process to attach
+	// sessions.
+	stdoutAttach attachWriter
+	stderrAttach attachWriter
 }
 
 // NewRunsc returns a new runsc instance for a process.
@@ -161,7 +166,7 @@ func (p *Init) Create(ctx context.Context, r *CreateConfig) (err error) {
 		}
 		p.console = console
 	} else if !hasNoIO(r) {
-		if err := copyPipes(ctx, p.io, r.Stdin, r.Stdout, r.Stderr, &p.wg); err != nil {
+		if err := copyPipes(ctx, p.io, r.Stdin, r.Stdout, r.Stderr, &p.stdoutAttach, &p.stderrAttach, &p.wg); err != nil {
 			return fmt.Errorf("failed to start io pipe copy: %w", err)
 		}
 	}
@@ -178,6 +183,42 @@ func (p *Init) Wait() {
 	<-p.waitBlock
 }
 
+// Attach copies the output of the process to stdout and stderr, and stdin to
+// the input of the process, until the process exits or ctx is canceled. Any of
+// the streams may be nil. Only processes without a terminal can be attached
+// to, and stdin is ignored unless the process was created with stdin.
+func (p *Init) Attach(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+	if p.console != nil {
+		return fmt.Errorf("attaching to a process with a terminal is not supported")
+	}
+	if stdout != nil {
+		defer p.stdoutAttach.attach(stdout)()
+	}
+	if stderr != nil {
+		defer p.stderrAttach.attach(stderr)()
+	}
+	if stdin != nil && p.stdin != nil {
+		go func() {
+			if _, err := io.Copy(p.io.Stdin(), stdin); err != nil {
+				log.G(ctx).WithError(err).Debug("Failed to copy attached stdin")
+			}
+		}()
+		// Closing the stream stops the copy when the session ends, so that
+		// it doesn't hold the stdin of the process after the client is
+		// gone. The stdin of the process is left open for other sessions.
+		if c, ok := stdin.(io.Closer); ok {
+			defer c.Close()
+		}
+	}
+	select {
+	case <-p.waitBlock:
+		// Flush the remaining output.
+		p.wg.Wait()
+	case <-ctx.Done():
+	}
+	return nil
+}
+
 // ID returns the ID of the process.
 func (p *Init) ID() string {
 	return p.id
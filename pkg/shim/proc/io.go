@@ -38,7 +38,10 @@ var bufPool = sync.Pool{
 	},
 }
 
-func copyPipes(ctx context.Context, rio runc.IO, stdin, stdout, stderr string, wg *sync.WaitGroup) error {
+// copyPipes copies the output of rio to the stdout and stderr files, and the
+// stdin file to the input of rio. Output is also copied to stdoutAttach and
+// stderrAttach, if not nil.
+func copyPipes(ctx context.Context, rio runc.IO, stdin, stdout, stderr string, stdoutAttach, stderrAttach *attachWriter, wg *sync.WaitGroup) error {
 	var sameFile *countingWriteCloser
 	for _, i := range []struct {
 		name string
@@ -51,7 +54,7 @@ func copyPipes(ctx context.Context, rio runc.IO, stdin, stdout, stderr string, w
 				go func() {
 					p := bufPool.Get().(*[]byte)
 					defer bufPool.Put(p)
-					if _, err := io.CopyBuffer(wc, rio.Stdout(), *p); err != nil {
+					if _, err := io.CopyBuffer(stdoutAttach.tee(wc), rio.Stdout(), *p); err != nil {
 						log.G(ctx).Warn("error copying stdout")
 					}
 					wg.Done()
@@ -68,7 +71,7 @@ func copyPipes(ctx context.Context, rio runc.IO, stdin, stdout, stderr string, w
 				go func() {
 					p := bufPool.Get().(*[]byte)
 					defer bufPool.Put(p)
-					if _, err := io.CopyBuffer(wc, rio.Stderr(), *p); err != nil {
+					if _, err := io.CopyBuffer(stderrAttach.tee(wc), rio.Stderr(), *p); err != nil {
 						log.G(ctx).Warn("error copying stderr")
 					}
 					wg.Done()
@@ -144,6 +147,50 @@ func (c *countingWriteCloser) Close() error {
 	return c.WriteCloser.Close()
 }
 
+// attachWriter copies the output of a process to the writers of attach
+// sessions.
+type attachWriter struct {
+	mu      sync.Mutex
+	writers map[*io.Writer]struct{}
+}
+
+// attach starts copying output to w, until the returned function is called.
+func (a *attachWriter) attach(w io.Writer) func() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.writers == nil {
+		a.writers = make(map[*io.Writer]struct{})
+	}
+	key := &w
+	a.writers[key] = struct{}{}
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		delete(a.writers, key)
+	}
+}
+
+// Write implements io.Writer.Write. It never fails, writers that return an
+// error are detached.
+func (a *attachWriter) Write(p []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key := range a.writers {
+		if _, err := (*key).Write(p); err != nil {
+			delete(a.writers, key)
+		}
+	}
+	return len(p), nil
+}
+
+// tee returns a writer that writes to w and a, or w if a is nil.
+func (a *attachWriter) tee(w io.Writer) io.Writer {
+	if a == nil {
+		return w
+	}
+	return io.MultiWriter(w, a)
+}
+
 // isFifo checks if a file is a fifo.
 //
 // If the file does not exist then it returns false.
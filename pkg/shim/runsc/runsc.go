@@ -271,21 +271,40 @@ func (o *ExecOpts) args() (out []string, err error) {
 // Exec executes an additional process inside the container based on a full OCI
 // Process specification.
 func (r *Runsc) Exec(context context.Context, id string, spec specs.Process, opts *ExecOpts) error {
+	cmd, status, err := r.exec(context, id, spec, opts)
+	if err == nil && status != 0 {
+		err = fmt.Errorf("%s did not terminate sucessfully", cmd.Args[0])
+	}
+	return err
+}
+
+// ExecStatus is like Exec, but returns the exit status of the process instead
+// of failing if it's not zero. The process must not be detached, and opts.IO
+// must set the output of the command.
+func (r *Runsc) ExecStatus(context context.Context, id string, spec specs.Process, opts *ExecOpts) (int, error) {
+	if opts == nil || opts.IO == nil || opts.Detach {
+		return -1, fmt.Errorf("exec status requires IO and a process that isn't detached")
+	}
+	_, status, err := r.exec(context, id, spec, opts)
+	return status, err
+}
+
+func (r *Runsc) exec(context context.Context, id string, spec specs.Process, opts *ExecOpts) (*exec.Cmd, int, error) {
 	f, err := ioutil.TempFile(os.Getenv("XDG_RUNTIME_DIR"), "runsc-process")
 	if err != nil {
-		return err
+		return nil, -1, err
 	}
 	defer os.Remove(f.Name())
 	err = json.NewEncoder(f).Encode(spec)
 	f.Close()
 	if err != nil {
-		return err
+		return nil, -1, err
 	}
 	args := []string{"exec", "--process", f.Name()}
 	if opts != nil {
 		oargs, err := opts.args()
 		if err != nil {
-			return err
+			return nil, -1, err
 		}
 		args = append(args, oargs...)
 	}
@@ -296,26 +315,29 @@ func (r *Runsc) Exec(context context.Context, id string, spec specs.Process, opt
 	if cmd.Stdout == nil && cmd.Stderr == nil {
 		out, _, err := cmdOutput(cmd, true)
 		if err != nil {
-			return fmt.Errorf("%w: %s", err, out)
+			return cmd, -1, fmt.Errorf("%w: %s", err, out)
 		}
-		return nil
+		return cmd, 0, nil
 	}
 	ec, err := Monitor.Start(cmd)
 	if err != nil {
-		return err
+		return cmd, -1, err
 	}
 	if opts != nil && opts.IO != nil {
 		if c, ok := opts.IO.(runc.StartCloser); ok {
 			if err := c.CloseAfterStart(); err != nil {
-				return err
+				return cmd, -1, err
 			}
 		}
 	}
 	status, err := Monitor.Wait(cmd, ec)
-	if err == nil && status != 0 {
-		err = fmt.Errorf("%s did not terminate sucessfully", cmd.Args[0])
-	}
-	return err
+	return cmd, status, err
+}
+
+// PortForward forwards a connection to port inside the sandbox to the UDS at
+// streamPath. The command returns once forwarding has started.
+func (r *Runsc) PortForward(context context.Context, id string, port uint16, streamPath string) error {
+	return r.runOrError(r.command(context, "port-forward", "--stream", streamPath, id, strconv.Itoa(int(port))))
 }
 
 // Run runs the create, start, delete lifecycle of the container and returns
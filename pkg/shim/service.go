@@ -185,6 +185,10 @@ type service struct {
 
 	// shimAddress is the location of the UDS used to communicate to containerd.
 	shimAddress string
+
+	// streamingSocket is the location of the UDS serving streaming requests,
+	// if streaming is enabled.
+	streamingSocket string
 }
 
 var _ shim.Shim = (*service)(nil)
@@ -522,9 +526,14 @@ func (s *service) create(ctx context.Context, r *taskAPI.CreateTaskRequest) (*ta
 		}
 	}
 
+	s.task = process
+	if err := s.startStreaming(ctx); err != nil {
+		s.task = nil
+		return nil, fmt.Errorf("starting streaming server: %w", err)
+	}
+
 	// Success
 	cu.Release()
-	s.task = process
 	return &taskAPI.CreateTaskResponse{
 		Pid: uint32(process.Pid()),
 	}, nil
@@ -840,6 +849,9 @@ func (s *service) shutdown(ctx context.Context, r *taskAPI.ShutdownRequest) (*ty
 	if s.shimAddress != "" {
 		_ = shim.RemoveSocket(s.shimAddress)
 	}
+	if s.streamingSocket != "" {
+		_ = os.Remove(s.streamingSocket)
+	}
 	os.Exit(0)
 	panic("Should not get here")
 }
@@ -0,0 +1,352 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shim
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containerd/console"
+	"github.com/containerd/containerd/log"
+	runc "github.com/containerd/go-runc"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/shim/proc"
+	"github.com/talismancer/gvisor-ligolo/pkg/shim/runsc"
+	"github.com/talismancer/gvisor-ligolo/pkg/shim/streaming"
+	"github.com/talismancer/gvisor-ligolo/pkg/shim/utils"
+)
+
+const (
+	// streamingSocketSuffix is appended to the shim socket path to form the
+	// path of the UDS serving streaming.APIHandler.
+	streamingSocketSuffix = ".streaming"
+
+	// consoleDrainTimeout is the time to wait for the remaining terminal
+	// output after an exec'd process exits.
+	consoleDrainTimeout = time.Second
+)
+
+// startStreaming starts the streaming server if it's enabled.
+func (s *service) startStreaming(ctx context.Context) error {
+	if s.opts.StreamingAddress == "" {
+		return nil
+	}
+	if s.shimAddress == "" {
+		return fmt.Errorf("streaming requires the shim address")
+	}
+	l, err := net.Listen("tcp", s.opts.StreamingAddress)
+	if err != nil {
+		return fmt.Errorf("listening on %q: %w", s.opts.StreamingAddress, err)
+	}
+	socketPath := strings.TrimPrefix(s.shimAddress, "unix://") + streamingSocketSuffix
+	_ = os.Remove(socketPath)
+	api, err := net.Listen("unix", socketPath)
+	if err != nil {
+		l.Close()
+		return fmt.Errorf("listening on %q: %w", socketPath, err)
+	}
+	s.streamingSocket = socketPath
+
+	srv := streaming.NewServer(streaming.Config{
+		BaseURL:           &url.URL{Scheme: "http", Host: l.Addr().String()},
+		StreamIdleTimeout: streaming.DefaultStreamIdleTimeout,
+	}, &streamingRuntime{s: s})
+	go func() {
+		if err := http.Serve(l, srv); err != nil {
+			log.G(ctx).WithError(err).Warning("Streaming server stopped")
+		}
+	}()
+	go func() {
+		if err := http.Serve(api, srv.APIHandler()); err != nil {
+			log.G(ctx).WithError(err).Warning("Streaming API server stopped")
+		}
+	}()
+	log.G(ctx).Infof("Streaming server listening on %s, API on %s", l.Addr(), socketPath)
+	return nil
+}
+
+// streamingRuntime implements streaming.Runtime for the container of the
+// shim.
+type streamingRuntime struct {
+	s *service
+}
+
+var _ streaming.Runtime = (*streamingRuntime)(nil)
+
+func (r *streamingRuntime) task() (*proc.Init, error) {
+	p, err := r.s.getProcess("")
+	if err != nil {
+		return nil, err
+	}
+	return p.(*proc.Init), nil
+}
+
+// Exec implements streaming.Runtime.Exec.
+func (r *streamingRuntime) Exec(ctx context.Context, cmd []string, streams streaming.Streams) (int, error) {
+	task, err := r.task()
+	if err != nil {
+		return -1, err
+	}
+	spec, err := utils.ReadSpec(r.s.bundle)
+	if err != nil {
+		return -1, fmt.Errorf("read oci spec: %w", err)
+	}
+	if spec.Process == nil {
+		return -1, fmt.Errorf("oci spec has no process")
+	}
+	process := *spec.Process
+	process.Args = cmd
+	process.Terminal = streams.TTY
+	process.ConsoleSize = nil
+
+	if streams.TTY {
+		return r.execTTY(ctx, task, process, streams)
+	}
+
+	sio := &streamingIO{stdout: io.Discard, stderr: io.Discard}
+	if streams.Stdout != nil {
+		sio.stdout = streams.Stdout
+	}
+	if streams.Stderr != nil {
+		sio.stderr = streams.Stderr
+	}
+	if streams.Stdin != nil {
+		// Use a pipe, so that waiting for the command doesn't wait for the
+		// client to close stdin.
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			return -1, err
+		}
+		defer pr.Close()
+		go func() {
+			io.Copy(pw, streams.Stdin)
+			pw.Close()
+		}()
+		sio.stdin = pr
+	}
+	return task.Runtime().ExecStatus(ctx, r.s.id, process, &runsc.ExecOpts{IO: sio})
+}
+
+func (r *streamingRuntime) execTTY(ctx context.Context, task *proc.Init, process specs.Process, streams streaming.Streams) (int, error) {
+	platform, ok := r.s.platform.(*linuxPlatform)
+	if !ok {
+		return -1, fmt.Errorf("terminals are not supported")
+	}
+	socket, err := runc.NewTempConsoleSocket()
+	if err != nil {
+		return -1, fmt.Errorf("failed to create OCI runtime console socket: %w", err)
+	}
+	defer socket.Close()
+
+	type result struct {
+		status int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// The output of the process goes to the terminal, not to the
+		// output of runsc.
+		opts := &runsc.ExecOpts{
+			IO:            &streamingIO{stdout: io.Discard, stderr: io.Discard},
+			ConsoleSocket: socket,
+		}
+		status, err := task.Runtime().ExecStatus(ctx, r.s.id, process, opts)
+		done <- result{status, err}
+	}()
+	type master struct {
+		console console.Console
+		err     error
+	}
+	masterCh := make(chan master, 1)
+	go func() {
+		c, err := socket.ReceiveMaster()
+		masterCh <- master{c, err}
+	}()
+
+	var m master
+	select {
+	case res := <-done:
+		// The process failed to start.
+		return res.status, res.err
+	case m = <-masterCh:
+	}
+	if m.err != nil {
+		res := <-done
+		if res.err == nil {
+			res.err = fmt.Errorf("failed to retrieve console master: %w", m.err)
+		}
+		return -1, res.err
+	}
+	con, err := platform.epoller.Add(m.console)
+	if err != nil {
+		m.console.Close()
+		<-done
+		return -1, err
+	}
+	defer func() {
+		platform.ShutdownConsole(ctx, con)
+		con.Close()
+	}()
+
+	if streams.Stdin != nil {
+		go io.Copy(con, streams.Stdin)
+	}
+	if streams.Resize != nil {
+		go func() {
+			for size := range streams.Resize {
+				if err := con.Resize(console.WinSize{Height: size.Height, Width: size.Width}); err != nil {
+					log.G(ctx).WithError(err).Debug("Failed to resize terminal")
+				}
+			}
+		}()
+	}
+	stdout := io.Discard
+	if streams.Stdout != nil {
+		stdout = streams.Stdout
+	}
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(stdout, con)
+		close(copied)
+	}()
+
+	res := <-done
+	select {
+	case <-copied:
+	case <-time.After(consoleDrainTimeout):
+	}
+	return res.status, res.err
+}
+
+// Attach implements streaming.Runtime.Attach.
+func (r *streamingRuntime) Attach(ctx context.Context, streams streaming.Streams) error {
+	task, err := r.task()
+	if err != nil {
+		return err
+	}
+	return task.Attach(ctx, streams.Stdin, streams.Stdout, streams.Stderr)
+}
+
+// PortForward implements streaming.Runtime.PortForward.
+func (r *streamingRuntime) PortForward(ctx context.Context, port uint16, stream io.ReadWriteCloser) error {
+	task, err := r.task()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "runsc-portforward")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stream.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	// runsc connects to the UDS and hands the connection over to the sandbox,
+	// which forwards it to the port.
+	if err := task.Runtime().PortForward(ctx, r.s.id, port, path); err != nil {
+		return err
+	}
+	// Accept doesn't take a context, so close the listener to stop waiting
+	// for runsc to connect when ctx is done.
+	accepted := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-accepted:
+		}
+	}()
+	conn, err := l.Accept()
+	close(accepted)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	defer conn.Close()
+
+	go func() {
+		io.Copy(conn, stream)
+		if uc, ok := conn.(*net.UnixConn); ok {
+			uc.CloseWrite()
+		}
+	}()
+	copied := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(stream, conn)
+		stream.Close()
+		copied <- err
+	}()
+	select {
+	case err := <-copied:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// streamingIO implements runc.IO for commands whose standard streams are
+// provided by the caller.
+type streamingIO struct {
+	stdin  *os.File
+	stdout io.Writer
+	stderr io.Writer
+}
+
+var _ runc.IO = (*streamingIO)(nil)
+
+// Close implements runc.IO.Close.
+func (*streamingIO) Close() error {
+	return nil
+}
+
+// Stdin implements runc.IO.Stdin.
+func (*streamingIO) Stdin() io.WriteCloser {
+	return nil
+}
+
+// Stdout implements runc.IO.Stdout.
+func (*streamingIO) Stdout() io.ReadCloser {
+	return nil
+}
+
+// Stderr implements runc.IO.Stderr.
+func (*streamingIO) Stderr() io.ReadCloser {
+	return nil
+}
+
+// Set implements runc.IO.Set.
+func (i *streamingIO) Set(cmd *exec.Cmd) {
+	if i.stdin != nil {
+		cmd.Stdin = i.stdin
+	}
+	cmd.Stdout = i.stdout
+	cmd.Stderr = i.stderr
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// tokenTTL is the time after which an unused token expires.
+	tokenTTL = time.Minute
+
+	// maxTokens is the maximum number of outstanding tokens.
+	maxTokens = 1000
+
+	// tokenLen is the number of random bytes in a token.
+	tokenLen = 8
+)
+
+// requestCache holds pending requests, indexed by a single-use token.
+type requestCache struct {
+	mu       sync.Mutex
+	requests map[string]cachedRequest
+}
+
+type cachedRequest struct {
+	req     any
+	expires time.Time
+}
+
+func newRequestCache() *requestCache {
+	return &requestCache{requests: make(map[string]cachedRequest)}
+}
+
+// insert adds req to the cache and returns its token.
+func (c *requestCache) insert(req any) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gcLocked()
+	if len(c.requests) >= maxTokens {
+		return "", fmt.Errorf("too many pending streaming requests")
+	}
+	for {
+		b := make([]byte, tokenLen)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("generating token: %w", err)
+		}
+		token := base64.RawURLEncoding.EncodeToString(b)
+		if _, ok := c.requests[token]; ok {
+			continue
+		}
+		c.requests[token] = cachedRequest{req: req, expires: time.Now().Add(tokenTTL)}
+		return token, nil
+	}
+}
+
+// consume removes and returns the request associated with token, if it
+// hasn't expired.
+func (c *requestCache) consume(token string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cr, ok := c.requests[token]
+	if !ok {
+		return nil, false
+	}
+	delete(c.requests, token)
+	if time.Now().After(cr.expires) {
+		return nil, false
+	}
+	return cr.req, true
+}
+
+// gcLocked removes expired requests.
+//
+// Preconditions: c.mu is locked.
+func (c *requestCache) gcLocked() {
+	now := time.Now()
+	for token, cr := range c.requests {
+		if now.After(cr.expires) {
+			delete(c.requests, token)
+		}
+	}
+}
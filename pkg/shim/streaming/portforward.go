@@ -0,0 +1,259 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containerd/containerd/log"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+const (
+	// portForwardProtocol is the SPDY and WebSocket port forward protocol.
+	portForwardProtocol = "portforward.k8s.io"
+
+	// base64PortForwardProtocol is the WebSocket port forward protocol using
+	// base64 text messages.
+	base64PortForwardProtocol = "base64.portforward.k8s.io"
+
+	// Headers of SPDY port forward streams.
+	portHeader      = "port"
+	requestIDHeader = "requestID"
+
+	// Stream types of SPDY port forward streams.
+	streamTypeData = "data"
+)
+
+// servePortForward serves a port forward session.
+func (s *Server) servePortForward(ctx context.Context, w http.ResponseWriter, r *http.Request, req *PortForwardRequest) {
+	switch {
+	case isWebSocketRequest(r):
+		s.servePortForwardWebSocket(ctx, w, r, req)
+	case httpstream.IsUpgradeRequest(r):
+		s.servePortForwardSPDY(ctx, w, r, req)
+	default:
+		http.Error(w, "connection upgrade is required", http.StatusBadRequest)
+	}
+}
+
+// portAllowed returns true if port may be forwarded for req.
+func portAllowed(req *PortForwardRequest, port uint16) bool {
+	if len(req.Ports) == 0 {
+		return true
+	}
+	for _, p := range req.Ports {
+		if p == int32(port) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardPort forwards stream to port and reports errors on errStream.
+func (s *Server) forwardPort(ctx context.Context, port uint16, stream io.ReadWriteCloser, errStream io.Writer) {
+	log.G(ctx).Debugf("Forwarding port %d", port)
+	if err := s.rt.PortForward(ctx, port, stream); err != nil {
+		msg := fmt.Sprintf("error forwarding port %d to sandbox: %v", port, err)
+		log.G(ctx).Debug(msg)
+		io.WriteString(errStream, msg)
+	}
+}
+
+// spdyStreamPair is the data and error stream of a single forwarded
+// connection.
+type spdyStreamPair struct {
+	data  *spdyStream
+	error *spdyStream
+	timer *time.Timer
+}
+
+func (s *Server) servePortForwardSPDY(ctx context.Context, w http.ResponseWriter, r *http.Request, req *PortForwardRequest) {
+	conn, _, err := upgradeSPDY(w, r, []string{portForwardProtocol}, s.conf.StreamIdleTimeout)
+	if err != nil {
+		log.G(ctx).WithError(err).Debug("Failed to upgrade streaming connection")
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		pairs = make(map[string]*spdyStreamPair)
+	)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for stream := range conn.newStreams {
+		streamType := stream.Headers().Get(streamTypeHeader)
+		if streamType != streamTypeData && streamType != streamTypeError {
+			log.G(ctx).Debugf("Rejecting port forward stream with type %q", streamType)
+			stream.Reset()
+			continue
+		}
+		requestID := stream.Headers().Get(requestIDHeader)
+		if requestID == "" {
+			// Old clients don't set the request ID. They create the error
+			// stream followed by the data stream.
+			id := stream.id
+			if streamType == streamTypeData {
+				id -= 2
+			}
+			requestID = strconv.FormatUint(uint64(id), 10)
+		}
+
+		mu.Lock()
+		p, ok := pairs[requestID]
+		if !ok {
+			p = &spdyStreamPair{}
+			pairs[requestID] = p
+			p.timer = time.AfterFunc(s.conf.StreamCreationTimeout, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if pairs[requestID] != p {
+					return
+				}
+				delete(pairs, requestID)
+				if p.data != nil {
+					p.data.Reset()
+				}
+				if p.error != nil {
+					p.error.Reset()
+				}
+			})
+		}
+		if streamType == streamTypeData {
+			p.data = stream
+		} else {
+			p.error = stream
+		}
+		complete := p.data != nil && p.error != nil
+		if complete {
+			p.timer.Stop()
+			delete(pairs, requestID)
+		}
+		mu.Unlock()
+		if !complete {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer p.data.Reset()
+			defer p.error.Close()
+			port, err := strconv.ParseUint(p.data.Headers().Get(portHeader), 10, 16)
+			if err != nil || port == 0 {
+				fmt.Fprintf(p.error, "invalid port %q", p.data.Headers().Get(portHeader))
+				return
+			}
+			if !portAllowed(req, uint16(port)) {
+				fmt.Fprintf(p.error, "port %d was not requested", port)
+				return
+			}
+			s.forwardPort(ctx, uint16(port), p.data, p.error)
+		}()
+	}
+}
+
+func (s *Server) servePortForwardWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, req *PortForwardRequest) {
+	var ports []uint16
+	for _, p := range req.Ports {
+		ports = append(ports, uint16(p))
+	}
+	if len(ports) == 0 {
+		for _, v := range r.URL.Query()[portHeader] {
+			for _, p := range strings.Split(v, ",") {
+				port, err := strconv.ParseUint(strings.TrimSpace(p), 10, 16)
+				if err != nil || port == 0 {
+					http.Error(w, fmt.Sprintf("invalid port %q", p), http.StatusBadRequest)
+					return
+				}
+				ports = append(ports, uint16(port))
+			}
+		}
+	}
+	if len(ports) == 0 {
+		http.Error(w, "at least one port must be specified", http.StatusBadRequest)
+		return
+	}
+
+	ws, protocol, err := upgradeWebSocket(w, r, []string{portForwardProtocol, base64PortForwardProtocol}, s.conf.StreamIdleTimeout)
+	if err != nil {
+		log.G(ctx).WithError(err).Debug("Failed to upgrade streaming connection")
+		return
+	}
+	defer ws.shutdown()
+
+	// Each port uses a data channel followed by an error channel. The first
+	// message on each channel is the port, in little endian.
+	readable := make([]int, len(ports))
+	for i := range ports {
+		readable[i] = 2 * i
+	}
+	channels := newWSChannels(ws, protocol == base64PortForwardProtocol, 2*len(ports), readable...)
+	for i, port := range ports {
+		var b [2]byte
+		binary.LittleEndian.PutUint16(b[:], port)
+		channels.writer(2 * i).Write(b[:])
+		channels.writer(2*i + 1).Write(b[:])
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ws.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	var wg sync.WaitGroup
+	for i, port := range ports {
+		stream := &wsPortStream{
+			Reader: channels.reader(2 * i),
+			Writer: channels.writer(2 * i),
+		}
+		wg.Add(1)
+		go func(i int, port uint16) {
+			defer wg.Done()
+			s.forwardPort(ctx, port, stream, channels.writer(2*i+1))
+		}(i, port)
+	}
+	wg.Wait()
+}
+
+// wsPortStream is the data channel of a forwarded port. The WebSocket
+// protocol has no way to close a single channel, so Close does nothing.
+type wsPortStream struct {
+	io.Reader
+	io.Writer
+}
+
+// Close implements io.Closer.Close.
+func (*wsPortStream) Close() error {
+	return nil
+}
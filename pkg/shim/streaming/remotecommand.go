@@ -0,0 +1,287 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/containerd/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/remotecommand"
+)
+
+// Stream types of the SPDY remote command protocols, sent in the streamType
+// header.
+const (
+	streamTypeHeader = "streamType"
+	streamTypeError  = "error"
+	streamTypeStdin  = "stdin"
+	streamTypeStdout = "stdout"
+	streamTypeStderr = "stderr"
+	streamTypeResize = "resize"
+)
+
+// Channels of the WebSocket remote command protocols.
+const (
+	stdinChannel = iota
+	stdoutChannel
+	stderrChannel
+	errorChannel
+	resizeChannel
+	numChannels
+)
+
+// WebSocket remote command protocols.
+const (
+	wsChannelProtocol         = "channel.k8s.io"
+	wsBase64ChannelProtocol   = "base64.channel.k8s.io"
+	wsV4ChannelProtocol       = "v4.channel.k8s.io"
+	wsV4Base64ChannelProtocol = "v4.base64.channel.k8s.io"
+)
+
+var wsRemoteCommandProtocols = []string{
+	wsV4ChannelProtocol,
+	wsV4Base64ChannelProtocol,
+	wsChannelProtocol,
+	wsBase64ChannelProtocol,
+}
+
+// streamOptions are the streams requested for an exec or attach session.
+type streamOptions struct {
+	stdin  bool
+	stdout bool
+	stderr bool
+	tty    bool
+}
+
+// remoteCommandFunc runs an exec or attach session and returns its exit
+// status.
+type remoteCommandFunc func(ctx context.Context, streams Streams) (int, error)
+
+// serveRemoteCommand serves an exec or attach session.
+func (s *Server) serveRemoteCommand(ctx context.Context, w http.ResponseWriter, r *http.Request, opts streamOptions, run remoteCommandFunc) {
+	switch {
+	case isWebSocketRequest(r):
+		s.serveRemoteCommandWebSocket(ctx, w, r, opts, run)
+	case httpstream.IsUpgradeRequest(r):
+		s.serveRemoteCommandSPDY(ctx, w, r, opts, run)
+	default:
+		http.Error(w, "connection upgrade is required", http.StatusBadRequest)
+	}
+}
+
+func (s *Server) serveRemoteCommandSPDY(ctx context.Context, w http.ResponseWriter, r *http.Request, opts streamOptions, run remoteCommandFunc) {
+	conn, protocol, err := upgradeSPDY(w, r, remotecommand.SupportedStreamingProtocols, s.conf.StreamIdleTimeout)
+	if err != nil {
+		log.G(ctx).WithError(err).Debug("Failed to upgrade streaming connection")
+		return
+	}
+	defer conn.shutdown()
+
+	// The error stream is always created.
+	expected := 1
+	for _, requested := range []bool{opts.stdin, opts.stdout, opts.stderr} {
+		if requested {
+			expected++
+		}
+	}
+	resize := opts.tty && protocol != remotecommand.StreamProtocolV1Name && protocol != remotecommand.StreamProtocolV2Name
+	if resize {
+		expected++
+	}
+	received, err := conn.waitStreams(s.conf.StreamCreationTimeout, func(streams []*spdyStream) bool {
+		return len(streams) >= expected
+	})
+	if err != nil {
+		log.G(ctx).WithError(err).Warning("Streaming session failed")
+		return
+	}
+
+	var (
+		streams     Streams
+		errorStream *spdyStream
+		outputs     []*spdyStream
+	)
+	streams.TTY = opts.tty
+	for _, stream := range received {
+		switch t := stream.Headers().Get(streamTypeHeader); t {
+		case streamTypeError:
+			errorStream = stream
+		case streamTypeStdin:
+			streams.Stdin = stream
+		case streamTypeStdout:
+			streams.Stdout = stream
+			outputs = append(outputs, stream)
+		case streamTypeStderr:
+			streams.Stderr = stream
+			outputs = append(outputs, stream)
+		case streamTypeResize:
+			streams.Resize = decodeResize(ctx, stream)
+		default:
+			log.G(ctx).Warningf("Streaming session failed: unexpected stream type %q", t)
+			return
+		}
+	}
+	if errorStream == nil {
+		log.G(ctx).Warning("Streaming session failed: no error stream")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// Stop the session if the connection goes away.
+		select {
+		case <-conn.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	code, err := run(ctx, streams)
+	for _, stream := range outputs {
+		stream.Close()
+	}
+	writeStatus(ctx, errorStream, strings.HasPrefix(protocol, "v4."), code, err)
+	errorStream.Close()
+}
+
+func (s *Server) serveRemoteCommandWebSocket(ctx context.Context, w http.ResponseWriter, r *http.Request, opts streamOptions, run remoteCommandFunc) {
+	ws, protocol, err := upgradeWebSocket(w, r, wsRemoteCommandProtocols, s.conf.StreamIdleTimeout)
+	if err != nil {
+		log.G(ctx).WithError(err).Debug("Failed to upgrade streaming connection")
+		return
+	}
+	defer ws.shutdown()
+
+	var readable []int
+	if opts.stdin {
+		readable = append(readable, stdinChannel)
+	}
+	if opts.tty {
+		readable = append(readable, resizeChannel)
+	}
+	channels := newWSChannels(ws, strings.Contains(protocol, "base64"), numChannels, readable...)
+
+	streams := Streams{TTY: opts.tty}
+	if opts.stdin {
+		streams.Stdin = channels.reader(stdinChannel)
+	}
+	if opts.stdout {
+		streams.Stdout = channels.writer(stdoutChannel)
+	}
+	if opts.stderr {
+		streams.Stderr = channels.writer(stderrChannel)
+	}
+	if opts.tty {
+		streams.Resize = decodeResize(ctx, channels.reader(resizeChannel))
+	}
+
+	// An empty message on the lowest writable channel tells the client that
+	// the session is established.
+	switch {
+	case opts.stdout:
+		streams.Stdout.Write(nil)
+	case opts.stderr:
+		streams.Stderr.Write(nil)
+	default:
+		channels.writer(errorChannel).Write(nil)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-ws.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	code, err := run(ctx, streams)
+	writeStatus(ctx, channels.writer(errorChannel), strings.HasPrefix(protocol, "v4."), code, err)
+}
+
+// decodeResize returns a channel which receives the terminal sizes read from
+// r. The channel is closed when r returns an error or ctx is canceled.
+func decodeResize(ctx context.Context, r io.Reader) <-chan Size {
+	ch := make(chan Size, 1)
+	go func() {
+		defer close(ch)
+		dec := json.NewDecoder(r)
+		for {
+			var size Size
+			if err := dec.Decode(&size); err != nil {
+				return
+			}
+			select {
+			case ch <- size:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// writeStatus writes the result of a session to w. Version 4 protocols use a
+// JSON metav1.Status, older protocols only report errors, as plain text.
+func writeStatus(ctx context.Context, w io.Writer, v4 bool, code int, err error) {
+	if !v4 {
+		switch {
+		case err != nil:
+			io.WriteString(w, err.Error())
+		case code != 0:
+			fmt.Fprintf(w, "command terminated with non-zero exit code: %d", code)
+		}
+		return
+	}
+
+	status := metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusSuccess,
+	}
+	switch {
+	case err != nil:
+		status.Status = metav1.StatusFailure
+		status.Code = http.StatusInternalServerError
+		status.Reason = metav1.StatusReasonInternalError
+		status.Message = fmt.Sprintf("Internal error occurred: %v", err)
+		status.Details = &metav1.StatusDetails{
+			Causes: []metav1.StatusCause{{Message: err.Error()}},
+		}
+	case code != 0:
+		status.Status = metav1.StatusFailure
+		status.Reason = remotecommand.NonZeroExitCodeReason
+		status.Message = fmt.Sprintf("command terminated with non-zero exit code: %d", code)
+		status.Details = &metav1.StatusDetails{
+			Causes: []metav1.StatusCause{{
+				Type:    remotecommand.ExitCodeCauseType,
+				Message: strconv.Itoa(code),
+			}},
+		}
+	}
+	b, jerr := json.Marshal(&status)
+	if jerr != nil {
+		log.G(ctx).WithError(jerr).Warning("Failed to encode streaming session status")
+		return
+	}
+	w.Write(b)
+}
@@ -0,0 +1,321 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package streaming implements the Kubernetes streaming protocols used by
+// exec, attach and port-forward, so that the shim can serve them without a
+// separate streaming server in the CRI runtime.
+//
+// Sessions follow the same flow as the kubelet streaming server: a URL is
+// requested with GetExec, GetAttach or GetPortForward, which mirror the CRI
+// RPCs of the same name, and the client then connects to that URL before the
+// embedded token expires. Streams are multiplexed over SPDY/3.1 or WebSocket
+// connections, depending on the upgrade requested by the client.
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/log"
+)
+
+const (
+	// DefaultStreamCreationTimeout is the default time allowed for the client
+	// to create all streams of a session.
+	DefaultStreamCreationTimeout = 30 * time.Second
+
+	// DefaultStreamIdleTimeout is the default time after which a session
+	// without any activity is closed.
+	DefaultStreamIdleTimeout = 4 * time.Hour
+)
+
+// Size is the size of a terminal.
+type Size struct {
+	Width  uint16
+	Height uint16
+}
+
+// Streams are the standard streams of an exec or attach session. Streams that
+// were not requested are nil.
+type Streams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// TTY is true if the session uses a terminal, in which case Stderr is
+	// nil and Resize receives terminal size changes.
+	TTY    bool
+	Resize <-chan Size
+}
+
+// Runtime runs streaming sessions.
+type Runtime interface {
+	// Exec runs cmd in the container and returns its exit status.
+	Exec(ctx context.Context, cmd []string, streams Streams) (int, error)
+
+	// Attach attaches streams to the init process of the container until it
+	// exits or ctx is canceled.
+	Attach(ctx context.Context, streams Streams) error
+
+	// PortForward forwards stream to port in the network namespace of the
+	// sandbox until either side closes the connection.
+	PortForward(ctx context.Context, port uint16, stream io.ReadWriteCloser) error
+}
+
+// ExecRequest is a request to run a command in the container. It mirrors the
+// CRI ExecRequest.
+type ExecRequest struct {
+	Cmd    []string `json:"cmd"`
+	TTY    bool     `json:"tty"`
+	Stdin  bool     `json:"stdin"`
+	Stdout bool     `json:"stdout"`
+	Stderr bool     `json:"stderr"`
+}
+
+// AttachRequest is a request to attach to the container. It mirrors the CRI
+// AttachRequest.
+type AttachRequest struct {
+	TTY    bool `json:"tty"`
+	Stdin  bool `json:"stdin"`
+	Stdout bool `json:"stdout"`
+	Stderr bool `json:"stderr"`
+}
+
+// PortForwardRequest is a request to forward ports of the sandbox. It mirrors
+// the CRI PortForwardRequest. If Ports is empty, the client chooses the ports
+// when it connects.
+type PortForwardRequest struct {
+	Ports []int32 `json:"ports"`
+}
+
+// Response is the response to a streaming request.
+type Response struct {
+	URL string `json:"url"`
+}
+
+// Config configures a Server.
+type Config struct {
+	// BaseURL is the prefix of the URLs returned to clients, e.g.
+	// "http://127.0.0.1:10010".
+	BaseURL *url.URL
+
+	// StreamCreationTimeout is the time allowed for the client to create all
+	// streams of a session.
+	StreamCreationTimeout time.Duration
+
+	// StreamIdleTimeout is the time after which a session without any
+	// activity is closed. Zero disables the timeout.
+	StreamIdleTimeout time.Duration
+}
+
+// Server serves streaming sessions. It implements http.Handler.
+type Server struct {
+	conf  Config
+	rt    Runtime
+	cache *requestCache
+}
+
+// NewServer returns a new server which runs sessions with rt.
+func NewServer(conf Config, rt Runtime) *Server {
+	if conf.StreamCreationTimeout == 0 {
+		conf.StreamCreationTimeout = DefaultStreamCreationTimeout
+	}
+	return &Server{
+		conf:  conf,
+		rt:    rt,
+		cache: newRequestCache(),
+	}
+}
+
+// GetExec returns the URL of an exec session.
+func (s *Server) GetExec(req *ExecRequest) (string, error) {
+	if len(req.Cmd) == 0 {
+		return "", fmt.Errorf("cmd is required")
+	}
+	if err := validateStreams(req.TTY, req.Stdin, req.Stdout, req.Stderr); err != nil {
+		return "", err
+	}
+	return s.buildURL("exec", req)
+}
+
+// GetAttach returns the URL of an attach session.
+func (s *Server) GetAttach(req *AttachRequest) (string, error) {
+	if err := validateStreams(req.TTY, req.Stdin, req.Stdout, req.Stderr); err != nil {
+		return "", err
+	}
+	return s.buildURL("attach", req)
+}
+
+// GetPortForward returns the URL of a port-forward session.
+func (s *Server) GetPortForward(req *PortForwardRequest) (string, error) {
+	for _, port := range req.Ports {
+		if port <= 0 || port > 0xffff {
+			return "", fmt.Errorf("invalid port %d", port)
+		}
+	}
+	return s.buildURL("portforward", req)
+}
+
+func validateStreams(tty, stdin, stdout, stderr bool) error {
+	if !stdin && !stdout && !stderr {
+		return fmt.Errorf("one of stdin, stdout, or stderr must be set")
+	}
+	if tty && stderr {
+		return fmt.Errorf("tty and stderr cannot both be set")
+	}
+	return nil
+}
+
+func (s *Server) buildURL(method string, req any) (string, error) {
+	token, err := s.cache.insert(req)
+	if err != nil {
+		return "", err
+	}
+	u := *s.conf.BaseURL
+	u.Path = path.Join(u.Path, method, token)
+	return u.String(), nil
+}
+
+// APIHandler returns a handler that serves the URLs of streaming sessions. An
+// ExecRequest, AttachRequest or PortForwardRequest is posted as JSON to /exec,
+// /attach or /portforward respectively, and a Response is returned. The
+// handler must only be reachable by trusted clients.
+func (s *Server) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/exec", func(w http.ResponseWriter, r *http.Request) {
+		var req ExecRequest
+		serveAPI(w, r, &req, func() (string, error) { return s.GetExec(&req) })
+	})
+	mux.HandleFunc("/attach", func(w http.ResponseWriter, r *http.Request) {
+		var req AttachRequest
+		serveAPI(w, r, &req, func() (string, error) { return s.GetAttach(&req) })
+	})
+	mux.HandleFunc("/portforward", func(w http.ResponseWriter, r *http.Request) {
+		var req PortForwardRequest
+		serveAPI(w, r, &req, func() (string, error) { return s.GetPortForward(&req) })
+	})
+	return mux
+}
+
+// serveAPI decodes the request body into req and responds with the URL
+// returned by get.
+func serveAPI(w http.ResponseWriter, r *http.Request, req any, get func() (string, error)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, fmt.Sprintf("decoding request: %v", err), http.StatusBadRequest)
+		return
+	}
+	url, err := get()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&Response{URL: url})
+}
+
+// ServeHTTP implements http.Handler.ServeHTTP.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := strings.TrimPrefix(r.URL.Path, s.conf.BaseURL.Path)
+	method, token := path.Split(strings.Trim(p, "/"))
+	req, ok := s.cache.consume(token)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	switch method = strings.TrimSuffix(method, "/"); method {
+	case "exec":
+		execReq, ok := req.(*ExecRequest)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		log.G(ctx).Debugf("Streaming exec session: %v", execReq.Cmd)
+		opts := streamOptions{stdin: execReq.Stdin, stdout: execReq.Stdout, stderr: execReq.Stderr, tty: execReq.TTY}
+		s.serveRemoteCommand(ctx, w, r, opts, func(ctx context.Context, streams Streams) (int, error) {
+			return s.rt.Exec(ctx, execReq.Cmd, streams)
+		})
+	case "attach":
+		attachReq, ok := req.(*AttachRequest)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		log.G(ctx).Debugf("Streaming attach session")
+		opts := streamOptions{stdin: attachReq.Stdin, stdout: attachReq.Stdout, stderr: attachReq.Stderr, tty: attachReq.TTY}
+		s.serveRemoteCommand(ctx, w, r, opts, func(ctx context.Context, streams Streams) (int, error) {
+			return 0, s.rt.Attach(ctx, streams)
+		})
+	case "portforward":
+		pfReq, ok := req.(*PortForwardRequest)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		log.G(ctx).Debugf("Streaming port-forward session: %v", pfReq.Ports)
+		s.servePortForward(ctx, w, r, pfReq)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// idleTimer calls a function when it hasn't been touched for some time. A nil
+// *idleTimer never fires.
+type idleTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+// newIdleTimer returns a timer that calls f after timeout without activity,
+// or nil if timeout is zero.
+func newIdleTimer(timeout time.Duration, f func()) *idleTimer {
+	if timeout == 0 {
+		return nil
+	}
+	return &idleTimer{
+		timeout: timeout,
+		timer:   time.AfterFunc(timeout, f),
+	}
+}
+
+// touch records activity.
+func (t *idleTimer) touch() {
+	if t != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+// stop stops the timer.
+func (t *idleTimer) stop() {
+	if t != nil {
+		t.timer.Stop()
+	}
+}
@@ -0,0 +1,606 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// The subset of SPDY/3 used by Kubernetes clients. Clients create all streams
+// and only rely on SYN_STREAM, SYN_REPLY, DATA and RST_STREAM. Flow control is
+// not used.
+
+const (
+	spdyVersion      = 3
+	spdyUpgrade      = "SPDY/3.1"
+	spdyHeaderLen    = 8
+	spdyMaxFrameLen  = 1<<24 - 1
+	spdyMaxDataLen   = 32 << 10
+	spdyMaxHeaderLen = 1 << 20
+
+	// spdyCloseTimeout is the time to wait for the client to close the
+	// connection at the end of a session.
+	spdyCloseTimeout = time.Second
+
+	// spdyStreamBufferLen is the amount of data buffered for a stream before
+	// the connection stops reading.
+	spdyStreamBufferLen = 1 << 20
+)
+
+// Control frame types.
+const (
+	spdySynStream    = 1
+	spdySynReply     = 2
+	spdyRstStream    = 3
+	spdySettings     = 4
+	spdyPing         = 6
+	spdyGoAway       = 7
+	spdyHeaders      = 8
+	spdyWindowUpdate = 9
+)
+
+// Frame flags.
+const (
+	spdyFlagFin = 0x1
+)
+
+// RST_STREAM status codes.
+const (
+	spdyProtocolError = 1
+	spdyCancel        = 5
+	spdyStreamInUse   = 8
+)
+
+// spdyDictionary is the zlib dictionary used to compress SPDY/3 header blocks.
+var spdyDictionary = func() []byte {
+	words := []string{
+		"options", "head", "post", "put", "delete", "trace", "accept",
+		"accept-charset", "accept-encoding", "accept-language",
+		"accept-ranges", "age", "allow", "authorization", "cache-control",
+		"connection", "content-base", "content-encoding", "content-language",
+		"content-length", "content-location", "content-md5", "content-range",
+		"content-type", "date", "etag", "expect", "expires", "from", "host",
+		"if-match", "if-modified-since", "if-none-match", "if-range",
+		"if-unmodified-since", "last-modified", "location", "max-forwards",
+		"pragma", "proxy-authenticate", "proxy-authorization", "range",
+		"referer", "retry-after", "server", "te", "trailer",
+		"transfer-encoding", "upgrade", "user-agent", "vary", "via",
+		"warning", "www-authenticate", "method", "get", "status", "200 OK",
+		"version", "HTTP/1.1", "url", "public", "set-cookie", "keep-alive",
+		"origin",
+	}
+	var b bytes.Buffer
+	for _, w := range words {
+		binary.Write(&b, binary.BigEndian, uint32(len(w)))
+		b.WriteString(w)
+	}
+	b.WriteString("100101201202205206300302303304305306307402405406407408409410411412413414415416417502504505" +
+		"203 Non-Authoritative Information204 No Content301 Moved Permanently400 Bad Request401 Unauthorized" +
+		"403 Forbidden404 Not Found500 Internal Server Error501 Not Implemented503 Service Unavailable" +
+		"Jan Feb Mar Apr May Jun Jul Aug Sept Oct Nov Dec 00:00:00 Mon, Tue, Wed, Thu, Fri, Sat, Sun, GMT" +
+		"chunked,text/html,image/png,image/jpg,image/gif,application/xml,application/xhtml+xml,text/plain," +
+		"text/javascript,publicprivatemax-age=gzip,deflate,sdchcharset=utf-8charset=iso-8859-1,utf-,*,enq=0.")
+	return b.Bytes()
+}()
+
+// upgradeSPDY negotiates one of protocols and upgrades the connection of r to
+// SPDY. On failure, an error response has been written to w.
+func upgradeSPDY(w http.ResponseWriter, r *http.Request, protocols []string, idleTimeout time.Duration) (*spdyConn, string, error) {
+	if !strings.EqualFold(r.Header.Get(httpstream.HeaderUpgrade), spdyUpgrade) {
+		err := fmt.Errorf("unsupported upgrade %q", r.Header.Get(httpstream.HeaderUpgrade))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, "", err
+	}
+	if len(r.Header.Values(httpstream.HeaderProtocolVersion)) == 0 {
+		err := fmt.Errorf("%s is required", httpstream.HeaderProtocolVersion)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, "", err
+	}
+	// Handshake writes the error response itself.
+	protocol, err := httpstream.Handshake(r, w, protocols)
+	if err != nil {
+		return nil, "", err
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		err := fmt.Errorf("connection can't be hijacked")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, "", err
+	}
+	w.Header().Set(httpstream.HeaderConnection, httpstream.HeaderUpgrade)
+	w.Header().Set(httpstream.HeaderUpgrade, spdyUpgrade)
+	w.WriteHeader(http.StatusSwitchingProtocols)
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, "", fmt.Errorf("hijacking connection: %w", err)
+	}
+	if err := rw.Writer.Flush(); err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("flushing upgrade response: %w", err)
+	}
+	return newSPDYConn(conn, rw.Reader, idleTimeout), protocol, nil
+}
+
+// spdyConn is the server side of a SPDY connection.
+type spdyConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	idle *idleTimer
+
+	// headerSrc holds the compressed header blocks that haven't been consumed
+	// by headerDecompressor yet. The compression context spans all header
+	// blocks received on the connection. Only used by readLoop.
+	headerSrc          bytes.Buffer
+	headerDecompressor io.ReadCloser
+
+	// newStreams receives the streams created by the client. It's closed
+	// when the connection is closed.
+	newStreams chan *spdyStream
+
+	// done is closed when the connection is closed.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// writeMu serializes frame writes and protects the compression context
+	// of outgoing header blocks.
+	writeMu          sync.Mutex
+	headerBuf        bytes.Buffer
+	headerCompressor *zlib.Writer
+
+	mu      sync.Mutex
+	streams map[uint32]*spdyStream
+}
+
+func newSPDYConn(conn net.Conn, r *bufio.Reader, idleTimeout time.Duration) *spdyConn {
+	c := &spdyConn{
+		conn:       conn,
+		r:          r,
+		newStreams: make(chan *spdyStream, 16),
+		done:       make(chan struct{}),
+		streams:    make(map[uint32]*spdyStream),
+	}
+	c.idle = newIdleTimer(idleTimeout, func() { c.Close() })
+	c.headerCompressor, _ = zlib.NewWriterLevelDict(&c.headerBuf, zlib.BestCompression, spdyDictionary)
+	go c.readLoop()
+	return c
+}
+
+// Close closes the connection and all of its streams.
+func (c *spdyConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+		c.idle.stop()
+	})
+	return nil
+}
+
+// shutdown sends a GOAWAY frame and closes the connection once the client
+// closed it, or after spdyCloseTimeout. This gives the client a chance to
+// read the data sent before the connection is reset.
+func (c *spdyConn) shutdown() {
+	var p [8]byte
+	if err := c.writeControl(spdyGoAway, 0, p[:]); err == nil {
+		select {
+		case <-c.done:
+		case <-time.After(spdyCloseTimeout):
+		}
+	}
+	c.Close()
+}
+
+// waitStreams waits for streams to be created until done returns true, and
+// returns the streams received.
+func (c *spdyConn) waitStreams(timeout time.Duration, done func([]*spdyStream) bool) ([]*spdyStream, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var streams []*spdyStream
+	for !done(streams) {
+		select {
+		case s, ok := <-c.newStreams:
+			if !ok {
+				return nil, fmt.Errorf("connection closed while waiting for streams")
+			}
+			streams = append(streams, s)
+		case <-timer.C:
+			return nil, fmt.Errorf("timed out waiting for streams")
+		}
+	}
+	return streams, nil
+}
+
+func (c *spdyConn) readLoop() {
+	defer func() {
+		c.Close()
+		c.mu.Lock()
+		for _, s := range c.streams {
+			s.buf.closeWithError(io.ErrUnexpectedEOF)
+		}
+		c.streams = nil
+		c.mu.Unlock()
+		close(c.newStreams)
+		if c.headerDecompressor != nil {
+			c.headerDecompressor.Close()
+		}
+	}()
+	var hdr [spdyHeaderLen]byte
+	for {
+		if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+			return
+		}
+		c.idle.touch()
+		word := binary.BigEndian.Uint32(hdr[0:4])
+		flags := hdr[4]
+		length := binary.BigEndian.Uint32(hdr[4:8]) & spdyMaxFrameLen
+		var err error
+		if word&(1<<31) == 0 {
+			err = c.handleData(word, flags, length)
+		} else if version := (word >> 16) & 0x7fff; version != spdyVersion {
+			err = fmt.Errorf("unsupported SPDY version %d", version)
+		} else {
+			err = c.handleControl(uint16(word), flags, length)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *spdyConn) handleData(id uint32, flags uint8, length uint32) error {
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return err
+	}
+	s := c.stream(id)
+	if s == nil {
+		// Data for a stream that was reset.
+		return nil
+	}
+	if len(data) > 0 {
+		// Errors mean the stream was reset by the server, drop the data.
+		s.buf.write(data)
+	}
+	if flags&spdyFlagFin != 0 {
+		s.buf.closeWithError(io.EOF)
+	}
+	return nil
+}
+
+func (c *spdyConn) handleControl(typ uint16, flags uint8, length uint32) error {
+	if length > spdyMaxHeaderLen {
+		return fmt.Errorf("control frame too large: %d bytes", length)
+	}
+	p := make([]byte, length)
+	if _, err := io.ReadFull(c.r, p); err != nil {
+		return err
+	}
+	switch typ {
+	case spdySynStream:
+		if len(p) < 10 {
+			return fmt.Errorf("invalid SYN_STREAM frame")
+		}
+		id := binary.BigEndian.Uint32(p[0:4]) & 0x7fffffff
+		headers, err := c.readHeaderBlock(p[10:])
+		if err != nil {
+			return err
+		}
+		return c.newStream(id, flags, headers)
+	case spdySynReply, spdyHeaders:
+		if len(p) < 4 {
+			return fmt.Errorf("invalid control frame type %d", typ)
+		}
+		// The header block must be decompressed to keep the compression
+		// context in sync, even though it isn't used.
+		_, err := c.readHeaderBlock(p[4:])
+		return err
+	case spdyRstStream:
+		if len(p) < 8 {
+			return fmt.Errorf("invalid RST_STREAM frame")
+		}
+		id := binary.BigEndian.Uint32(p[0:4]) & 0x7fffffff
+		if s := c.removeStream(id); s != nil {
+			s.buf.closeWithError(fmt.Errorf("stream reset by peer"))
+		}
+	case spdyPing:
+		return c.writeControl(spdyPing, 0, p)
+	case spdyGoAway:
+		return io.EOF
+	case spdySettings, spdyWindowUpdate:
+		// Flow control is not used.
+	}
+	return nil
+}
+
+func (c *spdyConn) newStream(id uint32, flags uint8, headers http.Header) error {
+	if id == 0 || id%2 == 0 {
+		return c.writeRstStream(id, spdyProtocolError)
+	}
+	c.mu.Lock()
+	if _, ok := c.streams[id]; ok {
+		c.mu.Unlock()
+		return c.writeRstStream(id, spdyStreamInUse)
+	}
+	s := &spdyStream{
+		conn:    c,
+		id:      id,
+		headers: headers,
+		buf:     newStreamBuffer(spdyStreamBufferLen),
+	}
+	c.streams[id] = s
+	c.mu.Unlock()
+
+	if flags&spdyFlagFin != 0 {
+		s.buf.closeWithError(io.EOF)
+	}
+	if err := c.writeSynReply(id); err != nil {
+		return err
+	}
+	select {
+	case c.newStreams <- s:
+	case <-c.done:
+		return io.EOF
+	}
+	return nil
+}
+
+func (c *spdyConn) stream(id uint32) *spdyStream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.streams[id]
+}
+
+func (c *spdyConn) removeStream(id uint32) *spdyStream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.streams[id]
+	delete(c.streams, id)
+	return s
+}
+
+// readHeaderBlock decompresses and parses a header block.
+func (c *spdyConn) readHeaderBlock(block []byte) (http.Header, error) {
+	c.headerSrc.Write(block)
+	if c.headerDecompressor == nil {
+		d, err := zlib.NewReaderDict(&c.headerSrc, spdyDictionary)
+		if err != nil {
+			return nil, fmt.Errorf("reading header block: %w", err)
+		}
+		c.headerDecompressor = d
+	}
+	r := &io.LimitedReader{R: c.headerDecompressor, N: spdyMaxHeaderLen}
+	readString := func() (string, error) {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return "", err
+		}
+		if int64(n) > r.N {
+			return "", fmt.Errorf("header block too large")
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.BigEndian, &count); err != nil {
+		return nil, fmt.Errorf("reading header block: %w", err)
+	}
+	headers := make(http.Header)
+	for i := uint32(0); i < count; i++ {
+		name, err := readString()
+		if err != nil {
+			return nil, fmt.Errorf("reading header block: %w", err)
+		}
+		value, err := readString()
+		if err != nil {
+			return nil, fmt.Errorf("reading header block: %w", err)
+		}
+		for _, v := range strings.Split(value, "\x00") {
+			headers.Add(name, v)
+		}
+	}
+	return headers, nil
+}
+
+// writeFrameLocked writes a frame with the given header word and payload.
+//
+// Preconditions: c.writeMu is locked.
+func (c *spdyConn) writeFrameLocked(word uint32, flags uint8, payload []byte) error {
+	frame := make([]byte, spdyHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(frame[0:4], word)
+	binary.BigEndian.PutUint32(frame[4:8], uint32(flags)<<24|uint32(len(payload)))
+	copy(frame[spdyHeaderLen:], payload)
+	c.idle.touch()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *spdyConn) writeControl(typ uint16, flags uint8, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeFrameLocked(1<<31|spdyVersion<<16|uint32(typ), flags, payload)
+}
+
+func (c *spdyConn) writeData(id uint32, flags uint8, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeFrameLocked(id, flags, data)
+}
+
+func (c *spdyConn) writeRstStream(id uint32, status uint32) error {
+	var p [8]byte
+	binary.BigEndian.PutUint32(p[0:4], id)
+	binary.BigEndian.PutUint32(p[4:8], status)
+	return c.writeControl(spdyRstStream, 0, p[:])
+}
+
+// writeSynReply replies to the creation of stream id with an empty header
+// block.
+func (c *spdyConn) writeSynReply(id uint32) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.headerBuf.Reset()
+	var p [4]byte
+	binary.BigEndian.PutUint32(p[:], id)
+	c.headerBuf.Write(p[:])
+	// Zero name/value pairs.
+	if _, err := c.headerCompressor.Write([]byte{0, 0, 0, 0}); err != nil {
+		return err
+	}
+	if err := c.headerCompressor.Flush(); err != nil {
+		return err
+	}
+	return c.writeFrameLocked(1<<31|spdyVersion<<16|spdySynReply, 0, c.headerBuf.Bytes())
+}
+
+// spdyStream is a stream created by the client.
+type spdyStream struct {
+	conn    *spdyConn
+	id      uint32
+	headers http.Header
+	buf     *streamBuffer
+
+	mu          sync.Mutex
+	writeClosed bool
+}
+
+// Headers returns the headers sent by the client when the stream was created.
+func (s *spdyStream) Headers() http.Header {
+	return s.headers
+}
+
+// Read implements io.Reader.Read.
+func (s *spdyStream) Read(p []byte) (int, error) {
+	return s.buf.read(p)
+}
+
+// Write implements io.Writer.Write.
+func (s *spdyStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writeClosed {
+		return 0, io.ErrClosedPipe
+	}
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > spdyMaxDataLen {
+			n = spdyMaxDataLen
+		}
+		if err := s.conn.writeData(s.id, 0, p[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close closes the write side of the stream. It implements io.Closer.Close.
+func (s *spdyStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.writeClosed {
+		return nil
+	}
+	s.writeClosed = true
+	return s.conn.writeData(s.id, spdyFlagFin, nil)
+}
+
+// Reset closes both sides of the stream and discards buffered data.
+func (s *spdyStream) Reset() error {
+	s.mu.Lock()
+	s.writeClosed = true
+	s.mu.Unlock()
+	s.buf.closeWithError(io.ErrClosedPipe)
+	if s.conn.removeStream(s.id) == nil {
+		return nil
+	}
+	return s.conn.writeRstStream(s.id, spdyCancel)
+}
+
+// streamBuffer buffers data received for a stream until it's read.
+type streamBuffer struct {
+	mu    sync.Mutex
+	cond  sync.Cond
+	data  bytes.Buffer
+	limit int
+	err   error
+}
+
+func newStreamBuffer(limit int) *streamBuffer {
+	b := &streamBuffer{limit: limit}
+	b.cond.L = &b.mu
+	return b
+}
+
+// write appends p to the buffer. It blocks while the buffer is full.
+func (b *streamBuffer) write(p []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.data.Len() >= b.limit && b.err == nil {
+		b.cond.Wait()
+	}
+	if b.err != nil {
+		return b.err
+	}
+	b.data.Write(p)
+	b.cond.Broadcast()
+	return nil
+}
+
+// read reads buffered data. It blocks until data is available or the buffer
+// is closed.
+func (b *streamBuffer) read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.data.Len() == 0 && b.err == nil {
+		b.cond.Wait()
+	}
+	if b.data.Len() > 0 {
+		n, _ := b.data.Read(p)
+		b.cond.Broadcast()
+		return n, nil
+	}
+	return 0, b.err
+}
+
+// closeWithError closes the buffer. Reads return err once the buffered data
+// has been consumed. If err is not io.EOF, buffered data is discarded.
+func (b *streamBuffer) closeWithError(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+	if err != io.EOF {
+		b.data.Reset()
+	}
+	b.cond.Broadcast()
+}
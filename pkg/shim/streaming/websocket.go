@@ -0,0 +1,396 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package streaming
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The server side of RFC 6455, as used by Kubernetes channel protocols: every
+// message carries the channel number in its first byte, followed by the data.
+// Base64 protocols use text messages where the channel number is an ASCII
+// digit and the data is base64 encoded.
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// wsMaxMessageLen is the maximum size of a message received from the
+	// client.
+	wsMaxMessageLen = 1 << 20
+
+	// wsCloseTimeout is the time to wait for the client to acknowledge a
+	// close frame.
+	wsCloseTimeout = time.Second
+)
+
+// Opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+)
+
+// isWebSocketRequest returns true if r requests a WebSocket upgrade.
+func isWebSocketRequest(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// upgradeWebSocket negotiates one of protocols and upgrades the connection of
+// r to WebSocket. The returned protocol is empty if the client didn't request
+// any protocol. On failure, an error response has been written to w.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, protocols []string, idleTimeout time.Duration) (*wsConn, string, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		err := fmt.Errorf("unsupported WebSocket handshake")
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, "", err
+	}
+	var clientProtocols []string
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				clientProtocols = append(clientProtocols, p)
+			}
+		}
+	}
+	protocol := ""
+	if len(clientProtocols) > 0 {
+	negotiate:
+		for _, cp := range clientProtocols {
+			for _, sp := range protocols {
+				if cp == sp {
+					protocol = cp
+					break negotiate
+				}
+			}
+		}
+		if protocol == "" {
+			err := fmt.Errorf("unable to negotiate protocol: client supports %v, server accepts %v", clientProtocols, protocols)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil, "", err
+		}
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		err := fmt.Errorf("connection can't be hijacked")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, "", err
+	}
+
+	accept := sha1.Sum([]byte(key + wsGUID))
+	w.Header().Set("Upgrade", "websocket")
+	w.Header().Set("Connection", "Upgrade")
+	w.Header().Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(accept[:]))
+	if protocol != "" {
+		w.Header().Set("Sec-WebSocket-Protocol", protocol)
+	}
+	w.WriteHeader(http.StatusSwitchingProtocols)
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, "", fmt.Errorf("hijacking connection: %w", err)
+	}
+	if err := rw.Writer.Flush(); err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("flushing upgrade response: %w", err)
+	}
+	ws := &wsConn{
+		conn: conn,
+		r:    rw.Reader,
+		done: make(chan struct{}),
+	}
+	ws.idle = newIdleTimer(idleTimeout, func() { ws.close() })
+	return ws, protocol, nil
+}
+
+// wsConn is the server side of a WebSocket connection.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	idle *idleTimer
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	writeMu sync.Mutex
+	// closeSent is true if a close frame has been sent. Protected by
+	// writeMu.
+	closeSent bool
+}
+
+// readMessage returns the next data message. Control frames are handled
+// internally. It returns io.EOF when the client closes the connection.
+func (c *wsConn) readMessage() (byte, []byte, error) {
+	var (
+		opcode byte
+		msg    []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.writeClose()
+			return 0, nil, io.EOF
+		case wsContinuation:
+			if opcode == 0 {
+				return 0, nil, fmt.Errorf("unexpected continuation frame")
+			}
+		case wsText, wsBinary:
+			if opcode != 0 {
+				return 0, nil, fmt.Errorf("unexpected data frame in fragmented message")
+			}
+			opcode = op
+		default:
+			return 0, nil, fmt.Errorf("unknown opcode %#x", op)
+		}
+		if len(msg)+len(payload) > wsMaxMessageLen {
+			return 0, nil, fmt.Errorf("message too large")
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return opcode, msg, nil
+		}
+	}
+}
+
+// readFrame reads a single frame.
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+	c.idle.touch()
+	fin := hdr[0]&0x80 != 0
+	op := hdr[0] & 0xf
+	if hdr[1]&0x80 == 0 {
+		return false, 0, nil, fmt.Errorf("unmasked client frame")
+	}
+	length := uint64(hdr[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > wsMaxMessageLen {
+		return false, 0, nil, fmt.Errorf("frame too large: %d bytes", length)
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeFrame writes a single, unfragmented frame.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.writeFrameLocked(op, payload)
+}
+
+// Preconditions: c.writeMu is locked.
+func (c *wsConn) writeFrameLocked(op byte, payload []byte) error {
+	if c.closeSent {
+		return io.ErrClosedPipe
+	}
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, 0x80|op)
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+	c.idle.touch()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// writeClose sends a close frame, if it hasn't been sent yet.
+func (c *wsConn) writeClose() {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return
+	}
+	// Normal closure.
+	c.writeFrameLocked(wsClose, []byte{0x03, 0xe8})
+	c.closeSent = true
+}
+
+// close closes the connection immediately.
+func (c *wsConn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+		c.idle.stop()
+	})
+}
+
+// shutdown sends a close frame and closes the connection once the reader
+// received the client's acknowledgment, or after wsCloseTimeout.
+func (c *wsConn) shutdown() {
+	c.writeClose()
+	select {
+	case <-c.done:
+	case <-time.After(wsCloseTimeout):
+	}
+	c.close()
+}
+
+// wsChannels demultiplexes the channels of a Kubernetes channel protocol.
+type wsChannels struct {
+	ws     *wsConn
+	base64 bool
+
+	// in holds the data received on readable channels, and nil for other
+	// channels.
+	in []*streamBuffer
+}
+
+// newWSChannels returns n channels over ws, of which the ones listed in
+// readable accept data from the client.
+func newWSChannels(ws *wsConn, base64 bool, n int, readable ...int) *wsChannels {
+	c := &wsChannels{
+		ws:     ws,
+		base64: base64,
+		in:     make([]*streamBuffer, n),
+	}
+	for _, ch := range readable {
+		c.in[ch] = newStreamBuffer(wsMaxMessageLen)
+	}
+	go c.readLoop()
+	return c
+}
+
+func (c *wsChannels) readLoop() {
+	defer func() {
+		for _, b := range c.in {
+			if b != nil {
+				b.closeWithError(io.EOF)
+			}
+		}
+		c.ws.close()
+	}()
+	for {
+		_, msg, err := c.ws.readMessage()
+		if err != nil {
+			return
+		}
+		if len(msg) == 0 {
+			continue
+		}
+		ch := int(msg[0])
+		data := msg[1:]
+		if c.base64 {
+			ch -= '0'
+			if data, err = base64.StdEncoding.DecodeString(string(data)); err != nil {
+				return
+			}
+		}
+		if ch < 0 || ch >= len(c.in) || c.in[ch] == nil || len(data) == 0 {
+			continue
+		}
+		c.in[ch].write(data)
+	}
+}
+
+// reader returns a reader for data received on channel ch.
+func (c *wsChannels) reader(ch int) io.Reader {
+	return &wsChannelReader{c.in[ch]}
+}
+
+// writer returns a writer that sends data on channel ch.
+func (c *wsChannels) writer(ch int) io.Writer {
+	return &wsChannelWriter{c, byte(ch)}
+}
+
+type wsChannelReader struct {
+	buf *streamBuffer
+}
+
+// Read implements io.Reader.Read.
+func (r *wsChannelReader) Read(p []byte) (int, error) {
+	return r.buf.read(p)
+}
+
+type wsChannelWriter struct {
+	c  *wsChannels
+	ch byte
+}
+
+// Write implements io.Writer.Write. Each call sends a single message.
+func (w *wsChannelWriter) Write(p []byte) (int, error) {
+	if w.c.base64 {
+		msg := make([]byte, 1+base64.StdEncoding.EncodedLen(len(p)))
+		msg[0] = '0' + w.ch
+		base64.StdEncoding.Encode(msg[1:], p)
+		if err := w.c.ws.writeFrame(wsText, msg); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	msg := make([]byte, 1+len(p))
+	msg[0] = w.ch
+	copy(msg[1:], p)
+	if err := w.c.ws.writeFrame(wsBinary, msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
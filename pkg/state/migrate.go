@@ -0,0 +1,721 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/state/wire"
+)
+
+// Version is the version of the types encoded by Save. It must be incremented
+// whenever a saved type changes in a way that the decoder can't reconcile,
+// e.g. a field is renamed, removed or added. A Migration from the previous
+// version must be registered at the same time.
+//
+// Version 0 denotes statefiles written before versioning was introduced.
+const Version = 31
+
+// FieldDefault is a field added by a migration.
+type FieldDefault struct {
+	// Name is the field name.
+	Name string
+
+	// Value is the encoded value of the field, e.g. wire.Int(0) or
+	// wire.Nil{}.
+	Value wire.Object
+}
+
+// TypeMigration describes the changes made to a single type.
+//
+// Changes are applied in the following order: RemoveFields, RenameFields,
+// AddFields and finally Rename. Note that field renames are not applied to
+// references into the type (wire.Ref.Dots); fields that are referenced by
+// pointer must not be renamed.
+type TypeMigration struct {
+	// Rename is the new name of the type, if it changed.
+	Rename string
+
+	// RenameFields maps old field names to new field names.
+	RenameFields map[string]string
+
+	// RemoveFields lists fields that no longer exist.
+	RemoveFields []string
+
+	// AddFields lists fields that were added, with their encoded value.
+	AddFields []FieldDefault
+}
+
+// Migration upgrades encoded objects from version From to From+1.
+type Migration struct {
+	// From is the version being upgraded.
+	From uint32
+
+	// Description is a human readable summary of the changes.
+	Description string
+
+	// Types maps the type names in version From to their changes.
+	Types map[string]TypeMigration
+}
+
+// migrations holds registered migrations, indexed by Migration.From.
+var migrations = make(map[uint32]*Migration)
+
+// RegisterMigration registers a migration.
+//
+// This must be called during initialization.
+func RegisterMigration(m *Migration) {
+	if m.From >= Version {
+		panic(fmt.Sprintf("migration from version %d is not older than current version %d", m.From, Version))
+	}
+	if _, ok := migrations[m.From]; ok {
+		panic(fmt.Sprintf("duplicate migration from version %d", m.From))
+	}
+	migrations[m.From] = m
+}
+
+func init() {
+	// Statefiles written before versioning was introduced use the same
+	// encoding as version 1.
+	RegisterMigration(&Migration{
+		From:        0,
+		Description: "unversioned statefile",
+	})
+	RegisterMigration(&Migration{
+		From:        1,
+		Description: "TCP endpoints record their save time",
+		Types: map[string]TypeMigration{
+			"pkg/tcpip/transport/tcp.endpoint": {
+				AddFields: []FieldDefault{{Name: "saveTime", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        2,
+		Description: "mounts record slave propagation",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/vfs.Mount": {
+				AddFields: []FieldDefault{
+					{Name: "master", Value: wire.Nil{}},
+					{Name: "slaves", Value: wire.Nil{}},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        3,
+		Description: "kernel records whether nested containers are enabled",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/kernel.Kernel": {
+				AddFields: []FieldDefault{{Name: "nestedContainers", Value: wire.Bool(false)}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        4,
+		Description: "thread groups record whether they reap orphans",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/kernel.ThreadGroup": {
+				AddFields: []FieldDefault{
+					{Name: "reapsOrphans", Value: wire.Bool(false)},
+					{Name: "autoReap", Value: wire.Bool(false)},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        5,
+		Description: "netlink sockets record their multicast groups",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/socket/netlink.Socket": {
+				AddFields: []FieldDefault{{Name: "groups", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        6,
+		Description: "credentials and user namespaces hold keyrings",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/kernel/auth.Credentials": {
+				AddFields: []FieldDefault{{Name: "SessionKeyring", Value: wire.Nil{}}},
+			},
+			"pkg/sentry/kernel/auth.UserNamespace": {
+				AddFields: []FieldDefault{{Name: "keys", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        7,
+		Description: "POSIX message queues are charged to RLIMIT_MSGQUEUE and support notifications",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/kernel/mq.Queue": {
+				// Queues without a registry weren't charged.
+				AddFields: []FieldDefault{
+					{Name: "registry", Value: wire.Nil{}},
+					{Name: "waitingReceivers", Value: wire.Nil{}},
+					{Name: "chargedBytes", Value: wire.Nil{}},
+				},
+			},
+			"pkg/sentry/kernel/mq.Registry": {
+				AddFields: []FieldDefault{
+					{Name: "queueCount", Value: wire.Nil{}},
+					{Name: "userBytes", Value: wire.Nil{}},
+				},
+			},
+			"pkg/sentry/kernel/mq.Subscriber": {
+				AddFields: []FieldDefault{
+					{Name: "method", Value: wire.Nil{}},
+					{Name: "signo", Value: wire.Nil{}},
+					{Name: "notifier", Value: wire.Nil{}},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        8,
+		Description: "SysV shared memory limits are per IPC namespace, and segments may use huge pages",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/kernel/shm.Registry": {
+				// The defaults are linux.SHMMAX, linux.SHMALL and
+				// linux.SHMMNI, which can't be imported here.
+				AddFields: []FieldDefault{
+					{Name: "shmMax", Value: wire.Uint(math.MaxUint64 - 1<<24)},
+					{Name: "shmAll", Value: wire.Uint(math.MaxUint64 - 1<<24)},
+					{Name: "shmMni", Value: wire.Uint(4096)},
+				},
+			},
+			"pkg/sentry/kernel/shm.Shm": {
+				AddFields: []FieldDefault{{Name: "hugetlb", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        9,
+		Description: "/proc/sys/kernel IPC limits and /proc/sys/net files are per namespace",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/proc.shmLimit": {
+				Rename: "pkg/sentry/fsimpl/proc.ipcLimit",
+			},
+			"pkg/sentry/fsimpl/proc.shmLimitData": {
+				Rename: "pkg/sentry/fsimpl/proc.ipcLimitData",
+			},
+			// The files now find the stack from the task's network
+			// namespace instead of holding it.
+			"pkg/sentry/fsimpl/proc.ipForwarding": {
+				RemoveFields: []string{"stack", "enabled"},
+			},
+			"pkg/sentry/fsimpl/proc.portRange": {
+				RemoveFields: []string{"stack", "start", "end"},
+			},
+			"pkg/sentry/fsimpl/proc.tcpMemData": {
+				RemoveFields: []string{"stack"},
+			},
+			"pkg/sentry/fsimpl/proc.tcpRecoveryData": {
+				RemoveFields: []string{"stack"},
+			},
+			"pkg/sentry/fsimpl/proc.tcpSackData": {
+				RemoveFields: []string{"stack", "enabled"},
+			},
+			// Registry.afterLoad sets the default limits.
+			"pkg/sentry/kernel/msgqueue.Registry": {
+				AddFields: []FieldDefault{
+					{Name: "msgMax", Value: wire.Nil{}},
+					{Name: "msgMnb", Value: wire.Nil{}},
+					{Name: "msgMni", Value: wire.Nil{}},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        10,
+		Description: "the kernel holds the audit subsystem, and credentials carry an audit login UID and session ID",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/kernel.Kernel": {
+				AddFields: []FieldDefault{
+					{Name: "lastAuditSessionID", Value: wire.Nil{}},
+					{Name: "audit", Value: wire.Nil{}},
+				},
+			},
+			"pkg/sentry/kernel/auth.Credentials": {
+				// auth.NoID and linux.AUDIT_SID_UNSET.
+				AddFields: []FieldDefault{
+					{Name: "LoginKUID", Value: wire.Uint(math.MaxUint32)},
+					{Name: "SessionID", Value: wire.Uint(math.MaxUint32)},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        11,
+		Description: "VFS presents a Linux Security Module",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/vfs.VirtualFilesystem": {
+				AddFields: []FieldDefault{{Name: "lsm", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        12,
+		Description: "cgroup cpusets are enforced, and /proc/cpuinfo is generated per task",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/cgroupfs.cpusData": {
+				AddFields: []FieldDefault{{Name: "cg", Value: wire.Nil{}}},
+			},
+			"pkg/sentry/fsimpl/proc.staticFileSetStat": {
+				// staticFileSetStat was only used by /proc/cpuinfo.
+				Rename:       "pkg/sentry/fsimpl/proc.cpuInfoData",
+				RemoveFields: []string{"StaticData"},
+			},
+			"pkg/sentry/fsimpl/sys.cpuFile": {
+				AddFields: []FieldDefault{{Name: "cpuset", Value: wire.Nil{}}},
+			},
+			// Restored tasks are confined to their cpuset once they move
+			// to another cgroup or its CPUs change.
+			"pkg/sentry/kernel.Task": {
+				AddFields: []FieldDefault{{Name: "cpusetMask", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        13,
+		Description: "CPUs can be brought online and offline",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/sys.cpuFile": {
+				RenameFields: map[string]string{"cpuset": "online"},
+			},
+			// Kernel.LoadFrom brings all CPUs online.
+			"pkg/sentry/kernel.Kernel": {
+				AddFields: []FieldDefault{{Name: "onlineCores", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        14,
+		Description: "gofer filesystems record the server that owns them",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/gofer.InternalFilesystemOptions": {
+				AddFields: []FieldDefault{{Name: "Owner", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        15,
+		Description: "gofer filesystems have a configurable readahead",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/gofer.filesystemOptions": {
+				AddFields: []FieldDefault{{Name: "readahead", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        16,
+		Description: "gofer filesystems may buffer appending writes",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/gofer.filesystemOptions": {
+				AddFields: []FieldDefault{{Name: "writeback", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        17,
+		Description: "gofer filesystems have configurable inode numbers and device",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/gofer.filesystem": {
+				AddFields: []FieldDefault{{Name: "savedInoByKey", Value: wire.Nil{}}},
+			},
+			"pkg/sentry/fsimpl/gofer.filesystemOptions": {
+				AddFields: []FieldDefault{
+					{Name: "ino", Value: wire.Nil{}},
+					{Name: "dev", Value: wire.Nil{}},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        18,
+		Description: "overlay filesystems support metacopy and redirect_dir",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/overlay.FilesystemOptions": {
+				AddFields: []FieldDefault{
+					{Name: "MetaCopy", Value: wire.Nil{}},
+					{Name: "RedirectDir", Value: wire.Nil{}},
+				},
+			},
+			"pkg/sentry/fsimpl/overlay.dentry": {
+				AddFields: []FieldDefault{
+					{Name: "metacopy", Value: wire.Nil{}},
+					{Name: "redirect", Value: wire.Nil{}},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        19,
+		Description: "shared futexes are hashed to multiple buckets",
+		Types: map[string]TypeMigration{
+			// Manager.afterLoad replaces the single shared bucket with
+			// sharedBuckets.
+			"pkg/sentry/kernel/futex.Manager": {
+				RenameFields: map[string]string{"sharedBucket": "legacySharedBucket"},
+				AddFields:    []FieldDefault{{Name: "sharedBuckets", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        20,
+		Description: "tasks have a scheduling policy",
+		Types: map[string]TypeMigration{
+			// The zero SchedPolicy is SCHED_NORMAL.
+			"pkg/sentry/kernel.Task": {
+				AddFields: []FieldDefault{{Name: "schedPolicy", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        21,
+		Description: "the cgroup cpu controller has burst and idle parameters",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/cgroupfs.cpuController": {
+				AddFields: []FieldDefault{
+					{Name: "cfsBurst", Value: wire.Nil{}},
+					{Name: "idle", Value: wire.Nil{}},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        22,
+		Description: "task timers have a slack and a minimum resolution",
+		Types: map[string]TypeMigration{
+			// Zero disables timer coalescing and rounding.
+			"pkg/sentry/kernel.Kernel": {
+				AddFields: []FieldDefault{
+					{Name: "timerSlack", Value: wire.Nil{}},
+					{Name: "timerResolution", Value: wire.Nil{}},
+				},
+			},
+			"pkg/sentry/kernel.Task": {
+				AddFields: []FieldDefault{
+					{Name: "timerSlack", Value: wire.Nil{}},
+					{Name: "defaultTimerSlack", Value: wire.Nil{}},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        23,
+		Description: "the sandbox may enter deep sleep when all tasks are blocked",
+		Types: map[string]TypeMigration{
+			// Zero disables deep sleep.
+			"pkg/sentry/kernel.Kernel": {
+				AddFields: []FieldDefault{
+					{Name: "deepSleepDelay", Value: wire.Nil{}},
+					{Name: "deepSleepMaxProcs", Value: wire.Nil{}},
+				},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        24,
+		Description: "memory managers have a memory-deny-write-execute policy",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/mm.MemoryManager": {
+				AddFields: []FieldDefault{{Name: "mdwe", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        25,
+		Description: "the kernel holds the binfmt_misc registry",
+		Types: map[string]TypeMigration{
+			// The zero BinfmtMisc is enabled and has no entries.
+			"pkg/sentry/kernel.Kernel": {
+				AddFields: []FieldDefault{{Name: "binfmtMisc", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        26,
+		Description: "gofer filesystems may fail accesses to files truncated outside of the sandbox",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/gofer.filesystemOptions": {
+				AddFields: []FieldDefault{{Name: "truncateEIO", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        27,
+		Description: "gofer filesystems may watch the remote filesystem for changes",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/fsimpl/gofer.filesystemOptions": {
+				AddFields: []FieldDefault{{Name: "watch", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        28,
+		Description: "network namespaces save their destroy hooks",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/inet.Namespace": {
+				AddFields: []FieldDefault{{Name: "destroyHooks", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        29,
+		Description: "user namespaces may deny setgroups(2)",
+		Types: map[string]TypeMigration{
+			"pkg/sentry/kernel/auth.UserNamespace": {
+				AddFields: []FieldDefault{{Name: "setgroupsDenied", Value: wire.Nil{}}},
+			},
+		},
+	})
+	RegisterMigration(&Migration{
+		From:        30,
+		Description: "tasks may be in cgroup namespaces",
+		Types: map[string]TypeMigration{
+			// Kernel.LoadFrom creates the missing root cgroup namespace.
+			"pkg/sentry/kernel.Kernel": {
+				AddFields: []FieldDefault{{Name: "rootCgroupNamespace", Value: wire.Nil{}}},
+			},
+			// Tasks with a nil cgroup namespace are in the root namespace.
+			"pkg/sentry/kernel.Task": {
+				AddFields: []FieldDefault{{Name: "cgroupns", Value: wire.Nil{}}},
+			},
+		},
+	})
+}
+
+// ErrVersion is returned when a statefile version is not supported.
+type ErrVersion struct {
+	// Version is the statefile version.
+	Version uint32
+
+	// Missing is the first version that has no registered migration, if
+	// Version is older than the current version.
+	Missing uint32
+}
+
+// Error implements error.Error.
+func (e *ErrVersion) Error() string {
+	if e.Version > Version {
+		return fmt.Sprintf("statefile version %d is newer than the supported version %d", e.Version, Version)
+	}
+	return fmt.Sprintf("statefile version %d can't be upgraded to version %d: no migration from version %d", e.Version, Version, e.Missing)
+}
+
+// CanMigrate returns nil if objects encoded at the given version can be
+// upgraded to the current version, and an *ErrVersion otherwise.
+func CanMigrate(from uint32) error {
+	if from > Version {
+		return &ErrVersion{Version: from}
+	}
+	for v := from; v < Version; v++ {
+		if _, ok := migrations[v]; !ok {
+			return &ErrVersion{Version: from, Missing: v}
+		}
+	}
+	return nil
+}
+
+// NeedsMigration returns true if objects encoded at the given version can't be
+// decoded by Load without first being upgraded by Migrate.
+//
+// Precondition: CanMigrate(from) == nil.
+func NeedsMigration(from uint32) bool {
+	for v := from; v < Version; v++ {
+		if len(migrations[v].Types) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Migrate reads a stream of objects encoded at version from r and writes it to
+// w, upgraded to the current version. Non-object data is copied unchanged.
+func Migrate(r wire.Reader, w wire.Writer, from uint32) error {
+	if err := CanMigrate(from); err != nil {
+		return err
+	}
+	m := migrator{from: from}
+	return safely(func() {
+		for {
+			length, object, err := ReadHeader(r)
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				Failf("header error: %w", err)
+			}
+			if err := WriteHeader(w, length, object); err != nil {
+				Failf("header error: %w", err)
+			}
+			if !object {
+				if _, err := io.CopyN(w, r, int64(length)); err != nil {
+					Failf("error copying non-object data: %w", err)
+				}
+				continue
+			}
+			m.migrateGraph(r, w, length)
+		}
+	})
+}
+
+// fieldSource describes where the value of an upgraded field comes from.
+type fieldSource struct {
+	// index is the index of the field in the original encoding, or -1 if the
+	// field was added.
+	index int
+
+	// value is the value of an added field.
+	value wire.Object
+}
+
+// migrator upgrades object graphs.
+type migrator struct {
+	from uint32
+
+	// fields maps type IDs of the current graph to their field sources. Nil
+	// entries are types that are not changed.
+	fields []([]fieldSource)
+}
+
+// migrateGraph upgrades a single object graph with numObjects objects.
+//
+// Note that the structure of this loop should match the decoding loop in
+// decodeState.Load.
+func (m *migrator) migrateGraph(r wire.Reader, w wire.Writer, numObjects uint64) {
+	// Type IDs are local to each graph.
+	m.fields = m.fields[:0]
+	for i := uint64(0); i < numObjects; {
+		encoded := wire.Load(r)
+		switch we := encoded.(type) {
+		case *wire.Type:
+			m.fields = append(m.fields, m.migrateType(we))
+		case wire.Uint:
+			i++
+			wire.Save(w, we)
+			encoded = m.migrateObject(wire.Load(r))
+		default:
+			Failf("wanted type or object ID, got %T", encoded)
+		}
+		wire.Save(w, encoded)
+	}
+}
+
+// migrateType applies all migrations to t in place, and returns the sources
+// of the upgraded fields, or nil if the fields are unchanged.
+func (m *migrator) migrateType(t *wire.Type) []fieldSource {
+	names := append([]string(nil), t.Fields...)
+	sources := make([]fieldSource, len(names))
+	for i := range sources {
+		sources[i].index = i
+	}
+	changed := false
+	for v := m.from; v < Version; v++ {
+		tm, ok := migrations[v].Types[t.Name]
+		if !ok {
+			continue
+		}
+		for _, name := range tm.RemoveFields {
+			i := indexOf(names, name)
+			if i < 0 {
+				Failf("migration from version %d: type %q has no field %q to remove", v, t.Name, name)
+			}
+			names = append(names[:i], names[i+1:]...)
+			sources = append(sources[:i], sources[i+1:]...)
+			changed = true
+		}
+		for oldName, newName := range tm.RenameFields {
+			i := indexOf(names, oldName)
+			if i < 0 {
+				Failf("migration from version %d: type %q has no field %q to rename", v, t.Name, oldName)
+			}
+			names[i] = newName
+		}
+		for _, f := range tm.AddFields {
+			names = append(names, f.Name)
+			sources = append(sources, fieldSource{index: -1, value: f.Value})
+			changed = true
+		}
+		if tm.Rename != "" {
+			t.Name = tm.Rename
+		}
+	}
+	t.Fields = names
+	if !changed {
+		return nil
+	}
+	return sources
+}
+
+// migrateObject upgrades all structs contained in obj.
+func (m *migrator) migrateObject(obj wire.Object) wire.Object {
+	switch x := obj.(type) {
+	case *wire.Struct:
+		return m.migrateStruct(x)
+	case *wire.Array:
+		for i := range x.Contents {
+			x.Contents[i] = m.migrateObject(x.Contents[i])
+		}
+	case *wire.Map:
+		for i := range x.Keys {
+			x.Keys[i] = m.migrateObject(x.Keys[i])
+			x.Values[i] = m.migrateObject(x.Values[i])
+		}
+	case *wire.Interface:
+		x.Value = m.migrateObject(x.Value)
+	}
+	return obj
+}
+
+// migrateStruct upgrades s and its fields.
+func (m *migrator) migrateStruct(s *wire.Struct) *wire.Struct {
+	for i := 0; i < s.Fields(); i++ {
+		f := s.Field(i)
+		*f = m.migrateObject(*f)
+	}
+	if s.TypeID == 0 {
+		// Anonymous empty struct.
+		return s
+	}
+	if int(s.TypeID) > len(m.fields) {
+		Failf("struct references unknown type ID %d", s.TypeID)
+	}
+	sources := m.fields[s.TypeID-1]
+	if sources == nil {
+		return s
+	}
+	out := &wire.Struct{TypeID: s.TypeID}
+	out.Alloc(len(sources))
+	for i, src := range sources {
+		if src.index < 0 {
+			*out.Field(i) = src.value
+		} else {
+			*out.Field(i) = *s.Field(src.index)
+		}
+	}
+	return out
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -37,10 +37,14 @@
 //
 // This map includes only strings for keys and strings for values. Keys in the
 // map that begin with "_" are for internal use only. They may be read, but may
-// not be provided by the user. In the future, this metadata may contain some
-// information relating to the state encoding itself.
+// not be provided by the user. The "_version" key holds the version of the
+// state encoding, see state.Version. The "_checksums" key is present if the
+// file was written with Options.Checksums.
 //
-// After the map, the remainder of the file is the state data.
+// The map is followed by its HMAC, keyed with the integrity key if any. After
+// that, the remainder of the file is the state data, in compressed chunks
+// which are followed by their HMAC if there is an integrity key or if the file
+// has checksums.
 package statefile
 
 import (
@@ -53,10 +57,12 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/compressio"
+	"github.com/talismancer/gvisor-ligolo/pkg/state"
 	"github.com/talismancer/gvisor-ligolo/pkg/state/wire"
 )
 
@@ -81,6 +87,17 @@ var ErrMetadataMissing = fmt.Errorf("missing metadata")
 // ErrInvalidMetadataLength is returned if the metadata length is too large.
 var ErrInvalidMetadataLength = fmt.Errorf("metadata length invalid, maximum size is %d", maxMetadataSize)
 
+// versionKey is the metadata key for the state encoding version.
+const versionKey = "_version"
+
+// checksumsKey is the metadata key recording that the file has checksums.
+const checksumsKey = "_checksums"
+
+// checksumKey is the key used for the data chunk HMACs of files with checksums
+// but without an integrity key. The HMACs are then only checksums, detecting
+// corruption but not tampering.
+var checksumKey = []byte{}
+
 // ErrMetadataInvalid is returned if passed metadata is invalid.
 var ErrMetadataInvalid = fmt.Errorf("metadata invalid, can't start with _")
 
@@ -97,10 +114,23 @@ func writeMetadataLen(w io.Writer, val uint64) error {
 	return err
 }
 
+// Options contains optional statefile settings.
+type Options struct {
+	// If Checksums is true, data chunks are checksummed even without an
+	// integrity key, and the file records that the saved state has checksums
+	// of its own, see Checksums.
+	Checksums bool
+}
+
 // NewWriter returns a state data writer for a statefile.
 //
 // Note that the returned WriteCloser must be closed.
 func NewWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser, error) {
+	return NewWriterWithOptions(w, key, metadata, Options{})
+}
+
+// NewWriterWithOptions is like NewWriter, with the given options.
+func NewWriterWithOptions(w io.Writer, key []byte, metadata map[string]string, opts Options) (WriteCloser, error) {
 	if metadata == nil {
 		metadata = make(map[string]string)
 	}
@@ -123,6 +153,18 @@ func NewWriter(w io.Writer, key []byte, metadata map[string]string) (WriteCloser
 	metadata["_timestamp"] = time.Now().UTC().String()
 	defer delete(metadata, "_timestamp")
 
+	// Record the encoding version, for compatibility checks on restore.
+	metadata[versionKey] = strconv.FormatUint(state.Version, 10)
+	defer delete(metadata, versionKey)
+
+	if opts.Checksums {
+		metadata[checksumsKey] = "true"
+		defer delete(metadata, checksumsKey)
+		if key == nil {
+			key = checksumKey
+		}
+	}
+
 	// Write the metadata.
 	b, err := json.Marshal(metadata)
 	if err != nil {
@@ -245,6 +287,10 @@ func NewReader(r io.Reader, key []byte) (wire.Reader, map[string]string, error)
 		return nil, nil, err
 	}
 
+	if key == nil && Checksums(metadata) {
+		key = checksumKey
+	}
+
 	// Wrap in compression.
 	cr, err := compressio.NewReader(r, key)
 	if err != nil {
@@ -252,3 +298,24 @@ func NewReader(r io.Reader, key []byte) (wire.Reader, map[string]string, error)
 	}
 	return cr, metadata, nil
 }
+
+// Version returns the state encoding version recorded in the statefile
+// metadata. Statefiles written before versioning was introduced are reported
+// as version 0.
+func Version(metadata map[string]string) (uint32, error) {
+	v, ok := metadata[versionKey]
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid statefile version %q: %w", v, err)
+	}
+	return uint32(n), nil
+}
+
+// Checksums returns true if the statefile with the given metadata was written
+// with Options.Checksums.
+func Checksums(metadata map[string]string) bool {
+	return metadata[checksumsKey] == "true"
+}
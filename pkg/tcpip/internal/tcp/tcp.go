@@ -42,6 +42,15 @@ func (offset TSOffset) TSVal(now tcpip.MonotonicTime) uint32 {
 	return uint32(now.Sub(tcpip.MonotonicTime{}).Milliseconds()) + offset.milliseconds
 }
 
+// Rebase returns an offset that yields the same TSVal at to as offset yields at
+// from. It's used to keep TSVal monotonic when the clock changes, e.g. after
+// restore.
+func (offset TSOffset) Rebase(from, to tcpip.MonotonicTime) TSOffset {
+	return TSOffset{
+		milliseconds: offset.TSVal(from) - uint32(to.Sub(tcpip.MonotonicTime{}).Milliseconds()),
+	}
+}
+
 // Elapsed calculates the elapsed time given now and the echoed back timestamp.
 func (offset TSOffset) Elapsed(now tcpip.MonotonicTime, tsEcr uint32) time.Duration {
 	return time.Duration(offset.TSVal(now)-tsEcr) * time.Millisecond
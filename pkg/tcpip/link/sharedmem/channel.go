@@ -0,0 +1,132 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package sharedmem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// ChannelFDs is the number of files sent along with a channel: the files of
+// the TX queue followed by the files of the RX queue, in the order returned by
+// QueueConfig.FDs.
+const ChannelFDs = 10
+
+// maxChannelInfoSize is the maximum size of an encoded ChannelInfo.
+const maxChannelInfoSize = 64 << 10
+
+// ChannelInfo describes a network channel offered by a host agent to a
+// sandbox over a Unix domain socket. The queues are named from the point of
+// view of the sandbox: it transmits packets on the TX queue and receives
+// them on the RX queue.
+type ChannelInfo struct {
+	// Name is the name of the network interface in the sandbox.
+	Name string `json:"name,omitempty"`
+
+	// MTU is the MTU of the interface.
+	MTU uint32 `json:"mtu"`
+
+	// BufferSize is the size of the buffers the data regions are split into.
+	// If zero, DefaultBufferSize is used.
+	BufferSize uint32 `json:"bufferSize,omitempty"`
+
+	// LinkAddress is the MAC address of the interface, e.g.
+	// "02:42:ac:11:00:02". If empty, packets carry no Ethernet header.
+	LinkAddress string `json:"linkAddress,omitempty"`
+
+	// Addresses are the addresses of the interface with their prefix
+	// length, e.g. "10.0.0.2/24".
+	Addresses []string `json:"addresses,omitempty"`
+
+	// Gateways are the default gateways reachable through the interface, at
+	// most one per address family.
+	Gateways []string `json:"gateways,omitempty"`
+}
+
+// SendChannel offers the queues of qp to the sandbox connected through conn,
+// which receives them with ReceiveChannel. The agent then serves the channel
+// with an endpoint returned by NewServerEndpoint.
+//
+// conn must be kept open while the channel is in use, since each side
+// detects the other going away by conn being closed.
+func SendChannel(conn *net.UnixConn, info *ChannelInfo, qp *QueuePair) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if len(b) > maxChannelInfoSize {
+		return fmt.Errorf("channel info is %d bytes, larger than the maximum of %d", len(b), maxChannelInfoSize)
+	}
+	tx, rx := qp.TXQueueConfig(), qp.RXQueueConfig()
+	fds := append(tx.FDs(), rx.FDs()...)
+	if _, _, err := conn.WriteMsgUnix(b, unix.UnixRights(fds...), nil); err != nil {
+		return fmt.Errorf("sending channel: %w", err)
+	}
+	return nil
+}
+
+// ReceiveChannel receives a channel sent with SendChannel. It returns the
+// description of the channel and ChannelFDs files, which can be turned into
+// queue configurations with QueueConfigFromFDs.
+func ReceiveChannel(conn *net.UnixConn) (*ChannelInfo, []*os.File, error) {
+	b := make([]byte, maxChannelInfoSize)
+	oob := make([]byte, unix.CmsgSpace(ChannelFDs*4))
+	n, oobn, flags, _, err := conn.ReadMsgUnix(b, oob)
+	if err != nil {
+		return nil, nil, fmt.Errorf("receiving channel: %w", err)
+	}
+	var fds []int
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing control messages: %w", err)
+	}
+	for _, msg := range msgs {
+		rights, err := unix.ParseUnixRights(&msg)
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+	files := make([]*os.File, 0, len(fds))
+	for _, fd := range fds {
+		files = append(files, os.NewFile(uintptr(fd), "sharedmem"))
+	}
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	if flags&(unix.MSG_TRUNC|unix.MSG_CTRUNC) != 0 {
+		closeAll()
+		return nil, nil, fmt.Errorf("channel message was truncated")
+	}
+	if len(files) != ChannelFDs {
+		closeAll()
+		return nil, nil, fmt.Errorf("received %d files with channel, want %d", len(files), ChannelFDs)
+	}
+	var info ChannelInfo
+	if err := json.Unmarshal(b[:n], &info); err != nil {
+		closeAll()
+		return nil, nil, fmt.Errorf("decoding channel info: %w", err)
+	}
+	return &info, files, nil
+}
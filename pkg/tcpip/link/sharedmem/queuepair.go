@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/eventfd"
+	"github.com/talismancer/gvisor-ligolo/pkg/memutil"
 	"golang.org/x/sys/unix"
 )
 
@@ -77,29 +78,46 @@ type QueueOptions struct {
 	// SharedMemPath is the path to use to create the shared memory backing
 	// files for the queue.
 	//
-	// If unspecified it defaults to "/dev/shm".
+	// If unspecified it defaults to "/dev/shm". It is ignored if Memfd is
+	// set.
 	SharedMemPath string
+
+	// Memfd backs the queues with memfds instead of files created under
+	// SharedMemPath, so that they don't depend on a writable tmpfs.
+	Memfd bool
+
+	// DataSize is the size of the data region of each queue. If zero,
+	// DefaultQueueDataSize is used.
+	DataSize int64
+
+	// PipeSize is the size of the descriptor pipes of each queue. If zero,
+	// DefaultQueuePipeSize is used.
+	PipeSize int64
 }
 
 // NewQueuePair creates a shared memory QueuePair.
 func NewQueuePair(opts QueueOptions) (*QueuePair, error) {
-	txCfg, err := createQueueFDs(opts.SharedMemPath, queueSizes{
+	sizes := queueSizes{
 		dataSize:       DefaultQueueDataSize,
 		txPipeSize:     DefaultQueuePipeSize,
 		rxPipeSize:     DefaultQueuePipeSize,
 		sharedDataSize: DefaultSharedDataSize,
-	})
+	}
+	if opts.DataSize != 0 {
+		sizes.dataSize = opts.DataSize
+	}
+	if opts.PipeSize != 0 {
+		sizes.txPipeSize = opts.PipeSize
+		sizes.rxPipeSize = opts.PipeSize
+	}
+
+	txCfg, err := createQueueFDs(opts, sizes)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create tx queue: %s", err)
 	}
 
-	rxCfg, err := createQueueFDs(opts.SharedMemPath, queueSizes{
-		dataSize:       DefaultQueueDataSize,
-		txPipeSize:     DefaultQueuePipeSize,
-		rxPipeSize:     DefaultQueuePipeSize,
-		sharedDataSize: DefaultSharedDataSize,
-	})
+	rxCfg, err := createQueueFDs(opts, sizes)
 
 	if err != nil {
 		closeFDs(txCfg)
@@ -135,7 +153,7 @@ type queueSizes struct {
 	sharedDataSize int64
 }
 
-func createQueueFDs(sharedMemPath string, s queueSizes) (QueueConfig, error) {
+func createQueueFDs(opts QueueOptions, s queueSizes) (QueueConfig, error) {
 	success := false
 	var eventFD eventfd.Eventfd
 	var dataFD, txPipeFD, rxPipeFD, sharedDataFD int
@@ -155,19 +173,19 @@ func createQueueFDs(sharedMemPath string, s queueSizes) (QueueConfig, error) {
 	if err != nil {
 		return QueueConfig{}, fmt.Errorf("eventfd failed: %v", err)
 	}
-	dataFD, err = createFile(sharedMemPath, s.dataSize, false)
+	dataFD, err = createQueueFile(opts, s.dataSize, false)
 	if err != nil {
 		return QueueConfig{}, fmt.Errorf("failed to create dataFD: %s", err)
 	}
-	txPipeFD, err = createFile(sharedMemPath, s.txPipeSize, true)
+	txPipeFD, err = createQueueFile(opts, s.txPipeSize, true)
 	if err != nil {
 		return QueueConfig{}, fmt.Errorf("failed to create txPipeFD: %s", err)
 	}
-	rxPipeFD, err = createFile(sharedMemPath, s.rxPipeSize, true)
+	rxPipeFD, err = createQueueFile(opts, s.rxPipeSize, true)
 	if err != nil {
 		return QueueConfig{}, fmt.Errorf("failed to create rxPipeFD: %s", err)
 	}
-	sharedDataFD, err = createFile(sharedMemPath, s.sharedDataSize, false)
+	sharedDataFD, err = createQueueFile(opts, s.sharedDataSize, false)
 	if err != nil {
 		return QueueConfig{}, fmt.Errorf("failed to create sharedDataFD: %s", err)
 	}
@@ -181,6 +199,15 @@ func createQueueFDs(sharedMemPath string, s queueSizes) (QueueConfig, error) {
 	}, nil
 }
 
+// createQueueFile creates a file of the given size for a queue, as specified
+// by opts.
+func createQueueFile(opts QueueOptions, size int64, initQueue bool) (int, error) {
+	if opts.Memfd {
+		return createMemfd(size, initQueue)
+	}
+	return createFile(opts.SharedMemPath, size, initQueue)
+}
+
 func createFile(sharedMemPath string, size int64, initQueue bool) (fd int, err error) {
 	var tmpDir = DefaultTmpDir
 	if sharedMemPath != "" {
@@ -220,3 +247,23 @@ func closeFDs(c QueueConfig) {
 	unix.Close(c.RxPipeFD)
 	unix.Close(c.SharedDataFD)
 }
+
+// createMemfd is like createFile, but creates a memfd.
+func createMemfd(size int64, initQueue bool) (int, error) {
+	fd, err := memutil.CreateMemFD("sharedmem", unix.MFD_CLOEXEC)
+	if err != nil {
+		return -1, fmt.Errorf("memfd_create failed: %v", err)
+	}
+	if err := unix.Ftruncate(fd, size); err != nil {
+		unix.Close(fd)
+		return -1, fmt.Errorf("ftruncate(%d, %d) failed: %v", fd, size, err)
+	}
+	if initQueue {
+		// Write the "slot-free" flag in the initial queue.
+		if _, err := unix.Pwrite(fd, []byte{0, 0, 0, 0, 0, 0, 0, 0x80}, 0); err != nil {
+			unix.Close(fd)
+			return -1, fmt.Errorf("pwrite failed: %v", err)
+		}
+	}
+	return fd, nil
+}
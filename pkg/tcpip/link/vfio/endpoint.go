@@ -0,0 +1,530 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package vfio
+
+import (
+	"fmt"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/buffer"
+	"github.com/talismancer/gvisor-ligolo/pkg/eventfd"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/rawfile"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/stopfd"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/virtqueue"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultMTU is the MTU used if the device doesn't report one.
+	DefaultMTU = 1500
+
+	// queueSize is the maximum number of entries of each virtqueue.
+	queueSize = 256
+
+	// bufferSize is the size of each packet buffer. Since mergeable receive
+	// buffers aren't negotiated, it limits the MTU.
+	bufferSize = 2048
+
+	// maxMTU is the largest MTU that fits in a packet buffer.
+	maxMTU = bufferSize - virtqueue.NetHdrSize - header.EthernetMinimumSize
+
+	// rxQueue and txQueue are the indices of the first receive and transmit
+	// virtqueues.
+	rxQueue = 0
+	txQueue = 1
+
+	// dmaIOVA is the IO virtual address the DMA memory is mapped at. It is
+	// above the 32-bit MSI window and within the address width of any
+	// IOMMU.
+	dmaIOVA = 1 << 32
+)
+
+var _ stack.LinkEndpoint = (*endpoint)(nil)
+
+type endpoint struct {
+	// containerFD is the VFIO container the device's IOMMU group is
+	// attached to.
+	containerFD int
+
+	// virtio is the device.
+	virtio *virtioDevice
+
+	// addr is the address of the endpoint.
+	addr tcpip.LinkAddress
+
+	// mtu is the MTU of the endpoint.
+	mtu uint32
+
+	// caps holds the endpoint capabilities.
+	caps stack.LinkEndpointCapabilities
+
+	// closed is a function to be called when the device fails.
+	closed func(tcpip.Error)
+
+	// mem is the DMA memory holding the virtqueues and packet buffers.
+	mem []byte
+
+	// rx and tx are the receive and transmit virtqueues.
+	rx *virtqueue.Queue
+	tx *virtqueue.Queue
+
+	// rxNotify and txNotify are used to notify the device of new available
+	// buffers.
+	rxNotify notifier
+	txNotify notifier
+
+	// rxBufs and txBufs are the packet buffers of the queues. Buffer i is
+	// used by descriptor i of the queue, and is at IO virtual address
+	// rxIOVA or txIOVA + i*bufferSize.
+	rxBufs []byte
+	rxIOVA uint64
+	txBufs []byte
+	txIOVA uint64
+
+	// irq is signaled by the device when it used receive buffers.
+	irq eventfd.Eventfd
+
+	mu sync.RWMutex
+	// +checklocks:mu
+	networkDispatcher stack.NetworkDispatcher
+
+	// wg keeps track of running goroutines.
+	wg sync.WaitGroup
+
+	// stopFD is used to stop the dispatch loop.
+	stopFD stopfd.StopFD
+
+	// txMu serializes access to the transmit queue.
+	txMu sync.Mutex
+
+	// txFree are the transmit descriptors not in use by the device.
+	//
+	// +checklocks:txMu
+	txFree []uint16
+}
+
+// Options specify the details about the VFIO endpoint to be created.
+type Options struct {
+	// ContainerFD is the VFIO container the IOMMU group of the device is
+	// attached to.
+	ContainerFD int
+
+	// DeviceFD is the VFIO device.
+	DeviceFD int
+
+	// ClosedFunc is a function to be called when the device fails.
+	ClosedFunc func(tcpip.Error)
+
+	// Address is the link address for this endpoint. If empty, the address
+	// reported by the device is used.
+	Address tcpip.LinkAddress
+
+	// MTU is the MTU of the endpoint. If zero, the MTU reported by the
+	// device, or DefaultMTU, is used.
+	MTU uint32
+}
+
+// New creates a new endpoint driving a virtio network device through VFIO.
+// The device is reset and owned by the endpoint from then on.
+func New(opts *Options) (stack.LinkEndpoint, error) {
+	dev := &device{fd: opts.DeviceFD}
+	// Not all devices support function level reset; the virtio reset below
+	// is sufficient for those.
+	if err := dev.reset(); err != nil {
+		log.Infof("VFIO device reset failed, continuing: %v", err)
+	}
+	v, err := newVirtioDevice(dev)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.reset(); err != nil {
+		return nil, err
+	}
+	ep, err := newEndpoint(opts, v)
+	if err != nil {
+		v.fail()
+		return nil, err
+	}
+	return ep, nil
+}
+
+func newEndpoint(opts *Options, v *virtioDevice) (*endpoint, error) {
+	features, err := v.negotiate(featureNetMAC | featureNetMTU)
+	if err != nil {
+		return nil, err
+	}
+	ep := &endpoint{
+		containerFD: opts.ContainerFD,
+		virtio:      v,
+		addr:        opts.Address,
+		mtu:         opts.MTU,
+		caps:        stack.CapabilityResolutionRequired,
+		closed:      opts.ClosedFunc,
+	}
+
+	if ep.addr == "" {
+		if features&featureNetMAC == 0 {
+			return nil, fmt.Errorf("device doesn't report a MAC address and none was given")
+		}
+		var mac [header.EthernetAddressSize]byte
+		if err := v.config.read(netConfigMAC, mac[:]); err != nil {
+			return nil, err
+		}
+		ep.addr = tcpip.LinkAddress(mac[:])
+	}
+	if ep.mtu == 0 {
+		ep.mtu = DefaultMTU
+		if features&featureNetMTU != 0 {
+			mtu, err := v.config.read16(netConfigMTU)
+			if err != nil {
+				return nil, err
+			}
+			ep.mtu = uint32(mtu)
+		}
+	}
+	if ep.mtu > maxMTU {
+		ep.mtu = maxMTU
+	}
+
+	if n, err := v.numQueues(); err != nil {
+		return nil, err
+	} else if n <= txQueue {
+		return nil, fmt.Errorf("device has %d virtqueues, want at least %d", n, txQueue+1)
+	}
+	var sizes [2]uint16
+	for i, idx := range []uint16{rxQueue, txQueue} {
+		maxSize, err := v.maxQueueSize(idx)
+		if err != nil {
+			return nil, err
+		}
+		if maxSize == 0 {
+			return nil, fmt.Errorf("virtqueue %d is unavailable", idx)
+		}
+		sizes[i] = queueSize
+		if maxSize < queueSize {
+			sizes[i] = maxSize
+		}
+	}
+
+	// Lay out the DMA memory: both virtqueues, followed by the buffers.
+	rxQueueLen, txQueueLen := virtqueue.MemorySize(sizes[0]), virtqueue.MemorySize(sizes[1])
+	rxBufsLen, txBufsLen := int(sizes[0])*bufferSize, int(sizes[1])*bufferSize
+	size := rxQueueLen + txQueueLen + rxBufsLen + txBufsLen
+	ep.mem, err = unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, fmt.Errorf("allocating DMA memory: %w", err)
+	}
+	if err := mapDMA(ep.containerFD, ep.mem, dmaIOVA); err != nil {
+		unix.Munmap(ep.mem)
+		return nil, err
+	}
+	off := 0
+	ep.rx = virtqueue.New(sizes[0], ep.mem[off:], dmaIOVA+uint64(off))
+	off += rxQueueLen
+	ep.tx = virtqueue.New(sizes[1], ep.mem[off:], dmaIOVA+uint64(off))
+	off += txQueueLen
+	ep.rxBufs, ep.rxIOVA = ep.mem[off:off+rxBufsLen], dmaIOVA+uint64(off)
+	off += rxBufsLen
+	ep.txBufs, ep.txIOVA = ep.mem[off:off+txBufsLen], dmaIOVA+uint64(off)
+
+	success := false
+	defer func() {
+		if !success {
+			ep.release()
+		}
+	}()
+
+	if ep.irq, err = eventfd.Create(); err != nil {
+		return nil, err
+	}
+	if err := v.dev.setMSIXEventFD(ep.irq.FD()); err != nil {
+		return nil, err
+	}
+	if err := v.common.write16(commonMSIXConfig, virtioMSINoVector); err != nil {
+		return nil, err
+	}
+	// Transmitted buffers are reclaimed lazily in WritePackets, so the
+	// transmit queue doesn't need interrupts.
+	ep.tx.SetNoInterrupt()
+	if ep.rxNotify, err = v.setupQueue(rxQueue, ep.rx, 0); err != nil {
+		return nil, err
+	}
+	if ep.txNotify, err = v.setupQueue(txQueue, ep.tx, virtioMSINoVector); err != nil {
+		return nil, err
+	}
+	if ep.stopFD, err = stopfd.New(); err != nil {
+		return nil, err
+	}
+
+	// Give all receive buffers to the device.
+	for id := uint16(0); id < ep.rx.Size(); id++ {
+		ep.rx.SetDesc(id, ep.rxIOVA+uint64(id)*bufferSize, bufferSize, virtqueue.DescFlagWrite)
+		ep.rx.Push(id)
+	}
+	ep.rx.Publish()
+	ep.txMu.Lock()
+	for id := uint16(0); id < ep.tx.Size(); id++ {
+		ep.txFree = append(ep.txFree, id)
+	}
+	ep.txMu.Unlock()
+
+	if err := v.setStatus(statusDriverOK); err != nil {
+		return nil, err
+	}
+	if err := v.kick(ep.rxNotify); err != nil {
+		return nil, err
+	}
+	success = true
+	return ep, nil
+}
+
+// release releases the resources of a partially initialized endpoint.
+func (ep *endpoint) release() {
+	if ep.irq.FD() > 0 {
+		ep.virtio.dev.disableMSIX()
+		ep.irq.Close()
+	}
+	if ep.stopFD.EFD > 0 {
+		unix.Close(ep.stopFD.EFD)
+	}
+	unmapDMA(ep.containerFD, dmaIOVA, uint64(len(ep.mem)))
+	unix.Munmap(ep.mem)
+}
+
+// Attach launches the goroutine that receives packets from the device and
+// dispatches them via the provided dispatcher. If one is already attached,
+// then nothing happens.
+//
+// Attach implements stack.LinkEndpoint.Attach.
+func (ep *endpoint) Attach(networkDispatcher stack.NetworkDispatcher) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	// nil means the NIC is being removed.
+	if networkDispatcher == nil && ep.networkDispatcher != nil {
+		ep.stopFD.Stop()
+		ep.Wait()
+		ep.networkDispatcher = nil
+		return
+	}
+	if networkDispatcher != nil && ep.networkDispatcher == nil {
+		ep.networkDispatcher = networkDispatcher
+		// Link endpoints are not savable. When transportation endpoints are
+		// saved, they stop sending outgoing packets and all incoming packets
+		// are rejected.
+		ep.wg.Add(1)
+		go func() { // S/R-SAFE: See above.
+			defer ep.wg.Done()
+			for {
+				cont, err := ep.dispatch()
+				if err != nil || !cont {
+					if err != nil {
+						ep.virtio.fail()
+					}
+					if ep.closed != nil {
+						ep.closed(err)
+					}
+					return
+				}
+			}
+		}()
+	}
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (ep *endpoint) IsAttached() bool {
+	ep.mu.RLock()
+	defer ep.mu.RUnlock()
+	return ep.networkDispatcher != nil
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (ep *endpoint) MTU() uint32 {
+	return ep.mtu
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities.
+func (ep *endpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return ep.caps
+}
+
+// MaxHeaderLength returns the maximum size of the link-layer header.
+func (ep *endpoint) MaxHeaderLength() uint16 {
+	return uint16(header.EthernetMinimumSize)
+}
+
+// LinkAddress returns the link address of this endpoint.
+func (ep *endpoint) LinkAddress() tcpip.LinkAddress {
+	return ep.addr
+}
+
+// Wait implements stack.LinkEndpoint.Wait. It waits for the endpoint to stop
+// receiving packets.
+func (ep *endpoint) Wait() {
+	ep.wg.Wait()
+}
+
+// AddHeader implements stack.LinkEndpoint.AddHeader.
+func (ep *endpoint) AddHeader(pkt stack.PacketBufferPtr) {
+	eth := header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize))
+	eth.Encode(&header.EthernetFields{
+		SrcAddr: pkt.EgressRoute.LocalLinkAddress,
+		DstAddr: pkt.EgressRoute.RemoteLinkAddress,
+		Type:    pkt.NetworkProtocolNumber,
+	})
+}
+
+// ParseHeader implements stack.LinkEndpoint.ParseHeader.
+func (ep *endpoint) ParseHeader(pkt stack.PacketBufferPtr) bool {
+	_, ok := pkt.LinkHeader().Consume(header.EthernetMinimumSize)
+	return ok
+}
+
+// ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType.
+func (ep *endpoint) ARPHardwareType() header.ARPHardwareType {
+	return header.ARPHardwareEther
+}
+
+// WritePackets copies outbound packets to transmit buffers and passes them to
+// the device. Packets that don't fit in the transmit queue aren't written.
+//
+// Each packet in pkts should have the following fields populated:
+//   - pkt.EgressRoute
+//   - pkt.NetworkProtocolNumber
+//
+// The following should not be populated, as GSO is not supported.
+//   - pkt.GSOOptions
+func (ep *endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	ep.txMu.Lock()
+	defer ep.txMu.Unlock()
+
+	// Reclaim buffers transmitted by the device.
+	for {
+		id, _, ok := ep.tx.Pop()
+		if !ok {
+			break
+		}
+		ep.txFree = append(ep.txFree, id)
+	}
+
+	written := 0
+	for _, pkt := range pkts.AsSlice() {
+		if len(ep.txFree) == 0 {
+			break
+		}
+		if size := pkt.Size(); size > bufferSize-virtqueue.NetHdrSize {
+			return written, &tcpip.ErrMessageTooLong{}
+		}
+		id := ep.txFree[len(ep.txFree)-1]
+		ep.txFree = ep.txFree[:len(ep.txFree)-1]
+
+		buf := ep.txBufs[int(id)*bufferSize : (int(id)+1)*bufferSize]
+		// No offloads are negotiated, so the header is all zeroes.
+		for i := range buf[:virtqueue.NetHdrSize] {
+			buf[i] = 0
+		}
+		n := virtqueue.NetHdrSize
+		for _, b := range pkt.AsSlices() {
+			n += copy(buf[n:], b)
+		}
+		ep.tx.SetDesc(id, ep.txIOVA+uint64(id)*bufferSize, uint32(n), 0)
+		ep.tx.Push(id)
+		written++
+	}
+	if written == 0 {
+		return 0, &tcpip.ErrNoBufferSpace{}
+	}
+	ep.tx.Publish()
+	if ep.tx.NeedsKick() {
+		if err := ep.virtio.kick(ep.txNotify); err != nil {
+			return written, &tcpip.ErrClosedForSend{}
+		}
+	}
+	return written, nil
+}
+
+// dispatch waits for the device to use receive buffers and delivers the
+// packets in them.
+func (ep *endpoint) dispatch() (bool, tcpip.Error) {
+	for {
+		stopped, errno := rawfile.BlockingPollUntilStopped(ep.stopFD.EFD, ep.irq.FD(), unix.POLLIN|unix.POLLERR)
+		if errno != 0 {
+			if errno == unix.EINTR {
+				continue
+			}
+			return !stopped, rawfile.TranslateErrno(errno)
+		}
+		if stopped {
+			return true, nil
+		}
+		break
+	}
+	// Clear the interrupt before looking at the used ring, so that buffers
+	// used afterwards raise a new one.
+	var tmp [8]byte
+	if _, err := unix.Read(ep.irq.FD(), tmp[:]); err != nil && err != unix.EAGAIN {
+		return false, rawfile.TranslateErrno(err.(unix.Errno))
+	}
+
+	var views []*buffer.View
+	reposted := 0
+	for {
+		id, n, ok := ep.rx.Pop()
+		if !ok {
+			break
+		}
+		if id >= ep.rx.Size() {
+			return false, &tcpip.ErrInvalidEndpointState{}
+		}
+		if n >= virtqueue.NetHdrSize+header.EthernetMinimumSize && n <= bufferSize {
+			buf := ep.rxBufs[int(id)*bufferSize:]
+			views = append(views, buffer.NewViewWithData(buf[virtqueue.NetHdrSize:n]))
+		}
+		// The data was copied, so the buffer can be reused right away.
+		ep.rx.Push(id)
+		reposted++
+	}
+	if reposted == 0 {
+		return true, nil
+	}
+	ep.rx.Publish()
+	if ep.rx.NeedsKick() {
+		if err := ep.virtio.kick(ep.rxNotify); err != nil {
+			return false, &tcpip.ErrClosedForReceive{}
+		}
+	}
+
+	ep.mu.RLock()
+	d := ep.networkDispatcher
+	ep.mu.RUnlock()
+	for _, view := range views {
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithView(view),
+		})
+		if !ep.ParseHeader(pkt) {
+			pkt.DecRef()
+			continue
+		}
+		d.DeliverNetworkPacket(header.Ethernet(view.AsSlice()).Type(), pkt)
+		pkt.DecRef()
+	}
+	return true, nil
+}
@@ -0,0 +1,45 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package vfio
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/seccomp"
+	"golang.org/x/sys/unix"
+)
+
+// Filters returns the syscalls needed by VFIO endpoints, in addition to
+// those needed by the sentry.
+func Filters() seccomp.SyscallRules {
+	nonNegativeFD := seccomp.NonNegativeFDCheck()
+	var ioctls []seccomp.Rule
+	for _, req := range []uintptr{
+		vfioDeviceGetRegionInfo,
+		vfioDeviceSetIRQs,
+		vfioDeviceReset,
+		vfioIOMMUMapDMA,
+		vfioIOMMUUnmapDMA,
+	} {
+		ioctls = append(ioctls, seccomp.Rule{
+			nonNegativeFD,
+			seccomp.EqualTo(req),
+		})
+	}
+	return seccomp.SyscallRules{
+		unix.SYS_IOCTL: ioctls,
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+// Package vfio provides link layer endpoints backed by PCI network devices,
+// typically SR-IOV virtual functions, that are driven from userspace through
+// the host's vfio-pci driver.
+//
+// The device is set up by the caller with Open, which attaches its IOMMU
+// group to a new VFIO container. The endpoint created by New then maps its
+// packet buffers into the container, so that the device can only DMA to and
+// from them, and drives the device through the device file.
+//
+// Only devices implementing the virtio 1.x network device interface over PCI
+// are supported.
+package vfio
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Ioctls and flags from include/uapi/linux/vfio.h.
+const (
+	vfioType = ';'
+	vfioBase = 100
+
+	vfioGetAPIVersion       = vfioType<<8 | (vfioBase + 0)
+	vfioCheckExtension      = vfioType<<8 | (vfioBase + 1)
+	vfioSetIOMMU            = vfioType<<8 | (vfioBase + 2)
+	vfioGroupGetStatus      = vfioType<<8 | (vfioBase + 3)
+	vfioGroupSetContainer   = vfioType<<8 | (vfioBase + 4)
+	vfioGroupGetDeviceFD    = vfioType<<8 | (vfioBase + 6)
+	vfioDeviceGetInfo       = vfioType<<8 | (vfioBase + 7)
+	vfioDeviceGetRegionInfo = vfioType<<8 | (vfioBase + 8)
+	vfioDeviceSetIRQs       = vfioType<<8 | (vfioBase + 10)
+	vfioDeviceReset         = vfioType<<8 | (vfioBase + 11)
+	vfioIOMMUMapDMA         = vfioType<<8 | (vfioBase + 13)
+	vfioIOMMUUnmapDMA       = vfioType<<8 | (vfioBase + 14)
+
+	vfioAPIVersion    = 0
+	vfioType1IOMMU    = 1
+	vfioType1v2IOMMU  = 3
+	vfioGroupViable   = 1 << 0
+	vfioDeviceFlagPCI = 1 << 1
+
+	vfioRegionInfoFlagRead  = 1 << 0
+	vfioRegionInfoFlagWrite = 1 << 1
+
+	vfioDMAMapFlagRead  = 1 << 0
+	vfioDMAMapFlagWrite = 1 << 1
+
+	vfioIRQSetDataNone      = 1 << 0
+	vfioIRQSetDataEventFD   = 1 << 2
+	vfioIRQSetActionTrigger = 1 << 5
+
+	// vfioPCIConfigRegionIndex is the index of the region holding the PCI
+	// configuration space. BAR n is region n.
+	vfioPCIConfigRegionIndex = 7
+
+	// vfioPCIMSIXIRQIndex is the index of MSI-X interrupts.
+	vfioPCIMSIXIRQIndex = 2
+)
+
+// groupStatus is struct vfio_group_status.
+type groupStatus struct {
+	argsz uint32
+	flags uint32
+}
+
+// deviceInfo is struct vfio_device_info, without capabilities.
+type deviceInfo struct {
+	argsz      uint32
+	flags      uint32
+	numRegions uint32
+	numIRQs    uint32
+}
+
+// regionInfo is struct vfio_region_info.
+type regionInfo struct {
+	argsz     uint32
+	flags     uint32
+	index     uint32
+	capOffset uint32
+	size      uint64
+	offset    uint64
+}
+
+// dmaMap is struct vfio_iommu_type1_dma_map.
+type dmaMap struct {
+	argsz uint32
+	flags uint32
+	vaddr uint64
+	iova  uint64
+	size  uint64
+}
+
+// dmaUnmap is struct vfio_iommu_type1_dma_unmap.
+type dmaUnmap struct {
+	argsz uint32
+	flags uint32
+	iova  uint64
+	size  uint64
+}
+
+// irqSet is struct vfio_irq_set without data.
+type irqSet struct {
+	argsz uint32
+	flags uint32
+	index uint32
+	start uint32
+	count uint32
+}
+
+// irqSetEventFD is struct vfio_irq_set with a single eventfd as data.
+type irqSetEventFD struct {
+	argsz uint32
+	flags uint32
+	index uint32
+	start uint32
+	count uint32
+	fd    int32
+}
+
+// Files are the host files that give access to a device.
+type Files struct {
+	// Container is the VFIO container the IOMMU group of the device is
+	// attached to. It is used to map DMA memory.
+	Container *os.File
+
+	// Group is the IOMMU group of the device. It is only kept open to keep
+	// the group attached to Container.
+	Group *os.File
+
+	// Device is the device.
+	Device *os.File
+}
+
+// Close closes all files.
+func (f *Files) Close() {
+	for _, file := range []*os.File{f.Device, f.Group, f.Container} {
+		if file != nil {
+			file.Close()
+		}
+	}
+}
+
+// Open opens the PCI device with address addr, e.g. "0000:3b:02.1", which
+// must be bound to the vfio-pci driver and belong to IOMMU group group. The
+// group is attached to a new container.
+func Open(addr string, group int) (*Files, error) {
+	var f Files
+	success := false
+	defer func() {
+		if !success {
+			f.Close()
+		}
+	}()
+
+	var err error
+	if f.Container, err = os.OpenFile("/dev/vfio/vfio", os.O_RDWR, 0); err != nil {
+		return nil, err
+	}
+	if v, err := ioctl(f.Container, vfioGetAPIVersion, 0); err != nil {
+		return nil, fmt.Errorf("VFIO_GET_API_VERSION: %w", err)
+	} else if v != vfioAPIVersion {
+		return nil, fmt.Errorf("unsupported VFIO API version %d", v)
+	}
+	iommuType := uintptr(vfioType1v2IOMMU)
+	if ok, _ := ioctl(f.Container, vfioCheckExtension, iommuType); ok == 0 {
+		iommuType = vfioType1IOMMU
+		if ok, _ := ioctl(f.Container, vfioCheckExtension, iommuType); ok == 0 {
+			return nil, fmt.Errorf("VFIO container doesn't support the type 1 IOMMU")
+		}
+	}
+
+	if f.Group, err = os.OpenFile(fmt.Sprintf("/dev/vfio/%d", group), os.O_RDWR, 0); err != nil {
+		return nil, err
+	}
+	status := groupStatus{}
+	if err := ioctlArg(int(f.Group.Fd()), vfioGroupGetStatus, &status); err != nil {
+		return nil, fmt.Errorf("VFIO_GROUP_GET_STATUS: %w", err)
+	}
+	if status.flags&vfioGroupViable == 0 {
+		return nil, fmt.Errorf("IOMMU group %d is not viable, all of its devices must be bound to vfio-pci", group)
+	}
+	containerFD := int32(f.Container.Fd())
+	if err := ioctlInt32(int(f.Group.Fd()), vfioGroupSetContainer, &containerFD); err != nil {
+		return nil, fmt.Errorf("VFIO_GROUP_SET_CONTAINER: %w", err)
+	}
+	if _, err := ioctl(f.Container, vfioSetIOMMU, iommuType); err != nil {
+		return nil, fmt.Errorf("VFIO_SET_IOMMU: %w", err)
+	}
+
+	fd, err := ioctlString(f.Group, vfioGroupGetDeviceFD, addr)
+	if err != nil {
+		return nil, fmt.Errorf("VFIO_GROUP_GET_DEVICE_FD(%q): %w", addr, err)
+	}
+	f.Device = os.NewFile(fd, "vfio-device")
+
+	info := deviceInfo{}
+	if err := ioctlArg(int(f.Device.Fd()), vfioDeviceGetInfo, &info); err != nil {
+		return nil, fmt.Errorf("VFIO_DEVICE_GET_INFO: %w", err)
+	}
+	if info.flags&vfioDeviceFlagPCI == 0 || info.numRegions <= vfioPCIConfigRegionIndex {
+		return nil, fmt.Errorf("device %q is not a PCI device", addr)
+	}
+	success = true
+	return &f, nil
+}
+
+// device wraps a VFIO device file descriptor.
+type device struct {
+	fd int
+}
+
+// region returns the offset and size of region index in the device file.
+func (d *device) region(index uint32) (uint64, uint64, error) {
+	info := regionInfo{index: index}
+	if err := ioctlArg(d.fd, vfioDeviceGetRegionInfo, &info); err != nil {
+		return 0, 0, fmt.Errorf("VFIO_DEVICE_GET_REGION_INFO(%d): %w", index, err)
+	}
+	if info.flags&(vfioRegionInfoFlagRead|vfioRegionInfoFlagWrite) != vfioRegionInfoFlagRead|vfioRegionInfoFlagWrite {
+		return 0, 0, fmt.Errorf("region %d is not readable and writable", index)
+	}
+	return info.offset, info.size, nil
+}
+
+// reset resets the device, if it supports function level reset.
+func (d *device) reset() error {
+	_, err := ioctlFD(d.fd, vfioDeviceReset, 0)
+	return err
+}
+
+// setMSIXEventFD signals efd when MSI-X vector 0 is triggered.
+func (d *device) setMSIXEventFD(efd int) error {
+	irqs := irqSetEventFD{
+		flags: vfioIRQSetDataEventFD | vfioIRQSetActionTrigger,
+		index: vfioPCIMSIXIRQIndex,
+		count: 1,
+		fd:    int32(efd),
+	}
+	if err := ioctlArg(d.fd, vfioDeviceSetIRQs, &irqs); err != nil {
+		return fmt.Errorf("VFIO_DEVICE_SET_IRQS: %w", err)
+	}
+	return nil
+}
+
+// disableMSIX disables all MSI-X vectors.
+func (d *device) disableMSIX() error {
+	irqs := irqSet{
+		flags: vfioIRQSetDataNone | vfioIRQSetActionTrigger,
+		index: vfioPCIMSIXIRQIndex,
+	}
+	return ioctlArg(d.fd, vfioDeviceSetIRQs, &irqs)
+}
+
+// mapDMA makes the memory mapping mem accessible to devices in the container
+// at IO virtual address iova.
+func mapDMA(containerFD int, mem []byte, iova uint64) error {
+	m := dmaMap{
+		flags: vfioDMAMapFlagRead | vfioDMAMapFlagWrite,
+		vaddr: uint64(sliceAddr(mem)),
+		iova:  iova,
+		size:  uint64(len(mem)),
+	}
+	if err := ioctlArg(containerFD, vfioIOMMUMapDMA, &m); err != nil {
+		return fmt.Errorf("VFIO_IOMMU_MAP_DMA: %w", err)
+	}
+	return nil
+}
+
+// unmapDMA reverses mapDMA.
+func unmapDMA(containerFD int, iova, size uint64) error {
+	m := dmaUnmap{
+		iova: iova,
+		size: size,
+	}
+	return ioctlArg(containerFD, vfioIOMMUUnmapDMA, &m)
+}
+
+// ioctl issues an ioctl with an integer argument on f.
+func ioctl(f *os.File, req, arg uintptr) (uintptr, error) {
+	return ioctlFD(int(f.Fd()), req, arg)
+}
+
+func ioctlFD(fd int, req, arg uintptr) (uintptr, error) {
+	r, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, arg)
+	if errno != 0 {
+		return 0, errno
+	}
+	return r, nil
+}
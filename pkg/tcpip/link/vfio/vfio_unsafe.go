@@ -0,0 +1,54 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package vfio
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioctlArg issues ioctl req on fd with a pointer to arg. All VFIO argument
+// structs start with an argsz field, which is set to the size of arg.
+func ioctlArg[T any](fd int, req uintptr, arg *T) error {
+	*(*uint32)(unsafe.Pointer(arg)) = uint32(unsafe.Sizeof(*arg))
+	_, err := ioctlFD(fd, req, uintptr(unsafe.Pointer(arg)))
+	return err
+}
+
+// ioctlInt32 issues ioctl req on fd with a pointer to arg.
+func ioctlInt32(fd int, req uintptr, arg *int32) error {
+	_, err := ioctlFD(fd, req, uintptr(unsafe.Pointer(arg)))
+	return err
+}
+
+// ioctlString issues ioctl req on f with a pointer to the NUL-terminated
+// string s, and returns the result as a file descriptor.
+func ioctlString(f *os.File, req uintptr, s string) (uintptr, error) {
+	p, err := unix.BytePtrFromString(s)
+	if err != nil {
+		return 0, err
+	}
+	return ioctl(f, req, uintptr(unsafe.Pointer(p)))
+}
+
+// sliceAddr returns the address of the first byte of b.
+func sliceAddr(b []byte) uintptr {
+	return uintptr(unsafe.Pointer(&b[0]))
+}
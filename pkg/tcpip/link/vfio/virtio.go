@@ -0,0 +1,424 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package vfio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/virtqueue"
+	"golang.org/x/sys/unix"
+)
+
+// PCI configuration space registers.
+const (
+	pciVendorID      = 0x00
+	pciDeviceID      = 0x02
+	pciCommand       = 0x04
+	pciStatus        = 0x06
+	pciCapabilityPtr = 0x34
+
+	pciCommandMemory    = 1 << 1
+	pciCommandMaster    = 1 << 2
+	pciStatusCapList    = 1 << 4
+	pciCapIDVendor      = 0x09
+	pciVendorRedHat     = 0x1af4
+	pciDeviceVirtioNet  = 0x1041
+	pciConfigSpaceLimit = 256
+)
+
+// Virtio PCI capability types, from the virtio 1.x specification.
+const (
+	virtioPCICapCommonCfg = 1
+	virtioPCICapNotifyCfg = 2
+	virtioPCICapDeviceCfg = 4
+)
+
+// Common configuration structure registers.
+const (
+	commonDeviceFeatureSelect = 0x00
+	commonDeviceFeature       = 0x04
+	commonDriverFeatureSelect = 0x08
+	commonDriverFeature       = 0x0c
+	commonMSIXConfig          = 0x10
+	commonNumQueues           = 0x12
+	commonDeviceStatus        = 0x14
+	commonQueueSelect         = 0x16
+	commonQueueSize           = 0x18
+	commonQueueMSIXVector     = 0x1a
+	commonQueueEnable         = 0x1c
+	commonQueueNotifyOff      = 0x1e
+	commonQueueDesc           = 0x20
+	commonQueueDriver         = 0x28
+	commonQueueDevice         = 0x30
+
+	virtioMSINoVector = 0xffff
+)
+
+// Device status bits.
+const (
+	statusAcknowledge = 1
+	statusDriver      = 2
+	statusDriverOK    = 4
+	statusFeaturesOK  = 8
+	statusFailed      = 128
+)
+
+// Feature bits.
+const (
+	featureNetMTU         = 1 << 3
+	featureNetMAC         = 1 << 5
+	featureVersion1       = 1 << 32
+	featureAccessPlatform = 1 << 33
+)
+
+// Network device configuration registers.
+const (
+	netConfigMAC = 0x00
+	netConfigMTU = 0x0a
+)
+
+// region is a range of a device region accessed through the device file.
+type region struct {
+	fd   int
+	off  int64
+	size uint64
+}
+
+func (r region) read(off uint64, b []byte) error {
+	if off+uint64(len(b)) > r.size {
+		return fmt.Errorf("access at %#x beyond end of region of size %#x", off, r.size)
+	}
+	if _, err := unix.Pread(r.fd, b, r.off+int64(off)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r region) write(off uint64, b []byte) error {
+	if off+uint64(len(b)) > r.size {
+		return fmt.Errorf("access at %#x beyond end of region of size %#x", off, r.size)
+	}
+	if _, err := unix.Pwrite(r.fd, b, r.off+int64(off)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r region) read8(off uint64) (uint8, error) {
+	var b [1]byte
+	err := r.read(off, b[:])
+	return b[0], err
+}
+
+func (r region) read16(off uint64) (uint16, error) {
+	var b [2]byte
+	err := r.read(off, b[:])
+	return binary.LittleEndian.Uint16(b[:]), err
+}
+
+func (r region) read32(off uint64) (uint32, error) {
+	var b [4]byte
+	err := r.read(off, b[:])
+	return binary.LittleEndian.Uint32(b[:]), err
+}
+
+func (r region) write8(off uint64, v uint8) error {
+	return r.write(off, []byte{v})
+}
+
+func (r region) write16(off uint64, v uint16) error {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	return r.write(off, b[:])
+}
+
+func (r region) write32(off uint64, v uint32) error {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return r.write(off, b[:])
+}
+
+// write64 writes v as two 32-bit halves, as required by the virtio
+// specification for 64-bit common configuration fields.
+func (r region) write64(off uint64, v uint64) error {
+	if err := r.write32(off, uint32(v)); err != nil {
+		return err
+	}
+	return r.write32(off+4, uint32(v>>32))
+}
+
+// virtioDevice is a virtio 1.x PCI device.
+type virtioDevice struct {
+	dev *device
+
+	// common, notify and config are the common configuration, notification
+	// and device-specific configuration structures.
+	common region
+	notify region
+	config region
+
+	// notifyMultiplier is the notify_off_multiplier of the notification
+	// capability.
+	notifyMultiplier uint32
+}
+
+// newVirtioDevice locates the virtio structures of dev and enables it to
+// access memory.
+func newVirtioDevice(dev *device) (*virtioDevice, error) {
+	off, size, err := dev.region(vfioPCIConfigRegionIndex)
+	if err != nil {
+		return nil, err
+	}
+	cfg := region{fd: dev.fd, off: int64(off), size: size}
+
+	vendor, err := cfg.read16(pciVendorID)
+	if err != nil {
+		return nil, err
+	}
+	devID, err := cfg.read16(pciDeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if vendor != pciVendorRedHat || devID != pciDeviceVirtioNet {
+		return nil, fmt.Errorf("unsupported device %04x:%04x, only virtio 1.x network devices (%04x:%04x) are supported", vendor, devID, pciVendorRedHat, pciDeviceVirtioNet)
+	}
+
+	cmd, err := cfg.read16(pciCommand)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.write16(pciCommand, cmd|pciCommandMemory|pciCommandMaster); err != nil {
+		return nil, fmt.Errorf("enabling bus mastering: %w", err)
+	}
+
+	status, err := cfg.read16(pciStatus)
+	if err != nil {
+		return nil, err
+	}
+	if status&pciStatusCapList == 0 {
+		return nil, fmt.Errorf("device has no PCI capabilities")
+	}
+
+	v := &virtioDevice{dev: dev}
+	bars := make(map[uint8]region)
+	ptr, err := cfg.read8(pciCapabilityPtr)
+	if err != nil {
+		return nil, err
+	}
+	// Bound the walk in case of a capability loop.
+	for i := 0; ptr != 0 && i < pciConfigSpaceLimit/4; i++ {
+		var c [16]byte
+		if err := cfg.read(uint64(ptr&^3), c[:]); err != nil {
+			return nil, err
+		}
+		next := c[1]
+		if c[0] != pciCapIDVendor {
+			ptr = next
+			continue
+		}
+		cfgType, barIdx := c[3], c[4]
+		capOff := uint64(binary.LittleEndian.Uint32(c[8:]))
+		capLen := uint64(binary.LittleEndian.Uint32(c[12:]))
+		var dst *region
+		switch cfgType {
+		case virtioPCICapCommonCfg:
+			dst = &v.common
+		case virtioPCICapNotifyCfg:
+			dst = &v.notify
+			if v.notify.size == 0 {
+				if v.notifyMultiplier, err = cfg.read32(uint64(ptr&^3) + 16); err != nil {
+					return nil, err
+				}
+			}
+		case virtioPCICapDeviceCfg:
+			dst = &v.config
+		}
+		// Only the first structure of each type is used.
+		if dst != nil && dst.size == 0 {
+			bar, ok := bars[barIdx]
+			if !ok {
+				barOff, barSize, err := dev.region(uint32(barIdx))
+				if err != nil {
+					return nil, err
+				}
+				bar = region{fd: dev.fd, off: int64(barOff), size: barSize}
+				bars[barIdx] = bar
+			}
+			if capOff+capLen > bar.size {
+				return nil, fmt.Errorf("virtio structure type %d at %#x+%#x is beyond end of BAR %d", cfgType, capOff, capLen, barIdx)
+			}
+			*dst = region{fd: dev.fd, off: bar.off + int64(capOff), size: capLen}
+		}
+		ptr = next
+	}
+	if v.common.size == 0 || v.notify.size == 0 || v.config.size == 0 {
+		return nil, fmt.Errorf("device lacks a virtio common, notification or device configuration structure")
+	}
+	return v, nil
+}
+
+// reset resets the device and waits for the reset to complete.
+func (v *virtioDevice) reset() error {
+	if err := v.common.write8(commonDeviceStatus, 0); err != nil {
+		return err
+	}
+	for i := 0; i < 1000; i++ {
+		status, err := v.common.read8(commonDeviceStatus)
+		if err != nil {
+			return err
+		}
+		if status == 0 {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return fmt.Errorf("timed out waiting for device reset")
+}
+
+// setStatus sets bits in the device status.
+func (v *virtioDevice) setStatus(bits uint8) error {
+	status, err := v.common.read8(commonDeviceStatus)
+	if err != nil {
+		return err
+	}
+	return v.common.write8(commonDeviceStatus, status|bits)
+}
+
+// fail marks the device as failed. Errors are ignored, as the device is no
+// longer usable anyway.
+func (v *virtioDevice) fail() {
+	_ = v.setStatus(statusFailed)
+}
+
+// negotiate acknowledges the device and negotiates features. The driver
+// accepts VIRTIO_F_VERSION_1 and those of the features in want that the
+// device offers.
+func (v *virtioDevice) negotiate(want uint64) (uint64, error) {
+	if err := v.setStatus(statusAcknowledge | statusDriver); err != nil {
+		return 0, err
+	}
+	var offered uint64
+	for sel := uint32(0); sel < 2; sel++ {
+		if err := v.common.write32(commonDeviceFeatureSelect, sel); err != nil {
+			return 0, err
+		}
+		f, err := v.common.read32(commonDeviceFeature)
+		if err != nil {
+			return 0, err
+		}
+		offered |= uint64(f) << (32 * sel)
+	}
+	if offered&featureVersion1 == 0 {
+		return 0, fmt.Errorf("device doesn't offer VIRTIO_F_VERSION_1")
+	}
+	// VIRTIO_F_ACCESS_PLATFORM must be accepted if offered, since the
+	// device is behind the IOMMU.
+	accepted := offered & (featureVersion1 | featureAccessPlatform | want)
+	for sel := uint32(0); sel < 2; sel++ {
+		if err := v.common.write32(commonDriverFeatureSelect, sel); err != nil {
+			return 0, err
+		}
+		if err := v.common.write32(commonDriverFeature, uint32(accepted>>(32*sel))); err != nil {
+			return 0, err
+		}
+	}
+	if err := v.setStatus(statusFeaturesOK); err != nil {
+		return 0, err
+	}
+	status, err := v.common.read8(commonDeviceStatus)
+	if err != nil {
+		return 0, err
+	}
+	if status&statusFeaturesOK == 0 {
+		return 0, fmt.Errorf("device rejected features %#x", accepted)
+	}
+	return accepted, nil
+}
+
+// numQueues returns the number of virtqueues of the device.
+func (v *virtioDevice) numQueues() (uint16, error) {
+	return v.common.read16(commonNumQueues)
+}
+
+// maxQueueSize returns the maximum size of virtqueue idx.
+func (v *virtioDevice) maxQueueSize(idx uint16) (uint16, error) {
+	if err := v.common.write16(commonQueueSelect, idx); err != nil {
+		return 0, err
+	}
+	return v.common.read16(commonQueueSize)
+}
+
+// notifier identifies the location and value written to notify the device of
+// new available buffers in a virtqueue.
+type notifier struct {
+	off uint64
+	idx uint16
+}
+
+// setupQueue configures virtqueue idx to use q, raising MSI-X vector msix
+// when buffers are used, and enables it.
+func (v *virtioDevice) setupQueue(idx uint16, q *virtqueue.Queue, msix uint16) (notifier, error) {
+	if err := v.common.write16(commonQueueSelect, idx); err != nil {
+		return notifier{}, err
+	}
+	if err := v.common.write16(commonQueueSize, q.Size()); err != nil {
+		return notifier{}, err
+	}
+	if err := v.common.write16(commonQueueMSIXVector, msix); err != nil {
+		return notifier{}, err
+	}
+	if msix != virtioMSINoVector {
+		// The device returns NO_VECTOR if it failed to allocate the
+		// vector.
+		got, err := v.common.read16(commonQueueMSIXVector)
+		if err != nil {
+			return notifier{}, err
+		}
+		if got != msix {
+			return notifier{}, fmt.Errorf("device failed to assign MSI-X vector %d to queue %d", msix, idx)
+		}
+	}
+	notifyOff, err := v.common.read16(commonQueueNotifyOff)
+	if err != nil {
+		return notifier{}, err
+	}
+	desc, avail, used := q.Addrs()
+	for _, r := range []struct {
+		reg  uint64
+		iova uint64
+	}{
+		{commonQueueDesc, desc},
+		{commonQueueDriver, avail},
+		{commonQueueDevice, used},
+	} {
+		if err := v.common.write64(r.reg, r.iova); err != nil {
+			return notifier{}, err
+		}
+	}
+	if err := v.common.write16(commonQueueEnable, 1); err != nil {
+		return notifier{}, err
+	}
+	return notifier{off: uint64(notifyOff) * uint64(v.notifyMultiplier), idx: idx}, nil
+}
+
+// kick notifies the device that buffers are available in the virtqueue of n.
+func (v *virtioDevice) kick(n notifier) error {
+	return v.notify.write16(n.off, n.idx)
+}
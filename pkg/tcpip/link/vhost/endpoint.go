@@ -0,0 +1,476 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package vhost
+
+import (
+	"fmt"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/buffer"
+	"github.com/talismancer/gvisor-ligolo/pkg/eventfd"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/rawfile"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/stopfd"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/virtqueue"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// DefaultMTU is the MTU used if none is given.
+	DefaultMTU = 1500
+
+	// queueSize is the number of entries of each virtqueue.
+	queueSize = 256
+
+	// bufferSize is the size of each packet buffer. It limits the MTU.
+	bufferSize = 2048
+
+	// maxMTU is the largest MTU that fits in a packet buffer.
+	maxMTU = bufferSize - virtqueue.NetHdrSize - header.EthernetMinimumSize
+
+	// rxQueue and txQueue are the indices of the receive and transmit
+	// virtqueues.
+	rxQueue = 0
+	txQueue = 1
+)
+
+var _ stack.LinkEndpoint = (*endpoint)(nil)
+
+type endpoint struct {
+	// dev is the vhost-net device.
+	dev device
+
+	// addr is the address of the endpoint.
+	addr tcpip.LinkAddress
+
+	// mtu is the MTU of the endpoint.
+	mtu uint32
+
+	// caps holds the endpoint capabilities.
+	caps stack.LinkEndpointCapabilities
+
+	// closed is a function to be called when the device fails.
+	closed func(tcpip.Error)
+
+	// mem holds the virtqueues and packet buffers.
+	mem []byte
+
+	// rx and tx are the receive and transmit virtqueues.
+	rx *virtqueue.Queue
+	tx *virtqueue.Queue
+
+	// rxBufs and txBufs are the packet buffers of the queues. Buffer i is
+	// used by descriptor i of the queue.
+	rxBufs []byte
+	txBufs []byte
+
+	// rxKick and txKick notify the device of new available buffers.
+	rxKick eventfd.Eventfd
+	txKick eventfd.Eventfd
+
+	// rxCall is signaled by the device when it used receive buffers.
+	rxCall eventfd.Eventfd
+
+	mu sync.RWMutex
+	// +checklocks:mu
+	networkDispatcher stack.NetworkDispatcher
+
+	// wg keeps track of running goroutines.
+	wg sync.WaitGroup
+
+	// stopFD is used to stop the dispatch loop.
+	stopFD stopfd.StopFD
+
+	// txMu serializes access to the transmit queue.
+	txMu sync.Mutex
+
+	// txFree are the transmit descriptors not in use by the device.
+	//
+	// +checklocks:txMu
+	txFree []uint16
+}
+
+// Options specify the details about the vhost-net endpoint to be created.
+type Options struct {
+	// VhostFD is an open /dev/vhost-net file that isn't owned by any
+	// process yet.
+	VhostFD int
+
+	// BackendFD is the socket packets are sent and received through. It
+	// must be a raw AF_PACKET socket bound to an interface, without
+	// PACKET_VNET_HDR, or a tap device.
+	BackendFD int
+
+	// ClosedFunc is a function to be called when the device fails.
+	ClosedFunc func(tcpip.Error)
+
+	// Address is the link address for this endpoint.
+	Address tcpip.LinkAddress
+
+	// MTU is the MTU of the endpoint. If zero, DefaultMTU is used.
+	MTU uint32
+}
+
+// New creates a new endpoint backed by vhost-net. The calling process becomes
+// the owner of the vhost-net device.
+func New(opts *Options) (stack.LinkEndpoint, error) {
+	ep := &endpoint{
+		dev:    device{fd: opts.VhostFD},
+		addr:   opts.Address,
+		mtu:    opts.MTU,
+		caps:   stack.CapabilityResolutionRequired,
+		closed: opts.ClosedFunc,
+	}
+	if ep.mtu == 0 {
+		ep.mtu = DefaultMTU
+	}
+	if ep.mtu > maxMTU {
+		return nil, fmt.Errorf("MTU %d is larger than the maximum of %d", ep.mtu, maxMTU)
+	}
+
+	if err := ep.dev.setOwner(); err != nil {
+		return nil, err
+	}
+	offered, err := ep.dev.getFeatures()
+	if err != nil {
+		return nil, err
+	}
+	const want = featureVersion1 | featureNetVirtioNetHdr
+	if offered&want != want {
+		return nil, fmt.Errorf("vhost-net offers features %#x, want %#x", offered, uint64(want))
+	}
+	if err := ep.dev.setFeatures(want); err != nil {
+		return nil, err
+	}
+
+	// Lay out the memory: both virtqueues, followed by the buffers.
+	queueLen := virtqueue.MemorySize(queueSize)
+	bufsLen := queueSize * bufferSize
+	ep.mem, err = unix.Mmap(-1, 0, 2*(queueLen+bufsLen), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, fmt.Errorf("allocating virtqueue memory: %w", err)
+	}
+	success := false
+	defer func() {
+		if !success {
+			ep.release()
+		}
+	}()
+	if err := ep.dev.setMemTable(ep.mem); err != nil {
+		return nil, err
+	}
+	// The device uses sentry addresses.
+	base := uint64(sliceAddr(ep.mem))
+	off := 0
+	ep.rx = virtqueue.New(queueSize, ep.mem[off:], base+uint64(off))
+	off += queueLen
+	ep.tx = virtqueue.New(queueSize, ep.mem[off:], base+uint64(off))
+	off += queueLen
+	ep.rxBufs = ep.mem[off : off+bufsLen]
+	off += bufsLen
+	ep.txBufs = ep.mem[off : off+bufsLen]
+
+	for _, efd := range []*eventfd.Eventfd{&ep.rxKick, &ep.txKick, &ep.rxCall} {
+		if *efd, err = eventfd.Create(); err != nil {
+			return nil, err
+		}
+	}
+	// Transmitted buffers are reclaimed lazily in WritePackets, so the
+	// transmit queue doesn't need to be signaled.
+	ep.tx.SetNoInterrupt()
+	for _, q := range []struct {
+		idx  uint16
+		q    *virtqueue.Queue
+		kick int
+		call int
+	}{
+		{rxQueue, ep.rx, ep.rxKick.FD(), ep.rxCall.FD()},
+		{txQueue, ep.tx, ep.txKick.FD(), -1},
+	} {
+		desc, avail, used := q.q.Addrs()
+		if err := ep.dev.setVring(q.idx, q.q.Size(), desc, avail, used, q.kick, q.call); err != nil {
+			return nil, err
+		}
+	}
+	if ep.stopFD, err = stopfd.New(); err != nil {
+		return nil, err
+	}
+
+	// Give all receive buffers to the device.
+	for id := uint16(0); id < ep.rx.Size(); id++ {
+		ep.rx.SetDesc(id, ep.bufAddr(ep.rxBufs, id), bufferSize, virtqueue.DescFlagWrite)
+		ep.rx.Push(id)
+	}
+	ep.rx.Publish()
+	ep.txMu.Lock()
+	for id := uint16(0); id < ep.tx.Size(); id++ {
+		ep.txFree = append(ep.txFree, id)
+	}
+	ep.txMu.Unlock()
+
+	for _, idx := range []uint16{rxQueue, txQueue} {
+		if err := ep.dev.setBackend(idx, opts.BackendFD); err != nil {
+			return nil, err
+		}
+	}
+	if err := ep.rxKick.Notify(); err != nil {
+		return nil, err
+	}
+	success = true
+	return ep, nil
+}
+
+// release releases the resources of a partially initialized endpoint. The
+// vhost-net device is left unusable, since it can't be reset.
+func (ep *endpoint) release() {
+	for _, idx := range []uint16{rxQueue, txQueue} {
+		ep.dev.setBackend(idx, -1)
+	}
+	for _, efd := range []eventfd.Eventfd{ep.rxKick, ep.txKick, ep.rxCall} {
+		if efd.FD() > 0 {
+			efd.Close()
+		}
+	}
+	if ep.stopFD.EFD > 0 {
+		unix.Close(ep.stopFD.EFD)
+	}
+	unix.Munmap(ep.mem)
+}
+
+// bufAddr returns the device address of buffer id in bufs.
+func (ep *endpoint) bufAddr(bufs []byte, id uint16) uint64 {
+	return uint64(sliceAddr(bufs)) + uint64(id)*bufferSize
+}
+
+// Attach launches the goroutine that receives packets from the device and
+// dispatches them via the provided dispatcher. If one is already attached,
+// then nothing happens.
+//
+// Attach implements stack.LinkEndpoint.Attach.
+func (ep *endpoint) Attach(networkDispatcher stack.NetworkDispatcher) {
+	ep.mu.Lock()
+	defer ep.mu.Unlock()
+	// nil means the NIC is being removed.
+	if networkDispatcher == nil && ep.networkDispatcher != nil {
+		ep.stopFD.Stop()
+		ep.Wait()
+		ep.networkDispatcher = nil
+		return
+	}
+	if networkDispatcher != nil && ep.networkDispatcher == nil {
+		ep.networkDispatcher = networkDispatcher
+		// Link endpoints are not savable. When transportation endpoints are
+		// saved, they stop sending outgoing packets and all incoming packets
+		// are rejected.
+		ep.wg.Add(1)
+		go func() { // S/R-SAFE: See above.
+			defer ep.wg.Done()
+			for {
+				cont, err := ep.dispatch()
+				if err != nil || !cont {
+					if ep.closed != nil {
+						ep.closed(err)
+					}
+					return
+				}
+			}
+		}()
+	}
+}
+
+// IsAttached implements stack.LinkEndpoint.IsAttached.
+func (ep *endpoint) IsAttached() bool {
+	ep.mu.RLock()
+	defer ep.mu.RUnlock()
+	return ep.networkDispatcher != nil
+}
+
+// MTU implements stack.LinkEndpoint.MTU.
+func (ep *endpoint) MTU() uint32 {
+	return ep.mtu
+}
+
+// Capabilities implements stack.LinkEndpoint.Capabilities.
+func (ep *endpoint) Capabilities() stack.LinkEndpointCapabilities {
+	return ep.caps
+}
+
+// MaxHeaderLength returns the maximum size of the link-layer header.
+func (ep *endpoint) MaxHeaderLength() uint16 {
+	return uint16(header.EthernetMinimumSize)
+}
+
+// LinkAddress returns the link address of this endpoint.
+func (ep *endpoint) LinkAddress() tcpip.LinkAddress {
+	return ep.addr
+}
+
+// Wait implements stack.LinkEndpoint.Wait. It waits for the endpoint to stop
+// receiving packets.
+func (ep *endpoint) Wait() {
+	ep.wg.Wait()
+}
+
+// AddHeader implements stack.LinkEndpoint.AddHeader.
+func (ep *endpoint) AddHeader(pkt stack.PacketBufferPtr) {
+	eth := header.Ethernet(pkt.LinkHeader().Push(header.EthernetMinimumSize))
+	eth.Encode(&header.EthernetFields{
+		SrcAddr: pkt.EgressRoute.LocalLinkAddress,
+		DstAddr: pkt.EgressRoute.RemoteLinkAddress,
+		Type:    pkt.NetworkProtocolNumber,
+	})
+}
+
+// ParseHeader implements stack.LinkEndpoint.ParseHeader.
+func (ep *endpoint) ParseHeader(pkt stack.PacketBufferPtr) bool {
+	_, ok := pkt.LinkHeader().Consume(header.EthernetMinimumSize)
+	return ok
+}
+
+// ARPHardwareType implements stack.LinkEndpoint.ARPHardwareType.
+func (ep *endpoint) ARPHardwareType() header.ARPHardwareType {
+	return header.ARPHardwareEther
+}
+
+// WritePackets copies outbound packets to transmit buffers and passes them to
+// vhost-net. Packets that don't fit in the transmit queue aren't written.
+//
+// Each packet in pkts should have the following fields populated:
+//   - pkt.EgressRoute
+//   - pkt.NetworkProtocolNumber
+//
+// The following should not be populated, as GSO is not supported.
+//   - pkt.GSOOptions
+func (ep *endpoint) WritePackets(pkts stack.PacketBufferList) (int, tcpip.Error) {
+	ep.txMu.Lock()
+	defer ep.txMu.Unlock()
+
+	// Reclaim buffers transmitted by the device.
+	for {
+		id, _, ok := ep.tx.Pop()
+		if !ok {
+			break
+		}
+		ep.txFree = append(ep.txFree, id)
+	}
+
+	written := 0
+	for _, pkt := range pkts.AsSlice() {
+		if len(ep.txFree) == 0 {
+			break
+		}
+		if size := pkt.Size(); size > bufferSize-virtqueue.NetHdrSize {
+			return written, &tcpip.ErrMessageTooLong{}
+		}
+		id := ep.txFree[len(ep.txFree)-1]
+		ep.txFree = ep.txFree[:len(ep.txFree)-1]
+
+		buf := ep.txBufs[int(id)*bufferSize : (int(id)+1)*bufferSize]
+		// No offloads are negotiated, so the header is all zeroes.
+		for i := range buf[:virtqueue.NetHdrSize] {
+			buf[i] = 0
+		}
+		n := virtqueue.NetHdrSize
+		for _, b := range pkt.AsSlices() {
+			n += copy(buf[n:], b)
+		}
+		ep.tx.SetDesc(id, ep.bufAddr(ep.txBufs, id), uint32(n), 0)
+		ep.tx.Push(id)
+		written++
+	}
+	if written == 0 {
+		return 0, &tcpip.ErrNoBufferSpace{}
+	}
+	ep.tx.Publish()
+	if ep.tx.NeedsKick() {
+		if err := ep.txKick.Notify(); err != nil {
+			return written, &tcpip.ErrClosedForSend{}
+		}
+	}
+	return written, nil
+}
+
+// dispatch waits for the device to use receive buffers and delivers the
+// packets in them.
+func (ep *endpoint) dispatch() (bool, tcpip.Error) {
+	for {
+		stopped, errno := rawfile.BlockingPollUntilStopped(ep.stopFD.EFD, ep.rxCall.FD(), unix.POLLIN|unix.POLLERR)
+		if errno != 0 {
+			if errno == unix.EINTR {
+				continue
+			}
+			return !stopped, rawfile.TranslateErrno(errno)
+		}
+		if stopped {
+			return true, nil
+		}
+		break
+	}
+	// Clear the signal before looking at the used ring, so that buffers used
+	// afterwards raise a new one.
+	var tmp [8]byte
+	if _, err := unix.Read(ep.rxCall.FD(), tmp[:]); err != nil && err != unix.EAGAIN {
+		return false, rawfile.TranslateErrno(err.(unix.Errno))
+	}
+
+	var views []*buffer.View
+	reposted := 0
+	for {
+		id, n, ok := ep.rx.Pop()
+		if !ok {
+			break
+		}
+		if id >= ep.rx.Size() {
+			return false, &tcpip.ErrInvalidEndpointState{}
+		}
+		if n >= virtqueue.NetHdrSize+header.EthernetMinimumSize && n <= bufferSize {
+			buf := ep.rxBufs[int(id)*bufferSize:]
+			views = append(views, buffer.NewViewWithData(buf[virtqueue.NetHdrSize:n]))
+		}
+		// The data was copied, so the buffer can be reused right away.
+		ep.rx.Push(id)
+		reposted++
+	}
+	if reposted == 0 {
+		return true, nil
+	}
+	ep.rx.Publish()
+	if ep.rx.NeedsKick() {
+		if err := ep.rxKick.Notify(); err != nil {
+			return false, &tcpip.ErrClosedForReceive{}
+		}
+	}
+
+	ep.mu.RLock()
+	d := ep.networkDispatcher
+	ep.mu.RUnlock()
+	for _, view := range views {
+		pkt := stack.NewPacketBuffer(stack.PacketBufferOptions{
+			Payload: buffer.MakeWithView(view),
+		})
+		if !ep.ParseHeader(pkt) {
+			pkt.DecRef()
+			continue
+		}
+		d.DeliverNetworkPacket(header.Ethernet(view.AsSlice()).Type(), pkt)
+		pkt.DecRef()
+	}
+	return true, nil
+}
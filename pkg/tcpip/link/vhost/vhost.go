@@ -0,0 +1,170 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+// Package vhost provides link layer endpoints that exchange packets with the
+// host through the vhost-net kernel driver.
+//
+// The endpoint acts as the driver of a virtio network device implemented by
+// vhost-net: packets are placed in virtqueues in sentry memory and moved
+// to and from a host socket by the kernel, without a system call per packet.
+package vhost
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// Ioctls from include/uapi/linux/vhost.h.
+const (
+	vhostGetFeatures   = 0x8008af00
+	vhostSetFeatures   = 0x4008af00
+	vhostSetOwner      = 0xaf01
+	vhostSetMemTable   = 0x4008af03
+	vhostSetVringNum   = 0x4008af10
+	vhostSetVringAddr  = 0x4028af11
+	vhostSetVringBase  = 0x4008af12
+	vhostSetVringKick  = 0x4008af20
+	vhostSetVringCall  = 0x4008af21
+	vhostNetSetBackend = 0x4008af30
+)
+
+// Feature bits.
+const (
+	// featureNetVirtioNetHdr makes vhost-net add and strip the virtio
+	// network header, which is required for backends that don't handle it
+	// themselves, like raw packet sockets.
+	featureNetVirtioNetHdr = 1 << 27
+	featureVersion1        = 1 << 32
+)
+
+// vringState is struct vhost_vring_state.
+type vringState struct {
+	index uint32
+	num   uint32
+}
+
+// vringFile is struct vhost_vring_file.
+type vringFile struct {
+	index uint32
+	fd    int32
+}
+
+// vringAddr is struct vhost_vring_addr.
+type vringAddr struct {
+	index         uint32
+	flags         uint32
+	descUserAddr  uint64
+	usedUserAddr  uint64
+	availUserAddr uint64
+	logGuestAddr  uint64
+}
+
+// memory is struct vhost_memory with a single struct vhost_memory_region.
+type memory struct {
+	nregions      uint32
+	padding       uint32
+	guestPhysAddr uint64
+	memorySize    uint64
+	userspaceAddr uint64
+	flagsPadding  uint64
+}
+
+// device wraps a vhost-net file descriptor.
+type device struct {
+	fd int
+}
+
+func (d *device) setOwner() error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(d.fd), vhostSetOwner, 0); errno != 0 {
+		return fmt.Errorf("VHOST_SET_OWNER: %w", errno)
+	}
+	return nil
+}
+
+func (d *device) getFeatures() (uint64, error) {
+	var features uint64
+	if err := ioctl(d.fd, vhostGetFeatures, &features); err != nil {
+		return 0, fmt.Errorf("VHOST_GET_FEATURES: %w", err)
+	}
+	return features, nil
+}
+
+func (d *device) setFeatures(features uint64) error {
+	if err := ioctl(d.fd, vhostSetFeatures, &features); err != nil {
+		return fmt.Errorf("VHOST_SET_FEATURES(%#x): %w", features, err)
+	}
+	return nil
+}
+
+// setMemTable makes mem accessible to the device. Addresses used by the
+// device are the same as the addresses of the sentry.
+func (d *device) setMemTable(mem []byte) error {
+	addr := uint64(sliceAddr(mem))
+	m := memory{
+		nregions:      1,
+		guestPhysAddr: addr,
+		memorySize:    uint64(len(mem)),
+		userspaceAddr: addr,
+	}
+	if err := ioctl(d.fd, vhostSetMemTable, &m); err != nil {
+		return fmt.Errorf("VHOST_SET_MEM_TABLE: %w", err)
+	}
+	return nil
+}
+
+// setVring configures virtqueue idx. The device is notified of new available
+// buffers through kick, and signals used buffers through call if call isn't
+// negative.
+func (d *device) setVring(idx, size uint16, desc, avail, used uint64, kick, call int) error {
+	num := vringState{index: uint32(idx), num: uint32(size)}
+	if err := ioctl(d.fd, vhostSetVringNum, &num); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_NUM: %w", err)
+	}
+	base := vringState{index: uint32(idx)}
+	if err := ioctl(d.fd, vhostSetVringBase, &base); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_BASE: %w", err)
+	}
+	addr := vringAddr{
+		index:         uint32(idx),
+		descUserAddr:  desc,
+		usedUserAddr:  used,
+		availUserAddr: avail,
+	}
+	if err := ioctl(d.fd, vhostSetVringAddr, &addr); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_ADDR: %w", err)
+	}
+	kickFile := vringFile{index: uint32(idx), fd: int32(kick)}
+	if err := ioctl(d.fd, vhostSetVringKick, &kickFile); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_KICK: %w", err)
+	}
+	callFile := vringFile{index: uint32(idx), fd: int32(call)}
+	if err := ioctl(d.fd, vhostSetVringCall, &callFile); err != nil {
+		return fmt.Errorf("VHOST_SET_VRING_CALL: %w", err)
+	}
+	return nil
+}
+
+// setBackend makes virtqueue idx send or receive packets through the socket
+// backend. A negative backend detaches the current one.
+func (d *device) setBackend(idx uint16, backend int) error {
+	f := vringFile{index: uint32(idx), fd: int32(backend)}
+	if err := ioctl(d.fd, vhostNetSetBackend, &f); err != nil {
+		return fmt.Errorf("VHOST_NET_SET_BACKEND: %w", err)
+	}
+	return nil
+}
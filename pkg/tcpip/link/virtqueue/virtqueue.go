@@ -0,0 +1,164 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+// Package virtqueue implements the driver side of split virtqueues, as
+// described by the virtio 1.x specification, and the virtio network packet
+// header.
+package virtqueue
+
+import (
+	"encoding/binary"
+
+	"golang.org/x/sys/unix"
+)
+
+// Descriptor flags.
+const (
+	DescFlagNext  = 1
+	DescFlagWrite = 2
+)
+
+// NetHdrSize is the size of struct virtio_net_hdr_v1, which precedes every
+// packet exchanged with a virtio network device once VIRTIO_F_VERSION_1 is
+// negotiated.
+const NetHdrSize = 12
+
+// Split virtqueue layout.
+const (
+	descSize = 16
+
+	availFlagNoInterrupt = 1
+	usedFlagNoNotify     = 1
+
+	// ringHeaderSize is the size of the flags and idx fields that start
+	// the available and used rings.
+	ringHeaderSize = 4
+	usedElemSize   = 8
+)
+
+// Queue is a split virtqueue in memory shared with a device. The driver owns
+// the descriptor table and available ring; the device owns the used ring.
+//
+// Queue is not thread-safe.
+type Queue struct {
+	size uint16
+
+	desc  []byte
+	avail []byte
+	used  []byte
+
+	// descAddr, availAddr and usedAddr are the addresses of the descriptor
+	// table and rings in the device's address space.
+	descAddr  uint64
+	availAddr uint64
+	usedAddr  uint64
+
+	// availIdx is the next index in the available ring.
+	availIdx uint16
+
+	// availFlags are the flags of the available ring.
+	availFlags uint16
+
+	// usedIdx is the next index in the used ring to consume.
+	usedIdx uint16
+}
+
+// MemorySize returns the size of memory needed by a queue with size entries,
+// with the descriptor table and each ring page aligned.
+func MemorySize(size uint16) int {
+	return pageRoundUp(descSize*int(size)) +
+		pageRoundUp(ringHeaderSize+2*int(size)+2) +
+		pageRoundUp(ringHeaderSize+usedElemSize*int(size)+2)
+}
+
+// New lays out a queue of size entries in mem, which the device accesses at
+// address addr.
+//
+// Preconditions:
+//   - len(mem) >= MemorySize(size).
+//   - mem is zeroed and page aligned.
+func New(size uint16, mem []byte, addr uint64) *Queue {
+	q := &Queue{size: size}
+	off := 0
+	q.desc, q.descAddr = mem[off:off+descSize*int(size)], addr+uint64(off)
+	off += pageRoundUp(descSize * int(size))
+	q.avail, q.availAddr = mem[off:off+ringHeaderSize+2*int(size)+2], addr+uint64(off)
+	off += pageRoundUp(ringHeaderSize + 2*int(size) + 2)
+	q.used, q.usedAddr = mem[off:off+ringHeaderSize+usedElemSize*int(size)+2], addr+uint64(off)
+	return q
+}
+
+// Size returns the number of entries of q.
+func (q *Queue) Size() uint16 {
+	return q.size
+}
+
+// Addrs returns the addresses of the descriptor table, available ring and
+// used ring in the device's address space.
+func (q *Queue) Addrs() (desc, avail, used uint64) {
+	return q.descAddr, q.availAddr, q.usedAddr
+}
+
+// SetDesc fills in descriptor id.
+func (q *Queue) SetDesc(id uint16, addr uint64, length uint32, flags uint16) {
+	d := q.desc[int(id)*descSize:]
+	binary.LittleEndian.PutUint64(d[0:], addr)
+	binary.LittleEndian.PutUint32(d[8:], length)
+	binary.LittleEndian.PutUint16(d[12:], flags)
+	binary.LittleEndian.PutUint16(d[14:], 0)
+}
+
+// Push adds descriptor id to the available ring. It isn't visible to the
+// device until Publish is called.
+func (q *Queue) Push(id uint16) {
+	binary.LittleEndian.PutUint16(q.avail[ringHeaderSize+2*int(q.availIdx%q.size):], id)
+	q.availIdx++
+}
+
+// Publish makes descriptors pushed to the available ring visible to the
+// device.
+func (q *Queue) Publish() {
+	storeUint32(q.avail, 0, uint32(q.availIdx)<<16|uint32(q.availFlags))
+}
+
+// SetNoInterrupt asks the device not to signal used buffers.
+func (q *Queue) SetNoInterrupt() {
+	q.availFlags |= availFlagNoInterrupt
+	q.Publish()
+}
+
+// NeedsKick returns true if the device wants to be notified of new available
+// buffers.
+func (q *Queue) NeedsKick() bool {
+	return loadUint32(q.used, 0)&usedFlagNoNotify == 0
+}
+
+// Pop returns the next descriptor chain used by the device and the number of
+// bytes it wrote to it, if any.
+func (q *Queue) Pop() (id uint16, length uint32, ok bool) {
+	devIdx := uint16(loadUint32(q.used, 0) >> 16)
+	if devIdx == q.usedIdx {
+		return 0, 0, false
+	}
+	e := q.used[ringHeaderSize+usedElemSize*int(q.usedIdx%q.size):]
+	q.usedIdx++
+	return uint16(binary.LittleEndian.Uint32(e[0:])), binary.LittleEndian.Uint32(e[4:]), true
+}
+
+func pageRoundUp(n int) int {
+	return (n + unix.Getpagesize() - 1) &^ (unix.Getpagesize() - 1)
+}
@@ -0,0 +1,39 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux
+// +build linux
+
+package virtqueue
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// loadUint32 atomically loads the little endian 32-bit word at b[off:].
+// Rings are shared with the device, and the atomic accesses order accesses
+// to ring entries with respect to the ring indices.
+//
+// Preconditions: off is a multiple of 4.
+func loadUint32(b []byte, off int) uint32 {
+	return atomic.LoadUint32((*uint32)(unsafe.Pointer(&b[off])))
+}
+
+// storeUint32 atomically stores v as a little endian 32-bit word at b[off:].
+//
+// Preconditions: off is a multiple of 4.
+func storeUint32(b []byte, off int, v uint32) {
+	atomic.StoreUint32((*uint32)(unsafe.Pointer(&b[off])), v)
+}
@@ -560,6 +560,20 @@ func (g *GenericMulticastProtocolState) JoinGroupLocked(groupAddress tcpip.Addre
 	g.memberships[groupAddress] = info
 }
 
+// JoinedGroupsRLocked returns the locally joined groups and the number of
+// times each group has been joined.
+//
+// Precondition: g.protocolMU must be read locked.
+func (g *GenericMulticastProtocolState) JoinedGroupsRLocked() map[tcpip.Address]uint64 {
+	groups := make(map[tcpip.Address]uint64)
+	for groupAddress, info := range g.memberships {
+		if !info.deleteScheduled {
+			groups[groupAddress] = info.joins
+		}
+	}
+	return groups
+}
+
 // IsLocallyJoinedRLocked returns true if the group is locally joined.
 //
 // Precondition: g.protocolMU must be read locked.
@@ -557,6 +557,14 @@ func (igmp *igmpState) joinGroup(groupAddress tcpip.Address) {
 	igmp.genericMulticastProtocol.JoinGroupLocked(groupAddress)
 }
 
+// joinedGroups returns the locally joined groups and the number of times each
+// group has been joined.
+//
+// +checklocksread:igmp.ep.mu
+func (igmp *igmpState) joinedGroups() map[tcpip.Address]uint64 {
+	return igmp.genericMulticastProtocol.JoinedGroupsRLocked()
+}
+
 // isInGroup returns true if the specified group has been joined locally.
 //
 // +checklocksread:igmp.ep.mu
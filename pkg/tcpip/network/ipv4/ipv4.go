@@ -1483,6 +1483,13 @@ func (e *endpoint) IsInGroup(addr tcpip.Address) bool {
 	return e.igmp.isInGroup(addr) // +checklocksforce: e.mu==e.igmp.ep.mu.
 }
 
+// JoinedGroups implements stack.GroupAddressableEndpoint.
+func (e *endpoint) JoinedGroups() map[tcpip.Address]uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.igmp.joinedGroups() // +checklocksforce: e.mu==e.igmp.ep.mu.
+}
+
 // Stats implements stack.NetworkEndpoint.
 func (e *endpoint) Stats() stack.NetworkEndpointStats {
 	return &e.stats.localStats
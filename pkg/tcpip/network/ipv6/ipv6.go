@@ -2258,6 +2258,13 @@ func (e *endpoint) IsInGroup(addr tcpip.Address) bool {
 	return e.mu.mld.isInGroup(addr)
 }
 
+// JoinedGroups implements stack.GroupAddressableEndpoint.
+func (e *endpoint) JoinedGroups() map[tcpip.Address]uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.mu.mld.joinedGroups()
+}
+
 // Stats implements stack.NetworkEndpoint.
 func (e *endpoint) Stats() stack.NetworkEndpointStats {
 	return &e.stats.localStats
@@ -279,6 +279,14 @@ func (mld *mldState) joinGroup(groupAddress tcpip.Address) {
 	mld.genericMulticastProtocol.JoinGroupLocked(groupAddress)
 }
 
+// joinedGroups returns the locally joined groups and the number of times each
+// group has been joined.
+//
+// Precondition: mld.ep.mu must be read locked.
+func (mld *mldState) joinedGroups() map[tcpip.Address]uint64 {
+	return mld.genericMulticastProtocol.JoinedGroupsRLocked()
+}
+
 // isInGroup returns true if the specified group has been joined locally.
 //
 // Precondition: mld.ep.mu must be read locked.
@@ -712,6 +712,24 @@ func (n *nic) isInGroup(addr tcpip.Address) bool {
 	return false
 }
 
+// joinedGroups returns the multicast groups joined by n and the number of
+// times each group has been joined.
+func (n *nic) joinedGroups() map[tcpip.Address]uint64 {
+	groups := make(map[tcpip.Address]uint64)
+	for _, ep := range n.networkEndpoints {
+		gep, ok := ep.(GroupAddressableEndpoint)
+		if !ok {
+			continue
+		}
+
+		for addr, joins := range gep.JoinedGroups() {
+			groups[addr] += joins
+		}
+	}
+
+	return groups
+}
+
 // DeliverNetworkPacket finds the appropriate network protocol endpoint and
 // hands the packet over for further processing. This function is called when
 // the NIC receives a packet from the link endpoint.
@@ -57,6 +57,14 @@ type ResumableEndpoint interface {
 	Resume(*Stack)
 }
 
+// SavedEndpoint is an endpoint that stops processing packets while it's being
+// saved.
+type SavedEndpoint interface {
+	// Thaw lets the endpoint process packets again. It's called if the stack
+	// keeps running after the save.
+	Thaw()
+}
+
 // uniqueIDGenerator is a default unique ID generator.
 type uniqueIDGenerator atomicbitops.Uint64
 
@@ -119,6 +127,14 @@ type Stack struct {
 	// stack is being restored.
 	resumableEndpoints []ResumableEndpoint
 
+	// savedEndpoints is a list of endpoints that have been saved and need to
+	// be thawed when the stack is resumed.
+	savedEndpoints []SavedEndpoint
+
+	// saveResumes indicates that the stack keeps running after the save in
+	// progress, if any.
+	saveResumes bool
+
 	// icmpRateLimiter is a global rate limiter for all ICMP messages generated
 	// by the stack.
 	icmpRateLimiter *ICMPRateLimiter
@@ -538,6 +554,15 @@ func (s *Stack) NICForwarding(id tcpip.NICID, protocol tcpip.NetworkProtocolNumb
 	return nic.forwarding(protocol)
 }
 
+// ForwardingDefault returns the default packet forwarding setting of newly
+// created NICs for the passed protocol.
+func (s *Stack) ForwardingDefault(protocol tcpip.NetworkProtocolNumber) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.defaultForwardingEnabled[protocol]
+	return ok
+}
+
 // SetForwardingDefaultAndAllNICs sets packet forwarding for all NICs for the
 // passed protocol and sets the default setting for newly created NICs.
 func (s *Stack) SetForwardingDefaultAndAllNICs(protocol tcpip.NetworkProtocolNumber, enable bool) tcpip.Error {
@@ -1685,6 +1710,22 @@ func (s *Stack) RegisterRestoredEndpoint(e ResumableEndpoint) {
 	s.mu.Unlock()
 }
 
+// RegisterSavedEndpoint records e as an endpoint that has been saved from this
+// stack.
+func (s *Stack) RegisterSavedEndpoint(e SavedEndpoint) {
+	s.mu.Lock()
+	s.savedEndpoints = append(s.savedEndpoints, e)
+	s.mu.Unlock()
+}
+
+// SaveResumes returns true if the stack keeps running after the save in
+// progress. Connections then don't need to be torn down by the save.
+func (s *Stack) SaveResumes() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.saveResumes
+}
+
 // RegisteredEndpoints returns all endpoints which are currently registered.
 func (s *Stack) RegisteredEndpoints() []TransportEndpoint {
 	s.mu.Lock()
@@ -1770,25 +1811,35 @@ func (s *Stack) Destroy() {
 	s.Wait()
 }
 
-// Pause pauses any protocol level background workers.
-func (s *Stack) Pause() {
+// Pause pauses any protocol level background workers before save. If resume
+// is true, the stack keeps running after the save.
+func (s *Stack) Pause(resume bool) {
+	s.mu.Lock()
+	s.saveResumes = resume
+	s.mu.Unlock()
 	for _, p := range s.transportProtocols {
 		p.proto.Pause()
 	}
 }
 
-// Resume restarts the stack after a restore. This must be called after the
-// entire system has been restored.
+// Resume restarts the stack after a save or a restore. After restore, this
+// must be called after the entire system has been restored.
 func (s *Stack) Resume() {
 	// ResumableEndpoint.Resume() may call other methods on s, so we can't hold
 	// s.mu while resuming the endpoints.
 	s.mu.Lock()
 	eps := s.resumableEndpoints
 	s.resumableEndpoints = nil
+	saved := s.savedEndpoints
+	s.savedEndpoints = nil
+	s.saveResumes = false
 	s.mu.Unlock()
 	for _, e := range eps {
 		e.Resume(s)
 	}
+	for _, e := range saved {
+		e.Thaw()
+	}
 	// Now resume any protocol level background workers.
 	for _, p := range s.transportProtocols {
 		p.proto.Resume()
@@ -1979,6 +2030,18 @@ func (s *Stack) IsInGroup(nicID tcpip.NICID, multicastAddr tcpip.Address) (bool,
 	return false, &tcpip.ErrUnknownNICID{}
 }
 
+// JoinedGroups returns the multicast groups joined by the NIC with ID nicID
+// and the number of times each group has been joined.
+func (s *Stack) JoinedGroups(nicID tcpip.NICID) (map[tcpip.Address]uint64, tcpip.Error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if nic, ok := s.nics[nicID]; ok {
+		return nic.joinedGroups(), nil
+	}
+	return nil, &tcpip.ErrUnknownNICID{}
+}
+
 // IPTables returns the stack's iptables.
 func (s *Stack) IPTables() *IPTables {
 	return s.tables
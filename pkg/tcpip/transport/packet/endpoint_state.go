@@ -35,8 +35,16 @@ func (p *packet) loadReceivedAt(nsec int64) {
 // beforeSave is invoked by stateify.
 func (ep *endpoint) beforeSave() {
 	ep.rcvMu.Lock()
-	defer ep.rcvMu.Unlock()
 	ep.rcvDisabled = true
+	ep.rcvMu.Unlock()
+	ep.stack.RegisterSavedEndpoint(ep)
+}
+
+// Thaw implements stack.SavedEndpoint.Thaw.
+func (ep *endpoint) Thaw() {
+	ep.rcvMu.Lock()
+	defer ep.rcvMu.Unlock()
+	ep.rcvDisabled = false
 }
 
 // afterLoad is invoked by stateify.
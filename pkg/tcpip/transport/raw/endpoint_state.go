@@ -40,6 +40,12 @@ func (e *endpoint) afterLoad() {
 // beforeSave is invoked by stateify.
 func (e *endpoint) beforeSave() {
 	e.setReceiveDisabled(true)
+	e.stack.RegisterSavedEndpoint(e)
+}
+
+// Thaw implements stack.SavedEndpoint.Thaw.
+func (e *endpoint) Thaw() {
+	e.setReceiveDisabled(false)
 }
 
 // Resume implements tcpip.ResumableEndpoint.Resume.
@@ -584,6 +584,10 @@ type endpoint struct {
 	// to an out of window segment being received by this endpoint.
 	lastOutOfWindowAckTime tcpip.MonotonicTime
 
+	// saveTime is the time at which the endpoint was saved. It is used to
+	// rebase the other timestamps of the endpoint on restore.
+	saveTime tcpip.MonotonicTime
+
 	// finWait2Timer is used to reap orphaned sockets in FIN-WAIT-2 where the peer
 	// is yet to send a FIN but on our end the socket is fully closed i.e. endpoint.Close()
 	// has been called on the socket. This timer is not started for sockets that
@@ -23,16 +23,21 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/ports"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
 )
 
 // beforeSave is invoked by stateify.
 func (e *endpoint) beforeSave() {
 	// Stop incoming packets.
 	e.segmentQueue.freeze()
+	e.stack.RegisterSavedEndpoint(e)
+	resumes := e.stack.SaveResumes()
 
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
+	e.saveTime = e.stack.Clock().NowMonotonic()
+
 	epState := e.EndpointState()
 	switch {
 	case epState == StateInitial || epState == StateBound:
@@ -43,6 +48,11 @@ func (e *endpoint) beforeSave() {
 					Err: fmt.Errorf("endpoint cannot be saved in connected state: local %s:%d, remote %s:%d", e.TransportEndpointInfo.ID.LocalAddress, e.TransportEndpointInfo.ID.LocalPort, e.TransportEndpointInfo.ID.RemoteAddress, e.TransportEndpointInfo.ID.RemotePort),
 				})
 			}
+			if resumes {
+				// The connection keeps running. It's aborted when
+				// restored instead, see Resume.
+				break
+			}
 			e.resetConnectionLocked(&tcpip.ErrConnectionAborted{})
 			e.mu.Unlock()
 			e.Close()
@@ -118,6 +128,11 @@ func (e *endpoint) afterLoad() {
 	stack.StackFromEnv.RegisterRestoredEndpoint(e)
 }
 
+// Thaw implements stack.SavedEndpoint.Thaw.
+func (e *endpoint) Thaw() {
+	e.segmentQueue.thaw()
+}
+
 // Resume implements tcpip.ResumableEndpoint.Resume.
 func (e *endpoint) Resume(s *stack.Stack) {
 	if !e.EndpointState().closed() {
@@ -181,9 +196,27 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		e.mu.Lock()
 		err := e.connect(tcpip.FullAddress{NIC: e.boundNICID, Addr: e.connectingAddress, Port: e.TransportEndpointInfo.ID.RemotePort}, false /* handshake */)
 		if _, ok := err.(*tcpip.ErrConnectStarted); !ok {
-			panic("endpoint connecting failed: " + err.String())
+			// The connection can't be repaired, e.g. the sandbox was
+			// restored with different addresses. Report it as reset by
+			// the peer.
+			e.resetConnectionLocked(&tcpip.ErrConnectionReset{})
+			e.mu.Unlock()
+			e.waiterQueue.Notify(waiter.EventHUp | waiter.EventErr | waiter.ReadableEvents | waiter.WritableEvents)
+			connectedLoading.Done()
+			return
+		}
+		if !e.route.HasSaveRestoreCapability() {
+			// The connection was saved by a save that the sandbox
+			// resumed from, and the link doesn't preserve it. Abort
+			// it, as if it had been saved without resuming.
+			e.resetConnectionLocked(&tcpip.ErrConnectionAborted{})
+			e.mu.Unlock()
+			e.waiterQueue.Notify(waiter.EventHUp | waiter.EventErr | waiter.ReadableEvents | waiter.WritableEvents)
+			connectedLoading.Done()
+			return
 		}
 		e.state.Store(e.origEndpointState)
+		e.repairLocked()
 		// For FIN-WAIT-2 and TIME-WAIT we need to start the appropriate timers so
 		// that the socket is closed correctly.
 		switch epState {
@@ -269,3 +302,64 @@ func (e *endpoint) Resume(s *stack.Stack) {
 		tcpip.DeleteDanglingEndpoint(e)
 	}
 }
+
+// repairLocked adjusts a restored connected endpoint so that the time during
+// which the sandbox was not running is not accounted for: timestamps recorded
+// before save are moved forward by the blackout, and the TCP timestamp option
+// continues from its value at save.
+//
+// It then gives both sides a chance to recover segments lost during the
+// blackout. Unacknowledged data is retransmitted after at most InitialRTO, and
+// duplicate ACKs are sent so that the peer fast-retransmits data it sent while
+// the endpoint was not running, instead of waiting for its backed-off
+// retransmission timer.
+//
+// +checklocks:e.mu
+func (e *endpoint) repairLocked() {
+	if e.saveTime == (tcpip.MonotonicTime{}) {
+		return
+	}
+	now := e.stack.Clock().NowMonotonic()
+	rebase := func(t *tcpip.MonotonicTime) {
+		if *t != (tcpip.MonotonicTime{}) {
+			*t = now.Add(t.Sub(e.saveTime))
+		}
+	}
+	e.TSOffset = e.TSOffset.Rebase(e.saveTime, now)
+	rebase(&e.recentTSTime)
+	rebase(&e.lastOutOfWindowAckTime)
+	rebase(&e.RcvAutoParams.MeasureTime)
+	rebase(&e.RcvAutoParams.RTTMeasureTime)
+	e.saveTime = tcpip.MonotonicTime{}
+	if e.rcv != nil {
+		rebase(&e.rcv.lastRcvdAckTime)
+	}
+
+	snd := e.snd
+	if snd == nil {
+		return
+	}
+	rebase(&snd.LastSendTime)
+	rebase(&snd.RTTMeasureTime)
+	rebase(&snd.firstRetransmittedSegXmitTime)
+	rebase(&snd.rc.XmitTime)
+	if c, ok := snd.cc.(*cubicState); ok {
+		rebase(&c.T)
+	}
+	for seg := snd.writeList.Front(); seg != nil; seg = seg.Next() {
+		rebase(&seg.xmitTime)
+	}
+
+	if e.EndpointState() == StateTimeWait {
+		return
+	}
+	if snd.SndUna != snd.SndNxt {
+		if snd.RTO > InitialRTO {
+			snd.RTO = InitialRTO
+		}
+		snd.resendTimer.enable(snd.RTO)
+	}
+	for i := 0; i < nDupAckThreshold; i++ {
+		snd.sendAck()
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tcp_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/state"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/adapters/gonet"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/loopback"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv4"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/tcp"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/udp"
+	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
+)
+
+const nicID = 1
+
+var localhost = tcpip.AddrFrom4([4]byte{127, 0, 0, 1})
+
+func newLoopbackStack(t *testing.T) *stack.Stack {
+	t.Helper()
+	s := stack.New(stack.Options{
+		NetworkProtocols:   []stack.NetworkProtocolFactory{ipv4.NewProtocol},
+		TransportProtocols: []stack.TransportProtocolFactory{tcp.NewProtocol, udp.NewProtocol},
+	})
+	t.Cleanup(s.Destroy)
+	if err := s.CreateNIC(nicID, loopback.New()); err != nil {
+		t.Fatalf("CreateNIC: %s", err)
+	}
+	protoAddr := tcpip.ProtocolAddress{
+		Protocol:          ipv4.ProtocolNumber,
+		AddressWithPrefix: localhost.WithPrefix(),
+	}
+	if err := s.AddProtocolAddress(nicID, protoAddr, stack.AddressProperties{}); err != nil {
+		t.Fatalf("AddProtocolAddress: %s", err)
+	}
+	s.SetRouteTable([]tcpip.Route{{Destination: header.IPv4EmptySubnet, NIC: nicID}})
+	return s
+}
+
+// saveResuming saves eps as a checkpoint that the stack resumes from would.
+func saveResuming(t *testing.T, s *stack.Stack, eps ...tcpip.Endpoint) {
+	t.Helper()
+	s.Pause(true /* resume */)
+	defer s.Resume()
+	w := bufio.NewWriter(io.Discard)
+	if _, err := state.Save(context.Background(), w, &eps); err != nil {
+		t.Fatalf("state.Save: %v", err)
+	}
+}
+
+// TestSaveResume checks that sockets keep working after a save that the stack
+// resumes from, as with automatic checkpoints.
+func TestSaveResume(t *testing.T) {
+	s := newLoopbackStack(t)
+
+	l, err := gonet.ListenTCP(s, tcpip.FullAddress{NIC: nicID, Addr: localhost, Port: 8080}, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("ListenTCP: %v", err)
+	}
+	defer l.Close()
+	accepted := make(chan *gonet.TCPConn, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+			close(accepted)
+			return
+		}
+		accepted <- c.(*gonet.TCPConn)
+	}()
+
+	var cwq waiter.Queue
+	cep, tcpErr := s.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &cwq)
+	if tcpErr != nil {
+		t.Fatalf("NewEndpoint: %s", tcpErr)
+	}
+	client := gonet.NewTCPConn(&cwq, cep)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := connect(ctx, cep, &cwq, tcpip.FullAddress{NIC: nicID, Addr: localhost, Port: 8080}); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	server, ok := <-accepted
+	if !ok {
+		return
+	}
+	defer server.Close()
+
+	var uwq waiter.Queue
+	uep, tcpErr := s.NewEndpoint(udp.ProtocolNumber, ipv4.ProtocolNumber, &uwq)
+	if tcpErr != nil {
+		t.Fatalf("NewEndpoint: %s", tcpErr)
+	}
+	udpConn := gonet.NewUDPConn(s, &uwq, uep)
+	defer udpConn.Close()
+	if tcpErr := uep.Bind(tcpip.FullAddress{NIC: nicID, Addr: localhost, Port: 8081}); tcpErr != nil {
+		t.Fatalf("Bind: %s", tcpErr)
+	}
+
+	saveResuming(t, s, cep, uep)
+
+	// The TCP connection must not have been reset, and must deliver data in
+	// both directions.
+	for _, c := range []struct {
+		name   string
+		w, r   *gonet.TCPConn
+		buffer []byte
+	}{
+		{name: "client to server", w: client, r: server, buffer: []byte("ping")},
+		{name: "server to client", w: server, r: client, buffer: []byte("pong")},
+	} {
+		if err := c.r.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+			t.Fatalf("SetReadDeadline: %v", err)
+		}
+		if _, err := c.w.Write(c.buffer); err != nil {
+			t.Fatalf("%s: Write: %v", c.name, err)
+		}
+		got := make([]byte, len(c.buffer))
+		if _, err := io.ReadFull(c.r, got); err != nil {
+			t.Fatalf("%s: Read: %v", c.name, err)
+		}
+		if !bytes.Equal(got, c.buffer) {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.buffer)
+		}
+	}
+
+	// The UDP socket must receive datagrams again.
+	sender, err := gonet.DialUDP(s, nil, &tcpip.FullAddress{NIC: nicID, Addr: localhost, Port: 8081}, ipv4.ProtocolNumber)
+	if err != nil {
+		t.Fatalf("DialUDP: %v", err)
+	}
+	defer sender.Close()
+	if _, err := sender.Write([]byte("datagram")); err != nil {
+		t.Fatalf("UDP Write: %v", err)
+	}
+	if err := udpConn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatalf("SetReadDeadline: %v", err)
+	}
+	got := make([]byte, 64)
+	n, _, err := udpConn.ReadFrom(got)
+	if err != nil {
+		t.Fatalf("UDP ReadFrom: %v", err)
+	}
+	if want := "datagram"; string(got[:n]) != want {
+		t.Errorf("UDP ReadFrom: got %q, want %q", got[:n], want)
+	}
+}
+
+// connect connects ep to addr, waiting for the handshake to complete.
+func connect(ctx context.Context, ep tcpip.Endpoint, wq *waiter.Queue, addr tcpip.FullAddress) error {
+	entry, ch := waiter.NewChannelEntry(waiter.WritableEvents)
+	wq.EventRegister(&entry)
+	defer wq.EventUnregister(&entry)
+	err := ep.Connect(addr)
+	if _, ok := err.(*tcpip.ErrConnectStarted); ok {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		err = ep.LastError()
+	}
+	if err != nil {
+		return fmt.Errorf("%s", err)
+	}
+	return nil
+}
@@ -380,6 +380,7 @@ func (e *endpoint) StateFields() []string {
 		"owner",
 		"ops",
 		"lastOutOfWindowAckTime",
+		"saveTime",
 	}
 }
 
@@ -440,6 +441,7 @@ func (e *endpoint) StateSave(stateSinkObject state.Sink) {
 	stateSinkObject.Save(49, &e.owner)
 	stateSinkObject.Save(50, &e.ops)
 	stateSinkObject.Save(51, &e.lastOutOfWindowAckTime)
+	stateSinkObject.Save(52, &e.saveTime)
 }
 
 // +checklocksignore
@@ -495,6 +497,7 @@ func (e *endpoint) StateLoad(stateSourceObject state.Source) {
 	stateSourceObject.Load(49, &e.owner)
 	stateSourceObject.Load(50, &e.ops)
 	stateSourceObject.Load(51, &e.lastOutOfWindowAckTime)
+	stateSourceObject.Load(52, &e.saveTime)
 	stateSourceObject.LoadValue(11, new(EndpointState), func(y any) { e.loadState(y.(EndpointState)) })
 	stateSourceObject.AfterLoad(e.afterLoad)
 }
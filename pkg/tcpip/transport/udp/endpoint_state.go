@@ -41,6 +41,12 @@ func (e *endpoint) afterLoad() {
 // beforeSave is invoked by stateify.
 func (e *endpoint) beforeSave() {
 	e.freeze()
+	e.stack.RegisterSavedEndpoint(e)
+}
+
+// Thaw implements stack.SavedEndpoint.Thaw.
+func (e *endpoint) Thaw() {
+	e.thaw()
 }
 
 // Resume implements tcpip.ResumableEndpoint.Resume.
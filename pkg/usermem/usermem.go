@@ -354,16 +354,30 @@ func isASCIIWhitespace(b byte) bool {
 //
 // Preconditions: Same as CopyInVec.
 func CopyInt32StringsInVec(ctx context.Context, uio IO, ars hostarch.AddrRangeSeq, dsts []int32, opts IOOpts) (int64, error) {
-	if len(dsts) == 0 {
+	return copyIntStringsInVec(ctx, uio, ars, len(dsts), func(j int, s string) error {
+		val, err := strconv.ParseInt(s, 10, 32)
+		if err != nil {
+			return err
+		}
+		dsts[j] = int32(val)
+		return nil
+	}, opts)
+}
+
+// copyIntStringsInVec implements CopyInt32StringsInVec and
+// CopyUint64StringsInVec. It calls parse with the index and text of each of
+// the n values read.
+func copyIntStringsInVec(ctx context.Context, uio IO, ars hostarch.AddrRangeSeq, n int, parse func(j int, s string) error, opts IOOpts) (int64, error) {
+	if n == 0 {
 		return 0, nil
 	}
 
 	buf := make([]byte, ars.NumBytes())
-	n, cperr := CopyInVec(ctx, uio, ars, buf, opts)
-	buf = buf[:n]
+	cn, cperr := CopyInVec(ctx, uio, ars, buf, opts)
+	buf = buf[:cn]
 
 	var i, j int
-	for ; j < len(dsts); j++ {
+	for ; j < n; j++ {
 		// Skip leading whitespace.
 		for i < len(buf) && isASCIIWhitespace(buf[i]) {
 			i++
@@ -379,11 +393,9 @@ func CopyInt32StringsInVec(ctx context.Context, uio IO, ars hostarch.AddrRangeSe
 		}
 
 		// Parse a single value.
-		val, err := strconv.ParseInt(string(buf[i:nextI]), 10, 32)
-		if err != nil {
+		if err := parse(j, string(buf[i:nextI])); err != nil {
 			return int64(i), linuxerr.EINVAL
 		}
-		dsts[j] = int32(val)
 
 		i = nextI
 	}
@@ -411,6 +423,28 @@ func CopyInt32StringInVec(ctx context.Context, uio IO, ars hostarch.AddrRangeSeq
 	return n, err
 }
 
+// CopyUint64StringsInVec is equivalent to CopyInt32StringsInVec, but copies
+// unsigned 64-bit values, like Linux's kernel/sysctl.c:proc_doulongvec_minmax().
+func CopyUint64StringsInVec(ctx context.Context, uio IO, ars hostarch.AddrRangeSeq, dsts []uint64, opts IOOpts) (int64, error) {
+	return copyIntStringsInVec(ctx, uio, ars, len(dsts), func(j int, s string) error {
+		val, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		dsts[j] = val
+		return nil
+	}, opts)
+}
+
+// CopyUint64StringInVec is equivalent to CopyUint64StringsInVec, but copies at
+// most one uint64.
+func CopyUint64StringInVec(ctx context.Context, uio IO, ars hostarch.AddrRangeSeq, dst *uint64, opts IOOpts) (int64, error) {
+	dsts := [1]uint64{*dst}
+	n, err := CopyUint64StringsInVec(ctx, uio, ars, dsts[:], opts)
+	*dst = dsts[0]
+	return n, err
+}
+
 // IOSequence holds arguments to IO methods.
 type IOSequence struct {
 	IO    IO
@@ -0,0 +1,194 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/sockfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	unixsocket "github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix/transport"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/unet"
+	pf "github.com/talismancer/gvisor-ligolo/runsc/boot/portforward"
+	"golang.org/x/sys/unix"
+)
+
+// Abstract Unix-domain sockets live in network namespaces, so sandboxed
+// applications can't see those of the host. Selected sockets can be shared
+// with the network namespace the sandbox process runs in, i.e. the host's
+// with --network=host:
+//
+//   - Imported sockets are bound on the host. Applications connect to them as
+//     if they were bound in the sandbox, unless a socket of the sandbox is
+//     bound to the same name. SCM_RIGHTS and SCM_CREDENTIALS work as with
+//     other host sockets.
+//
+//   - Exported sockets are bound by applications. The sentry binds a stream
+//     socket with the same name on the host and forwards connections to it.
+//     Only data is forwarded.
+
+// abstractNameMatches returns true if name matches pattern, which matches
+// names with its prefix if it ends with '*'.
+func abstractNameMatches(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return pattern == name
+}
+
+// setAbstractImports makes the host sockets matching imports accessible in the
+// root abstract socket namespace of k. It must be called again after restore.
+func setAbstractImports(k *kernel.Kernel, imports []string) {
+	if len(imports) == 0 {
+		return
+	}
+	k.RootAbstractSocketNamespace().SetExternal(func(name string) transport.BoundEndpoint {
+		for _, pattern := range imports {
+			if abstractNameMatches(pattern, name) {
+				return transport.NewHostAbstractEndpoint(name)
+			}
+		}
+		return nil
+	})
+}
+
+// abstractExport is an abstract socket of the sandbox exported onto the host.
+type abstractExport struct {
+	name string
+	sock *unet.ServerSocket
+}
+
+// newAbstractExports binds host sockets for the exported abstract sockets in
+// names. It must be called before seccomp filters are installed.
+func newAbstractExports(names []string) ([]*abstractExport, error) {
+	var exports []*abstractExport
+	success := false
+	defer func() {
+		if !success {
+			for _, e := range exports {
+				e.sock.Close()
+			}
+		}
+	}()
+	for _, name := range names {
+		fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+		if err != nil {
+			return nil, err
+		}
+		if err := unix.Bind(fd, &unix.SockaddrUnix{Name: "@" + name}); err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("binding abstract socket %q: %w", name, err)
+		}
+		if err := unix.Listen(fd, 16); err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("listening on abstract socket %q: %w", name, err)
+		}
+		sock, err := unet.NewServerSocket(fd)
+		if err != nil {
+			unix.Close(fd)
+			return nil, err
+		}
+		exports = append(exports, &abstractExport{name: name, sock: sock})
+	}
+	success = true
+	return exports, nil
+}
+
+// abstractExportFDs returns the host sockets of the exported abstract sockets.
+func (l *Loader) abstractExportFDs() []int {
+	var fds []int
+	for _, e := range l.abstractExports {
+		fds = append(fds, e.sock.FD())
+	}
+	return fds
+}
+
+// startAbstractExports starts accepting connections on the host sockets of
+// exported abstract sockets.
+func (l *Loader) startAbstractExports() {
+	for _, e := range l.abstractExports {
+		log.Infof("Exporting abstract socket %q", e.name)
+		go l.serveAbstractExport(e) // S/R-SAFE: not saved.
+	}
+}
+
+// stopAbstractExports stops accepting connections on the host sockets of
+// exported abstract sockets.
+func (l *Loader) stopAbstractExports() {
+	for _, e := range l.abstractExports {
+		e.sock.Close()
+	}
+}
+
+func (l *Loader) serveAbstractExport(e *abstractExport) {
+	for {
+		conn, err := e.sock.Accept()
+		if err != nil {
+			if err != unix.EBADF {
+				log.Warningf("Exported abstract socket %q stopped accepting connections: %v", e.name, err)
+			}
+			return
+		}
+		go l.handleAbstractExportConn(e, conn) // S/R-SAFE: not saved.
+	}
+}
+
+func (l *Loader) handleAbstractExportConn(e *abstractExport, conn *unet.Socket) {
+	fd, err := conn.Release()
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "abstract-"+e.name)
+	defer f.Close()
+
+	if err := l.connectAbstractExport(e, f); err != nil {
+		log.Warningf("Exported abstract socket %q: forwarding connection: %v", e.name, err)
+	}
+}
+
+// connectAbstractExport connects to the abstract socket bound in the sandbox
+// and forwards data between it and the host stream file f.
+func (l *Loader) connectAbstractExport(e *abstractExport, f *os.File) error {
+	ctx := l.k.SupervisorContext()
+	bep := l.k.RootAbstractSocketNamespace().BoundEndpoint(e.name)
+	if bep == nil {
+		return fmt.Errorf("no socket is bound")
+	}
+	defer bep.Release(ctx)
+	if _, ok := bep.(*transport.HostAbstractEndpoint); ok {
+		return fmt.Errorf("no socket is bound in the sandbox")
+	}
+
+	ep := transport.NewConnectioned(ctx, linux.SOCK_STREAM, l.k)
+	if err := ep.Connect(ctx, bep); err != nil {
+		ep.Close(ctx)
+		return err.ToError()
+	}
+	mnt := l.k.SocketMount()
+	d := sockfs.NewDentry(ctx, mnt)
+	defer d.DecRef(ctx)
+	fd, err := unixsocket.NewFileDescription(ep, linux.SOCK_STREAM, linux.O_RDWR|linux.O_NONBLOCK, mnt, d, &vfs.FileLocks{})
+	if err != nil {
+		ep.Close(ctx)
+		return err
+	}
+	return l.forwardConn(l.sandboxID, f, pf.ProxyPair{From: pf.NewFileDescriptionConn(fd)})
+}
@@ -0,0 +1,271 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/eventchannel"
+	pb "github.com/talismancer/gvisor-ligolo/pkg/eventchannel/eventchannel_go_proto"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/metric"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/control"
+	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/version"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// autoCheckpointPrefix is the name prefix of checkpoint images written to
+	// the auto-checkpoint directory. It's followed by a UTC timestamp, so that
+	// lexical order is the order in which images were taken.
+	autoCheckpointPrefix = "checkpoint-"
+
+	// autoCheckpointTimeFormat is the timestamp format used in image names.
+	autoCheckpointTimeFormat = "20060102T150405.000000000Z"
+
+	// autoCheckpointTmpPrefix is the name prefix of images being written.
+	autoCheckpointTmpPrefix = ".tmp-checkpoint-"
+
+	// The metadata keys below must match the ones in runsc/container, so that
+	// auto-checkpoint images can be restored with "runsc restore".
+	autoCheckpointSpecKey    = "container_spec"
+	autoCheckpointVersionKey = "runsc_version"
+)
+
+var (
+	autoCheckpointSaved    = metric.MustCreateNewUint64Metric("/checkpoint/auto/saved", false /* sync */, "Number of automatic checkpoints taken.")
+	autoCheckpointFailed   = metric.MustCreateNewUint64Metric("/checkpoint/auto/failed", false /* sync */, "Number of automatic checkpoints that failed.")
+	autoCheckpointDuration = metric.MustCreateNewUint64NanosecondsMetric("/checkpoint/auto/duration", false /* sync */, "Total time spent taking automatic checkpoints, during which the sandbox is paused.")
+)
+
+// autoCheckpointEvent is emitted as JSON in a DebugEvent after each automatic
+// checkpoint.
+type autoCheckpointEvent struct {
+	Path     string        `json:"path,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Removed  []string      `json:"removed,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// autoCheckpointer periodically checkpoints the sandbox into a directory
+// donated by the host, keeping only the most recent images.
+//
+// Each image is a full checkpoint that can be restored on its own with
+// "runsc restore". Incremental checkpoints, saving only the memory changed
+// since the previous image, are not supported: every image costs a full save.
+// The sandbox is paused while the image is written and resumed afterwards,
+// with its network connections kept open.
+type autoCheckpointer struct {
+	l     *Loader
+	conf  config.AutoCheckpoint
+	dirFD int
+	spec  string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startAutoCheckpoint starts taking periodic checkpoints if they are enabled.
+// It's a noop if they are already running.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) startAutoCheckpoint() error {
+	conf := l.root.conf.AutoCheckpoint
+	if !conf.Enabled() || l.autoCheckpoint != nil {
+		return nil
+	}
+	if l.autoCheckpointDirFD < 0 {
+		return fmt.Errorf("auto-checkpoint enabled but no directory was provided")
+	}
+	spec, err := json.Marshal(l.root.spec)
+	if err != nil {
+		return fmt.Errorf("marshaling spec: %w", err)
+	}
+	a := &autoCheckpointer{
+		l:     l,
+		conf:  conf,
+		dirFD: l.autoCheckpointDirFD,
+		spec:  string(spec),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	l.autoCheckpoint = a
+	log.Infof("Auto-checkpoint every %v to %q, keeping %d images", conf.Interval, conf.Dir, conf.Keep)
+	go a.run() // S/R-SAFE: not saved.
+	return nil
+}
+
+// stopAutoCheckpoint stops taking periodic checkpoints and waits for an
+// in-flight checkpoint to complete.
+func (l *Loader) stopAutoCheckpoint() {
+	l.mu.Lock()
+	a := l.autoCheckpoint
+	l.autoCheckpoint = nil
+	l.mu.Unlock()
+	if a != nil {
+		close(a.stop)
+		<-a.done
+	}
+}
+
+func (a *autoCheckpointer) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.conf.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			a.checkpoint()
+		}
+	}
+}
+
+// checkpoint takes a single checkpoint, removes stale images and reports the
+// result.
+func (a *autoCheckpointer) checkpoint() {
+	start := time.Now()
+	name, err := a.save(start)
+	ev := autoCheckpointEvent{Duration: time.Since(start)}
+	autoCheckpointDuration.IncrementBy(uint64(ev.Duration.Nanoseconds()))
+	if err != nil {
+		log.Warningf("Auto-checkpoint failed: %v", err)
+		autoCheckpointFailed.Increment()
+		ev.Error = err.Error()
+	} else {
+		log.Infof("Auto-checkpoint %q taken in %v", name, ev.Duration)
+		autoCheckpointSaved.Increment()
+		ev.Path = a.conf.Dir + "/" + name
+
+		removed, err := a.prune()
+		if err != nil {
+			log.Warningf("Auto-checkpoint retention failed: %v", err)
+		}
+		for _, r := range removed {
+			ev.Removed = append(ev.Removed, a.conf.Dir+"/"+r)
+		}
+	}
+
+	text, err := json.Marshal(&ev)
+	if err != nil {
+		log.Warningf("Failed to marshal auto-checkpoint event: %v", err)
+		return
+	}
+	eventchannel.Emit(&pb.DebugEvent{Name: "auto_checkpoint", Text: string(text)})
+}
+
+// save writes a checkpoint image to a temporary file and renames it into place
+// once complete, so that partial images are never picked up by retention or by
+// a restore. It returns the name of the image.
+func (a *autoCheckpointer) save(now time.Time) (string, error) {
+	name := autoCheckpointPrefix + now.UTC().Format(autoCheckpointTimeFormat)
+	tmpName := autoCheckpointTmpPrefix + name
+	metadata := map[string]string{
+		autoCheckpointSpecKey:    a.spec,
+		autoCheckpointVersionKey: version.Version(),
+	}
+	if err := addTraceSessionsMetadata(metadata); err != nil {
+		return "", err
+	}
+	fd, err := unix.Openat(a.dirFD, tmpName, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0644)
+	if err != nil {
+		return "", fmt.Errorf("creating %q: %w", tmpName, err)
+	}
+	file := os.NewFile(uintptr(fd), tmpName)
+
+	a.l.saveMu.Lock()
+	a.l.mu.Lock()
+	state := control.State{
+		Kernel:   a.l.k,
+		Watchdog: a.l.watchdog,
+	}
+	a.l.mu.Unlock()
+	// State.Save closes the file.
+	err = state.Save(&control.SaveOpts{
+		FilePayload: urpc.FilePayload{Files: []*os.File{file}},
+		Metadata:    metadata,
+		Resume:      true,
+		Checksums:   a.l.root.conf.CheckpointChecksums,
+	}, nil)
+	a.l.saveMu.Unlock()
+	if err != nil {
+		_ = unix.Unlinkat(a.dirFD, tmpName, 0)
+		return "", err
+	}
+	if err := unix.Renameat(a.dirFD, tmpName, a.dirFD, name); err != nil {
+		_ = unix.Unlinkat(a.dirFD, tmpName, 0)
+		return "", fmt.Errorf("renaming %q to %q: %w", tmpName, name, err)
+	}
+	return name, nil
+}
+
+// prune removes the oldest images, keeping at most conf.Keep of them. It
+// returns the names of the removed images.
+func (a *autoCheckpointer) prune() ([]string, error) {
+	names, err := a.list()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) <= a.conf.Keep {
+		return nil, nil
+	}
+	sort.Strings(names)
+	var removed []string
+	for _, name := range names[:len(names)-a.conf.Keep] {
+		if err := unix.Unlinkat(a.dirFD, name, 0); err != nil {
+			return removed, fmt.Errorf("removing %q: %w", name, err)
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// list returns the names of the images in the checkpoint directory.
+func (a *autoCheckpointer) list() ([]string, error) {
+	// The directory is read through dirFD, rather than a new FD, since the
+	// seccomp filters only allow the syscalls on dirFD. It's only read by
+	// the auto-checkpointer.
+	if _, err := unix.Seek(a.dirFD, 0, 0); err != nil {
+		return nil, fmt.Errorf("rewinding checkpoint directory: %w", err)
+	}
+
+	var names []string
+	buf := make([]byte, 8192)
+	for {
+		n, err := unix.Getdents(a.dirFD, buf)
+		if err != nil {
+			return nil, fmt.Errorf("reading checkpoint directory: %w", err)
+		}
+		if n <= 0 {
+			break
+		}
+		var entries []string
+		_, _, entries = unix.ParseDirent(buf[:n], -1, entries)
+		for _, name := range entries {
+			if strings.HasPrefix(name, autoCheckpointPrefix) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
@@ -15,25 +15,34 @@
 package boot
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"os"
+	"path"
+	"strings"
 	gtime "time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
 	"github.com/talismancer/gvisor-ligolo/pkg/control/server"
 	"github.com/talismancer/gvisor-ligolo/pkg/fd"
+	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/control"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/pgalloc"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/state"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/time"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/watchdog"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
 	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
+	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
 	"github.com/talismancer/gvisor-ligolo/runsc/boot/pprof"
 	"github.com/talismancer/gvisor-ligolo/runsc/boot/procfs"
 	"github.com/talismancer/gvisor-ligolo/runsc/config"
@@ -55,18 +64,52 @@ const (
 	// ContMgrEvent gets stats about the container used by "runsc events".
 	ContMgrEvent = "containerManager.Event"
 
+	// ContMgrStreamEvents streams stats about the container used by
+	// "runsc events --stream".
+	ContMgrStreamEvents = "containerManager.StreamEvents"
+
+	// ContMgrSetEgressPolicy replaces the egress policy of the sandbox.
+	ContMgrSetEgressPolicy = "containerManager.SetEgressPolicy"
+
 	// ContMgrExecuteAsync executes a command in a container.
 	ContMgrExecuteAsync = "containerManager.ExecuteAsync"
 
 	// ContMgrPortForward starts port forwarding with the sandbox.
 	ContMgrPortForward = "containerManager.PortForward"
 
+	// ContMgrDial connects to an address through the sandbox network stack.
+	ContMgrDial = "containerManager.Dial"
+
+	// ContMgrListen listens on an address in the sandbox network stack.
+	ContMgrListen = "containerManager.Listen"
+
+	// ContMgrAccept accepts a connection on a listener created with
+	// ContMgrListen.
+	ContMgrAccept = "containerManager.Accept"
+
+	// ContMgrCloseListener closes a listener created with ContMgrListen.
+	ContMgrCloseListener = "containerManager.CloseListener"
+
+	// ContMgrMigrate checkpoints a container to another host, pre-copying
+	// its memory while it runs.
+	ContMgrMigrate = "containerManager.Migrate"
+
 	// ContMgrProcesses lists processes running in a container.
 	ContMgrProcesses = "containerManager.Processes"
 
 	// ContMgrRestore restores a container from a statefile.
 	ContMgrRestore = "containerManager.Restore"
 
+	// ContMgrRestoreProgress returns the progress of a ContMgrRestore call.
+	ContMgrRestoreProgress = "containerManager.RestoreProgress"
+
+	// ContMgrRestoreCancel cancels a ContMgrRestore call.
+	ContMgrRestoreCancel = "containerManager.RestoreCancel"
+
+	// ContMgrReconnectGofer reconnects the mounts of a container to its
+	// restarted gofer.
+	ContMgrReconnectGofer = "containerManager.ReconnectGofer"
+
 	// ContMgrSignal sends a signal to a container.
 	ContMgrSignal = "containerManager.Signal"
 
@@ -93,18 +136,46 @@ const (
 	// ContMgrListTraceSessions lists a trace session.
 	ContMgrListTraceSessions = "containerManager.ListTraceSessions"
 
+	// ContMgrUpdateTraceSession updates the points of a trace session.
+	ContMgrUpdateTraceSession = "containerManager.UpdateTraceSession"
+
 	// ContMgrProcfsDump dumps sandbox procfs state.
 	ContMgrProcfsDump = "containerManager.ProcfsDump"
+
+	// ContMgrStartupPhases returns the startup phases recorded in the sandbox.
+	ContMgrStartupPhases = "containerManager.StartupPhases"
+
+	// ContMgrExportRootfs writes the changes made to a container's root
+	// filesystem as a tar archive.
+	ContMgrExportRootfs = "containerManager.ExportRootfs"
 )
 
 const (
 	// NetworkCreateLinksAndRoutes creates links and routes in a network stack.
 	NetworkCreateLinksAndRoutes = "Network.CreateLinksAndRoutes"
 
+	// NetworkDump dumps the state of the sandbox network stack.
+	NetworkDump = "Network.Dump"
+
 	// DebugStacks collects sandbox stacks for debugging.
 	DebugStacks = "debug.Stacks"
+
+	// DebugHostFDs collects the host FD table of the sandbox for debugging.
+	DebugHostFDs = "debug.HostFDs"
+
+	// DebugTunables collects the values of the sentry tunables.
+	DebugTunables = "debug.Tunables"
+
+	// DebugAttachGDB attaches a gdb remote stub to a process.
+	DebugAttachGDB = "Debug.AttachGDB"
+
+	// DebugThreads collects the state of guest threads.
+	DebugThreads = "Debug.Threads"
 )
 
+// HealthPing checks that the control server is responsive.
+const HealthPing = "Health.Ping"
+
 // Profiling related commands (see pprof.go for more details).
 const (
 	ProfileCPU   = "Profile.CPU"
@@ -121,14 +192,21 @@ const (
 
 // Lifecycle related commands (see lifecycle.go for more details).
 const (
-	LifecyclePause  = "Lifecycle.Pause"
-	LifecycleResume = "Lifecycle.Resume"
+	LifecyclePause      = "Lifecycle.Pause"
+	LifecycleResume     = "Lifecycle.Resume"
+	LifecycleSetCPUs    = "Lifecycle.SetCPUs"
+	LifecycleSetMemory  = "Lifecycle.SetMemory"
+	LifecycleSetBalloon = "Lifecycle.SetBalloon"
 )
 
 // Usage related commands (see usage.go for more details).
 const (
-	UsageCollect = "Usage.Collect"
-	UsageUsageFD = "Usage.UsageFD"
+	UsageCollect       = "Usage.Collect"
+	UsageCollectSentry = "Usage.CollectSentry"
+	UsageUsageFD       = "Usage.UsageFD"
+	UsageStartSampling = "Usage.StartSampling"
+	UsageStopSampling  = "Usage.StopSampling"
+	UsageSamples       = "Usage.Samples"
 )
 
 // Metrics related commands (see metrics.go).
@@ -137,6 +215,20 @@ const (
 	MetricsExport        = "Metrics.Export"
 )
 
+// Fault injection related commands (see faultinject.go for more details).
+const (
+	FaultInjectAdd    = "FaultInject.Add"
+	FaultInjectRemove = "FaultInject.Remove"
+	FaultInjectClear  = "FaultInject.Clear"
+	FaultInjectList   = "FaultInject.List"
+)
+
+// Filesystem related commands (see fs.go for more details).
+const (
+	FsFreeze = "Fs.Freeze"
+	FsThaw   = "Fs.Thaw"
+)
+
 // Commands for interacting with cgroupfs within the sandbox.
 const (
 	CgroupsReadControlFiles  = "Cgroups.ReadControlFiles"
@@ -177,7 +269,11 @@ func newController(fd int, l *Loader) (*controller, error) {
 	ctrl.srv.Register(&control.State{Kernel: l.k})
 	ctrl.srv.Register(&control.Usage{Kernel: l.k})
 	ctrl.srv.Register(&control.Metrics{})
+	ctrl.srv.Register(&control.FaultInject{})
+	ctrl.srv.Register(&control.Fs{Kernel: l.k})
 	ctrl.srv.Register(&debug{})
+	ctrl.srv.Register(newHealth(l.root.conf))
+	ctrl.srv.Register(&control.Debug{Kernel: l.k})
 
 	if eps, ok := l.k.RootNetworkNamespace().Stack().(*netstack.Stack); ok {
 		ctrl.srv.Register(&Network{Stack: eps.Stack})
@@ -208,11 +304,31 @@ type containerManager struct {
 
 	// l is the loader that creates containers and sandboxes.
 	l *Loader
+
+	// startMu protects rootStarted.
+	startMu sync.Mutex
+
+	// rootStarted is true once the root container has been started, or
+	// restored into.
+	//
+	// +checklocks:startMu
+	rootStarted bool
+
+	// restoreMu protects restoreProgress.
+	restoreMu sync.Mutex
+
+	// restoreProgress tracks the restore in progress, if any.
+	//
+	// +checklocks:restoreMu
+	restoreProgress *state.LoadProgress
 }
 
 // StartRoot will start the root container process.
 func (cm *containerManager) StartRoot(cid *string, _ *struct{}) error {
 	log.Debugf("containerManager.StartRoot, cid: %s", *cid)
+	if err := cm.claimRoot(); err != nil {
+		return err
+	}
 	// Tell the root container to start and wait for the result.
 	cm.startChan <- struct{}{}
 	if err := <-cm.startResultChan; err != nil {
@@ -221,6 +337,18 @@ func (cm *containerManager) StartRoot(cid *string, _ *struct{}) error {
 	return nil
 }
 
+// claimRoot marks the root container as started. It fails if it was already
+// started or restored into, since a sandbox runs a single root container.
+func (cm *containerManager) claimRoot() error {
+	cm.startMu.Lock()
+	defer cm.startMu.Unlock()
+	if cm.rootStarted {
+		return fmt.Errorf("root container of sandbox %q was already started", cm.l.sandboxID)
+	}
+	cm.rootStarted = true
+	return nil
+}
+
 // Processes retrieves information about processes running in the sandbox.
 func (cm *containerManager) Processes(cid *string, out *[]*control.Process) error {
 	log.Debugf("containerManager.Processes, cid: %s", *cid)
@@ -355,6 +483,28 @@ func (cm *containerManager) StartSubcontainer(args *StartArgs, _ *struct{}) erro
 	return nil
 }
 
+// ReconnectGoferArgs are the arguments to ReconnectGofer.
+type ReconnectGoferArgs struct {
+	// CID is the ID of the container whose gofer was restarted.
+	CID string
+
+	// FilePayload contains the FDs to connect to the restarted gofer, in the
+	// same order as when the container was started: the root filesystem
+	// first, followed by the gofer mounts.
+	urpc.FilePayload
+}
+
+// ReconnectGofer reconnects the mounts of a container to its restarted gofer,
+// after the previous one died. It requires --gofer-recovery-timeout.
+func (cm *containerManager) ReconnectGofer(args *ReconnectGoferArgs, _ *struct{}) error {
+	log.Debugf("containerManager.ReconnectGofer, cid: %s", args.CID)
+	goferFDs, err := fd.NewFromFiles(args.Files)
+	if err != nil {
+		return fmt.Errorf("error dup'ing gofer files: %w", err)
+	}
+	return cm.l.reconnectGofer(args.CID, goferFDs)
+}
+
 // DestroySubcontainer stops a container if it is still running and cleans up
 // its filesystem.
 func (cm *containerManager) DestroySubcontainer(cid *string, _ *struct{}) error {
@@ -378,18 +528,89 @@ func (cm *containerManager) ExecuteAsync(args *control.ExecArgs, pid *int32) err
 // Checkpoint pauses a sandbox and saves its state.
 func (cm *containerManager) Checkpoint(o *control.SaveOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Checkpoint")
-	// TODO(gvisor.dev/issues/6243): save/restore not supported w/ hostinet
-	if cm.l.root.conf.Network == config.NetworkHost {
-		return errors.New("checkpoint not supported when using hostinet")
-	}
+	// With hostinet, host sockets are not part of the checkpoint. They are
+	// reported as reset after restore, see hostinet.Socket.afterLoad.
+	cm.l.saveMu.Lock()
+	defer cm.l.saveMu.Unlock()
+	return cm.saveLocked(o)
+}
 
+// saveLocked saves the state of the sandbox as described by o.
+//
+// Preconditions: cm.l.saveMu is locked.
+func (cm *containerManager) saveLocked(o *control.SaveOpts) error {
 	state := control.State{
 		Kernel:   cm.l.k,
 		Watchdog: cm.l.watchdog,
 	}
+	o.Checksums = cm.l.root.conf.CheckpointChecksums
+	if o.Metadata == nil {
+		o.Metadata = make(map[string]string)
+	}
+	if err := addTraceSessionsMetadata(o.Metadata); err != nil {
+		return err
+	}
 	return state.Save(o, nil)
 }
 
+// MigrateOpts contains options for Migrate.
+type MigrateOpts struct {
+	// SaveOpts are the options of the save. Its file is the connection to
+	// the target of the migration.
+	control.SaveOpts
+
+	// PrecopyRounds is the maximum number of times memory is pre-copied
+	// while the sandbox runs. Each round copies the pages that changed since
+	// the previous one.
+	PrecopyRounds int
+}
+
+// precopyConvergedBytes is the amount of memory under which pre-copy rounds
+// stop, since the sandbox can be stopped to copy what's left.
+const precopyConvergedBytes = 16 << 20
+
+// Migrate saves the state of a sandbox to the target of a migration, like
+// Checkpoint. Memory is pre-copied to the target in rounds while the sandbox
+// runs, then the sandbox is paused and its state is saved, along with the
+// pages that changed since they were pre-copied. The sandbox exits after the
+// save.
+func (cm *containerManager) Migrate(o *MigrateOpts, _ *struct{}) error {
+	log.Debugf("containerManager.Migrate, precopy rounds: %d", o.PrecopyRounds)
+	if len(o.Files) != 1 {
+		return control.ErrInvalidFiles
+	}
+	cm.l.saveMu.Lock()
+	defer cm.l.saveMu.Unlock()
+
+	ctx := cm.l.k.SupervisorContext()
+	mf := cm.l.k.MemoryFile()
+	p := pgalloc.NewPrecopyState()
+	w := bufio.NewWriter(o.Files[0])
+	for round := 0; round < o.PrecopyRounds; round++ {
+		n, err := mf.PrecopyTo(ctx, w, p)
+		if err != nil {
+			o.Files[0].Close()
+			return fmt.Errorf("pre-copying memory: %w", err)
+		}
+		log.Infof("Migration pre-copy round %d copied %d bytes", round, n)
+		if n <= precopyConvergedBytes {
+			break
+		}
+	}
+	err := pgalloc.WritePrecopyEnd(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		o.Files[0].Close()
+		return fmt.Errorf("pre-copying memory: %w", err)
+	}
+
+	o.Precopy = p
+	o.Resume = false
+	return cm.saveLocked(&o.SaveOpts)
+}
+
 // PortForwardOpts contains options for port forwarding to a port in a
 // container.
 type PortForwardOpts struct {
@@ -413,42 +634,176 @@ func (cm *containerManager) PortForward(opts *PortForwardOpts, _ *struct{}) erro
 	return nil
 }
 
+// DialOpts contains options for connecting to an address through the
+// sandbox network stack.
+type DialOpts struct {
+	// FilePayload contains one stream fd the connection is forwarded to.
+	urpc.FilePayload
+
+	// ContainerID is the container the connection is made for.
+	ContainerID string
+
+	// Address is the "ip:port" address to connect to over TCP.
+	Address string
+}
+
+// Dial connects to an address through the sandbox network stack, as if the
+// connection was made by the container, and forwards it to the passed file.
+func (cm *containerManager) Dial(opts *DialOpts, _ *struct{}) error {
+	log.Debugf("containerManager.Dial, cid: %s, address: %s", opts.ContainerID, opts.Address)
+	return cm.l.dial(opts)
+}
+
+// ListenOpts contains options for listening on an address in the sandbox
+// network stack.
+type ListenOpts struct {
+	// ContainerID is the container the listener is created for.
+	ContainerID string
+
+	// Address is the "ip:port" address to listen on for TCP connections.
+	// The IP may be empty to listen on all IPv4 addresses, and the port may
+	// be zero to pick one.
+	Address string
+}
+
+// ListenResult is the result of Listen.
+type ListenResult struct {
+	// ID identifies the listener in Accept and CloseListener.
+	ID uint64
+
+	// Address is the address the listener is bound to.
+	Address string
+}
+
+// Listen listens on an address in the sandbox network stack, as if the
+// listener belonged to the container.
+func (cm *containerManager) Listen(opts *ListenOpts, res *ListenResult) error {
+	log.Debugf("containerManager.Listen, cid: %s, address: %s", opts.ContainerID, opts.Address)
+	r, err := cm.l.listen(opts)
+	if err != nil {
+		return err
+	}
+	*res = *r
+	return nil
+}
+
+// AcceptOpts contains options for accepting a connection.
+type AcceptOpts struct {
+	// FilePayload contains one stream fd the connection is forwarded to.
+	urpc.FilePayload
+
+	// ContainerID is the container the listener was created for.
+	ContainerID string
+
+	// ID is the listener returned by Listen.
+	ID uint64
+}
+
+// AcceptResult is the result of Accept.
+type AcceptResult struct {
+	// Address is the address of the peer.
+	Address string
+}
+
+// Accept waits for a connection on a listener created by Listen and forwards
+// it to the passed file.
+func (cm *containerManager) Accept(opts *AcceptOpts, res *AcceptResult) error {
+	log.Debugf("containerManager.Accept, cid: %s, listener: %d", opts.ContainerID, opts.ID)
+	r, err := cm.l.accept(opts)
+	if err != nil {
+		return err
+	}
+	*res = *r
+	return nil
+}
+
+// CloseListener closes a listener created by Listen.
+func (cm *containerManager) CloseListener(id *uint64, _ *struct{}) error {
+	log.Debugf("containerManager.CloseListener, listener: %d", *id)
+	return cm.l.closeListener(*id)
+}
+
 // RestoreOpts contains options related to restoring a container's file system.
 type RestoreOpts struct {
 	// FilePayload contains the state file to be restored, followed by the
-	// platform device file if necessary.
+	// pre-copied memory file if Precopy is true, followed by the platform
+	// device file if necessary.
 	urpc.FilePayload
 
+	// Precopy indicates that the state was saved by a migration, after
+	// pre-copying memory to the file following the state file.
+	Precopy bool
+
 	// SandboxID contains the ID of the sandbox.
 	SandboxID string
+
+	// Env contains environment variables that changed since the checkpoint
+	// was taken. The restored processes keep their environment, so these
+	// are written to EnvFile instead.
+	Env []string
+
+	// EnvFile is the path inside the root container where Env is written
+	// to. Ignored if Env is empty.
+	EnvFile string
 }
 
 // Restore loads a container from a statefile.
 // The container's current kernel is destroyed, a restore environment is
 // created, and the kernel is recreated with the restore state file. The
 // container then sends the signal to start.
+//
+// The sandbox must be idle: booted, but with its root container not started.
+// This allows sandboxes to be booted ahead of time, e.g. in a pool, and
+// restored into when the workload is known.
 func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	log.Debugf("containerManager.Restore")
+	if err := cm.claimRoot(); err != nil {
+		return err
+	}
 
-	var specFile, deviceFile *os.File
-	switch numFiles := len(o.Files); numFiles {
-	case 2:
+	files := o.Files
+	if len(files) == 0 {
+		return fmt.Errorf("at least one file must be passed to Restore")
+	}
+	specFile, files := files[0], files[1:]
+	var precopyFile, deviceFile *os.File
+	if o.Precopy {
+		if len(files) == 0 {
+			return fmt.Errorf("pre-copied memory file must be passed to Restore")
+		}
+		precopyFile, files = files[0], files[1:]
+	}
+	switch len(files) {
+	case 1:
 		// The device file is donated to the platform.
 		// Can't take ownership away from os.File. dup them to get a new FD.
-		fd, err := unix.Dup(int(o.Files[1].Fd()))
+		fd, err := unix.Dup(int(files[0].Fd()))
 		if err != nil {
 			return fmt.Errorf("failed to dup file: %v", err)
 		}
 		deviceFile = os.NewFile(uintptr(fd), "platform device")
-		fallthrough
-	case 1:
-		specFile = o.Files[0]
 	case 0:
-		return fmt.Errorf("at least one file must be passed to Restore")
 	default:
-		return fmt.Errorf("at most two files may be passed to Restore")
+		return fmt.Errorf("too many files passed to Restore")
 	}
 
+	info, err := specFile.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return fmt.Errorf("file cannot be empty")
+	}
+	progress := state.NewLoadProgress(info.Size())
+	cm.restoreMu.Lock()
+	cm.restoreProgress = progress
+	cm.restoreMu.Unlock()
+	defer func() {
+		cm.restoreMu.Lock()
+		cm.restoreProgress = nil
+		cm.restoreMu.Unlock()
+	}()
+
 	// Pause the kernel while we build a new one.
 	cm.l.k.Pause()
 
@@ -459,7 +814,7 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	k := &kernel.Kernel{
 		Platform: p,
 	}
-	mf, err := createMemoryFile()
+	mf, err := createMemoryFile(cm.l.memoryPressureFile)
 	if err != nil {
 		return fmt.Errorf("creating memory file: %v", err)
 	}
@@ -469,7 +824,7 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 
 	// Set up the restore environment.
 	ctx := k.SupervisorContext()
-	mntr := newContainerMounter(&cm.l.root, cm.l.k, cm.l.mountHints, cm.l.productName, o.SandboxID)
+	mntr := newContainerMounter(&cm.l.root, o.SandboxID, cm.l.k, cm.l.mountHints, cm.l.productName, o.SandboxID)
 	ctx, err = mntr.configureRestore(ctx)
 	if err != nil {
 		return fmt.Errorf("configuring filesystem restore: %v", err)
@@ -479,13 +834,6 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	if eps, ok := networkStack.(*netstack.Stack); ok {
 		stack.StackFromEnv = eps.Stack // FIXME(b/36201077)
 	}
-	info, err := specFile.Stat()
-	if err != nil {
-		return err
-	}
-	if info.Size() == 0 {
-		return fmt.Errorf("file cannot be empty")
-	}
 
 	if cm.l.root.conf.ProfileEnable {
 		// pprof.Initialize opens /proc/self/maps, so has to be called before
@@ -499,11 +847,25 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	}
 
 	// Load the state.
-	loadOpts := state.LoadOpts{Source: specFile}
+	loadOpts := state.LoadOpts{Source: specFile, Progress: progress, PrecopyFile: precopyFile}
 	if err := loadOpts.Load(ctx, k, nil, networkStack, time.NewCalibratedClocks(), &vfs.CompleteRestoreOptions{}); err != nil {
 		return err
 	}
 
+	// The image may be restored into a sandbox with a different spec than the
+	// one it was taken from, e.g. by "runsc clone". Apply the fixups that are
+	// not derived from the host environment.
+	if hostname := cm.l.root.spec.Hostname; hostname != "" {
+		k.RootUTSNamespace().SetHostName(hostname)
+	}
+	setAbstractImports(k, cm.l.root.conf.AbstractUDSImports())
+	cm.l.restoreVeths()
+	if len(o.Env) > 0 {
+		if err := writeRestoreEnv(k, o.EnvFile, o.Env); err != nil {
+			return fmt.Errorf("writing environment to %q: %w", o.EnvFile, err)
+		}
+	}
+
 	// Since we have a new kernel we also must make a new watchdog.
 	dogOpts := watchdog.DefaultOpts
 	dogOpts.TaskTimeoutAction = cm.l.root.conf.WatchdogAction
@@ -536,6 +898,46 @@ func (cm *containerManager) Restore(o *RestoreOpts, _ *struct{}) error {
 	return nil
 }
 
+// writeRestoreEnv writes env to the file at filename in the mount namespace of
+// the restored init process, one variable per line.
+func writeRestoreEnv(k *kernel.Kernel, filename string, env []string) error {
+	if !path.IsAbs(filename) {
+		return fmt.Errorf("path must be absolute")
+	}
+	initTG := k.GlobalInit()
+	if initTG == nil {
+		return fmt.Errorf("no init process")
+	}
+	mntns := initTG.Leader().MountNamespace()
+	if mntns == nil {
+		return fmt.Errorf("init process has no mount namespace")
+	}
+	ctx := k.SupervisorContext()
+	creds := auth.NewRootCredentials(initTG.Leader().UserNamespace())
+	root := mntns.Root()
+	root.IncRef()
+	defer root.DecRef(ctx)
+
+	if err := k.VFS().MkdirAllAt(ctx, path.Dir(filename), root, creds, &vfs.MkdirOptions{Mode: 0o755}, true /* mustBeDir */); err != nil {
+		return err
+	}
+	fd, err := k.VFS().OpenAt(ctx, creds, &vfs.PathOperation{
+		Root:  root,
+		Start: root,
+		Path:  fspath.Parse(filename),
+	}, &vfs.OpenOptions{
+		Flags: linux.O_WRONLY | linux.O_CREAT | linux.O_TRUNC,
+		Mode:  0o644,
+	})
+	if err != nil {
+		return err
+	}
+	defer fd.DecRef(ctx)
+	data := []byte(strings.Join(env, "\n") + "\n")
+	_, err = fd.Write(ctx, usermem.BytesIOSequence(data), vfs.WriteOptions{})
+	return err
+}
+
 // Wait waits for the init process in the given container.
 func (cm *containerManager) Wait(cid *string, waitStatus *uint32) error {
 	log.Debugf("containerManager.Wait, cid: %s", *cid)
@@ -648,6 +1050,13 @@ func (cm *containerManager) DeleteTraceSession(name *string, _ *struct{}) error
 	return seccheck.Delete(*name)
 }
 
+// UpdateTraceSession replaces the points of an existing trace session, keeping
+// its sinks.
+func (cm *containerManager) UpdateTraceSession(config *seccheck.SessionConfig, _ *struct{}) error {
+	log.Debugf("containerManager.UpdateTraceSession: config: %+v", config)
+	return seccheck.Update(config)
+}
+
 // ListTraceSessions lists trace sessions.
 func (cm *containerManager) ListTraceSessions(_ *struct{}, out *[]seccheck.SessionConfig) error {
 	log.Debugf("containerManager.ListTraceSessions")
@@ -672,3 +1081,82 @@ func (cm *containerManager) ProcfsDump(_ *struct{}, out *[]procfs.ProcessProcfsD
 	}
 	return nil
 }
+
+// ExportRootfsOpts contains options for exporting the root filesystem of a
+// container.
+type ExportRootfsOpts struct {
+	// FilePayload contains the file the archive is written to.
+	urpc.FilePayload
+
+	// ContainerID is the container whose root filesystem is exported.
+	ContainerID string
+}
+
+// ExportRootfs writes the changes made to the root filesystem of a container,
+// which must be overlaid, to a file as an OCI image layer tar archive.
+func (cm *containerManager) ExportRootfs(opts *ExportRootfsOpts, _ *struct{}) error {
+	log.Debugf("containerManager.ExportRootfs, cid: %s", opts.ContainerID)
+	if len(opts.Files) != 1 {
+		return fmt.Errorf("wrong number of files in opts, want 1, got %d", len(opts.Files))
+	}
+	out := opts.Files[0]
+	defer out.Close()
+	return cm.l.exportRootfs(opts.ContainerID, out)
+}
+
+// RestoreProgress is the progress of a restore.
+type RestoreProgress struct {
+	// InProgress is true if a restore is in progress. The other fields are
+	// only set if it is.
+	InProgress bool `json:"in_progress"`
+
+	state.LoadStats
+}
+
+// RestoreProgress returns the progress of the restore in progress, if any.
+func (cm *containerManager) RestoreProgress(_ *struct{}, out *RestoreProgress) error {
+	cm.restoreMu.Lock()
+	defer cm.restoreMu.Unlock()
+	if cm.restoreProgress == nil {
+		*out = RestoreProgress{}
+		return nil
+	}
+	*out = RestoreProgress{
+		InProgress: true,
+		LoadStats:  cm.restoreProgress.Stats(),
+	}
+	return nil
+}
+
+// RestoreCancel cancels the restore in progress. The Restore call then fails,
+// and the sandbox can only be destroyed.
+func (cm *containerManager) RestoreCancel(_ *struct{}, _ *struct{}) error {
+	log.Debugf("containerManager.RestoreCancel")
+	cm.restoreMu.Lock()
+	defer cm.restoreMu.Unlock()
+	if cm.restoreProgress == nil {
+		return fmt.Errorf("no restore in progress")
+	}
+	cm.restoreProgress.Cancel()
+	return nil
+}
+
+// SetEgressPolicyArgs are arguments to the SetEgressPolicy method.
+type SetEgressPolicyArgs struct {
+	// Policy is the new egress policy. If nil, egress isn't restricted.
+	Policy *EgressPolicy
+}
+
+// SetEgressPolicy replaces the egress policy of the sandbox. It applies to
+// connections made and datagrams sent afterwards.
+func (cm *containerManager) SetEgressPolicy(args *SetEgressPolicyArgs, _ *struct{}) error {
+	log.Debugf("containerManager.SetEgressPolicy")
+	return cm.l.setEgressPolicy(args.Policy)
+}
+
+// StartupPhases returns the startup phases recorded in the sandbox.
+func (cm *containerManager) StartupPhases(_ *struct{}, out *[]StartupPhase) error {
+	log.Debugf("containerManager.StartupPhases")
+	*out = cm.l.startup.Phases()
+	return nil
+}
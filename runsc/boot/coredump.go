@@ -0,0 +1,186 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/eventchannel"
+	pb "github.com/talismancer/gvisor-ligolo/pkg/eventchannel/eventchannel_go_proto"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/metric"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"golang.org/x/sys/unix"
+)
+
+// coreDumpMetadataSuffix is appended to the name of a core dump to form the
+// name of its metadata file.
+const coreDumpMetadataSuffix = ".json"
+
+var coreDumpsWritten = metric.MustCreateNewUint64Metric("/coredumps/written", false /* sync */, "Number of core dumps written to the host.")
+
+// coreDumpMetadata is written as JSON next to each core dump, and emitted in a
+// DebugEvent.
+type coreDumpMetadata struct {
+	Path        string    `json:"path"`
+	Size        int64     `json:"size"`
+	Truncated   bool      `json:"truncated,omitempty"`
+	ContainerID string    `json:"container_id"`
+	PID         int32     `json:"pid"`
+	TID         int32     `json:"tid"`
+	UID         uint32    `json:"uid"`
+	GID         uint32    `json:"gid"`
+	Signal      int       `json:"signal"`
+	FaultAddr   uint64    `json:"fault_addr,omitempty"`
+	Comm        string    `json:"comm"`
+	Executable  string    `json:"executable,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// coreDumper implements kernel.CoreDumper by writing core dumps to a directory
+// donated by the host.
+type coreDumper struct {
+	dir     string
+	dirFD   int
+	pattern string
+}
+
+var _ kernel.CoreDumper = (*coreDumper)(nil)
+
+// CreateCoreFile implements kernel.CoreDumper.CreateCoreFile.
+func (d *coreDumper) CreateCoreFile(info *kernel.CoreDumpInfo) (io.WriteCloser, error) {
+	name := expandCorePattern(d.pattern, info)
+	if name == "" || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid core dump name %q", name)
+	}
+	fd, err := unix.Openat(d.dirFD, name, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("creating %q: %w", name, err)
+	}
+	log.Infof("Writing core dump of PID %d in container %q to %q", info.PID, info.ContainerID, name)
+	return &coreFile{
+		d:    d,
+		name: name,
+		file: os.NewFile(uintptr(fd), name),
+		info: info,
+	}, nil
+}
+
+// coreFile is a core dump being written.
+type coreFile struct {
+	d    *coreDumper
+	name string
+	file *os.File
+	info *kernel.CoreDumpInfo
+	size int64
+}
+
+// Write implements io.Writer.Write.
+func (f *coreFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close implements io.Closer.Close. It writes the metadata of the dump.
+func (f *coreFile) Close() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	coreDumpsWritten.Increment()
+
+	md := coreDumpMetadata{
+		Path:        f.d.dir + "/" + f.name,
+		Size:        f.size,
+		Truncated:   uint64(f.size) >= f.info.Limit,
+		ContainerID: f.info.ContainerID,
+		PID:         int32(f.info.PID),
+		TID:         int32(f.info.TID),
+		UID:         f.info.UID,
+		GID:         f.info.GID,
+		Signal:      int(f.info.Signal),
+		FaultAddr:   f.info.FaultAddr,
+		Comm:        f.info.Comm,
+		Executable:  f.info.Executable,
+		Time:        f.info.Time,
+	}
+	text, err := json.Marshal(&md)
+	if err != nil {
+		return fmt.Errorf("marshaling core dump metadata: %w", err)
+	}
+	eventchannel.Emit(&pb.DebugEvent{Name: "core_dump", Text: string(text)})
+
+	name := f.name + coreDumpMetadataSuffix
+	fd, err := unix.Openat(f.d.dirFD, name, unix.O_WRONLY|unix.O_CREAT|unix.O_TRUNC|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0600)
+	if err != nil {
+		return fmt.Errorf("creating %q: %w", name, err)
+	}
+	mdFile := os.NewFile(uintptr(fd), name)
+	defer mdFile.Close()
+	if _, err := mdFile.Write(append(text, '\n')); err != nil {
+		return fmt.Errorf("writing %q: %w", name, err)
+	}
+	return nil
+}
+
+// expandCorePattern returns the core dump name for a pattern, which supports
+// the specifiers of core_pattern(5). Unknown specifiers are dropped, and
+// slashes in expanded values are replaced with '!'.
+func expandCorePattern(pattern string, info *kernel.CoreDumpInfo) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c != '%' || i == len(pattern)-1 {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		var v string
+		switch pattern[i] {
+		case '%':
+			v = "%"
+		case 'c':
+			v = strconv.FormatUint(info.Limit, 10)
+		case 'd':
+			v = "1"
+		case 'e':
+			v = info.Comm
+		case 'E':
+			v = info.Executable
+		case 'g':
+			v = strconv.FormatUint(uint64(info.GID), 10)
+		case 'h':
+			v = info.Hostname
+		case 'i', 'I':
+			v = strconv.FormatInt(int64(info.TID), 10)
+		case 'p', 'P':
+			v = strconv.FormatInt(int64(info.PID), 10)
+		case 's':
+			v = strconv.Itoa(int(info.Signal))
+		case 't':
+			v = strconv.FormatInt(info.Time.Unix(), 10)
+		case 'u':
+			v = strconv.FormatUint(uint64(info.UID), 10)
+		}
+		b.WriteString(strings.ReplaceAll(v, "/", "!"))
+	}
+	return b.String()
+}
@@ -15,6 +15,7 @@
 package boot
 
 import (
+	"github.com/talismancer/gvisor-ligolo/pkg/fdaudit"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 )
 
@@ -27,3 +28,21 @@ func (*debug) Stacks(_ *struct{}, stacks *string) error {
 	*stacks = string(buf)
 	return nil
 }
+
+// HostFDs returns the host FD table of the sandbox process, with each FD
+// annotated by the subsystem holding it.
+func (*debug) HostFDs(_ *struct{}, out *[]fdaudit.Entry) error {
+	entries, err := fdaudit.Table()
+	if err != nil {
+		return err
+	}
+	*out = entries
+	return nil
+}
+
+// Tunables returns the current values of the knobs that can be set with
+// --sentry-tunables, by name.
+func (*debug) Tunables(_ *struct{}, out *map[string]string) error {
+	*out = sentryTunableValues()
+	return nil
+}
@@ -0,0 +1,441 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/metric"
+	"github.com/talismancer/gvisor-ligolo/pkg/rand"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/adapters/gonet"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv4"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv6"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/tcp"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/udp"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// egressResolveTimeout bounds the resolution of the host names of egress
+	// rules, which blocks the connecting task.
+	egressResolveTimeout = 2 * time.Second
+
+	// egressMinTTL and egressMaxTTL bound how long resolved host names of
+	// egress rules are cached.
+	egressMinTTL = 5 * time.Second
+	egressMaxTTL = 5 * time.Minute
+)
+
+var (
+	egressDenied = metric.MustCreateNewUint64Metric("/network/egress_denied", false /* sync */, "Number of connections and datagrams denied by the egress policy.")
+
+	egressDeniedLogger = log.BasicRateLimitedLogger(time.Minute)
+)
+
+// EgressPolicy restricts the destinations containers of the sandbox may
+// connect or send datagrams to, e.g. to keep them from reaching anything but
+// their dependencies without configuring a host firewall. It's enforced by
+// netstack for the root network namespace, and doesn't apply to loopback
+// destinations. Packet sockets bypass it.
+//
+// A destination matching a Deny rule is denied. Otherwise, it's allowed if
+// Allow is empty or if it matches an Allow rule. Denied connections fail with
+// EPERM.
+type EgressPolicy struct {
+	// Allow lists the allowed destinations. If empty, all destinations that
+	// aren't denied are allowed.
+	Allow []EgressRule `json:"allow,omitempty"`
+
+	// Deny lists the denied destinations.
+	Deny []EgressRule `json:"deny,omitempty"`
+
+	// Resolver is the "ip:port" address of the DNS server used to resolve
+	// the host names of rules, through the sandbox network. It's required if
+	// a rule has a host name.
+	Resolver string `json:"resolver,omitempty"`
+}
+
+// EgressRule matches destinations. Exactly one of CIDR and Host must be set.
+type EgressRule struct {
+	// CIDR matches destination addresses in a subnet, e.g. "10.0.0.0/8". A
+	// single address matches itself.
+	CIDR string `json:"cidr,omitempty"`
+
+	// Host matches the addresses a host name resolves to when the
+	// connection is made.
+	Host string `json:"host,omitempty"`
+
+	// Ports are the destination ports matched, e.g. "443" or "8000-8100".
+	// All ports are matched if empty.
+	Ports []string `json:"ports,omitempty"`
+
+	// Protocol is the transport protocol matched, "tcp" or "udp". All
+	// protocols are matched if empty.
+	Protocol string `json:"protocol,omitempty"`
+}
+
+// egressRule is a parsed EgressRule.
+type egressRule struct {
+	subnet   *net.IPNet
+	host     string
+	ports    [][2]uint16
+	proto    tcpip.TransportProtocolNumber
+	anyProto bool
+}
+
+// egressPolicy is a parsed EgressPolicy.
+type egressPolicy struct {
+	allow    []egressRule
+	deny     []egressRule
+	resolver tcpip.FullAddress
+}
+
+func parseEgressRules(rules []EgressRule) ([]egressRule, error) {
+	var parsed []egressRule
+	for i, r := range rules {
+		var pr egressRule
+		switch {
+		case r.CIDR != "" && r.Host != "":
+			return nil, fmt.Errorf("rule %d: cidr and host are mutually exclusive", i)
+		case r.CIDR != "":
+			if !strings.Contains(r.CIDR, "/") {
+				ip := net.ParseIP(r.CIDR)
+				if ip == nil {
+					return nil, fmt.Errorf("rule %d: invalid address %q", i, r.CIDR)
+				}
+				bits := 8 * net.IPv6len
+				if ip4 := ip.To4(); ip4 != nil {
+					ip, bits = ip4, 8*net.IPv4len
+				}
+				pr.subnet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+			} else {
+				_, subnet, err := net.ParseCIDR(r.CIDR)
+				if err != nil {
+					return nil, fmt.Errorf("rule %d: %w", i, err)
+				}
+				pr.subnet = subnet
+			}
+		case r.Host != "":
+			pr.host = strings.TrimSuffix(strings.ToLower(r.Host), ".")
+		default:
+			return nil, fmt.Errorf("rule %d: cidr or host must be set", i)
+		}
+		for _, p := range r.Ports {
+			ports, err := parsePortRange(p)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			pr.ports = append(pr.ports, ports)
+		}
+		switch r.Protocol {
+		case "":
+			pr.anyProto = true
+		case "tcp":
+			pr.proto = tcp.ProtocolNumber
+		case "udp":
+			pr.proto = udp.ProtocolNumber
+		default:
+			return nil, fmt.Errorf("rule %d: invalid protocol %q, must be tcp or udp", i, r.Protocol)
+		}
+		parsed = append(parsed, pr)
+	}
+	return parsed, nil
+}
+
+// parsePortRange parses a port, e.g. "443", or an inclusive port range, e.g.
+// "8000-8100".
+func parsePortRange(p string) ([2]uint16, error) {
+	start, end, found := strings.Cut(p, "-")
+	if !found {
+		end = start
+	}
+	first, err := strconv.ParseUint(start, 10, 16)
+	if err != nil {
+		return [2]uint16{}, fmt.Errorf("invalid port %q", p)
+	}
+	last, err := strconv.ParseUint(end, 10, 16)
+	if err != nil || last < first {
+		return [2]uint16{}, fmt.Errorf("invalid port range %q", p)
+	}
+	return [2]uint16{uint16(first), uint16(last)}, nil
+}
+
+func parseEgressPolicy(p *EgressPolicy) (*egressPolicy, error) {
+	allow, err := parseEgressRules(p.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	deny, err := parseEgressRules(p.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	ep := &egressPolicy{allow: allow, deny: deny}
+	hasHost := false
+	for _, r := range append(allow, deny...) {
+		hasHost = hasHost || r.host != ""
+	}
+	if p.Resolver != "" {
+		if ep.resolver, err = parseFullAddress(p.Resolver); err != nil {
+			return nil, fmt.Errorf("invalid resolver %q: %w", p.Resolver, err)
+		}
+		if ep.resolver.Addr.Len() == 0 || ep.resolver.Port == 0 {
+			return nil, fmt.Errorf("invalid resolver %q: address and port are required", p.Resolver)
+		}
+	} else if hasHost {
+		return nil, fmt.Errorf("resolver is required by rules with a host name")
+	}
+	return ep, nil
+}
+
+// egressFilter implements netstack.EgressFilter with an EgressPolicy, which
+// may be replaced at any time.
+type egressFilter struct {
+	// stack is the stack host names are resolved through.
+	stack *stack.Stack
+
+	// policy is the current policy, or nil if egress isn't restricted.
+	policy atomic.Pointer[egressPolicy]
+
+	// mu protects names.
+	mu sync.Mutex
+
+	// names caches the addresses host names resolved to.
+	//
+	// +checklocks:mu
+	names map[string]*resolvedName
+}
+
+var _ netstack.EgressFilter = (*egressFilter)(nil)
+
+// resolvedName holds the addresses a host name resolved to.
+type resolvedName struct {
+	addrs   []net.IP
+	expires time.Time
+}
+
+func newEgressFilter(s *stack.Stack) *egressFilter {
+	return &egressFilter{
+		stack: s,
+		names: make(map[string]*resolvedName),
+	}
+}
+
+// setPolicy replaces the policy of f. A nil policy lifts all restrictions.
+func (f *egressFilter) setPolicy(p *EgressPolicy) error {
+	if p == nil {
+		f.policy.Store(nil)
+		log.Infof("Egress policy removed")
+		return nil
+	}
+	ep, err := parseEgressPolicy(p)
+	if err != nil {
+		return err
+	}
+	f.policy.Store(ep)
+	f.mu.Lock()
+	f.names = make(map[string]*resolvedName)
+	f.mu.Unlock()
+	log.Infof("Egress policy set: %d allow rules, %d deny rules", len(ep.allow), len(ep.deny))
+	return nil
+}
+
+// AllowEgress implements netstack.EgressFilter.AllowEgress.
+func (f *egressFilter) AllowEgress(proto tcpip.TransportProtocolNumber, addr tcpip.FullAddress) bool {
+	p := f.policy.Load()
+	if p == nil {
+		return true
+	}
+	ip := net.IP(addr.Addr.AsSlice())
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if len(ip) == 0 || ip.IsLoopback() || ip.IsUnspecified() {
+		return true
+	}
+	for i := range p.deny {
+		if f.matches(p, &p.deny[i], proto, ip, addr.Port) {
+			f.deny(ip, addr.Port)
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for i := range p.allow {
+		if f.matches(p, &p.allow[i], proto, ip, addr.Port) {
+			return true
+		}
+	}
+	f.deny(ip, addr.Port)
+	return false
+}
+
+func (f *egressFilter) deny(ip net.IP, port uint16) {
+	egressDenied.Increment()
+	egressDeniedLogger.Infof("Egress to %s denied by the egress policy", net.JoinHostPort(ip.String(), strconv.Itoa(int(port))))
+}
+
+// matches returns true if rule r of policy p matches the destination.
+func (f *egressFilter) matches(p *egressPolicy, r *egressRule, proto tcpip.TransportProtocolNumber, ip net.IP, port uint16) bool {
+	if !r.anyProto && r.proto != proto {
+		return false
+	}
+	if len(r.ports) > 0 {
+		inRange := false
+		for _, pr := range r.ports {
+			inRange = inRange || (port >= pr[0] && port <= pr[1])
+		}
+		if !inRange {
+			return false
+		}
+	}
+	if r.subnet != nil {
+		return r.subnet.Contains(ip)
+	}
+	for _, a := range f.resolve(p, r.host) {
+		if a.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns the addresses host resolves to, from the cache if they
+// haven't expired. Resolution failures resolve to no address.
+func (f *egressFilter) resolve(p *egressPolicy, host string) []net.IP {
+	f.mu.Lock()
+	if rn, ok := f.names[host]; ok && time.Now().Before(rn.expires) {
+		f.mu.Unlock()
+		return rn.addrs
+	}
+	f.mu.Unlock()
+
+	var (
+		addrs  []net.IP
+		minTTL = egressMaxTTL
+	)
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		a, ttl, err := f.lookup(p.resolver, host, qtype)
+		if err != nil {
+			log.Warningf("Egress policy: resolving %q: %v", host, err)
+			continue
+		}
+		addrs = append(addrs, a...)
+		if ttl < minTTL {
+			minTTL = ttl
+		}
+	}
+	if minTTL < egressMinTTL {
+		minTTL = egressMinTTL
+	}
+
+	f.mu.Lock()
+	f.names[host] = &resolvedName{addrs: addrs, expires: time.Now().Add(minTTL)}
+	f.mu.Unlock()
+	return addrs
+}
+
+// lookup queries resolver for the records of type qtype of host over UDP,
+// through the sandbox network. It returns the addresses found and the lowest
+// TTL of their records.
+func (f *egressFilter) lookup(resolver tcpip.FullAddress, host string, qtype dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	var idBuf [2]byte
+	if _, err := rand.Read(idBuf[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.LittleEndian.Uint16(idBuf[:])
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	netProto := ipv6.ProtocolNumber
+	if resolver.Addr.Len() == header.IPv4AddressSize {
+		netProto = ipv4.ProtocolNumber
+	}
+	conn, err := gonet.DialUDP(f.stack, nil, &resolver, netProto)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(egressResolveTimeout)); err != nil {
+		return nil, 0, err
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, 0, err
+		}
+		var resp dnsmessage.Message
+		if err := resp.Unpack(buf[:n]); err != nil || resp.Header.ID != id || !resp.Header.Response {
+			// Not the response to the query.
+			continue
+		}
+		if resp.Header.RCode != dnsmessage.RCodeSuccess {
+			return nil, 0, fmt.Errorf("DNS error: %v", resp.Header.RCode)
+		}
+		var (
+			addrs []net.IP
+			ttl   = egressMaxTTL
+		)
+		for _, a := range resp.Answers {
+			switch body := a.Body.(type) {
+			case *dnsmessage.AResource:
+				addrs = append(addrs, net.IP(body.A[:]))
+			case *dnsmessage.AAAAResource:
+				addrs = append(addrs, net.IP(body.AAAA[:]))
+			default:
+				continue
+			}
+			if d := time.Duration(a.Header.TTL) * time.Second; d < ttl {
+				ttl = d
+			}
+		}
+		return addrs, ttl, nil
+	}
+}
+
+// setEgressPolicy replaces the egress policy of the sandbox.
+func (l *Loader) setEgressPolicy(p *EgressPolicy) error {
+	if l.egress == nil {
+		return fmt.Errorf("egress policies require netstack")
+	}
+	return l.egress.setPolicy(p)
+}
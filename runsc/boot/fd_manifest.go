@@ -0,0 +1,118 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FDManifest maps the names of the resources donated to the sandbox process
+// to their FDs. A resource may have multiple FDs, in which case their order is
+// meaningful; an FD of -1 marks a missing file. See donation.Agency.
+type FDManifest map[string][]int
+
+// ReadFDManifest reads the manifest from f. The file isn't consumed, so the
+// manifest can be read again, e.g. after the process re-executes itself.
+func ReadFDManifest(f *os.File) (FDManifest, error) {
+	data, err := io.ReadAll(io.NewSectionReader(f, 0, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading FD manifest: %w", err)
+	}
+	var m FDManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing FD manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Take removes the resource name from m, and returns its FDs.
+func (m FDManifest) Take(name string) []int {
+	fds := m[name]
+	delete(m, name)
+	return fds
+}
+
+// TakeOne is similar to Take, for resources with a single FD. It returns -1
+// if the resource wasn't donated.
+func (m FDManifest) TakeOne(name string) (int, error) {
+	fds := m.Take(name)
+	switch len(fds) {
+	case 0:
+		return -1, nil
+	case 1:
+		return fds[0], nil
+	default:
+		return -1, fmt.Errorf("donated resource %q has %d FDs, want 1", name, len(fds))
+	}
+}
+
+// donatedFD returns a setter for a resource with a single FD.
+func donatedFD(set func(args *Args, fd int)) func(*Args, []int) error {
+	return func(args *Args, fds []int) error {
+		if len(fds) != 1 {
+			return fmt.Errorf("got %d FDs, want 1", len(fds))
+		}
+		set(args, fds[0])
+		return nil
+	}
+}
+
+// donatedFDs maps the names of the resources donated to the sandbox process
+// that are passed to the Loader to the Args fields they are stored in. New
+// resources only need to be added here, and donated by runsc/sandbox under the
+// same name.
+var donatedFDs = map[string]func(args *Args, fds []int) error{
+	"controller-fd":   donatedFD(func(args *Args, fd int) { args.ControllerFD = fd }),
+	"grpc-control-fd": donatedFD(func(args *Args, fd int) { args.GRPCControlFD = fd }),
+	"device-fd": donatedFD(func(args *Args, fd int) {
+		if fd >= 0 {
+			args.Device = os.NewFile(uintptr(fd), "platform device")
+		}
+	}),
+	"io-fds":                  func(args *Args, fds []int) error { args.GoferFDs = fds; return nil },
+	"stdio-fds":               func(args *Args, fds []int) error { args.StdioFDs = fds; return nil },
+	"exec-fd":                 donatedFD(func(args *Args, fd int) { args.ExecFD = fd }),
+	"overlay-filestore-fds":   func(args *Args, fds []int) error { args.OverlayFilestoreFDs = fds; return nil },
+	"user-log-fd":             donatedFD(func(args *Args, fd int) { args.UserLogFD = fd }),
+	"pod-init-config-fd":      donatedFD(func(args *Args, fd int) { args.PodInitConfigFD = fd }),
+	"sink-fds":                func(args *Args, fds []int) error { args.SinkFDs = fds; return nil },
+	"service-fds":             func(args *Args, fds []int) error { args.ServiceFDs = fds; return nil },
+	"flight-recorder-fd":      donatedFD(func(args *Args, fd int) { args.FlightRecorderFD = fd }),
+	"auto-checkpoint-dir-fd":  donatedFD(func(args *Args, fd int) { args.AutoCheckpointDirFD = fd }),
+	"core-dump-dir-fd":        donatedFD(func(args *Args, fd int) { args.CoreDumpDirFD = fd }),
+	"port-reservation-dir-fd": donatedFD(func(args *Args, fd int) { args.PortReservationDirFD = fd }),
+	"memory-pressure-fd":      donatedFD(func(args *Args, fd int) { args.MemoryPressureFD = fd }),
+	"entropy-fd":              donatedFD(func(args *Args, fd int) { args.EntropyFD = fd }),
+	"tls-intercept-ca-fd":     donatedFD(func(args *Args, fd int) { args.TLSInterceptCAFD = fd }),
+	"tls-intercept-roots-fd":  donatedFD(func(args *Args, fd int) { args.TLSInterceptRootsFD = fd }),
+}
+
+// ApplyFDManifest sets the FDs of the resources in m to args. Resources that
+// aren't passed to the Loader must have been taken from m already.
+func (args *Args) ApplyFDManifest(m FDManifest) error {
+	for name, fds := range m {
+		set, ok := donatedFDs[name]
+		if !ok {
+			return fmt.Errorf("unknown donated resource %q", name)
+		}
+		if err := set(args, fds); err != nil {
+			return fmt.Errorf("donated resource %q: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -368,6 +368,64 @@ func controlServerFilters(fd int) seccomp.SyscallRules {
 	}
 }
 
+// grpcControlServerFilters contains syscalls that are needed by the gRPC
+// control server listening on host socket fd.
+func grpcControlServerFilters(fd int) seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_ACCEPT4: []seccomp.Rule{
+			{
+				seccomp.EqualTo(fd),
+			},
+		},
+		// Used by package net to get the address of accepted connections.
+		unix.SYS_GETSOCKNAME: {},
+		unix.SYS_GETSOCKOPT: []seccomp.Rule{
+			{
+				seccomp.MatchAny{},
+				seccomp.EqualTo(unix.SOL_SOCKET),
+				seccomp.EqualTo(unix.SO_PEERCRED),
+			},
+		},
+		// Used to receive the files donated on connections.
+		unix.SYS_RECVMSG: []seccomp.Rule{
+			{
+				seccomp.MatchAny{},
+				seccomp.MatchAny{},
+				seccomp.EqualTo(unix.MSG_CMSG_CLOEXEC),
+			},
+		},
+	}
+}
+
+// acceptFilters contains syscalls that are needed to accept connections on
+// host socket fd, e.g. the socket of a service bridged by the sandbox.
+func acceptFilters(fd int) seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_ACCEPT4: []seccomp.Rule{
+			{
+				seccomp.EqualTo(fd),
+			},
+		},
+	}
+}
+
+// abstractUDSImportFilters contains syscalls that are needed to connect to
+// abstract Unix-domain sockets imported from the host.
+func abstractUDSImportFilters() seccomp.SyscallRules {
+	var socketRules []seccomp.Rule
+	for _, stype := range []int{unix.SOCK_STREAM, unix.SOCK_DGRAM, unix.SOCK_SEQPACKET} {
+		socketRules = append(socketRules, seccomp.Rule{
+			seccomp.EqualTo(unix.AF_UNIX),
+			seccomp.EqualTo(stype | unix.SOCK_CLOEXEC),
+			seccomp.EqualTo(0),
+		})
+	}
+	return seccomp.SyscallRules{
+		unix.SYS_SOCKET:  socketRules,
+		unix.SYS_CONNECT: {},
+	}
+}
+
 // hostFilesystemFilters contains syscalls that are needed by directfs.
 func hostFilesystemFilters() seccomp.SyscallRules {
 	// Directfs allows FD-based filesystem syscalls. We deny these syscalls with
@@ -485,3 +543,76 @@ func hostFilesystemFilters() seccomp.SyscallRules {
 		},
 	}
 }
+
+// autoCheckpointFilters contains syscalls that are needed to write periodic
+// checkpoints to the donated checkpoint directory dirFD.
+func autoCheckpointFilters(dirFD int) seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_GETDENTS64: []seccomp.Rule{
+			{
+				seccomp.EqualTo(dirFD),
+				seccomp.MatchAny{},
+				seccomp.MatchAny{},
+			},
+		},
+		unix.SYS_OPENAT: []seccomp.Rule{
+			{
+				seccomp.EqualTo(dirFD),
+				seccomp.MatchAny{},
+				seccomp.MaskedEqual(unix.O_NOFOLLOW, unix.O_NOFOLLOW),
+				seccomp.MatchAny{},
+			},
+		},
+		unix.SYS_RENAMEAT: []seccomp.Rule{
+			{
+				seccomp.EqualTo(dirFD),
+				seccomp.MatchAny{},
+				seccomp.EqualTo(dirFD),
+				seccomp.MatchAny{},
+			},
+		},
+		unix.SYS_UNLINKAT: []seccomp.Rule{
+			{
+				seccomp.EqualTo(dirFD),
+				seccomp.MatchAny{},
+				seccomp.EqualTo(0),
+			},
+		},
+	}
+}
+
+// portReservationFilters contains syscalls that are needed to reserve ports
+// with lock files in a donated directory.
+func portReservationFilters() seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_FLOCK: []seccomp.Rule{
+			{
+				seccomp.NonNegativeFDCheck(),
+				seccomp.EqualTo(unix.LOCK_EX | unix.LOCK_NB),
+			},
+		},
+		unix.SYS_OPENAT: []seccomp.Rule{
+			{
+				seccomp.NonNegativeFDCheck(),
+				seccomp.MatchAny{},
+				seccomp.MaskedEqual(unix.O_NOFOLLOW, unix.O_NOFOLLOW),
+				seccomp.MatchAny{},
+			},
+		},
+	}
+}
+
+// coreDumpFilters contains syscalls that are needed to create core dump files
+// in the donated core dump directory dirFD.
+func coreDumpFilters(dirFD int) seccomp.SyscallRules {
+	return seccomp.SyscallRules{
+		unix.SYS_OPENAT: []seccomp.Rule{
+			{
+				seccomp.EqualTo(dirFD),
+				seccomp.MatchAny{},
+				seccomp.MaskedEqual(unix.O_NOFOLLOW, unix.O_NOFOLLOW),
+				seccomp.MatchAny{},
+			},
+		},
+	}
+}
@@ -23,6 +23,8 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/devices/accel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/devices/nvproxy"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/platform"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/vfio"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/vhost"
 )
 
 // Options are seccomp filter related options.
@@ -34,13 +36,35 @@ type Options struct {
 	ProfileEnable         bool
 	NVProxy               bool
 	TPUProxy              bool
+	AutoCheckpointDirFD   int
+	CoreDumpDirFD         int
+	PortReservation       bool
+	VFIO                  bool
+	VhostNet              bool
 	ControllerFD          int
+	GRPCControlFD         int
+	ServiceFDs            []int
+	AbstractUDSImport     bool
+	AbstractUDSExportFDs  []int
+	HostListenerFDs       []int
 }
 
 // Install seccomp filters based on the given platform.
 func Install(opt Options) error {
 	s := allowedSyscalls
 	s.Merge(controlServerFilters(opt.ControllerFD))
+	if opt.GRPCControlFD >= 0 {
+		s.Merge(grpcControlServerFilters(opt.GRPCControlFD))
+	}
+	for _, fd := range opt.ServiceFDs {
+		s.Merge(acceptFilters(fd))
+	}
+	for _, fd := range opt.AbstractUDSExportFDs {
+		s.Merge(acceptFilters(fd))
+	}
+	for _, fd := range opt.HostListenerFDs {
+		s.Merge(acceptFilters(fd))
+	}
 
 	// Set of additional filters used by -race and -msan. Returns empty
 	// when not enabled.
@@ -54,6 +78,10 @@ func Install(opt Options) error {
 		}
 		s.Merge(hostInetFilters(opt.HostNetworkRawSockets))
 	}
+	if opt.AbstractUDSImport {
+		Report("abstract socket import enabled: syscall filters less restrictive!")
+		s.Merge(abstractUDSImportFilters())
+	}
 	if opt.ProfileEnable {
 		Report("profile enabled: syscall filters less restrictive!")
 		s.Merge(profileFilters())
@@ -62,6 +90,26 @@ func Install(opt Options) error {
 		Report("host filesystem enabled: syscall filters less restrictive!")
 		s.Merge(hostFilesystemFilters())
 	}
+	if opt.AutoCheckpointDirFD >= 0 {
+		Report("auto-checkpoint enabled: syscall filters less restrictive!")
+		s.Merge(autoCheckpointFilters(opt.AutoCheckpointDirFD))
+	}
+	if opt.CoreDumpDirFD >= 0 {
+		Report("core dumps enabled: syscall filters less restrictive!")
+		s.Merge(coreDumpFilters(opt.CoreDumpDirFD))
+	}
+	if opt.PortReservation {
+		Report("port reservation enabled: syscall filters less restrictive!")
+		s.Merge(portReservationFilters())
+	}
+	if opt.VFIO {
+		Report("VFIO network devices enabled: syscall filters less restrictive!")
+		s.Merge(vfio.Filters())
+	}
+	if opt.VhostNet {
+		Report("vhost-net enabled: syscall filters less restrictive!")
+		s.Merge(vhost.Filters())
+	}
 	if opt.NVProxy {
 		Report("Nvidia GPU driver proxy enabled: syscall filters less restrictive!")
 		s.Merge(nvproxy.Filters())
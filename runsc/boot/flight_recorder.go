@@ -0,0 +1,86 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"github.com/talismancer/gvisor-ligolo/pkg/fd"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/sinks/recorder"
+)
+
+// flightRecorderPoints are the points recorded by the flight recorder: the
+// lifecycle of processes, the files they open and their network activity.
+// Points that don't exist on the current architecture are skipped.
+var flightRecorderPoints = []string{
+	"container/start",
+	"sentry/clone",
+	"sentry/execve",
+	"sentry/exit_notify_parent",
+	"sentry/task_exit",
+	"sentry/tls_plaintext",
+	"syscall/execve/enter",
+	"syscall/execveat/enter",
+	"syscall/open/exit",
+	"syscall/openat/exit",
+	"syscall/creat/exit",
+	"syscall/chdir/exit",
+	"syscall/chroot/exit",
+	"syscall/socket/exit",
+	"syscall/connect/exit",
+	"syscall/bind/exit",
+	"syscall/accept/exit",
+	"syscall/accept4/exit",
+	"syscall/setuid/exit",
+	"syscall/setgid/exit",
+	"syscall/setresuid/exit",
+	"syscall/setresgid/exit",
+}
+
+// addFlightRecorder adds the recorder sink writing to the ring in endpoint to
+// session, along with flightRecorderPoints. The points are enabled with all
+// their fields, including points that session already enables.
+func addFlightRecorder(session *seccheck.SessionConfig, endpoint *fd.FD) {
+	if session.Name == "" {
+		session.Name = seccheck.DefaultSessionName
+	}
+	enabled := make(map[string]int, len(session.Points))
+	for i, pt := range session.Points {
+		enabled[pt.Name] = i
+	}
+	for _, name := range flightRecorderPoints {
+		desc, ok := seccheck.Points[name]
+		if !ok {
+			log.Debugf("Flight recorder point %q doesn't exist, skipping", name)
+			continue
+		}
+		pt := seccheck.PointConfig{Name: name}
+		for _, field := range desc.OptionalFields {
+			pt.OptionalFields = append(pt.OptionalFields, field.Name)
+		}
+		for _, field := range desc.ContextFields {
+			pt.ContextFields = append(pt.ContextFields, field.Name)
+		}
+		if i, ok := enabled[name]; ok {
+			session.Points[i] = pt
+		} else {
+			session.Points = append(session.Points, pt)
+		}
+	}
+	session.Sinks = append(session.Sinks, seccheck.SinkConfig{
+		Name: recorder.Name,
+		FD:   endpoint,
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/fd"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+)
+
+// addGoferMountsLocked registers the gofer mounts of a container, identified
+// by their unique IDs in the order of their gofer FDs.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) addGoferMountsLocked(cid string, ids []string) {
+	if l.goferMounts == nil {
+		l.goferMounts = make(map[string][]string)
+	}
+	l.goferMounts[cid] = ids
+}
+
+// removeGoferMountsLocked drops the gofer mounts of a container.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) removeGoferMountsLocked(cid string) {
+	delete(l.goferMounts, cid)
+	delete(l.goferReconnects, cid)
+}
+
+// containerRunning returns true if the container has been started and its
+// processes haven't been destroyed.
+func (l *Loader) containerRunning(cid string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tg, _ := l.tryThreadGroupFromIDLocked(execID{cid: cid})
+	return tg != nil
+}
+
+// reconnectGofer reconnects the gofer mounts of a container to its restarted
+// gofer, through goferFDs. goferFDs must be ordered like the FDs of the
+// previous gofer: rootfs first, followed by the gofer mounts.
+func (l *Loader) reconnectGofer(cid string, goferFDs []*fd.FD) error {
+	defer func() {
+		for _, f := range goferFDs {
+			_ = f.Close()
+		}
+	}()
+	if l.root.conf.GoferRecoveryTimeout <= 0 {
+		return fmt.Errorf("gofer recovery is disabled, see --gofer-recovery-timeout")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if tg, err := l.tryThreadGroupFromIDLocked(execID{cid: cid}); err != nil {
+		return err
+	} else if tg == nil {
+		return fmt.Errorf("container %q not started", cid)
+	}
+	ids, ok := l.goferMounts[cid]
+	if !ok {
+		return fmt.Errorf("container %q has no gofer mounts", cid)
+	}
+	if len(goferFDs) != len(ids) {
+		return fmt.Errorf("got %d gofer FDs for container %q, want %d", len(goferFDs), cid, len(ids))
+	}
+
+	fds := make(map[string]int, len(ids))
+	for i, id := range ids {
+		fds[id] = goferFDs[i].FD()
+	}
+	rootFD := fds["/"]
+	err := l.k.VFS().ReconnectFilesystems(l.k.SupervisorContext(), cid, fds)
+	for i, id := range ids {
+		if _, ok := fds[id]; !ok {
+			// The filesystem owns the FD now.
+			goferFDs[i].Release()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := fds["/"]; ok {
+		return fmt.Errorf("rootfs of container %q not found", cid)
+	}
+	for id := range fds {
+		log.Infof("Gofer mount %q of container %q is not in use, not reconnecting it", id, cid)
+	}
+
+	// Let the gofer monitor watch the new rootfs connection.
+	if ch, ok := l.goferReconnects[cid]; ok {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- int32(rootFD)
+	}
+	log.Infof("Reconnected container %q to its restarted gofer", cid)
+	return nil
+}
@@ -0,0 +1,689 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/control"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
+	pb "github.com/talismancer/gvisor-ligolo/runsc/boot/control_go_proto"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// grpcMaxFiles is the maximum number of files donated on a gRPC control
+// connection that haven't been taken by requests yet.
+const grpcMaxFiles = 128
+
+// grpcController serves the ContainerManager gRPC service, which mirrors
+// containerManager methods for orchestrators that don't drive the sandbox
+// through runsc. It's served alongside the uRPC control server, with the same
+// access rules.
+//
+// Unary RPCs don't observe the cancellation of their context: like their uRPC
+// counterparts, they run to completion.
+//
+// Files are passed to the RPCs that take them as on uRPC: they are donated as
+// SCM_RIGHTS control messages on the connection, see grpcConn, and requests
+// say how many of them they take.
+type grpcController struct {
+	pb.UnimplementedContainerManagerServer
+
+	// srv is the gRPC server.
+	srv *grpc.Server
+
+	// ln is the listener connections are accepted on.
+	ln *grpcListener
+
+	// manager holds the containerManager methods.
+	manager *containerManager
+}
+
+// newGRPCController creates a gRPC control server listening on host socket fd.
+// The caller must call startServing to start the server. It must be called
+// before seccomp filters are installed.
+func newGRPCController(fd int, manager *containerManager) (*grpcController, error) {
+	f := os.NewFile(uintptr(fd), "grpc_control_server_socket")
+	netLn, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	unixLn, ok := netLn.(*net.UnixListener)
+	if !ok {
+		netLn.Close()
+		return nil, fmt.Errorf("gRPC control socket isn't a Unix domain socket, got %T", netLn)
+	}
+	// net.FileListener duplicates the socket: connections are accepted on the
+	// duplicate.
+	rc, err := unixLn.SyscallConn()
+	if err != nil {
+		unixLn.Close()
+		return nil, err
+	}
+	lnFD := -1
+	if err := rc.Control(func(fd uintptr) { lnFD = int(fd) }); err != nil {
+		unixLn.Close()
+		return nil, err
+	}
+
+	gc := &grpcController{
+		srv:     grpc.NewServer(grpc.Creds(grpcFileCredentials{})),
+		ln:      &grpcListener{UnixListener: unixLn, fd: lnFD, uid: os.Getuid()},
+		manager: manager,
+	}
+	pb.RegisterContainerManagerServer(gc.srv, gc)
+	return gc, nil
+}
+
+// startServing starts accepting connections in a new goroutine.
+func (gc *grpcController) startServing() {
+	go func() { // S/R-SAFE: does not impact state directly.
+		if err := gc.srv.Serve(gc.ln); err != nil {
+			log.Warningf("gRPC control server stopped: %v", err)
+		}
+	}()
+}
+
+// stop closes the listener and all connections. RPCs in flight are abandoned.
+func (gc *grpcController) stop() {
+	gc.srv.Stop()
+}
+
+// grpcControlFD returns the host socket of the gRPC control server, or -1.
+func (l *Loader) grpcControlFD() int {
+	if l.grpcCtrl == nil {
+		return -1
+	}
+	return l.grpcCtrl.ln.fd
+}
+
+// grpcListener is a net.Listener that only accepts connections from the
+// sandbox user and root, like the uRPC control server.
+type grpcListener struct {
+	*net.UnixListener
+
+	// fd is the host socket connections are accepted on.
+	fd int
+
+	// uid is the UID of the sandbox user.
+	uid int
+}
+
+// Accept implements net.Listener.Accept.
+func (ln *grpcListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := ln.AcceptUnix()
+		if err != nil {
+			return nil, err
+		}
+		ucred, err := peerCred(conn)
+		if err != nil {
+			log.Warningf("gRPC control couldn't get credentials: %v", err)
+			conn.Close()
+			continue
+		}
+		if int(ucred.Uid) != ln.uid && ucred.Uid != 0 {
+			log.Warningf("gRPC control auth failure: other UID = %d, current UID = %d", ucred.Uid, ln.uid)
+			conn.Close()
+			continue
+		}
+		return &grpcConn{UnixConn: conn}, nil
+	}
+}
+
+// grpcConn is a connection to the gRPC control server. It queues the files
+// donated by the client, received as SCM_RIGHTS control messages, until
+// requests take them.
+type grpcConn struct {
+	*net.UnixConn
+
+	// mu protects files.
+	mu sync.Mutex
+
+	// files are the donated files not taken yet, in the order they were
+	// received.
+	files []*os.File
+}
+
+// Read implements net.Conn.Read.
+func (c *grpcConn) Read(b []byte) (int, error) {
+	oob := make([]byte, unix.CmsgSpace(grpcMaxFiles*4))
+	n, oobn, flags, _, err := c.ReadMsgUnix(b, oob)
+	if oobn > 0 {
+		c.queueFiles(oob[:oobn])
+	}
+	if flags&unix.MSG_CTRUNC != 0 {
+		log.Warningf("gRPC control connection: too many files donated at once, some were dropped")
+	}
+	// Unlike Read, ReadMsgUnix may return a negative count on error and
+	// doesn't report the end of the stream.
+	if n < 0 {
+		n = 0
+	}
+	if n == 0 && err == nil && len(b) > 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// queueFiles queues the files passed in control messages oob.
+func (c *grpcConn) queueFiles(oob []byte) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		log.Warningf("gRPC control connection: parsing control messages: %v", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, msg := range msgs {
+		fds, err := unix.ParseUnixRights(&msg)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if len(c.files) >= grpcMaxFiles {
+				log.Warningf("gRPC control connection: too many files donated, dropping FD %d", fd)
+				unix.Close(fd)
+				continue
+			}
+			c.files = append(c.files, os.NewFile(uintptr(fd), "grpc_control_file"))
+		}
+	}
+}
+
+// takeFiles dequeues the n first donated files.
+func (c *grpcConn) takeFiles(n int) ([]*os.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n > len(c.files) {
+		return nil, fmt.Errorf("request takes %d files, but only %d were donated", n, len(c.files))
+	}
+	files := c.files[:n:n]
+	c.files = c.files[n:]
+	return files, nil
+}
+
+// Close implements net.Conn.Close.
+func (c *grpcConn) Close() error {
+	c.mu.Lock()
+	closeFiles(c.files)
+	c.files = nil
+	c.mu.Unlock()
+	return c.UnixConn.Close()
+}
+
+// grpcFileCredentials are the transport credentials of the gRPC control server.
+// They don't secure connections, which are authenticated by grpcListener, but
+// give RPCs access to their connection through grpcConnInfo.
+type grpcFileCredentials struct{}
+
+// grpcConnInfo is the credentials.AuthInfo of gRPC control connections.
+type grpcConnInfo struct {
+	credentials.CommonAuthInfo
+
+	conn *grpcConn
+}
+
+// AuthType implements credentials.AuthInfo.AuthType.
+func (grpcConnInfo) AuthType() string {
+	return "grpc-control"
+}
+
+// ClientHandshake implements credentials.TransportCredentials.ClientHandshake.
+func (grpcFileCredentials) ClientHandshake(_ context.Context, _ string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("gRPC control credentials are server-only")
+}
+
+// ServerHandshake implements credentials.TransportCredentials.ServerHandshake.
+func (grpcFileCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	c, ok := conn.(*grpcConn)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected gRPC control connection type %T", conn)
+	}
+	return conn, grpcConnInfo{
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.NoSecurity},
+		conn:           c,
+	}, nil
+}
+
+// Info implements credentials.TransportCredentials.Info.
+func (grpcFileCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "grpc-control"}
+}
+
+// Clone implements credentials.TransportCredentials.Clone.
+func (c grpcFileCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+// OverrideServerName implements credentials.TransportCredentials.OverrideServerName.
+func (grpcFileCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// takeFiles dequeues n files donated on the connection of the RPC of ctx. The
+// caller takes ownership of the files.
+func takeFiles(ctx context.Context, n uint32) ([]*os.File, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, errors.New("no connection to take files from")
+	}
+	info, ok := p.AuthInfo.(grpcConnInfo)
+	if !ok {
+		return nil, errors.New("no connection to take files from")
+	}
+	return info.conn.takeFiles(int(n))
+}
+
+// closeFiles closes all files.
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// GRPCControlConn is a client connection to the gRPC control server, which
+// donates files to the requests that take them. Use it as the connection of a
+// grpc.ClientConn with grpc.WithContextDialer and insecure credentials.
+type GRPCControlConn struct {
+	*net.UnixConn
+
+	// mu protects files.
+	mu sync.Mutex
+
+	// files are sent with the next write.
+	files []*os.File
+}
+
+// DialGRPCControl connects to the gRPC control server listening on path.
+func DialGRPCControl(ctx context.Context, path string) (*GRPCControlConn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCControlConn{UnixConn: conn.(*net.UnixConn)}, nil
+}
+
+// Donate arranges for files to be sent with the next bytes written to c, so
+// that they're received before the next request, which can then take them.
+// files must remain open until the request is sent.
+func (c *GRPCControlConn) Donate(files ...*os.File) {
+	c.mu.Lock()
+	c.files = append(c.files, files...)
+	c.mu.Unlock()
+}
+
+// Write implements net.Conn.Write.
+func (c *GRPCControlConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	files := c.files
+	c.files = nil
+	c.mu.Unlock()
+	if len(files) == 0 || len(b) == 0 {
+		return c.UnixConn.Write(b)
+	}
+	fds := make([]int, 0, len(files))
+	for _, f := range files {
+		fds = append(fds, int(f.Fd()))
+	}
+	n, _, err := c.WriteMsgUnix(b, unix.UnixRights(fds...), nil)
+	runtime.KeepAlive(files)
+	if err != nil {
+		return n, err
+	}
+	if n < len(b) {
+		m, err := c.UnixConn.Write(b[n:])
+		return n + m, err
+	}
+	return n, nil
+}
+
+// peerCred returns the credentials of the peer of conn.
+func peerCred(conn *net.UnixConn) (*unix.Ucred, error) {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ucred   *unix.Ucred
+		credErr error
+	)
+	if err := rc.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return nil, err
+	}
+	return ucred, credErr
+}
+
+// StartRoot implements pb.ContainerManagerServer.StartRoot.
+func (gc *grpcController) StartRoot(_ context.Context, req *pb.ContainerRequest) (*pb.Empty, error) {
+	cid := req.GetContainerId()
+	if err := gc.manager.StartRoot(&cid, nil); err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// Processes implements pb.ContainerManagerServer.Processes.
+func (gc *grpcController) Processes(_ context.Context, req *pb.ContainerRequest) (*pb.ProcessesResponse, error) {
+	cid := req.GetContainerId()
+	var procs []*control.Process
+	if err := gc.manager.Processes(&cid, &procs); err != nil {
+		return nil, err
+	}
+	resp := &pb.ProcessesResponse{}
+	for _, p := range procs {
+		threads := make([]int32, 0, len(p.Threads))
+		for _, tid := range p.Threads {
+			threads = append(threads, int32(tid))
+		}
+		resp.Processes = append(resp.Processes, &pb.Process{
+			Uid:     uint32(p.UID),
+			Pid:     int32(p.PID),
+			Ppid:    int32(p.PPID),
+			Threads: threads,
+			C:       p.C,
+			Tty:     p.TTY,
+			Stime:   p.STime,
+			Time:    p.Time,
+			Cmd:     p.Cmd,
+		})
+	}
+	return resp, nil
+}
+
+// Signal implements pb.ContainerManagerServer.Signal.
+func (gc *grpcController) Signal(_ context.Context, req *pb.SignalRequest) (*pb.Empty, error) {
+	var mode SignalDeliveryMode
+	switch req.GetMode() {
+	case pb.SignalDeliveryMode_DELIVER_TO_PROCESS:
+		mode = DeliverToProcess
+	case pb.SignalDeliveryMode_DELIVER_TO_ALL_PROCESSES:
+		mode = DeliverToAllProcesses
+	case pb.SignalDeliveryMode_DELIVER_TO_FOREGROUND_PROCESS_GROUP:
+		mode = DeliverToForegroundProcessGroup
+	default:
+		return nil, fmt.Errorf("unknown signal delivery mode %v", req.GetMode())
+	}
+	args := SignalArgs{
+		CID:   req.GetContainerId(),
+		Signo: req.GetSigno(),
+		PID:   req.GetPid(),
+		Mode:  mode,
+	}
+	if err := gc.manager.Signal(&args, nil); err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// Wait implements pb.ContainerManagerServer.Wait.
+func (gc *grpcController) Wait(_ context.Context, req *pb.ContainerRequest) (*pb.WaitResponse, error) {
+	cid := req.GetContainerId()
+	var waitStatus uint32
+	if err := gc.manager.Wait(&cid, &waitStatus); err != nil {
+		return nil, err
+	}
+	return &pb.WaitResponse{WaitStatus: waitStatus}, nil
+}
+
+// WaitPID implements pb.ContainerManagerServer.WaitPID.
+func (gc *grpcController) WaitPID(_ context.Context, req *pb.WaitPIDRequest) (*pb.WaitResponse, error) {
+	args := WaitPIDArgs{
+		PID: req.GetPid(),
+		CID: req.GetContainerId(),
+	}
+	var waitStatus uint32
+	if err := gc.manager.WaitPID(&args, &waitStatus); err != nil {
+		return nil, err
+	}
+	return &pb.WaitResponse{WaitStatus: waitStatus}, nil
+}
+
+// DestroySubcontainer implements pb.ContainerManagerServer.DestroySubcontainer.
+func (gc *grpcController) DestroySubcontainer(_ context.Context, req *pb.ContainerRequest) (*pb.Empty, error) {
+	cid := req.GetContainerId()
+	if err := gc.manager.DestroySubcontainer(&cid, nil); err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// RestoreProgress implements pb.ContainerManagerServer.RestoreProgress.
+func (gc *grpcController) RestoreProgress(context.Context, *pb.Empty) (*pb.RestoreProgressResponse, error) {
+	var progress RestoreProgress
+	if err := gc.manager.RestoreProgress(nil, &progress); err != nil {
+		return nil, err
+	}
+	return &pb.RestoreProgressResponse{
+		InProgress:    progress.InProgress,
+		BytesRead:     progress.BytesRead,
+		TotalBytes:    progress.TotalBytes,
+		PagesLoaded:   progress.PagesLoaded,
+		FilesRestored: progress.FilesRestored,
+		Canceled:      progress.Canceled,
+	}, nil
+}
+
+// RestoreCancel implements pb.ContainerManagerServer.RestoreCancel.
+func (gc *grpcController) RestoreCancel(context.Context, *pb.Empty) (*pb.Empty, error) {
+	if err := gc.manager.RestoreCancel(nil, nil); err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// StartupPhases implements pb.ContainerManagerServer.StartupPhases.
+func (gc *grpcController) StartupPhases(context.Context, *pb.Empty) (*pb.StartupPhasesResponse, error) {
+	var phases []StartupPhase
+	if err := gc.manager.StartupPhases(nil, &phases); err != nil {
+		return nil, err
+	}
+	resp := &pb.StartupPhasesResponse{}
+	for _, p := range phases {
+		resp.Phases = append(resp.Phases, &pb.StartupPhase{
+			Name:           p.Name,
+			ContainerId:    p.Container,
+			StartUnixNanos: p.Start.UnixNano(),
+			DurationNanos:  int64(p.Duration),
+		})
+	}
+	return resp, nil
+}
+
+// CreateSubcontainer implements pb.ContainerManagerServer.CreateSubcontainer.
+func (gc *grpcController) CreateSubcontainer(ctx context.Context, req *pb.CreateSubcontainerRequest) (*pb.Empty, error) {
+	files, err := takeFiles(ctx, req.GetNumFiles())
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	args := CreateArgs{
+		CID:         req.GetContainerId(),
+		FilePayload: urpc.FilePayload{Files: files},
+	}
+	if err := gc.manager.CreateSubcontainer(&args, nil); err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// StartSubcontainer implements pb.ContainerManagerServer.StartSubcontainer.
+func (gc *grpcController) StartSubcontainer(ctx context.Context, req *pb.StartSubcontainerRequest) (*pb.Empty, error) {
+	files, err := takeFiles(ctx, req.GetNumFiles())
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	var spec specs.Spec
+	if err := json.Unmarshal(req.GetSpec(), &spec); err != nil {
+		return nil, fmt.Errorf("decoding spec: %w", err)
+	}
+	var conf config.Config
+	if err := json.Unmarshal(req.GetConfig(), &conf); err != nil {
+		return nil, fmt.Errorf("decoding config: %w", err)
+	}
+	args := StartArgs{
+		Spec:                   &spec,
+		Conf:                   &conf,
+		CID:                    req.GetContainerId(),
+		NumOverlayFilestoreFDs: int(req.GetNumOverlayFilestoreFds()),
+		FilePayload:            urpc.FilePayload{Files: files},
+	}
+	for _, m := range req.GetOverlayMediums() {
+		args.OverlayMediums = append(args.OverlayMediums, OverlayMedium(m))
+	}
+	if err := gc.manager.StartSubcontainer(&args, nil); err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// ExecuteAsync implements pb.ContainerManagerServer.ExecuteAsync.
+func (gc *grpcController) ExecuteAsync(ctx context.Context, req *pb.ExecuteAsyncRequest) (*pb.ExecuteAsyncResponse, error) {
+	files, err := takeFiles(ctx, req.GetNumFiles())
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	args := control.ExecArgs{
+		Filename:         req.GetFilename(),
+		Argv:             req.GetArgv(),
+		Envv:             req.GetEnvv(),
+		WorkingDirectory: req.GetWorkingDirectory(),
+		KUID:             auth.KUID(req.GetKuid()),
+		KGID:             auth.KGID(req.GetKgid()),
+		StdioIsPty:       req.GetStdioIsPty(),
+		ContainerID:      req.GetContainerId(),
+		FilePayload: control.FilePayload{
+			FilePayload: urpc.FilePayload{Files: files},
+		},
+	}
+	for _, gid := range req.GetExtraKgids() {
+		args.ExtraKGIDs = append(args.ExtraKGIDs, auth.KGID(gid))
+	}
+	for i := range files {
+		args.GuestFDs = append(args.GuestFDs, i)
+	}
+	if caps := req.GetCapabilities(); len(caps) > 0 {
+		args.Capabilities = &auth.TaskCapabilities{}
+		if err := json.Unmarshal(caps, args.Capabilities); err != nil {
+			return nil, fmt.Errorf("decoding capabilities: %w", err)
+		}
+	}
+	var pid int32
+	if err := gc.manager.ExecuteAsync(&args, &pid); err != nil {
+		return nil, err
+	}
+	return &pb.ExecuteAsyncResponse{Pid: pid}, nil
+}
+
+// Checkpoint implements pb.ContainerManagerServer.Checkpoint.
+func (gc *grpcController) Checkpoint(ctx context.Context, req *pb.CheckpointRequest) (*pb.Empty, error) {
+	files, err := takeFiles(ctx, req.GetNumFiles())
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	opts := control.SaveOpts{
+		Key:         req.GetKey(),
+		Metadata:    req.GetMetadata(),
+		Resume:      req.GetResume(),
+		Checksums:   req.GetChecksums(),
+		FilePayload: urpc.FilePayload{Files: files},
+	}
+	if err := gc.manager.Checkpoint(&opts, nil); err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// Restore implements pb.ContainerManagerServer.Restore.
+func (gc *grpcController) Restore(ctx context.Context, req *pb.RestoreRequest) (*pb.Empty, error) {
+	files, err := takeFiles(ctx, req.GetNumFiles())
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	opts := RestoreOpts{
+		FilePayload: urpc.FilePayload{Files: files},
+		Precopy:     req.GetPrecopy(),
+		SandboxID:   req.GetSandboxId(),
+		Env:         req.GetEnv(),
+		EnvFile:     req.GetEnvFile(),
+	}
+	if err := gc.manager.Restore(&opts, nil); err != nil {
+		return nil, err
+	}
+	return &pb.Empty{}, nil
+}
+
+// StreamEvents implements pb.ContainerManagerServer.StreamEvents. Unlike unary
+// RPCs, it stops when the stream is canceled.
+func (gc *grpcController) StreamEvents(req *pb.StreamEventsRequest, stream pb.ContainerManager_StreamEventsServer) error {
+	cid := req.GetContainerId()
+	interval := time.Duration(req.GetIntervalNanos())
+	if interval <= 0 {
+		return fmt.Errorf("interval must be positive, got %v", interval)
+	}
+	if !gc.manager.l.containerExists(cid) {
+		return fmt.Errorf("container %q not found", cid)
+	}
+	var first EventOut
+	if err := gc.manager.Event(&cid, &first); err != nil {
+		return err
+	}
+	return gc.manager.watchEvents(cid, interval, &first, stream.Context().Done(), func(ev *EventOut) error {
+		resp := &pb.Event{
+			Type:        ev.Event.Type,
+			Id:          ev.Event.ID,
+			MemoryUsage: ev.Event.Data.Memory.Usage.Usage,
+			PidsCurrent: ev.Event.Data.Pids.Current,
+		}
+		for id, usage := range ev.ContainerUsage {
+			resp.ContainerUsage = append(resp.ContainerUsage, &pb.ContainerUsage{
+				ContainerId:   id,
+				CpuUsageNanos: usage,
+			})
+		}
+		sort.Slice(resp.ContainerUsage, func(i, j int) bool {
+			return resp.ContainerUsage[i].ContainerId < resp.ContainerUsage[j].ContainerId
+		})
+		return stream.Send(resp)
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	gtime "time"
+
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/version"
+)
+
+// Features reported by Health.Ping.
+const (
+	FeatureDirectFS      = "directfs"
+	FeatureNVProxy       = "nvproxy"
+	FeatureIOUring       = "iouring"
+	FeatureGoferRecovery = "gofer-recovery"
+)
+
+// Health checks that the control server is responsive. Its methods must not
+// take any lock that may be held for long by the sandbox, so that a wedged
+// control server can be told apart from a busy sandbox.
+type Health struct {
+	// features are the features enabled in the sandbox.
+	features []string
+
+	// startTime is when the control server was created.
+	startTime gtime.Time
+}
+
+func newHealth(conf *config.Config) *Health {
+	h := &Health{startTime: gtime.Now()}
+	if conf.DirectFS {
+		h.features = append(h.features, FeatureDirectFS)
+	}
+	if conf.NVProxy {
+		h.features = append(h.features, FeatureNVProxy)
+	}
+	if conf.IOUring {
+		h.features = append(h.features, FeatureIOUring)
+	}
+	if conf.GoferRecoveryTimeout > 0 {
+		h.features = append(h.features, FeatureGoferRecovery)
+	}
+	return h
+}
+
+// PingResponse is the result of Health.Ping.
+type PingResponse struct {
+	// Version is the version of the sandbox.
+	Version string `json:"version"`
+
+	// Features are the optional features enabled in the sandbox.
+	Features []string `json:"features"`
+
+	// Uptime is the time since the control server was created.
+	Uptime gtime.Duration `json:"uptime"`
+}
+
+// HasFeature returns true if feature is enabled in the sandbox. Clients use it
+// to check for features before issuing calls that depend on them.
+func (r *PingResponse) HasFeature(feature string) bool {
+	for _, f := range r.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Ping returns the version, features and uptime of the sandbox.
+func (h *Health) Ping(_ *struct{}, resp *PingResponse) error {
+	*resp = PingResponse{
+		Version:  version.Version(),
+		Features: h.features,
+		Uptime:   gtime.Since(h.startTime),
+	}
+	return nil
+}
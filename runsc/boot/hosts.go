@@ -0,0 +1,293 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/tmpfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// etcHostname and etcHosts are the files the sandbox can synthesize when
+	// their mount hint has synthesize=true.
+	etcHostname = "/etc/hostname"
+	etcHosts    = "/etc/hosts"
+)
+
+// synthesizedFile is a file mounted in a container whose contents are
+// generated by the sandbox.
+type synthesizedFile struct {
+	// cid is the container the file is mounted in.
+	cid string
+
+	// dest is the destination of the mount, either etcHostname or etcHosts.
+	dest string
+
+	// mnt is a read-write mount of the tmpfs holding the file. The mount
+	// seen by the container may be read-only. synthesizedFile holds a
+	// reference on it.
+	mnt *vfs.Mount
+}
+
+// shouldSynthesize returns true if the sandbox generates the contents of
+// mount instead of mounting its source.
+func (m *MountHint) shouldSynthesize(mount *specs.Mount) bool {
+	return m.synthesize && (mount.Destination == etcHostname || mount.Destination == etcHosts)
+}
+
+// mountSynthesizedFile mounts an empty file backed by tmpfs at the
+// destination of mount. The contents are written once the container's
+// namespaces are known; see Loader.updateSynthesizedFilesLocked.
+func (c *containerMounter) mountSynthesizedFile(ctx context.Context, creds *auth.Credentials, mns *vfs.MountNamespace, submount *mountInfo) (*vfs.Mount, error) {
+	// The source of the mount is not used, release the FDs passed for it.
+	if submount.fd >= 0 {
+		_ = unix.Close(submount.fd)
+	}
+	if submount.overlayFilestoreFD != nil {
+		_ = submount.overlayFilestoreFD.Close()
+	}
+
+	mount := submount.mount
+	fsOpts := &vfs.MountOptions{
+		GetFilesystemOptions: vfs.GetFilesystemOptions{
+			Data: "mode=0644",
+			InternalData: tmpfs.FilesystemOpts{
+				RootFileType: linux.S_IFREG,
+			},
+		},
+		InternalMount: true,
+	}
+	fileMnt, err := c.k.VFS().MountDisconnected(ctx, creds, "" /* source */, tmpfs.Name, fsOpts)
+	if err != nil {
+		return nil, fmt.Errorf("creating tmpfs for %q: %w", mount.Destination, err)
+	}
+
+	newMnt := c.k.VFS().NewDisconnectedMount(fileMnt.Filesystem(), fileMnt.Root(), ParseMountOptions(mount.Options))
+	defer newMnt.DecRef(ctx)
+
+	if err := c.makeMountPoint(ctx, creds, mns, mount.Destination); err != nil {
+		fileMnt.DecRef(ctx)
+		return nil, fmt.Errorf("creating mount point %q: %w", mount.Destination, err)
+	}
+	root := mns.Root()
+	root.IncRef()
+	defer root.DecRef(ctx)
+	target := &vfs.PathOperation{
+		Root:  root,
+		Start: root,
+		Path:  fspath.Parse(mount.Destination),
+	}
+	if err := c.k.VFS().ConnectMountAt(ctx, creds, newMnt, target); err != nil {
+		fileMnt.DecRef(ctx)
+		return nil, err
+	}
+	c.synthesized = append(c.synthesized, &synthesizedFile{dest: mount.Destination, mnt: fileMnt})
+	log.Infof("Mounted synthesized file to %q", mount.Destination)
+	return newMnt, nil
+}
+
+// write replaces the contents of the file with data.
+func (f *synthesizedFile) write(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, data string) error {
+	root := vfs.MakeVirtualDentry(f.mnt, f.mnt.Root())
+	fd, err := vfsObj.OpenAt(ctx, creds, &vfs.PathOperation{
+		Root:  root,
+		Start: root,
+	}, &vfs.OpenOptions{
+		Flags: linux.O_WRONLY | linux.O_TRUNC,
+	})
+	if err != nil {
+		return err
+	}
+	defer fd.DecRef(ctx)
+	_, err = fd.Write(ctx, usermem.BytesIOSequence([]byte(data)), vfs.WriteOptions{})
+	return err
+}
+
+// hostEntry is a line of /etc/hosts.
+type hostEntry struct {
+	addr     string
+	hostname string
+}
+
+// containerAddress returns the address other containers in the pod can use
+// to reach a container in network namespace netns. IPv4 addresses are
+// preferred. It returns an empty string if the namespace has no address
+// besides loopback.
+func containerAddress(netns *inet.Namespace) string {
+	stack := netns.Stack()
+	if stack == nil {
+		return ""
+	}
+	ifaces := stack.Interfaces()
+	addrs := stack.InterfaceAddrs()
+	idxs := make([]int32, 0, len(ifaces))
+	for idx, iface := range ifaces {
+		if iface.Flags&linux.IFF_LOOPBACK == 0 {
+			idxs = append(idxs, idx)
+		}
+	}
+	sort.Slice(idxs, func(i, j int) bool { return idxs[i] < idxs[j] })
+
+	var v6 string
+	for _, idx := range idxs {
+		for _, addr := range addrs[idx] {
+			ip := net.IP(addr.Addr)
+			switch {
+			case addr.Family == linux.AF_INET:
+				return ip.String()
+			case addr.Family == linux.AF_INET6 && v6 == "" && !ip.IsLinkLocalUnicast():
+				v6 = ip.String()
+			}
+		}
+	}
+	return v6
+}
+
+// hostEntriesLocked returns the /etc/hosts entries of the started containers
+// in the sandbox: the address of each container mapped to its hostname. The
+// root container comes first, followed by the others ordered by ID.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) hostEntriesLocked() []hostEntry {
+	var cids []string
+	for eid, ep := range l.processes {
+		if eid.pid == 0 && ep.tg != nil && eid.cid != l.sandboxID {
+			cids = append(cids, eid.cid)
+		}
+	}
+	sort.Strings(cids)
+	if ep, ok := l.processes[execID{cid: l.sandboxID}]; ok && ep.tg != nil {
+		cids = append([]string{l.sandboxID}, cids...)
+	}
+
+	var entries []hostEntry
+	seen := make(map[hostEntry]struct{})
+	for _, cid := range cids {
+		ep := l.processes[execID{cid: cid}]
+		netns := ep.netns
+		if netns == nil {
+			netns = l.k.RootNetworkNamespace()
+		}
+		e := hostEntry{
+			addr:     containerAddress(netns),
+			hostname: l.containerHostnameLocked(ep),
+		}
+		if e.addr == "" || e.hostname == "" {
+			continue
+		}
+		if _, ok := seen[e]; ok {
+			// Containers sharing network and UTS namespaces, e.g. the
+			// containers of a Kubernetes pod, need a single entry.
+			continue
+		}
+		seen[e] = struct{}{}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// containerHostnameLocked returns the hostname of the container whose init
+// process is ep.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) containerHostnameLocked(ep *execProcess) string {
+	if ep.utsns != nil {
+		return ep.utsns.HostName()
+	}
+	return l.k.RootUTSNamespace().HostName()
+}
+
+// hostsFileContents returns the contents of /etc/hosts with the given
+// entries.
+func hostsFileContents(entries []hostEntry) string {
+	var b strings.Builder
+	b.WriteString("# Generated by gVisor.\n")
+	b.WriteString("127.0.0.1\tlocalhost\n")
+	b.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "%s\t%s\n", e.addr, e.hostname)
+	}
+	return b.String()
+}
+
+// updateSynthesizedFilesLocked rewrites the synthesized files of all
+// containers. It must be called when containers are started or destroyed, so
+// that /etc/hosts lists the running containers.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) updateSynthesizedFilesLocked() {
+	if len(l.synthesizedFiles) == 0 {
+		return
+	}
+	ctx := l.k.SupervisorContext()
+	creds := auth.NewRootCredentials(l.k.RootUserNamespace())
+	hosts := hostsFileContents(l.hostEntriesLocked())
+	for _, f := range l.synthesizedFiles {
+		var data string
+		switch f.dest {
+		case etcHosts:
+			data = hosts
+		case etcHostname:
+			ep, ok := l.processes[execID{cid: f.cid}]
+			if !ok {
+				continue
+			}
+			data = l.containerHostnameLocked(ep) + "\n"
+		}
+		if err := f.write(ctx, l.k.VFS(), creds, data); err != nil {
+			log.Warningf("Failed to update %q of container %q: %v", f.dest, f.cid, err)
+		}
+	}
+}
+
+// addSynthesizedFilesLocked registers the files synthesized for a container.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) addSynthesizedFilesLocked(cid string, files []*synthesizedFile) {
+	for _, f := range files {
+		f.cid = cid
+		l.synthesizedFiles = append(l.synthesizedFiles, f)
+	}
+}
+
+// removeSynthesizedFilesLocked drops the files synthesized for a container.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) removeSynthesizedFilesLocked(cid string) {
+	ctx := l.k.SupervisorContext()
+	files := l.synthesizedFiles[:0]
+	for _, f := range l.synthesizedFiles {
+		if f.cid == cid {
+			f.mnt.DecRef(ctx)
+			continue
+		}
+		files = append(files, f)
+	}
+	l.synthesizedFiles = files
+}
@@ -0,0 +1,299 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/hostinet"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/tcp"
+	"github.com/talismancer/gvisor-ligolo/pkg/unet"
+	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
+	pf "github.com/talismancer/gvisor-ligolo/runsc/boot/portforward"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"golang.org/x/sys/unix"
+)
+
+// Listening TCP sockets of the host can be passed to the application with
+// --pass-fd, e.g. by a socket activation manager. This lets the application
+// accept connections on addresses it can't bind to itself, such as privileged
+// ports, and lets a new sandbox take over the socket of an old one without
+// refusing connections meanwhile.
+//
+//   - With hostinet, the application gets the host socket itself.
+//
+//   - With netstack, the application gets a netstack socket listening on the
+//     port of the host socket on the any address, or on the address given in
+//     the FD mapping. The sentry accepts connections on the host socket and
+//     forwards them to it. Only data is forwarded: connections appear to come
+//     from the loopback address.
+//
+// Host listeners aren't restored after a checkpoint.
+
+// hostListenerBacklog is the backlog of netstack sockets listening on behalf of
+// host listeners, the default SOMAXCONN of Linux.
+const hostListenerBacklog = 4096
+
+// hostListener is a listening TCP socket passed from the host.
+type hostListener struct {
+	// family is the address family of the socket.
+	family int
+
+	// addr is the address the host socket is bound to.
+	addr tcpip.FullAddress
+
+	// guestAddr is the "ip:port" address to listen on in netstack, from the
+	// FD mapping. If empty, the port of addr is used on the any address.
+	guestAddr string
+
+	// sock accepts connections on the host socket to forward them to
+	// netstack. It's only set with netstack, once the application's socket
+	// is created.
+	sock *unet.ServerSocket
+}
+
+// newHostListener returns the hostListener for the host FD fd, or nil if it's
+// not a listening TCP socket. It must be called before seccomp filters are
+// installed.
+func newHostListener(fd int, guestAddr string) (*hostListener, error) {
+	family, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_DOMAIN)
+	isListener := err == nil && (family == unix.AF_INET || family == unix.AF_INET6)
+	if isListener {
+		stype, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TYPE)
+		isListener = err == nil && stype == unix.SOCK_STREAM
+	}
+	if isListener {
+		accepting, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ACCEPTCONN)
+		isListener = err == nil && accepting != 0
+	}
+	if !isListener {
+		if guestAddr != "" {
+			return nil, fmt.Errorf("host FD %d has listen address %q, but isn't a listening TCP socket", fd, guestAddr)
+		}
+		return nil, nil
+	}
+
+	sa, err := unix.Getsockname(fd)
+	if err != nil {
+		return nil, fmt.Errorf("getting address of host listener FD %d: %w", fd, err)
+	}
+	var addr tcpip.FullAddress
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		addr = tcpip.FullAddress{Addr: tcpip.AddrFrom4(sa.Addr), Port: uint16(sa.Port)}
+	case *unix.SockaddrInet6:
+		addr = tcpip.FullAddress{Addr: tcpip.AddrFrom16(sa.Addr), Port: uint16(sa.Port)}
+	default:
+		return nil, fmt.Errorf("host listener FD %d has unexpected address type %T", fd, sa)
+	}
+	// Both hostinet and unet expect non-blocking sockets.
+	if err := unix.SetNonblock(fd, true); err != nil {
+		return nil, err
+	}
+	return &hostListener{family: family, addr: addr, guestAddr: guestAddr}, nil
+}
+
+// netstackAddr returns the address to listen on in netstack for hl.
+func (hl *hostListener) netstackAddr() (tcpip.FullAddress, error) {
+	addr := tcpip.FullAddress{Port: hl.addr.Port}
+	if hl.guestAddr != "" {
+		var err error
+		if addr, err = parseFullAddress(hl.guestAddr); err != nil {
+			return tcpip.FullAddress{}, fmt.Errorf("invalid listen address %q: %w", hl.guestAddr, err)
+		}
+		if addr.Port == 0 {
+			addr.Port = hl.addr.Port
+		}
+	}
+	return addr, nil
+}
+
+// hostListenerFDs returns the host sockets of the host listeners passed to the
+// root container whose connections are accepted by the sentry.
+func (l *Loader) hostListenerFDs() []int {
+	if l.root.conf.Network != config.NetworkSandbox {
+		return nil
+	}
+	var fds []int
+	for _, m := range l.root.passFDs {
+		if m.listener != nil {
+			fds = append(fds, m.host.FD())
+		}
+	}
+	return fds
+}
+
+// splitHostListeners splits mappings into those of host listeners and the
+// others.
+func splitHostListeners(mappings []fdMapping) (others, listeners []fdMapping) {
+	for _, m := range mappings {
+		if m.listener != nil {
+			listeners = append(listeners, m)
+		} else {
+			others = append(others, m)
+		}
+	}
+	return others, listeners
+}
+
+// importHostListeners adds the sockets of host listeners to fdTable, in network
+// namespace ns.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) importHostListeners(ctx context.Context, cid string, fdTable *kernel.FDTable, ns *inet.Namespace, listeners []fdMapping) error {
+	for _, m := range listeners {
+		if m.guest < 0 {
+			return fmt.Errorf("guest file descriptors must be 0 or greater")
+		}
+		file, err := l.importHostListener(ctx, cid, ns, m)
+		if err != nil {
+			return fmt.Errorf("importing host listener for FD %d: %w", m.guest, err)
+		}
+		err = fdTable.NewFDAt(ctx, int32(m.guest), file, kernel.FDFlags{})
+		file.DecRef(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importHostListener returns the application's socket for host listener m.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) importHostListener(ctx context.Context, cid string, ns *inet.Namespace, m fdMapping) (*vfs.FileDescription, error) {
+	hl := m.listener
+	switch stack := ns.Stack().(type) {
+	case *hostinet.Stack:
+		if hl.guestAddr != "" {
+			return nil, fmt.Errorf("listen addresses are only supported with netstack")
+		}
+		file, err := hostinet.ImportSocket(ctx, hl.family, linux.SOCK_STREAM, unix.IPPROTO_TCP, m.host.FD())
+		if err != nil {
+			return nil, err
+		}
+		m.host.Release()
+		log.Infof("Passing host listener on %s to FD %d", formatFullAddress(hl.addr), m.guest)
+		return file, nil
+
+	case *netstack.Stack:
+		addr, err := hl.netstackAddr()
+		if err != nil {
+			return nil, err
+		}
+		family, netProto := unix.AF_INET6, header.IPv6ProtocolNumber
+		if addr.Addr.Len() == header.IPv4AddressSize || (addr.Addr.Len() == 0 && hl.family == unix.AF_INET) {
+			family, netProto = unix.AF_INET, header.IPv4ProtocolNumber
+		}
+		var wq waiter.Queue
+		ep, tcpErr := stack.Stack.NewEndpoint(tcp.ProtocolNumber, netProto, &wq)
+		if tcpErr != nil {
+			return nil, fmt.Errorf("creating endpoint: %v", tcpErr)
+		}
+		if tcpErr := ep.Bind(addr); tcpErr != nil {
+			ep.Close()
+			return nil, fmt.Errorf("binding to %s: %v", formatFullAddress(addr), tcpErr)
+		}
+		if tcpErr := ep.Listen(hostListenerBacklog); tcpErr != nil {
+			ep.Close()
+			return nil, fmt.Errorf("listening: %v", tcpErr)
+		}
+		file, serr := netstack.NewInNamespace(ctx, ns, family, linux.SOCK_STREAM, unix.IPPROTO_TCP, &wq, ep)
+		if serr != nil {
+			ep.Close()
+			return nil, serr.ToError()
+		}
+		sock, err := unet.NewServerSocket(m.host.FD())
+		if err != nil {
+			file.DecRef(ctx)
+			return nil, err
+		}
+		m.host.Release()
+		hl.sock = sock
+		l.hostListeners = append(l.hostListeners, hl)
+		log.Infof("Forwarding host listener on %s to %s, FD %d", formatFullAddress(hl.addr), formatFullAddress(addr), m.guest)
+		go l.serveHostListener(cid, stack, hl, addr) // S/R-SAFE: not saved.
+		return file, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported network stack %T", stack)
+	}
+}
+
+// stopHostListeners stops accepting connections on host listeners forwarded to
+// netstack.
+func (l *Loader) stopHostListeners() {
+	for _, hl := range l.hostListeners {
+		hl.sock.Close()
+	}
+}
+
+// serveHostListener forwards the connections accepted on hl to addr, the
+// address of the application's socket in stack.
+func (l *Loader) serveHostListener(cid string, stack *netstack.Stack, hl *hostListener, addr tcpip.FullAddress) {
+	// Connect to the loopback address if the application's socket listens on
+	// the any address.
+	if addr.Addr.Len() == 0 {
+		if hl.family == unix.AF_INET {
+			addr.Addr = tcpip.AddrFrom4([4]byte{0x7f, 0x00, 0x00, 0x01}) // 127.0.0.1
+		} else {
+			addr.Addr = header.IPv6Loopback
+		}
+	}
+	for {
+		conn, err := hl.sock.Accept()
+		if err != nil {
+			if err != unix.EBADF {
+				log.Warningf("Host listener on %s stopped accepting connections: %v", formatFullAddress(hl.addr), err)
+			}
+			return
+		}
+		go l.forwardHostListenerConn(cid, stack, conn, addr) // S/R-SAFE: not saved.
+	}
+}
+
+// forwardHostListenerConn forwards data between conn, accepted on a host
+// listener, and a new connection to addr in stack.
+func (l *Loader) forwardHostListenerConn(cid string, stack *netstack.Stack, conn *unet.Socket, addr tcpip.FullAddress) {
+	fd, err := conn.Release()
+	if err != nil {
+		return
+	}
+	hostConn, err := pf.NewHostInetConnFromFD(fd)
+	if err != nil {
+		unix.Close(fd)
+		log.Warningf("Host listener: registering connection: %v", err)
+		return
+	}
+	ctx := l.k.SupervisorContext()
+	nsConn, err := pf.DialNetstack(stack.Stack, addr)
+	if err != nil {
+		hostConn.Close(ctx)
+		log.Debugf("Host listener: connecting to %s: %v", formatFullAddress(addr), err)
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.startProxyPairLocked(ctx, cid, pf.ProxyPair{From: nsConn, To: hostConn})
+}
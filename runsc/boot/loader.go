@@ -18,6 +18,7 @@ package boot
 import (
 	"errors"
 	"fmt"
+	"io"
 	mrand "math/rand"
 	"os"
 	"runtime"
@@ -39,6 +40,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/control"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fdimport"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/host"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/overlay"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/tmpfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/user"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
@@ -85,6 +87,7 @@ import (
 
 	// Include other supported socket providers.
 	_ "github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netlink"
+	_ "github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netlink/audit"
 	_ "github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netlink/route"
 	_ "github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netlink/uevent"
 	_ "github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/unix"
@@ -132,6 +135,9 @@ type Loader struct {
 	// ctrl is the control server.
 	ctrl *controller
 
+	// grpcCtrl is the gRPC control server, or nil.
+	grpcCtrl *grpcController
+
 	// root contains information about the root container in the sandbox.
 	root containerInfo
 
@@ -165,9 +171,69 @@ type Loader struct {
 	// nvidiaUVMDevMajor is the device major number used for nvidia-uvm.
 	nvidiaUVMDevMajor uint32
 
-	// mu guards processes and porForwardProxies.
+	// autoCheckpointDirFD is the host FD of the directory periodic
+	// checkpoints are written to, or -1 if periodic checkpoints are disabled.
+	autoCheckpointDirFD int
+
+	// coreDumpDirFD is the host FD of the directory core dumps are written
+	// to, or -1 if core dumps are disabled.
+	coreDumpDirFD int
+
+	// saveMu serializes checkpoints requested by the controller and taken
+	// by the auto-checkpointer.
+	saveMu sync.Mutex
+
+	// probes are the health-check probes configured in the pod init config.
+	probes []ProbeConfig
+
+	// probeDevNull is the host /dev/null, used as stdio of exec probes. It's
+	// only opened if exec probes are configured.
+	probeDevNull *os.File
+
+	// services are the services bridged onto host sockets, configured in
+	// the pod init config.
+	services []*service
+
+	// abstractExports are the abstract sockets of the sandbox exported onto
+	// the host.
+	abstractExports []*abstractExport
+
+	// hostListeners are the host listeners passed to the root container
+	// whose connections are forwarded to netstack.
+	hostListeners []*hostListener
+
+	// egress enforces the egress policy of the sandbox. It's nil if the
+	// sandbox doesn't use netstack.
+	egress *egressFilter
+
+	// memoryPressureFile is the PSI memory pressure file of the sandbox's
+	// cgroup, or nil. It's kept to drive the memory file created on restore.
+	memoryPressureFile *os.File
+
+	// startup records the startup phases of the sandbox and its containers.
+	startup *StartupRecorder
+
+	// mu guards processes, porForwardProxies, autoCheckpoint, probers and
+	// serviceContainers.
 	mu sync.Mutex
 
+	// autoCheckpoint takes periodic checkpoints once the root container is
+	// running. It's nil if periodic checkpoints are disabled.
+	//
+	// autoCheckpoint is guarded by mu.
+	autoCheckpoint *autoCheckpointer
+
+	// probers maps container IDs to the probes running against them.
+	//
+	// probers is guarded by mu.
+	probers map[string][]*prober
+
+	// serviceContainers maps service names to the ID of the running
+	// container providing them.
+	//
+	// serviceContainers is guarded by mu.
+	serviceContainers map[string]string
+
 	// processes maps containers init process and invocation of exec. Root
 	// processes are keyed with container ID and pid=0, while exec invocations
 	// have the corresponding pid set.
@@ -179,6 +245,36 @@ type Loader struct {
 	//
 	// portForwardProxies is guarded by mu.
 	portForwardProxies []*pf.Proxy
+
+	// netListeners holds the listeners created by Listen, keyed by ID.
+	//
+	// netListeners is guarded by mu.
+	netListeners map[uint64]*pf.NetstackListener
+
+	// lastNetListenerID is the ID of the last listener created by Listen.
+	//
+	// lastNetListenerID is guarded by mu.
+	lastNetListenerID uint64
+
+	// synthesizedFiles are the /etc/hosts and /etc/hostname files of all
+	// containers whose contents are generated by the sandbox.
+	//
+	// synthesizedFiles is guarded by mu.
+	synthesizedFiles []*synthesizedFile
+
+	// goferMounts maps container IDs to the unique IDs of their gofer mounts,
+	// in the order of their gofer FDs. It is used to reconnect the mounts to a
+	// restarted gofer.
+	//
+	// goferMounts is guarded by mu.
+	goferMounts map[string][]string
+
+	// goferReconnects maps container IDs to a channel notifying the gofer
+	// monitor of the container of the new rootfs gofer FD once the container's
+	// mounts are reconnected to a restarted gofer.
+	//
+	// goferReconnects is guarded by mu.
+	goferReconnects map[string]chan int32
 }
 
 // execID uniquely identifies a sentry process that is executed in a container.
@@ -198,6 +294,33 @@ type execProcess struct {
 	// pidnsPath is the pid namespace path in spec
 	pidnsPath string
 
+	// netns is the network namespace of the container, or nil for the root
+	// network namespace. execProcess holds a reference on it.
+	netns *inet.Namespace
+
+	// netnsPath is the network namespace path in spec.
+	netnsPath string
+
+	// utsns is the UTS namespace of the container, or nil for the root UTS
+	// namespace.
+	utsns *kernel.UTSNamespace
+
+	// utsnsPath is the UTS namespace path in spec.
+	utsnsPath string
+
+	// ipcns is the IPC namespace of the container, or nil for the root IPC
+	// namespace. execProcess holds a reference on it.
+	ipcns *kernel.IPCNamespace
+
+	// ipcnsPath is the IPC namespace path in spec.
+	ipcnsPath string
+
+	// mntns is the mount namespace of the container's init process, which is
+	// kept after the container stops so that its root filesystem can still be
+	// exported. It is nil for exec'd processes. execProcess holds a reference
+	// on it.
+	mntns *vfs.MountNamespace
+
 	// hostTTY is present when creating a sub-container with terminal enabled.
 	// TTY file is passed during container create and must be saved until
 	// container start.
@@ -209,6 +332,9 @@ type execProcess struct {
 type fdMapping struct {
 	guest int
 	host  *fd.FD
+
+	// listener is set if host is a listening TCP socket.
+	listener *hostListener
 }
 
 // FDMapping is a helper type to represent a mapping from guest to host file
@@ -217,6 +343,10 @@ type fdMapping struct {
 type FDMapping struct {
 	Guest int
 	Host  int
+
+	// Address is the "ip:port" address a listening TCP socket passed as Host
+	// is exposed on with netstack. It's optional.
+	Address string
 }
 
 func init() {
@@ -235,6 +365,9 @@ type Args struct {
 	// ControllerFD is the FD to the URPC controller. The Loader takes ownership
 	// of this FD and may close it at any time.
 	ControllerFD int
+	// GRPCControlFD is the listening host socket of the gRPC control server,
+	// or -1. The Loader takes ownership of this FD.
+	GRPCControlFD int
 	// Device is an optional argument that is passed to the platform. The Loader
 	// takes ownership of this file and may close it at any time.
 	Device *os.File
@@ -274,6 +407,33 @@ type Args struct {
 	// SinkFDs is an ordered array of file descriptors to be used by seccheck
 	// sinks configured from the --pod-init-config file.
 	SinkFDs []int
+	// ServiceFDs is an ordered array of the host sockets of the services
+	// configured in the --pod-init-config file.
+	ServiceFDs []int
+	// FlightRecorderFD is the file descriptor of the ring of the flight
+	// recorder enabled with the --flight-recorder flag, or -1.
+	FlightRecorderFD int
+	// AutoCheckpointDirFD is the file descriptor of the directory given in
+	// the --auto-checkpoint flag, or -1.
+	AutoCheckpointDirFD int
+	// CoreDumpDirFD is the file descriptor of the directory given in the
+	// --core-dump-dir flag, or -1.
+	CoreDumpDirFD int
+	// PortReservationDirFD is the file descriptor of the directory holding
+	// the port reservations of the sandbox's network namespace, or -1.
+	PortReservationDirFD int
+	// TLSInterceptCAFD is the file descriptor of the file given in the
+	// --tls-intercept-ca flag, or -1.
+	TLSInterceptCAFD int
+	// TLSInterceptRootsFD is the file descriptor of the CA bundle servers of
+	// intercepted TLS connections are verified with, or -1.
+	TLSInterceptRootsFD int
+	// MemoryPressureFD is the file descriptor of the cgroup v2
+	// memory.pressure file of the sandbox, with a PSI trigger set up, or -1.
+	MemoryPressureFD int
+	// EntropyFD is the file descriptor of the file given in the
+	// --entropy-source flag, or -1.
+	EntropyFD int
 	// ProfileOpts contains the set of profiles to enable and the
 	// corresponding FDs where profile data will be written.
 	ProfileOpts profile.Opts
@@ -285,6 +445,8 @@ const startingStdioFD = 256
 // New initializes a new kernel loader configured by spec.
 // New also handles setting up a kernel for restoring a container.
 func New(args Args) (*Loader, error) {
+	startup := &StartupRecorder{}
+	endLoader := startup.Begin("", "loader")
 	stopProfiling := profile.Start(args.ProfileOpts)
 
 	// Initialize seccheck points.
@@ -295,6 +457,9 @@ func New(args Args) (*Loader, error) {
 	if err := rand.Init(); err != nil {
 		return nil, fmt.Errorf("setting up rand: %w", err)
 	}
+	if err := setupEntropy(args.Conf, args.EntropyFD); err != nil {
+		return nil, fmt.Errorf("setting up entropy: %w", err)
+	}
 
 	if err := usage.Init(); err != nil {
 		return nil, fmt.Errorf("setting up memory usage: %w", err)
@@ -302,6 +467,10 @@ func New(args Args) (*Loader, error) {
 
 	kernel.IOUringEnabled = args.Conf.IOUring
 
+	if err := setSentryTunables(args.Conf.SentryTunables); err != nil {
+		return nil, err
+	}
+
 	info := containerInfo{
 		conf:           args.Conf,
 		spec:           args.Spec,
@@ -342,17 +511,24 @@ func New(args Args) (*Loader, error) {
 	}
 
 	for _, customFD := range args.PassFDs {
+		listener, err := newHostListener(customFD.Host, customFD.Address)
+		if err != nil {
+			return nil, err
+		}
 		info.passFDs = append(info.passFDs, fdMapping{
-			host:  fd.New(customFD.Host),
-			guest: customFD.Guest,
+			host:     fd.New(customFD.Host),
+			guest:    customFD.Guest,
+			listener: listener,
 		})
 	}
 
 	// Create kernel and platform.
+	endPhase := startup.Begin("", "platform")
 	p, err := createPlatform(args.Conf, args.Device)
 	if err != nil {
 		return nil, fmt.Errorf("creating platform: %w", err)
 	}
+	endPhase()
 	if args.Conf.NVProxy && p.OwnsPageTables() {
 		return nil, fmt.Errorf("--nvproxy is incompatible with platform %s: owns page tables", args.Conf.Platform)
 	}
@@ -361,12 +537,26 @@ func New(args Args) (*Loader, error) {
 	}
 
 	// Create memory file.
-	mf, err := createMemoryFile()
+	var memoryPressureFile *os.File
+	if args.MemoryPressureFD >= 0 {
+		memoryPressureFile = os.NewFile(uintptr(args.MemoryPressureFD), "memory.pressure")
+	}
+	endPhase = startup.Begin("", "memory-file")
+	mf, err := createMemoryFile(memoryPressureFile)
 	if err != nil {
 		return nil, fmt.Errorf("creating memory file: %w", err)
 	}
+	endPhase()
 	k.SetMemoryFile(mf)
 
+	if args.CoreDumpDirFD >= 0 {
+		k.SetCoreDumper(&coreDumper{
+			dir:     args.Conf.CoreDumpDir,
+			dirFD:   args.CoreDumpDirFD,
+			pattern: args.Conf.CorePattern,
+		})
+	}
+
 	// Create VDSO.
 	//
 	// Pass k as the platform since it is savable, unlike the actual platform.
@@ -404,16 +594,41 @@ func New(args Args) (*Loader, error) {
 		auth.NewRootUserNamespace())
 
 	// Create root network namespace/stack.
+	endPhase = startup.Begin("", "network")
 	netns, err := newRootNetworkNamespace(args.Conf, tk, k, creds.UserNamespace)
 	if err != nil {
 		return nil, fmt.Errorf("creating network: %w", err)
 	}
+	var egress *egressFilter
+	if eps, ok := netns.Stack().(*netstack.Stack); ok {
+		if args.PortReservationDirFD >= 0 {
+			eps.PortReserver = newPortReserver(args.PortReservationDirFD, args.ID)
+		}
+		egress = newEgressFilter(eps.Stack)
+		eps.EgressFilter = egress
+		if args.TLSInterceptCAFD >= 0 {
+			ti, err := newTLSInterceptor(eps.Stack, args.TLSInterceptCAFD, args.TLSInterceptRootsFD, args.Conf)
+			if err != nil {
+				return nil, fmt.Errorf("setting up TLS interception: %w", err)
+			}
+			eps.ConnectRedirector = ti
+		}
+	}
+	endPhase()
 
 	if args.NumCPU == 0 {
 		args.NumCPU = runtime.NumCPU()
 	}
 	log.Infof("CPUs: %d", args.NumCPU)
 	runtime.GOMAXPROCS(args.NumCPU)
+	// CPUs above NumCPU start offline, and can be brought online later with
+	// Lifecycle.SetCPUs. The platform was created before GOMAXPROCS was set,
+	// so its per-CPU structures are sized for the host CPUs.
+	maxCPU := args.NumCPU
+	if args.Conf.CPUNumMax > maxCPU {
+		maxCPU = args.Conf.CPUNumMax
+		log.Infof("Maximum CPUs: %d", maxCPU)
+	}
 
 	if args.TotalHostMem > 0 {
 		// As per tmpfs(5), the default size limit is 50% of total physical RAM.
@@ -424,31 +639,54 @@ func New(args Args) (*Loader, error) {
 	if args.TotalMem > 0 {
 		// Adjust the total memory returned by the Sentry so that applications that
 		// use /proc/meminfo can make allocations based on this limit.
-		usage.MinimumTotalMemoryBytes = args.TotalMem
-		usage.MaximumTotalMemoryBytes = args.TotalMem
+		usage.SetTotalMemoryBytes(args.TotalMem)
 		log.Infof("Setting total memory to %.2f GB", float64(args.TotalMem)/(1<<30))
 	}
+	var memLimit uint64
+	if args.TotalMem < args.TotalHostMem {
+		memLimit = args.TotalMem
+	}
+	if limit := args.Conf.SentryMemoryLimit.Limit(memLimit); limit > 0 {
+		log.Infof("Setting sentry memory limit to %d bytes", limit)
+		usage.StartSentryMemoryLimit(limit)
+	}
+
+	featureSet, err := sandboxFeatureSet(args.Conf)
+	if err != nil {
+		return nil, err
+	}
 
 	// Initiate the Kernel object, which is required by the Context passed
 	// to createVFS in order to mount (among other things) procfs.
+	endPhase = startup.Begin("", "kernel")
 	if err = k.Init(kernel.InitKernelArgs{
-		FeatureSet:                  cpuid.HostFeatureSet().Fixed(),
+		FeatureSet:                  featureSet,
 		Timekeeper:                  tk,
 		RootUserNamespace:           creds.UserNamespace,
 		RootNetworkNamespace:        netns,
-		ApplicationCores:            uint(args.NumCPU),
+		ApplicationCores:            uint(maxCPU),
+		OnlineCores:                 uint(args.NumCPU),
 		Vdso:                        vdso,
 		RootUTSNamespace:            kernel.NewUTSNamespace(args.Spec.Hostname, args.Spec.Hostname, creds.UserNamespace),
 		RootIPCNamespace:            kernel.NewIPCNamespace(creds.UserNamespace),
 		RootAbstractSocketNamespace: kernel.NewAbstractSocketNamespace(),
 		PIDNamespace:                kernel.NewRootPIDNamespace(creds.UserNamespace),
+		NestedContainers:            args.Conf.NestedContainers,
+		LSM:                         lsmFromConfig(args.Conf.LSM),
+		TimerSlack:                  args.Conf.TimerSlack,
+		TimerResolution:             args.Conf.TimerResolution,
+		DeepSleepDelay:              args.Conf.DeepSleepDelay,
+		DeepSleepMaxProcs:           args.Conf.DeepSleepGOMAXPROCS,
 	}); err != nil {
 		return nil, fmt.Errorf("initializing kernel: %w", err)
 	}
+	endPhase()
 
+	endPhase = startup.Begin("", "filesystems")
 	if err := registerFilesystems(k, &info); err != nil {
 		return nil, fmt.Errorf("registering filesystems: %w", err)
 	}
+	endPhase()
 
 	// Turn on packet logging if enabled.
 	if args.Conf.LogPackets {
@@ -468,13 +706,14 @@ func New(args Args) (*Loader, error) {
 	if err != nil {
 		return nil, fmt.Errorf("creating init process for root container: %w", err)
 	}
+	procArgs.ReapOrphans = args.Conf.Init
 	info.procArgs = procArgs
 
 	if err := initCompatLogs(args.UserLogFD); err != nil {
 		return nil, fmt.Errorf("initializing compat logs: %w", err)
 	}
 
-	mountHints, err := NewPodMountHints(args.Spec)
+	mountHints, err := NewPodMountHints(args.Spec, args.Conf)
 	if err != nil {
 		return nil, fmt.Errorf("creating pod mount hints: %w", err)
 	}
@@ -487,10 +726,35 @@ func New(args Args) (*Loader, error) {
 	defer hostFilesystem.DecRef(k.SupervisorContext())
 	k.SetHostMount(k.VFS().NewDisconnectedMount(hostFilesystem, nil, &vfs.MountOptions{}))
 
-	if args.PodInitConfigFD >= 0 {
-		if err := setupSeccheck(args.PodInitConfigFD, args.SinkFDs); err != nil {
+	var probes []ProbeConfig
+	var services []*service
+	var egressPolicy *EgressPolicy
+	if args.PodInitConfigFD >= 0 || args.FlightRecorderFD >= 0 {
+		initConf, err := setupSeccheck(args.PodInitConfigFD, args.SinkFDs, args.FlightRecorderFD)
+		if err != nil {
 			log.Warningf("unable to configure event session: %v", err)
 		}
+		if initConf != nil {
+			probes = initConf.Probes
+			if services, err = newServices(initConf.Services, args.ServiceFDs); err != nil {
+				return nil, fmt.Errorf("creating services: %w", err)
+			}
+			egressPolicy = initConf.Egress
+		}
+	}
+	if egressPolicy != nil {
+		if egress == nil {
+			return nil, fmt.Errorf("egress policies require netstack")
+		}
+		if err := egress.setPolicy(egressPolicy); err != nil {
+			return nil, fmt.Errorf("setting egress policy: %w", err)
+		}
+	}
+
+	setAbstractImports(k, args.Conf.AbstractUDSImports())
+	abstractExports, err := newAbstractExports(args.Conf.AbstractUDSExports())
+	if err != nil {
+		return nil, fmt.Errorf("exporting abstract sockets: %w", err)
 	}
 
 	eid := execID{cid: args.ID}
@@ -504,6 +768,26 @@ func New(args Args) (*Loader, error) {
 		stopProfiling:     stopProfiling,
 		productName:       args.ProductName,
 		nvidiaUVMDevMajor: info.nvidiaUVMDevMajor,
+
+		autoCheckpointDirFD: args.AutoCheckpointDirFD,
+		coreDumpDirFD:       args.CoreDumpDirFD,
+		probes:              probes,
+		services:            services,
+		abstractExports:     abstractExports,
+		egress:              egress,
+		memoryPressureFile:  memoryPressureFile,
+		startup:             startup,
+	}
+	for _, p := range probes {
+		if len(p.Exec) > 0 {
+			// Open it now, as the sandbox can't open host files once seccomp
+			// filters are installed.
+			l.probeDevNull, err = os.OpenFile("/dev/null", os.O_RDWR, 0)
+			if err != nil {
+				return nil, fmt.Errorf("opening /dev/null for exec probes: %w", err)
+			}
+			break
+		}
 	}
 
 	// We don't care about child signals; some platforms can generate a
@@ -516,6 +800,7 @@ func New(args Args) (*Loader, error) {
 	//
 	// This must be done *after* we have initialized the kernel since the
 	// controller is used to configure the kernel's network stack.
+	endPhase = startup.Begin("", "control-server")
 	ctrl, err := newController(args.ControllerFD, l)
 	if err != nil {
 		return nil, fmt.Errorf("creating control server: %w", err)
@@ -527,7 +812,15 @@ func New(args Args) (*Loader, error) {
 	if err := ctrl.srv.StartServing(); err != nil {
 		return nil, fmt.Errorf("starting control server: %w", err)
 	}
+	if args.GRPCControlFD >= 0 {
+		if l.grpcCtrl, err = newGRPCController(args.GRPCControlFD, ctrl.manager); err != nil {
+			return nil, fmt.Errorf("creating gRPC control server: %w", err)
+		}
+		l.grpcCtrl.startServing()
+	}
+	endPhase()
 
+	endLoader()
 	return l, nil
 }
 
@@ -576,11 +869,19 @@ func (l *Loader) Destroy() {
 	if l.stopSignalForwarding != nil {
 		l.stopSignalForwarding()
 	}
+	l.stopAutoCheckpoint()
+	l.stopProbes()
+	l.stopServices()
+	l.stopAbstractExports()
+	l.stopHostListeners()
 	l.watchdog.Stop()
 
 	// Stop the control server. This will indirectly stop any
 	// long-running control operations that are in flight, e.g.
 	// profiling operations.
+	if l.grpcCtrl != nil {
+		l.grpcCtrl.stop()
+	}
 	l.ctrl.stop()
 
 	// Release all kernel resources. This is only safe after we can no longer
@@ -602,6 +903,9 @@ func (l *Loader) Destroy() {
 	for _, f := range l.root.goferFDs {
 		_ = f.Close()
 	}
+	if l.probeDevNull != nil {
+		_ = l.probeDevNull.Close()
+	}
 
 	l.stopProfiling()
 }
@@ -615,17 +919,62 @@ func createPlatform(conf *config.Config, deviceFile *os.File) (platform.Platform
 	return p.New(deviceFile)
 }
 
-func createMemoryFile() (*pgalloc.MemoryFile, error) {
+// entropyReseedInterval is the number of bytes of entropy handed out between
+// reseeds from --entropy-source.
+const entropyReseedInterval = 1 << 20
+
+// setupEntropy replaces the source of entropy if --entropy-seed or
+// --entropy-source is set. It must be called before any entropy is handed to
+// the sandbox.
+func setupEntropy(conf *config.Config, fd int) error {
+	switch {
+	case conf.EntropySeed != "":
+		log.Warningf("Entropy is seeded by --entropy-seed, it is NOT random")
+		rand.Reader = rand.NewDeterministicReader([]byte(conf.EntropySeed))
+	case fd >= 0:
+		source := os.NewFile(uintptr(fd), "entropy-source")
+		r, err := rand.NewReseedingReader(source, entropyReseedInterval)
+		if err != nil {
+			_ = source.Close()
+			return err
+		}
+		log.Infof("Entropy is seeded from %q", conf.EntropySource)
+		rand.Reader = r
+	}
+	return nil
+}
+
+// sandboxFeatureSet returns the CPU features visible to the sandbox: the host
+// features, without the ones hidden by --cpu-features.
+func sandboxFeatureSet(conf *config.Config) (cpuid.FeatureSet, error) {
+	hidden, err := cpuid.ParseFeatureMask(conf.CPUFeatures)
+	if err != nil {
+		return cpuid.FeatureSet{}, fmt.Errorf("parsing --cpu-features: %w", err)
+	}
+	if len(hidden) == 0 {
+		return cpuid.HostFeatureSet().Fixed(), nil
+	}
+	log.Infof("Hiding CPU features: %v", hidden)
+	return cpuid.HostFeatureSet().Mask(hidden), nil
+}
+
+// createMemoryFile creates the sandbox memory file. If pressureFile is not
+// nil, evictions are driven by its PSI memory pressure notifications.
+func createMemoryFile(pressureFile *os.File) (*pgalloc.MemoryFile, error) {
 	const memfileName = "runsc-memory"
 	memfd, err := memutil.CreateMemFD(memfileName, 0)
 	if err != nil {
 		return nil, fmt.Errorf("error creating memfd: %w", err)
 	}
 	memfile := os.NewFile(uintptr(memfd), memfileName)
-	// We can't enable pgalloc.MemoryFileOpts.UseHostMemcgPressure even if
-	// there are memory cgroups specified, because at this point we're already
-	// in a mount namespace in which the relevant cgroupfs is not visible.
-	mf, err := pgalloc.NewMemoryFile(memfile, pgalloc.MemoryFileOpts{})
+	// We can't use cgroup v1 memory pressure levels even if there are memory
+	// cgroups specified, because at this point we're already in a mount
+	// namespace in which the relevant cgroupfs is not visible. The cgroup v2
+	// memory.pressure file is opened by the sandbox launcher instead.
+	mf, err := pgalloc.NewMemoryFile(memfile, pgalloc.MemoryFileOpts{
+		UseHostMemcgPressure:   pressureFile != nil,
+		HostMemoryPressureFile: pressureFile,
+	})
 	if err != nil {
 		_ = memfile.Close()
 		return nil, fmt.Errorf("error creating pgalloc.MemoryFile: %w", err)
@@ -650,7 +999,17 @@ func (l *Loader) installSeccompFilters() error {
 			ProfileEnable:         l.root.conf.ProfileEnable,
 			NVProxy:               l.root.conf.NVProxy,
 			TPUProxy:              l.root.conf.TPUProxy,
+			AutoCheckpointDirFD:   l.autoCheckpointDirFD,
+			CoreDumpDirFD:         l.coreDumpDirFD,
+			PortReservation:       l.portReservation(),
+			VFIO:                  l.root.conf.VFIONet.Enabled(),
+			VhostNet:              l.root.conf.VhostNet,
 			ControllerFD:          l.ctrl.srv.FD(),
+			GRPCControlFD:         l.grpcControlFD(),
+			ServiceFDs:            l.serviceFDs(),
+			AbstractUDSImport:     len(l.root.conf.AbstractUDSImports()) > 0,
+			AbstractUDSExportFDs:  l.abstractExportFDs(),
+			HostListenerFDs:       l.hostListenerFDs(),
 		}
 		if err := filter.Install(opts); err != nil {
 			return fmt.Errorf("installing seccomp filters: %w", err)
@@ -703,9 +1062,11 @@ func (l *Loader) run() error {
 
 		// Finally done with all configuration. Setup filters before user code
 		// is loaded.
+		endPhase := l.startup.Begin("", "seccomp")
 		if err := l.installSeccompFilters(); err != nil {
 			return err
 		}
+		endPhase()
 
 		// Create the root container init task. It will begin running
 		// when the kernel is started.
@@ -713,10 +1074,12 @@ func (l *Loader) run() error {
 			tg  *kernel.ThreadGroup
 			err error
 		)
+		endPhase = l.startup.Begin(l.sandboxID, "create-process")
 		tg, ep.tty, err = l.createContainerProcess(true, l.sandboxID, &l.root)
 		if err != nil {
 			return err
 		}
+		endPhase()
 
 		if seccheck.Global.Enabled(seccheck.PointContainerStart) {
 			evt := pb.Start{
@@ -740,9 +1103,19 @@ func (l *Loader) run() error {
 	}
 
 	ep.tg = l.k.GlobalInit()
+	l.holdMountNamespace(ep)
 	if ns, ok := specutils.GetNS(specs.PIDNamespace, l.root.spec); ok {
 		ep.pidnsPath = ns.Path
 	}
+	if ns, ok := specutils.GetNS(specs.NetworkNamespace, l.root.spec); ok {
+		ep.netnsPath = ns.Path
+	}
+	if ns, ok := specutils.GetNS(specs.UTSNamespace, l.root.spec); ok {
+		ep.utsnsPath = ns.Path
+	}
+	if ns, ok := specutils.GetNS(specs.IPCNamespace, l.root.spec); ok {
+		ep.ipcnsPath = ns.Path
+	}
 
 	// Handle signals by forwarding them to the root container process
 	// (except for panic signal, which should cause a panic).
@@ -768,7 +1141,17 @@ func (l *Loader) run() error {
 
 	log.Infof("Process should have started...")
 	l.watchdog.Start()
-	return l.k.Start()
+	endPhase := l.startup.Begin("", "kernel-start")
+	if err := l.k.Start(); err != nil {
+		return err
+	}
+	endPhase()
+	l.updateSynthesizedFilesLocked()
+	l.startProbesLocked(l.sandboxID, l.root.spec)
+	l.startServicesLocked(l.sandboxID, l.root.spec)
+	l.startServices()
+	l.startAbstractExports()
+	return l.startAutoCheckpoint()
 }
 
 // createSubcontainer creates a new container inside the sandbox.
@@ -839,6 +1222,13 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 		pidns = l.k.RootPIDNamespace()
 	}
 
+	if err := l.setupSubcontainerNetworkNamespace(spec, conf, cid, ep); err != nil {
+		return err
+	}
+	if err := l.setupSubcontainerUTSAndIPCNamespaces(spec, creds, ep); err != nil {
+		return err
+	}
+
 	info := &containerInfo{
 		conf:                conf,
 		spec:                spec,
@@ -851,6 +1241,18 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 	if err != nil {
 		return fmt.Errorf("creating new process: %w", err)
 	}
+	info.procArgs.ReapOrphans = conf.Init
+	info.procArgs.NetworkNamespace = ep.netns
+	if ep.utsns != nil {
+		info.procArgs.UTSNamespace = ep.utsns
+	}
+	if ep.ipcns != nil {
+		// Replace the reference on the root IPC namespace taken by
+		// createProcessArgs.
+		info.procArgs.IPCNamespace.DecRef(l.k.SupervisorContext())
+		ep.ipcns.IncRef()
+		info.procArgs.IPCNamespace = ep.ipcns
+	}
 
 	// Use stdios or TTY depending on the spec configuration.
 	if spec.Process.Terminal {
@@ -866,10 +1268,13 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 		info.stdioFDs = stdioFDs
 	}
 
+	endPhase := l.startup.Begin(cid, "create-process")
 	ep.tg, ep.tty, err = l.createContainerProcess(false, cid, info)
 	if err != nil {
 		return err
 	}
+	l.holdMountNamespace(ep)
+	endPhase()
 
 	if seccheck.Global.Enabled(seccheck.PointContainerStart) {
 		evt := pb.Start{
@@ -892,16 +1297,121 @@ func (l *Loader) startSubcontainer(spec *specs.Spec, conf *config.Config, cid st
 	}
 
 	l.k.StartProcess(ep.tg)
+	l.startProbesLocked(cid, spec)
+	l.startServicesLocked(cid, spec)
+	l.updateSynthesizedFilesLocked()
 	return nil
 }
 
+// setupSubcontainerUTSAndIPCNamespaces sets the UTS and IPC namespaces of a
+// subcontainer based on its spec, following runc semantics:
+//   - Containers without the namespace in their spec use the root namespace.
+//   - Containers with the same namespace path as another container share its
+//     namespace.
+//   - Otherwise, the container gets a new namespace. New UTS namespaces use
+//     the hostname from the spec, if set.
+//
+// Containers using the root UTS namespace whose spec sets a different
+// hostname than the sandbox's get a new UTS namespace as well.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) setupSubcontainerUTSAndIPCNamespaces(spec *specs.Spec, creds *auth.Credentials, ep *execProcess) error {
+	if ns, ok := specutils.GetNS(specs.UTSNamespace, spec); ok {
+		ep.utsnsPath = ns.Path
+		if p := l.findNamespaceOwner(ep, ns.Path, func(p *execProcess) string { return p.utsnsPath }); p != nil {
+			log.Debugf("Joining UTS namespace named %q", ns.Path)
+			ep.utsns = p.utsns
+		} else {
+			ep.utsns = l.k.RootUTSNamespace().Clone(l.k.RootUserNamespace())
+			if spec.Hostname != "" {
+				ep.utsns.SetHostName(spec.Hostname)
+			}
+		}
+	} else if spec.Hostname != "" && spec.Hostname != l.k.RootUTSNamespace().HostName() {
+		// The container shares the sandbox's UTS namespace but asks for a
+		// hostname of its own. Give it a new namespace, so that the hostname
+		// doesn't change for the other containers.
+		log.Infof("Container hostname %q differs from the sandbox's, creating new UTS namespace", spec.Hostname)
+		ep.utsns = l.k.RootUTSNamespace().Clone(l.k.RootUserNamespace())
+		ep.utsns.SetHostName(spec.Hostname)
+	}
+
+	if ns, ok := specutils.GetNS(specs.IPCNamespace, spec); ok {
+		ep.ipcnsPath = ns.Path
+		if p := l.findNamespaceOwner(ep, ns.Path, func(p *execProcess) string { return p.ipcnsPath }); p != nil {
+			log.Debugf("Joining IPC namespace named %q", ns.Path)
+			if p.ipcns != nil {
+				p.ipcns.IncRef()
+				ep.ipcns = p.ipcns
+			}
+		} else {
+			ipcns := kernel.NewIPCNamespace(l.k.RootUserNamespace())
+			if err := ipcns.InitPosixQueues(l.k.SupervisorContext(), l.k.VFS(), creds); err != nil {
+				ipcns.DecRef(l.k.SupervisorContext())
+				return fmt.Errorf("creating IPC namespace: %w", err)
+			}
+			ep.ipcns = ipcns
+		}
+	}
+	return nil
+}
+
+// findNamespaceOwner returns the container, other than ep, whose namespace
+// path returned by nsPath is path. It returns nil if path is empty or if there
+// is no such container.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) findNamespaceOwner(ep *execProcess, path string, nsPath func(*execProcess) string) *execProcess {
+	if path == "" {
+		return nil
+	}
+	for key, p := range l.processes {
+		if key.pid == 0 && p != ep && nsPath(p) == path {
+			return p
+		}
+	}
+	return nil
+}
+
+// releaseNamespaces releases the namespaces held by ep.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) releaseNamespaces(ep *execProcess) {
+	l.releaseNetworkNamespace(ep)
+	if ep.ipcns != nil {
+		ep.ipcns.DecRef(l.k.SupervisorContext())
+		ep.ipcns = nil
+	}
+	if ep.mntns != nil {
+		ep.mntns.DecRef(l.k.SupervisorContext())
+		ep.mntns = nil
+	}
+}
+
+// holdMountNamespace takes a reference on the mount namespace of the init
+// process of ep, which must have started.
+func (l *Loader) holdMountNamespace(ep *execProcess) {
+	if mntns := ep.tg.Leader().MountNamespace(); mntns != nil && mntns.TryIncRef() {
+		ep.mntns = mntns
+	}
+}
+
 func (l *Loader) createContainerProcess(root bool, cid string, info *containerInfo) (*kernel.ThreadGroup, *host.TTYFileDescription, error) {
 	// Create the FD map, which will set stdin, stdout, and stderr.
 	ctx := info.procArgs.NewContext(l.k)
-	fdTable, ttyFile, err := createFDTable(ctx, info.spec.Process.Terminal, info.stdioFDs, info.passFDs, info.spec.Process.User)
+	passFDs, listeners := splitHostListeners(info.passFDs)
+	fdTable, ttyFile, err := createFDTable(ctx, info.spec.Process.Terminal, info.stdioFDs, passFDs, info.spec.Process.User)
 	if err != nil {
 		return nil, nil, fmt.Errorf("importing fds: %w", err)
 	}
+	netns := info.procArgs.NetworkNamespace
+	if netns == nil {
+		netns = l.k.RootNetworkNamespace()
+	}
+	if err := l.importHostListeners(ctx, cid, fdTable, netns, listeners); err != nil {
+		fdTable.DecRef(ctx)
+		return nil, nil, err
+	}
 	// CreateProcess takes a reference on fdTable if successful. We won't need
 	// ours either way.
 	info.procArgs.FDTable = fdTable
@@ -932,15 +1442,24 @@ func (l *Loader) createContainerProcess(root bool, cid string, info *containerIn
 	}
 	l.startGoferMonitor(cid, int32(info.goferFDs[0].FD()))
 
-	mntr := newContainerMounter(info, l.k, l.mountHints, l.productName, l.sandboxID)
+	mntr := newContainerMounter(info, cid, l.k, l.mountHints, l.productName, l.sandboxID)
 	if root {
 		if err := mntr.processHints(info.conf, info.procArgs.Credentials); err != nil {
 			return nil, nil, err
 		}
 	}
+	endPhase := l.startup.Begin(cid, "mounts")
 	if err := setupContainerVFS(ctx, info, mntr, &info.procArgs); err != nil {
 		return nil, nil, err
 	}
+	endPhase()
+	l.addSynthesizedFilesLocked(cid, mntr.synthesized)
+	l.addGoferMountsLocked(cid, mntr.goferMounts)
+	if info.spec.Linux != nil {
+		if err := applySysctls(l.k, &info.procArgs, info.spec.Linux.Sysctl, info.conf.SysctlPolicy); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	// Add the HOME environment variable if it is not already set.
 	info.procArgs.Envv, err = user.MaybeAddExecUserHome(ctx, info.procArgs.MountNamespace,
@@ -993,28 +1512,53 @@ func (l *Loader) createContainerProcess(root bool, cid string, info *containerIn
 
 // startGoferMonitor runs a goroutine to monitor gofer's health. It polls on
 // the gofer FD looking for disconnects, and kills the container processes if
-// the rootfs FD disconnects.
+// the rootfs FD disconnects. If gofer recovery is enabled, the container is
+// only killed if the gofer isn't restarted within the recovery timeout; see
+// Loader.reconnectGofer.
 //
 // Note that other gofer mounts are allowed to be unmounted and disconnected.
+//
+// Preconditions: l.mu is locked.
 func (l *Loader) startGoferMonitor(cid string, rootfsGoferFD int32) {
 	if rootfsGoferFD < 0 {
 		panic(fmt.Sprintf("invalid FD: %d", rootfsGoferFD))
 	}
+	reconnected := make(chan int32, 1)
+	if l.goferReconnects == nil {
+		l.goferReconnects = make(map[string]chan int32)
+	}
+	l.goferReconnects[cid] = reconnected
+	recoveryTimeout := l.root.conf.GoferRecoveryTimeout
 	go func() {
-		log.Debugf("Monitoring gofer health for container %q", cid)
-		events := []unix.PollFd{
-			{
-				Fd:     rootfsGoferFD,
-				Events: unix.POLLHUP | unix.POLLRDHUP,
-			},
-		}
-		_, _, err := specutils.RetryEintr(func() (uintptr, uintptr, error) {
-			// Use ppoll instead of poll because it's already allowed in seccomp.
-			n, err := unix.Ppoll(events, nil, nil)
-			return uintptr(n), 0, err
-		})
-		if err != nil {
-			panic(fmt.Sprintf("Error monitoring gofer FDs: %s", err))
+		for {
+			log.Debugf("Monitoring gofer health for container %q", cid)
+			events := []unix.PollFd{
+				{
+					Fd:     rootfsGoferFD,
+					Events: unix.POLLHUP | unix.POLLRDHUP,
+				},
+			}
+			_, _, err := specutils.RetryEintr(func() (uintptr, uintptr, error) {
+				// Use ppoll instead of poll because it's already allowed in seccomp.
+				n, err := unix.Ppoll(events, nil, nil)
+				return uintptr(n), 0, err
+			})
+			if err != nil {
+				panic(fmt.Sprintf("Error monitoring gofer FDs: %s", err))
+			}
+
+			if recoveryTimeout > 0 && l.containerRunning(cid) {
+				log.Warningf("Gofer socket disconnected for container %q, waiting %v for the gofer to be restarted", cid, recoveryTimeout)
+				timer := gtime.NewTimer(recoveryTimeout)
+				select {
+				case fd := <-reconnected:
+					timer.Stop()
+					rootfsGoferFD = fd
+					continue
+				case <-timer.C:
+				}
+			}
+			break
 		}
 
 		l.mu.Lock()
@@ -1057,18 +1601,59 @@ func (l *Loader) destroySubcontainer(cid string) error {
 		}
 	}
 
-	// No more failure from this point on. Remove all container thread groups
-	// from the map.
-	for key := range l.processes {
+	// No more failure from this point on. Stop probes and services, and
+	// remove all container thread groups from the map.
+	l.stopProbesLocked(cid)
+	l.stopServicesLocked(cid)
+	l.removeSynthesizedFilesLocked(cid)
+	l.removeGoferMountsLocked(cid)
+	for key, ep := range l.processes {
 		if key.cid == cid {
+			l.releaseNamespaces(ep)
 			delete(l.processes, key)
 		}
 	}
 
+	l.updateSynthesizedFilesLocked()
+
 	log.Debugf("Container destroyed, cid: %s", cid)
 	return nil
 }
 
+// exportRootfs writes the upper layer of the overlay at the root of container
+// cid to w. The container may have stopped, as long as it hasn't been
+// destroyed.
+func (l *Loader) exportRootfs(cid string, w io.Writer) error {
+	l.mu.Lock()
+	ep := l.processes[execID{cid: cid}]
+	if ep == nil {
+		l.mu.Unlock()
+		return fmt.Errorf("container %q not found", cid)
+	}
+	mntns := ep.mntns
+	if mntns == nil && ep.tg != nil {
+		// The root container of a restored sandbox.
+		mntns = ep.tg.Leader().MountNamespace()
+	}
+	if mntns == nil || !mntns.TryIncRef() {
+		l.mu.Unlock()
+		return fmt.Errorf("container %q not started", cid)
+	}
+	l.mu.Unlock()
+
+	ctx := l.k.SupervisorContext()
+	defer mntns.DecRef(ctx)
+	root := mntns.Root()
+	if name := root.Mount().Filesystem().FilesystemType().Name(); name != overlay.Name {
+		return fmt.Errorf("root filesystem of container %q is %q, not an overlay; see --overlay2", cid, name)
+	}
+	creds := auth.NewRootCredentials(l.k.RootUserNamespace())
+	if err := overlay.ExportUpperLayer(ctx, creds, root, w); err != nil {
+		return fmt.Errorf("exporting root filesystem of container %q: %w", cid, err)
+	}
+	return nil
+}
+
 func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 	// Hold the lock for the entire operation to ensure that exec'd process is
 	// added to 'processes' in case it races with destroyContainer().
@@ -1104,6 +1689,11 @@ func (l *Loader) executeAsync(args *control.ExecArgs) (kernel.ThreadID, error) {
 		return 0, err
 	}
 	args.PIDNamespace = tg.PIDNamespace()
+	if ep := l.processes[execID{cid: args.ContainerID}]; ep != nil {
+		args.NetworkNamespace = ep.netns
+		args.UTSNamespace = ep.utsns
+		args.IPCNamespace = ep.ipcns
+	}
 
 	args.Limits, err = createLimitSet(l.root.spec)
 	if err != nil {
@@ -1535,9 +2125,37 @@ func (l *Loader) portForward(opts *PortForwardOpts) error {
 		return fmt.Errorf("container %q not started", cid)
 	}
 
+	return l.startProxyLocked(cid, opts.Files[0], func() (pf.ProxyPair, error) {
+		var pair pf.ProxyPair
+		switch l.root.conf.Network {
+		case config.NetworkSandbox:
+			stack := l.k.RootNetworkNamespace().Stack().(*netstack.Stack).Stack
+			nsConn, err := pf.NewNetstackConn(stack, opts.Port)
+			if err != nil {
+				return pair, fmt.Errorf("creating netstack port forward connection: %w", err)
+			}
+			pair.From = nsConn
+		case config.NetworkHost:
+			hConn, err := pf.NewHostInetConn(opts.Port)
+			if err != nil {
+				return pair, fmt.Errorf("creating hostinet port forward connection: %w", err)
+			}
+			pair.From = hConn
+		default:
+			return pair, fmt.Errorf("unsupported network type %q for container %q", l.root.conf.Network, cid)
+		}
+		return pair, nil
+	})
+}
+
+// startProxyLocked starts forwarding data between the host stream file f and
+// the connection returned by connect in ProxyPair.From.
+//
+// Preconditions: l.mu must be locked.
+func (l *Loader) startProxyLocked(cid string, f *os.File, connect func() (pf.ProxyPair, error)) error {
 	// Import the fd for the UDS.
 	ctx := l.k.SupervisorContext()
-	fd, err := l.importFD(ctx, opts.Files[0])
+	fd, err := l.importFD(ctx, f)
 	if err != nil {
 		return fmt.Errorf("importing stream fd: %w", err)
 	}
@@ -1547,27 +2165,22 @@ func (l *Loader) portForward(opts *PortForwardOpts) error {
 	fdConn := pf.NewFileDescriptionConn(fd)
 
 	// Create a proxy to forward data between the fdConn and the sandboxed application.
-	pair := pf.ProxyPair{To: fdConn}
-
-	switch l.root.conf.Network {
-	case config.NetworkSandbox:
-		stack := l.k.RootNetworkNamespace().Stack().(*netstack.Stack).Stack
-		nsConn, err := pf.NewNetstackConn(stack, opts.Port)
-		if err != nil {
-			return fmt.Errorf("creating netstack port forward connection: %w", err)
-		}
-		pair.From = nsConn
-	case config.NetworkHost:
-		hConn, err := pf.NewHostInetConn(opts.Port)
-		if err != nil {
-			return fmt.Errorf("creating hostinet port forward connection: %w", err)
-		}
-		pair.From = hConn
-	default:
-		return fmt.Errorf("unsupported network type %q for container %q", l.root.conf.Network, cid)
+	pair, err := connect()
+	if err != nil {
+		return err
 	}
+	pair.To = fdConn
 	cu.Release()
-	proxy := pf.NewProxy(pair, opts.ContainerID)
+	l.startProxyPairLocked(ctx, cid, pair)
+	return nil
+}
+
+// startProxyPairLocked starts forwarding data between the connections of pair,
+// until either is closed.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) startProxyPairLocked(ctx context.Context, cid string, pair pf.ProxyPair) {
+	proxy := pf.NewProxy(pair, cid)
 
 	// Add to the list of port forward connections and remove when the
 	// connection closes.
@@ -1585,7 +2198,6 @@ func (l *Loader) portForward(opts *PortForwardOpts) error {
 
 	// Start forwarding on the connection.
 	proxy.Start(ctx)
-	return nil
 }
 
 // importFD generically imports a host file descriptor without adding it to any
@@ -1623,3 +2235,24 @@ func (l *Loader) containerCount() int {
 	}
 	return containers
 }
+
+// containerExists returns true if container cid is in the sandbox.
+func (l *Loader) containerExists(cid string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.processes[execID{cid: cid}]
+	return ok
+}
+
+// lsmFromConfig returns the LSM presented to applications for the given
+// configuration value.
+func lsmFromConfig(lsm config.LSM) vfs.LSM {
+	switch lsm {
+	case config.LSMAppArmor:
+		return vfs.LSMAppArmor
+	case config.LSMSELinux:
+		return vfs.LSMSELinux
+	default:
+		return vfs.LSMNone
+	}
+}
@@ -16,10 +16,13 @@ package boot
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/gofer"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/tmpfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/runsc/config"
@@ -94,13 +97,27 @@ func (o lifecycleType) String() string {
 	}
 }
 
+// tuningKeys are the mount annotation keys that tune the behavior of a
+// volume. Unlike other keys, invalid values fail pod creation rather than
+// being ignored, so that a volume doesn't silently run with the defaults.
+var tuningKeys = map[string]struct{}{
+	"cache":     {},
+	"overlay":   {},
+	"readahead": {},
+	"writeback": {},
+	"directfs":  {},
+	"ino":       {},
+	"dev":       {},
+	"watch":     {},
+}
+
 // PodMountHints contains a collection of mountHints for the pod.
 type PodMountHints struct {
 	mounts map[string]*MountHint
 }
 
 // NewPodMountHints instantiates PodMountHints using spec.
-func NewPodMountHints(spec *specs.Spec) (*PodMountHints, error) {
+func NewPodMountHints(spec *specs.Spec, conf *config.Config) (*PodMountHints, error) {
 	mnts := make(map[string]*MountHint)
 	for k, v := range spec.Annotations {
 		// Look for 'dev.gvisor.spec.mount' annotations and parse them.
@@ -120,6 +137,9 @@ func NewPodMountHints(spec *specs.Spec) (*PodMountHints, error) {
 				mnts[name] = mnt
 			}
 			if err := mnt.setField(parts[1], v); err != nil {
+				if _, ok := tuningKeys[parts[1]]; ok {
+					return nil, fmt.Errorf("invalid mount annotation %s=%s: %w", k, v, err)
+				}
 				log.Warningf("ignoring invalid mount annotation (name = %q, key = %q, value = %q): %v", name, parts[1], v, err)
 			}
 		}
@@ -127,18 +147,24 @@ func NewPodMountHints(spec *specs.Spec) (*PodMountHints, error) {
 
 	// Validate all the parsed hints.
 	for name, m := range mnts {
-		log.Infof("Mount annotation found, name: %s, source: %q, type: %s, share: %v", name, m.mount.Source, m.mount.Type, m.share)
+		log.Infof("Mount annotation found, name: %s, source: %q, type: %s, share: %v, synthesize: %t", name, m.mount.Source, m.mount.Type, m.share, m.synthesize)
 		if m.share == invalid || len(m.mount.Source) == 0 || len(m.mount.Type) == 0 {
 			log.Warningf("ignoring mount annotations for %q because of missing required field(s)", name)
 			delete(mnts, name)
 			continue
 		}
+		if err := m.checkTuning(conf); err != nil {
+			return nil, fmt.Errorf("invalid mount annotations for %q: %w", name, err)
+		}
 
-		// Check for duplicate mount sources.
+		// Check for duplicate mount sources and device numbers.
 		for name2, m2 := range mnts {
 			if name != name2 && m.mount.Source == m2.mount.Source {
 				return nil, fmt.Errorf("mounts %q and %q have the same mount source %q", m.name, m2.name, m.mount.Source)
 			}
+			if name != name2 && m.dev != 0 && m.dev == m2.dev {
+				return nil, fmt.Errorf("mounts %q and %q have the same device number %d", m.name, m2.name, m.dev)
+			}
 		}
 	}
 
@@ -154,6 +180,46 @@ type MountHint struct {
 	mount     specs.Mount
 	lifecycle lifecycleType
 
+	// synthesize indicates that, when the mount is a file mounted at
+	// /etc/hosts or /etc/hostname, the sandbox replaces the file with one it
+	// keeps up to date: /etc/hostname holds the container's hostname, and
+	// /etc/hosts gets entries for all containers in the pod.
+	synthesize bool
+
+	// cache overrides the file access type of a bind mount, if not empty. It's
+	// either "exclusive" or "shared".
+	cache string
+
+	// overlay overrides the overlay medium of a bind mount, if not empty.
+	// It's one of "none", "memory" or "self".
+	overlay string
+
+	// readahead is the maximum number of bytes read ahead of accesses to
+	// files of a bind mount, or 0 for the default.
+	readahead uint64
+
+	// writeback is the number of bytes appended to files of a bind mount that
+	// are buffered in the page cache and written back together, or 0 to
+	// write through.
+	writeback uint64
+
+	// directfs overrides --directfs for a bind mount, if not nil.
+	directfs *bool
+
+	// ino sets how inode numbers are assigned to the files of a bind mount,
+	// if not empty. It's one of "virtual", "persist" or "host"; see
+	// gofer.InoMode.
+	ino string
+
+	// dev is the minor device number of a bind mount, if not 0, so that
+	// st_dev of its files doesn't depend on the order of mounts.
+	dev uint32
+
+	// watch indicates that the files of a bind mount are watched on the host
+	// for changes made outside of the sandbox, which invalidate the cached
+	// metadata and contents of the changed files.
+	watch bool
+
 	// vfsMount is the master mount for the volume. For mounts with 'pod' share
 	// the master volume is bind mounted inside the containers.
 	vfsMount *vfs.Mount
@@ -174,6 +240,63 @@ func (m *MountHint) setField(key, val string) error {
 		m.mount.Options = specutils.FilterMountOptions(strings.Split(val, ","))
 	case "lifecycle":
 		return m.setLifecycle(val)
+	case "synthesize":
+		v, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid synthesize value %q", val)
+		}
+		m.synthesize = v
+	case "cache":
+		switch val {
+		case "exclusive", "shared":
+			m.cache = val
+		default:
+			return fmt.Errorf("invalid cache value %q", val)
+		}
+	case "overlay":
+		switch val {
+		case "none", "memory", "self":
+			m.overlay = val
+		default:
+			return fmt.Errorf("invalid overlay value %q", val)
+		}
+	case "readahead":
+		v, err := strconv.ParseUint(val, 10, 64)
+		if err != nil || v == 0 || v%hostarch.PageSize != 0 || v > maxReadahead {
+			return fmt.Errorf("invalid readahead value %q, must be a multiple of %d bytes up to %d bytes", val, hostarch.PageSize, maxReadahead)
+		}
+		m.readahead = v
+	case "writeback":
+		v, err := strconv.ParseUint(val, 10, 64)
+		if err != nil || v == 0 || v%hostarch.PageSize != 0 || v > maxWriteback {
+			return fmt.Errorf("invalid writeback value %q, must be a multiple of %d bytes up to %d bytes", val, hostarch.PageSize, maxWriteback)
+		}
+		m.writeback = v
+	case "directfs":
+		v, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid directfs value %q", val)
+		}
+		m.directfs = &v
+	case "ino":
+		switch val {
+		case gofer.InoModeVirtual.String(), gofer.InoModePersist.String(), gofer.InoModeHost.String():
+			m.ino = val
+		default:
+			return fmt.Errorf("invalid ino value %q", val)
+		}
+	case "dev":
+		v, err := strconv.ParseUint(val, 10, 32)
+		if err != nil || v < minDevMinor || v > maxDevMinor {
+			return fmt.Errorf("invalid dev value %q, must be between %d and %d", val, minDevMinor, maxDevMinor)
+		}
+		m.dev = uint32(v)
+	case "watch":
+		v, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("invalid watch value %q", val)
+		}
+		m.watch = v
 	default:
 		return fmt.Errorf("invalid mount annotation: %s=%s", key, val)
 	}
@@ -218,6 +341,80 @@ func (m *MountHint) setLifecycle(val string) error {
 	return nil
 }
 
+// maxReadahead is the maximum value of the "readahead" mount annotation.
+const maxReadahead = 16 << 20 // 16 MiB
+
+// maxWriteback is the maximum value of the "writeback" mount annotation.
+const maxWriteback = 64 << 20 // 64 MiB
+
+// minDevMinor and maxDevMinor bound the value of the "dev" mount annotation.
+// Device numbers below minDevMinor are left for the filesystems that get
+// dynamically allocated ones.
+const (
+	minDevMinor = 1 << 16
+	maxDevMinor = (1 << 20) - 2
+)
+
+// checkTuning checks that the tuning annotations of the mount are consistent
+// with the rest of the hint and with conf.
+func (m *MountHint) checkTuning(conf *config.Config) error {
+	if m.mount.Type != Bind {
+		switch {
+		case m.cache != "":
+			return fmt.Errorf("cache is only supported for bind mounts")
+		case m.overlay != "":
+			return fmt.Errorf("overlay is only supported for bind mounts")
+		case m.readahead != 0:
+			return fmt.Errorf("readahead is only supported for bind mounts")
+		case m.writeback != 0:
+			return fmt.Errorf("writeback is only supported for bind mounts")
+		case m.directfs != nil:
+			return fmt.Errorf("directfs is only supported for bind mounts")
+		case m.ino != "":
+			return fmt.Errorf("ino is only supported for bind mounts")
+		case m.dev != 0:
+			return fmt.Errorf("dev is only supported for bind mounts")
+		case m.watch:
+			return fmt.Errorf("watch is only supported for bind mounts")
+		}
+		return nil
+	}
+	if m.cache == "exclusive" && m.share == shared && !m.watch {
+		return fmt.Errorf("cache=exclusive is incompatible with share=shared, as the volume can be changed outside of the pod, unless watch=true")
+	}
+	if m.watch && m.cache == "shared" {
+		return fmt.Errorf("watch is redundant with cache=shared, which revalidates all files")
+	}
+	if m.overlay != "" && m.overlay != "none" && m.share != container {
+		// Each container would get its own overlay, hiding changes from the
+		// other containers sharing the volume.
+		return fmt.Errorf("overlay=%s requires share=container", m.overlay)
+	}
+	if m.writeback != 0 && m.cache == "shared" {
+		return fmt.Errorf("writeback requires the file contents to be cached, which cache=shared prevents")
+	}
+	if m.directfs != nil && *m.directfs && !conf.DirectFS {
+		return fmt.Errorf("directfs=true requires --directfs")
+	}
+	return nil
+}
+
+// OverlayMedium returns the overlay medium set for the mount by annotation.
+// It returns false if the medium isn't set, in which case it's chosen from the
+// configuration.
+func (m *MountHint) OverlayMedium() (OverlayMedium, bool) {
+	switch m.overlay {
+	case "none":
+		return NoOverlay, true
+	case "memory":
+		return MemoryMedium, true
+	case "self":
+		return SelfMedium, true
+	default:
+		return NoOverlay, false
+	}
+}
+
 // shouldShareMount returns true if this mount should be configured as a shared
 // mount that is shared among multiple containers in a pod.
 func (m *MountHint) shouldShareMount() bool {
@@ -254,6 +451,12 @@ func (m *MountHint) checkCompatible(replica *specs.Mount) error {
 
 // Precondition: m.mount.Type == Bind.
 func (m *MountHint) fileAccessType() config.FileAccessType {
+	switch m.cache {
+	case "exclusive":
+		return config.FileAccessExclusive
+	case "shared":
+		return config.FileAccessShared
+	}
 	if m.share == shared {
 		return config.FileAccessShared
 	}
@@ -0,0 +1,191 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	pf "github.com/talismancer/gvisor-ligolo/runsc/boot/portforward"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+)
+
+// parseFullAddress parses an "ip:port" address. The IP may be empty to mean
+// any address.
+func parseFullAddress(s string) (tcpip.FullAddress, error) {
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return tcpip.FullAddress{}, err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return tcpip.FullAddress{}, fmt.Errorf("invalid port %q", portStr)
+	}
+	addr := tcpip.FullAddress{Port: uint16(port)}
+	if host == "" {
+		return addr, nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return tcpip.FullAddress{}, fmt.Errorf("invalid IP address %q, host names aren't resolved", host)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		addr.Addr = tcpip.AddrFromSlice(ip4)
+	} else {
+		addr.Addr = tcpip.AddrFromSlice(ip)
+	}
+	return addr, nil
+}
+
+// formatFullAddress is the inverse of parseFullAddress.
+func formatFullAddress(addr tcpip.FullAddress) string {
+	return net.JoinHostPort(addr.Addr.String(), strconv.Itoa(int(addr.Port)))
+}
+
+// netstackForContainerLocked returns the network stack connections of container
+// cid are made through.
+//
+// Preconditions: l.mu must be locked.
+func (l *Loader) netstackForContainerLocked(cid string) (*stack.Stack, error) {
+	tg, err := l.tryThreadGroupFromIDLocked(execID{cid: cid})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get threadgroup from %q: %w", cid, err)
+	}
+	if tg == nil {
+		return nil, fmt.Errorf("container %q not started", cid)
+	}
+	if l.root.conf.Network != config.NetworkSandbox {
+		return nil, fmt.Errorf("network type %q doesn't use netstack, connect to the host directly", l.root.conf.Network)
+	}
+	return l.k.RootNetworkNamespace().Stack().(*netstack.Stack).Stack, nil
+}
+
+// dial connects to opts.Address through netstack and forwards data between
+// the connection and the stream file passed in opts.
+func (l *Loader) dial(opts *DialOpts) error {
+	if len(opts.Files) != 1 {
+		return fmt.Errorf("stream FD is required for dial")
+	}
+	addr, err := parseFullAddress(opts.Address)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	stack, err := l.netstackForContainerLocked(opts.ContainerID)
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Connecting may take long, don't hold the lock meanwhile.
+	conn, err := pf.DialNetstack(stack, addr)
+	if err != nil {
+		return fmt.Errorf("dialing %s: %w", opts.Address, err)
+	}
+	log.Infof("Dialed %s from container %q", opts.Address, opts.ContainerID)
+	return l.forwardConn(opts.ContainerID, opts.Files[0], pf.ProxyPair{From: conn})
+}
+
+// forwardConn forwards data between the connection in pair.From and the host
+// stream file f. pair.From is closed on failure.
+func (l *Loader) forwardConn(cid string, f *os.File, pair pf.ProxyPair) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	connected := false
+	err := l.startProxyLocked(cid, f, func() (pf.ProxyPair, error) {
+		connected = true
+		return pair, nil
+	})
+	if err != nil && !connected {
+		pair.From.Close(l.k.SupervisorContext())
+	}
+	return err
+}
+
+// listen creates a listener in netstack. Connections are accepted with
+// accept.
+func (l *Loader) listen(opts *ListenOpts) (*ListenResult, error) {
+	addr, err := parseFullAddress(opts.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stack, err := l.netstackForContainerLocked(opts.ContainerID)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := pf.ListenNetstack(stack, addr)
+	if err != nil {
+		return nil, err
+	}
+	bound, err := ln.Addr()
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if l.netListeners == nil {
+		l.netListeners = make(map[uint64]*pf.NetstackListener)
+	}
+	l.lastNetListenerID++
+	id := l.lastNetListenerID
+	l.netListeners[id] = ln
+	log.Infof("Listening on %s for container %q, listener ID %d", formatFullAddress(bound), opts.ContainerID, id)
+	return &ListenResult{ID: id, Address: formatFullAddress(bound)}, nil
+}
+
+// accept waits for a connection on listener opts.ID and forwards data between
+// it and the stream file passed in opts.
+func (l *Loader) accept(opts *AcceptOpts) (*AcceptResult, error) {
+	if len(opts.Files) != 1 {
+		return nil, fmt.Errorf("stream FD is required for accept")
+	}
+	l.mu.Lock()
+	ln, ok := l.netListeners[opts.ID]
+	l.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no listener with ID %d", opts.ID)
+	}
+
+	conn, peer, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if err := l.forwardConn(opts.ContainerID, opts.Files[0], pf.ProxyPair{From: conn}); err != nil {
+		return nil, err
+	}
+	return &AcceptResult{Address: formatFullAddress(peer)}, nil
+}
+
+// closeListener closes listener id. Pending calls to accept fail.
+func (l *Loader) closeListener(id uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ln, ok := l.netListeners[id]
+	if !ok {
+		return fmt.Errorf("no listener with ID %d", id)
+	}
+	delete(l.netListeners, id)
+	ln.Close()
+	return nil
+}
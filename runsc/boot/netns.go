@@ -0,0 +1,263 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/rand"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/inet"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netlink/uevent"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/ethernet"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/packetsocket"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/pipe"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+)
+
+const (
+	// vethAnnotation requests a veth pair between a subcontainer's network
+	// namespace and the root network namespace of the sandbox. Its value is
+	// "<container address>/<prefix>,<root address>/<prefix>", e.g.
+	// "10.1.0.2/24,10.1.0.1/24". The container end is named "eth0" and uses
+	// the root end as its default gateway.
+	vethAnnotation = "dev.gvisor.net.veth"
+
+	// vethMTU is the MTU of veth pairs, which matches the Linux default.
+	vethMTU = 1500
+
+	// vethContainerName is the name of the container end of a veth pair.
+	vethContainerName = "eth0"
+
+	// vethRootPrefix is the name prefix of the root end of a veth pair. It's
+	// followed by the beginning of the container ID.
+	vethRootPrefix = "veth"
+
+	// linuxIfNameMax is the maximum length of an interface name, excluding
+	// the NUL terminator.
+	linuxIfNameMax = 15
+)
+
+// setupSubcontainerNetworkNamespace sets the network namespace of a
+// subcontainer based on the network namespace path in its spec:
+//   - Containers without a path run in the root network namespace.
+//   - Containers with the same path as another container, including the root
+//     container, share its network namespace.
+//   - Otherwise, the container gets a new network namespace in the sentry,
+//     which only has a loopback interface unless vethAnnotation is set.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) setupSubcontainerNetworkNamespace(spec *specs.Spec, conf *config.Config, cid string, ep *execProcess) error {
+	ns, ok := specutils.GetNS(specs.NetworkNamespace, spec)
+	if !ok || ns.Path == "" {
+		return nil
+	}
+	ep.netnsPath = ns.Path
+	if p := l.findNamespaceOwner(ep, ns.Path, func(p *execProcess) string { return p.netnsPath }); p != nil {
+		log.Debugf("Joining network namespace named %q", ns.Path)
+		if p.netns != nil {
+			p.netns.IncRef()
+			ep.netns = p.netns
+		}
+		if _, ok := spec.Annotations[vethAnnotation]; ok {
+			log.Warningf("Ignoring %q for container %q, network namespace %q already exists", vethAnnotation, cid, ns.Path)
+		}
+		return nil
+	}
+
+	if conf.Network == config.NetworkHost {
+		log.Warningf("Network namespaces are not supported with hostinet, container %q runs in the root network namespace", cid)
+		return nil
+	}
+	log.Infof("Creating network namespace %q for container %q", ns.Path, cid)
+	ep.netns = l.k.NewNetworkNamespace(l.k.SupervisorContext(), l.k.RootUserNamespace())
+	if val, ok := spec.Annotations[vethAnnotation]; ok {
+		if err := l.createVeth(cid, ep, val); err != nil {
+			return fmt.Errorf("creating veth pair: %w", err)
+		}
+	}
+	return nil
+}
+
+// createVeth creates a veth pair between ep's network namespace and the root
+// network namespace, configured as described by vethAnnotation.
+//
+// Preconditions: l.mu is locked. ep.netns is a new network namespace.
+func (l *Loader) createVeth(cid string, ep *execProcess, val string) error {
+	linkAddr, err := randomLinkAddress()
+	if err != nil {
+		return err
+	}
+	rootLinkAddr, err := randomLinkAddress()
+	if err != nil {
+		return err
+	}
+	name := vethRootPrefix + cid
+	if len(name) > linuxIfNameMax {
+		name = name[:linuxIfNameMax]
+	}
+	v := &netstack.Veth{
+		Root:         l.k.RootNetworkNamespace(),
+		RootID:       tcpip.NICID(l.k.UniqueID()),
+		RootName:     name,
+		RootLinkAddr: rootLinkAddr,
+		ID:           tcpip.NICID(l.k.UniqueID()),
+		LinkAddr:     linkAddr,
+		Config:       val,
+		Notifier:     &uevent.NetDeviceNotifier{},
+	}
+	if err := l.linkVeth(ep.netns, v); err != nil {
+		return err
+	}
+	// Like Linux, the root end is removed with the network namespace, once
+	// all the containers and tasks sharing it are gone.
+	ep.netns.OnDestroy(v)
+	return nil
+}
+
+// linkVeth creates the interfaces of the veth pair v between netns and the
+// root network namespace.
+func (l *Loader) linkVeth(netns *inet.Namespace, v *netstack.Veth) error {
+	containerAddr, rootAddr, err := parseVeth(v.Config)
+	if err != nil {
+		return err
+	}
+	rootStack, ok := v.Root.Stack().(*netstack.Stack)
+	if !ok {
+		return fmt.Errorf("root network namespace doesn't use netstack")
+	}
+	nsStack, ok := netns.Stack().(*netstack.Stack)
+	if !ok {
+		return fmt.Errorf("container network namespace doesn't use netstack")
+	}
+	// After restore, the IDs may be used by the interfaces that the stacks
+	// were created with.
+	if _, ok := nsStack.Stack.NICInfo()[v.ID]; ok {
+		v.ID = tcpip.NICID(l.k.UniqueID())
+	}
+	if _, ok := rootStack.Stack.NICInfo()[v.RootID]; ok {
+		v.RootID = tcpip.NICID(l.k.UniqueID())
+	}
+
+	containerEP, rootEP := pipe.New(v.LinkAddr, v.RootLinkAddr, vethMTU)
+
+	n := &Network{Stack: nsStack.Stack}
+	log.Infof("Enabling veth interface %q with id %d on address %s", vethContainerName, v.ID, containerAddr)
+	if err := n.createNICWithAddrs(v.ID, packetsocket.New(ethernet.New(containerEP)), stack.NICOptions{Name: vethContainerName}, []IPWithPrefix{containerAddr}); err != nil {
+		return err
+	}
+	gateway := header.IPv4EmptySubnet
+	if containerAddr.Address.To4() == nil {
+		gateway = header.IPv6EmptySubnet
+	}
+	nsStack.Stack.SetRouteTable([]tcpip.Route{
+		{Destination: toAddressWithPrefix(containerAddr).Subnet(), NIC: v.ID},
+		{Destination: gateway, Gateway: ipToAddress(rootAddr.Address), NIC: v.ID},
+	})
+
+	n = &Network{Stack: rootStack.Stack}
+	log.Infof("Enabling veth interface %q with id %d on address %s", v.RootName, v.RootID, rootAddr)
+	if err := n.createNICWithAddrs(v.RootID, packetsocket.New(ethernet.New(rootEP)), stack.NICOptions{Name: v.RootName}, []IPWithPrefix{rootAddr}); err != nil {
+		return err
+	}
+	uevent.SendNetDevice(l.k.SupervisorContext(), "add", v.RootName, v.RootID)
+	// The route must precede the default route of the root namespace.
+	routes := []tcpip.Route{{Destination: toAddressWithPrefix(rootAddr).Subnet(), NIC: v.RootID}}
+	rootStack.Stack.SetRouteTable(append(routes, rootStack.Stack.GetRouteTable()...))
+	return nil
+}
+
+// restoreVeths recreates the veth pairs of the network namespaces used by
+// tasks after restore, as network stacks aren't saved.
+func (l *Loader) restoreVeths() {
+	seen := make(map[*inet.Namespace]struct{})
+	for _, t := range l.k.TaskSet().Root.Tasks() {
+		netns := t.NetworkNamespace()
+		if netns == nil || netns.IsRoot() {
+			continue
+		}
+		if _, ok := seen[netns]; ok {
+			continue
+		}
+		seen[netns] = struct{}{}
+		for _, h := range netns.DestroyHooks() {
+			v, ok := h.(*netstack.Veth)
+			if !ok {
+				continue
+			}
+			if err := l.linkVeth(netns, v); err != nil {
+				log.Warningf("Failed to recreate veth interface %q: %v", v.RootName, err)
+			}
+		}
+	}
+}
+
+// releaseNetworkNamespace releases the network namespace held by ep.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) releaseNetworkNamespace(ep *execProcess) {
+	if ep.netns != nil {
+		ep.netns.DecRef(l.k.SupervisorContext())
+		ep.netns = nil
+	}
+}
+
+// parseVeth parses the value of vethAnnotation.
+func parseVeth(val string) (IPWithPrefix, IPWithPrefix, error) {
+	parts := strings.Split(val, ",")
+	if len(parts) != 2 {
+		return IPWithPrefix{}, IPWithPrefix{}, fmt.Errorf("invalid %s %q, want <container address>/<prefix>,<root address>/<prefix>", vethAnnotation, val)
+	}
+	var addrs [2]IPWithPrefix
+	for i, part := range parts {
+		ip, subnet, err := net.ParseCIDR(strings.TrimSpace(part))
+		if err != nil {
+			return IPWithPrefix{}, IPWithPrefix{}, fmt.Errorf("invalid %s %q: %w", vethAnnotation, val, err)
+		}
+		prefix, _ := subnet.Mask.Size()
+		addrs[i] = IPWithPrefix{Address: ip, PrefixLen: prefix}
+	}
+	if (addrs[0].Address.To4() == nil) != (addrs[1].Address.To4() == nil) {
+		return IPWithPrefix{}, IPWithPrefix{}, fmt.Errorf("invalid %s %q: addresses must be of the same family", vethAnnotation, val)
+	}
+	return addrs[0], addrs[1], nil
+}
+
+// toAddressWithPrefix converts ip to a tcpip.AddressWithPrefix.
+func toAddressWithPrefix(ip IPWithPrefix) tcpip.AddressWithPrefix {
+	return tcpip.AddressWithPrefix{
+		Address:   ipToAddress(ip.Address),
+		PrefixLen: ip.PrefixLen,
+	}
+}
+
+// randomLinkAddress returns a random, locally administered, unicast MAC
+// address.
+func randomLinkAddress() (tcpip.LinkAddress, error) {
+	b := make([]byte, header.EthernetAddressSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating MAC address: %w", err)
+	}
+	b[0] = (b[0] &^ 0x1) | 0x2
+	return tcpip.LinkAddress(b), nil
+}
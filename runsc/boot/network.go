@@ -19,18 +19,23 @@ import (
 	"net"
 	"os"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/hostos"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/sinks/recorder"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/ethernet"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/fdbased"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/loopback"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/packetsocket"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/qdisc/fifo"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/sharedmem"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/sniffer"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/vfio"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/vhost"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/xdp"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv4"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv6"
@@ -75,6 +80,10 @@ type Network struct {
 type Route struct {
 	Destination net.IPNet
 	Gateway     net.IP
+
+	// Metric is the priority of the route among routes to the same
+	// destination, lower first, like the metric of host routes.
+	Metric int
 }
 
 // DefaultRoute represents a catch all route to the default gateway.
@@ -107,6 +116,15 @@ type FDBasedLink struct {
 	// NumChannels controls how many underlying FDs are to be used to
 	// create this endpoint.
 	NumChannels int
+
+	// VhostNet indicates that a /dev/vhost-net file follows the channel
+	// FDs, and that packets should be exchanged with the first channel
+	// through it.
+	VhostNet bool
+
+	// SaveRestore indicates that connected endpoints using this link are
+	// saved and restored, instead of preventing checkpoints.
+	SaveRestore bool
 }
 
 // XDPLink configures an XDP link.
@@ -126,8 +144,46 @@ type XDPLink struct {
 	// NumChannels controls how many underlying FDs are to be used to
 	// create this endpoint.
 	NumChannels int
+
+	// SaveRestore indicates that connected endpoints using this link are
+	// saved and restored, instead of preventing checkpoints.
+	SaveRestore bool
+}
+
+// VFIOLink configures a link driving a PCI device through VFIO.
+type VFIOLink struct {
+	Name             string
+	PCIAddress       string
+	MTU              int
+	Addresses        []IPWithPrefix
+	Routes           []Route
+	LinkAddress      net.HardwareAddr
+	QDisc            config.QueueingDiscipline
+	Neighbors        []Neighbor
+	GvisorGROTimeout time.Duration
+}
+
+// vfioLinkFDs is the number of files passed for each VFIOLink: the VFIO
+// container, the IOMMU group and the device.
+const vfioLinkFDs = 3
+
+// SharedMemLink configures a link backed by a shared memory channel offered by
+// a host agent.
+type SharedMemLink struct {
+	Name             string
+	MTU              int
+	BufferSize       uint32
+	Addresses        []IPWithPrefix
+	Routes           []Route
+	LinkAddress      net.HardwareAddr
+	QDisc            config.QueueingDiscipline
+	GvisorGROTimeout time.Duration
 }
 
+// sharedMemLinkFDs is the number of files passed for each SharedMemLink: the
+// files of the TX and RX queues, followed by the connection to the agent.
+const sharedMemLinkFDs = sharedmem.ChannelFDs + 1
+
 // LoopbackLink configures a loopback link.
 type LoopbackLink struct {
 	Name             string
@@ -140,12 +196,15 @@ type LoopbackLink struct {
 type CreateLinksAndRoutesArgs struct {
 	// FilePayload contains the fds associated with the FDBasedLinks. The
 	// number of fd's should match the sum of the NumChannels field of the
-	// FDBasedLink entries below.
+	// FDBasedLink entries below. The files of SharedMemLinks follow, and
+	// the files of VFIOLinks come last.
 	urpc.FilePayload
 
-	LoopbackLinks []LoopbackLink
-	FDBasedLinks  []FDBasedLink
-	XDPLinks      []XDPLink
+	LoopbackLinks  []LoopbackLink
+	FDBasedLinks   []FDBasedLink
+	XDPLinks       []XDPLink
+	SharedMemLinks []SharedMemLink
+	VFIOLinks      []VFIOLink
 
 	Defaultv4Gateway DefaultRoute
 	Defaultv6Gateway DefaultRoute
@@ -193,6 +252,9 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	wantFDs := 0
 	for _, l := range args.FDBasedLinks {
 		wantFDs += l.NumChannels
+		if l.VhostNet {
+			wantFDs++
+		}
 	}
 	if len(args.XDPLinks) > 0 {
 		wantFDs += 4
@@ -200,15 +262,17 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 	if args.PCAP {
 		wantFDs++
 	}
+	wantFDs += sharedMemLinkFDs * len(args.SharedMemLinks)
+	wantFDs += vfioLinkFDs * len(args.VFIOLinks)
 	if got := len(args.FilePayload.Files); got != wantFDs {
-		return fmt.Errorf("args.FilePayload.Files has %d FDs but we need %d entries based on FDBasedLinks, XDPLinks, and PCAP", got, wantFDs)
+		return fmt.Errorf("args.FilePayload.Files has %d FDs but we need %d entries based on FDBasedLinks, XDPLinks, SharedMemLinks, VFIOLinks and PCAP", got, wantFDs)
 	}
 
 	var nicID tcpip.NICID
 	nicids := make(map[string]tcpip.NICID)
 
 	// Collect routes from all links.
-	var routes []tcpip.Route
+	var routes []metricRoute
 
 	// Loopback normally appear before other interfaces.
 	for _, link := range args.LoopbackLinks {
@@ -232,7 +296,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			if err != nil {
 				return err
 			}
-			routes = append(routes, route)
+			routes = append(routes, metricRoute{Route: route, metric: r.Metric})
 		}
 	}
 
@@ -270,23 +334,35 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			mac := tcpip.LinkAddress(link.LinkAddress)
 			log.Infof("gso max size is: %d", link.GSOMaxSize)
 
-			linkEP, err := fdbased.New(&fdbased.Options{
-				FDs:                FDs,
-				MTU:                uint32(link.MTU),
-				EthernetHeader:     mac != "",
-				Address:            mac,
-				PacketDispatchMode: dispatchMode,
-				GSOMaxSize:         link.GSOMaxSize,
-				GvisorGSOEnabled:   link.GvisorGSOEnabled,
-				TXChecksumOffload:  link.TXChecksumOffload,
-				RXChecksumOffload:  link.RXChecksumOffload,
-			})
-			if err != nil {
-				return err
+			var linkEP stack.LinkEndpoint
+			if link.VhostNet {
+				vhostFD := int(args.FilePayload.Files[fdOffset].Fd())
+				fdOffset++
+				linkEP, err = createVhostLink(vhostFD, FDs[0], mac, uint32(link.MTU))
+				if err != nil {
+					log.Warningf("Failed to set up vhost-net for interface %q, falling back to fd-based link: %v", link.Name, err)
+				}
+			}
+			if linkEP == nil {
+				linkEP, err = fdbased.New(&fdbased.Options{
+					FDs:                FDs,
+					MTU:                uint32(link.MTU),
+					EthernetHeader:     mac != "",
+					Address:            mac,
+					PacketDispatchMode: dispatchMode,
+					GSOMaxSize:         link.GSOMaxSize,
+					GvisorGSOEnabled:   link.GvisorGSOEnabled,
+					TXChecksumOffload:  link.TXChecksumOffload,
+					RXChecksumOffload:  link.RXChecksumOffload,
+					SaveRestore:        link.SaveRestore,
+				})
+				if err != nil {
+					return err
+				}
 			}
 
 			// Wrap linkEP in a sniffer to enable packet logging.
-			sniffEP := sniffer.New(packetsocket.New(linkEP))
+			sniffEP := newSniffer(packetsocket.New(linkEP))
 
 			var qDisc stack.QueueingDiscipline
 			switch link.QDisc {
@@ -312,7 +388,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 				if err != nil {
 					return err
 				}
-				routes = append(routes, route)
+				routes = append(routes, metricRoute{Route: route, metric: r.Metric})
 			}
 
 			for _, neigh := range link.Neighbors {
@@ -356,6 +432,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			TXChecksumOffload: link.TXChecksumOffload,
 			RXChecksumOffload: link.RXChecksumOffload,
 			InterfaceIndex:    link.InterfaceIndex,
+			SaveRestore:       link.SaveRestore,
 		})
 		if err != nil {
 			return err
@@ -375,7 +452,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			}
 			fdOffset++
 		} else {
-			sniffEP = sniffer.New(packetsocket.New(linkEP))
+			sniffEP = newSniffer(packetsocket.New(linkEP))
 		}
 
 		var qDisc stack.QueueingDiscipline
@@ -402,7 +479,140 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 			if err != nil {
 				return err
 			}
-			routes = append(routes, route)
+			routes = append(routes, metricRoute{Route: route, metric: r.Metric})
+		}
+
+		for _, neigh := range link.Neighbors {
+			proto, tcpipAddr := ipToAddressAndProto(neigh.IP)
+			n.Stack.AddStaticNeighbor(nicID, proto, tcpipAddr, tcpip.LinkAddress(neigh.HardwareAddr))
+		}
+	}
+
+	vfioFDOffset := len(args.FilePayload.Files) - vfioLinkFDs*len(args.VFIOLinks)
+	sharedMemFDOffset := vfioFDOffset - sharedMemLinkFDs*len(args.SharedMemLinks)
+	for _, link := range args.SharedMemLinks {
+		nicID++
+		nicids[link.Name] = nicID
+
+		var fds [sharedMemLinkFDs]int
+		for i := range fds {
+			oldFD := args.FilePayload.Files[sharedMemFDOffset].Fd()
+			newFD, err := unix.Dup(int(oldFD))
+			if err != nil {
+				return fmt.Errorf("failed to dup shared memory FD %v: %v", oldFD, err)
+			}
+			fds[i] = newFD
+			sharedMemFDOffset++
+		}
+		tx, err := sharedmem.QueueConfigFromFDs(fds[:5])
+		if err != nil {
+			return err
+		}
+		rx, err := sharedmem.QueueConfigFromFDs(fds[5:10])
+		if err != nil {
+			return err
+		}
+
+		mac := tcpip.LinkAddress(link.LinkAddress)
+		name := link.Name
+		linkEP, err := sharedmem.New(sharedmem.Options{
+			MTU:         uint32(link.MTU),
+			BufferSize:  link.BufferSize,
+			LinkAddress: mac,
+			TX:          tx,
+			RX:          rx,
+			PeerFD:      fds[10],
+			OnClosed: func(tcpip.Error) {
+				log.Warningf("Host agent of shared memory interface %q went away", name)
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("creating shared memory link %q: %w", link.Name, err)
+		}
+
+		// Wrap linkEP in a sniffer to enable packet logging.
+		sniffEP := newSniffer(packetsocket.New(linkEP))
+
+		var qDisc stack.QueueingDiscipline
+		switch link.QDisc {
+		case config.QDiscNone:
+		case config.QDiscFIFO:
+			log.Infof("Enabling FIFO QDisc on %q", link.Name)
+			qDisc = fifo.New(sniffEP, runtime.GOMAXPROCS(0), 1000)
+		}
+
+		log.Infof("Enabling shared memory interface %q with id %d on addresses %+v (%v)", link.Name, nicID, link.Addresses, mac)
+		opts := stack.NICOptions{
+			Name:       link.Name,
+			QDisc:      qDisc,
+			GROTimeout: link.GvisorGROTimeout,
+		}
+		if err := n.createNICWithAddrs(nicID, sniffEP, opts, link.Addresses); err != nil {
+			return err
+		}
+		for _, r := range link.Routes {
+			route, err := r.toTcpipRoute(nicID)
+			if err != nil {
+				return err
+			}
+			routes = append(routes, metricRoute{Route: route, metric: r.Metric})
+		}
+	}
+
+	for _, link := range args.VFIOLinks {
+		nicID++
+		nicids[link.Name] = nicID
+
+		var fds [vfioLinkFDs]int
+		for i := range fds {
+			oldFD := args.FilePayload.Files[vfioFDOffset].Fd()
+			newFD, err := unix.Dup(int(oldFD))
+			if err != nil {
+				return fmt.Errorf("failed to dup VFIO FD %v: %v", oldFD, err)
+			}
+			fds[i] = newFD
+			vfioFDOffset++
+		}
+
+		mac := tcpip.LinkAddress(link.LinkAddress)
+		linkEP, err := vfio.New(&vfio.Options{
+			ContainerFD: fds[0],
+			DeviceFD:    fds[2],
+			Address:     mac,
+			MTU:         uint32(link.MTU),
+		})
+		if err != nil {
+			return fmt.Errorf("creating VFIO link for PCI device %s: %w", link.PCIAddress, err)
+		}
+
+		// Wrap linkEP in a sniffer to enable packet logging.
+		sniffEP := newSniffer(packetsocket.New(linkEP))
+
+		var qDisc stack.QueueingDiscipline
+		switch link.QDisc {
+		case config.QDiscNone:
+		case config.QDiscFIFO:
+			log.Infof("Enabling FIFO QDisc on %q", link.Name)
+			qDisc = fifo.New(sniffEP, runtime.GOMAXPROCS(0), 1000)
+		}
+
+		log.Infof("Enabling VFIO interface %q (PCI device %s) with id %d on addresses %+v (%v)", link.Name, link.PCIAddress, nicID, link.Addresses, linkEP.LinkAddress())
+		opts := stack.NICOptions{
+			Name:       link.Name,
+			QDisc:      qDisc,
+			GROTimeout: link.GvisorGROTimeout,
+		}
+		if err := n.createNICWithAddrs(nicID, sniffEP, opts, link.Addresses); err != nil {
+			return err
+		}
+
+		// Collect the routes from this link.
+		for _, r := range link.Routes {
+			route, err := r.toTcpipRoute(nicID)
+			if err != nil {
+				return err
+			}
+			routes = append(routes, metricRoute{Route: route, metric: r.Metric})
 		}
 
 		for _, neigh := range link.Neighbors {
@@ -420,7 +630,7 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		if err != nil {
 			return err
 		}
-		routes = append(routes, route)
+		routes = append(routes, metricRoute{Route: route, metric: args.Defaultv4Gateway.Route.Metric})
 	}
 
 	if !args.Defaultv6Gateway.Route.Empty() {
@@ -432,14 +642,79 @@ func (n *Network) CreateLinksAndRoutes(args *CreateLinksAndRoutesArgs, _ *struct
 		if err != nil {
 			return err
 		}
-		routes = append(routes, route)
+		routes = append(routes, metricRoute{Route: route, metric: args.Defaultv6Gateway.Route.Metric})
 	}
 
-	log.Infof("Setting routes %+v", routes)
-	n.Stack.SetRouteTable(routes)
+	table := sortRoutes(routes)
+	log.Infof("Setting routes %+v", table)
+	n.Stack.SetRouteTable(table)
 	return nil
 }
 
+// metricRoute is a route with its metric.
+type metricRoute struct {
+	tcpip.Route
+	metric int
+}
+
+// sortRoutes returns the route table made of routes. Netstack uses the first
+// route matching a destination, so with several interfaces the routes are
+// ordered like the host would pick them: longest prefix first, then lowest
+// metric. Routes that tie keep the order of their interfaces.
+func sortRoutes(routes []metricRoute) []tcpip.Route {
+	sort.SliceStable(routes, func(i, j int) bool {
+		pi, pj := routes[i].Destination.Prefix(), routes[j].Destination.Prefix()
+		if pi != pj {
+			return pi > pj
+		}
+		return routes[i].metric < routes[j].metric
+	})
+	table := make([]tcpip.Route, 0, len(routes))
+	for _, r := range routes {
+		table = append(table, r.Route)
+	}
+	return table
+}
+
+// newSniffer wraps ep in a sniffer that logs packets, or records them in the
+// flight recorder if there's one.
+func newSniffer(ep stack.LinkEndpoint) stack.LinkEndpoint {
+	w := recorder.NewPacketWriter()
+	if w == nil {
+		return sniffer.New(ep)
+	}
+	sniffEP, err := sniffer.NewWithWriter(ep, w, recorder.PacketSnapLen)
+	if err != nil {
+		log.Warningf("Failed to record packets in the flight recorder: %v", err)
+		return sniffer.New(ep)
+	}
+	return sniffEP
+}
+
+// createVhostLink creates a link endpoint that exchanges packets with the
+// AF_PACKET socket sockFD through the vhost-net device vhostFD.
+func createVhostLink(vhostFD, sockFD int, mac tcpip.LinkAddress, mtu uint32) (stack.LinkEndpoint, error) {
+	if mac == "" {
+		return nil, fmt.Errorf("vhost-net requires an Ethernet device")
+	}
+	fd, err := unix.Dup(vhostFD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dup vhost-net FD %v: %v", vhostFD, err)
+	}
+	linkEP, err := vhost.New(&vhost.Options{
+		VhostFD:   fd,
+		BackendFD: sockFD,
+		Address:   mac,
+		MTU:       mtu,
+	})
+	if err != nil {
+		// The device can't be reused once it has an owner.
+		unix.Close(fd)
+		return nil, err
+	}
+	return linkEP, nil
+}
+
 // createNICWithAddrs creates a NIC in the network stack and adds the given
 // addresses.
 func (n *Network) createNICWithAddrs(id tcpip.NICID, ep stack.LinkEndpoint, opts stack.NICOptions, addrs []IPWithPrefix) error {
@@ -0,0 +1,271 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/tcp"
+)
+
+// NetworkState is the state of a network stack returned by Network.Dump.
+type NetworkState struct {
+	NICs      []NICDump      `json:"nics"`
+	Routes    []RouteDump    `json:"routes"`
+	Neighbors []NeighborDump `json:"neighbors"`
+	Endpoints []EndpointDump `json:"endpoints"`
+}
+
+// NICDump describes a NIC.
+type NICDump struct {
+	ID          int32             `json:"id"`
+	Name        string            `json:"name"`
+	LinkAddress string            `json:"link_address,omitempty"`
+	MTU         uint32            `json:"mtu"`
+	Up          bool              `json:"up"`
+	Running     bool              `json:"running"`
+	Promiscuous bool              `json:"promiscuous,omitempty"`
+	Loopback    bool              `json:"loopback,omitempty"`
+	Addresses   []string          `json:"addresses,omitempty"`
+	Stats       map[string]uint64 `json:"stats,omitempty"`
+}
+
+// RouteDump describes a routing table entry.
+type RouteDump struct {
+	Destination string `json:"destination"`
+	Gateway     string `json:"gateway,omitempty"`
+	NIC         string `json:"nic"`
+}
+
+// NeighborDump describes an entry of the ARP or NDP cache of a NIC.
+type NeighborDump struct {
+	NIC         string `json:"nic"`
+	Protocol    string `json:"protocol"`
+	Address     string `json:"address"`
+	LinkAddress string `json:"link_address,omitempty"`
+	State       string `json:"state"`
+}
+
+// EndpointDump describes a transport endpoint registered with the stack.
+type EndpointDump struct {
+	Network       string            `json:"network"`
+	Transport     string            `json:"transport"`
+	LocalAddress  string            `json:"local_address"`
+	LocalPort     uint16            `json:"local_port"`
+	RemoteAddress string            `json:"remote_address,omitempty"`
+	RemotePort    uint16            `json:"remote_port,omitempty"`
+	BindNIC       string            `json:"bind_nic,omitempty"`
+	State         string            `json:"state"`
+	RecvQueue     int               `json:"recv_queue"`
+	SendQueue     int               `json:"send_queue"`
+	Stats         map[string]uint64 `json:"stats,omitempty"`
+}
+
+// Dump returns the NICs, routing table, neighbor caches and transport
+// endpoints of the network stack.
+func (n *Network) Dump(_ *struct{}, out *NetworkState) error {
+	nics := n.Stack.NICInfo()
+	ids := make([]tcpip.NICID, 0, len(nics))
+	for id := range nics {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	nicName := func(id tcpip.NICID) string {
+		if info, ok := nics[id]; ok {
+			return info.Name
+		}
+		return fmt.Sprintf("%d", id)
+	}
+
+	var dump NetworkState
+	for _, id := range ids {
+		info := nics[id]
+		nic := NICDump{
+			ID:          int32(id),
+			Name:        info.Name,
+			MTU:         info.MTU,
+			Up:          info.Flags.Up,
+			Running:     info.Flags.Running,
+			Promiscuous: info.Flags.Promiscuous,
+			Loopback:    info.Flags.Loopback,
+			Stats:       make(map[string]uint64),
+		}
+		if len(info.LinkAddress) != 0 {
+			nic.LinkAddress = info.LinkAddress.String()
+		}
+		for _, addr := range info.ProtocolAddresses {
+			nic.Addresses = append(nic.Addresses, addr.AddressWithPrefix.String())
+		}
+		statCounters(reflect.ValueOf(&info.Stats).Elem(), "", nic.Stats)
+		dump.NICs = append(dump.NICs, nic)
+
+		for _, proto := range []struct {
+			name   string
+			number tcpip.NetworkProtocolNumber
+		}{
+			{"arp", header.IPv4ProtocolNumber},
+			{"ndp", header.IPv6ProtocolNumber},
+		} {
+			// Errors are expected for NICs that don't resolve link
+			// addresses, e.g. loopback.
+			entries, err := n.Stack.Neighbors(id, proto.number)
+			if err != nil {
+				continue
+			}
+			for _, e := range entries {
+				neigh := NeighborDump{
+					NIC:      info.Name,
+					Protocol: proto.name,
+					Address:  e.Addr.String(),
+					State:    e.State.String(),
+				}
+				if len(e.LinkAddr) != 0 {
+					neigh.LinkAddress = e.LinkAddr.String()
+				}
+				dump.Neighbors = append(dump.Neighbors, neigh)
+			}
+		}
+	}
+
+	for _, r := range n.Stack.GetRouteTable() {
+		route := RouteDump{
+			Destination: r.Destination.String(),
+			NIC:         nicName(r.NIC),
+		}
+		if r.Gateway.Len() != 0 {
+			route.Gateway = r.Gateway.String()
+		}
+		dump.Routes = append(dump.Routes, route)
+	}
+
+	// Dual-stack endpoints are registered once per network protocol.
+	seen := make(map[stack.TransportEndpoint]struct{})
+	for _, tep := range n.Stack.RegisteredEndpoints() {
+		if _, ok := seen[tep]; ok {
+			continue
+		}
+		seen[tep] = struct{}{}
+		ep, ok := tep.(tcpip.Endpoint)
+		if !ok {
+			continue
+		}
+		info, ok := ep.Info().(*stack.TransportEndpointInfo)
+		if !ok {
+			continue
+		}
+		e := EndpointDump{
+			Network:      networkProtocolName(info.NetProto),
+			Transport:    transportProtocolName(info.TransProto),
+			LocalAddress: info.ID.LocalAddress.String(),
+			LocalPort:    info.ID.LocalPort,
+			RemotePort:   info.ID.RemotePort,
+			Stats:        make(map[string]uint64),
+		}
+		if info.ID.RemoteAddress.Len() != 0 {
+			e.RemoteAddress = info.ID.RemoteAddress.String()
+		}
+		if info.BindNICID != 0 {
+			e.BindNIC = nicName(info.BindNICID)
+		}
+		if info.TransProto == header.TCPProtocolNumber {
+			e.State = tcp.EndpointState(ep.State()).String()
+		} else {
+			e.State = transport.DatagramEndpointState(ep.State()).String()
+		}
+		if v, err := ep.GetSockOptInt(tcpip.ReceiveQueueSizeOption); err == nil {
+			e.RecvQueue = v
+		}
+		if v, err := ep.GetSockOptInt(tcpip.SendQueueSizeOption); err == nil {
+			e.SendQueue = v
+		}
+		if stats := reflect.ValueOf(ep.Stats()); stats.Kind() == reflect.Pointer && !stats.IsNil() {
+			statCounters(stats.Elem(), "", e.Stats)
+		}
+		dump.Endpoints = append(dump.Endpoints, e)
+	}
+	sort.Slice(dump.Endpoints, func(i, j int) bool {
+		a, b := &dump.Endpoints[i], &dump.Endpoints[j]
+		if a.Transport != b.Transport {
+			return a.Transport < b.Transport
+		}
+		return a.LocalPort < b.LocalPort
+	})
+
+	*out = dump
+	return nil
+}
+
+// statCounters adds the values of all StatCounters in the struct v to out,
+// keyed by their dotted field path.
+func statCounters(v reflect.Value, prefix string, out map[string]uint64) {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		name := prefix + t.Field(i).Name
+		f := v.Field(i)
+		switch c := f.Addr().Interface().(type) {
+		case *tcpip.StatCounter:
+			out[name] = c.Value()
+		case **tcpip.StatCounter:
+			if *c != nil {
+				out[name] = (*c).Value()
+			}
+		default:
+			if f.Kind() != reflect.Struct {
+				break
+			}
+			if t.Field(i).Anonymous {
+				// Fields of embedded structs are promoted.
+				statCounters(f, prefix, out)
+			} else {
+				statCounters(f, name+".", out)
+			}
+		}
+	}
+}
+
+func networkProtocolName(p tcpip.NetworkProtocolNumber) string {
+	switch p {
+	case header.IPv4ProtocolNumber:
+		return "ipv4"
+	case header.IPv6ProtocolNumber:
+		return "ipv6"
+	default:
+		return fmt.Sprintf("%#x", uint32(p))
+	}
+}
+
+func transportProtocolName(p tcpip.TransportProtocolNumber) string {
+	switch p {
+	case header.TCPProtocolNumber:
+		return "tcp"
+	case header.UDPProtocolNumber:
+		return "udp"
+	case header.ICMPv4ProtocolNumber:
+		return "icmp"
+	case header.ICMPv6ProtocolNumber:
+		return "icmpv6"
+	default:
+		return fmt.Sprintf("%d", uint32(p))
+	}
+}
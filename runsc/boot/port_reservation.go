@@ -0,0 +1,166 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"github.com/talismancer/gvisor-ligolo/pkg/syserr"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/tcp"
+	"golang.org/x/sys/unix"
+)
+
+// Sandboxes joining the same host network namespace each run their own
+// netstack, with the same addresses, so nothing prevents two of them from
+// binding the same port and racing for its packets. With --port-reservation-dir,
+// a sandbox reserves each port bound by its applications by holding an
+// exclusive flock(2) on a lock file named after the port, in a directory
+// shared by the sandboxes of the network namespace. A bind to a port reserved
+// by another sandbox fails with EADDRINUSE. The host kernel drops the locks of
+// a sandbox when it exits.
+//
+// Ports are reserved regardless of the address they are bound to, and
+// ephemeral ports aren't reserved: sandboxes sharing a network namespace
+// should use distinct ephemeral port ranges.
+
+// portReserver implements netstack.PortReserver with lock files in a directory
+// donated by the host.
+type portReserver struct {
+	// dirFD is the directory holding the lock files.
+	dirFD int
+
+	// sandboxID is written to the lock files of the reserved ports, to
+	// report which sandbox holds them.
+	sandboxID string
+
+	// mu protects reservations.
+	mu sync.Mutex
+
+	// reservations maps the ports reserved by the sandbox to their
+	// reservation. Sockets of the sandbox may share a port, e.g. with
+	// SO_REUSEPORT, so reservations are reference counted.
+	//
+	// +checklocks:mu
+	reservations map[portKey]*portReservation
+}
+
+var _ netstack.PortReserver = (*portReserver)(nil)
+
+// portKey identifies a port.
+type portKey struct {
+	proto tcpip.TransportProtocolNumber
+	port  uint16
+}
+
+// String returns the name of the lock file of k, e.g. "tcp-80".
+func (k portKey) String() string {
+	if k.proto == tcp.ProtocolNumber {
+		return fmt.Sprintf("tcp-%d", k.port)
+	}
+	return fmt.Sprintf("udp-%d", k.port)
+}
+
+// portReservation is a port reserved by the sandbox.
+type portReservation struct {
+	// fd is the locked lock file.
+	fd int
+
+	// refs is the number of sockets bound to the port.
+	refs int
+}
+
+func newPortReserver(dirFD int, sandboxID string) *portReserver {
+	return &portReserver{
+		dirFD:        dirFD,
+		sandboxID:    sandboxID,
+		reservations: make(map[portKey]*portReservation),
+	}
+}
+
+// ReservePort implements netstack.PortReserver.ReservePort.
+func (r *portReserver) ReservePort(proto tcpip.TransportProtocolNumber, port uint16) *syserr.Error {
+	k := portKey{proto: proto, port: port}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if res, ok := r.reservations[k]; ok {
+		res.refs++
+		return nil
+	}
+
+	fd, err := unix.Openat(r.dirFD, k.String(), unix.O_RDWR|unix.O_CREAT|unix.O_CLOEXEC|unix.O_NOFOLLOW, 0644)
+	if err != nil {
+		// Don't prevent the application from binding if the reservation
+		// can't be checked.
+		log.Warningf("Port reservation: opening lock file %q: %v", k, err)
+		return nil
+	}
+	if err := unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		if err == unix.EWOULDBLOCK {
+			log.Warningf("Port reservation: %s is reserved by sandbox %q sharing the network namespace", k, readPortHolder(fd))
+			unix.Close(fd)
+			return syserr.ErrAddressInUse
+		}
+		log.Warningf("Port reservation: locking %q: %v", k, err)
+		unix.Close(fd)
+		return nil
+	}
+	if err := unix.Ftruncate(fd, 0); err == nil {
+		unix.Pwrite(fd, []byte(r.sandboxID), 0)
+	}
+	r.reservations[k] = &portReservation{fd: fd, refs: 1}
+	log.Debugf("Port reservation: reserved %s", k)
+	return nil
+}
+
+// ReleasePort implements netstack.PortReserver.ReleasePort.
+func (r *portReserver) ReleasePort(proto tcpip.TransportProtocolNumber, port uint16) {
+	k := portKey{proto: proto, port: port}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res, ok := r.reservations[k]
+	if !ok {
+		return
+	}
+	if res.refs--; res.refs > 0 {
+		return
+	}
+	// Closing the lock file releases the lock. The file is left in place, as
+	// removing it could race with another sandbox locking it.
+	unix.Close(res.fd)
+	delete(r.reservations, k)
+	log.Debugf("Port reservation: released %s", k)
+}
+
+// readPortHolder returns the ID of the sandbox holding the lock file fd.
+func readPortHolder(fd int) string {
+	buf := make([]byte, 256)
+	n, err := unix.Pread(fd, buf, 0)
+	if err != nil || n <= 0 {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(buf[:n]))
+}
+
+// portReservation returns true if the sandbox reserves the ports bound by its
+// applications.
+func (l *Loader) portReservation() bool {
+	eps, ok := l.k.RootNetworkNamespace().Stack().(*netstack.Stack)
+	return ok && eps.PortReserver != nil
+}
@@ -100,6 +100,20 @@ func NewHostInetConn(port uint16) (proxyConn, error) {
 	return &s, nil
 }
 
+// NewHostInetConnFromFD creates a hostInetConn backed by fd, a connected
+// non-blocking host socket, e.g. a connection accepted on a host listener. It
+// takes ownership of fd.
+func NewHostInetConnFromFD(fd int) (proxyConn, error) {
+	s := hostInetConn{
+		fd: fileDescriptor.New(fd),
+	}
+	if err := fdnotifier.AddFD(int32(s.fd.FD()), &s.wq); err != nil {
+		s.fd.Close()
+		return nil, err
+	}
+	return &s, nil
+}
+
 func (s *hostInetConn) Name() string {
 	return fmt.Sprintf("localhost:port:%d", s.port)
 }
@@ -22,7 +22,9 @@ import (
 
 	"github.com/talismancer/gvisor-ligolo/pkg/context"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/header"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv4"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv6"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
 	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/tcp"
 	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
@@ -33,8 +35,8 @@ import (
 type netstackConn struct {
 	// ep is the tcpip.Endpoint on which to read and write.
 	ep tcpip.Endpoint
-	// port is the port on which to connect.
-	port uint16
+	// addr is the remote address of the connection.
+	addr tcpip.FullAddress
 	// wq is the WaitQueue for this connection to wait on notifications.
 	wq *waiter.Queue
 	// once makes sure Close is called once.
@@ -44,37 +46,52 @@ type netstackConn struct {
 // NewNetstackConn creates a new port forwarding connection to the given
 // port in netstack mode.
 func NewNetstackConn(stack *stack.Stack, port uint16) (proxyConn, error) {
+	return DialNetstack(stack, tcpip.FullAddress{
+		Addr: tcpip.AddrFrom4([4]byte{0x7f, 0x00, 0x00, 0x01}), // 127.0.0.1
+		Port: port,
+	})
+}
+
+// DialNetstack creates a new TCP connection to addr through netstack, as if it
+// was made by the sandboxed application.
+func DialNetstack(stack *stack.Stack, addr tcpip.FullAddress) (proxyConn, error) {
 	var wq waiter.Queue
-	ep, tcpErr := stack.NewEndpoint(tcp.ProtocolNumber, ipv4.ProtocolNumber, &wq)
+	ep, tcpErr := stack.NewEndpoint(tcp.ProtocolNumber, networkProtocol(addr.Addr), &wq)
 	if tcpErr != nil {
 		return nil, fmt.Errorf("creating endpoint: %v", tcpErr)
 	}
 	n := &netstackConn{
 		ep:   ep,
-		port: port,
+		addr: addr,
 		wq:   &wq,
 	}
 	waitEntry, notifyCh := waiter.NewChannelEntry(waiter.WritableEvents)
 	n.wq.EventRegister(&waitEntry)
 	defer n.wq.EventUnregister(&waitEntry)
 
-	tcpErr = n.ep.Connect(tcpip.FullAddress{
-		Addr: tcpip.AddrFrom4([4]byte{0x7f, 0x00, 0x00, 0x01}), // 127.0.0.1
-		Port: n.port,
-	})
+	tcpErr = n.ep.Connect(addr)
 	if _, ok := tcpErr.(*tcpip.ErrConnectStarted); ok {
 		<-notifyCh
 		tcpErr = n.ep.LastError()
 	}
 	if tcpErr != nil {
+		n.ep.Close()
 		return nil, fmt.Errorf("connecting endpoint: %v", tcpErr)
 	}
 	return n, nil
 }
 
+// networkProtocol returns the network protocol of addr.
+func networkProtocol(addr tcpip.Address) tcpip.NetworkProtocolNumber {
+	if addr.Len() == header.IPv6AddressSize {
+		return ipv6.ProtocolNumber
+	}
+	return ipv4.ProtocolNumber
+}
+
 // Name implements proxyConn.Name.
 func (n *netstackConn) Name() string {
-	return fmt.Sprintf("netstack:port:%d", n.port)
+	return fmt.Sprintf("netstack:%s:%d", n.addr.Addr, n.addr.Port)
 }
 
 // bufWriter is used as an io.Writer to read from tcpip.Endpoint.
@@ -0,0 +1,101 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portforward
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/transport/tcp"
+	"github.com/talismancer/gvisor-ligolo/pkg/waiter"
+)
+
+// NetstackListener accepts TCP connections made to the sandbox, as if it was a
+// listening socket of the sandboxed application.
+type NetstackListener struct {
+	// ep is the listening endpoint.
+	ep tcpip.Endpoint
+	// wq is the WaitQueue of ep.
+	wq *waiter.Queue
+	// closed is closed by Close to interrupt Accept.
+	closed chan struct{}
+	// once makes sure Close is called once.
+	once sync.Once
+}
+
+// ListenNetstack creates a listener bound to addr in netstack. If addr.Port is
+// zero, a port is allocated.
+func ListenNetstack(stack *stack.Stack, addr tcpip.FullAddress) (*NetstackListener, error) {
+	var wq waiter.Queue
+	ep, tcpErr := stack.NewEndpoint(tcp.ProtocolNumber, networkProtocol(addr.Addr), &wq)
+	if tcpErr != nil {
+		return nil, fmt.Errorf("creating endpoint: %v", tcpErr)
+	}
+	if tcpErr := ep.Bind(addr); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("binding to %s:%d: %v", addr.Addr, addr.Port, tcpErr)
+	}
+	if tcpErr := ep.Listen(10); tcpErr != nil {
+		ep.Close()
+		return nil, fmt.Errorf("listening: %v", tcpErr)
+	}
+	return &NetstackListener{
+		ep:     ep,
+		wq:     &wq,
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Addr returns the address the listener is bound to.
+func (l *NetstackListener) Addr() (tcpip.FullAddress, error) {
+	addr, tcpErr := l.ep.GetLocalAddress()
+	if tcpErr != nil {
+		return tcpip.FullAddress{}, fmt.Errorf("getting local address: %v", tcpErr)
+	}
+	return addr, nil
+}
+
+// Accept waits for a connection and returns it along with the address of the
+// peer. It fails once the listener is closed.
+func (l *NetstackListener) Accept() (proxyConn, tcpip.FullAddress, error) {
+	waitEntry, notifyCh := waiter.NewChannelEntry(waiter.ReadableEvents)
+	l.wq.EventRegister(&waitEntry)
+	defer l.wq.EventUnregister(&waitEntry)
+	for {
+		var peer tcpip.FullAddress
+		ep, wq, tcpErr := l.ep.Accept(&peer)
+		if tcpErr == nil {
+			return &netstackConn{ep: ep, addr: peer, wq: wq}, peer, nil
+		}
+		if _, ok := tcpErr.(*tcpip.ErrWouldBlock); !ok {
+			return nil, tcpip.FullAddress{}, fmt.Errorf("accepting connection: %v", tcpErr)
+		}
+		select {
+		case <-notifyCh:
+		case <-l.closed:
+			return nil, tcpip.FullAddress{}, fmt.Errorf("listener closed")
+		}
+	}
+}
+
+// Close closes the listener. Connections already accepted aren't affected.
+func (l *NetstackListener) Close() {
+	l.once.Do(func() {
+		close(l.closed)
+		l.ep.Close()
+	})
+}
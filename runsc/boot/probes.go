@@ -0,0 +1,410 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	gocontext "context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/eventchannel"
+	pb "github.com/talismancer/gvisor-ligolo/pkg/eventchannel/eventchannel_go_proto"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/metric"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/control"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/adapters/gonet"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv4"
+	"github.com/talismancer/gvisor-ligolo/runsc/boot/portforward"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+)
+
+const (
+	defaultProbePeriodSeconds    = 10
+	defaultProbeTimeoutSeconds   = 1
+	defaultProbeFailureThreshold = 3
+	defaultProbeSuccessThreshold = 1
+)
+
+var (
+	probesSucceeded = metric.MustCreateNewUint64Metric("/probes/succeeded", false /* sync */, "Number of health-check probes that succeeded.")
+	probesFailed    = metric.MustCreateNewUint64Metric("/probes/failed", false /* sync */, "Number of health-check probes that failed.")
+)
+
+// ProbeConfig configures a health-check probe that the sentry runs
+// periodically against a container, similar to a Kubernetes liveness probe.
+// Exactly one of Exec and TCPPort must be set.
+//
+// Running probes in the sentry avoids the cost of going through the runtime,
+// the shim and the control server for every probe.
+type ProbeConfig struct {
+	// Name identifies the probe in events.
+	Name string `json:"name"`
+
+	// Container is the container to probe. It matches either the Kubernetes
+	// container name annotation or the container ID.
+	Container string `json:"container"`
+
+	// Exec is a command to run in the container. The probe succeeds if the
+	// command exits with status 0.
+	Exec []string `json:"exec,omitempty"`
+
+	// TCPPort is a port to connect to on the loopback interface of the
+	// container's network namespace. The probe succeeds if the connection is
+	// established.
+	TCPPort uint16 `json:"tcp_port,omitempty"`
+
+	// InitialDelaySeconds is the time to wait after the container starts
+	// before running the first probe.
+	InitialDelaySeconds int32 `json:"initial_delay_seconds,omitempty"`
+
+	// PeriodSeconds is the time between probes. Defaults to 10.
+	PeriodSeconds int32 `json:"period_seconds,omitempty"`
+
+	// TimeoutSeconds is the time after which a probe fails. Defaults to 1.
+	TimeoutSeconds int32 `json:"timeout_seconds,omitempty"`
+
+	// FailureThreshold is the number of consecutive failures after which the
+	// container is reported unhealthy. Defaults to 3.
+	FailureThreshold int32 `json:"failure_threshold,omitempty"`
+
+	// SuccessThreshold is the number of consecutive successes after which an
+	// unhealthy container is reported healthy again. Defaults to 1.
+	SuccessThreshold int32 `json:"success_threshold,omitempty"`
+}
+
+// validate checks the probe configuration and sets default values.
+func (p *ProbeConfig) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("probe name is required")
+	}
+	if p.Container == "" {
+		return fmt.Errorf("probe %q: container is required", p.Name)
+	}
+	if (len(p.Exec) == 0) == (p.TCPPort == 0) {
+		return fmt.Errorf("probe %q: exactly one of exec and tcp_port must be set", p.Name)
+	}
+	for _, v := range []int32{p.InitialDelaySeconds, p.PeriodSeconds, p.TimeoutSeconds, p.FailureThreshold, p.SuccessThreshold} {
+		if v < 0 {
+			return fmt.Errorf("probe %q: durations and thresholds must not be negative", p.Name)
+		}
+	}
+	if p.PeriodSeconds == 0 {
+		p.PeriodSeconds = defaultProbePeriodSeconds
+	}
+	if p.TimeoutSeconds == 0 {
+		p.TimeoutSeconds = defaultProbeTimeoutSeconds
+	}
+	if p.FailureThreshold == 0 {
+		p.FailureThreshold = defaultProbeFailureThreshold
+	}
+	if p.SuccessThreshold == 0 {
+		p.SuccessThreshold = defaultProbeSuccessThreshold
+	}
+	return nil
+}
+
+// matches returns true if the probe applies to the given container.
+func (p *ProbeConfig) matches(cid string, spec *specs.Spec) bool {
+	return p.Container == cid || p.Container == specutils.ContainerName(spec)
+}
+
+// probeEvent is emitted as JSON in a DebugEvent when a probe fails or the
+// health of a container changes.
+type probeEvent struct {
+	Name      string `json:"name"`
+	Container string `json:"container"`
+	Healthy   bool   `json:"healthy"`
+	Failures  int32  `json:"consecutive_failures,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// prober runs a single probe against a container until stopped.
+type prober struct {
+	l    *Loader
+	conf ProbeConfig
+	cid  string
+	spec *specs.Spec
+	caps *auth.TaskCapabilities
+
+	stop chan struct{}
+
+	// The fields below are only accessed by the prober goroutine.
+	healthy   bool
+	successes int32
+	failures  int32
+}
+
+// startProbesLocked starts the probes that apply to a container that just
+// started.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) startProbesLocked(cid string, spec *specs.Spec) {
+	for _, conf := range l.probes {
+		if !conf.matches(cid, spec) {
+			continue
+		}
+		caps, err := specutils.Capabilities(l.root.conf.EnableRaw, spec.Process.Capabilities)
+		if err != nil {
+			log.Warningf("Not starting probe %q for container %q: creating capabilities: %v", conf.Name, cid, err)
+			continue
+		}
+		p := &prober{
+			l:       l,
+			conf:    conf,
+			cid:     cid,
+			spec:    spec,
+			caps:    caps,
+			stop:    make(chan struct{}),
+			healthy: true,
+		}
+		if l.probers == nil {
+			l.probers = make(map[string][]*prober)
+		}
+		l.probers[cid] = append(l.probers[cid], p)
+		log.Infof("Starting probe %q for container %q every %ds", conf.Name, cid, conf.PeriodSeconds)
+		go p.run() // S/R-SAFE: not saved.
+	}
+}
+
+// stopProbesLocked stops the probes of a container. It doesn't wait for
+// in-flight probes, which may need l.mu to complete; their results are
+// discarded.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) stopProbesLocked(cid string) {
+	for _, p := range l.probers[cid] {
+		close(p.stop)
+	}
+	delete(l.probers, cid)
+}
+
+// stopProbes stops the probes of all containers.
+func (l *Loader) stopProbes() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for cid := range l.probers {
+		l.stopProbesLocked(cid)
+	}
+}
+
+func (p *prober) run() {
+	delay := time.NewTimer(time.Duration(p.conf.InitialDelaySeconds) * time.Second)
+	select {
+	case <-p.stop:
+		delay.Stop()
+		return
+	case <-delay.C:
+	}
+
+	ticker := time.NewTicker(time.Duration(p.conf.PeriodSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		p.probe()
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe runs the probe once and reports the result.
+func (p *prober) probe() {
+	timeout := time.Duration(p.conf.TimeoutSeconds) * time.Second
+	var err error
+	if len(p.conf.Exec) > 0 {
+		err = p.probeExec(timeout)
+	} else {
+		err = p.probeTCP(timeout)
+	}
+	select {
+	case <-p.stop:
+		// The container is gone, don't report failures caused by its
+		// destruction.
+		return
+	default:
+	}
+
+	wasHealthy := p.healthy
+	if err != nil {
+		probesFailed.Increment()
+		p.successes = 0
+		p.failures++
+		if p.failures >= p.conf.FailureThreshold {
+			p.healthy = false
+		}
+		log.Debugf("Probe %q for container %q failed (%d consecutive failures): %v", p.conf.Name, p.cid, p.failures, err)
+	} else {
+		probesSucceeded.Increment()
+		p.failures = 0
+		p.successes++
+		if p.successes >= p.conf.SuccessThreshold {
+			p.healthy = true
+		}
+	}
+	if err == nil && p.healthy == wasHealthy {
+		return
+	}
+	if p.healthy != wasHealthy {
+		log.Infof("Container %q is now %s according to probe %q", p.cid, healthString(p.healthy), p.conf.Name)
+	}
+
+	ev := probeEvent{
+		Name:      p.conf.Name,
+		Container: p.cid,
+		Healthy:   p.healthy,
+		Failures:  p.failures,
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	text, err := json.Marshal(&ev)
+	if err != nil {
+		log.Warningf("Failed to marshal probe event: %v", err)
+		return
+	}
+	eventchannel.Emit(&pb.DebugEvent{Name: "health_probe", Text: string(text)})
+}
+
+func healthString(healthy bool) string {
+	if healthy {
+		return "healthy"
+	}
+	return "unhealthy"
+}
+
+// probeExec runs the probe command in the container, and kills it if it
+// doesn't exit before the timeout.
+func (p *prober) probeExec(timeout time.Duration) error {
+	args := &control.ExecArgs{
+		Argv:             p.conf.Exec,
+		Envv:             p.spec.Process.Env,
+		WorkingDirectory: p.spec.Process.Cwd,
+		KUID:             auth.KUID(p.spec.Process.User.UID),
+		KGID:             auth.KGID(p.spec.Process.User.GID),
+		Capabilities:     p.caps,
+		ContainerID:      p.cid,
+	}
+	for _, gid := range p.spec.Process.User.AdditionalGids {
+		args.ExtraKGIDs = append(args.ExtraKGIDs, auth.KGID(gid))
+	}
+	if devNull := p.l.probeDevNull; devNull != nil {
+		args.FilePayload = control.NewFilePayload(map[int]*os.File{0: devNull, 1: devNull, 2: devNull}, nil)
+	}
+	tgid, err := p.l.executeAsync(args)
+	if err != nil {
+		return err
+	}
+
+	status := make(chan uint32, 1)
+	go func() {
+		var ws uint32
+		if err := p.l.waitPID(tgid, p.cid, &ws); err != nil {
+			log.Warningf("Failed to wait for probe %q in container %q: %v", p.conf.Name, p.cid, err)
+			ws = uint32(linux.WaitStatusTerminationSignal(linux.SIGKILL))
+		}
+		status <- ws
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ws := <-status:
+		if ws := linux.WaitStatus(ws); !ws.Exited() || ws.ExitStatus() != 0 {
+			return fmt.Errorf("command %q failed with %v", p.conf.Exec, ws)
+		}
+		return nil
+	case <-timer.C:
+		err = fmt.Errorf("command %q timed out after %v", p.conf.Exec, timeout)
+	case <-p.stop:
+		err = fmt.Errorf("probe stopped")
+	}
+	// The waiter goroutine reaps the process once it's killed.
+	if err := p.l.signalProcess(p.cid, tgid, int32(linux.SIGKILL)); err != nil {
+		log.Warningf("Failed to kill probe %q in container %q: %v", p.conf.Name, p.cid, err)
+	}
+	return err
+}
+
+// probeTCP connects to the probe port on the loopback interface of the
+// container's network namespace.
+func (p *prober) probeTCP(timeout time.Duration) error {
+	if p.l.root.conf.Network == config.NetworkHost {
+		return p.probeHostTCP(timeout)
+	}
+
+	p.l.mu.Lock()
+	ns := p.l.k.RootNetworkNamespace()
+	if ep := p.l.processes[execID{cid: p.cid}]; ep != nil && ep.netns != nil {
+		ns = ep.netns
+	}
+	s, ok := ns.Stack().(*netstack.Stack)
+	p.l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("TCP probes are not supported with network %q", p.l.root.conf.Network)
+	}
+
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), timeout)
+	defer cancel()
+	conn, err := gonet.DialContextTCP(ctx, s.Stack, tcpip.FullAddress{
+		Addr: tcpip.AddrFrom4([4]byte{0x7f, 0x00, 0x00, 0x01}), // 127.0.0.1
+		Port: p.conf.TCPPort,
+	}, ipv4.ProtocolNumber)
+	if err != nil {
+		return fmt.Errorf("connecting to port %d: %w", p.conf.TCPPort, err)
+	}
+	return conn.Close()
+}
+
+// probeHostTCP connects to the probe port on the host loopback interface.
+// Containers share the host network namespace of the sandbox in this mode.
+func (p *prober) probeHostTCP(timeout time.Duration) error {
+	type result struct {
+		conn interface{ Close(context.Context) }
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn, err := portforward.NewHostInetConn(p.conf.TCPPort)
+		done <- result{conn, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return fmt.Errorf("connecting to port %d: %w", p.conf.TCPPort, res.err)
+		}
+		res.conn.Close(p.l.k.SupervisorContext())
+		return nil
+	case <-timer.C:
+		go func() {
+			if res := <-done; res.err == nil {
+				res.conn.Close(p.l.k.SupervisorContext())
+			}
+		}()
+		return fmt.Errorf("connecting to port %d timed out after %v", p.conf.TCPPort, timeout)
+	}
+}
@@ -16,6 +16,7 @@ package boot
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 
@@ -23,25 +24,72 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
 
 	// Register supported of sinks.
+	_ "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/sinks/audit"
 	_ "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/sinks/null"
+	_ "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/sinks/recorder"
 	_ "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/sinks/remote"
 )
 
-// InitConfig represents the configuration to apply during pod creation. For
-// now, it supports setting up a seccheck session.
+// InitConfig represents the configuration to apply during pod creation. It
+// supports setting up a seccheck session, health-check probes and services
+// bridged onto host sockets.
 type InitConfig struct {
 	TraceSession seccheck.SessionConfig `json:"trace_session"`
+
+	// Probes are health-check probes run by the sentry.
+	Probes []ProbeConfig `json:"probes,omitempty"`
+
+	// Services are services of containers exposed on host sockets.
+	Services []ServiceConfig `json:"services,omitempty"`
+
+	// Egress is the egress policy of the sandbox, if any.
+	Egress *EgressPolicy `json:"egress,omitempty"`
 }
 
-func setupSeccheck(configFD int, sinkFDs []int) error {
-	config := fd.New(configFD)
-	defer config.Close()
+// TraceSessionsMetadataKey is the checkpoint image metadata key holding the
+// restartable trace sessions, which are recreated after restore.
+const TraceSessionsMetadataKey = "trace_sessions"
 
-	initConf, err := loadInitConfig(config)
+// addTraceSessionsMetadata records the restartable trace sessions in the
+// checkpoint metadata m.
+func addTraceSessionsMetadata(m map[string]string) error {
+	sessions := seccheck.Restartable()
+	if len(sessions) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(sessions)
 	if err != nil {
-		return err
+		return fmt.Errorf("marshaling trace sessions: %w", err)
+	}
+	m[TraceSessionsMetadataKey] = string(b)
+	return nil
+}
+
+// setupSeccheck loads the InitConfig from configFD, if it's valid, and creates
+// its seccheck session, if any. If recorderFD is valid, the flight recorder is
+// added to the session. The InitConfig is returned if it was loaded, even if
+// the session couldn't be created.
+func setupSeccheck(configFD int, sinkFDs []int, recorderFD int) (*InitConfig, error) {
+	initConf := &InitConfig{}
+	if configFD >= 0 {
+		config := fd.New(configFD)
+		defer config.Close()
+
+		var err error
+		initConf, err = loadInitConfig(config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if recorderFD >= 0 {
+		// The recorder comes after the sinks that sinkFDs belong to.
+		addFlightRecorder(&initConf.TraceSession, fd.New(recorderFD))
+	}
+	if initConf.TraceSession.Name == "" && len(initConf.TraceSession.Points) == 0 && len(initConf.TraceSession.Sinks) == 0 {
+		// Only probes and services are configured.
+		return initConf, nil
 	}
-	return initConf.create(sinkFDs)
+	return initConf, initConf.create(sinkFDs)
 }
 
 // LoadInitConfig loads an InitConfig struct from a json formatted file.
@@ -61,6 +109,14 @@ func loadInitConfig(reader io.Reader) (*InitConfig, error) {
 	if err := decoder.Decode(init); err != nil {
 		return nil, err
 	}
+	for i := range init.Probes {
+		if err := init.Probes[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateServices(init.Services); err != nil {
+		return nil, err
+	}
 	return init, nil
 }
 
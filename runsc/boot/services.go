@@ -0,0 +1,319 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/unet"
+	pf "github.com/talismancer/gvisor-ligolo/runsc/boot/portforward"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+	"golang.org/x/sys/unix"
+)
+
+// ServiceConfig declares a service listening on a TCP port in a container,
+// which the sandbox exposes on a Unix domain socket on the host. This lets
+// daemons on the host talk to the service without exposing it over TCP.
+//
+// The socket is created by runsc when the sandbox is created, and removed when
+// the sandbox is destroyed. The sentry accepts connections on it, checks the
+// credentials of the peer, and forwards the connection to the port, the same
+// way as port forwarding does.
+type ServiceConfig struct {
+	// Name identifies the service.
+	Name string `json:"name"`
+
+	// Container is the container providing the service. It matches either
+	// the Kubernetes container name annotation or the container ID.
+	Container string `json:"container"`
+
+	// Port is the TCP port the service listens on, on the loopback interface
+	// of the container's network namespace.
+	Port uint16 `json:"port"`
+
+	// Path is the absolute path of the socket on the host.
+	Path string `json:"path"`
+
+	// AllowedUIDs and AllowedGIDs are the host users and groups allowed to
+	// connect to the socket. A peer is allowed if its UID is in AllowedUIDs
+	// or its GID is in AllowedGIDs. If both are empty, only root is allowed.
+	AllowedUIDs []uint32 `json:"allowed_uids,omitempty"`
+	AllowedGIDs []uint32 `json:"allowed_gids,omitempty"`
+}
+
+// validate checks the service configuration.
+func (s *ServiceConfig) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("service name is required")
+	}
+	if s.Container == "" {
+		return fmt.Errorf("service %q: container is required", s.Name)
+	}
+	if s.Port == 0 {
+		return fmt.Errorf("service %q: port is required", s.Name)
+	}
+	if !filepath.IsAbs(s.Path) {
+		return fmt.Errorf("service %q: path must be absolute, got %q", s.Name, s.Path)
+	}
+	return nil
+}
+
+// allowed returns true if the peer with credentials cred may connect to the
+// service.
+func (s *ServiceConfig) allowed(cred *unix.Ucred) bool {
+	if len(s.AllowedUIDs) == 0 && len(s.AllowedGIDs) == 0 {
+		return cred.Uid == 0
+	}
+	for _, uid := range s.AllowedUIDs {
+		if cred.Uid == uid {
+			return true
+		}
+	}
+	for _, gid := range s.AllowedGIDs {
+		if cred.Gid == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if the service is provided by the given container.
+func (s *ServiceConfig) matches(cid string, spec *specs.Spec) bool {
+	return s.Container == cid || s.Container == specutils.ContainerName(spec)
+}
+
+// validateServices checks that service names and paths are unique.
+func validateServices(services []ServiceConfig) error {
+	names := make(map[string]struct{})
+	paths := make(map[string]struct{})
+	for i := range services {
+		s := &services[i]
+		if err := s.validate(); err != nil {
+			return err
+		}
+		if _, ok := names[s.Name]; ok {
+			return fmt.Errorf("duplicate service %q", s.Name)
+		}
+		names[s.Name] = struct{}{}
+		path := filepath.Clean(s.Path)
+		if _, ok := paths[path]; ok {
+			return fmt.Errorf("service %q: path %q is used by another service", s.Name, s.Path)
+		}
+		paths[path] = struct{}{}
+	}
+	return nil
+}
+
+// CreateServiceSocket creates the listening socket of a service on the host,
+// replacing a stale socket left at its path. The socket is accessible to all
+// users: access is controlled by checking the credentials of peers.
+func CreateServiceSocket(s *ServiceConfig) (*os.File, error) {
+	if fi, err := os.Lstat(s.Path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("service %q: %q exists and is not a socket", s.Name, s.Path)
+		}
+		if err := os.Remove(s.Path); err != nil {
+			return nil, fmt.Errorf("service %q: removing stale socket: %w", s.Name, err)
+		}
+	}
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "service-"+s.Name)
+	if err := unix.Bind(fd, &unix.SockaddrUnix{Name: s.Path}); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("service %q: binding to %q: %w", s.Name, s.Path, err)
+	}
+	if err := os.Chmod(s.Path, 0666); err != nil {
+		f.Close()
+		os.Remove(s.Path)
+		return nil, fmt.Errorf("service %q: %w", s.Name, err)
+	}
+	if err := unix.Listen(fd, 16 /* unet.backlog */); err != nil {
+		f.Close()
+		os.Remove(s.Path)
+		return nil, fmt.Errorf("service %q: listening on %q: %w", s.Name, s.Path, err)
+	}
+	return f, nil
+}
+
+// service is a service bridged onto a host socket.
+type service struct {
+	conf ServiceConfig
+	sock *unet.ServerSocket
+}
+
+// newServices returns the services in confs, listening on the host sockets in
+// fds, in the same order.
+func newServices(confs []ServiceConfig, fds []int) ([]*service, error) {
+	if len(confs) != len(fds) {
+		return nil, fmt.Errorf("%d services configured, but %d sockets passed", len(confs), len(fds))
+	}
+	var services []*service
+	for i, fd := range fds {
+		sock, err := unet.NewServerSocket(fd)
+		if err != nil {
+			return nil, fmt.Errorf("service %q: %w", confs[i].Name, err)
+		}
+		services = append(services, &service{conf: confs[i], sock: sock})
+	}
+	return services, nil
+}
+
+// serviceFDs returns the host sockets of the services.
+func (l *Loader) serviceFDs() []int {
+	var fds []int
+	for _, s := range l.services {
+		fds = append(fds, s.sock.FD())
+	}
+	return fds
+}
+
+// startServices starts accepting connections on the sockets of services.
+func (l *Loader) startServices() {
+	for _, s := range l.services {
+		log.Infof("Bridging service %q of container %q, port %d, onto %q", s.conf.Name, s.conf.Container, s.conf.Port, s.conf.Path)
+		go l.serveService(s) // S/R-SAFE: not saved.
+	}
+}
+
+// stopServices stops accepting connections for services. Connections already
+// forwarded are left alone.
+func (l *Loader) stopServices() {
+	for _, s := range l.services {
+		s.sock.Close()
+	}
+}
+
+// startServicesLocked records the services provided by a container that just
+// started.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) startServicesLocked(cid string, spec *specs.Spec) {
+	for _, s := range l.services {
+		if !s.conf.matches(cid, spec) {
+			continue
+		}
+		if l.serviceContainers == nil {
+			l.serviceContainers = make(map[string]string)
+		}
+		l.serviceContainers[s.conf.Name] = cid
+	}
+}
+
+// stopServicesLocked forgets the services provided by a container. New
+// connections to them are refused until a matching container starts.
+//
+// Preconditions: l.mu is locked.
+func (l *Loader) stopServicesLocked(cid string) {
+	for name, c := range l.serviceContainers {
+		if c == cid {
+			delete(l.serviceContainers, name)
+		}
+	}
+}
+
+func (l *Loader) serveService(s *service) {
+	for {
+		conn, err := s.sock.Accept()
+		if err != nil {
+			if err != unix.EBADF {
+				log.Warningf("Service %q stopped accepting connections: %v", s.conf.Name, err)
+			}
+			return
+		}
+		go l.handleServiceConn(s, conn) // S/R-SAFE: not saved.
+	}
+}
+
+// handleServiceConn checks the credentials of the peer of conn and forwards
+// it to the service.
+func (l *Loader) handleServiceConn(s *service, conn *unet.Socket) {
+	cred, err := conn.GetPeerCred()
+	if err != nil {
+		log.Warningf("Service %q: getting peer credentials: %v", s.conf.Name, err)
+		conn.Close()
+		return
+	}
+	if !s.conf.allowed(cred) {
+		log.Warningf("Service %q refused connection from PID %d, UID %d, GID %d", s.conf.Name, cred.Pid, cred.Uid, cred.Gid)
+		conn.Close()
+		return
+	}
+	fd, err := conn.Release()
+	if err != nil {
+		return
+	}
+	f := os.NewFile(uintptr(fd), "service-"+s.conf.Name)
+	defer f.Close()
+
+	if err := l.connectService(s, f); err != nil {
+		log.Warningf("Service %q: forwarding connection from PID %d: %v", s.conf.Name, cred.Pid, err)
+		return
+	}
+	log.Debugf("Service %q forwarding connection from PID %d", s.conf.Name, cred.Pid)
+}
+
+// connectService connects to the port of the service and forwards data
+// between it and the host stream file f.
+func (l *Loader) connectService(s *service, f *os.File) error {
+	l.mu.Lock()
+	cid, ok := l.serviceContainers[s.conf.Name]
+	l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("container %q is not running", s.conf.Container)
+	}
+
+	var pair pf.ProxyPair
+	switch l.root.conf.Network {
+	case config.NetworkSandbox:
+		l.mu.Lock()
+		ns := l.k.RootNetworkNamespace()
+		if ep := l.processes[execID{cid: cid}]; ep != nil && ep.netns != nil {
+			ns = ep.netns
+		}
+		stack, ok := ns.Stack().(*netstack.Stack)
+		l.mu.Unlock()
+		if !ok {
+			return fmt.Errorf("container %q doesn't use netstack", cid)
+		}
+		// Connecting may take long, don't hold the lock meanwhile.
+		conn, err := pf.DialNetstack(stack.Stack, tcpip.FullAddress{
+			Addr: tcpip.AddrFrom4([4]byte{0x7f, 0x00, 0x00, 0x01}), // 127.0.0.1
+			Port: s.conf.Port,
+		})
+		if err != nil {
+			return fmt.Errorf("connecting to port %d: %w", s.conf.Port, err)
+		}
+		pair.From = conn
+	case config.NetworkHost:
+		conn, err := pf.NewHostInetConn(s.conf.Port)
+		if err != nil {
+			return fmt.Errorf("connecting to port %d: %w", s.conf.Port, err)
+		}
+		pair.From = conn
+	default:
+		return fmt.Errorf("unsupported network type %q", l.root.conf.Network)
+	}
+	return l.forwardConn(cid, f, pair)
+}
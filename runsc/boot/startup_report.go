@@ -0,0 +1,83 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	gtime "time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+)
+
+// StartupPhase is a timed phase of the sandbox startup.
+type StartupPhase struct {
+	// Name is the name of the phase, e.g. "platform".
+	Name string `json:"name"`
+
+	// Container is the ID of the container the phase applies to, or empty
+	// for phases that apply to the whole sandbox.
+	Container string `json:"container,omitempty"`
+
+	// Start is when the phase started.
+	Start gtime.Time `json:"start"`
+
+	// Duration is how long the phase took.
+	Duration gtime.Duration `json:"duration"`
+}
+
+// StartupReport lists the startup phases of a sandbox, in the order they
+// completed.
+type StartupReport struct {
+	// Host are the phases recorded by runsc on the host, before and while the
+	// sandbox process starts.
+	Host []StartupPhase `json:"host,omitempty"`
+
+	// Sandbox are the phases recorded inside the sandbox process.
+	Sandbox []StartupPhase `json:"sandbox"`
+}
+
+// StartupRecorder records the startup phases of a sandbox. It's safe for
+// concurrent use. The zero value is ready to use.
+type StartupRecorder struct {
+	mu     sync.Mutex
+	phases []StartupPhase
+}
+
+// Begin starts timing phase name of container cid, which is empty for
+// phases that apply to the whole sandbox. The phase is recorded when the
+// returned function is called; phases that fail aren't ended.
+func (r *StartupRecorder) Begin(cid, name string) func() {
+	start := gtime.Now()
+	return func() {
+		phase := StartupPhase{
+			Name:      name,
+			Container: cid,
+			Start:     start,
+			Duration:  gtime.Since(start),
+		}
+		log.Debugf("Startup phase %q of container %q took %v", name, cid, phase.Duration)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.phases = append(r.phases, phase)
+	}
+}
+
+// Phases returns a copy of the phases recorded so far.
+func (r *StartupRecorder) Phases() []StartupPhase {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]StartupPhase(nil), r.phases...)
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/abi/linux"
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/fspath"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/proc"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/auth"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
+	"github.com/talismancer/gvisor-ligolo/pkg/usermem"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+)
+
+// applySysctls sets sysctls, from spec.Linux.Sysctl, in the namespaces of the
+// container process described by procArgs. Sysctls are written to
+// /proc/sys of a private procfs mount, so they are set in the network and IPC
+// namespaces of the container in the same way as if the container wrote them.
+//
+// Sysctls that the sandbox can't honor are logged. They fail the container
+// start if policy is config.SysctlPolicyStrict.
+func applySysctls(k *kernel.Kernel, procArgs *kernel.CreateProcessArgs, sysctls map[string]string, policy config.SysctlPolicy) error {
+	if len(sysctls) == 0 {
+		return nil
+	}
+
+	// Sysctls are set by the runtime, which is privileged in the container.
+	rootCreds := auth.NewRootCredentials(procArgs.Credentials.UserNamespace)
+	rootProcArgs := *procArgs
+	rootProcArgs.Credentials = rootCreds
+	ctx := rootProcArgs.NewContext(k)
+
+	mnt, err := k.VFS().MountDisconnected(ctx, rootCreds, "" /* source */, proc.Name, &vfs.MountOptions{})
+	if err != nil {
+		return fmt.Errorf("mounting procfs to set sysctls: %w", err)
+	}
+	defer mnt.DecRef(ctx)
+	root := vfs.MakeVirtualDentry(mnt, mnt.Root())
+
+	// Apply sysctls in a stable order, since some of them depend on each
+	// other.
+	names := make([]string, 0, len(sysctls))
+	for name := range sysctls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var unhonored []string
+	for _, name := range names {
+		value := sysctls[name]
+		if err := setSysctl(ctx, k.VFS(), rootCreds, root, name, value); err != nil {
+			log.Warningf("Sysctl %s=%q can't be honored in the sandbox: %v", name, value, err)
+			unhonored = append(unhonored, name)
+			continue
+		}
+		log.Infof("Sysctl %s=%q applied", name, value)
+	}
+	if len(unhonored) > 0 && policy == config.SysctlPolicyStrict {
+		return fmt.Errorf("sysctls %s can't be honored in the sandbox, see the logs for details", strings.Join(unhonored, ", "))
+	}
+	return nil
+}
+
+// setSysctl writes value to the /proc/sys file of sysctl name, under the
+// procfs root. If the file can't be written, but already holds value, the
+// sysctl is considered set; this is the case for many sysctls that the sandbox
+// reports but doesn't allow to change.
+func setSysctl(ctx context.Context, vfsObj *vfs.VirtualFilesystem, creds *auth.Credentials, root vfs.VirtualDentry, name, value string) error {
+	pop := &vfs.PathOperation{
+		Root:  root,
+		Start: root,
+		Path:  fspath.Parse("sys/" + strings.ReplaceAll(name, ".", "/")),
+	}
+	fd, err := vfsObj.OpenAt(ctx, creds, pop, &vfs.OpenOptions{Flags: linux.O_RDWR})
+	if err != nil {
+		if fd, rerr := vfsObj.OpenAt(ctx, creds, pop, &vfs.OpenOptions{Flags: linux.O_RDONLY}); rerr == nil {
+			defer fd.DecRef(ctx)
+			if sysctlValueMatches(ctx, fd, value) {
+				return nil
+			}
+		}
+		return err
+	}
+	defer fd.DecRef(ctx)
+
+	if _, err := fd.PWrite(ctx, usermem.BytesIOSequence([]byte(value)), 0, vfs.WriteOptions{}); err != nil {
+		if sysctlValueMatches(ctx, fd, value) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// sysctlValueMatches returns true if fd holds value, ignoring differences in
+// whitespace.
+func sysctlValueMatches(ctx context.Context, fd *vfs.FileDescription, value string) bool {
+	buf := make([]byte, 4096)
+	n, err := fd.PRead(ctx, usermem.BytesIOSequence(buf), 0, vfs.ReadOptions{})
+	if err != nil && n == 0 {
+		return false
+	}
+	return strings.Join(strings.Fields(string(buf[:n])), " ") == strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,586 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"bytes"
+	gocontext "context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/context"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
+	pb "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/points/points_go_proto"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/socket/netstack"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/adapters/gonet"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv4"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/network/ipv6"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/stack"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+)
+
+// With --tls-intercept-ca, TCP connections made by applications to the
+// intercepted ports are redirected by netstack to a proxy listening on
+// loopback in the sandbox. The proxy reads the TLS ClientHello and, if the
+// server name is intercepted, completes the handshake with a certificate for
+// the server name issued by the CA, connects to the original destination with
+// TLS and relays the plaintext between both connections, reporting it to the
+// "sentry/tls_plaintext" trace point. Other connections are relayed
+// unmodified.
+//
+// Applications see their connections as made to the original destination,
+// but from a loopback address.
+
+const (
+	// tlsInterceptFlowTimeout bounds how long the proxy waits for the
+	// original destination of an accepted connection to be registered.
+	tlsInterceptFlowTimeout = 5 * time.Second
+
+	// tlsInterceptHandshakeTimeout bounds the TLS handshakes of the proxy.
+	tlsInterceptHandshakeTimeout = 30 * time.Second
+
+	// tlsInterceptMaxPendingFlows is the number of redirected connections
+	// not yet accepted by the proxy above which stale ones are dropped.
+	tlsInterceptMaxPendingFlows = 1024
+
+	// tlsInterceptCertLifetime is the validity of issued certificates.
+	tlsInterceptCertLifetime = 24 * time.Hour
+
+	// tlsInterceptBufferSize is the size of the buffers plaintext is relayed
+	// with, which bounds the size of reported chunks.
+	tlsInterceptBufferSize = 16 << 10
+)
+
+// errClientHelloRead stops a handshake once the ClientHello has been read.
+var errClientHelloRead = errors.New("ClientHello read")
+
+// tlsInterceptor implements netstack.ConnectRedirector by redirecting
+// connections to its TLS intercepting proxy.
+type tlsInterceptor struct {
+	// stack is the stack the proxy runs in.
+	stack *stack.Stack
+
+	// ca is the certificate of the CA issuing the certificates presented to
+	// applications, and caKey its private key.
+	ca    *x509.Certificate
+	caKey crypto.Signer
+
+	// leafKey is the key of the issued certificates.
+	leafKey *ecdsa.PrivateKey
+
+	// roots are the CA certificates servers are verified with.
+	roots *x509.CertPool
+
+	// ports are the intercepted port ranges.
+	ports [][2]uint16
+
+	// hosts are the intercepted server names, lowercase. "*." prefixes match
+	// any subdomain. All server names are intercepted if empty.
+	hosts []string
+
+	// lastFlowID is the ID of the last intercepted connection.
+	lastFlowID atomic.Uint64
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// flowCond is signaled when flows changes.
+	flowCond sync.Cond
+
+	// listeners are the proxy listeners, by network protocol, created when
+	// first needed since loopback addresses are configured after the stack
+	// is created.
+	//
+	// +checklocks:mu
+	listeners map[tcpip.NetworkProtocolNumber]*gonet.TCPListener
+
+	// flows maps the local address of redirected connections to their
+	// original destination, until the proxy accepts them.
+	//
+	// +checklocks:mu
+	flows map[string]pendingFlow
+
+	// certs caches the issued certificates by server name.
+	//
+	// +checklocks:mu
+	certs map[string]*tls.Certificate
+}
+
+var _ netstack.ConnectRedirector = (*tlsInterceptor)(nil)
+
+// pendingFlow is a redirected connection not yet accepted by the proxy.
+type pendingFlow struct {
+	dst     tcpip.FullAddress
+	created time.Time
+}
+
+// newTLSInterceptor creates a tlsInterceptor for stack s, with the CA read
+// from caFD and the roots read from rootsFD. It takes ownership of the FDs.
+func newTLSInterceptor(s *stack.Stack, caFD, rootsFD int, conf *config.Config) (*tlsInterceptor, error) {
+	caPEM, err := readDonatedFile(caFD, "tls-intercept-ca")
+	if err != nil {
+		return nil, fmt.Errorf("reading CA: %w", err)
+	}
+	if rootsFD < 0 {
+		return nil, fmt.Errorf("no CA bundle to verify servers with")
+	}
+	rootsPEM, err := readDonatedFile(rootsFD, "tls-intercept-roots")
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle: %w", err)
+	}
+
+	pair, err := tls.X509KeyPair(caPEM, caPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA: %w", err)
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("parsing CA certificate: %w", err)
+	}
+	if !ca.IsCA {
+		return nil, fmt.Errorf("certificate %q isn't a CA", ca.Subject)
+	}
+	caKey, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA private key type %T", pair.PrivateKey)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(rootsPEM) {
+		return nil, fmt.Errorf("no certificate found in CA bundle")
+	}
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generating key: %w", err)
+	}
+
+	ti := &tlsInterceptor{
+		stack:     s,
+		ca:        ca,
+		caKey:     caKey,
+		leafKey:   leafKey,
+		roots:     roots,
+		listeners: make(map[tcpip.NetworkProtocolNumber]*gonet.TCPListener),
+		flows:     make(map[string]pendingFlow),
+		certs:     make(map[string]*tls.Certificate),
+	}
+	ti.flowCond.L = &ti.mu
+	for _, p := range strings.Split(conf.TLSInterceptPorts, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		ports, err := parsePortRange(p)
+		if err != nil {
+			return nil, fmt.Errorf("tls-intercept-ports: %w", err)
+		}
+		ti.ports = append(ti.ports, ports)
+	}
+	if len(ti.ports) == 0 {
+		return nil, fmt.Errorf("tls-intercept-ports is empty")
+	}
+	for _, h := range strings.Split(conf.TLSInterceptHosts, ",") {
+		if h = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(h)), "."); h != "" {
+			ti.hosts = append(ti.hosts, h)
+		}
+	}
+	log.Infof("TLS interception enabled with CA %q, ports: %s, hosts: %v", ca.Subject, conf.TLSInterceptPorts, ti.hosts)
+	return ti, nil
+}
+
+// readDonatedFile reads and closes the file donated as fd.
+func readDonatedFile(fd int, name string) ([]byte, error) {
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// RedirectConnect implements netstack.ConnectRedirector.RedirectConnect.
+func (ti *tlsInterceptor) RedirectConnect(addr tcpip.FullAddress) (tcpip.FullAddress, bool) {
+	if !ti.interceptsPort(addr.Port) {
+		return addr, false
+	}
+	ip := net.IP(addr.Addr.AsSlice())
+	if ip.IsLoopback() || ip.IsUnspecified() {
+		return addr, false
+	}
+	proto, loopback := ipv6.ProtocolNumber, net.IPv6loopback
+	if ip4 := ip.To4(); ip4 != nil {
+		proto, loopback = ipv4.ProtocolNumber, net.IPv4(127, 0, 0, 1)
+	}
+	ln, err := ti.listener(proto, loopback)
+	if err != nil {
+		log.Warningf("TLS interception: not intercepting connection to %s: %v", formatFullAddress(addr), err)
+		return addr, false
+	}
+	to := tcpip.FullAddress{Port: uint16(ln.Addr().(*net.TCPAddr).Port)}
+	if addr.Addr.Len() == net.IPv6len {
+		// IPv6 sockets connect to IPv4 destinations through IPv4-mapped
+		// addresses.
+		to.Addr = tcpip.AddrFromSlice(loopback.To16())
+	} else {
+		to.Addr = tcpip.AddrFromSlice(loopback.To4())
+	}
+	return to, true
+}
+
+// ConnectRedirected implements netstack.ConnectRedirector.ConnectRedirected.
+func (ti *tlsInterceptor) ConnectRedirected(local, addr tcpip.FullAddress) {
+	now := time.Now()
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if len(ti.flows) >= tlsInterceptMaxPendingFlows {
+		for k, f := range ti.flows {
+			if now.Sub(f.created) > tlsInterceptFlowTimeout {
+				delete(ti.flows, k)
+			}
+		}
+	}
+	ti.flows[flowKey(net.IP(local.Addr.AsSlice()), int(local.Port))] = pendingFlow{dst: addr, created: now}
+	ti.flowCond.Broadcast()
+}
+
+// flowKey returns the key of a connection from ip:port in flows. IPv4-mapped
+// addresses have the same key as their IPv4 address.
+func flowKey(ip net.IP, port int) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(port))
+}
+
+func (ti *tlsInterceptor) interceptsPort(port uint16) bool {
+	for _, r := range ti.ports {
+		if port >= r[0] && port <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (ti *tlsInterceptor) interceptsHost(name string) bool {
+	if len(ti.hosts) == 0 {
+		return true
+	}
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if name == "" {
+		return false
+	}
+	for _, h := range ti.hosts {
+		if suffix, ok := strings.CutPrefix(h, "*"); ok {
+			if strings.HasSuffix(name, suffix) {
+				return true
+			}
+		} else if name == h {
+			return true
+		}
+	}
+	return false
+}
+
+// listener returns the proxy listener for network protocol proto, creating it
+// on the loopback address if needed.
+func (ti *tlsInterceptor) listener(proto tcpip.NetworkProtocolNumber, loopback net.IP) (*gonet.TCPListener, error) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if ln, ok := ti.listeners[proto]; ok {
+		return ln, nil
+	}
+	addr := tcpip.FullAddress{Addr: tcpip.AddrFromSlice(loopback)}
+	if proto == ipv4.ProtocolNumber {
+		addr.Addr = tcpip.AddrFromSlice(loopback.To4())
+	}
+	ln, err := gonet.ListenTCP(ti.stack, addr, proto)
+	if err != nil {
+		return nil, err
+	}
+	ti.listeners[proto] = ln
+	log.Infof("TLS interception proxy listening on %s", ln.Addr())
+	go ti.serve(ln) // S/R-SAFE: intercepted connections aren't saved.
+	return ln, nil
+}
+
+// serve accepts connections on ln until it fails.
+func (ti *tlsInterceptor) serve(ln *gonet.TCPListener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Warningf("TLS interception proxy stopped accepting on %s: %v", ln.Addr(), err)
+			return
+		}
+		go ti.handle(conn) // S/R-SAFE: intercepted connections aren't saved.
+	}
+}
+
+// originalDestination returns the original destination of the redirected
+// connection from peer.
+func (ti *tlsInterceptor) originalDestination(peer *net.TCPAddr) (tcpip.FullAddress, bool) {
+	key := flowKey(peer.IP, peer.Port)
+	deadline := time.Now().Add(tlsInterceptFlowTimeout)
+	timer := time.AfterFunc(tlsInterceptFlowTimeout, func() {
+		ti.mu.Lock()
+		ti.flowCond.Broadcast()
+		ti.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	for {
+		if f, ok := ti.flows[key]; ok {
+			delete(ti.flows, key)
+			return f.dst, true
+		}
+		if time.Now().After(deadline) {
+			return tcpip.FullAddress{}, false
+		}
+		ti.flowCond.Wait()
+	}
+}
+
+// handle proxies the redirected connection conn.
+func (ti *tlsInterceptor) handle(conn net.Conn) {
+	defer conn.Close()
+	dst, ok := ti.originalDestination(conn.RemoteAddr().(*net.TCPAddr))
+	if !ok {
+		log.Warningf("TLS interception: unknown connection from %s", conn.RemoteAddr())
+		return
+	}
+
+	// Read the ClientHello to decide whether to intercept the connection.
+	// Whatever is read is replayed to the TLS server or original
+	// destination.
+	var hello bytes.Buffer
+	conn.SetDeadline(time.Now().Add(tlsInterceptHandshakeTimeout))
+	info := readClientHello(io.TeeReader(conn, &hello))
+	client := &replayConn{Conn: conn, r: io.MultiReader(&hello, conn)}
+
+	proto := ipv6.ProtocolNumber
+	if ip4 := net.IP(dst.Addr.AsSlice()).To4(); ip4 != nil {
+		// The destination may be IPv4-mapped.
+		proto, dst.Addr = ipv4.ProtocolNumber, tcpip.AddrFromSlice(ip4)
+	}
+	ctx, cancel := gocontext.WithTimeout(gocontext.Background(), tlsInterceptHandshakeTimeout)
+	defer cancel()
+	upstream, err := gonet.DialContextTCP(ctx, ti.stack, dst, proto)
+	if err != nil {
+		log.Infof("TLS interception: dialing %s: %v", formatFullAddress(dst), err)
+		return
+	}
+	defer upstream.Close()
+
+	if info == nil || !ti.interceptsHost(info.ServerName) {
+		conn.SetDeadline(time.Time{})
+		relay(client, upstream, nil)
+		return
+	}
+	ti.intercept(ctx, client, upstream, dst, info)
+}
+
+// intercept terminates the TLS connection client, whose ClientHello is info,
+// and relays its plaintext over a TLS connection re-originated on upstream.
+func (ti *tlsInterceptor) intercept(ctx gocontext.Context, client net.Conn, upstream net.Conn, dst tcpip.FullAddress, info *tls.ClientHelloInfo) {
+	serverName := info.ServerName
+	if serverName == "" {
+		serverName = dst.Addr.String()
+	}
+	server := tls.Client(upstream, &tls.Config{
+		ServerName: serverName,
+		RootCAs:    ti.roots,
+		NextProtos: info.SupportedProtos,
+	})
+	if err := server.HandshakeContext(ctx); err != nil {
+		log.Warningf("TLS interception: handshake with %s (%q) failed: %v", formatFullAddress(dst), serverName, err)
+		return
+	}
+	cert, err := ti.certificate(serverName)
+	if err != nil {
+		log.Warningf("TLS interception: issuing certificate for %q: %v", serverName, err)
+		return
+	}
+	var nextProtos []string
+	if p := server.ConnectionState().NegotiatedProtocol; p != "" {
+		nextProtos = []string{p}
+	}
+	app := tls.Server(client, &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		NextProtos:   nextProtos,
+	})
+	if err := app.HandshakeContext(ctx); err != nil {
+		log.Infof("TLS interception: handshake with application connecting to %s (%q) failed: %v", formatFullAddress(dst), serverName, err)
+		return
+	}
+	client.SetDeadline(time.Time{})
+
+	flow := &pb.TLSPlaintext{
+		FlowId:        ti.lastFlowID.Add(1),
+		ServerName:    info.ServerName,
+		RemoteAddress: formatFullAddress(dst),
+	}
+	log.Debugf("TLS interception: intercepting flow %d to %s (%q)", flow.FlowId, flow.RemoteAddress, serverName)
+	relay(app, server, flow)
+}
+
+// certificate returns a certificate for name issued by the CA.
+func (ti *tlsInterceptor) certificate(name string) (*tls.Certificate, error) {
+	now := time.Now()
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+	if cert, ok := ti.certs[name]; ok && now.Add(time.Hour).Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	notAfter := now.Add(tlsInterceptCertLifetime)
+	if notAfter.After(ti.ca.NotAfter) {
+		notAfter = ti.ca.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ti.ca, &ti.leafKey.PublicKey, ti.caKey)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{
+		Certificate: [][]byte{der, ti.ca.Raw},
+		PrivateKey:  ti.leafKey,
+		Leaf:        leaf,
+	}
+	ti.certs[name] = cert
+	return cert, nil
+}
+
+// readClientHello reads a TLS ClientHello from r. It returns nil if r doesn't
+// start with a ClientHello.
+func readClientHello(r io.Reader) *tls.ClientHelloInfo {
+	var info *tls.ClientHelloInfo
+	tls.Server(&replayConn{r: r}, &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			info = hello
+			return nil, errClientHelloRead
+		},
+	}).Handshake()
+	return info
+}
+
+// replayConn is a net.Conn reading from r. If Conn is nil, writes are
+// discarded.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+// Read implements net.Conn.Read.
+func (c *replayConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// Write implements net.Conn.Write.
+func (c *replayConn) Write(b []byte) (int, error) {
+	if c.Conn == nil {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+// relay copies data between client and server until both directions are
+// done. If flow isn't nil, the data is reported to the tls_plaintext point.
+func relay(client, server net.Conn, flow *pb.TLSPlaintext) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() { // S/R-SAFE: intercepted connections aren't saved.
+		defer wg.Done()
+		relayOneWay(server, client, flow, false /* fromServer */)
+	}()
+	relayOneWay(client, server, flow, true /* fromServer */)
+	wg.Wait()
+}
+
+// relayOneWay copies data from src to dst.
+func relayOneWay(dst, src net.Conn, flow *pb.TLSPlaintext, fromServer bool) {
+	buf := make([]byte, tlsInterceptBufferSize)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if flow != nil {
+				reportTLSPlaintext(flow, fromServer, buf[:n])
+			}
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				src.Close()
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				// The connection failed, tear down both directions.
+				dst.Close()
+				return
+			}
+			if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+				cw.CloseWrite()
+			}
+			return
+		}
+	}
+}
+
+// reportTLSPlaintext reports data of flow to the tls_plaintext point.
+func reportTLSPlaintext(flow *pb.TLSPlaintext, fromServer bool, data []byte) {
+	if !seccheck.Global.Enabled(seccheck.PointTLSPlaintext) {
+		return
+	}
+	info := &pb.TLSPlaintext{
+		FlowId:        flow.FlowId,
+		ServerName:    flow.ServerName,
+		RemoteAddress: flow.RemoteAddress,
+		FromServer:    fromServer,
+		Data:          append([]byte(nil), data...),
+	}
+	fields := seccheck.Global.GetFieldSet(seccheck.PointTLSPlaintext)
+	seccheck.Global.SentToSinks(func(c seccheck.Sink) error {
+		return c.TLSPlaintext(context.Background(), fields, info)
+	})
+}
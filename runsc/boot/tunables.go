@@ -0,0 +1,101 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package boot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel/futex"
+)
+
+// sentryTunable is an experimental knob of the sentry, set at boot with
+// --sentry-tunables rather than with a flag of its own.
+type sentryTunable struct {
+	// get returns the current value of the knob.
+	get func() string
+
+	// set sets the knob to the given value. It's called before the kernel is
+	// initialized.
+	set func(string) error
+}
+
+// sentryTunables are the knobs that can be set with --sentry-tunables, by
+// name.
+var sentryTunables = map[string]sentryTunable{
+	// kernel.pid_max is the largest thread ID allocated in a PID namespace,
+	// like Linux's /proc/sys/kernel/pid_max.
+	"kernel.pid_max": {
+		get: func() string {
+			return strconv.Itoa(int(kernel.PIDMax()))
+		},
+		set: func(val string) error {
+			tid, err := strconv.ParseInt(val, 10, 32)
+			if err != nil {
+				return err
+			}
+			return kernel.SetPIDMax(kernel.ThreadID(tid))
+		},
+	},
+	// kernel.futex_buckets is the number of buckets in the futex hash table
+	// of each address space.
+	"kernel.futex_buckets": {
+		get: func() string {
+			return strconv.Itoa(futex.BucketCount())
+		},
+		set: func(val string) error {
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				return err
+			}
+			return futex.SetBucketCount(n)
+		},
+	},
+}
+
+// setSentryTunables sets the knobs in tunables, a comma-separated list of
+// key=value pairs.
+func setSentryTunables(tunables string) error {
+	for _, kv := range strings.Split(tunables, ",") {
+		if kv == "" {
+			continue
+		}
+		key, val, ok := parseKeyValue(kv)
+		if !ok {
+			return fmt.Errorf("invalid sentry tunable %q, must be key=value", kv)
+		}
+		t, ok := sentryTunables[key]
+		if !ok {
+			return fmt.Errorf("unknown sentry tunable %q", key)
+		}
+		if err := t.set(val); err != nil {
+			return fmt.Errorf("invalid value %q for sentry tunable %q: %w", val, key, err)
+		}
+		log.Infof("Sentry tunable %s set to %s", key, t.get())
+	}
+	return nil
+}
+
+// sentryTunableValues returns the current values of all knobs, by name.
+func sentryTunableValues() map[string]string {
+	vals := make(map[string]string, len(sentryTunables))
+	for key, t := range sentryTunables {
+		vals[key] = t.get()
+	}
+	return vals
+}
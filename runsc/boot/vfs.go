@@ -36,6 +36,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/devices/nvproxy"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/devices/ttydev"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/devices/tundev"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/binfmtmisc"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/cgroupfs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/devpts"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/fsimpl/devtmpfs"
@@ -53,6 +54,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/vfs"
 	"github.com/talismancer/gvisor-ligolo/runsc/config"
 	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+	"golang.org/x/sync/errgroup"
 )
 
 // Supported filesystems that map to different internal filesystems.
@@ -82,11 +84,20 @@ func selfOverlayFilestoreName(sandboxID string) string {
 // tmpfs has some extra supported options that we must pass through.
 var tmpfsAllowedData = []string{"mode", "size", "uid", "gid"}
 
+// shmSizeAnnotation sets the size of the container's /dev/shm if it's a tmpfs
+// mount, overriding the size option of the mount. The value has the format
+// of the size option, e.g. "1g". The size can be changed from inside the
+// container by remounting /dev/shm.
+const shmSizeAnnotation = "dev.gvisor.spec.shm-size"
+
 func registerFilesystems(k *kernel.Kernel, info *containerInfo) error {
 	ctx := k.SupervisorContext()
 	creds := auth.NewRootCredentials(k.RootUserNamespace())
 	vfsObj := k.VFS()
 
+	// TODO(Talismancer/gvisor-ligolo#synth-3174): Register a writable
+	// cgroup2 filesystem, so that inner runtimes can use the cgroupfs v2
+	// driver with --nested-containers.
 	vfsObj.MustRegisterFilesystemType(cgroupfs.Name, &cgroupfs.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
 		AllowUserMount: true,
 		AllowUserList:  true,
@@ -128,6 +139,10 @@ func registerFilesystems(k *kernel.Kernel, info *containerInfo) error {
 		AllowUserMount: true,
 		AllowUserList:  true,
 	})
+	vfsObj.MustRegisterFilesystemType(binfmtmisc.Name, &binfmtmisc.FilesystemType{}, &vfs.RegisterFilesystemTypeOptions{
+		AllowUserMount: true,
+		AllowUserList:  true,
+	})
 
 	// Register devices.
 	if err := memdev.Register(vfsObj); err != nil {
@@ -247,6 +262,8 @@ func compileMounts(spec *specs.Spec, conf *config.Config) []specs.Mount {
 		case "/dev/pts":
 			m.Type = devpts.Name
 			devptsMounted = true
+		case "/dev/shm":
+			m.Options = shmMountOptions(spec, &m)
 		}
 		mounts = append(mounts, m)
 	}
@@ -304,8 +321,9 @@ func compileMounts(spec *specs.Spec, conf *config.Config) []specs.Mount {
 	return mounts
 }
 
-// goferMountData creates a slice of gofer mount data.
-func goferMountData(fd int, fa config.FileAccessType, conf *config.Config) []string {
+// goferMountData creates a slice of gofer mount data. hint, if not nil, may
+// override conf for the mount.
+func goferMountData(fd int, fa config.FileAccessType, hint *MountHint, conf *config.Config) []string {
 	opts := []string{
 		"trans=fd",
 		"rfdno=" + strconv.Itoa(fd),
@@ -314,12 +332,37 @@ func goferMountData(fd int, fa config.FileAccessType, conf *config.Config) []str
 	if fa == config.FileAccessShared {
 		opts = append(opts, "cache=remote_revalidating")
 	}
-	if conf.DirectFS {
+	directfs := conf.DirectFS
+	if hint != nil && hint.directfs != nil {
+		directfs = *hint.directfs
+	}
+	if directfs {
 		opts = append(opts, "directfs")
 	}
 	if !conf.HostFifo.AllowOpen() {
 		opts = append(opts, "disable_fifo_open")
 	}
+	switch conf.MappedFileTruncate {
+	case config.MappedFileTruncateEIO:
+		opts = append(opts, "truncate_eio")
+	case config.MappedFileTruncatePin:
+		opts = append(opts, "force_page_cache")
+	}
+	if hint != nil && hint.readahead != 0 {
+		opts = append(opts, "readahead="+strconv.FormatUint(hint.readahead, 10))
+	}
+	if hint != nil && hint.writeback != 0 {
+		opts = append(opts, "writeback="+strconv.FormatUint(hint.writeback, 10))
+	}
+	if hint != nil && hint.ino != "" {
+		opts = append(opts, "ino="+hint.ino)
+	}
+	if hint != nil && hint.dev != 0 {
+		opts = append(opts, "dev="+strconv.FormatUint(uint64(hint.dev), 10))
+	}
+	if hint != nil && hint.watch && fa != config.FileAccessShared {
+		opts = append(opts, "watch")
+	}
 	return opts
 }
 
@@ -371,6 +414,9 @@ func (f *fdDispenser) empty() bool {
 type containerMounter struct {
 	root *specs.Root
 
+	// rootPropagation is the propagation option of the root mount.
+	rootPropagation string
+
 	// mounts is the set of submounts for the container. It's a copy from the spec
 	// that may be freely modified without affecting the original spec.
 	mounts []specs.Mount
@@ -397,11 +443,34 @@ type containerMounter struct {
 
 	// sandboxID is the ID for the whole sandbox.
 	sandboxID string
+
+	// synthesized are the files mounted in the container whose contents are
+	// generated by the sandbox.
+	synthesized []*synthesizedFile
+
+	// cid is the ID of the container. It owns the gofer mounts.
+	cid string
+
+	// goferMounts are the unique IDs of the gofer mounts, in the order in which
+	// they were given gofer FDs.
+	goferMounts []string
+
+	// resources are the resources of the container from the spec, if any.
+	resources *specs.LinuxResources
 }
 
-func newContainerMounter(info *containerInfo, k *kernel.Kernel, hints *PodMountHints, productName string, sandboxID string) *containerMounter {
+func newContainerMounter(info *containerInfo, cid string, k *kernel.Kernel, hints *PodMountHints, productName string, sandboxID string) *containerMounter {
+	var (
+		rootPropagation string
+		resources       *specs.LinuxResources
+	)
+	if info.spec.Linux != nil {
+		rootPropagation = info.spec.Linux.RootfsPropagation
+		resources = info.spec.Linux.Resources
+	}
 	return &containerMounter{
 		root:                info.spec.Root,
+		rootPropagation:     rootPropagation,
 		mounts:              compileMounts(info.spec, info.conf),
 		fds:                 fdDispenser{fds: info.goferFDs},
 		overlayFilestoreFDs: fdDispenser{fds: info.overlayFilestoreFDs},
@@ -410,6 +479,8 @@ func newContainerMounter(info *containerInfo, k *kernel.Kernel, hints *PodMountH
 		hints:               hints,
 		productName:         productName,
 		sandboxID:           sandboxID,
+		cid:                 cid,
+		resources:           resources,
 	}
 }
 
@@ -439,6 +510,7 @@ func (c *containerMounter) mountAll(rootCtx context.Context, rootCreds *auth.Cre
 	root := mns.Root()
 	root.IncRef()
 	defer root.DecRef(rootCtx)
+	c.setMountPropagation(root.Mount(), []string{c.rootPropagation})
 	if root.Mount().ReadOnly() {
 		// Switch to ReadWrite while we setup submounts.
 		if err := c.k.VFS().SetMountReadOnly(root.Mount(), false); err != nil {
@@ -463,7 +535,8 @@ func (c *containerMounter) mountAll(rootCtx context.Context, rootCreds *auth.Cre
 // createMountNamespace creates the container's root mount and namespace.
 func (c *containerMounter) createMountNamespace(ctx context.Context, conf *config.Config, creds *auth.Credentials) (*vfs.MountNamespace, error) {
 	ioFD := c.fds.remove()
-	data := goferMountData(ioFD, conf.FileAccess, conf)
+	c.goferMounts = append(c.goferMounts, "/")
+	data := goferMountData(ioFD, conf.FileAccess, nil /* hint */, conf)
 
 	// We can't check for overlayfs here because sandbox is chroot'ed and gofer
 	// can only send mount options for specs.Mounts (specs.Root is missing
@@ -480,6 +553,7 @@ func (c *containerMounter) createMountNamespace(ctx context.Context, conf *confi
 			Data: strings.Join(data, ","),
 			InternalData: gofer.InternalFilesystemOptions{
 				UniqueID: "/",
+				Owner:    c.cid,
 			},
 		},
 		InternalMount: true,
@@ -627,18 +701,40 @@ func (c *containerMounter) configureOverlay(ctx context.Context, conf *config.Co
 
 	// Configure overlay with both layers.
 	overlayOpts.GetFilesystemOptions.InternalData = overlay.FilesystemOptions{
-		UpperRoot:  upperRootVD,
-		LowerRoots: []vfs.VirtualDentry{lowerRootVD},
+		UpperRoot:   upperRootVD,
+		LowerRoots:  []vfs.VirtualDentry{lowerRootVD},
+		MetaCopy:    conf.OverlayMetaCopy,
+		RedirectDir: conf.OverlayMetaCopy,
 	}
 	return &overlayOpts, cu.Release(), nil
 }
 
+// maxConcurrentSubmounts is the maximum number of submount filesystems that
+// are created concurrently.
+const maxConcurrentSubmounts = 8
+
 func (c *containerMounter) mountSubmounts(ctx context.Context, conf *config.Config, mns *vfs.MountNamespace, creds *auth.Credentials) error {
 	mounts, err := c.prepareMounts()
 	if err != nil {
 		return err
 	}
 
+	// Creating a filesystem doesn't depend on other mounts, but may take
+	// round trips to the gofer, so filesystems are created concurrently. They
+	// are then connected in order, so that parents are mounted before their
+	// children.
+	disconnected, err := c.newSubmounts(ctx, conf, creds, mounts)
+	defer func() {
+		for _, mnt := range disconnected {
+			if mnt != nil {
+				mnt.DecRef(ctx)
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
 	for i := range mounts {
 		submount := &mounts[i]
 		log.Debugf("Mounting %q to %q, type: %s, options: %s", submount.mount.Source, submount.mount.Destination, submount.mount.Type, submount.mount.Options)
@@ -647,14 +743,19 @@ func (c *containerMounter) mountSubmounts(ctx context.Context, conf *config.Conf
 			err error
 		)
 
-		if submount.hint != nil && submount.hint.shouldShareMount() {
+		if submount.hint != nil && submount.hint.shouldSynthesize(submount.mount) {
+			mnt, err = c.mountSynthesizedFile(ctx, creds, mns, submount)
+			if err != nil {
+				return fmt.Errorf("mount synthesized file %q: %w", submount.mount.Destination, err)
+			}
+		} else if submount.hint != nil && submount.hint.shouldShareMount() {
 			mnt, err = c.mountSharedSubmount(ctx, conf, mns, creds, submount.mount, submount.hint)
 			if err != nil {
 				return fmt.Errorf("mount shared mount %q to %q: %v", submount.hint.name, submount.mount.Destination, err)
 			}
-		} else {
-			mnt, err = c.mountSubmount(ctx, conf, mns, creds, submount)
-			if err != nil {
+		} else if disconnected[i] != nil {
+			mnt = disconnected[i]
+			if err := c.connectSubmount(ctx, mns, creds, submount, mnt); err != nil {
 				return fmt.Errorf("mount submount %q: %w", submount.mount.Destination, err)
 			}
 		}
@@ -711,6 +812,7 @@ func (c *containerMounter) prepareMounts() ([]mountInfo, error) {
 		}
 		if specutils.IsGoferMount(*m) {
 			info.fd = c.fds.remove()
+			c.goferMounts = append(c.goferMounts, m.Destination)
 			info.overlayMedium = c.overlayMediums[goferMntIdx]
 			if info.overlayMedium.IsBackedByHostFile() {
 				info.overlayFilestoreFD = c.overlayFilestoreFDs.removeAsFD()
@@ -731,7 +833,47 @@ func (c *containerMounter) prepareMounts() ([]mountInfo, error) {
 	return mounts, nil
 }
 
+// newSubmounts creates the filesystems of mounts, other than synthesized and
+// shared mounts, using up to maxConcurrentSubmounts goroutines. It returns a
+// disconnected mount for each of mounts, or nil if the mount isn't created
+// here. The caller must DecRef the returned mounts, even on error.
+func (c *containerMounter) newSubmounts(ctx context.Context, conf *config.Config, creds *auth.Credentials, mounts []mountInfo) ([]*vfs.Mount, error) {
+	disconnected := make([]*vfs.Mount, len(mounts))
+	var g errgroup.Group
+	g.SetLimit(maxConcurrentSubmounts)
+	for i := range mounts {
+		submount := &mounts[i]
+		if submount.hint != nil && (submount.hint.shouldSynthesize(submount.mount) || submount.hint.shouldShareMount()) {
+			continue
+		}
+		i := i
+		g.Go(func() error {
+			mnt, err := c.newSubmount(ctx, conf, creds, submount)
+			if err != nil {
+				return fmt.Errorf("mount submount %q: %w", submount.mount.Destination, err)
+			}
+			disconnected[i] = mnt
+			return nil
+		})
+	}
+	return disconnected, g.Wait()
+}
+
 func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Config, mns *vfs.MountNamespace, creds *auth.Credentials, submount *mountInfo) (*vfs.Mount, error) {
+	mnt, err := c.newSubmount(ctx, conf, creds, submount)
+	if mnt == nil || err != nil {
+		return nil, err
+	}
+	defer mnt.DecRef(ctx)
+	if err := c.connectSubmount(ctx, mns, creds, submount, mnt); err != nil {
+		return nil, err
+	}
+	return mnt, nil
+}
+
+// newSubmount creates the filesystem of submount, and returns it as a
+// disconnected mount. It returns nil if the filesystem isn't supported.
+func (c *containerMounter) newSubmount(ctx context.Context, conf *config.Config, creds *auth.Credentials, submount *mountInfo) (*vfs.Mount, error) {
 	fsName, opts, err := c.getMountNameAndOptions(conf, submount)
 	if err != nil {
 		return nil, fmt.Errorf("mountOptions failed: %w", err)
@@ -741,10 +883,6 @@ func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Confi
 		return nil, nil
 	}
 
-	if err := c.makeMountPoint(ctx, creds, mns, submount.mount.Destination); err != nil {
-		return nil, fmt.Errorf("creating mount point %q: %w", submount.mount.Destination, err)
-	}
-
 	if submount.overlayMedium.IsEnabled() {
 		log.Infof("Adding overlay on top of mount %q", submount.mount.Destination)
 		var cleanup func()
@@ -756,6 +894,21 @@ func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Confi
 		fsName = overlay.Name
 	}
 
+	mnt, err := c.k.VFS().MountDisconnected(ctx, creds, "", fsName, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mount %q (type: %s): %w, opts: %v", submount.mount.Destination, submount.mount.Type, err, opts)
+	}
+	log.Debugf("Created filesystem for %q, internal-options: %q", submount.mount.Destination, opts.GetFilesystemOptions.Data)
+	return mnt, nil
+}
+
+// connectSubmount connects mnt, created by newSubmount, at the destination of
+// submount. Parents of the destination must already be mounted.
+func (c *containerMounter) connectSubmount(ctx context.Context, mns *vfs.MountNamespace, creds *auth.Credentials, submount *mountInfo, mnt *vfs.Mount) error {
+	if err := c.makeMountPoint(ctx, creds, mns, submount.mount.Destination); err != nil {
+		return fmt.Errorf("creating mount point %q: %w", submount.mount.Destination, err)
+	}
+
 	root := mns.Root()
 	root.IncRef()
 	defer root.DecRef(ctx)
@@ -764,12 +917,72 @@ func (c *containerMounter) mountSubmount(ctx context.Context, conf *config.Confi
 		Start: root,
 		Path:  fspath.Parse(submount.mount.Destination),
 	}
-	mnt, err := c.k.VFS().MountAt(ctx, creds, "", target, fsName, opts)
-	if err != nil {
-		return nil, fmt.Errorf("failed to mount %q (type: %s): %w, opts: %v", submount.mount.Destination, submount.mount.Type, err, opts)
+	if err := c.k.VFS().ConnectMountAt(ctx, creds, mnt, target); err != nil {
+		return fmt.Errorf("failed to mount %q (type: %s): %w", submount.mount.Destination, submount.mount.Type, err)
 	}
-	log.Infof("Mounted %q to %q type: %s, internal-options: %q", submount.mount.Source, submount.mount.Destination, submount.mount.Type, opts.GetFilesystemOptions.Data)
-	return mnt, nil
+	c.setMountPropagation(mnt, submount.mount.Options)
+	log.Infof("Mounted %q to %q type: %s", submount.mount.Source, submount.mount.Destination, submount.mount.Type)
+	return nil
+}
+
+// shmMountOptions returns the options of m, the /dev/shm mount of spec, with
+// the size set by shmSizeAnnotation. If neither sets a size, the size of a
+// tmpfs /dev/shm is limited to the container's memory limit, since its pages
+// are charged to the memory cgroup of the tasks that allocate them.
+func shmMountOptions(spec *specs.Spec, m *specs.Mount) []string {
+	if m.Type != tmpfs.Name {
+		return m.Options
+	}
+	size, ok := spec.Annotations[shmSizeAnnotation]
+	if !ok {
+		for _, o := range m.Options {
+			if strings.HasPrefix(o, "size=") {
+				return m.Options
+			}
+		}
+		if spec.Linux == nil || spec.Linux.Resources == nil || spec.Linux.Resources.Memory == nil {
+			return m.Options
+		}
+		limit := spec.Linux.Resources.Memory.Limit
+		if limit == nil || *limit <= 0 {
+			return m.Options
+		}
+		size = strconv.FormatInt(*limit, 10)
+	}
+	// Don't modify the spec's options.
+	opts := make([]string, 0, len(m.Options)+1)
+	for _, o := range m.Options {
+		if !strings.HasPrefix(o, "size=") {
+			opts = append(opts, o)
+		}
+	}
+	return append(opts, "size="+size)
+}
+
+// cgroupCPUDefaults returns the initial values of the control files of the cpu
+// cgroup controller from the CPU resources of a container, so that the
+// in-sandbox cgroupfs reports the limits applied to the sandbox.
+func cgroupCPUDefaults(r *specs.LinuxResources) map[string]int64 {
+	if r == nil || r.CPU == nil {
+		return nil
+	}
+	defaults := make(map[string]int64)
+	if r.CPU.Period != nil && *r.CPU.Period != 0 {
+		defaults["cpu.cfs_period_us"] = int64(*r.CPU.Period)
+	}
+	if r.CPU.Quota != nil && *r.CPU.Quota != 0 {
+		defaults["cpu.cfs_quota_us"] = *r.CPU.Quota
+	}
+	if r.CPU.Burst != nil {
+		defaults["cpu.cfs_burst_us"] = int64(*r.CPU.Burst)
+	}
+	if r.CPU.Shares != nil && *r.CPU.Shares != 0 {
+		defaults["cpu.shares"] = int64(*r.CPU.Shares)
+	}
+	if r.CPU.Idle != nil {
+		defaults["cpu.idle"] = *r.CPU.Idle
+	}
+	return defaults
 }
 
 // getMountNameAndOptions retrieves the fsName, opts, and useOverlay values
@@ -783,7 +996,7 @@ func (c *containerMounter) getMountNameAndOptions(conf *config.Config, m *mountI
 
 	// Find filesystem name and FS specific data field.
 	switch m.mount.Type {
-	case devpts.Name, devtmpfs.Name, proc.Name:
+	case devpts.Name, devtmpfs.Name, mqfs.Name, proc.Name:
 		// Nothing to do.
 
 	case Nonefs:
@@ -809,9 +1022,10 @@ func (c *containerMounter) getMountNameAndOptions(conf *config.Config, m *mountI
 			// Check that an FD was provided to fails fast.
 			return "", nil, fmt.Errorf("gofer mount requires a connection FD")
 		}
-		data = goferMountData(m.fd, c.getMountAccessType(conf, m.mount, m.hint), conf)
+		data = goferMountData(m.fd, c.getMountAccessType(conf, m.mount, m.hint), m.hint, conf)
 		internalData = gofer.InternalFilesystemOptions{
 			UniqueID: m.mount.Destination,
+			Owner:    c.cid,
 		}
 
 	case cgroupfs.Name:
@@ -820,6 +1034,11 @@ func (c *containerMounter) getMountNameAndOptions(conf *config.Config, m *mountI
 		if err != nil {
 			return "", nil, err
 		}
+		if specutils.ContainsStr(m.mount.Options, "cpu") {
+			if defaults := cgroupCPUDefaults(c.resources); len(defaults) != 0 {
+				internalData = &cgroupfs.InternalData{DefaultControlValues: defaults}
+			}
+		}
 
 	default:
 		log.Warningf("ignoring unknown filesystem type %q", m.mount.Type)
@@ -853,6 +1072,8 @@ func ParseMountOptions(opts []string) *vfs.MountOptions {
 			// These use the default value and don't need to be set.
 		case "bind", "rbind":
 			// These are the same as a mount with type="bind".
+		case specutils.HostUDSAllowOption:
+			// This is enforced by the gofer.
 		default:
 			log.Warningf("ignoring unknown mount option %q", o)
 		}
@@ -1007,13 +1228,31 @@ func (c *containerMounter) mountSharedSubmount(ctx context.Context, conf *config
 		return nil, fmt.Errorf("creating mount point %q: %w", mount.Destination, err)
 	}
 
+	// Shared and slave mounts receive mount events from the other containers
+	// that share the volume. Slave mounts don't send their own events.
+	propType := vfs.PropagationTypeFromLinux(uint64(specutils.SentryPropOptionsToFlag(mount.Options)))
+	if propType == vfs.Shared || propType == vfs.Child {
+		if err := c.k.VFS().JoinPropagationGroup(source.vfsMount, newMnt, propType); err != nil {
+			return nil, fmt.Errorf("setting propagation of %q: %w", mount.Destination, err)
+		}
+	}
+
 	if err := c.k.VFS().ConnectMountAt(ctx, creds, newMnt, target); err != nil {
+		c.k.VFS().SetMountPropagation(newMnt, vfs.Private)
 		return nil, err
 	}
 	log.Infof("Mounted %q type shared bind to %q", mount.Destination, source.name)
 	return newMnt, nil
 }
 
+// setMountPropagation sets the propagation type of mnt from the propagation
+// options in opts, if any.
+func (c *containerMounter) setMountPropagation(mnt *vfs.Mount, opts []string) {
+	if flag := specutils.SentryPropOptionsToFlag(opts); flag != 0 {
+		c.k.VFS().SetMountPropagation(mnt, vfs.PropagationTypeFromLinux(uint64(flag)))
+	}
+}
+
 func (c *containerMounter) makeMountPoint(ctx context.Context, creds *auth.Credentials, mns *vfs.MountNamespace, dest string) error {
 	root := mns.Root()
 	root.IncRef()
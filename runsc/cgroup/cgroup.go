@@ -346,12 +346,22 @@ type cgroupV1 struct {
 // Returns nil otherwise. Cgroup paths are loaded based on the current process.
 // If useSystemd is true, the Cgroup will be created and managed with
 // systemd. This requires systemd (>=v244) to be running on the host and the
-// cgroup path to be in the form `slice:prefix:name`.
+// cgroup path to be in the form `slice:prefix:name`. Properties of the systemd
+// unit can be set with "org.systemd.property.<name>" annotations.
 func NewFromSpec(spec *specs.Spec, useSystemd bool) (Cgroup, error) {
 	if spec.Linux == nil || spec.Linux.CgroupsPath == "" {
 		return nil, nil
 	}
-	return NewFromPath(spec.Linux.CgroupsPath, useSystemd)
+	cg, err := NewFromPath(spec.Linux.CgroupsPath, useSystemd)
+	if err != nil {
+		return nil, err
+	}
+	if scg, ok := cg.(*cgroupSystemd); ok {
+		if err := scg.setPropertyAnnotations(spec.Annotations); err != nil {
+			return nil, err
+		}
+	}
+	return cg, nil
 }
 
 // NewFromPath creates a new Cgroup instance from the specified relative path.
@@ -401,6 +411,9 @@ func new(pid, cgroupsPath string, useSystemd bool) (Cgroup, error) {
 			return nil, err
 		}
 	} else {
+		if useSystemd {
+			log.Warningf("The systemd cgroup driver requires the cgroup v2 unified hierarchy, using cgroupfs for %q", cgroupsPath)
+		}
 		cg = &cgroupV1{
 			Name:    cgroupsPath,
 			Parents: parents,
@@ -768,6 +781,17 @@ func (*cpu) set(spec *specs.LinuxResources, path string) error {
 	if err := setOptionalValueUint(path, "cpu.cfs_period_us", spec.CPU.Period); err != nil {
 		return err
 	}
+	// Like runc, set the burst after the quota, which limits it.
+	if spec.CPU.Burst != nil {
+		if err := setValue(path, "cpu.cfs_burst_us", strconv.FormatUint(*spec.CPU.Burst, 10)); err != nil {
+			return err
+		}
+	}
+	if spec.CPU.Idle != nil {
+		if err := setValue(path, "cpu.idle", strconv.FormatInt(*spec.CPU.Idle, 10)); err != nil {
+			return err
+		}
+	}
 	if err := setOptionalValueUint(path, "cpu.rt_period_us", spec.CPU.RealtimePeriod); err != nil {
 		return err
 	}
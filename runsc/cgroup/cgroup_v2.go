@@ -331,12 +331,19 @@ func (*cpu2) generateProperties(spec *specs.LinuxResources) ([]dbus.Property, er
 		return props, nil
 	}
 	cpu := spec.CPU
-	if cpu.Shares != nil {
+	if cpu.Idle != nil && *cpu.Idle == 1 {
+		// systemd sets cpu.idle for a CPUWeight of 0, "idle".
+		props = append(props, newProp("CPUWeight", uint64(0)))
+	} else if cpu.Shares != nil {
 		weight := convertCPUSharesToCgroupV2Value(*cpu.Shares)
 		if weight != 0 {
 			props = append(props, newProp("CPUWeight", weight))
 		}
 	}
+	if cpu.Burst != nil && *cpu.Burst != 0 {
+		// systemd has no property for cpu.max.burst.
+		log.Warningf("Ignoring CPU burst of %dus: not supported with systemd", *cpu.Burst)
+	}
 	var (
 		period uint64
 		quota  int64
@@ -406,6 +413,19 @@ func (*cpu2) set(spec *specs.LinuxResources, path string) error {
 		}
 	}
 
+	// Like runc, set the burst after the quota, which limits it.
+	if spec.CPU.Burst != nil {
+		if err := setValue(path, "cpu.max.burst", strconv.FormatUint(*spec.CPU.Burst, 10)); err != nil {
+			return err
+		}
+	}
+
+	if spec.CPU.Idle != nil {
+		if err := setValue(path, "cpu.idle", strconv.FormatInt(*spec.CPU.Idle, 10)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -43,7 +43,25 @@ var (
 	ErrInvalidSlice = errors.New("invalid slice name")
 )
 
+const (
+	// defaultSlice is the slice units are created under if the cgroup path
+	// doesn't specify one, as with runc.
+	defaultSlice = "system.slice"
+
+	// propertyAnnotationPrefix is the prefix of annotations that set
+	// properties of the systemd unit, e.g.
+	// "org.systemd.property.TimeoutStopUSec", as with runc. Values use the
+	// GVariant text format, e.g. "uint64 5000000".
+	propertyAnnotationPrefix = "org.systemd.property."
+
+	// systemdTimeout is how long to wait for systemd jobs to complete.
+	systemdTimeout = 30 * time.Second
+)
+
 // cgroupSystemd represents a cgroupv2 managed by systemd.
+//
+// The cgroup is a transient scope, or a transient slice if Name ends with
+// ".slice", created under the slice Parent.
 type cgroupSystemd struct {
 	cgroupV2
 	// Name is the name of the of the systemd scope that controls the cgroups.
@@ -54,7 +72,10 @@ type cgroupSystemd struct {
 	ScopePrefix string
 
 	properties []systemdDbus.Property
-	dbusConn   *systemdDbus.Conn
+	// extraProperties are set from annotations, after and thus overriding
+	// properties derived from the spec.
+	extraProperties []systemdDbus.Property
+	dbusConn        *systemdDbus.Conn
 }
 
 func newCgroupV2Systemd(cgv2 *cgroupV2) (*cgroupSystemd, error) {
@@ -72,6 +93,17 @@ func newCgroupV2Systemd(cgv2 *cgroupV2) (*cgroupSystemd, error) {
 	cg.Parent = parts[0]
 	cg.ScopePrefix = parts[1]
 	cg.Name = parts[2]
+	if cg.Parent == "" {
+		cg.Parent = defaultSlice
+	}
+	if cg.Name == "" {
+		return nil, fmt.Errorf("%w: unit name can't be empty in %q", ErrInvalidGroupPath, cg.Path)
+	}
+	if cg.isSlice() {
+		if err := validSlice(cg.Name); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidGroupPath, err)
+		}
+	}
 	if err := validSlice(cg.Parent); err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrInvalidGroupPath, err)
 	}
@@ -92,22 +124,62 @@ func newCgroupV2Systemd(cgv2 *cgroupV2) (*cgroupSystemd, error) {
 	return cg, err
 }
 
-// Install configures the properties for a scope unit but does not start the
-// unit.
+// setPropertyAnnotations sets the unit properties requested by annotations
+// with propertyAnnotationPrefix.
+func (c *cgroupSystemd) setPropertyAnnotations(annotations map[string]string) error {
+	for key, value := range annotations {
+		name, ok := strings.CutPrefix(key, propertyAnnotationPrefix)
+		if !ok {
+			continue
+		}
+		if !validPropertyName(name) {
+			return fmt.Errorf("%w: invalid systemd property name in annotation %q", ErrBadResourceSpec, key)
+		}
+		v, err := dbus.ParseVariant(value, dbus.Signature{})
+		if err != nil {
+			return fmt.Errorf("%w: annotation %q: %v", ErrBadResourceSpec, key, err)
+		}
+		c.extraProperties = append(c.extraProperties, systemdDbus.Property{Name: name, Value: v})
+	}
+	return nil
+}
+
+// validPropertyName returns true if name is a well-formed systemd unit
+// property name.
+func validPropertyName(name string) bool {
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Install configures the properties for a scope or slice unit but does not
+// start the unit.
 func (c *cgroupSystemd) Install(res *specs.LinuxResources) error {
 	log.Debugf("Installing systemd cgroup resource controller under %v", c.Parent)
-	c.properties = append(c.properties, systemdDbus.PropSlice(c.Parent))
+	if c.isSlice() {
+		// Slices can't contain processes directly nor be delegated. The
+		// process joins the cgroup of the slice once it's started.
+		c.properties = append(c.properties, systemdDbus.PropWants(c.Parent))
+	} else {
+		c.properties = append(c.properties, systemdDbus.PropSlice(c.Parent))
+		pid := os.Getpid()
+		c.properties = append(c.properties, systemdDbus.PropPids(uint32(pid)))
+		// Delegate must be true so that the container can manage its own cgroups.
+		c.addProp("Delegate", true)
+	}
 	c.properties = append(c.properties, systemdDbus.PropDescription("Secure container "+c.Name))
-	pid := os.Getpid()
-	c.properties = append(c.properties, systemdDbus.PropPids(uint32(pid)))
 	// We always want proper accounting for the container for reporting resource
 	// usage.
 	c.addProp("MemoryAccounting", true)
 	c.addProp("CPUAccounting", true)
 	c.addProp("TasksAccounting", true)
 	c.addProp("IOAccounting", true)
-	// Delegate must be true so that the container can manage its own cgroups.
-	c.addProp("Delegate", true)
 	// For compatibility with runc.
 	c.addProp("DefaultDependencies", false)
 
@@ -135,13 +207,38 @@ func (c *cgroupSystemd) Install(res *specs.LinuxResources) error {
 			return fmt.Errorf("mandatory cgroup controller %q is missing for %q", controllerName, c.Path)
 		}
 	}
+	c.properties = append(c.properties, c.extraProperties...)
 	return nil
 }
 
+// isSlice returns true if the unit is a slice rather than a scope.
+func (c *cgroupSystemd) isSlice() bool {
+	return strings.HasSuffix(c.Name, ".slice")
+}
+
 func (c *cgroupSystemd) unitName() string {
+	if c.isSlice() {
+		return c.Name
+	}
+	if c.ScopePrefix == "" {
+		return c.Name + ".scope"
+	}
 	return fmt.Sprintf("%s-%s.scope", c.ScopePrefix, c.Name)
 }
 
+// conn returns a connection to systemd, connecting if needed, e.g. because c
+// was loaded from the container state.
+func (c *cgroupSystemd) conn(ctx context.Context) (*systemdDbus.Conn, error) {
+	if c.dbusConn == nil {
+		conn, err := systemdDbus.NewWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.dbusConn = conn
+	}
+	return c.dbusConn, nil
+}
+
 // MakePath builds a path to the given controller.
 func (c *cgroupSystemd) MakePath(string) string {
 	fullSlicePath := expandSlice(c.Parent)
@@ -149,47 +246,104 @@ func (c *cgroupSystemd) MakePath(string) string {
 	return path
 }
 
-// Join implements Cgroup.Join.
+// Join implements Cgroup.Join. The unit is started with the current process
+// in it if it doesn't exist yet, otherwise the current process joins its
+// cgroup. The returned function moves the current process back to its
+// original cgroup, leaving the unit running.
 func (c *cgroupSystemd) Join() (func(), error) {
 	log.Debugf("Joining systemd cgroup %v", c.unitName())
-	timeout := 30 * time.Second
 	ctx := context.Background()
-	// Clean up partially created cgroups on error. Errors during cleanup itself
-	// are ignored.
-	clean := cleanup.Make(func() { _ = c.Uninstall() })
-	defer clean.Clean()
 
-	conn, err := systemdDbus.NewWithContext(ctx)
+	// First save the current state so it can be restored.
+	paths, err := loadPaths("self")
+	if err != nil {
+		return nil, err
+	}
+	undoPath := filepath.Join(c.Mountpoint, paths[cgroup2Key])
+	restore := func() {
+		log.Debugf("Restoring cgroup %q", undoPath)
+		if err := setValue(undoPath, "cgroup.procs", "0"); err != nil {
+			log.Warningf("Error restoring cgroup %q: %v", undoPath, err)
+		}
+	}
+
+	conn, err := c.conn(ctx)
 	if err != nil {
 		return nil, err
 	}
-	c.dbusConn = conn
 	unitName := c.unitName()
 	statusChan := make(chan string)
-	timedCtx, cancel := context.WithTimeout(ctx, timeout)
+	timedCtx, cancel := context.WithTimeout(ctx, systemdTimeout)
 	defer cancel()
-	if _, err := c.dbusConn.StartTransientUnitContext(timedCtx, unitName, "replace", c.properties, statusChan); err == nil {
+	started := false
+	if _, err := conn.StartTransientUnitContext(timedCtx, unitName, "replace", c.properties, statusChan); err == nil {
 		s := <-statusChan
 		close(statusChan)
 		switch s {
 		case "done":
 		// All cases that are not "done" according to the dbus package.
 		case "cancelled", "timeout", "failed", "dependency", "skipped":
-			c.dbusConn.ResetFailedUnitContext(ctx, unitName)
+			conn.ResetFailedUnitContext(ctx, unitName)
 			return nil, fmt.Errorf("error creating systemd unit `%s`: got %s", unitName, s)
 		default:
-			c.dbusConn.ResetFailedUnitContext(ctx, unitName)
+			conn.ResetFailedUnitContext(ctx, unitName)
 			return nil, fmt.Errorf("unknown job completion status %q", s)
 		}
-	} else if unitAlreadyExists(err) {
-		return clean.Release(), nil
-	} else {
+		started = true
+	} else if !unitAlreadyExists(err) {
 		return nil, fmt.Errorf("systemd error: %v", err)
 	}
+
+	// Clean up the unit if it was started here and joining fails. Errors
+	// during cleanup itself are ignored.
+	clean := cleanup.Make(func() {
+		if started {
+			_ = c.Uninstall()
+		}
+	})
+	defer clean.Clean()
+
 	if _, err = c.createCgroupPaths(); err != nil {
 		return nil, err
 	}
-	return clean.Release(), nil
+	if !started || c.isSlice() {
+		// The process was not added to the unit when it was started.
+		if err := setValue(c.MakePath(""), "cgroup.procs", "0"); err != nil {
+			return nil, err
+		}
+	}
+	clean.Release()
+	return restore, nil
+}
+
+// Uninstall implements Cgroup.Uninstall. It stops the unit, which makes
+// systemd remove its cgroup.
+func (c *cgroupSystemd) Uninstall() error {
+	log.Debugf("Stopping systemd unit %v", c.unitName())
+	ctx := context.Background()
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return err
+	}
+	unitName := c.unitName()
+	statusChan := make(chan string, 1)
+	timedCtx, cancel := context.WithTimeout(ctx, systemdTimeout)
+	defer cancel()
+	if _, err := conn.StopUnitContext(timedCtx, unitName, "replace", statusChan); err == nil {
+		select {
+		case s := <-statusChan:
+			if s != "done" {
+				log.Warningf("Stopping systemd unit %q: got %s", unitName, s)
+			}
+		case <-timedCtx.Done():
+			return fmt.Errorf("timed out stopping systemd unit %q", unitName)
+		}
+	} else if !unitNotLoaded(err) {
+		return fmt.Errorf("stopping systemd unit %q: %w", unitName, err)
+	}
+	// Allow the unit name to be reused if the unit failed.
+	_ = conn.ResetFailedUnitContext(ctx, unitName)
+	return c.cgroupV2.Uninstall()
 }
 
 // unitAlreadyExists returns true if the error is that a systemd unit already
@@ -204,6 +358,16 @@ func unitAlreadyExists(err error) bool {
 	return false
 }
 
+// unitNotLoaded returns true if the error is that a systemd unit doesn't
+// exist, e.g. because it was already stopped.
+func unitNotLoaded(err error) bool {
+	var derr dbus.Error
+	if errors.As(err, &derr) {
+		return strings.Contains(derr.Name, "org.freedesktop.systemd1.NoSuchUnit")
+	}
+	return false
+}
+
 // systemd represents slice hierarchy using `-`, so we need to follow suit when
 // generating the path of slice. Essentially, test-a-b.slice becomes
 // /test.slice/test-a.slice/test-a-b.slice.
@@ -36,6 +36,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
 	"github.com/talismancer/gvisor-ligolo/runsc/config"
 	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+	"github.com/talismancer/gvisor-ligolo/runsc/hostcheck"
 	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
 	"github.com/talismancer/gvisor-ligolo/runsc/version"
 	"golang.org/x/sys/unix"
@@ -68,22 +69,29 @@ func Main() {
 
 	// Register OCI user-facing runsc commands.
 	subcommands.Register(new(cmd.Checkpoint), "")
+	subcommands.Register(new(cmd.Clone), "")
 	subcommands.Register(new(cmd.Create), "")
 	subcommands.Register(new(cmd.Delete), "")
 	subcommands.Register(new(cmd.Do), "")
+	subcommands.Register(new(cmd.EgressPolicy), "")
 	subcommands.Register(new(cmd.Events), "")
 	subcommands.Register(new(cmd.Exec), "")
+	subcommands.Register(new(cmd.Export), "")
+	subcommands.Register(new(cmd.Features), "")
 	subcommands.Register(new(cmd.Kill), "")
 	subcommands.Register(new(cmd.List), "")
+	subcommands.Register(new(cmd.Migrate), "")
 	subcommands.Register(new(cmd.PS), "")
 	subcommands.Register(new(cmd.Pause), "")
 	subcommands.Register(new(cmd.PortForward), "")
+	subcommands.Register(new(cmd.Relay), "")
 	subcommands.Register(new(cmd.Restore), "")
 	subcommands.Register(new(cmd.Resume), "")
 	subcommands.Register(new(cmd.Run), "")
 	subcommands.Register(new(cmd.Spec), "")
 	subcommands.Register(new(cmd.Start), "")
 	subcommands.Register(new(cmd.State), "")
+	subcommands.Register(new(cmd.Update), "")
 	subcommands.Register(new(cmd.Wait), "")
 
 	// Helpers.
@@ -95,6 +103,8 @@ func Main() {
 
 	const debugGroup = "debug"
 	subcommands.Register(new(cmd.Debug), debugGroup)
+	subcommands.Register(new(cmd.Fault), debugGroup)
+	subcommands.Register(new(cmd.FSFreeze), debugGroup)
 	subcommands.Register(new(cmd.Statefile), debugGroup)
 	subcommands.Register(new(cmd.Symbolize), debugGroup)
 	subcommands.Register(new(cmd.Usage), debugGroup)
@@ -247,6 +257,14 @@ func Main() {
 	log.Infof("\t\tSystemd: %v", conf.SystemdCgroup)
 	log.Infof("***************************")
 
+	// Fail early on hosts that can't run a sandbox, instead of failing deep
+	// inside sandbox creation with a cryptic error.
+	if hostcheck.Required(subcommand) && !conf.SkipHostChecks {
+		if err := hostcheck.Probe(conf); err != nil {
+			util.Fatalf("%v", err)
+		}
+	}
+
 	if conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
 		// SIGTERM is sent to all processes if a test exceeds its
 		// timeout and this case is handled by syscall_test_runner.
@@ -30,6 +30,7 @@ import (
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/talismancer/gvisor-ligolo/pkg/coretag"
 	"github.com/talismancer/gvisor-ligolo/pkg/cpuid"
+	"github.com/talismancer/gvisor-ligolo/pkg/fdaudit"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/metric"
 	"github.com/talismancer/gvisor-ligolo/pkg/ring0"
@@ -67,38 +68,22 @@ type Boot struct {
 	// bundleDir is the directory containing the OCI spec.
 	bundleDir string
 
-	// specFD is the file descriptor that the spec will be read from.
-	specFD int
-
-	// controllerFD is the file descriptor of a stream socket for the
-	// control server that is donated to this process.
-	controllerFD int
-
-	// deviceFD is the file descriptor for the platform device file.
-	deviceFD int
+	// fdManifestFD is the file descriptor of the manifest of the FDs donated
+	// to this process. See boot.FDManifest.
+	fdManifestFD int
 
-	// ioFDs is the list of FDs used to connect to FS gofers.
-	ioFDs intFlags
-
-	// overlayFilestoreFDs are FDs to the regular files that will back the tmpfs
-	// upper mount in the overlay mounts.
-	overlayFilestoreFDs intFlags
+	// specFD is the file descriptor that the spec will be read from. It's
+	// taken from the FD manifest.
+	specFD int
 
 	// overlayMediums contains information about how the gofer mounts have been
 	// overlaid. The first entry is for rootfs and the following entries are for
 	// bind mounts in Spec.Mounts (in the same order).
 	overlayMediums boot.OverlayMediumFlags
 
-	// stdioFDs are the fds for stdin, stdout, and stderr. They must be
-	// provided in that order.
-	stdioFDs intFlags
-
 	// passFDs are mappings of user-supplied host to guest file descriptors.
 	passFDs fdMappings
 
-	// execFD is the host file descriptor used for program execution.
-	execFD int
-
 	// applyCaps determines if capabilities defined in the spec should be applied
 	// to the process.
 	applyCaps bool
@@ -116,21 +101,16 @@ type Boot struct {
 	// totalHostMem is the total memory reported by host /proc/meminfo.
 	totalHostMem uint64
 
-	// userLogFD is the file descriptor to write user logs to.
-	userLogFD int
-
-	// startSyncFD is the file descriptor to synchronize runsc and sandbox.
+	// startSyncFD is the file descriptor to synchronize runsc and sandbox. It's
+	// taken from the FD manifest.
 	startSyncFD int
 
 	// mountsFD is the file descriptor to read list of mounts after they have
 	// been resolved (direct paths, no symlinks). They are resolved outside the
-	// sandbox (e.g. gofer) and sent through this FD.
+	// sandbox (e.g. gofer) and sent through this FD. It's taken from the FD
+	// manifest.
 	mountsFD int
 
-	podInitConfigFD int
-
-	sinkFDs intFlags
-
 	// pidns is set if the sandbox is in its own pid namespace.
 	pidns bool
 
@@ -186,20 +166,9 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&b.productName, "product-name", "", "value to show in /sys/devices/virtual/dmi/id/product_name")
 
 	// Open FDs that are donated to the sandbox.
-	f.IntVar(&b.specFD, "spec-fd", -1, "required fd with the container spec")
-	f.IntVar(&b.controllerFD, "controller-fd", -1, "required FD of a stream socket for the control server that must be donated to this process")
-	f.IntVar(&b.deviceFD, "device-fd", -1, "FD for the platform device file")
-	f.Var(&b.ioFDs, "io-fds", "list of FDs to connect gofer clients. They must follow this order: root first, then mounts as defined in the spec")
-	f.Var(&b.stdioFDs, "stdio-fds", "list of FDs containing sandbox stdin, stdout, and stderr in that order")
+	f.IntVar(&b.fdManifestFD, "fd-manifest", -1, "required FD of the manifest of the FDs donated to the sandbox")
 	f.Var(&b.passFDs, "pass-fd", "mapping of host to guest FDs. They must be in M:N format. M is the host and N the guest descriptor.")
-	f.IntVar(&b.execFD, "exec-fd", -1, "host file descriptor used for program execution.")
-	f.Var(&b.overlayFilestoreFDs, "overlay-filestore-fds", "FDs to the regular files that will back the tmpfs upper mount in the overlay mounts.")
 	f.Var(&b.overlayMediums, "overlay-mediums", "information about how the gofer mounts have been overlaid.")
-	f.IntVar(&b.userLogFD, "user-log-fd", 0, "file descriptor to write user logs to. 0 means no logging.")
-	f.IntVar(&b.startSyncFD, "start-sync-fd", -1, "required FD to used to synchronize sandbox startup")
-	f.IntVar(&b.mountsFD, "mounts-fd", -1, "mountsFD is the file descriptor to read list of mounts after they have been resolved (direct paths, no symlinks).")
-	f.IntVar(&b.podInitConfigFD, "pod-init-config-fd", -1, "file descriptor to the pod init configuration file.")
-	f.Var(&b.sinkFDs, "sink-fds", "ordered list of file descriptors to be used by the sinks defined in --pod-init-config.")
 
 	// Profiling flags.
 	b.profileFDs.SetFromFlags(f)
@@ -208,13 +177,34 @@ func (b *Boot) SetFlags(f *flag.FlagSet) {
 // Execute implements subcommands.Command.Execute.  It starts a sandbox in a
 // waiting state.
 func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
-	if b.specFD == -1 || b.controllerFD == -1 || b.startSyncFD == -1 || f.NArg() != 1 {
+	if b.fdManifestFD == -1 || f.NArg() != 1 {
 		f.Usage()
 		return subcommands.ExitUsageError
 	}
 
 	conf := args[0].(*config.Config)
 
+	// Read the FD manifest. Like specFile, fdManifestFile must be kept alive
+	// past the call to setCapsAndCallSelf, as the manifest is read again after
+	// re-executing.
+	fdManifestFile := os.NewFile(uintptr(b.fdManifestFD), "FD manifest")
+	fdManifest, err := boot.ReadFDManifest(fdManifestFile)
+	if err != nil {
+		util.Fatalf("reading FD manifest: %v", err)
+	}
+	if b.specFD, err = fdManifest.TakeOne("spec-fd"); err != nil {
+		util.Fatalf("%v", err)
+	}
+	if b.startSyncFD, err = fdManifest.TakeOne("start-sync-fd"); err != nil {
+		util.Fatalf("%v", err)
+	}
+	if b.mountsFD, err = fdManifest.TakeOne("mounts-fd"); err != nil {
+		util.Fatalf("%v", err)
+	}
+	if b.specFD == -1 || b.startSyncFD == -1 {
+		util.Fatalf("FD manifest is missing spec-fd or start-sync-fd")
+	}
+
 	// Set traceback level
 	debug.SetTraceback(conf.Traceback)
 
@@ -328,6 +318,7 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 		// the specFD, which we have passed to ourselves when
 		// re-execing.
 		runtime.KeepAlive(specFile)
+		runtime.KeepAlive(fdManifestFile)
 		panic("unreachable")
 	}
 
@@ -337,10 +328,13 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 		panic("unreachable")
 	}
 
-	// Close specFile to avoid exposing it to the sandbox.
+	// Close specFile and fdManifestFile to avoid exposing them to the sandbox.
 	if err := specFile.Close(); err != nil {
 		util.Fatalf("closing specFile: %v", err)
 	}
+	if err := fdManifestFile.Close(); err != nil {
+		util.Fatalf("closing fdManifestFile: %v", err)
+	}
 
 	// At this point we won't re-execute, so it's safe to limit via rlimits. Any
 	// limit >= 0 works. If the limit is lower than the current number of open
@@ -395,25 +389,34 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 
 	// Create the loader.
 	bootArgs := boot.Args{
-		ID:                  f.Arg(0),
-		Spec:                spec,
-		Conf:                conf,
-		ControllerFD:        b.controllerFD,
-		Device:              os.NewFile(uintptr(b.deviceFD), "platform device"),
-		GoferFDs:            b.ioFDs.GetArray(),
-		StdioFDs:            b.stdioFDs.GetArray(),
-		PassFDs:             b.passFDs.GetArray(),
-		ExecFD:              b.execFD,
-		OverlayFilestoreFDs: b.overlayFilestoreFDs.GetArray(),
-		OverlayMediums:      b.overlayMediums.GetArray(),
-		NumCPU:              b.cpuNum,
-		TotalMem:            b.totalMem,
-		TotalHostMem:        b.totalHostMem,
-		UserLogFD:           b.userLogFD,
-		ProductName:         b.productName,
-		PodInitConfigFD:     b.podInitConfigFD,
-		SinkFDs:             b.sinkFDs.GetArray(),
-		ProfileOpts:         b.profileFDs.ToOpts(),
+		ID:                   f.Arg(0),
+		Spec:                 spec,
+		Conf:                 conf,
+		ControllerFD:         -1,
+		GRPCControlFD:        -1,
+		PassFDs:              b.passFDs.GetArray(),
+		ExecFD:               -1,
+		OverlayMediums:       b.overlayMediums.GetArray(),
+		NumCPU:               b.cpuNum,
+		TotalMem:             b.totalMem,
+		TotalHostMem:         b.totalHostMem,
+		ProductName:          b.productName,
+		PodInitConfigFD:      -1,
+		AutoCheckpointDirFD:  -1,
+		CoreDumpDirFD:        -1,
+		PortReservationDirFD: -1,
+		TLSInterceptCAFD:     -1,
+		TLSInterceptRootsFD:  -1,
+		FlightRecorderFD:     -1,
+		MemoryPressureFD:     -1,
+		EntropyFD:            -1,
+		ProfileOpts:          b.profileFDs.ToOpts(),
+	}
+	if err := bootArgs.ApplyFDManifest(fdManifest); err != nil {
+		util.Fatalf("applying FD manifest: %v", err)
+	}
+	if bootArgs.ControllerFD == -1 {
+		util.Fatalf("FD manifest is missing controller-fd")
 	}
 	l, err := boot.New(bootArgs)
 	if err != nil {
@@ -449,6 +452,14 @@ func (b *Boot) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 	// Closes startSyncFile because 'l.Run()' only returns when the sandbox exits.
 	startSyncFile.Close()
 
+	// Start auditing host FDs once the FDs donated to the sandbox are set up,
+	// and before seccomp filters are installed.
+	if conf.FDAuditInterval > 0 {
+		if err := fdaudit.Start(conf.FDAuditInterval); err != nil {
+			log.Warningf("Failed to start host FD auditing: %v", err)
+		}
+	}
+
 	// Wait for the start signal from runsc.
 	l.WaitForStartSignal()
 
@@ -51,6 +51,10 @@ func (*Checkpoint) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Checkpoint) Usage() string {
 	return `checkpoint [flags] <container id> - save current state of container.
+
+With --network=host, host sockets are not saved. After restore, stream sockets
+report ECONNRESET as if the connection was reset by the peer, and other sockets
+no longer receive data. Listening sockets must be recreated by the application.
 `
 }
 
@@ -65,7 +69,7 @@ func (c *Checkpoint) SetFlags(f *flag.FlagSet) {
 }
 
 // Execute implements subcommands.Command.Execute.
-func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+func (c *Checkpoint) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
 	if f.NArg() != 1 {
 		f.Usage()
 		return subcommands.ExitUsageError
@@ -138,17 +142,17 @@ func (c *Checkpoint) Execute(_ context.Context, f *flag.FlagSet, args ...any) su
 		Spec:      spec,
 		BundleDir: bundleDir,
 	}
-	cont, err = container.New(conf, contArgs)
+	cont, err = container.New(ctx, conf, contArgs)
 	if err != nil {
 		util.Fatalf("restoring container: %v", err)
 	}
 	defer cont.Destroy()
 
-	if err := cont.Restore(conf, fullImagePath); err != nil {
+	if err := cont.Restore(ctx, conf, fullImagePath); err != nil {
 		util.Fatalf("starting container: %v", err)
 	}
 
-	ws, err := cont.Wait()
+	ws, err := cont.Wait(ctx)
 	if err != nil {
 		util.Fatalf("Error waiting for container: %v", err)
 	}
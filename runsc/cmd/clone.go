@@ -0,0 +1,217 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/subcommands"
+	"github.com/mohae/deepcopy"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/container"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+)
+
+// Clone implements subcommands.Command for the "clone" command.
+//
+// Copies don't share memory copy-on-write: restoring a sandbox copies all of
+// its memory from the image into its own memory file, which is mapped shared
+// into application address spaces and so can't be backed by pages of another
+// sandbox.
+type Clone struct {
+	imagePath    string
+	count        int
+	idPrefix     string
+	netns        string
+	leaveRunning bool
+}
+
+// Name implements subcommands.Command.Name.
+func (*Clone) Name() string {
+	return "clone"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Clone) Synopsis() string {
+	return "checkpoint a running sandbox and restore it into new sandboxes (experimental)"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Clone) Usage() string {
+	return `clone [flags] <container id> - checkpoint a running sandbox and create N copies of it.
+
+The sandbox is checkpointed to the image path, and each copy is restored from
+the same image with its own container ID. The hostname of each copy is
+suffixed with the copy index.
+
+Memory isn't shared copy-on-write between copies: each copy loads all of the
+memory of the original sandbox from the image, so N copies use N times its
+memory, and take as long to start as a restore.
+
+Copies get their network interfaces, and so their MAC and IP addresses, from
+the network namespace they are created in, see -netns. -netns is required if
+the spec joins an existing network namespace, as copies would otherwise share
+the interfaces of the original container.
+
+The IDs of the new containers are printed to stdout, one per line.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (c *Clone) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.imagePath, "image-path", "", "directory path to save the sandbox image to")
+	f.IntVar(&c.count, "count", 1, "number of copies to create")
+	f.StringVar(&c.idPrefix, "id-prefix", "", "prefix for the container ID of the copies, followed by the copy index. Defaults to '<container id>-clone-'")
+	f.StringVar(&c.netns, "netns", "", "comma-separated list of network namespace paths, one per copy. If empty, copies use the network namespace of the spec")
+	f.BoolVar(&c.leaveRunning, "leave-running", true, "restore the original container after checkpointing")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (c *Clone) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	if conf.Rootless {
+		return util.Errorf("Rootless mode not supported with %q", c.Name())
+	}
+	if c.imagePath == "" {
+		return util.Errorf("image-path flag must be provided")
+	}
+	if c.count < 1 {
+		return util.Errorf("count must be at least 1, got %d", c.count)
+	}
+	var netns []string
+	if c.netns != "" {
+		netns = strings.Split(c.netns, ",")
+		if len(netns) != c.count {
+			return util.Errorf("netns must contain exactly %d paths, got %d", c.count, len(netns))
+		}
+	}
+	idPrefix := c.idPrefix
+	if idPrefix == "" {
+		idPrefix = id + "-clone-"
+	}
+
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		return util.Errorf("loading container: %v", err)
+	}
+	if !cont.IsSandboxRoot() {
+		return util.Errorf("only the root container of a sandbox can be cloned")
+	}
+	bundleDir := cont.BundleDir
+	if bundleDir == "" {
+		return util.Errorf("container %q has no bundle directory", id)
+	}
+	spec, err := specutils.ReadSpec(bundleDir, conf)
+	if err != nil {
+		return util.Errorf("reading spec: %v", err)
+	}
+
+	if netns == nil && conf.Network == config.NetworkSandbox {
+		if ns, ok := specutils.GetNS(specs.NetworkNamespace, spec); ok && ns.Path != "" {
+			return util.Errorf("copies would share the network namespace %q, and so the MAC and IP addresses, of the original container; set -netns", ns.Path)
+		}
+	}
+
+	if err := os.MkdirAll(c.imagePath, 0755); err != nil {
+		return util.Errorf("making directories at path provided: %v", err)
+	}
+	imageFile := filepath.Join(c.imagePath, checkpointFileName)
+	file, err := os.OpenFile(imageFile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if err != nil {
+		return util.Errorf("os.OpenFile(%q) failed: %v", imageFile, err)
+	}
+	err = cont.Checkpoint(file)
+	file.Close()
+	if err != nil {
+		return util.Errorf("checkpoint failed: %v", err)
+	}
+
+	// The sandbox exits after a successful checkpoint.
+	if err := cont.Destroy(); err != nil {
+		return util.Errorf("destroying container: %v", err)
+	}
+	if c.leaveRunning {
+		if err := restoreDetached(ctx, conf, id, spec, bundleDir, imageFile); err != nil {
+			return util.Errorf("restoring original container: %v", err)
+		}
+	}
+
+	for i := 0; i < c.count; i++ {
+		cloneID := fmt.Sprintf("%s%d", idPrefix, i)
+		cloneSpec := deepcopy.Copy(spec).(*specs.Spec)
+		if cloneSpec.Hostname != "" {
+			cloneSpec.Hostname = fmt.Sprintf("%s-%d", cloneSpec.Hostname, i)
+		}
+		if netns != nil {
+			setNetworkNamespacePath(cloneSpec, netns[i])
+		}
+		if err := restoreDetached(ctx, conf, cloneID, cloneSpec, bundleDir, imageFile); err != nil {
+			return util.Errorf("restoring copy %q: %v", cloneID, err)
+		}
+		fmt.Println(cloneID)
+	}
+	return subcommands.ExitSuccess
+}
+
+// restoreDetached creates a new container with the given spec and restores it
+// from imageFile without waiting for it to exit.
+func restoreDetached(ctx context.Context, conf *config.Config, id string, spec *specs.Spec, bundleDir, imageFile string) error {
+	log.Debugf("Restore container, cid: %s, image: %q", id, imageFile)
+	cont, err := container.New(ctx, conf, container.Args{
+		ID:        id,
+		Spec:      spec,
+		BundleDir: bundleDir,
+	})
+	if err != nil {
+		return fmt.Errorf("creating container: %w", err)
+	}
+	if err := cont.Restore(ctx, conf, imageFile); err != nil {
+		cont.Destroy()
+		return err
+	}
+	return nil
+}
+
+// setNetworkNamespacePath makes the spec join the network namespace at path.
+func setNetworkNamespacePath(spec *specs.Spec, path string) {
+	if spec.Linux == nil {
+		spec.Linux = &specs.Linux{}
+	}
+	for i, ns := range spec.Linux.Namespaces {
+		if ns.Type == specs.NetworkNamespace {
+			spec.Linux.Namespaces[i].Path = path
+			return
+		}
+	}
+	spec.Linux.Namespaces = append(spec.Linux.Namespaces, specs.LinuxNamespace{
+		Type: specs.NetworkNamespace,
+		Path: path,
+	})
+}
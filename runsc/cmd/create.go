@@ -16,6 +16,8 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"os"
 
 	"github.com/google/subcommands"
 	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
@@ -48,6 +50,10 @@ type Create struct {
 	// container, e.g. unsupported syscalls, while the later is more verbose and
 	// consumed by developers.
 	userLog string
+
+	// dryRun validates the container configuration and prints what would be
+	// done to create it, without creating it.
+	dryRun bool
 }
 
 // Name implements subcommands.Command.Name.
@@ -63,6 +69,10 @@ func (*Create) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Create) Usage() string {
 	return `create [flags] <container id> - create a secure container
+
+With --dry-run, the spec, platform, cgroup and mounts are validated, and the
+plan to create the container is printed in JSON format: namespaces, mounts and
+FDs donated to the sandbox. Nothing is created, and no process is started.
 `
 }
 
@@ -72,10 +82,11 @@ func (c *Create) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.consoleSocket, "console-socket", "", "path to an AF_UNIX socket which will receive a file descriptor referencing the master end of the console's pseudoterminal")
 	f.StringVar(&c.pidFile, "pid-file", "", "filename that the container pid will be written to")
 	f.StringVar(&c.userLog, "user-log", "", "filename to send user-visible logs to. Empty means no logging.")
+	f.BoolVar(&c.dryRun, "dry-run", false, "validate the container configuration and print the plan to create it, without creating it")
 }
 
 // Execute implements subcommands.Command.Execute.
-func (c *Create) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+func (c *Create) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
 	if f.NArg() != 1 {
 		f.Usage()
 		return subcommands.ExitUsageError
@@ -109,7 +120,19 @@ func (c *Create) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcom
 		PIDFile:       c.pidFile,
 		UserLog:       c.userLog,
 	}
-	if _, err := container.New(conf, contArgs); err != nil {
+	if c.dryRun {
+		plan, err := container.Plan(conf, contArgs)
+		if err != nil {
+			return util.Errorf("planning container: %v", err)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		if err := enc.Encode(plan); err != nil {
+			return util.Errorf("marshaling plan: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+	if _, err := container.New(ctx, conf, contArgs); err != nil {
 		return util.Errorf("creating container: %v", err)
 	}
 	return subcommands.ExitSuccess
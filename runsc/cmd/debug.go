@@ -16,14 +16,19 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net"
 	"os"
 	"os/signal"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/subcommands"
+	"github.com/talismancer/gvisor-ligolo/pkg/fdaudit"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/control"
 	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
@@ -37,6 +42,11 @@ import (
 type Debug struct {
 	pid          int
 	stacks       bool
+	hostFDs      bool
+	threads      bool
+	network      bool
+	startup      bool
+	tunables     bool
 	signal       int
 	profileBlock string
 	profileCPU   string
@@ -49,6 +59,8 @@ type Debug struct {
 	delay        time.Duration
 	duration     time.Duration
 	ps           bool
+	gdbPID       int
+	gdbListen    string
 }
 
 // Name implements subcommands.Command.
@@ -70,6 +82,11 @@ func (*Debug) Usage() string {
 func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&d.pid, "pid", 0, "sandbox process ID. Container ID is not necessary if this is set")
 	f.BoolVar(&d.stacks, "stacks", false, "if true, dumps all sandbox stacks to the log")
+	f.BoolVar(&d.hostFDs, "host-fds", false, "if true, dumps the host FD table of the sandbox process, annotated by the subsystem holding each FD")
+	f.BoolVar(&d.network, "network", false, "if true, dumps the routes, neighbors and endpoints of the sandbox network stack as JSON")
+	f.BoolVar(&d.startup, "startup-report", false, "if true, dumps the duration of each sandbox startup phase as JSON")
+	f.BoolVar(&d.tunables, "tunables", false, "if true, dumps the values of the knobs that can be set with --sentry-tunables")
+	f.BoolVar(&d.threads, "threads", false, "if true, dumps the state of guest threads. With --stacks, the sentry stack of each thread is included")
 	f.StringVar(&d.profileBlock, "profile-block", "", "writes block profile to the given file.")
 	f.StringVar(&d.profileCPU, "profile-cpu", "", "writes CPU profile to the given file.")
 	f.StringVar(&d.profileHeap, "profile-heap", "", "writes heap profile to the given file.")
@@ -82,6 +99,8 @@ func (d *Debug) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&d.logLevel, "log-level", "", "The log level to set: warning (0), info (1), or debug (2).")
 	f.StringVar(&d.logPackets, "log-packets", "", "A boolean value to enable or disable packet logging: true or false.")
 	f.BoolVar(&d.ps, "ps", false, "lists processes")
+	f.IntVar(&d.gdbPID, "gdb-pid", 0, "attaches a gdb remote stub to the process with the given PID (as shown by --ps) and waits for gdb to connect to --gdb-listen")
+	f.StringVar(&d.gdbListen, "gdb-listen", "localhost:1234", "TCP address to wait for gdb on when --gdb-pid is set")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -156,6 +175,67 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		}
 		util.Infof("     *** Stack dump ***\n%s", stacks)
 	}
+	if d.hostFDs {
+		util.Infof("Retrieving sandbox host FDs")
+		entries, err := c.Sandbox.HostFDs()
+		if err != nil {
+			return util.Errorf("retrieving host FDs: %v", err)
+		}
+		util.Infof("     *** Host FDs (%s) ***\n%s", fdaudit.Summary(entries), fdaudit.Format(entries))
+	}
+	if d.threads {
+		util.Infof("Retrieving guest threads")
+		threads, err := c.Sandbox.Threads(d.stacks)
+		if err != nil {
+			return util.Errorf("retrieving threads: %v", err)
+		}
+		var b strings.Builder
+		for _, t := range threads {
+			writeThreadState(&b, t)
+		}
+		util.Infof("     *** Guest threads ***\n%s", b.String())
+	}
+	if d.network {
+		util.Infof("Retrieving network state")
+		dump, err := c.Sandbox.NetworkDump()
+		if err != nil {
+			return util.Errorf("retrieving network state: %v", err)
+		}
+		out, err := json.MarshalIndent(dump, "", "  ")
+		if err != nil {
+			return util.Errorf("marshaling network state: %v", err)
+		}
+		util.Infof("     *** Network state ***\n%s", out)
+	}
+	if d.startup {
+		util.Infof("Retrieving startup report")
+		report, err := c.Sandbox.StartupReport()
+		if err != nil {
+			return util.Errorf("retrieving startup report: %v", err)
+		}
+		out, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return util.Errorf("marshaling startup report: %v", err)
+		}
+		util.Infof("     *** Startup report ***\n%s", out)
+	}
+	if d.tunables {
+		util.Infof("Retrieving sentry tunables")
+		vals, err := c.Sandbox.Tunables()
+		if err != nil {
+			return util.Errorf("retrieving sentry tunables: %v", err)
+		}
+		keys := make([]string, 0, len(vals))
+		for key := range vals {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var b strings.Builder
+		for _, key := range keys {
+			fmt.Fprintf(&b, "%s=%s\n", key, vals[key])
+		}
+		util.Infof("     *** Sentry tunables ***\n%s", b.String())
+	}
 	if d.strace != "" || len(d.logLevel) != 0 || len(d.logPackets) != 0 {
 		args := control.LoggingArgs{}
 		switch strings.ToLower(d.strace) {
@@ -224,6 +304,16 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		}
 		util.Infof("%s", o)
 	}
+	if d.gdbPID != 0 {
+		// With --pid, the process may belong to any container.
+		var cid string
+		if d.pid == 0 {
+			cid = c.ID
+		}
+		if err := attachGDB(c, cid, d.gdbPID, d.gdbListen); err != nil {
+			return util.Errorf("attaching gdb: %v", err)
+		}
+	}
 
 	// Open profiling files.
 	var (
@@ -379,3 +469,57 @@ func (d *Debug) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 
 	return subcommands.ExitSuccess
 }
+
+// attachGDB waits for gdb to connect to listenAddr, and hands the connection
+// to a gdb stub attached to the process with the given PID.
+func attachGDB(c *container.Container, cid string, pid int, listenAddr string) error {
+	l, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	util.Infof("Waiting for gdb on %s, connect with: target remote %s", l.Addr(), l.Addr())
+	conn, err := l.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	f, err := conn.(*net.TCPConn).File()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := c.Sandbox.AttachGDB(cid, int32(pid), f); err != nil {
+		return err
+	}
+	util.Infof("gdb attached to PID %d", pid)
+	return nil
+}
+
+// writeThreadState writes a human readable description of t to b.
+func writeThreadState(b *strings.Builder, t *control.ThreadState) {
+	fmt.Fprintf(b, "PID %d TID %d %q", t.PID, t.TID, t.Name)
+	if t.ContainerID != "" {
+		fmt.Fprintf(b, " container %q", t.ContainerID)
+	}
+	fmt.Fprintf(b, ": %s", t.State)
+	if t.Syscall != "" {
+		args := make([]string, 0, len(t.Args))
+		for _, a := range t.Args {
+			args = append(args, fmt.Sprintf("%#x", a))
+		}
+		fmt.Fprintf(b, " in %s(%s)", t.Syscall, strings.Join(args, ", "))
+	}
+	if t.UserPC != 0 {
+		fmt.Fprintf(b, " pc=%#x sp=%#x", t.UserPC, t.UserSP)
+	}
+	if t.WaitChannel != "" {
+		fmt.Fprintf(b, " wchan=%s", t.WaitChannel)
+	}
+	b.WriteString("\n")
+	if t.Stack != "" {
+		for _, line := range strings.Split(t.Stack, "\n") {
+			fmt.Fprintf(b, "    %s\n", line)
+		}
+	}
+}
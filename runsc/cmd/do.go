@@ -125,7 +125,7 @@ func (c *Do) SetFlags(f *flag.FlagSet) {
 }
 
 // Execute implements subcommands.Command.Execute.
-func (c *Do) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+func (c *Do) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
 	if len(f.Args()) == 0 {
 		f.Usage()
 		return subcommands.ExitUsageError
@@ -208,7 +208,7 @@ func (c *Do) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommand
 		}
 	}
 
-	return startContainerAndWait(spec, conf, cid, waitStatus)
+	return startContainerAndWait(ctx, spec, conf, cid, waitStatus)
 }
 
 func addNamespace(spec *specs.Spec, ns specs.LinuxNamespace) {
@@ -407,7 +407,7 @@ func calculatePeerIP(ip string) (string, error) {
 	return fmt.Sprintf("%s.%s.%s.%d", parts[0], parts[1], parts[2], n), nil
 }
 
-func startContainerAndWait(spec *specs.Spec, conf *config.Config, cid string, waitStatus *unix.WaitStatus) subcommands.ExitStatus {
+func startContainerAndWait(ctx context.Context, spec *specs.Spec, conf *config.Config, cid string, waitStatus *unix.WaitStatus) subcommands.ExitStatus {
 	specutils.LogSpecDebug(spec, conf.OCISeccomp)
 
 	out, err := json.Marshal(spec)
@@ -435,13 +435,13 @@ func startContainerAndWait(spec *specs.Spec, conf *config.Config, cid string, wa
 		Attached:  true,
 	}
 
-	ct, err := container.New(conf, containerArgs)
+	ct, err := container.New(ctx, conf, containerArgs)
 	if err != nil {
 		return util.Errorf("creating container: %v", err)
 	}
 	defer ct.Destroy()
 
-	if err := ct.Start(conf); err != nil {
+	if err := ct.Start(ctx, conf); err != nil {
 		return util.Errorf("starting container: %v", err)
 	}
 
@@ -453,7 +453,7 @@ func startContainerAndWait(spec *specs.Spec, conf *config.Config, cid string, wa
 	stopForwarding := ct.ForwardSignals(0 /* pid */, spec.Process.Terminal /* fgProcess */)
 	defer stopForwarding()
 
-	ws, err := ct.Wait()
+	ws, err := ct.Wait(ctx)
 	if err != nil {
 		return util.Errorf("waiting for container: %v", err)
 	}
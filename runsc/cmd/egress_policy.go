@@ -0,0 +1,117 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/talismancer/gvisor-ligolo/runsc/boot"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/container"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+)
+
+// EgressPolicy implements subcommands.Command for the "egress-policy" command.
+type EgressPolicy struct {
+	policy string
+	clear  bool
+}
+
+// Name implements subcommands.Command.
+func (*EgressPolicy) Name() string {
+	return "egress-policy"
+}
+
+// Synopsis implements subcommands.Command.
+func (*EgressPolicy) Synopsis() string {
+	return "replaces the egress policy of a running sandbox"
+}
+
+// Usage implements subcommands.Command.
+func (*EgressPolicy) Usage() string {
+	return `egress-policy [flags] <container id>
+
+Replaces the policy restricting the destinations applications of the sandbox
+can connect or send datagrams to. The policy is JSON, in the format of the
+"egress" field of the pod init config, e.g.:
+
+  {
+    "allow": [
+      {"cidr": "10.0.0.0/8", "ports": ["443"], "protocol": "tcp"},
+      {"host": "api.example.com", "ports": ["443"]}
+    ],
+    "deny": [{"cidr": "10.0.0.1"}],
+    "resolver": "10.0.0.53:53"
+  }
+
+It applies to connections made afterwards. Requires --network=sandbox.
+
+Example:
+  runsc egress-policy -policy=policy.json <id>
+  runsc egress-policy -clear <id>
+`
+}
+
+// SetFlags implements subcommands.Command.
+func (e *EgressPolicy) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&e.policy, "policy", "", `file containing the policy, or "-" for stdin.`)
+	fs.BoolVar(&e.clear, "clear", false, "lifts egress restrictions.")
+}
+
+// Execute implements subcommands.Command.
+func (e *EgressPolicy) Execute(_ context.Context, fs *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if fs.NArg() != 1 || (e.policy == "") == !e.clear {
+		fs.Usage()
+		return subcommands.ExitUsageError
+	}
+	id := fs.Arg(0)
+	conf := args[0].(*config.Config)
+
+	var policy *boot.EgressPolicy
+	if !e.clear {
+		var r io.Reader = os.Stdin
+		if e.policy != "-" {
+			f, err := os.Open(e.policy)
+			if err != nil {
+				util.Fatalf("opening policy: %v", err)
+			}
+			defer f.Close()
+			r = f
+		}
+		policy = &boot.EgressPolicy{}
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(policy); err != nil {
+			util.Fatalf("decoding policy: %v", err)
+		}
+	}
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if !c.IsSandboxRunning() {
+		util.Fatalf("container sandbox is not running")
+	}
+	if err := c.Sandbox.SetEgressPolicy(policy); err != nil {
+		util.Fatalf("%v", err)
+	}
+	return subcommands.ExitSuccess
+}
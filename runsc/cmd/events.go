@@ -22,6 +22,7 @@ import (
 
 	"github.com/google/subcommands"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/runsc/boot"
 	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
 	"github.com/talismancer/gvisor-ligolo/runsc/config"
 	"github.com/talismancer/gvisor-ligolo/runsc/container"
@@ -34,6 +35,9 @@ type Events struct {
 	intervalSec int
 	// If true, events will print a single group of stats and exit.
 	stats bool
+	// If true, the sandbox pushes stats when they change instead of being
+	// polled.
+	stream bool
 }
 
 // Name implements subcommands.Command.Name.
@@ -55,6 +59,11 @@ Where "<container-id>" is the name for the instance of the container.
 The events command displays information about the container. By default the
 information is displayed once every 5 seconds.
 
+With --stream, the sandbox collects stats at each interval and pushes them over
+the control connection only when they changed, so idle containers produce no
+output. Events are printed as newline-delimited JSON until the container is
+destroyed.
+
 OPTIONS:
 `
 }
@@ -63,6 +72,7 @@ OPTIONS:
 func (evs *Events) SetFlags(f *flag.FlagSet) {
 	f.IntVar(&evs.intervalSec, "interval", 5, "set the stats collection interval, in seconds")
 	f.BoolVar(&evs.stats, "stats", false, "display the container's stats then exit")
+	f.BoolVar(&evs.stream, "stream", false, "have the sandbox push the container's stats when they change, instead of polling them")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -75,11 +85,32 @@ func (evs *Events) Execute(_ context.Context, f *flag.FlagSet, args ...any) subc
 	id := f.Arg(0)
 	conf := args[0].(*config.Config)
 
+	if evs.stream {
+		if evs.stats {
+			util.Fatalf("--stream and --stats are mutually exclusive")
+		}
+		if evs.intervalSec <= 0 {
+			util.Fatalf("--stream requires a positive interval, got %d", evs.intervalSec)
+		}
+	}
+
 	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
 	if err != nil {
 		util.Fatalf("loading sandbox: %v", err)
 	}
 
+	if evs.stream {
+		enc := json.NewEncoder(os.Stdout)
+		err := c.StreamEvents(time.Duration(evs.intervalSec)*time.Second, func(ev *boot.EventOut) error {
+			log.Debugf("Events: %+v", ev)
+			return enc.Encode(ev.Event)
+		})
+		if err != nil {
+			util.Fatalf("streaming events: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+
 	// Repeatedly get stats from the container. Sleep a bit after every loop
 	// except the first one.
 	for dur := time.Duration(evs.intervalSec) * time.Second; true; time.Sleep(dur) {
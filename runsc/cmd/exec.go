@@ -113,7 +113,7 @@ func (ex *Exec) SetFlags(f *flag.FlagSet) {
 
 // Execute implements subcommands.Command.Execute. It starts a process in an
 // already created container.
-func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+func (ex *Exec) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
 	conf := args[0].(*config.Config)
 	e, id, err := ex.parseArgs(f, conf.EnableRaw)
 	if err != nil {
@@ -157,6 +157,9 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 
 	// Add custom file descriptors to the map.
 	for _, mapping := range ex.passFDs {
+		if mapping.Address != "" {
+			util.Fatalf("listen addresses of passed file descriptors are only supported by run")
+		}
 		file := os.NewFile(uintptr(mapping.Host), "")
 		if file == nil {
 			util.Fatalf("failed to create file from file descriptor %d", mapping.Host)
@@ -192,10 +195,10 @@ func (ex *Exec) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 	if ex.detach {
 		return ex.execChildAndWait(waitStatus)
 	}
-	return ex.exec(conf, c, e, waitStatus)
+	return ex.exec(ctx, conf, c, e, waitStatus)
 }
 
-func (ex *Exec) exec(conf *config.Config, c *container.Container, e *control.ExecArgs, waitStatus *unix.WaitStatus) subcommands.ExitStatus {
+func (ex *Exec) exec(ctx context.Context, conf *config.Config, c *container.Container, e *control.ExecArgs, waitStatus *unix.WaitStatus) subcommands.ExitStatus {
 	// Start the new process and get its pid.
 	pid, err := c.Execute(conf, e)
 	if err != nil {
@@ -227,7 +230,7 @@ func (ex *Exec) exec(conf *config.Config, c *container.Container, e *control.Exe
 	}
 
 	// Wait for the process to exit.
-	ws, err := c.WaitPID(pid)
+	ws, err := c.WaitPID(ctx, pid)
 	if err != nil {
 		return util.Errorf("waiting on pid %d: %v", pid, err)
 	}
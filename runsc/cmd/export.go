@@ -0,0 +1,95 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/container"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+)
+
+// Export implements subcommands.Command for the "export" command.
+type Export struct {
+	output string
+}
+
+// Name implements subcommands.Command.
+func (*Export) Name() string {
+	return "export"
+}
+
+// Synopsis implements subcommands.Command.
+func (*Export) Synopsis() string {
+	return "writes the changes made to the root filesystem of a container as a tar archive"
+}
+
+// Usage implements subcommands.Command.
+func (*Export) Usage() string {
+	return `export [flags] <container id>
+
+Writes the files changed in the root filesystem of a container, i.e. the upper
+layer of its overlay, as a tar archive in the format of OCI image layers, with
+deleted files represented by whiteouts. The root filesystem must be overlaid
+(see --overlay2). The container may have stopped, as long as it hasn't been
+deleted; pause running containers to get a consistent archive.
+
+Example:
+  runsc export -output=layer.tar <id>
+`
+}
+
+// SetFlags implements subcommands.Command.
+func (e *Export) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&e.output, "output", "", "file to write the archive to. Defaults to stdout.")
+}
+
+// Execute implements subcommands.Command.
+func (e *Export) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if !c.IsSandboxRunning() {
+		util.Fatalf("container sandbox is not running")
+	}
+
+	out := os.Stdout
+	if e.output != "" {
+		out, err = os.OpenFile(e.output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			util.Fatalf("creating output file: %v", err)
+		}
+		defer out.Close()
+	}
+	if err := c.Sandbox.ExportRootfs(c.ID, out); err != nil {
+		if e.output != "" {
+			_ = os.Remove(e.output)
+		}
+		util.Fatalf("%v", err)
+	}
+	return subcommands.ExitSuccess
+}
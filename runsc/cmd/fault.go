@@ -0,0 +1,169 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/subcommands"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/faultinject"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/container"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+	"golang.org/x/sys/unix"
+)
+
+// Fault implements subcommands.Command for the "fault" command.
+type Fault struct {
+	add         string
+	point       string
+	path        string
+	probability float64
+	errno       string
+	delay       time.Duration
+	count       uint64
+	remove      string
+	clear       bool
+	list        bool
+}
+
+// Name implements subcommands.Command.
+func (*Fault) Name() string {
+	return "fault"
+}
+
+// Synopsis implements subcommands.Command.
+func (*Fault) Synopsis() string {
+	return "manages fault injection rules in a running sandbox"
+}
+
+// Usage implements subcommands.Command.
+func (*Fault) Usage() string {
+	var b strings.Builder
+	b.WriteString(`fault [flags] <container id>
+
+Installs rules that make filesystem or network operations inside the sandbox
+fail or slow down. Supported injection points:
+`)
+	for _, p := range faultinject.Points {
+		fmt.Fprintf(&b, "  %s\n", p)
+	}
+	b.WriteString(`
+Example:
+  runsc fault -add=slow-etc -point=gofer.* -path=/etc/* -delay=100ms <id>
+  runsc fault -add=flaky-net -point=net.send -errno=ECONNRESET -probability=0.1 <id>
+`)
+	return b.String()
+}
+
+// SetFlags implements subcommands.Command.
+func (f *Fault) SetFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.add, "add", "", "name of the rule to add or replace.")
+	fs.StringVar(&f.point, "point", "", "glob matching injection points, e.g. gofer.* or net.connect.")
+	fs.StringVar(&f.path, "path", "", "glob matching file paths or remote addresses. Empty matches everything.")
+	fs.Float64Var(&f.probability, "probability", 1, "probability in (0, 1] that a matching operation is affected.")
+	fs.StringVar(&f.errno, "errno", "", "error to return, by name (e.g. EIO) or number.")
+	fs.DurationVar(&f.delay, "delay", 0, "latency to add to matching operations.")
+	fs.Uint64Var(&f.count, "count", 0, "maximum number of times the rule fires. 0 means unlimited.")
+	fs.StringVar(&f.remove, "remove", "", "name of the rule to remove.")
+	fs.BoolVar(&f.clear, "clear", false, "removes all rules.")
+	fs.BoolVar(&f.list, "list", false, "lists installed rules in JSON format.")
+}
+
+// Execute implements subcommands.Command.
+func (f *Fault) Execute(_ context.Context, fs *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return subcommands.ExitUsageError
+	}
+	id := fs.Arg(0)
+	conf := args[0].(*config.Config)
+
+	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if !c.IsSandboxRunning() {
+		util.Fatalf("container sandbox is not running")
+	}
+
+	if f.clear {
+		if err := c.Sandbox.ClearFaultRules(); err != nil {
+			util.Fatalf("%v", err)
+		}
+	}
+	if f.remove != "" {
+		if err := c.Sandbox.RemoveFaultRule(f.remove); err != nil {
+			util.Fatalf("%v", err)
+		}
+	}
+	if f.add != "" {
+		errno, err := parseErrno(f.errno)
+		if err != nil {
+			util.Fatalf("%v", err)
+		}
+		rule := faultinject.Rule{
+			Name:        f.add,
+			Point:       f.point,
+			Path:        f.path,
+			Probability: f.probability,
+			Errno:       errno,
+			Delay:       f.delay,
+			Count:       f.count,
+		}
+		if err := rule.Validate(); err != nil {
+			util.Fatalf("%v", err)
+		}
+		if err := c.Sandbox.AddFaultRule(rule); err != nil {
+			util.Fatalf("%v", err)
+		}
+	}
+	if f.list {
+		rules, err := c.Sandbox.ListFaultRules()
+		if err != nil {
+			util.Fatalf("%v", err)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(rules); err != nil {
+			util.Fatalf("encoding rules: %v", err)
+		}
+	}
+	return subcommands.ExitSuccess
+}
+
+// parseErrno parses an errno given either by name or number.
+func parseErrno(s string) (uint32, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+	name := strings.ToUpper(s)
+	for e := unix.Errno(1); e <= unix.EHWPOISON; e++ {
+		if unix.ErrnoName(e) == name {
+			return uint32(e), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid errno %q", s)
+}
@@ -41,8 +41,10 @@ func (i *fdMappings) GetArray() []boot.FDMapping {
 }
 
 // Set implements flag.Value and appends a mapping from the command line to the
-// mappings array.
+// mappings array. A mapping may be followed by "@ip:port", the address a
+// listening socket is exposed on.
 func (i *fdMappings) Set(s string) error {
+	s, addr, _ := strings.Cut(s, "@")
 	split := strings.Split(s, ":")
 	if len(split) != 2 {
 		// Split returns a slice of length 1 if its first argument does not
@@ -54,8 +56,9 @@ func (i *fdMappings) Set(s string) error {
 			return fmt.Errorf("invalid flag value: must be an integer or a mapping of format M:N")
 		}
 		*i = append(*i, boot.FDMapping{
-			Host:  fd,
-			Guest: fd,
+			Host:    fd,
+			Guest:   fd,
+			Address: addr,
 		})
 		return nil
 	}
@@ -77,8 +80,9 @@ func (i *fdMappings) Set(s string) error {
 	}
 
 	*i = append(*i, boot.FDMapping{
-		Host:  fdHost,
-		Guest: fdGuest,
+		Host:    fdHost,
+		Guest:   fdGuest,
+		Address: addr,
 	})
 	return nil
 }
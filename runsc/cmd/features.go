@@ -0,0 +1,221 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/platform"
+	"github.com/talismancer/gvisor-ligolo/runsc/cgroup"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+	"github.com/talismancer/gvisor-ligolo/runsc/version"
+	"golang.org/x/sys/unix"
+)
+
+// Features implements subcommands.Command for the "features" command.
+type Features struct{}
+
+// Name implements subcommands.Command.Name.
+func (*Features) Name() string {
+	return "features"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Features) Synopsis() string {
+	return "print the features supported by runsc in JSON format"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Features) Usage() string {
+	return `features - print the features supported by runsc in JSON format.
+
+The report includes both the features compiled into runsc and the features
+that depend on the host, e.g. the platforms that can be used. It's meant to be
+consumed by orchestrators, similarly to "runc features".
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (*Features) SetFlags(*flag.FlagSet) {}
+
+// featureReport is the output of the "features" command. Field names follow
+// the ones of "runc features" where applicable.
+type featureReport struct {
+	OCIVersionMin string         `json:"ociVersionMin"`
+	OCIVersionMax string         `json:"ociVersionMax"`
+	Linux         linuxFeatures  `json:"linux"`
+	GVisor        gvisorFeatures `json:"gvisor"`
+}
+
+type linuxFeatures struct {
+	Namespaces   []string        `json:"namespaces"`
+	Capabilities []string        `json:"capabilities"`
+	Cgroup       cgroupFeatures  `json:"cgroup"`
+	Seccomp      seccompFeatures `json:"seccomp"`
+}
+
+type cgroupFeatures struct {
+	V1      bool `json:"v1"`
+	V2      bool `json:"v2"`
+	Systemd bool `json:"systemd"`
+
+	// Host is the cgroup version mounted on the host, "v1" or "v2".
+	Host string `json:"host"`
+}
+
+type seccompFeatures struct {
+	Enabled bool     `json:"enabled"`
+	Actions []string `json:"actions"`
+}
+
+type gvisorFeatures struct {
+	Version    string            `json:"version"`
+	Platforms  []platformFeature `json:"platforms"`
+	NVProxy    hostFeature       `json:"nvproxy"`
+	XDP        hostFeature       `json:"xdp"`
+	IOUring    hostFeature       `json:"iouring"`
+	Checkpoint hostFeature       `json:"checkpoint"`
+}
+
+type platformFeature struct {
+	Name string `json:"name"`
+	hostFeature
+}
+
+// hostFeature is a feature compiled into runsc, which may need support from
+// the host to be used.
+type hostFeature struct {
+	// Available is true if the feature can be used on this host.
+	Available bool `json:"available"`
+
+	// Reason explains why the feature isn't available.
+	Reason string `json:"reason,omitempty"`
+
+	// Experimental is true if the feature isn't meant for production use.
+	Experimental bool `json:"experimental,omitempty"`
+}
+
+// Execute implements subcommands.Command.Execute.
+func (*Features) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	caps := specutils.AllCapabilities().Bounding
+	sort.Strings(caps)
+	cgroupHost := "v1"
+	if cgroup.IsOnlyV2() {
+		cgroupHost = "v2"
+	}
+	report := featureReport{
+		OCIVersionMin: "1.0.0",
+		OCIVersionMax: specs.Version,
+		Linux: linuxFeatures{
+			Namespaces: []string{
+				string(specs.CgroupNamespace),
+				string(specs.IPCNamespace),
+				string(specs.MountNamespace),
+				string(specs.NetworkNamespace),
+				string(specs.PIDNamespace),
+				string(specs.UserNamespace),
+				string(specs.UTSNamespace),
+			},
+			Capabilities: caps,
+			Cgroup: cgroupFeatures{
+				V1:      true,
+				V2:      true,
+				Systemd: true,
+				Host:    cgroupHost,
+			},
+			// Actions supported by --oci-seccomp, see runsc/specutils/seccomp.
+			Seccomp: seccompFeatures{
+				Enabled: true,
+				Actions: []string{
+					string(specs.ActAllow),
+					string(specs.ActErrno),
+					string(specs.ActKill),
+					string(specs.ActTrace),
+					string(specs.ActTrap),
+				},
+			},
+		},
+		GVisor: gvisorFeatures{
+			Version:    version.Version(),
+			Platforms:  platformFeatures(),
+			NVProxy:    deviceFeature("/dev/nvidiactl"),
+			XDP:        xdpFeature(),
+			IOUring:    hostFeature{Available: true, Experimental: true},
+			Checkpoint: hostFeature{Available: true},
+		},
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(&report); err != nil {
+		util.Fatalf("marshaling features: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// platformFeatures returns the platforms compiled into runsc, and whether
+// their device can be opened.
+func platformFeatures() []platformFeature {
+	names := platform.List()
+	sort.Strings(names)
+	var features []platformFeature
+	for _, name := range names {
+		pf := platformFeature{Name: name}
+		p, err := platform.Lookup(name)
+		if err != nil {
+			pf.Reason = err.Error()
+		} else if dev, err := p.OpenDevice(""); err != nil {
+			pf.Reason = err.Error()
+		} else {
+			if dev != nil {
+				_ = dev.Close()
+			}
+			pf.Available = true
+		}
+		features = append(features, pf)
+	}
+	return features
+}
+
+// deviceFeature returns a feature that requires the host device at path.
+func deviceFeature(path string) hostFeature {
+	if _, err := os.Stat(path); err != nil {
+		return hostFeature{Reason: err.Error()}
+	}
+	return hostFeature{Available: true}
+}
+
+// xdpFeature checks whether the host supports AF_XDP sockets, used by
+// --EXPERIMENTAL-afxdp.
+func xdpFeature() hostFeature {
+	fd, err := unix.Socket(unix.AF_XDP, unix.SOCK_RAW, 0)
+	if err != nil {
+		return hostFeature{Reason: "creating AF_XDP socket: " + err.Error(), Experimental: true}
+	}
+	_ = unix.Close(fd)
+	return hostFeature{Available: true, Experimental: true}
+}
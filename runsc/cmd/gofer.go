@@ -27,6 +27,7 @@ import (
 
 	"github.com/google/subcommands"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/pkg/fdaudit"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/unet"
 	"github.com/talismancer/gvisor-ligolo/runsc/boot"
@@ -242,6 +243,14 @@ func (g *Gofer) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		UDSCreateEnabled: conf.GetHostUDS().AllowCreate(),
 		ProfileEnabled:   len(profileOpts) > 0,
 	}
+	// Start auditing host FDs before seccomp filters are installed. FDs are
+	// listed through the /proc/self/fd FD opened above.
+	if conf.FDAuditInterval > 0 {
+		if err := fdaudit.Start(conf.FDAuditInterval); err != nil {
+			log.Warningf("Failed to start host FD auditing: %v", err)
+		}
+	}
+
 	if err := filter.Install(opts); err != nil {
 		util.Fatalf("installing seccomp filters: %v", err)
 	}
@@ -268,6 +277,7 @@ func (g *Gofer) serve(spec *specs.Spec, conf *config.Config, root string) subcom
 		// These are global options. Ignore readonly configuration, that is set on
 		// a per connection basis.
 		HostUDS:            conf.GetHostUDS(),
+		HostUDSPolicy:      fsgofer.NewUDSPolicy(conf.HostUDSAllowlist(), spec.Root.Path, spec.Mounts),
 		HostFifo:           conf.HostFifo,
 		DonateMountPointFD: conf.DirectFS,
 	})
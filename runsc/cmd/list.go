@@ -20,23 +20,32 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"sync"
 	"text/tabwriter"
 	"time"
 
 	"github.com/google/subcommands"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/runsc/boot"
 	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
 	"github.com/talismancer/gvisor-ligolo/runsc/config"
 	"github.com/talismancer/gvisor-ligolo/runsc/container"
 	"github.com/talismancer/gvisor-ligolo/runsc/flag"
 )
 
+// healthTimeout is the time given to a sandbox to respond to a health check.
+const healthTimeout = 5 * time.Second
+
 // List implements subcommands.Command for the "list" command.
 type List struct {
 	quiet   bool
 	format  string
 	sandbox bool
+	health  bool
+	usage   bool
+	byPod   bool
 }
 
 // Name implements subcommands.command.name.
@@ -57,8 +66,11 @@ func (*List) Usage() string {
 // SetFlags implements subcommands.Command.SetFlags.
 func (l *List) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&l.quiet, "quiet", false, "only list container ids")
-	f.StringVar(&l.format, "format", "text", "output format: 'text' (default) or 'json'")
+	f.StringVar(&l.format, "format", "text", "output format: 'text' (default), 'table' (with sandbox and pod details) or 'json'")
 	f.BoolVar(&l.sandbox, "sandbox", false, "limit output to sandboxes only")
+	f.BoolVar(&l.health, "health", false, "check that the control server of each sandbox responds, to detect wedged sandboxes")
+	f.BoolVar(&l.usage, "usage", false, "query the CPU and memory usage of running sandboxes")
+	f.BoolVar(&l.byPod, "by-pod", false, "with --format=json, group containers by pod and sandbox")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -105,29 +117,48 @@ func (l *List) execute(rootDir string, out io.Writer) error {
 		}
 		containers = append(containers, c)
 	}
+	sandboxes := l.querySandboxes(containers)
 
 	switch l.format {
 	case "text":
 		// Print a nice table.
 		w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
-		fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER\n")
+		fmt.Fprint(w, "ID\tPID\tSTATUS\tBUNDLE\tCREATED\tOWNER")
+		if l.health {
+			fmt.Fprint(w, "\tHEALTH")
+		}
+		fmt.Fprint(w, "\n")
 		for _, c := range containers {
-			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n",
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s",
 				c.ID,
 				c.SandboxPid(),
 				c.Status,
 				c.BundleDir,
 				c.CreatedAt.Format(time.RFC3339Nano),
 				c.Owner)
+			if l.health {
+				fmt.Fprintf(w, "\t%s", orDash(sandboxes[sandboxID(c)].Health))
+			}
+			fmt.Fprint(w, "\n")
 		}
 		_ = w.Flush()
+	case "table":
+		l.printTable(out, containers, sandboxes)
 	case "json":
-		// Print just the states.
-		var states []specs.State
-		for _, c := range containers {
-			states = append(states, c.State())
+		var v any
+		if l.byPod {
+			v = groupByPod(containers, sandboxes)
+		} else {
+			var infos []containerInfo
+			for _, c := range containers {
+				s := sandboxes[sandboxID(c)]
+				info := newContainerInfo(c, s)
+				info.Sandbox = s
+				infos = append(infos, info)
+			}
+			v = infos
 		}
-		if err := json.NewEncoder(out).Encode(states); err != nil {
+		if err := json.NewEncoder(out).Encode(v); err != nil {
 			return fmt.Errorf("marshaling container state: %w", err)
 		}
 	default:
@@ -135,3 +166,245 @@ func (l *List) execute(rootDir string, out io.Writer) error {
 	}
 	return nil
 }
+
+// printTable prints containers with the details of their sandboxes, grouped
+// by pod and sandbox.
+func (l *List) printTable(out io.Writer, containers []*container.Container, sandboxes map[string]*sandboxInfo) {
+	sorted := append([]*container.Container(nil), containers...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sandboxes[sandboxID(sorted[i])], sandboxes[sandboxID(sorted[j])]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.PodName != b.PodName {
+			return a.PodName < b.PodName
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		// The root container comes first.
+		if sorted[i].IsSandboxRoot() != sorted[j].IsSandboxRoot() {
+			return sorted[i].IsSandboxRoot()
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+
+	w := tabwriter.NewWriter(out, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "NAMESPACE\tPOD\tSANDBOX\tID\tPID\tSTATUS\tPLATFORM\tCONTROL\tCREATED")
+	if l.usage {
+		fmt.Fprint(w, "\tCPU\tMEMORY")
+	}
+	if l.health {
+		fmt.Fprint(w, "\tHEALTH")
+	}
+	fmt.Fprint(w, "\n")
+	for _, c := range sorted {
+		s := sandboxes[sandboxID(c)]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s",
+			orDash(s.Namespace),
+			orDash(s.PodName),
+			orDash(s.ID),
+			c.ID,
+			s.PID,
+			c.Status,
+			orDash(s.Platform),
+			orDash(s.ControlAddress),
+			c.CreatedAt.Format(time.RFC3339))
+		if l.usage {
+			cpu, mem := "-", "-"
+			if usage, ok := s.cpuUsage[c.ID]; ok {
+				cpu = time.Duration(usage).String()
+			}
+			if s.MemoryUsage != nil && c.IsSandboxRoot() {
+				mem = fmt.Sprintf("%dMB", *s.MemoryUsage>>20)
+			}
+			fmt.Fprintf(w, "\t%s\t%s", cpu, mem)
+		}
+		if l.health {
+			fmt.Fprintf(w, "\t%s", orDash(s.Health))
+		}
+		fmt.Fprint(w, "\n")
+	}
+	_ = w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// Health states of a sandbox.
+const (
+	healthOK           = "ok"
+	healthUnresponsive = "unresponsive"
+	healthStopped      = "stopped"
+)
+
+// sandboxInfo describes a sandbox in the output of list.
+type sandboxInfo struct {
+	ID             string `json:"id"`
+	PodName        string `json:"podName,omitempty"`
+	Namespace      string `json:"namespace,omitempty"`
+	PID            int    `json:"pid"`
+	ControlAddress string `json:"controlAddress,omitempty"`
+	Platform       string `json:"platform,omitempty"`
+
+	// Health is one of the health states above, if health was checked.
+	Health string `json:"health,omitempty"`
+
+	// Ping is the response of the sandbox to the health check, if it
+	// responded.
+	Ping *boot.PingResponse `json:"ping,omitempty"`
+
+	// MemoryUsage is the memory used by the sandbox in bytes, if usage was
+	// queried.
+	MemoryUsage *uint64 `json:"memoryUsage,omitempty"`
+
+	// Containers are the containers of the sandbox, when grouped by pod.
+	Containers []containerInfo `json:"containers,omitempty"`
+
+	// cpuUsage maps container IDs to the CPU time they used in nanoseconds, if
+	// usage was queried.
+	cpuUsage map[string]uint64
+}
+
+// containerInfo describes a container in the JSON output of list. It embeds
+// the OCI state, so that it can still be parsed as such.
+type containerInfo struct {
+	specs.State
+	SandboxID string    `json:"sandboxId"`
+	Created   time.Time `json:"created"`
+	Owner     string    `json:"owner,omitempty"`
+
+	// CPUUsage is the CPU time used by the container in nanoseconds, if usage
+	// was queried.
+	CPUUsage *uint64 `json:"cpuUsage,omitempty"`
+
+	// Sandbox describes the sandbox of the container, unless containers are
+	// grouped by pod.
+	Sandbox *sandboxInfo `json:"sandbox,omitempty"`
+}
+
+func newContainerInfo(c *container.Container, s *sandboxInfo) containerInfo {
+	info := containerInfo{
+		State:     c.State(),
+		SandboxID: s.ID,
+		Created:   c.CreatedAt,
+		Owner:     c.Owner,
+	}
+	if usage, ok := s.cpuUsage[c.ID]; ok {
+		info.CPUUsage = &usage
+	}
+	return info
+}
+
+// podInfo groups the sandboxes of a pod in the JSON output of list.
+type podInfo struct {
+	Namespace string         `json:"namespace"`
+	Name      string         `json:"name"`
+	Sandboxes []*sandboxInfo `json:"sandboxes"`
+}
+
+func groupByPod(containers []*container.Container, sandboxes map[string]*sandboxInfo) []*podInfo {
+	type podKey struct{ namespace, name string }
+	pods := make(map[podKey]*podInfo)
+	var out []*podInfo
+	added := make(map[string]bool)
+	for _, c := range containers {
+		s := sandboxes[sandboxID(c)]
+		s.Containers = append(s.Containers, newContainerInfo(c, s))
+		if added[s.ID] {
+			continue
+		}
+		added[s.ID] = true
+		key := podKey{s.Namespace, s.PodName}
+		pod, ok := pods[key]
+		if !ok {
+			pod = &podInfo{Namespace: s.Namespace, Name: s.PodName}
+			pods[key] = pod
+			out = append(out, pod)
+		}
+		pod.Sandboxes = append(pod.Sandboxes, s)
+	}
+	return out
+}
+
+func sandboxID(c *container.Container) string {
+	if c.Sandbox == nil {
+		return ""
+	}
+	return c.Sandbox.ID
+}
+
+// querySandboxes returns the sandboxes of containers by ID. Sandboxes are
+// queried concurrently if health or usage was requested, so that wedged
+// sandboxes don't add up their timeouts.
+func (l *List) querySandboxes(containers []*container.Container) map[string]*sandboxInfo {
+	sandboxes := make(map[string]*sandboxInfo)
+	var running []*container.Container
+	for _, c := range containers {
+		id := sandboxID(c)
+		if _, ok := sandboxes[id]; ok {
+			continue
+		}
+		s := &sandboxInfo{ID: id}
+		sandboxes[id] = s
+		if c.Sandbox == nil {
+			continue
+		}
+		s.PodName = c.Sandbox.PodName
+		s.Namespace = c.Sandbox.Namespace
+		s.PID = c.SandboxPid()
+		s.ControlAddress = c.Sandbox.ControlAddress
+		s.Platform = c.Sandbox.Platform
+		running = append(running, c)
+	}
+	if !l.health && !l.usage {
+		return sandboxes
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range running {
+		wg.Add(1)
+		go func(c *container.Container, s *sandboxInfo) {
+			defer wg.Done()
+			l.querySandbox(c, s)
+		}(c, sandboxes[c.Sandbox.ID])
+	}
+	wg.Wait()
+	return sandboxes
+}
+
+// querySandbox checks the health and usage of the sandbox of c. The usage is
+// only queried if the sandbox passes the health check, as those calls have no
+// timeout.
+func (l *List) querySandbox(c *container.Container, s *sandboxInfo) {
+	if !c.IsSandboxRunning() {
+		s.Health = healthStopped
+		return
+	}
+	resp, err := c.Sandbox.Ping(healthTimeout)
+	if err != nil {
+		log.Warningf("Sandbox %q is unresponsive: %v", s.ID, err)
+		s.Health = healthUnresponsive
+		return
+	}
+	s.Health = healthOK
+	s.Ping = resp
+	if !l.usage {
+		return
+	}
+
+	if ev, err := c.Sandbox.Event(s.ID); err != nil {
+		log.Warningf("Getting CPU usage of sandbox %q: %v", s.ID, err)
+	} else {
+		s.cpuUsage = ev.ContainerUsage
+	}
+	if m, err := c.Sandbox.Usage(false /* Full */); err != nil {
+		log.Warningf("Getting memory usage of sandbox %q: %v", s.ID, err)
+	} else {
+		s.MemoryUsage = &m.Total
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/pgalloc"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/container"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+	"golang.org/x/sys/unix"
+)
+
+// Migrate implements subcommands.Command for the "migrate" command.
+type Migrate struct {
+	address       string
+	precopyRounds int
+}
+
+// Name implements subcommands.Command.Name.
+func (*Migrate) Name() string {
+	return "migrate"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Migrate) Synopsis() string {
+	return "migrate a container to another host (experimental)"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Migrate) Usage() string {
+	return `migrate [flags] <container id> - migrate a container to another host.
+
+The state of the container is streamed to a "runsc restore -listen=<address>"
+process on the target host, which restores it. Memory is first copied while
+the container keeps running, in up to -precopy-rounds rounds that each copy
+the memory that changed during the previous one. The container is then
+stopped, and the rest of its state is sent along with the memory that changed
+since it was copied. The container exits once its state is sent, as after
+"runsc checkpoint".
+
+The stream is neither encrypted nor authenticated: only use it over a trusted
+network.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (m *Migrate) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&m.address, "address", "", "host:port address the target \"runsc restore -listen\" process listens on")
+	f.IntVar(&m.precopyRounds, "precopy-rounds", 3, "maximum number of rounds of memory copy while the container runs. 0 copies all memory while it's stopped")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (m *Migrate) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	if m.address == "" {
+		return util.Errorf("address flag must be provided")
+	}
+	if m.precopyRounds < 0 {
+		return util.Errorf("precopy-rounds must not be negative, got %d", m.precopyRounds)
+	}
+
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		return util.Errorf("loading container: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", m.address)
+	if err != nil {
+		return util.Errorf("connecting to %q: %v", m.address, err)
+	}
+	defer conn.Close()
+	connFile, err := conn.(*net.TCPConn).File()
+	if err != nil {
+		return util.Errorf("getting connection file: %v", err)
+	}
+	defer connFile.Close()
+	// The sandbox writes to the connection with blocking writes.
+	if err := unix.SetNonblock(int(connFile.Fd()), false); err != nil {
+		return util.Errorf("setting connection to blocking mode: %v", err)
+	}
+
+	if err := cont.Migrate(connFile, m.precopyRounds); err != nil {
+		return util.Errorf("migrate failed: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// receiveMigration waits for a "runsc migrate" connection on address. It
+// writes the state it receives to restoreFile, and returns the file holding the
+// pre-copied memory, to restore with.
+func receiveMigration(address, restoreFile string) (*os.File, error) {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	log.Infof("Waiting for migration on %s", ln.Addr())
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	log.Infof("Receiving migration from %s", conn.RemoteAddr())
+	r := bufio.NewReader(conn)
+
+	fd, err := unix.MemfdCreate("precopy", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("creating pre-copied memory file: %w", err)
+	}
+	precopy := os.NewFile(uintptr(fd), "precopy")
+	n, err := pgalloc.ReadPrecopy(r, precopy)
+	if err != nil {
+		precopy.Close()
+		return nil, fmt.Errorf("receiving pre-copied memory: %w", err)
+	}
+	log.Infof("Received %d bytes of pre-copied memory", n)
+
+	f, err := os.OpenFile(restoreFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		precopy.Close()
+		return nil, err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		precopy.Close()
+		return nil, fmt.Errorf("receiving state: %w", err)
+	}
+	return precopy, nil
+}
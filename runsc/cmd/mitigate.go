@@ -16,10 +16,12 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"runtime"
+	"strings"
 
 	"github.com/google/subcommands"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
@@ -33,6 +35,11 @@ const (
 	cpuInfo = "/proc/cpuinfo"
 	// Path to enable/disable SMT.
 	smtPath = "/sys/devices/system/cpu/smt/control"
+	// Directory holding the kernel's mitigation status of each vulnerability.
+	vulnerabilitiesPath = "/sys/devices/system/cpu/vulnerabilities"
+	// Default path of the file recording the SMT control value that was in
+	// place before SMT was disabled.
+	defaultMitigateStateFile = "/run/runsc-mitigate"
 )
 
 // Mitigate implements subcommands.Command for the "mitigate" command.
@@ -41,6 +48,10 @@ type Mitigate struct {
 	dryRun bool
 	// Reverse mitigate by turning on all CPU cores.
 	reverse bool
+	// Print a JSON report of the host's state before making changes.
+	json bool
+	// File recording the SMT control value to restore on reverse.
+	stateFile string
 	// Extra data for post mitigate operations.
 	data string
 	// Control to mitigate/reverse smt.
@@ -61,15 +72,19 @@ func (*Mitigate) Synopsis() string {
 func (m *Mitigate) Usage() string {
 	return fmt.Sprintf(`mitigate [flags]
 
-mitigate mitigates a system to the "MDS" vulnerability by writing "off" to %q. CPUs can be restored by writing "on" to the same file or rebooting your system.
+mitigate mitigates a system to vulnerabilities that leak data between hyperthreads, e.g. "MDS", "Downfall" or "Inception", by writing "off" to %q. CPUs can be restored by writing "on" to the same file or rebooting your system.
 
-The command can be reversed with --reverse, which writes "on" to the file above.%s`, smtPath, m.usage())
+The command can be reversed with --reverse, which restores the value the file had before it was mitigated, or writes "on" if it's unknown.
+
+With --json, an assessment of the host's SMT and vulnerability state, along with the action to be taken, is printed to stdout before making changes. Combine it with --dryrun to only report.%s`, smtPath, m.usage())
 }
 
 // SetFlags sets flags for the command Mitigate.
 func (m *Mitigate) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&m.dryRun, "dryrun", false, "run the command without changing system")
 	f.BoolVar(&m.reverse, "reverse", false, "reverse mitigate by enabling all CPUs")
+	f.BoolVar(&m.json, "json", false, "print a JSON report of the host's SMT and vulnerability state before making changes")
+	f.StringVar(&m.stateFile, "state-file", defaultMitigateStateFile, "file recording the SMT control value to restore with --reverse")
 	m.setFlags(f)
 }
 
@@ -98,7 +113,21 @@ func (m *Mitigate) execute() subcommands.ExitStatus {
 	}
 	log.Infof("CPUs before: %s", beforeSet.String())
 
-	if err := m.doEnableDisable(beforeSet); err != nil {
+	control, err := m.control.getControl()
+	if err != nil {
+		return util.Errorf("Reading %q failed: %v", smtPath, err)
+	}
+	value, err := m.plan(beforeSet, control)
+	if err != nil {
+		return util.Errorf("Planning mitigation failed: %v", err)
+	}
+	if m.json {
+		if err := m.printReport(beforeSet, control, value); err != nil {
+			return util.Errorf("Printing report failed: %v", err)
+		}
+	}
+
+	if err := m.doEnableDisable(control, value); err != nil {
 		return util.Errorf("Enabled/Disable action failed on %q: %v", smtPath, err)
 	}
 
@@ -115,61 +144,139 @@ func (m *Mitigate) execute() subcommands.ExitStatus {
 	return subcommands.ExitSuccess
 }
 
-// doEnableDisable does either enable or disable operation based on flags.
-func (m *Mitigate) doEnableDisable(set mitigate.CPUSet) error {
+// plan returns the value to write to the SMT control file given its current
+// value control, or an empty string if it should be left alone.
+func (m *Mitigate) plan(set mitigate.CPUSet, control string) (string, error) {
+	if control != "on" && control != "off" {
+		// There is no SMT control, or SMT can't be changed at runtime:
+		// "forceoff", "notsupported" or "notimplemented".
+		log.Infof("SMT control is %q. Skipping enable/disable.", control)
+		return "", nil
+	}
 	if m.reverse {
-		if m.dryRun {
-			log.Infof("Skipping reverse action because dryrun is set.")
-			return nil
+		value := "on"
+		if saved, err := m.savedControl(); err != nil {
+			return "", err
+		} else if saved != "" {
+			value = saved
+		}
+		if value == control {
+			return "", nil
 		}
-		return m.control.enable()
+		return value, nil
+	}
+	if !set.IsVulnerable() {
+		log.Infof("CPUs not vulnerable. Skipping disable call.")
+		return "", nil
+	}
+	if control == "off" {
+		return "", nil
+	}
+	return "off", nil
+}
+
+// doEnableDisable writes value to the SMT control file, whose current value
+// is control, unless value is empty or dryrun is set.
+func (m *Mitigate) doEnableDisable(control, value string) error {
+	if value == "" {
+		return nil
 	}
 	if m.dryRun {
-		log.Infof("Skipping mitigate action because dryrun is set.")
+		log.Infof("Skipping writing %q to %q because dryrun is set.", value, smtPath)
 		return nil
 	}
-	if set.IsVulnerable() {
-		return m.control.disable()
+	if m.reverse {
+		if err := m.control.setControl(value); err != nil {
+			return err
+		}
+		if err := os.Remove(m.stateFile); err != nil && !os.IsNotExist(err) {
+			log.Warningf("Failed to remove %q: %v", m.stateFile, err)
+		}
+		return nil
 	}
-	log.Infof("CPUs not vulnerable. Skipping disable call.")
-	return nil
+	// Record the previous value to be able to revert the mitigation. Don't
+	// overwrite an existing record, which holds the original value.
+	if saved, err := m.savedControl(); err != nil {
+		return err
+	} else if saved == "" {
+		if err := ioutil.WriteFile(m.stateFile, []byte(control), 0644); err != nil {
+			return fmt.Errorf("recording SMT control value in %q: %w", m.stateFile, err)
+		}
+	}
+	return m.control.setControl(value)
+}
+
+// savedControl returns the SMT control value recorded before SMT was
+// disabled, or an empty string if there is none.
+func (m *Mitigate) savedControl() (string, error) {
+	if m.stateFile == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(m.stateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// printReport prints a JSON assessment of the host to stdout.
+func (m *Mitigate) printReport(set mitigate.CPUSet, control, value string) error {
+	vulns, err := m.control.vulnerabilities()
+	if err != nil {
+		return err
+	}
+	report := mitigate.NewReport(set, control, vulns)
+	report.Action = "none"
+	if value != "" {
+		report.Action = value
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
 }
 
 // Interface to wrap interactions with underlying machine. Done
 // so testing with mocks can be done hermetically.
 type machineControl interface {
-	enable() error
-	disable() error
-	isEnabled() (bool, error)
+	getControl() (string, error)
+	setControl(value string) error
+	vulnerabilities() (map[string]string, error)
 	getCPUs() (mitigate.CPUSet, error)
 }
 
 // Implementation of SMT control interaction with the underlying machine.
 type machineControlImpl struct{}
 
-func (*machineControlImpl) enable() error {
-	return checkFileExistsOnWrite("enable", "on")
-}
-
-func (*machineControlImpl) disable() error {
-	return checkFileExistsOnWrite("disable", "off")
+// getControl returns the content of the SMT control file, or an empty string
+// if it doesn't exist, which is the case on machines with one thread per core.
+func (*machineControlImpl) getControl() (string, error) {
+	data, err := ioutil.ReadFile(smtPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
 }
 
 // Writes data to SMT control. If file not found, logs file not exist error and returns nil
 // error, which is done because machines without the file pointed to by smtPath only have one
 // thread per core in the first place. Otherwise returns error from ioutil.WriteFile.
-func checkFileExistsOnWrite(op, data string) error {
+func (*machineControlImpl) setControl(data string) error {
 	err := ioutil.WriteFile(smtPath, []byte(data), 0644)
-	if err != nil && os.IsExist(err) {
-		log.Infof("File %q does not exist for operation %s. This machine probably has no smt control.", smtPath, op)
+	if err != nil && os.IsNotExist(err) {
+		log.Infof("File %q does not exist for value %q. This machine probably has no smt control.", smtPath, data)
 		return nil
 	}
 	return err
 }
 
-func (*machineControlImpl) isEnabled() (bool, error) {
-	data, err := ioutil.ReadFile(cpuInfo)
-	return string(data) == "on", err
+func (*machineControlImpl) vulnerabilities() (map[string]string, error) {
+	return mitigate.ReadVulnerabilities(vulnerabilitiesPath)
 }
 
 func (*machineControlImpl) getCPUs() (mitigate.CPUSet, error) {
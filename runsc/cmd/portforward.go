@@ -143,9 +143,12 @@ func (p *PortForward) Execute(ctx context.Context, f *flag.FlagSet, args ...any)
 	go func() {
 		defer wg.Done()
 		// Cancel port forwarding after Wait returns regardless of return
-		// value as err may indicate sandbox has terminated already.
-		_, _ = c.Wait()
-		fmt.Printf("Container %q stopped. Exiting...\n", c.ID)
+		// value as err may indicate sandbox has terminated already. Wait
+		// also returns once port forwarding is canceled.
+		_, _ = c.Wait(ctx)
+		if ctx.Err() == nil {
+			fmt.Printf("Container %q stopped. Exiting...\n", c.ID)
+		}
 		cancel()
 	}()
 
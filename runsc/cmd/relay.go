@@ -0,0 +1,196 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/subcommands"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sandboxapi"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+	"github.com/talismancer/gvisor-ligolo/runsc/relay"
+)
+
+// Relay implements subcommands.Command for the "relay" command.
+type Relay struct {
+	serve      string
+	secretFile string
+	hops       string
+	control    string
+	forward    string
+}
+
+// Name implements subcommands.Command.Name.
+func (*Relay) Name() string {
+	return "relay"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Relay) Synopsis() string {
+	return "tunnel control RPCs and connections through sandboxes"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Relay) Usage() string {
+	return `relay [OPTIONS] CONTAINER_ID - tunnel control RPCs and connections through sandboxes.
+
+Relays give access to sandboxes that are only reachable from the network of
+other sandboxes. A relay listens in the network stack of a sandbox, and serves
+requests to connect to the control server of the sandbox or to an address
+through its network stack. Since that address may be another relay, relays can
+be chained.
+
+With --serve, the sandbox of CONTAINER_ID is made a relay. Otherwise, --hops
+lists the relays to go through, the first of which is reached through the
+network stack of the sandbox of CONTAINER_ID, and either --control or
+--forward selects what to do with the last one.
+
+Relays and clients authenticate each other with the secret in --secret-file,
+of at least 16 bytes, from which the keys encrypting and authenticating
+tunneled streams are also derived.
+
+EXAMPLES:
+
+Make the sandbox of container 'b' a relay on port 7000 of its network:
+
+	# runsc relay --serve=:7000 --secret-file=/etc/relay.key b
+
+Forward local port 8080 to port 80 of 10.1.0.3, reachable only from 'b', which
+is reachable at 10.0.0.2 from the network of container 'a':
+
+	# runsc relay --hops=10.0.0.2:7000 --forward=127.0.0.1:8080=10.1.0.3:80 --secret-file=/etc/relay.key a
+
+Expose the control server of the sandbox of a relay at 10.1.0.3, reached
+through 'b', on a local socket:
+
+	# runsc relay --hops=10.0.0.2:7000,10.1.0.3:7000 --control=/tmp/ctl.sock --secret-file=/etc/relay.key a
+
+OPTIONS:
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (r *Relay) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&r.serve, "serve", "", "make the sandbox a relay listening on this address in its network")
+	f.StringVar(&r.secretFile, "secret-file", "", "file holding the secret shared by relays and clients")
+	f.StringVar(&r.hops, "hops", "", "comma-separated addresses of the relays to go through")
+	f.StringVar(&r.control, "control", "", "path of a Unix domain socket to expose the control server of the last relay's sandbox on")
+	f.StringVar(&r.forward, "forward", "", "LOCAL_ADDRESS=REMOTE_ADDRESS, forward connections to a local TCP address to an address dialed by the last relay")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (r *Relay) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	conf := args[0].(*config.Config)
+
+	if r.secretFile == "" {
+		util.Fatalf("--secret-file is required")
+	}
+	secret, err := relay.ReadSecret(r.secretFile)
+	if err != nil {
+		util.Fatalf("reading secret: %v", err)
+	}
+
+	client, err := sandboxapi.New(sandboxapi.Options{Config: conf})
+	if err != nil {
+		util.Fatalf("%v", err)
+	}
+	c, err := client.Load(ctx, f.Arg(0))
+	if err != nil {
+		util.Fatalf("%v", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		sig := waitSignal()
+		fmt.Printf("Got %v, Exiting...\n", sig)
+		cancel()
+	}()
+
+	if r.serve != "" {
+		if r.hops != "" || r.control != "" || r.forward != "" {
+			util.Fatalf("--serve can't be used with --hops, --control or --forward")
+		}
+		fmt.Printf("Relaying on %s in the network of container %q...\n", r.serve, c.ID())
+		if err := c.ServeRelay(ctx, r.serve, secret); err != nil && ctx.Err() == nil {
+			util.Fatalf("serving relay: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+
+	if r.hops == "" {
+		util.Fatalf("either --serve or --hops is required")
+	}
+	var hops []relay.Hop
+	for _, addr := range strings.Split(r.hops, ",") {
+		hops = append(hops, relay.Hop{Address: addr, Secret: secret})
+	}
+
+	var l net.Listener
+	var req relay.Request
+	switch {
+	case r.control != "" && r.forward != "":
+		util.Fatalf("--control and --forward can't be used together")
+	case r.control != "":
+		req = relay.Request{Target: relay.TargetControl}
+		l, err = net.Listen("unix", r.control)
+	case r.forward != "":
+		local, remote, ok := strings.Cut(r.forward, "=")
+		if !ok {
+			util.Fatalf("invalid --forward %q, must be LOCAL_ADDRESS=REMOTE_ADDRESS", r.forward)
+		}
+		req = relay.Request{Target: relay.TargetDial, Address: remote}
+		l, err = net.Listen("tcp", local)
+	default:
+		util.Fatalf("either --control or --forward is required with --hops")
+	}
+	if err != nil {
+		util.Fatalf("listening: %v", err)
+	}
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	fmt.Printf("Tunneling connections to %s through %d relays...\n", l.Addr(), len(hops))
+	for {
+		local, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return subcommands.ExitSuccess
+			}
+			util.Fatalf("accepting connection: %v", err)
+		}
+		go func() {
+			tunnel, err := c.DialRelay(ctx, hops, req)
+			if err != nil {
+				log.Warningf("Connecting through relays: %v", err)
+				local.Close()
+				return
+			}
+			relay.Splice(local, tunnel)
+		}()
+	}
+}
@@ -16,8 +16,11 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"time"
 
 	"github.com/google/subcommands"
 	"github.com/talismancer/gvisor-ligolo/pkg/cleanup"
@@ -40,6 +43,21 @@ type Restore struct {
 
 	// detach indicates that runsc has to start a process and exit without waiting it.
 	detach bool
+
+	// envFile is the path inside the container where environment variables
+	// that changed since the checkpoint are written to.
+	envFile string
+
+	// progress indicates that the progress of the restore is printed.
+	progress bool
+
+	// intoSandbox is the ID of an idle sandbox to restore into, instead of
+	// creating a new one.
+	intoSandbox string
+
+	// listen is the address on which to receive the state from
+	// "runsc migrate", instead of reading it from image-path.
+	listen string
 }
 
 // Name implements subcommands.Command.Name.
@@ -55,6 +73,25 @@ func (*Restore) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Restore) Usage() string {
 	return `restore [flags] <container id> - restore saved state of container.
+       restore [flags] -into-sandbox=<sandbox id> - restore saved state into an idle sandbox.
+
+The spec may differ from the one the image was taken with in mount sources,
+network namespace path, hostname and environment variables. Since restored
+processes keep their environment, changed variables are written to the file
+given by -env-file.
+
+With -progress, the progress of the restore is printed to stderr. SIGINT and
+SIGTERM cancel the restore; the container must then be deleted.
+
+With -into-sandbox, the state is restored into a sandbox that was created
+beforehand, e.g. from a pool of warm sandboxes, and hasn't been started. The
+restored container takes the ID of the sandbox, whose spec must be compatible
+with the image as described above.
+
+With -listen, the state is received from "runsc migrate" on the given
+host:port address, once the sandbox is created. The state is written to
+image-path, which must not hold an image yet, and the memory that was copied
+before the migrated container stopped is held in memory until it's restored.
 `
 }
 
@@ -63,6 +100,10 @@ func (r *Restore) SetFlags(f *flag.FlagSet) {
 	r.Create.SetFlags(f)
 	f.StringVar(&r.imagePath, "image-path", "", "directory path to saved container image")
 	f.BoolVar(&r.detach, "detach", false, "detach from the container's process")
+	f.StringVar(&r.envFile, "env-file", "", "path inside the container where environment variables that differ from the checkpointed spec are written to")
+	f.BoolVar(&r.progress, "progress", false, "print the progress of the restore to stderr")
+	f.StringVar(&r.intoSandbox, "into-sandbox", "", "ID of a created, not yet started sandbox to restore into instead of creating a new one")
+	f.StringVar(&r.listen, "listen", "", "host:port address to receive the state from \"runsc migrate\" on")
 
 	// Unimplemented flags necessary for compatibility with docker.
 
@@ -74,13 +115,17 @@ func (r *Restore) SetFlags(f *flag.FlagSet) {
 }
 
 // Execute implements subcommands.Command.Execute.
-func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
-	if f.NArg() != 1 {
+func (r *Restore) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	var id string
+	switch {
+	case r.intoSandbox == "" && f.NArg() == 1:
+		id = f.Arg(0)
+	case r.intoSandbox != "" && f.NArg() == 0:
+		id = r.intoSandbox
+	default:
 		f.Usage()
 		return subcommands.ExitUsageError
 	}
-
-	id := f.Arg(0)
 	conf := args[0].(*config.Config)
 	waitStatus := args[1].(*unix.WaitStatus)
 
@@ -100,6 +145,7 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subco
 	defer cu.Clean()
 
 	conf.RestoreFile = filepath.Join(r.imagePath, checkpointFileName)
+	conf.RestoreEnvFile = r.envFile
 
 	runArgs := container.Args{
 		ID:            id,
@@ -113,7 +159,15 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subco
 
 	log.Debugf("Restore container, cid: %s, rootDir: %q", id, conf.RootDir)
 	c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
-	if err != nil {
+	if r.intoSandbox != "" {
+		if err != nil {
+			return util.Errorf("loading sandbox: %v", err)
+		}
+		if err := checkIdleSandbox(c); err != nil {
+			return util.Errorf("restoring into sandbox %q: %v", id, err)
+		}
+		runArgs.Spec = c.Spec
+	} else if err != nil {
 		if err != os.ErrNotExist {
 			return util.Errorf("loading container: %v", err)
 		}
@@ -127,7 +181,7 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subco
 		}
 		specutils.LogSpecDebug(runArgs.Spec, conf.OCISeccomp)
 
-		if c, err = container.New(conf, runArgs); err != nil {
+		if c, err = container.New(ctx, conf, runArgs); err != nil {
 			return util.Errorf("creating container: %v", err)
 		}
 
@@ -140,8 +194,22 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subco
 		runArgs.Spec = c.Spec
 	}
 
+	var precopy *os.File
+	if r.listen != "" {
+		if err := os.MkdirAll(r.imagePath, 0755); err != nil {
+			return util.Errorf("creating image directory: %v", err)
+		}
+		if precopy, err = receiveMigration(r.listen, conf.RestoreFile); err != nil {
+			return util.Errorf("receiving migration: %v", err)
+		}
+		defer precopy.Close()
+	}
+
 	log.Debugf("Restore: %v", conf.RestoreFile)
-	if err := c.Restore(conf, conf.RestoreFile); err != nil {
+	stopWatching := watchRestore(c, r.progress)
+	err = c.RestoreWithPrecopy(ctx, conf, conf.RestoreFile, precopy)
+	stopWatching()
+	if err != nil {
 		return util.Errorf("starting container: %v", err)
 	}
 
@@ -155,7 +223,7 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subco
 
 	var ws unix.WaitStatus
 	if runArgs.Attached {
-		if ws, err = c.Wait(); err != nil {
+		if ws, err = c.Wait(ctx); err != nil {
 			return util.Errorf("running container: %v", err)
 		}
 	}
@@ -165,3 +233,75 @@ func (r *Restore) Execute(_ context.Context, f *flag.FlagSet, args ...any) subco
 
 	return subcommands.ExitSuccess
 }
+
+// checkIdleSandbox checks that c is the root container of a running sandbox
+// that hasn't been started.
+func checkIdleSandbox(c *container.Container) error {
+	if !c.IsSandboxRoot() || c.Sandbox == nil || c.Sandbox.ID != c.ID {
+		return fmt.Errorf("not the root container of a sandbox")
+	}
+	if c.Status != container.Created {
+		return fmt.Errorf("sandbox is %s, must be %s", c.Status, container.Created)
+	}
+	if !c.IsSandboxRunning() {
+		return fmt.Errorf("sandbox process isn't running")
+	}
+	return nil
+}
+
+// restoreProgressInterval is the interval at which the progress of a restore
+// is printed.
+const restoreProgressInterval = time.Second
+
+// watchRestore prints the progress of the restore of c to stderr if progress
+// is true, and cancels the restore on SIGINT and SIGTERM. It returns a
+// function that stops watching.
+func watchRestore(c *container.Container, progress bool) func() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, unix.SIGINT, unix.SIGTERM)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(restoreProgressInterval)
+		defer ticker.Stop()
+		cancel, canceled := false, false
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-sigCh:
+				fmt.Fprintf(os.Stderr, "Got %v, canceling restore\n", sig)
+				cancel = true
+			case <-ticker.C:
+			}
+			if cancel && !canceled {
+				// The restore RPC may not have started yet, retry on
+				// the next tick in that case.
+				if err := c.Sandbox.CancelRestore(); err != nil {
+					log.Debugf("Canceling restore: %v", err)
+				} else {
+					canceled = true
+				}
+			}
+			if !progress {
+				continue
+			}
+			p, err := c.Sandbox.RestoreProgress()
+			if err != nil {
+				log.Debugf("Getting restore progress: %v", err)
+				continue
+			}
+			if !p.InProgress {
+				continue
+			}
+			const mib = 1 << 20
+			fmt.Fprintf(os.Stderr, "Restoring: %d%% (%d/%d MiB), %d pages loaded, %d files reattached\n", p.Percent(), p.BytesRead/mib, p.TotalBytes/mib, p.PagesLoaded, p.FilesRestored)
+		}
+	}()
+	return func() {
+		signal.Stop(sigCh)
+		close(done)
+		<-stopped
+	}
+}
@@ -57,19 +57,26 @@ func (*Run) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Run) Usage() string {
 	return `run [flags] <container id> - create and run a secure container.
+
+Listening TCP sockets passed with -pass-fd, e.g. by systemd socket
+activation, appear as listening sockets in the container. With
+--network=host, the container gets the host socket. Otherwise, it gets a socket
+listening on the port of the host socket, or on the address given after the
+mapping as in -pass-fd=3:3@127.0.0.1:8080, and connections accepted on the
+host socket are forwarded to it.
 `
 }
 
 // SetFlags implements subcommands.Command.SetFlags.
 func (r *Run) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&r.detach, "detach", false, "detach from the container's process")
-	f.Var(&r.passFDs, "pass-fd", "file descriptor passed to the container in M:N format, where M is the host and N is the guest descriptor (can be supplied multiple times)")
+	f.Var(&r.passFDs, "pass-fd", "file descriptor passed to the container in M:N[@ip:port] format, where M is the host and N is the guest descriptor, and ip:port is where a listening socket is exposed (can be supplied multiple times)")
 	f.IntVar(&r.execFD, "exec-fd", -1, "host file descriptor used for program execution")
 	r.Create.SetFlags(f)
 }
 
 // Execute implements subcommands.Command.Execute.
-func (r *Run) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+func (r *Run) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
 	if f.NArg() != 1 {
 		f.Usage()
 		return subcommands.ExitUsageError
@@ -102,12 +109,16 @@ func (r *Run) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomman
 
 	// Create files from file descriptors.
 	fdMap := make(map[int]*os.File)
+	listenAddrs := make(map[int]string)
 	for _, mapping := range r.passFDs {
 		file := os.NewFile(uintptr(mapping.Host), "")
 		if file == nil {
 			return util.Errorf("Failed to create file from file descriptor %d", mapping.Host)
 		}
 		fdMap[mapping.Guest] = file
+		if mapping.Address != "" {
+			listenAddrs[mapping.Guest] = mapping.Address
+		}
 	}
 
 	var execFile *os.File
@@ -130,17 +141,18 @@ func (r *Run) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomman
 	}()
 
 	runArgs := container.Args{
-		ID:            id,
-		Spec:          spec,
-		BundleDir:     bundleDir,
-		ConsoleSocket: r.consoleSocket,
-		PIDFile:       r.pidFile,
-		UserLog:       r.userLog,
-		Attached:      !r.detach,
-		PassFiles:     fdMap,
-		ExecFile:      execFile,
+		ID:              id,
+		Spec:            spec,
+		BundleDir:       bundleDir,
+		ConsoleSocket:   r.consoleSocket,
+		PIDFile:         r.pidFile,
+		UserLog:         r.userLog,
+		Attached:        !r.detach,
+		PassFiles:       fdMap,
+		ListenAddresses: listenAddrs,
+		ExecFile:        execFile,
 	}
-	ws, err := container.Run(conf, runArgs)
+	ws, err := container.Run(ctx, conf, runArgs)
 	if err != nil {
 		return util.Errorf("running container: %v", err)
 	}
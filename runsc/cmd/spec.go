@@ -24,6 +24,7 @@ import (
 	"github.com/google/subcommands"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
 	"github.com/talismancer/gvisor-ligolo/runsc/flag"
 )
 
@@ -147,6 +148,7 @@ func (*Spec) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Spec) Usage() string {
 	return `spec [options] [-- args...] - create a new OCI bundle specification file.
+spec [options] validate [validate options] - check a bundle's specification file.
 
 The spec command creates a new specification file (config.json) for a new OCI
 bundle.
@@ -161,12 +163,19 @@ You can find out more about the format of the specification file by visiting
 the OCI runtime spec repository:
 https://github.com/opencontainers/runtime-spec/
 
+The validate subcommand reads the specification file of an existing bundle and
+reports the features it requests that runsc doesn't support, silently ignores,
+or emulates differently than a native runtime. It fails if the spec can't be
+used with runsc, or if any issue is found with --strict. Use "--" to create a
+spec that runs a program named "validate".
+
 EXAMPLE:
     $ mkdir -p bundle/rootfs
     $ cd bundle
     $ runsc spec -- /hello
     $ docker export $(docker create hello-world) | tar -xf - -C rootfs
     $ sudo runsc run hello
+    $ runsc spec validate --format=json
 
 `
 }
@@ -181,6 +190,11 @@ func (s *Spec) SetFlags(f *flag.FlagSet) {
 
 // Execute implements subcommands.Command.Execute.
 func (s *Spec) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() > 0 && f.Arg(0) == "validate" && !dashDashBefore("validate") {
+		v := specValidate{bundle: s.bundle}
+		return v.execute(args[0].(*config.Config), f.Args()[1:])
+	}
+
 	// Grab the arguments.
 	containerArgs := f.Args()
 	if len(containerArgs) == 0 {
@@ -204,3 +218,17 @@ func (s *Spec) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomma
 
 	return subcommands.ExitSuccess
 }
+
+// dashDashBefore returns true if "--" precedes arg in the command line, i.e.
+// arg is meant as a program argument rather than a subcommand.
+func dashDashBefore(arg string) bool {
+	for _, a := range os.Args[1:] {
+		switch a {
+		case "--":
+			return true
+		case arg:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/google/subcommands"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+)
+
+// specValidate implements "spec validate", which reports the features of a
+// bundle's spec that runsc doesn't support, ignores, or emulates differently.
+type specValidate struct {
+	bundle string
+	format string
+	strict bool
+}
+
+func (v *specValidate) setFlags(f *flag.FlagSet, bundle string) {
+	f.StringVar(&v.bundle, "bundle", bundle, "path to the root of the OCI bundle")
+	f.StringVar(&v.format, "format", "text", "output format: text or json")
+	f.BoolVar(&v.strict, "strict", false, "fail if the spec uses any feature that runsc ignores or emulates")
+}
+
+// validationResult is the output of "spec validate" in JSON format.
+type validationResult struct {
+	Valid    bool                    `json:"valid"`
+	Error    string                  `json:"error,omitempty"`
+	Findings []specutils.LintFinding `json:"findings"`
+}
+
+func (v *specValidate) execute(conf *config.Config, args []string) subcommands.ExitStatus {
+	f := flag.NewFlagSet("spec validate", flag.ContinueOnError)
+	v.setFlags(f, v.bundle)
+	if err := f.Parse(args); err != nil {
+		return subcommands.ExitUsageError
+	}
+	if f.NArg() != 0 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+	if v.format != "text" && v.format != "json" {
+		util.Fatalf("invalid format %q, must be text or json", v.format)
+	}
+
+	res := validationResult{Valid: true}
+	spec, err := specutils.ReadSpec(v.bundle, conf)
+	if err != nil {
+		res.Valid = false
+		res.Error = err.Error()
+	} else {
+		res.Findings = specutils.LintSpec(spec, conf)
+		for _, finding := range res.Findings {
+			if finding.Severity == specutils.LintUnsupported || v.strict {
+				res.Valid = false
+			}
+		}
+	}
+
+	switch v.format {
+	case "json":
+		if err := json.NewEncoder(os.Stdout).Encode(&res); err != nil {
+			util.Fatalf("marshaling result: %v", err)
+		}
+	default:
+		if res.Error != "" {
+			fmt.Fprintf(os.Stdout, "invalid spec: %s\n", res.Error)
+		} else if len(res.Findings) == 0 {
+			fmt.Fprintln(os.Stdout, "no compatibility issues found")
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprint(w, "SEVERITY\tFIELD\tMESSAGE\n")
+			for _, finding := range res.Findings {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", finding.Severity, finding.Field, finding.Message)
+			}
+			_ = w.Flush()
+		}
+	}
+
+	if !res.Valid {
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -47,7 +47,7 @@ func (*Start) Usage() string {
 func (*Start) SetFlags(*flag.FlagSet) {}
 
 // Execute implements subcommands.Command.Execute.
-func (*Start) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+func (*Start) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
 	if f.NArg() != 1 {
 		f.Usage()
 		return subcommands.ExitUsageError
@@ -66,7 +66,7 @@ func (*Start) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomman
 		util.Fatalf("reading spec: %v", err)
 	}
 
-	if err := c.Start(conf); err != nil {
+	if err := c.Start(ctx, conf); err != nil {
 		util.Fatalf("starting container: %v", err)
 	}
 	return subcommands.ExitSuccess
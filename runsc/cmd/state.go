@@ -20,6 +20,7 @@ import (
 	"os"
 
 	"github.com/google/subcommands"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
 	"github.com/talismancer/gvisor-ligolo/runsc/config"
@@ -28,7 +29,9 @@ import (
 )
 
 // State implements subcommands.Command for the "state" command.
-type State struct{}
+type State struct {
+	history bool
+}
 
 // Name implements subcommands.Command.Name.
 func (*State) Name() string {
@@ -46,10 +49,18 @@ func (*State) Usage() string {
 }
 
 // SetFlags implements subcommands.Command.SetFlags.
-func (*State) SetFlags(*flag.FlagSet) {}
+func (s *State) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&s.history, "history", false, "include the lifecycle transitions of the container, e.g. start and exit, with their timestamps")
+}
+
+// stateWithHistory is the output of state with --history.
+type stateWithHistory struct {
+	specs.State
+	History []container.HistoryEvent `json:"history"`
+}
 
 // Execute implements subcommands.Command.Execute.
-func (*State) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+func (s *State) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
 	if f.NArg() != 1 {
 		f.Usage()
 		return subcommands.ExitUsageError
@@ -67,8 +78,17 @@ func (*State) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomman
 	state := c.State()
 	log.Debugf("State: %+v", state)
 
+	var v any = state
+	if s.history {
+		history, err := c.History()
+		if err != nil {
+			util.Fatalf("reading container history: %v", err)
+		}
+		v = stateWithHistory{State: state, History: history}
+	}
+
 	// Write json-encoded state directly to stdout.
-	b, err := json.MarshalIndent(state, "", "  ")
+	b, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		util.Fatalf("marshaling container state: %v", err)
 	}
@@ -18,8 +18,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/google/subcommands"
+	sentrystate "github.com/talismancer/gvisor-ligolo/pkg/sentry/state"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/state/inspect"
+	"github.com/talismancer/gvisor-ligolo/pkg/state"
 	"github.com/talismancer/gvisor-ligolo/pkg/state/pretty"
 	"github.com/talismancer/gvisor-ligolo/pkg/state/statefile"
 	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
@@ -28,11 +32,14 @@ import (
 
 // Statefile implements subcommands.Command for the "statefile" command.
 type Statefile struct {
-	list   bool
-	get    string
-	key    string
-	output string
-	html   bool
+	list    bool
+	get     string
+	key     string
+	output  string
+	html    bool
+	convert string
+	summary bool
+	verify  bool
 }
 
 // Name implements subcommands.Command.
@@ -47,7 +54,20 @@ func (*Statefile) Synopsis() string {
 
 // Usage implements subcommands.Command.
 func (*Statefile) Usage() string {
-	return `statefile [flags] <statefile>`
+	return `statefile [flags] <statefile>
+
+With -summary, a human readable summary of the checkpointed processes is
+printed: their memory maps, open files and sockets, as well as the mounts.
+
+With -convert, the statefile is upgraded to the state version supported by
+this runsc build and written to the given path. The same integrity key is used
+for the new file.
+
+With -verify, the whole statefile is read and checked for corruption without
+restoring it. The state data is checked if the file has an integrity key or
+was written with --checkpoint-checksums, and memory pages are checked if it was
+written with --checkpoint-checksums.
+`
 }
 
 // SetFlags implements subcommands.Command.
@@ -57,6 +77,9 @@ func (s *Statefile) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&s.key, "key", "", "the integrity key for the file.")
 	f.StringVar(&s.output, "output", "", "target to write the result.")
 	f.BoolVar(&s.html, "html", false, "outputs in HTML format.")
+	f.BoolVar(&s.summary, "summary", false, "prints a summary of processes, memory maps, open files, sockets and mounts.")
+	f.StringVar(&s.convert, "convert", "", "upgrades the statefile to the current state version and writes it to the given path.")
+	f.BoolVar(&s.verify, "verify", false, "checks the statefile for corruption.")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -65,6 +88,15 @@ func (s *Statefile) Execute(_ context.Context, f *flag.FlagSet, args ...any) sub
 	if s.list && s.get != "" {
 		util.Fatalf("error: can't specify -list and -get simultaneously.")
 	}
+	if s.convert != "" && (s.list || s.get != "" || s.output != "" || s.html || s.summary) {
+		util.Fatalf("error: -convert can't be combined with other output flags.")
+	}
+	if s.summary && (s.list || s.get != "" || s.html) {
+		util.Fatalf("error: -summary can't be combined with -list, -get or -html.")
+	}
+	if s.verify && (s.list || s.get != "" || s.html || s.summary || s.convert != "") {
+		util.Fatalf("error: -verify can't be combined with other flags except -key and -output.")
+	}
 
 	// Setup output.
 	var output = os.Stdout // Default.
@@ -91,6 +123,33 @@ func (s *Statefile) Execute(_ context.Context, f *flag.FlagSet, args ...any) sub
 		util.Fatalf("error opening input: %v\n", err)
 	}
 
+	if s.convert != "" {
+		if err := convertStatefile(input, s.convert, s.key); err != nil {
+			util.Fatalf("error converting statefile: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+
+	if s.verify {
+		var key []byte
+		if s.key != "" {
+			key = []byte(s.key)
+		}
+		metadata, err := sentrystate.Verify(input, key)
+		if err != nil {
+			util.Fatalf("statefile is corrupted: %v", err)
+		}
+		switch {
+		case statefile.Checksums(metadata):
+			fmt.Fprintf(output, "Statefile OK\n")
+		case key != nil:
+			fmt.Fprintf(output, "Statefile OK, memory pages not checked: written without checksums\n")
+		default:
+			fmt.Fprintf(output, "Statefile metadata OK, data not checked: written without checksums or integrity key\n")
+		}
+		return subcommands.ExitSuccess
+	}
+
 	if s.html {
 		fmt.Fprintf(output, "<html><body>\n")
 		defer fmt.Fprintf(output, "</body></html>\n")
@@ -106,6 +165,14 @@ func (s *Statefile) Execute(_ context.Context, f *flag.FlagSet, args ...any) sub
 		if err != nil {
 			util.Fatalf("error parsing statefile: %v", err)
 		}
+		if s.summary {
+			summary, err := inspect.Summarize(rc)
+			if err != nil {
+				util.Fatalf("error summarizing state: %v", err)
+			}
+			summary.WriteText(output)
+			return subcommands.ExitSuccess
+		}
 		if s.html {
 			if err := pretty.PrintHTML(output, rc); err != nil {
 				util.Fatalf("error printing state: %v", err)
@@ -148,3 +215,52 @@ func (s *Statefile) Execute(_ context.Context, f *flag.FlagSet, args ...any) sub
 	}
 	return subcommands.ExitSuccess
 }
+
+// convertStatefile upgrades the statefile read from input to the current state
+// version and writes it to path.
+func convertStatefile(input *os.File, path, key string) error {
+	var k []byte
+	if key != "" {
+		k = []byte(key)
+	}
+	rc, metadata, err := statefile.NewReader(input, k)
+	if err != nil {
+		return fmt.Errorf("parsing statefile: %w", err)
+	}
+	from, err := statefile.Version(metadata)
+	if err != nil {
+		return err
+	}
+	if err := state.CanMigrate(from); err != nil {
+		return err
+	}
+
+	// Internal keys are regenerated by the writer.
+	for key := range metadata {
+		if strings.HasPrefix(key, "_") {
+			delete(metadata, key)
+		}
+	}
+
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("opening output: %w", err)
+	}
+	defer out.Close()
+	w, err := statefile.NewWriter(out, k, metadata)
+	if err != nil {
+		return fmt.Errorf("writing statefile header: %w", err)
+	}
+	if err := state.Migrate(rc, w, from); err != nil {
+		w.Close()
+		return fmt.Errorf("upgrading from version %d: %w", from, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("flushing statefile: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("closing output: %w", err)
+	}
+	fmt.Printf("Converted statefile from version %d to version %d\n", from, state.Version)
+	return nil
+}
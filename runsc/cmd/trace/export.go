@@ -0,0 +1,271 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/subcommands"
+	pb "github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/points/points_go_proto"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/sinks/recorder"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/container"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// export implements subcommands.Command for the "export" command.
+type export struct {
+	ring  string
+	since string
+	until string
+	pcap  string
+}
+
+// Name implements subcommands.Command.
+func (*export) Name() string {
+	return "export"
+}
+
+// Synopsis implements subcommands.Command.
+func (*export) Synopsis() string {
+	return "export the records of the flight recorder"
+}
+
+// Usage implements subcommands.Command.
+func (*export) Usage() string {
+	return `export [flags] <sandbox id> - export the records of the flight recorder
+
+Points recorded by the flight recorder are written to stdout as JSON lines.
+Network packets are only exported if --pcap is set.
+`
+}
+
+// SetFlags implements subcommands.Command.
+func (e *export) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&e.ring, "ring", "", "path of a flight recorder ring to read instead of the ring of the sandbox, e.g. after the sandbox was deleted")
+	f.StringVar(&e.since, "since", "", "only export records written since this time, either RFC 3339 or a duration before now, e.g. 10m")
+	f.StringVar(&e.until, "until", "", "only export records written until this time, either RFC 3339 or a duration before now")
+	f.StringVar(&e.pcap, "pcap", "", "path of a pcap file to write the recorded network packets to")
+}
+
+// Execute implements subcommands.Command.
+func (e *export) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	path := e.ring
+	switch {
+	case path == "" && f.NArg() == 1:
+		id := f.Arg(0)
+		conf := args[0].(*config.Config)
+
+		opts := container.LoadOpts{
+			SkipCheck:     true,
+			RootContainer: true,
+		}
+		c, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, opts)
+		if err != nil {
+			util.Fatalf("loading sandbox: %v", err)
+		}
+		if c.Sandbox.FlightRecorder == "" {
+			util.Fatalf("sandbox %q has no flight recorder, it must be created with --flight-recorder", id)
+		}
+		path = c.Sandbox.FlightRecorder
+	case path != "" && f.NArg() == 0:
+	default:
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	now := time.Now()
+	since, err := parseExportTime(e.since, now)
+	if err != nil {
+		return util.Errorf("invalid --since: %v", err)
+	}
+	until, err := parseExportTime(e.until, now)
+	if err != nil {
+		return util.Errorf("invalid --until: %v", err)
+	}
+
+	ring, err := os.Open(path)
+	if err != nil {
+		util.Fatalf("opening flight recorder ring: %v", err)
+	}
+	defer ring.Close()
+
+	var packets io.Writer
+	if e.pcap != "" {
+		pcapFile, err := os.Create(e.pcap)
+		if err != nil {
+			util.Fatalf("creating pcap file: %v", err)
+		}
+		defer pcapFile.Close()
+		w := bufio.NewWriter(pcapFile)
+		defer w.Flush()
+		if err := recorder.WritePCAPHeader(w); err != nil {
+			util.Fatalf("writing pcap file: %v", err)
+		}
+		packets = w
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	enc := json.NewEncoder(out)
+	err = recorder.Scan(ring, since, until, func(rec recorder.Record) error {
+		if rec.Type == recorder.RecordPacket {
+			if packets == nil {
+				return nil
+			}
+			_, err := packets.Write(rec.Payload)
+			return err
+		}
+		return enc.Encode(newExportedRecord(rec))
+	})
+	if err != nil {
+		util.Fatalf("exporting flight recorder ring: %v", err)
+	}
+	return subcommands.ExitSuccess
+}
+
+// parseExportTime parses s as either a RFC 3339 time or a duration before now.
+// The zero time is returned if s is empty.
+func parseExportTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// exportedRecord is the JSON representation of a recorded point.
+type exportedRecord struct {
+	Time  time.Time       `json:"time"`
+	Type  string          `json:"type"`
+	Point json.RawMessage `json:"point,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+func newExportedRecord(rec recorder.Record) *exportedRecord {
+	msgType := pb.MessageType(rec.Type)
+	out := &exportedRecord{
+		Time: rec.Time,
+		Type: msgType.String(),
+	}
+	msg := newPointMessage(msgType)
+	if msg == nil {
+		out.Error = "unknown message type"
+		return out
+	}
+	if err := proto.Unmarshal(rec.Payload, msg); err != nil {
+		out.Error = fmt.Sprintf("unmarshalling point: %v", err)
+		return out
+	}
+	point, err := protojson.Marshal(msg)
+	if err != nil {
+		out.Error = fmt.Sprintf("marshalling point: %v", err)
+		return out
+	}
+	out.Point = point
+	return out
+}
+
+// newPointMessage returns an empty message of type msgType, or nil if the type
+// is unknown.
+func newPointMessage(msgType pb.MessageType) proto.Message {
+	switch msgType {
+	case pb.MessageType_MESSAGE_CONTAINER_START:
+		return &pb.Start{}
+	case pb.MessageType_MESSAGE_SENTRY_CLONE:
+		return &pb.CloneInfo{}
+	case pb.MessageType_MESSAGE_SENTRY_EXEC:
+		return &pb.ExecveInfo{}
+	case pb.MessageType_MESSAGE_SENTRY_EXIT_NOTIFY_PARENT:
+		return &pb.ExitNotifyParentInfo{}
+	case pb.MessageType_MESSAGE_SENTRY_TASK_EXIT:
+		return &pb.TaskExit{}
+	case pb.MessageType_MESSAGE_SENTRY_MAPPED_FILE_TRUNCATED:
+		return &pb.MappedFileTruncated{}
+	case pb.MessageType_MESSAGE_SENTRY_TLS_PLAINTEXT:
+		return &pb.TLSPlaintext{}
+	case pb.MessageType_MESSAGE_SYSCALL_RAW:
+		return &pb.Syscall{}
+	case pb.MessageType_MESSAGE_SYSCALL_OPEN:
+		return &pb.Open{}
+	case pb.MessageType_MESSAGE_SYSCALL_CLOSE:
+		return &pb.Close{}
+	case pb.MessageType_MESSAGE_SYSCALL_READ:
+		return &pb.Read{}
+	case pb.MessageType_MESSAGE_SYSCALL_WRITE:
+		return &pb.Write{}
+	case pb.MessageType_MESSAGE_SYSCALL_CONNECT:
+		return &pb.Connect{}
+	case pb.MessageType_MESSAGE_SYSCALL_EXECVE:
+		return &pb.Execve{}
+	case pb.MessageType_MESSAGE_SYSCALL_SOCKET:
+		return &pb.Socket{}
+	case pb.MessageType_MESSAGE_SYSCALL_CHDIR:
+		return &pb.Chdir{}
+	case pb.MessageType_MESSAGE_SYSCALL_SETID:
+		return &pb.Setid{}
+	case pb.MessageType_MESSAGE_SYSCALL_SETRESID:
+		return &pb.Setresid{}
+	case pb.MessageType_MESSAGE_SYSCALL_PRLIMIT64:
+		return &pb.Prlimit{}
+	case pb.MessageType_MESSAGE_SYSCALL_PIPE:
+		return &pb.Pipe{}
+	case pb.MessageType_MESSAGE_SYSCALL_FCNTL:
+		return &pb.Fcntl{}
+	case pb.MessageType_MESSAGE_SYSCALL_DUP:
+		return &pb.Dup{}
+	case pb.MessageType_MESSAGE_SYSCALL_SIGNALFD:
+		return &pb.Signalfd{}
+	case pb.MessageType_MESSAGE_SYSCALL_CHROOT:
+		return &pb.Chroot{}
+	case pb.MessageType_MESSAGE_SYSCALL_EVENTFD:
+		return &pb.Eventfd{}
+	case pb.MessageType_MESSAGE_SYSCALL_CLONE:
+		return &pb.Clone{}
+	case pb.MessageType_MESSAGE_SYSCALL_BIND:
+		return &pb.Bind{}
+	case pb.MessageType_MESSAGE_SYSCALL_ACCEPT:
+		return &pb.Accept{}
+	case pb.MessageType_MESSAGE_SYSCALL_TIMERFD_CREATE:
+		return &pb.TimerfdCreate{}
+	case pb.MessageType_MESSAGE_SYSCALL_TIMERFD_SETTIME:
+		return &pb.TimerfdSetTime{}
+	case pb.MessageType_MESSAGE_SYSCALL_TIMERFD_GETTIME:
+		return &pb.TimerfdGetTime{}
+	case pb.MessageType_MESSAGE_SYSCALL_FORK:
+		return &pb.Fork{}
+	case pb.MessageType_MESSAGE_SYSCALL_INOTIFY_INIT:
+		return &pb.InotifyInit{}
+	case pb.MessageType_MESSAGE_SYSCALL_INOTIFY_ADD_WATCH:
+		return &pb.InotifyAddWatch{}
+	case pb.MessageType_MESSAGE_SYSCALL_INOTIFY_RM_WATCH:
+		return &pb.InotifyRmWatch{}
+	case pb.MessageType_MESSAGE_SYSCALL_SOCKETPAIR:
+		return &pb.SocketPair{}
+	default:
+		return nil
+	}
+}
@@ -65,6 +65,7 @@ func createCommander(f *flag.FlagSet) *subcommands.Commander {
 	cdr.Register(cdr.FlagsCommand(), "")
 	cdr.Register(new(create), "")
 	cdr.Register(new(delete), "")
+	cdr.Register(new(export), "")
 	cdr.Register(new(list), "")
 	cdr.Register(new(metadata), "")
 	cdr.Register(new(procfs), "")
@@ -0,0 +1,93 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/google/subcommands"
+	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/container"
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+)
+
+// Update implements subcommands.Command for the "update" command.
+type Update struct {
+	cpuNum  int
+	memory  uint64
+	balloon int64
+}
+
+// Name implements subcommands.Command.Name.
+func (*Update) Name() string {
+	return "update"
+}
+
+// Synopsis implements subcommands.Command.Synopsis.
+func (*Update) Synopsis() string {
+	return "update resizes the sandbox of a running container"
+}
+
+// Usage implements subcommands.Command.Usage.
+func (*Update) Usage() string {
+	return `update [flags] <container id> - resize the sandbox running the container.
+
+The resources of the whole sandbox are changed, affecting all containers in it.
+`
+}
+
+// SetFlags implements subcommands.Command.SetFlags.
+func (u *Update) SetFlags(f *flag.FlagSet) {
+	f.IntVar(&u.cpuNum, "cpu-num", 0, "number of CPUs applications in the sandbox run on, up to --cpu-num-max")
+	f.Uint64Var(&u.memory, "memory", 0, "total memory, in bytes, reported to applications in the sandbox")
+	f.Int64Var(&u.balloon, "balloon", -1, "memory, in bytes, the sandbox should return to the host; 0 deflates the balloon")
+}
+
+// Execute implements subcommands.Command.Execute.
+func (u *Update) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+	if f.NArg() != 1 {
+		f.Usage()
+		return subcommands.ExitUsageError
+	}
+
+	id := f.Arg(0)
+	conf := args[0].(*config.Config)
+
+	cont, err := container.Load(conf.RootDir, container.FullID{ContainerID: id}, container.LoadOpts{})
+	if err != nil {
+		util.Fatalf("loading container: %v", err)
+	}
+	if !cont.IsSandboxRunning() {
+		util.Fatalf("sandbox of container %q is not running", id)
+	}
+
+	if u.cpuNum != 0 {
+		if err := cont.Sandbox.SetCPUs(u.cpuNum); err != nil {
+			util.Fatalf("%v", err)
+		}
+	}
+	if u.memory != 0 {
+		if err := cont.Sandbox.SetMemory(u.memory); err != nil {
+			util.Fatalf("%v", err)
+		}
+	}
+	if u.balloon >= 0 {
+		if err := cont.Sandbox.SetBalloon(uint64(u.balloon)); err != nil {
+			util.Fatalf("%v", err)
+		}
+	}
+	return subcommands.ExitSuccess
+}
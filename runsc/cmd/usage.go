@@ -17,6 +17,7 @@ package cmd
 import (
 	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/google/subcommands"
 	"github.com/talismancer/gvisor-ligolo/runsc/cmd/util"
@@ -27,8 +28,14 @@ import (
 
 // Usage implements subcommands.Command for the "usage" command.
 type Usage struct {
-	full bool
-	fd   bool
+	full   bool
+	fd     bool
+	sentry bool
+
+	startSampling  time.Duration
+	sampleCapacity int
+	stopSampling   bool
+	samples        bool
 }
 
 // Name implements subcommands.Command.Name.
@@ -44,6 +51,12 @@ func (*Usage) Synopsis() string {
 // Usage implements subcommands.Command.Usage.
 func (*Usage) Usage() string {
 	return `usage [flags] <container id> - print memory usages to standard output.
+
+With --sentry, the memory used by the sentry itself, i.e. the runtime overhead
+of the sandbox, is printed instead of the memory used by the application.
+
+With --start-sampling, the sandbox records its memory and CPU usage at a fixed
+interval in the background. The samples are printed with --samples.
 `
 }
 
@@ -51,6 +64,11 @@ func (*Usage) Usage() string {
 func (u *Usage) SetFlags(f *flag.FlagSet) {
 	f.BoolVar(&u.full, "full", false, "enumerate all usage by categories")
 	f.BoolVar(&u.fd, "fd", false, "retrieves a subset of usage through the established usage FD")
+	f.BoolVar(&u.sentry, "sentry", false, "print the memory used by the sentry itself instead of the application")
+	f.DurationVar(&u.startSampling, "start-sampling", 0, "start recording usage samples in the sandbox at the given interval")
+	f.IntVar(&u.sampleCapacity, "sample-capacity", 0, "number of samples kept by --start-sampling, 0 for the default")
+	f.BoolVar(&u.stopSampling, "stop-sampling", false, "stop recording usage samples")
+	f.BoolVar(&u.samples, "samples", false, "print the usage samples recorded in the sandbox")
 }
 
 // Execute implements subcommands.Command.Execute.
@@ -68,6 +86,41 @@ func (u *Usage) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 		util.Fatalf("loading container: %v", err)
 	}
 
+	switch {
+	case u.startSampling != 0:
+		if err := cont.Sandbox.StartUsageSampling(u.startSampling, u.sampleCapacity); err != nil {
+			util.Fatalf("starting usage sampling failed: %v", err)
+		}
+		return subcommands.ExitSuccess
+	case u.stopSampling:
+		if err := cont.Sandbox.StopUsageSampling(); err != nil {
+			util.Fatalf("stopping usage sampling failed: %v", err)
+		}
+		return subcommands.ExitSuccess
+	case u.samples:
+		samples, err := cont.Sandbox.UsageSamples()
+		if err != nil {
+			util.Fatalf("usage samples failed: %v", err)
+		}
+		encoder := json.NewEncoder(&util.Writer{})
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(samples); err != nil {
+			util.Fatalf("Encode UsageSamples failed: %v", err)
+		}
+		return subcommands.ExitSuccess
+	case u.sentry:
+		m, err := cont.Sandbox.SentryUsage()
+		if err != nil {
+			util.Fatalf("sentry usage failed: %v", err)
+		}
+		encoder := json.NewEncoder(&util.Writer{})
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(m); err != nil {
+			util.Fatalf("Encode SentryMemoryUsage failed: %v", err)
+		}
+		return subcommands.ExitSuccess
+	}
+
 	if u.fd {
 		m, err := cont.Sandbox.UsageFD()
 		if err != nil {
@@ -60,7 +60,7 @@ func (wt *Wait) SetFlags(f *flag.FlagSet) {
 
 // Execute implements subcommands.Command.Execute. It waits for a process in a
 // container to exit before returning.
-func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
+func (wt *Wait) Execute(ctx context.Context, f *flag.FlagSet, args ...any) subcommands.ExitStatus {
 	if f.NArg() != 1 {
 		f.Usage()
 		return subcommands.ExitUsageError
@@ -82,21 +82,21 @@ func (wt *Wait) Execute(_ context.Context, f *flag.FlagSet, args ...any) subcomm
 	switch {
 	// Wait on the whole container.
 	case wt.rootPID == unsetPID && wt.pid == unsetPID:
-		ws, err := c.Wait()
+		ws, err := c.Wait(ctx)
 		if err != nil {
 			util.Fatalf("waiting on container %q: %v", c.ID, err)
 		}
 		waitStatus = ws
 	// Wait on a PID in the root PID namespace.
 	case wt.rootPID != unsetPID:
-		ws, err := c.WaitRootPID(int32(wt.rootPID))
+		ws, err := c.WaitRootPID(ctx, int32(wt.rootPID))
 		if err != nil {
 			util.Fatalf("waiting on PID in root PID namespace %d in container %q: %v", wt.rootPID, c.ID, err)
 		}
 		waitStatus = ws
 	// Wait on a PID in the container's PID namespace.
 	case wt.pid != unsetPID:
-		ws, err := c.WaitPID(int32(wt.pid))
+		ws, err := c.WaitPID(ctx, int32(wt.pid))
 		if err != nil {
 			util.Fatalf("waiting on PID %d in container %q: %v", wt.pid, c.ID, err)
 		}
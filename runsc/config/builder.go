@@ -0,0 +1,120 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/talismancer/gvisor-ligolo/runsc/flag"
+)
+
+// Builder constructs a Config in code, for programs that embed runsc and
+// don't parse its command line flags. A Builder starts from the default value
+// of every field, the same as runsc started without flags.
+//
+// Settings are applied in order. The first error is reported by Build:
+//
+//	conf, err := config.NewBuilder().
+//		Set("network", "none").
+//		Set("platform", "kvm").
+//		With(func(c *Config) { c.RootDir = "/run/myagent" }).
+//		Build()
+type Builder struct {
+	conf    Config
+	flagSet *flag.FlagSet
+	err     error
+}
+
+// NewBuilder returns a Builder holding the default configuration.
+func NewBuilder() *Builder {
+	b := &Builder{
+		flagSet: flag.NewFlagSet("builder", flag.ContinueOnError),
+	}
+	RegisterFlags(b.flagSet)
+	obj := reflect.ValueOf(&b.conf).Elem()
+	st := obj.Type()
+	for i := 0; i < st.NumField(); i++ {
+		name, ok := st.Field(i).Tag.Lookup("flag")
+		if !ok {
+			continue
+		}
+		fl := b.flagSet.Lookup(name)
+		if fl == nil {
+			b.err = fmt.Errorf("flag %q not found", name)
+			return b
+		}
+		obj.Field(i).Set(reflect.ValueOf(flag.Get(fl.Value)))
+	}
+	return b
+}
+
+// Set sets the field of flag name to value, which is parsed like on the
+// command line, e.g. Set("network", "host").
+func (b *Builder) Set(name, value string) *Builder {
+	if b.err != nil {
+		return b
+	}
+	obj := reflect.ValueOf(&b.conf).Elem()
+	st := obj.Type()
+	for i := 0; i < st.NumField(); i++ {
+		if fieldName, ok := st.Field(i).Tag.Lookup("flag"); !ok || fieldName != name {
+			continue
+		}
+		fl := b.flagSet.Lookup(name)
+		if err := fl.Value.Set(value); err != nil {
+			b.err = fmt.Errorf("setting %s=%q: %w", name, value, err)
+			return b
+		}
+		obj.Field(i).Set(reflect.ValueOf(flag.Get(fl.Value)))
+		return b
+	}
+	b.err = fmt.Errorf("unknown flag %q", name)
+	return b
+}
+
+// With applies fn to the configuration, allowing fields to be set directly.
+func (b *Builder) With(fn func(*Config)) *Builder {
+	if b.err != nil {
+		return b
+	}
+	fn(&b.conf)
+	return b
+}
+
+// Bundles applies the given bundles, see Config.ApplyBundles.
+func (b *Builder) Bundles(names ...BundleName) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if err := b.conf.ApplyBundles(b.flagSet, names...); err != nil {
+		b.err = err
+	}
+	return b
+}
+
+// Build validates the configuration and returns it. The Builder may be used
+// again afterwards, the returned Config is a copy.
+func (b *Builder) Build() (*Config, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	conf := b.conf
+	conf.setDefaultRootDir()
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
@@ -19,12 +19,15 @@ package config
 
 import (
 	"fmt"
+	"math"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/talismancer/gvisor-ligolo/pkg/cpuid"
 	"github.com/talismancer/gvisor-ligolo/pkg/refs"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/watchdog"
 	"github.com/talismancer/gvisor-ligolo/runsc/flag"
@@ -68,6 +71,13 @@ type Config struct {
 	// PanicLog is the path to log GO's runtime messages, if not empty.
 	PanicLog string `flag:"panic-log"`
 
+	// SandboxExitHook is run when the sandbox process exits before reporting
+	// the exit status of its root container, if not empty. It's either the
+	// path to a program, or "unix:" followed by the path of a stream socket.
+	// A JSON description of the exit is written to the program's stdin, or to
+	// the socket.
+	SandboxExitHook string `flag:"sandbox-exit-hook"`
+
 	// CoverageReport is the path to write Go coverage information, if not empty.
 	CoverageReport string `flag:"coverage-report"`
 
@@ -88,6 +98,10 @@ type Config struct {
 	// DO NOT call it directly, use GetOverlay2() instead.
 	Overlay2 Overlay2 `flag:"overlay2"`
 
+	// OverlayMetaCopy enables metadata-only copy-up of regular files and
+	// redirects of renamed directories in overlays configured by Overlay2.
+	OverlayMetaCopy bool `flag:"overlay-metacopy"`
+
 	// FSGoferHostUDS is deprecated: use host-uds=all.
 	FSGoferHostUDS bool `flag:"fsgofer-host-uds"`
 
@@ -95,9 +109,37 @@ type Config struct {
 	// DO NOT call it directly, use GetHostUDS() instead.
 	HostUDS HostUDS `flag:"host-uds"`
 
+	// HostUDSAllow is a comma-separated list of host path prefixes. If set,
+	// only host Unix-domain sockets under them may be accessed as allowed by
+	// HostUDS. Use HostUDSAllowlist() to get the list.
+	HostUDSAllow string `flag:"host-uds-allow"`
+
+	// AbstractUDSImport is a comma-separated list of names of abstract
+	// Unix-domain sockets in the sandbox's host network namespace that
+	// applications in the sandbox may connect to. A name ending with '*'
+	// matches all names with that prefix. Use AbstractUDSImports() to get the
+	// list.
+	AbstractUDSImport string `flag:"abstract-uds-import"`
+
+	// AbstractUDSExport is a comma-separated list of names of abstract
+	// Unix-domain sockets bound by applications in the sandbox that are
+	// exposed in the sandbox's host network namespace. Use AbstractUDSExports()
+	// to get the list.
+	AbstractUDSExport string `flag:"abstract-uds-export"`
+
 	// HostFifo controls permission to access host FIFO (or named pipes).
 	HostFifo HostFifo `flag:"host-fifo"`
 
+	// MappedFileTruncate controls what applications observe when a host file
+	// they have memory-mapped through a gofer mount is truncated outside of
+	// the sandbox.
+	MappedFileTruncate MappedFileTruncate `flag:"mapped-file-truncate"`
+
+	// GoferRecoveryTimeout is how long the sandbox waits for a container's
+	// gofer to be restarted after it dies, before killing the container. 0
+	// disables recovery: containers are killed as soon as their gofer dies.
+	GoferRecoveryTimeout time.Duration `flag:"gofer-recovery-timeout"`
+
 	// Network indicates what type of network to use.
 	Network NetworkType `flag:"network"`
 
@@ -126,6 +168,11 @@ type Config struct {
 	// RXChecksumOffload indicates that RX Checksum Offload is enabled.
 	RXChecksumOffload bool `flag:"rx-checksum-offload"`
 
+	// TCPRepair indicates that established TCP connections are preserved
+	// across checkpoint/restore. Connections only survive if the restored
+	// sandbox has the same addresses.
+	TCPRepair bool `flag:"tcp-repair"`
+
 	// QDisc indicates the type of queuening discipline to use by default
 	// for non-loopback interfaces.
 	QDisc QueueingDiscipline `flag:"qdisc"`
@@ -136,6 +183,16 @@ type Config struct {
 	// PCAP is a file to which network packets should be logged in PCAP format.
 	PCAP string `flag:"pcap-log"`
 
+	// FlightRecorder is the absolute path of a host directory holding the
+	// flight recorder rings of sandboxes, named after the sandbox IDs. If set,
+	// process lifecycle, file open and network trace points, and network
+	// packets, are recorded in the ring of the sandbox, which keeps the most
+	// recent FlightRecorderSize MiB of records.
+	FlightRecorder string `flag:"flight-recorder"`
+
+	// FlightRecorderSize is the size of each flight recorder ring, in MiB.
+	FlightRecorderSize uint `flag:"flight-recorder-size"`
+
 	// Platform is the platform to run on.
 	Platform string `flag:"platform"`
 
@@ -155,6 +212,12 @@ type Config struct {
 	// The value of this flag must also match across the two command lines.
 	MetricServer string `flag:"metric-server"`
 
+	// GRPCControlSocket, if set, is the path of a Unix domain socket on which
+	// the sandbox serves the gRPC ContainerManager service, see
+	// runsc/boot/control_go_proto. The substring "%ID%" is replaced by the
+	// sandbox ID.
+	GRPCControlSocket string `flag:"grpc-control-socket"`
+
 	// Strace indicates that strace should be enabled.
 	Strace bool `flag:"strace"`
 
@@ -188,6 +251,10 @@ type Config struct {
 	// SIGUSR2(12) to troubleshoot hangs. -1 disables it.
 	PanicSignal int `flag:"panic-signal"`
 
+	// FDAuditInterval is the interval at which the sandbox and gofer processes
+	// audit their host FD tables for leaks. 0 disables auditing.
+	FDAuditInterval time.Duration `flag:"fd-audit-interval"`
+
 	// ProfileEnable is set to prepare the sandbox to be profiled.
 	ProfileEnable bool `flag:"profile"`
 
@@ -214,6 +281,11 @@ type Config struct {
 	// RestoreFile is the path to the saved container image.
 	RestoreFile string
 
+	// RestoreEnvFile is the path, inside the container, of the file where
+	// environment variables that changed since the checkpoint are written to
+	// on restore.
+	RestoreEnvFile string
+
 	// NumNetworkChannels controls the number of AF_PACKET sockets that map
 	// to the same underlying network device. This allows netstack to better
 	// scale for high throughput use cases.
@@ -226,6 +298,11 @@ type Config struct {
 	// should not have a symlink.
 	Rootless bool `flag:"rootless"`
 
+	// SkipHostChecks disables the checks that the host supports the features
+	// required to start a sandbox, done before creating one. See
+	// runsc/hostcheck.
+	SkipHostChecks bool `flag:"skip-host-checks"`
+
 	// AlsoLogToStderr allows to send log messages to stderr.
 	AlsoLogToStderr bool `flag:"alsologtostderr"`
 
@@ -238,12 +315,39 @@ type Config struct {
 	// E.g. 0.2 CPU quota will result in 1, and 1.9 in 2.
 	CPUNumFromQuota bool `flag:"cpu-num-from-quota"`
 
+	// CPUNumMax is the maximum number of CPUs the sandbox can be resized to at
+	// runtime, e.g. with "runsc update". If it is less than the number of CPUs
+	// the sandbox starts with, the sandbox can't grow beyond its initial size.
+	CPUNumMax int `flag:"cpu-num-max"`
+
+	// CPUFeatures is a comma-separated list of CPU features hidden from the
+	// sandbox, each prefixed with "-", e.g. "-avx512f,-rtm,-hle". Features
+	// that depend on a hidden feature are hidden as well.
+	CPUFeatures string `flag:"cpu-features"`
+
+	// EntropySeed, if set, seeds all entropy handed to the sandbox, e.g. by
+	// getrandom(2) and /dev/urandom, making it reproducible. It's meant for
+	// tests only: the seed is visible in the sandbox command line.
+	EntropySeed string `flag:"entropy-seed"`
+
+	// EntropySource is the path of a host file, e.g. /dev/hwrng, that the
+	// entropy handed to the sandbox is seeded and periodically reseeded from.
+	EntropySource string `flag:"entropy-source"`
+
 	// Allows overriding of flags in OCI annotations.
 	AllowFlagOverride bool `flag:"allow-flag-override"`
 
 	// Enables seccomp inside the sandbox.
 	OCISeccomp bool `flag:"oci-seccomp"`
 
+	// SysctlPolicy controls what happens when a sysctl from the OCI spec
+	// can't be applied inside the sandbox.
+	SysctlPolicy SysctlPolicy `flag:"sysctl-policy"`
+
+	// LSM is the Linux Security Module presented to applications probing
+	// for one. No policy is enforced.
+	LSM LSM `flag:"lsm"`
+
 	// Mounts the cgroup filesystem backed by the sentry's cgroupfs.
 	Cgroupfs bool `flag:"cgroupfs"`
 
@@ -257,6 +361,82 @@ type Config struct {
 	// take during pod creation.
 	PodInitConfig string `flag:"pod-init-config"`
 
+	// AutoCheckpoint configures periodic checkpoints of the sandbox.
+	AutoCheckpoint AutoCheckpoint `flag:"auto-checkpoint"`
+
+	// CheckpointChecksums enables checksums of checkpoint images, so that
+	// corrupted images are detected on restore.
+	CheckpointChecksums bool `flag:"checkpoint-checksums"`
+
+	// NestedContainers enables the kernel features required to run container
+	// runtimes, e.g. runc or podman, inside the sandbox: mount namespaces,
+	// cgroup namespaces and pivot_root(2) from the container's root
+	// filesystem.
+	//
+	// Cgroup v2 is not supported: only the v1 cgroupfs can be mounted, so
+	// inner runtimes must run with cgroups disabled or with the cgroupfs v1
+	// driver. An overlay
+	// can't be the upper layer of another overlay, so the storage of inner
+	// runtimes must be on a tmpfs or bind mount rather than the overlay root.
+	NestedContainers bool `flag:"nested-containers"`
+
+	// TimerSlack is the initial timer slack of sandboxed tasks: their timers
+	// may be deferred by up to this long so that timers of different tasks
+	// expire together, reducing sentry wakeups on densely packed hosts. Tasks
+	// can change theirs with prctl(PR_SET_TIMERSLACK). 0 disables coalescing.
+	TimerSlack time.Duration `flag:"timer-slack"`
+
+	// TimerResolution is the minimum resolution of sandboxed task timers:
+	// their expiration times are rounded up to a multiple of it. 0 disables
+	// rounding.
+	TimerResolution time.Duration `flag:"timer-resolution"`
+
+	// DeepSleepDelay is how long all sandboxed tasks must stay blocked before
+	// the sandbox enters deep sleep, parking the sentry more aggressively until
+	// a task runs again. 0 disables deep sleep.
+	DeepSleepDelay time.Duration `flag:"deep-sleep-delay"`
+
+	// DeepSleepGOMAXPROCS is the sentry's GOMAXPROCS while the sandbox is in
+	// deep sleep. 0 leaves GOMAXPROCS unchanged.
+	DeepSleepGOMAXPROCS int `flag:"deep-sleep-gomaxprocs"`
+
+	// SentryGOGC is the GOGC value of the sandbox process's Go runtime, either
+	// "off" or a percentage. Empty leaves the runtime default.
+	SentryGOGC string `flag:"sentry-gogc"`
+
+	// SentryGOMEMLIMIT is the soft memory limit of the sandbox process's Go
+	// runtime. By default, it is derived from the sandbox's cgroup memory
+	// limit, so that the sentry's heap overhead stays bounded relative to it.
+	SentryGOMEMLIMIT GoMemLimit `flag:"sentry-gomemlimit"`
+
+	// SentryGODEBUG is a comma-separated list of GODEBUG settings, e.g.
+	// scheduler knobs, for the sandbox process's Go runtime.
+	SentryGODEBUG string `flag:"sentry-godebug"`
+
+	// SentryMemoryLimit caps the memory used by the sentry itself, as opposed
+	// to memory used on behalf of the application. While it is exceeded, the
+	// sentry's caches stop growing. Percentages are relative to the memory
+	// reported to the application.
+	SentryMemoryLimit GoMemLimit `flag:"sentry-memory-limit"`
+
+	// Init makes the init process of each container reap orphaned processes
+	// as soon as they exit, mirroring "docker run --init" for entrypoints
+	// that don't handle PID 1 responsibilities.
+	Init bool `flag:"init"`
+
+	// CoreDumpDir is the absolute host directory core dumps of sandboxed
+	// processes are written to. Core dumps are disabled if it's empty.
+	CoreDumpDir string `flag:"core-dump-dir"`
+
+	// CorePattern is the name of core dump files in CoreDumpDir. It supports
+	// the same specifiers as core_pattern(5), except for pipes.
+	CorePattern string `flag:"core-pattern"`
+
+	// HostMemoryPressure makes the sandbox subscribe to the PSI memory
+	// pressure of its host cgroup, and evict caches when sandboxed tasks
+	// start stalling on memory. It requires cgroup v2.
+	HostMemoryPressure bool `flag:"host-memory-pressure"`
+
 	// Use pools to manage buffer memory instead of heap.
 	BufferPooling bool `flag:"buffer-pooling"`
 
@@ -264,6 +444,55 @@ type Config struct {
 	// (rather than AF_PACKET). Enabling it disables RX checksum offload.
 	AFXDP bool `flag:"EXPERIMENTAL-afxdp"`
 
+	// VFIONet lists the SR-IOV virtual functions that may be claimed for the
+	// sandbox. Network interfaces backed by an allowed virtual function are
+	// rebound to vfio-pci and driven by the sandbox directly, instead of
+	// through an AF_PACKET socket.
+	VFIONet PCIAllowlist `flag:"vfio-net"`
+
+	// VhostNet makes the sandbox exchange packets with AF_PACKET sockets
+	// through vhost-net virtqueues instead of system calls. It is only
+	// supported by the KVM platform. If vhost-net is unavailable, regular
+	// fd-based links are used.
+	VhostNet bool `flag:"vhost-net"`
+
+	// SharedMemNet is the path of a Unix domain socket on which a host agent
+	// offers a shared memory network channel, see sharedmem.SendChannel. If
+	// set, the channel is added as a network interface of the sandbox,
+	// allowing embedders to exchange packets with the sandbox from userspace
+	// without a tap device.
+	SharedMemNet string `flag:"sharedmem-net"`
+
+	// PortReservationDir is the absolute host directory holding the lock
+	// files that reserve the TCP and UDP ports bound by applications, when
+	// sandboxes share a host network namespace. Sandboxes sharing a network
+	// namespace must use the same directory. Ports aren't reserved if it's
+	// empty.
+	PortReservationDir string `flag:"port-reservation-dir"`
+
+	// TLSInterceptCA is the absolute path of a host PEM file holding a CA
+	// certificate and its private key. If set, TLS connections made by
+	// applications to TLSInterceptPorts are terminated in the sandbox with
+	// certificates issued by the CA and re-originated to their destination,
+	// and their plaintext is sent to the "sentry/tls_plaintext" trace point.
+	// Applications must trust the CA.
+	TLSInterceptCA string `flag:"tls-intercept-ca"`
+
+	// TLSInterceptRoots is the absolute path of a host PEM file holding the
+	// CA certificates that intercepted servers are verified with. If empty,
+	// the CA bundle of the host is used.
+	TLSInterceptRoots string `flag:"tls-intercept-roots"`
+
+	// TLSInterceptPorts is a comma-separated list of destination ports and
+	// port ranges, e.g. "443,8443-8444", of the connections intercepted.
+	TLSInterceptPorts string `flag:"tls-intercept-ports"`
+
+	// TLSInterceptHosts is a comma-separated list of server names, e.g.
+	// "api.example.com,*.example.org", of the connections intercepted. If
+	// empty, connections are intercepted regardless of their server name.
+	// Other connections are forwarded unmodified.
+	TLSInterceptHosts string `flag:"tls-intercept-hosts"`
+
 	// FDLimit specifies a limit on the number of host file descriptors that can
 	// be open simultaneously by the sentry and gofer. It applies separately to
 	// each.
@@ -273,6 +502,10 @@ type Config struct {
 	// used.
 	DCache int `flag:"dcache"`
 
+	// SentryTunables is a comma-separated list of key=value pairs that set
+	// experimental knobs of the sentry at boot, e.g. "kernel.pid_max=131072".
+	SentryTunables string `flag:"sentry-tunables"`
+
 	// IOUring enables support for the IO_URING API calls to perform
 	// asynchronous I/O operations.
 	IOUring bool `flag:"iouring"`
@@ -317,6 +550,12 @@ type Config struct {
 	explicitlySet map[string]struct{}
 }
 
+// Validate checks that the configuration is consistent. It must be called
+// after modifying fields of a Config directly.
+func (c *Config) Validate() error {
+	return c.validate()
+}
+
 func (c *Config) validate() error {
 	if c.Overlay && c.Overlay2.Enabled() {
 		// Deprecated flag was used together with flag that replaced it.
@@ -347,9 +586,153 @@ func (c *Config) validate() error {
 		// Deprecated flag was used together with flag that replaced it.
 		return fmt.Errorf("fsgofer-host-uds has been replaced with host-uds flag")
 	}
+	for _, prefix := range c.HostUDSAllowlist() {
+		if !filepath.IsAbs(prefix) {
+			return fmt.Errorf("host-uds-allow paths must be absolute, got: %q", prefix)
+		}
+	}
+	if c.GRPCControlSocket != "" && !filepath.IsAbs(c.GRPCControlSocket) {
+		return fmt.Errorf("grpc-control-socket must be an absolute path, got: %q", c.GRPCControlSocket)
+	}
+	if c.HostUDSAllow != "" && c.GetHostUDS() == HostUDSNone {
+		return fmt.Errorf("host-uds-allow requires host-uds to allow access to host sockets")
+	}
+	for _, name := range c.AbstractUDSImports() {
+		if name == "" || name == "*" {
+			return fmt.Errorf("abstract-uds-import names can't be empty")
+		}
+	}
+	for _, name := range c.AbstractUDSExports() {
+		if name == "" || strings.Contains(name, "*") {
+			return fmt.Errorf("abstract-uds-export names must be non-empty and can't contain '*', got: %q", name)
+		}
+		for _, imp := range c.AbstractUDSImports() {
+			if imp == name || (strings.HasSuffix(imp, "*") && strings.HasPrefix(name, imp[:len(imp)-1])) {
+				// Connections would loop back to the exported socket.
+				return fmt.Errorf("abstract socket %q can't be both imported and exported", name)
+			}
+		}
+	}
+	if _, err := cpuid.ParseFeatureMask(c.CPUFeatures); err != nil {
+		return fmt.Errorf("invalid cpu-features: %w", err)
+	}
+	if c.TimerSlack < 0 {
+		return fmt.Errorf("timer-slack must be >= 0, got: %v", c.TimerSlack)
+	}
+	if c.TimerResolution < 0 {
+		return fmt.Errorf("timer-resolution must be >= 0, got: %v", c.TimerResolution)
+	}
+	if c.DeepSleepDelay < 0 {
+		return fmt.Errorf("deep-sleep-delay must be >= 0, got: %v", c.DeepSleepDelay)
+	}
+	if c.DeepSleepGOMAXPROCS < 0 {
+		return fmt.Errorf("deep-sleep-gomaxprocs must be >= 0, got: %d", c.DeepSleepGOMAXPROCS)
+	}
+	if c.DeepSleepGOMAXPROCS > 0 && c.DeepSleepDelay == 0 {
+		return fmt.Errorf("deep-sleep-gomaxprocs requires deep-sleep-delay")
+	}
+	if c.SentryGOGC != "" && c.SentryGOGC != "off" {
+		if n, err := strconv.Atoi(c.SentryGOGC); err != nil || n < 0 {
+			return fmt.Errorf("sentry-gogc must be \"off\" or a non-negative integer, got: %q", c.SentryGOGC)
+		}
+	}
+	if c.SentryGODEBUG != "" {
+		for _, setting := range strings.Split(c.SentryGODEBUG, ",") {
+			if k, _, ok := strings.Cut(setting, "="); !ok || k == "" {
+				return fmt.Errorf("sentry-godebug settings must be of the form key=value, got: %q", setting)
+			}
+		}
+	}
+	if c.EntropySeed != "" && c.EntropySource != "" {
+		return fmt.Errorf("entropy-seed and entropy-source flags are mutually exclusive")
+	}
+	if c.EntropySource != "" && !filepath.IsAbs(c.EntropySource) {
+		return fmt.Errorf("entropy-source must be an absolute path, got: %q", c.EntropySource)
+	}
+	if c.PortReservationDir != "" {
+		if !filepath.IsAbs(c.PortReservationDir) {
+			return fmt.Errorf("port-reservation-dir must be an absolute path, got: %q", c.PortReservationDir)
+		}
+		if c.Network != NetworkSandbox {
+			return fmt.Errorf("port-reservation-dir requires --network=sandbox, got: %v", c.Network)
+		}
+	}
+	if c.FlightRecorder != "" && !filepath.IsAbs(c.FlightRecorder) {
+		return fmt.Errorf("flight-recorder must be an absolute path, got: %q", c.FlightRecorder)
+	}
+	if c.TLSInterceptCA != "" {
+		if !filepath.IsAbs(c.TLSInterceptCA) {
+			return fmt.Errorf("tls-intercept-ca must be an absolute path, got: %q", c.TLSInterceptCA)
+		}
+		if c.TLSInterceptRoots != "" && !filepath.IsAbs(c.TLSInterceptRoots) {
+			return fmt.Errorf("tls-intercept-roots must be an absolute path, got: %q", c.TLSInterceptRoots)
+		}
+		if c.Network != NetworkSandbox {
+			return fmt.Errorf("tls-intercept-ca requires --network=sandbox, got: %v", c.Network)
+		}
+	}
+	if c.CoreDumpDir != "" {
+		if !filepath.IsAbs(c.CoreDumpDir) {
+			return fmt.Errorf("core-dump-dir must be an absolute path, got: %q", c.CoreDumpDir)
+		}
+		if c.CorePattern == "" || strings.HasPrefix(c.CorePattern, "|") || strings.Contains(c.CorePattern, "/") {
+			return fmt.Errorf("core-pattern must be a file name and can't be a pipe, got: %q", c.CorePattern)
+		}
+	}
+	if c.VFIONet.Enabled() && c.Network != NetworkSandbox {
+		return fmt.Errorf("vfio-net flag requires --network=sandbox")
+	}
+	if c.VhostNet {
+		if c.Platform != "kvm" {
+			return fmt.Errorf("vhost-net flag requires --platform=kvm, got %q", c.Platform)
+		}
+		if c.Network != NetworkSandbox {
+			return fmt.Errorf("vhost-net flag requires --network=sandbox")
+		}
+		if c.AFXDP {
+			return fmt.Errorf("vhost-net and EXPERIMENTAL-afxdp flags can't be used together")
+		}
+		if c.NumNetworkChannels != 1 {
+			return fmt.Errorf("vhost-net flag requires --num-network-channels=1, got %d", c.NumNetworkChannels)
+		}
+	}
+	if c.SharedMemNet != "" && c.Network == NetworkHost {
+		return fmt.Errorf("sharedmem-net flag can't be used with --network=host")
+	}
 	return nil
 }
 
+// HostUDSAllowlist returns the host path prefixes of HostUDSAllow.
+func (c *Config) HostUDSAllowlist() []string {
+	if c.HostUDSAllow == "" {
+		return nil
+	}
+	return strings.Split(c.HostUDSAllow, ",")
+}
+
+// AbstractUDSImports returns the names of AbstractUDSImport, without the
+// optional leading '@'.
+func (c *Config) AbstractUDSImports() []string {
+	return abstractUDSNames(c.AbstractUDSImport)
+}
+
+// AbstractUDSExports returns the names of AbstractUDSExport, without the
+// optional leading '@'.
+func (c *Config) AbstractUDSExports() []string {
+	return abstractUDSNames(c.AbstractUDSExport)
+}
+
+func abstractUDSNames(list string) []string {
+	if list == "" {
+		return nil
+	}
+	names := strings.Split(list, ",")
+	for i, name := range names {
+		names[i] = strings.TrimPrefix(name, "@")
+	}
+	return names
+}
+
 // GetHostUDS returns the FS gofer communication that is allowed, taking into
 // consideration all flags what affect the result.
 func (c *Config) GetHostUDS() HostUDS {
@@ -716,6 +1099,167 @@ func (g HostFifo) AllowOpen() bool {
 	return g&HostFifoOpen != 0
 }
 
+// MappedFileTruncate tells what applications observe when a host file that
+// they have memory-mapped is truncated outside of the sandbox.
+type MappedFileTruncate int
+
+const (
+	// MappedFileTruncateSIGBUS delivers SIGBUS, with the faulting address, to
+	// applications that access the mapping beyond the host file's new EOF, as
+	// Linux does.
+	MappedFileTruncateSIGBUS MappedFileTruncate = iota
+
+	// MappedFileTruncateEIO is MappedFileTruncateSIGBUS, except that reads
+	// and writes of the file additionally fail with EIO after such an access,
+	// until the application truncates the file itself.
+	MappedFileTruncateEIO
+
+	// MappedFileTruncatePin maps files from the sentry's page cache rather
+	// than from the host file, so that truncation outside of the sandbox
+	// doesn't affect mapped pages. This uses more memory.
+	MappedFileTruncatePin
+)
+
+func mappedFileTruncatePtr(v MappedFileTruncate) *MappedFileTruncate {
+	return &v
+}
+
+// Set implements flag.Value.
+func (m *MappedFileTruncate) Set(v string) error {
+	switch v {
+	case "", "sigbus":
+		*m = MappedFileTruncateSIGBUS
+	case "eio":
+		*m = MappedFileTruncateEIO
+	case "pin":
+		*m = MappedFileTruncatePin
+	default:
+		return fmt.Errorf("invalid mapped file truncate policy %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (m *MappedFileTruncate) Get() any {
+	return *m
+}
+
+// String implements flag.Value.
+func (m MappedFileTruncate) String() string {
+	switch m {
+	case MappedFileTruncateSIGBUS:
+		return "sigbus"
+	case MappedFileTruncateEIO:
+		return "eio"
+	case MappedFileTruncatePin:
+		return "pin"
+	default:
+		panic(fmt.Sprintf("Invalid mapped file truncate policy %d", m))
+	}
+}
+
+// SysctlPolicy tells what to do with sysctls from the OCI spec that the
+// sandbox can't honor.
+type SysctlPolicy int
+
+const (
+	// SysctlPolicyWarn logs sysctls that can't be applied and starts the
+	// container anyway.
+	SysctlPolicyWarn SysctlPolicy = iota
+
+	// SysctlPolicyStrict fails the container start if any sysctl can't be
+	// applied.
+	SysctlPolicyStrict
+)
+
+func sysctlPolicyPtr(v SysctlPolicy) *SysctlPolicy {
+	return &v
+}
+
+// Set implements flag.Value.
+func (p *SysctlPolicy) Set(v string) error {
+	switch v {
+	case "", "warn":
+		*p = SysctlPolicyWarn
+	case "strict":
+		*p = SysctlPolicyStrict
+	default:
+		return fmt.Errorf("invalid sysctl policy %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (p *SysctlPolicy) Get() any {
+	return *p
+}
+
+// String implements flag.Value.
+func (p SysctlPolicy) String() string {
+	switch p {
+	case SysctlPolicyWarn:
+		return "warn"
+	case SysctlPolicyStrict:
+		return "strict"
+	default:
+		panic(fmt.Sprintf("Invalid sysctl policy %d", p))
+	}
+}
+
+// LSM is the Linux Security Module presented to applications. gVisor doesn't
+// enforce LSM policies: tasks and files are always unconfined.
+type LSM int
+
+const (
+	// LSMNone presents no LSM.
+	LSMNone LSM = iota
+
+	// LSMAppArmor presents AppArmor, enabled, with every task unconfined.
+	LSMAppArmor
+
+	// LSMSELinux presents SELinux labels on tasks and files, without
+	// selinuxfs, so SELinux appears disabled to libselinux.
+	LSMSELinux
+)
+
+func lsmPtr(v LSM) *LSM {
+	return &v
+}
+
+// Set implements flag.Value.
+func (l *LSM) Set(v string) error {
+	switch v {
+	case "", "none":
+		*l = LSMNone
+	case "apparmor":
+		*l = LSMAppArmor
+	case "selinux":
+		*l = LSMSELinux
+	default:
+		return fmt.Errorf("invalid LSM %q", v)
+	}
+	return nil
+}
+
+// Get implements flag.Value.
+func (l *LSM) Get() any {
+	return *l
+}
+
+// String implements flag.Value.
+func (l LSM) String() string {
+	switch l {
+	case LSMNone:
+		return "none"
+	case LSMAppArmor:
+		return "apparmor"
+	case LSMSELinux:
+		return "selinux"
+	default:
+		panic(fmt.Sprintf("Invalid LSM %d", l))
+	}
+}
+
 // Overlay2 holds the configuration for setting up overlay filesystems for the
 // container.
 type Overlay2 struct {
@@ -829,3 +1373,222 @@ func (o *Overlay2) HostFileDir() string {
 	}
 	return hostFileDir
 }
+
+// defaultAutoCheckpointKeep is the number of images retained by
+// AutoCheckpoint when keep isn't specified.
+const defaultAutoCheckpointKeep = 3
+
+// AutoCheckpoint holds the configuration for periodic checkpoints taken by the
+// sandbox. The zero value disables it. Each checkpoint is a full save;
+// incremental checkpoints are not supported.
+type AutoCheckpoint struct {
+	// Interval is the time between two checkpoints.
+	Interval time.Duration
+
+	// Dir is the host directory where checkpoint images are written.
+	Dir string
+
+	// Keep is the number of most recent images to retain.
+	Keep int
+}
+
+// Set implements flag.Value.
+func (a *AutoCheckpoint) Set(v string) error {
+	if v == "" {
+		*a = AutoCheckpoint{}
+		return nil
+	}
+	vs := strings.Split(v, ",")
+	if len(vs) < 2 || len(vs) > 3 {
+		return fmt.Errorf("expected format is --auto-checkpoint={interval},{dir}[,keep={N}], got %q", v)
+	}
+	interval, err := time.ParseDuration(vs[0])
+	if err != nil {
+		return fmt.Errorf("invalid auto-checkpoint interval %q: %v", vs[0], err)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("auto-checkpoint interval must be positive, got %v", interval)
+	}
+	if !filepath.IsAbs(vs[1]) {
+		return fmt.Errorf("auto-checkpoint directory should be an absolute path, got %q", vs[1])
+	}
+	keep := defaultAutoCheckpointKeep
+	if len(vs) == 3 {
+		n, ok := strings.CutPrefix(vs[2], "keep=")
+		if !ok {
+			return fmt.Errorf("unexpected auto-checkpoint option %q", vs[2])
+		}
+		keep, err = strconv.Atoi(n)
+		if err != nil || keep < 1 {
+			return fmt.Errorf("auto-checkpoint keep must be a positive integer, got %q", n)
+		}
+	}
+	*a = AutoCheckpoint{Interval: interval, Dir: vs[1], Keep: keep}
+	return nil
+}
+
+// Get implements flag.Value.
+func (a *AutoCheckpoint) Get() any {
+	return *a
+}
+
+// String implements flag.Value.
+func (a AutoCheckpoint) String() string {
+	if !a.Enabled() {
+		return ""
+	}
+	return fmt.Sprintf("%s,%s,keep=%d", a.Interval, a.Dir, a.Keep)
+}
+
+// Enabled returns true if periodic checkpoints are enabled.
+func (a *AutoCheckpoint) Enabled() bool {
+	return a.Interval > 0
+}
+
+// PCIAllowlist is a list of patterns matching PCI device addresses, e.g.
+// 0000:3b:02.*, using the syntax of path.Match. The zero value allows no
+// device.
+type PCIAllowlist struct {
+	patterns []string
+}
+
+// Set implements flag.Value.
+func (p *PCIAllowlist) Set(v string) error {
+	if v == "" {
+		*p = PCIAllowlist{}
+		return nil
+	}
+	patterns := strings.Split(v, ",")
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("empty PCI address pattern in %q", v)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid PCI address pattern %q: %v", pattern, err)
+		}
+	}
+	*p = PCIAllowlist{patterns: patterns}
+	return nil
+}
+
+// Get implements flag.Value.
+func (p *PCIAllowlist) Get() any {
+	return *p
+}
+
+// String implements flag.Value.
+func (p PCIAllowlist) String() string {
+	return strings.Join(p.patterns, ",")
+}
+
+// Enabled returns true if any device is allowed.
+func (p *PCIAllowlist) Enabled() bool {
+	return len(p.patterns) > 0
+}
+
+// Allows returns true if the PCI device with address addr is allowed.
+func (p *PCIAllowlist) Allows(addr string) bool {
+	for _, pattern := range p.patterns {
+		if ok, _ := path.Match(pattern, addr); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// goMemLimitUnits are the units accepted by GOMEMLIMIT, see runtime/debug.
+var goMemLimitUnits = []struct {
+	suffix string
+	shift  uint
+}{
+	{"TiB", 40},
+	{"GiB", 30},
+	{"MiB", 20},
+	{"KiB", 10},
+	{"B", 0},
+}
+
+// GoMemLimit is a limit on the memory of the sandbox process's Go runtime, e.g.
+// its soft memory limit (GOMEMLIMIT). The zero value sets no limit.
+type GoMemLimit struct {
+	// Percent, if non-zero, sets the limit to this percentage of the memory
+	// limit of the sandbox's cgroup.
+	Percent int
+
+	// Bytes, if non-zero, is the limit in bytes.
+	Bytes uint64
+}
+
+func goMemLimitPtr(v GoMemLimit) *GoMemLimit {
+	return &v
+}
+
+// Set implements flag.Value. Accepted values are "off", a percentage of the
+// sandbox's memory limit, e.g. "25%", or an absolute limit in the format of
+// GOMEMLIMIT, e.g. "512MiB".
+func (g *GoMemLimit) Set(v string) error {
+	if v == "" || v == "off" {
+		*g = GoMemLimit{}
+		return nil
+	}
+	if n, ok := strings.CutSuffix(v, "%"); ok {
+		percent, err := strconv.Atoi(n)
+		if err != nil || percent <= 0 || percent > 100 {
+			return fmt.Errorf("invalid memory limit percentage %q, must be in (0, 100]", v)
+		}
+		*g = GoMemLimit{Percent: percent}
+		return nil
+	}
+	n, shift := v, uint(0)
+	for _, unit := range goMemLimitUnits {
+		if s, ok := strings.CutSuffix(v, unit.suffix); ok {
+			n, shift = s, unit.shift
+			break
+		}
+	}
+	bytes, err := strconv.ParseUint(n, 10, 64)
+	if err != nil || bytes == 0 || bytes > math.MaxUint64>>shift {
+		return fmt.Errorf("invalid memory limit %q", v)
+	}
+	*g = GoMemLimit{Bytes: bytes << shift}
+	return nil
+}
+
+// Get implements flag.Value.
+func (g *GoMemLimit) Get() any {
+	return *g
+}
+
+// String implements flag.Value.
+func (g GoMemLimit) String() string {
+	switch {
+	case g.Percent != 0:
+		return fmt.Sprintf("%d%%", g.Percent)
+	case g.Bytes != 0:
+		return strconv.FormatUint(g.Bytes, 10)
+	default:
+		return "off"
+	}
+}
+
+// minGoMemLimit is the lowest limit derived from a percentage of the
+// sandbox's memory limit. Below it, the sentry's baseline heap alone would
+// keep the garbage collector running continuously.
+const minGoMemLimit = 64 << 20
+
+// Limit returns the limit in bytes for a sandbox whose cgroup memory limit is
+// memLimit, or 0 if no limit should be set. memLimit is 0 if the sandbox's
+// memory isn't limited, in which case percentages don't set any limit.
+func (g *GoMemLimit) Limit(memLimit uint64) uint64 {
+	if g.Percent == 0 {
+		return g.Bytes
+	}
+	if memLimit == 0 {
+		return 0
+	}
+	limit := memLimit / 100 * uint64(g.Percent)
+	if limit < minGoMemLimit {
+		limit = minGoMemLimit
+	}
+	return limit
+}
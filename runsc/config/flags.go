@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/refs"
@@ -48,9 +49,12 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.String("debug-log", "", "additional location for logs. If it ends with '/', log files are created inside the directory with default names. The following variables are available: %TIMESTAMP%, %COMMAND%.")
 	flagSet.String("debug-command", "", `comma-separated list of commands to be debugged if --debug-log is also set. Empty means debug all. "!" negates the expression. E.g. "create,start" or "!boot,events"`)
 	flagSet.String("panic-log", "", "file path where panic reports and other Go's runtime messages are written.")
+	flagSet.String("sandbox-exit-hook", "", "program to run, or unix:<path> socket to write to, when the sandbox process exits unexpectedly. It receives a JSON description of the exit.")
 	flagSet.String("coverage-report", "", "file path where Go coverage reports are written. Reports will only be generated if runsc is built with --collect_code_coverage and --instrumentation_filter Bazel flags.")
 	flagSet.Bool("log-packets", false, "enable network packet logging.")
 	flagSet.String("pcap-log", "", "location of PCAP log file.")
+	flagSet.String("flight-recorder", "", "absolute host directory holding a flight recorder ring per sandbox. If set, process lifecycle, file open and network trace points, and network packets, are recorded in a size-bounded ring that can be read with 'runsc trace export'.")
+	flagSet.Uint("flight-recorder-size", 256, "size of each flight recorder ring, in MiB.")
 	flagSet.String("debug-log-format", "text", "log format: text (default), json, or json-k8s.")
 	// Only register -alsologtostderr flag if it is not already defined on this flagSet.
 	if flagSet.Lookup("alsologtostderr") == nil {
@@ -62,6 +66,9 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	// Metrics flags.
 	flagSet.String("metric-server", "", "if set, export metrics on this address. This may either be 1) 'addr:port' to export metrics on a specific network interface address, 2) ':port' for exporting metrics on all interfaces, or 3) an absolute path to a Unix Domain Socket. The substring '%ID%' will be replaced by the container ID, and '%RUNTIME_ROOT%' by the root. This flag must be specified in both `runsc metric-server` and `runsc create`, and their values must match.")
 
+	// Control flags.
+	flagSet.String("grpc-control-socket", "", "if set, absolute path of a Unix domain socket on which the sandbox serves a gRPC API to manage its containers, in addition to the control socket used by runsc. The substring '%ID%' will be replaced by the sandbox ID.")
+
 	// Debugging flags: strace related
 	flagSet.Bool("strace", false, "enable strace.")
 	flagSet.String("strace-syscalls", "", "comma-separated list of syscalls to trace. If --strace is true and this list is empty, then all syscalls will be traced.")
@@ -73,6 +80,7 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.String("platform_device_path", "", "path to a platform-specific device file (e.g. /dev/kvm for KVM platform). If unset, will use a sane platform-specific default.")
 	flagSet.Var(watchdogActionPtr(watchdog.LogWarning), "watchdog-action", "sets what action the watchdog takes when triggered: log (default), panic.")
 	flagSet.Int("panic-signal", -1, "register signal handling that panics. Usually set to SIGUSR2(12) to troubleshoot hangs. -1 disables it.")
+	flagSet.Duration("fd-audit-interval", time.Minute, "interval at which the sandbox and gofer processes audit their host FD tables, warning when they get close to RLIMIT_NOFILE or FDs leak. 0 disables auditing.")
 	flagSet.Bool("profile", false, "prepares the sandbox to use Golang profiler. Note that enabling profiler loosens the seccomp protection added to the sandbox (DO NOT USE IN PRODUCTION).")
 	flagSet.String("profile-block", "", "collects a block profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("profile-cpu", "", "collects a CPU profile to this file path for the duration of the container execution. Requires -profile=true.")
@@ -80,20 +88,48 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.String("profile-mutex", "", "collects a mutex profile to this file path for the duration of the container execution. Requires -profile=true.")
 	flagSet.String("trace", "", "collects a Go runtime execution trace to this file path for the duration of the container execution.")
 	flagSet.Bool("rootless", false, "it allows the sandbox to be started with a user that is not root. Sandbox and Gofer processes may run with same privileges as current user.")
+	flagSet.Bool("skip-host-checks", false, "skip the checks that the host supports the kernel features required to start a sandbox.")
 	flagSet.Var(leakModePtr(refs.NoLeakChecking), "ref-leak-mode", "sets reference leak check mode: disabled (default), log-names, log-traces.")
 	flagSet.Bool("cpu-num-from-quota", false, "set cpu number to cpu quota (least integer greater or equal to quota value, but not less than 2)")
+	flagSet.Int("cpu-num-max", 0, "maximum number of CPUs the sandbox can be resized to at runtime with 'runsc update'. Defaults to the number of CPUs it starts with.")
+	flagSet.String("cpu-features", "", "comma-separated list of CPU features to hide from the sandbox, each prefixed with '-', e.g. -avx512f,-rtm,-hle. Features depending on a hidden feature are hidden too.")
+	flagSet.String("entropy-seed", "", "seed for all entropy handed to the sandbox, e.g. by getrandom(2) and /dev/urandom, making it reproducible. For tests only.")
+	flagSet.String("entropy-source", "", "absolute path of a host file, e.g. /dev/hwrng, that the entropy handed to the sandbox is seeded and periodically reseeded from.")
 	flagSet.Bool("oci-seccomp", false, "Enables loading OCI seccomp filters inside the sandbox.")
+	flagSet.Var(sysctlPolicyPtr(SysctlPolicyWarn), "sysctl-policy", "what to do with sysctls from the OCI spec that can't be applied inside the sandbox. Values: warn|strict. warn logs them and starts the container, strict fails the container start.")
+	flagSet.Var(lsmPtr(LSMNone), "lsm", "Linux Security Module presented to applications probing for one, no policy is enforced. Values: none|apparmor|selinux. apparmor reports every task as unconfined, selinux labels tasks and files with unconfined contexts.")
 	flagSet.Bool("enable-core-tags", false, "enables core tagging. Requires host linux kernel >= 5.14.")
 	flagSet.String("pod-init-config", "", "path to configuration file with additional steps to take during pod creation.")
+	flagSet.Var(&AutoCheckpoint{}, "auto-checkpoint", "periodically checkpoint the sandbox while it keeps running. Format is {interval},{dir}[,keep={N}], e.g. 10m,/var/lib/checkpoints,keep=3. Images are written to the absolute host directory dir, and only the N most recent are retained (default 3). Each image is a full checkpoint: incremental checkpoints are not supported.")
+	flagSet.Bool("checkpoint-checksums", false, "checksum the memory pages and state data of checkpoint images, so that corruption is detected on restore and by 'runsc state -verify'.")
+	flagSet.Bool("nested-containers", false, "EXPERIMENTAL: enable the kernel features required to run container runtimes, e.g. runc or podman, inside the sandbox. Cgroup v2 and overlay upper layers on the rootfs overlay are not supported.")
+	flagSet.Duration("timer-slack", 0, "initial timer slack of sandboxed tasks (e.g. \"50us\"): timers may be deferred by up to this long to coalesce sentry wakeups. Tasks can change it with prctl(PR_SET_TIMERSLACK). 0 disables coalescing.")
+	flagSet.Duration("timer-resolution", 0, "minimum resolution of sandboxed task timers (e.g. \"1ms\"): expiration times are rounded up to a multiple of it. 0 disables rounding.")
+	flagSet.Duration("deep-sleep-delay", 0, "how long all sandboxed tasks must stay blocked before the sandbox enters deep sleep, parking the sentry more aggressively until a task runs again. 0 disables deep sleep.")
+	flagSet.Int("deep-sleep-gomaxprocs", 0, "GOMAXPROCS of the sentry while the sandbox is in deep sleep. 0 leaves it unchanged.")
+	flagSet.String("sentry-gogc", "", "GOGC of the sandbox process's Go runtime: \"off\" or a percentage. Empty leaves the runtime default.")
+	flagSet.Var(goMemLimitPtr(GoMemLimit{Percent: 25}), "sentry-gomemlimit", "soft memory limit (GOMEMLIMIT) of the sandbox process's Go runtime: \"off\", a percentage of the sandbox's cgroup memory limit (at least 64MiB), e.g. 25%, or an absolute size, e.g. 512MiB. Percentages set no limit if the sandbox's memory isn't limited.")
+	flagSet.Var(&GoMemLimit{}, "sentry-memory-limit", "cap on the memory used by the sentry itself rather than on behalf of the application: \"off\", a percentage of the sandbox's memory limit, e.g. 10%, or an absolute size, e.g. 256MiB. While it is exceeded, the sentry's caches stop growing.")
+	flagSet.String("sentry-godebug", "", "comma-separated list of GODEBUG settings, e.g. scheduler knobs, for the sandbox process's Go runtime.")
+	flagSet.Bool("init", false, "make the init process of each container reap orphaned zombie processes, like docker run --init.")
+	flagSet.String("core-dump-dir", "", "absolute host directory core dumps of sandboxed processes are written to, subject to RLIMIT_CORE. Empty disables core dumps.")
+	flagSet.String("core-pattern", "core.%e.%p.%t", "name of core dump files in --core-dump-dir. Supports the specifiers of core_pattern(5), except for pipes.")
+	flagSet.Bool("host-memory-pressure", false, "evict sandbox caches when the sandbox's host cgroup reports memory pressure through PSI. Requires cgroup v2.")
 
 	// Flags that control sandbox runtime behavior: FS related.
 	flagSet.Var(fileAccessTypePtr(FileAccessExclusive), "file-access", "specifies which filesystem validation to use for the root mount: exclusive (default), shared.")
 	flagSet.Var(fileAccessTypePtr(FileAccessShared), "file-access-mounts", "specifies which filesystem validation to use for volumes other than the root mount: shared (default), exclusive.")
 	flagSet.Bool("overlay", false, "DEPRECATED: use --overlay2=all:memory to achieve the same effect")
 	flagSet.Var(defaultOverlay2(), "overlay2", "wrap mounts with overlayfs. Format is {mount}:{medium}, where 'mount' can be 'root' or 'all' and medium can be 'memory', 'self' or 'dir=/abs/dir/path' in which filestore will be created. 'none' will turn overlay mode off.")
+	flagSet.Bool("overlay-metacopy", true, "in overlays set up by --overlay2, copy up only the metadata of files whose attributes change (e.g. by chown or chmod), and rename directories without copying up their contents.")
 	flagSet.Bool("fsgofer-host-uds", false, "DEPRECATED: use host-uds=all")
 	flagSet.Var(hostUDSPtr(HostUDSNone), "host-uds", "controls permission to access host Unix-domain sockets. Values: none|open|create|all, default: none")
+	flagSet.String("host-uds-allow", "", "comma-separated list of host path prefixes. If set, or if bind mounts have the host-uds-allow option, only host Unix-domain sockets under these prefixes or mounts may be accessed, as allowed by --host-uds.")
+	flagSet.String("abstract-uds-import", "", "comma-separated list of abstract Unix-domain socket names, optionally starting with '@', in the sandbox's host network namespace that applications may connect to. Names ending with '*' match prefixes.")
+	flagSet.String("abstract-uds-export", "", "comma-separated list of abstract Unix-domain socket names, optionally starting with '@', bound by applications that are exposed in the sandbox's host network namespace.")
 	flagSet.Var(hostFifoPtr(HostFifoNone), "host-fifo", "controls permission to access host FIFOs (or named pipes). Values: none|open, default: none")
+	flagSet.Var(mappedFileTruncatePtr(MappedFileTruncateSIGBUS), "mapped-file-truncate", "controls what applications observe when a memory-mapped host file is truncated outside of the sandbox. Values: sigbus (SIGBUS at the faulting address), eio (also fail later reads and writes of the file with EIO), pin (map files from sentry memory instead of the host file), default: sigbus")
+	flagSet.Duration("gofer-recovery-timeout", 0, "time to wait for a dead gofer to be restarted, e.g. with the sandbox API, before killing its container. Open files are reopened by path where safe. 0 disables recovery.")
 
 	flagSet.Bool("vfs2", true, "DEPRECATED: this flag has no effect.")
 	flagSet.Bool("fuse", true, "DEPRECATED: this flag has no effect.")
@@ -102,6 +138,7 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Bool("ignore-cgroups", false, "don't configure cgroups.")
 	flagSet.Int("fdlimit", -1, "Specifies a limit on the number of host file descriptors that can be open. Applies separately to the sentry and gofer. Note: each file in the sandbox holds more than one host FD open.")
 	flagSet.Int("dcache", -1, "Set the global dentry cache size. This acts as a coarse-grained control on the number of host FDs simultaneously open by the sentry. If negative, per-mount caches are used.")
+	flagSet.String("sentry-tunables", "", "comma-separated list of key=value pairs that set experimental knobs of the sentry, e.g. kernel.pid_max=131072. Use \"runsc debug --tunables\" to list the knobs and their values.")
 	flagSet.Bool("iouring", false, "TEST ONLY; Enables io_uring syscalls in the sentry. Support is experimental and very limited.")
 	flagSet.Bool("directfs", true, "directly access the container filesystems from the sentry. Sentry runs with higher privileges.")
 
@@ -113,10 +150,19 @@ func RegisterFlags(flagSet *flag.FlagSet) {
 	flagSet.Duration("gvisor-gro", 0, "(e.g. \"20000ns\" or \"1ms\") sets gVisor's generic receive offload timeout. Zero bypasses GRO.")
 	flagSet.Bool("tx-checksum-offload", false, "enable TX checksum offload.")
 	flagSet.Bool("rx-checksum-offload", true, "enable RX checksum offload.")
+	flagSet.Bool("tcp-repair", false, "preserve established TCP connections across checkpoint/restore. The restored sandbox must have the same IP addresses.")
 	flagSet.Var(queueingDisciplinePtr(QDiscFIFO), "qdisc", "specifies which queueing discipline to apply by default to the non loopback nics used by the sandbox.")
 	flagSet.Int("num-network-channels", 1, "number of underlying channels(FDs) to use for network link endpoints.")
 	flagSet.Bool("buffer-pooling", true, "enable allocation of buffers from a shared pool instead of the heap.")
 	flagSet.Bool("EXPERIMENTAL-afxdp", false, "EXPERIMENTAL. Use an AF_XDP socket to receive packets.")
+	flagSet.Bool("vhost-net", false, "exchange packets with the host through vhost-net virtqueues instead of system calls. Requires --platform=kvm. Falls back to AF_PACKET sockets if vhost-net is unavailable.")
+	flagSet.String("sharedmem-net", "", "path of a Unix domain socket on which a host agent offers a shared memory network channel. The channel is added as a network interface of the sandbox.")
+	flagSet.String("tls-intercept-ca", "", "absolute path of a host PEM file holding a CA certificate and its private key. Enables the interception of TLS connections made by applications: they are terminated in the sandbox with certificates issued by the CA, and their plaintext is sent to the sentry/tls_plaintext trace point. Applications must trust the CA. Requires --network=sandbox.")
+	flagSet.String("tls-intercept-roots", "", "absolute path of a host PEM file holding the CA certificates that servers of intercepted TLS connections are verified with. Defaults to the CA bundle of the host.")
+	flagSet.String("tls-intercept-ports", "443", "comma-separated list of destination ports and port ranges of the TLS connections intercepted with --tls-intercept-ca.")
+	flagSet.String("tls-intercept-hosts", "", "comma-separated list of server names, e.g. *.example.com, of the TLS connections intercepted with --tls-intercept-ca. All server names are intercepted if empty.")
+	flagSet.String("port-reservation-dir", "", "absolute host directory holding lock files that reserve the TCP and UDP ports bound by applications in sandboxes joining the same network namespace, so that conflicting binds fail with EADDRINUSE. Requires --network=sandbox.")
+	flagSet.Var(&PCIAllowlist{}, "vfio-net", "comma-separated list of PCI addresses of SR-IOV virtual functions that may be claimed for the sandbox, e.g. 0000:3b:02.*. Network interfaces backed by an allowed virtual function are rebound to vfio-pci and driven by the sandbox directly. Only virtio network devices are supported.")
 
 	// Flags that control sandbox runtime behavior: accelerator related.
 	flagSet.Bool("nvproxy", false, "EXPERIMENTAL: enable support for Nvidia GPUs")
@@ -172,8 +218,10 @@ func isFlagExplicitlySet(flagSet *flag.FlagSet, name string) bool {
 }
 
 // NewFromFlags creates a new Config with values coming from command line flags.
+// Flags that aren't registered in flagSet take their default value.
 func NewFromFlags(flagSet *flag.FlagSet) (*Config, error) {
 	conf := &Config{explicitlySet: map[string]struct{}{}}
+	var defaults *flag.FlagSet
 
 	obj := reflect.ValueOf(conf).Elem()
 	st := obj.Type()
@@ -186,7 +234,15 @@ func NewFromFlags(flagSet *flag.FlagSet) (*Config, error) {
 		}
 		fl := flagSet.Lookup(name)
 		if fl == nil {
-			panic(fmt.Sprintf("Flag %q not found", name))
+			// flagSet doesn't come from RegisterFlags, e.g. it belongs to a
+			// program embedding runsc. Use the default value.
+			if defaults == nil {
+				defaults = flag.NewFlagSet("defaults", flag.ContinueOnError)
+				RegisterFlags(defaults)
+			}
+			if fl = defaults.Lookup(name); fl == nil {
+				return nil, fmt.Errorf("flag %q not found", name)
+			}
 		}
 		x := reflect.ValueOf(flag.Get(fl.Value))
 		obj.Field(i).Set(x)
@@ -194,20 +250,24 @@ func NewFromFlags(flagSet *flag.FlagSet) (*Config, error) {
 			conf.explicitlySet[name] = struct{}{}
 		}
 	}
+	conf.setDefaultRootDir()
+
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
 
-	if len(conf.RootDir) == 0 {
+// setDefaultRootDir sets RootDir if it isn't set.
+func (c *Config) setDefaultRootDir() {
+	if len(c.RootDir) == 0 {
 		// If not set, set default root dir to something (hopefully) user-writeable.
-		conf.RootDir = "/var/run/runsc"
+		c.RootDir = "/var/run/runsc"
 		// NOTE: empty values for XDG_RUNTIME_DIR should be ignored.
 		if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
-			conf.RootDir = filepath.Join(runtimeDir, "runsc")
+			c.RootDir = filepath.Join(runtimeDir, "runsc")
 		}
 	}
-
-	if err := conf.validate(); err != nil {
-		return nil, err
-	}
-	return conf, nil
 }
 
 // NewFromBundle makes a new config from a Bundle.
@@ -358,8 +418,7 @@ func (c *Config) Override(flagSet *flag.FlagSet, name string, value string, forc
 		}
 		fl := flagSet.Lookup(name)
 		if fl == nil {
-			// Flag must exist if there is a field match above.
-			panic(fmt.Sprintf("Flag %q not found", name))
+			return fmt.Errorf("flag %q is not registered in the flag set", name)
 		}
 		if !force {
 			if err := c.isOverrideAllowed(name, value); err != nil {
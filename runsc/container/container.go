@@ -18,8 +18,10 @@ package container
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -37,7 +39,10 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/control"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/pgalloc"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
 	"github.com/talismancer/gvisor-ligolo/pkg/sighandling"
+	"github.com/talismancer/gvisor-ligolo/pkg/state"
+	"github.com/talismancer/gvisor-ligolo/pkg/state/statefile"
 	"github.com/talismancer/gvisor-ligolo/runsc/boot"
 	"github.com/talismancer/gvisor-ligolo/runsc/cgroup"
 	"github.com/talismancer/gvisor-ligolo/runsc/config"
@@ -45,11 +50,20 @@ import (
 	"github.com/talismancer/gvisor-ligolo/runsc/donation"
 	"github.com/talismancer/gvisor-ligolo/runsc/sandbox"
 	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+	"github.com/talismancer/gvisor-ligolo/runsc/version"
 	"golang.org/x/sys/unix"
 )
 
 const cgroupParentAnnotation = "dev.gvisor.spec.cgroup-parent"
 
+// specMetadataKey is the checkpoint image metadata key holding the spec of
+// the checkpointed container in JSON format.
+const specMetadataKey = "container_spec"
+
+// versionMetadataKey is the checkpoint image metadata key holding the version
+// of runsc that took the checkpoint.
+const versionMetadataKey = "runsc_version"
+
 // validateID validates the container id.
 func validateID(id string) error {
 	// See libcontainer/factory_linux.go.
@@ -142,6 +156,10 @@ type Container struct {
 	// bind mounts in Spec.Mounts (in the same order).
 	OverlayMediums []boot.OverlayMedium `json:"overlayMediums"`
 
+	// ExePath is the path of the runsc binary that runs the sandbox and
+	// gofer processes of the container. If empty, specutils.ExePath is used.
+	ExePath string `json:"exePath,omitempty"`
+
 	//
 	// Fields below this line are not saved in the state file and will not
 	// be preserved across commands.
@@ -188,14 +206,23 @@ type Args struct {
 	// sandboxed app.
 	PassFiles map[int]*os.File
 
+	// ListenAddresses maps the guest FDs of listening sockets in PassFiles
+	// to the address they're exposed on with netstack, if set.
+	ListenAddresses map[int]string
+
 	// ExecFile is the host file used for program execution.
 	ExecFile *os.File
+
+	// ExePath is the path of the runsc binary that runs the sandbox and
+	// gofer processes. If empty, specutils.ExePath is used.
+	ExePath string
 }
 
 // New creates the container in a new Sandbox process, unless the metadata
 // indicates that an existing Sandbox should be used. The caller must call
-// Destroy() on the container.
-func New(conf *config.Config, args Args) (*Container, error) {
+// Destroy() on the container. If ctx is done before the container is created,
+// the partially created container is destroyed.
+func New(ctx context.Context, conf *config.Config, args Args) (*Container, error) {
 	log.Debugf("Create container, cid: %s, rootDir: %q", args.ID, conf.RootDir)
 	if err := validateID(args.ID); err != nil {
 		return nil, err
@@ -234,6 +261,7 @@ func New(conf *config.Config, args Args) (*Container, error) {
 			},
 		},
 		OverlayConf: conf.GetOverlay2(),
+		ExePath:     args.ExePath,
 	}
 	// The Cleanup object cleans up partially created containers when an error
 	// occurs. Any errors occurring during cleanup itself are ignored.
@@ -287,7 +315,7 @@ func New(conf *config.Config, args Args) (*Container, error) {
 			}
 		}
 		c.CompatCgroup = cgroup.CgroupJSON{Cgroup: subCgroup}
-		mountHints, err := boot.NewPodMountHints(args.Spec)
+		mountHints, err := boot.NewPodMountHints(args.Spec, conf)
 		if err != nil {
 			return nil, fmt.Errorf("error creating pod mount hints: %w", err)
 		}
@@ -321,9 +349,11 @@ func New(conf *config.Config, args Args) (*Container, error) {
 				OverlayMediums:        overlayMediums,
 				MountHints:            mountHints,
 				PassFiles:             args.PassFiles,
+				ListenAddresses:       args.ListenAddresses,
 				ExecFile:              args.ExecFile,
+				ExePath:               args.ExePath,
 			}
-			sand, err := sandbox.New(conf, sandArgs)
+			sand, err := sandbox.New(ctx, conf, sandArgs)
 			if err != nil {
 				return fmt.Errorf("cannot create sandbox: %w", err)
 			}
@@ -367,7 +397,7 @@ func New(conf *config.Config, args Args) (*Container, error) {
 			defer tty.Close()
 		}
 
-		if err := c.Sandbox.CreateSubcontainer(conf, c.ID, tty); err != nil {
+		if err := c.Sandbox.CreateSubcontainer(ctx, conf, c.ID, tty); err != nil {
 			return nil, fmt.Errorf("cannot create subcontainer: %w", err)
 		}
 	}
@@ -377,6 +407,7 @@ func New(conf *config.Config, args Args) (*Container, error) {
 	if err := c.saveLocked(); err != nil {
 		return nil, err
 	}
+	c.recordEvent(HistoryCreated, "")
 
 	// "If any prestart hook fails, the runtime MUST generate an error,
 	// stop and destroy the container" -OCI spec.
@@ -411,8 +442,9 @@ func New(conf *config.Config, args Args) (*Container, error) {
 	return c, nil
 }
 
-// Start starts running the containerized process inside the sandbox.
-func (c *Container) Start(conf *config.Config) error {
+// Start starts running the containerized process inside the sandbox. If ctx is
+// done before the process is started, ctx.Err() is returned.
+func (c *Container) Start(ctx context.Context, conf *config.Config) error {
 	log.Debugf("Start container, cid: %s", c.ID)
 
 	if err := c.Saver.lock(BlockAcquire); err != nil {
@@ -432,7 +464,7 @@ func (c *Container) Start(conf *config.Config) error {
 	}
 
 	if isRoot(c.Spec) {
-		if err := c.Sandbox.StartRoot(conf); err != nil {
+		if err := c.Sandbox.StartRoot(ctx, conf); err != nil {
 			return err
 		}
 	} else {
@@ -469,7 +501,7 @@ func (c *Container) Start(conf *config.Config) error {
 				stdios = []*os.File{os.Stdin, os.Stdout, os.Stderr}
 			}
 
-			return c.Sandbox.StartSubcontainer(c.Spec, conf, c.ID, stdios, goferFiles, overlayFilestoreFiles, overlayMediums)
+			return c.Sandbox.StartSubcontainer(ctx, c.Spec, conf, c.ID, stdios, goferFiles, overlayFilestoreFiles, overlayMediums)
 		}); err != nil {
 			return err
 		}
@@ -486,6 +518,7 @@ func (c *Container) Start(conf *config.Config) error {
 	if err := c.saveLocked(); err != nil {
 		return err
 	}
+	c.recordEvent(HistoryStarted, "")
 
 	// Release lock before adjusting OOM score because the lock is acquired there.
 	unlock.Clean()
@@ -501,8 +534,16 @@ func (c *Container) Start(conf *config.Config) error {
 }
 
 // Restore takes a container and replaces its kernel and file system
-// to restore a container from its state file.
-func (c *Container) Restore(conf *config.Config, restoreFile string) error {
+// to restore a container from its state file. If ctx is done before the
+// restore completes, the restore is canceled and the container must be
+// destroyed.
+func (c *Container) Restore(ctx context.Context, conf *config.Config, restoreFile string) error {
+	return c.RestoreWithPrecopy(ctx, conf, restoreFile, nil)
+}
+
+// RestoreWithPrecopy is like Restore, for a restore file saved by a migration
+// after pre-copying memory to precopy. See pgalloc.ReadPrecopy.
+func (c *Container) RestoreWithPrecopy(ctx context.Context, conf *config.Config, restoreFile string, precopy *os.File) error {
 	log.Debugf("Restore container, cid: %s", c.ID)
 	if err := c.Saver.lock(BlockAcquire); err != nil {
 		return err
@@ -519,17 +560,39 @@ func (c *Container) Restore(conf *config.Config, restoreFile string) error {
 		log.Warningf("StartContainer hook skipped because running inside container namespace is not supported")
 	}
 
-	if err := c.Sandbox.Restore(conf, c.ID, restoreFile); err != nil {
+	f, err := os.Open(restoreFile)
+	if err != nil {
+		return fmt.Errorf("opening restore file %q: %w", restoreFile, err)
+	}
+	metadata, err := statefile.MetadataUnsafe(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("reading restore file %q metadata: %w", restoreFile, err)
+	}
+	if err := checkRestoreVersion(restoreFile, metadata); err != nil {
+		return err
+	}
+	env, err := c.validateRestoreSpec(conf, restoreFile, metadata)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Sandbox.Restore(ctx, conf, c.ID, restoreFile, env, precopy); err != nil {
 		return err
 	}
+	c.restoreTraceSessions(metadata)
 	c.changeStatus(Running)
-	return c.saveLocked()
+	if err := c.saveLocked(); err != nil {
+		return err
+	}
+	c.recordEvent(HistoryRestored, restoreFile)
+	return nil
 }
 
 // Run is a helper that calls Create + Start + Wait.
-func Run(conf *config.Config, args Args) (unix.WaitStatus, error) {
+func Run(ctx context.Context, conf *config.Config, args Args) (unix.WaitStatus, error) {
 	log.Debugf("Run container, cid: %s, rootDir: %q", args.ID, conf.RootDir)
-	c, err := New(conf, args)
+	c, err := New(ctx, conf, args)
 	if err != nil {
 		return 0, fmt.Errorf("creating container: %v", err)
 	}
@@ -542,11 +605,11 @@ func Run(conf *config.Config, args Args) (unix.WaitStatus, error) {
 
 	if conf.RestoreFile != "" {
 		log.Debugf("Restore: %v", conf.RestoreFile)
-		if err := c.Restore(conf, conf.RestoreFile); err != nil {
+		if err := c.Restore(ctx, conf, conf.RestoreFile); err != nil {
 			return 0, fmt.Errorf("starting container: %v", err)
 		}
 	} else {
-		if err := c.Start(conf); err != nil {
+		if err := c.Start(ctx, conf); err != nil {
 			return 0, fmt.Errorf("starting container: %v", err)
 		}
 	}
@@ -560,7 +623,7 @@ func Run(conf *config.Config, args Args) (unix.WaitStatus, error) {
 	}
 
 	if args.Attached {
-		return c.Wait()
+		return c.Wait(ctx)
 	}
 	cu.Release()
 	return 0, nil
@@ -594,6 +657,42 @@ func (c *Container) Event() (*boot.EventOut, error) {
 	return event, nil
 }
 
+// StreamEvents calls fn with the events of the container, collected at each
+// interval and sent when its stats changed, until the container is gone or fn
+// returns an error.
+func (c *Container) StreamEvents(interval time.Duration, fn func(*boot.EventOut) error) error {
+	log.Debugf("Streaming events for container, cid: %s", c.ID)
+	if err := c.requireStatus("get events for", Created, Running, Paused); err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	err = c.Sandbox.StreamEvents(c.ID, w, interval)
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(r)
+	for {
+		var event boot.EventOut
+		if err := dec.Decode(&event); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("decoding event: %w", err)
+		}
+		// Some stats can utilize host cgroups for accuracy.
+		c.populateStats(&event)
+		if err := fn(&event); err != nil {
+			return err
+		}
+	}
+}
+
 // PortForward starts port forwarding to the container.
 func (c *Container) PortForward(opts *boot.PortForwardOpts) error {
 	if err := c.requireStatus("port forward", Running); err != nil {
@@ -614,35 +713,58 @@ func (c *Container) SandboxPid() int {
 
 // Wait waits for the container to exit, and returns its WaitStatus.
 // Call to wait on a stopped container is needed to retrieve the exit status
-// and wait returns immediately.
-func (c *Container) Wait() (unix.WaitStatus, error) {
+// and wait returns immediately. It returns ctx.Err() if ctx is done first.
+func (c *Container) Wait(ctx context.Context) (unix.WaitStatus, error) {
 	log.Debugf("Wait on container, cid: %s", c.ID)
-	ws, err := c.Sandbox.Wait(c.ID)
+	ws, err := c.Sandbox.Wait(ctx, c.ID)
 	if err == nil {
 		// Wait succeeded, container is not running anymore.
 		c.changeStatus(Stopped)
+		c.recordExit(ws)
+	}
+	if ev := c.Sandbox.UnexpectedExit(); ev != nil {
+		c.notifySandboxExit(ev)
 	}
 	return ws, err
 }
 
+// notifySandboxExit passes ev to the exit hook of the sandbox, unless the
+// sandbox was killed because the container was destroyed.
+func (c *Container) notifySandboxExit(ev *sandbox.ExitEvent) {
+	if _, err := c.Saver.Stat(); os.IsNotExist(err) {
+		return
+	}
+	ids, err := listMatch(c.Saver.RootDir, FullID{SandboxID: c.Sandbox.ID})
+	if err != nil {
+		log.Warningf("Listing containers of sandbox %q: %v", c.Sandbox.ID, err)
+	}
+	for _, id := range ids {
+		ev.ContainerIDs = append(ev.ContainerIDs, id.ContainerID)
+	}
+	log.Warningf("Sandbox %q exited unexpectedly: %+v", c.Sandbox.ID, ev)
+	if err := c.Sandbox.NotifyExit(ev); err != nil {
+		log.Warningf("Notifying exit of sandbox %q: %v", c.Sandbox.ID, err)
+	}
+}
+
 // WaitRootPID waits for process 'pid' in the sandbox's PID namespace and
-// returns its WaitStatus.
-func (c *Container) WaitRootPID(pid int32) (unix.WaitStatus, error) {
+// returns its WaitStatus. It returns ctx.Err() if ctx is done first.
+func (c *Container) WaitRootPID(ctx context.Context, pid int32) (unix.WaitStatus, error) {
 	log.Debugf("Wait on process %d in sandbox, cid: %s", pid, c.Sandbox.ID)
 	if !c.IsSandboxRunning() {
 		return 0, fmt.Errorf("sandbox is not running")
 	}
-	return c.Sandbox.WaitPID(c.Sandbox.ID, pid)
+	return c.Sandbox.WaitPID(ctx, c.Sandbox.ID, pid)
 }
 
 // WaitPID waits for process 'pid' in the container's PID namespace and returns
-// its WaitStatus.
-func (c *Container) WaitPID(pid int32) (unix.WaitStatus, error) {
+// its WaitStatus. It returns ctx.Err() if ctx is done first.
+func (c *Container) WaitPID(ctx context.Context, pid int32) (unix.WaitStatus, error) {
 	log.Debugf("Wait on process %d in container, cid: %s", pid, c.ID)
 	if !c.IsSandboxRunning() {
 		return 0, fmt.Errorf("sandbox is not running")
 	}
-	return c.Sandbox.WaitPID(c.ID, pid)
+	return c.Sandbox.WaitPID(ctx, c.ID, pid)
 }
 
 // SignalContainer sends the signal to the container. If all is true and signal
@@ -701,7 +823,126 @@ func (c *Container) Checkpoint(f *os.File) error {
 	if err := c.requireStatus("checkpoint", Created, Running, Paused); err != nil {
 		return err
 	}
-	return c.Sandbox.Checkpoint(c.ID, f)
+	specJSON, err := json.Marshal(c.Spec)
+	if err != nil {
+		return fmt.Errorf("marshaling spec: %w", err)
+	}
+	metadata := map[string]string{
+		specMetadataKey:    string(specJSON),
+		versionMetadataKey: version.Version(),
+	}
+	if err := c.Sandbox.Checkpoint(c.ID, f, metadata); err != nil {
+		return err
+	}
+	c.recordEvent(HistoryCheckpointed, f.Name())
+	return nil
+}
+
+// Migrate sends the migrate call to the container. The state is written to
+// conn, the connection to the "runsc restore -listen" process on the target,
+// after up to precopyRounds rounds of memory pre-copy. The sandbox exits after
+// a successful migration.
+func (c *Container) Migrate(conn *os.File, precopyRounds int) error {
+	log.Debugf("Migrate container, cid: %s", c.ID)
+	if err := c.requireStatus("migrate", Created, Running, Paused); err != nil {
+		return err
+	}
+	specJSON, err := json.Marshal(c.Spec)
+	if err != nil {
+		return fmt.Errorf("marshaling spec: %w", err)
+	}
+	metadata := map[string]string{
+		specMetadataKey:    string(specJSON),
+		versionMetadataKey: version.Version(),
+	}
+	if err := c.Sandbox.Migrate(c.ID, conn, metadata, precopyRounds); err != nil {
+		return err
+	}
+	c.recordEvent(HistoryMigrated, conn.Name())
+	return nil
+}
+
+// checkRestoreVersion checks that the state encoding of the checkpoint image
+// can be loaded by this version of runsc.
+func checkRestoreVersion(restoreFile string, metadata map[string]string) error {
+	v, err := statefile.Version(metadata)
+	if err != nil {
+		return fmt.Errorf("restore file %q: %w", restoreFile, err)
+	}
+	takenBy, ok := metadata[versionMetadataKey]
+	if !ok {
+		takenBy = "unknown"
+	}
+	if v > state.Version {
+		return fmt.Errorf("restore file %q uses state version %d, which is newer than the supported version %d: restore it with the runsc version that took the checkpoint (%s) or newer", restoreFile, v, state.Version, takenBy)
+	}
+	if err := state.CanMigrate(v); err != nil {
+		return fmt.Errorf("restore file %q was taken by runsc version %s and can't be restored by this version: %w", restoreFile, takenBy, err)
+	}
+	if state.NeedsMigration(v) {
+		return fmt.Errorf("restore file %q uses state version %d, older than the current version %d: upgrade it with \"runsc statefile -convert=<new file> %s\" and restore from the new file", restoreFile, v, state.Version, restoreFile)
+	}
+	return nil
+}
+
+// restoreTraceSessions recreates the restartable trace sessions recorded in the
+// checkpoint metadata that don't exist in the restored sandbox yet, e.g.
+// because they weren't created from the pod init config. Failures are logged,
+// since the sandbox is already running.
+func (c *Container) restoreTraceSessions(metadata map[string]string) {
+	sessionsJSON, ok := metadata[boot.TraceSessionsMetadataKey]
+	if !ok {
+		return
+	}
+	var sessions []seccheck.SessionConfig
+	if err := json.Unmarshal([]byte(sessionsJSON), &sessions); err != nil {
+		log.Warningf("Invalid trace sessions in checkpoint metadata: %v", err)
+		return
+	}
+	existing, err := c.Sandbox.ListTraceSessions()
+	if err != nil {
+		log.Warningf("Unable to restore trace sessions: %v", err)
+		return
+	}
+	names := make(map[string]struct{}, len(existing))
+	for _, session := range existing {
+		names[session.Name] = struct{}{}
+	}
+	for i := range sessions {
+		session := &sessions[i]
+		if _, ok := names[session.Name]; ok {
+			continue
+		}
+		if err := c.Sandbox.CreateTraceSession(session, false /* force */); err != nil {
+			log.Warningf("Unable to restore trace session %q: %v", session.Name, err)
+			continue
+		}
+		log.Infof("Restored trace session %q", session.Name)
+	}
+}
+
+// validateRestoreSpec checks that the container's spec is compatible with the
+// spec recorded in the checkpoint image, and returns the environment variables
+// that changed and must be surfaced to the restored container.
+func (c *Container) validateRestoreSpec(conf *config.Config, restoreFile string, metadata map[string]string) ([]string, error) {
+	specJSON, ok := metadata[specMetadataKey]
+	if !ok {
+		// Images taken by older versions do not record the spec.
+		log.Warningf("Restore file %q has no spec, skipping compatibility checks", restoreFile)
+		return nil, nil
+	}
+	var old specs.Spec
+	if err := json.Unmarshal([]byte(specJSON), &old); err != nil {
+		return nil, fmt.Errorf("unmarshaling checkpointed spec: %w", err)
+	}
+	if err := specutils.ValidateRestoreSpec(&old, c.Spec); err != nil {
+		return nil, fmt.Errorf("spec is not compatible with checkpoint image: %w", err)
+	}
+	env := specutils.RestoreEnvDiff(&old, c.Spec)
+	if len(env) > 0 && conf.RestoreEnvFile == "" {
+		return nil, fmt.Errorf("environment variables changed since checkpoint, an env file path must be provided to surface them: %v", env)
+	}
+	return env, nil
 }
 
 // Pause suspends the container and its kernel.
@@ -721,7 +962,11 @@ func (c *Container) Pause() error {
 		return fmt.Errorf("pausing container %q: %v", c.ID, err)
 	}
 	c.changeStatus(Paused)
-	return c.saveLocked()
+	if err := c.saveLocked(); err != nil {
+		return err
+	}
+	c.recordEvent(HistoryPaused, "")
+	return nil
 }
 
 // Resume unpauses the container and its kernel.
@@ -740,7 +985,70 @@ func (c *Container) Resume() error {
 		return fmt.Errorf("resuming container: %v", err)
 	}
 	c.changeStatus(Running)
-	return c.saveLocked()
+	if err := c.saveLocked(); err != nil {
+		return err
+	}
+	c.recordEvent(HistoryResumed, "")
+	return nil
+}
+
+// RestartGofer starts a new gofer for the container after its gofer died,
+// and reconnects the container's mounts to it. The sandbox must run with
+// --gofer-recovery-timeout, and the gofer must be restarted before the
+// timeout expires, otherwise the container has already been killed.
+func (c *Container) RestartGofer(conf *config.Config) error {
+	log.Debugf("Restart gofer, cid: %s", c.ID)
+	if err := c.Saver.lock(BlockAcquire); err != nil {
+		return err
+	}
+	defer c.Saver.UnlockOrDie()
+
+	if err := c.requireStatus("restart gofer of", Running, Paused); err != nil {
+		return err
+	}
+	if c.IsGoferRunning() {
+		return fmt.Errorf("gofer of container %q is still running, PID: %d", c.ID, c.GoferPid)
+	}
+	if err := runInCgroup(c.Sandbox.CgroupJSON.Cgroup, func() error {
+		goferFiles, mountsFile, err := c.createGoferProcess(c.Spec, conf, c.BundleDir, false)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = mountsFile.Close()
+			for _, f := range goferFiles {
+				_ = f.Close()
+			}
+		}()
+
+		// The sandbox already has the mounts, but the gofer panics if it
+		// can't send them.
+		if _, err := specutils.ReadMounts(mountsFile); err != nil {
+			return fmt.Errorf("reading mounts file: %v", err)
+		}
+		return c.Sandbox.ReconnectGofer(c.ID, goferFiles)
+	}); err != nil {
+		return err
+	}
+	if err := c.saveLocked(); err != nil {
+		return err
+	}
+	return c.adjustGoferOOMScoreAdj()
+}
+
+// IsGoferRunning returns true if the gofer of the container is running. The
+// gofer is reaped if it's a child of the current process and has exited.
+func (c *Container) IsGoferRunning() bool {
+	if c.GoferPid == 0 {
+		return false
+	}
+	if c.goferIsChild {
+		if pid, _ := unix.Wait4(c.GoferPid, nil, unix.WNOHANG, nil); pid == c.GoferPid {
+			c.goferIsChild = false
+			return false
+		}
+	}
+	return unix.Kill(c.GoferPid, 0) == nil
 }
 
 // State returns the metadata of the container.
@@ -911,9 +1219,19 @@ func (c *Container) createOverlayFilestores(mountHints *boot.PodMountHints) ([]*
 }
 
 func (c *Container) createOverlayFilestore(mountSrc string, shouldOverlay bool, hint *boot.MountHint) (*os.File, boot.OverlayMedium, error) {
-	if hint != nil && hint.ShouldOverlay() {
-		// MountHint information takes precedence over shouldOverlay.
-		return c.createOverlayFilestoreInSelf(mountSrc)
+	// MountHint information takes precedence over shouldOverlay.
+	if hint != nil {
+		if medium, ok := hint.OverlayMedium(); ok {
+			switch medium {
+			case boot.NoOverlay, boot.MemoryMedium:
+				return nil, medium, nil
+			default:
+				return c.createOverlayFilestoreInSelf(mountSrc)
+			}
+		}
+		if hint.ShouldOverlay() {
+			return c.createOverlayFilestoreInSelf(mountSrc)
+		}
 	}
 	switch {
 	case !shouldOverlay:
@@ -1101,7 +1419,11 @@ func (c *Container) createGoferProcess(spec *specs.Spec, conf *config.Config, bu
 	}
 
 	// Start with the general config flags.
-	cmd := exec.Command(specutils.ExePath, conf.ToFlags()...)
+	exePath := c.ExePath
+	if exePath == "" {
+		exePath = specutils.ExePath
+	}
+	cmd := exec.Command(exePath, conf.ToFlags()...)
 	cmd.SysProcAttr = &unix.SysProcAttr{
 		// Detach from session. Otherwise, signals sent to the foreground process
 		// will also be forwarded by this process, resulting in duplicate signals.
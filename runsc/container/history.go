@@ -0,0 +1,153 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"golang.org/x/sys/unix"
+)
+
+// Lifecycle transitions recorded in the history of a container.
+const (
+	HistoryCreated      = "created"
+	HistoryStarted      = "started"
+	HistoryRestored     = "restored"
+	HistoryPaused       = "paused"
+	HistoryResumed      = "resumed"
+	HistoryCheckpointed = "checkpointed"
+	HistoryMigrated     = "migrated"
+	HistoryExited       = "exited"
+)
+
+// HistoryEvent is an entry of the history of a container. The history is an
+// append-only journal kept in the root directory next to the state file, and
+// removed with it when the container is destroyed.
+type HistoryEvent struct {
+	// Time is when the transition happened.
+	Time time.Time `json:"time"`
+
+	// Event is the transition, one of the History* constants.
+	Event string `json:"event"`
+
+	// Status is the status of the container after the transition.
+	Status Status `json:"status"`
+
+	// PID is the PID of the sandbox process.
+	PID int `json:"pid,omitempty"`
+
+	// ExitStatus is the exit status of the container, for exits.
+	ExitStatus *int `json:"exitStatus,omitempty"`
+
+	// Signal is the signal that killed the container, for exits.
+	Signal string `json:"signal,omitempty"`
+
+	// Detail is additional information about the transition, e.g. the path
+	// of a checkpoint image.
+	Detail string `json:"detail,omitempty"`
+}
+
+// historyPath is the full path to the history file.
+func (s *StateFile) historyPath() string {
+	return buildPath(s.RootDir, s.ID, "history")
+}
+
+// appendHistory appends ev to the history file. The file is only created for
+// the first event, so that events racing with the destruction of the container
+// don't leave it behind.
+//
+// It doesn't require the lock to be held, as appends of a single line are
+// atomic.
+func (s *StateFile) appendHistory(ev *HistoryEvent, create bool) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	flags := os.O_WRONLY | os.O_APPEND
+	if create {
+		flags |= os.O_CREATE
+	}
+	f, err := os.OpenFile(s.historyPath(), flags, 0640)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(line)
+	return err
+}
+
+// History returns the lifecycle transitions of the container, oldest first.
+func (c *Container) History() ([]HistoryEvent, error) {
+	f, err := os.Open(c.Saver.historyPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []HistoryEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev HistoryEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			// A crash may leave a partial line behind, skip it.
+			log.Warningf("Skipping invalid history entry of container %q: %v", c.ID, err)
+			continue
+		}
+		events = append(events, ev)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading history of container %q: %w", c.ID, err)
+	}
+	return events, nil
+}
+
+// recordEvent records a lifecycle transition in the history of the container.
+// Failures are logged, since the history is only informational.
+func (c *Container) recordEvent(event, detail string) {
+	c.recordHistory(&HistoryEvent{Event: event, Detail: detail})
+}
+
+// recordExit records the exit of the container with ws in its history.
+func (c *Container) recordExit(ws unix.WaitStatus) {
+	ev := &HistoryEvent{Event: HistoryExited}
+	if ws.Signaled() {
+		ev.Signal = ws.Signal().String()
+	} else {
+		status := ws.ExitStatus()
+		ev.ExitStatus = &status
+	}
+	c.recordHistory(ev)
+}
+
+func (c *Container) recordHistory(ev *HistoryEvent) {
+	ev.Time = time.Now()
+	ev.Status = c.Status
+	if pid := c.SandboxPid(); pid > 0 {
+		ev.PID = pid
+	}
+	if err := c.Saver.appendHistory(ev, ev.Event == HistoryCreated); err != nil && !os.IsNotExist(err) {
+		log.Warningf("Recording %q in the history of container %q: %v", ev.Event, c.ID, err)
+	}
+}
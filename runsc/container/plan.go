@@ -0,0 +1,321 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/runsc/boot"
+	"github.com/talismancer/gvisor-ligolo/runsc/cgroup"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/sandbox"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+)
+
+// CreatePlan describes what New would do for a container, without doing it.
+type CreatePlan struct {
+	// ID is the container ID.
+	ID string `json:"id"`
+
+	// SandboxID is the ID of the sandbox the container runs in.
+	SandboxID string `json:"sandboxId"`
+
+	// NewSandbox is true if a new sandbox is started for the container, as
+	// opposed to creating the container in an existing sandbox.
+	NewSandbox bool `json:"newSandbox"`
+
+	// Cgroup is the host cgroup of the sandbox, if any.
+	Cgroup *CgroupPlan `json:"cgroup,omitempty"`
+
+	// Mounts are the mounts of the container, starting with the root.
+	Mounts []MountPlan `json:"mounts"`
+
+	// GoferNamespaces are the namespaces the gofer process is started in.
+	GoferNamespaces []sandbox.NamespacePlan `json:"goferNamespaces,omitempty"`
+
+	// Sandbox describes the sandbox process, if NewSandbox is true.
+	Sandbox *sandbox.Plan `json:"sandbox,omitempty"`
+
+	// Findings are the features of the spec that runsc ignores or emulates.
+	Findings []specutils.LintFinding `json:"findings,omitempty"`
+}
+
+// CgroupPlan describes the host cgroup of a sandbox.
+type CgroupPlan struct {
+	// Path is the path of the cgroup.
+	Path string `json:"path"`
+
+	// Systemd is true if the cgroup is managed by systemd.
+	Systemd bool `json:"systemd"`
+
+	// Exists is true if the cgroup already exists.
+	Exists bool `json:"exists"`
+
+	// Resources are the resource limits applied to the cgroup.
+	Resources *specs.LinuxResources `json:"resources,omitempty"`
+}
+
+// MountPlan describes a mount of the container.
+type MountPlan struct {
+	// Destination is the path of the mount in the container.
+	Destination string `json:"destination"`
+
+	// Type is the filesystem type of the mount.
+	Type string `json:"type"`
+
+	// Source is the source of the mount, as given in the spec.
+	Source string `json:"source,omitempty"`
+
+	// ResolvedSource is Source with symlinks resolved, for gofer mounts.
+	ResolvedSource string `json:"resolvedSource,omitempty"`
+
+	// Gofer is true if the mount is served by the gofer.
+	Gofer bool `json:"gofer"`
+
+	// Overlay is the medium of the overlay applied to the mount, if any.
+	Overlay string `json:"overlay,omitempty"`
+}
+
+// Plan validates that a container can be created with args, and returns what
+// New would do to create it. Unlike New, it doesn't create any state, cgroup
+// or process; in particular, mounts are resolved on the host rather than by
+// the gofer.
+func Plan(conf *config.Config, args Args) (*CreatePlan, error) {
+	if err := validateID(args.ID); err != nil {
+		return nil, err
+	}
+	if err := modifySpecForDirectfs(conf, args.Spec); err != nil {
+		return nil, fmt.Errorf("failed to modify spec for directfs: %v", err)
+	}
+
+	plan := &CreatePlan{
+		ID:        args.ID,
+		SandboxID: args.ID,
+		Findings:  specutils.LintSpec(args.Spec, conf),
+	}
+	if !isRoot(args.Spec) {
+		var ok bool
+		plan.SandboxID, ok = specutils.SandboxID(args.Spec)
+		if !ok {
+			return nil, fmt.Errorf("no sandbox ID found when creating container")
+		}
+	}
+	// Don't use Load, as it creates lock files.
+	existing, err := filepath.Glob(buildPath(conf.RootDir, FullID{SandboxID: "*", ContainerID: args.ID}, stateFileExtension))
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, fmt.Errorf("container with id %q already exists", args.ID)
+	}
+
+	if !isRoot(args.Spec) {
+		sb, err := Load(conf.RootDir, FullID{SandboxID: plan.SandboxID, ContainerID: plan.SandboxID}, LoadOpts{Exact: true})
+		if err != nil {
+			return nil, fmt.Errorf("cannot load sandbox: %w", err)
+		}
+		if !sb.IsSandboxRunning() {
+			return nil, fmt.Errorf("sandbox %q is not running", plan.SandboxID)
+		}
+		mounts, err := planMounts(conf, args.Spec, nil, plan.SandboxID)
+		if err != nil {
+			return nil, err
+		}
+		plan.Mounts = mounts
+		return plan, nil
+	}
+
+	plan.NewSandbox = true
+	if args.Spec.Linux == nil {
+		args.Spec.Linux = &specs.Linux{}
+	}
+	if args.Spec.Linux.CgroupsPath == "" && !conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
+		args.Spec.Linux.CgroupsPath = "/" + args.ID
+	}
+	if !conf.IgnoreCgroups {
+		cg, err := planCgroup(conf, args.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("cannot set up cgroup for root: %w", err)
+		}
+		plan.Cgroup = cg
+	}
+
+	mountHints, err := boot.NewPodMountHints(args.Spec, conf)
+	if err != nil {
+		return nil, fmt.Errorf("error creating pod mount hints: %w", err)
+	}
+	mounts, err := planMounts(conf, args.Spec, mountHints, plan.SandboxID)
+	if err != nil {
+		return nil, err
+	}
+	plan.Mounts = mounts
+
+	goferMounts, overlayFilestores := 0, 0
+	for _, m := range mounts {
+		if m.Gofer {
+			goferMounts++
+		}
+		if m.Overlay == overlayMediumNames[boot.SelfMedium] || m.Overlay == overlayMediumNames[boot.AnonDirMedium] {
+			overlayFilestores++
+		}
+	}
+	plan.GoferNamespaces = []sandbox.NamespacePlan{
+		{Type: specs.IPCNamespace},
+		{Type: specs.MountNamespace},
+		{Type: specs.NetworkNamespace},
+		{Type: specs.PIDNamespace},
+		{Type: specs.UTSNamespace},
+	}
+	if userns, ok := specutils.GetNS(specs.UserNamespace, args.Spec); ok {
+		plan.GoferNamespaces = append(plan.GoferNamespaces, sandbox.NamespacePlan{Type: userns.Type, Path: userns.Path})
+	}
+
+	sandArgs := &sandbox.Args{
+		ID:            plan.SandboxID,
+		Spec:          args.Spec,
+		BundleDir:     args.BundleDir,
+		ConsoleSocket: args.ConsoleSocket,
+		UserLog:       args.UserLog,
+		MountHints:    mountHints,
+		ExecFile:      args.ExecFile,
+	}
+	plan.Sandbox, err = sandbox.NewPlan(conf, sandArgs, goferMounts, overlayFilestores)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// planCgroup mirrors setupCgroupForRoot without installing the cgroup.
+func planCgroup(conf *config.Config, spec *specs.Spec) (*CgroupPlan, error) {
+	var (
+		cg  cgroup.Cgroup
+		err error
+	)
+	if parentPath, ok := spec.Annotations[cgroupParentAnnotation]; ok {
+		cg, err = cgroup.NewFromPath(parentPath, conf.SystemdCgroup)
+	} else {
+		cg, err = cgroup.NewFromSpec(spec, conf.SystemdCgroup)
+	}
+	if cg == nil || err != nil {
+		return nil, err
+	}
+	path := cg.MakePath("memory")
+	_, statErr := os.Stat(path)
+	return &CgroupPlan{
+		Path:      path,
+		Systemd:   conf.SystemdCgroup,
+		Exists:    statErr == nil,
+		Resources: spec.Linux.Resources,
+	}, nil
+}
+
+var overlayMediumNames = map[boot.OverlayMedium]string{
+	boot.NoOverlay:     "",
+	boot.MemoryMedium:  "memory",
+	boot.SelfMedium:    "self",
+	boot.AnonDirMedium: "dir",
+}
+
+// planMounts returns the mounts of spec, checking that the sources of gofer
+// mounts exist. Overlays are only applied to the mounts of new sandboxes, for
+// which mountHints is set. It mirrors createOverlayFilestores without creating
+// filestores.
+func planMounts(conf *config.Config, spec *specs.Spec, mountHints *boot.PodMountHints, sandboxID string) ([]MountPlan, error) {
+	overlayConf := conf.GetOverlay2()
+	overlay := func(src string, shouldOverlay bool, hint *boot.MountHint) boot.OverlayMedium {
+		self := hint != nil && hint.ShouldOverlay()
+		if hint != nil {
+			if medium, ok := hint.OverlayMedium(); ok {
+				if medium != boot.SelfMedium {
+					return medium
+				}
+				self = true
+			}
+		}
+		switch {
+		case self:
+		case !shouldOverlay:
+			return boot.NoOverlay
+		case overlayConf.IsBackedByMemory():
+			return boot.MemoryMedium
+		case overlayConf.IsBackedBySelf():
+			self = true
+		default:
+			return boot.AnonDirMedium
+		}
+		if info, err := os.Stat(src); err == nil && !info.IsDir() {
+			return boot.MemoryMedium
+		}
+		return boot.SelfMedium
+	}
+
+	root, err := resolveSource(spec.Root.Path)
+	if err != nil {
+		return nil, fmt.Errorf("root filesystem: %w", err)
+	}
+	rootPlan := MountPlan{
+		Destination:    "/",
+		Type:           "bind",
+		Source:         spec.Root.Path,
+		ResolvedSource: root,
+		Gofer:          true,
+	}
+	if mountHints != nil {
+		rootPlan.Overlay = overlayMediumNames[overlay(root, overlayConf.RootEnabled() && !spec.Root.Readonly, nil)]
+	}
+	plans := []MountPlan{rootPlan}
+
+	for i := range spec.Mounts {
+		m := &spec.Mounts[i]
+		mp := MountPlan{
+			Destination: m.Destination,
+			Type:        m.Type,
+			Source:      m.Source,
+			Gofer:       specutils.IsGoferMount(*m),
+		}
+		if mp.Gofer {
+			mp.Type = "bind"
+			if mp.ResolvedSource, err = resolveSource(m.Source); err != nil {
+				return nil, fmt.Errorf("mount %q: %w", m.Destination, err)
+			}
+			if mountHints != nil {
+				shouldOverlay := overlayConf.SubMountEnabled() && !specutils.IsReadonlyMount(m.Options)
+				medium := overlay(mp.ResolvedSource, shouldOverlay, mountHints.FindMount(m))
+				if medium == boot.SelfMedium {
+					if _, err := os.Stat(boot.SelfOverlayFilestorePath(mp.ResolvedSource, sandboxID)); err == nil {
+						return nil, fmt.Errorf("%q mount source already has a filestore file; repeated submounts are not suppported with self medium", m.Source)
+					}
+				}
+				mp.Overlay = overlayMediumNames[medium]
+			}
+		}
+		plans = append(plans, mp)
+	}
+	return plans, nil
+}
+
+// resolveSource resolves the symlinks in the source of a gofer mount, which
+// must exist.
+func resolveSource(src string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return "", fmt.Errorf("resolving mount source: %w", err)
+	}
+	return resolved, nil
+}
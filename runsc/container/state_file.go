@@ -24,7 +24,6 @@ import (
 	"regexp"
 	"strings"
 
-	"github.com/gofrs/flock"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"golang.org/x/sys/unix"
@@ -294,13 +293,13 @@ type StateFile struct {
 	//
 
 	once  sync.Once
-	flock *flock.Flock
+	flock *fileLock
 }
 
 // lock globally locks all locking operations for the container.
 func (s *StateFile) lock(tryLock TryLock) error {
 	s.once.Do(func() {
-		s.flock = flock.New(s.lockPath())
+		s.flock = newFileLock(s.lockPath())
 	})
 
 	if tryLock {
@@ -373,12 +372,48 @@ func (s *StateFile) SaveLocked(v any) error {
 	if err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(s.statePath(), meta, 0640); err != nil {
+	if err := s.writeLocked(meta, true /* backup */); err != nil {
 		return fmt.Errorf("writing json file: %v", err)
 	}
 	return nil
 }
 
+// writeLocked atomically replaces the contents of the state file with data,
+// so that concurrent readers and crashes never see a partially written file.
+// If backup is true, the previous contents are kept in the backup file.
+//
+// Preconditions: lock(*) must been called before.
+func (s *StateFile) writeLocked(data []byte, backup bool) error {
+	tmpPath := s.statePath() + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	if backup {
+		// Keep the previous version around in case the new one is lost, e.g.
+		// if the host crashes before it reaches the disk.
+		if err := os.Remove(s.backupPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Link(s.statePath(), s.backupPath()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(tmpPath, s.statePath())
+}
+
 // Stat returns the result of calling stat() on the state file.
 // Doing so does not require locking.
 func (s *StateFile) Stat() (os.FileInfo, error) {
@@ -395,7 +430,30 @@ func (s *StateFile) load(v any, opts LoadOpts) error {
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(metaBytes, &v)
+	if err := json.Unmarshal(metaBytes, &v); err != nil {
+		log.Warningf("State file %q is corrupted, recovering it from backup: %v", s.statePath(), err)
+		return s.recoverLocked(v, err)
+	}
+	return nil
+}
+
+// recoverLocked restores the state file from its backup, and loads it into v.
+// err is the error that was found in the state file.
+//
+// Preconditions: lock(*) must been called before.
+func (s *StateFile) recoverLocked(v any, err error) error {
+	metaBytes, backupErr := ioutil.ReadFile(s.backupPath())
+	if backupErr == nil {
+		backupErr = json.Unmarshal(metaBytes, &v)
+	}
+	if backupErr != nil {
+		return fmt.Errorf("state file %q is corrupted: %v, and it can't be recovered: %v", s.statePath(), err, backupErr)
+	}
+	// Don't back up the corrupted file, it would replace the good backup.
+	if err := s.writeLocked(metaBytes, false /* backup */); err != nil {
+		return fmt.Errorf("restoring state file %q from backup: %v", s.statePath(), err)
+	}
+	return nil
 }
 
 func (s *StateFile) close() error {
@@ -419,6 +477,11 @@ func (s *StateFile) statePath() string {
 	return buildPath(s.RootDir, s.ID, stateFileExtension)
 }
 
+// backupPath is the full path to the backup of the state file.
+func (s *StateFile) backupPath() string {
+	return s.statePath() + ".bak"
+}
+
 // lockPath is the full path to the lock file.
 func (s *StateFile) lockPath() string {
 	return buildPath(s.RootDir, s.ID, "lock")
@@ -431,6 +494,11 @@ func (s *StateFile) Destroy() error {
 	if err := os.Remove(s.statePath()); err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	for _, path := range []string{s.backupPath(), s.statePath() + ".tmp", s.historyPath()} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
 	if err := os.Remove(s.lockPath()); err != nil && !os.IsNotExist(err) {
 		return err
 	}
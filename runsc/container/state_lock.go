@@ -0,0 +1,255 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/sync"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// maxLockRetryDelay is the maximum time between attempts to acquire a
+	// lock held by another process.
+	maxLockRetryDelay = 100 * time.Millisecond
+
+	// staleLockCheckInterval is the time between checks of whether a lock
+	// being waited on is stale.
+	staleLockCheckInterval = time.Second
+)
+
+// fileLock is an exclusive advisory lock on a file, taken with flock(2).
+//
+// The holder of the lock records its PID in the file while holding it. The
+// lock is released by the kernel when the holder exits, unless the file
+// descriptor leaked to another process, e.g. a child. Such a stale lock is
+// broken by replacing the lock file once the recorded holder is dead.
+type fileLock struct {
+	path string
+
+	// mu protects file.
+	mu sync.Mutex
+
+	// file is the locked file, or nil if the lock isn't held.
+	file *os.File
+}
+
+func newFileLock(path string) *fileLock {
+	return &fileLock{path: path}
+}
+
+// String implements fmt.Stringer.
+func (l *fileLock) String() string {
+	return l.path
+}
+
+// Locked returns true if the lock is held.
+func (l *fileLock) Locked() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file != nil
+}
+
+// TryLock acquires the lock if it's available. It returns false if the lock
+// is held by someone else.
+func (l *fileLock) TryLock() (bool, error) {
+	return l.acquire(false /* block */)
+}
+
+// Lock acquires the lock, waiting for it to be available.
+func (l *fileLock) Lock() error {
+	_, err := l.acquire(true /* block */)
+	return err
+}
+
+func (l *fileLock) acquire(block bool) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		return true, nil
+	}
+
+	delay := time.Millisecond
+	lastCheck := time.Now()
+	for {
+		f, err := l.tryLockFile()
+		if err != nil {
+			return false, err
+		}
+		if f != nil {
+			l.file = f
+			return true, nil
+		}
+		if !block {
+			return false, nil
+		}
+		if time.Since(lastCheck) >= staleLockCheckInterval {
+			lastCheck = time.Now()
+			if err := l.breakIfStale(); err != nil {
+				log.Warningf("Checking whether lock %q is stale: %v", l.path, err)
+			}
+		}
+		time.Sleep(delay)
+		if delay *= 2; delay > maxLockRetryDelay {
+			delay = maxLockRetryDelay
+		}
+	}
+}
+
+// tryLockFile locks the file at l.path, and records the current process as
+// its holder. It returns nil if the lock is held by someone else.
+func (l *fileLock) tryLockFile() (*os.File, error) {
+	for {
+		f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0640)
+		if err != nil {
+			return nil, err
+		}
+		if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+			_ = f.Close()
+			if err == unix.EWOULDBLOCK {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		// The lock file may have been replaced by breakIfStale while it was
+		// being locked, in which case the lock is worthless. If it was removed
+		// instead, the container was destroyed and there is nothing left to
+		// protect.
+		var fdStat, pathStat unix.Stat_t
+		if err := unix.Fstat(int(f.Fd()), &fdStat); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if err := unix.Stat(l.path, &pathStat); err == unix.ENOENT {
+			return f, nil
+		} else if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		if fdStat.Dev != pathStat.Dev || fdStat.Ino != pathStat.Ino {
+			_ = f.Close()
+			continue
+		}
+
+		if err := writeLockHolder(f); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+}
+
+// Unlock releases the lock. It's a noop if the lock isn't held.
+func (l *fileLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	// Clear the holder before releasing the lock, so that a new holder that
+	// hasn't recorded itself yet isn't mistaken for the previous one.
+	_ = l.file.Truncate(0)
+	err := unix.Flock(int(l.file.Fd()), unix.LOCK_UN)
+	_ = l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Close releases the lock, if held.
+func (l *fileLock) Close() error {
+	return l.Unlock()
+}
+
+// breakIfStale removes the lock file if the lock is held on behalf of a dead
+// process, so that the lock can be acquired on a new file.
+func (l *fileLock) breakIfStale() error {
+	// Serialize breakers by locking the directory, so that a lock file that
+	// was just replaced by a breaker isn't removed again by another one.
+	dir, err := os.Open(filepath.Dir(l.path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	if err := unix.Flock(int(dir.Fd()), unix.LOCK_EX); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	pid, pidNS, ok := parseLockHolder(data)
+	if !ok {
+		// The holder hasn't recorded itself yet.
+		return nil
+	}
+	// PIDs are only meaningful in the PID namespace of the holder.
+	if ns, err := os.Readlink("/proc/self/ns/pid"); err != nil || ns != pidNS {
+		return nil
+	}
+	if err := unix.Kill(pid, 0); err != unix.ESRCH {
+		return nil
+	}
+
+	// Check again that the lock is held, in case it was released while the
+	// holder was being checked.
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_SH|unix.LOCK_NB); err == nil {
+		return nil
+	}
+	log.Warningf("Breaking lock %q held on behalf of dead process %d", l.path, pid)
+	return os.Remove(l.path)
+}
+
+// writeLockHolder records the current process as the holder of the lock on f.
+func writeLockHolder(f *os.File) error {
+	pidNS, err := os.Readlink("/proc/self/ns/pid")
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	_, err = f.WriteAt([]byte(fmt.Sprintf("%d %s\n", os.Getpid(), pidNS)), 0)
+	return err
+}
+
+// parseLockHolder parses the holder recorded by writeLockHolder.
+func parseLockHolder(data []byte) (int, string, bool) {
+	pidStr, pidNS, ok := strings.Cut(strings.TrimSpace(string(data)), " ")
+	if !ok {
+		return 0, "", false
+	}
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil || pid <= 0 {
+		return 0, "", false
+	}
+	return pid, pidNS, true
+}
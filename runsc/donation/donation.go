@@ -17,12 +17,14 @@
 package donation
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+	"golang.org/x/sys/unix"
 )
 
 // LogDonations logs the FDs we are donating in the command.
@@ -36,6 +38,10 @@ func LogDonations(cmd *exec.Cmd) {
 type Agency struct {
 	donations    []donation
 	closePending []*os.File
+
+	// manifest maps the names of donations transferred with
+	// TransferToManifest to their FDs in the child process.
+	manifest map[string][]int
 }
 
 type donation struct {
@@ -106,11 +112,68 @@ func (f *Agency) Transfer(cmd *exec.Cmd, nextFD int) int {
 	return nextFD
 }
 
+// TransferToManifest is similar to Transfer, but records the FDs of the files
+// in a manifest instead of adding flags to cmd. The manifest is passed to cmd
+// with TransferManifest.
+func (f *Agency) TransferToManifest(cmd *exec.Cmd, nextFD int) int {
+	if f.manifest == nil {
+		f.manifest = make(map[string][]int)
+	}
+	for _, d := range f.donations {
+		for _, file := range d.files {
+			fd := -1
+			if file != nil {
+				cmd.ExtraFiles = append(cmd.ExtraFiles, file)
+				fd = nextFD
+				nextFD++
+			}
+			f.manifest[d.flag] = append(f.manifest[d.flag], fd)
+		}
+	}
+	f.donations = nil
+	return nextFD
+}
+
+// TransferManifest transfers the remaining donations to the manifest, and then
+// the manifest itself to cmd, adding --flag with its FD. The manifest is a
+// JSON object that maps the name of each donation to its FDs. It's stored in
+// a sealed memfd, so that it can be read multiple times, e.g. after the child
+// re-executes itself.
+func (f *Agency) TransferManifest(cmd *exec.Cmd, nextFD int, flag string) (int, error) {
+	nextFD = f.TransferToManifest(cmd, nextFD)
+	data, err := json.Marshal(f.manifest)
+	if err != nil {
+		return 0, err
+	}
+	memfd, err := unix.MemfdCreate(flag, unix.MFD_CLOEXEC|unix.MFD_ALLOW_SEALING)
+	if err != nil {
+		return 0, fmt.Errorf("creating FD manifest: %w", err)
+	}
+	file := os.NewFile(uintptr(memfd), flag)
+	f.closePending = append(f.closePending, file)
+	if _, err := file.Write(data); err != nil {
+		return 0, fmt.Errorf("writing FD manifest: %w", err)
+	}
+	if _, err := unix.FcntlInt(file.Fd(), unix.F_ADD_SEALS, unix.F_SEAL_SHRINK|unix.F_SEAL_GROW|unix.F_SEAL_WRITE|unix.F_SEAL_SEAL); err != nil {
+		return 0, fmt.Errorf("sealing FD manifest: %w", err)
+	}
+	cmd.ExtraFiles = append(cmd.ExtraFiles, file)
+	cmd.Args = append(cmd.Args, fmt.Sprintf("--%s=%d", flag, nextFD))
+	return nextFD + 1, nil
+}
+
 // DonateAndTransferCustomFiles sets up the flags for passing file descriptors from the
 // host to the sandbox. Making use of the agency is not necessary,
-func DonateAndTransferCustomFiles(cmd *exec.Cmd, nextFD int, files map[int]*os.File) int {
+//
+// listenAddrs maps the guest FDs of listening sockets to the address they're
+// exposed on, if set.
+func DonateAndTransferCustomFiles(cmd *exec.Cmd, nextFD int, files map[int]*os.File, listenAddrs map[int]string) int {
 	for fd, file := range files {
-		cmd.Args = append(cmd.Args, fmt.Sprintf("--pass-fd=%d:%d", nextFD, fd))
+		if addr, ok := listenAddrs[fd]; ok {
+			cmd.Args = append(cmd.Args, fmt.Sprintf("--pass-fd=%d:%d@%s", nextFD, fd, addr))
+		} else {
+			cmd.Args = append(cmd.Args, fmt.Sprintf("--pass-fd=%d:%d", nextFD, fd))
+		}
 		cmd.ExtraFiles = append(cmd.ExtraFiles, file)
 		nextFD++
 	}
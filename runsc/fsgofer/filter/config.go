@@ -51,6 +51,30 @@ var allowedSyscalls = seccomp.SyscallRules{
 			seccomp.MatchAny{},
 			seccomp.EqualTo(0),
 		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_KEEP_SIZE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_PUNCH_HOLE | unix.FALLOC_FL_KEEP_SIZE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_ZERO_RANGE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_ZERO_RANGE | unix.FALLOC_FL_KEEP_SIZE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_COLLAPSE_RANGE),
+		},
+		{
+			seccomp.MatchAny{},
+			seccomp.EqualTo(unix.FALLOC_FL_INSERT_RANGE),
+		},
 	},
 	unix.SYS_FCHMOD:   {},
 	unix.SYS_FCHMODAT: {},
@@ -121,6 +145,11 @@ var allowedSyscalls = seccomp.SyscallRules{
 	unix.SYS_GETRANDOM:    {},
 	unix.SYS_GETTID:       {},
 	unix.SYS_GETTIMEOFDAY: {},
+	// Used by fsgofer watchers.
+	unix.SYS_INOTIFY_ADD_WATCH: {},
+	unix.SYS_INOTIFY_INIT1: []seccomp.Rule{
+		{seccomp.EqualTo(unix.IN_CLOEXEC | unix.IN_NONBLOCK)},
+	},
 	unix.SYS_LINKAT:       {},
 	unix.SYS_LSEEK:        {},
 	unix.SYS_MADVISE:      {},
@@ -29,6 +29,7 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/atomicbitops"
 	"github.com/talismancer/gvisor-ligolo/pkg/cleanup"
 	rwfd "github.com/talismancer/gvisor-ligolo/pkg/fd"
+	"github.com/talismancer/gvisor-ligolo/pkg/fdaudit"
 	"github.com/talismancer/gvisor-ligolo/pkg/fsutil"
 	"github.com/talismancer/gvisor-ligolo/pkg/lisafs"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
@@ -57,6 +58,10 @@ type Config struct {
 	// HostUDS signals whether the gofer can connect to host unix domain sockets.
 	HostUDS config.HostUDS
 
+	// HostUDSPolicy further restricts the host unix domain sockets that can
+	// be connected to or bound. If nil, all sockets are allowed.
+	HostUDSPolicy *UDSPolicy
+
 	// HostFifo signals whether the gofer can connect to host FIFOs.
 	HostFifo config.HostFifo
 
@@ -67,6 +72,9 @@ type Config struct {
 
 var procSelfFD *rwfd.FD
 
+// hostFDs tracks the host FDs of control and open FDs, see fdaudit.
+var hostFDs = fdaudit.NewOwner("fsgofer")
+
 // OpenProcSelfFD opens the /proc/self/fd directory, which will be used to
 // reopen file descriptors.
 func OpenProcSelfFD() error {
@@ -75,6 +83,7 @@ func OpenProcSelfFD() error {
 		return fmt.Errorf("error opening /proc/self/fd: %v", err)
 	}
 	procSelfFD = rwfd.New(d)
+	fdaudit.SetProcSelfFD(d)
 	return nil
 }
 
@@ -130,6 +139,7 @@ func (s *LisafsServer) Mount(c *lisafs.Connection, mountNode *lisafs.Node) (*lis
 	}
 	cu.Release()
 
+	hostFDs.Add(rootHostFD)
 	rootFD := &controlFDLisa{
 		hostFD:         rootHostFD,
 		writableHostFD: atomicbitops.FromInt32(-1),
@@ -177,6 +187,7 @@ func (s *LisafsServer) SupportedMessages() []lisafs.MID {
 		lisafs.BindAt,
 		lisafs.Listen,
 		lisafs.Accept,
+		lisafs.Watch,
 	}
 }
 
@@ -225,6 +236,7 @@ func newControlFDLisa(hostFD int, parent *controlFDLisa, name string, mode linux
 			childFD = &controlFDLisa{}
 		}
 	})
+	hostFDs.Add(hostFD)
 	childFD.hostFD = hostFD
 	childFD.writableHostFD = atomicbitops.FromInt32(-1)
 	childFD.ControlFD.Init(parent.Conn(), childNode, mode, childFD)
@@ -245,6 +257,7 @@ func (fd *controlFDLisa) getWritableFD() (int, error) {
 		unix.Close(writableFD)
 		return int(fd.writableHostFD.Load()), nil
 	}
+	hostFDs.Add(writableFD)
 	return writableFD, nil
 }
 
@@ -269,11 +282,13 @@ func (fd *controlFDLisa) FD() *lisafs.ControlFD {
 // Close implements lisafs.ControlFDImpl.Close.
 func (fd *controlFDLisa) Close() {
 	if fd.hostFD >= 0 {
+		hostFDs.Remove(fd.hostFD)
 		_ = unix.Close(fd.hostFD)
 		fd.hostFD = -1
 	}
 	// No concurrent access is possible so no need to use atomics.
 	if fd.writableHostFD.RacyLoad() >= 0 {
+		hostFDs.Remove(int(fd.writableHostFD.RacyLoad()))
 		_ = unix.Close(int(fd.writableHostFD.RacyLoad()))
 		fd.writableHostFD = atomicbitops.FromInt32(-1)
 	}
@@ -488,7 +503,7 @@ func (fd *controlFDLisa) Open(flags uint32) (*lisafs.OpenFD, int, error) {
 			return nil, -1, unix.EPERM
 		}
 	case unix.S_IFSOCK:
-		if !server.config.HostUDS.AllowOpen() {
+		if !server.config.HostUDS.AllowOpen() || !server.config.HostUDSPolicy.Allowed(fd.Node().FilePath()) {
 			return nil, -1, unix.EPERM
 		}
 	}
@@ -782,6 +797,10 @@ func (fd *controlFDLisa) Connect(sockType uint32) (int, error) {
 	if len(hostPath) >= linux.UnixPathMax {
 		return -1, unix.EINVAL
 	}
+	if !fd.Conn().ServerImpl().(*LisafsServer).config.HostUDSPolicy.Allowed(hostPath) {
+		log.Warningf("Connect to host socket %q denied by --host-uds-allow", hostPath)
+		return -1, unix.EPERM
+	}
 
 	if !isSockTypeSupported(sockType) {
 		return -1, unix.ENXIO
@@ -818,6 +837,10 @@ func (fd *controlFDLisa) BindAt(name string, sockType uint32, mode linux.FileMod
 		log.Warningf("BindAt called with name too long: %q (len=%d)", socketPath, len(socketPath))
 		return nil, linux.Statx{}, nil, -1, unix.EINVAL
 	}
+	if !fd.Conn().ServerImpl().(*LisafsServer).config.HostUDSPolicy.Allowed(socketPath) {
+		log.Warningf("Bind to host socket %q denied by --host-uds-allow", socketPath)
+		return nil, linux.Statx{}, nil, -1, unix.EPERM
+	}
 
 	// Only the following types are supported.
 	if !isSockTypeSupported(sockType) {
@@ -930,6 +953,7 @@ type openFDLisa struct {
 var _ lisafs.OpenFDImpl = (*openFDLisa)(nil)
 
 func (fd *controlFDLisa) newOpenFDLisa(hostFD int, flags uint32) *openFDLisa {
+	hostFDs.Add(hostFD)
 	newFD := &openFDLisa{
 		hostFD: hostFD,
 	}
@@ -948,6 +972,7 @@ func (fd *openFDLisa) FD() *lisafs.OpenFD {
 // Close implements lisafs.OpenFDImpl.Close.
 func (fd *openFDLisa) Close() {
 	if fd.hostFD >= 0 {
+		hostFDs.Remove(fd.hostFD)
 		_ = unix.Close(fd.hostFD)
 		fd.hostFD = -1
 	}
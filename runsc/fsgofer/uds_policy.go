@@ -0,0 +1,127 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"path/filepath"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+)
+
+// UDSPolicy restricts the host Unix domain sockets that can be connected to or
+// bound, on top of Config.HostUDS. A socket is allowed if its host path is
+// under one of the allowed prefixes, or under a mount with the
+// specutils.HostUDSAllowOption option.
+//
+// The gofer serves files by their path in the container, so paths are mapped
+// to host paths through the mounts of the container.
+type UDSPolicy struct {
+	// allowed are the allowed host path prefixes.
+	allowed []string
+
+	// mounts are the mounts of the container, in mount order, starting with
+	// the root.
+	mounts []udsMount
+}
+
+// udsMount maps paths in the container to host paths.
+type udsMount struct {
+	// dst is the path of the mount in the container.
+	dst string
+
+	// src is the host path of the mount.
+	src string
+
+	// allowAll is set if all sockets under the mount are allowed.
+	allowAll bool
+}
+
+// NewUDSPolicy returns the policy allowing sockets under the host path
+// prefixes in allowed, and under mounts with the specutils.HostUDSAllowOption
+// option. root is the host path of the root of the container, and mounts must
+// have been resolved. It returns nil, meaning that all sockets are allowed, if
+// allowed is empty and no mount has the option.
+func NewUDSPolicy(allowed []string, root string, mounts []specs.Mount) *UDSPolicy {
+	p := &UDSPolicy{
+		mounts: []udsMount{{dst: "/", src: root}},
+	}
+	for _, prefix := range allowed {
+		p.allowed = append(p.allowed, filepath.Clean(prefix))
+	}
+	enabled := len(p.allowed) > 0
+	for _, m := range mounts {
+		if !specutils.IsGoferMount(m) {
+			continue
+		}
+		allowAll := specutils.HasMountOption(m.Options, specutils.HostUDSAllowOption)
+		enabled = enabled || allowAll
+		p.mounts = append(p.mounts, udsMount{
+			dst:      filepath.Clean(m.Destination),
+			src:      filepath.Clean(m.Source),
+			allowAll: allowAll,
+		})
+	}
+	if !enabled {
+		return nil
+	}
+	return p
+}
+
+// under returns the path of p relative to dir, if p is dir or is under it.
+func under(p, dir string) (string, bool) {
+	if dir == "/" {
+		return p, true
+	}
+	if p == dir {
+		return "", true
+	}
+	if strings.HasPrefix(p, dir+"/") {
+		return p[len(dir):], true
+	}
+	return "", false
+}
+
+// Allowed returns true if the socket at path p in the container may be
+// connected to or bound. A nil policy allows all sockets.
+func (p *UDSPolicy) Allowed(path string) bool {
+	if p == nil {
+		return true
+	}
+	path = filepath.Clean(path)
+	// The path is served by the most nested mount containing it, or the
+	// last one if several are mounted at the same place.
+	var m *udsMount
+	var rel string
+	for i := range p.mounts {
+		if r, ok := under(path, p.mounts[i].dst); ok && (m == nil || len(p.mounts[i].dst) >= len(m.dst)) {
+			m, rel = &p.mounts[i], r
+		}
+	}
+	if m == nil {
+		return false
+	}
+	if m.allowAll {
+		return true
+	}
+	host := filepath.Join(m.src, rel)
+	for _, prefix := range p.allowed {
+		if _, ok := under(host, prefix); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fsgofer
+
+import (
+	"bytes"
+	"path"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/fsutil"
+	"github.com/talismancer/gvisor-ligolo/pkg/hostarch"
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"golang.org/x/sys/unix"
+)
+
+// watchMask is the set of inotify events reported by watchers.
+const watchMask = unix.IN_ATTRIB | unix.IN_CLOSE_WRITE | unix.IN_CREATE |
+	unix.IN_DELETE | unix.IN_DELETE_SELF | unix.IN_MODIFY | unix.IN_MOVE_SELF |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// inotifyEventSize is the size of struct inotify_event, without its name.
+const inotifyEventSize = 16
+
+// watcher reports changes to the files under a directory, as seen by inotify,
+// on a socket shared with the client. Each message sent on the socket is the
+// path of a changed file relative to the directory, or "." for the directory
+// itself.
+//
+// inotify watches aren't recursive, so a watcher watches each directory of
+// the tree separately, and starts watching directories as they're created.
+type watcher struct {
+	// root is the path of the watched directory.
+	root string
+
+	// inotifyFD is the inotify instance watching the tree.
+	inotifyFD int
+
+	// sock is the watcher's end of the socket shared with the client.
+	sock int
+
+	// dirs maps inotify watch descriptors to the path of the watched
+	// directory, relative to root.
+	dirs map[int32]string
+
+	// full is true if the watcher ran out of inotify watches.
+	full bool
+}
+
+// startWatcher starts watching the tree at root. It returns the client's end
+// of the socket on which changes are reported.
+func startWatcher(root string) (int, error) {
+	inotifyFD, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return -1, err
+	}
+	socks, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		_ = unix.Close(inotifyFD)
+		return -1, err
+	}
+	w := &watcher{
+		root:      root,
+		inotifyFD: inotifyFD,
+		sock:      socks[0],
+		dirs:      make(map[int32]string),
+	}
+	if err := w.addTree("."); err != nil {
+		w.close()
+		_ = unix.Close(socks[1])
+		return -1, err
+	}
+	go w.run() // S/R-SAFE: gofer is not saved.
+	return socks[1], nil
+}
+
+func (w *watcher) close() {
+	_ = unix.Close(w.inotifyFD)
+	_ = unix.Close(w.sock)
+}
+
+// addTree starts watching the directory at rel and its subdirectories.
+func (w *watcher) addTree(rel string) error {
+	if w.full {
+		return nil
+	}
+	p := path.Join(w.root, rel)
+	wd, err := unix.InotifyAddWatch(w.inotifyFD, p, watchMask|unix.IN_ONLYDIR|unix.IN_DONT_FOLLOW)
+	if err != nil {
+		if err == unix.ENOSPC {
+			log.Warningf("Out of inotify watches watching %q, changes to files under other directories won't be reported", p)
+			w.full = true
+		}
+		return err
+	}
+	w.dirs[int32(wd)] = rel
+
+	dirFD, err := unix.Open(p, unix.O_RDONLY|unix.O_DIRECTORY|openFlags, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(dirFD)
+	var subdirs []string
+	buf := make([]byte, 8192)
+	for {
+		n, err := unix.Getdents(dirFD, buf)
+		if err != nil {
+			return err
+		}
+		if n <= 0 {
+			break
+		}
+		fsutil.ParseDirents(buf[:n], func(_ uint64, _ int64, ftype uint8, name string, _ uint16) bool {
+			if ftype == unix.DT_DIR {
+				subdirs = append(subdirs, path.Join(rel, name))
+			}
+			return true
+		})
+	}
+	for _, subdir := range subdirs {
+		// Directories may be removed concurrently; keep watching the others.
+		_ = w.addTree(subdir)
+	}
+	return nil
+}
+
+// run reports changes until the client closes its end of the socket.
+func (w *watcher) run() {
+	defer w.close()
+	fds := []unix.PollFd{
+		{Fd: int32(w.inotifyFD), Events: unix.POLLIN},
+		{Fd: int32(w.sock)},
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		if _, err := unix.Ppoll(fds, nil, nil); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			log.Warningf("Watching %q failed: %v", w.root, err)
+			return
+		}
+		if fds[1].Revents&(unix.POLLHUP|unix.POLLERR) != 0 {
+			return
+		}
+		if fds[0].Revents&unix.POLLIN == 0 {
+			continue
+		}
+		n, err := unix.Read(w.inotifyFD, buf)
+		if err != nil {
+			if err == unix.EAGAIN || err == unix.EINTR {
+				continue
+			}
+			log.Warningf("Watching %q failed: %v", w.root, err)
+			return
+		}
+		if !w.handleEvents(buf[:n]) {
+			return
+		}
+	}
+}
+
+// handleEvents reports the changes described by the inotify events in buf. It
+// returns false if the client closed its end of the socket.
+func (w *watcher) handleEvents(buf []byte) bool {
+	for len(buf) >= inotifyEventSize {
+		wd := int32(hostarch.ByteOrder.Uint32(buf[0:]))
+		mask := hostarch.ByteOrder.Uint32(buf[4:])
+		nameLen := hostarch.ByteOrder.Uint32(buf[12:])
+		if len(buf) < inotifyEventSize+int(nameLen) {
+			break
+		}
+		name := buf[inotifyEventSize : inotifyEventSize+nameLen]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		buf = buf[inotifyEventSize+nameLen:]
+
+		if mask&unix.IN_Q_OVERFLOW != 0 {
+			log.Warningf("inotify queue overflow watching %q, some changes weren't reported", w.root)
+			continue
+		}
+		dir, ok := w.dirs[wd]
+		if !ok {
+			continue
+		}
+		if mask&unix.IN_IGNORED != 0 {
+			delete(w.dirs, wd)
+			continue
+		}
+		rel := path.Join(dir, string(name))
+		if mask&unix.IN_ISDIR != 0 && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			_ = w.addTree(rel)
+		}
+		if _, err := unix.Write(w.sock, []byte(rel)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch implements lisafs.ControlFDImpl.Watch.
+func (fd *controlFDLisa) Watch() (int, error) {
+	return startWatcher(fd.Node().FilePath())
+}
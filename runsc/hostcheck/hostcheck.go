@@ -0,0 +1,177 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hostcheck probes whether the host supports the kernel features that
+// runsc needs to start a sandbox. It's meant to be called before a sandbox is
+// created, so that unsupported hosts are reported with an actionable error
+// rather than an obscure failure when the sandbox process is started.
+package hostcheck
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+	"golang.org/x/sys/unix"
+)
+
+// Error is returned when the host doesn't support a feature required by runsc.
+type Error struct {
+	// Check is the name of the failed check, e.g. "userns".
+	Check string `json:"check"`
+
+	// Reason describes what the host is missing.
+	Reason string `json:"reason"`
+
+	// Remedy describes how to fix the host, if known.
+	Remedy string `json:"remedy,omitempty"`
+
+	// FAQ is the anchor of the FAQ entry about the failure.
+	FAQ string `json:"faq"`
+}
+
+// Error implements error.Error.
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("unsupported host (%s): %s", e.Check, e.Reason)
+	if e.Remedy != "" {
+		msg += ". " + e.Remedy
+	}
+	return specutils.FaqErrorMsg(e.FAQ, msg)
+}
+
+// namespaces are the namespaces created by runsc, and the kernel options
+// required for them.
+var namespaces = []struct {
+	name   string
+	option string
+}{
+	{name: "mnt", option: "CONFIG_NAMESPACES"},
+	{name: "ipc", option: "CONFIG_IPC_NS"},
+	{name: "uts", option: "CONFIG_UTS_NS"},
+	{name: "pid", option: "CONFIG_PID_NS"},
+	{name: "net", option: "CONFIG_NET_NS"},
+	{name: "user", option: "CONFIG_USER_NS"},
+}
+
+// Required returns true if subcommand creates a sandbox, and hence requires
+// the host to pass Probe.
+func Required(subcommand string) bool {
+	switch subcommand {
+	case "create", "do", "restore", "run":
+		return true
+	default:
+		return false
+	}
+}
+
+// Probe checks that the host supports the features required to start a
+// sandbox with conf. It returns an *Error for the first check that fails.
+func Probe(conf *config.Config) error {
+	if err := checkWSL(); err != nil {
+		return err
+	}
+	for _, ns := range namespaces {
+		if _, err := os.Stat("/proc/self/ns/" + ns.name); err != nil {
+			return &Error{
+				Check:  "namespaces",
+				Reason: fmt.Sprintf("the kernel doesn't support %s namespaces: %v", ns.name, err),
+				Remedy: fmt.Sprintf("Use a kernel built with %s", ns.option),
+				FAQ:    "host-namespaces",
+			}
+		}
+	}
+	if conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
+		// User namespaces aren't used in this mode.
+		return nil
+	}
+	return checkUserNS(unix.Geteuid() != 0 || conf.Rootless)
+}
+
+// checkWSL fails on WSL1, which emulates Linux syscalls without a Linux
+// kernel. WSL2 runs a real Linux kernel and is supported.
+func checkWSL() error {
+	release, err := os.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		log.Warningf("Host check: reading kernel release: %v", err)
+		return nil
+	}
+	// WSL1 reports e.g. "4.4.0-19041-Microsoft", WSL2 reports e.g.
+	// "5.15.90.1-microsoft-standard-WSL2".
+	if strings.Contains(string(release), "Microsoft") {
+		return &Error{
+			Check:  "wsl",
+			Reason: "WSL1 doesn't provide the Linux kernel features required by runsc",
+			Remedy: "Convert the distribution to WSL2 with 'wsl --set-version <distro> 2'",
+			FAQ:    "wsl",
+		}
+	}
+	return nil
+}
+
+// checkUserNS checks that user namespaces can be created, by unprivileged
+// users if rootless is set.
+func checkUserNS(rootless bool) error {
+	if v, ok := readSysctl("user/max_user_namespaces"); ok && v == 0 {
+		return &Error{
+			Check:  "userns",
+			Reason: "user namespaces are disabled (user.max_user_namespaces is 0)",
+			Remedy: "Enable them with 'sysctl -w user.max_user_namespaces=15000'",
+			FAQ:    "userns-disabled",
+		}
+	}
+	if !rootless {
+		return nil
+	}
+	// Debian and older Ubuntu kernels.
+	if v, ok := readSysctl("kernel/unprivileged_userns_clone"); ok && v == 0 {
+		return &Error{
+			Check:  "userns",
+			Reason: "unprivileged user namespaces are disabled (kernel.unprivileged_userns_clone is 0), which rootless mode requires",
+			Remedy: "Enable them with 'sysctl -w kernel.unprivileged_userns_clone=1', or run runsc as root",
+			FAQ:    "userns-disabled",
+		}
+	}
+	// Ubuntu 23.10 and later.
+	if v, ok := readSysctl("kernel/apparmor_restrict_unprivileged_userns"); ok && v == 1 {
+		return &Error{
+			Check:  "userns",
+			Reason: "unprivileged user namespaces are restricted by AppArmor (kernel.apparmor_restrict_unprivileged_userns is 1), which rootless mode requires",
+			Remedy: "Allow them for runsc with an AppArmor profile, or run runsc as root",
+			FAQ:    "userns-disabled",
+		}
+	}
+	return nil
+}
+
+// readSysctl reads the integer sysctl at /proc/sys/name. It returns false if
+// the sysctl doesn't exist or can't be read.
+func readSysctl(name string) (int, bool) {
+	data, err := os.ReadFile("/proc/sys/" + name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warningf("Host check: reading sysctl %q: %v", name, err)
+		}
+		return 0, false
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		log.Warningf("Host check: parsing sysctl %q: %v", name, err)
+		return 0, false
+	}
+	return v, true
+}
@@ -19,15 +19,29 @@ package mitigate
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
-const (
-	// mds is the only bug we care about.
-	mds = "mds"
+// smtBugs are the bugs, as named in the bugs field of /proc/cpuinfo, that let
+// a hyperthread observe data of its sibling and are fully mitigated only by
+// disabling SMT.
+var smtBugs = []string{
+	"mds",             // Microarchitectural Data Sampling.
+	"taa",             // TSX Asynchronous Abort.
+	"l1tf",            // L1 Terminal Fault.
+	"mmio_stale_data", // Processor MMIO Stale Data.
+	"retbleed",        // Arbitrary speculative code execution with return instructions.
+	"gds",             // Gather Data Sampling, a.k.a. Downfall.
+	"srso",            // Speculative Return Stack Overflow, a.k.a. Inception.
+	"rfds",            // Register File Data Sampling.
+}
 
+const (
 	// Constants for parsing /proc/cpuinfo.
 	processorKey  = "processor"
 	vendorIDKey   = "vendor_id"
@@ -76,7 +90,8 @@ func NewCPUSet(data string) (CPUSet, error) {
 	return set, nil
 }
 
-// IsVulnerable checks if this CPUSet is vulnerable to MDS.
+// IsVulnerable checks if this CPUSet is vulnerable to a bug mitigated by
+// disabling SMT.
 func (c CPUSet) IsVulnerable() bool {
 	for _, cpu := range c {
 		if cpu.IsVulnerable() {
@@ -86,6 +101,36 @@ func (c CPUSet) IsVulnerable() bool {
 	return false
 }
 
+// SMTBugs returns the sorted bugs mitigated by disabling SMT that any CPU of
+// this CPUSet is vulnerable to.
+func (c CPUSet) SMTBugs() []string {
+	seen := make(map[string]struct{})
+	var bugs []string
+	for _, cpu := range c {
+		for _, bug := range cpu.SMTBugs() {
+			if _, ok := seen[bug]; !ok {
+				seen[bug] = struct{}{}
+				bugs = append(bugs, bug)
+			}
+		}
+	}
+	sort.Strings(bugs)
+	return bugs
+}
+
+// NumCores returns the number of physical cores of this CPUSet.
+func (c CPUSet) NumCores() int {
+	type core struct {
+		physicalID int64
+		coreID     int64
+	}
+	cores := make(map[core]struct{})
+	for _, cpu := range c {
+		cores[core{cpu.physicalID, cpu.coreID}] = struct{}{}
+	}
+	return len(cores)
+}
+
 // String implements the String method for CPUSet.
 func (c CPUSet) String() string {
 	parts := make([]string, len(c))
@@ -178,10 +223,23 @@ func (t *CPU) String() string {
 		bugsKey, strings.Join(bugs, " "))
 }
 
-// IsVulnerable checks if a CPU is vulnerable to mds.
+// IsVulnerable checks if a CPU is vulnerable to a bug mitigated by disabling
+// SMT.
 func (t *CPU) IsVulnerable() bool {
-	_, ok := t.bugs[mds]
-	return ok
+	return len(t.SMTBugs()) > 0
+}
+
+// SMTBugs returns the sorted bugs mitigated by disabling SMT that this CPU is
+// vulnerable to.
+func (t *CPU) SMTBugs() []string {
+	var bugs []string
+	for _, bug := range smtBugs {
+		if _, ok := t.bugs[bug]; ok {
+			bugs = append(bugs, bug)
+		}
+	}
+	sort.Strings(bugs)
+	return bugs
 }
 
 // SimilarTo checks family/model/bugs fields for equality of two
@@ -280,3 +338,70 @@ func parseRegex(data, key, match string) (string, error) {
 	}
 	return matches[1], nil
 }
+
+// ReadVulnerabilities returns the mitigation status reported by the kernel for
+// each vulnerability in dir, usually /sys/devices/system/cpu/vulnerabilities.
+// It returns nil if dir doesn't exist, as is the case on old kernels.
+func ReadVulnerabilities(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	vulns := make(map[string]string, len(entries))
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		vulns[e.Name()] = strings.TrimSpace(string(data))
+	}
+	return vulns, nil
+}
+
+// Report is a machine readable assessment of the host's SMT and
+// vulnerability state.
+type Report struct {
+	// SMTControl is the content of the SMT control file, e.g. "on", "off"
+	// or "notsupported". It's empty if the host has no SMT control.
+	SMTControl string `json:"smt_control"`
+
+	// Threads is the number of online hardware threads.
+	Threads int `json:"threads"`
+
+	// Cores is the number of physical cores of the online threads.
+	Cores int `json:"cores"`
+
+	// Vulnerable is true if any CPU is vulnerable to a bug mitigated by
+	// disabling SMT.
+	Vulnerable bool `json:"vulnerable"`
+
+	// Bugs are the bugs mitigated by disabling SMT that the CPUs are
+	// vulnerable to.
+	Bugs []string `json:"bugs"`
+
+	// Vulnerabilities maps each vulnerability known to the kernel to its
+	// mitigation status.
+	Vulnerabilities map[string]string `json:"vulnerabilities,omitempty"`
+
+	// Action is the action mitigate takes, or would take in a dry run.
+	Action string `json:"action"`
+}
+
+// NewReport creates a Report for the CPUs in set.
+func NewReport(set CPUSet, smtControl string, vulns map[string]string) *Report {
+	bugs := set.SMTBugs()
+	if bugs == nil {
+		bugs = []string{}
+	}
+	return &Report{
+		SMTControl:      smtControl,
+		Threads:         len(set),
+		Cores:           set.NumCores(),
+		Vulnerable:      len(bugs) > 0,
+		Bugs:            bugs,
+		Vulnerabilities: vulns,
+	}
+}
@@ -107,6 +107,33 @@ var AMD8 = MockCPU{
 	ThreadsPerCore: 2,
 }
 
+// SapphireRapids2 is a two core Intel Sapphire Rapids machine, which is only
+// affected by newer bugs.
+var SapphireRapids2 = MockCPU{
+	Name:           "SapphireRapids",
+	VendorID:       "GenuineIntel",
+	Family:         6,
+	Model:          143,
+	ModelName:      "Intel(R) Xeon(R) Platinum 8481C CPU",
+	Bugs:           "spectre_v1 spectre_v2 spec_store_bypass swapgs eibrs_pbrsb gds",
+	PhysicalCores:  1,
+	Cores:          1,
+	ThreadsPerCore: 2,
+}
+
+// Milan2 is a two core AMD Milan machine.
+var Milan2 = MockCPU{
+	Name:           "Milan",
+	VendorID:       "AuthenticAMD",
+	Family:         25,
+	Model:          1,
+	ModelName:      "AMD EPYC 7B13",
+	Bugs:           "sysret_ss_attrs spectre_v1 spectre_v2 spec_store_bypass srso",
+	PhysicalCores:  1,
+	Cores:          1,
+	ThreadsPerCore: 2,
+}
+
 // Empty is an empty CPU set.
 var Empty = MockCPU{
 	Name: "Empty",
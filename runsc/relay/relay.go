@@ -0,0 +1,317 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package relay tunnels control RPCs and connections through chains of
+// sandboxes.
+//
+// A sandbox is made a relay by serving this package's protocol on a TCP
+// listener in its network stack, see sandboxapi.Container.ServeRelay. A relay
+// serves two kinds of requests: connecting to the control server of its
+// sandbox, and connecting to an address through the network stack of its
+// sandbox. Once a request succeeds, the connection to the relay carries the
+// resulting stream. Since the dialed address may be another relay, relays can
+// be chained to reach sandboxes that are only reachable from the network of
+// other sandboxes:
+//
+//	host -> sandbox A -> relay in sandbox B -> relay in sandbox C -> control
+//
+// Each hop authenticates the client, and is authenticated by it, with a secret
+// shared between them, using an HMAC-SHA256 challenge-response exchange. The
+// stream that follows is encrypted and authenticated with keys derived from the
+// secret and the exchange, see sessionConn. Over a chain, the stream to each hop
+// is carried inside the stream to the previous one, so that intermediate relays
+// can't read or alter the traffic of the following hops.
+package relay
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/unet"
+	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
+	"golang.org/x/sys/unix"
+)
+
+// Request targets.
+const (
+	// TargetControl connects to the control server of the relay's sandbox.
+	TargetControl = "control"
+
+	// TargetDial connects to Request.Address through the network stack of
+	// the relay's sandbox.
+	TargetDial = "dial"
+)
+
+const (
+	// MinSecretSize is the minimum size of secrets, in bytes.
+	MinSecretSize = 16
+
+	nonceSize      = 32
+	macSize        = sha256.Size
+	maxRequestSize = 4 << 10
+	maxReplySize   = 4 << 10
+
+	// handshakeTimeout bounds the time taken to authenticate and serve a
+	// request.
+	handshakeTimeout = 30 * time.Second
+
+	statusOK    = 0
+	statusError = 1
+)
+
+// Labels distinguishing the MACs computed by each side, so that one can't be
+// reflected as the other.
+var (
+	clientLabel = []byte("gvisor-relay-v2 client")
+	serverLabel = []byte("gvisor-relay-v2 server")
+)
+
+// Request is sent by a client to a relay once authenticated.
+type Request struct {
+	// Target is TargetControl or TargetDial.
+	Target string `json:"target"`
+
+	// Address is the TCP address connected to for TargetDial.
+	Address string `json:"address,omitempty"`
+}
+
+// Hop is a relay on the path to a sandbox.
+type Hop struct {
+	// Address is the TCP address of the relay, in the network of the
+	// previous hop.
+	Address string
+
+	// Secret is shared by the client and the relay to authenticate each
+	// other.
+	Secret []byte
+}
+
+// checkSecret returns an error if secret is too short.
+func checkSecret(secret []byte) error {
+	if len(secret) < MinSecretSize {
+		return fmt.Errorf("relay secret must be at least %d bytes long, got %d", MinSecretSize, len(secret))
+	}
+	return nil
+}
+
+// ReadSecret reads a secret from the file at path. Trailing newlines are
+// ignored.
+func ReadSecret(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for len(b) > 0 && (b[len(b)-1] == '\n' || b[len(b)-1] == '\r') {
+		b = b[:len(b)-1]
+	}
+	if err := checkSecret(b); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// mac returns the HMAC-SHA256 of parts with key secret.
+func mac(secret []byte, parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+// lengthPrefix returns the size of b as a 16-bit big endian integer.
+func lengthPrefix(b []byte) []byte {
+	var l [2]byte
+	binary.BigEndian.PutUint16(l[:], uint16(len(b)))
+	return l[:]
+}
+
+// readPrefixed reads a length-prefixed message of at most max bytes from r.
+func readPrefixed(r io.Reader, max int) ([]byte, []byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, nil, err
+	}
+	n := int(binary.BigEndian.Uint16(l[:]))
+	if n > max {
+		return nil, nil, fmt.Errorf("message of %d bytes exceeds limit of %d bytes", n, max)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, nil, err
+	}
+	return l[:], b, nil
+}
+
+// handshake authenticates the relay at the other end of conn and asks it for
+// req. The exchange is:
+//
+//	relay:  server nonce
+//	client: client nonce, MAC(client label, nonces, request), request
+//	relay:  status, message, MAC(server label, nonces, status, message)
+//
+// The MAC of the relay covers the client nonce, so that a client only accepts
+// a reply from a relay knowing the secret. On success, the returned connection
+// carries the stream over conn.
+func handshake(conn net.Conn, secret []byte, req Request) (net.Conn, error) {
+	if err := checkSecret(secret); err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	serverNonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(conn, serverNonce); err != nil {
+		return nil, fmt.Errorf("reading challenge: %w", err)
+	}
+	clientNonce := make([]byte, nonceSize)
+	if _, err := rand.Read(clientNonce); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(&req)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxRequestSize {
+		return nil, fmt.Errorf("request of %d bytes exceeds limit of %d bytes", len(body), maxRequestSize)
+	}
+	msg := append([]byte{}, clientNonce...)
+	msg = append(msg, mac(secret, clientLabel, serverNonce, clientNonce, body)...)
+	msg = append(msg, lengthPrefix(body)...)
+	msg = append(msg, body...)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, fmt.Errorf("sending request: %w", err)
+	}
+
+	var status [1]byte
+	if _, err := io.ReadFull(conn, status[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			// Relays close the connection on authentication failures.
+			return nil, fmt.Errorf("relay closed the connection, the secret may be wrong")
+		}
+		return nil, fmt.Errorf("reading reply: %w", err)
+	}
+	l, text, err := readPrefixed(conn, maxReplySize)
+	if err != nil {
+		return nil, fmt.Errorf("reading reply: %w", err)
+	}
+	got := make([]byte, macSize)
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return nil, fmt.Errorf("reading reply: %w", err)
+	}
+	if !hmac.Equal(got, mac(secret, serverLabel, clientNonce, serverNonce, status[:], l, text)) {
+		return nil, fmt.Errorf("relay failed to authenticate")
+	}
+	if status[0] != statusOK {
+		return nil, fmt.Errorf("relay: %s", text)
+	}
+	session, err := newSessionConn(conn, secret, serverNonce, clientNonce, true /* client */)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Connect establishes a tunnel through hops and asks the last one for req.
+// conn must be connected to the first hop, which is typically done by dialing
+// its address through the network stack of a local sandbox. Each hop but the
+// last is asked to dial the next one.
+//
+// On success, the returned connection carries the stream requested from the
+// last hop. On failure, conn is closed.
+func Connect(conn net.Conn, hops []Hop, req Request) (net.Conn, error) {
+	if len(hops) == 0 {
+		conn.Close()
+		return nil, fmt.Errorf("no relay to connect to")
+	}
+	for i, hop := range hops {
+		r := req
+		if i < len(hops)-1 {
+			r = Request{Target: TargetDial, Address: hops[i+1].Address}
+		}
+		session, err := handshake(conn, hop.Secret, r)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("relay %d at %s: %w", i, hop.Address, err)
+		}
+		conn = session
+	}
+	return conn, nil
+}
+
+// NewControlClient returns a client of the control server at the other end of
+// conn, a tunnel established by Connect with TargetControl.
+//
+// Files can't be passed through tunnels, so calls that take files fail.
+func NewControlClient(conn net.Conn) (*urpc.Client, error) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("creating socket pair: %w", err)
+	}
+	f := os.NewFile(uintptr(fds[1]), "relay-control")
+	local, err := net.FileConn(f)
+	f.Close()
+	if err != nil {
+		unix.Close(fds[0])
+		return nil, err
+	}
+	sock, err := unet.NewSocket(fds[0])
+	if err != nil {
+		unix.Close(fds[0])
+		local.Close()
+		return nil, err
+	}
+	go Splice(conn, local)
+	return urpc.NewClient(sock), nil
+}
+
+// closeWriter is implemented by connections that support half-close.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// Splice copies data between a and b in both directions until both are done,
+// and closes them.
+func Splice(a, b net.Conn) {
+	defer a.Close()
+	defer b.Close()
+	done := make(chan struct{}, 2)
+	copyTo := func(dst, src net.Conn) {
+		defer func() { done <- struct{}{} }()
+		if _, err := io.Copy(dst, src); err != nil {
+			// Unblock the other direction.
+			a.Close()
+			b.Close()
+			return
+		}
+		if cw, ok := dst.(closeWriter); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+	go copyTo(a, b)
+	go copyTo(b, a)
+	<-done
+	<-done
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+)
+
+// Backend serves the requests of a relay.
+type Backend interface {
+	// DialControl connects to the control server of the sandbox.
+	DialControl() (net.Conn, error)
+
+	// Dial connects to the TCP address through the network stack of the
+	// sandbox.
+	Dial(address string) (net.Conn, error)
+}
+
+// Server serves the relay protocol.
+type Server struct {
+	// Secret authenticates clients and the server to each other. It must be
+	// at least MinSecretSize bytes long.
+	Secret []byte
+
+	// Backend serves requests.
+	Backend Backend
+}
+
+// Serve serves connections accepted from l until accepting fails.
+func (s *Server) Serve(l net.Listener) error {
+	if err := checkSecret(s.Secret); err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle serves one connection, see handshake.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	serverNonce := make([]byte, nonceSize)
+	if _, err := rand.Read(serverNonce); err != nil {
+		log.Warningf("Relay failed to generate nonce: %v", err)
+		return
+	}
+	if _, err := conn.Write(serverNonce); err != nil {
+		return
+	}
+	msg := make([]byte, nonceSize+macSize)
+	if _, err := io.ReadFull(conn, msg); err != nil {
+		log.Debugf("Relay failed to read request from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	clientNonce, got := msg[:nonceSize], msg[nonceSize:]
+	_, body, err := readPrefixed(conn, maxRequestSize)
+	if err != nil {
+		log.Debugf("Relay failed to read request from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if !hmac.Equal(got, mac(s.Secret, clientLabel, serverNonce, clientNonce, body)) {
+		// Don't tell unauthenticated clients anything.
+		log.Warningf("Relay rejected connection from %s: authentication failed", conn.RemoteAddr())
+		return
+	}
+
+	var req Request
+	var peer net.Conn
+	if err = json.Unmarshal(body, &req); err == nil {
+		peer, err = s.open(&req)
+	}
+	status, text := byte(statusOK), []byte{}
+	if err != nil {
+		log.Infof("Relay request %+v from %s failed: %v", req, conn.RemoteAddr(), err)
+		status, text = statusError, []byte(err.Error())
+		if len(text) > maxReplySize {
+			text = text[:maxReplySize]
+		}
+	}
+	reply := []byte{status}
+	reply = append(reply, lengthPrefix(text)...)
+	reply = append(reply, text...)
+	reply = append(reply, mac(s.Secret, serverLabel, clientNonce, serverNonce, reply[:1], reply[1:3], text)...)
+	if _, err := conn.Write(reply); err != nil || peer == nil {
+		if peer != nil {
+			peer.Close()
+		}
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	session, err := newSessionConn(conn, s.Secret, serverNonce, clientNonce, false /* client */)
+	if err != nil {
+		log.Warningf("Relay failed to set up stream for %s: %v", conn.RemoteAddr(), err)
+		peer.Close()
+		return
+	}
+	log.Debugf("Relay serving %+v for %s", req, conn.RemoteAddr())
+	Splice(session, peer)
+}
+
+// open serves req.
+func (s *Server) open(req *Request) (net.Conn, error) {
+	switch req.Target {
+	case TargetControl:
+		return s.Backend.DialControl()
+	case TargetDial:
+		if _, _, err := net.SplitHostPort(req.Address); err != nil {
+			return nil, err
+		}
+		return s.Backend.Dial(req.Address)
+	default:
+		return nil, fmt.Errorf("unknown target %q", req.Target)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package relay
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	// maxFrameSize is the maximum size of the plaintext of a frame.
+	maxFrameSize = 16 << 10
+
+	// frameHeaderSize is the size of the header of frames: the type of the
+	// frame and the size of its ciphertext.
+	frameHeaderSize = 3
+
+	frameData = 0
+	frameEnd  = 1
+)
+
+// Labels of the keys derived for each direction of a stream.
+var (
+	clientKeyLabel = []byte("gvisor-relay-v2 client stream")
+	serverKeyLabel = []byte("gvisor-relay-v2 server stream")
+)
+
+// errStreamTampered is returned by sessionConn.Read when a frame fails to
+// authenticate.
+var errStreamTampered = errors.New("relay stream failed to authenticate")
+
+// sessionConn carries a stream over conn once a handshake succeeded. Each
+// direction is encrypted and authenticated with AES-256-GCM, with a key derived
+// from the secret and the nonces of the handshake, so that a stream is bound to
+// its handshake. Frames are:
+//
+//	type (1 byte), ciphertext size (2 bytes), ciphertext
+//
+// The nonce of a frame is its sequence number in its direction, which prevents
+// frames from being dropped, replayed or reordered, and the header is
+// authenticated with it. The end of a direction is marked by an empty frameEnd
+// frame, so that streams can't be truncated either.
+type sessionConn struct {
+	net.Conn
+
+	// readMu serializes reads and protects the fields below it.
+	readMu  sync.Mutex
+	open    cipher.AEAD
+	readSeq uint64
+	// pending is the plaintext received but not read yet.
+	pending []byte
+	// readErr is returned by reads once set.
+	readErr error
+
+	// writeMu serializes writes and protects the fields below it.
+	writeMu  sync.Mutex
+	seal     cipher.AEAD
+	writeSeq uint64
+	closed   bool
+}
+
+// newSessionConn returns a sessionConn over conn, keyed for the given side of
+// the handshake that used nonces serverNonce and clientNonce.
+func newSessionConn(conn net.Conn, secret, serverNonce, clientNonce []byte, client bool) (*sessionConn, error) {
+	clientAEAD, err := newStreamAEAD(mac(secret, clientKeyLabel, serverNonce, clientNonce))
+	if err != nil {
+		return nil, err
+	}
+	serverAEAD, err := newStreamAEAD(mac(secret, serverKeyLabel, serverNonce, clientNonce))
+	if err != nil {
+		return nil, err
+	}
+	c := &sessionConn{Conn: conn, open: clientAEAD, seal: serverAEAD}
+	if client {
+		c.open, c.seal = serverAEAD, clientAEAD
+	}
+	return c, nil
+}
+
+// newStreamAEAD returns an AES-GCM AEAD with key.
+func newStreamAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// frameNonce returns the nonce of the frame with sequence number seq.
+func frameNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// Read implements net.Conn.Read.
+func (c *sessionConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for len(c.pending) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		if len(b) == 0 {
+			return 0, nil
+		}
+		c.pending, c.readErr = c.readFrame()
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readFrame reads and opens the next frame. It returns io.EOF at the end of
+// the stream.
+func (c *sessionConn) readFrame() ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(c.Conn, header[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			// The stream ended without an end frame.
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint16(header[1:]))
+	if size > maxFrameSize+c.open.Overhead() {
+		return nil, fmt.Errorf("relay frame of %d bytes exceeds limit of %d bytes", size, maxFrameSize+c.open.Overhead())
+	}
+	ciphertext := make([]byte, size)
+	if _, err := io.ReadFull(c.Conn, ciphertext); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	plaintext, err := c.open.Open(ciphertext[:0], frameNonce(c.open, c.readSeq), ciphertext, header[:])
+	if err != nil {
+		return nil, errStreamTampered
+	}
+	c.readSeq++
+	switch header[0] {
+	case frameData:
+		return plaintext, nil
+	case frameEnd:
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("unknown relay frame type %d", header[0])
+	}
+}
+
+// Write implements net.Conn.Write.
+func (c *sessionConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	written := 0
+	for len(b) > 0 {
+		n := len(b)
+		if n > maxFrameSize {
+			n = maxFrameSize
+		}
+		if err := c.writeFrame(frameData, b[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// writeFrame seals and writes a frame of type typ carrying plaintext.
+func (c *sessionConn) writeFrame(typ byte, plaintext []byte) error {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(plaintext)+c.seal.Overhead())
+	frame[0] = typ
+	binary.BigEndian.PutUint16(frame[1:], uint16(len(plaintext)+c.seal.Overhead()))
+	frame = c.seal.Seal(frame, frameNonce(c.seal, c.writeSeq), plaintext, frame[:frameHeaderSize])
+	c.writeSeq++
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// CloseWrite ends the stream sent to the other end, and half-closes the
+// underlying connection if it supports it.
+func (c *sessionConn) CloseWrite() error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	if err := c.writeFrame(frameEnd, nil); err != nil {
+		return err
+	}
+	if cw, ok := c.Conn.(closeWriter); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// exitHookTimeout is the time given to the exit hook to consume an event.
+const exitHookTimeout = 30 * time.Second
+
+// ExitEvent describes a sandbox process that exited before reporting the exit
+// status of its root container, e.g. because it crashed or was killed. It's
+// passed to the exit hook as JSON.
+type ExitEvent struct {
+	// SandboxID is the ID of the sandbox.
+	SandboxID string `json:"sandboxId"`
+
+	// PID is the PID of the sandbox process.
+	PID int `json:"pid"`
+
+	// ContainerIDs are the IDs of the containers that were running in the
+	// sandbox.
+	ContainerIDs []string `json:"containerIds"`
+
+	// StatusKnown is set if the exit status of the sandbox process is known.
+	// It's only known to the process that created the sandbox.
+	StatusKnown bool `json:"statusKnown"`
+
+	// ExitCode is the exit code of the sandbox process, if it exited.
+	ExitCode int `json:"exitCode,omitempty"`
+
+	// Signal is the signal that killed the sandbox process, if any.
+	Signal string `json:"signal,omitempty"`
+
+	// PanicLog is the path of the panic log of the sandbox, if any.
+	PanicLog string `json:"panicLog,omitempty"`
+
+	// Time is when the exit was detected.
+	Time time.Time `json:"time"`
+}
+
+// Preconditions: s.statusMu is locked.
+func (s *Sandbox) newExitEvent(pid int) *ExitEvent {
+	ev := &ExitEvent{
+		SandboxID: s.ID,
+		PID:       pid,
+		PanicLog:  s.PanicLog,
+		Time:      time.Now(),
+	}
+	if s.child {
+		ev.StatusKnown = true
+		if s.status.Signaled() {
+			ev.Signal = s.status.Signal().String()
+		} else {
+			ev.ExitCode = s.status.ExitStatus()
+		}
+	}
+	return ev
+}
+
+// UnexpectedExit returns a description of the exit of the sandbox process, if
+// Wait found that the sandbox exited before reporting the exit status of the
+// root container. Otherwise, it returns nil.
+func (s *Sandbox) UnexpectedExit() *ExitEvent {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	if s.unexpectedExit == nil {
+		return nil
+	}
+	ev := *s.unexpectedExit
+	return &ev
+}
+
+// NotifyExit passes ev to the exit hook of the sandbox. It's a noop if the
+// sandbox has no exit hook.
+func (s *Sandbox) NotifyExit(ev *ExitEvent) error {
+	if len(s.ExitHook) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	ctx, cancel := context.WithTimeout(context.Background(), exitHookTimeout)
+	defer cancel()
+	if path, ok := strings.CutPrefix(s.ExitHook, "unix:"); ok {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "unix", path)
+		if err != nil {
+			return fmt.Errorf("connecting to exit hook socket %q: %w", path, err)
+		}
+		defer conn.Close()
+		deadline, _ := ctx.Deadline()
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		if _, err := conn.Write(data); err != nil {
+			return fmt.Errorf("writing to exit hook socket %q: %w", path, err)
+		}
+		return nil
+	}
+
+	cmd := exec.CommandContext(ctx, s.ExitHook)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"RUNSC_SANDBOX_ID="+ev.SandboxID,
+		"RUNSC_PANIC_LOG="+ev.PanicLog,
+	)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running exit hook %q: %w", s.ExitHook, err)
+	}
+	return nil
+}
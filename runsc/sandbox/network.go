@@ -54,36 +54,48 @@ import (
 // Run the following container to test it:
 //
 //	docker run -di --runtime=runsc -p 8080:80 -v $PWD:/usr/local/apache2/htdocs/ httpd:2.4
-func setupNetwork(conn *urpc.Client, pid int, conf *config.Config) error {
+func setupNetwork(conn *urpc.Client, pid int, conf *config.Config) ([]VFIODevice, error) {
 	log.Infof("Setting up network")
 
 	switch conf.Network {
 	case config.NetworkNone:
 		log.Infof("Network is disabled, create loopback interface only")
 		if err := createDefaultLoopbackInterface(conf, conn); err != nil {
-			return fmt.Errorf("creating default loopback interface: %v", err)
+			return nil, fmt.Errorf("creating default loopback interface: %v", err)
 		}
 	case config.NetworkSandbox:
 		// Build the path to the net namespace of the sandbox process.
 		// This is what we will copy.
 		nsPath := filepath.Join("/proc", strconv.Itoa(pid), "ns/net")
-		if err := createInterfacesAndRoutesFromNS(conn, nsPath, conf); err != nil {
-			return fmt.Errorf("creating interfaces from net namespace %q: %v", nsPath, err)
+		claimed, err := createInterfacesAndRoutesFromNS(conn, nsPath, conf)
+		if err != nil {
+			return claimed, fmt.Errorf("creating interfaces from net namespace %q: %v", nsPath, err)
 		}
+		return claimed, nil
 	case config.NetworkHost:
 		// Nothing to do here.
 	default:
-		return fmt.Errorf("invalid network type: %v", conf.Network)
+		return nil, fmt.Errorf("invalid network type: %v", conf.Network)
 	}
-	return nil
+	return nil, nil
 }
 
 func createDefaultLoopbackInterface(conf *config.Config, conn *urpc.Client) error {
 	link := boot.DefaultLoopbackLink
 	link.GvisorGROTimeout = conf.GvisorGROTimeout
-	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, &boot.CreateLinksAndRoutesArgs{
+	args := boot.CreateLinksAndRoutesArgs{
 		LoopbackLinks: []boot.LoopbackLink{link},
-	}, nil); err != nil {
+	}
+	shmFiles, err := addSharedMemLink(conf, &args)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range shmFiles {
+			f.Close()
+		}
+	}()
+	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, &args, nil); err != nil {
 		return fmt.Errorf("creating loopback link and routes: %v", err)
 	}
 	return nil
@@ -122,30 +134,40 @@ func isRootNS() (bool, error) {
 // createInterfacesAndRoutesFromNS scrapes the interface and routes from the
 // net namespace with the given path, creates them in the sandbox, and removes
 // them from the host.
-func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *config.Config) error {
+func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *config.Config) ([]VFIODevice, error) {
 	// Join the network namespace that we will be copying.
 	restore, err := joinNetNS(nsPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer restore()
 
 	// Get all interfaces in the namespace.
 	ifaces, err := net.Interfaces()
 	if err != nil {
-		return fmt.Errorf("querying interfaces: %w", err)
+		return nil, fmt.Errorf("querying interfaces: %w", err)
 	}
 
 	isRoot, err := isRootNS()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if isRoot {
-		return fmt.Errorf("cannot run with network enabled in root network namespace")
+		return nil, fmt.Errorf("cannot run with network enabled in root network namespace")
 	}
 
 	// Collect addresses and routes from the interfaces.
-	var args boot.CreateLinksAndRoutesArgs
+	var (
+		args      boot.CreateLinksAndRoutesArgs
+		vfioFiles []*os.File
+		claimed   []VFIODevice
+	)
+	defer func() {
+		// The sandbox holds its own copies.
+		for _, f := range vfioFiles {
+			f.Close()
+		}
+	}()
 	for _, iface := range ifaces {
 		if iface.Flags&net.FlagUp == 0 {
 			log.Infof("Skipping down interface: %+v", iface)
@@ -154,14 +176,14 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 
 		allAddrs, err := iface.Addrs()
 		if err != nil {
-			return fmt.Errorf("fetching interface addresses for %q: %w", iface.Name, err)
+			return claimed, fmt.Errorf("fetching interface addresses for %q: %w", iface.Name, err)
 		}
 
 		// We build our own loopback device.
 		if iface.Flags&net.FlagLoopback != 0 {
 			link, err := loopbackLink(conf, iface, allAddrs)
 			if err != nil {
-				return fmt.Errorf("getting loopback link for iface %q: %w", iface.Name, err)
+				return claimed, fmt.Errorf("getting loopback link for iface %q: %w", iface.Name, err)
 			}
 			args.LoopbackLinks = append(args.LoopbackLinks, link)
 			continue
@@ -171,7 +193,7 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 		for _, ifaddr := range allAddrs {
 			ipNet, ok := ifaddr.(*net.IPNet)
 			if !ok {
-				return fmt.Errorf("address is not IPNet: %+v", ifaddr)
+				return claimed, fmt.Errorf("address is not IPNet: %+v", ifaddr)
 			}
 			ipAddrs = append(ipAddrs, ipNet)
 		}
@@ -183,7 +205,7 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 		// Collect data from the ARP table.
 		dump, err := netlink.NeighList(iface.Index, 0)
 		if err != nil {
-			return fmt.Errorf("fetching ARP table for %q: %w", iface.Name, err)
+			return claimed, fmt.Errorf("fetching ARP table for %q: %w", iface.Name, err)
 		}
 
 		var neighbors []boot.Neighbor
@@ -201,28 +223,35 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 		// will remove the routes as well.
 		routes, defv4, defv6, err := routesForIface(iface)
 		if err != nil {
-			return fmt.Errorf("getting routes for interface %q: %v", iface.Name, err)
+			return claimed, fmt.Errorf("getting routes for interface %q: %v", iface.Name, err)
 		}
+		// With several interfaces, e.g. attached by CNI multi-network
+		// plugins, more than one may have a default route. They are all
+		// kept, and the sandbox orders them by metric like the host.
 		if defv4 != nil {
-			if !args.Defaultv4Gateway.Route.Empty() {
-				return fmt.Errorf("more than one default route found, interface: %v, route: %v, default route: %+v", iface.Name, defv4, args.Defaultv4Gateway)
+			if args.Defaultv4Gateway.Route.Empty() {
+				args.Defaultv4Gateway.Route = *defv4
+				args.Defaultv4Gateway.Name = iface.Name
+			} else {
+				log.Infof("Interface %q has another default route %+v, default route: %+v", iface.Name, defv4, args.Defaultv4Gateway)
+				routes = append(routes, *defv4)
 			}
-			args.Defaultv4Gateway.Route = *defv4
-			args.Defaultv4Gateway.Name = iface.Name
 		}
 
 		if defv6 != nil {
-			if !args.Defaultv6Gateway.Route.Empty() {
-				return fmt.Errorf("more than one default route found, interface: %v, route: %v, default route: %+v", iface.Name, defv6, args.Defaultv6Gateway)
+			if args.Defaultv6Gateway.Route.Empty() {
+				args.Defaultv6Gateway.Route = *defv6
+				args.Defaultv6Gateway.Name = iface.Name
+			} else {
+				log.Infof("Interface %q has another default route %+v, default route: %+v", iface.Name, defv6, args.Defaultv6Gateway)
+				routes = append(routes, *defv6)
 			}
-			args.Defaultv6Gateway.Route = *defv6
-			args.Defaultv6Gateway.Name = iface.Name
 		}
 
 		// Get the link for the interface.
 		ifaceLink, err := netlink.LinkByName(iface.Name)
 		if err != nil {
-			return fmt.Errorf("getting link for interface %q: %w", iface.Name, err)
+			return claimed, fmt.Errorf("getting link for interface %q: %w", iface.Name, err)
 		}
 		linkAddress := ifaceLink.Attrs().HardwareAddr
 
@@ -238,18 +267,45 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 				// If we encounter an error while deleting the ip,
 				// verify the ip is still present on the interface.
 				if present, err := isAddressOnInterface(iface.Name, addr); err != nil {
-					return fmt.Errorf("checking if address %v is on interface %q: %w", addr, iface.Name, err)
+					return claimed, fmt.Errorf("checking if address %v is on interface %q: %w", addr, iface.Name, err)
 				} else if !present {
 					continue
 				}
-				return fmt.Errorf("removing address %v from device %q: %w", addr, iface.Name, err)
+				return claimed, fmt.Errorf("removing address %v from device %q: %w", addr, iface.Name, err)
+			}
+		}
+
+		if conf.VFIONet.Enabled() {
+			pciAddr, err := pciAddressOfInterface(iface.Name)
+			if err != nil {
+				return claimed, err
+			}
+			if pciAddr != "" && conf.VFIONet.Allows(pciAddr) {
+				dev, files, err := claimVFIODevice(pciAddr)
+				if err != nil {
+					return claimed, fmt.Errorf("claiming PCI device %s of interface %q: %w", pciAddr, iface.Name, err)
+				}
+				claimed = append(claimed, *dev)
+				vfioFiles = append(vfioFiles, files.Container, files.Group, files.Device)
+				args.VFIOLinks = append(args.VFIOLinks, boot.VFIOLink{
+					Name:             iface.Name,
+					PCIAddress:       pciAddr,
+					MTU:              iface.MTU,
+					Routes:           routes,
+					QDisc:            conf.QDisc,
+					Neighbors:        neighbors,
+					LinkAddress:      linkAddress,
+					Addresses:        addresses,
+					GvisorGROTimeout: conf.GvisorGROTimeout,
+				})
+				continue
 			}
 		}
 
 		if conf.AFXDP {
 			xdpSockFDs, err := createSocketXDP(iface)
 			if err != nil {
-				return fmt.Errorf("failed to create XDP socket: %v", err)
+				return claimed, fmt.Errorf("failed to create XDP socket: %v", err)
 			}
 			args.FilePayload.Files = append(args.FilePayload.Files, xdpSockFDs...)
 			args.XDPLinks = append(args.XDPLinks, boot.XDPLink{
@@ -264,6 +320,7 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 				LinkAddress:       linkAddress,
 				Addresses:         addresses,
 				GvisorGROTimeout:  conf.GvisorGROTimeout,
+				SaveRestore:       conf.TCPRepair,
 			})
 		} else {
 			link := boot.FDBasedLink{
@@ -277,26 +334,43 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 				Neighbors:         neighbors,
 				LinkAddress:       linkAddress,
 				Addresses:         addresses,
+				SaveRestore:       conf.TCPRepair,
+			}
+
+			// vhost-net adds and strips the virtio header itself, so
+			// the socket must not expect one.
+			var vhostFile *os.File
+			if conf.VhostNet {
+				vhostFile, err = os.OpenFile("/dev/vhost-net", os.O_RDWR, 0)
+				if err != nil {
+					log.Warningf("Failed to open /dev/vhost-net, falling back to fd-based link for %s: %v", iface.Name, err)
+					vhostFile = nil
+				}
 			}
+			enableGSO := conf.HostGSO && vhostFile == nil
 
 			log.Debugf("Setting up network channels")
 			// Create the socket for the device.
 			for i := 0; i < link.NumChannels; i++ {
 				log.Debugf("Creating Channel %d", i)
-				socketEntry, err := createSocket(iface, ifaceLink, conf.HostGSO)
+				socketEntry, err := createSocket(iface, ifaceLink, enableGSO)
 				if err != nil {
-					return fmt.Errorf("failed to createSocket for %s : %w", iface.Name, err)
+					return claimed, fmt.Errorf("failed to createSocket for %s : %w", iface.Name, err)
 				}
 				if i == 0 {
 					link.GSOMaxSize = socketEntry.gsoMaxSize
 				} else {
 					if link.GSOMaxSize != socketEntry.gsoMaxSize {
-						return fmt.Errorf("inconsistent gsoMaxSize %d and %d when creating multiple channels for same interface: %s",
+						return claimed, fmt.Errorf("inconsistent gsoMaxSize %d and %d when creating multiple channels for same interface: %s",
 							link.GSOMaxSize, socketEntry.gsoMaxSize, iface.Name)
 					}
 				}
 				args.FilePayload.Files = append(args.FilePayload.Files, socketEntry.deviceFile)
 			}
+			if vhostFile != nil {
+				link.VhostNet = true
+				args.FilePayload.Files = append(args.FilePayload.Files, vhostFile)
+			}
 
 			if link.GSOMaxSize == 0 && conf.GvisorGSO {
 				// Host GSO is disabled. Let's enable gVisor GSO.
@@ -314,16 +388,29 @@ func createInterfacesAndRoutesFromNS(conn *urpc.Client, nsPath string, conf *con
 		args.PCAP = true
 		pcap, err := os.OpenFile(conf.PCAP, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0664)
 		if err != nil {
-			return fmt.Errorf("failed to open PCAP file %s: %v", conf.PCAP, err)
+			return claimed, fmt.Errorf("failed to open PCAP file %s: %v", conf.PCAP, err)
 		}
 		args.FilePayload.Files = append(args.FilePayload.Files, pcap)
 	}
 
+	shmFiles, err := addSharedMemLink(conf, &args)
+	if err != nil {
+		return claimed, err
+	}
+	defer func() {
+		for _, f := range shmFiles {
+			f.Close()
+		}
+	}()
+
+	// VFIO files come last.
+	args.FilePayload.Files = append(args.FilePayload.Files, vfioFiles...)
+
 	log.Debugf("Setting up network, config: %+v", args)
 	if err := conn.Call(boot.NetworkCreateLinksAndRoutes, &args, nil); err != nil {
-		return fmt.Errorf("creating links and routes: %w", err)
+		return claimed, fmt.Errorf("creating links and routes: %w", err)
 	}
-	return nil
+	return claimed, nil
 }
 
 // isAddressOnInterface checks if an address is on an interface
@@ -522,7 +609,8 @@ func loopbackLink(conf *config.Config, iface net.Interface, addrs []net.Addr) (b
 }
 
 // routesForIface iterates over all routes for the given interface and converts
-// them to boot.Routes. It also returns the a default v4/v6 route if found.
+// them to boot.Routes. It also returns the default v4/v6 route with the lowest
+// metric if found. Other default routes are returned with the routes.
 func routesForIface(iface net.Interface) ([]boot.Route, *boot.Route, *boot.Route, error) {
 	link, err := netlink.LinkByIndex(iface.Index)
 	if err != nil {
@@ -544,28 +632,39 @@ func routesForIface(iface net.Interface) ([]boot.Route, *boot.Route, *boot.Route
 			// Create a catch all route to the gateway.
 			switch len(r.Gw) {
 			case header.IPv4AddressSize:
-				if defv4 != nil {
-					return nil, nil, nil, fmt.Errorf("more than one default route found %q, def: %+v, route: %+v", iface.Name, defv4, r)
-				}
-				defv4 = &boot.Route{
+				def := &boot.Route{
 					Destination: net.IPNet{
 						IP:   net.IPv4zero,
 						Mask: net.IPMask(net.IPv4zero),
 					},
 					Gateway: r.Gw,
+					Metric:  r.Priority,
 				}
-			case header.IPv6AddressSize:
-				if defv6 != nil {
-					return nil, nil, nil, fmt.Errorf("more than one default route found %q, def: %+v, route: %+v", iface.Name, defv6, r)
+				if defv4 != nil {
+					if defv4.Metric <= def.Metric {
+						routes = append(routes, *def)
+						continue
+					}
+					routes = append(routes, *defv4)
 				}
-
-				defv6 = &boot.Route{
+				defv4 = def
+			case header.IPv6AddressSize:
+				def := &boot.Route{
 					Destination: net.IPNet{
 						IP:   net.IPv6zero,
 						Mask: net.IPMask(net.IPv6zero),
 					},
 					Gateway: r.Gw,
+					Metric:  r.Priority,
+				}
+				if defv6 != nil {
+					if defv6.Metric <= def.Metric {
+						routes = append(routes, *def)
+						continue
+					}
+					routes = append(routes, *defv6)
 				}
+				defv6 = def
 			default:
 				return nil, nil, nil, fmt.Errorf("unexpected address size for gateway: %+v for route: %+v", r.Gw, r)
 			}
@@ -577,6 +676,7 @@ func routesForIface(iface net.Interface) ([]boot.Route, *boot.Route, *boot.Route
 		routes = append(routes, boot.Route{
 			Destination: dst,
 			Gateway:     r.Gw,
+			Metric:      r.Priority,
 		})
 	}
 	return routes, defv4, defv6, nil
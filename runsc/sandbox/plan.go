@@ -0,0 +1,163 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/syndtr/gocapability/capability"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/platform"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"github.com/talismancer/gvisor-ligolo/runsc/specutils"
+	"golang.org/x/sys/unix"
+)
+
+// Plan describes how a sandbox process would be started, without starting
+// it. It's used by "runsc create --dry-run".
+type Plan struct {
+	// Platform is the platform of the sandbox.
+	Platform string `json:"platform"`
+
+	// PlatformDevice is the device opened for the platform, if any.
+	PlatformDevice string `json:"platformDevice,omitempty"`
+
+	// Namespaces are the namespaces the sandbox process is started in.
+	Namespaces []NamespacePlan `json:"namespaces"`
+
+	// UID and GID are the host user and group the sandbox process runs as.
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+
+	// Chroot is true if the sandbox process sets up a minimal chroot.
+	Chroot bool `json:"chroot"`
+
+	// DonatedFDs maps the resources in the FD manifest passed to the sandbox
+	// process to their number of FDs. See boot.FDManifest.
+	DonatedFDs map[string]int `json:"donatedFDs"`
+}
+
+// NamespacePlan describes a namespace a process is started in.
+type NamespacePlan struct {
+	// Type is the type of the namespace.
+	Type specs.LinuxNamespaceType `json:"type"`
+
+	// Path is the namespace that is joined, or empty if a new one is created.
+	Path string `json:"path,omitempty"`
+}
+
+// NewPlan returns how a sandbox process would be started for args, with
+// goferMounts gofer-backed mounts (including the root) and overlayFilestores
+// overlay filestore files. It mirrors the decisions made by
+// createSandboxProcess and must be kept in sync with it.
+func NewPlan(conf *config.Config, args *Args, goferMounts, overlayFilestores int) (*Plan, error) {
+	p := &Plan{
+		Platform: conf.Platform,
+		UID:      os.Getuid(),
+		GID:      os.Getgid(),
+		DonatedFDs: map[string]int{
+			"controller-fd": 1,
+			"spec-fd":       1,
+			"start-sync-fd": 1,
+			"mounts-fd":     1,
+			"stdio-fds":     3,
+		},
+	}
+	if goferMounts > 0 {
+		p.DonatedFDs["io-fds"] = goferMounts
+	}
+	if overlayFilestores > 0 {
+		p.DonatedFDs["overlay-filestore-fds"] = overlayFilestores
+	}
+	portDir, err := portReservationDir(conf, args.Spec)
+	if err != nil {
+		return nil, err
+	}
+	optional := map[string]bool{
+		"user-log-fd":             args.UserLog != "",
+		"pod-init-config-fd":      conf.PodInitConfig != "",
+		"auto-checkpoint-dir-fd":  conf.AutoCheckpoint.Enabled(),
+		"core-dump-dir-fd":        conf.CoreDumpDir != "",
+		"entropy-fd":              conf.EntropySource != "",
+		"memory-pressure-fd":      conf.HostMemoryPressure,
+		"exec-fd":                 args.ExecFile != nil,
+		"grpc-control-fd":         conf.GRPCControlSocket != "",
+		"port-reservation-dir-fd": portDir != "",
+		"tls-intercept-ca-fd":     conf.TLSInterceptCA != "",
+		"tls-intercept-roots-fd":  conf.TLSInterceptCA != "",
+		"flight-recorder-fd":      conf.FlightRecorder != "",
+	}
+	for name, donated := range optional {
+		if donated {
+			p.DonatedFDs[name] = 1
+		}
+	}
+
+	gPlatform, err := platform.Lookup(conf.Platform)
+	if err != nil {
+		return nil, fmt.Errorf("cannot look up platform: %w", err)
+	}
+	deviceFile, err := gPlatform.OpenDevice(conf.PlatformDevicePath)
+	if err != nil {
+		return nil, fmt.Errorf("opening device file for platform %q: %v", conf.Platform, err)
+	}
+	if deviceFile != nil {
+		p.PlatformDevice = deviceFile.Name()
+		p.DonatedFDs["device-fd"] = 1
+		_ = deviceFile.Close()
+	}
+
+	p.Namespaces = []NamespacePlan{
+		{Type: specs.IPCNamespace},
+		{Type: specs.MountNamespace},
+		{Type: specs.UTSNamespace},
+	}
+	if !gPlatform.Requirements().RequiresCurrentPIDNS {
+		p.Namespaces = append(p.Namespaces, NamespacePlan{Type: specs.PIDNamespace})
+	}
+	if ns, ok := specutils.GetNS(specs.NetworkNamespace, args.Spec); ok && conf.Network != config.NetworkNone {
+		p.Namespaces = append(p.Namespaces, NamespacePlan{Type: ns.Type, Path: ns.Path})
+	} else if conf.Network != config.NetworkHost {
+		p.Namespaces = append(p.Namespaces, NamespacePlan{Type: specs.NetworkNamespace})
+	}
+
+	rootlessEUID := unix.Geteuid() != 0
+	if conf.Network == config.NetworkHost || conf.DirectFS {
+		if userns, ok := specutils.GetNS(specs.UserNamespace, args.Spec); ok {
+			p.Namespaces = append(p.Namespaces, NamespacePlan{Type: userns.Type, Path: userns.Path})
+		} else if rootlessEUID {
+			return nil, fmt.Errorf("unable to run a rootless container without userns")
+		}
+		if !conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
+			if !specutils.HasCapabilities(capability.CAP_SYS_ADMIN) && !rootlessEUID {
+				return nil, fmt.Errorf("can't run sandbox process in minimal chroot since we don't have CAP_SYS_ADMIN")
+			}
+			p.Chroot = true
+		}
+	} else if !conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
+		if !rootlessEUID && !specutils.HasCapabilities(capability.CAP_SETUID, capability.CAP_SETGID) {
+			return nil, fmt.Errorf("can't run sandbox process as user nobody since we don't have CAP_SETUID or CAP_SETGID")
+		}
+		p.Namespaces = append(p.Namespaces, NamespacePlan{Type: specs.UserNamespace})
+		p.Chroot = true
+		if !rootlessEUID && !conf.Rootless {
+			const nobody = 65534
+			p.UID = nobody
+			p.GID = nobody
+		}
+	}
+	return p, nil
+}
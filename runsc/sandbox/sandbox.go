@@ -38,12 +38,17 @@ import (
 	"github.com/talismancer/gvisor-ligolo/pkg/control/client"
 	"github.com/talismancer/gvisor-ligolo/pkg/control/server"
 	"github.com/talismancer/gvisor-ligolo/pkg/coverage"
+	"github.com/talismancer/gvisor-ligolo/pkg/fdaudit"
 	"github.com/talismancer/gvisor-ligolo/pkg/log"
 	metricpb "github.com/talismancer/gvisor-ligolo/pkg/metric/metric_go_proto"
 	"github.com/talismancer/gvisor-ligolo/pkg/prometheus"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/control"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/faultinject"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/hostmm"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/kernel"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/platform"
 	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck"
+	"github.com/talismancer/gvisor-ligolo/pkg/sentry/seccheck/sinks/recorder"
 	"github.com/talismancer/gvisor-ligolo/pkg/sync"
 	"github.com/talismancer/gvisor-ligolo/pkg/urpc"
 	"github.com/talismancer/gvisor-ligolo/runsc/boot"
@@ -90,6 +95,86 @@ func createControlSocket(rootDir, id string) (string, int, error) {
 	return "", -1, fmt.Errorf("unable to find location to write socket file")
 }
 
+// createGRPCControlSocket creates a listening socket at path for the gRPC
+// control server. A stale socket left at path is replaced. Only the owner may
+// connect to the socket.
+func createGRPCControlSocket(path string) (*os.File, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%q exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+	fd, err := unix.Socket(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	f := os.NewFile(uintptr(fd), "grpc_control_server_socket")
+	if err := unix.Bind(fd, &unix.SockaddrUnix{Name: path}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	if err := unix.Listen(fd, 16 /* unet.backlog */); err != nil {
+		f.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return f, nil
+}
+
+// portReservationDir returns the directory holding the port reservations of
+// the sandboxes joining the network namespace of spec, or "" if the sandbox
+// doesn't reserve ports.
+func portReservationDir(conf *config.Config, spec *specs.Spec) (string, error) {
+	if conf.PortReservationDir == "" || conf.Network != config.NetworkSandbox {
+		return "", nil
+	}
+	ns, ok := specutils.GetNS(specs.NetworkNamespace, spec)
+	if !ok || ns.Path == "" {
+		// The sandbox gets a network namespace of its own.
+		return "", nil
+	}
+	var st unix.Stat_t
+	if err := unix.Stat(ns.Path, &st); err != nil {
+		return "", fmt.Errorf("stat network namespace %q: %w", ns.Path, err)
+	}
+	return filepath.Join(conf.PortReservationDir, fmt.Sprintf("netns-%d-%d", st.Dev, st.Ino)), nil
+}
+
+// hostCABundles are the usual locations of the CA bundle of the host.
+var hostCABundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian/Ubuntu/Gentoo etc.
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora/RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS/RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine Linux
+}
+
+// tlsInterceptRoots returns the host file holding the CA certificates that
+// servers of intercepted TLS connections are verified with, or "" if TLS
+// connections aren't intercepted.
+func tlsInterceptRoots(conf *config.Config) (string, error) {
+	if conf.TLSInterceptCA == "" {
+		return "", nil
+	}
+	if conf.TLSInterceptRoots != "" {
+		return conf.TLSInterceptRoots, nil
+	}
+	for _, path := range hostCABundles {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("no CA bundle found on the host, --tls-intercept-roots must be set")
+}
+
 // pid is an atomic type that implements JSON marshal/unmarshal interfaces.
 type pid struct {
 	val atomicbitops.Int64
@@ -178,10 +263,41 @@ type Sandbox struct {
 	// ControlAddress is the uRPC address used to connect to the sandbox.
 	ControlAddress string `json:"control_address"`
 
+	// GRPCControlAddress is the path of the socket of the gRPC control
+	// server, if --grpc-control-socket is set.
+	GRPCControlAddress string `json:"grpcControlAddress,omitempty"`
+
+	// Platform is the name of the platform the sandbox runs on.
+	Platform string `json:"platform"`
+
 	// MountHints provides extra information about container mounts that apply
 	// to the entire pod.
 	MountHints *boot.PodMountHints `json:"mountHints"`
 
+	// VFIODevices are the PCI devices claimed for the sandbox network. They
+	// are returned to their original drivers when the sandbox is destroyed.
+	VFIODevices []VFIODevice `json:"vfioDevices,omitempty"`
+
+	// ServiceSockets are the paths of the host sockets of services bridged
+	// by the sandbox. They are removed when the sandbox is destroyed.
+	ServiceSockets []string `json:"serviceSockets,omitempty"`
+
+	// ExitHook is the hook notified when the sandbox process exits
+	// unexpectedly, see config.Config.SandboxExitHook.
+	ExitHook string `json:"exitHook,omitempty"`
+
+	// PanicLog is the path of the file the sandbox process writes panic
+	// reports to, if any.
+	PanicLog string `json:"panicLog,omitempty"`
+
+	// FlightRecorder is the path of the flight recorder ring of the sandbox,
+	// if any. It's kept after the sandbox is destroyed.
+	FlightRecorder string `json:"flightRecorder,omitempty"`
+
+	// StartupPhases are the startup phases of the sandbox recorded on the
+	// host. Phases recorded inside the sandbox are returned by StartupReport.
+	StartupPhases []boot.StartupPhase `json:"startupPhases,omitempty"`
+
 	// child is set if a sandbox process is a child of the current process.
 	//
 	// This field isn't saved to json, because only a creator of sandbox
@@ -196,6 +312,10 @@ type Sandbox struct {
 	// threads to wait on sandbox and get the exit code, since Linux will return
 	// WaitStatus to one of the waiters only.
 	status unix.WaitStatus
+
+	// unexpectedExit is set if the sandbox process was found to have exited
+	// while waiting for the root container. It's protected by statusMu.
+	unexpectedExit *ExitEvent
 }
 
 // Getpid returns the process ID of the sandbox process.
@@ -255,17 +375,30 @@ type Args struct {
 	// configured from the --pod-init-config file.
 	SinkFiles []*os.File
 
+	// ServiceFiles is the ordered array of host sockets of the services
+	// configured from the --pod-init-config file.
+	ServiceFiles []*os.File
+
 	// PassFiles are user-supplied files from the host to be exposed to the
 	// sandboxed app.
 	PassFiles map[int]*os.File
 
+	// ListenAddresses maps the guest FDs of listening sockets in PassFiles
+	// to the address they're exposed on with netstack, if set.
+	ListenAddresses map[int]string
+
 	// ExecFile is the file from the host used for program execution.
 	ExecFile *os.File
+
+	// ExePath is the path of the runsc binary that runs the sandbox. If
+	// empty, specutils.ExePath is used.
+	ExePath string
 }
 
 // New creates the sandbox process. The caller must call Destroy() on the
-// sandbox.
-func New(conf *config.Config, args *Args) (*Sandbox, error) {
+// sandbox. If ctx is done before the sandbox has booted, the sandbox is
+// destroyed and ctx.Err() is returned.
+func New(ctx context.Context, conf *config.Config, args *Args) (*Sandbox, error) {
 	s := &Sandbox{
 		ID: args.ID,
 		CgroupJSON: cgroup.CgroupJSON{
@@ -276,6 +409,8 @@ func New(conf *config.Config, args *Args) (*Sandbox, error) {
 		MetricMetadata:      conf.MetricMetadata(),
 		MetricServerAddress: conf.MetricServer,
 		MountHints:          args.MountHints,
+		ExitHook:            conf.SandboxExitHook,
+		Platform:            conf.Platform,
 	}
 	if args.Spec != nil && args.Spec.Annotations != nil {
 		s.PodName = args.Spec.Annotations[podNameAnnotation]
@@ -300,6 +435,9 @@ func New(conf *config.Config, args *Args) (*Sandbox, error) {
 		if err != nil {
 			return nil, fmt.Errorf("cannot init config: %w", err)
 		}
+		if err := s.createServiceSockets(initConf.Services, args); err != nil {
+			return nil, err
+		}
 	}
 
 	// Create pipe to synchronize when sandbox process has been booted.
@@ -310,6 +448,8 @@ func New(conf *config.Config, args *Args) (*Sandbox, error) {
 	defer clientSyncFile.Close()
 
 	// Create the sandbox process.
+	var startup boot.StartupRecorder
+	endPhase := startup.Begin("", "create-sandbox-process")
 	err = s.createSandboxProcess(conf, args, sandboxSyncFile)
 	// sandboxSyncFile has to be closed to be able to detect when the sandbox
 	// process exits unexpectedly.
@@ -317,10 +457,20 @@ func New(conf *config.Config, args *Args) (*Sandbox, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot create sandbox process: %w", err)
 	}
+	endPhase()
 
 	// Wait until the sandbox has booted.
+	endPhase = startup.Begin("", "wait-for-boot")
 	b := make([]byte, 1)
-	if l, err := clientSyncFile.Read(b); err != nil || l != 1 {
+	stop := afterDone(ctx, func() {
+		_ = clientSyncFile.SetReadDeadline(time.Now())
+	})
+	l, err := clientSyncFile.Read(b)
+	stop()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil || l != 1 {
 		err := fmt.Errorf("waiting for sandbox to start: %v", err)
 		// If the sandbox failed to start, it may be because the binary
 		// permissions were incorrect. Check the bits and return a more helpful
@@ -335,6 +485,8 @@ func New(conf *config.Config, args *Args) (*Sandbox, error) {
 		}
 		return nil, fmt.Errorf("cannot read client sync file: %w", err)
 	}
+	endPhase()
+	s.StartupPhases = startup.Phases()
 
 	if conf.MetricServer != "" {
 		// The control server is up and the sandbox was configured to export metrics.
@@ -352,7 +504,7 @@ func New(conf *config.Config, args *Args) (*Sandbox, error) {
 }
 
 // CreateSubcontainer creates a container inside the sandbox.
-func (s *Sandbox) CreateSubcontainer(conf *config.Config, cid string, tty *os.File) error {
+func (s *Sandbox) CreateSubcontainer(ctx context.Context, conf *config.Config, cid string, tty *os.File) error {
 	log.Debugf("Create sub-container %q in sandbox %q, PID: %d", cid, s.ID, s.Pid.load())
 
 	var files []*os.File
@@ -367,14 +519,14 @@ func (s *Sandbox) CreateSubcontainer(conf *config.Config, cid string, tty *os.Fi
 		CID:         cid,
 		FilePayload: urpc.FilePayload{Files: files},
 	}
-	if err := s.call(boot.ContMgrCreateSubcontainer, &args, nil); err != nil {
+	if err := s.callContext(ctx, boot.ContMgrCreateSubcontainer, &args, nil); err != nil {
 		return fmt.Errorf("creating sub-container %q: %w", cid, err)
 	}
 	return nil
 }
 
 // StartRoot starts running the root container process inside the sandbox.
-func (s *Sandbox) StartRoot(conf *config.Config) error {
+func (s *Sandbox) StartRoot(ctx context.Context, conf *config.Config) error {
 	pid := s.Pid.load()
 	log.Debugf("Start root sandbox %q, PID: %d", s.ID, pid)
 	conn, err := s.sandboxConnect()
@@ -382,28 +534,39 @@ func (s *Sandbox) StartRoot(conf *config.Config) error {
 		return err
 	}
 	defer conn.Close()
-
-	// Configure the network.
-	if err := setupNetwork(conn, pid, conf); err != nil {
-		return fmt.Errorf("setting up network: %w", err)
+	stop := shutdownAfterDone(ctx, conn)
+	defer stop()
+
+	// Configure the network. Claimed devices are recorded even on failure,
+	// so that they are released when the sandbox is destroyed.
+	var startup boot.StartupRecorder
+	endPhase := startup.Begin("", "setup-network")
+	vfioDevices, err := setupNetwork(conn, pid, conf)
+	s.VFIODevices = append(s.VFIODevices, vfioDevices...)
+	if err != nil {
+		return fmt.Errorf("setting up network: %w", contextError(ctx, err))
 	}
+	endPhase()
 
 	// Send a message to the sandbox control server to start the root container.
+	endPhase = startup.Begin(s.ID, "start-root")
 	if err := conn.Call(boot.ContMgrRootContainerStart, &s.ID, nil); err != nil {
-		return fmt.Errorf("starting root container: %w", err)
+		return fmt.Errorf("starting root container: %w", contextError(ctx, err))
 	}
+	endPhase()
+	s.StartupPhases = append(s.StartupPhases, startup.Phases()...)
 
 	return nil
 }
 
 // StartSubcontainer starts running a sub-container inside the sandbox.
-func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid string, stdios, goferFiles, overlayFilestoreFiles []*os.File, overlayMediums []boot.OverlayMedium) error {
+func (s *Sandbox) StartSubcontainer(ctx context.Context, spec *specs.Spec, conf *config.Config, cid string, stdios, goferFiles, overlayFilestoreFiles []*os.File, overlayMediums []boot.OverlayMedium) error {
 	log.Debugf("Start sub-container %q in sandbox %q, PID: %d", cid, s.ID, s.Pid.load())
 
 	if err := s.configureStdios(conf, stdios); err != nil {
 		return err
 	}
-	s.fixPidns(spec)
+	s.fixNamespaces(spec)
 
 	// The payload contains (in this specific order):
 	// * stdin/stdout/stderr (optional: only present when not using TTY)
@@ -424,14 +587,36 @@ func (s *Sandbox) StartSubcontainer(spec *specs.Spec, conf *config.Config, cid s
 		OverlayMediums:         overlayMediums,
 		FilePayload:            payload,
 	}
-	if err := s.call(boot.ContMgrStartSubcontainer, &args, nil); err != nil {
+	if err := s.callContext(ctx, boot.ContMgrStartSubcontainer, &args, nil); err != nil {
 		return fmt.Errorf("starting sub-container %v: %w", spec.Process.Args, err)
 	}
 	return nil
 }
 
+// ReconnectGofer connects the mounts of a container to its restarted gofer
+// through goferFiles, which are ordered like the gofer files the container was
+// started with.
+func (s *Sandbox) ReconnectGofer(cid string, goferFiles []*os.File) error {
+	log.Debugf("Reconnect gofer of container %q in sandbox %q", cid, s.ID)
+	args := boot.ReconnectGoferArgs{
+		CID:         cid,
+		FilePayload: urpc.FilePayload{Files: goferFiles},
+	}
+	if err := s.call(boot.ContMgrReconnectGofer, &args, nil); err != nil {
+		return fmt.Errorf("reconnecting gofer of container %q: %w", cid, err)
+	}
+	return nil
+}
+
 // Restore sends the restore call for a container in the sandbox.
-func (s *Sandbox) Restore(conf *config.Config, cid string, filename string) error {
+//
+// env contains environment variables that changed since the checkpoint. They
+// are written to conf.RestoreEnvFile inside the sandbox. precopy, if not nil,
+// holds the memory pre-copied by the migration that saved the state.
+//
+// If ctx is done before the restore completes, the restore is canceled and the
+// sandbox must be destroyed.
+func (s *Sandbox) Restore(ctx context.Context, conf *config.Config, cid string, filename string, env []string, precopy *os.File) error {
 	log.Debugf("Restore sandbox %q", s.ID)
 
 	rf, err := os.Open(filename)
@@ -445,6 +630,12 @@ func (s *Sandbox) Restore(conf *config.Config, cid string, filename string) erro
 			Files: []*os.File{rf},
 		},
 		SandboxID: s.ID,
+		Env:       env,
+		EnvFile:   conf.RestoreEnvFile,
+	}
+	if precopy != nil {
+		opt.Precopy = true
+		opt.FilePayload.Files = append(opt.FilePayload.Files, precopy)
 	}
 
 	// If the platform needs a device FD we must pass it in.
@@ -462,15 +653,63 @@ func (s *Sandbox) Restore(conf *config.Config, cid string, filename string) erro
 	defer conn.Close()
 
 	// Configure the network.
-	if err := setupNetwork(conn, s.Pid.load(), conf); err != nil {
-		return fmt.Errorf("setting up network: %v", err)
+	stop := shutdownAfterDone(ctx, conn)
+	vfioDevices, err := setupNetwork(conn, s.Pid.load(), conf)
+	stop()
+	s.VFIODevices = append(s.VFIODevices, vfioDevices...)
+	if err != nil {
+		return fmt.Errorf("setting up network: %w", contextError(ctx, err))
+	}
+
+	// Restore the container and start the root container. The restore goes on
+	// in the sandbox if the connection is shut down, so it's canceled with
+	// CancelRestore instead.
+	done := make(chan struct{})
+	stop = afterDone(ctx, func() {
+		for {
+			// The restore may not have started in the sandbox yet, retry
+			// until it's canceled or done.
+			if err := s.CancelRestore(); err == nil {
+				return
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(restoreCancelRetryInterval):
+			}
+		}
+	})
+	err = conn.Call(boot.ContMgrRestore, &opt, nil)
+	close(done)
+	stop()
+	if err != nil {
+		return fmt.Errorf("restoring container %q: %w", cid, contextError(ctx, err))
 	}
 
-	// Restore the container and start the root container.
-	if err := conn.Call(boot.ContMgrRestore, &opt, nil); err != nil {
-		return fmt.Errorf("restoring container %q: %v", cid, err)
+	return nil
+}
+
+// restoreCancelRetryInterval is the interval between attempts to cancel a
+// restore that hasn't started in the sandbox yet.
+const restoreCancelRetryInterval = 100 * time.Millisecond
+
+// RestoreProgress returns the progress of the restore in progress in the
+// sandbox, if any.
+func (s *Sandbox) RestoreProgress() (*boot.RestoreProgress, error) {
+	var progress boot.RestoreProgress
+	if err := s.call(boot.ContMgrRestoreProgress, nil, &progress); err != nil {
+		return nil, fmt.Errorf("getting restore progress of sandbox %q: %w", s.ID, err)
 	}
+	return &progress, nil
+}
 
+// CancelRestore cancels the restore in progress in the sandbox. The sandbox
+// must then be destroyed.
+func (s *Sandbox) CancelRestore() error {
+	log.Debugf("Cancel restore of sandbox %q", s.ID)
+	if err := s.call(boot.ContMgrRestoreCancel, nil, nil); err != nil {
+		return fmt.Errorf("canceling restore of sandbox %q: %w", s.ID, err)
+	}
 	return nil
 }
 
@@ -521,6 +760,16 @@ func (s *Sandbox) DeleteTraceSession(name string) error {
 	return nil
 }
 
+// UpdateTraceSession replaces the points of an existing trace session,
+// keeping its sinks.
+func (s *Sandbox) UpdateTraceSession(config *seccheck.SessionConfig) error {
+	log.Debugf("Updating trace session %q in sandbox %q", config.Name, s.ID)
+	if err := s.call(boot.ContMgrUpdateTraceSession, config, nil); err != nil {
+		return fmt.Errorf("updating trace session: %w", err)
+	}
+	return nil
+}
+
 // ListTraceSessions lists all trace sessions.
 func (s *Sandbox) ListTraceSessions() ([]seccheck.SessionConfig, error) {
 	log.Debugf("Listing trace sessions in sandbox %q", s.ID)
@@ -541,6 +790,17 @@ func (s *Sandbox) ProcfsDump() ([]procfs.ProcessProcfsDump, error) {
 	return procfsDump, nil
 }
 
+// StartupReport returns the startup phases of the sandbox, both recorded on
+// the host and inside the sandbox.
+func (s *Sandbox) StartupReport() (*boot.StartupReport, error) {
+	log.Debugf("Startup report %q", s.ID)
+	report := &boot.StartupReport{Host: s.StartupPhases}
+	if err := s.call(boot.ContMgrStartupPhases, nil, &report.Sandbox); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q startup phases: %w", s.ID, err)
+	}
+	return report, nil
+}
+
 // NewCGroup returns the sandbox's Cgroup, or an error if it does not have one.
 func (s *Sandbox) NewCGroup() (cgroup.Cgroup, error) {
 	return cgroup.NewFromPid(s.Pid.load(), false /* useSystemd */)
@@ -583,6 +843,32 @@ func (s *Sandbox) Event(cid string) (*boot.EventOut, error) {
 	return &e, nil
 }
 
+// StreamEvents starts streaming the events of container cid to f, see
+// boot.containerManager.StreamEvents.
+func (s *Sandbox) StreamEvents(cid string, f *os.File, interval time.Duration) error {
+	log.Debugf("Streaming events for container %q in sandbox %q", cid, s.ID)
+	opts := boot.StreamEventsOpts{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+		ContainerID: cid,
+		Interval:    interval,
+	}
+	if err := s.call(boot.ContMgrStreamEvents, &opts, nil); err != nil {
+		return fmt.Errorf("streaming event data from sandbox: %w", err)
+	}
+	return nil
+}
+
+// SetEgressPolicy replaces the egress policy of the sandbox. A nil policy
+// lifts egress restrictions.
+func (s *Sandbox) SetEgressPolicy(p *boot.EgressPolicy) error {
+	log.Debugf("Setting egress policy of sandbox %q", s.ID)
+	args := boot.SetEgressPolicyArgs{Policy: p}
+	if err := s.call(boot.ContMgrSetEgressPolicy, &args, nil); err != nil {
+		return fmt.Errorf("setting egress policy of sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
 // PortForward starts port forwarding to the sandbox.
 func (s *Sandbox) PortForward(opts *boot.PortForwardOpts) error {
 	log.Debugf("Requesting port forward for container %q in sandbox %q: %+v", opts.ContainerID, s.ID, opts)
@@ -599,6 +885,56 @@ func (s *Sandbox) PortForward(opts *boot.PortForwardOpts) error {
 	return nil
 }
 
+// Dial connects to addr through the sandbox network stack on behalf of
+// container cid, and forwards the connection to f.
+func (s *Sandbox) Dial(ctx context.Context, cid, addr string, f *os.File) error {
+	log.Debugf("Dialing %s for container %q in sandbox %q", addr, cid, s.ID)
+	opts := boot.DialOpts{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+		ContainerID: cid,
+		Address:     addr,
+	}
+	if err := s.callContext(ctx, boot.ContMgrDial, &opts, nil); err != nil {
+		return fmt.Errorf("dialing %s in sandbox: %w", addr, err)
+	}
+	return nil
+}
+
+// Listen listens on addr in the sandbox network stack on behalf of container
+// cid.
+func (s *Sandbox) Listen(cid, addr string) (*boot.ListenResult, error) {
+	log.Debugf("Listening on %s for container %q in sandbox %q", addr, cid, s.ID)
+	opts := boot.ListenOpts{
+		ContainerID: cid,
+		Address:     addr,
+	}
+	var res boot.ListenResult
+	if err := s.call(boot.ContMgrListen, &opts, &res); err != nil {
+		return nil, fmt.Errorf("listening on %s in sandbox: %w", addr, err)
+	}
+	return &res, nil
+}
+
+// Accept waits for a connection on listener id, created by Listen, and
+// forwards it to f. It returns the address of the peer.
+func (s *Sandbox) Accept(cid string, id uint64, f *os.File) (string, error) {
+	opts := boot.AcceptOpts{
+		FilePayload: urpc.FilePayload{Files: []*os.File{f}},
+		ContainerID: cid,
+		ID:          id,
+	}
+	var res boot.AcceptResult
+	if err := s.call(boot.ContMgrAccept, &opts, &res); err != nil {
+		return "", fmt.Errorf("accepting connection in sandbox: %w", err)
+	}
+	return res.Address, nil
+}
+
+// CloseListener closes listener id, created by Listen.
+func (s *Sandbox) CloseListener(id uint64) error {
+	return s.call(boot.ContMgrCloseListener, &id, nil)
+}
+
 func (s *Sandbox) sandboxConnect() (*urpc.Client, error) {
 	log.Debugf("Connecting to sandbox %q", s.ID)
 	conn, err := client.ConnectTo(s.ControlAddress)
@@ -618,6 +954,55 @@ func (s *Sandbox) call(method string, arg, result any) error {
 	return conn.Call(method, arg, result)
 }
 
+// callContext is like call, but the call is interrupted if ctx is done before
+// it returns. ctx.Err() is returned in that case.
+func (s *Sandbox) callContext(ctx context.Context, method string, arg, result any) error {
+	conn, err := s.sandboxConnect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := shutdownAfterDone(ctx, conn)
+	defer stop()
+	return contextError(ctx, conn.Call(method, arg, result))
+}
+
+// shutdownAfterDone shuts down conn once ctx is done, which interrupts the
+// calls in progress on it. The returned function stops waiting for ctx.
+func shutdownAfterDone(ctx context.Context, conn *urpc.Client) func() {
+	return afterDone(ctx, func() {
+		_ = conn.Socket.Shutdown()
+	})
+}
+
+// afterDone calls f in a new goroutine once ctx is done, unless the returned
+// function is called first.
+func afterDone(ctx context.Context, f func()) func() {
+	if ctx.Done() == nil {
+		return func() {}
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			f()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
+
+// contextError returns ctx.Err() if err is not nil and ctx is done, as err is
+// then likely caused by the interruption of the operation. Otherwise, it
+// returns err.
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
 func (s *Sandbox) connError(err error) error {
 	return fmt.Errorf("connecting to control server at PID %d: %v", s.Pid.load(), err)
 }
@@ -671,8 +1056,15 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 			return err
 		}
 	}
-	if err := donations.DonateDebugLogFile("panic-log-fd", conf.PanicLog, "panic", test); err != nil {
-		return err
+	if len(conf.PanicLog) > 0 {
+		// Open the file here, instead of using DonateDebugLogFile, to record
+		// its final path for the exit hook.
+		file, err := specutils.DebugLogFile(conf.PanicLog, "panic", test)
+		if err != nil {
+			return fmt.Errorf("opening debug log file in %q: %v", conf.PanicLog, err)
+		}
+		donations.DonateAndClose("panic-log-fd", file)
+		s.PanicLog = file.Name()
 	}
 	covFilename := conf.CoverageReport
 	if covFilename == "" {
@@ -685,7 +1077,11 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	}
 
 	// Relay all the config flags to the sandbox process.
-	cmd := exec.Command(specutils.ExePath, conf.ToFlags()...)
+	exePath := args.ExePath
+	if exePath == "" {
+		exePath = specutils.ExePath
+	}
+	cmd := exec.Command(exePath, conf.ToFlags()...)
 	cmd.SysProcAttr = &unix.SysProcAttr{
 		// Detach from this session, otherwise cmd will get SIGHUP and SIGCONT
 		// when re-parented.
@@ -705,20 +1101,8 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	// All flags after this must be for the boot command
 	cmd.Args = append(cmd.Args, "boot", "--bundle="+args.BundleDir)
 
-	// Clear environment variables, unless --TESTONLY-unsafe-nonroot is set.
-	if !conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
-		// Setting cmd.Env = nil causes cmd to inherit the current process's env.
-		cmd.Env = []string{}
-	}
-
-	// If there is a gofer, sends all socket ends to the sandbox.
-	donations.DonateAndClose("io-fds", args.IOFiles...)
-	donations.DonateAndClose("overlay-filestore-fds", args.OverlayFilestoreFiles...)
-	donations.DonateAndClose("mounts-fd", args.MountsFile)
-	donations.Donate("start-sync-fd", startSyncFile)
-	if err := donations.OpenAndDonate("user-log-fd", args.UserLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND); err != nil {
-		return err
-	}
+	// Profiling FDs are passed as flags, as they are shared with other
+	// commands. All other resources are passed in the FD manifest.
 	const profFlags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
 	if err := donations.OpenAndDonate("profile-block-fd", conf.ProfileBlock, profFlags); err != nil {
 		return err
@@ -735,6 +1119,25 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	if err := donations.OpenAndDonate("trace-fd", conf.TraceFile, profFlags); err != nil {
 		return err
 	}
+	nextFD = donations.Transfer(cmd, nextFD)
+
+	// Clear environment variables, unless --TESTONLY-unsafe-nonroot is set.
+	// The current process's env is copied explicitly in that case, since Go
+	// runtime settings are appended to cmd.Env below.
+	if conf.TestOnlyAllowRunAsCurrentUserWithoutChroot {
+		cmd.Env = os.Environ()
+	} else {
+		cmd.Env = []string{}
+	}
+
+	// If there is a gofer, sends all socket ends to the sandbox.
+	donations.DonateAndClose("io-fds", args.IOFiles...)
+	donations.DonateAndClose("overlay-filestore-fds", args.OverlayFilestoreFiles...)
+	donations.DonateAndClose("mounts-fd", args.MountsFile)
+	donations.Donate("start-sync-fd", startSyncFile)
+	if err := donations.OpenAndDonate("user-log-fd", args.UserLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND); err != nil {
+		return err
+	}
 
 	// Pass overlay mediums.
 	cmd.Args = append(cmd.Args, "--overlay-mediums="+boot.ToOverlayMediumFlags(args.OverlayMediums))
@@ -748,6 +1151,17 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	s.ControlAddress = controlAddress
 	donations.DonateAndClose("controller-fd", os.NewFile(uintptr(sockFD), "control_server_socket"))
 
+	if conf.GRPCControlSocket != "" {
+		path := strings.ReplaceAll(conf.GRPCControlSocket, "%ID%", s.ID)
+		grpcFile, err := createGRPCControlSocket(path)
+		if err != nil {
+			return fmt.Errorf("creating gRPC control socket %q: %w", path, err)
+		}
+		log.Infof("gRPC control socket: %q", path)
+		s.GRPCControlAddress = path
+		donations.DonateAndClose("grpc-control-fd", grpcFile)
+	}
+
 	specFile, err := specutils.OpenSpec(args.BundleDir)
 	if err != nil {
 		return fmt.Errorf("cannot open spec file in bundle dir %v: %w", args.BundleDir, err)
@@ -758,6 +1172,75 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 		return err
 	}
 	donations.DonateAndClose("sink-fds", args.SinkFiles...)
+	donations.DonateAndClose("service-fds", args.ServiceFiles...)
+
+	if conf.FlightRecorder != "" {
+		if err := os.MkdirAll(conf.FlightRecorder, 0700); err != nil {
+			return fmt.Errorf("creating flight recorder directory: %w", err)
+		}
+		path := filepath.Join(conf.FlightRecorder, s.ID+".ring")
+		ring, err := recorder.Open(path, uint64(conf.FlightRecorderSize)<<20)
+		if err != nil {
+			return fmt.Errorf("opening flight recorder ring %q: %w", path, err)
+		}
+		log.Infof("Flight recorder ring: %q", path)
+		s.FlightRecorder = path
+		donations.DonateAndClose("flight-recorder-fd", ring)
+	}
+
+	if conf.AutoCheckpoint.Enabled() {
+		if err := os.MkdirAll(conf.AutoCheckpoint.Dir, 0755); err != nil {
+			return fmt.Errorf("creating auto-checkpoint directory: %w", err)
+		}
+		if err := donations.OpenAndDonate("auto-checkpoint-dir-fd", conf.AutoCheckpoint.Dir, os.O_RDONLY|unix.O_DIRECTORY); err != nil {
+			return err
+		}
+	}
+
+	if conf.CoreDumpDir != "" {
+		if err := os.MkdirAll(conf.CoreDumpDir, 0755); err != nil {
+			return fmt.Errorf("creating core dump directory: %w", err)
+		}
+		if err := donations.OpenAndDonate("core-dump-dir-fd", conf.CoreDumpDir, os.O_RDONLY|unix.O_DIRECTORY); err != nil {
+			return err
+		}
+	}
+
+	portDir, err := portReservationDir(conf, args.Spec)
+	if err != nil {
+		return err
+	}
+	if portDir != "" {
+		if err := os.MkdirAll(portDir, 0755); err != nil {
+			return fmt.Errorf("creating port reservation directory: %w", err)
+		}
+		if err := donations.OpenAndDonate("port-reservation-dir-fd", portDir, os.O_RDONLY|unix.O_DIRECTORY); err != nil {
+			return err
+		}
+	}
+
+	if err := donations.OpenAndDonate("entropy-fd", conf.EntropySource, os.O_RDONLY); err != nil {
+		return err
+	}
+
+	if err := donations.OpenAndDonate("tls-intercept-ca-fd", conf.TLSInterceptCA, os.O_RDONLY); err != nil {
+		return err
+	}
+	roots, err := tlsInterceptRoots(conf)
+	if err != nil {
+		return err
+	}
+	if err := donations.OpenAndDonate("tls-intercept-roots-fd", roots, os.O_RDONLY); err != nil {
+		return err
+	}
+
+	if conf.HostMemoryPressure {
+		if file, err := openMemoryPressure(args.Cgroup); err != nil {
+			log.Warningf("Host memory pressure notifications disabled: %v", err)
+		} else {
+			donations.DonateAndClose("memory-pressure-fd", file)
+		}
+	}
 
 	gPlatform, err := platform.Lookup(conf.Platform)
 	if err != nil {
@@ -768,11 +1251,22 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	} else if deviceFile != nil {
 		donations.DonateAndClose("device-fd", deviceFile)
 	}
+	nextFD = donations.TransferToManifest(cmd, nextFD)
 
+	var godebug []string
 	// TODO(b/151157106): syscall tests fail by timeout if asyncpreemptoff
 	// isn't set.
 	if conf.Platform == "kvm" {
-		cmd.Env = append(cmd.Env, "GODEBUG=asyncpreemptoff=1")
+		godebug = append(godebug, "asyncpreemptoff=1")
+	}
+	if conf.SentryGODEBUG != "" {
+		godebug = append(godebug, conf.SentryGODEBUG)
+	}
+	if len(godebug) > 0 {
+		cmd.Env = append(cmd.Env, "GODEBUG="+strings.Join(godebug, ","))
+	}
+	if conf.SentryGOGC != "" {
+		cmd.Env = append(cmd.Env, "GOGC="+conf.SentryGOGC)
 	}
 
 	// nss is the set of namespaces to join or create before starting the sandbox
@@ -831,6 +1325,8 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 					return err
 				}
 				defer syncFile.Close()
+				// The sync FD is used before the FD manifest is read.
+				nextFD = donations.Transfer(cmd, nextFD)
 				setUserMappings = true
 			} else {
 				specutils.SetUIDGIDMappings(cmd, args.Spec)
@@ -910,9 +1406,9 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	}
 
 	// The current process' stdio must be passed to the application via the
-	// --stdio-fds flag. The stdio of the sandbox process itself must not
-	// be connected to the same FDs, otherwise we risk leaking sandbox
-	// errors to the application, so we set the sandbox stdio to nil,
+	// stdio-fds entry of the FD manifest. The stdio of the sandbox process
+	// itself must not be connected to the same FDs, otherwise we risk leaking
+	// sandbox errors to the application, so we set the sandbox stdio to nil,
 	// causing them to read/write from the null device.
 	cmd.Stdin = nil
 	cmd.Stdout = nil
@@ -938,7 +1434,7 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 		// added to donations is stdin.
 		//
 		// See https://github.com/golang/go/issues/29458.
-		nextFD = donations.Transfer(cmd, nextFD)
+		nextFD = donations.TransferToManifest(cmd, nextFD)
 		cmd.SysProcAttr.Ctty = nextFD
 
 		// Pass the tty as all stdio fds to sandbox.
@@ -982,6 +1478,9 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 	cmd.Args = append(cmd.Args, "--total-host-memory", strconv.FormatUint(totalSysMem, 10))
 
 	mem := totalSysMem
+	// memLimit is the memory limit of the sandbox's cgroup, or 0 if its memory
+	// isn't limited.
+	var memLimit uint64
 	if s.CgroupJSON.Cgroup != nil {
 		cpuNum, err := s.CgroupJSON.Cgroup.NumCPU()
 		if err != nil {
@@ -1009,15 +1508,20 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 		}
 		cmd.Args = append(cmd.Args, "--cpu-num", strconv.Itoa(cpuNum))
 
-		memLimit, err := s.CgroupJSON.Cgroup.MemoryLimit()
+		cgroupMemLimit, err := s.CgroupJSON.Cgroup.MemoryLimit()
 		if err != nil {
 			return fmt.Errorf("getting memory limit from cgroups: %v", err)
 		}
-		if memLimit < mem {
-			mem = memLimit
+		if cgroupMemLimit < mem {
+			mem = cgroupMemLimit
+			memLimit = cgroupMemLimit
 		}
 	}
 	cmd.Args = append(cmd.Args, "--total-memory", strconv.FormatUint(mem, 10))
+	if limit := conf.SentryGOMEMLIMIT.Limit(memLimit); limit > 0 {
+		log.Infof("Sandbox Go runtime memory limit: %d bytes", limit)
+		cmd.Env = append(cmd.Env, "GOMEMLIMIT="+strconv.FormatUint(limit, 10))
+	}
 
 	if args.Attached {
 		// Kill sandbox if parent process exits in attached mode.
@@ -1030,9 +1534,12 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 		donations.Donate("exec-fd", args.ExecFile)
 	}
 
-	nextFD = donations.Transfer(cmd, nextFD)
+	nextFD, err = donations.TransferManifest(cmd, nextFD, "fd-manifest")
+	if err != nil {
+		return err
+	}
 
-	_ = donation.DonateAndTransferCustomFiles(cmd, nextFD, args.PassFiles)
+	_ = donation.DonateAndTransferCustomFiles(cmd, nextFD, args.PassFiles, args.ListenAddresses)
 
 	// Add container ID as the last argument.
 	cmd.Args = append(cmd.Args, s.ID)
@@ -1073,7 +1580,8 @@ func (s *Sandbox) createSandboxProcess(conf *config.Config, args *Args, startSyn
 }
 
 // Wait waits for the containerized process to exit, and returns its WaitStatus.
-func (s *Sandbox) Wait(cid string) (unix.WaitStatus, error) {
+// It returns ctx.Err() if ctx is done first.
+func (s *Sandbox) Wait(ctx context.Context, cid string) (unix.WaitStatus, error) {
 	log.Debugf("Waiting for container %q in sandbox %q", cid, s.ID)
 
 	if conn, err := s.sandboxConnect(); err != nil {
@@ -1089,8 +1597,13 @@ func (s *Sandbox) Wait(cid string) (unix.WaitStatus, error) {
 
 		// Try the Wait RPC to the sandbox.
 		var ws unix.WaitStatus
+		stop := shutdownAfterDone(ctx, conn)
 		err = conn.Call(boot.ContMgrWait, &cid, &ws)
+		stop()
 		conn.Close()
+		if err := ctx.Err(); err != nil {
+			return unix.WaitStatus(0), err
+		}
 		if err == nil {
 			if s.IsRootContainer(cid) {
 				if err := s.waitForStopped(); err != nil {
@@ -1113,28 +1626,30 @@ func (s *Sandbox) Wait(cid string) (unix.WaitStatus, error) {
 	// The sandbox may have already exited, or exited while handling the Wait RPC.
 	// The best we can do is ask Linux what the sandbox exit status was, since in
 	// most cases that will be the same as the container exit status.
+	pid := s.Pid.load()
 	if err := s.waitForStopped(); err != nil {
 		return unix.WaitStatus(0), err
 	}
-	if !s.child {
-		return unix.WaitStatus(0), fmt.Errorf("sandbox no longer running and its exit status is unavailable")
-	}
 
 	s.statusMu.Lock()
 	defer s.statusMu.Unlock()
+	s.unexpectedExit = s.newExitEvent(pid)
+	if !s.child {
+		return unix.WaitStatus(0), fmt.Errorf("sandbox no longer running and its exit status is unavailable")
+	}
 	return s.status, nil
 }
 
 // WaitPID waits for process 'pid' in the container's sandbox and returns its
-// WaitStatus.
-func (s *Sandbox) WaitPID(cid string, pid int32) (unix.WaitStatus, error) {
+// WaitStatus. It returns ctx.Err() if ctx is done first.
+func (s *Sandbox) WaitPID(ctx context.Context, cid string, pid int32) (unix.WaitStatus, error) {
 	log.Debugf("Waiting for PID %d in sandbox %q", pid, s.ID)
 	var ws unix.WaitStatus
 	args := &boot.WaitPIDArgs{
 		PID: pid,
 		CID: cid,
 	}
-	if err := s.call(boot.ContMgrWaitPID, args, &ws); err != nil {
+	if err := s.callContext(ctx, boot.ContMgrWaitPID, args, &ws); err != nil {
 		return ws, fmt.Errorf("waiting on PID %d in sandbox %q: %w", pid, s.ID, err)
 	}
 	return ws, nil
@@ -1156,6 +1671,12 @@ func (s *Sandbox) destroy() error {
 			log.Warningf("failed to delete control socket file %q: %v", s.ControlAddress, err)
 		}
 	}
+	if s.GRPCControlAddress != "" {
+		if err := os.Remove(s.GRPCControlAddress); err != nil && !os.IsNotExist(err) {
+			log.Warningf("failed to delete gRPC control socket file %q: %v", s.GRPCControlAddress, err)
+		}
+	}
+	s.removeServiceSockets()
 	pid := s.Pid.load()
 	if pid != 0 {
 		log.Debugf("Killing sandbox %q", s.ID)
@@ -1166,6 +1687,7 @@ func (s *Sandbox) destroy() error {
 			return fmt.Errorf("waiting sandbox %q stop: %w", s.ID, err)
 		}
 	}
+	s.releaseVFIODevices()
 
 	return nil
 }
@@ -1217,9 +1739,10 @@ func (s *Sandbox) SignalProcess(cid string, pid int32, sig unix.Signal, fgProces
 
 // Checkpoint sends the checkpoint call for a container in the sandbox.
 // The statefile will be written to f.
-func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
+func (s *Sandbox) Checkpoint(cid string, f *os.File, metadata map[string]string) error {
 	log.Debugf("Checkpoint sandbox %q", s.ID)
 	opt := control.SaveOpts{
+		Metadata: metadata,
 		FilePayload: urpc.FilePayload{
 			Files: []*os.File{f},
 		},
@@ -1231,6 +1754,27 @@ func (s *Sandbox) Checkpoint(cid string, f *os.File) error {
 	return nil
 }
 
+// Migrate sends the migrate call for a container in the sandbox. The state is
+// written to conn, the connection to the target of the migration, after up to
+// precopyRounds rounds of memory pre-copy.
+func (s *Sandbox) Migrate(cid string, conn *os.File, metadata map[string]string, precopyRounds int) error {
+	log.Debugf("Migrate sandbox %q", s.ID)
+	opt := boot.MigrateOpts{
+		SaveOpts: control.SaveOpts{
+			Metadata: metadata,
+			FilePayload: urpc.FilePayload{
+				Files: []*os.File{conn},
+			},
+		},
+		PrecopyRounds: precopyRounds,
+	}
+
+	if err := s.call(boot.ContMgrMigrate, &opt, nil); err != nil {
+		return fmt.Errorf("migrating container %q: %w", cid, err)
+	}
+	return nil
+}
+
 // Pause sends the pause call for a container in the sandbox.
 func (s *Sandbox) Pause(cid string) error {
 	log.Debugf("Pause sandbox %q", s.ID)
@@ -1240,6 +1784,38 @@ func (s *Sandbox) Pause(cid string) error {
 	return nil
 }
 
+// SetCPUs changes the number of CPUs applications in the sandbox run on.
+func (s *Sandbox) SetCPUs(numCPUs int) error {
+	log.Debugf("Set CPUs of sandbox %q to %d", s.ID, numCPUs)
+	args := control.SetCPUsArgs{NumCPUs: numCPUs}
+	if err := s.call(boot.LifecycleSetCPUs, &args, nil); err != nil {
+		return fmt.Errorf("setting CPUs of sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// SetMemory changes the total memory reported to applications in the sandbox
+// to totalMem bytes.
+func (s *Sandbox) SetMemory(totalMem uint64) error {
+	log.Debugf("Set total memory of sandbox %q to %d", s.ID, totalMem)
+	args := control.SetMemoryArgs{TotalMem: totalMem}
+	if err := s.call(boot.LifecycleSetMemory, &args, nil); err != nil {
+		return fmt.Errorf("setting total memory of sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// SetBalloon sets the amount of memory, in bytes, the sandbox should return to
+// the host.
+func (s *Sandbox) SetBalloon(targetBytes uint64) error {
+	log.Debugf("Set balloon target of sandbox %q to %d", s.ID, targetBytes)
+	args := control.SetBalloonArgs{TargetBytes: targetBytes}
+	if err := s.call(boot.LifecycleSetBalloon, &args, nil); err != nil {
+		return fmt.Errorf("setting balloon target of sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
 // Resume sends the resume call for a container in the sandbox.
 func (s *Sandbox) Resume(cid string) error {
 	log.Debugf("Resume sandbox %q", s.ID)
@@ -1260,6 +1836,47 @@ func (s *Sandbox) Usage(Full bool) (control.MemoryUsage, error) {
 	return m, nil
 }
 
+// SentryUsage sends the collect sentry usage control message to the sandbox,
+// returning the memory used by the sentry itself.
+func (s *Sandbox) SentryUsage() (control.SentryMemoryUsage, error) {
+	log.Debugf("Sentry usage sandbox %q", s.ID)
+	var m control.SentryMemoryUsage
+	if err := s.call(boot.UsageCollectSentry, nil, &m); err != nil {
+		return control.SentryMemoryUsage{}, fmt.Errorf("collecting sentry usage: %w", err)
+	}
+	return m, nil
+}
+
+// StartUsageSampling starts recording the usage of the sandbox every interval,
+// keeping the last capacity samples.
+func (s *Sandbox) StartUsageSampling(interval time.Duration, capacity int) error {
+	log.Debugf("Start usage sampling of sandbox %q", s.ID)
+	opts := control.UsageSamplingOpts{Interval: interval, Capacity: capacity}
+	if err := s.call(boot.UsageStartSampling, &opts, nil); err != nil {
+		return fmt.Errorf("starting usage sampling: %w", err)
+	}
+	return nil
+}
+
+// StopUsageSampling stops recording the usage of the sandbox.
+func (s *Sandbox) StopUsageSampling() error {
+	log.Debugf("Stop usage sampling of sandbox %q", s.ID)
+	if err := s.call(boot.UsageStopSampling, nil, nil); err != nil {
+		return fmt.Errorf("stopping usage sampling: %w", err)
+	}
+	return nil
+}
+
+// UsageSamples returns the usage samples recorded in the sandbox.
+func (s *Sandbox) UsageSamples() (*control.UsageSamples, error) {
+	log.Debugf("Usage samples of sandbox %q", s.ID)
+	var samples control.UsageSamples
+	if err := s.call(boot.UsageSamples, nil, &samples); err != nil {
+		return nil, fmt.Errorf("getting usage samples: %w", err)
+	}
+	return &samples, nil
+}
+
 // UsageFD sends the usagefd call for a container in the sandbox.
 func (s *Sandbox) UsageFD() (*control.MemoryUsageRecord, error) {
 	log.Debugf("Usage sandbox %q", s.ID)
@@ -1325,6 +1942,91 @@ func (s *Sandbox) Stacks() (string, error) {
 	return stacks, nil
 }
 
+// HostFDs returns the host FD table of the sandbox process.
+func (s *Sandbox) HostFDs() ([]fdaudit.Entry, error) {
+	log.Debugf("Host FDs sandbox %q", s.ID)
+	var entries []fdaudit.Entry
+	if err := s.call(boot.DebugHostFDs, nil, &entries); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q host FDs: %w", s.ID, err)
+	}
+	return entries, nil
+}
+
+// Tunables returns the values of the sentry tunables of the sandbox, by
+// name.
+func (s *Sandbox) Tunables() (map[string]string, error) {
+	log.Debugf("Tunables sandbox %q", s.ID)
+	var vals map[string]string
+	if err := s.call(boot.DebugTunables, nil, &vals); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q tunables: %w", s.ID, err)
+	}
+	return vals, nil
+}
+
+// Ping checks that the control server of the sandbox responds within
+// timeout, and returns the version and features of the sandbox.
+func (s *Sandbox) Ping(timeout time.Duration) (*boot.PingResponse, error) {
+	log.Debugf("Ping sandbox %q", s.ID)
+	type result struct {
+		resp boot.PingResponse
+		err  error
+	}
+	// Buffered, so that a response arriving after the timeout doesn't block
+	// the goroutine forever.
+	ch := make(chan result, 1)
+	go func() {
+		var r result
+		r.err = s.call(boot.HealthPing, nil, &r.resp)
+		ch <- r
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return nil, fmt.Errorf("pinging sandbox %q: %w", s.ID, r.err)
+		}
+		return &r.resp, nil
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("pinging sandbox %q: no response after %v", s.ID, timeout)
+	}
+}
+
+// NetworkDump returns the routes, neighbors and endpoints of the sandbox
+// network stack.
+func (s *Sandbox) NetworkDump() (*boot.NetworkState, error) {
+	log.Debugf("Network dump sandbox %q", s.ID)
+	var dump boot.NetworkState
+	if err := s.call(boot.NetworkDump, nil, &dump); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q network state: %w", s.ID, err)
+	}
+	return &dump, nil
+}
+
+// Threads returns the state of all guest threads in the sandbox. If stacks is
+// true, the sentry stack of each thread is included.
+func (s *Sandbox) Threads(stacks bool) ([]*control.ThreadState, error) {
+	log.Debugf("Threads sandbox %q", s.ID)
+	var threads []*control.ThreadState
+	if err := s.call(boot.DebugThreads, &control.ThreadsArgs{Stacks: stacks}, &threads); err != nil {
+		return nil, fmt.Errorf("getting sandbox %q threads: %w", s.ID, err)
+	}
+	return threads, nil
+}
+
+// AttachGDB attaches a gdb remote stub serving conn to the process with the
+// given PID in the root PID namespace.
+func (s *Sandbox) AttachGDB(cid string, pid int32, conn *os.File) error {
+	log.Debugf("Attach gdb to PID %d in container %q in sandbox %q", pid, cid, s.ID)
+	args := control.AttachGDBArgs{
+		ContainerID: cid,
+		PID:         kernel.ThreadID(pid),
+		FilePayload: urpc.FilePayload{Files: []*os.File{conn}},
+	}
+	if err := s.call(boot.DebugAttachGDB, &args, nil); err != nil {
+		return fmt.Errorf("attaching gdb to PID %d in sandbox %q: %w", pid, s.ID, err)
+	}
+	return nil
+}
+
 // HeapProfile writes a heap profile to the given file.
 func (s *Sandbox) HeapProfile(f *os.File, delay time.Duration) error {
 	log.Debugf("Heap profile %q", s.ID)
@@ -1384,6 +2086,86 @@ func (s *Sandbox) ChangeLogging(args control.LoggingArgs) error {
 	return nil
 }
 
+// AddFaultRule installs a fault injection rule in the sandbox.
+func (s *Sandbox) AddFaultRule(rule faultinject.Rule) error {
+	log.Debugf("Add fault injection rule %q to sandbox %q", rule.Name, s.ID)
+	if err := s.call(boot.FaultInjectAdd, &rule, nil); err != nil {
+		return fmt.Errorf("adding fault injection rule to sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// RemoveFaultRule uninstalls a fault injection rule from the sandbox.
+func (s *Sandbox) RemoveFaultRule(name string) error {
+	log.Debugf("Remove fault injection rule %q from sandbox %q", name, s.ID)
+	if err := s.call(boot.FaultInjectRemove, &name, nil); err != nil {
+		return fmt.Errorf("removing fault injection rule from sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// ClearFaultRules uninstalls all fault injection rules from the sandbox.
+func (s *Sandbox) ClearFaultRules() error {
+	log.Debugf("Clear fault injection rules from sandbox %q", s.ID)
+	if err := s.call(boot.FaultInjectClear, nil, nil); err != nil {
+		return fmt.Errorf("clearing fault injection rules from sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// ListFaultRules lists fault injection rules installed in the sandbox.
+func (s *Sandbox) ListFaultRules() ([]faultinject.Rule, error) {
+	log.Debugf("List fault injection rules in sandbox %q", s.ID)
+	var rules []faultinject.Rule
+	if err := s.call(boot.FaultInjectList, nil, &rules); err != nil {
+		return nil, fmt.Errorf("listing fault injection rules in sandbox %q: %w", s.ID, err)
+	}
+	return rules, nil
+}
+
+// FreezeFilesystems quiesces writes to the filesystems of the given mounts of
+// container cid, so that their backing storage can be snapshotted. If timeout
+// is non-zero, the filesystems are thawed automatically after it.
+func (s *Sandbox) FreezeFilesystems(cid string, mounts []string, timeout time.Duration) error {
+	log.Debugf("Freeze filesystems %v of container %q in sandbox %q", mounts, cid, s.ID)
+	opts := control.FreezeOpts{
+		ContainerID: cid,
+		Mounts:      mounts,
+		Timeout:     timeout,
+	}
+	if err := s.call(boot.FsFreeze, &opts, nil); err != nil {
+		return fmt.Errorf("freezing filesystems in sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// ThawFilesystems undoes FreezeFilesystems.
+func (s *Sandbox) ThawFilesystems(cid string, mounts []string) error {
+	log.Debugf("Thaw filesystems %v of container %q in sandbox %q", mounts, cid, s.ID)
+	opts := control.FreezeOpts{
+		ContainerID: cid,
+		Mounts:      mounts,
+	}
+	if err := s.call(boot.FsThaw, &opts, nil); err != nil {
+		return fmt.Errorf("thawing filesystems in sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
+// ExportRootfs writes the changes made to the root filesystem of container
+// cid to out, as an OCI image layer tar archive.
+func (s *Sandbox) ExportRootfs(cid string, out *os.File) error {
+	log.Debugf("Export root filesystem of container %q in sandbox %q", cid, s.ID)
+	opts := boot.ExportRootfsOpts{
+		FilePayload: urpc.FilePayload{Files: []*os.File{out}},
+		ContainerID: cid,
+	}
+	if err := s.call(boot.ContMgrExportRootfs, &opts, nil); err != nil {
+		return fmt.Errorf("exporting root filesystem in sandbox %q: %w", s.ID, err)
+	}
+	return nil
+}
+
 // DestroyContainer destroys the given container. If it is the root container,
 // then the entire sandbox is destroyed.
 func (s *Sandbox) DestroyContainer(cid string) error {
@@ -1548,25 +2330,33 @@ func (s *Sandbox) CgroupsWriteControlFile(file control.CgroupControlFile, value
 	return out.Results[0].AsError()
 }
 
-// fixPidns looks at the PID namespace path. If that path corresponds to the
-// sandbox process PID namespace, then change the spec so that the container
-// joins the sandbox root namespace.
-func (s *Sandbox) fixPidns(spec *specs.Spec) {
-	pidns, ok := specutils.GetNS(specs.PIDNamespace, spec)
+// fixNamespaces looks at the PID, network, IPC and UTS namespace paths. If a
+// path corresponds to the sandbox process namespace, then change the spec so
+// that the container joins the sandbox root namespace.
+func (s *Sandbox) fixNamespaces(spec *specs.Spec) {
+	for _, typ := range []specs.LinuxNamespaceType{specs.PIDNamespace, specs.NetworkNamespace, specs.IPCNamespace, specs.UTSNamespace} {
+		s.fixNamespace(spec, typ)
+	}
+}
+
+// fixNamespace fixes the path of the namespace of the given type, see
+// fixNamespaces.
+func (s *Sandbox) fixNamespace(spec *specs.Spec, typ specs.LinuxNamespaceType) {
+	ns, ok := specutils.GetNS(typ, spec)
 	if !ok {
-		// pidns was not set, nothing to fix.
+		// Namespace was not set, nothing to fix.
 		return
 	}
-	if pidns.Path != fmt.Sprintf("/proc/%d/ns/pid", s.Pid.load()) {
-		// Fix only if the PID namespace corresponds to the sandbox's.
+	if ns.Path != specutils.ProcessNSPath(s.Pid.load(), typ) {
+		// Fix only if the namespace corresponds to the sandbox's.
 		return
 	}
 
 	for i := range spec.Linux.Namespaces {
-		if spec.Linux.Namespaces[i].Type == specs.PIDNamespace {
+		if spec.Linux.Namespaces[i].Type == typ {
 			// Removing the namespace makes the container join the sandbox root
 			// namespace.
-			log.Infof("Fixing PID namespace in spec from %q to make the container join the sandbox root namespace", pidns.Path)
+			log.Infof("Fixing %s namespace in spec from %q to make the container join the sandbox root namespace", typ, ns.Path)
 			spec.Linux.Namespaces = append(spec.Linux.Namespaces[:i], spec.Linux.Namespaces[i+1:]...)
 			return
 		}
@@ -1643,3 +2433,33 @@ func SetUserMappings(spec *specs.Spec, pid int) error {
 	}
 	return nil
 }
+
+const (
+	// memoryPressureStall and memoryPressureWindow define the PSI trigger
+	// used for host memory pressure notifications: they fire when sandbox
+	// tasks are stalled on memory for memoryPressureStall within any
+	// memoryPressureWindow.
+	memoryPressureStall  = 100 * time.Millisecond
+	memoryPressureWindow = time.Second
+)
+
+// openMemoryPressure opens the memory.pressure file of cgroup cg and sets up
+// a PSI trigger on it.
+func openMemoryPressure(cg cgroup.Cgroup) (*os.File, error) {
+	if cg == nil {
+		return nil, fmt.Errorf("sandbox has no cgroup")
+	}
+	if !cgroup.IsOnlyV2() {
+		return nil, fmt.Errorf("PSI requires cgroup v2")
+	}
+	path := filepath.Join(cg.MakePath(""), "memory.pressure")
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := hostmm.SetPSITrigger(file, false /* full */, memoryPressureStall, memoryPressureWindow); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"os"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/runsc/boot"
+)
+
+// createServiceSockets creates the host sockets of services, in args in the
+// same order.
+func (s *Sandbox) createServiceSockets(services []boot.ServiceConfig, args *Args) error {
+	for i := range services {
+		f, err := boot.CreateServiceSocket(&services[i])
+		if err != nil {
+			return err
+		}
+		args.ServiceFiles = append(args.ServiceFiles, f)
+		s.ServiceSockets = append(s.ServiceSockets, services[i].Path)
+	}
+	return nil
+}
+
+// removeServiceSockets removes the host sockets of services.
+func (s *Sandbox) removeServiceSockets() {
+	for _, path := range s.ServiceSockets {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Warningf("Failed to delete service socket %q: %v", path, err)
+		}
+	}
+	s.ServiceSockets = nil
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/sharedmem"
+	"github.com/talismancer/gvisor-ligolo/runsc/boot"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+)
+
+// defaultSharedMemLinkName is the name of the shared memory interface if the
+// host agent doesn't name it.
+const defaultSharedMemLinkName = "shm0"
+
+// addSharedMemLink receives the shared memory channel offered on
+// conf.SharedMemNet, if any, and adds it to args. Its files must come after
+// the files of fd-based and XDP links and the PCAP log. The files added to
+// args are returned, so that they can be closed once sent: the agent detects
+// that the sandbox went away when all copies of the connection are closed.
+func addSharedMemLink(conf *config.Config, args *boot.CreateLinksAndRoutesArgs) ([]*os.File, error) {
+	if conf.SharedMemNet == "" {
+		return nil, nil
+	}
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: conf.SharedMemNet, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to shared memory network agent: %w", err)
+	}
+	defer conn.Close()
+	info, files, err := sharedmem.ReceiveChannel(conn)
+	if err != nil {
+		return nil, err
+	}
+	success := false
+	defer func() {
+		if !success {
+			for _, f := range files {
+				f.Close()
+			}
+		}
+	}()
+
+	link, err := sharedMemLinkFromInfo(info)
+	if err != nil {
+		return nil, err
+	}
+	link.QDisc = conf.QDisc
+	link.GvisorGROTimeout = conf.GvisorGROTimeout
+
+	// The connection tells the sandbox when the agent goes away.
+	peer, err := conn.File()
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, peer)
+	log.Infof("Adding shared memory interface %q from %s: %+v", link.Name, conf.SharedMemNet, info)
+	args.SharedMemLinks = append(args.SharedMemLinks, *link)
+	args.FilePayload.Files = append(args.FilePayload.Files, files...)
+	success = true
+	return files, nil
+}
+
+// sharedMemLinkFromInfo converts the description of a channel sent by the
+// agent to a link configuration.
+func sharedMemLinkFromInfo(info *sharedmem.ChannelInfo) (*boot.SharedMemLink, error) {
+	link := &boot.SharedMemLink{
+		Name:       info.Name,
+		MTU:        int(info.MTU),
+		BufferSize: info.BufferSize,
+	}
+	if link.Name == "" {
+		link.Name = defaultSharedMemLinkName
+	}
+	if link.MTU == 0 {
+		return nil, fmt.Errorf("shared memory channel has no MTU")
+	}
+	if link.BufferSize == 0 {
+		link.BufferSize = sharedmem.DefaultBufferSize
+	}
+	if info.LinkAddress != "" {
+		mac, err := net.ParseMAC(info.LinkAddress)
+		if err != nil {
+			return nil, fmt.Errorf("invalid link address %q: %w", info.LinkAddress, err)
+		}
+		link.LinkAddress = mac
+	}
+	for _, a := range info.Addresses {
+		ip, ipNet, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", a, err)
+		}
+		prefix, _ := ipNet.Mask.Size()
+		link.Addresses = append(link.Addresses, boot.IPWithPrefix{Address: ip, PrefixLen: prefix})
+		// Make the subnet reachable through the interface.
+		link.Routes = append(link.Routes, boot.Route{Destination: *ipNet})
+	}
+	for _, g := range info.Gateways {
+		gw := net.ParseIP(g)
+		if gw == nil {
+			return nil, fmt.Errorf("invalid gateway %q", g)
+		}
+		dst := net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 8*net.IPv6len)}
+		if gw.To4() != nil {
+			gw = gw.To4()
+			dst = net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 8*net.IPv4len)}
+		}
+		link.Routes = append(link.Routes, boot.Route{Destination: dst, Gateway: gw})
+	}
+	return link, nil
+}
@@ -0,0 +1,207 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/talismancer/gvisor-ligolo/pkg/log"
+	"github.com/talismancer/gvisor-ligolo/pkg/tcpip/link/vfio"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sysfsPCIDevices = "/sys/bus/pci/devices"
+	sysfsPCIProbe   = "/sys/bus/pci/drivers_probe"
+	vfioPCIDriver   = "vfio-pci"
+
+	// virtioNetVendor and virtioNetDevice are the PCI IDs of virtio 1.x
+	// network devices, the only devices supported by VFIO links.
+	virtioNetVendor = "0x1af4"
+	virtioNetDevice = "0x1041"
+)
+
+// VFIODevice is a PCI device claimed for the sandbox and bound to vfio-pci.
+type VFIODevice struct {
+	// Address is the PCI address of the device.
+	Address string `json:"address"`
+
+	// Driver is the driver the device was bound to before it was claimed,
+	// if any.
+	Driver string `json:"driver"`
+}
+
+// pciAddressOfInterface returns the PCI address of the device backing the
+// network interface name in the current network namespace, or an empty string
+// if it isn't backed by a PCI device.
+func pciAddressOfInterface(name string) (string, error) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(fd)
+	info, err := unix.IoctlGetEthtoolDrvinfo(fd, name)
+	if err != nil {
+		if err == unix.EOPNOTSUPP {
+			return "", nil
+		}
+		return "", fmt.Errorf("getting driver info of %q: %w", name, err)
+	}
+	addr := unix.ByteSliceToString(info.Bus_info[:])
+	if _, err := os.Stat(filepath.Join(sysfsPCIDevices, addr)); err != nil {
+		// Not a PCI device, e.g. a veth.
+		return "", nil
+	}
+	return addr, nil
+}
+
+// pciDriver returns the driver the PCI device at path dev is bound to, if any.
+func pciDriver(dev string) (string, error) {
+	driver, err := os.Readlink(filepath.Join(dev, "driver"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(driver), nil
+}
+
+// checkVFIODevice checks that the PCI device at address addr may be passed
+// through to a sandbox, and returns its IOMMU group. The device must be a
+// virtio network SR-IOV virtual function, and the only device in its IOMMU
+// group, so that claiming it doesn't affect other devices.
+func checkVFIODevice(addr string) (int, error) {
+	dev := filepath.Join(sysfsPCIDevices, addr)
+	if _, err := os.Stat(filepath.Join(dev, "physfn")); err != nil {
+		return 0, fmt.Errorf("PCI device %s is not an SR-IOV virtual function", addr)
+	}
+	for _, id := range []struct {
+		file string
+		want string
+	}{
+		{"vendor", virtioNetVendor},
+		{"device", virtioNetDevice},
+	} {
+		got, err := os.ReadFile(filepath.Join(dev, id.file))
+		if err != nil {
+			return 0, err
+		}
+		if strings.TrimSpace(string(got)) != id.want {
+			return 0, fmt.Errorf("PCI device %s is not a virtio network device, only those are supported", addr)
+		}
+	}
+
+	groupPath, err := os.Readlink(filepath.Join(dev, "iommu_group"))
+	if err != nil {
+		return 0, fmt.Errorf("PCI device %s has no IOMMU group, is the IOMMU enabled? %w", addr, err)
+	}
+	group, err := strconv.Atoi(filepath.Base(groupPath))
+	if err != nil {
+		return 0, fmt.Errorf("invalid IOMMU group %q: %w", groupPath, err)
+	}
+	members, err := os.ReadDir(filepath.Join(dev, "iommu_group", "devices"))
+	if err != nil {
+		return 0, err
+	}
+	if len(members) != 1 {
+		return 0, fmt.Errorf("PCI device %s shares IOMMU group %d with %d other devices", addr, group, len(members)-1)
+	}
+	return group, nil
+}
+
+// claimVFIODevice binds the PCI device at address addr to vfio-pci and opens
+// it.
+func claimVFIODevice(addr string) (*VFIODevice, *vfio.Files, error) {
+	group, err := checkVFIODevice(addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	dev := filepath.Join(sysfsPCIDevices, addr)
+	driver, err := pciDriver(dev)
+	if err != nil {
+		return nil, nil, err
+	}
+	claimed := &VFIODevice{Address: addr, Driver: driver}
+	if driver != vfioPCIDriver {
+		log.Infof("Rebinding PCI device %s from driver %q to %s", addr, driver, vfioPCIDriver)
+		if err := os.WriteFile(filepath.Join(dev, "driver_override"), []byte(vfioPCIDriver), 0); err != nil {
+			return nil, nil, fmt.Errorf("setting driver override of %s: %w", addr, err)
+		}
+		if driver != "" {
+			if err := os.WriteFile(filepath.Join(dev, "driver", "unbind"), []byte(addr), 0); err != nil {
+				releaseVFIODevice(claimed)
+				return nil, nil, fmt.Errorf("unbinding %s from %s: %w", addr, driver, err)
+			}
+		}
+		if err := os.WriteFile(sysfsPCIProbe, []byte(addr), 0); err != nil {
+			releaseVFIODevice(claimed)
+			return nil, nil, fmt.Errorf("binding %s to %s, is the vfio-pci module loaded? %w", addr, vfioPCIDriver, err)
+		}
+	}
+	files, err := vfio.Open(addr, group)
+	if err != nil {
+		releaseVFIODevice(claimed)
+		return nil, nil, fmt.Errorf("opening VFIO device %s: %w", addr, err)
+	}
+	return claimed, files, nil
+}
+
+// releaseVFIODevice returns d to the driver it was bound to before it was
+// claimed. It must only be called once the sandbox has exited, since vfio-pci
+// waits for the device to be closed before unbinding from it.
+func releaseVFIODevice(d *VFIODevice) error {
+	if d.Driver == vfioPCIDriver {
+		// It was bound to vfio-pci already.
+		return nil
+	}
+	dev := filepath.Join(sysfsPCIDevices, d.Address)
+	driver, err := pciDriver(dev)
+	if err != nil {
+		return err
+	}
+	if driver == vfioPCIDriver {
+		if err := os.WriteFile(filepath.Join(dev, "driver", "unbind"), []byte(d.Address), 0); err != nil {
+			return fmt.Errorf("unbinding %s from %s: %w", d.Address, vfioPCIDriver, err)
+		}
+	}
+	// An empty override restores driver matching by device ID.
+	if err := os.WriteFile(filepath.Join(dev, "driver_override"), []byte("\n"), 0); err != nil {
+		return fmt.Errorf("clearing driver override of %s: %w", d.Address, err)
+	}
+	if d.Driver != "" {
+		if err := os.WriteFile(sysfsPCIProbe, []byte(d.Address), 0); err != nil {
+			return fmt.Errorf("binding %s to %s: %w", d.Address, d.Driver, err)
+		}
+	}
+	return nil
+}
+
+// releaseVFIODevices releases all devices claimed for the sandbox.
+func (s *Sandbox) releaseVFIODevices() {
+	for i := range s.VFIODevices {
+		d := &s.VFIODevices[i]
+		if err := releaseVFIODevice(d); err != nil {
+			log.Warningf("Failed to release PCI device %s: %v", d.Address, err)
+			continue
+		}
+		log.Infof("Released PCI device %s", d.Address)
+	}
+	s.VFIODevices = nil
+}
@@ -68,19 +68,40 @@ var optionsMap = map[string]mapping{
 
 // propOptionsMap is similar to optionsMap, but it lists propagation options
 // that cannot be used together with other flags.
+//
+// Shared mounts are only shared inside the sandbox, see
+// SentryPropOptionsToFlag. On the host they are slaves: the sandbox must be
+// isolated from the host, and propagating mount changes from the sandbox to the
+// host breaks the isolation.
 var propOptionsMap = map[string]mapping{
 	"private":     {set: true, val: unix.MS_PRIVATE},
 	"rprivate":    {set: true, val: unix.MS_PRIVATE | unix.MS_REC},
+	"shared":      {set: true, val: unix.MS_SLAVE},
+	"rshared":     {set: true, val: unix.MS_SLAVE | unix.MS_REC},
 	"slave":       {set: true, val: unix.MS_SLAVE},
 	"rslave":      {set: true, val: unix.MS_SLAVE | unix.MS_REC},
 	"unbindable":  {set: true, val: unix.MS_UNBINDABLE},
 	"runbindable": {set: true, val: unix.MS_UNBINDABLE | unix.MS_REC},
 }
 
-// invalidOptions list options not allowed.
-//   - shared: sandbox must be isolated from the host. Propagating mount changes
-//     from the sandbox to the host breaks the isolation.
-var invalidOptions = []string{"shared", "rshared"}
+// SentryPropOptionsToFlag returns the propagation flag of a mount inside the
+// sandbox: MS_SHARED, MS_SLAVE, MS_PRIVATE or 0 if opts don't have propagation
+// options. The last option wins, and recursive options are treated like their
+// non-recursive counterpart.
+func SentryPropOptionsToFlag(opts []string) uint32 {
+	var flag uint32
+	for _, opt := range opts {
+		switch opt {
+		case "shared", "rshared":
+			flag = unix.MS_SHARED
+		case "slave", "rslave":
+			flag = unix.MS_SLAVE
+		case "private", "rprivate":
+			flag = unix.MS_PRIVATE
+		}
+	}
+	return flag
+}
 
 // OptionsToFlags converts mount options to syscall flags.
 func OptionsToFlags(opts []string) uint32 {
@@ -108,6 +129,22 @@ func optionsToFlags(opts []string, source map[string]mapping) uint32 {
 	return rv
 }
 
+// HostUDSAllowOption is a mount option, only interpreted by runsc, that allows
+// the host Unix domain sockets under a bind mount to be connected to or bound,
+// as permitted by --host-uds. Once a mount has it, sockets outside of such
+// mounts are only allowed if --host-uds-allow lists them.
+const HostUDSAllowOption = "host-uds-allow"
+
+// HasMountOption returns true if opts contains opt.
+func HasMountOption(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
 // IsReadonlyMount returns true if the mount options has read only option.
 func IsReadonlyMount(opts []string) bool {
 	for _, o := range opts {
@@ -161,9 +198,6 @@ func ValidateMountOptions(opts []string) error {
 }
 
 func validateMountOption(o string) error {
-	if ContainsStr(invalidOptions, o) {
-		return fmt.Errorf("mount option %q is not supported", o)
-	}
 	_, ok1 := optionsMap[o]
 	_, ok2 := propOptionsMap[o]
 	if !ok1 && !ok2 {
@@ -177,7 +211,7 @@ func validateMountOption(o string) error {
 func validateRootfsPropagation(opt string) error {
 	flags := PropOptionsToFlags([]string{opt})
 	if flags&(unix.MS_SLAVE|unix.MS_PRIVATE) == 0 {
-		return fmt.Errorf("root mount propagation option must specify private or slave: %q", opt)
+		return fmt.Errorf("root mount propagation option must specify private, slave or shared: %q", opt)
 	}
 	return validatePropagation(opt)
 }
@@ -0,0 +1,157 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"fmt"
+	"sort"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/talismancer/gvisor-ligolo/runsc/config"
+	"golang.org/x/sys/unix"
+)
+
+// Severities of the findings of LintSpec.
+const (
+	// LintUnsupported is for features that make runsc reject the spec.
+	LintUnsupported = "unsupported"
+
+	// LintIgnored is for features that runsc silently ignores.
+	LintIgnored = "ignored"
+
+	// LintEmulated is for features that runsc honors, but that behave
+	// differently than with a native runtime.
+	LintEmulated = "emulated"
+)
+
+// LintFinding is a difference between the behavior requested by a spec and
+// what runsc does with it.
+type LintFinding struct {
+	// Severity is one of the Lint* constants.
+	Severity string `json:"severity"`
+
+	// Field is the path of the spec field, e.g. "linux.sysctl".
+	Field string `json:"field"`
+
+	// Message describes how runsc handles the field.
+	Message string `json:"message"`
+}
+
+// LintSpec reports the features requested by spec that runsc doesn't support,
+// ignores, or emulates differently than a native runtime, under conf. spec
+// must have been read with ReadSpec, so that flag annotations are applied to
+// conf; in particular, it's already known to pass ValidateSpec.
+func LintSpec(spec *specs.Spec, conf *config.Config) []LintFinding {
+	var findings []LintFinding
+	add := func(severity, field, format string, args ...any) {
+		findings = append(findings, LintFinding{
+			Severity: severity,
+			Field:    field,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if spec.Process != nil {
+		if spec.Process.ApparmorProfile != "" {
+			add(LintIgnored, "process.apparmorProfile", "AppArmor profile %q isn't applied, the sandbox kernel doesn't implement AppArmor", spec.Process.ApparmorProfile)
+		}
+		if !spec.Process.NoNewPrivileges {
+			add(LintIgnored, "process.noNewPrivileges", "PR_SET_NO_NEW_PRIVS is always set in the sandbox")
+		}
+	}
+	if spec.Linux == nil {
+		return findings
+	}
+
+	lintSeccomp(spec.Linux.Seccomp, conf, add)
+
+	if p := spec.Linux.RootfsPropagation; p != "" {
+		if PropOptionsToFlags([]string{p})&(unix.MS_SHARED|unix.MS_SLAVE) != 0 {
+			add(LintEmulated, "linux.rootfsPropagation", "%q only applies to mounts inside the sandbox, mount events aren't propagated to or from the host", p)
+		}
+	}
+	for i, m := range spec.Mounts {
+		if PropOptionsToFlags(m.Options)&(unix.MS_SHARED|unix.MS_SLAVE) != 0 {
+			add(LintEmulated, fmt.Sprintf("mounts[%d].options", i), "propagation of %q only applies to mounts inside the sandbox, mount events aren't propagated to or from the host", m.Destination)
+		}
+	}
+
+	if spec.Linux.Resources != nil && len(spec.Linux.Resources.Devices) > 0 {
+		add(LintIgnored, "linux.resources.devices", "device cgroup rules aren't enforced, the sandbox only exposes the devices it implements and those in linux.devices")
+	}
+
+	names := make([]string, 0, len(spec.Linux.Sysctl))
+	for name := range spec.Linux.Sysctl {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		action := "logged"
+		if conf.SysctlPolicy == config.SysctlPolicyStrict {
+			action = "fail the container start"
+		}
+		add(LintEmulated, "linux.sysctl."+name, "set in the sandbox kernel, not the host; if the sandbox doesn't implement it, it's %s", action)
+	}
+
+	if spec.Linux.IntelRdt != nil {
+		add(LintIgnored, "linux.intelRdt", "Intel RDT isn't supported")
+	}
+	if spec.Linux.Personality != nil {
+		add(LintIgnored, "linux.personality", "execution domains aren't supported")
+	}
+	return findings
+}
+
+func lintSeccomp(s *specs.LinuxSeccomp, conf *config.Config, add func(severity, field, format string, args ...any)) {
+	if s == nil {
+		return
+	}
+	if !conf.OCISeccomp {
+		add(LintIgnored, "linux.seccomp", "seccomp profile is ignored unless --oci-seccomp is set; the sandbox is confined by its own seccomp filters instead")
+		return
+	}
+	if len(s.Flags) > 0 {
+		add(LintIgnored, "linux.seccomp.flags", "seccomp flags %v are ignored", s.Flags)
+	}
+	if s.ListenerPath != "" {
+		add(LintIgnored, "linux.seccomp.listenerPath", "seccomp user notifications aren't supported")
+	}
+	if len(s.Architectures) > 0 {
+		add(LintIgnored, "linux.seccomp.architectures", "only the native architecture is filtered")
+	}
+	if s.DefaultErrnoRet != nil {
+		add(LintEmulated, "linux.seccomp.defaultErrnoRet", "SCMP_ACT_ERRNO always returns EPERM")
+	}
+	lintSeccompAction(s.DefaultAction, "linux.seccomp.defaultAction", add)
+	for i, sc := range s.Syscalls {
+		field := fmt.Sprintf("linux.seccomp.syscalls[%d]", i)
+		lintSeccompAction(sc.Action, field+".action", add)
+		if sc.ErrnoRet != nil {
+			add(LintEmulated, field+".errnoRet", "SCMP_ACT_ERRNO always returns EPERM")
+		}
+	}
+}
+
+func lintSeccompAction(act specs.LinuxSeccompAction, field string, add func(severity, field, format string, args ...any)) {
+	switch act {
+	case specs.ActAllow, specs.ActErrno, specs.ActTrap:
+	case specs.ActKill:
+		add(LintEmulated, field, "%s kills the thread, not the process", act)
+	case specs.ActTrace:
+		add(LintEmulated, field, "%s returns EPERM, tracers aren't notified", act)
+	default:
+		add(LintUnsupported, field, "seccomp action %s isn't supported, the container will fail to start", act)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"syscall"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -52,30 +53,39 @@ func nsCloneFlag(nst specs.LinuxNamespaceType) uintptr {
 	}
 }
 
-// nsPath returns the path of the namespace for the current process and the
-// given namespace.
-func nsPath(nst specs.LinuxNamespaceType) string {
-	base := "/proc/self/ns"
+// nsName returns the name of the given namespace in /proc/[pid]/ns.
+func nsName(nst specs.LinuxNamespaceType) string {
 	switch nst {
 	case specs.CgroupNamespace:
-		return filepath.Join(base, "cgroup")
+		return "cgroup"
 	case specs.IPCNamespace:
-		return filepath.Join(base, "ipc")
+		return "ipc"
 	case specs.MountNamespace:
-		return filepath.Join(base, "mnt")
+		return "mnt"
 	case specs.NetworkNamespace:
-		return filepath.Join(base, "net")
+		return "net"
 	case specs.PIDNamespace:
-		return filepath.Join(base, "pid")
+		return "pid"
 	case specs.UserNamespace:
-		return filepath.Join(base, "user")
+		return "user"
 	case specs.UTSNamespace:
-		return filepath.Join(base, "uts")
+		return "uts"
 	default:
 		panic(fmt.Sprintf("unknown namespace %v", nst))
 	}
 }
 
+// nsPath returns the path of the namespace for the current process and the
+// given namespace.
+func nsPath(nst specs.LinuxNamespaceType) string {
+	return filepath.Join("/proc/self/ns", nsName(nst))
+}
+
+// ProcessNSPath returns the path of the given namespace of process pid.
+func ProcessNSPath(pid int, nst specs.LinuxNamespaceType) string {
+	return filepath.Join("/proc", strconv.Itoa(pid), "ns", nsName(nst))
+}
+
 // GetNS returns true and the namespace with the given type from the slice of
 // namespaces in the spec.  It returns false if the slice does not contain a
 // namespace with the type.
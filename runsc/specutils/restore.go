@@ -0,0 +1,122 @@
+// Copyright 2023 The gVisor Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package specutils
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/mohae/deepcopy"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// ValidateRestoreSpec checks that a checkpoint image taken with spec old can
+// be restored with spec new. Only the following changes are allowed:
+//   - Mount sources, as long as destination, type and options are unchanged.
+//   - The path of the network namespace.
+//   - Process environment variables. They are not visible to the restored
+//     processes, see RestoreEnvDiff.
+//   - Hostname, annotations, hooks, resources and cgroup path.
+func ValidateRestoreSpec(old, new *specs.Spec) error {
+	if old.Root != nil && new.Root != nil && old.Root.Readonly != new.Root.Readonly {
+		return fmt.Errorf("root readonly changed from %t to %t", old.Root.Readonly, new.Root.Readonly)
+	}
+
+	if len(old.Mounts) != len(new.Mounts) {
+		return fmt.Errorf("number of mounts changed from %d to %d", len(old.Mounts), len(new.Mounts))
+	}
+	for i := range old.Mounts {
+		o, n := &old.Mounts[i], &new.Mounts[i]
+		if o.Destination != n.Destination {
+			return fmt.Errorf("mount %d destination changed from %q to %q", i, o.Destination, n.Destination)
+		}
+		if o.Type != n.Type {
+			return fmt.Errorf("mount %q type changed from %q to %q", o.Destination, o.Type, n.Type)
+		}
+		if !reflect.DeepEqual(o.Options, n.Options) {
+			return fmt.Errorf("mount %q options changed from %v to %v", o.Destination, o.Options, n.Options)
+		}
+	}
+
+	if (old.Process == nil) != (new.Process == nil) {
+		return fmt.Errorf("process presence changed")
+	}
+	if old.Process != nil {
+		op := deepcopy.Copy(old.Process).(*specs.Process)
+		np := deepcopy.Copy(new.Process).(*specs.Process)
+		op.Env, np.Env = nil, nil
+		// The console size is only meaningful at creation time.
+		op.ConsoleSize, np.ConsoleSize = nil, nil
+		if !reflect.DeepEqual(op, np) {
+			return fmt.Errorf("process changed, only environment variables can be changed on restore")
+		}
+	}
+
+	if (old.Linux == nil) != (new.Linux == nil) {
+		return fmt.Errorf("linux section presence changed")
+	}
+	if old.Linux != nil {
+		if err := validateRestoreNamespaces(old.Linux.Namespaces, new.Linux.Namespaces); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(old.Linux.UIDMappings, new.Linux.UIDMappings) {
+			return fmt.Errorf("UID mappings changed")
+		}
+		if !reflect.DeepEqual(old.Linux.GIDMappings, new.Linux.GIDMappings) {
+			return fmt.Errorf("GID mappings changed")
+		}
+		if !reflect.DeepEqual(old.Linux.Sysctl, new.Linux.Sysctl) {
+			return fmt.Errorf("sysctls changed")
+		}
+	}
+	return nil
+}
+
+func validateRestoreNamespaces(old, new []specs.LinuxNamespace) error {
+	if len(old) != len(new) {
+		return fmt.Errorf("number of namespaces changed from %d to %d", len(old), len(new))
+	}
+	for _, o := range old {
+		n, ok := GetNS(o.Type, &specs.Spec{Linux: &specs.Linux{Namespaces: new}})
+		if !ok {
+			return fmt.Errorf("namespace %q removed", o.Type)
+		}
+		if o.Type != specs.NetworkNamespace && o.Path != n.Path {
+			return fmt.Errorf("namespace %q path changed from %q to %q", o.Type, o.Path, n.Path)
+		}
+	}
+	return nil
+}
+
+// RestoreEnvDiff returns the environment variables in new that are absent
+// from, or have a different value in, old.
+func RestoreEnvDiff(old, new *specs.Spec) []string {
+	if new.Process == nil {
+		return nil
+	}
+	oldEnv := make(map[string]struct{})
+	if old.Process != nil {
+		for _, e := range old.Process.Env {
+			oldEnv[e] = struct{}{}
+		}
+	}
+	var diff []string
+	for _, e := range new.Process.Env {
+		if _, ok := oldEnv[e]; !ok {
+			diff = append(diff, e)
+		}
+	}
+	return diff
+}
@@ -85,6 +85,25 @@ func LogSpecDebug(orig *specs.Spec, logSeccomp bool) {
 	log.Debugf("Spec:\n%s", out)
 }
 
+// validateSysctl validates that name is a well-formed sysctl name, e.g.
+// "net.ipv4.ip_forward". Since the sandbox has its own kernel, sysctls that
+// aren't namespaced in Linux are allowed too; whether they can be honored is
+// only known once they are applied.
+func validateSysctl(name string) error {
+	if name == "" {
+		return fmt.Errorf("sysctl name can't be empty")
+	}
+	if strings.Contains(name, "/") {
+		return fmt.Errorf("sysctl %q must use '.' as separator", name)
+	}
+	for _, c := range strings.Split(name, ".") {
+		if c == "" {
+			return fmt.Errorf("sysctl %q has an empty component", name)
+		}
+	}
+	return nil
+}
+
 // ValidateSpec validates that the spec is compatible with runsc.
 func ValidateSpec(spec *specs.Spec) error {
 	// Mandatory fields.
@@ -133,6 +152,13 @@ func ValidateSpec(spec *specs.Spec) error {
 			return err
 		}
 	}
+	if spec.Linux != nil {
+		for name := range spec.Linux.Sysctl {
+			if err := validateSysctl(name); err != nil {
+				return err
+			}
+		}
+	}
 
 	// CRI specifies whether a container should start a new sandbox, or run
 	// another container in an existing sandbox.
@@ -196,6 +222,12 @@ func ReadSpecFromFile(bundleDir string, specFile *os.File, conf *config.Config)
 	if err := json.Unmarshal(specBytes, &spec); err != nil {
 		return nil, fmt.Errorf("error unmarshaling spec from file %q: %v\n %s", specFile.Name(), err, string(specBytes))
 	}
+	// With a SELinux personality, every task runs with the same unconfined
+	// context, so the label of the process is ignored like AppArmor profiles.
+	if conf.LSM == config.LSMSELinux && spec.Process != nil && spec.Process.SelinuxLabel != "" {
+		log.Warningf("SELinux label %q is being ignored", spec.Process.SelinuxLabel)
+		spec.Process.SelinuxLabel = ""
+	}
 	if err := ValidateSpec(&spec); err != nil {
 		return nil, err
 	}
@@ -241,13 +273,9 @@ func fixSpec(spec *specs.Spec, bundleDir string, conf *config.Config) error {
 	}
 
 	// Check annotation to see if container name is available.
-	var containerName string
-	for key, val := range spec.Annotations {
-		if key == annotationContainerName {
-			containerName = val
-			log.Debugf("Container name: %q", containerName)
-			break
-		}
+	containerName := ContainerName(spec)
+	if containerName != "" {
+		log.Debugf("Container name: %q", containerName)
 	}
 	for annotation, val := range spec.Annotations {
 		if strings.HasPrefix(annotation, annotationFlagPrefix) {
@@ -274,6 +302,12 @@ func fixSpec(spec *specs.Spec, bundleDir string, conf *config.Config) error {
 	return nil
 }
 
+// ContainerName returns the Kubernetes name of the container from the spec
+// annotations, or "" if it isn't set.
+func ContainerName(spec *specs.Spec) string {
+	return spec.Annotations[annotationContainerName]
+}
+
 // ReadMounts reads mount list from a file.
 func ReadMounts(f *os.File) ([]specs.Mount, error) {
 	bytes, err := ioutil.ReadAll(f)